@@ -0,0 +1,240 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type adminOptions struct {
+	Socket  string
+	Seconds int
+	Limit   int
+	NextHop string
+	Agent   string
+}
+
+// AdminOptions stores the command-line option values for the admin commands.
+var AdminOptions adminOptions
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Administer a running instance",
+	Long: `Run administrative tasks on a running instance. Commands use the
+administrative socket of the HTTP server (admin-socket key of the http
+section).`,
+}
+
+var adminHealthCmd = &cobra.Command{
+	Use:   "health",
+	Short: "Check health",
+	Long:  `Display the result of the healthchecks of a running instance.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		status, body, err := adminRequest(http.MethodGet, "/api/v0/healthcheck", nil)
+		if err != nil {
+			return err
+		}
+		if err := adminPrint(cmd.OutOrStdout(), body); err != nil {
+			return err
+		}
+		if status != http.StatusOK {
+			return errors.New("instance is not healthy")
+		}
+		return nil
+	},
+}
+
+var adminCacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage caches",
+}
+
+var adminCacheInvalidateCmd = &cobra.Command{
+	Use:   "invalidate [EXPORTER [IFINDEX...]]",
+	Short: "Invalidate metadata cache",
+	Long: `Invalidate the metadata cached for an exporter, optionally restricted to
+some interfaces. Without exporter, the whole cache is invalidated.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		input := map[string]interface{}{"all": true}
+		if len(args) > 0 {
+			interfaces := []uint{}
+			for _, arg := range args[1:] {
+				ifIndex, err := strconv.ParseUint(arg, 10, 32)
+				if err != nil {
+					return fmt.Errorf("invalid interface index %q", arg)
+				}
+				interfaces = append(interfaces, uint(ifIndex))
+			}
+			input = map[string]interface{}{
+				"exporter":   args[0],
+				"interfaces": interfaces,
+			}
+		}
+		return adminRun(cmd.OutOrStdout(), http.MethodPost, "/api/v0/inlet/admin/metadata/invalidate", input)
+	},
+}
+
+var adminReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload GeoIP databases",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminRun(cmd.OutOrStdout(), http.MethodPost, "/api/v0/inlet/admin/geoip/reload",
+			map[string]interface{}{})
+	},
+}
+
+var adminRestartCmd = &cobra.Command{
+	Use:   "restart COMPONENT",
+	Short: "Restart a component",
+	Long: `Restart a component of the inlet without restarting the inlet. The
+component can be kafka or routing. Connections are closed and established
+again. If the component cannot be started again, the inlet stops.`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"kafka", "routing"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return adminRun(cmd.OutOrStdout(), http.MethodPost,
+			"/api/v0/inlet/admin/restart/"+url.PathEscape(args[0]), map[string]interface{}{})
+	},
+}
+
+var adminTopTalkersCmd = &cobra.Command{
+	Use:   "top-talkers",
+	Short: "Display top talkers",
+	Long: `Sample the flows forwarded by the inlet during a few seconds and display
+the source and destination addresses with the most traffic.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("seconds", strconv.Itoa(AdminOptions.Seconds))
+		query.Set("limit", strconv.Itoa(AdminOptions.Limit))
+		return adminRun(cmd.OutOrStdout(), http.MethodGet,
+			"/api/v0/inlet/admin/top-talkers?"+query.Encode(), nil)
+	},
+}
+
+var adminRIBCmd = &cobra.Command{
+	Use:   "rib",
+	Short: "Query routing information",
+}
+
+var adminRIBLookupCmd = &cobra.Command{
+	Use:   "lookup IP",
+	Short: "Lookup an IP address",
+	Long: `Display the routing information for an IP address, as used to enrich
+flows.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		query := url.Values{}
+		query.Set("ip", args[0])
+		if AdminOptions.NextHop != "" {
+			query.Set("next-hop", AdminOptions.NextHop)
+		}
+		if AdminOptions.Agent != "" {
+			query.Set("agent", AdminOptions.Agent)
+		}
+		return adminRun(cmd.OutOrStdout(), http.MethodGet,
+			"/api/v0/inlet/admin/routing/lookup?"+query.Encode(), nil)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(adminCmd)
+	adminCmd.PersistentFlags().StringVar(&AdminOptions.Socket, "socket", "/run/akvorado/admin.sock",
+		"Administrative socket of the instance")
+	adminCmd.AddCommand(adminHealthCmd, adminCacheCmd, adminReloadCmd, adminRestartCmd,
+		adminTopTalkersCmd, adminRIBCmd)
+	adminCacheCmd.AddCommand(adminCacheInvalidateCmd)
+	adminRIBCmd.AddCommand(adminRIBLookupCmd)
+	adminTopTalkersCmd.Flags().IntVar(&AdminOptions.Seconds, "seconds", 10,
+		"Number of seconds to sample flows")
+	adminTopTalkersCmd.Flags().IntVar(&AdminOptions.Limit, "limit", 10,
+		"Number of addresses to display")
+	adminRIBLookupCmd.Flags().StringVar(&AdminOptions.NextHop, "next-hop", "",
+		"Next hop of the route")
+	adminRIBLookupCmd.Flags().StringVar(&AdminOptions.Agent, "agent", "",
+		"Exporter of the flow")
+}
+
+// adminRequest sends a request to the administrative socket and returns the
+// HTTP status and the body of the answer.
+func adminRequest(method, path string, input interface{}) (int, []byte, error) {
+	client := http.Client{
+		// Top talkers are sampled for up to one minute
+		Timeout: 90 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", AdminOptions.Socket)
+			},
+		},
+	}
+	var body io.Reader
+	if input != nil {
+		encoded, err := json.Marshal(input)
+		if err != nil {
+			return 0, nil, fmt.Errorf("cannot encode request: %w", err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, "http://akvorado"+path, body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot build request: %w", err)
+	}
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot query %s: %w", AdminOptions.Socket, err)
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("cannot read answer: %w", err)
+	}
+	return resp.StatusCode, answer, nil
+}
+
+// adminRun sends a request to the administrative socket and displays the
+// answer. An error is returned if the request is not successful.
+func adminRun(w io.Writer, method, path string, input interface{}) error {
+	status, body, err := adminRequest(method, path, input)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		var answer struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(body, &answer); err == nil && answer.Message != "" {
+			return errors.New(answer.Message)
+		}
+		return fmt.Errorf("unexpected status %d", status)
+	}
+	return adminPrint(w, body)
+}
+
+// adminPrint displays the provided JSON answer.
+func adminPrint(w io.Writer, body []byte) error {
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", "  "); err != nil {
+		return fmt.Errorf("cannot decode answer: %w", err)
+	}
+	out.WriteByte('\n')
+	_, err := out.WriteTo(w)
+	return err
+}
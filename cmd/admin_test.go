@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/cmd"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+func TestAdmin(t *testing.T) {
+	r := reporter.NewMock(t)
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	config := httpserver.DefaultConfiguration()
+	config.Listen = "127.0.0.1:0"
+	config.AdminSocket = socket
+	h, err := httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	// Answer with the received request
+	echo := func(gc *gin.Context) {
+		var input interface{}
+		gc.ShouldBindJSON(&input)
+		gc.JSON(http.StatusOK, gin.H{
+			"path":  gc.Request.URL.Path,
+			"query": gc.Request.URL.RawQuery,
+			"input": input,
+		})
+	}
+	h.GinRouter.GET("/api/v0/healthcheck", func(gc *gin.Context) {
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"status": "error"})
+	})
+	h.GinRouter.POST("/api/v0/inlet/admin/metadata/invalidate", echo)
+	h.GinRouter.POST("/api/v0/inlet/admin/geoip/reload", func(gc *gin.Context) {
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot open database."})
+	})
+	h.GinRouter.POST("/api/v0/inlet/admin/restart/:component", echo)
+	h.GinRouter.GET("/api/v0/inlet/admin/top-talkers", echo)
+	h.GinRouter.GET("/api/v0/inlet/admin/routing/lookup", echo)
+	helpers.StartStop(t, h)
+
+	cases := []struct {
+		Description string
+		Args        []string
+		Error       string
+		Expected    gin.H
+	}{
+		{
+			Description: "health",
+			Args:        []string{"admin", "health"},
+			Error:       "instance is not healthy",
+			Expected:    gin.H{"status": "error"},
+		}, {
+			Description: "invalidate all",
+			Args:        []string{"admin", "cache", "invalidate"},
+			Expected: gin.H{
+				"path":  "/api/v0/inlet/admin/metadata/invalidate",
+				"query": "",
+				"input": gin.H{"all": true},
+			},
+		}, {
+			Description: "invalidate interfaces",
+			Args:        []string{"admin", "cache", "invalidate", "192.0.2.1", "10", "11"},
+			Expected: gin.H{
+				"path":  "/api/v0/inlet/admin/metadata/invalidate",
+				"query": "",
+				"input": gin.H{"exporter": "192.0.2.1", "interfaces": []int{10, 11}},
+			},
+		}, {
+			Description: "invalid interface",
+			Args:        []string{"admin", "cache", "invalidate", "192.0.2.1", "eth0"},
+			Error:       `invalid interface index "eth0"`,
+		}, {
+			Description: "reload",
+			Args:        []string{"admin", "reload"},
+			Error:       "Cannot open database.",
+		}, {
+			Description: "restart",
+			Args:        []string{"admin", "restart", "kafka"},
+			Expected: gin.H{
+				"path":  "/api/v0/inlet/admin/restart/kafka",
+				"query": "",
+				"input": gin.H{},
+			},
+		}, {
+			Description: "restart without component",
+			Args:        []string{"admin", "restart"},
+			Error:       "accepts 1 arg(s), received 0",
+		}, {
+			Description: "top talkers",
+			Args:        []string{"admin", "top-talkers", "--seconds", "5"},
+			Expected: gin.H{
+				"path":  "/api/v0/inlet/admin/top-talkers",
+				"query": "limit=10&seconds=5",
+				"input": nil,
+			},
+		}, {
+			Description: "RIB lookup",
+			Args:        []string{"admin", "rib", "lookup", "192.0.2.1", "--agent", "198.51.100.1"},
+			Expected: gin.H{
+				"path":  "/api/v0/inlet/admin/routing/lookup",
+				"query": "agent=198.51.100.1&ip=192.0.2.1",
+				"input": nil,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			root := cmd.RootCmd
+			buf := new(bytes.Buffer)
+			root.SetOut(buf)
+			root.SetArgs(append(tc.Args, "--socket", socket))
+			err := root.Execute()
+			if tc.Error != "" {
+				if err == nil || err.Error() != tc.Error {
+					t.Fatalf("Execute() error == %v, expected %q", err, tc.Error)
+				}
+			} else if err != nil {
+				t.Fatalf("Execute() error:\n%+v", err)
+			}
+			if tc.Expected == nil {
+				return
+			}
+			var got gin.H
+			if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("Unmarshal() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("Execute() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
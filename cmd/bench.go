@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"akvorado/common/daemon"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/demoexporter/flows"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/input/udp"
+)
+
+type benchInletOptions struct {
+	Target       string
+	MetricsURL   string
+	Protocol     string
+	Rate         float64
+	Duration     time.Duration
+	Flows        int
+	SamplingRate int
+	Workers      int
+}
+
+// BenchInletOptions stores the command-line option values for the inlet
+// benchmark command.
+var BenchInletOptions benchInletOptions
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Run benchmarks",
+	Long:  `Run benchmarks against Akvorado services.`,
+}
+
+var benchInletCmd = &cobra.Command{
+	Use:   "inlet",
+	Short: "Benchmark flow ingestion",
+	Long: `Send synthetic NetFlow or sFlow packets at a target rate to an inlet
+service and report the achieved rate, the drops and the CPU usage. Without
+a target, an in-process flow component is used to only measure decoding
+performance.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return benchInlet(cmd.OutOrStdout(), BenchInletOptions)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(benchCmd)
+	benchCmd.AddCommand(benchInletCmd)
+	benchInletCmd.Flags().StringVarP(&BenchInletOptions.Target, "target", "t", "",
+		"UDP address of a running inlet (in-process flow component if empty)")
+	benchInletCmd.Flags().StringVarP(&BenchInletOptions.MetricsURL, "metrics", "m", "",
+		"Base URL of the HTTP server of the running inlet, to collect drops and CPU usage")
+	benchInletCmd.Flags().StringVarP(&BenchInletOptions.Protocol, "protocol", "p", "netflow",
+		"Protocol to use (netflow or sflow)")
+	benchInletCmd.Flags().Float64VarP(&BenchInletOptions.Rate, "rate", "r", 1000,
+		"Target rate in packets per second")
+	benchInletCmd.Flags().DurationVar(&BenchInletOptions.Duration, "duration", 10*time.Second,
+		"Duration of the benchmark")
+	benchInletCmd.Flags().IntVar(&BenchInletOptions.Flows, "flows", 10000,
+		"Number of distinct flows to generate and replay")
+	benchInletCmd.Flags().IntVar(&BenchInletOptions.SamplingRate, "sampling-rate", 1000,
+		"Sampling rate advertised in generated packets")
+	benchInletCmd.Flags().IntVar(&BenchInletOptions.Workers, "workers", 1,
+		"Number of UDP workers for the in-process flow component")
+}
+
+// benchMetrics are the metrics we need to compute the benchmark results.
+var benchMetrics = map[string]string{
+	"packets":         "akvorado_inlet_flow_input_udp_packets_total",
+	"in_dropped":      "akvorado_inlet_flow_input_udp_in_dropped_packets_total",
+	"out_dropped":     "akvorado_inlet_flow_input_udp_out_dropped_packets_total",
+	"decoded":         "akvorado_inlet_flow_input_udp_decoded_flows_total",
+	"decoding_errors": "akvorado_inlet_flow_decoder_errors_total",
+	"cpu":             "process_cpu_seconds_total",
+}
+
+// benchResult contains the results of an inlet benchmark.
+type benchResult struct {
+	Elapsed     time.Duration
+	SentPackets int
+	SentFlows   int
+	SendErrors  int
+	// Deltas of metrics from the inlet (missing when not available)
+	Metrics map[string]float64
+}
+
+func benchInlet(out io.Writer, options benchInletOptions) error {
+	if options.Rate <= 0 {
+		return errors.New("rate should be positive")
+	}
+	if options.Flows <= 0 {
+		return errors.New("number of flows should be positive")
+	}
+	if options.Protocol != "netflow" && options.Protocol != "sflow" {
+		return fmt.Errorf("unknown protocol %q", options.Protocol)
+	}
+
+	// Setup an in-process flow component if needed
+	var scrape func() (map[string]float64, error)
+	if options.Target == "" {
+		stop, target, scrapeInProcess, err := benchInletInProcess(options.Protocol, options.Workers)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		options.Target = target
+		scrape = scrapeInProcess
+	} else if options.MetricsURL != "" {
+		url := fmt.Sprintf("%s/api/v0/inlet/metrics", strings.TrimRight(options.MetricsURL, "/"))
+		scrape = func() (map[string]float64, error) {
+			resp, err := http.Get(url)
+			if err != nil {
+				return nil, fmt.Errorf("cannot fetch metrics: %w", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("cannot fetch metrics: unexpected status %s", resp.Status)
+			}
+			return parseMetrics(resp.Body, benchMetrics)
+		}
+	}
+
+	conn, err := net.Dial("udp", options.Target)
+	if err != nil {
+		return fmt.Errorf("cannot create socket to %q: %w", options.Target, err)
+	}
+	defer conn.Close()
+	agent := conn.LocalAddr().(*net.UDPAddr).IP
+	if agent.To4() == nil {
+		agent = net.ParseIP("192.0.2.1")
+	}
+	payloads, err := flows.GeneratePayloads(options.Protocol, options.Flows, options.SamplingRate, agent, 0)
+	if err != nil {
+		return fmt.Errorf("cannot generate payloads: %w", err)
+	}
+
+	var before map[string]float64
+	if scrape != nil {
+		if before, err = scrape(); err != nil {
+			return err
+		}
+	}
+	result := benchSend(conn, payloads, options.Rate, options.Duration)
+	if scrape != nil {
+		// Let the inlet process the remaining packets
+		time.Sleep(time.Second)
+		after, err := scrape()
+		if err != nil {
+			return err
+		}
+		result.Metrics = map[string]float64{}
+		for key, value := range after {
+			result.Metrics[key] = value - before[key]
+		}
+	}
+	result.write(out, options)
+	return nil
+}
+
+// benchInletInProcess starts an in-process flow component listening on a
+// random port. It returns a function to stop it, the address to send packets
+// to and a function to scrape its metrics.
+func benchInletInProcess(protocol string, workers int) (func(), string, func() (map[string]float64, error), error) {
+	r, err := reporter.New(reporter.DefaultConfiguration())
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to initialize reporter: %w", err)
+	}
+	daemonComponent, err := daemon.New(r)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to initialize daemon component: %w", err)
+	}
+	httpConfiguration := httpserver.DefaultConfiguration()
+	httpConfiguration.Listen = ""
+	httpComponent, err := httpserver.New(r, httpConfiguration, httpserver.Dependencies{
+		Daemon: daemonComponent,
+	})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to initialize HTTP component: %w", err)
+	}
+	schemaComponent, err := schema.New(schema.DefaultConfiguration())
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to initialize schema component: %w", err)
+	}
+
+	// Find a free port
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("cannot find a free port: %w", err)
+	}
+	target := probe.LocalAddr().String()
+	probe.Close()
+
+	udpConfiguration := udp.DefaultConfiguration().(*udp.Configuration)
+	udpConfiguration.Listen = target
+	if workers > 0 {
+		udpConfiguration.Workers = workers
+	}
+	flowConfiguration := flow.DefaultConfiguration()
+	flowConfiguration.Inputs = []flow.InputConfiguration{{
+		Decoder: protocol,
+		Config:  udpConfiguration,
+	}}
+	flowComponent, err := flow.New(r, flowConfiguration, flow.Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+		Schema: schemaComponent,
+	})
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("unable to initialize flow component: %w", err)
+	}
+	if err := flowComponent.Start(); err != nil {
+		return nil, "", nil, fmt.Errorf("unable to start flow component: %w", err)
+	}
+	// Drain decoded flows
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range flowComponent.Flows() {
+		}
+	}()
+
+	stop := func() {
+		flowComponent.Stop()
+		<-done
+	}
+	scrape := func() (map[string]float64, error) {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/api/v0/inlet/metrics", nil)
+		r.MetricsHTTPHandler().ServeHTTP(recorder, request)
+		return parseMetrics(recorder.Body, benchMetrics)
+	}
+	return stop, target, scrape, nil
+}
+
+// benchSend sends the payloads at the target rate (in packets per second)
+// for the provided duration.
+func benchSend(conn net.Conn, payloads flows.Payloads, rate float64, duration time.Duration) benchResult {
+	result := benchResult{}
+	send := func(payload []byte) bool {
+		if _, err := conn.Write(payload); err != nil {
+			result.SendErrors++
+			return false
+		}
+		result.SentPackets++
+		return true
+	}
+
+	const tick = 10 * time.Millisecond
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	start := time.Now()
+	lastTemplates := time.Time{}
+	next := 0
+	for {
+		now := time.Now()
+		if now.Sub(start) >= duration {
+			break
+		}
+		if now.Sub(lastTemplates) >= time.Second {
+			for _, payload := range payloads.Templates {
+				send(payload)
+			}
+			lastTemplates = now
+		}
+		// Compute how many packets should have been sent by now.
+		budget := rate*now.Sub(start).Seconds() - float64(result.SentPackets+result.SendErrors)
+		for ; budget >= 1; budget-- {
+			if send(payloads.Data[next]) {
+				result.SentFlows += payloads.Flows[next]
+			}
+			next = (next + 1) % len(payloads.Data)
+		}
+		<-ticker.C
+	}
+	result.Elapsed = time.Since(start)
+	return result
+}
+
+// parseMetrics extracts the provided metrics (a map from keys to metric
+// names) from a Prometheus text exposition. Values are summed across labels.
+func parseMetrics(in io.Reader, metrics map[string]string) (map[string]float64, error) {
+	wanted := map[string]string{}
+	for key, name := range metrics {
+		wanted[name] = key
+	}
+	result := map[string]float64{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, rest, _ := strings.Cut(line, " ")
+		if idx := strings.IndexByte(line, '{'); idx != -1 && idx < len(name) {
+			name = line[:idx]
+			end := strings.LastIndexByte(line, '}')
+			if end == -1 {
+				continue
+			}
+			rest = line[end+1:]
+		}
+		key, ok := wanted[name]
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse value for %s: %w", name, err)
+		}
+		result[key] += value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read metrics: %w", err)
+	}
+	return result, nil
+}
+
+// write outputs the benchmark results.
+func (result benchResult) write(out io.Writer, options benchInletOptions) {
+	seconds := result.Elapsed.Seconds()
+	fmt.Fprintf(out, "Protocol:          %s\n", options.Protocol)
+	fmt.Fprintf(out, "Target:            %s\n", options.Target)
+	fmt.Fprintf(out, "Duration:          %s\n", result.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(out, "Sent packets:      %d (%.1f pps, target %.1f pps)\n",
+		result.SentPackets, float64(result.SentPackets)/seconds, options.Rate)
+	fmt.Fprintf(out, "Sent flows:        %d (%.1f flows/s)\n",
+		result.SentFlows, float64(result.SentFlows)/seconds)
+	fmt.Fprintf(out, "Send errors:       %d\n", result.SendErrors)
+	if result.Metrics == nil {
+		return
+	}
+	if packets, ok := result.Metrics["packets"]; ok {
+		fmt.Fprintf(out, "Received packets:  %.0f (%.1f pps)\n", packets, packets/seconds)
+	}
+	if decoded, ok := result.Metrics["decoded"]; ok {
+		fmt.Fprintf(out, "Decoded flows:     %.0f (%.1f flows/s)\n", decoded, decoded/seconds)
+	}
+	fmt.Fprintf(out, "Dropped packets:   %.0f (kernel), %.0f (queue)\n",
+		result.Metrics["in_dropped"], result.Metrics["out_dropped"])
+	fmt.Fprintf(out, "Decoding errors:   %.0f\n", result.Metrics["decoding_errors"])
+	if result.SentFlows > 0 {
+		lost := float64(result.SentFlows) - result.Metrics["decoded"]
+		fmt.Fprintf(out, "Lost flows:        %.0f (%.2f%%)\n",
+			lost, 100*lost/float64(result.SentFlows))
+	}
+	if cpu, ok := result.Metrics["cpu"]; ok {
+		if options.MetricsURL == "" {
+			// In-process: this includes the generator.
+			fmt.Fprintf(out, "Process CPU:       %.2fs (%.1f%%)\n", cpu, 100*cpu/seconds)
+		} else {
+			fmt.Fprintf(out, "Inlet CPU:         %.2fs (%.1f%%)\n", cpu, 100*cpu/seconds)
+		}
+	}
+}
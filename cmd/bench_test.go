@@ -0,0 +1,69 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+func TestParseMetrics(t *testing.T) {
+	input := `# HELP akvorado_inlet_flow_input_udp_packets_total Packets received by the application.
+# TYPE akvorado_inlet_flow_input_udp_packets_total counter
+akvorado_inlet_flow_input_udp_packets_total{exporter="127.0.0.1",listener=":2055",worker="0"} 100
+akvorado_inlet_flow_input_udp_packets_total{exporter="127.0.0.2",listener=":2055",worker="1"} 50
+akvorado_inlet_flow_input_udp_in_dropped_packets_total{listener=":2055",worker="0"} 3
+akvorado_inlet_flow_input_udp_decoded_flows_total{exporter="127.0.0.1",listener="{weird} label",worker="0"} 2000
+akvorado_inlet_flow_input_udp_bytes_total{exporter="127.0.0.1",listener=":2055",worker="0"} 150000
+process_cpu_seconds_total 1.5
+`
+	got, err := parseMetrics(strings.NewReader(input), benchMetrics)
+	if err != nil {
+		t.Fatalf("parseMetrics() error:\n%+v", err)
+	}
+	expected := map[string]float64{
+		"packets":    150,
+		"in_dropped": 3,
+		"decoded":    2000,
+		"cpu":        1.5,
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("parseMetrics() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestBenchInlet(t *testing.T) {
+	for _, protocol := range []string{"netflow", "sflow"} {
+		t.Run(protocol, func(t *testing.T) {
+			out := bytes.NewBuffer([]byte{})
+			err := benchInlet(out, benchInletOptions{
+				Protocol:     protocol,
+				Rate:         100,
+				Duration:     300 * time.Millisecond,
+				Flows:        100,
+				SamplingRate: 1000,
+				Workers:      1,
+			})
+			if err != nil {
+				t.Fatalf("benchInlet() error:\n%+v", err)
+			}
+			output := out.String()
+			for _, expected := range []string{
+				"Protocol:          " + protocol,
+				"Decoded flows:",
+				"Dropped packets:   0 (kernel), 0 (queue)",
+				"Decoding errors:   0",
+				"Lost flows:        0 (0.00%)",
+			} {
+				if !strings.Contains(output, expected) {
+					t.Errorf("benchInlet() output does not contain %q:\n%s", expected, output)
+				}
+			}
+		})
+	}
+}
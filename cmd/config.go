@@ -23,6 +23,7 @@ import (
 	"akvorado/common/helpers/yaml"
 
 	"akvorado/common/helpers"
+	"akvorado/common/reporter"
 )
 
 // ConfigRelatedOptions are command-line options related to handling a
@@ -105,7 +106,7 @@ func (c ConfigRelatedOptions) Parse(out io.Writer, component string, config inte
 			continue
 		}
 		kk := strings.Split(kv[0], "_")
-		if len(kk) < 4 || kk[0] != "AKVORADO" || kk[1] != "CFG" || kk[2] != strings.ReplaceAll(strings.ToUpper(component), "-", "") {
+		if len(kk) < 4 || kk[0] != "AKVORADO" || (kk[1] != "CFG" && kk[1] != "CFGFILE") || kk[2] != strings.ReplaceAll(strings.ToUpper(component), "-", "") {
 			continue
 		}
 		// From AKVORADO_CFG_CMP_SQUID_PURPLE_QUIRK=47, we
@@ -114,6 +115,15 @@ func (c ConfigRelatedOptions) Parse(out io.Writer, component string, config inte
 		// build "squid[3] -> purple -> 47"
 		var rawConfig interface{}
 		rawConfig = kv[1]
+		if kk[1] == "CFGFILE" {
+			// With AKVORADO_CFGFILE_CMP_SQUID=/run/secrets/squid,
+			// the value is read from the provided file.
+			content, err := os.ReadFile(kv[1])
+			if err != nil {
+				return fmt.Errorf("unable to read override %q: %w", kv[0], err)
+			}
+			rawConfig = strings.TrimRight(string(content), "\r\n")
+		}
 		for i := len(kk) - 1; i > 2; i-- {
 			if index, err := strconv.Atoi(kk[i]); err == nil {
 				newRawConfig := make([]interface{}, index+1)
@@ -237,3 +247,18 @@ func ZeroSliceHook() (mapstructure.DecodeHookFunc, func()) {
 	}
 	return hook, disable
 }
+
+// reportSubnetMapOverlaps logs the overlapping subnets found in the subnet
+// maps of the provided configuration. The most specific subnet takes
+// precedence.
+func reportSubnetMapOverlaps(r *reporter.Reporter, config interface{}) {
+	helpers.WalkSubnetMaps(config, func(path string, sm helpers.SubnetMapInspector) {
+		for _, overlap := range sm.Overlaps() {
+			r.Info().
+				Str("path", path).
+				Str("subnet", overlap.Subnet.String()).
+				Str("parent", overlap.Parent.String()).
+				Msg("subnet overlaps with a larger subnet, most specific subnet takes precedence")
+		}
+	})
+}
@@ -6,6 +6,7 @@ package cmd_test
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -255,6 +256,42 @@ module2:
 	}
 }
 
+func TestSecretsFromFiles(t *testing.T) {
+	dir := t.TempDir()
+	config := `---
+module1:
+ listen: !file listen.secret
+ topic: flows
+module2:
+ stuff: !env AKVORADO_TEST_STUFF
+`
+	configFile := filepath.Join(dir, "config.yaml")
+	os.WriteFile(configFile, []byte(config), 0o644)
+	os.WriteFile(filepath.Join(dir, "listen.secret"), []byte("127.0.0.1:9000\n"), 0o644)
+	topicFile := filepath.Join(dir, "topic.secret")
+	os.WriteFile(topicFile, []byte("secret-topic\n"), 0o644)
+	t.Setenv("AKVORADO_TEST_STUFF", "hello")
+	t.Setenv("AKVORADO_CFGFILE_DUMMY_MODULE1_TOPIC", topicFile)
+
+	c := cmd.ConfigRelatedOptions{
+		Path: configFile,
+	}
+	parsed := dummyConfiguration{}
+	if err := c.Parse(io.Discard, "dummy", &parsed); err != nil {
+		t.Fatalf("Parse() error:\n%+v", err)
+	}
+	got := []string{parsed.Module1.Listen, parsed.Module1.Topic, parsed.Module2.Stuff}
+	expected := []string{"127.0.0.1:9000", "secret-topic", "hello"}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("Parse() (-got, +want):\n%s", diff)
+	}
+
+	t.Setenv("AKVORADO_CFGFILE_DUMMY_MODULE1_TOPIC", filepath.Join(dir, "missing.secret"))
+	if err := c.Parse(io.Discard, "dummy", &parsed); err == nil {
+		t.Fatal("Parse() did not error with a missing secret file")
+	}
+}
+
 func TestHTTPConfiguration(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/x-yaml; charset=utf-8")
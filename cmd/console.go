@@ -11,6 +11,7 @@ import (
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
 	"akvorado/common/httpserver"
+	"akvorado/common/leader"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/console"
@@ -27,6 +28,7 @@ type ConsoleConfiguration struct {
 	Auth       authentication.Configuration
 	Database   database.Configuration
 	Schema     schema.Configuration
+	Leader     leader.Configuration
 }
 
 // Reset resets the console configuration to its default value.
@@ -39,6 +41,7 @@ func (c *ConsoleConfiguration) Reset() {
 		Auth:       authentication.DefaultConfiguration(),
 		Database:   database.DefaultConfiguration(),
 		Schema:     schema.DefaultConfiguration(),
+		Leader:     leader.DefaultConfiguration(),
 	}
 }
 
@@ -69,6 +72,7 @@ manage collected flows.`,
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
+		reportSubnetMapOverlaps(r, config)
 		return consoleStart(r, config, ConsoleOptions.CheckMode)
 	},
 }
@@ -110,6 +114,12 @@ func consoleStart(r *reporter.Reporter, config ConsoleConfiguration, checkOnly b
 	if err != nil {
 		return fmt.Errorf("unable to initialize schema component: %w", err)
 	}
+	leaderComponent, err := leader.New(r, "console", config.Leader, leader.Dependencies{
+		ClickHouse: clickhouseComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize leader election component: %w", err)
+	}
 	consoleComponent, err := console.New(r, config.Console, console.Dependencies{
 		Daemon:       daemonComponent,
 		HTTP:         httpComponent,
@@ -117,6 +127,7 @@ func consoleStart(r *reporter.Reporter, config ConsoleConfiguration, checkOnly b
 		Auth:         authenticationComponent,
 		Database:     databaseComponent,
 		Schema:       schemaComponent,
+		Leader:       leaderComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize console component: %w", err)
@@ -124,6 +135,7 @@ func consoleStart(r *reporter.Reporter, config ConsoleConfiguration, checkOnly b
 
 	// Expose some informations and metrics
 	addCommonHTTPHandlers(r, "console", httpComponent)
+	addSchemaHTTPHandlers("console", httpComponent, schemaComponent)
 	versionMetrics(r)
 
 	// If we only asked for a check, stop here.
@@ -135,6 +147,7 @@ func consoleStart(r *reporter.Reporter, config ConsoleConfiguration, checkOnly b
 	components := []interface{}{
 		httpComponent,
 		clickhouseComponent,
+		leaderComponent,
 		authenticationComponent,
 		databaseComponent,
 		consoleComponent,
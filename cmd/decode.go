@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+	"github.com/netsampler/goflow2/v2/decoders/netflow"
+	"github.com/netsampler/goflow2/v2/decoders/sflow"
+	"github.com/spf13/cobra"
+
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+	nfdecoder "akvorado/inlet/flow/decoder/netflow"
+	"akvorado/inlet/flow/decoder/record"
+	sfdecoder "akvorado/inlet/flow/decoder/sflow"
+)
+
+type decodeOptions struct {
+	Decoder string
+}
+
+// DecodeOptions stores the command-line option values for the decode
+// command.
+var DecodeOptions decodeOptions
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode FILE...",
+	Short: "Decode flow packets",
+	Long: `Decode NetFlow, IPFIX, or sFlow packets and display them as JSON, both as
+sent by the exporter (templates, fields, and values) and as flows once decoded
+by Akvorado. Each file is either a raw packet or a pcap/pcapng capture. Files
+are decoded in order, so templates can be provided in a first file.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return decodeFiles(cmd.OutOrStdout(), DecodeOptions.Decoder, args)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(decodeCmd)
+	decodeCmd.Flags().StringVar(&DecodeOptions.Decoder, "decoder", "auto",
+		"Decoder to use (auto, netflow, ipfix, or sflow)")
+}
+
+// decodedPacket is the result of decoding one packet.
+type decodedPacket struct {
+	File     string                   `json:"file"`
+	Packet   int                      `json:"packet"`
+	Exporter string                   `json:"exporter"`
+	Decoder  string                   `json:"decoder,omitempty"`
+	Raw      interface{}              `json:"raw,omitempty"`
+	Error    string                   `json:"error,omitempty"`
+	Flows    []map[string]interface{} `json:"flows"`
+}
+
+// packetDecoder decodes packets while keeping the state (templates) between
+// them.
+type packetDecoder struct {
+	r         *reporter.Reporter
+	schema    *schema.Component
+	name      string
+	decoders  map[string]decoder.Decoder
+	templates map[string]netflow.NetFlowTemplateSystem
+}
+
+var decodeDecoders = map[string]decoder.NewDecoderFunc{
+	"netflow": nfdecoder.New,
+	"ipfix":   nfdecoder.NewIPFIX,
+	"sflow":   sfdecoder.New,
+}
+
+// decodeFiles decodes the packets contained in the provided files and writes
+// the result as JSON.
+func decodeFiles(w io.Writer, name string, paths []string) error {
+	if _, ok := decodeDecoders[name]; !ok && name != "auto" {
+		return fmt.Errorf("unknown decoder %q", name)
+	}
+	r, err := reporter.New(reporter.DefaultConfiguration())
+	if err != nil {
+		return fmt.Errorf("unable to initialize reporter: %w", err)
+	}
+	// Enable all columns to get everything the decoders are able to extract.
+	schemaConfiguration := schema.DefaultConfiguration()
+	for key := schema.ColumnTimeReceived; key < schema.ColumnLast; key++ {
+		schemaConfiguration.Enabled = append(schemaConfiguration.Enabled, key)
+	}
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		return fmt.Errorf("unable to initialize schema component: %w", err)
+	}
+	pd := &packetDecoder{
+		r:         r,
+		schema:    sch,
+		name:      name,
+		decoders:  map[string]decoder.Decoder{},
+		templates: map[string]netflow.NetFlowTemplateSystem{},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	for _, path := range paths {
+		idx := 0
+		if err := readPackets(path, func(payload []byte, source net.IP) error {
+			idx++
+			result := pd.decode(payload, source)
+			result.File = path
+			result.Packet = idx
+			return encoder.Encode(result)
+		}); err != nil {
+			return fmt.Errorf("cannot decode %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// decode decodes a packet with goflow2 to get its raw content and with the
+// decoders of Akvorado to get the flows.
+func (pd *packetDecoder) decode(payload []byte, source net.IP) decodedPacket {
+	exporter := source.String()
+	result := decodedPacket{
+		Exporter: exporter,
+		Flows:    []map[string]interface{}{},
+	}
+	name := pd.name
+	if name == "auto" {
+		name = detectDecoder(payload)
+		if name == "" {
+			result.Error = "unknown protocol"
+			return result
+		}
+	}
+	result.Decoder = name
+
+	// Raw content
+	var err error
+	switch name {
+	case "netflow", "ipfix":
+		templates, ok := pd.templates[exporter]
+		if !ok {
+			templates = netflow.CreateTemplateSystem()
+			pd.templates[exporter] = templates
+		}
+		var (
+			packetNFv9  netflow.NFv9Packet
+			packetIPFIX netflow.IPFIXPacket
+		)
+		err = netflow.DecodeMessageVersion(bytes.NewBuffer(payload), templates, &packetNFv9, &packetIPFIX)
+		if packetNFv9.Version == 9 {
+			result.Raw = &packetNFv9
+		} else if packetIPFIX.Version == 10 {
+			result.Raw = &packetIPFIX
+		}
+	case "sflow":
+		var packet sflow.Packet
+		err = sflow.DecodeMessageVersion(bytes.NewBuffer(payload), &packet)
+		result.Raw = &packet
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	// Flows
+	dec, ok := pd.decoders[name]
+	if !ok {
+		dec = decodeDecoders[name](pd.r, decoder.Dependencies{Schema: pd.schema}, decoder.Option{})
+		pd.decoders[name] = dec
+	}
+	for _, flow := range dec.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      payload,
+		Source:       source,
+	}) {
+		m, err := record.ToMap(pd.schema, flow)
+		if err != nil {
+			result.Error = err.Error()
+			continue
+		}
+		result.Flows = append(result.Flows, m)
+	}
+	return result
+}
+
+// detectDecoder returns the decoder to use for the provided packet, using
+// the version in its header.
+func detectDecoder(payload []byte) string {
+	if len(payload) >= 2 {
+		switch binary.BigEndian.Uint16(payload) {
+		case 9, 10:
+			return "netflow"
+		}
+	}
+	if len(payload) >= 4 && binary.BigEndian.Uint32(payload) == 5 {
+		return "sflow"
+	}
+	return ""
+}
+
+var (
+	pcapMagics = [][]byte{
+		{0xa1, 0xb2, 0xc3, 0xd4}, {0xd4, 0xc3, 0xb2, 0xa1}, // microseconds
+		{0xa1, 0xb2, 0x3c, 0x4d}, {0x4d, 0x3c, 0xb2, 0xa1}, // nanoseconds
+	}
+	pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+)
+
+// readPackets calls the provided function for each UDP payload in a pcap or
+// pcapng file, or once with the whole content for other files.
+func readPackets(path string, fn func(payload []byte, source net.IP) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buffered := bufio.NewReader(f)
+	magic, _ := buffered.Peek(4)
+
+	var reader interface {
+		ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+		LinkType() layers.LinkType
+	}
+	switch {
+	case bytes.Equal(magic, pcapngMagic):
+		reader, err = pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+	case slices.ContainsFunc(pcapMagics, func(m []byte) bool { return bytes.Equal(magic, m) }):
+		reader, err = pcapgo.NewReader(buffered)
+	default:
+		payload, err := io.ReadAll(buffered)
+		if err != nil {
+			return err
+		}
+		return fn(payload, net.ParseIP("127.0.0.1"))
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read file header: %w", err)
+	}
+	for {
+		data, _, err := reader.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot read packet: %w", err)
+		}
+		packet := gopacket.NewPacket(data, reader.LinkType(), gopacket.DecodeOptions{Lazy: true})
+		udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+		if !ok {
+			continue
+		}
+		var source net.IP
+		switch network := packet.NetworkLayer().(type) {
+		case *layers.IPv4:
+			source = network.SrcIP
+		case *layers.IPv6:
+			source = network.SrcIP
+		default:
+			continue
+		}
+		if err := fn(udp.Payload, source); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestDecode(t *testing.T) {
+	netflowData := filepath.Join("..", "inlet", "flow", "decoder", "netflow", "testdata")
+	sflowData := filepath.Join("..", "inlet", "flow", "decoder", "sflow", "testdata")
+
+	// sFlow packet as a raw file
+	raw := filepath.Join(t.TempDir(), "sflow.raw")
+	if err := os.WriteFile(raw, helpers.ReadPcapL4(t, filepath.Join(sflowData, "data-1140.pcap")), 0o644); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+
+	cases := []struct {
+		Description string
+		Files       []string
+		Decoder     string
+		Expected    []string // decoder, error and number of flows for each packet
+	}{
+		{
+			Description: "NetFlow data without template",
+			Files:       []string{filepath.Join(netflowData, "data.pcap")},
+			Decoder:     "auto",
+			Expected:    []string{"netflow/error/0"},
+		}, {
+			Description: "NetFlow template and data",
+			Files: []string{
+				filepath.Join(netflowData, "template.pcap"),
+				filepath.Join(netflowData, "data.pcap"),
+			},
+			Decoder:  "netflow",
+			Expected: []string{"netflow/ok/0", "netflow/ok/4"},
+		}, {
+			Description: "sFlow raw packet",
+			Files:       []string{raw},
+			Decoder:     "auto",
+			Expected:    []string{"sflow/ok/5"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := decodeFiles(&buf, tc.Decoder, tc.Files); err != nil {
+				t.Fatalf("decodeFiles() error:\n%+v", err)
+			}
+			got := []string{}
+			decoder := json.NewDecoder(&buf)
+			for decoder.More() {
+				var result decodedPacket
+				if err := decoder.Decode(&result); err != nil {
+					t.Fatalf("Decode() error:\n%+v", err)
+				}
+				status := "ok"
+				if result.Error != "" {
+					status = "error"
+				}
+				got = append(got, fmt.Sprintf("%s/%s/%d", result.Decoder, status, len(result.Flows)))
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("decodeFiles() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	if err := decodeFiles(&bytes.Buffer{}, "unknown", []string{raw}); err == nil {
+		t.Fatal("decodeFiles() did not error on unknown decoder")
+	}
+}
@@ -16,8 +16,14 @@ import (
 func addCommonHTTPHandlers(r *reporter.Reporter, service string, httpComponent *httpserver.Component) {
 	httpComponent.AddHandler(fmt.Sprintf("/api/v0/%s/metrics", service), r.MetricsHTTPHandler())
 	httpComponent.AddHandler("/api/v0/metrics", r.MetricsHTTPHandler())
+	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/admin/metrics", service), r.MetricsListHTTPHandler)
+	httpComponent.GinRouter.GET("/api/v0/admin/metrics", r.MetricsListHTTPHandler)
 	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/healthcheck", service), r.HealthcheckHTTPHandler)
 	httpComponent.GinRouter.GET("/api/v0/healthcheck", r.HealthcheckHTTPHandler)
+	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/healthcheck/live", service), r.LivenessHTTPHandler)
+	httpComponent.GinRouter.GET("/api/v0/healthcheck/live", r.LivenessHTTPHandler)
+	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/healthcheck/ready", service), r.HealthcheckHTTPHandler)
+	httpComponent.GinRouter.GET("/api/v0/healthcheck/ready", r.HealthcheckHTTPHandler)
 	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/version", service), versionHandler)
 	httpComponent.GinRouter.GET("/api/v0/version", versionHandler)
 }
@@ -18,47 +18,56 @@ import (
 	"akvorado/common/schema"
 	"akvorado/inlet/core"
 	"akvorado/inlet/flow"
+	"akvorado/inlet/flow/input/stdin"
 	"akvorado/inlet/geoip"
 	"akvorado/inlet/kafka"
 	"akvorado/inlet/metadata"
 	"akvorado/inlet/metadata/provider/snmp"
+	"akvorado/inlet/mitigation"
+	"akvorado/inlet/pool"
 	"akvorado/inlet/routing"
 	"akvorado/inlet/routing/provider/bmp"
 )
 
 // InletConfiguration represents the configuration file for the inlet command.
 type InletConfiguration struct {
-	Reporting reporter.Configuration
-	HTTP      httpserver.Configuration
-	Flow      flow.Configuration
-	Metadata  metadata.Configuration
-	Routing   routing.Configuration
-	GeoIP     geoip.Configuration
-	Kafka     kafka.Configuration
-	Core      core.Configuration
-	Schema    schema.Configuration
+	Reporting  reporter.Configuration
+	HTTP       httpserver.Configuration
+	Flow       flow.Configuration
+	Metadata   metadata.Configuration
+	Routing    routing.Configuration
+	GeoIP      geoip.Configuration
+	Kafka      kafka.Configuration
+	Mitigation mitigation.Configuration
+	Pool       pool.Configuration
+	Core       core.Configuration
+	Schema     schema.Configuration
 }
 
 // Reset resets the configuration for the inlet command to its default value.
 func (c *InletConfiguration) Reset() {
 	*c = InletConfiguration{
-		HTTP:      httpserver.DefaultConfiguration(),
-		Reporting: reporter.DefaultConfiguration(),
-		Flow:      flow.DefaultConfiguration(),
-		Metadata:  metadata.DefaultConfiguration(),
-		Routing:   routing.DefaultConfiguration(),
-		GeoIP:     geoip.DefaultConfiguration(),
-		Kafka:     kafka.DefaultConfiguration(),
-		Core:      core.DefaultConfiguration(),
-		Schema:    schema.DefaultConfiguration(),
+		HTTP:       httpserver.DefaultConfiguration(),
+		Reporting:  reporter.DefaultConfiguration(),
+		Flow:       flow.DefaultConfiguration(),
+		Metadata:   metadata.DefaultConfiguration(),
+		Routing:    routing.DefaultConfiguration(),
+		GeoIP:      geoip.DefaultConfiguration(),
+		Kafka:      kafka.DefaultConfiguration(),
+		Mitigation: mitigation.DefaultConfiguration(),
+		Pool:       pool.DefaultConfiguration(),
+		Core:       core.DefaultConfiguration(),
+		Schema:     schema.DefaultConfiguration(),
 	}
-	c.Metadata.Provider.Config = snmp.DefaultConfiguration()
+	c.Metadata.Providers = []metadata.ProviderConfiguration{{Config: snmp.DefaultConfiguration()}}
 	c.Routing.Provider.Config = bmp.DefaultConfiguration()
 }
 
 type inletOptions struct {
 	ConfigRelatedOptions
-	CheckMode bool
+	CheckMode   bool
+	Input       string
+	InputFormat string
 }
 
 // InletOptions stores the command-line option values for the inlet
@@ -77,11 +86,15 @@ enrichment and export to Kafka.`,
 		if err := InletOptions.Parse(cmd.OutOrStdout(), "inlet", &config); err != nil {
 			return err
 		}
+		if err := InletOptions.overrideInputs(&config); err != nil {
+			return err
+		}
 
 		r, err := reporter.New(config.Reporting)
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
+		reportSubnetMapOverlaps(r, config)
 		return inletStart(r, config, InletOptions.CheckMode)
 	},
 }
@@ -92,6 +105,32 @@ func init() {
 		"Dump configuration before starting")
 	inletCmd.Flags().BoolVarP(&InletOptions.CheckMode, "check", "C", false,
 		"Check configuration, but does not start")
+	inletCmd.Flags().StringVar(&InletOptions.Input, "input", "",
+		"Replace configured flow inputs (only \"stdin\" is supported)")
+	inletCmd.Flags().StringVar(&InletOptions.InputFormat, "input-format", "json",
+		"Format of flow records read from standard input (json or protobuf)")
+}
+
+// overrideInputs replaces the configured flow inputs with the one requested
+// on the command line, if any.
+func (o inletOptions) overrideInputs(config *InletConfiguration) error {
+	switch o.Input {
+	case "":
+		return nil
+	case "stdin":
+	default:
+		return fmt.Errorf("unknown input %q", o.Input)
+	}
+	switch o.InputFormat {
+	case "json", "protobuf":
+	default:
+		return fmt.Errorf("unknown input format %q", o.InputFormat)
+	}
+	config.Flow.Inputs = []flow.InputConfiguration{{
+		Decoder: o.InputFormat,
+		Config:  stdin.DefaultConfiguration(),
+	}}
+	return nil
 }
 
 func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool) error {
@@ -120,6 +159,7 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 	}
 	metadataComponent, err := metadata.New(r, config.Metadata, metadata.Dependencies{
 		Daemon: daemonComponent,
+		HTTP:   httpComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize metadata component: %w", err)
@@ -143,15 +183,31 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 	if err != nil {
 		return fmt.Errorf("unable to initialize Kafka component: %w", err)
 	}
+	mitigationComponent, err := mitigation.New(r, config.Mitigation, mitigation.Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+		Schema: schemaComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize mitigation component: %w", err)
+	}
+	poolComponent, err := pool.New(r, config.Pool, pool.Dependencies{
+		Daemon: daemonComponent,
+		HTTP:   httpComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize pool component: %w", err)
+	}
 	coreComponent, err := core.New(r, config.Core, core.Dependencies{
-		Daemon:   daemonComponent,
-		Flow:     flowComponent,
-		Metadata: metadataComponent,
-		Routing:  routingComponent,
-		GeoIP:    geoipComponent,
-		Kafka:    kafkaComponent,
-		HTTP:     httpComponent,
-		Schema:   schemaComponent,
+		Daemon:     daemonComponent,
+		Flow:       flowComponent,
+		Metadata:   metadataComponent,
+		Routing:    routingComponent,
+		GeoIP:      geoipComponent,
+		Kafka:      kafkaComponent,
+		Mitigation: mitigationComponent,
+		HTTP:       httpComponent,
+		Schema:     schemaComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize core component: %w", err)
@@ -159,6 +215,7 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 
 	// Expose some informations and metrics
 	addCommonHTTPHandlers(r, "inlet", httpComponent)
+	addSchemaHTTPHandlers("inlet", httpComponent, schemaComponent)
 	versionMetrics(r)
 
 	// If we only asked for a check, stop here.
@@ -173,8 +230,10 @@ func inletStart(r *reporter.Reporter, config InletConfiguration, checkOnly bool)
 		routingComponent,
 		geoipComponent,
 		kafkaComponent,
+		mitigationComponent,
 		coreComponent,
 		flowComponent,
+		poolComponent,
 	}
 	return StartStopComponents(r, daemonComponent, components)
 }
@@ -234,7 +293,7 @@ func InletConfigurationUnmarshallerHook() mapstructure.DecodeHookFunc {
 				}
 
 				providerValue["type"] = "snmp"
-				metadataValue["provider"] = providerValue
+				metadataValue["providers"] = []interface{}{providerValue}
 				from.SetMapIndex(reflect.ValueOf("metadata"), reflect.ValueOf(metadataValue))
 				from.SetMapIndex(*snmpKey, reflect.Value{})
 			}
@@ -29,3 +29,20 @@ func TestInlet(t *testing.T) {
 		t.Errorf("`inlet` error:\n%+v", err)
 	}
 }
+
+func TestInletOverrideInputs(t *testing.T) {
+	config := InletConfiguration{}
+	config.Reset()
+	if err := (inletOptions{Input: "stdin", InputFormat: "protobuf"}).overrideInputs(&config); err != nil {
+		t.Fatalf("overrideInputs() error:\n%+v", err)
+	}
+	if len(config.Flow.Inputs) != 1 || config.Flow.Inputs[0].Decoder != "protobuf" {
+		t.Fatalf("overrideInputs() inputs: %+v", config.Flow.Inputs)
+	}
+	if err := (inletOptions{Input: "udp", InputFormat: "json"}).overrideInputs(&config); err == nil {
+		t.Fatal("overrideInputs() did not error on unknown input")
+	}
+	if err := (inletOptions{Input: "stdin", InputFormat: "yaml"}).overrideInputs(&config); err == nil {
+		t.Fatal("overrideInputs() did not error on unknown format")
+	}
+}
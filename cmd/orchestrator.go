@@ -5,12 +5,17 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
 	"akvorado/common/httpserver"
+	"akvorado/common/leader"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/orchestrator"
@@ -25,6 +30,7 @@ type OrchestratorConfiguration struct {
 	ClickHouseDB clickhousedb.Configuration `yaml:"-"`
 	ClickHouse   clickhouse.Configuration
 	Kafka        kafka.Configuration
+	Leader       leader.Configuration
 	Orchestrator orchestrator.Configuration `mapstructure:",squash" yaml:",inline"`
 	Schema       schema.Configuration
 	// Other service configurations
@@ -45,6 +51,7 @@ func (c *OrchestratorConfiguration) Reset() {
 		ClickHouseDB: clickhousedb.DefaultConfiguration(),
 		ClickHouse:   clickhouse.DefaultConfiguration(),
 		Kafka:        kafka.DefaultConfiguration(),
+		Leader:       leader.DefaultConfiguration(),
 		Orchestrator: orchestrator.DefaultConfiguration(),
 		Schema:       schema.DefaultConfiguration(),
 		// Other service configurations
@@ -57,6 +64,7 @@ func (c *OrchestratorConfiguration) Reset() {
 type orchestratorOptions struct {
 	ConfigRelatedOptions
 	CheckMode bool
+	Watch     bool
 }
 
 // OrchestratorOptions stores the command-line option values for the orchestrator
@@ -72,19 +80,7 @@ components and centralizes configuration of the various other components.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config := OrchestratorConfiguration{}
 		OrchestratorOptions.Path = args[0]
-		OrchestratorOptions.BeforeDump = func() {
-			// Override some parts of the configuration
-			config.ClickHouseDB = config.ClickHouse.Configuration
-			config.ClickHouse.Kafka.Configuration = config.Kafka.Configuration
-			for idx := range config.Inlet {
-				config.Inlet[idx].Kafka.Configuration = config.Kafka.Configuration
-				config.Inlet[idx].Schema = config.Schema
-			}
-			for idx := range config.Console {
-				config.Console[idx].ClickHouse = config.ClickHouse.Configuration
-				config.Console[idx].Schema = config.Schema
-			}
-		}
+		OrchestratorOptions.BeforeDump = config.propagate
 		if err := OrchestratorOptions.Parse(cmd.OutOrStdout(), "orchestrator", &config); err != nil {
 			return err
 		}
@@ -93,19 +89,37 @@ components and centralizes configuration of the various other components.`,
 		if err != nil {
 			return fmt.Errorf("unable to initialize reporter: %w", err)
 		}
-		return orchestratorStart(r, config, OrchestratorOptions.CheckMode)
+		reportSubnetMapOverlaps(r, config)
+		return orchestratorStart(r, config, OrchestratorOptions)
 	},
 }
 
+// propagate overrides some parts of the configuration of the other
+// services with the ones from the orchestrator.
+func (config *OrchestratorConfiguration) propagate() {
+	config.ClickHouseDB = config.ClickHouse.Configuration
+	config.ClickHouse.Kafka.Configuration = config.Kafka.Configuration
+	for idx := range config.Inlet {
+		config.Inlet[idx].Kafka.Configuration = config.Kafka.Configuration
+		config.Inlet[idx].Schema = config.Schema
+	}
+	for idx := range config.Console {
+		config.Console[idx].ClickHouse = config.ClickHouse.Configuration
+		config.Console[idx].Schema = config.Schema
+	}
+}
+
 func init() {
 	RootCmd.AddCommand(orchestratorCmd)
 	orchestratorCmd.Flags().BoolVarP(&OrchestratorOptions.ConfigRelatedOptions.Dump, "dump", "D", false,
 		"Dump configuration before starting")
 	orchestratorCmd.Flags().BoolVarP(&OrchestratorOptions.CheckMode, "check", "C", false,
 		"Check configuration, but does not start")
+	orchestratorCmd.Flags().BoolVarP(&OrchestratorOptions.Watch, "watch", "W", false,
+		"Watch configuration file and reload service configurations on change")
 }
 
-func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, checkOnly bool) error {
+func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, options orchestratorOptions) error {
 	daemonComponent, err := daemon.New(r)
 	if err != nil {
 		return fmt.Errorf("unable to initialize daemon component: %w", err)
@@ -130,11 +144,18 @@ func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, c
 	if err != nil {
 		return fmt.Errorf("unable to initialize ClickHouse component: %w", err)
 	}
+	leaderComponent, err := leader.New(r, "orchestrator", config.Leader, leader.Dependencies{
+		ClickHouse: clickhouseDBComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize leader election component: %w", err)
+	}
 	clickhouseComponent, err := clickhouse.New(r, config.ClickHouse, clickhouse.Dependencies{
 		Daemon:     daemonComponent,
 		HTTP:       httpComponent,
 		ClickHouse: clickhouseDBComponent,
 		Schema:     schemaComponent,
+		Leader:     leaderComponent,
 	})
 	if err != nil {
 		return fmt.Errorf("unable to initialize clickhouse component: %w", err)
@@ -145,22 +166,15 @@ func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, c
 	if err != nil {
 		return fmt.Errorf("unable to initialize orchestrator component: %w", err)
 	}
-	for idx := range config.Inlet {
-		orchestratorComponent.RegisterConfiguration(orchestrator.InletService, config.Inlet[idx])
-	}
-	for idx := range config.Console {
-		orchestratorComponent.RegisterConfiguration(orchestrator.ConsoleService, config.Console[idx])
-	}
-	for idx := range config.DemoExporter {
-		orchestratorComponent.RegisterConfiguration(orchestrator.DemoExporterService, config.DemoExporter[idx])
-	}
+	orchestratorRegisterConfigurations(orchestratorComponent, config)
 
 	// Expose some informations and metrics
 	addCommonHTTPHandlers(r, "orchestrator", httpComponent)
+	addSchemaHTTPHandlers("orchestrator", httpComponent, schemaComponent)
 	versionMetrics(r)
 
 	// If we only asked for a check, stop here.
-	if checkOnly {
+	if options.CheckMode {
 		return nil
 	}
 
@@ -168,8 +182,56 @@ func orchestratorStart(r *reporter.Reporter, config OrchestratorConfiguration, c
 	components := []interface{}{
 		httpComponent,
 		clickhouseDBComponent,
+		leaderComponent,
 		clickhouseComponent,
 		kafkaComponent,
 	}
+	if options.Watch && options.Path != "" && !strings.HasPrefix(options.Path, "http://") && !strings.HasPrefix(options.Path, "https://") {
+		components = append(components, newConfigWatcher(r, options.Path, time.Second,
+			orchestratorReload(r, orchestratorComponent, options.ConfigRelatedOptions, config)))
+	}
 	return StartStopComponents(r, daemonComponent, components)
 }
+
+// orchestratorRegisterConfigurations registers the configurations of the other
+// services to the orchestrator component.
+func orchestratorRegisterConfigurations(component *orchestrator.Component, config OrchestratorConfiguration) {
+	component.ReplaceConfigurations(orchestrator.InletService, toInterfaces(config.Inlet))
+	component.ReplaceConfigurations(orchestrator.ConsoleService, toInterfaces(config.Console))
+	component.ReplaceConfigurations(orchestrator.DemoExporterService, toInterfaces(config.DemoExporter))
+}
+
+func toInterfaces[T any](configurations []T) []interface{} {
+	result := make([]interface{}, len(configurations))
+	for idx := range configurations {
+		result[idx] = configurations[idx]
+	}
+	return result
+}
+
+// orchestratorReload returns a function reloading the configuration file. Only
+// the configurations of the other services are updated. Other changes require
+// a restart of the orchestrator.
+func orchestratorReload(r *reporter.Reporter, component *orchestrator.Component, options ConfigRelatedOptions, current OrchestratorConfiguration) func() error {
+	return func() error {
+		config := OrchestratorConfiguration{}
+		options.Dump = false
+		options.BeforeDump = config.propagate
+		if err := options.Parse(io.Discard, "orchestrator", &config); err != nil {
+			return err
+		}
+		if reflect.DeepEqual(config, current) {
+			return nil
+		}
+		newOwn, currentOwn := config, current
+		newOwn.Inlet, newOwn.Console, newOwn.DemoExporter = nil, nil, nil
+		currentOwn.Inlet, currentOwn.Console, currentOwn.DemoExporter = nil, nil, nil
+		if !reflect.DeepEqual(newOwn, currentOwn) {
+			r.Warn().Msg("orchestrator configuration has changed, restart to apply it")
+		}
+		orchestratorRegisterConfigurations(component, config)
+		current = config
+		r.Info().Msg("service configurations reloaded")
+		return nil
+	}
+}
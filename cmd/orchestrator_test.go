@@ -5,6 +5,9 @@ package cmd
 
 import (
 	"bytes"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -14,14 +17,16 @@ import (
 
 	"akvorado/common/helpers"
 	"akvorado/common/helpers/yaml"
+	"akvorado/common/httpserver"
 	"akvorado/common/reporter"
+	"akvorado/orchestrator"
 )
 
 func TestOrchestratorStart(t *testing.T) {
 	r := reporter.NewMock(t)
 	config := OrchestratorConfiguration{}
 	config.Reset()
-	if err := orchestratorStart(r, config, true); err != nil {
+	if err := orchestratorStart(r, config, orchestratorOptions{CheckMode: true}); err != nil {
 		t.Fatalf("orchestratorStart() error:\n%+v", err)
 	}
 }
@@ -108,3 +113,68 @@ func TestOrchestrator(t *testing.T) {
 		t.Errorf("`orchestrator` error:\n%+v", err)
 	}
 }
+
+func TestOrchestratorReload(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(duration string) {
+		config := fmt.Sprintf(`---
+inlet:
+ - metadata:
+    cache-duration: %s
+`, duration)
+		if err := os.WriteFile(configFile, []byte(config), 0o644); err != nil {
+			t.Fatalf("WriteFile() error:\n%+v", err)
+		}
+	}
+	write("10m")
+	options := ConfigRelatedOptions{Path: configFile}
+	config := OrchestratorConfiguration{}
+	options.BeforeDump = config.propagate
+	if err := options.Parse(io.Discard, "orchestrator", &config); err != nil {
+		t.Fatalf("Parse() error:\n%+v", err)
+	}
+
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	c, err := orchestrator.New(r, orchestrator.DefaultConfiguration(), orchestrator.Dependencies{HTTP: h})
+	if err != nil {
+		t.Fatalf("orchestrator.New() error:\n%+v", err)
+	}
+	orchestratorRegisterConfigurations(c, config)
+	reload := orchestratorReload(r, c, options, config)
+
+	check := func(expected string) {
+		t.Helper()
+		resp, err := http.Get(fmt.Sprintf("http://%s/api/v0/orchestrator/configuration/inlet", h.LocalAddr()))
+		if err != nil {
+			t.Fatalf("GET error:\n%+v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var got struct {
+			Metadata struct {
+				CacheDuration string `yaml:"cacheduration"`
+			}
+		}
+		if err := yaml.Unmarshal(body, &got); err != nil {
+			t.Fatalf("yaml.Unmarshal() error:\n%+v", err)
+		}
+		if got.Metadata.CacheDuration != expected {
+			t.Fatalf("cache duration = %q, expected %q", got.Metadata.CacheDuration, expected)
+		}
+	}
+	check("10m0s")
+
+	write("20m")
+	if err := reload(); err != nil {
+		t.Fatalf("reload() error:\n%+v", err)
+	}
+	check("20m0s")
+
+	// An invalid configuration is not applied
+	write("blah")
+	if err := reload(); err == nil {
+		t.Fatal("reload() did not error")
+	}
+	check("20m0s")
+}
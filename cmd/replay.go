@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/core"
+	"akvorado/inlet/geoip"
+)
+
+type replayOptions struct {
+	ConfigRelatedOptions
+}
+
+// ReplayOptions stores the command-line option values for the replay
+// command.
+var ReplayOptions replayOptions
+
+var replayCmd = &cobra.Command{
+	Use:   "replay CONFIG RECORDING",
+	Short: "Replay recorded enrichment decisions",
+	Long: `Enrich again the flows recorded by an inlet using the provided inlet
+configuration and display the differences with the recorded outputs. The
+answers of the metadata and routing components are taken from the recording.
+The command fails if any difference is found.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := InletConfiguration{}
+		ReplayOptions.Path = args[0]
+		if err := ReplayOptions.Parse(cmd.OutOrStdout(), "inlet", &config); err != nil {
+			return err
+		}
+		r, err := reporter.New(config.Reporting)
+		if err != nil {
+			return fmt.Errorf("unable to initialize reporter: %w", err)
+		}
+		f, err := os.Open(args[1])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return replayRecording(r, config, f, cmd.OutOrStdout())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(replayCmd)
+}
+
+// replayRecording replays the enrichment records read from in and writes the
+// differences to out.
+func replayRecording(r *reporter.Reporter, config InletConfiguration, in io.Reader, out io.Writer) error {
+	// Never record while replaying
+	config.Core.Recording.File = ""
+
+	daemonComponent, err := daemon.New(r)
+	if err != nil {
+		return fmt.Errorf("unable to initialize daemon component: %w", err)
+	}
+	schemaComponent, err := schema.New(config.Schema)
+	if err != nil {
+		return fmt.Errorf("unable to initialize schema component: %w", err)
+	}
+	geoipComponent, err := geoip.New(r, config.GeoIP, geoip.Dependencies{
+		Daemon: daemonComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize GeoIP component: %w", err)
+	}
+	// The core component is not started: only its enrichment logic is used.
+	coreComponent, err := core.New(r, config.Core, core.Dependencies{
+		Daemon: daemonComponent,
+		GeoIP:  geoipComponent,
+		Schema: schemaComponent,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize core component: %w", err)
+	}
+	if err := geoipComponent.Start(); err != nil {
+		return fmt.Errorf("unable to start GeoIP component: %w", err)
+	}
+	defer geoipComponent.Stop()
+
+	replayer := coreComponent.NewReplayer()
+	decoder := json.NewDecoder(in)
+	decoder.UseNumber()
+	total, different := 0, 0
+	for {
+		var rec core.EnrichmentRecord
+		if err := decoder.Decode(&rec); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("cannot decode record %d: %w", total+1, err)
+		}
+		total++
+		got, err := replayer.Replay(rec)
+		if err != nil {
+			return fmt.Errorf("cannot replay record %d: %w", total, err)
+		}
+		if got, err = normalizeReplayedFlow(got); err != nil {
+			return fmt.Errorf("cannot replay record %d: %w", total, err)
+		}
+		diff := diffReplayedFlows(rec.Output, got)
+		if len(diff) == 0 {
+			continue
+		}
+		different++
+		fmt.Fprintf(out, "record %d:\n", total)
+		for _, line := range diff {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(out, "%d records replayed, %d with differences\n", total, different)
+	if different > 0 {
+		return fmt.Errorf("%d records with differences", different)
+	}
+	return nil
+}
+
+// normalizeReplayedFlow encodes the replayed flow to JSON and decodes it back
+// to make it comparable with the recorded one.
+func normalizeReplayedFlow(flow map[string]interface{}) (map[string]interface{}, error) {
+	if flow == nil {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(flow)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var normalized map[string]interface{}
+	if err := decoder.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return normalized, nil
+}
+
+// diffReplayedFlows returns the differences between the recorded and the
+// replayed flows, one line per column. A nil flow means it was skipped.
+func diffReplayedFlows(recorded, replayed map[string]interface{}) []string {
+	switch {
+	case recorded == nil && replayed == nil:
+		return nil
+	case recorded == nil:
+		return []string{"flow was skipped, now enriched"}
+	case replayed == nil:
+		return []string{"flow was enriched, now skipped"}
+	}
+	keys := map[string]struct{}{}
+	for key := range recorded {
+		keys[key] = struct{}{}
+	}
+	for key := range replayed {
+		keys[key] = struct{}{}
+	}
+	diff := []string{}
+	for key := range keys {
+		before, after := recorded[key], replayed[key]
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+		diff = append(diff, fmt.Sprintf("%s: %s -> %s", key, replayedValue(before), replayedValue(after)))
+	}
+	sort.Strings(diff)
+	return diff
+}
+
+// replayedValue formats a column value for display.
+func replayedValue(value interface{}) string {
+	if value == nil {
+		return "(none)"
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
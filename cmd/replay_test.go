@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/core"
+	"akvorado/inlet/metadata/provider"
+)
+
+func TestReplay(t *testing.T) {
+	r := reporter.NewMock(t)
+	answer := func(name string) provider.Answer {
+		return provider.Answer{
+			Exporter:  provider.Exporter{Name: "edge1"},
+			Interface: provider.Interface{Name: name, Description: "Transit", Speed: 1000},
+		}
+	}
+	records := []core.EnrichmentRecord{
+		{
+			Input: map[string]interface{}{
+				"TimeReceived":    1712822400,
+				"SamplingRate":    1000,
+				"ExporterAddress": "192.0.2.1",
+				"InIf":            10,
+				"OutIf":           20,
+			},
+			Lookups: core.EnrichmentLookups{
+				Metadata: []provider.Answer{answer("Gi0/0/10"), answer("Gi0/0/20")},
+			},
+			Output: map[string]interface{}{
+				"TimeReceived":     1712822400,
+				"SamplingRate":     1000,
+				"ExporterAddress":  "192.0.2.1",
+				"ExporterName":     "edge1",
+				"InIf":             10,
+				"OutIf":            20,
+				"InIfName":         "Gi0/0/10",
+				"OutIfName":        "Gi0/0/20",
+				"InIfDescription":  "Transit",
+				"OutIfDescription": "Transit",
+				"InIfSpeed":        1000,
+				"OutIfSpeed":       1000,
+			},
+		}, {
+			// Skipped because of a cache miss
+			Input: map[string]interface{}{
+				"TimeReceived":    1712822400,
+				"SamplingRate":    1000,
+				"ExporterAddress": "192.0.2.1",
+				"InIf":            10,
+				"OutIf":           30,
+			},
+		},
+	}
+	var recording bytes.Buffer
+	encoder := json.NewEncoder(&recording)
+	for _, rec := range records {
+		if err := encoder.Encode(rec); err != nil {
+			t.Fatalf("Encode() error:\n%+v", err)
+		}
+	}
+
+	t.Run("same configuration", func(t *testing.T) {
+		config := InletConfiguration{}
+		config.Reset()
+		var out bytes.Buffer
+		if err := replayRecording(r, config, bytes.NewReader(recording.Bytes()), &out); err != nil {
+			t.Fatalf("replayRecording() error:\n%+v\n%s", err, out.String())
+		}
+		if diff := helpers.Diff(out.String(), "2 records replayed, 0 with differences\n"); diff != "" {
+			t.Fatalf("replayRecording() (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("new classifier", func(t *testing.T) {
+		config := InletConfiguration{}
+		config.Reset()
+		var exporterRule core.ExporterClassifierRule
+		if err := exporterRule.UnmarshalText([]byte(`ClassifySite("paris")`)); err != nil {
+			t.Fatalf("UnmarshalText() error:\n%+v", err)
+		}
+		config.Core.ExporterClassifiers = []core.ExporterClassifierRule{exporterRule}
+		var out bytes.Buffer
+		err := replayRecording(r, config, bytes.NewReader(recording.Bytes()), &out)
+		if err == nil {
+			t.Fatal("replayRecording() did not error")
+		}
+		if diff := helpers.Diff(out.String(), `record 1:
+  ExporterSite: (none) -> "paris"
+2 records replayed, 1 with differences
+`); diff != "" {
+			t.Fatalf("replayRecording() (-got, +want):\n%s", diff)
+		}
+	})
+}
+
+func TestDiffReplayedFlows(t *testing.T) {
+	got := diffReplayedFlows(map[string]interface{}{
+		"ExporterName": "edge1",
+		"InIfName":     "Gi0/0/10",
+		"SrcAS":        json.Number("65000"),
+	}, map[string]interface{}{
+		"ExporterName": "edge1",
+		"ExporterSite": "paris",
+		"SrcAS":        json.Number("65001"),
+	})
+	expected := []string{
+		`ExporterSite: (none) -> "paris"`,
+		`InIfName: "Gi0/0/10" -> (none)`,
+		`SrcAS: 65000 -> 65001`,
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("diffReplayedFlows() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/tabwriter"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cobra"
+
+	"akvorado/common/httpserver"
+	"akvorado/common/schema"
+)
+
+type schemaOptions struct {
+	ConfigRelatedOptions
+	JSON bool
+}
+
+// SchemaOptions stores the command-line option values for the schema
+// command.
+var SchemaOptions schemaOptions
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema [orchestrator configuration]",
+	Short: "Document the flow schema",
+	Long: `Display the columns of the flow schema with their types, their status and where
+their values come from. When the orchestrator configuration is provided, the
+schema is customized accordingly.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config := OrchestratorConfiguration{}
+		SchemaOptions.Path = ""
+		if len(args) > 0 {
+			SchemaOptions.Path = args[0]
+		}
+		SchemaOptions.BeforeDump = config.propagate
+		if err := SchemaOptions.Parse(cmd.OutOrStdout(), "orchestrator", &config); err != nil {
+			return err
+		}
+		sch, err := schema.New(config.Schema)
+		if err != nil {
+			return fmt.Errorf("unable to initialize schema component: %w", err)
+		}
+
+		if SchemaOptions.JSON {
+			output, err := json.MarshalIndent(sch.Documentation(), "", "  ")
+			if err != nil {
+				return err
+			}
+			cmd.Println(string(output))
+			return nil
+		}
+		w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tTYPE\tENABLED\tSOURCE")
+		for _, column := range sch.Documentation() {
+			enabled := "yes"
+			if !column.Enabled {
+				enabled = "no"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", column.Name, column.Type, enabled, column.Source)
+		}
+		return w.Flush()
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(schemaCmd)
+	schemaCmd.Flags().BoolVarP(&SchemaOptions.JSON, "json", "j", false,
+		"Output schema as JSON")
+}
+
+// addSchemaHTTPHandlers exposes the documentation of the schema. The endpoint
+// is registered under `/api/v0` and `/api/v0/SERVICE` namespaces.
+func addSchemaHTTPHandlers(service string, httpComponent *httpserver.Component, sch *schema.Component) {
+	handler := func(gc *gin.Context) {
+		gc.JSON(http.StatusOK, gin.H{"columns": sch.Documentation()})
+	}
+	httpComponent.GinRouter.GET(fmt.Sprintf("/api/v0/%s/schema", service), handler)
+	httpComponent.GinRouter.GET("/api/v0/schema", handler)
+}
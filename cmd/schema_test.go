@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"akvorado/cmd"
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+)
+
+func TestSchema(t *testing.T) {
+	root := cmd.RootCmd
+	buf := new(bytes.Buffer)
+	root.SetOut(buf)
+	root.SetArgs([]string{"schema"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("`schema` error:\n%+v", err)
+	}
+	got := strings.Fields(strings.Split(buf.String(), "\n")[1])
+	expected := []string{"TimeReceived", "DateTime", "yes", "decoder"}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("`schema` (-got, +want):\n%s", diff)
+	}
+
+	buf.Reset()
+	root.SetArgs([]string{"schema", "--json"})
+	if err := root.Execute(); err != nil {
+		t.Fatalf("`schema --json` error:\n%+v", err)
+	}
+	var columns []schema.ColumnDocumentation
+	if err := json.Unmarshal(buf.Bytes(), &columns); err != nil {
+		t.Fatalf("`schema --json` error:\n%+v", err)
+	}
+	for _, column := range columns {
+		if column.Name == "ExporterName" {
+			if column.Source != schema.ColumnSourceEnrichment {
+				t.Errorf("`schema --json` ExporterName source is %q", column.Source)
+			}
+			return
+		}
+	}
+	t.Error("`schema --json` ExporterName not found")
+}
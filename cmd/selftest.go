@@ -0,0 +1,362 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"akvorado/demoexporter/flows"
+)
+
+type selftestOptions struct {
+	Target     string
+	InletURL   string
+	ConsoleURL string
+	Timeout    time.Duration
+}
+
+// SelftestOptions stores the command-line option values for the self-test
+// command.
+var SelftestOptions selftestOptions
+
+var selftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check the flow pipeline",
+	Long: `Inject a synthetic NetFlow flow into a running inlet service and follow
+it through Kafka and ClickHouse until it can be queried from the console API.
+The stage where the flow was lost is reported. Without a console URL, the test
+stops once the inlet has sent the flow to Kafka.`,
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return selftest(cmd.OutOrStdout(), SelftestOptions, newSelftestProbe())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(selftestCmd)
+	selftestCmd.Flags().StringVarP(&SelftestOptions.Target, "target", "t", "127.0.0.1:2055",
+		"UDP address of the running inlet accepting NetFlow")
+	selftestCmd.Flags().StringVarP(&SelftestOptions.InletURL, "inlet", "i", "http://127.0.0.1:8080",
+		"Base URL of the HTTP server of the running inlet (skip inlet checks if empty)")
+	selftestCmd.Flags().StringVarP(&SelftestOptions.ConsoleURL, "console", "c", "http://127.0.0.1:8080",
+		"Base URL of the HTTP server of the running console (skip console checks if empty)")
+	selftestCmd.Flags().DurationVar(&SelftestOptions.Timeout, "timeout", time.Minute,
+		"Maximum time to wait for the flow at each stage")
+}
+
+// selftestPollInterval is the interval between two checks or two sends.
+var selftestPollInterval = time.Second
+
+// selftestMetrics are the inlet metrics needed to check the Kafka stage.
+var selftestMetrics = map[string]string{
+	"sent":   "akvorado_inlet_kafka_sent_messages_total",
+	"errors": "akvorado_inlet_kafka_errors_total",
+}
+
+// selftestProbe describes the synthetic flow used for the self-test.
+// Addresses and ports are random to be able to recognize it.
+type selftestProbe struct {
+	SrcAddr net.IP
+	DstAddr net.IP
+	SrcPort uint16
+	DstPort uint16
+}
+
+// newSelftestProbe returns a random probe, using documentation prefixes.
+func newSelftestProbe() selftestProbe {
+	return selftestProbe{
+		SrcAddr: net.IPv4(198, 51, 100, byte(1+rand.Intn(254))),
+		DstAddr: net.IPv4(203, 0, 113, byte(1+rand.Intn(254))),
+		SrcPort: uint16(1024 + rand.Intn(64511)),
+		DstPort: 9,
+	}
+}
+
+func (probe selftestProbe) String() string {
+	return fmt.Sprintf("%s:%d → %s:%d", probe.SrcAddr, probe.SrcPort, probe.DstAddr, probe.DstPort)
+}
+
+// selftestError is returned when a stage of the self-test fails.
+type selftestError struct {
+	Stage string
+}
+
+func (err selftestError) Error() string {
+	return fmt.Sprintf("self-test failed at %s stage", err.Stage)
+}
+
+func selftest(out io.Writer, options selftestOptions, probe selftestProbe) error {
+	if options.Timeout <= 0 {
+		return errors.New("timeout should be positive")
+	}
+	inletURL := strings.TrimRight(options.InletURL, "/")
+	consoleURL := strings.TrimRight(options.ConsoleURL, "/")
+	if inletURL == "" && consoleURL == "" {
+		return errors.New("at least one of inlet or console URL is needed")
+	}
+	report := func(stage, status, format string, args ...interface{}) {
+		fmt.Fprintf(out, "%-8s %-8s %s\n", stage, status, fmt.Sprintf(format, args...))
+	}
+	fail := func(stage, format string, args ...interface{}) error {
+		report(stage, "failed", format, args...)
+		return selftestError{Stage: stage}
+	}
+	fmt.Fprintf(out, "Probe flow: %s\n", probe)
+
+	start := time.Now()
+	payloads, err := flows.GenerateProbePayloads(probe.SrcAddr, probe.DstAddr,
+		probe.SrcPort, probe.DstPort, 1, start)
+	if err != nil {
+		return fmt.Errorf("cannot generate probe flow: %w", err)
+	}
+	conn, err := net.Dial("udp", options.Target)
+	if err != nil {
+		return fail("inject", "cannot create socket to %q: %s", options.Target, err)
+	}
+	defer conn.Close()
+	packets := append(append([][]byte{}, payloads.Templates...), payloads.Data...)
+	sent := 0
+	send := func() error {
+		for _, payload := range packets {
+			if _, err := conn.Write(payload); err != nil {
+				return err
+			}
+		}
+		sent++
+		return nil
+	}
+
+	if inletURL == "" {
+		if err := send(); err != nil {
+			return fail("inject", "cannot send probe flow to %s: %s", options.Target, err)
+		}
+		report("inject", "ok", "probe flow sent to %s", options.Target)
+		report("inlet", "skipped", "no inlet URL")
+		report("kafka", "skipped", "no inlet URL")
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+		defer cancel()
+		before, err := selftestScrape(ctx, inletURL)
+		if err != nil {
+			return fail("inlet", "%s", err)
+		}
+		seen, err := selftestWatchInlet(ctx, inletURL, probe)
+		if err != nil {
+			return fail("inlet", "%s", err)
+		}
+
+		// Send the probe until the inlet sees it. UDP is not reliable.
+		if err := send(); err != nil {
+			return fail("inject", "cannot send probe flow to %s: %s", options.Target, err)
+		}
+		report("inject", "ok", "probe flow sent to %s", options.Target)
+		ticker := time.NewTicker(selftestPollInterval)
+		defer ticker.Stop()
+		var exporter string
+	watch:
+		for {
+			select {
+			case exporter = <-seen:
+				break watch
+			case <-ctx.Done():
+				reason := fmt.Sprintf("probe flow not seen after %s (sent %d times)", options.Timeout, sent)
+				if drops := selftestDrops(inletURL); drops != "" {
+					reason = fmt.Sprintf("%s, recent drops: %s", reason, drops)
+				}
+				return fail("inlet", "%s", reason)
+			case <-ticker.C:
+				if err := send(); err != nil {
+					return fail("inject", "cannot send probe flow to %s: %s", options.Target, err)
+				}
+			}
+		}
+		cancel()
+		report("inlet", "ok", "probe flow from exporter %s seen after %s",
+			exporter, time.Since(start).Round(time.Millisecond))
+
+		// Give some time to the Kafka producer to report errors
+		time.Sleep(selftestPollInterval)
+		after, err := selftestScrape(context.Background(), inletURL)
+		if err != nil {
+			return fail("kafka", "%s", err)
+		}
+		if failed := after["errors"] - before["errors"]; failed > 0 {
+			return fail("kafka", "%.0f errors while sending to Kafka", failed)
+		}
+		if after["sent"]-before["sent"] < 1 {
+			return fail("kafka", "no message sent to Kafka")
+		}
+		report("kafka", "ok", "%.0f messages sent without errors", after["sent"]-before["sent"])
+	}
+
+	if consoleURL == "" {
+		report("console", "skipped", "no console URL")
+		return nil
+	}
+	deadline := time.Now().Add(options.Timeout)
+	for {
+		found, err := selftestQueryConsole(consoleURL, probe, start)
+		if err != nil {
+			return fail("console", "%s", err)
+		}
+		if found {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fail("console", "probe flow not found in ClickHouse after %s", options.Timeout)
+		}
+		time.Sleep(selftestPollInterval)
+	}
+	report("console", "ok", "probe flow queryable after %s", time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// selftestScrape fetches the inlet metrics needed for the self-test.
+func selftestScrape(ctx context.Context, inletURL string) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/v0/inlet/metrics", inletURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch metrics: unexpected status %s", resp.Status)
+	}
+	return parseMetrics(resp.Body, selftestMetrics)
+}
+
+// selftestWatchInlet watches the flows sent by the inlet to Kafka. It returns
+// a channel receiving the exporter address when the probe flow is seen. The
+// watch ends when the context is canceled.
+func selftestWatchInlet(ctx context.Context, inletURL string, probe selftestProbe) (<-chan string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/api/v0/inlet/flows", inletURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch flows: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("cannot watch flows: unexpected status %s", resp.Status)
+	}
+	seen := make(chan string, 1)
+	go func() {
+		defer resp.Body.Close()
+		decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+		for {
+			var flow struct {
+				ExporterAddress string
+				SrcAddr         string
+				DstAddr         string
+			}
+			if err := decoder.Decode(&flow); err != nil {
+				return
+			}
+			if flow.SrcAddr == probe.SrcAddr.String() && flow.DstAddr == probe.DstAddr.String() {
+				seen <- flow.ExporterAddress
+				return
+			}
+		}
+	}()
+	return seen, nil
+}
+
+// selftestDrops returns a summary of the flows dropped by the inlet during the
+// last minute. It returns an empty string if nothing was dropped or if this
+// information is not available.
+func selftestDrops(inletURL string) string {
+	resp, err := http.Get(fmt.Sprintf("%s/api/v0/inlet/admin/drops?minutes=1", inletURL))
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	var drops struct {
+		Stages []struct {
+			Stage   string
+			Dropped float64
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&drops); err != nil {
+		return ""
+	}
+	result := []string{}
+	for _, stage := range drops.Stages {
+		if stage.Dropped > 0 {
+			result = append(result, fmt.Sprintf("%.0f at %s", stage.Dropped, stage.Stage))
+		}
+	}
+	return strings.Join(result, ", ")
+}
+
+// selftestQueryConsole checks if the probe flow can be queried from the
+// console API.
+func selftestQueryConsole(consoleURL string, probe selftestProbe, start time.Time) (bool, error) {
+	now := time.Now()
+	body, err := json.Marshal(map[string]interface{}{
+		"start":  start.Add(-time.Minute).UTC(),
+		"end":    now.Add(time.Minute).UTC(),
+		"points": 5,
+		"limit":  1,
+		"units":  "l3bps",
+		"filter": fmt.Sprintf("SrcAddr = %s AND DstAddr = %s AND SrcPort = %d AND DstPort = %d",
+			probe.SrcAddr, probe.DstAddr, probe.SrcPort, probe.DstPort),
+	})
+	if err != nil {
+		return false, err
+	}
+	resp, err := http.Post(fmt.Sprintf("%s/api/v0/console/graph/line", consoleURL),
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("cannot query console: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var message struct {
+			Message string
+		}
+		json.NewDecoder(resp.Body).Decode(&message)
+		if message.Message != "" {
+			return false, fmt.Errorf("cannot query console: %s", message.Message)
+		}
+		return false, fmt.Errorf("cannot query console: unexpected status %s", resp.Status)
+	}
+	var output struct {
+		Points [][]int `json:"points"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&output); err != nil {
+		return false, fmt.Errorf("cannot decode console answer: %w", err)
+	}
+	for _, row := range output.Points {
+		for _, value := range row {
+			if value > 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// selftestFakeInlet is a fake inlet receiving the probe flow and exposing the
+// HTTP endpoints used by the self-test.
+type selftestFakeInlet struct {
+	Target   string
+	URL      string
+	received chan struct{}
+	sent     atomic.Int64
+}
+
+func newSelftestFakeInlet(t *testing.T, probe selftestProbe, forward bool) *selftestFakeInlet {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error:\n%+v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	inlet := &selftestFakeInlet{
+		Target:   conn.LocalAddr().String(),
+		received: make(chan struct{}),
+	}
+	go func() {
+		var once sync.Once
+		buf := make([]byte, 9000)
+		for {
+			if _, _, err := conn.ReadFrom(buf); err != nil {
+				return
+			}
+			if forward {
+				once.Do(func() {
+					inlet.sent.Add(1)
+					close(inlet.received)
+				})
+			}
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/inlet/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, "akvorado_inlet_kafka_sent_messages_total{exporter=\"127.0.0.1\"} %d\n",
+			inlet.sent.Load())
+	})
+	mux.HandleFunc("/api/v0/inlet/flows", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-inlet.received:
+		case <-r.Context().Done():
+			return
+		}
+		fmt.Fprintf(w, `{"ExporterAddress": "127.0.0.1", "SrcAddr": "192.0.2.1", "DstAddr": "192.0.2.2"}`+"\n")
+		fmt.Fprintf(w, `{"ExporterAddress": "127.0.0.1", "SrcAddr": "%s", "DstAddr": "%s"}`+"\n",
+			probe.SrcAddr, probe.DstAddr)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/api/v0/inlet/admin/drops", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprint(w, `{"minutes": 1, "stages": [{"stage": "decode", "dropped": 0}, {"stage": "metadata-miss", "dropped": 4}], "total": 4}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	inlet.URL = server.URL
+	return inlet
+}
+
+// newSelftestFakeConsole is a fake console answering to graph requests. It
+// returns an empty result for the first queries.
+func newSelftestFakeConsole(t *testing.T, probe selftestProbe, emptyAnswers int, status int) string {
+	t.Helper()
+	var queries atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v0/console/graph/line", func(w http.ResponseWriter, r *http.Request) {
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(r.Body)
+		expected := fmt.Sprintf(`"filter":"SrcAddr = %s AND DstAddr = %s AND SrcPort = %d AND DstPort = %d"`,
+			probe.SrcAddr, probe.DstAddr, probe.SrcPort, probe.DstPort)
+		if !strings.Contains(buf.String(), expected) {
+			t.Errorf("POST /api/v0/console/graph/line body:\n%s\nshould contain %s", buf.String(), expected)
+		}
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"message": "Cannot query."}`)
+			return
+		}
+		if queries.Add(1) <= int64(emptyAnswers) {
+			fmt.Fprint(w, `{"t": [], "rows": [], "points": []}`)
+			return
+		}
+		fmt.Fprint(w, `{"t": [], "rows": [["Other"]], "points": [[0, 0, 12000, 0, 0]]}`)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestSelftest(t *testing.T) {
+	selftestPollInterval = 10 * time.Millisecond
+	probe := selftestProbe{
+		SrcAddr: net.ParseIP("198.51.100.7"),
+		DstAddr: net.ParseIP("203.0.113.9"),
+		SrcPort: 41234,
+		DstPort: 9,
+	}
+
+	cases := []struct {
+		Description   string
+		Forward       bool
+		NoInlet       bool
+		NoConsole     bool
+		EmptyAnswers  int
+		ConsoleStatus int
+		Expected      []string
+		ExpectedStage string
+	}{
+		{
+			Description:  "ok",
+			Forward:      true,
+			EmptyAnswers: 2,
+			Expected: []string{
+				"Probe flow: 198.51.100.7:41234 → 203.0.113.9:9",
+				"inject   ok       probe flow sent to ",
+				"inlet    ok       probe flow from exporter 127.0.0.1 seen after ",
+				"kafka    ok       1 messages sent without errors",
+				"console  ok       probe flow queryable after ",
+			},
+		}, {
+			Description: "without console",
+			Forward:     true,
+			NoConsole:   true,
+			Expected: []string{
+				"inlet    ok       ",
+				"kafka    ok       ",
+				"console  skipped  no console URL",
+			},
+		}, {
+			Description: "without inlet",
+			NoInlet:     true,
+			Expected: []string{
+				"inject   ok       ",
+				"inlet    skipped  no inlet URL",
+				"kafka    skipped  no inlet URL",
+				"console  ok       ",
+			},
+		}, {
+			Description: "lost in inlet",
+			Forward:     false,
+			Expected: []string{
+				"inject   ok       ",
+				"inlet    failed   probe flow not seen after 200ms (sent ",
+				"recent drops: 4 at metadata-miss\n",
+			},
+			ExpectedStage: "inlet",
+		}, {
+			Description:  "lost in ClickHouse",
+			Forward:      true,
+			EmptyAnswers: 1000,
+			Expected: []string{
+				"kafka    ok       ",
+				"console  failed   probe flow not found in ClickHouse after 200ms",
+			},
+			ExpectedStage: "console",
+		}, {
+			Description:   "console error",
+			Forward:       true,
+			ConsoleStatus: http.StatusBadRequest,
+			Expected: []string{
+				"console  failed   cannot query console: Cannot query.",
+			},
+			ExpectedStage: "console",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			if tc.ConsoleStatus == 0 {
+				tc.ConsoleStatus = http.StatusOK
+			}
+			inlet := newSelftestFakeInlet(t, probe, tc.Forward)
+			options := selftestOptions{
+				Target:     inlet.Target,
+				InletURL:   inlet.URL,
+				ConsoleURL: newSelftestFakeConsole(t, probe, tc.EmptyAnswers, tc.ConsoleStatus),
+				Timeout:    200 * time.Millisecond,
+			}
+			if tc.NoInlet {
+				options.InletURL = ""
+			}
+			if tc.NoConsole {
+				options.ConsoleURL = ""
+			}
+
+			out := bytes.NewBuffer([]byte{})
+			err := selftest(out, options, probe)
+			output := out.String()
+			var serr selftestError
+			switch {
+			case tc.ExpectedStage == "" && err != nil:
+				t.Fatalf("selftest() error:\n%+v\n%s", err, output)
+			case tc.ExpectedStage != "" && !errors.As(err, &serr):
+				t.Fatalf("selftest() error %v, expected failure at %s stage", err, tc.ExpectedStage)
+			case tc.ExpectedStage != "":
+				if diff := helpers.Diff(serr.Stage, tc.ExpectedStage); diff != "" {
+					t.Fatalf("selftest() failed stage (-got, +want):\n%s", diff)
+				}
+			}
+			for _, expected := range tc.Expected {
+				if !strings.Contains(output, expected) {
+					t.Errorf("selftest() output does not contain %q:\n%s", expected, output)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/reporter"
+)
+
+// configWatcher watches a configuration file and calls a reload function when
+// it changes. The whole directory is watched as Kubernetes updates ConfigMaps
+// by atomically swapping a symbolic link and editors may replace the file
+// instead of writing to it.
+type configWatcher struct {
+	r      *reporter.Reporter
+	t      tomb.Tomb
+	path   string
+	delay  time.Duration
+	reload func() error
+
+	metrics struct {
+		reloads *reporter.CounterVec
+	}
+}
+
+// newConfigWatcher creates a new watcher for the provided configuration file.
+// Bursts of events are coalesced: the reload function is only called once no
+// event has been received for the provided delay.
+func newConfigWatcher(r *reporter.Reporter, path string, delay time.Duration, reload func() error) *configWatcher {
+	w := configWatcher{
+		r:      r,
+		path:   path,
+		delay:  delay,
+		reload: reload,
+	}
+	w.metrics.reloads = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "configuration_reloads_total",
+			Help: "Number of configuration reloads.",
+		},
+		[]string{"status"},
+	)
+	return &w
+}
+
+// Start starts watching the configuration file.
+func (w *configWatcher) Start() error {
+	w.r.Info().Str("path", w.path).Msg("watching configuration file for changes")
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot setup configuration watcher: %w", err)
+	}
+	if err := watcher.Add(filepath.Dir(w.path)); err != nil {
+		watcher.Close()
+		return fmt.Errorf("cannot watch configuration directory: %w", err)
+	}
+	w.t.Go(func() error {
+		errLogger := w.r.Sample(reporter.BurstSampler(10*time.Second, 1))
+		defer watcher.Close()
+		timer := time.NewTimer(w.delay)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-w.t.Dying():
+				return nil
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return errors.New("configuration watcher died")
+				}
+				errLogger.Err(err).Msg("error from configuration watcher")
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return errors.New("configuration watcher died")
+				}
+				if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+					continue
+				}
+				timer.Reset(w.delay)
+			case <-timer.C:
+				if err := w.reload(); err != nil {
+					w.r.Err(err).Msg("cannot reload configuration, keeping the current one")
+					w.metrics.reloads.WithLabelValues("error").Inc()
+					continue
+				}
+				w.metrics.reloads.WithLabelValues("ok").Inc()
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops watching the configuration file.
+func (w *configWatcher) Stop() error {
+	w.t.Kill(nil)
+	return w.t.Wait()
+}
@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestConfigWatcher(t *testing.T) {
+	r := reporter.NewMock(t)
+	dir := t.TempDir()
+	// Mimic a ConfigMap: the configuration file is a symlink to a
+	// symlinked directory.
+	if err := os.Mkdir(filepath.Join(dir, "..v1"), 0o755); err != nil {
+		t.Fatalf("Mkdir() error:\n%+v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "..v1", "config.yaml"), []byte("hello: 1\n"), 0o644)
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("Symlink() error:\n%+v", err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatalf("Symlink() error:\n%+v", err)
+	}
+
+	var reloads atomic.Uint32
+	var fail atomic.Bool
+	w := newConfigWatcher(r, filepath.Join(dir, "config.yaml"), 20*time.Millisecond, func() error {
+		reloads.Add(1)
+		if fail.Load() {
+			return errors.New("nope")
+		}
+		return nil
+	})
+	helpers.StartStop(t, w)
+
+	// Nothing happens without a change
+	time.Sleep(50 * time.Millisecond)
+	if got := reloads.Load(); got != 0 {
+		t.Fatalf("reloads = %d, expected 0", got)
+	}
+
+	// Swap the data directory like Kubernetes does
+	if err := os.Mkdir(filepath.Join(dir, "..v2"), 0o755); err != nil {
+		t.Fatalf("Mkdir() error:\n%+v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "..v2", "config.yaml"), []byte("hello: 2\n"), 0o644)
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatalf("Symlink() error:\n%+v", err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatalf("Rename() error:\n%+v", err)
+	}
+	os.RemoveAll(filepath.Join(dir, "..v1"))
+	time.Sleep(100 * time.Millisecond)
+	if got := reloads.Load(); got != 1 {
+		t.Fatalf("reloads = %d, expected 1", got)
+	}
+
+	// Reload failure when modifying another file (like an included one)
+	fail.Store(true)
+	os.WriteFile(filepath.Join(dir, "included.yaml"), []byte("hello: 3\n"), 0o644)
+	time.Sleep(100 * time.Millisecond)
+	if got := reloads.Load(); got != 2 {
+		t.Fatalf("reloads = %d, expected 2", got)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_cmd_", "configuration_")
+	expectedMetrics := map[string]string{
+		`configuration_reloads_total{status="error"}`: "1",
+		`configuration_reloads_total{status="ok"}`:    "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhousedb
+
+import (
+	"errors"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"akvorado/common/helpers"
+)
+
+// ClassifyError returns the provided error with its class, depending on the
+// code of the ClickHouse exception. Authentication and permission errors are
+// configuration errors, invalid queries are permanent errors and overloads
+// are transient errors. Other errors are returned unchanged.
+func ClassifyError(err error) error {
+	var exception *clickhouse.Exception
+	if !errors.As(err, &exception) {
+		return err
+	}
+	switch exception.Code {
+	case 81, // UNKNOWN_DATABASE
+		192, // UNKNOWN_USER
+		193, // WRONG_PASSWORD
+		194, // REQUIRED_PASSWORD
+		497, // ACCESS_DENIED
+		516: // AUTHENTICATION_FAILED
+		return helpers.ConfigurationError(err)
+	case 46, // UNKNOWN_FUNCTION
+		47, // UNKNOWN_IDENTIFIER
+		53, // TYPE_MISMATCH
+		60, // UNKNOWN_TABLE
+		62: // SYNTAX_ERROR
+		return helpers.PermanentError(err)
+	case 159, // TIMEOUT_EXCEEDED
+		202, // TOO_MANY_SIMULTANEOUS_QUERIES
+		209, // SOCKET_TIMEOUT
+		210, // NETWORK_ERROR
+		241, // MEMORY_LIMIT_EXCEEDED
+		252: // TOO_MANY_PARTS
+		return helpers.TransientError(err)
+	}
+	return err
+}
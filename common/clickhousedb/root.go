@@ -97,7 +97,7 @@ func (c *Component) Start() error {
 						cb(reporter.HealthcheckOK, "database available")
 						rows.Close()
 					} else {
-						cb(reporter.HealthcheckWarning, "database unavailable")
+						cb(reporter.HealthcheckStatusForError(ClassifyError(err)), "database unavailable")
 					}
 					cancel()
 				}
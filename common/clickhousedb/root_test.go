@@ -8,6 +8,7 @@ import (
 	"errors"
 	"testing"
 
+	"github.com/ClickHouse/clickhouse-go/v2"
 	"go.uber.org/mock/gomock"
 
 	"akvorado/common/clickhousedb/mocks"
@@ -93,24 +94,37 @@ func TestMock(t *testing.T) {
 			Query(gomock.Any(), "SELECT 1").
 			Return(mockRows, nil)
 		got := r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["clickhousedb"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["clickhousedb"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckOK,
 			Reason: "database available",
 		}); diff != "" {
 			t.Fatalf("runHealthcheck() (-got, +want):\n%s", diff)
 		}
 
-		mock.EXPECT().
+		secondCall := mock.EXPECT().
 			Query(gomock.Any(), "SELECT 1").
 			Return(nil, errors.New("not available")).
 			After(firstCall)
 		got = r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["clickhousedb"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["clickhousedb"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckWarning,
 			Reason: "database unavailable",
 		}); diff != "" {
 			t.Fatalf("runHealthcheck() (-got, +want):\n%s", diff)
 		}
+
+		// Authentication errors are not transient
+		mock.EXPECT().
+			Query(gomock.Any(), "SELECT 1").
+			Return(nil, &clickhouse.Exception{Code: 516, Message: "authentication failed"}).
+			After(secondCall)
+		got = r.RunHealthchecks(context.Background())
+		if diff := helpers.Diff(got.Details["clickhousedb"].HealthcheckResult, reporter.HealthcheckResult{
+			Status: reporter.HealthcheckError,
+			Reason: "database unavailable",
+		}); diff != "" {
+			t.Fatalf("runHealthcheck() (-got, +want):\n%s", diff)
+		}
 	})
 }
 
@@ -147,7 +161,7 @@ func TestRealClickHouse(t *testing.T) {
 	// Check healthcheck
 	t.Run("healthcheck", func(t *testing.T) {
 		got := r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["clickhousedb"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["clickhousedb"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckOK,
 			Reason: "database available",
 		}); diff != "" {
@@ -0,0 +1,76 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package daemon
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ActivationPrefix is the prefix of listening addresses designating sockets
+// passed by systemd. It is followed by the name of the socket
+// (FileDescriptorName= in the socket unit).
+const ActivationPrefix = "systemd:"
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+var activation struct {
+	once  sync.Once
+	lock  sync.Mutex
+	files map[string][]*os.File
+}
+
+// ActivatedFiles returns the sockets passed by systemd with the provided name.
+// Sockets without a name are named "unknown", like systemd does. Sockets are
+// kept open: they can be used again after restarting a component.
+func ActivatedFiles(name string) []*os.File {
+	loadActivatedFiles()
+	activation.lock.Lock()
+	defer activation.lock.Unlock()
+	return activation.files[name]
+}
+
+// loadActivatedFiles loads the sockets passed by systemd, once. The
+// environment variables are removed to not pass them to children.
+func loadActivatedFiles() {
+	activation.once.Do(func() {
+		activation.files = map[string][]*os.File{}
+		for name, fds := range activatedFDs(os.Getenv, os.Getpid()) {
+			for _, fd := range fds {
+				syscall.CloseOnExec(fd)
+				activation.files[name] = append(activation.files[name],
+					os.NewFile(uintptr(fd), name))
+			}
+		}
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	})
+}
+
+// activatedFDs returns the file descriptors passed by systemd, indexed by
+// name, using the sd_listen_fds(3) protocol.
+func activatedFDs(getenv func(string) string, pid int) map[string][]int {
+	fds := map[string][]int{}
+	if getenv("LISTEN_PID") != strconv.Itoa(pid) {
+		return fds
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return fds
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+	for i := 0; i < count; i++ {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		fds[name] = append(fds[name], listenFDsStart+i)
+	}
+	return fds
+}
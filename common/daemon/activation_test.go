@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package daemon
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestActivatedFDs(t *testing.T) {
+	cases := []struct {
+		Description string
+		Env         map[string]string
+		Expected    map[string][]int
+	}{
+		{
+			Description: "no activation",
+			Env:         map[string]string{},
+			Expected:    map[string][]int{},
+		}, {
+			Description: "another process",
+			Env:         map[string]string{"LISTEN_PID": "1", "LISTEN_FDS": "1"},
+			Expected:    map[string][]int{},
+		}, {
+			Description: "without names",
+			Env:         map[string]string{"LISTEN_PID": "1000", "LISTEN_FDS": "2"},
+			Expected:    map[string][]int{"unknown": {3, 4}},
+		}, {
+			Description: "with names",
+			Env: map[string]string{
+				"LISTEN_PID":     "1000",
+				"LISTEN_FDS":     "3",
+				"LISTEN_FDNAMES": "http:netflow:netflow",
+			},
+			Expected: map[string][]int{"http": {3}, "netflow": {4, 5}},
+		}, {
+			Description: "invalid count",
+			Env:         map[string]string{"LISTEN_PID": "1000", "LISTEN_FDS": "foo"},
+			Expected:    map[string][]int{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := activatedFDs(func(key string) string { return tc.Env[key] }, 1000)
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("activatedFDs() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
@@ -7,8 +7,12 @@
 package daemon
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
+	"slices"
+	"sync"
 	"syscall"
 
 	"gopkg.in/tomb.v2"
@@ -21,6 +25,7 @@ type Component interface {
 	Start() error
 	Stop() error
 	Track(t *tomb.Tomb, who string)
+	Restart(t *tomb.Tomb, stop func() error, start func() error) error
 
 	// Lifecycle
 	Terminated() <-chan struct{}
@@ -33,6 +38,10 @@ type realComponent struct {
 	r     *reporter.Reporter
 	tombs []tombWithOrigin
 
+	restartSerial sync.Mutex // only one restart at a time
+	restartLock   sync.Mutex
+	restarting    map[*tomb.Tomb]tombRestart
+
 	lifecycleComponent
 }
 
@@ -42,10 +51,18 @@ type tombWithOrigin struct {
 	origin string
 }
 
+// tombRestart signals the restart of a tomb between Restart() and the
+// goroutine watching the tomb.
+type tombRestart struct {
+	stopped   chan struct{} // closed by the watcher once the tomb is dead
+	restarted chan struct{} // closed once the tomb can be watched again
+}
+
 // New will create a new daemon component.
 func New(r *reporter.Reporter) (Component, error) {
 	return &realComponent{
-		r: r,
+		r:          r,
+		restarting: make(map[*tomb.Tomb]tombRestart),
 		lifecycleComponent: lifecycleComponent{
 			terminateChannel: make(chan struct{}),
 		},
@@ -56,19 +73,7 @@ func New(r *reporter.Reporter) (Component, error) {
 func (c *realComponent) Start() error {
 	// Listen for tombs
 	for _, t := range c.tombs {
-		go func(t tombWithOrigin) {
-			<-t.tomb.Dying()
-			if t.tomb.Err() == nil {
-				c.r.Debug().
-					Str("component", t.origin).
-					Msg("component shutting down, quitting")
-			} else {
-				c.r.Err(t.tomb.Err()).
-					Str("component", t.origin).
-					Msg("component error, quitting")
-			}
-			c.Terminate()
-		}(t)
+		go c.watch(t)
 	}
 	// On signal, terminate
 	go func() {
@@ -97,6 +102,80 @@ func (c *realComponent) Stop() error {
 	return nil
 }
 
+// watch terminates the daemon when the provided tomb is dying, unless the
+// component is being restarted.
+func (c *realComponent) watch(t tombWithOrigin) {
+	for {
+		select {
+		case <-t.tomb.Dying():
+		case <-c.Terminated():
+			return
+		}
+		c.restartLock.Lock()
+		restart, ok := c.restarting[t.tomb]
+		delete(c.restarting, t.tomb)
+		c.restartLock.Unlock()
+		if !ok {
+			break
+		}
+		// The tomb is reset by Restart() once we are notified.
+		close(restart.stopped)
+		select {
+		case <-restart.restarted:
+			continue
+		case <-c.Terminated():
+			return
+		}
+	}
+	if t.tomb.Err() == nil {
+		c.r.Debug().
+			Str("component", t.origin).
+			Msg("component shutting down, quitting")
+	} else {
+		c.r.Err(t.tomb.Err()).
+			Str("component", t.origin).
+			Msg("component error, quitting")
+	}
+	c.Terminate()
+}
+
+// Restart stops a component tracked with the provided tomb, resets the tomb
+// and starts the component again, without terminating the daemon. When
+// stopping or starting fails, the daemon is terminated.
+func (c *realComponent) Restart(t *tomb.Tomb, stop func() error, start func() error) error {
+	c.restartSerial.Lock()
+	defer c.restartSerial.Unlock()
+	restart := tombRestart{
+		stopped:   make(chan struct{}),
+		restarted: make(chan struct{}),
+	}
+	if slices.ContainsFunc(c.tombs, func(tt tombWithOrigin) bool { return tt.tomb == t }) {
+		c.restartLock.Lock()
+		c.restarting[t] = restart
+		c.restartLock.Unlock()
+	} else {
+		// Nobody is watching this tomb.
+		close(restart.stopped)
+	}
+	defer close(restart.restarted)
+
+	if err := stop(); err != nil {
+		c.Terminate()
+		return fmt.Errorf("unable to stop component: %w", err)
+	}
+	select {
+	case <-restart.stopped:
+	case <-c.Terminated():
+		return errors.New("daemon terminated while restarting component")
+	}
+	*t = tomb.Tomb{}
+	if err := start(); err != nil {
+		c.Terminate()
+		return fmt.Errorf("unable to start component: %w", err)
+	}
+	return nil
+}
+
 // Add a new tomb to be tracked. This is only used before Start().
 func (c *realComponent) Track(t *tomb.Tomb, who string) {
 	c.tombs = append(c.tombs, tombWithOrigin{
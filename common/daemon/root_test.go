@@ -114,3 +114,84 @@ func TestTombTracking(t *testing.T) {
 
 	c.Stop()
 }
+
+func TestTombRestart(t *testing.T) {
+	var tomb tomb.Tomb
+	r := reporter.NewMock(t)
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	c.Track(&tomb, "tomb")
+	helpers.StartStop(t, c)
+
+	start := func() error {
+		tomb.Go(func() error {
+			<-tomb.Dying()
+			return nil
+		})
+		return nil
+	}
+	stop := func() error {
+		tomb.Kill(nil)
+		return tomb.Wait()
+	}
+	start()
+
+	// Restart twice, the daemon should not be terminated.
+	for i := 0; i < 2; i++ {
+		if err := c.Restart(&tomb, stop, start); err != nil {
+			t.Fatalf("Restart() error:\n%+v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+		select {
+		case <-c.Terminated():
+			t.Fatalf("Terminated() was closed while the tomb was restarted")
+		default:
+			// OK
+		}
+	}
+
+	// The restarted tomb is still watched
+	stop()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-c.Terminated():
+		// OK
+	default:
+		t.Fatalf("Terminated() was not closed while tomb is dead")
+	}
+}
+
+func TestTombRestartFailure(t *testing.T) {
+	var tomb tomb.Tomb
+	r := reporter.NewMock(t)
+	c, err := New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	c.Track(&tomb, "tomb")
+	helpers.StartStop(t, c)
+	tomb.Go(func() error {
+		<-tomb.Dying()
+		return nil
+	})
+
+	err = c.Restart(&tomb, func() error {
+		tomb.Kill(nil)
+		return tomb.Wait()
+	}, func() error {
+		return fmt.Errorf("cannot start")
+	})
+	if err == nil {
+		t.Fatal("Restart() did not error")
+	}
+	select {
+	case <-c.Terminated():
+		// OK
+	default:
+		t.Fatalf("Terminated() was not closed while restart failed")
+	}
+}
@@ -6,6 +6,7 @@
 package daemon
 
 import (
+	"os"
 	"testing"
 
 	"gopkg.in/tomb.v2"
@@ -41,3 +42,27 @@ func (c *MockComponent) Stop() error {
 // Track does nothing
 func (c *MockComponent) Track(_ *tomb.Tomb, _ string) {
 }
+
+// Restart stops the component, resets the tomb and starts the component.
+func (c *MockComponent) Restart(t *tomb.Tomb, stop func() error, start func() error) error {
+	if err := stop(); err != nil {
+		return err
+	}
+	*t = tomb.Tomb{}
+	return start()
+}
+
+// MockActivatedFiles makes the provided files available as if they were
+// passed by systemd with the provided name.
+func MockActivatedFiles(t *testing.T, name string, files ...*os.File) {
+	t.Helper()
+	loadActivatedFiles()
+	activation.lock.Lock()
+	activation.files[name] = files
+	activation.lock.Unlock()
+	t.Cleanup(func() {
+		activation.lock.Lock()
+		delete(activation.files, name)
+		activation.lock.Unlock()
+	})
+}
@@ -4,10 +4,12 @@
 // Package cache implements a cache with an optional TTL. Each operation should
 // provide the current time. Items are expired on demand. Expiration can be done
 // on last access or last update. Due to an implementation detail, it relies on
-// wall time.
+// wall time. The cache can also be bounded in size, in which case the least
+// recently accessed item is evicted when adding a new one.
 package cache
 
 import (
+	"container/list"
 	"errors"
 	"sync"
 	"sync/atomic"
@@ -19,8 +21,14 @@ var ErrVersion = errors.New("cache version mismatch")
 
 // Cache is a thread-safe in-memory key/value store
 type Cache[K comparable, V any] struct {
-	items map[K]*item[V]
-	mu    sync.RWMutex
+	items   map[K]*item[V]
+	mu      sync.RWMutex
+	maxSize int
+	lru     *list.List // keys, most recently accessed first (bounded caches only)
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
 }
 
 // item is a cache item, including last access and last update
@@ -28,6 +36,8 @@ type item[V any] struct {
 	Object       V
 	LastAccessed int64
 	LastUpdated  int64
+
+	element *list.Element // position in the LRU list
 }
 
 // New creates a new instance of the cache with the specified duration.
@@ -37,6 +47,15 @@ func New[K comparable, V any]() *Cache[K, V] {
 	}
 }
 
+// NewLRU creates a new instance of the cache holding at most the specified
+// number of items. When full, the least recently accessed items are evicted.
+func NewLRU[K comparable, V any](maxSize int) *Cache[K, V] {
+	c := New[K, V]()
+	c.maxSize = maxSize
+	c.lru = list.New()
+	return c
+}
+
 func (c *Cache[K, V]) zero() V {
 	var v V
 	return v
@@ -51,26 +70,97 @@ func (c *Cache[K, V]) Put(now time.Time, key K, object V) {
 		LastUpdated:  n,
 	}
 	c.mu.Lock()
+	if c.lru != nil {
+		if old, ok := c.items[key]; ok {
+			item.element = old.element
+			c.lru.MoveToFront(item.element)
+		} else {
+			item.element = c.lru.PushFront(key)
+		}
+	}
 	c.items[key] = &item
+	if c.lru != nil {
+		for len(c.items) > c.maxSize {
+			c.remove(c.lru.Back().Value.(K))
+			c.evictions.Add(1)
+		}
+	}
 	c.mu.Unlock()
 }
 
+// remove removes the provided key from the cache. The lock should be held.
+func (c *Cache[K, V]) remove(key K) {
+	if c.lru != nil {
+		c.lru.Remove(c.items[key].element)
+	}
+	delete(c.items, key)
+}
+
 // Get retrieves an object from the cache. If now is uninitialized, time of last
 // access is not updated.
 func (c *Cache[K, V]) Get(now time.Time, key K) (V, bool) {
-	c.mu.RLock()
+	if c.lru != nil && !now.IsZero() {
+		// The LRU list is modified, the write lock is needed.
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
 	item, ok := c.items[key]
-	c.mu.RUnlock()
 	if !ok {
+		c.misses.Add(1)
 		return c.zero(), false
 	}
+	c.hits.Add(1)
 	if !now.IsZero() {
-		n := now.Unix()
-		atomic.StoreInt64(&item.LastAccessed, n)
+		c.touch(item, now.Unix())
 	}
 	return item.Object, true
 }
 
+// touch updates the last access time of the provided item and, for bounded
+// caches, moves it to the front of the LRU list. Unless the cache is
+// unbounded, the write lock should be held.
+func (c *Cache[K, V]) touch(item *item[V], n int64) {
+	atomic.StoreInt64(&item.LastAccessed, n)
+	if c.lru != nil {
+		c.lru.MoveToFront(item.element)
+	}
+}
+
+// GetMany retrieves several objects from the cache while acquiring the lock
+// only once. The returned slices are in the same order as the provided keys.
+// If now is uninitialized, time of last access is not updated.
+func (c *Cache[K, V]) GetMany(now time.Time, keys []K) ([]V, []bool) {
+	objects := make([]V, len(keys))
+	found := make([]bool, len(keys))
+	var hits, misses uint64
+	n := now.Unix()
+	if c.lru != nil && !now.IsZero() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+	} else {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+	}
+	for idx, key := range keys {
+		item, ok := c.items[key]
+		if !ok {
+			misses++
+			continue
+		}
+		hits++
+		if !now.IsZero() {
+			c.touch(item, n)
+		}
+		objects[idx], found[idx] = item.Object, true
+	}
+	c.hits.Add(hits)
+	c.misses.Add(misses)
+	return objects, found
+}
+
 // Items retrieve all the key/value in the cache.
 func (c *Cache[K, V]) Items() map[K]V {
 	result := map[K]V{}
@@ -105,7 +195,21 @@ func (c *Cache[K, V]) DeleteLastAccessedBefore(before time.Time) int {
 	for k, v := range c.items {
 		last := atomic.LoadInt64(&v.LastAccessed)
 		if last < before.Unix() {
-			delete(c.items, k)
+			c.remove(k)
+			count++
+		}
+	}
+	return count
+}
+
+// DeleteMatching deletes items whose key matches the provided predicate.
+func (c *Cache[K, V]) DeleteMatching(match func(K) bool) int {
+	count := 0
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.items {
+		if match(k) {
+			c.remove(k)
 			count++
 		}
 	}
@@ -118,3 +222,9 @@ func (c *Cache[K, V]) Size() int {
 	defer c.mu.RUnlock()
 	return len(c.items)
 }
+
+// Stats returns the number of hits, misses, and evictions since the creation
+// of the cache.
+func (c *Cache[K, V]) Stats() (hits uint64, misses uint64, evictions uint64) {
+	return c.hits.Load(), c.misses.Load(), c.evictions.Load()
+}
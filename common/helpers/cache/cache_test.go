@@ -4,6 +4,7 @@
 package cache_test
 
 import (
+	"fmt"
 	"net/netip"
 	"testing"
 	"time"
@@ -97,6 +98,24 @@ func TestDeleteLastAccessedBefore(t *testing.T) {
 	expectCacheGet(t, c, "127.0.0.3", "", false)
 }
 
+func TestDeleteMatching(t *testing.T) {
+	c := cache.New[netip.Addr, string]()
+	now := time.Date(2022, time.December, 31, 10, 23, 0, 0, time.UTC)
+	c.Put(now, netip.MustParseAddr("::ffff:127.0.0.1"), "entry1")
+	c.Put(now, netip.MustParseAddr("::ffff:127.0.0.2"), "entry2")
+	c.Put(now, netip.MustParseAddr("::ffff:127.0.0.3"), "entry3")
+
+	count := c.DeleteMatching(func(k netip.Addr) bool {
+		return k != netip.MustParseAddr("::ffff:127.0.0.2")
+	})
+	if count != 2 {
+		t.Errorf("DeleteMatching() returned %d, expected 2", count)
+	}
+	expectCacheGet(t, c, "127.0.0.1", "", false)
+	expectCacheGet(t, c, "127.0.0.2", "entry2", true)
+	expectCacheGet(t, c, "127.0.0.3", "", false)
+}
+
 func TestItemsLastUpdatedBefore(t *testing.T) {
 	c := cache.New[netip.Addr, string]()
 	t1 := time.Date(2022, time.December, 31, 10, 23, 0, 0, time.UTC)
@@ -117,3 +136,91 @@ func TestItemsLastUpdatedBefore(t *testing.T) {
 		t.Errorf("ItemsLastUpdatedBefore() (-got, +want):\n%s", diff)
 	}
 }
+
+func TestLRU(t *testing.T) {
+	c := cache.NewLRU[netip.Addr, string](10)
+	t1 := time.Date(2022, time.December, 31, 10, 23, 0, 0, time.UTC)
+	for i := 1; i <= 10; i++ {
+		c.Put(t1.Add(time.Duration(i)*time.Second),
+			netip.AddrFrom4([4]byte{127, 0, 0, byte(i)}), fmt.Sprintf("entry%d", i))
+	}
+	// Access the first entry to make it the most recently used one.
+	c.Get(t1.Add(time.Minute), netip.AddrFrom4([4]byte{127, 0, 0, 1}))
+	if size := c.Size(); size != 10 {
+		t.Fatalf("Size() == %d, expected 10", size)
+	}
+
+	// Adding one more evicts the least recently accessed entry.
+	c.Put(t1.Add(2*time.Minute), netip.AddrFrom4([4]byte{127, 0, 0, 11}), "entry11")
+	if size := c.Size(); size != 10 {
+		t.Fatalf("Size() == %d, expected 10", size)
+	}
+	if _, ok := c.Get(time.Time{}, netip.MustParseAddr("127.0.0.2")); ok {
+		t.Errorf("Get(%q) should have been evicted", "127.0.0.2")
+	}
+	for _, key := range []string{"127.0.0.1", "127.0.0.3", "127.0.0.11"} {
+		if _, ok := c.Get(time.Time{}, netip.MustParseAddr(key)); !ok {
+			t.Errorf("Get(%q) should not have been evicted", key)
+		}
+	}
+
+	// Updating an entry makes it the most recently used one.
+	c.Put(t1.Add(3*time.Minute), netip.AddrFrom4([4]byte{127, 0, 0, 3}), "entry3")
+	c.Put(t1.Add(3*time.Minute), netip.AddrFrom4([4]byte{127, 0, 0, 12}), "entry12")
+	if _, ok := c.Get(time.Time{}, netip.MustParseAddr("127.0.0.4")); ok {
+		t.Errorf("Get(%q) should have been evicted", "127.0.0.4")
+	}
+	if _, ok := c.Get(time.Time{}, netip.MustParseAddr("127.0.0.3")); !ok {
+		t.Errorf("Get(%q) should not have been evicted", "127.0.0.3")
+	}
+
+	// Deleting entries keeps the LRU list consistent.
+	if count := c.DeleteMatching(func(k netip.Addr) bool { return k.As4()[3] < 8 }); count != 5 {
+		t.Errorf("DeleteMatching() == %d, expected 5", count)
+	}
+	for i := 13; i <= 18; i++ {
+		c.Put(t1.Add(4*time.Minute), netip.AddrFrom4([4]byte{127, 0, 0, byte(i)}), fmt.Sprintf("entry%d", i))
+	}
+	if size := c.Size(); size != 10 {
+		t.Fatalf("Size() == %d, expected 10", size)
+	}
+	if _, ok := c.Get(time.Time{}, netip.MustParseAddr("127.0.0.8")); ok {
+		t.Errorf("Get(%q) should have been evicted", "127.0.0.8")
+	}
+
+	hits, misses, evictions := c.Stats()
+	got := []uint64{hits, misses, evictions}
+	expected := []uint64{5, 3, 3}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("Stats() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestGetMany(t *testing.T) {
+	c := cache.New[netip.Addr, string]()
+	t1 := time.Date(2022, time.December, 31, 10, 23, 0, 0, time.UTC)
+	c.Put(t1, netip.MustParseAddr("127.0.0.1"), "entry1")
+	c.Put(t1, netip.MustParseAddr("127.0.0.2"), "entry2")
+
+	objects, found := c.GetMany(t1.Add(time.Minute), []netip.Addr{
+		netip.MustParseAddr("127.0.0.2"),
+		netip.MustParseAddr("127.0.0.3"),
+		netip.MustParseAddr("127.0.0.1"),
+	})
+	if diff := helpers.Diff(objects, []string{"entry2", "", "entry1"}); diff != "" {
+		t.Errorf("GetMany() objects (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(found, []bool{true, false, true}); diff != "" {
+		t.Errorf("GetMany() found (-got, +want):\n%s", diff)
+	}
+
+	// Last access time should have been updated
+	if count := c.DeleteLastAccessedBefore(t1.Add(time.Minute)); count != 0 {
+		t.Errorf("DeleteLastAccessedBefore() == %d, expected 0", count)
+	}
+
+	hits, misses, _ := c.Stats()
+	if diff := helpers.Diff([]uint64{hits, misses}, []uint64{2, 1}); diff != "" {
+		t.Errorf("Stats() (-got, +want):\n%s", diff)
+	}
+}
@@ -5,10 +5,12 @@ package cache
 
 import (
 	"bytes"
+	"container/list"
 	"encoding/gob"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 )
 
 // Save persists the cache to the specified file
@@ -111,6 +113,29 @@ func (c *Cache[K, V]) GobDecode(data []byte) error {
 
 	c.mu.Lock()
 	c.items = items
+	if c.lru != nil {
+		c.rebuildLRU()
+	}
 	c.mu.Unlock()
 	return nil
 }
+
+// rebuildLRU rebuilds the LRU list from the last access time of each item
+// and evicts the least recently accessed items if the cache is too large. The
+// lock should be held.
+func (c *Cache[K, V]) rebuildLRU() {
+	keys := make([]K, 0, len(c.items))
+	for k := range c.items {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.items[keys[i]].LastAccessed > c.items[keys[j]].LastAccessed
+	})
+	c.lru = list.New()
+	for _, k := range keys {
+		c.items[k].element = c.lru.PushBack(k)
+	}
+	for len(c.items) > c.maxSize {
+		c.remove(c.lru.Back().Value.(K))
+	}
+}
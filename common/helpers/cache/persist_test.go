@@ -46,6 +46,34 @@ func TestSaveLoad(t *testing.T) {
 	expectCacheGet(t, c, "127.0.0.3", "entry3", true)
 }
 
+func TestSaveLoadLRU(t *testing.T) {
+	c := cache.New[netip.Addr, string]()
+	t1 := time.Date(2022, time.December, 31, 10, 23, 0, 0, time.UTC)
+	c.Put(t1, netip.MustParseAddr("::ffff:127.0.0.1"), "entry1")
+	c.Put(t1, netip.MustParseAddr("::ffff:127.0.0.2"), "entry2")
+	c.Put(t1, netip.MustParseAddr("::ffff:127.0.0.3"), "entry3")
+	c.Get(t1.Add(time.Minute), netip.MustParseAddr("::ffff:127.0.0.1"))
+	c.Get(t1.Add(2*time.Minute), netip.MustParseAddr("::ffff:127.0.0.3"))
+
+	target := filepath.Join(t.TempDir(), "cache")
+	if err := c.Save(target); err != nil {
+		t.Fatalf("c.Save() error:\n%s", err)
+	}
+
+	// Loading into a smaller cache keeps the most recently accessed items
+	c = cache.NewLRU[netip.Addr, string](2)
+	if err := c.Load(target); err != nil {
+		t.Fatalf("c.Load() error:\n%s", err)
+	}
+	expectCacheGet(t, c, "127.0.0.1", "entry1", true)
+	expectCacheGet(t, c, "127.0.0.2", "", false)
+	expectCacheGet(t, c, "127.0.0.3", "entry3", true)
+
+	c.Put(t1.Add(3*time.Minute), netip.MustParseAddr("::ffff:127.0.0.4"), "entry4")
+	expectCacheGet(t, c, "127.0.0.1", "", false)
+	expectCacheGet(t, c, "127.0.0.4", "entry4", true)
+}
+
 func TestLoadMismatchVersion(t *testing.T) {
 	c1 := cache.New[netip.Addr, string]()
 	c1.Put(time.Now(), netip.MustParseAddr("::ffff:127.0.0.1"), "entry1")
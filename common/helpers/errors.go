@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// ErrorClass tells how an error should be handled: a transient error may go
+// away by retrying later, a configuration error needs a change from the
+// operator, a permanent error will happen again with the same input.
+type ErrorClass int
+
+const (
+	// ErrorClassUnknown is used for errors without class. They are handled
+	// like transient errors.
+	ErrorClassUnknown ErrorClass = iota
+	// ErrorClassTransient is for errors which may go away by retrying later
+	// (timeouts, unreachable services).
+	ErrorClassTransient
+	// ErrorClassConfiguration is for errors needing a change in the
+	// configuration (bad credentials, missing permissions).
+	ErrorClassConfiguration
+	// ErrorClassPermanent is for errors happening again when retrying with
+	// the same input (malformed data, unsupported request).
+	ErrorClassPermanent
+)
+
+func (ec ErrorClass) String() string {
+	switch ec {
+	case ErrorClassTransient:
+		return "transient"
+	case ErrorClassConfiguration:
+		return "configuration"
+	case ErrorClassPermanent:
+		return "permanent"
+	default:
+		return "unknown"
+	}
+}
+
+// Retryable tells if an error of this class may go away by retrying.
+func (ec ErrorClass) Retryable() bool {
+	return ec == ErrorClassUnknown || ec == ErrorClassTransient
+}
+
+// classifiedError is an error with a class.
+type classifiedError struct {
+	class ErrorClass
+	err   error
+}
+
+func (ce classifiedError) Error() string {
+	return ce.err.Error()
+}
+
+func (ce classifiedError) Unwrap() error {
+	return ce.err
+}
+
+// classify wraps an error with the provided class.
+func classify(class ErrorClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return classifiedError{class: class, err: err}
+}
+
+// TransientError marks the provided error as transient.
+func TransientError(err error) error {
+	return classify(ErrorClassTransient, err)
+}
+
+// ConfigurationError marks the provided error as a configuration error.
+func ConfigurationError(err error) error {
+	return classify(ErrorClassConfiguration, err)
+}
+
+// PermanentError marks the provided error as permanent.
+func PermanentError(err error) error {
+	return classify(ErrorClassPermanent, err)
+}
+
+// ErrorClassOf returns the class of the provided error. The outermost class
+// in the chain wins. Timeouts and network errors without class are
+// considered as transient.
+func ErrorClassOf(err error) ErrorClass {
+	if err == nil {
+		return ErrorClassUnknown
+	}
+	var ce classifiedError
+	if errors.As(err, &ce) {
+		return ce.class
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EHOSTUNREACH) ||
+		errors.Is(err, syscall.ENETUNREACH) {
+		return ErrorClassTransient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTransient
+	}
+	return ErrorClassUnknown
+}
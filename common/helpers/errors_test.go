@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestErrorClassOf(t *testing.T) {
+	cases := []struct {
+		Description string
+		Err         error
+		Class       ErrorClass
+	}{
+		{"nil", nil, ErrorClassUnknown},
+		{"plain", errors.New("plain"), ErrorClassUnknown},
+		{"transient", TransientError(io.EOF), ErrorClassTransient},
+		{"configuration", ConfigurationError(io.EOF), ErrorClassConfiguration},
+		{"permanent", PermanentError(io.EOF), ErrorClassPermanent},
+		{"wrapped", fmt.Errorf("cannot do: %w", ConfigurationError(io.EOF)), ErrorClassConfiguration},
+		{"outermost wins", PermanentError(fmt.Errorf("cannot do: %w", TransientError(io.EOF))), ErrorClassPermanent},
+		{"deadline", fmt.Errorf("cannot do: %w", context.DeadlineExceeded), ErrorClassTransient},
+		{"connection refused", &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}, ErrorClassTransient},
+		{"timeout", os.ErrDeadlineExceeded, ErrorClassTransient},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			if got := ErrorClassOf(tc.Err); got != tc.Class {
+				t.Errorf("ErrorClassOf(%v) == %s, expected %s", tc.Err, got, tc.Class)
+			}
+		})
+	}
+}
+
+func TestClassifiedError(t *testing.T) {
+	if err := TransientError(nil); err != nil {
+		t.Errorf("TransientError(nil) == %v, expected nil", err)
+	}
+	err := ConfigurationError(fmt.Errorf("cannot read: %w", io.EOF))
+	if err.Error() != "cannot read: EOF" {
+		t.Errorf("Error() == %q, expected %q", err.Error(), "cannot read: EOF")
+	}
+	if !errors.Is(err, io.EOF) {
+		t.Error("errors.Is(err, io.EOF) == false, expected true")
+	}
+	if ErrorClassOf(err).Retryable() {
+		t.Error("Retryable() == true, expected false")
+	}
+}
@@ -4,11 +4,14 @@
 package helpers
 
 import (
+	"encoding/binary"
 	"fmt"
 	"net"
 	"net/netip"
 	"reflect"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -19,7 +22,7 @@ import (
 
 // SubnetMap maps subnets to values and allow to lookup by IP address.
 // Internally, everything is stored as an IPv6 (using v6-mapped IPv4
-// addresses).
+// addresses). When subnets overlap, the most specific one takes precedence.
 type SubnetMap[V any] struct {
 	tree *tree.TreeV6[V]
 }
@@ -35,6 +38,158 @@ func (sm *SubnetMap[V]) Lookup(ip netip.Addr) (V, bool) {
 	return value, ok
 }
 
+// LookupPrefix is like Lookup but also returns the matching subnet. It is
+// slower than Lookup and should only be used for diagnostic purpose.
+func (sm *SubnetMap[V]) LookupPrefix(ip netip.Addr) (netip.Prefix, V, bool) {
+	var (
+		prefix netip.Prefix
+		value  V
+		found  bool
+	)
+	if sm == nil || sm.tree == nil {
+		return prefix, value, false
+	}
+	ip = netip.AddrFrom16(ip.As16())
+	iter := sm.tree.Iterate()
+	for iter.Next() {
+		candidate := subnetMapPrefix(iter.Address())
+		if candidate.Contains(ip) && (!found || candidate.Bits() > prefix.Bits()) {
+			prefix, value, found = candidate, iter.Tags()[0], true
+		}
+	}
+	return unmapPrefix(prefix), value, found
+}
+
+// LookupPrefixValue is like LookupPrefix but the value is returned as an
+// interface. This is used to implement SubnetMapInspector.
+func (sm *SubnetMap[V]) LookupPrefixValue(ip netip.Addr) (netip.Prefix, interface{}, bool) {
+	return sm.LookupPrefix(ip)
+}
+
+// SubnetMapOverlap describes a subnet included in a larger subnet of the same
+// SubnetMap. As the most specific subnet takes precedence, the larger subnet
+// does not apply to the included one.
+type SubnetMapOverlap struct {
+	Subnet netip.Prefix
+	Parent netip.Prefix
+}
+
+// Overlaps returns the subnets included in a larger subnet, along with the
+// closest larger subnet. The result is sorted.
+func (sm *SubnetMap[V]) Overlaps() []SubnetMapOverlap {
+	result := []SubnetMapOverlap{}
+	if sm == nil || sm.tree == nil {
+		return result
+	}
+	subnets := map[netip.Prefix]struct{}{}
+	iter := sm.tree.Iterate()
+	for iter.Next() {
+		subnets[subnetMapPrefix(iter.Address())] = struct{}{}
+	}
+	for subnet := range subnets {
+		for bits := subnet.Bits() - 1; bits >= 0; bits-- {
+			parent, _ := subnet.Addr().Prefix(bits)
+			if _, ok := subnets[parent]; ok {
+				result = append(result, SubnetMapOverlap{
+					Subnet: unmapPrefix(subnet),
+					Parent: unmapPrefix(parent),
+				})
+				break
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if c := result[i].Subnet.Addr().Compare(result[j].Subnet.Addr()); c != 0 {
+			return c < 0
+		}
+		return result[i].Subnet.Bits() < result[j].Subnet.Bits()
+	})
+	return result
+}
+
+// subnetMapPrefix converts a key of the tree to a prefix.
+func subnetMapPrefix(address patricia.IPv6Address) netip.Prefix {
+	var ip [16]byte
+	binary.BigEndian.PutUint64(ip[:8], address.Left)
+	binary.BigEndian.PutUint64(ip[8:], address.Right)
+	return netip.PrefixFrom(netip.AddrFrom16(ip), int(address.Length))
+}
+
+// unmapPrefix turns a subnet of v6-mapped IPv4 addresses into an IPv4 subnet.
+func unmapPrefix(prefix netip.Prefix) netip.Prefix {
+	if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+		return netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+	}
+	return prefix
+}
+
+// SubnetMapInspector is implemented by all SubnetMap types. It allows to
+// inspect them without knowing the type of the values.
+type SubnetMapInspector interface {
+	Overlaps() []SubnetMapOverlap
+	LookupPrefixValue(ip netip.Addr) (netip.Prefix, interface{}, bool)
+}
+
+// WalkSubnetMaps calls the provided function for each SubnetMap found in the
+// provided value (usually a configuration). The path is built from the
+// lowercased field names, the map keys, and the slice indexes.
+func WalkSubnetMaps(value interface{}, fn func(path string, sm SubnetMapInspector)) {
+	walkSubnetMaps(reflect.ValueOf(value), "", fn)
+}
+
+func walkSubnetMaps(v reflect.Value, path string, fn func(string, SubnetMapInspector)) {
+	if !v.IsValid() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		if v.Kind() == reflect.Pointer && v.CanInterface() {
+			if sm, ok := v.Interface().(SubnetMapInspector); ok {
+				fn(path, sm)
+				return
+			}
+		}
+		walkSubnetMaps(v.Elem(), path, fn)
+	case reflect.Struct:
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		if sm, ok := ptr.Interface().(SubnetMapInspector); ok {
+			fn(path, sm)
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			fieldPath := path
+			if !field.Anonymous {
+				fieldPath = joinSubnetMapPath(path, strings.ToLower(field.Name))
+			}
+			walkSubnetMaps(v.Field(i), fieldPath, fn)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			walkSubnetMaps(iter.Value(), joinSubnetMapPath(path, fmt.Sprint(iter.Key().Interface())), fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walkSubnetMaps(v.Index(i), joinSubnetMapPath(path, strconv.Itoa(i)), fn)
+		}
+	}
+}
+
+func joinSubnetMapPath(path, element string) string {
+	if path == "" {
+		return element
+	}
+	return fmt.Sprintf("%s.%s", path, element)
+}
+
 // LookupOrDefault calls lookup and if not found, will return the
 // provided default value.
 func (sm *SubnetMap[V]) LookupOrDefault(ip netip.Addr, fallback V) V {
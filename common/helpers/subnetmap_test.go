@@ -4,6 +4,7 @@
 package helpers_test
 
 import (
+	"fmt"
 	"net/netip"
 	"testing"
 
@@ -303,3 +304,109 @@ func TestToMap(t *testing.T) {
 		t.Fatalf("ToMap() (-got, +want):\n%s", diff)
 	}
 }
+
+func TestSubnetMapOverlaps(t *testing.T) {
+	sm := helpers.MustNewSubnetMap(map[string]string{
+		"::/0":                 "default",
+		"::ffff:192.0.2.0/120": "network",
+		"::ffff:192.0.2.0/124": "small network",
+		"::ffff:192.0.2.1/128": "host",
+		"2001:db8::/64":        "other network",
+	})
+	got := sm.Overlaps()
+	expected := []helpers.SubnetMapOverlap{
+		{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("::/0")},
+		{netip.MustParsePrefix("192.0.2.0/28"), netip.MustParsePrefix("192.0.2.0/24")},
+		{netip.MustParsePrefix("192.0.2.1/32"), netip.MustParsePrefix("192.0.2.0/28")},
+		{netip.MustParsePrefix("2001:db8::/64"), netip.MustParsePrefix("::/0")},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Overlaps() (-got, +want):\n%s", diff)
+	}
+
+	var empty *helpers.SubnetMap[string]
+	if diff := helpers.Diff(empty.Overlaps(), []helpers.SubnetMapOverlap{}); diff != "" {
+		t.Fatalf("Overlaps() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSubnetMapLookupPrefix(t *testing.T) {
+	sm := helpers.MustNewSubnetMap(map[string]string{
+		"::/0":                 "default",
+		"::ffff:192.0.2.0/120": "network",
+		"::ffff:192.0.2.0/124": "small network",
+	})
+	cases := []struct {
+		IP             string
+		ExpectedPrefix string
+		ExpectedValue  string
+	}{
+		{"192.0.2.1", "192.0.2.0/28", "small network"},
+		{"::ffff:192.0.2.1", "192.0.2.0/28", "small network"},
+		{"192.0.2.100", "192.0.2.0/24", "network"},
+		{"2001:db8::1", "::/0", "default"},
+	}
+	for _, tc := range cases {
+		ip := netip.MustParseAddr(tc.IP)
+		prefix, value, ok := sm.LookupPrefix(ip)
+		if !ok {
+			t.Fatalf("LookupPrefix(%q) did not find anything", tc.IP)
+		}
+		if diff := helpers.Diff([]string{prefix.String(), value},
+			[]string{tc.ExpectedPrefix, tc.ExpectedValue}); diff != "" {
+			t.Errorf("LookupPrefix(%q) (-got, +want):\n%s", tc.IP, diff)
+		}
+		// Should be consistent with Lookup()
+		if value2, _ := sm.Lookup(netip.AddrFrom16(ip.As16())); value2 != value {
+			t.Errorf("Lookup(%q) == %q but LookupPrefix() == %q", tc.IP, value2, value)
+		}
+	}
+
+	sm = helpers.MustNewSubnetMap(map[string]string{"2001:db8::/64": "network"})
+	if _, _, ok := sm.LookupPrefix(netip.MustParseAddr("192.0.2.1")); ok {
+		t.Error("LookupPrefix() found something")
+	}
+}
+
+func TestWalkSubnetMaps(t *testing.T) {
+	type inner struct {
+		Networks *helpers.SubnetMap[string]
+	}
+	type Embedded struct {
+		Communities *helpers.SubnetMap[string]
+	}
+	config := struct {
+		Embedded
+		Rate      helpers.SubnetMap[uint]
+		Missing   *helpers.SubnetMap[string]
+		Inners    []inner
+		Named     map[string]interface{}
+		Untouched string
+	}{
+		Embedded: Embedded{
+			Communities: helpers.MustNewSubnetMap(map[string]string{"::/0": "public"}),
+		},
+		Rate: *helpers.MustNewSubnetMap(map[string]uint{"::/0": 100}),
+		Inners: []inner{
+			{},
+			{helpers.MustNewSubnetMap(map[string]string{"2001:db8::/64": "hello"})},
+		},
+		Named: map[string]interface{}{
+			"something": inner{helpers.MustNewSubnetMap(map[string]string{"2001:db8::/48": "bye"})},
+		},
+	}
+	got := map[string]string{}
+	helpers.WalkSubnetMaps(config, func(path string, sm helpers.SubnetMapInspector) {
+		prefix, value, _ := sm.LookupPrefixValue(netip.MustParseAddr("2001:db8::1"))
+		got[path] = fmt.Sprintf("%s %v", prefix, value)
+	})
+	expected := map[string]string{
+		"communities":              "::/0 public",
+		"rate":                     "::/0 100",
+		"inners.1.networks":        "2001:db8::/64 hello",
+		"named.something.networks": "2001:db8::/48 bye",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("WalkSubnetMaps() (-got, +want):\n%s", diff)
+	}
+}
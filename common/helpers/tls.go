@@ -6,6 +6,8 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 )
 
 // TLSConfiguration defines TLS configuration.
@@ -49,11 +51,58 @@ func (config TLSConfiguration) MakeTLSConfig() (*tls.Config, error) {
 		if config.KeyFile == "" {
 			config.KeyFile = config.CertFile
 		}
-		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
-		if err != nil {
+		cc := &clientCertificate{
+			certFile: config.CertFile,
+			keyFile:  config.KeyFile,
+		}
+		if _, err := cc.load(); err != nil {
 			return nil, fmt.Errorf("cannot read user certificate: %w", err)
 		}
-		tlsConfig.Certificates = []tls.Certificate{cert}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := cc.load()
+			if err != nil {
+				return nil, fmt.Errorf("cannot reload user certificate: %w", err)
+			}
+			return cert, nil
+		}
 	}
 	return tlsConfig, nil
 }
+
+// clientCertificate loads a user certificate and its key and reloads them when
+// one of the files is modified. This enables rotation of short-lived
+// certificates without a restart.
+type clientCertificate struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// load returns the current certificate, reloading it if needed.
+func (cc *clientCertificate) load() (*tls.Certificate, error) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	var modTime time.Time
+	for _, file := range []string{cc.certFile, cc.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if cc.cert != nil && modTime.Equal(cc.modTime) {
+		return cc.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(cc.certFile, cc.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cc.cert = &cert
+	cc.modTime = modTime
+	return cc.cert, nil
+}
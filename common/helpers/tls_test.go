@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate with the provided common
+// name and its key.
+func writeCertificate(t *testing.T, certFile, keyFile, name string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error:\n%+v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error:\n%+v", err)
+	}
+	keyBytes, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error:\n%+v", err)
+	}
+	if err := os.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	if err := os.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+}
+
+func TestTLSClientCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+
+	tlsConfig, err := TLSConfiguration{
+		Enable:   true,
+		CertFile: certFile,
+		KeyFile:  keyFile,
+	}.MakeTLSConfig()
+	if err != nil {
+		t.Fatalf("MakeTLSConfig() error:\n%+v", err)
+	}
+	commonName := func() string {
+		t.Helper()
+		cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+		if err != nil {
+			t.Fatalf("GetClientCertificate() error:\n%+v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatalf("ParseCertificate() error:\n%+v", err)
+		}
+		return leaf.Subject.CommonName
+	}
+	if got := commonName(); got != "first" {
+		t.Fatalf("GetClientCertificate() == %q, expected %q", got, "first")
+	}
+
+	// Rotate the certificate
+	writeCertificate(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatalf("Chtimes() error:\n%+v", err)
+		}
+	}
+	if got := commonName(); got != "second" {
+		t.Fatalf("GetClientCertificate() == %q, expected %q", got, "second")
+	}
+
+	// Remove the key
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatalf("Remove() error:\n%+v", err)
+	}
+	if _, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{}); err == nil {
+		t.Fatal("GetClientCertificate() did not error")
+	}
+}
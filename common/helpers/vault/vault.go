@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package vault implements a minimal client to read secrets from a Vault
+// server. Both KV version 1 and version 2 engines are supported.
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Client reads secrets from a Vault server.
+type Client struct {
+	http      *http.Client
+	address   string
+	namespace string
+}
+
+// StatusError is returned when Vault answers with an unexpected HTTP status.
+type StatusError struct {
+	Code   int
+	Status string
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %s", err.Status)
+}
+
+// New creates a new Vault client. When empty, the address and the namespace
+// are taken from the VAULT_ADDR and VAULT_NAMESPACE environment variables. When
+// nil, the default HTTP client is used.
+func New(client *http.Client, address, namespace string) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if namespace == "" {
+		namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	return &Client{
+		http:      client,
+		address:   strings.TrimRight(address, "/"),
+		namespace: namespace,
+	}
+}
+
+// Read fetches the secret at the provided API path (for example,
+// "secret/data/akvorado") using the provided token and returns its fields.
+// Transport errors are returned as is while unexpected HTTP statuses are
+// returned as a *StatusError.
+func (c *Client) Read(ctx context.Context, token, path string) (map[string]interface{}, error) {
+	url := fmt.Sprintf("%s/v1/%s", c.address, strings.TrimLeft(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build Vault request for %s: %v", path, err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Vault-Token", token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot query Vault for %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot query Vault for %s: %w", path,
+			&StatusError{Code: resp.StatusCode, Status: resp.Status})
+	}
+
+	var payload struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("cannot decode Vault answer for %s: %v", path, err)
+	}
+	data := payload.Data
+	// KV version 2 nests the secret in another "data" field.
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = nested
+		}
+	}
+	return data, nil
+}
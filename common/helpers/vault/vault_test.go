@@ -0,0 +1,86 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vault_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/helpers/vault"
+)
+
+func TestRead(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "network" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/akvorado":
+			w.Write([]byte(`{"data": {"data": {"username": "akvorado", "port": 830}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/akvorado":
+			w.Write([]byte(`{"data": {"username": "other"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_NAMESPACE", "network")
+	client := vault.New(nil, server.URL+"/", "")
+
+	cases := []struct {
+		Description string
+		Token       string
+		Path        string
+		Expected    map[string]interface{}
+		Status      int
+	}{
+		{
+			Description: "KV v2",
+			Token:       "s.token",
+			Path:        "secret/data/akvorado",
+			Expected:    map[string]interface{}{"username": "akvorado", "port": 830.},
+		}, {
+			Description: "KV v1",
+			Token:       "s.token",
+			Path:        "/kv/akvorado",
+			Expected:    map[string]interface{}{"username": "other"},
+		}, {
+			Description: "missing secret",
+			Token:       "s.token",
+			Path:        "secret/data/missing",
+			Status:      http.StatusNotFound,
+		}, {
+			Description: "invalid token",
+			Token:       "s.expired",
+			Path:        "secret/data/akvorado",
+			Status:      http.StatusForbidden,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := client.Read(context.Background(), tc.Token, tc.Path)
+			if tc.Status != 0 {
+				var statusErr *vault.StatusError
+				if !errors.As(err, &statusErr) {
+					t.Fatalf("Read() error:\n%+v", err)
+				}
+				if statusErr.Code != tc.Status {
+					t.Fatalf("Read() status %d instead of %d", statusErr.Code, tc.Status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("Read() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
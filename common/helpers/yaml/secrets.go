@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package yaml
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"akvorado/common/helpers/vault"
+)
+
+// secretResolvers maps a tag to the function fetching the secret it refers
+// to. The resolved value replaces the tagged node as a string.
+var secretResolvers = map[string]func(fs.FS, string) (string, error){
+	"!file":  resolveFile,
+	"!env":   resolveEnv,
+	"!vault": resolveVault,
+}
+
+// vaultTimeout is the maximum time to wait for an answer from Vault.
+var vaultTimeout = 10 * time.Second
+
+// resolveFile returns the content of the provided file, without the trailing
+// newlines. Relative paths are looked up in the provided fs while absolute
+// paths are read from the filesystem.
+func resolveFile(fsys fs.FS, path string) (string, error) {
+	var content []byte
+	var err error
+	if filepath.IsAbs(path) {
+		content, err = os.ReadFile(path)
+	} else {
+		content, err = fs.ReadFile(fsys, path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret file %s: %w", path, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// resolveEnv returns the value of the provided environment variable.
+func resolveEnv(_ fs.FS, name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// resolveVault fetches a secret from a Vault server. The reference is
+// "path#key", where path is the API path of the secret (for example,
+// "secret/data/akvorado") and key is the field to extract. Both KV version 1
+// and version 2 engines are supported. The server address and the token are
+// taken from the VAULT_ADDR and VAULT_TOKEN environment variables.
+func resolveVault(_ fs.FS, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || key == "" {
+		return "", fmt.Errorf("invalid Vault reference %q (expected path#key)", ref)
+	}
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", errors.New("VAULT_ADDR is not set")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return "", errors.New("VAULT_TOKEN is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), vaultTimeout)
+	defer cancel()
+	data, err := vault.New(nil, addr, "").Read(ctx, token, path)
+	if err != nil {
+		return "", err
+	}
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("no key %q in Vault secret %s", key, path)
+	}
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	default:
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("cannot encode key %q of Vault secret %s: %w", key, path, err)
+		}
+		return string(encoded), nil
+	}
+}
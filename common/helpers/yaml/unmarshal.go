@@ -2,7 +2,8 @@
 // SPDX-License-Identifier: AGPL-3.0-only
 
 // Package yaml implements YAML support for the Go language. It adds the ability
-// to use the "!include" tag.
+// to use the "!include" tag and to fetch secrets with the "!file", "!env" and
+// "!vault" tags.
 package yaml
 
 import (
@@ -21,7 +22,8 @@ func Unmarshal(in []byte, out interface{}) (err error) {
 
 // UnmarshalWithInclude decodes the first document found within the in byte
 // slice and assigns decoded values into the out value. It also accepts the
-// "!include" tag to include additional files contained in the provided fs.
+// "!include" tag to include additional files contained in the provided fs and
+// the "!file", "!env" and "!vault" tags to replace a scalar with a secret.
 func UnmarshalWithInclude(fsys fs.FS, input string, out interface{}) (err error) {
 	var outNode yaml.Node
 	in, err := fs.ReadFile(fsys, input)
@@ -59,15 +61,29 @@ func UnmarshalWithInclude(fsys fs.FS, input string, out interface{}) (err error)
 	for len(todo) > 0 {
 		current := todo[0]
 		todo = todo[1:]
-		if current.Tag != "!include" {
+		resolver, ok := secretResolvers[current.Tag]
+		if current.Tag != "!include" && !ok {
 			todo = append(todo, current.Content...)
 			continue
 		}
 		if current.Alias != nil {
-			return fmt.Errorf("at line %d of %s, no alias is allowed for !include", current.Line, input)
+			return fmt.Errorf("at line %d of %s, no alias is allowed for %s", current.Line, input, current.Tag)
 		}
 		if len(current.Content) > 0 {
-			return fmt.Errorf("at line %d of %s, no content is allowed for !include", current.Line, input)
+			return fmt.Errorf("at line %d of %s, no content is allowed for %s", current.Line, input, current.Tag)
+		}
+		if ok {
+			value, err := resolver(fsys, current.Value)
+			if err != nil {
+				return fmt.Errorf("at line %d of %s: %w", current.Line, input, err)
+			}
+			*current = yaml.Node{
+				Kind:  yaml.ScalarNode,
+				Tag:   "!!str",
+				Value: value,
+				Line:  current.Line,
+			}
+			continue
 		}
 		var outNode yaml.Node
 		if err := UnmarshalWithInclude(fsys, current.Value, &outNode); err != nil {
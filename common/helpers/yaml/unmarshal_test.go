@@ -4,8 +4,13 @@
 package yaml_test
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"akvorado/common/helpers"
 	"akvorado/common/helpers/yaml"
@@ -35,3 +40,104 @@ func TestUnmarshalWithIn(t *testing.T) {
 		t.Fatalf("UnmarshalWithInclude() (-got, +want):\n%s", diff)
 	}
 }
+
+func TestUnmarshalWithSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/akvorado":
+			w.Write([]byte(`{"data": {"data": {"dsn": "clickhouse://user:pass@db"}, "metadata": {"version": 1}}}`))
+		case "/v1/kv/akvorado":
+			w.Write([]byte(`{"data": {"dsn": "clickhouse://other:pass@db"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "s.token")
+	t.Setenv("AKVORADO_TEST_PASSWORD", "secret password")
+
+	t.Run("ok", func(t *testing.T) {
+		fsys := os.DirFS("testdata")
+		var got interface{}
+		if err := yaml.UnmarshalWithInclude(fsys, "secrets.yaml", &got); err != nil {
+			t.Fatalf("UnmarshalWithInclude() error:\n%+v", err)
+		}
+		expected := gin.H{
+			"community": "community",
+			"password":  "secret password",
+			"dsn":       "clickhouse://user:pass@db",
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("UnmarshalWithInclude() (-got, +want):\n%s", diff)
+		}
+	})
+
+	cases := []struct {
+		Description string
+		Input       string
+		Expected    interface{}
+		Error       string
+	}{
+		{
+			Description: "absolute file",
+			Input:       "community: !file ABSOLUTE",
+			Expected:    gin.H{"community": "community"},
+		}, {
+			Description: "vault KV v1",
+			Input:       "dsn: !vault kv/akvorado#dsn",
+			Expected:    gin.H{"dsn": "clickhouse://other:pass@db"},
+		}, {
+			Description: "missing file",
+			Input:       "community: !file missing.secret",
+			Error:       "cannot read secret file missing.secret",
+		}, {
+			Description: "missing variable",
+			Input:       "password: !env AKVORADO_TEST_MISSING",
+			Error:       "environment variable AKVORADO_TEST_MISSING is not set",
+		}, {
+			Description: "invalid Vault reference",
+			Input:       "dsn: !vault secret/data/akvorado",
+			Error:       "invalid Vault reference",
+		}, {
+			Description: "missing Vault secret",
+			Input:       "dsn: !vault secret/data/missing#dsn",
+			Error:       "unexpected status 404",
+		}, {
+			Description: "missing Vault key",
+			Input:       "dsn: !vault secret/data/akvorado#password",
+			Error:       `no key "password" in Vault secret`,
+		},
+	}
+	absolute, err := filepath.Abs("testdata/community.secret")
+	if err != nil {
+		t.Fatalf("Abs() error:\n%+v", err)
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			input := strings.ReplaceAll(tc.Input, "ABSOLUTE", absolute)
+			fsys := fstest.MapFS{
+				"input.yaml":       &fstest.MapFile{Data: []byte(input)},
+				"community.secret": &fstest.MapFile{Data: []byte("community\n")},
+			}
+			var got interface{}
+			err := yaml.UnmarshalWithInclude(fsys, "input.yaml", &got)
+			if tc.Error != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.Error) {
+					t.Fatalf("UnmarshalWithInclude() error:\n%+v\nexpected: %s", err, tc.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalWithInclude() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("UnmarshalWithInclude() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
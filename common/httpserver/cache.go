@@ -15,18 +15,36 @@ import (
 	"akvorado/common/reporter"
 )
 
-// CacheByRequestPath is a middleware to cache the request using path as key
+// CacheScopeKey is the key in the request context for an optional cache
+// scope. Requests with different scopes do not share cached responses.
+const CacheScopeKey = "cache-scope"
+
+// CacheByRequestPath is a middleware to cache the request using path (and
+// cache scope, if any) as key
 func (c *Component) CacheByRequestPath(expire time.Duration) gin.HandlerFunc {
 	opts := c.commonCacheOptions()
 	opts = append(opts, cache.WithCacheStrategyByRequest(func(gc *gin.Context) (bool, cache.Strategy) {
 		return true, cache.Strategy{
-			CacheKey: gc.Request.URL.Path,
+			CacheKey: gc.GetString(CacheScopeKey) + gc.Request.URL.Path,
+		}
+	}))
+	return cache.Cache(c.cacheStore, expire, opts...)
+}
+
+// CacheByRequestURI is a middleware to cache the request using path and query
+// string (and cache scope, if any) as key
+func (c *Component) CacheByRequestURI(expire time.Duration) gin.HandlerFunc {
+	opts := c.commonCacheOptions()
+	opts = append(opts, cache.WithCacheStrategyByRequest(func(gc *gin.Context) (bool, cache.Strategy) {
+		return true, cache.Strategy{
+			CacheKey: gc.GetString(CacheScopeKey) + gc.Request.URL.RequestURI(),
 		}
 	}))
 	return cache.Cache(c.cacheStore, expire, opts...)
 }
 
-// CacheByRequestBody is a middleware to cache the request using body as key
+// CacheByRequestBody is a middleware to cache the request using body (and
+// cache scope, if any) as key
 func (c *Component) CacheByRequestBody(expire time.Duration) gin.HandlerFunc {
 	opts := c.commonCacheOptions()
 	opts = append(opts, cache.WithCacheStrategyByRequest(func(gc *gin.Context) (bool, cache.Strategy) {
@@ -38,7 +56,7 @@ func (c *Component) CacheByRequestBody(expire time.Duration) gin.HandlerFunc {
 		h := crypto.SHA256.New()
 		bodyHash := string(h.Sum(requestBody))
 		return true, cache.Strategy{
-			CacheKey: bodyHash,
+			CacheKey: gc.GetString(CacheScopeKey) + bodyHash,
 		}
 	}))
 	return cache.Cache(c.cacheStore, expire, opts...)
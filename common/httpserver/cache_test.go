@@ -61,12 +61,47 @@ func TestCacheByRequestPath(t *testing.T) {
 	}
 }
 
+func TestCacheByRequestURI(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+
+	count := 0
+	h.GinRouter.GET("/api/v0/test",
+		h.CacheByRequestURI(time.Minute),
+		func(c *gin.Context) {
+			count++
+			c.JSON(http.StatusOK, gin.H{
+				"message": c.Query("message"),
+				"count":   count,
+			})
+		})
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "not cached",
+			URL:         "/api/v0/test?message=ping",
+			JSONOutput:  gin.H{"message": "ping", "count": 1},
+		}, {
+			Description: "cached",
+			URL:         "/api/v0/test?message=ping",
+			JSONOutput:  gin.H{"message": "ping", "count": 1},
+		}, {
+			Description: "another query string",
+			URL:         "/api/v0/test?message=pong",
+			JSONOutput:  gin.H{"message": "pong", "count": 2},
+		},
+	})
+}
+
 func TestCacheByRequestBody(t *testing.T) {
 	r := reporter.NewMock(t)
 	h := httpserver.NewMock(t, r)
 
 	count := 0
 	h.GinRouter.POST("/api/v0/test",
+		func(c *gin.Context) {
+			c.Set(httpserver.CacheScopeKey, c.GetHeader("X-Scope"))
+		},
 		h.CacheByRequestBody(time.Minute),
 		func(c *gin.Context) {
 			count++
@@ -103,14 +138,24 @@ func TestCacheByRequestBody(t *testing.T) {
 			URL:         "/api/v0/test",
 			JSONInput:   gin.H{"hop": 2},
 			JSONOutput:  gin.H{"message": "ping", "count": 2, "body": `{"hop":2}` + "\n"},
+		}, {
+			Description: "different scope",
+			URL:         "/api/v0/test",
+			Header: func() http.Header {
+				headers := make(http.Header)
+				headers.Add("X-Scope", "restricted")
+				return headers
+			}(),
+			JSONInput:  gin.H{"hop": 2},
+			JSONOutput: gin.H{"message": "ping", "count": 3, "body": `{"hop":2}` + "\n"},
 		},
 	})
 
 	gotMetrics := r.GetMetrics("akvorado_common_httpserver_", "requests_", "cache_")
 	expectedMetrics := map[string]string{
 		`cache_hit_total{method="POST",path="/api/v0/test"}`:       "2",
-		`cache_miss_total{method="POST",path="/api/v0/test"}`:      "2",
-		`requests_total{code="200",handler="/api/",method="post"}`: "4",
+		`cache_miss_total{method="POST",path="/api/v0/test"}`:      "3",
+		`requests_total{code="200",handler="/api/",method="post"}`: "5",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
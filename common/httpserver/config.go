@@ -5,24 +5,33 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"runtime"
 	"time"
 
 	"akvorado/common/helpers"
+	akvpersist "akvorado/common/persist"
 
 	"github.com/chenyahui/gin-cache/persist"
-	"github.com/go-redis/redis/v8"
 )
 
 // Configuration describes the configuration for the HTTP server.
 type Configuration struct {
-	// Listen defines the listening string to listen to.
-	Listen string `validate:"required,listen"`
+	// Listen defines the listening string to listen to. It can also be an
+	// Unix socket ("unix:/path") or a socket passed by systemd
+	// ("systemd:name").
+	Listen string `validate:"required,listen|startswith=unix:|startswith=systemd:"`
+	// AdminSocket is the path of an Unix socket serving the same handlers,
+	// notably for "akvorado admin".
+	AdminSocket string
 	// Profiler enables Go profiler as /debug
 	Profiler bool
 	// Cache configuration
 	Cache CacheConfiguration
+	// DeprecatedAPISunset is the date after which the deprecated version of
+	// the API may be removed. It is advertised with the Sunset header.
+	DeprecatedAPISunset time.Time
 }
 
 // CacheConfiguration describes the configuration of the internal HTTP cache.
@@ -53,28 +62,14 @@ func DefaultMemoryCacheConfiguration() CacheBackendConfiguration {
 }
 
 // RedisCacheConfiguration is the configuration for a Redis cache.
-type RedisCacheConfiguration struct {
-	// Protocol to connect with
-	Protocol string `validate:"oneof=tcp unix"`
-	// Server to connect to (with port)
-	Server string `validate:"required,listen"`
-	// Optional username
-	Username string
-	// Optional password
-	Password string
-	// Database to connect to
-	DB int
-}
+type RedisCacheConfiguration akvpersist.RedisConfiguration
 
 // New creates a new Redis cache store from a Redis cache configuration.
 func (c RedisCacheConfiguration) New() (persist.CacheStore, error) {
-	client := redis.NewClient(&redis.Options{
-		Network:  c.Protocol,
-		Addr:     c.Server,
-		Username: c.Username,
-		Password: c.Password,
-		DB:       c.DB,
-	})
+	if c.Server == "" {
+		return nil, errors.New("no Redis server configured for the cache")
+	}
+	client := akvpersist.RedisConfiguration(c).NewClient()
 	store := persist.NewRedisStore(client)
 	runtime.SetFinalizer(store, func(*persist.RedisStore) { client.Close() })
 	if _, err := client.Ping(context.Background()).Result(); err != nil {
@@ -6,10 +6,14 @@ package httpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net"
 	"net/http"
 	"net/http/pprof"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/chenyahui/gin-cache/persist"
@@ -23,6 +27,9 @@ import (
 	"akvorado/common/reporter"
 )
 
+// unixPrefix is the prefix of listening addresses designating an Unix socket.
+const unixPrefix = "unix:"
+
 // Component represents the HTTP compomenent.
 type Component struct {
 	r      *reporter.Reporter
@@ -62,6 +69,8 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		return nil, err
 	}
 	c.GinRouter.Use(gin.Recovery())
+	c.GinRouter.NoRoute(c.apiVersionShim)
+	c.GinRouter.GET("/api/versions", c.apiVersionsHandler)
 	c.AddHandler("/api/", c.GinRouter)
 	if configuration.Profiler {
 		c.mux.HandleFunc("/debug/pprof/", pprof.Index)
@@ -104,25 +113,42 @@ func (c *Component) Start() error {
 	if c.config.Listen == "" {
 		return nil
 	}
-	server := &http.Server{Handler: c.mux}
+	server := &http.Server{Handler: c.apiVersionHeaders(c.mux)}
 
 	// Most of the time, if we have an error, it's here!
 	c.r.Info().Str("listen", c.config.Listen).Msg("starting HTTP server")
-	listener, err := net.Listen("tcp", c.config.Listen)
+	listener, err := listen(c.config.Listen)
 	if err != nil {
 		return fmt.Errorf("unable to listen to %v: %w", c.config.Listen, err)
 	}
 	c.address = listener.Addr()
 	server.Addr = listener.Addr().String()
+	listeners := []net.Listener{listener}
+	if c.config.AdminSocket != "" {
+		adminListener, err := listenUnix(c.config.AdminSocket)
+		if err != nil {
+			listener.Close()
+			return fmt.Errorf("unable to listen to %v: %w", c.config.AdminSocket, err)
+		}
+		if err := os.Chmod(c.config.AdminSocket, 0o600); err != nil {
+			listener.Close()
+			adminListener.Close()
+			return fmt.Errorf("unable to restrict access to %v: %w", c.config.AdminSocket, err)
+		}
+		listeners = append(listeners, adminListener)
+	}
 
 	// Start serving requests
-	c.t.Go(func() error {
-		if err := server.Serve(listener); err != http.ErrServerClosed {
-			c.r.Err(err).Str("listen", c.config.Listen).Msg("unable to start HTTP server")
-			return fmt.Errorf("unable to start HTTP server: %w", err)
-		}
-		return nil
-	})
+	for _, listener := range listeners {
+		listener := listener
+		c.t.Go(func() error {
+			if err := server.Serve(listener); err != http.ErrServerClosed {
+				c.r.Err(err).Str("listen", listener.Addr().String()).Msg("unable to start HTTP server")
+				return fmt.Errorf("unable to start HTTP server: %w", err)
+			}
+			return nil
+		})
+	}
 
 	// Gracefully stop when asked to
 	c.t.Go(func() error {
@@ -149,6 +175,34 @@ func (c *Component) Stop() error {
 	return c.t.Wait()
 }
 
+// listen returns a listener for the provided address. It can be a TCP address,
+// an Unix socket prefixed by "unix:" or a socket passed by systemd prefixed by
+// "systemd:".
+func listen(address string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, unixPrefix):
+		return listenUnix(strings.TrimPrefix(address, unixPrefix))
+	case strings.HasPrefix(address, daemon.ActivationPrefix):
+		name := strings.TrimPrefix(address, daemon.ActivationPrefix)
+		files := daemon.ActivatedFiles(name)
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no socket %q passed by systemd", name)
+		}
+		return net.FileListener(files[0])
+	default:
+		return net.Listen("tcp", address)
+	}
+}
+
+// listenUnix listens to the provided Unix socket, removing the one left by a
+// previous instance.
+func listenUnix(path string) (net.Listener, error) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
 // LocalAddr returns the address the HTTP server is listening to.
 func (c *Component) LocalAddr() net.Addr {
 	return c.address
@@ -4,10 +4,16 @@
 package httpserver_test
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"akvorado/common/daemon"
 	"akvorado/common/helpers"
 	"akvorado/common/httpserver"
 	"akvorado/common/reporter"
@@ -91,3 +97,121 @@ func TestGinRouterPanic(t *testing.T) {
 		},
 	})
 }
+
+func TestAdminSocket(t *testing.T) {
+	r := reporter.NewMock(t)
+	socket := filepath.Join(t.TempDir(), "admin.sock")
+	config := httpserver.DefaultConfiguration()
+	config.Listen = "127.0.0.1:0"
+	config.AdminSocket = socket
+	h, err := httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ping"})
+	})
+	helpers.StartStop(t, h)
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatalf("Stat() error:\n%+v", err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Stat() mode == %v, expected 0600", info.Mode().Perm())
+	}
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://akvorado/api/v0/test")
+	if err != nil {
+		t.Fatalf("Get() error:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if diff := helpers.Diff(string(body), `{"message":"ping"}`); diff != "" {
+		t.Fatalf("Get() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	r := reporter.NewMock(t)
+	socket := filepath.Join(t.TempDir(), "http.sock")
+	config := httpserver.DefaultConfiguration()
+	config.Listen = fmt.Sprintf("unix:%s", socket)
+	h, err := httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ping"})
+	})
+	helpers.StartStop(t, h)
+
+	client := http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://akvorado/api/v0/test")
+	if err != nil {
+		t.Fatalf("Get() error:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if diff := helpers.Diff(string(body), `{"message":"ping"}`); diff != "" {
+		t.Fatalf("Get() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestListenSystemd(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatalf("File() error:\n%+v", err)
+	}
+	defer file.Close()
+	daemon.MockActivatedFiles(t, "http", file)
+
+	r := reporter.NewMock(t)
+	config := httpserver.DefaultConfiguration()
+	config.Listen = "systemd:http"
+	h, err := httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ping"})
+	})
+	helpers.StartStop(t, h)
+	if diff := helpers.Diff(h.LocalAddr().String(), listener.Addr().String()); diff != "" {
+		t.Fatalf("LocalAddr() (-got, +want):\n%s", diff)
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/test",
+			JSONOutput: gin.H{"message": "ping"},
+		},
+	})
+
+	// Without the socket, an error is returned
+	config.Listen = "systemd:unknown"
+	h, err = httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := h.Start(); err == nil {
+		h.Stop()
+		t.Fatal("Start() did not error")
+	}
+}
@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package httpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// currentAPIVersion is the current version of the API.
+	currentAPIVersion = "v1"
+	// deprecatedAPIVersion is the previous version of the API. It is still
+	// served but its use is deprecated.
+	deprecatedAPIVersion = "v0"
+)
+
+// requestedAPIVersion returns the version of the API explicitly requested by
+// the client, either with the `API-Version` header or with the `version`
+// parameter of the `Accept` header (for example `application/json;
+// version=v1`). It returns an empty string when no version is requested.
+func requestedAPIVersion(r *http.Request) string {
+	if version := r.Header.Get("API-Version"); version != "" {
+		return strings.TrimSpace(version)
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(accept); err == nil && params["version"] != "" {
+			return params["version"]
+		}
+	}
+	return ""
+}
+
+// apiVersionHeaders negotiates the version of the API and adds headers
+// related to the API version to the response. When the client explicitly
+// requests a version, the request is served by this version, whatever the
+// version in the path. Requests to the deprecated version of the API get a
+// `Deprecation` header, a `Link` header pointing to the successor and, if
+// configured, a `Sunset` header.
+func (c *Component) apiVersionHeaders(handler http.Handler) http.Handler {
+	deprecatedPrefix := fmt.Sprintf("/api/%s/", deprecatedAPIVersion)
+	currentPrefix := fmt.Sprintf("/api/%s/", currentAPIVersion)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "API-Version, Accept")
+		if requested := requestedAPIVersion(r); requested != "" {
+			if requested != currentAPIVersion && requested != deprecatedAPIVersion {
+				w.Header().Set("Content-Type", "application/json; charset=utf-8")
+				w.WriteHeader(http.StatusNotAcceptable)
+				json.NewEncoder(w).Encode(gin.H{
+					"message":  fmt.Sprintf("Unsupported API version %q.", requested),
+					"versions": []string{currentAPIVersion, deprecatedAPIVersion},
+				})
+				return
+			}
+			for _, prefix := range []string{currentPrefix, deprecatedPrefix} {
+				if strings.HasPrefix(r.URL.Path, prefix) {
+					r = r.Clone(r.Context())
+					r.URL.Path = fmt.Sprintf("/api/%s/%s", requested, strings.TrimPrefix(r.URL.Path, prefix))
+					r.URL.RawPath = ""
+					r.RequestURI = r.URL.RequestURI()
+					break
+				}
+			}
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, currentPrefix):
+			w.Header().Set("API-Version", currentAPIVersion)
+		case strings.HasPrefix(r.URL.Path, deprecatedPrefix):
+			w.Header().Set("API-Version", deprecatedAPIVersion)
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", fmt.Sprintf(`<%s%s>; rel="successor-version"`,
+				currentPrefix, strings.TrimPrefix(r.URL.Path, deprecatedPrefix)))
+			if !c.config.DeprecatedAPISunset.IsZero() {
+				w.Header().Set("Sunset", c.config.DeprecatedAPISunset.UTC().Format(http.TimeFormat))
+			}
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// apiVersionShim serves requests for the current version of the API with
+// the handlers of the deprecated version when no specific handler exists.
+// Endpoints only need to be registered for the current version when their
+// behavior differs.
+func (c *Component) apiVersionShim(gc *gin.Context) {
+	currentPrefix := fmt.Sprintf("/api/%s/", currentAPIVersion)
+	if !strings.HasPrefix(gc.Request.URL.Path, currentPrefix) {
+		return
+	}
+	gc.Status(http.StatusOK)
+	r := gc.Request.Clone(gc.Request.Context())
+	r.URL.Path = fmt.Sprintf("/api/%s/%s",
+		deprecatedAPIVersion, strings.TrimPrefix(r.URL.Path, currentPrefix))
+	r.URL.RawPath = ""
+	r.RequestURI = r.URL.RequestURI()
+	c.mux.ServeHTTP(gc.Writer, r)
+}
+
+// apiVersionsHandler lists the available versions of the API.
+func (c *Component) apiVersionsHandler(gc *gin.Context) {
+	response := gin.H{
+		"current":    currentAPIVersion,
+		"deprecated": []string{deprecatedAPIVersion},
+	}
+	if !c.config.DeprecatedAPISunset.IsZero() {
+		response["sunset"] = c.config.DeprecatedAPISunset.UTC()
+	}
+	gc.JSON(http.StatusOK, response)
+}
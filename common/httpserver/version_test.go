@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package httpserver_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+func TestAPIVersions(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := httpserver.DefaultConfiguration()
+	config.Listen = "127.0.0.1:0"
+	config.DeprecatedAPISunset = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	h, err := httpserver.New(r, config, httpserver.Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, h)
+
+	h.GinRouter.GET("/api/v0/test", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": 0})
+	})
+	h.GinRouter.GET("/api/v0/other", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": 0})
+	})
+	h.GinRouter.GET("/api/v1/other", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"version": 1})
+	})
+	h.AddHandler("/api/v0/raw",
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "Hello !")
+		}))
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/test",
+			JSONOutput: gin.H{"version": 0},
+		}, {
+			URL:        "/api/v1/test",
+			JSONOutput: gin.H{"version": 0},
+		}, {
+			URL:        "/api/v1/other",
+			JSONOutput: gin.H{"version": 1},
+		}, {
+			URL:         "/api/v1/raw",
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"Hello !"},
+		}, {
+			URL:         "/api/v1/missing",
+			ContentType: "text/plain",
+			StatusCode:  404,
+			FirstLines:  []string{"404 page not found"},
+		}, {
+			URL: "/api/versions",
+			JSONOutput: gin.H{
+				"current":    "v1",
+				"deprecated": []string{"v0"},
+				"sunset":     "2025-06-01T00:00:00Z",
+			},
+		},
+	})
+
+	cases := []struct {
+		URL      string
+		Request  map[string]string
+		Status   int
+		Expected map[string]string
+	}{
+		{
+			URL: "/api/v0/test",
+			Expected: map[string]string{
+				"Api-Version": "v0",
+				"Deprecation": "true",
+				"Link":        `</api/v1/test>; rel="successor-version"`,
+				"Sunset":      "Sun, 01 Jun 2025 00:00:00 GMT",
+			},
+		}, {
+			URL: "/api/v1/test",
+			Expected: map[string]string{
+				"Api-Version": "v1",
+				"Deprecation": "",
+				"Link":        "",
+				"Sunset":      "",
+			},
+		}, {
+			URL:     "/api/v0/other",
+			Request: map[string]string{"API-Version": "v1"},
+			Expected: map[string]string{
+				"Api-Version": "v1",
+				"Deprecation": "",
+				"Vary":        "API-Version, Accept",
+			},
+		}, {
+			URL:     "/api/v1/other",
+			Request: map[string]string{"Accept": "application/json; version=v0"},
+			Expected: map[string]string{
+				"Api-Version": "v0",
+				"Deprecation": "true",
+			},
+		}, {
+			URL:     "/api/v1/other",
+			Request: map[string]string{"API-Version": "v7"},
+			Status:  406,
+			Expected: map[string]string{
+				"Api-Version": "",
+			},
+		},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s%s", h.LocalAddr(), tc.URL), nil)
+		for header, value := range tc.Request {
+			req.Header.Set(header, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s:\n%+v", tc.URL, err)
+		}
+		resp.Body.Close()
+		if tc.Status == 0 {
+			tc.Status = 200
+		}
+		if resp.StatusCode != tc.Status {
+			t.Errorf("GET %s status: %d, expected %d", tc.URL, resp.StatusCode, tc.Status)
+		}
+		got := map[string]string{}
+		for header := range tc.Expected {
+			got[header] = resp.Header.Get(header)
+		}
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("GET %s headers (-got, +want):\n%s", tc.URL, diff)
+		}
+	}
+}
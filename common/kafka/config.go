@@ -37,6 +37,16 @@ type TLSAndSASLConfiguration struct {
 	SASLPassword string `validate:"required_with=SASLAlgorithm SASLUsername"`
 	// SASLMechanism tells the SASL algorithm
 	SASLMechanism SASLMechanism `validate:"required_with=SASLUsername"`
+	// SASLOAuthTokenURL tells the URL to use to request OAuth tokens when
+	// using OAUTHBEARER. The username and password are used as client ID and
+	// secret.
+	SASLOAuthTokenURL string `validate:"omitempty,url"`
+	// SASLOAuthScopes is the list of scopes to request with OAUTHBEARER
+	SASLOAuthScopes []string
+	// SASLAWSRegion tells the AWS region of the cluster when using AWS MSK
+	// IAM. The username and password are used as access key ID and secret
+	// access key. When they are empty, they are taken from the environment.
+	SASLAWSRegion string
 }
 
 // DefaultConfiguration represents the default configuration for connecting to Kafka.
@@ -85,6 +95,8 @@ const (
 	SASLPlainText                        // SASLPlainText means user/password in plain text
 	SASLSCRAMSHA256                      // SASLSCRAMSHA256 enables SCRAM challenge with SHA256
 	SASLSCRAMSHA512                      // SASLSCRAMSHA512 enables SCRAM challenge with SHA512
+	SASLOAuth                            // SASLOAuth enables OAUTHBEARER with tokens from an OAuth provider
+	SASLAWSMSKIAM                        // SASLAWSMSKIAM enables OAUTHBEARER with AWS MSK IAM tokens
 )
 
 var saslAlgorithmMap = bimap.New(map[SASLMechanism]string{
@@ -92,6 +104,8 @@ var saslAlgorithmMap = bimap.New(map[SASLMechanism]string{
 	SASLPlainText:   "plain",
 	SASLSCRAMSHA256: "scram-sha256",
 	SASLSCRAMSHA512: "scram-sha512",
+	SASLOAuth:       "oauth",
+	SASLAWSMSKIAM:   "aws-msk-iam",
 })
 
 // MarshalText turns a SASL algorithm to text
@@ -135,7 +149,7 @@ func NewConfig(config Configuration) (*sarama.Config, error) {
 		kafkaConfig.Net.TLS.Enable = true
 		kafkaConfig.Net.TLS.Config = tlsConfig
 		// SASL
-		if config.TLS.SASLUsername != "" {
+		if config.TLS.SASLUsername != "" || config.TLS.SASLMechanism == SASLAWSMSKIAM {
 			kafkaConfig.Net.SASL.Enable = true
 			kafkaConfig.Net.SASL.User = config.TLS.SASLUsername
 			kafkaConfig.Net.SASL.Password = config.TLS.SASLPassword
@@ -154,6 +168,26 @@ func NewConfig(config Configuration) (*sarama.Config, error) {
 					return &xdgSCRAMClient{HashGeneratorFcn: sha512.New}
 				}
 			}
+			if config.TLS.SASLMechanism == SASLOAuth {
+				if config.TLS.SASLOAuthTokenURL == "" {
+					return nil, errors.New("a token URL is required for OAuth")
+				}
+				kafkaConfig.Net.SASL.Handshake = true
+				kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+				kafkaConfig.Net.SASL.TokenProvider = newOAuthTokenProvider(
+					config.TLS.SASLUsername, config.TLS.SASLPassword,
+					config.TLS.SASLOAuthTokenURL, config.TLS.SASLOAuthScopes)
+			}
+			if config.TLS.SASLMechanism == SASLAWSMSKIAM {
+				if config.TLS.SASLAWSRegion == "" {
+					return nil, errors.New("a region is required for AWS MSK IAM")
+				}
+				kafkaConfig.Net.SASL.Handshake = true
+				kafkaConfig.Net.SASL.Mechanism = sarama.SASLTypeOAuth
+				kafkaConfig.Net.SASL.TokenProvider = newMSKIAMTokenProvider(
+					config.TLS.SASLAWSRegion,
+					config.TLS.SASLUsername, config.TLS.SASLPassword)
+			}
 		}
 	}
 	return kafkaConfig, nil
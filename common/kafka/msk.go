@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	mskIAMService    = "kafka-cluster"
+	mskIAMAction     = "kafka-cluster:Connect"
+	mskIAMExpiration = 15 * time.Minute
+	mskIAMUserAgent  = "akvorado"
+	// mskIAMEmptyPayloadHash is the SHA256 of an empty payload.
+	mskIAMEmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// mskIAMTokenProvider provides tokens for SASL/OAUTHBEARER with AWS MSK IAM.
+// A token is a presigned URL for the "kafka-cluster:Connect" action, signed
+// with AWS Signature Version 4.
+type mskIAMTokenProvider struct {
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	now             func() time.Time
+}
+
+func newMSKIAMTokenProvider(region, accessKeyID, secretAccessKey string) *mskIAMTokenProvider {
+	return &mskIAMTokenProvider{
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		now:             time.Now,
+	}
+}
+
+// credentials returns the AWS credentials to use. When they are not
+// configured, they are taken from the environment.
+func (p *mskIAMTokenProvider) credentials() (string, string, string, error) {
+	if p.accessKeyID != "" {
+		return p.accessKeyID, p.secretAccessKey, "", nil
+	}
+	accessKeyID := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretAccessKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKeyID == "" || secretAccessKey == "" {
+		return "", "", "", errors.New("no AWS credentials available")
+	}
+	return accessKeyID, secretAccessKey, os.Getenv("AWS_SESSION_TOKEN"), nil
+}
+
+// Token returns a new token. As tokens are cheap to build, they are not
+// cached.
+func (p *mskIAMTokenProvider) Token() (*sarama.AccessToken, error) {
+	accessKeyID, secretAccessKey, sessionToken, err := p.credentials()
+	if err != nil {
+		return nil, err
+	}
+	now := p.now().UTC()
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	host := fmt.Sprintf("kafka.%s.amazonaws.com", p.region)
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, p.region, mskIAMService)
+
+	query := url.Values{}
+	query.Set("Action", mskIAMAction)
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", fmt.Sprintf("%s/%s", accessKeyID, scope))
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", fmt.Sprintf("%d", int(mskIAMExpiration.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if sessionToken != "" {
+		query.Set("X-Amz-Security-Token", sessionToken)
+	}
+	canonicalQuery := sigV4CanonicalQuery(query)
+	canonicalRequest := strings.Join([]string{
+		"GET",
+		"/",
+		canonicalQuery,
+		fmt.Sprintf("host:%s\n", host),
+		"host",
+		mskIAMEmptyPayloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, p.region, mskIAMService, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	signedURL := fmt.Sprintf("https://%s/?%s&X-Amz-Signature=%s&User-Agent=%s",
+		host, canonicalQuery, signature, mskIAMUserAgent)
+	return &sarama.AccessToken{
+		Token: base64.RawURLEncoding.EncodeToString([]byte(signedURL)),
+	}, nil
+}
+
+// sigV4CanonicalQuery encodes a query string as expected by AWS Signature
+// Version 4: keys are sorted and values are encoded following RFC 3986.
+func sigV4CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", sigV4Escape(key), sigV4Escape(query.Get(key))))
+	}
+	return strings.Join(parts, "&")
+}
+
+// sigV4Escape escapes a string following RFC 3986.
+func sigV4Escape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/IBM/sarama"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// oauthTokenProvider provides OAuth tokens for SASL/OAUTHBEARER using the
+// client credentials flow. Tokens are cached and refreshed when they are about
+// to expire.
+type oauthTokenProvider struct {
+	tokenSource oauth2.TokenSource
+}
+
+func newOAuthTokenProvider(clientID, clientSecret, tokenURL string, scopes []string) *oauthTokenProvider {
+	config := clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+	}
+	// Sarama expects the provider to not block indefinitely.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient,
+		&http.Client{Timeout: 10 * time.Second})
+	return &oauthTokenProvider{
+		tokenSource: config.TokenSource(ctx),
+	}
+}
+
+// Token returns a valid token, requesting a new one if needed.
+func (p *oauthTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &sarama.AccessToken{Token: token.AccessToken}, nil
+}
@@ -0,0 +1,29 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package leader
+
+import "time"
+
+// Configuration describes the configuration for the leader election
+// component.
+type Configuration struct {
+	// Enabled tells if leader election is enabled. When disabled, this
+	// instance is always the leader.
+	Enabled bool
+	// LeaseDuration is how long a leader keeps its leadership without
+	// renewing it.
+	LeaseDuration time.Duration `validate:"min=1s"`
+	// RenewInterval is how often a candidate renews its candidacy.
+	RenewInterval time.Duration `validate:"min=100ms,ltfield=LeaseDuration"`
+}
+
+// DefaultConfiguration represents the default configuration for the leader
+// election component.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Enabled:       false,
+		LeaseDuration: 30 * time.Second,
+		RenewInterval: 10 * time.Second,
+	}
+}
@@ -0,0 +1,197 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package leader elects a leader among several replicas of a service to run
+// singleton jobs. The election uses a ClickHouse table: each candidate
+// periodically inserts a heartbeat and the leader is the oldest candidate with
+// a fresh heartbeat.
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/reporter"
+)
+
+// Component represents the leader election component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	name         string
+	id           string
+	since        time.Time
+	leader       atomic.Bool
+	tableCreated bool
+
+	metrics struct {
+		leader reporter.Gauge
+		errors reporter.Counter
+	}
+}
+
+// Dependencies define the dependencies of the leader election component.
+type Dependencies struct {
+	ClickHouse *clickhousedb.Component
+}
+
+// New creates a new leader election component. The name identifies the
+// election: only candidates using the same name compete.
+func New(r *reporter.Reporter, name string, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	random := make([]byte, 4)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("cannot generate candidate identifier: %w", err)
+	}
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+		name:   name,
+		id:     fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(random)),
+	}
+	c.metrics.leader = r.Gauge(
+		reporter.GaugeOpts{
+			Name: "leader",
+			Help: "1 if this instance is the leader.",
+		},
+	)
+	c.metrics.errors = r.Counter(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Number of errors while campaigning for leadership.",
+		},
+	)
+	return &c, nil
+}
+
+// Start starts the leader election component.
+func (c *Component) Start() error {
+	if !c.config.Enabled {
+		c.setLeader(true)
+		return nil
+	}
+	c.r.Info().Str("id", c.id).Msg("starting leader election component")
+	c.since = time.Now()
+	c.t.Go(func() error {
+		errLogger := c.r.Sample(reporter.BurstSampler(time.Minute, 1))
+		ticker := time.NewTicker(c.config.RenewInterval)
+		defer ticker.Stop()
+		for {
+			if err := c.campaign(); err != nil {
+				errLogger.Err(err).Msg("cannot campaign for leadership")
+				c.metrics.errors.Inc()
+				// Without a fresh heartbeat, another candidate may
+				// become the leader. Step down.
+				c.setLeader(false)
+			}
+			select {
+			case <-c.t.Dying():
+				c.resign()
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+	return nil
+}
+
+// Stop stops the leader election component.
+func (c *Component) Stop() error {
+	if !c.config.Enabled {
+		return nil
+	}
+	c.r.Info().Msg("stopping leader election component")
+	defer c.r.Info().Msg("leader election component stopped")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// IsLeader tells if this instance is currently the leader.
+func (c *Component) IsLeader() bool {
+	return c.leader.Load()
+}
+
+// setLeader updates the leadership status.
+func (c *Component) setLeader(leader bool) {
+	if c.leader.Swap(leader) != leader {
+		if leader {
+			c.r.Info().Str("id", c.id).Msg("this instance is now the leader")
+		} else if c.config.Enabled {
+			c.r.Info().Str("id", c.id).Msg("this instance is not the leader anymore")
+		}
+	}
+	if leader {
+		c.metrics.leader.Set(1)
+	} else {
+		c.metrics.leader.Set(0)
+	}
+}
+
+// campaign renews our candidacy and checks who is the leader.
+func (c *Component) campaign() error {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.RenewInterval)
+	defer cancel()
+	if !c.tableCreated {
+		if err := c.d.ClickHouse.Exec(ctx, `
+CREATE TABLE IF NOT EXISTS leader_election (
+ name LowCardinality(String),
+ holder String,
+ since DateTime64(3),
+ heartbeat DateTime64(3)
+)
+ENGINE = ReplacingMergeTree
+ORDER BY (name, holder)
+TTL toDateTime(heartbeat) + INTERVAL 1 DAY
+`); err != nil {
+			return fmt.Errorf("cannot create leader election table: %w", err)
+		}
+		c.tableCreated = true
+	}
+	if err := c.d.ClickHouse.Exec(ctx,
+		`INSERT INTO leader_election (name, holder, since, heartbeat) VALUES ($1, $2, $3, now64(3))`,
+		c.name, c.id, c.since); err != nil {
+		return fmt.Errorf("cannot renew candidacy: %w", err)
+	}
+	var results []struct {
+		Holder string `ch:"holder"`
+	}
+	if err := c.d.ClickHouse.Select(ctx, &results, `
+SELECT holder
+FROM leader_election FINAL
+WHERE name = $1
+AND heartbeat > now64(3) - toIntervalMillisecond($2)
+ORDER BY since, holder
+LIMIT 1`, c.name, c.config.LeaseDuration.Milliseconds()); err != nil {
+		return fmt.Errorf("cannot query leader: %w", err)
+	}
+	c.setLeader(len(results) == 1 && results[0].Holder == c.id)
+	return nil
+}
+
+// resign expires our candidacy to let another candidate take over
+// immediately.
+func (c *Component) resign() {
+	c.setLeader(false)
+	ctx, cancel := context.WithTimeout(context.Background(), c.config.RenewInterval)
+	defer cancel()
+	if err := c.d.ClickHouse.Exec(ctx,
+		`INSERT INTO leader_election (name, holder, since, heartbeat) VALUES ($1, $2, $3, toDateTime64(0, 3))`,
+		c.name, c.id, c.since); err != nil {
+		c.r.Err(err).Msg("cannot resign from leadership")
+	}
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package leader
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, _ := clickhousedb.NewMock(t, r)
+	c, err := New(r, "test", DefaultConfiguration(), Dependencies{ClickHouse: chComponent})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	if !c.IsLeader() {
+		t.Fatal("IsLeader() should be true when election is disabled")
+	}
+}
+
+func TestElection(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mock := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.Enabled = true
+	config.RenewInterval = 20 * time.Millisecond
+	c, err := New(r, "test", config, Dependencies{ClickHouse: chComponent})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	var lock sync.Mutex
+	holder := c.id
+	mock.EXPECT().
+		Exec(gomock.Any(), gomock.Any()).
+		Return(nil)
+	mock.EXPECT().
+		Exec(gomock.Any(), gomock.Any(), "test", c.id, gomock.Any()).
+		Return(nil).
+		MinTimes(1)
+	mock.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any(), "test", int64(30000)).
+		DoAndReturn(func(_ context.Context, dest interface{}, _ string, _ ...interface{}) error {
+			lock.Lock()
+			defer lock.Unlock()
+			results := dest.(*[]struct {
+				Holder string `ch:"holder"`
+			})
+			*results = append(*results, struct {
+				Holder string `ch:"holder"`
+			}{holder})
+			return nil
+		}).
+		MinTimes(1)
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if !c.IsLeader() {
+		t.Fatal("IsLeader() should be true")
+	}
+
+	// Another candidate is older
+	lock.Lock()
+	holder = "other"
+	lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	if c.IsLeader() {
+		t.Fatal("IsLeader() should be false")
+	}
+	gotMetrics := r.GetMetrics("akvorado_common_leader_")
+	expectedMetrics := map[string]string{
+		`leader`:       "0",
+		`errors_total`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+}
@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package persist stores the state of a component, like a cache, to survive
+// restarts. The state is an opaque blob stored in a local file or in Redis.
+package persist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store is a place to persist the state of a component.
+type Store interface {
+	// Load returns the last saved state. ErrNotFound is returned if there
+	// is none.
+	Load(ctx context.Context) ([]byte, error)
+	// Save replaces the saved state.
+	Save(ctx context.Context, state []byte) error
+	// Close releases the resources associated with the store.
+	Close() error
+}
+
+// ErrNotFound is returned when there is no saved state.
+var ErrNotFound = errors.New("no saved state")
+
+// Timeout is the suggested timeout to load or save a state.
+const Timeout = 10 * time.Second
+
+// RedisConfiguration describes how to connect to a Redis server.
+type RedisConfiguration struct {
+	// Protocol to connect with
+	Protocol string `validate:"required_with=Server,omitempty,oneof=tcp unix"`
+	// Server to connect to (with port). When empty, Redis is not used.
+	Server string `validate:"omitempty,listen"`
+	// Optional username
+	Username string
+	// Optional password
+	Password string
+	// Database to connect to
+	DB int
+}
+
+// NewClient returns a new client for the configured Redis server.
+func (config RedisConfiguration) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Network:  config.Protocol,
+		Addr:     config.Server,
+		Username: config.Username,
+		Password: config.Password,
+		DB:       config.DB,
+	})
+}
+
+// RedisStoreConfiguration describes how to persist the state of a component
+// in Redis.
+type RedisStoreConfiguration struct {
+	// Key is the key used to store the state. When empty, the state is not
+	// stored in Redis.
+	Key string
+	// TTL defines how long the state is kept in Redis. Use 0 to keep it
+	// forever.
+	TTL time.Duration `validate:"min=0"`
+}
+
+// fileStore stores the state in a local file.
+type fileStore struct {
+	path string
+}
+
+// NewFileStore creates a new store using the provided file.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+// Load returns the content of the file.
+func (fs *fileStore) Load(_ context.Context) ([]byte, error) {
+	state, err := os.ReadFile(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to load %q: %w", fs.path, err)
+	}
+	return state, nil
+}
+
+// Save atomically replaces the content of the file.
+func (fs *fileStore) Save(_ context.Context, state []byte) error {
+	tmpFile, err := os.CreateTemp(
+		filepath.Dir(fs.path),
+		fmt.Sprintf("%s-*", filepath.Base(fs.path)))
+	if err != nil {
+		return fmt.Errorf("unable to create file %q: %w", fs.path, err)
+	}
+	defer func() {
+		tmpFile.Close()           // ignore errors
+		os.Remove(tmpFile.Name()) // ignore errors
+	}()
+	if _, err := tmpFile.Write(state); err != nil {
+		return fmt.Errorf("unable to write file %q: %w", fs.path, err)
+	}
+	if err := os.Rename(tmpFile.Name(), fs.path); err != nil {
+		return fmt.Errorf("unable to write file %q: %w", fs.path, err)
+	}
+	return nil
+}
+
+// Close does nothing.
+func (fs *fileStore) Close() error {
+	return nil
+}
+
+// redisStore stores the state in Redis.
+type redisStore struct {
+	client *redis.Client
+	key    string
+	ttl    time.Duration
+}
+
+// NewRedisStore creates a new store using the provided Redis client. The
+// client is not closed with the store.
+func NewRedisStore(client *redis.Client, config RedisStoreConfiguration) Store {
+	return &redisStore{
+		client: client,
+		key:    config.Key,
+		ttl:    config.TTL,
+	}
+}
+
+// Load returns the state stored in Redis.
+func (rs *redisStore) Load(ctx context.Context) ([]byte, error) {
+	state, err := rs.client.Get(ctx, rs.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("cannot get %s from Redis: %w", rs.key, err)
+	}
+	return state, nil
+}
+
+// Save replaces the state stored in Redis.
+func (rs *redisStore) Save(ctx context.Context, state []byte) error {
+	if err := rs.client.Set(ctx, rs.key, state, rs.ttl).Err(); err != nil {
+		return fmt.Errorf("cannot store %s in Redis: %w", rs.key, err)
+	}
+	return nil
+}
+
+// Close does nothing. The client is closed by its owner.
+func (rs *redisStore) Close() error {
+	return nil
+}
+
+// NewStores returns the stores to use for the provided file and Redis
+// client, which may be nil. Redis comes first as its state may have been
+// saved by another instance more recently.
+func NewStores(file string, client *redis.Client, config RedisStoreConfiguration) []Store {
+	stores := []Store{}
+	if client != nil && config.Key != "" {
+		stores = append(stores, NewRedisStore(client, config))
+	}
+	if file != "" {
+		stores = append(stores, NewFileStore(file))
+	}
+	return stores
+}
+
+// Load returns the state from the first store having one. ErrNotFound is
+// returned if no store has a state.
+func Load(ctx context.Context, stores []Store) ([]byte, error) {
+	var errs []error
+	for _, store := range stores {
+		state, err := store.Load(ctx)
+		if err == nil {
+			return state, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return nil, ErrNotFound
+}
+
+// Save saves the state in all the provided stores.
+func Save(ctx context.Context, stores []Store, state []byte) error {
+	var errs []error
+	for _, store := range stores {
+		if err := store.Save(ctx, state); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
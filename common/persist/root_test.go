@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package persist_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/persist"
+)
+
+func testStores(t *testing.T, stores []persist.Store) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := persist.Load(ctx, stores); !errors.Is(err, persist.ErrNotFound) {
+		t.Fatalf("Load() error:\n%+v", err)
+	}
+	if err := persist.Save(ctx, stores, []byte("hello")); err != nil {
+		t.Fatalf("Save() error:\n%+v", err)
+	}
+	if err := persist.Save(ctx, stores, []byte("hello world")); err != nil {
+		t.Fatalf("Save() error:\n%+v", err)
+	}
+	for _, store := range stores {
+		got, err := store.Load(ctx)
+		if err != nil {
+			t.Fatalf("Load() error:\n%+v", err)
+		}
+		if diff := helpers.Diff(string(got), "hello world"); diff != "" {
+			t.Fatalf("Load() (-got, +want):\n%s", diff)
+		}
+		store.Close()
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testStores(t, persist.NewStores(filepath.Join(t.TempDir(), "state"), nil, persist.RedisStoreConfiguration{}))
+}
+
+func TestFileStoreError(t *testing.T) {
+	stores := persist.NewStores(t.TempDir(), nil, persist.RedisStoreConfiguration{})
+	if _, err := persist.Load(context.Background(), stores); err == nil || errors.Is(err, persist.ErrNotFound) {
+		t.Fatalf("Load() error:\n%+v", err)
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	server := helpers.CheckExternalService(t, "Redis",
+		[]string{"redis:6379", "127.0.0.1:6379"})
+	client := persist.RedisConfiguration{
+		Protocol: "tcp",
+		Server:   server,
+		DB:       10,
+	}.NewClient()
+	defer client.Close()
+	if err := client.FlushAll(context.Background()).Err(); err != nil {
+		t.Fatalf("FlushAll() error:\n%+v", err)
+	}
+
+	testStores(t, persist.NewStores(filepath.Join(t.TempDir(), "state"), client,
+		persist.RedisStoreConfiguration{Key: "akvorado:test:state"}))
+}
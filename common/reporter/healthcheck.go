@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
 )
 
 // HealthcheckStatus represents an healthcheck status.
@@ -21,10 +23,18 @@ type HealthcheckResult struct {
 	Reason string            `json:"reason"`
 }
 
+// HealthcheckDetail is the result of one healthcheck when running several of
+// them. The latency is in seconds.
+type HealthcheckDetail struct {
+	HealthcheckResult
+	Probe   HealthcheckProbe `json:"probe"`
+	Latency float64          `json:"latency"`
+}
+
 // MultipleHealthcheckResults aggregates the result of several healthchecks
 type MultipleHealthcheckResults struct {
 	Status  HealthcheckStatus            `json:"status"`
-	Details map[string]HealthcheckResult `json:"details,omitempty"`
+	Details map[string]HealthcheckDetail `json:"details,omitempty"`
 }
 
 const (
@@ -49,19 +59,77 @@ func (hs HealthcheckStatus) String() string {
 	}
 }
 
+// HealthcheckStatusForError returns the status matching the class of the
+// provided error. Errors which will not go away by retrying need an action
+// from the operator and are reported as errors. Other errors are reported as
+// warnings.
+func HealthcheckStatusForError(err error) HealthcheckStatus {
+	if err == nil {
+		return HealthcheckOK
+	}
+	if !helpers.ErrorClassOf(err).Retryable() {
+		return HealthcheckError
+	}
+	return HealthcheckWarning
+}
+
 // MarshalText turns a status into text.
 func (hs HealthcheckStatus) MarshalText() ([]byte, error) {
 	return []byte(hs.String()), nil
 }
 
+// HealthcheckProbe tells which probe an healthcheck belongs to.
+type HealthcheckProbe int
+
+const (
+	// HealthcheckLiveness checks if the component is alive. When failing,
+	// the process should be restarted.
+	HealthcheckLiveness HealthcheckProbe = iota
+	// HealthcheckReadiness checks if the component is able to do its job.
+	// When failing, the process should not receive traffic.
+	HealthcheckReadiness
+)
+
+func (hp HealthcheckProbe) String() string {
+	switch hp {
+	case HealthcheckLiveness:
+		return "liveness"
+	case HealthcheckReadiness:
+		return "readiness"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText turns a probe into text.
+func (hp HealthcheckProbe) MarshalText() ([]byte, error) {
+	return []byte(hp.String()), nil
+}
+
 // HealthcheckFunc defines a function returning an healthcheck result.
 type HealthcheckFunc func(context.Context) HealthcheckResult
 
-// RegisterHealthcheck registers a new healthcheck. An healthcheck is
-// a function returning a state and a status string.
+type registeredHealthcheck struct {
+	probe HealthcheckProbe
+	fn    HealthcheckFunc
+}
+
+// RegisterHealthcheck registers a new liveness healthcheck. An
+// healthcheck is a function returning a state and a status string.
 func (r *Reporter) RegisterHealthcheck(name string, hf HealthcheckFunc) {
+	r.registerHealthcheck(name, HealthcheckLiveness, hf)
+}
+
+// RegisterReadinessCheck registers a new readiness healthcheck. It
+// should check the component is able to do its job (connected to its
+// backends, not overloaded, ...).
+func (r *Reporter) RegisterReadinessCheck(name string, hf HealthcheckFunc) {
+	r.registerHealthcheck(name, HealthcheckReadiness, hf)
+}
+
+func (r *Reporter) registerHealthcheck(name string, probe HealthcheckProbe, hf HealthcheckFunc) {
 	r.healthchecksLock.Lock()
-	r.healthchecks[name] = hf
+	r.healthchecks[name] = registeredHealthcheck{probe: probe, fn: hf}
 	r.healthchecksLock.Unlock()
 }
 
@@ -69,15 +137,32 @@ func (r *Reporter) RegisterHealthcheck(name string, hf HealthcheckFunc) {
 // global status as well as a map from service names to returned
 // results.
 func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResults {
+	return r.runHealthchecks(ctx, HealthcheckReadiness)
+}
+
+// RunLivenessChecks execute liveness healthchecks only.
+func (r *Reporter) RunLivenessChecks(ctx context.Context) MultipleHealthcheckResults {
+	return r.runHealthchecks(ctx, HealthcheckLiveness)
+}
+
+// runHealthchecks execute healthchecks up to the provided probe: readiness
+// also includes liveness healthchecks.
+func (r *Reporter) runHealthchecks(ctx context.Context, upTo HealthcheckProbe) MultipleHealthcheckResults {
 	var wg sync.WaitGroup
 	results := MultipleHealthcheckResults{
 		Status:  HealthcheckOK,
-		Details: map[string]HealthcheckResult{},
+		Details: map[string]HealthcheckDetail{},
 	}
 
 	r.healthchecksLock.Lock()
 	defer r.healthchecksLock.Unlock()
-	runningHealthchecks := len(r.healthchecks)
+	healthchecks := map[string]registeredHealthcheck{}
+	for name, hc := range r.healthchecks {
+		if hc.probe <= upTo {
+			healthchecks[name] = hc
+		}
+	}
+	runningHealthchecks := len(healthchecks)
 	if runningHealthchecks == 0 {
 		return results
 	}
@@ -85,7 +170,7 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 	// Go routine to centralize results
 	type oneResult struct {
 		name   string
-		result HealthcheckResult
+		result HealthcheckDetail
 	}
 	resultChan := make(chan oneResult)
 	wg.Add(1)
@@ -106,32 +191,41 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 	}()
 
 	// One goroutine for each healthcheck
-	for name, healthcheckFunc := range r.healthchecks {
+	start := time.Now()
+	for name, hc := range healthchecks {
 		wg.Add(1)
-		go func(name string, healthcheckFunc HealthcheckFunc) {
+		go func(name string, hc registeredHealthcheck) {
 			defer wg.Done()
-			result := healthcheckFunc(ctx)
+			result := hc.fn(ctx)
 			oneResult := oneResult{
-				name:   name,
-				result: result,
+				name: name,
+				result: HealthcheckDetail{
+					HealthcheckResult: result,
+					Probe:             hc.probe,
+					Latency:           time.Since(start).Seconds(),
+				},
 			}
 			select {
 			case <-ctx.Done():
 			case resultChan <- oneResult:
 			}
-		}(name, healthcheckFunc)
+		}(name, hc)
 	}
 
 	wg.Wait() // keep lock, we don't want something to change
 
 	// Check what we have
-	for name := range r.healthchecks {
+	for name, hc := range healthchecks {
 		if result, ok := results.Details[name]; ok {
 			if result.Status > results.Status {
 				results.Status = result.Status
 			}
 		} else {
-			results.Details[name] = HealthcheckResult{HealthcheckError, "timeout during check"}
+			results.Details[name] = HealthcheckDetail{
+				HealthcheckResult: HealthcheckResult{HealthcheckError, "timeout during check"},
+				Probe:             hc.probe,
+				Latency:           time.Since(start).Seconds(),
+			}
 			results.Status = HealthcheckError
 		}
 	}
@@ -141,9 +235,19 @@ func (r *Reporter) RunHealthchecks(ctx context.Context) MultipleHealthcheckResul
 
 // HealthcheckHTTPHandler is an HTTP handler return healthcheck results as JSON.
 func (r *Reporter) HealthcheckHTTPHandler(c *gin.Context) {
+	r.healthcheckHTTPHandler(c, HealthcheckReadiness)
+}
+
+// LivenessHTTPHandler is an HTTP handler returning liveness healthcheck
+// results as JSON.
+func (r *Reporter) LivenessHTTPHandler(c *gin.Context) {
+	r.healthcheckHTTPHandler(c, HealthcheckLiveness)
+}
+
+func (r *Reporter) healthcheckHTTPHandler(c *gin.Context, upTo HealthcheckProbe) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 	defer cancel()
-	results := r.RunHealthchecks(ctx)
+	results := r.runHealthchecks(ctx, upTo)
 	httpStatus := http.StatusOK
 	if results.Status == HealthcheckError {
 		httpStatus = http.StatusServiceUnavailable
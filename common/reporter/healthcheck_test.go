@@ -21,6 +21,13 @@ import (
 func testHealthchecks(ctx context.Context, t *testing.T, r *reporter.Reporter, expected reporter.MultipleHealthcheckResults) {
 	t.Helper()
 	got := r.RunHealthchecks(ctx)
+	for name, detail := range got.Details {
+		if detail.Latency < 0 {
+			t.Errorf("RunHealthchecks() latency for %s is negative", name)
+		}
+		detail.Latency = 0
+		got.Details[name] = detail
+	}
 	if diff := helpers.Diff(got, expected); diff != "" {
 		t.Errorf("RunHealthchecks() (-got, +want):\n%s", diff)
 	}
@@ -31,7 +38,7 @@ func TestEmptyHealthcheck(t *testing.T) {
 	testHealthchecks(context.Background(), t, r,
 		reporter.MultipleHealthcheckResults{
 			Status:  reporter.HealthcheckOK,
-			Details: map[string]reporter.HealthcheckResult{},
+			Details: map[string]reporter.HealthcheckDetail{},
 		})
 }
 
@@ -43,8 +50,8 @@ func TestOneHealthcheck(t *testing.T) {
 	testHealthchecks(context.Background(), t, r,
 		reporter.MultipleHealthcheckResults{
 			Status: reporter.HealthcheckOK,
-			Details: map[string]reporter.HealthcheckResult{
-				"hc1": {reporter.HealthcheckOK, "all well"},
+			Details: map[string]reporter.HealthcheckDetail{
+				"hc1": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}},
 			},
 		})
 }
@@ -60,9 +67,9 @@ func TestFailingHealthcheck(t *testing.T) {
 	testHealthchecks(context.Background(), t, r,
 		reporter.MultipleHealthcheckResults{
 			Status: reporter.HealthcheckError,
-			Details: map[string]reporter.HealthcheckResult{
-				"hc1": {reporter.HealthcheckOK, "all well"},
-				"hc2": {reporter.HealthcheckError, "not so good"},
+			Details: map[string]reporter.HealthcheckDetail{
+				"hc1": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}},
+				"hc2": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckError, "not so good"}},
 			},
 		})
 }
@@ -84,9 +91,9 @@ func TestHealthcheckCancelContext(t *testing.T) {
 	testHealthchecks(ctx, t, r,
 		reporter.MultipleHealthcheckResults{
 			Status: reporter.HealthcheckError,
-			Details: map[string]reporter.HealthcheckResult{
-				"hc1": {reporter.HealthcheckOK, "all well"},
-				"hc2": {reporter.HealthcheckError, "timeout during check"},
+			Details: map[string]reporter.HealthcheckDetail{
+				"hc1": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}},
+				"hc2": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckError, "timeout during check"}},
 			},
 		})
 }
@@ -106,8 +113,8 @@ func TestChannelHealthcheck(t *testing.T) {
 	testHealthchecks(context.Background(), t, r,
 		reporter.MultipleHealthcheckResults{
 			Status: reporter.HealthcheckOK,
-			Details: map[string]reporter.HealthcheckResult{
-				"hc1": {reporter.HealthcheckOK, "all well, thank you!"},
+			Details: map[string]reporter.HealthcheckDetail{
+				"hc1": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckOK, "all well, thank you!"}},
 			},
 		})
 }
@@ -117,7 +124,7 @@ func TestHealthcheckHTTPHandler(t *testing.T) {
 	r.RegisterHealthcheck("hc1", func(ctx context.Context) reporter.HealthcheckResult {
 		return reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}
 	})
-	r.RegisterHealthcheck("hc2", func(ctx context.Context) reporter.HealthcheckResult {
+	r.RegisterReadinessCheck("hc2", func(ctx context.Context) reporter.HealthcheckResult {
 		return reporter.HealthcheckResult{reporter.HealthcheckError, "trying to be better"}
 	})
 
@@ -137,16 +144,24 @@ func TestHealthcheckHTTPHandler(t *testing.T) {
 	if err := decoder.Decode(&got); err != nil {
 		t.Fatalf("GET /api/v0/healthcheck error:\n%+v", err)
 	}
+	for _, detail := range got["details"].(map[string]interface{}) {
+		if _, ok := detail.(map[string]interface{})["latency"].(float64); !ok {
+			t.Errorf("GET /api/v0/healthcheck: missing latency in %v", detail)
+		}
+		delete(detail.(map[string]interface{}), "latency")
+	}
 	expected := gin.H{
 		"status": "error",
 		"details": gin.H{
-			"hc1": map[string]string{
+			"hc1": gin.H{
 				"status": "ok",
 				"reason": "all well",
+				"probe":  "liveness",
 			},
-			"hc2": map[string]string{
+			"hc2": gin.H{
 				"status": "error",
 				"reason": "trying to be better",
+				"probe":  "readiness",
 			},
 		},
 	}
@@ -154,3 +169,46 @@ func TestHealthcheckHTTPHandler(t *testing.T) {
 		t.Fatalf("GET /api/v0/healthcheck (-got, +want):\n%s", diff)
 	}
 }
+
+func TestReadinessHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	r.RegisterHealthcheck("hc1", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}
+	})
+	r.RegisterReadinessCheck("hc2", func(ctx context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{reporter.HealthcheckError, "not ready"}
+	})
+	testHealthchecks(context.Background(), t, r,
+		reporter.MultipleHealthcheckResults{
+			Status: reporter.HealthcheckError,
+			Details: map[string]reporter.HealthcheckDetail{
+				"hc1": {HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckOK, "all well"}},
+				"hc2": {
+					HealthcheckResult: reporter.HealthcheckResult{reporter.HealthcheckError, "not ready"},
+					Probe:             reporter.HealthcheckReadiness,
+				},
+			},
+		})
+
+	got := r.RunLivenessChecks(context.Background())
+	if got.Status != reporter.HealthcheckOK {
+		t.Errorf("RunLivenessChecks() status: got %s, expected %s", got.Status, reporter.HealthcheckOK)
+	}
+	if _, ok := got.Details["hc2"]; ok {
+		t.Error("RunLivenessChecks() should not run readiness checks")
+	}
+
+	ginRouter := gin.Default()
+	ginRouter.GET("/api/v0/healthcheck/live", r.LivenessHTTPHandler)
+	ginRouter.GET("/api/v0/healthcheck/ready", r.HealthcheckHTTPHandler)
+	for url, expected := range map[string]int{
+		"/api/v0/healthcheck/live":  http.StatusOK,
+		"/api/v0/healthcheck/ready": http.StatusServiceUnavailable,
+	} {
+		w := httptest.NewRecorder()
+		ginRouter.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != expected {
+			t.Errorf("GET %s status code, got %d, expected %d", url, w.Code, expected)
+		}
+	}
+}
@@ -11,8 +11,12 @@ package reporter
 
 import (
 	"net/http"
+	"sort"
 
+	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/reporter/metrics"
 )
 
 // Register some aliases to avoid importing prometheus package.
@@ -51,9 +55,13 @@ type (
 	SummaryVec = prometheus.SummaryVec
 	// UntypedFunc defines untyped functions
 	UntypedFunc = prometheus.UntypedFunc
+	// Observer defines something that can observe values (histograms, summaries)
+	Observer = prometheus.Observer
 
 	// MetricDesc defines a metric description
 	MetricDesc = prometheus.Desc
+	// MetricInfo describes a registered metric
+	MetricInfo = metrics.MetricInfo
 )
 
 // Counter mimics NewCounter from promauto package.
@@ -106,6 +114,19 @@ func (r *Reporter) SummaryVec(opts SummaryOpts, labelNames []string) *SummaryVec
 	return r.metrics.Factory(1).NewSummaryVec(opts, labelNames)
 }
 
+// ObserveWithExemplar observes a value. When labels are provided and the
+// observer supports them, they are attached as an exemplar. This is mostly
+// useful to link a slow sample to a trace ID.
+func ObserveWithExemplar(observer Observer, value float64, labels map[string]string) {
+	if len(labels) > 0 {
+		if eo, ok := observer.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(value, labels)
+			return
+		}
+	}
+	observer.Observe(value)
+}
+
 // MetricsHTTPHandler returns the HTTP handler to get metrics.
 func (r *Reporter) MetricsHTTPHandler() http.Handler {
 	return r.metrics.HTTPHandler()
@@ -125,3 +146,53 @@ func (r *Reporter) MetricCollectorForCurrentModule(c prometheus.Collector) {
 func (r *Reporter) MetricDesc(name, help string, variableLabels []string) *MetricDesc {
 	return r.metrics.Desc(1, name, help, variableLabels)
 }
+
+// ListMetrics returns information about all the registered metrics.
+func (r *Reporter) ListMetrics() ([]MetricInfo, error) {
+	return r.metrics.List()
+}
+
+type metricsComponentInfo struct {
+	Name    string `json:"name"`
+	Metrics int    `json:"metrics"`
+	Series  int    `json:"series"`
+}
+
+// MetricsListHTTPHandler is an HTTP handler listing the registered metrics
+// with their help, labels, and current cardinality, as well as the number of
+// metrics and series for each component. The list can be restricted to a
+// component with the `component` parameter.
+func (r *Reporter) MetricsListHTTPHandler(c *gin.Context) {
+	list, err := r.ListMetrics()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	filter := c.Query("component")
+	metrics := []MetricInfo{}
+	componentsMap := map[string]*metricsComponentInfo{}
+	for _, metric := range list {
+		if filter != "" && metric.Component != filter {
+			continue
+		}
+		metrics = append(metrics, metric)
+		component, ok := componentsMap[metric.Component]
+		if !ok {
+			component = &metricsComponentInfo{Name: metric.Component}
+			componentsMap[metric.Component] = component
+		}
+		component.Metrics++
+		component.Series += metric.Cardinality
+	}
+	components := make([]metricsComponentInfo, 0, len(componentsMap))
+	for _, component := range componentsMap {
+		components = append(components, *component)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].Name < components[j].Name
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"components": components,
+		"metrics":    metrics,
+	})
+}
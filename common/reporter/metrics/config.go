@@ -3,11 +3,34 @@
 
 package metrics
 
-// Configuration is currently empty as this sub-component is not
-// configurable yet.
-type Configuration struct{}
+// Configuration is the configuration for metrics.
+type Configuration struct {
+	// NativeHistogramBucketFactor enables native histograms for all
+	// histograms when not 0. Each bucket is at most this factor larger than
+	// the previous one. Classic buckets are still exposed.
+	NativeHistogramBucketFactor float64 `validate:"eq=0|gt=1"`
+	// NativeHistogramMaxBucketNumber is the maximum number of buckets for a
+	// native histogram. When exceeded, the resolution is reduced.
+	NativeHistogramMaxBucketNumber uint32
+	// Histograms overrides the settings for some histograms. The key is the
+	// full name of the histogram.
+	Histograms map[string]HistogramConfiguration `validate:"dive"`
+}
+
+// HistogramConfiguration overrides the settings of a histogram.
+type HistogramConfiguration struct {
+	// Buckets are the upper bounds of the classic buckets.
+	Buckets []float64 `validate:"omitempty,dive,min=0"`
+	// NativeHistogramBucketFactor overrides the global setting for this
+	// histogram. Use 0 to keep the global setting.
+	NativeHistogramBucketFactor float64 `validate:"eq=0|gt=1"`
+}
 
 // DefaultConfiguration is the default metrics configuration.
 func DefaultConfiguration() Configuration {
-	return Configuration{}
+	return Configuration{
+		NativeHistogramBucketFactor:    0,
+		NativeHistogramMaxBucketNumber: 160,
+		Histograms:                     map[string]HistogramConfiguration{},
+	}
 }
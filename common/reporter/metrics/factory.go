@@ -5,6 +5,7 @@ package metrics
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -14,12 +15,40 @@ import (
 type Factory struct {
 	prefix   string
 	registry *prometheus.Registry
+	config   *Configuration
 }
 
 func (f *Factory) prefixWith(name string) string {
 	return fmt.Sprintf("%s%s", f.prefix, name)
 }
 
+// histogramOpts applies the configuration to the options of a histogram. The
+// name should already be prefixed.
+func (f *Factory) histogramOpts(opts prometheus.HistogramOpts) prometheus.HistogramOpts {
+	if f.config == nil {
+		return opts
+	}
+	factor := f.config.NativeHistogramBucketFactor
+	if override, ok := f.config.Histograms[opts.Name]; ok {
+		if len(override.Buckets) > 0 {
+			opts.Buckets = override.Buckets
+		}
+		if override.NativeHistogramBucketFactor != 0 {
+			factor = override.NativeHistogramBucketFactor
+		}
+	}
+	if factor > 1 && opts.NativeHistogramBucketFactor == 0 {
+		if opts.Buckets == nil {
+			// Otherwise, only native buckets would be exposed
+			opts.Buckets = prometheus.DefBuckets
+		}
+		opts.NativeHistogramBucketFactor = factor
+		opts.NativeHistogramMaxBucketNumber = f.config.NativeHistogramMaxBucketNumber
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	return opts
+}
+
 // NewCounter works like the function of the same name in the prometheus package
 // but it automatically registers the Counter with the Factory's Registerer.
 func (f *Factory) NewCounter(opts prometheus.CounterOpts) prometheus.Counter {
@@ -142,6 +171,7 @@ func (f *Factory) NewSummaryVec(opts prometheus.SummaryOpts, labelNames []string
 // Registerer.
 func (f *Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogram {
 	opts.Name = f.prefixWith(opts.Name)
+	opts = f.histogramOpts(opts)
 	c := prometheus.NewHistogram(opts)
 	if err := f.registry.Register(c); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
@@ -157,6 +187,7 @@ func (f *Factory) NewHistogram(opts prometheus.HistogramOpts) prometheus.Histogr
 // Registerer.
 func (f *Factory) NewHistogramVec(opts prometheus.HistogramOpts, labelNames []string) *prometheus.HistogramVec {
 	opts.Name = f.prefixWith(opts.Name)
+	opts = f.histogramOpts(opts)
 	c := prometheus.NewHistogramVec(opts, labelNames)
 	if err := f.registry.Register(c); err != nil {
 		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"akvorado/common/helpers"
+)
+
+func TestHistogramOpts(t *testing.T) {
+	config := DefaultConfiguration()
+	config.NativeHistogramBucketFactor = 1.1
+	config.Histograms = map[string]HistogramConfiguration{
+		"akvorado_histo2": {
+			Buckets:                     []float64{10, 100},
+			NativeHistogramBucketFactor: 1.5,
+		},
+	}
+	f := Factory{prefix: "akvorado_", config: &config}
+
+	cases := []struct {
+		Description string
+		Input       prometheus.HistogramOpts
+		Expected    prometheus.HistogramOpts
+	}{
+		{
+			Description: "default buckets",
+			Input:       prometheus.HistogramOpts{Name: "akvorado_histo1"},
+			Expected: prometheus.HistogramOpts{
+				Name:                            "akvorado_histo1",
+				Buckets:                         prometheus.DefBuckets,
+				NativeHistogramBucketFactor:     1.1,
+				NativeHistogramMaxBucketNumber:  160,
+				NativeHistogramMinResetDuration: time.Hour,
+			},
+		}, {
+			Description: "overridden histogram",
+			Input: prometheus.HistogramOpts{
+				Name:    "akvorado_histo2",
+				Buckets: []float64{1, 2, 3},
+			},
+			Expected: prometheus.HistogramOpts{
+				Name:                            "akvorado_histo2",
+				Buckets:                         []float64{10, 100},
+				NativeHistogramBucketFactor:     1.5,
+				NativeHistogramMaxBucketNumber:  160,
+				NativeHistogramMinResetDuration: time.Hour,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := f.histogramOpts(tc.Input)
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("histogramOpts() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	// Without native histograms, options are left untouched
+	config.NativeHistogramBucketFactor = 0
+	input := prometheus.HistogramOpts{Name: "akvorado_histo1"}
+	if diff := helpers.Diff(f.histogramOpts(input), input); diff != "" {
+		t.Fatalf("histogramOpts() (-got, +want):\n%s", diff)
+	}
+}
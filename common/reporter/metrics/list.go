@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metrics
+
+import (
+	"sort"
+	"strings"
+)
+
+// MetricInfo describes a registered metric.
+type MetricInfo struct {
+	Name        string   `json:"name"`
+	Help        string   `json:"help"`
+	Type        string   `json:"type"`
+	Component   string   `json:"component"`
+	Labels      []string `json:"labels"`
+	Cardinality int      `json:"cardinality"`
+}
+
+// registerPrefix records a prefix used by a component to register metrics.
+func (m *Metrics) registerPrefix(prefix string) {
+	m.prefixesLock.Lock()
+	m.prefixes[prefix] = struct{}{}
+	m.prefixesLock.Unlock()
+}
+
+// Prefixes returns the sorted list of prefixes used by components to
+// register metrics.
+func (m *Metrics) Prefixes() []string {
+	m.prefixesLock.Lock()
+	defer m.prefixesLock.Unlock()
+	prefixes := make([]string, 0, len(m.prefixes))
+	for prefix := range m.prefixes {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// component returns the component owning a metric. This is the longest
+// registered prefix matching the name of the metric, without the trailing
+// underscore. When no prefix matches, the first word of the name is used
+// (`go` or `process` for runtime metrics).
+func component(prefixes []string, name string) string {
+	best := ""
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best != "" {
+		return strings.TrimSuffix(best, "_")
+	}
+	before, _, _ := strings.Cut(name, "_")
+	return before
+}
+
+// List returns information about all the registered metrics, sorted by name.
+// The cardinality is the current number of series for each metric.
+func (m *Metrics) List() ([]MetricInfo, error) {
+	families, err := m.registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	prefixes := m.Prefixes()
+	result := make([]MetricInfo, 0, len(families))
+	for _, family := range families {
+		info := MetricInfo{
+			Name:        family.GetName(),
+			Help:        family.GetHelp(),
+			Type:        strings.ToLower(family.GetType().String()),
+			Component:   component(prefixes, family.GetName()),
+			Labels:      []string{},
+			Cardinality: len(family.GetMetric()),
+		}
+		labels := map[string]struct{}{}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = struct{}{}
+			}
+		}
+		for label := range labels {
+			info.Labels = append(info.Labels, label)
+		}
+		sort.Strings(info.Labels)
+		result = append(result, info)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
@@ -27,6 +27,8 @@ type Metrics struct {
 	registry         *prometheus.Registry
 	factoryCache     map[string]*Factory
 	factoryCacheLock sync.RWMutex
+	prefixes         map[string]struct{}
+	prefixesLock     sync.Mutex
 }
 
 // New creates a new metric registry and setup the appropriate
@@ -41,6 +43,7 @@ func New(logger logger.Logger, configuration Configuration) (*Metrics, error) {
 		config:       configuration,
 		registry:     reg,
 		factoryCache: make(map[string]*Factory, 0),
+		prefixes:     make(map[string]struct{}),
 	}
 
 	return &m, nil
@@ -50,6 +53,8 @@ func New(logger logger.Logger, configuration Configuration) (*Metrics, error) {
 func (m *Metrics) HTTPHandler() http.Handler {
 	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
 		ErrorLog: promHTTPLogger{m.logger},
+		// OpenMetrics is needed to expose exemplars
+		EnableOpenMetrics: true,
 	})
 }
 
@@ -90,9 +95,11 @@ func (m *Metrics) Factory(skipCallstack int) *Factory {
 	m.factoryCacheLock.Lock()
 	defer m.factoryCacheLock.Unlock()
 	moduleName := getPrefix(module)
+	m.registerPrefix(moduleName)
 	factory := Factory{
 		prefix:   moduleName,
 		registry: m.registry,
+		config:   &m.config,
 	}
 	m.factoryCache[module] = &factory
 	return &factory
@@ -105,6 +112,7 @@ func (m *Metrics) Desc(skipCallstack int, name, help string, variableLabels []st
 	callStack := stack.Callers()
 	call := callStack[1+skipCallstack] // Trial and error, there is a test to check it works
 	prefix := getPrefix(call.FunctionName())
+	m.registerPrefix(prefix)
 	name = fmt.Sprintf("%s%s", prefix, name)
 	return prometheus.NewDesc(name, help, variableLabels, nil)
 }
@@ -120,5 +128,6 @@ func (m *Metrics) CollectorForCurrentModule(skipCallStack int, c prometheus.Coll
 	callStack := stack.Callers()
 	call := callStack[1+skipCallStack] // Should be the same as above !
 	prefix := getPrefix(call.FunctionName())
+	m.registerPrefix(prefix)
 	prometheus.WrapRegistererWithPrefix(prefix, m.registry).MustRegister(c)
 }
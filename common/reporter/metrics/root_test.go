@@ -125,3 +125,130 @@ func TestRegisterTwice(t *testing.T) {
 		t.Fatalf("counter1 != counter2")
 	}
 }
+
+func TestHistogramConfiguration(t *testing.T) {
+	l, err := logger.New(logger.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("logger.New() err:\n%+v", err)
+	}
+	config := metrics.DefaultConfiguration()
+	config.Histograms = map[string]metrics.HistogramConfiguration{
+		"akvorado_common_reporter_metrics_test_histo1": {
+			Buckets: []float64{10, 100},
+		},
+	}
+	m, err := metrics.New(l, config)
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+
+	histo1 := m.Factory(0).NewHistogram(prometheus.HistogramOpts{
+		Name:    "histo1",
+		Help:    "Some histogram",
+		Buckets: []float64{1, 2, 3},
+	})
+	histo1.(prometheus.ExemplarObserver).ObserveWithExemplar(50, prometheus.Labels{"trace_id": "abcd"})
+	histo2 := m.Factory(0).NewHistogram(prometheus.HistogramOpts{
+		Name:    "histo2",
+		Help:    "Another histogram",
+		Buckets: []float64{1, 2, 3},
+	})
+	histo2.Observe(2)
+
+	// Use the HTTP handler for testing, with OpenMetrics to get exemplars
+	req := httptest.NewRequest("GET", "/api/v0/metrics", nil)
+	req.Header.Set("Accept", "application/openmetrics-text; version=1.0.0")
+	w := httptest.NewRecorder()
+	m.HTTPHandler().ServeHTTP(w, req)
+	got := []string{}
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "akvorado_common_reporter_metrics_test_histo") &&
+			strings.Contains(line, "_bucket") {
+			// Remove exemplar timestamp
+			if idx := strings.LastIndex(line, "} 50.0 "); idx >= 0 {
+				line = line[:idx+6]
+			}
+			got = append(got, line)
+		}
+	}
+	expected := []string{
+		`akvorado_common_reporter_metrics_test_histo1_bucket{le="10.0"} 0`,
+		`akvorado_common_reporter_metrics_test_histo1_bucket{le="100.0"} 1 # {trace_id="abcd"} 50.0`,
+		`akvorado_common_reporter_metrics_test_histo1_bucket{le="+Inf"} 1`,
+		`akvorado_common_reporter_metrics_test_histo2_bucket{le="1.0"} 0`,
+		`akvorado_common_reporter_metrics_test_histo2_bucket{le="2.0"} 1`,
+		`akvorado_common_reporter_metrics_test_histo2_bucket{le="3.0"} 1`,
+		`akvorado_common_reporter_metrics_test_histo2_bucket{le="+Inf"} 1`,
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("GET /api/v0/metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestList(t *testing.T) {
+	l, err := logger.New(logger.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("logger.New() err:\n%+v", err)
+	}
+	m, err := metrics.New(l, metrics.DefaultConfiguration())
+	if err != nil {
+		t.Fatalf("metrics.New() err:\n%+v", err)
+	}
+
+	counter := m.Factory(0).NewCounterVec(prometheus.CounterOpts{
+		Name: "counter1",
+		Help: "Some counter",
+	}, []string{"exporter", "error"})
+	counter.WithLabelValues("192.0.2.1", "timeout").Inc()
+	counter.WithLabelValues("192.0.2.2", "timeout").Inc()
+	counter.WithLabelValues("192.0.2.2", "refused").Inc()
+	gauge := m.Factory(0).NewGauge(prometheus.GaugeOpts{
+		Name: "gauge1",
+		Help: "Some gauge",
+	})
+	gauge.Set(4)
+
+	if diff := helpers.Diff(m.Prefixes(), []string{"akvorado_common_reporter_metrics_test_"}); diff != "" {
+		t.Errorf("Prefixes() (-got, +want):\n%s", diff)
+	}
+
+	list, err := m.List()
+	if err != nil {
+		t.Fatalf("List() error:\n%+v", err)
+	}
+	got := []metrics.MetricInfo{}
+	runtime := 0
+	for _, metric := range list {
+		switch metric.Component {
+		case "akvorado_common_reporter_metrics_test":
+			got = append(got, metric)
+		case "go", "process":
+			runtime++
+		default:
+			t.Errorf("List() returned unexpected component %q for %s", metric.Component, metric.Name)
+		}
+	}
+	if runtime == 0 {
+		t.Error("List() did not return runtime metrics")
+	}
+	expected := []metrics.MetricInfo{
+		{
+			Name:        "akvorado_common_reporter_metrics_test_counter1",
+			Help:        "Some counter",
+			Type:        "counter",
+			Component:   "akvorado_common_reporter_metrics_test",
+			Labels:      []string{"error", "exporter"},
+			Cardinality: 3,
+		}, {
+			Name:        "akvorado_common_reporter_metrics_test_gauge1",
+			Help:        "Some gauge",
+			Type:        "gauge",
+			Component:   "akvorado_common_reporter_metrics_test",
+			Labels:      []string{},
+			Cardinality: 1,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("List() (-got, +want):\n%s", diff)
+	}
+}
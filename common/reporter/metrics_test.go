@@ -4,9 +4,13 @@
 package reporter_test
 
 import (
+	"encoding/json"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"akvorado/common/helpers"
@@ -196,3 +200,71 @@ func TestMetricCollector(t *testing.T) {
 		t.Fatalf("subsetted metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestObserveWithExemplar(t *testing.T) {
+	r := reporter.NewMock(t)
+
+	histo := r.Histogram(reporter.HistogramOpts{
+		Name:    "histo_exemplar",
+		Help:    "Some histogram",
+		Buckets: []float64{1, 10},
+	})
+	summary := r.Summary(reporter.SummaryOpts{
+		Name: "summary_exemplar",
+		Help: "Some summary",
+	})
+	reporter.ObserveWithExemplar(histo, 5, map[string]string{"trace_id": "1234"})
+	reporter.ObserveWithExemplar(histo, 0.5, nil)
+	// Summaries do not support exemplars
+	reporter.ObserveWithExemplar(summary, 5, map[string]string{"trace_id": "1234"})
+
+	got := r.GetMetrics("akvorado_common_reporter_test_", "histo_exemplar_count", "summary_exemplar_count")
+	expected := map[string]string{
+		`histo_exemplar_count`:   "2",
+		`summary_exemplar_count`: "1",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMetricsListHTTPHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	counter := r.CounterVec(reporter.CounterOpts{
+		Name: "counter_list",
+		Help: "Some counter",
+	}, []string{"label1"})
+	counter.WithLabelValues("value1").Inc()
+	counter.WithLabelValues("value2").Inc()
+
+	req := httptest.NewRequest("GET", "/api/v0/admin/metrics?component=akvorado_common_reporter_test", nil)
+	w := httptest.NewRecorder()
+	ginRouter := gin.New()
+	ginRouter.GET("/api/v0/admin/metrics", r.MetricsListHTTPHandler)
+	ginRouter.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/v0/admin/metrics status code, got %d, expected %d", w.Code, http.StatusOK)
+	}
+	var got gin.H
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("GET /api/v0/admin/metrics error:\n%+v", err)
+	}
+	expected := gin.H{
+		"components": []gin.H{
+			{"name": "akvorado_common_reporter_test", "metrics": 1, "series": 2},
+		},
+		"metrics": []gin.H{
+			{
+				"name":        "akvorado_common_reporter_test_counter_list",
+				"help":        "Some counter",
+				"type":        "counter",
+				"component":   "akvorado_common_reporter_test",
+				"labels":      []string{"label1"},
+				"cardinality": 2,
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("GET /api/v0/admin/metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -19,7 +19,7 @@ type Reporter struct {
 	logger.Logger
 	metrics *metrics.Metrics
 
-	healthchecks     map[string]HealthcheckFunc
+	healthchecks     map[string]registeredHealthcheck
 	healthchecksLock sync.Mutex
 }
 
@@ -39,6 +39,6 @@ func New(config Configuration) (*Reporter, error) {
 	return &Reporter{
 		Logger:       l,
 		metrics:      m,
-		healthchecks: make(map[string]HealthcheckFunc),
+		healthchecks: make(map[string]registeredHealthcheck),
 	}, nil
 }
@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"golang.org/x/exp/slices"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// AvroEncoder turns flows encoded with protobuf into Avro binary encoding.
+// The Avro record contains the same fields as the protobuf message.
+type AvroEncoder struct {
+	name       string
+	definition string
+	columns    []Column
+	positions  map[protowire.Number]int
+	enums      [][]int // for each column, the protobuf values in Avro order
+}
+
+// NewAvroEncoder returns a new Avro encoder for the current schema.
+func (schema *Schema) NewAvroEncoder() *AvroEncoder {
+	hash, _ := schema.protobufMessageHashAndDefinition()
+	encoder := AvroEncoder{
+		name:      fmt.Sprintf("FlowMessagev%s", hash),
+		positions: map[protowire.Number]int{},
+	}
+
+	fields := []interface{}{}
+	definedEnums := map[string]bool{}
+	for _, column := range schema.Columns() {
+		for _, column := range append([]Column{column}, column.ClickHouseTransformFrom...) {
+			if column.ProtobufIndex < 0 {
+				continue
+			}
+			var (
+				t        interface{}
+				defValue interface{}
+				enum     []int
+			)
+			switch column.ProtobufType {
+			case protoreflect.Uint64Kind, protoreflect.Uint32Kind:
+				t, defValue = "long", 0
+			case protoreflect.StringKind, protoreflect.BytesKind:
+				t, defValue = column.ProtobufType.String(), ""
+			case protoreflect.EnumKind:
+				for key := range column.ProtobufEnum {
+					enum = append(enum, key)
+				}
+				slices.Sort(enum)
+				defValue = column.ProtobufEnum[enum[0]]
+				if definedEnums[column.ProtobufEnumName] {
+					t = column.ProtobufEnumName
+					break
+				}
+				definedEnums[column.ProtobufEnumName] = true
+				symbols := make([]string, 0, len(enum))
+				for _, key := range enum {
+					symbols = append(symbols, column.ProtobufEnum[key])
+				}
+				t = map[string]interface{}{
+					"type":    "enum",
+					"name":    column.ProtobufEnumName,
+					"symbols": symbols,
+				}
+			default:
+				continue
+			}
+			if column.ProtobufRepeated {
+				t = map[string]interface{}{"type": "array", "items": t}
+				defValue = []interface{}{}
+			}
+			fields = append(fields, map[string]interface{}{
+				"name":    column.Name,
+				"type":    t,
+				"default": defValue,
+			})
+			encoder.positions[column.ProtobufIndex] = len(encoder.columns)
+			encoder.columns = append(encoder.columns, column)
+			encoder.enums = append(encoder.enums, enum)
+		}
+	}
+
+	definition, err := json.Marshal(map[string]interface{}{
+		"type":      "record",
+		"name":      encoder.name,
+		"namespace": "akvorado",
+		"fields":    fields,
+	})
+	if err != nil {
+		panic(err)
+	}
+	encoder.definition = string(definition)
+	return &encoder
+}
+
+// Name returns the full name of the Avro record.
+func (encoder *AvroEncoder) Name() string {
+	return fmt.Sprintf("akvorado.%s", encoder.name)
+}
+
+// Definition returns the Avro schema, as JSON.
+func (encoder *AvroEncoder) Definition() string {
+	return encoder.definition
+}
+
+// Marshal appends to dst the Avro binary encoding of the provided flow. The
+// flow is the output of ProtobufMarshal, including its length prefix.
+func (encoder *AvroEncoder) Marshal(dst []byte, payload []byte) ([]byte, error) {
+	length, n := protowire.ConsumeVarint(payload)
+	if n < 0 || uint64(len(payload)-n) != length {
+		return nil, errors.New("invalid protobuf length prefix")
+	}
+	data := payload[n:]
+
+	// Collect values in Avro order
+	varints := make([][]uint64, len(encoder.columns))
+	bytes := make([][][]byte, len(encoder.columns))
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		position, ok := encoder.positions[num]
+		switch {
+		case ok && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			varints[position] = append(varints[position], v)
+			data = data[n:]
+		case ok && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			bytes[position] = append(bytes[position], v)
+			data = data[n:]
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+
+	for position, column := range encoder.columns {
+		switch column.ProtobufType {
+		case protoreflect.StringKind, protoreflect.BytesKind:
+			values := bytes[position]
+			if !column.ProtobufRepeated {
+				if len(values) == 0 {
+					values = [][]byte{nil}
+				}
+				dst = avroAppendBytes(dst, values[0])
+				continue
+			}
+			if len(values) > 0 {
+				dst = avroAppendLong(dst, int64(len(values)))
+				for _, v := range values {
+					dst = avroAppendBytes(dst, v)
+				}
+			}
+			dst = avroAppendLong(dst, 0)
+		default:
+			values := varints[position]
+			if !column.ProtobufRepeated && len(values) == 0 {
+				values = []uint64{0}
+			}
+			if column.ProtobufType == protoreflect.EnumKind {
+				// Unknown values are mapped to the first symbol
+				for idx, v := range values {
+					values[idx] = uint64(max(slices.Index(encoder.enums[position], int(v)), 0))
+				}
+			}
+			if !column.ProtobufRepeated {
+				dst = avroAppendLong(dst, int64(values[0]))
+				continue
+			}
+			if len(values) > 0 {
+				dst = avroAppendLong(dst, int64(len(values)))
+				for _, v := range values {
+					dst = avroAppendLong(dst, int64(v))
+				}
+			}
+			dst = avroAppendLong(dst, 0)
+		}
+	}
+	return dst, nil
+}
+
+// avroAppendLong appends a long (or an int) using zigzag encoding.
+func avroAppendLong(dst []byte, v int64) []byte {
+	return protowire.AppendVarint(dst, protowire.EncodeZigZag(v))
+}
+
+// avroAppendBytes appends bytes (or a string) prefixed by their length.
+func avroAppendBytes(dst []byte, v []byte) []byte {
+	dst = avroAppendLong(dst, int64(len(v)))
+	return append(dst, v...)
+}
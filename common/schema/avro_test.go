@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"akvorado/common/helpers"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestAvroEncoder(t *testing.T) {
+	flows := Schema{
+		columns: []Column{
+			{
+				Key:            ColumnTimeReceived,
+				ClickHouseType: "DateTime",
+				ProtobufType:   protoreflect.Uint64Kind,
+			},
+			{Key: ColumnExporterName, ClickHouseType: "LowCardinality(String)"},
+			{
+				Key:            ColumnDstASPath,
+				ClickHouseType: "Array(UInt32)",
+			},
+			{
+				Key:                     ColumnInIfBoundary,
+				ClickHouseType:          "Enum8('undefined' = 0, 'external' = 1, 'internal' = 2)",
+				ClickHouseNotSortingKey: true,
+				ProtobufType:            protoreflect.EnumKind,
+				ProtobufEnumName:        "Boundary",
+				ProtobufEnum: map[int]string{
+					0: "UNDEFINED",
+					1: "EXTERNAL",
+					2: "INTERNAL",
+				},
+			},
+		},
+	}.finalize()
+	encoder := flows.NewAvroEncoder()
+
+	t.Run("definition", func(t *testing.T) {
+		var got interface{}
+		if err := json.Unmarshal([]byte(encoder.Definition()), &got); err != nil {
+			t.Fatalf("json.Unmarshal() error:\n%+v", err)
+		}
+		boundary := map[string]interface{}{
+			"type":    "enum",
+			"name":    "Boundary",
+			"symbols": []interface{}{"UNDEFINED", "EXTERNAL", "INTERNAL"},
+		}
+		expected := map[string]interface{}{
+			"type":      "record",
+			"name":      "FlowMessagev" + flows.ProtobufMessageHash(),
+			"namespace": "akvorado",
+			"fields": []interface{}{
+				map[string]interface{}{"name": "TimeReceived", "type": "long", "default": 0.},
+				map[string]interface{}{"name": "ExporterName", "type": "string", "default": ""},
+				map[string]interface{}{
+					"name":    "DstASPath",
+					"type":    map[string]interface{}{"type": "array", "items": "long"},
+					"default": []interface{}{},
+				},
+				map[string]interface{}{"name": "InIfBoundary", "type": boundary, "default": "UNDEFINED"},
+				map[string]interface{}{"name": "OutIfBoundary", "type": "Boundary", "default": "UNDEFINED"},
+			},
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("Definition() (-got, +want):\n%s", diff)
+		}
+		if got := encoder.Name(); got != "akvorado.FlowMessagev"+flows.ProtobufMessageHash() {
+			t.Fatalf("Name() == %q", got)
+		}
+	})
+
+	t.Run("marshal", func(t *testing.T) {
+		bf := &FlowMessage{TimeReceived: 1000}
+		flows.ProtobufAppendBytes(bf, ColumnExporterName, []byte("router1"))
+		flows.ProtobufAppendVarint(bf, ColumnDstASPath, 65000)
+		flows.ProtobufAppendVarint(bf, ColumnDstASPath, 1299)
+		flows.ProtobufAppendVarint(bf, ColumnOutIfBoundary, 2)
+		got, err := encoder.Marshal([]byte{0xff}, flows.ProtobufMarshal(bf))
+		if err != nil {
+			t.Fatalf("Marshal() error:\n%+v", err)
+		}
+		expected := []byte{
+			0xff, // existing content
+			// TimeReceived: 1000
+			0xd0, 0x0f,
+			// ExporterName: router1
+			0x0e, 'r', 'o', 'u', 't', 'e', 'r', '1',
+			// DstASPath: [65000, 1299]
+			0x04, 0xd0, 0xf7, 0x07, 0xa6, 0x14, 0x00,
+			// InIfBoundary: UNDEFINED
+			0x00,
+			// OutIfBoundary: INTERNAL
+			0x04,
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("Marshal() (-got, +want):\n%s", diff)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if _, err := encoder.Marshal(nil, []byte{0x10, 0x08}); err == nil {
+			t.Fatal("Marshal() did not error")
+		}
+	})
+}
@@ -5,6 +5,7 @@ package schema
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	"golang.org/x/exp/slices"
@@ -22,6 +23,56 @@ func (column Column) ClickHouseDefinition() string {
 	return strings.Join(result, " ")
 }
 
+var (
+	// clickHouseCodecs matches the codecs accepted for a column. Parameters are
+	// mandatory when ClickHouse would otherwise display a default value, to
+	// be able to compare with the codecs of existing columns.
+	clickHouseCodecs = regexp.MustCompile(`^(NONE|LZ4|LZ4HC\([0-9]+\)|ZSTD\([0-9]+\)|Delta\([1248]\)|DoubleDelta|Gorilla|T64)$`)
+	// lowCardinalityTypes matches the types that can be wrapped into LowCardinality.
+	lowCardinalityTypes = regexp.MustCompile(`^(String|FixedString\([0-9]+\)|IPv4|IPv6)$`)
+	// missingValueTypes matches the types for which a missing value can be
+	// detected and replaced. The first group is the type without
+	// LowCardinality.
+	missingValueTypes = regexp.MustCompile(`^(?:LowCardinality\()?(String|FixedString\(([0-9]+)\)|UInt(?:8|16|32|64)|IPv6)\)?$`)
+)
+
+// ClickHouseNotNullableType returns the type of the column without Nullable.
+func (column Column) ClickHouseNotNullableType() string {
+	if !column.ClickHouseNullable {
+		return column.ClickHouseType
+	}
+	if inner, ok := strings.CutPrefix(column.ClickHouseType, "LowCardinality(Nullable("); ok {
+		return fmt.Sprintf("LowCardinality(%s", strings.TrimSuffix(inner, ")"))
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(column.ClickHouseType, "Nullable("), ")")
+}
+
+// clickHouseMissingCondition returns the condition telling if the value of
+// the column is missing.
+func (column Column) clickHouseMissingCondition() string {
+	switch baseType := missingValueTypes.FindStringSubmatch(column.ClickHouseNotNullableType())[1]; {
+	case baseType == "IPv6":
+		return fmt.Sprintf("%s = toIPv6('::')", column.Name)
+	case strings.HasPrefix(baseType, "UInt"):
+		return fmt.Sprintf("%s = 0", column.Name)
+	default:
+		return fmt.Sprintf("empty(%s)", column.Name)
+	}
+}
+
+// normalizeClickHouseCodec checks a list of codecs and returns it in the form
+// displayed by ClickHouse.
+func normalizeClickHouseCodec(codec string) (string, error) {
+	codecs := strings.Split(codec, ",")
+	for idx := range codecs {
+		codecs[idx] = strings.TrimSpace(codecs[idx])
+		if !clickHouseCodecs.MatchString(codecs[idx]) {
+			return "", fmt.Errorf("unsupported codec %q", codecs[idx])
+		}
+	}
+	return strings.Join(codecs, ", "), nil
+}
+
 // ClickHouseTableOption is an option to alter the values returned by ClickHouseCreateTable() and ClickHouseSelectColumns().
 type ClickHouseTableOption int
 
@@ -42,6 +93,12 @@ const (
 	ClickHouseSubstituteGenerates
 	// ClickHouseSubstituteTransforms changes the column name to use the transformed value
 	ClickHouseSubstituteTransforms
+	// ClickHouseSubstituteMissingValues changes the column name to replace missing values
+	ClickHouseSubstituteMissingValues
+	// ClickHouseNotNullable uses the type without Nullable
+	ClickHouseNotNullable
+	// ClickHouseSkipCodecs removes the codecs from the column definitions
+	ClickHouseSkipCodecs
 )
 
 // ClickHouseCreateTable returns the columns for the CREATE TABLE clause in ClickHouse.
@@ -94,6 +151,16 @@ func (schema Schema) clickhouseIterate(fn func(Column), options ...ClickHouseTab
 		if slices.Contains(options, ClickHouseSubstituteTransforms) && column.ClickHouseTransformFrom != nil {
 			column.Name = fmt.Sprintf("%s AS %s", column.ClickHouseTransformTo, column.Name)
 		}
+		if slices.Contains(options, ClickHouseSubstituteMissingValues) && column.ClickHouseMissingValue != "" {
+			column.Name = fmt.Sprintf("if(%s, %s, %s) AS %s",
+				column.clickHouseMissingCondition(), column.ClickHouseMissingValue, column.Name, column.Name)
+		}
+		if slices.Contains(options, ClickHouseNotNullable) {
+			column.ClickHouseType = column.ClickHouseNotNullableType()
+		}
+		if slices.Contains(options, ClickHouseSkipCodecs) {
+			column.ClickHouseCodec = ""
+		}
 		fn(column)
 	}
 }
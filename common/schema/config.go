@@ -21,8 +21,37 @@ type Configuration struct {
 	NotMainTableOnly []ColumnKey `validate:"ninterfield=MainTableOnly"`
 	// Materialize lists columns that shall be materialized at ingest instead of computed at query time
 	Materialize []ColumnKey
+	// Codecs overrides the ClickHouse compression codecs of some columns
+	Codecs map[ColumnKey]string
+	// LowCardinality lists columns to be wrapped into LowCardinality in ClickHouse
+	LowCardinality []ColumnKey
+	// MissingValues defines how missing values of some columns are stored
+	MissingValues map[ColumnKey]MissingValue `validate:"dive"`
 	// CustomDictionaries allows enrichment of flows with custom metadata
 	CustomDictionaries map[string]CustomDict `validate:"dive"`
+	// InterfaceDescriptions lists regular expressions with named captures
+	// to extract additional columns from interface descriptions
+	InterfaceDescriptions []string
+	// CustomDimensions defines additional columns computed by the inlet
+	// from an expression
+	CustomDimensions []CustomDimension `validate:"dive"`
+	// EphemeralPortThreshold is the first ephemeral port. When set,
+	// SrcPortBucket and DstPortBucket keep ports below it as is and
+	// replace the other ones with "ephemeral".
+	EphemeralPortThreshold uint16
+	// Privacy prevents IP addresses and ports to leave the inlet. Only
+	// aggregated columns (AS numbers, countries, port buckets, ...) are
+	// stored.
+	Privacy bool
+}
+
+// MissingValue defines how a missing value of a column is stored in
+// ClickHouse: either as NULL or as a default value.
+type MissingValue struct {
+	// Nullable stores missing values as NULL
+	Nullable bool
+	// Default is the value stored in place of missing values
+	Default string `validate:"required_without=Nullable,excluded_with=Nullable"`
 }
 
 // CustomDict represents a single custom dictionary
@@ -50,6 +79,14 @@ type CustomDictAttribute struct {
 	Default string `validate:"omitempty,alphanum"`
 }
 
+// CustomDimension represents a single column computed by the inlet from an
+// expression
+type CustomDimension struct {
+	Name       string `validate:"required,alphanum"`
+	Type       string `validate:"required,oneof=String UInt8 UInt16 UInt32 UInt64"`
+	Expression string `validate:"required"`
+}
+
 // DefaultConfiguration returns the default configuration for the schema component.
 func DefaultConfiguration() Configuration {
 	return Configuration{}
@@ -84,6 +121,11 @@ func (c *Component) GetCustomDictConfig() map[string]CustomDict {
 	return c.c.CustomDictionaries
 }
 
+// GetCustomDimensionsConfig returns the custom dimensions encoded in this schema
+func (c *Component) GetCustomDimensionsConfig() []CustomDimension {
+	return c.c.CustomDimensions
+}
+
 // DefaultCustomDictConfiguration is the default config for a CustomDict
 func DefaultCustomDictConfiguration() CustomDict {
 	return CustomDict{
@@ -105,8 +147,16 @@ func DefaultCustomDictAttributeConfiguration() CustomDictAttribute {
 	}
 }
 
+// DefaultCustomDimensionConfiguration is the default config for a CustomDimension
+func DefaultCustomDimensionConfiguration() CustomDimension {
+	return CustomDimension{
+		Type: "String",
+	}
+}
+
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.DefaultValuesUnmarshallerHook[CustomDict](DefaultCustomDictConfiguration()))
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.DefaultValuesUnmarshallerHook[CustomDictKey](DefaultCustomDictKeyConfiguration()))
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.DefaultValuesUnmarshallerHook[CustomDictAttribute](DefaultCustomDictAttributeConfiguration()))
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.DefaultValuesUnmarshallerHook[CustomDimension](DefaultCustomDimensionConfiguration()))
 }
@@ -28,6 +28,22 @@ const (
 	InterfaceBoundaryInternal
 )
 
+// TunnelType identifies the encapsulation detected for a flow.
+type TunnelType uint
+
+const (
+	// TunnelTypeNone means no encapsulation was detected.
+	TunnelTypeNone TunnelType = iota
+	// TunnelTypeGRE is for GRE (including NVGRE).
+	TunnelTypeGRE
+	// TunnelTypeVXLAN is for VXLAN.
+	TunnelTypeVXLAN
+	// TunnelTypeIPIP is for IPv4 or IPv6 encapsulated into IPv4 or IPv6.
+	TunnelTypeIPIP
+	// TunnelTypeESP is for IPsec ESP.
+	TunnelTypeESP
+)
+
 var (
 	interfaceBoundaryMap = bimap.New(map[InterfaceBoundary]string{
 		InterfaceBoundaryUndefined: "undefined",
@@ -153,6 +169,32 @@ const (
 	ColumnMPLS2ndLabel
 	ColumnMPLS3rdLabel
 	ColumnMPLS4thLabel
+	ColumnInletSite
+	ColumnApplication
+	ColumnForwardingClass
+	ColumnApplicationID
+	ColumnSubscriberID
+	ColumnFlowDuration
+	ColumnFlowDurationBucket
+	ColumnReverseBytes
+	ColumnReversePackets
+	ColumnSrcVlanInner
+	ColumnDstVlanInner
+	ColumnTunnelID
+	ColumnProtoInner
+	ColumnSrcAddrInner
+	ColumnDstAddrInner
+	ColumnSrcPortInner
+	ColumnDstPortInner
+	ColumnNATEvent
+	ColumnFirewallEvent
+	ColumnTrafficDirection
+	ColumnSrcPortBucket
+	ColumnDstPortBucket
+	ColumnTunnelType
+	ColumnTag
+	ColumnInIfLogicalLink
+	ColumnOutIfLogicalLink
 
 	// ColumnLast points to after the last static column, custom dictionaries
 	// (dynamic columns) come after ColumnLast
@@ -163,6 +205,7 @@ const (
 	ColumnGroupL2 ColumnGroup = iota + 1
 	ColumnGroupNAT
 	ColumnGroupL3L4
+	ColumnGroupTunnel
 
 	ColumnGroupLast
 )
@@ -197,12 +240,12 @@ func flows() Schema {
 			},
 			{Key: ColumnSamplingRate, NoDisable: true, ClickHouseType: "UInt64", ConsoleNotDimension: true},
 			{Key: ColumnExporterAddress, ParserType: "ip", ClickHouseType: "LowCardinality(IPv6)"},
-			{Key: ColumnExporterName, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnExporterGroup, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnExporterRole, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnExporterSite, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnExporterRegion, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnExporterTenant, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
+			{Key: ColumnExporterName, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnExporterGroup, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnExporterRole, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnExporterSite, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnExporterRegion, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnExporterTenant, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
 			{
 				Key:                ColumnSrcAddr,
 				ParserType:         "ip",
@@ -216,6 +259,7 @@ func flows() Schema {
 				ClickHouseMainOnly:  true,
 				ClickHouseType:      "UInt8",
 				ConsoleNotDimension: true,
+				InletEnrichment:     true,
 			},
 			{
 				Key:                        ColumnSrcNetPrefix,
@@ -228,7 +272,7 @@ func flows() Schema {
  ELSE ''
 END`,
 			},
-			{Key: ColumnSrcAS, ClickHouseType: "UInt32"},
+			{Key: ColumnSrcAS, ClickHouseType: "UInt32", InletEnrichment: true},
 			{
 				Key:                    ColumnSrcNetName,
 				ParserType:             "string",
@@ -290,11 +334,12 @@ END`,
 				ClickHouseGenerateFrom: "dictGetOrDefault('networks', 'tenant', DstAddr, '')",
 			},
 			{Key: ColumnSrcVlan, ParserType: "uint", ClickHouseType: "UInt16", Disabled: true, Group: ColumnGroupL2},
-			{Key: ColumnSrcCountry, ParserType: "string", ClickHouseType: "FixedString(2)"},
+			{Key: ColumnSrcCountry, ParserType: "string", ClickHouseType: "FixedString(2)", InletEnrichment: true},
 			{
 				Key:                ColumnDstASPath,
 				ClickHouseMainOnly: true,
 				ClickHouseType:     "Array(UInt32)",
+				InletEnrichment:    true,
 			},
 			{
 				Key:                    ColumnDst1stAS,
@@ -318,6 +363,7 @@ END`,
 				Key:                ColumnDstCommunities,
 				ClickHouseMainOnly: true,
 				ClickHouseType:     "Array(UInt32)",
+				InletEnrichment:    true,
 			},
 			{
 				Key:                ColumnDstLargeCommunities,
@@ -339,12 +385,13 @@ END`,
 				},
 				ClickHouseTransformTo: "arrayMap((asn, l1, l2) -> ((bitShiftLeft(CAST(asn, 'UInt128'), 64) + bitShiftLeft(CAST(l1, 'UInt128'), 32)) + CAST(l2, 'UInt128')), DstLargeCommunitiesASN, DstLargeCommunitiesLocalData1, DstLargeCommunitiesLocalData2)",
 				ConsoleNotDimension:   true,
+				InletEnrichment:       true,
 			},
-			{Key: ColumnInIfName, ParserType: "string", ClickHouseType: "LowCardinality(String)"},
-			{Key: ColumnInIfDescription, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnInIfSpeed, ParserType: "uint", ClickHouseType: "UInt32", ClickHouseNotSortingKey: true},
-			{Key: ColumnInIfConnectivity, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
-			{Key: ColumnInIfProvider, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true},
+			{Key: ColumnInIfName, ParserType: "string", ClickHouseType: "LowCardinality(String)", InletEnrichment: true},
+			{Key: ColumnInIfDescription, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnInIfSpeed, ParserType: "uint", ClickHouseType: "UInt32", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnInIfConnectivity, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
+			{Key: ColumnInIfProvider, ParserType: "string", ClickHouseType: "LowCardinality(String)", ClickHouseNotSortingKey: true, InletEnrichment: true},
 			{
 				Key:                     ColumnInIfBoundary,
 				ClickHouseType:          fmt.Sprintf("Enum8('undefined' = %d, 'external' = %d, 'internal' = %d)", InterfaceBoundaryUndefined, InterfaceBoundaryExternal, InterfaceBoundaryInternal),
@@ -356,6 +403,19 @@ END`,
 					int(InterfaceBoundaryExternal):  "EXTERNAL",
 					int(InterfaceBoundaryInternal):  "INTERNAL",
 				},
+				InletEnrichment: true,
+			},
+			{
+				Key:            ColumnTrafficDirection,
+				Depends:        []ColumnKey{ColumnInIfBoundary, ColumnOutIfBoundary},
+				ParserType:     "string",
+				ClickHouseType: "LowCardinality(String)",
+				ClickHouseAlias: `multiIf(` +
+					`InIfBoundary = 'external' AND OutIfBoundary = 'internal', 'inbound', ` +
+					`InIfBoundary = 'internal' AND OutIfBoundary = 'external', 'outbound', ` +
+					`InIfBoundary = 'internal' AND OutIfBoundary = 'internal', 'internal', ` +
+					`InIfBoundary = 'external' AND OutIfBoundary = 'external', 'transit', ` +
+					`'undefined')`,
 			},
 			{Key: ColumnEType, ClickHouseType: "UInt32"}, // TODO: UInt16 but hard to change, primary key
 			{Key: ColumnProto, ClickHouseType: "UInt32"}, // TODO: UInt8 but hard to change, primary key
@@ -422,6 +482,22 @@ END`,
 				ClickHouseType:     "UInt16",
 				ClickHouseMainOnly: true,
 			},
+			{
+				Key:                ColumnNATEvent,
+				Disabled:           true,
+				Group:              ColumnGroupNAT,
+				ParserType:         "uint",
+				ClickHouseType:     "UInt8",
+				ClickHouseMainOnly: true,
+			},
+			{
+				Key:                ColumnFirewallEvent,
+				Disabled:           true,
+				Group:              ColumnGroupNAT,
+				ParserType:         "uint",
+				ClickHouseType:     "UInt8",
+				ClickHouseMainOnly: true,
+			},
 			{Key: ColumnSrcMAC, Disabled: true, Group: ColumnGroupL2, ClickHouseType: "UInt64"},
 			{Key: ColumnIPTTL, Disabled: true, Group: ColumnGroupL3L4, ParserType: "uint", ClickHouseType: "UInt8"},
 			{Key: ColumnIPTos, Disabled: true, Group: ColumnGroupL3L4, ParserType: "uint", ClickHouseType: "UInt8"},
@@ -461,6 +537,7 @@ END`,
 				ParserType:      "ip",
 				ClickHouseType:  "LowCardinality(IPv6)",
 				ClickHouseCodec: "ZSTD(1)",
+				InletEnrichment: true,
 			},
 			{
 				Key:                ColumnMPLSLabels,
@@ -505,6 +582,158 @@ END`,
 				ClickHouseAlias:    "MPLSLabels[4]",
 				ParserType:         "uint",
 			},
+			{
+				Key:             ColumnInletSite,
+				Disabled:        true,
+				ParserType:      "string",
+				ClickHouseType:  "LowCardinality(String)",
+				InletEnrichment: true,
+			},
+			{
+				Key:             ColumnApplication,
+				Disabled:        true,
+				ParserType:      "string",
+				ClickHouseType:  "LowCardinality(String)",
+				InletEnrichment: true,
+			},
+			{
+				Key:            ColumnForwardingClass,
+				Disabled:       true,
+				ClickHouseType: "UInt8",
+				ParserType:     "uint",
+			},
+			{
+				Key:            ColumnApplicationID,
+				Disabled:       true,
+				ClickHouseType: "UInt32",
+				ParserType:     "uint",
+			},
+			{
+				Key:                ColumnSubscriberID,
+				Disabled:           true,
+				ClickHouseMainOnly: true,
+				ClickHouseType:     "String",
+				ParserType:         "string",
+			},
+			{
+				Key:                 ColumnFlowDuration,
+				Disabled:            true,
+				ClickHouseMainOnly:  true,
+				ClickHouseType:      "UInt32",
+				ParserType:          "uint",
+				ConsoleNotDimension: true,
+			},
+			{
+				Key:                ColumnFlowDurationBucket,
+				Depends:            []ColumnKey{ColumnFlowDuration},
+				Disabled:           true,
+				ClickHouseMainOnly: true,
+				ClickHouseType:     "LowCardinality(String)",
+				ClickHouseAlias: func() string {
+					boundaries := []int{1, 5, 10, 15, 30, 60, 120, 300, 600, 1800}
+					conditions := []string{}
+					last := 0
+					for _, boundary := range boundaries {
+						conditions = append(conditions, fmt.Sprintf("FlowDuration < %d, '%ds-%ds'",
+							boundary*1000, last, boundary))
+						last = boundary
+					}
+					conditions = append(conditions, fmt.Sprintf("'%ds-Inf'", last))
+					return fmt.Sprintf("multiIf(%s)", strings.Join(conditions, ", "))
+				}(),
+			},
+			{
+				Key:                 ColumnReverseBytes,
+				Disabled:            true,
+				ClickHouseMainOnly:  true,
+				ClickHouseType:      "UInt64",
+				ClickHouseCodec:     "T64, LZ4",
+				ParserType:          "uint",
+				ConsoleNotDimension: true,
+			},
+			{
+				Key:                 ColumnReversePackets,
+				Disabled:            true,
+				ClickHouseMainOnly:  true,
+				ClickHouseType:      "UInt64",
+				ClickHouseCodec:     "T64, LZ4",
+				ParserType:          "uint",
+				ConsoleNotDimension: true,
+			},
+			{Key: ColumnSrcVlanInner, ParserType: "uint", ClickHouseType: "UInt16", Disabled: true, Group: ColumnGroupL2},
+			{
+				Key:                ColumnTunnelID,
+				Disabled:           true,
+				Group:              ColumnGroupTunnel,
+				ParserType:         "uint",
+				ClickHouseType:     "UInt32",
+				ClickHouseMainOnly: true,
+			},
+			{
+				Key:                ColumnProtoInner,
+				Disabled:           true,
+				Group:              ColumnGroupTunnel,
+				ParserType:         "uint",
+				ClickHouseType:     "UInt8",
+				ClickHouseMainOnly: true,
+			},
+			{
+				Key:                ColumnSrcAddrInner,
+				Disabled:           true,
+				Group:              ColumnGroupTunnel,
+				ParserType:         "ip",
+				ClickHouseType:     "IPv6",
+				ClickHouseMainOnly: true,
+				ConsoleTruncateIP:  true,
+			},
+			{
+				Key:                ColumnSrcPortInner,
+				Disabled:           true,
+				Group:              ColumnGroupTunnel,
+				ParserType:         "uint",
+				ClickHouseType:     "UInt16",
+				ClickHouseMainOnly: true,
+			},
+			{
+				Key:            ColumnSrcPortBucket,
+				Disabled:       true,
+				ParserType:     "string",
+				ClickHouseType: "LowCardinality(String)",
+			},
+			{
+				Key:        ColumnTunnelType,
+				Disabled:   true,
+				Group:      ColumnGroupTunnel,
+				ParserType: "string",
+				ClickHouseType: fmt.Sprintf("Enum8('none' = %d, 'gre' = %d, 'vxlan' = %d, 'ipip' = %d, 'esp' = %d)",
+					TunnelTypeNone, TunnelTypeGRE, TunnelTypeVXLAN, TunnelTypeIPIP, TunnelTypeESP),
+				ClickHouseNotSortingKey: true,
+				ProtobufType:            protoreflect.EnumKind,
+				ProtobufEnumName:        "TunnelType",
+				ProtobufEnum: map[int]string{
+					int(TunnelTypeNone):  "NONE",
+					int(TunnelTypeGRE):   "GRE",
+					int(TunnelTypeVXLAN): "VXLAN",
+					int(TunnelTypeIPIP):  "IPIP",
+					int(TunnelTypeESP):   "ESP",
+				},
+			},
+			{
+				Key:                     ColumnTag,
+				Disabled:                true,
+				ParserType:              "string",
+				ClickHouseType:          "LowCardinality(String)",
+				ClickHouseNotSortingKey: true,
+				InletEnrichment:         true,
+			},
+			{
+				Key:                     ColumnInIfLogicalLink,
+				Disabled:                true,
+				ParserType:              "string",
+				ClickHouseType:          "LowCardinality(String)",
+				ClickHouseNotSortingKey: true,
+				InletEnrichment:         true,
+			},
 		},
 	}.finalize()
 }
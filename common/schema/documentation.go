@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package schema
+
+// ColumnSource describes where the value of a column comes from.
+type ColumnSource string
+
+const (
+	// ColumnSourceDecoder is for columns extracted from the received flows.
+	ColumnSourceDecoder ColumnSource = "decoder"
+	// ColumnSourceEnrichment is for columns set by the inlet during
+	// enrichment (metadata, routing, GeoIP, classifiers).
+	ColumnSourceEnrichment ColumnSource = "enrichment"
+	// ColumnSourceClickHouse is for columns computed by ClickHouse when
+	// inserting flows.
+	ColumnSourceClickHouse ColumnSource = "clickhouse"
+	// ColumnSourceAlias is for columns computed by ClickHouse when querying
+	// flows.
+	ColumnSourceAlias ColumnSource = "alias"
+)
+
+// ColumnDocumentation documents a column of the schema.
+type ColumnDocumentation struct {
+	Name          string       `json:"name"`
+	Type          string       `json:"type"`
+	Enabled       bool         `json:"enabled"`
+	MainTableOnly bool         `json:"main-table-only"`
+	Source        ColumnSource `json:"source"`
+	Expression    string       `json:"expression,omitempty"`
+}
+
+// Source returns the source of the value of the column.
+func (column Column) Source() ColumnSource {
+	switch {
+	case column.ClickHouseAlias != "":
+		return ColumnSourceAlias
+	case column.ClickHouseGenerateFrom != "":
+		return ColumnSourceClickHouse
+	case column.InletEnrichment:
+		return ColumnSourceEnrichment
+	default:
+		return ColumnSourceDecoder
+	}
+}
+
+// Documentation returns the documentation of all the columns of the schema,
+// including the disabled ones.
+func (schema *Schema) Documentation() []ColumnDocumentation {
+	result := make([]ColumnDocumentation, 0, len(schema.columns))
+	for _, column := range schema.columns {
+		expression := column.ClickHouseAlias
+		if expression == "" {
+			expression = column.ClickHouseGenerateFrom
+		}
+		result = append(result, ColumnDocumentation{
+			Name:          column.Name,
+			Type:          column.ClickHouseType,
+			Enabled:       !column.Disabled,
+			MainTableOnly: column.ClickHouseMainOnly,
+			Source:        column.Source(),
+			Expression:    expression,
+		})
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package schema
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestDocumentation(t *testing.T) {
+	c := NewMock(t)
+	got := map[string]ColumnDocumentation{}
+	for _, column := range c.Documentation() {
+		got[column.Name] = column
+	}
+	if len(got) != len(c.columns) {
+		t.Fatalf("Documentation() returned %d columns, expected %d", len(got), len(c.columns))
+	}
+
+	expected := []ColumnDocumentation{
+		{
+			Name:          "SrcPort",
+			Type:          "UInt16",
+			Enabled:       true,
+			Source:        ColumnSourceDecoder,
+			MainTableOnly: true,
+		}, {
+			Name:    "OutIfProvider",
+			Type:    "LowCardinality(String)",
+			Enabled: true,
+			Source:  ColumnSourceEnrichment,
+		}, {
+			Name:       "DstNetName",
+			Type:       "LowCardinality(String)",
+			Enabled:    true,
+			Source:     ColumnSourceClickHouse,
+			Expression: "dictGetOrDefault('networks', 'name', DstAddr, '')",
+		}, {
+			Name:          "MPLS1stLabel",
+			Type:          "UInt32",
+			Source:        ColumnSourceAlias,
+			Expression:    "MPLSLabels[1]",
+			MainTableOnly: true,
+		},
+	}
+	for _, column := range expected {
+		if diff := helpers.Diff(got[column.Name], column); diff != "" {
+			t.Errorf("Documentation(%q) (-got, +want):\n%s", column.Name, diff)
+		}
+	}
+}
@@ -3,7 +3,10 @@
 
 package schema
 
-import "strings"
+import (
+	"regexp"
+	"strings"
+)
 
 // LookupColumnByName can lookup a column by its name.
 func (schema *Schema) LookupColumnByName(name string) (*Column, bool) {
@@ -62,3 +65,28 @@ func (schema *Schema) Columns() []Column {
 func (schema *Schema) IsDisabled(group ColumnGroup) bool {
 	return schema.disabledGroups.Test(uint(group))
 }
+
+// compileReferences compiles the regular expressions matching a reference to
+// each column in an SQL expression.
+func (schema *Schema) compileReferences() {
+	schema.references = map[string]*regexp.Regexp{}
+	for _, column := range schema.columns {
+		for _, column := range append([]Column{column}, column.ClickHouseTransformFrom...) {
+			schema.references[column.Name] = regexp.MustCompile(
+				`\b` + regexp.QuoteMeta(column.Name) + `\b`)
+		}
+	}
+}
+
+// ReferencesColumn tells if the provided SQL expression references the
+// provided column.
+func (schema *Schema) ReferencesColumn(expression string, name string) bool {
+	if expression == "" {
+		return false
+	}
+	re, ok := schema.references[name]
+	if !ok {
+		re = regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+	}
+	return re.MatchString(expression)
+}
@@ -48,3 +48,26 @@ func TestReverseColumnDirection(t *testing.T) {
 		}
 	}
 }
+
+func TestReferencesColumn(t *testing.T) {
+	c := NewMock(t)
+	cases := []struct {
+		Expression string
+		Name       string
+		Output     bool
+	}{
+		{"", "SrcAddr", false},
+		{"SrcAddr = 1.1.1.1", "SrcAddr", true},
+		{"SrcAddrNAT = 1.1.1.1", "SrcAddr", false},
+		{"dictGet('asns', 'name', SrcAS)", "SrcAS", true},
+		{"dictGet('asns', 'name', SrcAS)", "DstAS", false},
+		{"CustomColumn = 'x'", "CustomColumn", true},
+	}
+	for _, tc := range cases {
+		got := c.ReferencesColumn(tc.Expression, tc.Name)
+		if got != tc.Output {
+			t.Errorf("ReferencesColumn(%q, %q) == %v but expected %v",
+				tc.Expression, tc.Name, got, tc.Output)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package schema
+
+import (
+	"fmt"
+	"strconv"
+
+	"golang.org/x/exp/slices"
+)
+
+// privateColumns are the columns disabled in privacy mode, in addition to
+// the ones containing IP addresses.
+var privateColumns = []ColumnKey{
+	ColumnSrcPort, ColumnDstPort,
+	ColumnSrcPortNAT, ColumnDstPortNAT,
+	ColumnSrcPortInner, ColumnDstPortInner,
+	ColumnSrcMAC, ColumnDstMAC,
+}
+
+// applyPrivacy disables the columns containing IP addresses (except the
+// exporter address), MAC addresses or ports, as well as the columns derived
+// from them. Ports are replaced by port buckets.
+func (schema *Schema) applyPrivacy(config Configuration) error {
+	private := map[string]bool{}
+	for _, column := range schema.columns {
+		if column.Key == ColumnExporterAddress {
+			continue
+		}
+		if column.ParserType == "ip" || slices.Contains(privateColumns, column.Key) {
+			private[column.Name] = true
+		}
+	}
+
+	// Columns derived from a private column are private too.
+	for changed := true; changed; {
+		changed = false
+		for _, column := range schema.columns {
+			if private[column.Name] {
+				continue
+			}
+			for name := range private {
+				key, _ := columnNameMap.LoadKey(name)
+				if slices.Contains(column.Depends, key) ||
+					schema.ReferencesColumn(column.ClickHouseAlias, name) ||
+					schema.ReferencesColumn(column.ClickHouseGenerateFrom, name) {
+					private[column.Name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	for idx := range schema.columns {
+		column := &schema.columns[idx]
+		switch {
+		case private[column.Name]:
+			if slices.Contains(config.Enabled, column.Key) {
+				return fmt.Errorf("column %q cannot be enabled in privacy mode", column.Name)
+			}
+			column.Disabled = true
+		case column.Key == ColumnSrcPortBucket || column.Key == ColumnDstPortBucket:
+			if !slices.Contains(config.Disabled, column.Key) {
+				column.Disabled = false
+			}
+		}
+	}
+	schema.privacy = true
+	return nil
+}
+
+// PortBucket returns the bucket for the provided port. When an ephemeral port
+// threshold is configured, ports below it are kept as is and the other ones
+// are "ephemeral". Otherwise, well-known ports are kept as is, other ports
+// are grouped into registered and dynamic ports.
+func (schema *Schema) PortBucket(port uint64) string {
+	if schema.ephemeralPortThreshold > 0 {
+		if port < uint64(schema.ephemeralPortThreshold) {
+			return strconv.FormatUint(port, 10)
+		}
+		return "ephemeral"
+	}
+	switch {
+	case port < 1024:
+		return strconv.FormatUint(port, 10)
+	case port < 49152:
+		return "1024-49151"
+	default:
+		return "49152-65535"
+	}
+}
+
+// Privacy tells if the privacy mode is enabled. In this mode, IP addresses
+// and ports are not transmitted outside of the inlet.
+func (schema *Schema) Privacy() bool {
+	return schema.privacy
+}
@@ -4,9 +4,12 @@
 package schema
 
 import (
+	"bytes"
 	"encoding/base32"
+	"encoding/binary"
 	"fmt"
 	"hash/fnv"
+	"maps"
 	"net/netip"
 	"strings"
 
@@ -158,6 +161,58 @@ func (column *Column) ProtobufAppendVarintForce(bf *FlowMessage, value uint64) {
 	}
 }
 
+// ProtobufVarint returns the first varint appended for the provided column to
+// the protobuf representation of a flow. The flow should not have been
+// processed by `ProtobufMarshal` yet.
+func (schema *Schema) ProtobufVarint(bf *FlowMessage, columnKey ColumnKey) (uint64, bool) {
+	column, _ := schema.LookupColumnByKey(columnKey)
+	if column.ProtobufIndex <= 0 || bf.protobuf == nil || !bf.protobufSet.Test(uint(column.ProtobufIndex)) {
+		return 0, false
+	}
+	data := bf.protobuf[maxSizeVarint:]
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return 0, false
+		}
+		data = data[n:]
+		if num == column.ProtobufIndex && typ == protowire.VarintType {
+			value, n := protowire.ConsumeVarint(data)
+			return value, n >= 0
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return 0, false
+		}
+		data = data[n:]
+	}
+	return 0, false
+}
+
+// FlowHash returns a hash of the 5-tuple of a flow (addresses, ports and
+// protocol). Both directions of a flow get the same hash. The flow should not
+// have been processed by `ProtobufMarshal` yet.
+func (schema *Schema) FlowHash(bf *FlowMessage) uint64 {
+	proto, _ := schema.ProtobufVarint(bf, ColumnProto)
+	srcPort, _ := schema.ProtobufVarint(bf, ColumnSrcPort)
+	dstPort, _ := schema.ProtobufVarint(bf, ColumnDstPort)
+	srcAddr := bf.SrcAddr.As16()
+	dstAddr := bf.DstAddr.As16()
+	if c := bytes.Compare(srcAddr[:], dstAddr[:]); c > 0 || (c == 0 && srcPort > dstPort) {
+		srcAddr, dstAddr = dstAddr, srcAddr
+		srcPort, dstPort = dstPort, srcPort
+	}
+	buf := make([]byte, 0, 37)
+	buf = append(buf, srcAddr[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(srcPort))
+	buf = append(buf, dstAddr[:]...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(dstPort))
+	buf = append(buf, byte(proto))
+	h := fnv.New64a()
+	h.Write(buf)
+	return h.Sum64()
+}
+
 func (column Column) protobufCanAppend(bf *FlowMessage) bool {
 	return column.ProtobufIndex > 0 &&
 		!column.Disabled &&
@@ -254,6 +309,20 @@ func (bf *FlowMessage) Bytes() []byte {
 	return bf.protobuf
 }
 
+// Clone returns a copy of the flow which can be modified or marshaled
+// independently of the original one.
+func (bf *FlowMessage) Clone() *FlowMessage {
+	clone := *bf
+	if bf.protobuf != nil {
+		clone.protobuf = append(make([]byte, 0, cap(bf.protobuf)), bf.protobuf...)
+		clone.protobufSet = *bf.protobufSet.Clone()
+	}
+	if bf.ProtobufDebug != nil {
+		clone.ProtobufDebug = maps.Clone(bf.ProtobufDebug)
+	}
+	return &clone
+}
+
 func (bf *FlowMessage) init() {
 	if bf.protobuf == nil {
 		bf.protobuf = make([]byte, maxSizeVarint, 500)
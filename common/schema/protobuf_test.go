@@ -174,6 +174,99 @@ func TestProtobufMarshal(t *testing.T) {
 	})
 }
 
+func TestProtobufClone(t *testing.T) {
+	c := NewMock(t)
+	bf := &FlowMessage{SamplingRate: 20000}
+	c.ProtobufAppendVarint(bf, ColumnBytes, 200)
+	clone := bf.Clone()
+	c.ProtobufAppendVarint(clone, ColumnPackets, 300)
+	c.ProtobufAppendVarint(bf, ColumnDstAS, 65000)
+	clone.SamplingRate = 1000
+
+	got := c.ProtobufDecode(t, c.ProtobufMarshal(bf))
+	expected := &FlowMessage{
+		SamplingRate: 20000,
+		DstAS:        65000,
+		ProtobufDebug: map[ColumnKey]interface{}{
+			ColumnBytes: 200,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ProtobufDecode() (-got, +want):\n%s", diff)
+	}
+	got = c.ProtobufDecode(t, c.ProtobufMarshal(clone))
+	expected = &FlowMessage{
+		SamplingRate: 1000,
+		ProtobufDebug: map[ColumnKey]interface{}{
+			ColumnBytes:   200,
+			ColumnPackets: 300,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ProtobufDecode() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestProtobufVarint(t *testing.T) {
+	c := NewMock(t)
+	bf := &FlowMessage{}
+	if _, ok := c.ProtobufVarint(bf, ColumnProto); ok {
+		t.Fatal("ProtobufVarint(Proto) on empty flow should not find a value")
+	}
+	c.ProtobufAppendVarint(bf, ColumnDstAS, 65000)
+	c.ProtobufAppendBytes(bf, ColumnDstCountry, []byte("FR"))
+	c.ProtobufAppendVarint(bf, ColumnProto, 17)
+	c.ProtobufAppendVarint(bf, ColumnDstPort, 443)
+
+	cases := []struct {
+		Column   ColumnKey
+		Expected uint64
+		Found    bool
+	}{
+		{ColumnProto, 17, true},
+		{ColumnDstPort, 443, true},
+		{ColumnDstAS, 65000, true},
+		{ColumnSrcPort, 0, false},
+		{ColumnSrcVlan, 0, false}, // disabled
+	}
+	for _, tc := range cases {
+		got, ok := c.ProtobufVarint(bf, tc.Column)
+		if got != tc.Expected || ok != tc.Found {
+			t.Errorf("ProtobufVarint(%s) == %d, %v but expected %d, %v",
+				tc.Column, got, ok, tc.Expected, tc.Found)
+		}
+	}
+}
+
+func TestFlowHash(t *testing.T) {
+	c := NewMock(t)
+	flow := func(srcAddr, dstAddr string, srcPort, dstPort, proto uint64) *FlowMessage {
+		bf := &FlowMessage{
+			SrcAddr: netip.MustParseAddr(srcAddr),
+			DstAddr: netip.MustParseAddr(dstAddr),
+		}
+		c.ProtobufAppendVarint(bf, ColumnProto, proto)
+		c.ProtobufAppendVarint(bf, ColumnSrcPort, srcPort)
+		c.ProtobufAppendVarint(bf, ColumnDstPort, dstPort)
+		return bf
+	}
+	reference := c.FlowHash(flow("::ffff:192.0.2.1", "::ffff:198.51.100.1", 34567, 443, 6))
+	if got := c.FlowHash(flow("::ffff:198.51.100.1", "::ffff:192.0.2.1", 443, 34567, 6)); got != reference {
+		t.Errorf("FlowHash() for reverse direction == %d, expected %d", got, reference)
+	}
+	for _, bf := range []*FlowMessage{
+		flow("::ffff:192.0.2.1", "::ffff:198.51.100.1", 34568, 443, 6),
+		flow("::ffff:192.0.2.1", "::ffff:198.51.100.1", 34567, 443, 17),
+		flow("::ffff:192.0.2.2", "::ffff:198.51.100.1", 34567, 443, 6),
+		flow("::ffff:192.0.2.1", "::ffff:198.51.100.1", 443, 34567, 6),
+	} {
+		if got := c.FlowHash(bf); got == reference {
+			t.Errorf("FlowHash(%s, %s) == %d, expected a different value",
+				bf.SrcAddr, bf.DstAddr, got)
+		}
+	}
+}
+
 func BenchmarkProtobufMarshal(b *testing.B) {
 	c := NewMock(b)
 	exporterAddress := netip.MustParseAddr("::ffff:203.0.113.14")
@@ -7,7 +7,11 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"golang.org/x/exp/slices"
@@ -25,6 +29,7 @@ type Component struct {
 // New creates a new schema component.
 func New(config Configuration) (*Component, error) {
 	schema := flows()
+	schema.ephemeralPortThreshold = config.EphemeralPortThreshold
 	for _, k := range config.Materialize {
 		if column, ok := schema.LookupColumnByKey(k); ok {
 			if column.ClickHouseAlias != "" {
@@ -83,6 +88,75 @@ func New(config Configuration) (*Component, error) {
 			column.ClickHouseMainOnly = true
 		}
 	}
+	for k, codec := range config.Codecs {
+		if column, ok := schema.LookupColumnByKey(k); ok {
+			if column.ClickHouseAlias != "" {
+				return nil, fmt.Errorf("column %q is an alias and cannot have a codec", k)
+			}
+			normalized, err := normalizeClickHouseCodec(codec)
+			if err != nil {
+				return nil, fmt.Errorf("column %q: %w", k, err)
+			}
+			column.ClickHouseCodec = normalized
+		}
+	}
+	for _, k := range config.LowCardinality {
+		if column, ok := schema.LookupColumnByKey(k); ok {
+			if strings.HasPrefix(column.ClickHouseType, "LowCardinality(") {
+				continue
+			}
+			if column.ClickHouseAlias != "" {
+				return nil, fmt.Errorf("column %q is an alias and cannot be wrapped into LowCardinality", k)
+			}
+			if !lowCardinalityTypes.MatchString(column.ClickHouseType) {
+				return nil, fmt.Errorf("column %q of type %s cannot be wrapped into LowCardinality", k, column.ClickHouseType)
+			}
+			column.ClickHouseType = fmt.Sprintf("LowCardinality(%s)", column.ClickHouseType)
+		}
+	}
+	for k, missing := range config.MissingValues {
+		if column, ok := schema.LookupColumnByKey(k); ok {
+			if !column.InletEnrichment || column.ClickHouseAlias != "" || column.ClickHouseGenerateFrom != "" {
+				return nil, fmt.Errorf("column %q is not set by the inlet and cannot have a missing value", k)
+			}
+			matches := missingValueTypes.FindStringSubmatch(column.ClickHouseType)
+			if matches == nil {
+				return nil, fmt.Errorf("column %q of type %s cannot have a missing value", k, column.ClickHouseType)
+			}
+			if missing.Nullable {
+				if slices.Contains(schema.clickHousePrimaryKeys, k) ||
+					(!column.ClickHouseNotSortingKey && !column.ClickHouseMainOnly) {
+					return nil, fmt.Errorf("column %q is part of the sorting key and cannot be nullable", k)
+				}
+				if strings.HasPrefix(column.ClickHouseType, "LowCardinality(") {
+					column.ClickHouseType = fmt.Sprintf("LowCardinality(Nullable(%s))", matches[1])
+				} else {
+					column.ClickHouseType = fmt.Sprintf("Nullable(%s)", column.ClickHouseType)
+				}
+				column.ClickHouseNullable = true
+				column.ClickHouseMissingValue = "NULL"
+				continue
+			}
+			switch baseType := matches[1]; {
+			case strings.HasPrefix(baseType, "UInt"):
+				bits, _ := strconv.Atoi(strings.TrimPrefix(baseType, "UInt"))
+				if _, err := strconv.ParseUint(missing.Default, 10, bits); err != nil {
+					return nil, fmt.Errorf("column %q: invalid default value %q for %s", k, missing.Default, baseType)
+				}
+				column.ClickHouseMissingValue = missing.Default
+			case baseType == "IPv6":
+				if _, err := netip.ParseAddr(missing.Default); err != nil {
+					return nil, fmt.Errorf("column %q: invalid default value %q for %s", k, missing.Default, baseType)
+				}
+				column.ClickHouseMissingValue = fmt.Sprintf("toIPv6('%s')", missing.Default)
+			default:
+				if size, _ := strconv.Atoi(matches[2]); size > 0 && len(missing.Default) > size {
+					return nil, fmt.Errorf("column %q: default value %q is too long for %s", k, missing.Default, baseType)
+				}
+				column.ClickHouseMissingValue = fmt.Sprintf("'%s'", quoteString(missing.Default))
+			}
+		}
+	}
 
 	// Add new columns from custom dictionaries after the static ones as we dont
 	// reference the dicts in the code and they are created during runtime from
@@ -157,10 +231,88 @@ func New(config Configuration) (*Component, error) {
 		}
 	}
 
+	// Add new columns extracted from interface descriptions. Each named
+	// capture gives a column for both directions.
+	if len(config.InterfaceDescriptions) > 0 {
+		if column, _ := schema.LookupColumnByKey(ColumnInIfDescription); column.Disabled {
+			return nil, errors.New("interface descriptions cannot be parsed when InIfDescription is disabled")
+		}
+	}
+	for _, pattern := range config.InterfaceDescriptions {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("cannot compile interface description pattern %q: %w", pattern, err)
+		}
+		found := false
+		for idx, capture := range re.SubexpNames() {
+			if capture == "" {
+				continue
+			}
+			found = true
+			for _, direction := range []string{"InIf", "OutIf"} {
+				name := fmt.Sprintf("%s%s", direction, capture)
+				if key, ok := columnNameMap.LoadKey(name); ok && key < ColumnLast ||
+					slices.ContainsFunc(customDictColumns, func(c Column) bool { return c.Name == name }) {
+					return nil, fmt.Errorf("column %q from interface description pattern %q already exists", name, pattern)
+				}
+				key := ColumnLast + schema.dynamicColumns
+				customDictColumns = append(customDictColumns,
+					Column{
+						Key:            key,
+						Name:           name,
+						ParserType:     "string",
+						ClickHouseType: "LowCardinality(String)",
+						ClickHouseGenerateFrom: fmt.Sprintf("extractGroups(%sDescription, '%s')[%d]",
+							direction, quoteString(pattern), idx),
+					})
+				columnNameMap.Insert(key, name)
+				schema.dynamicColumns++
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("interface description pattern %q has no named capture", pattern)
+		}
+	}
+
+	// Add new columns computed by the inlet from an expression. As they are
+	// not generated by ClickHouse, they are transmitted in the protobuf
+	// message.
+	for _, d := range config.CustomDimensions {
+		if key, ok := columnNameMap.LoadKey(d.Name); ok && key < ColumnLast ||
+			slices.ContainsFunc(customDictColumns, func(c Column) bool { return c.Name == d.Name }) {
+			return nil, fmt.Errorf("custom dimension %q already exists", d.Name)
+		}
+		column := Column{
+			Key:            ColumnLast + schema.dynamicColumns,
+			Name:           d.Name,
+			ParserType:     "uint",
+			ClickHouseType: d.Type,
+		}
+		if d.Type == "String" {
+			column.ParserType = "string"
+			column.ClickHouseType = "LowCardinality(String)"
+		}
+		customDictColumns = append(customDictColumns, column)
+		columnNameMap.Insert(column.Key, column.Name)
+		schema.dynamicColumns++
+	}
+
 	schema.columns = append(schema.columns, customDictColumns...)
+	schema.compileReferences()
+
+	if config.Privacy {
+		if err := schema.applyPrivacy(config); err != nil {
+			return nil, err
+		}
+	}
 
 	return &Component{
 		c:      config,
 		Schema: schema.finalize(),
 	}, nil
 }
+
+// quoteString escapes a string to be used as a ClickHouse string literal.
+func quoteString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
@@ -4,8 +4,12 @@
 package schema_test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+
 	"akvorado/common/helpers"
 	"akvorado/common/schema"
 )
@@ -239,3 +243,404 @@ func TestCustomDictNoKeyErr(t *testing.T) {
 		t.Fatalf("New() did not error correctly\n %s", diff)
 	}
 }
+
+func TestInterfaceDescriptions(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.InterfaceDescriptions = []string{
+		`^(?P<Customer>[A-Z]+)-\d+ `,
+		`\bcid:(?P<Circuit>[^ ]+)`,
+	}
+	s, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got := map[string]string{}
+	for _, column := range s.Columns() {
+		if strings.HasSuffix(column.Name, "Customer") || strings.HasSuffix(column.Name, "Circuit") {
+			if column.ClickHouseType != "LowCardinality(String)" {
+				t.Errorf("%s should be LowCardinality(String), is %s", column.Name, column.ClickHouseType)
+			}
+			got[column.Name] = column.ClickHouseGenerateFrom
+		}
+	}
+	expected := map[string]string{
+		"InIfCustomer":  `extractGroups(InIfDescription, '^(?P<Customer>[A-Z]+)-\\d+ ')[1]`,
+		"OutIfCustomer": `extractGroups(OutIfDescription, '^(?P<Customer>[A-Z]+)-\\d+ ')[1]`,
+		"InIfCircuit":   `extractGroups(InIfDescription, '\\bcid:(?P<Circuit>[^ ]+)')[1]`,
+		"OutIfCircuit":  `extractGroups(OutIfDescription, '\\bcid:(?P<Circuit>[^ ]+)')[1]`,
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("New() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestInterfaceDescriptionsErrors(t *testing.T) {
+	cases := []struct {
+		Description string
+		Patterns    []string
+		Disabled    []schema.ColumnKey
+	}{
+		{"invalid regular expression", []string{`(?P<Customer>`}, nil},
+		{"no named capture", []string{`^([A-Z]+)`}, nil},
+		{"existing column", []string{`^(?P<Name>[A-Z]+)`}, nil},
+		{"duplicate capture", []string{`^(?P<Customer>[A-Z]+)`, `(?P<Customer>\d+)$`}, nil},
+		{"disabled description", []string{`^(?P<Customer>[A-Z]+)`},
+			[]schema.ColumnKey{schema.ColumnInIfDescription, schema.ColumnOutIfDescription}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			config := schema.DefaultConfiguration()
+			config.InterfaceDescriptions = tc.Patterns
+			config.Disabled = tc.Disabled
+			if _, err := schema.New(config); err == nil {
+				t.Fatal("New() did not error")
+			}
+		})
+	}
+}
+
+func TestCustomDimensions(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.CustomDimensions = []schema.CustomDimension{
+		{Name: "CustomerID", Type: "String", Expression: `"acme"`},
+		{Name: "TrafficClass", Type: "UInt8", Expression: `1`},
+	}
+	s, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got := map[string]string{}
+	for _, name := range []string{"CustomerID", "TrafficClass"} {
+		column, ok := s.LookupColumnByName(name)
+		if !ok {
+			t.Fatalf("LookupColumnByName(%q) not found", name)
+		}
+		if column.ProtobufIndex <= 0 {
+			t.Errorf("%s should be in the protobuf schema", name)
+		}
+		got[name] = fmt.Sprintf("%s %s %s", column.ClickHouseType, column.ProtobufType, column.ParserType)
+	}
+	expected := map[string]string{
+		"CustomerID":   "LowCardinality(String) string string",
+		"TrafficClass": "UInt8 uint32 uint",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("New() (-got, +want):\n%s", diff)
+	}
+
+	config.CustomDimensions = []schema.CustomDimension{
+		{Name: "SrcAS", Type: "UInt32", Expression: `Flow.SrcAS`},
+	}
+	if _, err := schema.New(config); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestCustomDimensionsConfigurationDecode(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "default type",
+			Initial:     func() interface{} { return schema.DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"custom-dimensions": []gin.H{
+						{"name": "CustomerID", "expression": `"acme"`},
+						{"name": "TrafficClass", "type": "UInt8", "expression": `1`},
+					},
+				}
+			},
+			Expected: schema.Configuration{
+				CustomDimensions: []schema.CustomDimension{
+					{Name: "CustomerID", Type: "String", Expression: `"acme"`},
+					{Name: "TrafficClass", Type: "UInt8", Expression: `1`},
+				},
+			},
+		},
+	})
+}
+
+func TestClickHouseCodecsAndLowCardinality(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.Codecs = map[schema.ColumnKey]string{
+		schema.ColumnSrcAddr:      "ZSTD(3)",
+		schema.ColumnTimeReceived: "Delta(4),ZSTD(1)",
+	}
+	config.LowCardinality = []schema.ColumnKey{schema.ColumnSrcCountry, schema.ColumnExporterName}
+	s, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got := map[string]string{}
+	for _, key := range []schema.ColumnKey{
+		schema.ColumnSrcAddr,
+		schema.ColumnTimeReceived,
+		schema.ColumnSrcCountry,
+		schema.ColumnExporterName,
+	} {
+		column, _ := s.LookupColumnByKey(key)
+		got[column.Name] = column.ClickHouseDefinition()
+	}
+	expected := map[string]string{
+		"SrcAddr":      "`SrcAddr` IPv6 CODEC(ZSTD(3))",
+		"TimeReceived": "`TimeReceived` DateTime CODEC(Delta(4), ZSTD(1))",
+		"SrcCountry":   "`SrcCountry` LowCardinality(FixedString(2))",
+		"ExporterName": "`ExporterName` LowCardinality(String)",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("New() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestClickHouseCodecsAndLowCardinalityErrors(t *testing.T) {
+	cases := []struct {
+		Description    string
+		Codecs         map[schema.ColumnKey]string
+		LowCardinality []schema.ColumnKey
+	}{
+		{"unknown codec", map[schema.ColumnKey]string{schema.ColumnSrcAddr: "Brotli"}, nil},
+		{"missing codec parameter", map[schema.ColumnKey]string{schema.ColumnBytes: "Delta, LZ4"}, nil},
+		{"codec on alias", map[schema.ColumnKey]string{schema.ColumnSrcNetPrefix: "ZSTD(1)"}, nil},
+		{"LowCardinality on integer", nil, []schema.ColumnKey{schema.ColumnBytes}},
+		{"LowCardinality on array", nil, []schema.ColumnKey{schema.ColumnDstASPath}},
+		{"LowCardinality on alias", nil, []schema.ColumnKey{schema.ColumnSrcNetPrefix}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			config := schema.DefaultConfiguration()
+			config.Codecs = tc.Codecs
+			config.LowCardinality = tc.LowCardinality
+			if _, err := schema.New(config); err == nil {
+				t.Fatal("New() did not error")
+			}
+		})
+	}
+}
+
+func TestClickHouseCodecsConfigurationDecode(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "codecs and LowCardinality",
+			Initial:     func() interface{} { return schema.DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"codecs": gin.H{
+						"SrcAddr": "ZSTD(3)",
+					},
+					"low-cardinality": []string{"SrcCountry"},
+				}
+			},
+			Expected: schema.Configuration{
+				Codecs:         map[schema.ColumnKey]string{schema.ColumnSrcAddr: "ZSTD(3)"},
+				LowCardinality: []schema.ColumnKey{schema.ColumnSrcCountry},
+			},
+		},
+	})
+}
+
+func TestMissingValues(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.MainTableOnly = []schema.ColumnKey{schema.ColumnSrcCountry}
+	config.LowCardinality = []schema.ColumnKey{schema.ColumnSrcCountry}
+	config.MissingValues = map[schema.ColumnKey]schema.MissingValue{
+		schema.ColumnSrcCountry:       {Nullable: true},
+		schema.ColumnInIfSpeed:        {Nullable: true},
+		schema.ColumnExporterName:     {Default: "unknown"},
+		schema.ColumnInIfConnectivity: {Default: "it's unknown"},
+		schema.ColumnSrcAS:            {Default: "4294967295"},
+	}
+	s, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got := map[string][]string{}
+	for _, key := range []schema.ColumnKey{
+		schema.ColumnSrcCountry,
+		schema.ColumnDstCountry,
+		schema.ColumnInIfSpeed,
+		schema.ColumnOutIfSpeed,
+		schema.ColumnExporterName,
+		schema.ColumnSrcAS,
+	} {
+		column, _ := s.LookupColumnByKey(key)
+		got[column.Name] = []string{column.ClickHouseDefinition(), column.ClickHouseNotNullableType()}
+	}
+	expected := map[string][]string{
+		"SrcCountry":   {"`SrcCountry` LowCardinality(Nullable(FixedString(2)))", "LowCardinality(FixedString(2))"},
+		"DstCountry":   {"`DstCountry` FixedString(2)", "FixedString(2)"},
+		"InIfSpeed":    {"`InIfSpeed` Nullable(UInt32)", "UInt32"},
+		"OutIfSpeed":   {"`OutIfSpeed` UInt32", "UInt32"},
+		"ExporterName": {"`ExporterName` LowCardinality(String)", "LowCardinality(String)"},
+		"SrcAS":        {"`SrcAS` UInt32", "UInt32"},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("New() (-got, +want):\n%s", diff)
+	}
+
+	selected := map[string]bool{}
+	for _, column := range s.ClickHouseSelectColumns(schema.ClickHouseSubstituteMissingValues) {
+		selected[column] = true
+	}
+	for _, column := range []string{
+		"if(empty(SrcCountry), NULL, SrcCountry) AS SrcCountry",
+		"DstCountry",
+		"if(InIfSpeed = 0, NULL, InIfSpeed) AS InIfSpeed",
+		"if(empty(ExporterName), 'unknown', ExporterName) AS ExporterName",
+		`if(empty(InIfConnectivity), 'it\'s unknown', InIfConnectivity) AS InIfConnectivity`,
+		"OutIfConnectivity",
+		"if(SrcAS = 0, 4294967295, SrcAS) AS SrcAS",
+		"ExporterRole",
+	} {
+		if !selected[column] {
+			t.Errorf("ClickHouseSelectColumns() does not contain %q", column)
+		}
+	}
+	if !strings.Contains(s.ClickHouseCreateTable(schema.ClickHouseNotNullable),
+		"`InIfSpeed` UInt32") {
+		t.Error("ClickHouseCreateTable(ClickHouseNotNullable) should not use Nullable")
+	}
+}
+
+func TestMissingValuesErrors(t *testing.T) {
+	cases := []struct {
+		Description   string
+		MissingValues map[schema.ColumnKey]schema.MissingValue
+	}{
+		{"not enriched", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcPort: {Nullable: true}}},
+		{"alias", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcNetPrefix: {Default: "unknown"}}},
+		{"array", map[schema.ColumnKey]schema.MissingValue{schema.ColumnDstASPath: {Nullable: true}}},
+		{"nullable primary key", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcAS: {Nullable: true}}},
+		{"nullable sorting key", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcCountry: {Nullable: true}}},
+		{"invalid integer", map[schema.ColumnKey]schema.MissingValue{schema.ColumnInIfSpeed: {Default: "unknown"}}},
+		{"integer overflow", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcNetMask: {Default: "256"}}},
+		{"too long", map[schema.ColumnKey]schema.MissingValue{schema.ColumnSrcCountry: {Default: "unknown"}}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			config := schema.DefaultConfiguration()
+			config.MissingValues = tc.MissingValues
+			if _, err := schema.New(config); err == nil {
+				t.Fatal("New() did not error")
+			}
+		})
+	}
+}
+
+func TestMissingValuesConfigurationDecode(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "nullable and default",
+			Initial:     func() interface{} { return schema.DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"missing-values": gin.H{
+						"InIfSpeed":  gin.H{"nullable": true},
+						"SrcCountry": gin.H{"default": "XX"},
+					},
+				}
+			},
+			Expected: schema.Configuration{
+				MissingValues: map[schema.ColumnKey]schema.MissingValue{
+					schema.ColumnInIfSpeed:  {Nullable: true},
+					schema.ColumnSrcCountry: {Default: "XX"},
+				},
+			},
+		}, {
+			Description: "nullable with default",
+			Initial:     func() interface{} { return schema.DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"missing-values": gin.H{
+						"InIfSpeed": gin.H{"nullable": true, "default": "0"},
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "neither nullable nor default",
+			Initial:     func() interface{} { return schema.DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"missing-values": gin.H{
+						"InIfSpeed": gin.H{},
+					},
+				}
+			},
+			Error: true,
+		},
+	})
+}
+
+func TestPrivacy(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.Privacy = true
+	c, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if !c.Privacy() {
+		t.Error("Privacy() should be true")
+	}
+	for _, key := range []schema.ColumnKey{
+		schema.ColumnSrcAddr, schema.ColumnDstAddr,
+		schema.ColumnSrcNetPrefix, schema.ColumnDstNetPrefix,
+		schema.ColumnSrcNetName, schema.ColumnDstNetName,
+		schema.ColumnSrcPort, schema.ColumnDstPort,
+		schema.ColumnNextHop,
+	} {
+		if column, _ := c.LookupColumnByKey(key); !column.Disabled {
+			t.Errorf("%s is not disabled", key)
+		}
+	}
+	for _, key := range []schema.ColumnKey{
+		schema.ColumnExporterAddress,
+		schema.ColumnSrcAS, schema.ColumnDstAS,
+		schema.ColumnSrcCountry, schema.ColumnDstCountry,
+		schema.ColumnSrcPortBucket, schema.ColumnDstPortBucket,
+	} {
+		if column, _ := c.LookupColumnByKey(key); column.Disabled {
+			t.Errorf("%s is disabled", key)
+		}
+	}
+
+	config.Enabled = []schema.ColumnKey{schema.ColumnNextHop}
+	if _, err := schema.New(config); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestPortBucket(t *testing.T) {
+	cases := []struct {
+		Threshold uint16
+		Port      uint64
+		Expected  string
+	}{
+		{0, 0, "0"},
+		{0, 443, "443"},
+		{0, 1023, "1023"},
+		{0, 1024, "1024-49151"},
+		{0, 8080, "1024-49151"},
+		{0, 49152, "49152-65535"},
+		{0, 65535, "49152-65535"},
+		{32768, 443, "443"},
+		{32768, 8080, "8080"},
+		{32768, 32767, "32767"},
+		{32768, 32768, "ephemeral"},
+		{32768, 65535, "ephemeral"},
+	}
+	for _, tc := range cases {
+		config := schema.DefaultConfiguration()
+		config.EphemeralPortThreshold = tc.Threshold
+		c, err := schema.New(config)
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		if got := c.PortBucket(tc.Port); got != tc.Expected {
+			t.Errorf("PortBucket(%d) with threshold %d == %q, expected %q",
+				tc.Port, tc.Threshold, got, tc.Expected)
+		}
+	}
+}
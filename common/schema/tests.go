@@ -117,9 +117,14 @@ func (schema *Schema) ProtobufDecode(t *testing.T, input []byte) *FlowMessage {
 	return &flow
 }
 
-// EnableAllColumns enable all columns and returns itself.
+// EnableAllColumns enable all columns and returns itself. Port buckets are
+// not enabled as they only duplicate ports.
 func (schema *Component) EnableAllColumns() *Component {
 	for i := range schema.columns {
+		switch schema.columns[i].Key {
+		case ColumnSrcPortBucket, ColumnDstPortBucket:
+			continue
+		}
 		schema.columns[i].Disabled = false
 	}
 	schema.Schema = schema.finalize()
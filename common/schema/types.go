@@ -5,6 +5,7 @@ package schema
 
 import (
 	"net/netip"
+	"regexp"
 
 	"github.com/bits-and-blooms/bitset"
 	"google.golang.org/protobuf/encoding/protowire"
@@ -22,6 +23,15 @@ type Schema struct {
 	// For ClickHouse. This is the set of primary keys (order is important and
 	// may not follow column order) for the aggregated tables.
 	clickHousePrimaryKeys []ColumnKey
+
+	// references are the regular expressions matching a reference to each
+	// column in an SQL expression
+	references map[string]*regexp.Regexp
+
+	// privacy tells if IP addresses and ports should not leave the inlet
+	privacy bool
+	// ephemeralPortThreshold is the first port bucketed as ephemeral
+	ephemeralPortThreshold uint16
 }
 
 // Column represents a column of data.
@@ -55,11 +65,23 @@ type Column struct {
 	// ClickHouseMaterialized indicates that the column was materialized (and is not by default)
 	ClickHouseMaterialized bool
 
+	// For ClickHouse. `ClickHouseMissingValue' is the expression stored in
+	// place of a missing value when inserting into the main table.
+	// `ClickHouseNullable' tells the column is wrapped into Nullable (but not
+	// in the raw table).
+	ClickHouseMissingValue string
+	ClickHouseNullable     bool
+
 	// For the console. `ClickHouseTruncateIP' makes the specified column
 	// truncatable when used as a dimension.
 	ConsoleNotDimension bool
 	ConsoleTruncateIP   bool
 
+	// For documentation. `InletEnrichment' tells the value is set (or may be
+	// overridden) by the inlet during enrichment instead of being only
+	// extracted from the received flow.
+	InletEnrichment bool
+
 	// For protobuf. The index is automatically derived from the position,
 	// unless specified. Use -1 to not include the column into the protobuf
 	// schema.
@@ -113,7 +113,7 @@ func TestRoot(t *testing.T) {
 	t.Run("healthcheck", func(t *testing.T) {
 		dockerClientMock.EXPECT().Ping(gomock.Any()).Return(types.Ping{}, nil)
 		got := r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["conntrack-fixer"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["conntrack-fixer"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckOK,
 			Reason: "docker client alive",
 		}); diff != "" {
@@ -121,7 +121,7 @@ func TestRoot(t *testing.T) {
 		}
 		dockerClientMock.EXPECT().Ping(gomock.Any()).Return(types.Ping{}, errors.New("unexpected"))
 		got = r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["conntrack-fixer"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["conntrack-fixer"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckWarning,
 			Reason: "docker client unavailable",
 		}); diff != "" {
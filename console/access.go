@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/httpserver"
+	"akvorado/common/schema"
+	"akvorado/console/authentication"
+	"akvorado/console/query"
+)
+
+// RestrictedColumnsConfiguration restricts access to some columns to a set of
+// groups.
+type RestrictedColumnsConfiguration struct {
+	// Columns is the list of restricted columns.
+	Columns []string `validate:"min=1"`
+	// Groups is the list of groups allowed to access these columns.
+	Groups []string
+}
+
+// TeamFolderConfiguration describes a folder for saved filters shared with
+// the members of some groups.
+type TeamFolderConfiguration struct {
+	// Name is the name of the folder.
+	Name string `validate:"required"`
+	// Groups is the list of groups allowed to access this folder.
+	Groups []string `validate:"min=1"`
+}
+
+// teamFolders returns the names of the team folders the current user can
+// access.
+func (c *Component) teamFolders(gc *gin.Context) []string {
+	user := gc.MustGet("user").(authentication.UserInformation)
+	folders := []string{}
+	for _, folder := range c.config.TeamFolders {
+		for _, group := range user.Groups {
+			if slices.Contains(folder.Groups, group) {
+				folders = append(folders, folder.Name)
+				break
+			}
+		}
+	}
+	return folders
+}
+
+// restrictedColumns returns the names of the columns the current user
+// cannot access.
+func (c *Component) restrictedColumns(gc *gin.Context) []string {
+	if len(c.config.RestrictedColumns) == 0 {
+		return nil
+	}
+	user := gc.MustGet("user").(authentication.UserInformation)
+	return c.restrictedColumnsForGroups(user.Groups)
+}
+
+// restrictedColumnsForGroups returns the names of the columns the members of the
+// provided groups cannot access.
+func (c *Component) restrictedColumnsForGroups(groups []string) []string {
+	if len(c.config.RestrictedColumns) == 0 {
+		return nil
+	}
+	restricted := []string{}
+outer:
+	for _, rc := range c.config.RestrictedColumns {
+		for _, group := range groups {
+			if slices.Contains(rc.Groups, group) {
+				continue outer
+			}
+		}
+		for _, column := range rc.Columns {
+			if name := c.fixQueryColumnName(column); name != "" {
+				restricted = append(restricted, name)
+			}
+		}
+	}
+	return restricted
+}
+
+// columnAccess is a middleware scoping the cache to the restricted columns of
+// the current user.
+func (c *Component) columnAccess() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if restricted := c.restrictedColumns(gc); len(restricted) > 0 {
+			gc.Set(httpserver.CacheScopeKey, strings.Join(restricted, ","))
+		}
+		gc.Next()
+	}
+}
+
+// checkFilterAccess checks if the filter uses one of the restricted columns.
+func checkFilterAccess(sch *schema.Component, restricted []string, filter query.Filter) error {
+	return checkExpressionAccess(sch, restricted, filter.Direct(), filter.Reverse())
+}
+
+// checkExpressionAccess checks if one of the SQL expressions uses one of the
+// restricted columns.
+func checkExpressionAccess(sch *schema.Component, restricted []string, expressions ...string) error {
+	for _, column := range restricted {
+		for _, expression := range expressions {
+			if sch.ReferencesColumn(expression, column) {
+				return fmt.Errorf("access to column %s is restricted", column)
+			}
+		}
+	}
+	return nil
+}
+
+// applyColumnAccess modifies the input to comply with access restrictions.
+// Restricted IP columns are kept but truncated, while other restricted
+// columns are removed from the dimensions. An error is returned if the
+// filter uses a restricted column.
+func (input *graphCommonHandlerInput) applyColumnAccess(restricted []string) error {
+	if len(restricted) == 0 {
+		return nil
+	}
+	if err := checkFilterAccess(input.schema, restricted, input.Filter); err != nil {
+		return err
+	}
+	dimensions := []query.Column{}
+	for _, qc := range input.Dimensions {
+		if !slices.Contains(restricted, qc.String()) {
+			dimensions = append(dimensions, qc)
+			continue
+		}
+		if column, _ := input.schema.LookupColumnByKey(qc.Key()); column.ConsoleTruncateIP {
+			if input.TruncateAddrV4 == 0 || input.TruncateAddrV4 > 24 {
+				input.TruncateAddrV4 = 24
+			}
+			if input.TruncateAddrV6 == 0 || input.TruncateAddrV6 > 48 {
+				input.TruncateAddrV6 = 48
+			}
+			dimensions = append(dimensions, qc)
+		}
+	}
+	input.Dimensions = dimensions
+	return nil
+}
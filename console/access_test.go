@@ -0,0 +1,189 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/authentication"
+	"akvorado/console/query"
+)
+
+func TestApplyColumnAccess(t *testing.T) {
+	input := graphCommonHandlerInput{
+		schema: schema.NewMock(t),
+		Dimensions: []query.Column{
+			query.NewColumn("SrcAddr"),
+			query.NewColumn("SrcPort"),
+			query.NewColumn("ExporterName"),
+		},
+		Filter:         query.NewFilter("InIfBoundary = external"),
+		TruncateAddrV4: 16,
+	}
+	if err := query.Columns(input.Dimensions).Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	if err := input.applyColumnAccess([]string{"SrcAddr", "SrcPort"}); err != nil {
+		t.Fatalf("applyColumnAccess() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(input.Dimensions, []query.Column{
+		query.NewColumn("SrcAddr"),
+		query.NewColumn("ExporterName"),
+	}); diff != "" {
+		t.Errorf("applyColumnAccess() dimensions (-got, +want):\n%s", diff)
+	}
+	if input.TruncateAddrV4 != 16 || input.TruncateAddrV6 != 48 {
+		t.Errorf("applyColumnAccess() truncation: %d/%d, expected 16/48",
+			input.TruncateAddrV4, input.TruncateAddrV6)
+	}
+
+	input.Filter = query.NewFilter("DstAddr = 192.0.2.1")
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	// The reverse filter uses SrcAddr
+	if err := input.applyColumnAccess([]string{"SrcAddr"}); err == nil {
+		t.Fatal("applyColumnAccess() no error")
+	}
+}
+
+func TestColumnAccessHandlers(t *testing.T) {
+	config := DefaultConfiguration()
+	config.RestrictedColumns = []RestrictedColumnsConfiguration{
+		{
+			Columns: []string{"SrcAddr", "DstAddr", "SrcPort", "EType"},
+			Groups:  []string{"privacy"},
+		},
+	}
+	_, h, mockConn, _ := NewMock(t, config)
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Xps        float64  `ch:"xps"`
+			Dimensions []string `ch:"dimensions"`
+		}{
+			{1000, []string{"AS1299", "router1"}},
+		}).
+		Return(nil)
+
+	privileged := func() http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", "alfred")
+		headers.Add("Remote-Groups", "butlers, privacy")
+		return headers
+	}()
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "filter on restricted column",
+			URL:         "/api/v0/console/graph/sankey",
+			JSONInput: gin.H{
+				"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"dimensions": []string{"SrcAS", "ExporterName"},
+				"limit":      10,
+				"filter":     "SrcAddr = 192.0.2.1",
+				"units":      "l3bps",
+			},
+			StatusCode: 403,
+			JSONOutput: gin.H{"message": "Access to column SrcAddr is restricted"},
+		}, {
+			Description: "restricted column removed from dimensions",
+			URL:         "/api/v0/console/graph/sankey",
+			JSONInput: gin.H{
+				"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"dimensions": []string{"SrcAS", "SrcPort", "ExporterName"},
+				"limit":      10,
+				"units":      "l3bps",
+			},
+			JSONOutput: gin.H{
+				"rows":  [][]string{{"AS1299", "router1"}},
+				"xps":   []int{1000},
+				"nodes": []string{"SrcAS: AS1299", "ExporterName: router1"},
+				"links": []gin.H{
+					{"source": "SrcAS: AS1299", "target": "ExporterName: router1", "xps": 1000},
+				},
+			},
+		}, {
+			Description: "widget using a restricted column",
+			URL:         "/api/v0/console/widget/top/src-port",
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access to this widget is restricted."},
+		}, {
+			Description: "no completion for restricted column",
+			URL:         "/api/v0/console/filter/complete",
+			JSONInput:   gin.H{"what": "value", "column": "etype", "prefix": ""},
+			JSONOutput:  gin.H{"completions": []gin.H{}},
+		}, {
+			Description: "completion for privileged user",
+			URL:         "/api/v0/console/filter/complete",
+			Header:      privileged,
+			JSONInput:   gin.H{"what": "value", "column": "etype", "prefix": ""},
+			JSONOutput: gin.H{"completions": []gin.H{
+				{"label": "IPv4", "detail": "ethernet type", "quoted": false},
+				{"label": "IPv6", "detail": "ethernet type", "quoted": false},
+			}},
+		},
+	})
+}
+
+func TestRoleAccess(t *testing.T) {
+	authConfig := authentication.DefaultConfiguration()
+	authConfig.DefaultRole = authentication.RoleViewer
+	authConfig.Roles.Editor = []string{"neteng"}
+	_, h, _, _ := NewMockWithAuthentication(t, DefaultConfiguration(), authConfig)
+
+	user := func(groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", "alfred")
+		headers.Add("Remote-Groups", groups)
+		return headers
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list saved filters as viewer",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      user(""),
+			JSONOutput:  gin.H{"filters": []gin.H{}},
+		}, {
+			Description: "save filter as viewer",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      user(""),
+			JSONInput:   gin.H{"description": "test", "content": "InIfBoundary = external"},
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to editors."},
+		}, {
+			Description: "save filter as editor",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      user("neteng"),
+			JSONInput:   gin.H{"description": "test", "content": "InIfBoundary = external"},
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "delete scheduled report as viewer",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/scheduled-reports/1",
+			Header:      user(""),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to editors."},
+		}, {
+			Description: "query advisor as editor",
+			URL:         "/api/v0/console/admin/query-advisor",
+			Header:      user("neteng"),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to administrators."},
+		},
+	})
+}
@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/console/authentication"
+)
+
+// advisorQuery is a slow query found in the query log, along with its
+// analysis.
+type advisorQuery struct {
+	Query       string   `json:"query"`
+	Count       uint64   `json:"count"`
+	AvgDuration float64  `json:"avg-duration"`
+	MaxDuration float64  `json:"max-duration"`
+	ReadRows    uint64   `json:"read-rows"`
+	Columns     []string `json:"columns"`
+	// From EXPLAIN
+	SelectedGranules uint64 `json:"selected-granules"`
+	TotalGranules    uint64 `json:"total-granules"`
+	Error            string `json:"error,omitempty"`
+}
+
+// advisorSuggestion is a suggestion to improve performance of slow queries.
+type advisorSuggestion struct {
+	Kind    string `json:"kind"`
+	Column  string `json:"column"`
+	Queries uint64 `json:"queries"`
+	Advice  string `json:"advice"`
+}
+
+var (
+	advisorWhereRegexp = regexp.MustCompile(
+		`(?is)\bWHERE\b(.*?)(?:\bGROUP\s+BY\b|\bORDER\s+BY\b|\bLIMIT\b|\bSETTINGS\b|\bUNION\b|$)`)
+	advisorGranulesRegexp = regexp.MustCompile(`^Granules:\s*(\d+)/(\d+)$`)
+)
+
+// adminAccess is a middleware restricting access to the administrative
+// endpoints to users with the admin role. When configured, they also need
+// to belong to one of the administrative groups.
+func (c *Component) adminAccess() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		user := gc.MustGet("user").(authentication.UserInformation)
+		if user.Role < authentication.RoleAdmin {
+			gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Access restricted to administrators."})
+			return
+		}
+		if len(c.config.AdminGroups) == 0 {
+			gc.Next()
+			return
+		}
+		for _, group := range user.Groups {
+			if slices.Contains(c.config.AdminGroups, group) {
+				gc.Next()
+				return
+			}
+		}
+		gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Access restricted to administrators."})
+	}
+}
+
+// filteredColumns returns the columns used in the WHERE clauses of the
+// provided query.
+func (c *Component) filteredColumns(query string) []string {
+	columns := []string{}
+	clauses := advisorWhereRegexp.FindAllStringSubmatch(query, -1)
+	for _, column := range c.d.Schema.Columns() {
+		if column.Disabled {
+			continue
+		}
+		for _, clause := range clauses {
+			if c.d.Schema.ReferencesColumn(clause[1], column.Name) {
+				columns = append(columns, column.Name)
+				break
+			}
+		}
+	}
+	return columns
+}
+
+// parseExplainIndexes returns the number of selected granules and the total
+// number of granules for the primary key from the output of `EXPLAIN indexes
+// = 1'.
+func parseExplainIndexes(lines []string) (uint64, uint64) {
+	var selected, total uint64
+	section := ""
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch line {
+		case "MinMax", "Partition", "PrimaryKey", "Skip":
+			section = line
+			continue
+		}
+		if section != "PrimaryKey" {
+			continue
+		}
+		if matches := advisorGranulesRegexp.FindStringSubmatch(line); matches != nil {
+			s, _ := strconv.ParseUint(matches[1], 10, 64)
+			t, _ := strconv.ParseUint(matches[2], 10, 64)
+			selected += s
+			total += t
+			section = ""
+		}
+	}
+	return selected, total
+}
+
+// suggestIndexes returns suggestions from the analyzed slow queries. Alias
+// columns used in filters should be materialized. Other columns outside of
+// the primary key used by queries reading most granules are candidates for
+// the sorting key (when used by most of these queries) or for a skipping
+// index.
+func (c *Component) suggestIndexes(queries []advisorQuery) []advisorSuggestion {
+	primaryKeys := c.d.Schema.ClickHousePrimaryKeys()
+	materialize := map[string]uint64{}
+	candidates := map[string]uint64{}
+	inefficient := uint64(0)
+	for _, query := range queries {
+		if query.Error != "" {
+			continue
+		}
+		isInefficient := query.TotalGranules > 0 && query.SelectedGranules*2 > query.TotalGranules
+		if isInefficient {
+			inefficient += query.Count
+		}
+		for _, name := range query.Columns {
+			if slices.Contains(primaryKeys, name) {
+				continue
+			}
+			column, ok := c.d.Schema.LookupColumnByName(name)
+			if !ok {
+				continue
+			}
+			if column.ClickHouseAlias != "" && !column.ClickHouseMaterialized {
+				materialize[name] += query.Count
+				continue
+			}
+			if isInefficient {
+				candidates[name] += query.Count
+			}
+		}
+	}
+
+	suggestions := []advisorSuggestion{}
+	for name, count := range materialize {
+		suggestions = append(suggestions, advisorSuggestion{
+			Kind:    "materialize",
+			Column:  name,
+			Queries: count,
+			Advice: fmt.Sprintf("%s is computed at query time. Add it to schema → materialize "+
+				"in the orchestrator configuration.", name),
+		})
+	}
+	for name, count := range candidates {
+		if count*2 > inefficient {
+			suggestions = append(suggestions, advisorSuggestion{
+				Kind:    "order-by",
+				Column:  name,
+				Queries: count,
+				Advice: fmt.Sprintf("%s is used by most slow queries. Consider adding it to the "+
+					"sorting key of the flows tables.", name),
+			})
+			continue
+		}
+		suggestions = append(suggestions, advisorSuggestion{
+			Kind:    "skip-index",
+			Column:  name,
+			Queries: count,
+			Advice: fmt.Sprintf("ALTER TABLE flows ADD INDEX %s_idx %s TYPE bloom_filter(0.01) GRANULARITY 4",
+				name, name),
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Queries != suggestions[j].Queries {
+			return suggestions[i].Queries > suggestions[j].Queries
+		}
+		return suggestions[i].Column < suggestions[j].Column
+	})
+	return suggestions
+}
+
+func (c *Component) queryAdvisorHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	since, err := time.ParseDuration(gc.DefaultQuery("since", "24h"))
+	if err != nil || since <= 0 {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid since parameter."})
+		return
+	}
+	threshold, err := time.ParseDuration(gc.DefaultQuery("threshold", "1s"))
+	if err != nil || threshold < 0 {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid threshold parameter."})
+		return
+	}
+	limit, err := strconv.Atoi(gc.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid limit parameter."})
+		return
+	}
+
+	// Fetch slow queries from the query log
+	var results []struct {
+		Query       string  `ch:"query"`
+		Count       uint64  `ch:"count"`
+		AvgDuration float64 `ch:"avg_duration"`
+		MaxDuration float64 `ch:"max_duration"`
+		ReadRows    uint64  `ch:"read_rows"`
+	}
+	if err := c.d.ClickHouseDB.Select(ctx, &results, `
+SELECT
+ any(query) AS query,
+ count() AS count,
+ avg(query_duration_ms)/1000 AS avg_duration,
+ max(query_duration_ms)/1000 AS max_duration,
+ toUInt64(avg(read_rows)) AS read_rows
+FROM system.query_log
+WHERE type = 'QueryFinish'
+AND query_kind = 'Select'
+AND event_time > now() - toIntervalSecond($1)
+AND query_duration_ms >= $2
+AND arrayExists(t -> startsWith(t, concat(currentDatabase(), '.flows')), tables)
+AND NOT startsWith(query, 'EXPLAIN')
+GROUP BY normalized_query_hash
+ORDER BY count * avg_duration DESC
+LIMIT $3`, uint64(since.Seconds()), uint64(threshold.Milliseconds()), limit); err != nil {
+		c.r.Err(err).Msg("unable to query slow query log")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query slow query log."})
+		return
+	}
+
+	// Analyze them
+	queries := make([]advisorQuery, 0, len(results))
+	for _, result := range results {
+		query := advisorQuery{
+			Query:       result.Query,
+			Count:       result.Count,
+			AvgDuration: result.AvgDuration,
+			MaxDuration: result.MaxDuration,
+			ReadRows:    result.ReadRows,
+			Columns:     c.filteredColumns(result.Query),
+		}
+		var explain []struct {
+			Explain string `ch:"explain"`
+		}
+		if err := c.d.ClickHouseDB.Select(ctx, &explain,
+			fmt.Sprintf("EXPLAIN indexes = 1 %s", result.Query)); err != nil {
+			query.Error = err.Error()
+		} else {
+			lines := make([]string, len(explain))
+			for idx := range explain {
+				lines[idx] = explain[idx].Explain
+			}
+			query.SelectedGranules, query.TotalGranules = parseExplainIndexes(lines)
+		}
+		queries = append(queries, query)
+	}
+
+	gc.JSON(http.StatusOK, gin.H{
+		"queries":     queries,
+		"suggestions": c.suggestIndexes(queries),
+	})
+}
@@ -0,0 +1,194 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestParseExplainIndexes(t *testing.T) {
+	lines := []string{
+		"Expression ((Projection + Before ORDER BY))",
+		"  Aggregating",
+		"    Expression (Before GROUP BY)",
+		"      Filter (WHERE)",
+		"        ReadFromMergeTree (default.flows)",
+		"        Indexes:",
+		"          MinMax",
+		"            Keys:",
+		"              TimeReceived",
+		"            Granules: 120/150",
+		"          Partition",
+		"            Keys:",
+		"              toYYYYMMDDhhmmss(toStartOfInterval(TimeReceived, toIntervalSecond(25920)))",
+		"            Granules: 120/120",
+		"          PrimaryKey",
+		"            Keys:",
+		"              TimeReceived",
+		"            Condition: (TimeReceived in [1681221600, +Inf))",
+		"            Parts: 8/8",
+		"            Granules: 90/120",
+	}
+	selected, total := parseExplainIndexes(lines)
+	if selected != 90 || total != 120 {
+		t.Fatalf("parseExplainIndexes() == %d/%d, expected 90/120", selected, total)
+	}
+}
+
+func TestFilteredColumns(t *testing.T) {
+	c, _, _, _ := NewMock(t, DefaultConfiguration())
+	got := c.filteredColumns(`
+SELECT SrcAS, SUM(Bytes)
+FROM flows
+WHERE TimeReceived > now() - 3600 AND DstPort = 443 AND SrcCountry IN (SELECT 'FR')
+GROUP BY SrcAS
+ORDER BY DstAS`)
+	expected := []string{"TimeReceived", "SrcCountry", "DstPort"}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("filteredColumns() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestQueryAdvisor(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	query1 := "SELECT SrcAS FROM flows WHERE TimeReceived > now() - 3600 AND DstPort = 443 AND PacketSize > 1000 GROUP BY SrcAS"
+	query2 := "SELECT DstAS FROM flows WHERE SrcAS = 65000 AND SrcCountry = 'FR'"
+	query3 := "SELECT DstAS FROM flows WHERE DstPort = 80"
+	explain := func(selected string) []struct {
+		Explain string `ch:"explain"`
+	} {
+		return []struct {
+			Explain string `ch:"explain"`
+		}{
+			{"ReadFromMergeTree (default.flows)"},
+			{"Indexes:"},
+			{"  PrimaryKey"},
+			{"    Keys:"},
+			{"      TimeReceived"},
+			{"    Granules: " + selected + "/100"},
+		}
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), "EXPLAIN indexes = 1 "+query1).
+		SetArg(1, explain("90")).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), "EXPLAIN indexes = 1 "+query2).
+		SetArg(1, explain("80")).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), "EXPLAIN indexes = 1 "+query3).
+		Return(errors.New("unknown table"))
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any(), uint64(86400), uint64(1000), 20).
+		SetArg(1, []struct {
+			Query       string  `ch:"query"`
+			Count       uint64  `ch:"count"`
+			AvgDuration float64 `ch:"avg_duration"`
+			MaxDuration float64 `ch:"max_duration"`
+			ReadRows    uint64  `ch:"read_rows"`
+		}{
+			{query1, 10, 2.5, 4, 1_000_000},
+			{query2, 5, 1.5, 2, 500_000},
+			{query3, 2, 1, 1, 100_000},
+		}).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "invalid since",
+			URL:         "/api/v0/console/admin/query-advisor?since=yesterday",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Invalid since parameter."},
+		}, {
+			Description: "invalid limit",
+			URL:         "/api/v0/console/admin/query-advisor?limit=1000",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Invalid limit parameter."},
+		}, {
+			Description: "advisor",
+			URL:         "/api/v0/console/admin/query-advisor",
+			JSONOutput: gin.H{
+				"queries": []gin.H{
+					{
+						"query":             query1,
+						"count":             10,
+						"avg-duration":      2.5,
+						"max-duration":      4,
+						"read-rows":         1e6,
+						"columns":           []string{"TimeReceived", "DstPort", "PacketSize"},
+						"selected-granules": 90,
+						"total-granules":    100,
+					}, {
+						"query":             query2,
+						"count":             5,
+						"avg-duration":      1.5,
+						"max-duration":      2,
+						"read-rows":         500_000,
+						"columns":           []string{"SrcAS", "SrcCountry"},
+						"selected-granules": 80,
+						"total-granules":    100,
+					}, {
+						"query":             query3,
+						"count":             2,
+						"avg-duration":      1,
+						"max-duration":      1,
+						"read-rows":         100_000,
+						"columns":           []string{"DstPort"},
+						"selected-granules": 0,
+						"total-granules":    0,
+						"error":             "unknown table",
+					},
+				},
+				"suggestions": []gin.H{
+					{
+						"kind":    "order-by",
+						"column":  "DstPort",
+						"queries": 10,
+						"advice":  "DstPort is used by most slow queries. Consider adding it to the sorting key of the flows tables.",
+					}, {
+						"kind":    "materialize",
+						"column":  "PacketSize",
+						"queries": 10,
+						"advice":  "PacketSize is computed at query time. Add it to schema → materialize in the orchestrator configuration.",
+					}, {
+						"kind":    "skip-index",
+						"column":  "SrcCountry",
+						"queries": 5,
+						"advice":  "ALTER TABLE flows ADD INDEX SrcCountry_idx SrcCountry TYPE bloom_filter(0.01) GRANULARITY 4",
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestQueryAdvisorRestricted(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AdminGroups = []string{"admins"}
+	_, h, _, _ := NewMock(t, config)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "not an administrator",
+			URL:         "/api/v0/console/admin/query-advisor",
+			Header: func() http.Header {
+				headers := make(http.Header)
+				headers.Add("Remote-User", "alfred")
+				headers.Add("Remote-Groups", "butlers")
+				return headers
+			}(),
+			StatusCode: 403,
+			JSONOutput: gin.H{"message": "Access restricted to administrators."},
+		},
+	})
+}
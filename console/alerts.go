@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+	"akvorado/console/notifier"
+	"akvorado/console/query"
+)
+
+// firingAlert is a value exceeding the threshold of an alert rule.
+type firingAlert struct {
+	since time.Time
+}
+
+// validateAlertRule checks the filter, the dimension and the notifier of an
+// alert rule. The dimension, the kind, the format and the baseline are
+// normalized. It returns an HTTP status code with the error.
+func (c *Component) validateAlertRule(gc *gin.Context, rule *database.AlertRule) (int, error) {
+	if rule.Kind == "" {
+		rule.Kind = "threshold"
+	}
+	if rule.Notifier != "" {
+		if _, ok := c.notifiers[rule.Notifier]; !ok {
+			return http.StatusBadRequest, fmt.Errorf("unknown notifier %s", rule.Notifier)
+		}
+		rule.Channel = ""
+		rule.Format = ""
+	} else if rule.Format == "" {
+		rule.Format = "webhook"
+	}
+	switch {
+	case rule.Kind == "threshold":
+		rule.Baseline = 0
+	case rule.Baseline == 0:
+		rule.Baseline = 86400
+	}
+	restricted := c.restrictedColumns(gc)
+	qf := query.NewFilter(rule.Filter)
+	if err := qf.Validate(c.d.Schema); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err := checkFilterAccess(c.d.Schema, restricted, qf); err != nil {
+		return http.StatusForbidden, err
+	}
+	if rule.Dimension != "" {
+		qc := query.NewColumn(rule.Dimension)
+		if err := qc.Validate(c.d.Schema); err != nil {
+			return http.StatusBadRequest, err
+		}
+		rule.Dimension = qc.String()
+		if slices.Contains(restricted, rule.Dimension) {
+			return http.StatusForbidden, fmt.Errorf("access to column %s is restricted", rule.Dimension)
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func (c *Component) alertRuleListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	params, ok := bindListParameters(gc)
+	if !ok {
+		return
+	}
+	rules, next, err := c.d.Database.ListAlertRules(ctx, params.page())
+	if err != nil {
+		c.listError(gc, err, "alert rules")
+		return
+	}
+	listResponse(gc, params, "rules", rules, next)
+}
+
+func (c *Component) alertRuleAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var rule database.AlertRule
+	if err := gc.ShouldBindJSON(&rule); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if status, err := c.validateAlertRule(gc, &rule); err != nil {
+		gc.JSON(status, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	rule.User = user
+	id, err := c.d.Database.CreateAlertRule(ctx, rule)
+	if err != nil {
+		c.r.Err(err).Msg("cannot create alert rule")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new alert rule"})
+		return
+	}
+	gc.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (c *Component) alertRuleUpdateHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	var rule database.AlertRule
+	if err := gc.ShouldBindJSON(&rule); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if status, err := c.validateAlertRule(gc, &rule); err != nil {
+		gc.JSON(status, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	rule.ID = id
+	rule.User = user
+	if err := c.d.Database.UpdateAlertRule(ctx, rule); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "alert rule not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) alertRuleDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteAlertRule(ctx, database.AlertRule{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "alert rule not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+// alertRuleSQL builds the SQL query returning the values of the dimension of
+// an alert rule exceeding its threshold. For anomaly rules, the query also
+// returns the average traffic over the baseline period.
+func (c *Component) alertRuleSQL(rule database.AlertRule, now time.Time) (string, error) {
+	qf := query.NewFilter(rule.Filter)
+	if err := qf.Validate(c.d.Schema); err != nil {
+		return "", err
+	}
+	value := "''"
+	qcs := []query.Column{}
+	if rule.Dimension != "" {
+		qc := query.NewColumn(rule.Dimension)
+		if err := qc.Validate(c.d.Schema); err != nil {
+			return "", err
+		}
+		value = qc.ToSQLSelect(c.d.Schema)
+		qcs = append(qcs, qc)
+	}
+	start := now.Add(-time.Duration(rule.Duration) * time.Second)
+	average := func(start, end time.Time) string {
+		return fmt.Sprintf(`
+{{ with %s }}
+ SELECT
+  %s AS value,
+  {{ .Units }}/{{ .Interval }} AS xps
+ FROM (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1)
+ WHERE %s
+ GROUP BY value
+{{ end }}`,
+			templateContext(inputContext{
+				Start:             start,
+				End:               end,
+				MainTableRequired: requireMainTable(c.d.Schema, qcs, qf),
+				Points:            1,
+				Units:             rule.Units,
+			}),
+			value, templateWhere(qf))
+	}
+	var sqlQuery string
+	if rule.Kind == "anomaly" {
+		sqlQuery = fmt.Sprintf(`
+WITH
+ current AS (%s),
+ baseline AS (%s)
+SELECT
+ current.value AS value,
+ current.xps AS xps,
+ baseline.xps AS baseline
+FROM current
+INNER JOIN baseline ON current.value = baseline.value
+WHERE current.xps > baseline.xps * %d / 100
+ORDER BY xps DESC
+LIMIT %d`,
+			average(start, now),
+			average(start.Add(-time.Duration(rule.Baseline)*time.Second), start),
+			100+rule.Threshold, c.config.DimensionsLimit)
+	} else {
+		sqlQuery = fmt.Sprintf(`
+WITH
+ current AS (%s)
+SELECT
+ value,
+ xps,
+ 0 AS baseline
+FROM current
+WHERE xps > %d
+ORDER BY xps DESC
+LIMIT %d`,
+			average(start, now), rule.Threshold, c.config.DimensionsLimit)
+	}
+	return strings.TrimSpace(sqlQuery), nil
+}
+
+// checkAlertRules checks all the enabled alert rules and notify their channel
+// when a value starts or stops exceeding the threshold.
+func (c *Component) checkAlertRules(ctx stdcontext.Context) {
+	rules, _, err := c.d.Database.ListAlertRules(ctx, database.Page{})
+	if err != nil {
+		c.r.Err(err).Msg("unable to list alert rules")
+		c.metrics.alertErrors.WithLabelValues("database").Inc()
+		return
+	}
+	now := c.d.Clock.Now()
+	enabled := map[uint64]bool{}
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		enabled[rule.ID] = true
+		sqlQuery, err := c.alertRuleSQL(rule, now)
+		if err != nil {
+			c.r.Err(err).Uint64("rule", rule.ID).Msg("invalid alert rule")
+			c.metrics.alertErrors.WithLabelValues("query").Inc()
+			continue
+		}
+		sqlQuery = c.finalizeQuery(sqlQuery)
+		results := []struct {
+			Value    string  `ch:"value"`
+			Xps      float64 `ch:"xps"`
+			Baseline float64 `ch:"baseline"`
+		}{}
+		if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+			c.r.Err(err).Uint64("rule", rule.ID).Str("query", sqlQuery).Msg("unable to query database")
+			c.metrics.alertErrors.WithLabelValues("query").Inc()
+			continue
+		}
+
+		notifications := []notifier.Notification{}
+		firing := map[string]firingAlert{}
+		previous := c.alertsFiring[rule.ID]
+		for _, result := range results {
+			notification := notifier.Notification{
+				Status:   "firing",
+				Value:    result.Value,
+				Xps:      uint64(result.Xps),
+				Baseline: uint64(result.Baseline),
+				Time:     now,
+				StartsAt: now,
+			}
+			if alert, ok := previous[result.Value]; ok {
+				notification.StartsAt = alert.since
+				notification.Renewed = true
+			}
+			firing[result.Value] = firingAlert{since: notification.StartsAt}
+			notifications = append(notifications, notification)
+		}
+		resolved := []string{}
+		for value := range previous {
+			if _, ok := firing[value]; !ok {
+				resolved = append(resolved, value)
+			}
+		}
+		slices.Sort(resolved)
+		for _, value := range resolved {
+			notifications = append(notifications, notifier.Notification{
+				Status:   "resolved",
+				Value:    value,
+				Time:     now,
+				StartsAt: previous[value].since,
+			})
+		}
+		c.notifyAlerts(ctx, rule, notifications)
+		c.alertsFiring[rule.ID] = firing
+	}
+
+	// Forget about deleted or disabled rules
+	for id := range c.alertsFiring {
+		if !enabled[id] {
+			delete(c.alertsFiring, id)
+		}
+	}
+}
+
+// notifyAlerts sends the notifications for the provided alert rule to its
+// notifier. When the rule does not use a configured notifier, its channel is
+// used with the format of the rule.
+func (c *Component) notifyAlerts(ctx stdcontext.Context, rule database.AlertRule, notifications []notifier.Notification) {
+	for idx := range notifications {
+		notifications[idx].Rule = rule.ID
+		notifications[idx].Description = rule.Description
+		notifications[idx].Dimension = rule.Dimension
+		notifications[idx].Units = rule.Units
+		notifications[idx].Threshold = rule.Threshold
+	}
+	if len(notifications) == 0 {
+		return
+	}
+
+	var channel *notifier.Channel
+	if rule.Notifier != "" {
+		channel = c.notifiers[rule.Notifier]
+		if channel == nil {
+			c.r.Error().Uint64("rule", rule.ID).Str("notifier", rule.Notifier).Msg("unknown notifier")
+			c.metrics.alertErrors.WithLabelValues("notification").Inc()
+			return
+		}
+	} else {
+		var err error
+		channel, err = ruleChannel(rule)
+		if err != nil {
+			c.r.Err(err).Uint64("rule", rule.ID).Msg("invalid alert rule channel")
+			c.metrics.alertErrors.WithLabelValues("notification").Inc()
+			return
+		}
+	}
+	sent, err := channel.Notify(ctx, notifications)
+	if errors.Is(err, notifier.ErrRateLimited) {
+		dropped := len(notifications) - len(sent)
+		c.r.Warn().Uint64("rule", rule.ID).Str("notifier", channel.Name).Int("dropped", dropped).
+			Msg("notifier rate limit exceeded, notifications dropped")
+		c.metrics.alertDropped.WithLabelValues(channel.Name).Add(float64(dropped))
+	} else if err != nil {
+		c.r.Err(err).Uint64("rule", rule.ID).Msg("cannot send alert notification")
+		c.metrics.alertErrors.WithLabelValues("notification").Inc()
+		return
+	}
+	for _, notification := range sent {
+		if !notification.Renewed {
+			c.metrics.alertNotifications.WithLabelValues(notification.Status).Inc()
+		}
+	}
+}
+
+// ruleChannel returns a channel for an alert rule sending notifications to
+// the channel of the rule, using its format.
+func ruleChannel(rule database.AlertRule) (*notifier.Channel, error) {
+	var config notifier.Configuration
+	switch rule.Format {
+	case "alertmanager":
+		config = notifier.AlertmanagerConfiguration{URL: rule.Channel}
+	case "slack":
+		slack := notifier.DefaultSlackConfiguration().(notifier.SlackConfiguration)
+		slack.URL = rule.Channel
+		config = slack
+	default:
+		config = notifier.WebhookConfiguration{URL: rule.Channel}
+	}
+	return notifier.NewChannel(notifier.ChannelConfiguration{
+		Name:   fmt.Sprintf("rule-%d", rule.ID),
+		Config: config,
+	})
+}
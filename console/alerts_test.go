@@ -0,0 +1,458 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	stdcontext "context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/leader"
+	"akvorado/console/database"
+	"akvorado/console/notifier"
+)
+
+func TestAlertRuleHandlers(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+
+	rule := gin.H{
+		"description": "DDoS to customers",
+		"enabled":     true,
+		"filter":      "InIfBoundary = external",
+		"dimension":   "DstAddr",
+		"units":       "pps",
+		"threshold":   100000,
+		"duration":    300,
+		"channel":     "https://hooks.example.com/ddos",
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no rules",
+			URL:         "/api/v0/console/alert-rules",
+			JSONOutput:  gin.H{"rules": []gin.H{}},
+		}, {
+			Description: "create rule",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  201,
+			JSONInput:   rule,
+			JSONOutput:  gin.H{"id": 1},
+		}, {
+			Description: "create rule with invalid filter",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"filter":      "InIfBoundary = ",
+				"units":       "pps",
+				"threshold":   100000,
+				"duration":    300,
+				"channel":     "https://hooks.example.com/ddos",
+			},
+			JSONOutput: gin.H{
+				"message": `Cannot parse filter: at line 1, position 16: no match found, expected: "--", "/*", "external"i, "internal"i, "undefined"i or [ \n\r\t]`,
+			},
+		}, {
+			Description: "create rule with invalid dimension",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"dimension":   "nope",
+				"units":       "pps",
+				"threshold":   100000,
+				"duration":    300,
+				"channel":     "https://hooks.example.com/ddos",
+			},
+			JSONOutput: gin.H{"message": `Unknown column name nope`},
+		}, {
+			Description: "create rule with missing channel",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"units":       "pps",
+				"threshold":   100000,
+				"duration":    300,
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'AlertRule.Channel' Error:Field validation for 'Channel' failed on the 'required_without' tag",
+			},
+		}, {
+			Description: "create rule with unknown notifier",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"units":       "pps",
+				"threshold":   100000,
+				"duration":    300,
+				"notifier":    "noc",
+			},
+			JSONOutput: gin.H{"message": "Unknown notifier noc"},
+		}, {
+			Description: "list rules",
+			URL:         "/api/v0/console/alert-rules",
+			JSONOutput: gin.H{"rules": []gin.H{
+				{
+					"id":          1,
+					"user":        "__default",
+					"description": "DDoS to customers",
+					"enabled":     true,
+					"kind":        "threshold",
+					"filter":      "InIfBoundary = external",
+					"dimension":   "DstAddr",
+					"units":       "pps",
+					"threshold":   100000,
+					"duration":    300,
+					"baseline":    0,
+					"channel":     "https://hooks.example.com/ddos",
+					"format":      "webhook",
+					"notifier":    "",
+				},
+			}},
+		}, {
+			Description: "update rule",
+			Method:      "PUT",
+			URL:         "/api/v0/console/alert-rules/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+			JSONInput: gin.H{
+				"description": "DDoS to customers",
+				"enabled":     false,
+				"kind":        "anomaly",
+				"filter":      "InIfBoundary = external",
+				"units":       "l3bps",
+				"threshold":   200,
+				"duration":    300,
+				"channel":     "https://hooks.slack.com/services/T0/B0/X",
+				"format":      "slack",
+			},
+		}, {
+			Description: "update missing rule",
+			Method:      "PUT",
+			URL:         "/api/v0/console/alert-rules/2",
+			StatusCode:  404,
+			JSONInput:   rule,
+			JSONOutput:  gin.H{"message": "alert rule not found"},
+		}, {
+			Description: "list updated rules",
+			URL:         "/api/v0/console/alert-rules",
+			JSONOutput: gin.H{"rules": []gin.H{
+				{
+					"id":          1,
+					"user":        "__default",
+					"description": "DDoS to customers",
+					"enabled":     false,
+					"kind":        "anomaly",
+					"filter":      "InIfBoundary = external",
+					"dimension":   "",
+					"units":       "l3bps",
+					"threshold":   200,
+					"duration":    300,
+					"baseline":    86400,
+					"channel":     "https://hooks.slack.com/services/T0/B0/X",
+					"format":      "slack",
+					"notifier":    "",
+				},
+			}},
+		}, {
+			Description: "delete missing rule",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/alert-rules/2",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "alert rule not found"},
+		}, {
+			Description: "delete rule",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/alert-rules/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list, no rules again",
+			URL:         "/api/v0/console/alert-rules",
+			JSONOutput:  gin.H{"rules": []gin.H{}},
+		},
+	})
+}
+
+func TestCheckAlertRules(t *testing.T) {
+	c, _, mockConn, mockClock := NewMock(t, DefaultConfiguration())
+	mockClock.Set(time.Date(2024, 4, 11, 15, 45, 0, 0, time.UTC))
+
+	var notificationsLock sync.Mutex
+	notifications := []notifier.Notification{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification notifier.Notification
+		if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		notificationsLock.Lock()
+		notifications = append(notifications, notification)
+		notificationsLock.Unlock()
+	}))
+	defer server.Close()
+
+	if _, err := c.d.Database.CreateAlertRule(stdcontext.Background(), database.AlertRule{
+		User:        "__default",
+		Description: "DDoS to customers",
+		Enabled:     true,
+		Filter:      "InIfBoundary = external",
+		Dimension:   "DstAddr",
+		Units:       "pps",
+		Threshold:   100000,
+		Duration:    300,
+		Channel:     server.URL,
+	}); err != nil {
+		t.Fatalf("CreateAlertRule() error:\n%+v", err)
+	}
+
+	type result = struct {
+		Value    string  `ch:"value"`
+		Xps      float64 `ch:"xps"`
+		Baseline float64 `ch:"baseline"`
+	}
+	check := func(results []result, expected []notifier.Notification) {
+		t.Helper()
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(func(_ stdcontext.Context, _ interface{}, query string, _ ...interface{}) error {
+				if !strings.Contains(query, "WHERE xps > 100000") {
+					t.Errorf("Select() unexpected query:\n%s", query)
+				}
+				return nil
+			}).
+			SetArg(1, results)
+		notifications = notifications[:0]
+		c.checkAlertRules(stdcontext.Background())
+		if diff := helpers.Diff(notifications, expected); diff != "" {
+			t.Fatalf("checkAlertRules() (-got, +want):\n%s", diff)
+		}
+	}
+
+	now := mockClock.Now().UTC()
+	base := notifier.Notification{
+		Rule:        1,
+		Description: "DDoS to customers",
+		Dimension:   "DstAddr",
+		Units:       "pps",
+		Threshold:   100000,
+		Time:        now,
+	}
+	firing := func(value string, xps uint64) notifier.Notification {
+		n := base
+		n.Status = "firing"
+		n.Value = value
+		n.Xps = xps
+		return n
+	}
+	resolved := func(value string) notifier.Notification {
+		n := base
+		n.Status = "resolved"
+		n.Value = value
+		return n
+	}
+
+	check([]result{}, []notifier.Notification{})
+	check([]result{{"2001:db8::1", 200000, 0}}, []notifier.Notification{firing("2001:db8::1", 200000)})
+	check([]result{{"2001:db8::1", 300000, 0}}, []notifier.Notification{})
+	check([]result{{"2001:db8::2", 150000, 0}}, []notifier.Notification{
+		firing("2001:db8::2", 150000),
+		resolved("2001:db8::1"),
+	})
+	check([]result{}, []notifier.Notification{resolved("2001:db8::2")})
+
+	gotMetrics := c.r.GetMetrics("akvorado_console_alert_")
+	expectedMetrics := map[string]string{
+		`notifications_total{status="firing"}`:   "2",
+		`notifications_total{status="resolved"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCheckAlertRulesFormats(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AlertCheckInterval = 0
+	config.ReportCheckInterval = 0
+	c, _, mockConn, mockClock := NewMock(t, config)
+	start := time.Date(2024, 4, 11, 15, 45, 0, 0, time.UTC)
+	mockClock.Set(start)
+
+	var bodiesLock sync.Mutex
+	bodies := map[string][]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodiesLock.Lock()
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], string(body))
+		bodiesLock.Unlock()
+	}))
+	defer server.Close()
+
+	for _, rule := range []database.AlertRule{
+		{
+			User:        "__default",
+			Description: "DDoS to customers",
+			Enabled:     true,
+			Kind:        "threshold",
+			Dimension:   "DstAddr",
+			Units:       "pps",
+			Threshold:   100000,
+			Duration:    300,
+			Channel:     server.URL + "/slack",
+			Format:      "slack",
+		}, {
+			User:        "__default",
+			Description: "Traffic surge",
+			Enabled:     true,
+			Kind:        "anomaly",
+			Dimension:   "SrcAS",
+			Units:       "l3bps",
+			Threshold:   200,
+			Duration:    300,
+			Baseline:    86400,
+			Channel:     server.URL + "/alertmanager",
+			Format:      "alertmanager",
+		},
+	} {
+		if _, err := c.d.Database.CreateAlertRule(stdcontext.Background(), rule); err != nil {
+			t.Fatalf("CreateAlertRule() error:\n%+v", err)
+		}
+	}
+
+	type result = struct {
+		Value    string  `ch:"value"`
+		Xps      float64 `ch:"xps"`
+		Baseline float64 `ch:"baseline"`
+	}
+	check := func(slack []result, alertmanager []result, expected map[string][]string) {
+		t.Helper()
+		gomock.InOrder(
+			mockConn.EXPECT().
+				Select(gomock.Any(), gomock.Any(), gomock.Any()).
+				SetArg(1, slack).
+				Return(nil),
+			mockConn.EXPECT().
+				Select(gomock.Any(), gomock.Any(), gomock.Any()).
+				DoAndReturn(func(_ stdcontext.Context, _ interface{}, query string, _ ...interface{}) error {
+					if !strings.Contains(query, "INNER JOIN baseline") ||
+						!strings.Contains(query, "baseline.xps * 300 / 100") {
+						t.Errorf("Select() unexpected query:\n%s", query)
+					}
+					return nil
+				}).
+				SetArg(1, alertmanager),
+		)
+		bodies = map[string][]string{}
+		c.checkAlertRules(stdcontext.Background())
+		if diff := helpers.Diff(bodies, expected); diff != "" {
+			t.Fatalf("checkAlertRules() (-got, +want):\n%s", diff)
+		}
+	}
+
+	check([]result{{"2001:db8::1", 200000, 0}}, []result{{"AS65000", 40000, 10000}},
+		map[string][]string{
+			"/slack": {
+				`{"text":"[FIRING] DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps"}`,
+			},
+			"/alertmanager": {
+				`[{"labels":{"alertname":"AkvoradoAlertRule","dimension":"SrcAS","rule":"2","value":"AS65000"},` +
+					`"annotations":{"description":"Traffic surge","summary":"Traffic surge (SrcAS AS65000): 40000 l3bps, baseline 10000 l3bps"},` +
+					`"startsAt":"2024-04-11T15:45:00Z"}]`,
+			},
+		})
+	// Still firing: only Alertmanager is notified again
+	mockClock.Add(time.Minute)
+	check([]result{{"2001:db8::1", 200000, 0}}, []result{{"AS65000", 50000, 10000}},
+		map[string][]string{
+			"/alertmanager": {
+				`[{"labels":{"alertname":"AkvoradoAlertRule","dimension":"SrcAS","rule":"2","value":"AS65000"},` +
+					`"annotations":{"description":"Traffic surge","summary":"Traffic surge (SrcAS AS65000): 50000 l3bps, baseline 10000 l3bps"},` +
+					`"startsAt":"2024-04-11T15:45:00Z"}]`,
+			},
+		})
+	// Resolved
+	mockClock.Add(time.Minute)
+	check([]result{}, []result{},
+		map[string][]string{
+			"/slack": {
+				`{"text":"[RESOLVED] DDoS to customers (DstAddr 2001:db8::1)"}`,
+			},
+			"/alertmanager": {
+				`[{"labels":{"alertname":"AkvoradoAlertRule","dimension":"SrcAS","rule":"2","value":"AS65000"},` +
+					`"annotations":{"description":"Traffic surge","summary":"Traffic surge (SrcAS AS65000)"},` +
+					`"startsAt":"2024-04-11T15:45:00Z","endsAt":"2024-04-11T15:47:00Z"}]`,
+			},
+		})
+
+	gotMetrics := c.r.GetMetrics("akvorado_console_alert_")
+	expectedMetrics := map[string]string{
+		`notifications_total{status="firing"}`:   "2",
+		`notifications_total{status="resolved"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCheckAlertRulesLeader(t *testing.T) {
+	c, _, mockConn, mockClock := NewMock(t, DefaultConfiguration())
+	leaderComponent, err := leader.New(c.r, "console", leader.DefaultConfiguration(),
+		leader.Dependencies{ClickHouse: c.d.ClickHouseDB})
+	if err != nil {
+		t.Fatalf("leader.New() error:\n%+v", err)
+	}
+	c.d.Leader = leaderComponent
+	if _, err := c.d.Database.CreateAlertRule(stdcontext.Background(), database.AlertRule{
+		User:        "__default",
+		Description: "DDoS to customers",
+		Enabled:     true,
+		Kind:        "threshold",
+		Dimension:   "DstAddr",
+		Units:       "pps",
+		Threshold:   100000,
+		Duration:    300,
+		Channel:     "https://hooks.example.com/ddos",
+	}); err != nil {
+		t.Fatalf("CreateAlertRule() error:\n%+v", err)
+	}
+
+	checked := make(chan struct{}, 10)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(stdcontext.Context, interface{}, string, ...interface{}) error {
+			checked <- struct{}{}
+			return nil
+		}).
+		AnyTimes()
+
+	// Not the leader: rules are not checked
+	time.Sleep(20 * time.Millisecond)
+	mockClock.Add(time.Minute)
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case <-checked:
+		t.Fatal("alert rules checked while not the leader")
+	default:
+	}
+
+	// Leader: rules are checked
+	helpers.StartStop(t, leaderComponent)
+	mockClock.Add(time.Minute)
+	select {
+	case <-checked:
+	case <-time.After(time.Second):
+		t.Fatal("alert rules not checked by the leader")
+	}
+}
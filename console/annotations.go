@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+)
+
+// annotationListHandlerInput describes the input for the /annotations
+// endpoint. Both bounds are optional.
+type annotationListHandlerInput struct {
+	Start time.Time `form:"start"`
+	End   time.Time `form:"end"`
+}
+
+func (c *Component) annotationListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input annotationListHandlerInput
+	if err := gc.ShouldBindQuery(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	annotations, err := c.d.Database.ListAnnotations(ctx, input.Start, input.End)
+	if err != nil {
+		c.r.Err(err).Msg("unable to list annotations")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list annotations"})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"annotations": annotations})
+}
+
+func (c *Component) annotationDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteAnnotation(ctx, database.Annotation{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "annotation not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) annotationAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var annotation database.Annotation
+	if err := gc.ShouldBindJSON(&annotation); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	annotation.User = user
+	if err := c.d.Database.CreateAnnotation(ctx, annotation); err != nil {
+		c.r.Err(err).Msg("cannot create annotation")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new annotation"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
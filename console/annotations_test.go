@@ -0,0 +1,101 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestAnnotationHandlers(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no annotations",
+			URL:         "/api/v0/console/annotations",
+			JSONOutput:  gin.H{"annotations": []gin.H{}},
+		}, {
+			Description: "store one annotation",
+			URL:         "/api/v0/console/annotations",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"start": "2024-03-10T02:00:00Z",
+				"end":   "2024-03-10T04:00:00Z",
+				"kind":  "maintenance",
+				"label": "Router upgrade",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store annotation ending before its start",
+			URL:         "/api/v0/console/annotations",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"start": "2024-03-10T04:00:00Z",
+				"end":   "2024-03-10T02:00:00Z",
+				"kind":  "incident",
+				"label": "Time travel",
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'Annotation.EndTime' Error:Field validation for 'EndTime' failed on the 'gtefield' tag",
+			},
+		}, {
+			Description: "store annotation with invalid kind",
+			URL:         "/api/v0/console/annotations",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"start": "2024-03-10T02:00:00Z",
+				"end":   "2024-03-10T04:00:00Z",
+				"kind":  "party",
+				"label": "Release party",
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'Annotation.Kind' Error:Field validation for 'Kind' failed on the 'oneof' tag",
+			},
+		}, {
+			Description: "list stored annotations",
+			URL:         "/api/v0/console/annotations?start=2024-03-10T00:00:00Z&end=2024-03-11T00:00:00Z",
+			JSONOutput: gin.H{"annotations": []gin.H{
+				{
+					"id":    1,
+					"user":  "__default",
+					"start": "2024-03-10T02:00:00Z",
+					"end":   "2024-03-10T04:00:00Z",
+					"kind":  "maintenance",
+					"label": "Router upgrade",
+				},
+			}},
+		}, {
+			Description: "list stored annotations outside range",
+			URL:         "/api/v0/console/annotations?start=2024-03-11T00:00:00Z",
+			JSONOutput:  gin.H{"annotations": []gin.H{}},
+		}, {
+			Description: "list with invalid range",
+			URL:         "/api/v0/console/annotations?start=yesterday",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": `Parsing time "yesterday" as "2006-01-02T15:04:05Z07:00": cannot parse "yesterday" as "2006"`,
+			},
+		}, {
+			Description: "delete missing annotation",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/annotations/2",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "annotation not found"},
+		}, {
+			Description: "delete stored annotation",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/annotations/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list stored annotations after delete",
+			URL:         "/api/v0/console/annotations",
+			JSONOutput:  gin.H{"annotations": []gin.H{}},
+		},
+	})
+}
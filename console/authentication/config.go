@@ -3,14 +3,34 @@
 
 package authentication
 
+import (
+	"net/netip"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
 // Configuration describes the configuration for the authentication component.
 type Configuration struct {
 	// Headers define authentication headers
 	Headers ConfigurationHeaders
+	// TrustedProxies is the list of networks allowed to provide
+	// authentication headers. When empty, headers are accepted from
+	// anywhere.
+	TrustedProxies []netip.Prefix
+	// OIDC enables authentication with an OpenID Connect provider
+	// instead of authentication headers.
+	OIDC ConfigurationOIDC
 	// DefaultUser define the default user when no authentication
 	// headers are present. Leave `User' empty to not allow access
 	// without authentication.
 	DefaultUser UserInformation
+	// Roles maps groups to roles
+	Roles ConfigurationRoles
+	// DefaultRole is the role of users not belonging to any group
+	// mapped to a role. When not set, this is viewer when OIDC is
+	// enabled and admin otherwise.
+	DefaultRole Role
 }
 
 // ConfigurationHeaders define headers used for authentication
@@ -19,6 +39,50 @@ type ConfigurationHeaders struct {
 	Name      string
 	Email     string
 	LogoutURL string
+	Groups    string
+}
+
+// ConfigurationRoles define the groups granted each role
+type ConfigurationRoles struct {
+	// Editor is the list of groups granted the editor role.
+	Editor []string
+	// Admin is the list of groups granted the admin role.
+	Admin []string
+}
+
+// ConfigurationOIDC defines how to authenticate users with an OpenID
+// Connect provider.
+type ConfigurationOIDC struct {
+	// Issuer is the URL of the provider. OIDC is disabled when empty.
+	Issuer string `validate:"omitempty,url"`
+	// ClientID is the client identifier registered with the provider.
+	ClientID string `validate:"required_with=Issuer"`
+	// ClientSecret is the secret associated to the client identifier.
+	ClientSecret string
+	// RedirectURL is the public URL of the callback endpoint
+	// (/api/v0/console/auth/callback).
+	RedirectURL string `validate:"required_with=Issuer,omitempty,url"`
+	// Scopes are the scopes requested to the provider.
+	Scopes []string
+	// LoginClaim is the claim to use as a login.
+	LoginClaim string `validate:"required"`
+	// GroupsClaim is the claim to use as a list of groups.
+	GroupsClaim string `validate:"required"`
+	// SessionSecret is the secret used to sign the state cookie during
+	// login. When empty, a random secret is used.
+	SessionSecret string
+	// SessionDuration is the maximum validity of a session.
+	SessionDuration time.Duration `validate:"min=1m"`
+	// SessionIdleTimeout is the time after which an unused session
+	// expires. 0 disables this timeout.
+	SessionIdleTimeout time.Duration `validate:"min=0"`
+	// MaxSessionsPerUser is the maximum number of concurrent sessions for
+	// a user. The oldest sessions are revoked when exceeded. 0 means no
+	// limit.
+	MaxSessionsPerUser int `validate:"min=0"`
+	// LoginRateLimit is the number of login attempts per second allowed
+	// from a client address. 0 means no limit.
+	LoginRateLimit rate.Limit `validate:"min=0"`
 }
 
 // DefaultConfiguration represents the default configuration for the console component.
@@ -29,6 +93,16 @@ func DefaultConfiguration() Configuration {
 			Name:      "Remote-Name",
 			Email:     "Remote-Email",
 			LogoutURL: "X-Logout-URL",
+			Groups:    "Remote-Groups",
+		},
+		OIDC: ConfigurationOIDC{
+			Scopes:             []string{"openid", "profile", "email"},
+			LoginClaim:         "preferred_username",
+			GroupsClaim:        "groups",
+			SessionDuration:    12 * time.Hour,
+			SessionIdleTimeout: 2 * time.Hour,
+			MaxSessionsPerUser: 5,
+			LoginRateLimit:     0.1,
 		},
 		DefaultUser: UserInformation{
 			Login: "__default",
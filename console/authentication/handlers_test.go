@@ -33,7 +33,7 @@ func TestUserHandler(t *testing.T) {
 				Description: "user info, no user logged in",
 				URL:         "/api/v0/console/user/info",
 				StatusCode:  200,
-				JSONOutput:  gin.H{"login": "__default", "name": "Default User"},
+				JSONOutput:  gin.H{"login": "__default", "name": "Default User", "role": "admin"},
 			}, {
 				Description: "user info, minimal user logged in",
 				URL:         "/api/v0/console/user/info",
@@ -45,6 +45,7 @@ func TestUserHandler(t *testing.T) {
 				StatusCode: 200,
 				JSONOutput: gin.H{
 					"login": "alfred",
+					"role":  "admin",
 				},
 			}, {
 				Description: "user info, complete user logged in",
@@ -55,6 +56,7 @@ func TestUserHandler(t *testing.T) {
 					headers.Add("Remote-Name", "Alfred Pennyworth")
 					headers.Add("Remote-Email", "alfred@batman.com")
 					headers.Add("X-Logout-URL", "/logout")
+					headers.Add("Remote-Groups", "butlers, admins")
 					return headers
 				}(),
 				StatusCode: 200,
@@ -63,6 +65,8 @@ func TestUserHandler(t *testing.T) {
 					"name":       "Alfred Pennyworth",
 					"email":      "alfred@batman.com",
 					"logout-url": "/logout",
+					"groups":     []string{"butlers", "admins"},
+					"role":       "admin",
 				},
 			}, {
 				Description: "user info, invalid user logged in",
@@ -74,7 +78,7 @@ func TestUserHandler(t *testing.T) {
 					return headers
 				}(),
 				StatusCode: 200,
-				JSONOutput: gin.H{"login": "__default", "name": "Default User"},
+				JSONOutput: gin.H{"login": "__default", "name": "Default User", "role": "admin"},
 			}, {
 				Description: "avatar, no user logged in",
 				URL:         "/api/v0/console/user/avatar",
@@ -5,7 +5,9 @@ package authentication
 
 import (
 	"net/http"
+	"net/netip"
 	"reflect"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
@@ -13,31 +15,66 @@ import (
 
 // UserInformation contains information about the current user.
 type UserInformation struct {
-	Login     string `json:"login" header:"LOGIN" binding:"required"`
-	Name      string `json:"name,omitempty" header:"NAME"`
-	Email     string `json:"email,omitempty" header:"EMAIL" binding:"omitempty,email"`
-	LogoutURL string `json:"logout-url,omitempty" header:"LOGOUT" binding:"omitempty,uri"`
+	Login     string   `json:"login" header:"LOGIN" binding:"required"`
+	Name      string   `json:"name,omitempty" header:"NAME"`
+	Email     string   `json:"email,omitempty" header:"EMAIL" binding:"omitempty,email"`
+	LogoutURL string   `json:"logout-url,omitempty" header:"LOGOUT" binding:"omitempty,uri"`
+	Groups    []string `json:"groups,omitempty" header:"GROUPS"`
+	Role      Role     `json:"role" header:"-" yaml:"-"`
 }
 
 // UserAuthentication is a middleware to fill information about the
-// current user. It does not really perform authentication but relies
-// on HTTP headers.
+// current user. Unless OIDC is enabled, it does not really perform
+// authentication but relies on HTTP headers set by a trusted proxy.
 func (c *Component) UserAuthentication() gin.HandlerFunc {
 	return func(gc *gin.Context) {
 		var info UserInformation
-		if err := gc.ShouldBindWith(&info, customHeaderBinding{c}); err != nil {
-			if c.config.DefaultUser.Login == "" {
-				gc.JSON(http.StatusUnauthorized, gin.H{"message": "No user logged in."})
-				gc.Abort()
+		var ok bool
+		if c.oidc != nil {
+			info, ok = c.oidc.session(gc)
+			if !ok {
+				gc.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"message":   "No user logged in.",
+					"login-url": oidcLoginPath,
+				})
 				return
 			}
-			info = c.config.DefaultUser
+		} else {
+			ok = c.trustedProxy(gc) && gc.ShouldBindWith(&info, customHeaderBinding{c}) == nil
+			if !ok {
+				if c.config.DefaultUser.Login == "" {
+					gc.JSON(http.StatusUnauthorized, gin.H{"message": "No user logged in."})
+					gc.Abort()
+					return
+				}
+				info = c.config.DefaultUser
+			}
 		}
+		info.Role = c.role(info)
 		gc.Set("user", info)
 		gc.Next()
 	}
 }
 
+// trustedProxy tells if the request comes from a proxy allowed to provide
+// authentication headers.
+func (c *Component) trustedProxy(gc *gin.Context) bool {
+	if len(c.config.TrustedProxies) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(gc.RemoteIP())
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range c.config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
 type customHeaderBinding struct {
 	c *Component
 }
@@ -72,10 +109,23 @@ func (b customHeaderBinding) Bind(req *http.Request, obj interface{}) error {
 			header = b.c.config.Headers.Email
 		case "LOGOUT":
 			header = b.c.config.Headers.LogoutURL
+		case "GROUPS":
+			header = b.c.config.Headers.Groups
 		}
 		if header == "" {
 			continue
 		}
+		if value.Field(i).Kind() == reflect.Slice {
+			// Comma-separated list
+			var values []string
+			for _, v := range strings.Split(req.Header.Get(header), ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			value.Field(i).Set(reflect.ValueOf(values))
+			continue
+		}
 		value.Field(i).SetString(req.Header.Get(header))
 	}
 
@@ -0,0 +1,438 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcLoginPath     = "/api/v0/console/auth/login"
+	oidcLogoutPath    = "/api/v0/console/auth/logout"
+	oidcSessionCookie = "akvorado-session"
+	oidcStateCookie   = "akvorado-oidc-state"
+	oidcStateDuration = 10 * time.Minute
+)
+
+// oidcComponent handles authentication with an OpenID Connect provider.
+type oidcComponent struct {
+	config   ConfigurationOIDC
+	secret   []byte
+	client   *http.Client
+	sessions *sessionStore
+
+	// Endpoints of the provider, discovered on first use
+	providerLock sync.Mutex
+	provider     *oidcProvider
+}
+
+// oidcProvider contains the endpoints advertised by the provider.
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcState is the content of the state cookie during login.
+type oidcState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+	Expires  int64  `json:"expires"`
+}
+
+// oidcIDClaims are the claims of the ID token checked during login.
+type oidcIDClaims struct {
+	Issuer   string      `json:"iss"`
+	Subject  string      `json:"sub"`
+	Audience interface{} `json:"aud"`
+	Expires  int64       `json:"exp"`
+	Nonce    string      `json:"nonce"`
+}
+
+func newOIDC(config ConfigurationOIDC) (*oidcComponent, error) {
+	secret := []byte(config.SessionSecret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("cannot generate session secret: %w", err)
+		}
+	}
+	return &oidcComponent{
+		config:   config,
+		secret:   secret,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		sessions: newSessionStore(config),
+	}, nil
+}
+
+// discover returns the endpoints of the provider.
+func (o *oidcComponent) discover(ctx context.Context) (*oidcProvider, error) {
+	o.providerLock.Lock()
+	defer o.providerLock.Unlock()
+	if o.provider != nil {
+		return o.provider, nil
+	}
+	url := fmt.Sprintf("%s/.well-known/openid-configuration", strings.TrimSuffix(o.config.Issuer, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch provider configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot fetch provider configuration: unexpected status %d", resp.StatusCode)
+	}
+	var provider oidcProvider
+	if err := json.NewDecoder(resp.Body).Decode(&provider); err != nil {
+		return nil, fmt.Errorf("cannot decode provider configuration: %w", err)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.UserinfoEndpoint == "" {
+		return nil, errors.New("incomplete provider configuration")
+	}
+	o.provider = &provider
+	return o.provider, nil
+}
+
+// oauth2Config returns the OAuth2 configuration for the provider.
+func (o *oidcComponent) oauth2Config(provider *oidcProvider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     o.config.ClientID,
+		ClientSecret: o.config.ClientSecret,
+		RedirectURL:  o.config.RedirectURL,
+		Scopes:       o.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  provider.AuthorizationEndpoint,
+			TokenURL: provider.TokenEndpoint,
+		},
+	}
+}
+
+// sign returns a signed representation of the provided value.
+func (o *oidcComponent) sign(value interface{}) (string, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, o.secret)
+	mac.Write(payload)
+	return fmt.Sprintf("%s.%s",
+		base64.RawURLEncoding.EncodeToString(payload),
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))), nil
+}
+
+// verify checks the signature of the provided signed value and decodes
+// it.
+func (o *oidcComponent) verify(signed string, value interface{}) error {
+	encodedPayload, encodedSignature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return errors.New("invalid signed value")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, o.secret)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+	return json.Unmarshal(payload, value)
+}
+
+// setCookie sets a cookie only available to the console.
+func (o *oidcComponent) setCookie(gc *gin.Context, name, value string, maxAge time.Duration) {
+	http.SetCookie(gc.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   strings.HasPrefix(o.config.RedirectURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// session returns the user information for the session referenced by the
+// session cookie.
+func (o *oidcComponent) session(gc *gin.Context) (UserInformation, bool) {
+	token, err := gc.Cookie(oidcSessionCookie)
+	if err != nil {
+		return UserInformation{}, false
+	}
+	info, ok := o.sessions.get(token)
+	if !ok {
+		return UserInformation{}, false
+	}
+	info.LogoutURL = oidcLogoutPath
+	return info, true
+}
+
+// checkIDToken decodes the ID token returned by the token endpoint and
+// checks its claims. As the token is received directly from the provider
+// over TLS, its signature is not checked (OpenID Connect Core, 3.1.3.7).
+func (o *oidcComponent) checkIDToken(provider *oidcProvider, idToken, nonce string) (oidcIDClaims, error) {
+	var claims oidcIDClaims
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("missing or malformed ID token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, fmt.Errorf("cannot decode ID token: %w", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("cannot decode ID token: %w", err)
+	}
+	if claims.Issuer != provider.Issuer {
+		return claims, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	audienceOK := false
+	switch audience := claims.Audience.(type) {
+	case string:
+		audienceOK = audience == o.config.ClientID
+	case []interface{}:
+		for _, aud := range audience {
+			if aud == o.config.ClientID {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return claims, errors.New("unexpected audience")
+	}
+	if time.Now().Unix() > claims.Expires {
+		return claims, errors.New("expired ID token")
+	}
+	if claims.Nonce != nonce {
+		return claims, errors.New("unexpected nonce")
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("missing subject")
+	}
+	return claims, nil
+}
+
+// userInformation extracts user information from the claims returned by
+// the provider.
+func (o *oidcComponent) userInformation(claims map[string]interface{}) UserInformation {
+	var info UserInformation
+	info.Login, _ = claims[o.config.LoginClaim].(string)
+	if info.Login == "" {
+		info.Login, _ = claims["sub"].(string)
+	}
+	info.Name, _ = claims["name"].(string)
+	info.Email, _ = claims["email"].(string)
+	switch groups := claims[o.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				info.Groups = append(info.Groups, group)
+			}
+		}
+	case string:
+		for _, group := range strings.Split(groups, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				info.Groups = append(info.Groups, group)
+			}
+		}
+	}
+	return info
+}
+
+// localRedirect returns the provided redirection target if it is a local
+// path. Otherwise, it returns "/". Browsers handle backslashes like slashes,
+// so "/\\evil.example" would be considered as a remote URL.
+func localRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.ContainsRune(redirect, '\\') {
+		return "/"
+	}
+	u, err := url.Parse(redirect)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "/"
+	}
+	return redirect
+}
+
+// LoginHandlerFunc redirects the user to the OIDC provider.
+func (c *Component) LoginHandlerFunc(gc *gin.Context) {
+	if c.oidc == nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "OIDC authentication not enabled."})
+		return
+	}
+	if !c.oidc.sessions.allowLogin(gc.ClientIP()) {
+		gc.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many login attempts."})
+		return
+	}
+	provider, err := c.oidc.discover(gc.Request.Context())
+	if err != nil {
+		c.r.Err(err).Msg("cannot discover OIDC provider")
+		gc.JSON(http.StatusBadGateway, gin.H{"message": "Cannot contact authentication provider."})
+		return
+	}
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		c.r.Err(err).Msg("cannot generate OIDC state")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot start authentication."})
+		return
+	}
+	redirect := localRedirect(gc.Query("redirect"))
+	state := oidcState{
+		State:    hex.EncodeToString(random[:16]),
+		Nonce:    hex.EncodeToString(random[16:]),
+		Verifier: oauth2.GenerateVerifier(),
+		Redirect: redirect,
+		Expires:  time.Now().Add(oidcStateDuration).Unix(),
+	}
+	signed, err := c.oidc.sign(state)
+	if err != nil {
+		c.r.Err(err).Msg("cannot sign OIDC state")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot start authentication."})
+		return
+	}
+	c.oidc.setCookie(gc, oidcStateCookie, signed, oidcStateDuration)
+	gc.Redirect(http.StatusFound, c.oidc.oauth2Config(provider).AuthCodeURL(state.State,
+		oauth2.S256ChallengeOption(state.Verifier),
+		oauth2.SetAuthURLParam("nonce", state.Nonce)))
+}
+
+// CallbackHandlerFunc handles the redirection from the OIDC provider once
+// the user is authenticated.
+func (c *Component) CallbackHandlerFunc(gc *gin.Context) {
+	if c.oidc == nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "OIDC authentication not enabled."})
+		return
+	}
+	if !c.oidc.sessions.allowLogin(gc.ClientIP()) {
+		gc.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many login attempts."})
+		return
+	}
+	ctx := gc.Request.Context()
+	var state oidcState
+	cookie, err := gc.Cookie(oidcStateCookie)
+	if err == nil {
+		err = c.oidc.verify(cookie, &state)
+	}
+	if err != nil || time.Now().Unix() > state.Expires || gc.Query("state") != state.State {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid authentication state."})
+		return
+	}
+	c.oidc.setCookie(gc, oidcStateCookie, "", -1)
+	if message := gc.Query("error"); message != "" {
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": fmt.Sprintf("Authentication failed: %s.", message)})
+		return
+	}
+	provider, err := c.oidc.discover(ctx)
+	if err != nil {
+		c.r.Err(err).Msg("cannot discover OIDC provider")
+		gc.JSON(http.StatusBadGateway, gin.H{"message": "Cannot contact authentication provider."})
+		return
+	}
+
+	// Exchange the code for a token and use it to fetch user information
+	config := c.oidc.oauth2Config(provider)
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, c.oidc.client)
+	token, err := config.Exchange(ctx, gc.Query("code"), oauth2.VerifierOption(state.Verifier))
+	if err != nil {
+		c.r.Err(err).Msg("cannot exchange OIDC code")
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed."})
+		return
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	idClaims, err := c.oidc.checkIDToken(provider, idToken, state.Nonce)
+	if err != nil {
+		c.r.Err(err).Msg("invalid OIDC ID token")
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed."})
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.UserinfoEndpoint, nil)
+	if err != nil {
+		c.r.Err(err).Msg("cannot build OIDC user info request")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Authentication failed."})
+		return
+	}
+	resp, err := config.Client(ctx, token).Do(req)
+	if err != nil {
+		c.r.Err(err).Msg("cannot fetch OIDC user info")
+		gc.JSON(http.StatusBadGateway, gin.H{"message": "Cannot contact authentication provider."})
+		return
+	}
+	defer resp.Body.Close()
+	var claims map[string]interface{}
+	if resp.StatusCode != http.StatusOK {
+		err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&claims)
+	}
+	if err != nil {
+		c.r.Err(err).Msg("cannot fetch OIDC user info")
+		gc.JSON(http.StatusBadGateway, gin.H{"message": "Cannot contact authentication provider."})
+		return
+	}
+	if sub, _ := claims["sub"].(string); sub != idClaims.Subject {
+		c.r.Error().Str("sub", sub).Msg("OIDC user info does not match ID token")
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed."})
+		return
+	}
+	info := c.oidc.userInformation(claims)
+	if info.Login == "" {
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": "Authentication failed."})
+		return
+	}
+
+	// Create a session and reference it in the session cookie
+	sessionToken, err := c.oidc.sessions.create(info, gc.ClientIP())
+	if err != nil {
+		c.r.Err(err).Msg("cannot create OIDC session")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Authentication failed."})
+		return
+	}
+	c.oidc.setCookie(gc, oidcSessionCookie, sessionToken, c.oidc.config.SessionDuration)
+	c.r.Info().Str("login", info.Login).Msg("user logged in")
+	gc.Redirect(http.StatusFound, state.Redirect)
+}
+
+// LogoutHandlerFunc removes the session of the user and redirects them to
+// the OIDC provider if it supports it.
+func (c *Component) LogoutHandlerFunc(gc *gin.Context) {
+	if c.oidc == nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "OIDC authentication not enabled."})
+		return
+	}
+	if token, err := gc.Cookie(oidcSessionCookie); err == nil {
+		c.oidc.sessions.remove(token)
+	}
+	c.oidc.setCookie(gc, oidcSessionCookie, "", -1)
+	redirect := "/"
+	if provider, err := c.oidc.discover(gc.Request.Context()); err == nil && provider.EndSessionEndpoint != "" {
+		redirect = provider.EndSessionEndpoint
+	}
+	gc.Redirect(http.StatusFound, redirect)
+}
@@ -0,0 +1,314 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+// fakeIDToken builds an unsigned ID token with the provided claims.
+func fakeIDToken(claims map[string]interface{}) string {
+	payload, _ := json.Marshal(claims)
+	return fmt.Sprintf("eyJhbGciOiJub25lIn0.%s.", base64.RawURLEncoding.EncodeToString(payload))
+}
+
+// newFakeOIDCProvider creates a minimal OIDC provider accepting any user.
+func newFakeOIDCProvider(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	var lock sync.Mutex
+	var challenge, nonce string
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"userinfo_endpoint":      server.URL + "/userinfo",
+			"end_session_endpoint":   server.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("code_challenge_method") != "S256" || r.URL.Query().Get("nonce") == "" {
+			http.Error(w, "missing PKCE challenge or nonce", http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		challenge = r.URL.Query().Get("code_challenge")
+		nonce = r.URL.Query().Get("nonce")
+		lock.Unlock()
+		http.Redirect(w, r, fmt.Sprintf("%s?code=secret-code&state=%s",
+			r.URL.Query().Get("redirect_uri"), r.URL.Query().Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "secret-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(verifier[:]) != challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "secret-token",
+			"token_type":   "Bearer",
+			"id_token": fakeIDToken(map[string]interface{}{
+				"iss":   server.URL,
+				"sub":   "1234",
+				"aud":   "akvorado",
+				"exp":   time.Now().Add(time.Minute).Unix(),
+				"nonce": nonce,
+			}),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"sub":                "1234",
+			"preferred_username": "alfred",
+			"name":               "Alfred Pennyworth",
+			"email":              "alfred@batman.com",
+			"groups":             []string{"butlers", "admins"},
+		})
+	})
+	return server
+}
+
+func TestOIDC(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	base := fmt.Sprintf("http://%s", h.LocalAddr())
+	config := DefaultConfiguration()
+	config.DefaultRole = RoleViewer
+	config.Roles.Admin = []string{"admins"}
+	config.OIDC.Issuer = provider.URL
+	config.OIDC.ClientID = "akvorado"
+	config.OIDC.ClientSecret = "secret"
+	config.OIDC.RedirectURL = base + "/api/v0/console/auth/callback"
+	c, err := New(r, config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	auth := h.GinRouter.Group("/api/v0/console/auth")
+	auth.GET("/login", c.LoginHandlerFunc)
+	auth.GET("/callback", c.CallbackHandlerFunc)
+	auth.GET("/logout", c.LogoutHandlerFunc)
+	endpoint := h.GinRouter.Group("/api/v0/console", c.UserAuthentication())
+	endpoint.GET("/user/info", c.UserInfoHandlerFunc)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			// Stop once redirected outside of the authentication flow
+			if req.URL.Path == "/visualize" || req.URL.Path == "/logout" {
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+	userInfo := func() (int, map[string]interface{}) {
+		t.Helper()
+		resp, err := client.Get(base + "/api/v0/console/user/info")
+		if err != nil {
+			t.Fatalf("GET /user/info error:\n%+v", err)
+		}
+		defer resp.Body.Close()
+		var got map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&got)
+		return resp.StatusCode, got
+	}
+
+	// Not logged in
+	status, got := userInfo()
+	if status != 401 {
+		t.Fatalf("GET /user/info status: %d, expected 401", status)
+	}
+	if diff := helpers.Diff(got, map[string]interface{}{
+		"message":   "No user logged in.",
+		"login-url": "/api/v0/console/auth/login",
+	}); diff != "" {
+		t.Fatalf("GET /user/info (-got, +want):\n%s", diff)
+	}
+
+	// Log in
+	resp, err := client.Get(base + "/api/v0/console/auth/login?redirect=/visualize")
+	if err != nil {
+		t.Fatalf("GET /auth/login error:\n%+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != "/visualize" {
+		t.Fatalf("GET /auth/login: %d %q, expected 302 to /visualize",
+			resp.StatusCode, resp.Header.Get("Location"))
+	}
+	status, got = userInfo()
+	if status != 200 {
+		t.Fatalf("GET /user/info status: %d, expected 200", status)
+	}
+	if diff := helpers.Diff(got, map[string]interface{}{
+		"login":      "alfred",
+		"name":       "Alfred Pennyworth",
+		"email":      "alfred@batman.com",
+		"groups":     []interface{}{"butlers", "admins"},
+		"logout-url": "/api/v0/console/auth/logout",
+		"role":       "admin",
+	}); diff != "" {
+		t.Fatalf("GET /user/info (-got, +want):\n%s", diff)
+	}
+
+	// Tampered session
+	found := false
+	for _, cookie := range jar.Cookies(resp.Request.URL) {
+		if cookie.Name != oidcSessionCookie {
+			continue
+		}
+		found = true
+		req, _ := http.NewRequest("GET", base+"/api/v0/console/user/info", nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: "e30" + cookie.Value[2:]})
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /user/info error:\n%+v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 401 {
+			t.Fatalf("GET /user/info with tampered session status: %d, expected 401", resp.StatusCode)
+		}
+	}
+	if !found {
+		t.Fatal("no session cookie after login")
+	}
+
+	// Log out
+	resp, err = client.Get(base + "/api/v0/console/auth/logout")
+	if err != nil {
+		t.Fatalf("GET /auth/logout error:\n%+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 302 || resp.Header.Get("Location") != provider.URL+"/logout" {
+		t.Fatalf("GET /auth/logout: %d %q, expected 302 to provider",
+			resp.StatusCode, resp.Header.Get("Location"))
+	}
+	if status, _ := userInfo(); status != 401 {
+		t.Fatalf("GET /user/info after logout status: %d, expected 401", status)
+	}
+
+	// Invalid state
+	resp, err = client.Get(base + "/api/v0/console/auth/callback?code=secret-code&state=nope")
+	if err != nil {
+		t.Fatalf("GET /auth/callback error:\n%+v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Fatalf("GET /auth/callback with invalid state status: %d, expected 400", resp.StatusCode)
+	}
+}
+
+func TestOIDCCheckIDToken(t *testing.T) {
+	o, err := newOIDC(ConfigurationOIDC{ClientID: "akvorado"})
+	if err != nil {
+		t.Fatalf("newOIDC() error:\n%+v", err)
+	}
+	provider := &oidcProvider{Issuer: "https://auth.example.com"}
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://auth.example.com",
+			"sub":   "1234",
+			"aud":   "akvorado",
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": "nonce",
+		}
+	}
+	cases := []struct {
+		Description string
+		Update      func(map[string]interface{})
+		Token       string
+		Error       bool
+	}{
+		{"valid", func(map[string]interface{}) {}, "", false},
+		{"audience list", func(c map[string]interface{}) { c["aud"] = []string{"other", "akvorado"} }, "", false},
+		{"missing token", nil, "", true},
+		{"malformed token", nil, "not-a-token", true},
+		{"wrong issuer", func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" }, "", true},
+		{"wrong audience", func(c map[string]interface{}) { c["aud"] = []string{"other"} }, "", true},
+		{"expired", func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, "", true},
+		{"wrong nonce", func(c map[string]interface{}) { c["nonce"] = "replayed" }, "", true},
+		{"missing subject", func(c map[string]interface{}) { delete(c, "sub") }, "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			token := tc.Token
+			if tc.Update != nil {
+				claims := valid()
+				tc.Update(claims)
+				token = fakeIDToken(claims)
+			}
+			_, err := o.checkIDToken(provider, token, "nonce")
+			if err != nil && !tc.Error {
+				t.Fatalf("checkIDToken() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("checkIDToken() did not error")
+			}
+		})
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	c := NewMock(t, r)
+	h.GinRouter.GET("/api/v0/console/auth/login", c.LoginHandlerFunc)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/console/auth/login",
+			StatusCode: 404,
+			JSONOutput: map[string]string{"message": "OIDC authentication not enabled."},
+		},
+	})
+}
+
+func TestLocalRedirect(t *testing.T) {
+	cases := []struct {
+		Redirect string
+		Expected string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/visualize", "/visualize"},
+		{"/visualize?filter=InIfBoundary+%3D+external#graph", "/visualize?filter=InIfBoundary+%3D+external#graph"},
+		{"visualize", "/"},
+		{"//evil.example", "/"},
+		{`/\evil.example`, "/"},
+		{`/visualize\..\`, "/"},
+		{"https://evil.example/", "/"},
+		{"/%zz", "/"},
+	}
+	for _, tc := range cases {
+		if got := localRedirect(tc.Redirect); got != tc.Expected {
+			t.Errorf("localRedirect(%q) == %q, expected %q", tc.Redirect, got, tc.Expected)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers/bimap"
+)
+
+// Role is the role of a user. Each role includes the permissions of the
+// previous ones.
+type Role int
+
+const (
+	// RoleViewer can only look at data
+	RoleViewer Role = iota + 1
+	// RoleEditor can also modify shared objects (saved filters, alert
+	// rules, scheduled reports, …)
+	RoleEditor
+	// RoleAdmin can also use administrative tools
+	RoleAdmin
+)
+
+var roleMap = bimap.New(map[Role]string{
+	RoleViewer: "viewer",
+	RoleEditor: "editor",
+	RoleAdmin:  "admin",
+})
+
+// MarshalText turns a role into text
+func (r Role) MarshalText() ([]byte, error) {
+	if r == 0 {
+		return []byte{}, nil
+	}
+	got, ok := roleMap.LoadValue(r)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown role")
+}
+
+// String turns a role into a string
+func (r Role) String() string {
+	got, _ := roleMap.LoadValue(r)
+	return got
+}
+
+// UnmarshalText provides a role from text
+func (r *Role) UnmarshalText(input []byte) error {
+	if len(input) == 0 {
+		*r = 0
+		return nil
+	}
+	got, ok := roleMap.LoadKey(string(input))
+	if ok {
+		*r = got
+		return nil
+	}
+	return errors.New("unknown role")
+}
+
+// role returns the role of the provided user from its groups.
+func (c *Component) role(info UserInformation) Role {
+	role := c.config.DefaultRole
+	for _, group := range info.Groups {
+		if slices.Contains(c.config.Roles.Admin, group) {
+			return RoleAdmin
+		}
+		if role < RoleEditor && slices.Contains(c.config.Roles.Editor, group) {
+			role = RoleEditor
+		}
+	}
+	return role
+}
+
+// RequireRole is a middleware restricting access to users with at least the
+// provided role. It should be used after UserAuthentication.
+func (c *Component) RequireRole(role Role) gin.HandlerFunc {
+	messages := map[Role]string{
+		RoleViewer: "Access restricted to viewers.",
+		RoleEditor: "Access restricted to editors.",
+		RoleAdmin:  "Access restricted to administrators.",
+	}
+	return func(gc *gin.Context) {
+		info := gc.MustGet("user").(UserInformation)
+		if info.Role < role {
+			gc.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": messages[role]})
+			return
+		}
+		gc.Next()
+	}
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRoles(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.DefaultRole = RoleViewer
+	config.Roles.Editor = []string{"butlers"}
+	config.Roles.Admin = []string{"admins"}
+	c, err := New(r, config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	endpoint := h.GinRouter.Group("/api/v0/console", c.UserAuthentication())
+	endpoint.GET("/user/info", c.UserInfoHandlerFunc)
+	endpoint.GET("/editor", c.RequireRole(RoleEditor), c.UserInfoHandlerFunc)
+	endpoint.GET("/admin", c.RequireRole(RoleAdmin), c.UserInfoHandlerFunc)
+
+	user := func(groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", "alfred")
+		if groups != "" {
+			headers.Add("Remote-Groups", groups)
+		}
+		return headers
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "viewer",
+			URL:         "/api/v0/console/user/info",
+			Header:      user(""),
+			JSONOutput:  gin.H{"login": "alfred", "role": "viewer"},
+		}, {
+			Description: "editor",
+			URL:         "/api/v0/console/user/info",
+			Header:      user("butlers"),
+			JSONOutput:  gin.H{"login": "alfred", "groups": []string{"butlers"}, "role": "editor"},
+		}, {
+			Description: "admin",
+			URL:         "/api/v0/console/user/info",
+			Header:      user("butlers, admins"),
+			JSONOutput:  gin.H{"login": "alfred", "groups": []string{"butlers", "admins"}, "role": "admin"},
+		}, {
+			Description: "viewer on editor endpoint",
+			URL:         "/api/v0/console/editor",
+			Header:      user(""),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to editors."},
+		}, {
+			Description: "editor on editor endpoint",
+			URL:         "/api/v0/console/editor",
+			Header:      user("butlers"),
+			JSONOutput:  gin.H{"login": "alfred", "groups": []string{"butlers"}, "role": "editor"},
+		}, {
+			Description: "editor on admin endpoint",
+			URL:         "/api/v0/console/admin",
+			Header:      user("butlers"),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to administrators."},
+		}, {
+			Description: "admin on admin endpoint",
+			URL:         "/api/v0/console/admin",
+			Header:      user("admins"),
+			JSONOutput:  gin.H{"login": "alfred", "groups": []string{"admins"}, "role": "admin"},
+		},
+	})
+}
+
+func TestTrustedProxies(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}
+	c, err := New(r, config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	endpoint := h.GinRouter.Group("/api/v0/console", c.UserAuthentication())
+	endpoint.GET("/user/info", c.UserInfoHandlerFunc)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "headers from untrusted proxy",
+			URL:         "/api/v0/console/user/info",
+			Header: func() http.Header {
+				headers := make(http.Header)
+				headers.Add("Remote-User", "alfred")
+				return headers
+			}(),
+			JSONOutput: gin.H{"login": "__default", "name": "Default User", "role": "admin"},
+		},
+	})
+
+	c.config.TrustedProxies = append(c.config.TrustedProxies, netip.MustParsePrefix("127.0.0.0/8"))
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "headers from trusted proxy",
+			URL:         "/api/v0/console/user/info",
+			Header: func() http.Header {
+				headers := make(http.Header)
+				headers.Add("Remote-User", "alfred")
+				return headers
+			}(),
+			JSONOutput: gin.H{"login": "alfred", "role": "admin"},
+		},
+	})
+}
+
+func TestDefaultRole(t *testing.T) {
+	r := reporter.NewMock(t)
+	oidc := func(config Configuration) Configuration {
+		config.OIDC.Issuer = "https://auth.example.com"
+		config.OIDC.ClientID = "akvorado"
+		config.OIDC.RedirectURL = "https://akvorado.example.com/api/v0/console/auth/callback"
+		return config
+	}
+	explicit := DefaultConfiguration()
+	explicit.DefaultRole = RoleEditor
+	cases := []struct {
+		Description string
+		Config      Configuration
+		Expected    Role
+	}{
+		{"headers", DefaultConfiguration(), RoleAdmin},
+		{"OIDC", oidc(DefaultConfiguration()), RoleViewer},
+		{"explicit with headers", explicit, RoleEditor},
+		{"explicit with OIDC", oidc(explicit), RoleEditor},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			c, err := New(r, tc.Config)
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			if c.config.DefaultRole != tc.Expected {
+				t.Fatalf("DefaultRole == %s, expected %s", c.config.DefaultRole, tc.Expected)
+			}
+		})
+	}
+}
@@ -10,6 +10,7 @@ import "akvorado/common/reporter"
 type Component struct {
 	r      *reporter.Reporter
 	config Configuration
+	oidc   *oidcComponent
 }
 
 // New creates a new authentication component.
@@ -18,6 +19,21 @@ func New(r *reporter.Reporter, configuration Configuration) (*Component, error)
 		r:      r,
 		config: configuration,
 	}
+	if configuration.OIDC.Issuer != "" {
+		oidc, err := newOIDC(configuration.OIDC)
+		if err != nil {
+			return nil, err
+		}
+		c.oidc = oidc
+	} else if len(configuration.TrustedProxies) == 0 {
+		r.Warn().Msg("authentication headers are accepted from any client, use trusted-proxies to restrict them")
+	}
+	if c.config.DefaultRole == 0 {
+		c.config.DefaultRole = RoleAdmin
+		if c.oidc != nil {
+			c.config.DefaultRole = RoleViewer
+		}
+	}
 
 	return &c, nil
 }
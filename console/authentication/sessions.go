@@ -0,0 +1,230 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// oidcLoginBurst is the number of login attempts a client can make in a row
+// before being rate limited.
+const oidcLoginBurst = 5
+
+// oidcMaxLimiters is the number of client addresses tracked for login rate
+// limiting before idle ones are forgotten.
+const oidcMaxLimiters = 1000
+
+// Session is an active session of a user authenticated with OIDC.
+type Session struct {
+	ID       string    `json:"id"`
+	Login    string    `json:"login"`
+	Address  string    `json:"address"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"last-seen"`
+	Expires  time.Time `json:"expires"`
+
+	user UserInformation
+}
+
+// sessionStore keeps the active sessions in memory. Sessions are indexed by
+// the secret token stored in the session cookie, while the public ID is used
+// by administrators to revoke them.
+type sessionStore struct {
+	config ConfigurationOIDC
+	now    func() time.Time
+
+	lock     sync.Mutex
+	sessions map[string]*Session
+
+	limitersLock sync.Mutex
+	limiters     map[string]*rate.Limiter
+}
+
+func newSessionStore(config ConfigurationOIDC) *sessionStore {
+	return &sessionStore{
+		config:   config,
+		now:      time.Now,
+		sessions: map[string]*Session{},
+		limiters: map[string]*rate.Limiter{},
+	}
+}
+
+// randomString returns a random string built from the provided number of
+// random bytes.
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("cannot generate random value: %w", err)
+	}
+	return encode(buf), nil
+}
+
+// expired tells if the session has expired.
+func (s *sessionStore) expired(session *Session, now time.Time) bool {
+	if now.After(session.Expires) {
+		return true
+	}
+	return s.config.SessionIdleTimeout > 0 && now.Sub(session.LastSeen) > s.config.SessionIdleTimeout
+}
+
+// create registers a new session for the provided user and returns its
+// token. When the user has too many sessions, the oldest ones are revoked.
+func (s *sessionStore) create(user UserInformation, address string) (string, error) {
+	token, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", err
+	}
+	now := s.now()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	userTokens := []string{}
+	for token, session := range s.sessions {
+		if s.expired(session, now) {
+			delete(s.sessions, token)
+			continue
+		}
+		if session.Login == user.Login {
+			userTokens = append(userTokens, token)
+		}
+	}
+	if limit := s.config.MaxSessionsPerUser; limit > 0 && len(userTokens) >= limit {
+		sort.Slice(userTokens, func(i, j int) bool {
+			return s.sessions[userTokens[i]].Created.Before(s.sessions[userTokens[j]].Created)
+		})
+		for _, token := range userTokens[:len(userTokens)-limit+1] {
+			delete(s.sessions, token)
+		}
+	}
+	s.sessions[token] = &Session{
+		ID:       id,
+		Login:    user.Login,
+		Address:  address,
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(s.config.SessionDuration),
+		user:     user,
+	}
+	return token, nil
+}
+
+// get returns the user information for the session matching the provided
+// token and refreshes its last use.
+func (s *sessionStore) get(token string) (UserInformation, bool) {
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	session, ok := s.sessions[token]
+	if !ok {
+		return UserInformation{}, false
+	}
+	if s.expired(session, now) {
+		delete(s.sessions, token)
+		return UserInformation{}, false
+	}
+	session.LastSeen = now
+	return session.user, true
+}
+
+// remove removes the session matching the provided token.
+func (s *sessionStore) remove(token string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.sessions, token)
+}
+
+// revoke removes the session with the provided public ID.
+func (s *sessionStore) revoke(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for token, session := range s.sessions {
+		if session.ID == id {
+			delete(s.sessions, token)
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the active sessions, sorted by login and creation time.
+func (s *sessionStore) list() []Session {
+	now := s.now()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sessions := []Session{}
+	for token, session := range s.sessions {
+		if s.expired(session, now) {
+			delete(s.sessions, token)
+			continue
+		}
+		sessions = append(sessions, *session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Login != sessions[j].Login {
+			return sessions[i].Login < sessions[j].Login
+		}
+		return sessions[i].Created.Before(sessions[j].Created)
+	})
+	return sessions
+}
+
+// allowLogin tells if a login attempt from the provided address is allowed.
+func (s *sessionStore) allowLogin(address string) bool {
+	if s.config.LoginRateLimit == 0 {
+		return true
+	}
+	s.limitersLock.Lock()
+	defer s.limitersLock.Unlock()
+	limiter, ok := s.limiters[address]
+	if !ok {
+		if len(s.limiters) >= oidcMaxLimiters {
+			// Forget clients whose limiter is back to its full capacity
+			for address, limiter := range s.limiters {
+				if limiter.Tokens() >= oidcLoginBurst {
+					delete(s.limiters, address)
+				}
+			}
+		}
+		limiter = rate.NewLimiter(s.config.LoginRateLimit, oidcLoginBurst)
+		s.limiters[address] = limiter
+	}
+	return limiter.Allow()
+}
+
+// SessionsListHandlerFunc returns the active OIDC sessions.
+func (c *Component) SessionsListHandlerFunc(gc *gin.Context) {
+	if c.oidc == nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "OIDC authentication not enabled."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"sessions": c.oidc.sessions.list()})
+}
+
+// SessionsRevokeHandlerFunc revokes an OIDC session.
+func (c *Component) SessionsRevokeHandlerFunc(gc *gin.Context) {
+	if c.oidc == nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "OIDC authentication not enabled."})
+		return
+	}
+	if !c.oidc.sessions.revoke(gc.Param("id")) {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Session not found."})
+		return
+	}
+	c.r.Info().Str("session", gc.Param("id")).Msg("session revoked")
+	gc.Status(http.StatusNoContent)
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package authentication
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+func TestSessionStore(t *testing.T) {
+	config := DefaultConfiguration().OIDC
+	config.SessionDuration = time.Hour
+	config.SessionIdleTimeout = 10 * time.Minute
+	config.MaxSessionsPerUser = 2
+	store := newSessionStore(config)
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	alfred := UserInformation{Login: "alfred", Name: "Alfred Pennyworth"}
+	bruce := UserInformation{Login: "bruce"}
+	token1, err := store.create(alfred, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("create() error:\n%+v", err)
+	}
+	if got, ok := store.get(token1); !ok {
+		t.Fatal("get() did not find session")
+	} else if diff := helpers.Diff(got, alfred); diff != "" {
+		t.Fatalf("get() (-got, +want):\n%s", diff)
+	}
+	if _, ok := store.get("unknown"); ok {
+		t.Fatal("get() found unknown session")
+	}
+
+	// Concurrent sessions: the oldest one is revoked
+	now = now.Add(time.Minute)
+	token2, _ := store.create(alfred, "192.0.2.2")
+	now = now.Add(time.Minute)
+	token3, _ := store.create(alfred, "192.0.2.3")
+	token4, _ := store.create(bruce, "192.0.2.4")
+	if _, ok := store.get(token1); ok {
+		t.Fatal("get() found session over the limit")
+	}
+	for _, token := range []string{token2, token3, token4} {
+		if _, ok := store.get(token); !ok {
+			t.Fatalf("get(%q) did not find session", token)
+		}
+	}
+	sessions := store.list()
+	got := []string{}
+	for _, session := range sessions {
+		got = append(got, fmt.Sprintf("%s %s", session.Login, session.Address))
+	}
+	if diff := helpers.Diff(got, []string{
+		"alfred 192.0.2.2",
+		"alfred 192.0.2.3",
+		"bruce 192.0.2.4",
+	}); diff != "" {
+		t.Fatalf("list() (-got, +want):\n%s", diff)
+	}
+
+	// Revocation
+	if !store.revoke(sessions[0].ID) {
+		t.Fatal("revoke() did not find session")
+	}
+	if store.revoke(sessions[0].ID) {
+		t.Fatal("revoke() found session twice")
+	}
+	if _, ok := store.get(token2); ok {
+		t.Fatal("get() found revoked session")
+	}
+
+	// Idle timeout
+	now = now.Add(8 * time.Minute)
+	store.get(token3)
+	now = now.Add(8 * time.Minute)
+	if _, ok := store.get(token3); !ok {
+		t.Fatal("get() did not find active session")
+	}
+	if _, ok := store.get(token4); ok {
+		t.Fatal("get() found idle session")
+	}
+
+	// Absolute expiration
+	for i := 0; i < 10; i++ {
+		now = now.Add(5 * time.Minute)
+		store.get(token3)
+	}
+	if _, ok := store.get(token3); ok {
+		t.Fatal("get() found expired session")
+	}
+	if diff := helpers.Diff(store.list(), []Session{}); diff != "" {
+		t.Fatalf("list() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	config := DefaultConfiguration().OIDC
+	config.LoginRateLimit = 0.001
+	store := newSessionStore(config)
+	for i := 0; i < oidcLoginBurst; i++ {
+		if !store.allowLogin("192.0.2.1") {
+			t.Fatalf("allowLogin() == false for attempt %d", i+1)
+		}
+	}
+	if store.allowLogin("192.0.2.1") {
+		t.Fatal("allowLogin() == true after burst")
+	}
+	if !store.allowLogin("192.0.2.2") {
+		t.Fatal("allowLogin() == false for another client")
+	}
+
+	config.LoginRateLimit = 0
+	store = newSessionStore(config)
+	for i := 0; i < 2*oidcLoginBurst; i++ {
+		if !store.allowLogin("192.0.2.1") {
+			t.Fatal("allowLogin() == false without limit")
+		}
+	}
+}
+
+func TestSessionsHandlers(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.OIDC.Issuer = "https://auth.example.com"
+	config.OIDC.ClientID = "akvorado"
+	config.OIDC.RedirectURL = "https://akvorado.example.com/api/v0/console/auth/callback"
+	c, err := New(r, config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/console/admin/sessions", c.SessionsListHandlerFunc)
+	h.GinRouter.DELETE("/api/v0/console/admin/sessions/:id", c.SessionsRevokeHandlerFunc)
+
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, time.UTC)
+	c.oidc.sessions.now = func() time.Time { return now }
+	if _, err := c.oidc.sessions.create(UserInformation{Login: "alfred"}, "192.0.2.1"); err != nil {
+		t.Fatalf("create() error:\n%+v", err)
+	}
+	id := c.oidc.sessions.list()[0].ID
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list sessions",
+			URL:         "/api/v0/console/admin/sessions",
+			JSONOutput: gin.H{
+				"sessions": []gin.H{
+					{
+						"id":        id,
+						"login":     "alfred",
+						"address":   "192.0.2.1",
+						"created":   "2024-05-10T10:00:00Z",
+						"last-seen": "2024-05-10T10:00:00Z",
+						"expires":   "2024-05-10T22:00:00Z",
+					},
+				},
+			},
+		}, {
+			Description: "revoke session",
+			Method:      http.MethodDelete,
+			URL:         fmt.Sprintf("/api/v0/console/admin/sessions/%s", id),
+			StatusCode:  204,
+		}, {
+			Description: "revoke unknown session",
+			Method:      http.MethodDelete,
+			URL:         fmt.Sprintf("/api/v0/console/admin/sessions/%s", id),
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Session not found."},
+		}, {
+			Description: "list without sessions",
+			URL:         "/api/v0/console/admin/sessions",
+			JSONOutput:  gin.H{"sessions": []gin.H{}},
+		},
+	})
+}
@@ -0,0 +1,345 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/console/query"
+)
+
+// ChatOpsConfiguration defines the slash command handler for Slack and
+// Mattermost.
+type ChatOpsConfiguration struct {
+	// Tokens is the list of tokens accepted from slash commands. When
+	// empty, slash commands are disabled.
+	Tokens []string
+	// ConsoleURL is the URL of the console, used to link to the
+	// corresponding graph. When empty, no link is provided.
+	ConsoleURL string `validate:"omitempty,url"`
+	// Groups is the list of groups granted to chat users to access
+	// restricted columns.
+	Groups []string
+	// DefaultRange is the period covered by a command when not specified.
+	DefaultRange time.Duration `validate:"min=1m"`
+}
+
+// chatOpsCommandInput is the request sent by Slack or Mattermost for a slash
+// command. Only the fields we use are present.
+type chatOpsCommandInput struct {
+	Token string `form:"token" json:"token"`
+	Text  string `form:"text" json:"text"`
+}
+
+// chatOpsCommandOutput is the answer to a slash command.
+type chatOpsCommandOutput struct {
+	ResponseType string `json:"response_type"` // in_channel or ephemeral
+	Text         string `json:"text"`
+}
+
+// chatCommand is a parsed slash command.
+type chatCommand struct {
+	dimensions []query.Column
+	period     time.Duration
+	limit      int
+	units      string
+	filter     query.Filter
+	filterText string // filter before validation, for the console
+}
+
+const (
+	chatOpsPoints       = 100
+	chatOpsDefaultLimit = 10
+	chatOpsUsage        = "Usage: `top DIMENSION[,DIMENSION…] [last PERIOD] [limit N] [units pps|l3bps|l2bps] [where CONDITIONS]`, " +
+		"for example `top dst-as last 1h where exporter=edge1`."
+)
+
+// chatColumnAliases are short names for some columns.
+var chatColumnAliases = map[string]string{
+	"exporter": "ExporterName",
+	"in-if":    "InIfName",
+	"out-if":   "OutIfName",
+}
+
+var (
+	chatWhereRegex     = regexp.MustCompile(`(?i)\s+where\s+`)
+	chatConditionRegex = regexp.MustCompile(`^([A-Za-z0-9-]+)(!?=)(.+)$`)
+)
+
+// chatColumn returns the name of the column matching the provided name, in
+// kebab case or not. It returns an empty string if there is none.
+func (c *Component) chatColumn(name string) string {
+	if alias, ok := chatColumnAliases[strings.ToLower(name)]; ok {
+		return alias
+	}
+	return c.fixQueryColumnName(strings.ReplaceAll(name, "-", ""))
+}
+
+// parseChatPeriod parses a period. In addition to Go durations, days and
+// weeks are accepted.
+func parseChatPeriod(input string) (time.Duration, error) {
+	multiplier := time.Duration(0)
+	switch {
+	case strings.HasSuffix(input, "d"):
+		multiplier = 24 * time.Hour
+	case strings.HasSuffix(input, "w"):
+		multiplier = 7 * 24 * time.Hour
+	}
+	if multiplier != 0 {
+		n, err := strconv.ParseUint(input[:len(input)-1], 10, 32)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("invalid period %q", input)
+		}
+		return time.Duration(n) * multiplier, nil
+	}
+	period, err := time.ParseDuration(input)
+	if err != nil || period <= 0 {
+		return 0, fmt.Errorf("invalid period %q", input)
+	}
+	return period, nil
+}
+
+// chatFilter turns the conditions of a command into a filter. Conditions
+// like "exporter=edge1" are translated to the filter language. Otherwise, the
+// conditions are expected to use the filter language.
+func (c *Component) chatFilter(conditions string) query.Filter {
+	translated := []string{}
+	for _, condition := range strings.Fields(conditions) {
+		if strings.EqualFold(condition, "and") {
+			continue
+		}
+		matches := chatConditionRegex.FindStringSubmatch(condition)
+		if matches == nil || strings.Contains(matches[3], `"`) {
+			return query.NewFilter(conditions)
+		}
+		column := c.chatColumn(matches[1])
+		if column == "" {
+			return query.NewFilter(conditions)
+		}
+		// Try without quotes first, for numbers, IP addresses, and so on.
+		expression := fmt.Sprintf("%s %s %s", column, matches[2], matches[3])
+		if filter := query.NewFilter(expression); filter.Validate(c.d.Schema) != nil {
+			expression = fmt.Sprintf(`%s %s "%s"`, column, matches[2], matches[3])
+		}
+		translated = append(translated, expression)
+	}
+	return query.NewFilter(strings.Join(translated, " AND "))
+}
+
+// parseChatCommand parses a command like "top dst-as last 1h where
+// exporter=edge1".
+func (c *Component) parseChatCommand(text string) (chatCommand, error) {
+	command := chatCommand{
+		period: c.config.ChatOps.DefaultRange,
+		limit:  chatOpsDefaultLimit,
+		units:  "l3bps",
+	}
+	if parts := chatWhereRegex.Split(strings.TrimSpace(text), 2); len(parts) == 2 {
+		text = parts[0]
+		command.filter = c.chatFilter(parts[1])
+		command.filterText = command.filter.String()
+		if err := command.filter.Validate(c.d.Schema); err != nil {
+			return command, err
+		}
+	}
+
+	fields := strings.Fields(text)
+	if len(fields) < 2 || !strings.EqualFold(fields[0], "top") {
+		return command, errors.New("unknown command")
+	}
+	for _, name := range strings.Split(fields[1], ",") {
+		column := c.chatColumn(name)
+		if column == "" {
+			return command, fmt.Errorf("unknown dimension %q", name)
+		}
+		command.dimensions = append(command.dimensions, query.NewColumn(column))
+	}
+	if err := query.Columns(command.dimensions).Validate(c.d.Schema); err != nil {
+		return command, err
+	}
+	fields = fields[2:]
+	for len(fields) > 0 {
+		if len(fields) < 2 {
+			return command, fmt.Errorf("missing value for %q", fields[0])
+		}
+		keyword, value := strings.ToLower(fields[0]), fields[1]
+		switch keyword {
+		case "last":
+			period, err := parseChatPeriod(value)
+			if err != nil {
+				return command, err
+			}
+			command.period = period
+		case "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > c.config.DimensionsLimit {
+				return command, fmt.Errorf("limit should be between 1 and %d", c.config.DimensionsLimit)
+			}
+			command.limit = limit
+		case "units":
+			value = strings.ToLower(value)
+			if !slices.Contains([]string{"pps", "l3bps", "l2bps"}, value) {
+				return command, fmt.Errorf("unknown units %q", value)
+			}
+			command.units = value
+		default:
+			return command, fmt.Errorf("unknown keyword %q", keyword)
+		}
+		fields = fields[2:]
+	}
+	return command, nil
+}
+
+// chatOpsTable formats the output of a line graph as a text table with the
+// average and the maximum of each row.
+func chatOpsTable(input graphLineHandlerInput, output graphLineHandlerOutput) string {
+	lines := [][]string{{}}
+	for _, qc := range input.Dimensions {
+		lines[0] = append(lines[0], qc.String())
+	}
+	lines[0] = append(lines[0], "Average", "Max")
+	for idx, row := range output.Rows {
+		line := append([]string{}, row...)
+		line = append(line,
+			formatXps(float64(output.Average[idx]), input.Units),
+			formatXps(float64(output.Max[idx]), input.Units))
+		lines = append(lines, line)
+	}
+	widths := make([]int, len(lines[0]))
+	for _, line := range lines {
+		for i, cell := range line {
+			widths[i] = max(widths[i], len([]rune(cell)))
+		}
+	}
+	var b strings.Builder
+	for _, line := range lines {
+		for i, cell := range line {
+			if i > 0 {
+				b.WriteString("  ")
+			}
+			padding := strings.Repeat(" ", widths[i]-len([]rune(cell)))
+			if i >= len(input.Dimensions) {
+				// Right-align values
+				b.WriteString(padding + cell)
+			} else {
+				b.WriteString(cell + padding)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// chatOpsLink returns a link to the visualize page of the console for the
+// provided input and filter.
+func (c *Component) chatOpsLink(input graphLineHandlerInput, filter string) string {
+	if c.config.ChatOps.ConsoleURL == "" {
+		return ""
+	}
+	dimensions := []string{}
+	for _, qc := range input.Dimensions {
+		dimensions = append(dimensions, qc.String())
+	}
+	start := input.Start.UTC().Format(time.RFC3339)
+	end := input.End.UTC().Format(time.RFC3339)
+	state, _ := json.Marshal(map[string]any{
+		"graphType":      "stacked",
+		"start":          start,
+		"end":            end,
+		"humanStart":     start,
+		"humanEnd":       end,
+		"dimensions":     dimensions,
+		"limit":          input.Limit,
+		"truncate-v4":    32,
+		"truncate-v6":    128,
+		"filter":         filter,
+		"units":          input.Units,
+		"bidirectional":  false,
+		"previousPeriod": false,
+	})
+	return fmt.Sprintf("%s/visualize/%s",
+		strings.TrimRight(c.config.ChatOps.ConsoleURL, "/"),
+		url.PathEscape(lzCompressToBase64(string(state))))
+}
+
+func (c *Component) chatOpsCommandHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input chatOpsCommandInput
+	if err := gc.ShouldBind(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request."})
+		return
+	}
+	if !slices.ContainsFunc(c.config.ChatOps.Tokens, func(token string) bool {
+		return subtle.ConstantTimeCompare([]byte(token), []byte(input.Token)) == 1
+	}) {
+		gc.JSON(http.StatusForbidden, gin.H{"message": "Invalid token."})
+		return
+	}
+	// Errors are sent back to the user only, with a 200 status code to be
+	// displayed by the chat platform.
+	reply := func(format string, args ...any) {
+		gc.JSON(http.StatusOK, chatOpsCommandOutput{
+			ResponseType: "ephemeral",
+			Text:         fmt.Sprintf(format, args...),
+		})
+	}
+	if text := strings.TrimSpace(input.Text); text == "" || strings.EqualFold(text, "help") {
+		reply("%s", chatOpsUsage)
+		return
+	}
+
+	command, err := c.parseChatCommand(input.Text)
+	if err != nil {
+		reply("Error: %s. %s", err, chatOpsUsage)
+		return
+	}
+	now := c.d.Clock.Now()
+	graphInput := graphLineHandlerInput{
+		graphCommonHandlerInput: graphCommonHandlerInput{
+			schema:     c.d.Schema,
+			Start:      now.Add(-command.period),
+			End:        now,
+			Dimensions: command.dimensions,
+			Limit:      command.limit,
+			Filter:     command.filter,
+			Units:      command.units,
+		},
+		Points: chatOpsPoints,
+	}
+	if err := graphInput.applyColumnAccess(c.restrictedColumnsForGroups(c.config.ChatOps.Groups)); err != nil {
+		reply("Error: %s.", err)
+		return
+	}
+	c.recordUsage("chatops", graphInput.Dimensions, graphInput.Filter)
+
+	sqlQuery := c.finalizeQuery(graphInput.toSQL())
+	output, err := c.computeGraphLine(ctx, graphInput, sqlQuery)
+	if err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		reply("Error: unable to query database.")
+		return
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "`%s`\n```\n%s```", strings.TrimSpace(input.Text), chatOpsTable(graphInput, output))
+	if link := c.chatOpsLink(graphInput, command.filterText); link != "" {
+		fmt.Fprintf(&text, "\n%s", link)
+	}
+	gc.JSON(http.StatusOK, chatOpsCommandOutput{
+		ResponseType: "in_channel",
+		Text:         text.String(),
+	})
+}
@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestParseChatPeriod(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected time.Duration
+		Error    bool
+	}{
+		{"1h", time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"2d", 48 * time.Hour, false},
+		{"1w", 7 * 24 * time.Hour, false},
+		{"0d", 0, true},
+		{"-1h", 0, true},
+		{"forever", 0, true},
+	}
+	for _, tc := range cases {
+		got, err := parseChatPeriod(tc.Input)
+		if err != nil && !tc.Error {
+			t.Errorf("parseChatPeriod(%q) error:\n%+v", tc.Input, err)
+		} else if err == nil && tc.Error {
+			t.Errorf("parseChatPeriod(%q) did not error", tc.Input)
+		} else if got != tc.Expected {
+			t.Errorf("parseChatPeriod(%q) == %s, expected %s", tc.Input, got, tc.Expected)
+		}
+	}
+}
+
+func TestParseChatCommand(t *testing.T) {
+	c, _, _, _ := NewMock(t, DefaultConfiguration())
+	type command struct {
+		Dimensions []string
+		Period     time.Duration
+		Limit      int
+		Units      string
+		Filter     string
+	}
+	cases := []struct {
+		Input    string
+		Expected command
+		Error    string
+	}{
+		{
+			Input: "top dst-as",
+			Expected: command{
+				Dimensions: []string{"DstAS"},
+				Period:     time.Hour,
+				Limit:      10,
+				Units:      "l3bps",
+			},
+		}, {
+			Input: "top src-as,exporter last 2d limit 5 units pps where exporter=edge1 and InIfBoundary=external",
+			Expected: command{
+				Dimensions: []string{"SrcAS", "ExporterName"},
+				Period:     48 * time.Hour,
+				Limit:      5,
+				Units:      "pps",
+				Filter:     `ExporterName = "edge1" AND InIfBoundary = external`,
+			},
+		}, {
+			Input: "TOP DstAS WHERE dst-as!=15169",
+			Expected: command{
+				Dimensions: []string{"DstAS"},
+				Period:     time.Hour,
+				Limit:      10,
+				Units:      "l3bps",
+				Filter:     "DstAS != 15169",
+			},
+		}, {
+			Input: "top dst-as where SrcAS = 15169 OR SrcAS = 16276",
+			Expected: command{
+				Dimensions: []string{"DstAS"},
+				Period:     time.Hour,
+				Limit:      10,
+				Units:      "l3bps",
+				Filter:     "SrcAS = 15169 OR SrcAS = 16276",
+			},
+		},
+		{Input: "bottom dst-as", Error: "unknown command"},
+		{Input: "top", Error: "unknown command"},
+		{Input: "top unknown", Error: `unknown dimension "unknown"`},
+		{Input: "top dst-as last forever", Error: `invalid period "forever"`},
+		{Input: "top dst-as last", Error: `missing value for "last"`},
+		{Input: "top dst-as limit 1000", Error: "limit should be between 1 and 50"},
+		{Input: "top dst-as units bytes", Error: `unknown units "bytes"`},
+		{Input: "top dst-as since 1h", Error: `unknown keyword "since"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Input, func(t *testing.T) {
+			got, err := c.parseChatCommand(tc.Input)
+			if tc.Error != "" {
+				if err == nil {
+					t.Fatalf("parseChatCommand() did not error")
+				}
+				if diff := helpers.Diff(err.Error(), tc.Error); diff != "" {
+					t.Fatalf("parseChatCommand() error (-got, +want):\n%s", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseChatCommand() error:\n%+v", err)
+			}
+			dimensions := []string{}
+			for _, qc := range got.dimensions {
+				dimensions = append(dimensions, qc.String())
+			}
+			if diff := helpers.Diff(command{
+				Dimensions: dimensions,
+				Period:     got.period,
+				Limit:      got.limit,
+				Units:      got.units,
+				Filter:     got.filterText,
+			}, tc.Expected); diff != "" {
+				t.Fatalf("parseChatCommand() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestChatOpsCommandHandler(t *testing.T) {
+	config := DefaultConfiguration()
+	config.ChatOps.Tokens = []string{"secret"}
+	config.ChatOps.ConsoleURL = "https://akvorado.example.com/"
+	_, h, mockConn, mockClock := NewMock(t, config)
+	mockClock.Set(time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC))
+	base := time.Date(2024, 4, 1, 11, 0, 0, 0, time.UTC)
+
+	expectedSQL := []struct {
+		Axis       uint8     `ch:"axis"`
+		Time       time.Time `ch:"time"`
+		Xps        float64   `ch:"xps"`
+		Dimensions []string  `ch:"dimensions"`
+	}{
+		{1, base, 1000, []string{"AS65000 Edge"}},
+		{1, base, 2000000, []string{"AS15169 Google"}},
+		{1, base, 500, []string{"Other"}},
+		{1, base.Add(time.Minute), 3000, []string{"AS65000 Edge"}},
+		{1, base.Add(time.Minute), 4000000, []string{"AS15169 Google"}},
+		{1, base.Add(time.Minute), 500, []string{"Other"}},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil).
+		Times(2)
+
+	state, _ := json.Marshal(map[string]any{
+		"graphType":      "stacked",
+		"start":          "2024-04-01T11:00:00Z",
+		"end":            "2024-04-01T12:00:00Z",
+		"humanStart":     "2024-04-01T11:00:00Z",
+		"humanEnd":       "2024-04-01T12:00:00Z",
+		"dimensions":     []string{"DstAS"},
+		"limit":          10,
+		"truncate-v4":    32,
+		"truncate-v6":    128,
+		"filter":         `ExporterName = "edge1"`,
+		"units":          "l3bps",
+		"bidirectional":  false,
+		"previousPeriod": false,
+	})
+	expectedText := fmt.Sprintf("`top dst-as last 1h where exporter=edge1`\n```\n"+
+		"DstAS             Average        Max\n"+
+		"AS15169 Google   3.0 Mbps   4.0 Mbps\n"+
+		"AS65000 Edge     2.0 kbps   3.0 kbps\n"+
+		"Other           500.0 bps  500.0 bps\n"+
+		"```\nhttps://akvorado.example.com/visualize/%s",
+		url.PathEscape(lzCompressToBase64(string(state))))
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "invalid token",
+			URL:         "/api/v0/console/chatops/command",
+			StatusCode:  403,
+			JSONInput:   gin.H{"token": "not secret", "text": "help"},
+			JSONOutput:  gin.H{"message": "Invalid token."},
+		}, {
+			Description: "help",
+			URL:         "/api/v0/console/chatops/command",
+			JSONInput:   gin.H{"token": "secret", "text": "help"},
+			JSONOutput: gin.H{
+				"response_type": "ephemeral",
+				"text":          chatOpsUsage,
+			},
+		}, {
+			Description: "invalid command",
+			URL:         "/api/v0/console/chatops/command",
+			JSONInput:   gin.H{"token": "secret", "text": "top nothing"},
+			JSONOutput: gin.H{
+				"response_type": "ephemeral",
+				"text":          `Error: unknown dimension "nothing". ` + chatOpsUsage,
+			},
+		}, {
+			Description: "top dst-as",
+			URL:         "/api/v0/console/chatops/command",
+			JSONInput:   gin.H{"token": "secret", "text": "top dst-as last 1h where exporter=edge1"},
+			JSONOutput: gin.H{
+				"response_type": "in_channel",
+				"text":          expectedText,
+			},
+		},
+	})
+
+	// Slack and Mattermost use form-encoded requests
+	resp, err := http.PostForm(fmt.Sprintf("http://%s/api/v0/console/chatops/command", h.LocalAddr()),
+		url.Values{"token": {"secret"}, "text": {"top dst-as last 1h where exporter=edge1"}})
+	if err != nil {
+		t.Fatalf("PostForm() error:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	var got chatOpsCommandOutput
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatalf("Decode() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, chatOpsCommandOutput{
+		ResponseType: "in_channel",
+		Text:         expectedText,
+	}); diff != "" {
+		t.Fatalf("POST /api/v0/console/chatops/command (-got, +want):\n%s", diff)
+	}
+}
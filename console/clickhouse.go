@@ -23,9 +23,13 @@ type flowsTable struct {
 	Oldest     time.Time
 }
 
+// archiveTable is the table to query archived flows, when present.
+const archiveTable = "flows_archive"
+
 // refreshFlowsTables refreshes the information we have about flows
 // tables (live one and consolidated ones). This information includes
-// the consolidation interval and the oldest available data.
+// the consolidation interval and the oldest available data. It also
+// checks if archived flows are available.
 func (c *Component) refreshFlowsTables() error {
 	ctx := c.t.Context(nil)
 	var tables []struct {
@@ -36,14 +40,20 @@ SELECT name
 FROM system.tables
 WHERE database=currentDatabase()
 AND table LIKE 'flows%'
-AND engine LIKE '%MergeTree'
+AND (engine LIKE '%MergeTree' OR (table = 'flows_archive' AND engine = 'S3'))
 `)
 	if err != nil {
 		return fmt.Errorf("cannot query flows table metadata: %w", err)
 	}
 
 	newFlowsTables := []flowsTable{}
+	newFlowsArchive := false
 	for _, table := range tables {
+		// The oldest archived flow is not queried as this is costly.
+		if table.Name == archiveTable {
+			newFlowsArchive = true
+			continue
+		}
 		// Parse resolution
 		resolution := time.Duration(0)
 		if strings.HasPrefix(table.Name, "flows_") {
@@ -76,6 +86,7 @@ AND engine LIKE '%MergeTree'
 
 	c.flowsTablesLock.Lock()
 	c.flowsTables = newFlowsTables
+	c.flowsArchive = newFlowsArchive
 	c.flowsTablesLock.Unlock()
 	return nil
 }
@@ -113,6 +124,8 @@ type context struct {
 	TimefilterStart   string
 	TimefilterEnd     string
 	Units             string
+	UnitsValue        string // value summed by Units, not for percent units
+	Exporter          string // expression identifying an exporter
 	Interval          uint64
 	ToStartOfInterval func(string) string
 }
@@ -183,26 +196,36 @@ func (c *Component) contextFunc(inputStr string) context {
 	timefilterStart := fmt.Sprintf(`toDateTime('%s', 'UTC')`, start.UTC().Format("2006-01-02 15:04:05"))
 	timefilterEnd := fmt.Sprintf(`toDateTime('%s', 'UTC')`, end.UTC().Format("2006-01-02 15:04:05"))
 	timefilter := fmt.Sprintf(`TimeReceived BETWEEN %s AND %s`, timefilterStart, timefilterEnd)
-	var units string
+	exporter := "ExporterAddress"
+	if c.config.ExporterIdentity == "name" {
+		// Fallback to the address when the name is unknown
+		exporter = "if(ExporterName = '', toString(ExporterAddress), ExporterName)"
+	}
+	var units, unitsValue string
 	switch input.Units {
 	case "pps":
-		units = `SUM(Packets*SamplingRate)`
+		unitsValue = `Packets*SamplingRate`
+		units = fmt.Sprintf(`SUM(%s)`, unitsValue)
 	case "l3bps":
-		units = `SUM(Bytes*SamplingRate*8)`
+		unitsValue = `Bytes*SamplingRate*8`
+		units = fmt.Sprintf(`SUM(%s)`, unitsValue)
 	case "l2bps":
 		// For each packet, we add the Ethernet header (14 bytes), the FCS (4
 		// bytes), the preamble and start frame delimiter (8 bytes) and the IPG
 		// (~ 12 bytes). We don't include the VLAN header (4 bytes) as it is
 		// often not used with external entities. Both sFlow and IPFIX may have
 		// a better view of that, but we don't collect it yet.
-		units = `SUM((Bytes+38*Packets)*SamplingRate*8)`
+		unitsValue = `(Bytes+38*Packets)*SamplingRate*8`
+		units = fmt.Sprintf(`SUM(%s)`, unitsValue)
 	case "inl2%":
 		// That's like l2bps, but this time we use the interface speed to get a
 		// percent value
-		units = `ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(InIfSpeed*1000000))/COUNT(DISTINCT ExporterAddress, InIfName),0)`
+		units = fmt.Sprintf(`ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(InIfSpeed*1000000))/COUNT(DISTINCT %s, InIfName),0)`,
+			exporter)
 	case "outl2%":
 		// Same but using output interface as reference
-		units = `ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(OutIfSpeed*1000000))/COUNT(DISTINCT ExporterAddress, OutIfName),0)`
+		units = fmt.Sprintf(`ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(OutIfSpeed*1000000))/COUNT(DISTINCT %s, OutIfName),0)`,
+			exporter)
 	}
 
 	c.metrics.clickhouseQueries.WithLabelValues(table).Inc()
@@ -212,6 +235,8 @@ func (c *Component) contextFunc(inputStr string) context {
 		TimefilterStart: timefilterStart,
 		TimefilterEnd:   timefilterEnd,
 		Units:           units,
+		UnitsValue:      unitsValue,
+		Exporter:        exporter,
 		Interval:        uint64(computedInterval.Seconds()),
 		ToStartOfInterval: func(field string) string {
 			return fmt.Sprintf(
@@ -241,6 +266,11 @@ func (c *Component) getBestTable(start time.Time, targetInterval time.Duration)
 				candidates = append(candidates, idx)
 			}
 		}
+		if len(candidates) == 0 && c.flowsArchive {
+			// No candidate, but flows are archived. They are not
+			// consolidated.
+			return archiveTable, time.Second
+		}
 		if len(candidates) == 0 {
 			// No candidate, fallback to the one with oldest data
 			best := 0
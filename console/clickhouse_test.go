@@ -21,7 +21,7 @@ SELECT name
 FROM system.tables
 WHERE database=currentDatabase()
 AND table LIKE 'flows%'
-AND engine LIKE '%MergeTree'
+AND (engine LIKE '%MergeTree' OR (table = 'flows_archive' AND engine = 'S3'))
 `).
 		Return(nil).
 		SetArg(1, []struct {
@@ -31,6 +31,7 @@ AND engine LIKE '%MergeTree'
 			{"flows_1h0m0s"},
 			{"flows_1m0s"},
 			{"flows_5m0s"},
+			{"flows_archive"},
 		})
 	mockConn.EXPECT().
 		Select(gomock.Any(), gomock.Any(), `SELECT MIN(TimeReceived) AS t FROM flows`).
@@ -69,12 +70,16 @@ AND engine LIKE '%MergeTree'
 	if diff := helpers.Diff(c.flowsTables, expected); diff != "" {
 		t.Fatalf("refreshFlowsTables() diff:\n%s", diff)
 	}
+	if !c.flowsArchive {
+		t.Fatal("refreshFlowsTables() did not detect archive table")
+	}
 }
 
 func TestFinalizeQuery(t *testing.T) {
 	cases := []struct {
 		Description string
 		Tables      []flowsTable
+		Archive     bool
 		Query       string
 		Context     inputContext
 		Expected    string
@@ -285,6 +290,34 @@ func TestFinalizeQuery(t *testing.T) {
 				Points: 200,
 			},
 			Expected: "SELECT InIfProvider FROM flows_5m0s",
+		}, {
+			Description: "Archive not used when data is available",
+			Query:       "SELECT InIfProvider FROM {{ .Table }}",
+			Tables: []flowsTable{
+				{"flows", time.Duration(0), time.Date(2022, 11, 6, 12, 0, 0, 0, time.UTC)},
+				{"flows_1h0m0s", time.Hour, time.Date(2022, 4, 25, 18, 0, 0, 0, time.UTC)},
+			},
+			Archive: true,
+			Context: inputContext{
+				Start:  time.Date(2022, 10, 30, 1, 0, 0, 0, time.UTC),
+				End:    time.Date(2022, 10, 30, 12, 0, 0, 0, time.UTC),
+				Points: 200,
+			},
+			Expected: "SELECT InIfProvider FROM flows_1h0m0s",
+		}, {
+			Description: "Archive used before live retention",
+			Query:       "SELECT InIfProvider FROM {{ .Table }} WHERE {{ .Timefilter }}",
+			Tables: []flowsTable{
+				{"flows", time.Duration(0), time.Date(2022, 11, 6, 12, 0, 0, 0, time.UTC)},
+				{"flows_1h0m0s", time.Hour, time.Date(2022, 4, 25, 18, 0, 0, 0, time.UTC)},
+			},
+			Archive: true,
+			Context: inputContext{
+				Start:  time.Date(2022, 3, 30, 1, 0, 0, 0, time.UTC),
+				End:    time.Date(2022, 3, 30, 12, 0, 0, 0, time.UTC),
+				Points: 200,
+			},
+			Expected: "SELECT InIfProvider FROM flows_archive WHERE TimeReceived BETWEEN toDateTime('2022-03-30 01:00:00', 'UTC') AND toDateTime('2022-03-30 12:00:00', 'UTC')",
 		},
 	}
 
@@ -292,6 +325,7 @@ func TestFinalizeQuery(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.Description, func(t *testing.T) {
 			c.flowsTables = tc.Tables
+			c.flowsArchive = tc.Archive
 			got := c.finalizeQuery(
 				fmt.Sprintf(`{{ with %s }}%s{{ end }}`, templateContext(tc.Context), tc.Query))
 			if diff := helpers.Diff(got, tc.Expected); diff != "" {
@@ -300,3 +334,29 @@ func TestFinalizeQuery(t *testing.T) {
 		})
 	}
 }
+
+func TestFinalizeQueryExporterIdentity(t *testing.T) {
+	query := fmt.Sprintf(`{{ with %s }}{{ .Exporter }} // {{ .Units }}{{ end }}`,
+		templateContext(inputContext{
+			Start:  time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+			End:    time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+			Points: 86400,
+			Units:  "inl2%",
+		}))
+
+	c, _, _, _ := NewMock(t, DefaultConfiguration())
+	got := c.finalizeQuery(query)
+	expected := "ExporterAddress // ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(InIfSpeed*1000000))/COUNT(DISTINCT ExporterAddress, InIfName),0)"
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("finalizeQuery(): (-got, +want):\n%s", diff)
+	}
+
+	config := DefaultConfiguration()
+	config.ExporterIdentity = "name"
+	c, _, _, _ = NewMock(t, config)
+	got = c.finalizeQuery(query)
+	expected = "if(ExporterName = '', toString(ExporterAddress), ExporterName) // ifNotFinite(SUM((Bytes+38*Packets)*SamplingRate*8*100/(InIfSpeed*1000000))/COUNT(DISTINCT if(ExporterName = '', toString(ExporterAddress), ExporterName), InIfName),0)"
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("finalizeQuery(): (-got, +want):\n%s", diff)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"akvorado/console/notifier"
 	"akvorado/console/query"
 
 	"github.com/gin-gonic/gin"
@@ -26,8 +27,76 @@ type Configuration struct {
 	HomepageGraphFilter string
 	// DimensionsLimit put an upper limit to the number of dimensions to return.
 	DimensionsLimit int `validate:"min=10"`
+	// FlowsLimit put an upper limit to the number of flow records returned
+	// by a single request when browsing them.
+	FlowsLimit int `validate:"min=100"`
+	// FlowsExportLimit put an upper limit to the number of flow records
+	// returned by a single export. Exports are streamed.
+	FlowsExportLimit int `validate:"min=100"`
 	// CacheTTL tells how long to keep the most costly requests in cache.
 	CacheTTL time.Duration `validate:"min=5s"`
+	// RestrictedColumns restricts access to some columns to some groups.
+	RestrictedColumns []RestrictedColumnsConfiguration `validate:"dive"`
+	// TeamFolders defines folders for saved filters, shared with the members
+	// of some groups.
+	TeamFolders []TeamFolderConfiguration `validate:"dive"`
+	// RenamedColumns maps former column names to their current names. It is
+	// used to suggest rewrites of saved filters using former names.
+	RenamedColumns map[string]string
+	// AdminGroups restricts access to administrative tools to some
+	// groups. When empty, any user can access them.
+	AdminGroups []string
+	// AlertCheckInterval tells how often alert rules are checked. 0 disables
+	// alert rules.
+	AlertCheckInterval time.Duration `validate:"eq=0|min=10s"`
+	// Notifiers defines the channels alert rules can send notifications
+	// to.
+	Notifiers []notifier.ChannelConfiguration `validate:"dive"`
+	// ReportCheckInterval tells how often scheduled reports are checked. 0
+	// disables scheduled reports.
+	ReportCheckInterval time.Duration `validate:"eq=0|min=10s"`
+	// ReportSMTP defines the SMTP server used to send scheduled reports by
+	// email.
+	ReportSMTP ReportSMTPConfiguration
+	// ExporterIdentity tells how exporters are identified when grouping
+	// flows by exporter (site deduplication, interface usage): by address
+	// or by name. Names are stable when exporters are renumbered.
+	ExporterIdentity string `validate:"oneof=address name"`
+	// Costs defines the cost of the traffic exchanged with providers.
+	Costs []CostConfiguration `validate:"dive"`
+	// CostCurrency is the currency of the prices of the costs.
+	CostCurrency string `validate:"required"`
+	// UsageTracking enables the collection of usage counters for graphs,
+	// dimensions, filters, and saved queries. Users are not recorded.
+	UsageTracking bool
+	// UsageRetention tells how long usage counters are kept.
+	UsageRetention time.Duration `validate:"min=24h"`
+	// PublicCharts defines aggregate charts available without
+	// authentication.
+	PublicCharts []PublicChartConfiguration `validate:"dive"`
+	// PublicRateLimit is the maximum number of requests per minute to the
+	// public endpoints, for all clients.
+	PublicRateLimit int `validate:"min=1"`
+	// Federation defines remote consoles to query for federated graphs.
+	Federation []FederationConfiguration `validate:"dive"`
+	// FederationTimeout is the timeout for each query to a remote console.
+	FederationTimeout time.Duration `validate:"min=1s"`
+	// ChatOps defines the slash command handler for Slack and Mattermost.
+	ChatOps ChatOpsConfiguration
+}
+
+// ReportSMTPConfiguration defines the SMTP server used to send scheduled
+// reports.
+type ReportSMTPConfiguration struct {
+	// Server is the address of the SMTP server (host:port). When empty,
+	// reports cannot be sent by email.
+	Server string `validate:"omitempty,hostname_port"`
+	// From is the sender of the emails
+	From string `validate:"required_with=Server,omitempty,email"`
+	// Username is the username to authenticate to the SMTP server
+	Username string
+	// Password is the password to authenticate to the SMTP server
+	Password string
 }
 
 // VisualizeOptionsConfiguration defines options for the "visualize" tab.
@@ -59,8 +128,20 @@ func DefaultConfiguration() Configuration {
 		},
 		HomepageTopWidgets:  []string{"src-as", "src-port", "protocol", "src-country", "etype"},
 		DimensionsLimit:     50,
+		FlowsLimit:          10000,
+		FlowsExportLimit:    10000000,
 		CacheTTL:            30 * time.Minute,
 		HomepageGraphFilter: "InIfBoundary = 'external'",
+		AlertCheckInterval:  time.Minute,
+		ReportCheckInterval: time.Minute,
+		ExporterIdentity:    "address",
+		CostCurrency:        "USD",
+		UsageRetention:      365 * 24 * time.Hour,
+		PublicRateLimit:     60,
+		FederationTimeout:   30 * time.Second,
+		ChatOps: ChatOpsConfiguration{
+			DefaultRange: time.Hour,
+		},
 	}
 }
 
@@ -80,6 +161,8 @@ func (c *Component) configHandlerFunc(gc *gin.Context) {
 		"version":                 c.config.Version,
 		"defaultVisualizeOptions": c.config.DefaultVisualizeOptions,
 		"dimensionsLimit":         c.config.DimensionsLimit,
+		"flowsLimit":              c.config.FlowsLimit,
+		"flowsExportLimit":        c.config.FlowsExportLimit,
 		"dimensions":              dimensions,
 		"truncatable":             truncatable,
 		"homepageTopWidgets":      c.config.HomepageTopWidgets,
@@ -30,6 +30,8 @@ func TestConfigHandler(t *testing.T) {
 				},
 				"homepageTopWidgets": []string{"src-as", "src-port", "protocol", "src-country", "etype"},
 				"dimensionsLimit":    50,
+				"flowsLimit":         10000,
+				"flowsExportLimit":   1e7,
 				"dimensions": []string{
 					"ExporterAddress",
 					"ExporterName",
@@ -73,6 +75,7 @@ func TestConfigHandler(t *testing.T) {
 					"OutIfProvider",
 					"InIfBoundary",
 					"OutIfBoundary",
+					"TrafficDirection",
 					"EType",
 					"Proto",
 					"SrcPort",
@@ -0,0 +1,332 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+// CostConfiguration defines the cost of the traffic exchanged with a
+// provider.
+type CostConfiguration struct {
+	// Name identifies the cost in reports.
+	Name string `validate:"required"`
+	// Provider is the provider of the interfaces, as set by the interface
+	// classifiers of the inlet.
+	Provider string `validate:"required"`
+	// ExporterName restricts the cost to the interfaces of an exporter.
+	ExporterName string
+	// InterfaceName restricts the cost to the interfaces with this name.
+	InterfaceName string
+	// Model is the billing model: "95th" bills the 95th percentile of the
+	// rate in Mbps, "volume" bills the transferred volume in GB.
+	Model string `validate:"required,oneof=95th volume"`
+	// Price is the price per Mbps and per month (95th) or per GB (volume).
+	Price float64 `validate:"min=0"`
+	// Commit is the minimum billed rate in Mbps (95th).
+	Commit float64 `validate:"min=0"`
+}
+
+// costMonth is the duration of the month used to prorate costs using the
+// 95th percentile model.
+const costMonth = 730 * time.Hour
+
+// costSampleInterval is the targeted interval between two samples for the
+// 95th percentile model.
+const costSampleInterval = 5 * time.Minute
+
+// conditions returns the SQL conditions matching the incoming and the
+// outgoing traffic of the provider.
+func (cc CostConfiguration) conditions() (string, string) {
+	in := []string{fmt.Sprintf("InIfProvider = %s", quoteSQLString(cc.Provider))}
+	out := []string{fmt.Sprintf("OutIfProvider = %s", quoteSQLString(cc.Provider))}
+	if cc.ExporterName != "" {
+		in = append(in, fmt.Sprintf("ExporterName = %s", quoteSQLString(cc.ExporterName)))
+		out = append(out, fmt.Sprintf("ExporterName = %s", quoteSQLString(cc.ExporterName)))
+	}
+	if cc.InterfaceName != "" {
+		in = append(in, fmt.Sprintf("InIfName = %s", quoteSQLString(cc.InterfaceName)))
+		out = append(out, fmt.Sprintf("OutIfName = %s", quoteSQLString(cc.InterfaceName)))
+	}
+	return templateEscape(strings.Join(in, " AND ")), templateEscape(strings.Join(out, " AND "))
+}
+
+// quoteSQLString turns a string into a ClickHouse string literal.
+func quoteSQLString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// costsHandlerInput describes the input for the /costs endpoint.
+type costsHandlerInput struct {
+	schema    *schema.Component
+	costs     []CostConfiguration
+	Start     time.Time    `json:"start" binding:"required"`
+	End       time.Time    `json:"end" binding:"required,gtfield=Start"`
+	Dimension query.Column `json:"dimension"`
+	Limit     int          `json:"limit" binding:"min=1"`
+	Filter    query.Filter `json:"filter"` // where ...
+}
+
+// costsHandlerOutput describes the output for the /costs endpoint.
+type costsHandlerOutput struct {
+	Currency string      `json:"currency"`
+	Costs    []costsCost `json:"costs"`
+	Rows     []costsRow  `json:"rows"`
+	Total    float64     `json:"total"`
+}
+type costsCost struct {
+	Name       string  `json:"name"`
+	Model      string  `json:"model"`
+	BilledMbps float64 `json:"billed-mbps,omitempty"`
+	VolumeGB   float64 `json:"volume-gb"`
+	Cost       float64 `json:"cost"`
+}
+type costsRow struct {
+	Dimension string    `json:"dimension"`
+	Costs     []float64 `json:"costs"`
+	Total     float64   `json:"total"`
+}
+
+// points returns the number of points to request for the 95th percentile.
+func (input costsHandlerInput) points() uint {
+	return max(uint(input.End.Sub(input.Start)/costSampleInterval), 1)
+}
+
+// toSQLVolumes returns the SQL query to get the incoming and outgoing volume
+// of each cost for each interval.
+func (input costsHandlerInput) toSQLVolumes() string {
+	in := make([]string, 0, len(input.costs))
+	out := make([]string, 0, len(input.costs))
+	for _, cost := range input.costs {
+		inCondition, outCondition := cost.conditions()
+		in = append(in, fmt.Sprintf("sumIf(Bytes*SamplingRate, %s)", inCondition))
+		out = append(out, fmt.Sprintf("sumIf(Bytes*SamplingRate, %s)", outCondition))
+	}
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ [%s] AS in,
+ [%s] AS out
+FROM {{ .Table }}
+WHERE {{ .Timefilter }}
+GROUP BY time
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+{{ end }}`,
+		templateContext(inputContext{
+			Start:  input.Start,
+			End:    input.End,
+			Points: input.points(),
+		}),
+		strings.Join(in, ", "),
+		strings.Join(out, ", "))
+	return strings.TrimSpace(sqlQuery)
+}
+
+// toSQLAttribution returns the SQL query to get the volume of each cost for
+// each value of the dimension.
+func (input costsHandlerInput) toSQLAttribution() string {
+	volumes := make([]string, 0, len(input.costs))
+	conditions := make([]string, 0, len(input.costs))
+	for _, cost := range input.costs {
+		inCondition, outCondition := cost.conditions()
+		condition := fmt.Sprintf("(%s) OR (%s)", inCondition, outCondition)
+		volumes = append(volumes, fmt.Sprintf("sumIf(Bytes*SamplingRate, %s)", condition))
+		conditions = append(conditions, condition)
+	}
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+SELECT
+ %s AS dimension,
+ [%s] AS volumes
+FROM {{ .Table }}
+WHERE %s AND (%s)
+GROUP BY dimension
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: requireMainTable(input.schema, []query.Column{input.Dimension}, input.Filter),
+			Points:            input.points(),
+		}),
+		input.Dimension.ToSQLSelect(input.schema),
+		strings.Join(volumes, ", "),
+		templateWhere(input.Filter),
+		strings.Join(conditions, " OR "))
+	return strings.TrimSpace(sqlQuery)
+}
+
+// percentile95 returns the 95th percentile of the provided values, like for
+// line graphs.
+func percentile95(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	if len(values) == 1 {
+		return values[0]
+	}
+	values = slices.Clone(values)
+	slices.Sort(values)
+	index := 0.95 * float64(len(values))
+	j := int(index)
+	if index == float64(j) {
+		return values[j-1]
+	}
+	return (values[j-1] + values[j]) / 2
+}
+
+func (c *Component) costsHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	if len(c.config.Costs) == 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "No cost model configured."})
+		return
+	}
+	input := costsHandlerInput{schema: c.d.Schema, costs: c.config.Costs}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Dimension.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	restricted := c.restrictedColumns(gc)
+	if err := checkFilterAccess(c.d.Schema, restricted, input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if slices.Contains(restricted, input.Dimension.String()) {
+		gc.JSON(http.StatusForbidden, gin.H{
+			"message": fmt.Sprintf("Access to column %s is restricted", input.Dimension),
+		})
+		return
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return
+	}
+	c.recordUsage("costs", []query.Column{input.Dimension}, input.Filter)
+
+	// Volume of each cost for each interval
+	sqlQuery := c.finalizeQuery(input.toSQLVolumes())
+	volumes := []struct {
+		Time time.Time `ch:"time"`
+		In   []uint64  `ch:"in"`
+		Out  []uint64  `ch:"out"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &volumes, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	interval := input.End.Sub(input.Start)
+	if len(volumes) > 1 {
+		interval = volumes[1].Time.Sub(volumes[0].Time)
+	}
+	output := costsHandlerOutput{
+		Currency: c.config.CostCurrency,
+		Costs:    make([]costsCost, len(input.costs)),
+		Rows:     []costsRow{},
+	}
+	totalVolumes := make([]uint64, len(input.costs))
+	for idx, cost := range input.costs {
+		inRates := make([]float64, len(volumes))
+		outRates := make([]float64, len(volumes))
+		for t, volume := range volumes {
+			// Filled rows have empty arrays
+			if idx < len(volume.In) && idx < len(volume.Out) {
+				inRates[t] = float64(volume.In[idx]*8) / interval.Seconds()
+				outRates[t] = float64(volume.Out[idx]*8) / interval.Seconds()
+				totalVolumes[idx] += volume.In[idx] + volume.Out[idx]
+			}
+		}
+		output.Costs[idx] = costsCost{
+			Name:     cost.Name,
+			Model:    cost.Model,
+			VolumeGB: float64(totalVolumes[idx]) / 1e9,
+		}
+		switch cost.Model {
+		case "95th":
+			billed := max(percentile95(inRates), percentile95(outRates)) / 1e6
+			billed = max(billed, cost.Commit)
+			output.Costs[idx].BilledMbps = billed
+			output.Costs[idx].Cost = billed * cost.Price * float64(input.End.Sub(input.Start)) / float64(costMonth)
+		case "volume":
+			output.Costs[idx].Cost = output.Costs[idx].VolumeGB * cost.Price
+		}
+		output.Total += output.Costs[idx].Cost
+	}
+
+	// Attribution of each cost to the dimension, using its share of the
+	// volume.
+	sqlQuery = c.finalizeQuery(input.toSQLAttribution())
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	attributions := []struct {
+		Dimension string   `ch:"dimension"`
+		Volumes   []uint64 `ch:"volumes"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &attributions, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	for _, attribution := range attributions {
+		row := costsRow{
+			Dimension: attribution.Dimension,
+			Costs:     make([]float64, len(input.costs)),
+		}
+		for idx := range input.costs {
+			if idx >= len(attribution.Volumes) || totalVolumes[idx] == 0 {
+				continue
+			}
+			share := float64(attribution.Volumes[idx]) / float64(totalVolumes[idx])
+			row.Costs[idx] = share * output.Costs[idx].Cost
+			row.Total += row.Costs[idx]
+		}
+		output.Rows = append(output.Rows, row)
+	}
+	sort.SliceStable(output.Rows, func(i, j int) bool {
+		if output.Rows[i].Total != output.Rows[j].Total {
+			return output.Rows[i].Total > output.Rows[j].Total
+		}
+		return output.Rows[i].Dimension < output.Rows[j].Dimension
+	})
+
+	// Group the remaining rows into "Other"
+	if len(output.Rows) > input.Limit {
+		other := costsRow{
+			Dimension: "Other",
+			Costs:     make([]float64, len(input.costs)),
+		}
+		for _, row := range output.Rows[input.Limit:] {
+			for idx := range row.Costs {
+				other.Costs[idx] += row.Costs[idx]
+			}
+			other.Total += row.Total
+		}
+		output.Rows = append(output.Rows[:input.Limit], other)
+	}
+
+	gc.JSON(http.StatusOK, output)
+}
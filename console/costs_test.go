@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestPercentile95(t *testing.T) {
+	cases := []struct {
+		Values   []float64
+		Expected float64
+	}{
+		{nil, 0},
+		{[]float64{10}, 10},
+		{[]float64{0, 1000}, 500},
+		{[]float64{20, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, 19},
+	}
+	for _, tc := range cases {
+		if got := percentile95(tc.Values); got != tc.Expected {
+			t.Errorf("percentile95(%v) == %v, expected %v", tc.Values, got, tc.Expected)
+		}
+	}
+}
+
+func TestCostsQuerySQL(t *testing.T) {
+	input := costsHandlerInput{
+		schema: schema.NewMock(t),
+		costs: []CostConfiguration{
+			{Name: "transit", Provider: "telia", Model: "95th", Price: 1},
+			{Name: "ix", Provider: "franceix", ExporterName: "th2-edge1", InterfaceName: "Ethernet4", Model: "volume", Price: 1},
+		},
+		Start:     time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		End:       time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		Dimension: query.NewColumn("DstAS"),
+		Limit:     10,
+		Filter:    query.NewFilter("InIfBoundary = external"),
+	}
+	if err := input.Dimension.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":288}@@ }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ [sumIf(Bytes*SamplingRate, InIfProvider = 'telia'), sumIf(Bytes*SamplingRate, InIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND InIfName = 'Ethernet4')] AS in,
+ [sumIf(Bytes*SamplingRate, OutIfProvider = 'telia'), sumIf(Bytes*SamplingRate, OutIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND OutIfName = 'Ethernet4')] AS out
+FROM {{ .Table }}
+WHERE {{ .Timefilter }}
+GROUP BY time
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	if diff := helpers.Diff(input.toSQLVolumes(), expected); diff != "" {
+		t.Fatalf("toSQLVolumes() (-got, +want):\n%s", diff)
+	}
+	expected = `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":288}@@ }}
+SELECT
+ concat(toString(DstAS), ': ', dictGetOrDefault('asns', 'name', DstAS, '???')) AS dimension,
+ [sumIf(Bytes*SamplingRate, (InIfProvider = 'telia') OR (OutIfProvider = 'telia')), sumIf(Bytes*SamplingRate, (InIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND InIfName = 'Ethernet4') OR (OutIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND OutIfName = 'Ethernet4'))] AS volumes
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (InIfBoundary = 'external') AND ((InIfProvider = 'telia') OR (OutIfProvider = 'telia') OR (InIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND InIfName = 'Ethernet4') OR (OutIfProvider = 'franceix' AND ExporterName = 'th2-edge1' AND OutIfName = 'Ethernet4'))
+GROUP BY dimension
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	if diff := helpers.Diff(input.toSQLAttribution(), expected); diff != "" {
+		t.Fatalf("toSQLAttribution() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCostsHandler(t *testing.T) {
+	config := DefaultConfiguration()
+	config.Costs = []CostConfiguration{
+		{Name: "transit", Provider: "telia", Model: "95th", Price: 2},
+		{Name: "ix", Provider: "franceix", Model: "volume", Price: 0.01},
+	}
+	_, h, mockConn, _ := NewMock(t, config)
+
+	start := time.Date(2022, 4, 10, 15, 45, 0, 0, time.UTC)
+	end := start.Add(24 * time.Hour)
+	volumes := []struct {
+		Time time.Time `ch:"time"`
+		In   []uint64  `ch:"in"`
+		Out  []uint64  `ch:"out"`
+	}{
+		{start, []uint64{37_500_000_000, 2_000_000_000}, []uint64{1_000_000, 0}},
+		{start.Add(5 * time.Minute), []uint64{}, []uint64{}},
+		{start.Add(10 * time.Minute), []uint64{0, 0}, []uint64{0, 3_000_000_000}},
+	}
+	attributions := []struct {
+		Dimension string   `ch:"dimension"`
+		Volumes   []uint64 `ch:"volumes"`
+	}{
+		{"64501: ACME Inc.", []uint64{7_500_200_000, 1_000_000_000}},
+		{"64502: ACME Corp.", []uint64{30_000_800_000, 0}},
+		{"64503: Other Inc.", []uint64{0, 3_000_000_000}},
+		{"64504: Other Corp.", []uint64{0, 1_000_000_000}},
+	}
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, volumes).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, attributions).
+			Return(nil),
+	)
+
+	// 95th percentile of [1000 Mbps, 0, 0] is 500 Mbps, for one day
+	transitCost := 500. * 2 * 24 / 730
+	ixCost := 5 * 0.01
+	share := func(volume, total float64) float64 { return volume / total }
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "costs",
+			URL:         "/api/v0/console/costs",
+			JSONInput: gin.H{
+				"start":     start,
+				"end":       end,
+				"dimension": "DstAS",
+				"limit":     2,
+				"filter":    "",
+			},
+			JSONOutput: gin.H{
+				"currency": "USD",
+				"costs": []gin.H{
+					{
+						"name":        "transit",
+						"model":       "95th",
+						"billed-mbps": 500,
+						"volume-gb":   37.501,
+						"cost":        transitCost,
+					}, {
+						"name":      "ix",
+						"model":     "volume",
+						"volume-gb": 5,
+						"cost":      ixCost,
+					},
+				},
+				"rows": []gin.H{
+					{
+						"dimension": "64502: ACME Corp.",
+						"costs":     []float64{share(30_000_800_000, 37_501_000_000) * transitCost, 0},
+						"total":     share(30_000_800_000, 37_501_000_000) * transitCost,
+					}, {
+						"dimension": "64501: ACME Inc.",
+						"costs": []float64{
+							share(7_500_200_000, 37_501_000_000) * transitCost,
+							share(1_000_000_000, 5_000_000_000) * ixCost,
+						},
+						"total": share(7_500_200_000, 37_501_000_000)*transitCost +
+							share(1_000_000_000, 5_000_000_000)*ixCost,
+					}, {
+						"dimension": "Other",
+						"costs": []float64{0,
+							share(3_000_000_000, 5_000_000_000)*ixCost +
+								share(1_000_000_000, 5_000_000_000)*ixCost},
+						"total": share(3_000_000_000, 5_000_000_000)*ixCost +
+							share(1_000_000_000, 5_000_000_000)*ixCost,
+					},
+				},
+				"total": transitCost + ixCost,
+			},
+		}, {
+			Description: "unknown dimension",
+			URL:         "/api/v0/console/costs",
+			JSONInput: gin.H{
+				"start":     start,
+				"end":       end,
+				"dimension": "Unknown",
+				"limit":     2,
+				"filter":    "",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Unknown column name Unknown"},
+		}, {
+			Description: "limit too high",
+			URL:         "/api/v0/console/costs",
+			JSONInput: gin.H{
+				"start":     start,
+				"end":       end,
+				"dimension": "DstAS",
+				"limit":     100,
+				"filter":    "",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Limit is set beyond maximum value (50)"},
+		},
+	})
+}
+
+func TestCostsHandlerWithoutCosts(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/costs",
+			JSONInput: gin.H{
+				"start":     time.Date(2022, 4, 10, 15, 45, 0, 0, time.UTC),
+				"end":       time.Date(2022, 4, 11, 15, 45, 0, 0, time.UTC),
+				"dimension": "DstAS",
+				"limit":     10,
+			},
+			StatusCode: 404,
+			JSONOutput: gin.H{"message": "No cost model configured."},
+		},
+	})
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression. For each field, the set of
+// matching values is stored as a bitmask.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// domStar and dowStar tell if the day of month or the day of week are
+	// unrestricted. When both are restricted, a day matches if either
+	// matches.
+	domStar, dowStar bool
+}
+
+// cronFields describes the bounds of each field of a cron expression.
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// cronAliases are the accepted shortcuts for common schedules.
+var cronAliases = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// parseCron parses a cron expression with 5 fields (minute, hour, day of
+// month, month, day of week). Each field accepts `*`, values, ranges
+// (`1-5`), steps (`*/15`, `0-30/10`) and lists of them (`1,15`).
+func parseCron(spec string) (cronSchedule, error) {
+	if alias, ok := cronAliases[strings.TrimSpace(spec)]; ok {
+		spec = alias
+	}
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("expected %d fields in cron expression %q, got %d",
+			len(cronFields), spec, len(parts))
+	}
+	masks := make([]uint64, len(cronFields))
+	for idx, part := range parts {
+		mask, err := parseCronField(part, cronFields[idx].min, cronFields[idx].max)
+		if err != nil {
+			return cronSchedule{}, fmt.Errorf("invalid %s in cron expression %q: %w",
+				cronFields[idx].name, spec, err)
+		}
+		masks[idx] = mask
+	}
+	// Sunday is both 0 and 7
+	if masks[4]&(1<<7) != 0 {
+		masks[4] |= 1
+	}
+	return cronSchedule{
+		minute:  masks[0],
+		hour:    masks[1],
+		dom:     masks[2],
+		month:   masks[3],
+		dow:     masks[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField parses one field of a cron expression and returns the
+// matching values as a bitmask.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, step := item, 1
+		if before, after, found := strings.Cut(item, "/"); found {
+			var err error
+			rangePart = before
+			step, err = strconv.Atoi(after)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", after)
+			}
+		}
+		start, end := min, max
+		if rangePart != "*" {
+			var err error
+			before, after, found := strings.Cut(rangePart, "-")
+			start, err = strconv.Atoi(before)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", before)
+			}
+			end = start
+			if found {
+				end, err = strconv.Atoi(after)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %q", after)
+				}
+			} else if step != 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("value out of range in %q", item)
+		}
+		for v := start; v <= end; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// matches tells if the provided time matches the schedule. Only the minute
+// resolution is considered.
+func (cs cronSchedule) matches(t time.Time) bool {
+	if cs.minute&(1<<t.Minute()) == 0 ||
+		cs.hour&(1<<t.Hour()) == 0 ||
+		cs.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	domMatch := cs.dom&(1<<t.Day()) != 0
+	dowMatch := cs.dow&(1<<int(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCron(t *testing.T) {
+	cases := []struct {
+		Schedule string
+		Time     string
+		Matches  bool
+	}{
+		{"* * * * *", "2024-04-11 15:45", true},
+		{"0 8 * * *", "2024-04-11 08:00", true},
+		{"0 8 * * *", "2024-04-11 08:01", false},
+		{"0 8 * * *", "2024-04-11 09:00", false},
+		{"*/15 * * * *", "2024-04-11 15:45", true},
+		{"*/15 * * * *", "2024-04-11 15:46", false},
+		{"5/15 * * * *", "2024-04-11 15:50", true},
+		{"0-30/10 * * * *", "2024-04-11 15:20", true},
+		{"0-30/10 * * * *", "2024-04-11 15:40", false},
+		{"0 8,18 * * *", "2024-04-11 18:00", true},
+		{"0 8 * * 1-5", "2024-04-11 08:00", true},  // Thursday
+		{"0 8 * * 1-5", "2024-04-13 08:00", false}, // Saturday
+		{"0 8 * * 7", "2024-04-14 08:00", true},    // Sunday
+		{"0 8 * * 0", "2024-04-14 08:00", true},    // Sunday
+		{"0 0 1 * *", "2024-04-01 00:00", true},
+		{"0 0 1 * *", "2024-04-02 00:00", false},
+		{"0 0 1 1 *", "2024-04-01 00:00", false},
+		// Both day of month and day of week are restricted: either matches
+		{"0 0 1 * 1", "2024-04-08 00:00", true},
+		{"0 0 1 * 1", "2024-04-01 00:00", true},
+		{"0 0 1 * 1", "2024-04-02 00:00", false},
+		{"@hourly", "2024-04-11 15:00", true},
+		{"@daily", "2024-04-11 00:00", true},
+		{"@weekly", "2024-04-14 00:00", true},
+		{"@monthly", "2024-04-01 00:00", true},
+	}
+	for _, tc := range cases {
+		schedule, err := parseCron(tc.Schedule)
+		if err != nil {
+			t.Errorf("parseCron(%q) error:\n%+v", tc.Schedule, err)
+			continue
+		}
+		tt, err := time.Parse("2006-01-02 15:04", tc.Time)
+		if err != nil {
+			t.Fatalf("time.Parse(%q) error:\n%+v", tc.Time, err)
+		}
+		if got := schedule.matches(tt); got != tc.Matches {
+			t.Errorf("parseCron(%q).matches(%s) == %v, expected %v",
+				tc.Schedule, tc.Time, got, tc.Matches)
+		}
+	}
+}
+
+func TestCronErrors(t *testing.T) {
+	for _, schedule := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"a * * * *",
+		"@yearly",
+	} {
+		if _, err := parseCron(schedule); err == nil {
+			t.Errorf("parseCron(%q) did not error", schedule)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+	"akvorado/console/query"
+)
+
+var dashboardVariableRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// dashboardExecuteHandlerInput describes the input for the
+// /dashboards/:id/queries/:query/execute endpoint.
+type dashboardExecuteHandlerInput struct {
+	Variables map[string]string `json:"variables"`
+}
+
+// validateDashboard checks the variables and the saved queries of a
+// dashboard. It returns an HTTP status code with the error.
+func (c *Component) validateDashboard(gc *gin.Context, dashboard database.Dashboard) (int, error) {
+	ctx := c.t.Context(gc.Request.Context())
+	restricted := c.restrictedColumns(gc)
+	names := map[string]bool{}
+	for _, variable := range dashboard.Variables {
+		if !dashboardVariableRegex.MatchString(variable.Name) {
+			return http.StatusBadRequest, fmt.Errorf("invalid name for variable %q", variable.Name)
+		}
+		if names[variable.Name] {
+			return http.StatusBadRequest, fmt.Errorf("duplicate variable %q", variable.Name)
+		}
+		names[variable.Name] = true
+		column := query.NewColumn(variable.Dimension)
+		if err := column.Validate(c.d.Schema); err != nil {
+			return http.StatusBadRequest, fmt.Errorf("invalid dimension for variable %q: %w", variable.Name, err)
+		}
+		if slices.Contains(restricted, column.String()) {
+			return http.StatusForbidden, fmt.Errorf("access to dimension %q is restricted", column)
+		}
+		if variable.Default != "" && !savedQueryValueRegex.MatchString(variable.Default) {
+			return http.StatusBadRequest, fmt.Errorf("invalid default value for variable %q", variable.Name)
+		}
+	}
+	// Saved queries should be usable by the users of the dashboard.
+	for _, id := range dashboard.Queries {
+		savedQuery, err := c.d.Database.GetSavedQuery(ctx, id, dashboard.User)
+		if err != nil {
+			return http.StatusBadRequest, fmt.Errorf("saved query %d not found", id)
+		}
+		if dashboard.Shared && !savedQuery.Shared {
+			return http.StatusBadRequest, fmt.Errorf("saved query %d is not shared", id)
+		}
+	}
+	return 0, nil
+}
+
+// resolveDashboardQuery expands the content of a saved query with the
+// variables of the dashboard. The provided values override the default ones.
+// When the content does not specify the period, it is set to the range of the
+// dashboard ending now.
+func resolveDashboardQuery(dashboard database.Dashboard, content string, values map[string]string, now time.Time) (string, error) {
+	parameters := map[string]string{}
+	for _, variable := range dashboard.Variables {
+		if variable.Default != "" {
+			parameters[variable.Name] = variable.Default
+		}
+	}
+	for name, value := range values {
+		if !slices.ContainsFunc(dashboard.Variables, func(v database.DashboardVariable) bool {
+			return v.Name == name
+		}) {
+			return "", fmt.Errorf("unknown variable %q", name)
+		}
+		parameters[name] = value
+	}
+	expanded, err := expandSavedQuery(content, parameters)
+	if err != nil {
+		return "", err
+	}
+
+	var request map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(expanded), &request); err != nil {
+		return "", fmt.Errorf("cannot parse saved query: %w", err)
+	}
+	if _, ok := request["start"]; !ok {
+		start, _ := json.Marshal(now.Add(-time.Duration(dashboard.Range) * time.Second))
+		request["start"] = start
+	}
+	if _, ok := request["end"]; !ok {
+		end, _ := json.Marshal(now)
+		request["end"] = end
+	}
+	resolved, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode saved query: %w", err)
+	}
+	return string(resolved), nil
+}
+
+func (c *Component) dashboardListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	dashboards, err := c.d.Database.ListDashboards(ctx, user)
+	if err != nil {
+		c.r.Err(err).Msg("unable to list dashboards")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list dashboards"})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"dashboards": dashboards})
+}
+
+func (c *Component) dashboardGetHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	dashboard, err := c.d.Database.GetDashboard(ctx, id, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "dashboard not found"})
+		return
+	}
+	gc.JSON(http.StatusOK, dashboard)
+}
+
+func (c *Component) dashboardDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteDashboard(ctx, database.Dashboard{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "dashboard not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) dashboardAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var dashboard database.Dashboard
+	if err := gc.ShouldBindJSON(&dashboard); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	dashboard.User = user
+	if status, err := c.validateDashboard(gc, dashboard); err != nil {
+		gc.JSON(status, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	id, err := c.d.Database.CreateDashboard(ctx, dashboard)
+	if err != nil {
+		c.r.Err(err).Msg("cannot create dashboard")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new dashboard"})
+		return
+	}
+	gc.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (c *Component) dashboardExecuteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	queryID, err := strconv.ParseUint(gc.Param("query"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad query ID format"})
+		return
+	}
+	var input dashboardExecuteHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	dashboard, err := c.d.Database.GetDashboard(ctx, id, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "dashboard not found"})
+		return
+	}
+	if !slices.Contains(dashboard.Queries, queryID) {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	savedQuery, err := c.d.Database.GetSavedQuery(ctx, queryID, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	content, err := resolveDashboardQuery(dashboard, savedQuery.Content, input.Variables, c.d.Clock.Now())
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	c.recordSavedQueryUsage(queryID)
+	c.executeSavedQuery(gc, savedQuery.Graph, content)
+}
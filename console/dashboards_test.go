@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/console/database"
+)
+
+func TestResolveDashboardQuery(t *testing.T) {
+	dashboard := database.Dashboard{
+		Range: 3600,
+		Variables: []database.DashboardVariable{
+			{Name: "asn", Dimension: "SrcAS", Default: "AS1299"},
+			{Name: "site", Dimension: "ExporterSite"},
+		},
+	}
+	now := time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC)
+	cases := []struct {
+		Description string
+		Content     string
+		Values      map[string]string
+		Expected    string
+		Error       bool
+	}{
+		{
+			Description: "default values and range",
+			Content:     `{"filter": "SrcAS = $asn"}`,
+			Expected:    `{"end":"2022-04-11T15:45:10Z","filter":"SrcAS = AS1299","start":"2022-04-11T14:45:10Z"}`,
+		}, {
+			Description: "provided values and period",
+			Content:     `{"start": "2022-04-10T15:45:10Z", "end": "2022-04-11T15:45:10Z", "filter": "SrcAS = $asn AND ExporterSite = '$site'"}`,
+			Values:      map[string]string{"asn": "AS174", "site": "paris"},
+			Expected:    `{"end":"2022-04-11T15:45:10Z","filter":"SrcAS = AS174 AND ExporterSite = 'paris'","start":"2022-04-10T15:45:10Z"}`,
+		}, {
+			Description: "missing value",
+			Content:     `{"filter": "ExporterSite = '$site'"}`,
+			Error:       true,
+		}, {
+			Description: "unknown variable",
+			Content:     `{"filter": "SrcAS = $asn"}`,
+			Values:      map[string]string{"provider": "telia"},
+			Error:       true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := resolveDashboardQuery(dashboard, tc.Content, tc.Values, now)
+			if err != nil && !tc.Error {
+				t.Fatalf("resolveDashboardQuery() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("resolveDashboardQuery() no error")
+			} else if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("resolveDashboardQuery() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDashboardHandlers(t *testing.T) {
+	_, h, mockConn, mockClock := NewMock(t, DefaultConfiguration())
+	mockClock.Set(time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC))
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Xps        float64  `ch:"xps"`
+			Dimensions []string `ch:"dimensions"`
+		}{
+			{1000, []string{"AS1299", "router1"}},
+		}).
+		Return(nil)
+
+	dashboard := gin.H{
+		"id":          1,
+		"user":        "__default",
+		"shared":      false,
+		"description": "transit",
+		"queries":     []int{1},
+		"refresh":     60,
+		"range":       86400,
+		"variables": []gin.H{
+			{"name": "asn", "dimension": "SrcAS", "default": "AS1299"},
+		},
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no dashboards",
+			URL:         "/api/v0/console/dashboards",
+			JSONOutput:  gin.H{"dashboards": []gin.H{}},
+		}, {
+			Description: "store one query",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "top exporters for an AS",
+				"graph":       "sankey",
+				"content": `{
+  "dimensions": ["SrcAS", "ExporterName"],
+  "limit": 10,
+  "filter": "SrcAS = $asn",
+  "units": "l3bps"
+}`,
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store dashboard with a missing query",
+			URL:         "/api/v0/console/dashboards",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "transit",
+				"queries":     []int{1, 2},
+				"range":       86400,
+			},
+			JSONOutput: gin.H{"message": "Saved query 2 not found"},
+		}, {
+			Description: "store dashboard with an invalid dimension",
+			URL:         "/api/v0/console/dashboards",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "transit",
+				"queries":     []int{1},
+				"range":       86400,
+				"variables": []gin.H{
+					{"name": "asn", "dimension": "Nope"},
+				},
+			},
+			JSONOutput: gin.H{"message": `Invalid dimension for variable "asn": unknown column name Nope`},
+		}, {
+			Description: "store shared dashboard with a private query",
+			URL:         "/api/v0/console/dashboards",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "transit",
+				"shared":      true,
+				"queries":     []int{1},
+				"range":       86400,
+			},
+			JSONOutput: gin.H{"message": "Saved query 1 is not shared"},
+		}, {
+			Description: "store dashboard",
+			URL:         "/api/v0/console/dashboards",
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "transit",
+				"queries":     []int{1},
+				"refresh":     60,
+				"range":       86400,
+				"variables": []gin.H{
+					{"name": "asn", "dimension": "SrcAS", "default": "AS1299"},
+				},
+			},
+			JSONOutput: gin.H{"id": 1},
+		}, {
+			Description: "list dashboards",
+			URL:         "/api/v0/console/dashboards",
+			JSONOutput:  gin.H{"dashboards": []gin.H{dashboard}},
+		}, {
+			Description: "get dashboard",
+			URL:         "/api/v0/console/dashboards/1",
+			JSONOutput:  dashboard,
+		}, {
+			Description: "execute query with an unknown variable",
+			URL:         "/api/v0/console/dashboards/1/queries/1/execute",
+			StatusCode:  400,
+			JSONInput:   gin.H{"variables": gin.H{"site": "paris"}},
+			JSONOutput:  gin.H{"message": `Unknown variable "site"`},
+		}, {
+			Description: "execute query",
+			URL:         "/api/v0/console/dashboards/1/queries/1/execute",
+			JSONInput:   gin.H{"variables": gin.H{}},
+			JSONOutput: gin.H{
+				"rows":  [][]string{{"AS1299", "router1"}},
+				"xps":   []int{1000},
+				"nodes": []string{"SrcAS: AS1299", "ExporterName: router1"},
+				"links": []gin.H{
+					{"source": "SrcAS: AS1299", "target": "ExporterName: router1", "xps": 1000},
+				},
+			},
+		}, {
+			Description: "execute query not in dashboard",
+			URL:         "/api/v0/console/dashboards/1/queries/2/execute",
+			StatusCode:  404,
+			JSONInput:   gin.H{"variables": gin.H{}},
+			JSONOutput:  gin.H{"message": "query not found"},
+		}, {
+			Description: "delete dashboard",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/dashboards/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "get missing dashboard",
+			URL:         "/api/v0/console/dashboards/1",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "dashboard not found"},
+		},
+	})
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// AlertRule represents a condition on the traffic periodically checked by the
+// console. For threshold rules, a notification is sent to the channel when the
+// average traffic over the provided duration is above the threshold. For
+// anomaly rules, the threshold is a percentage: a notification is sent when
+// the average traffic over the provided duration exceeds the average traffic
+// over the preceding baseline period by this percentage. When a dimension is
+// provided, the traffic is checked for each of its values. Notifications are
+// sent to the configured notifier when one is provided. Otherwise, they are
+// sent to the channel using the provided format. Alert rules are visible to
+// all users.
+type AlertRule struct {
+	ID          uint64 `json:"id"`
+	User        string `gorm:"index" json:"user"`
+	Description string `json:"description" binding:"required"`
+	Enabled     bool   `json:"enabled"`
+	Kind        string `json:"kind" binding:"omitempty,oneof=threshold anomaly"`
+	Filter      string `json:"filter"`
+	Dimension   string `json:"dimension"`
+	Units       string `json:"units" binding:"required,oneof=pps l3bps l2bps"`
+	Threshold   uint64 `json:"threshold" binding:"required,min=1"`
+	Duration    uint64 `json:"duration" binding:"required,min=60"`    // in seconds
+	Baseline    uint64 `json:"baseline" binding:"omitempty,min=3600"` // in seconds
+	Channel     string `json:"channel" binding:"required_without=Notifier,omitempty,url"`
+	Format      string `json:"format" binding:"omitempty,oneof=webhook slack alertmanager"`
+	Notifier    string `json:"notifier"`
+}
+
+// CreateAlertRule creates a new alert rule in database and returns its ID.
+func (c *Component) CreateAlertRule(ctx context.Context, a AlertRule) (uint64, error) {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&a)
+	if result.Error != nil {
+		return 0, fmt.Errorf("unable to create new alert rule: %w", result.Error)
+	}
+	return a.ID, nil
+}
+
+// ListAlertRules list alert rules. It returns the requested page and the
+// cursor to the next one.
+func (c *Component) ListAlertRules(ctx context.Context, page Page) ([]AlertRule, string, error) {
+	results, next, err := listPage(c.db.WithContext(ctx), page,
+		func(a AlertRule) uint64 { return a.ID },
+		map[string]func(AlertRule) string{
+			"description": func(a AlertRule) string { return a.Description },
+			"kind":        func(a AlertRule) string { return a.Kind },
+			"units":       func(a AlertRule) string { return a.Units },
+			"user":        func(a AlertRule) string { return a.User },
+		})
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to retrieve alert rules: %w", err)
+	}
+	return results, next, nil
+}
+
+// UpdateAlertRule updates the provided alert rule. It should be owned by the
+// same user.
+func (c *Component) UpdateAlertRule(ctx context.Context, a AlertRule) error {
+	result := c.db.WithContext(ctx).
+		Model(&AlertRule{}).
+		Where(&AlertRule{ID: a.ID, User: a.User}).
+		Select("*").
+		Omit("ID", "User").
+		Updates(&a)
+	if result.Error != nil {
+		return fmt.Errorf("cannot update alert rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching alert rule to update")
+	}
+	return nil
+}
+
+// DeleteAlertRule deletes the provided alert rule
+func (c *Component) DeleteAlertRule(ctx context.Context, a AlertRule) error {
+	result := c.db.WithContext(ctx).Where(&AlertRule{User: a.User}).Delete(&a)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete alert rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching alert rule to delete")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestAlertRule(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	// Create
+	rule1 := AlertRule{
+		ID:          17,
+		User:        "marty",
+		Description: "DDoS to customers",
+		Enabled:     true,
+		Filter:      "InIfBoundary = external",
+		Dimension:   "DstAddr",
+		Units:       "pps",
+		Threshold:   100000,
+		Duration:    300,
+		Channel:     "https://hooks.example.com/ddos",
+	}
+	id, err := c.CreateAlertRule(context.Background(), rule1)
+	if err != nil {
+		t.Fatalf("CreateAlertRule() error:\n%+v", err)
+	}
+	if id != 1 {
+		t.Fatalf("CreateAlertRule() returned ID %d, expected 1", id)
+	}
+	rule1.ID = 1
+	rule2 := AlertRule{
+		User:        "judith",
+		Description: "transit saturation",
+		Enabled:     false,
+		Filter:      "OutIfConnectivity = transit",
+		Units:       "l2bps",
+		Threshold:   90_000_000_000,
+		Duration:    600,
+		Channel:     "https://hooks.example.com/transit",
+	}
+	if _, err := c.CreateAlertRule(context.Background(), rule2); err != nil {
+		t.Fatalf("CreateAlertRule() error:\n%+v", err)
+	}
+	rule2.ID = 2
+
+	// List
+	got, _, err := c.ListAlertRules(context.Background(), Page{})
+	if err != nil {
+		t.Fatalf("ListAlertRules() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, []AlertRule{rule1, rule2}); diff != "" {
+		t.Fatalf("ListAlertRules() (-got, +want):\n%s", diff)
+	}
+
+	// Update
+	update := rule2
+	update.User = "marty"
+	update.Enabled = true
+	if err := c.UpdateAlertRule(context.Background(), update); err == nil {
+		t.Fatal("UpdateAlertRule() no error")
+	}
+	rule1.Enabled = false
+	rule1.Threshold = 200000
+	if err := c.UpdateAlertRule(context.Background(), rule1); err != nil {
+		t.Fatalf("UpdateAlertRule() error:\n%+v", err)
+	}
+	got, _, _ = c.ListAlertRules(context.Background(), Page{})
+	if diff := helpers.Diff(got, []AlertRule{rule1, rule2}); diff != "" {
+		t.Fatalf("ListAlertRules() (-got, +want):\n%s", diff)
+	}
+
+	// Delete
+	if err := c.DeleteAlertRule(context.Background(), AlertRule{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteAlertRule() no error")
+	}
+	if err := c.DeleteAlertRule(context.Background(), AlertRule{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteAlertRule() error:\n%+v", err)
+	}
+	got, _, _ = c.ListAlertRules(context.Background(), Page{})
+	if diff := helpers.Diff(got, []AlertRule{rule2}); diff != "" {
+		t.Fatalf("ListAlertRules() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Annotation represents an event (maintenance, incident) over a time range
+// to be displayed on graphs. Annotations are visible to all users.
+type Annotation struct {
+	ID        uint64    `json:"id"`
+	User      string    `gorm:"index" json:"user"`
+	StartTime time.Time `gorm:"index" json:"start" binding:"required"`
+	EndTime   time.Time `gorm:"index" json:"end" binding:"required,gtefield=StartTime"`
+	Kind      string    `json:"kind" binding:"required,oneof=maintenance incident other"`
+	Label     string    `json:"label" binding:"required"`
+}
+
+// CreateAnnotation creates a new annotation in database.
+func (c *Component) CreateAnnotation(ctx context.Context, a Annotation) error {
+	// Times are compared as strings by SQLite, use UTC everywhere.
+	a.StartTime = a.StartTime.UTC()
+	a.EndTime = a.EndTime.UTC()
+	result := c.db.WithContext(ctx).Omit("ID").Create(&a)
+	if result.Error != nil {
+		return fmt.Errorf("unable to create new annotation: %w", result.Error)
+	}
+	return nil
+}
+
+// ListAnnotations list all annotations overlapping the provided time range.
+// A zero start or end leaves the range open on this side.
+func (c *Component) ListAnnotations(ctx context.Context, start, end time.Time) ([]Annotation, error) {
+	var results []Annotation
+	query := c.db.WithContext(ctx)
+	if !start.IsZero() {
+		query = query.Where("end_time >= ?", start.UTC())
+	}
+	if !end.IsZero() {
+		query = query.Where("start_time <= ?", end.UTC())
+	}
+	result := query.Order("start_time").Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve annotations: %w", result.Error)
+	}
+	return results, nil
+}
+
+// DeleteAnnotation deletes the provided annotation
+func (c *Component) DeleteAnnotation(ctx context.Context, a Annotation) error {
+	result := c.db.WithContext(ctx).Where(&Annotation{User: a.User}).Delete(&a)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete annotation: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching annotation to delete")
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestAnnotation(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+	at := func(s string) time.Time {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	// Create
+	if err := c.CreateAnnotation(context.Background(), Annotation{
+		ID:        17,
+		User:      "marty",
+		StartTime: at("2024-03-10T02:00:00Z"),
+		EndTime:   at("2024-03-10T04:00:00Z"),
+		Kind:      "maintenance",
+		Label:     "Router upgrade",
+	}); err != nil {
+		t.Fatalf("CreateAnnotation() error:\n%+v", err)
+	}
+	if err := c.CreateAnnotation(context.Background(), Annotation{
+		User:      "judith",
+		StartTime: at("2024-03-12T15:30:00+01:00"),
+		EndTime:   at("2024-03-12T16:00:00+01:00"),
+		Kind:      "incident",
+		Label:     "Transit link down",
+	}); err != nil {
+		t.Fatalf("CreateAnnotation() error:\n%+v", err)
+	}
+	expected := []Annotation{
+		{
+			ID:        1,
+			User:      "marty",
+			StartTime: at("2024-03-10T02:00:00Z"),
+			EndTime:   at("2024-03-10T04:00:00Z"),
+			Kind:      "maintenance",
+			Label:     "Router upgrade",
+		}, {
+			ID:        2,
+			User:      "judith",
+			StartTime: at("2024-03-12T14:30:00Z"),
+			EndTime:   at("2024-03-12T15:00:00Z"),
+			Kind:      "incident",
+			Label:     "Transit link down",
+		},
+	}
+
+	// List
+	cases := []struct {
+		Description string
+		Start       time.Time
+		End         time.Time
+		Expected    []Annotation
+	}{
+		{
+			Description: "no range",
+			Expected:    expected,
+		}, {
+			Description: "overlapping start",
+			Start:       at("2024-03-10T03:00:00Z"),
+			End:         at("2024-03-11T00:00:00Z"),
+			Expected:    expected[:1],
+		}, {
+			Description: "overlapping end",
+			Start:       at("2024-03-12T00:00:00Z"),
+			End:         at("2024-03-12T14:45:00Z"),
+			Expected:    expected[1:],
+		}, {
+			Description: "open end",
+			Start:       at("2024-03-11T00:00:00Z"),
+			Expected:    expected[1:],
+		}, {
+			Description: "nothing",
+			Start:       at("2024-03-11T00:00:00Z"),
+			End:         at("2024-03-12T00:00:00Z"),
+			Expected:    []Annotation{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := c.ListAnnotations(context.Background(), tc.Start, tc.End)
+			if err != nil {
+				t.Fatalf("ListAnnotations() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("ListAnnotations() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	// Delete
+	if err := c.DeleteAnnotation(context.Background(), Annotation{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteAnnotation() no error")
+	}
+	if err := c.DeleteAnnotation(context.Background(), Annotation{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteAnnotation() error:\n%+v", err)
+	}
+	got, _ := c.ListAnnotations(context.Background(), time.Time{}, time.Time{})
+	if diff := helpers.Diff(got, expected[1:]); diff != "" {
+		t.Fatalf("ListAnnotations() (-got, +want):\n%s", diff)
+	}
+}
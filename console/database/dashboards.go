@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Dashboard represents a set of saved queries displayed together in
+// database. The queries share a refresh interval, a time range ending now and
+// variables. Variables provide the values of the parameters (`$name`) of the
+// saved queries.
+type Dashboard struct {
+	ID          uint64              `json:"id"`
+	User        string              `gorm:"index" json:"user"`
+	Shared      bool                `json:"shared"`
+	Description string              `json:"description" binding:"required"`
+	Queries     []uint64            `gorm:"serializer:json" json:"queries" binding:"required,min=1"`
+	Refresh     uint64              `json:"refresh" binding:"omitempty,min=10"` // in seconds, 0 to disable
+	Range       uint64              `json:"range" binding:"required,min=60"`    // in seconds
+	Variables   []DashboardVariable `gorm:"serializer:json" json:"variables" binding:"dive"`
+}
+
+// DashboardVariable is a variable of a dashboard. It is bound to a dimension
+// to know which values it can take.
+type DashboardVariable struct {
+	Name      string `json:"name" binding:"required"`
+	Dimension string `json:"dimension" binding:"required"`
+	Default   string `json:"default"`
+}
+
+// CreateDashboard creates a new dashboard in database and returns its ID.
+func (c *Component) CreateDashboard(ctx context.Context, d Dashboard) (uint64, error) {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&d)
+	if result.Error != nil {
+		return 0, fmt.Errorf("unable to create new dashboard: %w", result.Error)
+	}
+	return d.ID, nil
+}
+
+// ListDashboards list the dashboards for the provided user: the ones owned
+// by the user and the shared ones.
+func (c *Component) ListDashboards(ctx context.Context, user string) ([]Dashboard, error) {
+	var results []Dashboard
+	result := c.db.WithContext(ctx).
+		Where(&Dashboard{User: user}).
+		Or(&Dashboard{Shared: true}).
+		Order("id").
+		Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve dashboards: %w", result.Error)
+	}
+	return results, nil
+}
+
+// GetDashboard retrieves the dashboard with the provided ID if it is owned by
+// the provided user or shared.
+func (c *Component) GetDashboard(ctx context.Context, id uint64, user string) (Dashboard, error) {
+	var results []Dashboard
+	result := c.db.WithContext(ctx).
+		Where(&Dashboard{ID: id}).
+		Where(c.db.Where(&Dashboard{User: user}).Or(&Dashboard{Shared: true})).
+		Limit(1).
+		Find(&results)
+	if result.Error != nil {
+		return Dashboard{}, fmt.Errorf("unable to retrieve dashboard: %w", result.Error)
+	}
+	if len(results) == 0 {
+		return Dashboard{}, errors.New("no matching dashboard")
+	}
+	return results[0], nil
+}
+
+// DeleteDashboard deletes the provided dashboard
+func (c *Component) DeleteDashboard(ctx context.Context, d Dashboard) error {
+	result := c.db.WithContext(ctx).Where(&Dashboard{User: d.User}).Delete(&d)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete dashboard: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching dashboard to delete")
+	}
+	return nil
+}
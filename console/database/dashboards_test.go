@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestDashboard(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	// Create
+	id, err := c.CreateDashboard(context.Background(), Dashboard{
+		ID:          17,
+		User:        "marty",
+		Description: "marty's dashboard",
+		Queries:     []uint64{1, 2},
+		Refresh:     60,
+		Range:       3600,
+		Variables: []DashboardVariable{
+			{Name: "site", Dimension: "ExporterSite", Default: "paris"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateDashboard() error:\n%+v", err)
+	}
+	if id != 1 {
+		t.Fatalf("CreateDashboard() ID: got %d, expected 1", id)
+	}
+	if _, err := c.CreateDashboard(context.Background(), Dashboard{
+		User:        "judith",
+		Shared:      true,
+		Description: "judith's dashboard",
+		Queries:     []uint64{3},
+		Range:       86400,
+	}); err != nil {
+		t.Fatalf("CreateDashboard() error:\n%+v", err)
+	}
+	if _, err := c.CreateDashboard(context.Background(), Dashboard{
+		User:        "judith",
+		Description: "judith's private dashboard",
+		Queries:     []uint64{3},
+		Range:       86400,
+	}); err != nil {
+		t.Fatalf("CreateDashboard() error:\n%+v", err)
+	}
+
+	// List
+	got, err := c.ListDashboards(context.Background(), "marty")
+	if err != nil {
+		t.Fatalf("ListDashboards() error:\n%+v", err)
+	}
+	expected := []Dashboard{
+		{
+			ID:          1,
+			User:        "marty",
+			Description: "marty's dashboard",
+			Queries:     []uint64{1, 2},
+			Refresh:     60,
+			Range:       3600,
+			Variables: []DashboardVariable{
+				{Name: "site", Dimension: "ExporterSite", Default: "paris"},
+			},
+		}, {
+			ID:          2,
+			User:        "judith",
+			Shared:      true,
+			Description: "judith's dashboard",
+			Queries:     []uint64{3},
+			Range:       86400,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListDashboards() (-got, +want):\n%s", diff)
+	}
+
+	// Get
+	if dashboard, err := c.GetDashboard(context.Background(), 1, "marty"); err != nil {
+		t.Fatalf("GetDashboard() error:\n%+v", err)
+	} else if diff := helpers.Diff(dashboard, expected[0]); diff != "" {
+		t.Fatalf("GetDashboard() (-got, +want):\n%s", diff)
+	}
+	if dashboard, err := c.GetDashboard(context.Background(), 2, "marty"); err != nil {
+		t.Fatalf("GetDashboard() error:\n%+v", err)
+	} else if diff := helpers.Diff(dashboard, expected[1]); diff != "" {
+		t.Fatalf("GetDashboard() (-got, +want):\n%s", diff)
+	}
+	if _, err := c.GetDashboard(context.Background(), 1, "judith"); err == nil {
+		t.Fatal("GetDashboard() no error")
+	}
+	if _, err := c.GetDashboard(context.Background(), 3, "marty"); err == nil {
+		t.Fatal("GetDashboard() no error")
+	}
+
+	// Delete
+	if err := c.DeleteDashboard(context.Background(), Dashboard{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteDashboard() no error")
+	}
+	if err := c.DeleteDashboard(context.Background(), Dashboard{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteDashboard() error:\n%+v", err)
+	}
+	got, _ = c.ListDashboards(context.Background(), "marty")
+	if diff := helpers.Diff(got, expected[1:]); diff != "" {
+		t.Fatalf("ListDashboards() (-got, +want):\n%s", diff)
+	}
+}
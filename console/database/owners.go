@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ownedObjects lists the kinds of objects owned by a user, along with
+// their model.
+var ownedObjects = []struct {
+	kind  string
+	model interface{}
+}{
+	{"filters", &SavedFilter{}},
+	{"queries", &SavedQuery{}},
+	{"annotations", &Annotation{}},
+	{"snapshots", &Snapshot{}},
+	{"alert-rules", &AlertRule{}},
+	{"scheduled-reports", &ScheduledReport{}},
+}
+
+// OwnedObjects is the number of objects of each kind owned by a user.
+type OwnedObjects map[string]int64
+
+// ListOwners returns the number of objects of each kind owned by each user.
+func (c *Component) ListOwners(ctx context.Context) (map[string]OwnedObjects, error) {
+	owners := map[string]OwnedObjects{}
+	for _, object := range ownedObjects {
+		var results []struct {
+			User  string
+			Count int64
+		}
+		result := c.db.WithContext(ctx).
+			Model(object.model).
+			Select("user, COUNT(*) AS count").
+			Group("user").
+			Find(&results)
+		if result.Error != nil {
+			return nil, fmt.Errorf("unable to count %s: %w", object.kind, result.Error)
+		}
+		for _, r := range results {
+			if owners[r.User] == nil {
+				owners[r.User] = OwnedObjects{}
+			}
+			owners[r.User][object.kind] = r.Count
+		}
+	}
+	return owners, nil
+}
+
+// TransferOwnership transfers all the objects owned by a user to another
+// user. It returns the number of objects transferred for each kind.
+func (c *Component) TransferOwnership(ctx context.Context, from, to string) (OwnedObjects, error) {
+	transferred := OwnedObjects{}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, object := range ownedObjects {
+			result := tx.Model(object.model).
+				Where(map[string]interface{}{"user": from}).
+				Update("user", to)
+			if result.Error != nil {
+				return fmt.Errorf("unable to transfer %s: %w", object.kind, result.Error)
+			}
+			transferred[object.kind] = result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transferred, nil
+}
+
+// DeleteOwnedObjects deletes all the objects owned by the provided users. It
+// returns the number of objects deleted for each kind.
+func (c *Component) DeleteOwnedObjects(ctx context.Context, users []string) (OwnedObjects, error) {
+	deleted := OwnedObjects{}
+	if len(users) == 0 {
+		return deleted, nil
+	}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, object := range ownedObjects {
+			result := tx.Where(map[string]interface{}{"user": users}).
+				Delete(object.model)
+			if result.Error != nil {
+				return fmt.Errorf("unable to delete %s: %w", object.kind, result.Error)
+			}
+			deleted[object.kind] = result.RowsAffected
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
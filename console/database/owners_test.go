@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestOwners(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+	ctx := context.Background()
+
+	for _, f := range []SavedFilter{
+		{User: "marty", Description: "marty's filter", Content: "SrcAS = 12322"},
+		{User: "marty", Description: "marty's other filter", Content: "SrcAS = 2906"},
+		{User: "judith", Description: "judith's filter", Content: "SrcAS = 15169"},
+	} {
+		if err := c.CreateSavedFilter(ctx, f); err != nil {
+			t.Fatalf("CreateSavedFilter() error:\n%+v", err)
+		}
+	}
+	if _, err := c.CreateSnapshot(ctx, Snapshot{
+		User:        "emmett",
+		Description: "emmett's snapshot",
+		Graph:       "line",
+		Request:     []byte(`{}`),
+	}); err != nil {
+		t.Fatalf("CreateSnapshot() error:\n%+v", err)
+	}
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	if err := c.CreateAnnotation(ctx, Annotation{
+		User:      "marty",
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		Kind:      "maintenance",
+		Label:     "Router upgrade",
+	}); err != nil {
+		t.Fatalf("CreateAnnotation() error:\n%+v", err)
+	}
+
+	got, err := c.ListOwners(ctx)
+	if err != nil {
+		t.Fatalf("ListOwners() error:\n%+v", err)
+	}
+	expected := map[string]OwnedObjects{
+		"marty":  {"filters": 2, "annotations": 1},
+		"judith": {"filters": 1},
+		"emmett": {"snapshots": 1},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListOwners() (-got, +want):\n%s", diff)
+	}
+
+	// Transfer
+	transferred, err := c.TransferOwnership(ctx, "marty", "judith")
+	if err != nil {
+		t.Fatalf("TransferOwnership() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(transferred, OwnedObjects{
+		"filters":           2,
+		"queries":           0,
+		"annotations":       1,
+		"snapshots":         0,
+		"alert-rules":       0,
+		"scheduled-reports": 0,
+	}); diff != "" {
+		t.Fatalf("TransferOwnership() (-got, +want):\n%s", diff)
+	}
+	filters, _, err := c.ListSavedFilters(ctx, "judith", nil, Page{})
+	if err != nil {
+		t.Fatalf("ListSavedFilters() error:\n%+v", err)
+	}
+	if len(filters) != 3 {
+		t.Fatalf("ListSavedFilters() should return 3 filters, got %d", len(filters))
+	}
+
+	// Purge
+	deleted, err := c.DeleteOwnedObjects(ctx, []string{"emmett", "biff"})
+	if err != nil {
+		t.Fatalf("DeleteOwnedObjects() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(deleted, OwnedObjects{
+		"filters":           0,
+		"queries":           0,
+		"annotations":       0,
+		"snapshots":         1,
+		"alert-rules":       0,
+		"scheduled-reports": 0,
+	}); diff != "" {
+		t.Fatalf("DeleteOwnedObjects() (-got, +want):\n%s", diff)
+	}
+	got, err = c.ListOwners(ctx)
+	if err != nil {
+		t.Fatalf("ListOwners() error:\n%+v", err)
+	}
+	expected = map[string]OwnedObjects{
+		"judith": {"filters": 3, "annotations": 1},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListOwners() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPage is returned when the requested page cannot be used: unknown
+// sort field or invalid cursor.
+var ErrInvalidPage = errors.New("invalid page")
+
+// Page selects a page of objects when listing them. The zero value selects
+// all objects, sorted by ID.
+type Page struct {
+	// Cursor is the opaque cursor returned with the previous page. It is
+	// empty for the first page.
+	Cursor string
+	// Limit is the maximum number of objects to return. 0 means no limit.
+	Limit int
+	// Sort is the field to sort on, prefixed by "-" for a descending order.
+	// Empty means sorting by ID.
+	Sort string
+}
+
+// cursor is the position of the last object of a page. It contains the value
+// of the sort field and the ID to break ties.
+type cursor struct {
+	Value string `json:"v,omitempty"`
+	ID    uint64 `json:"id"`
+}
+
+func (c cursor) encode() string {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeCursor(input string) (cursor, error) {
+	var c cursor
+	decoded, err := base64.RawURLEncoding.DecodeString(input)
+	if err != nil {
+		return c, fmt.Errorf("%w: cannot decode cursor", ErrInvalidPage)
+	}
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return c, fmt.Errorf("%w: cannot decode cursor", ErrInvalidPage)
+	}
+	return c, nil
+}
+
+// listPage retrieves the requested page of objects matched by the provided
+// query. Conditions of the query should be grouped as additional conditions
+// are appended. Objects can be sorted by ID or by one of the provided
+// sortable string fields, whose name is also the name of the column. It
+// returns the cursor to get the next page, if any.
+func listPage[T any](query *gorm.DB, page Page, id func(T) uint64, sortable map[string]func(T) string) ([]T, string, error) {
+	field := strings.TrimPrefix(page.Sort, "-")
+	operator, direction := ">", "ASC"
+	if strings.HasPrefix(page.Sort, "-") {
+		operator, direction = "<", "DESC"
+	}
+	if field == "" {
+		field = "id"
+	}
+	value, ok := sortable[field]
+	if field != "id" && !ok {
+		return nil, "", fmt.Errorf("%w: cannot sort on %q", ErrInvalidPage, field)
+	}
+	if page.Limit < 0 {
+		return nil, "", fmt.Errorf("%w: negative limit", ErrInvalidPage)
+	}
+
+	if page.Cursor != "" {
+		after, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if field == "id" {
+			query = query.Where(fmt.Sprintf("id %s ?", operator), after.ID)
+		} else {
+			query = query.Where(fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))",
+				field, operator, field, operator),
+				after.Value, after.Value, after.ID)
+		}
+	}
+	if field != "id" {
+		query = query.Order(fmt.Sprintf("%s %s", field, direction))
+	}
+	query = query.Order(fmt.Sprintf("id %s", direction))
+	if page.Limit > 0 {
+		query = query.Limit(page.Limit + 1)
+	}
+
+	var results []T
+	if err := query.Find(&results).Error; err != nil {
+		return nil, "", err
+	}
+	if page.Limit == 0 || len(results) <= page.Limit {
+		return results, "", nil
+	}
+	results = results[:page.Limit]
+	last := results[len(results)-1]
+	next := cursor{ID: id(last)}
+	if field != "id" {
+		next.Value = value(last)
+	}
+	return results, next.encode(), nil
+}
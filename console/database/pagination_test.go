@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestPagination(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+	ctx := context.Background()
+
+	for _, description := range []string{"delta", "alpha", "charlie", "alpha", "bravo"} {
+		if err := c.CreateSavedFilter(ctx, SavedFilter{
+			User:        "marty",
+			Description: description,
+			Content:     "InIfBoundary = external",
+		}); err != nil {
+			t.Fatalf("CreateSavedFilter() error:\n%+v", err)
+		}
+	}
+	// Not visible to marty
+	if err := c.CreateSavedFilter(ctx, SavedFilter{
+		User:        "judith",
+		Description: "alpha",
+		Content:     "InIfBoundary = internal",
+	}); err != nil {
+		t.Fatalf("CreateSavedFilter() error:\n%+v", err)
+	}
+
+	cases := []struct {
+		Description string
+		Sort        string
+		Expected    [][]uint64
+	}{
+		{
+			Description: "by ID",
+			Expected:    [][]uint64{{1, 2}, {3, 4}, {5}},
+		}, {
+			Description: "by descending ID",
+			Sort:        "-id",
+			Expected:    [][]uint64{{5, 4}, {3, 2}, {1}},
+		}, {
+			Description: "by description",
+			Sort:        "description",
+			Expected:    [][]uint64{{2, 4}, {5, 3}, {1}},
+		}, {
+			Description: "by descending description",
+			Sort:        "-description",
+			Expected:    [][]uint64{{1, 3}, {5, 4}, {2}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := [][]uint64{}
+			page := Page{Limit: 2, Sort: tc.Sort}
+			for {
+				filters, next, err := c.ListSavedFilters(ctx, "marty", nil, page)
+				if err != nil {
+					t.Fatalf("ListSavedFilters() error:\n%+v", err)
+				}
+				ids := []uint64{}
+				for _, filter := range filters {
+					ids = append(ids, filter.ID)
+				}
+				got = append(got, ids)
+				if next == "" {
+					break
+				}
+				page.Cursor = next
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+
+	for _, page := range []Page{
+		{Sort: "content"},
+		{Sort: "description; DROP TABLE saved_filters"},
+		{Cursor: "not a cursor"},
+		{Limit: -1},
+	} {
+		if _, _, err := c.ListSavedFilters(ctx, "marty", nil, page); !errors.Is(err, ErrInvalidPage) {
+			t.Errorf("ListSavedFilters(%+v) error:\n%+v", page, err)
+		}
+	}
+}
@@ -6,6 +6,7 @@
 package database
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/glebarez/sqlite"
@@ -46,12 +47,25 @@ func New(r *reporter.Reporter, configuration Configuration) (*Component, error)
 // Start starts the database component
 func (c *Component) Start() error {
 	c.r.Info().Msg("starting database component")
-	if err := c.db.AutoMigrate(&SavedFilter{}); err != nil {
+	if err := c.db.AutoMigrate(&SavedFilter{}, &SavedQuery{}, &Annotation{}, &Snapshot{}, &Dashboard{}, &AlertRule{}, &ScheduledReport{}, &UsageCounter{}); err != nil {
 		return fmt.Errorf("cannot migrate database: %w", err)
 	}
+	c.r.RegisterReadinessCheck("console/database", c.healthcheck)
 	return c.populate()
 }
 
+// healthcheck checks the database is reachable.
+func (c *Component) healthcheck(ctx context.Context) reporter.HealthcheckResult {
+	sqlDB, err := c.db.DB()
+	if err == nil {
+		err = sqlDB.PingContext(ctx)
+	}
+	if err != nil {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "database unavailable"}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "database available"}
+}
+
 // Stop stops the database component.
 func (c *Component) Stop() error {
 	defer c.r.Info().Msg("database component stopped")
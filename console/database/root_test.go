@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	got := r.RunHealthchecks(context.Background())
+	expected := reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "database available"}
+	if diff := helpers.Diff(got.Details["console/database"].HealthcheckResult, expected); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+
+	sqlDB, _ := c.db.DB()
+	sqlDB.Close()
+	got = r.RunHealthchecks(context.Background())
+	expected = reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "database unavailable"}
+	if diff := helpers.Diff(got.Details["console/database"].HealthcheckResult, expected); diff != "" {
+		t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+	}
+}
@@ -7,15 +7,23 @@ import (
 	"context"
 	"errors"
 	"fmt"
+
+	"gorm.io/gorm"
 )
 
-// SavedFilter represents a saved filter in database.
+// SavedFilter represents a saved filter in database. A filter is visible to
+// its owner, to everyone when shared, and to the members of its team folder
+// when it is in one. Only its owner and the members of its team folder can
+// modify it.
 type SavedFilter struct {
 	ID          uint64 `json:"id"`
 	User        string `gorm:"index" json:"user"`
 	Shared      bool   `json:"shared"`
+	Folder      string `gorm:"index" json:"folder"`
 	Description string `json:"description" binding:"required"`
 	Content     string `json:"content" binding:"required"`
+	// Owned tells if the filter belongs to the user listing it.
+	Owned bool `gorm:"-" json:"owned"`
 }
 
 // To populate a few filters:
@@ -32,22 +40,67 @@ func (c *Component) CreateSavedFilter(ctx context.Context, f SavedFilter) error
 	return nil
 }
 
-// ListSavedFilters list all saved filters for the provided user
-func (c *Component) ListSavedFilters(ctx context.Context, user string) ([]SavedFilter, error) {
-	var results []SavedFilter
-	result := c.db.WithContext(ctx).
-		Where(&SavedFilter{User: user}).
-		Or(&SavedFilter{Shared: true}).
-		Find(&results)
+// ListSavedFilters list the saved filters visible to the provided user: the
+// ones owned by the user, the shared ones and the ones in the provided team
+// folders. It returns the requested page and the cursor to the next one.
+func (c *Component) ListSavedFilters(ctx context.Context, user string, folders []string, page Page) ([]SavedFilter, string, error) {
+	scope := c.db.
+		Where(map[string]interface{}{"user": user}).
+		Or(&SavedFilter{Shared: true})
+	if len(folders) > 0 {
+		scope = scope.Or(map[string]interface{}{"folder": folders})
+	}
+	results, next, err := listPage(c.db.WithContext(ctx).Where(scope), page,
+		func(f SavedFilter) uint64 { return f.ID },
+		map[string]func(SavedFilter) string{
+			"description": func(f SavedFilter) string { return f.Description },
+			"folder":      func(f SavedFilter) string { return f.Folder },
+			"user":        func(f SavedFilter) string { return f.User },
+		})
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to retrieve saved filters: %w", err)
+	}
+	for idx := range results {
+		results[idx].Owned = results[idx].User == user
+	}
+	return results, next, nil
+}
+
+// editableSavedFilters scopes a query to the saved filters the provided user
+// can modify: the ones owned by the user and the ones in the provided team
+// folders.
+func (c *Component) editableSavedFilters(ctx context.Context, user string, folders []string) *gorm.DB {
+	scope := c.db.Where(map[string]interface{}{"user": user})
+	if len(folders) > 0 {
+		scope = scope.Or(map[string]interface{}{"folder": folders})
+	}
+	return c.db.WithContext(ctx).Where(scope)
+}
+
+// UpdateSavedFilter updates the provided saved filter. It should be owned by
+// the same user or be in one of the provided team folders. The owner is
+// left unchanged.
+func (c *Component) UpdateSavedFilter(ctx context.Context, f SavedFilter, folders []string) error {
+	result := c.editableSavedFilters(ctx, f.User, folders).
+		Model(&SavedFilter{}).
+		Where(&SavedFilter{ID: f.ID}).
+		Select("*").
+		Omit("ID", "User").
+		Updates(&f)
 	if result.Error != nil {
-		return nil, fmt.Errorf("unable to retrieve saved filters: %w", result.Error)
+		return fmt.Errorf("cannot update saved filter: %w", result.Error)
 	}
-	return results, nil
+	if result.RowsAffected == 0 {
+		return errors.New("no matching saved filter to update")
+	}
+	return nil
 }
 
-// DeleteSavedFilter deletes the provided saved filter
-func (c *Component) DeleteSavedFilter(ctx context.Context, f SavedFilter) error {
-	result := c.db.WithContext(ctx).Where(&SavedFilter{User: f.User}).Delete(&f)
+// DeleteSavedFilter deletes the provided saved filter. It should be owned by
+// the same user or be in one of the provided team folders.
+func (c *Component) DeleteSavedFilter(ctx context.Context, f SavedFilter, folders []string) error {
+	result := c.editableSavedFilters(ctx, f.User, folders).
+		Delete(&SavedFilter{ID: f.ID})
 	if result.Error != nil {
 		return fmt.Errorf("cannot delete saved filter: %w", result.Error)
 	}
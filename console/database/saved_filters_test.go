@@ -43,7 +43,7 @@ func TestSavedFilter(t *testing.T) {
 	}
 
 	// List
-	got, err := c.ListSavedFilters(context.Background(), "marty")
+	got, _, err := c.ListSavedFilters(context.Background(), "marty", nil, Page{})
 	if err != nil {
 		t.Fatalf("ListSavedFilters() error:\n%+v", err)
 	}
@@ -54,6 +54,7 @@ func TestSavedFilter(t *testing.T) {
 			Shared:      false,
 			Description: "marty's filter",
 			Content:     "SrcAS = 12322",
+			Owned:       true,
 		}, {
 			ID:          2,
 			User:        "judith",
@@ -66,16 +67,20 @@ func TestSavedFilter(t *testing.T) {
 			Shared:      true,
 			Description: "marty's second filter",
 			Content:     "InIfBoundary = internal",
+			Owned:       true,
 		},
 	}); diff != "" {
 		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
 	}
 
 	// Delete
-	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1}); err != nil {
+	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1, User: "judith"}, nil); err == nil {
+		t.Fatal("DeleteSavedFilter() no error")
+	}
+	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1, User: "marty"}, nil); err != nil {
 		t.Fatalf("DeleteSavedFilter() error:\n%+v", err)
 	}
-	got, _ = c.ListSavedFilters(context.Background(), "marty")
+	got, _, _ = c.ListSavedFilters(context.Background(), "marty", nil, Page{})
 	if diff := helpers.Diff(got, []SavedFilter{
 		{
 			ID:          2,
@@ -89,13 +94,118 @@ func TestSavedFilter(t *testing.T) {
 			Shared:      true,
 			Description: "marty's second filter",
 			Content:     "InIfBoundary = internal",
+			Owned:       true,
+		},
+	}); diff != "" {
+		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
+	}
+	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1, User: "marty"}, nil); err == nil {
+		t.Fatal("DeleteSavedFilter() no error")
+	}
+}
+
+func TestSavedFilterTeamFolders(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	for _, filter := range []SavedFilter{
+		{
+			User:        "marty",
+			Folder:      "noc",
+			Description: "transit",
+			Content:     "OutIfConnectivity = transit",
+		}, {
+			User:        "judith",
+			Folder:      "peering",
+			Description: "IX",
+			Content:     "OutIfConnectivity = ix",
+		}, {
+			User:        "judith",
+			Description: "private",
+			Content:     "SrcAS = 12322",
+		},
+	} {
+		if err := c.CreateSavedFilter(context.Background(), filter); err != nil {
+			t.Fatalf("CreateSavedFilter() error:\n%+v", err)
+		}
+	}
+
+	// List
+	got, _, err := c.ListSavedFilters(context.Background(), "judith", []string{"noc"}, Page{})
+	if err != nil {
+		t.Fatalf("ListSavedFilters() error:\n%+v", err)
+	}
+	expected := []SavedFilter{
+		{
+			ID:          1,
+			User:        "marty",
+			Folder:      "noc",
+			Description: "transit",
+			Content:     "OutIfConnectivity = transit",
+		}, {
+			ID:          2,
+			User:        "judith",
+			Folder:      "peering",
+			Description: "IX",
+			Content:     "OutIfConnectivity = ix",
+			Owned:       true,
+		}, {
+			ID:          3,
+			User:        "judith",
+			Description: "private",
+			Content:     "SrcAS = 12322",
+			Owned:       true,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
+	}
+	got, _, _ = c.ListSavedFilters(context.Background(), "doc", []string{"peering"}, Page{})
+	expected = []SavedFilter{expected[1]}
+	expected[0].Owned = false
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
+	}
+
+	// Update
+	update := SavedFilter{
+		ID:          1,
+		User:        "judith",
+		Folder:      "noc",
+		Description: "transit providers",
+		Content:     "OutIfConnectivity = transit",
+	}
+	if err := c.UpdateSavedFilter(context.Background(), update, nil); err == nil {
+		t.Fatal("UpdateSavedFilter() no error")
+	}
+	if err := c.UpdateSavedFilter(context.Background(), update, []string{"noc"}); err != nil {
+		t.Fatalf("UpdateSavedFilter() error:\n%+v", err)
+	}
+	got, _, _ = c.ListSavedFilters(context.Background(), "marty", nil, Page{})
+	if diff := helpers.Diff(got, []SavedFilter{
+		{
+			ID:          1,
+			User:        "marty",
+			Folder:      "noc",
+			Description: "transit providers",
+			Content:     "OutIfConnectivity = transit",
+			Owned:       true,
 		},
 	}); diff != "" {
 		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
 	}
-	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1}); err == nil {
+
+	// Delete
+	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 3, User: "marty"}, []string{"noc"}); err == nil {
 		t.Fatal("DeleteSavedFilter() no error")
 	}
+	if err := c.DeleteSavedFilter(context.Background(), SavedFilter{ID: 1, User: "judith"}, []string{"noc"}); err != nil {
+		t.Fatalf("DeleteSavedFilter() error:\n%+v", err)
+	}
+	got, _, _ = c.ListSavedFilters(context.Background(), "marty", []string{"noc"}, Page{})
+	if diff := helpers.Diff(got, []SavedFilter{}); diff != "" {
+		t.Fatalf("ListSavedFilters() (-got, +want):\n%s", diff)
+	}
 }
 
 func TestPopulateSavedFilters(t *testing.T) {
@@ -112,7 +222,7 @@ func TestPopulateSavedFilters(t *testing.T) {
 	r := reporter.NewMock(t)
 	c := NewMock(t, r, config)
 
-	got, _ := c.ListSavedFilters(context.Background(), "marty")
+	got, _, _ := c.ListSavedFilters(context.Background(), "marty", nil, Page{})
 	if diff := helpers.Diff(got, []SavedFilter{
 		{
 			ID:          1,
@@ -133,7 +243,7 @@ func TestPopulateSavedFilters(t *testing.T) {
 
 	c.config.SavedFilters = c.config.SavedFilters[1:]
 	c.populate()
-	got, _ = c.ListSavedFilters(context.Background(), "marty")
+	got, _, _ = c.ListSavedFilters(context.Background(), "marty", nil, Page{})
 	if diff := helpers.Diff(got, []SavedFilter{
 		{
 			ID:          2,
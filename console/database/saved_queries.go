@@ -0,0 +1,81 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// SavedQuery represents a saved query template in database. The content is
+// the body of a graph request and may contain parameters (`$name`) to be
+// replaced when the query is executed.
+type SavedQuery struct {
+	ID          uint64 `json:"id"`
+	User        string `gorm:"index" json:"user"`
+	Shared      bool   `json:"shared"`
+	Description string `json:"description" binding:"required"`
+	Graph       string `json:"graph" binding:"required,oneof=line sankey"`
+	Content     string `json:"content" binding:"required"`
+}
+
+// CreateSavedQuery creates a new saved query in database.
+func (c *Component) CreateSavedQuery(ctx context.Context, q SavedQuery) error {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&q)
+	if result.Error != nil {
+		return fmt.Errorf("unable to create new saved query: %w", result.Error)
+	}
+	return nil
+}
+
+// ListSavedQueries list the saved queries for the provided user: the ones
+// owned by the user and the shared ones. It returns the requested page and
+// the cursor to the next one.
+func (c *Component) ListSavedQueries(ctx context.Context, user string, page Page) ([]SavedQuery, string, error) {
+	scope := c.db.
+		Where(&SavedQuery{User: user}).
+		Or(&SavedQuery{Shared: true})
+	results, next, err := listPage(c.db.WithContext(ctx).Where(scope), page,
+		func(q SavedQuery) uint64 { return q.ID },
+		map[string]func(SavedQuery) string{
+			"description": func(q SavedQuery) string { return q.Description },
+			"graph":       func(q SavedQuery) string { return q.Graph },
+			"user":        func(q SavedQuery) string { return q.User },
+		})
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to retrieve saved queries: %w", err)
+	}
+	return results, next, nil
+}
+
+// GetSavedQuery retrieves the saved query with the provided ID if it is
+// owned by the provided user or shared.
+func (c *Component) GetSavedQuery(ctx context.Context, id uint64, user string) (SavedQuery, error) {
+	var results []SavedQuery
+	result := c.db.WithContext(ctx).
+		Where(&SavedQuery{ID: id}).
+		Where(c.db.Where(&SavedQuery{User: user}).Or(&SavedQuery{Shared: true})).
+		Limit(1).
+		Find(&results)
+	if result.Error != nil {
+		return SavedQuery{}, fmt.Errorf("unable to retrieve saved query: %w", result.Error)
+	}
+	if len(results) == 0 {
+		return SavedQuery{}, errors.New("no matching saved query")
+	}
+	return results[0], nil
+}
+
+// DeleteSavedQuery deletes the provided saved query
+func (c *Component) DeleteSavedQuery(ctx context.Context, q SavedQuery) error {
+	result := c.db.WithContext(ctx).Where(&SavedQuery{User: q.User}).Delete(&q)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete saved query: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching saved query to delete")
+	}
+	return nil
+}
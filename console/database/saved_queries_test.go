@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSavedQuery(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	// Create
+	if err := c.CreateSavedQuery(context.Background(), SavedQuery{
+		ID:          17,
+		User:        "marty",
+		Shared:      false,
+		Description: "marty's query",
+		Graph:       "line",
+		Content:     `{"filter": "InIfProvider = $provider"}`,
+	}); err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+	if err := c.CreateSavedQuery(context.Background(), SavedQuery{
+		User:        "judith",
+		Shared:      true,
+		Description: "judith's query",
+		Graph:       "sankey",
+		Content:     `{"filter": "SrcAS = $asn"}`,
+	}); err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+
+	// List
+	got, _, err := c.ListSavedQueries(context.Background(), "marty", Page{})
+	if err != nil {
+		t.Fatalf("ListSavedQueries() error:\n%+v", err)
+	}
+	expected := []SavedQuery{
+		{
+			ID:          1,
+			User:        "marty",
+			Shared:      false,
+			Description: "marty's query",
+			Graph:       "line",
+			Content:     `{"filter": "InIfProvider = $provider"}`,
+		}, {
+			ID:          2,
+			User:        "judith",
+			Shared:      true,
+			Description: "judith's query",
+			Graph:       "sankey",
+			Content:     `{"filter": "SrcAS = $asn"}`,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListSavedQueries() (-got, +want):\n%s", diff)
+	}
+
+	// Get
+	if query, err := c.GetSavedQuery(context.Background(), 1, "marty"); err != nil {
+		t.Fatalf("GetSavedQuery() error:\n%+v", err)
+	} else if diff := helpers.Diff(query, expected[0]); diff != "" {
+		t.Fatalf("GetSavedQuery() (-got, +want):\n%s", diff)
+	}
+	if query, err := c.GetSavedQuery(context.Background(), 2, "marty"); err != nil {
+		t.Fatalf("GetSavedQuery() error:\n%+v", err)
+	} else if diff := helpers.Diff(query, expected[1]); diff != "" {
+		t.Fatalf("GetSavedQuery() (-got, +want):\n%s", diff)
+	}
+	if _, err := c.GetSavedQuery(context.Background(), 1, "judith"); err == nil {
+		t.Fatal("GetSavedQuery() no error")
+	}
+
+	// Delete
+	if err := c.DeleteSavedQuery(context.Background(), SavedQuery{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteSavedQuery() no error")
+	}
+	if err := c.DeleteSavedQuery(context.Background(), SavedQuery{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteSavedQuery() error:\n%+v", err)
+	}
+	got, _, _ = c.ListSavedQueries(context.Background(), "marty", Page{})
+	if diff := helpers.Diff(got, expected[1:]); diff != "" {
+		t.Fatalf("ListSavedQueries() (-got, +want):\n%s", diff)
+	}
+}
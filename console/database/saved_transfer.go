@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SavedItems is a set of saved filters and saved queries, used to move them
+// from one environment or one user to another.
+type SavedItems struct {
+	Filters []SavedFilter `json:"filters" binding:"dive"`
+	Queries []SavedQuery  `json:"queries" binding:"dive"`
+}
+
+// SavedItemsMapping maps the IDs of imported saved filters and saved queries
+// to their new IDs.
+type SavedItemsMapping struct {
+	Filters map[uint64]uint64 `json:"filters"`
+	Queries map[uint64]uint64 `json:"queries"`
+}
+
+// ExportSavedItems returns the saved filters and saved queries owned by the
+// provided user, as well as the saved filters in the provided team folder.
+// An empty user or folder is ignored.
+func (c *Component) ExportSavedItems(ctx context.Context, user, folder string) (SavedItems, error) {
+	items := SavedItems{
+		Filters: []SavedFilter{},
+		Queries: []SavedQuery{},
+	}
+	if user == "" && folder == "" {
+		return items, nil
+	}
+	filters := c.db.WithContext(ctx)
+	if user != "" {
+		filters = filters.Or(map[string]interface{}{"user": user})
+	}
+	if folder != "" {
+		filters = filters.Or(map[string]interface{}{"folder": folder})
+	}
+	if result := filters.Order("id").Find(&items.Filters); result.Error != nil {
+		return items, fmt.Errorf("unable to retrieve saved filters: %w", result.Error)
+	}
+	if user != "" {
+		result := c.db.WithContext(ctx).
+			Where(map[string]interface{}{"user": user}).
+			Order("id").
+			Find(&items.Queries)
+		if result.Error != nil {
+			return items, fmt.Errorf("unable to retrieve saved queries: %w", result.Error)
+		}
+	}
+	return items, nil
+}
+
+// ImportSavedItems creates the provided saved filters and saved queries with
+// new IDs. Either all of them are imported or none.
+func (c *Component) ImportSavedItems(ctx context.Context, items SavedItems) (SavedItemsMapping, error) {
+	mapping := SavedItemsMapping{
+		Filters: map[uint64]uint64{},
+		Queries: map[uint64]uint64{},
+	}
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, f := range items.Filters {
+			oldID := f.ID
+			f.ID = 0
+			if result := tx.Create(&f); result.Error != nil {
+				return fmt.Errorf("unable to import saved filter: %w", result.Error)
+			}
+			mapping.Filters[oldID] = f.ID
+		}
+		for _, q := range items.Queries {
+			oldID := q.ID
+			q.ID = 0
+			if result := tx.Create(&q); result.Error != nil {
+				return fmt.Errorf("unable to import saved query: %w", result.Error)
+			}
+			mapping.Queries[oldID] = q.ID
+		}
+		return nil
+	})
+	if err != nil {
+		return SavedItemsMapping{}, err
+	}
+	return mapping, nil
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSavedItemsTransfer(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+	ctx := context.Background()
+
+	for _, f := range []SavedFilter{
+		{User: "marty", Description: "marty's filter", Content: "SrcAS = 12322"},
+		{User: "judith", Description: "judith's filter", Content: "SrcAS = 2906"},
+		{User: "judith", Folder: "NOC", Description: "NOC filter", Content: "SrcAS = 15169"},
+	} {
+		if err := c.CreateSavedFilter(ctx, f); err != nil {
+			t.Fatalf("CreateSavedFilter() error:\n%+v", err)
+		}
+	}
+	if err := c.CreateSavedQuery(ctx, SavedQuery{
+		User:        "marty",
+		Description: "marty's query",
+		Graph:       "line",
+		Content:     `{"filter": "SrcAS = $asn"}`,
+	}); err != nil {
+		t.Fatalf("CreateSavedQuery() error:\n%+v", err)
+	}
+
+	// Export
+	got, err := c.ExportSavedItems(ctx, "marty", "NOC")
+	if err != nil {
+		t.Fatalf("ExportSavedItems() error:\n%+v", err)
+	}
+	expected := SavedItems{
+		Filters: []SavedFilter{
+			{ID: 1, User: "marty", Description: "marty's filter", Content: "SrcAS = 12322"},
+			{ID: 3, User: "judith", Folder: "NOC", Description: "NOC filter", Content: "SrcAS = 15169"},
+		},
+		Queries: []SavedQuery{
+			{ID: 1, User: "marty", Description: "marty's query", Graph: "line", Content: `{"filter": "SrcAS = $asn"}`},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ExportSavedItems() (-got, +want):\n%s", diff)
+	}
+	got, err = c.ExportSavedItems(ctx, "", "")
+	if err != nil {
+		t.Fatalf("ExportSavedItems() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, SavedItems{Filters: []SavedFilter{}, Queries: []SavedQuery{}}); diff != "" {
+		t.Fatalf("ExportSavedItems() (-got, +want):\n%s", diff)
+	}
+
+	// Import
+	items := expected
+	items.Filters[0].User = "alfred"
+	items.Filters[1].User = "alfred"
+	items.Queries[0].User = "alfred"
+	mapping, err := c.ImportSavedItems(ctx, items)
+	if err != nil {
+		t.Fatalf("ImportSavedItems() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(mapping, SavedItemsMapping{
+		Filters: map[uint64]uint64{1: 4, 3: 5},
+		Queries: map[uint64]uint64{1: 2},
+	}); diff != "" {
+		t.Fatalf("ImportSavedItems() (-got, +want):\n%s", diff)
+	}
+	got, err = c.ExportSavedItems(ctx, "alfred", "")
+	if err != nil {
+		t.Fatalf("ExportSavedItems() error:\n%+v", err)
+	}
+	expected = SavedItems{
+		Filters: []SavedFilter{
+			{ID: 4, User: "alfred", Description: "marty's filter", Content: "SrcAS = 12322"},
+			{ID: 5, User: "alfred", Folder: "NOC", Description: "NOC filter", Content: "SrcAS = 15169"},
+		},
+		Queries: []SavedQuery{
+			{ID: 2, User: "alfred", Description: "marty's query", Graph: "line", Content: `{"filter": "SrcAS = $asn"}`},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ExportSavedItems() (-got, +want):\n%s", diff)
+	}
+}
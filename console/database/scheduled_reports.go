@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ScheduledReport represents a line graph periodically rendered by the console
+// and delivered to the channel. The content is the body of a line graph
+// request, without the start and the end. The period covered by the report is
+// the provided range before the time it runs. The schedule is a cron
+// expression. The channel is either an HTTP URL or a mailto: URL.
+type ScheduledReport struct {
+	ID          uint64 `json:"id"`
+	User        string `gorm:"index" json:"user"`
+	Description string `json:"description" binding:"required"`
+	Enabled     bool   `json:"enabled"`
+	Schedule    string `json:"schedule" binding:"required"`
+	Range       uint64 `json:"range" binding:"required,min=60"` // in seconds
+	Content     string `json:"content" binding:"required"`
+	Channel     string `json:"channel" binding:"required,url"`
+}
+
+// CreateScheduledReport creates a new scheduled report in database and returns
+// its ID.
+func (c *Component) CreateScheduledReport(ctx context.Context, r ScheduledReport) (uint64, error) {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&r)
+	if result.Error != nil {
+		return 0, fmt.Errorf("unable to create new scheduled report: %w", result.Error)
+	}
+	return r.ID, nil
+}
+
+// ListScheduledReports list all scheduled reports for the provided user. When
+// the user is empty, reports for all users are returned.
+func (c *Component) ListScheduledReports(ctx context.Context, user string) ([]ScheduledReport, error) {
+	var results []ScheduledReport
+	result := c.db.WithContext(ctx).
+		Where(&ScheduledReport{User: user}).
+		Order("id").
+		Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve scheduled reports: %w", result.Error)
+	}
+	return results, nil
+}
+
+// GetScheduledReport retrieves the scheduled report with the provided ID if
+// it is owned by the provided user.
+func (c *Component) GetScheduledReport(ctx context.Context, id uint64, user string) (ScheduledReport, error) {
+	var results []ScheduledReport
+	result := c.db.WithContext(ctx).
+		Where(&ScheduledReport{ID: id, User: user}).
+		Limit(1).
+		Find(&results)
+	if result.Error != nil {
+		return ScheduledReport{}, fmt.Errorf("unable to retrieve scheduled report: %w", result.Error)
+	}
+	if len(results) == 0 {
+		return ScheduledReport{}, errors.New("no matching scheduled report")
+	}
+	return results[0], nil
+}
+
+// UpdateScheduledReport updates the provided scheduled report. It should be
+// owned by the same user.
+func (c *Component) UpdateScheduledReport(ctx context.Context, r ScheduledReport) error {
+	result := c.db.WithContext(ctx).
+		Model(&ScheduledReport{}).
+		Where(&ScheduledReport{ID: r.ID, User: r.User}).
+		Select("*").
+		Omit("ID", "User").
+		Updates(&r)
+	if result.Error != nil {
+		return fmt.Errorf("cannot update scheduled report: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching scheduled report to update")
+	}
+	return nil
+}
+
+// DeleteScheduledReport deletes the provided scheduled report
+func (c *Component) DeleteScheduledReport(ctx context.Context, r ScheduledReport) error {
+	result := c.db.WithContext(ctx).Where(&ScheduledReport{User: r.User}).Delete(&r)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete scheduled report: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching scheduled report to delete")
+	}
+	return nil
+}
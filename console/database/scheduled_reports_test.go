@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestScheduledReport(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	// Create
+	report1 := ScheduledReport{
+		ID:          17,
+		User:        "marty",
+		Description: "Daily top AS",
+		Enabled:     true,
+		Schedule:    "0 8 * * *",
+		Range:       86400,
+		Content:     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+		Channel:     "mailto:noc@example.com",
+	}
+	id, err := c.CreateScheduledReport(context.Background(), report1)
+	if err != nil {
+		t.Fatalf("CreateScheduledReport() error:\n%+v", err)
+	}
+	if id != 1 {
+		t.Fatalf("CreateScheduledReport() returned ID %d, expected 1", id)
+	}
+	report1.ID = 1
+	report2 := ScheduledReport{
+		User:        "judith",
+		Description: "Weekly transit usage",
+		Enabled:     false,
+		Schedule:    "0 8 * * 1",
+		Range:       7 * 86400,
+		Content:     `{"filter": "OutIfConnectivity = transit", "limit": 10, "units": "l2bps"}`,
+		Channel:     "https://hooks.example.com/transit",
+	}
+	if _, err := c.CreateScheduledReport(context.Background(), report2); err != nil {
+		t.Fatalf("CreateScheduledReport() error:\n%+v", err)
+	}
+	report2.ID = 2
+
+	// List
+	got, err := c.ListScheduledReports(context.Background(), "")
+	if err != nil {
+		t.Fatalf("ListScheduledReports() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, []ScheduledReport{report1, report2}); diff != "" {
+		t.Fatalf("ListScheduledReports() (-got, +want):\n%s", diff)
+	}
+	got, _ = c.ListScheduledReports(context.Background(), "judith")
+	if diff := helpers.Diff(got, []ScheduledReport{report2}); diff != "" {
+		t.Fatalf("ListScheduledReports() (-got, +want):\n%s", diff)
+	}
+
+	// Get
+	if _, err := c.GetScheduledReport(context.Background(), 1, "judith"); err == nil {
+		t.Fatal("GetScheduledReport() no error")
+	}
+	report, err := c.GetScheduledReport(context.Background(), 1, "marty")
+	if err != nil {
+		t.Fatalf("GetScheduledReport() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(report, report1); diff != "" {
+		t.Fatalf("GetScheduledReport() (-got, +want):\n%s", diff)
+	}
+
+	// Update
+	update := report2
+	update.User = "marty"
+	update.Enabled = true
+	if err := c.UpdateScheduledReport(context.Background(), update); err == nil {
+		t.Fatal("UpdateScheduledReport() no error")
+	}
+	report1.Enabled = false
+	report1.Schedule = "0 9 * * *"
+	if err := c.UpdateScheduledReport(context.Background(), report1); err != nil {
+		t.Fatalf("UpdateScheduledReport() error:\n%+v", err)
+	}
+	got, _ = c.ListScheduledReports(context.Background(), "")
+	if diff := helpers.Diff(got, []ScheduledReport{report1, report2}); diff != "" {
+		t.Fatalf("ListScheduledReports() (-got, +want):\n%s", diff)
+	}
+
+	// Delete
+	if err := c.DeleteScheduledReport(context.Background(), ScheduledReport{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteScheduledReport() no error")
+	}
+	if err := c.DeleteScheduledReport(context.Background(), ScheduledReport{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteScheduledReport() error:\n%+v", err)
+	}
+	got, _ = c.ListScheduledReports(context.Background(), "")
+	if diff := helpers.Diff(got, []ScheduledReport{report2}); diff != "" {
+		t.Fatalf("ListScheduledReports() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,82 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Snapshot represents the frozen result of a graph request. It stays
+// available after the flows it was computed from are expired.
+type Snapshot struct {
+	ID          uint64          `json:"id"`
+	User        string          `gorm:"index" json:"user"`
+	Shared      bool            `json:"shared"`
+	Description string          `json:"description" binding:"required"`
+	Graph       string          `json:"graph" binding:"required,oneof=line sankey"`
+	Request     json.RawMessage `json:"request" binding:"required"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	CreatedAt   time.Time       `json:"created"`
+	// RestrictedColumns is the comma-separated list of columns the creator
+	// of the snapshot could not access when computing its result.
+	RestrictedColumns string `json:"-"`
+}
+
+// CreateSnapshot creates a new snapshot in database and returns its ID.
+func (c *Component) CreateSnapshot(ctx context.Context, s Snapshot) (uint64, error) {
+	result := c.db.WithContext(ctx).Omit("ID").Create(&s)
+	if result.Error != nil {
+		return 0, fmt.Errorf("unable to create new snapshot: %w", result.Error)
+	}
+	return s.ID, nil
+}
+
+// ListSnapshots list all snapshots for the provided user, without their
+// result.
+func (c *Component) ListSnapshots(ctx context.Context, user string) ([]Snapshot, error) {
+	var results []Snapshot
+	result := c.db.WithContext(ctx).
+		Omit("Result").
+		Where(&Snapshot{User: user}).
+		Or(&Snapshot{Shared: true}).
+		Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve snapshots: %w", result.Error)
+	}
+	return results, nil
+}
+
+// GetSnapshot retrieves the snapshot with the provided ID if it is owned by
+// the provided user or shared.
+func (c *Component) GetSnapshot(ctx context.Context, id uint64, user string) (Snapshot, error) {
+	var results []Snapshot
+	result := c.db.WithContext(ctx).
+		Where(&Snapshot{ID: id}).
+		Where(c.db.Where(&Snapshot{User: user}).Or(&Snapshot{Shared: true})).
+		Limit(1).
+		Find(&results)
+	if result.Error != nil {
+		return Snapshot{}, fmt.Errorf("unable to retrieve snapshot: %w", result.Error)
+	}
+	if len(results) == 0 {
+		return Snapshot{}, errors.New("no matching snapshot")
+	}
+	return results[0], nil
+}
+
+// DeleteSnapshot deletes the provided snapshot
+func (c *Component) DeleteSnapshot(ctx context.Context, s Snapshot) error {
+	result := c.db.WithContext(ctx).Where(&Snapshot{User: s.User}).Delete(&s)
+	if result.Error != nil {
+		return fmt.Errorf("cannot delete snapshot: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no matching snapshot to delete")
+	}
+	return nil
+}
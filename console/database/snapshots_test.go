@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	// Create
+	id, err := c.CreateSnapshot(context.Background(), Snapshot{
+		ID:          17,
+		User:        "marty",
+		Shared:      false,
+		Description: "DDoS on 2024-03-10",
+		Graph:       "sankey",
+		Request:     json.RawMessage(`{"dimensions":["SrcAS"]}`),
+		Result:      json.RawMessage(`{"rows":[["AS1299"]]}`),
+	})
+	if err != nil {
+		t.Fatalf("CreateSnapshot() error:\n%+v", err)
+	}
+	if id != 1 {
+		t.Fatalf("CreateSnapshot() returned ID %d, expected 1", id)
+	}
+	if _, err := c.CreateSnapshot(context.Background(), Snapshot{
+		User:        "judith",
+		Shared:      true,
+		Description: "transit outage",
+		Graph:       "line",
+		Request:     json.RawMessage(`{"dimensions":["InIfProvider"]}`),
+		Result:      json.RawMessage(`{"t":[]}`),
+	}); err != nil {
+		t.Fatalf("CreateSnapshot() error:\n%+v", err)
+	}
+
+	// List
+	got, err := c.ListSnapshots(context.Background(), "marty")
+	if err != nil {
+		t.Fatalf("ListSnapshots() error:\n%+v", err)
+	}
+	for idx := range got {
+		if time.Since(got[idx].CreatedAt) > time.Minute {
+			t.Errorf("ListSnapshots() created time %s is not recent", got[idx].CreatedAt)
+		}
+		got[idx].CreatedAt = time.Time{}
+	}
+	expected := []Snapshot{
+		{
+			ID:          1,
+			User:        "marty",
+			Shared:      false,
+			Description: "DDoS on 2024-03-10",
+			Graph:       "sankey",
+			Request:     json.RawMessage(`{"dimensions":["SrcAS"]}`),
+		}, {
+			ID:          2,
+			User:        "judith",
+			Shared:      true,
+			Description: "transit outage",
+			Graph:       "line",
+			Request:     json.RawMessage(`{"dimensions":["InIfProvider"]}`),
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListSnapshots() (-got, +want):\n%s", diff)
+	}
+
+	// Get
+	snapshot, err := c.GetSnapshot(context.Background(), 1, "marty")
+	if err != nil {
+		t.Fatalf("GetSnapshot() error:\n%+v", err)
+	}
+	snapshot.CreatedAt = time.Time{}
+	expected[0].Result = json.RawMessage(`{"rows":[["AS1299"]]}`)
+	if diff := helpers.Diff(snapshot, expected[0]); diff != "" {
+		t.Fatalf("GetSnapshot() (-got, +want):\n%s", diff)
+	}
+	if _, err := c.GetSnapshot(context.Background(), 2, "marty"); err != nil {
+		t.Fatalf("GetSnapshot() error:\n%+v", err)
+	}
+	if _, err := c.GetSnapshot(context.Background(), 1, "judith"); err == nil {
+		t.Fatal("GetSnapshot() no error")
+	}
+
+	// Delete
+	if err := c.DeleteSnapshot(context.Background(), Snapshot{ID: 1, User: "judith"}); err == nil {
+		t.Fatal("DeleteSnapshot() no error")
+	}
+	if err := c.DeleteSnapshot(context.Background(), Snapshot{ID: 1, User: "marty"}); err != nil {
+		t.Fatalf("DeleteSnapshot() error:\n%+v", err)
+	}
+	got, _ = c.ListSnapshots(context.Background(), "marty")
+	for idx := range got {
+		got[idx].CreatedAt = time.Time{}
+	}
+	if diff := helpers.Diff(got, expected[1:]); diff != "" {
+		t.Fatalf("ListSnapshots() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UsageCounter counts how many times a feature of the console (a dimension,
+// a column in a filter, a graph, a saved query) was used during a day. Users
+// are not recorded.
+type UsageCounter struct {
+	Day   time.Time `gorm:"primaryKey" json:"-"`
+	Kind  string    `gorm:"primaryKey" json:"-"`
+	Name  string    `gorm:"primaryKey" json:"name"`
+	Count uint64    `json:"count"`
+}
+
+// UsageKey identifies a usage counter for a day.
+type UsageKey struct {
+	Kind string
+	Name string
+}
+
+// IncrementUsage adds the provided counts to the usage counters of the
+// provided day.
+func (c *Component) IncrementUsage(ctx context.Context, day time.Time, counts map[UsageKey]uint64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	day = day.UTC().Truncate(24 * time.Hour)
+	counters := make([]UsageCounter, 0, len(counts))
+	for key, count := range counts {
+		counters = append(counters, UsageCounter{
+			Day:   day,
+			Kind:  key.Kind,
+			Name:  key.Name,
+			Count: count,
+		})
+	}
+	result := c.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "kind"}, {Name: "name"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count": gorm.Expr("usage_counters.count + excluded.count"),
+		}),
+	}).Create(&counters)
+	if result.Error != nil {
+		return fmt.Errorf("unable to update usage counters: %w", result.Error)
+	}
+	return nil
+}
+
+// ListUsage returns the usage counters for each kind since the provided
+// day, summed over the days and sorted by decreasing count.
+func (c *Component) ListUsage(ctx context.Context, since time.Time) (map[string][]UsageCounter, error) {
+	var results []struct {
+		Kind  string
+		Name  string
+		Count uint64
+	}
+	result := c.db.WithContext(ctx).
+		Model(&UsageCounter{}).
+		Select("kind, name, SUM(count) AS count").
+		Where("day >= ?", since.UTC().Truncate(24*time.Hour)).
+		Group("kind, name").
+		Order("count DESC, name").
+		Find(&results)
+	if result.Error != nil {
+		return nil, fmt.Errorf("unable to retrieve usage counters: %w", result.Error)
+	}
+	usage := map[string][]UsageCounter{}
+	for _, r := range results {
+		usage[r.Kind] = append(usage[r.Kind], UsageCounter{Name: r.Name, Count: r.Count})
+	}
+	return usage, nil
+}
+
+// DeleteUsageBefore deletes the usage counters older than the provided day.
+func (c *Component) DeleteUsageBefore(ctx context.Context, day time.Time) error {
+	result := c.db.WithContext(ctx).
+		Where("day < ?", day.UTC().Truncate(24*time.Hour)).
+		Delete(&UsageCounter{})
+	if result.Error != nil {
+		return fmt.Errorf("unable to delete usage counters: %w", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestUsage(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+	ctx := context.Background()
+	day1 := time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC)
+	day2 := time.Date(2024, 5, 11, 8, 0, 0, 0, time.UTC)
+
+	for _, update := range []struct {
+		Day    time.Time
+		Counts map[UsageKey]uint64
+	}{
+		{day1, map[UsageKey]uint64{
+			{"dimension", "SrcAS"}:     3,
+			{"dimension", "DstAS"}:     1,
+			{"filter", "InIfBoundary"}: 2,
+		}},
+		{day1, map[UsageKey]uint64{
+			{"dimension", "SrcAS"}: 2,
+		}},
+		{day2, map[UsageKey]uint64{
+			{"dimension", "DstAS"}: 7,
+			{"graph", "sankey"}:    1,
+		}},
+	} {
+		if err := c.IncrementUsage(ctx, update.Day, update.Counts); err != nil {
+			t.Fatalf("IncrementUsage() error:\n%+v", err)
+		}
+	}
+
+	got, err := c.ListUsage(ctx, day1)
+	if err != nil {
+		t.Fatalf("ListUsage() error:\n%+v", err)
+	}
+	expected := map[string][]UsageCounter{
+		"dimension": {{Name: "DstAS", Count: 8}, {Name: "SrcAS", Count: 5}},
+		"filter":    {{Name: "InIfBoundary", Count: 2}},
+		"graph":     {{Name: "sankey", Count: 1}},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListUsage() (-got, +want):\n%s", diff)
+	}
+
+	if err := c.DeleteUsageBefore(ctx, day2); err != nil {
+		t.Fatalf("DeleteUsageBefore() error:\n%+v", err)
+	}
+	got, err = c.ListUsage(ctx, day1)
+	if err != nil {
+		t.Fatalf("ListUsage() error:\n%+v", err)
+	}
+	expected = map[string][]UsageCounter{
+		"dimension": {{Name: "DstAS", Count: 7}},
+		"graph":     {{Name: "sankey", Count: 1}},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ListUsage() (-got, +want):\n%s", diff)
+	}
+}
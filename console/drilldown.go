@@ -0,0 +1,176 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+// graphDrilldownHandlerInput describes the input for the /graph/drilldown
+// endpoint. The filter should select the series to drill into.
+type graphDrilldownHandlerInput struct {
+	schema     *schema.Component
+	restricted []string
+	Start      time.Time    `json:"start" binding:"required"`
+	End        time.Time    `json:"end" binding:"required,gtfield=Start"`
+	Limit      int          `json:"limit" binding:"min=1"` // limit for each category
+	Filter     query.Filter `json:"filter"`                // where ...
+	Units      string       `json:"units" binding:"required,oneof=pps l3bps l2bps"`
+	Direction  string       `json:"direction" binding:"required,oneof=src dst"`
+}
+
+// graphDrilldownHandlerOutput describes the output for the /graph/drilldown
+// endpoint.
+type graphDrilldownHandlerOutput struct {
+	Prefixes  []drilldownItem `json:"prefixes"`
+	Ports     []drilldownItem `json:"ports"`
+	Exporters []drilldownItem `json:"exporters"`
+}
+type drilldownItem struct {
+	Name string `json:"name"`
+	Xps  int    `json:"xps"`
+}
+
+// drilldownCategories returns the category names and the associated column
+// for the provided direction.
+func (input graphDrilldownHandlerInput) drilldownCategories() ([]string, []query.Column) {
+	prefix := "Dst"
+	if input.Direction == "src" {
+		prefix = "Src"
+	}
+	return []string{"prefix", "port", "exporter"},
+		[]query.Column{
+			query.NewColumn(prefix + "NetPrefix"),
+			query.NewColumn(prefix + "Port"),
+			query.NewColumn("ExporterName"),
+		}
+}
+
+// toSQL converts a drilldown query to an SQL request. Each category is
+// retrieved with its own subquery.
+func (input graphDrilldownHandlerInput) toSQL() (string, error) {
+	where := templateWhere(input.Filter)
+	names, columns := input.drilldownCategories()
+	if err := query.Columns(columns).Validate(input.schema); err != nil {
+		return "", err
+	}
+
+	selects := []string{}
+	for idx, column := range columns {
+		if slices.Contains(input.restricted, column.String()) {
+			continue
+		}
+		selects = append(selects, fmt.Sprintf(`(WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE %s) AS range
+SELECT
+ '%s' AS category,
+ %s AS name,
+ {{ .Units }}/range AS xps
+FROM {{ .Table }}
+WHERE %s
+GROUP BY name
+ORDER BY xps DESC
+LIMIT %d)`,
+			where, names[idx], column.ToSQLSelect(input.schema), where, input.Limit))
+	}
+	if len(selects) == 0 {
+		return "", errors.New("no accessible column to drill down")
+	}
+
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+%s
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: requireMainTable(input.schema, columns, input.Filter),
+			Points:            20,
+			Units:             input.Units,
+		}),
+		strings.Join(selects, "\nUNION ALL\n"))
+	return strings.TrimSpace(sqlQuery), nil
+}
+
+func (c *Component) graphDrilldownHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	input := graphDrilldownHandlerInput{schema: c.d.Schema}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	input.restricted = c.restrictedColumns(gc)
+	if err := checkFilterAccess(c.d.Schema, input.restricted, input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return
+	}
+	c.recordUsage("drilldown", nil, input.Filter)
+
+	sqlQuery, err := input.toSQL()
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	// Prepare and execute query
+	sqlQuery = c.finalizeQuery(sqlQuery)
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	results := []struct {
+		Category string  `ch:"category"`
+		Name     string  `ch:"name"`
+		Xps      float64 `ch:"xps"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+
+	// Prepare output
+	output := graphDrilldownHandlerOutput{
+		Prefixes:  make([]drilldownItem, 0),
+		Ports:     make([]drilldownItem, 0),
+		Exporters: make([]drilldownItem, 0),
+	}
+	for _, result := range results {
+		item := drilldownItem{Name: result.Name, Xps: int(result.Xps)}
+		switch result.Category {
+		case "prefix":
+			output.Prefixes = append(output.Prefixes, item)
+		case "port":
+			output.Ports = append(output.Ports, item)
+		case "exporter":
+			output.Exporters = append(output.Exporters, item)
+		}
+	}
+	for _, items := range [][]drilldownItem{output.Prefixes, output.Ports, output.Exporters} {
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Xps > items[j].Xps
+		})
+	}
+
+	gc.JSON(http.StatusOK, output)
+}
@@ -0,0 +1,140 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestDrilldownQuerySQL(t *testing.T) {
+	input := graphDrilldownHandlerInput{
+		schema:    schema.NewMock(t),
+		Start:     time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		End:       time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		Limit:     5,
+		Filter:    query.NewFilter("DstAS = 65000"),
+		Units:     "l3bps",
+		Direction: "dst",
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","main-table-required":true,"points":20,"units":"l3bps"}@@ }}
+(WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE {{ .Timefilter }} AND (DstAS = 65000)) AS range
+SELECT
+ 'prefix' AS category,
+ DstNetPrefix AS name,
+ {{ .Units }}/range AS xps
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY xps DESC
+LIMIT 5)
+UNION ALL
+(WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE {{ .Timefilter }} AND (DstAS = 65000)) AS range
+SELECT
+ 'port' AS category,
+ if(dictHas('ports', tuple(Proto, DstPort)), concat(toString(DstPort), ': ', dictGet('ports', 'name', tuple(Proto, DstPort))), toString(DstPort)) AS name,
+ {{ .Units }}/range AS xps
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY xps DESC
+LIMIT 5)
+UNION ALL
+(WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE {{ .Timefilter }} AND (DstAS = 65000)) AS range
+SELECT
+ 'exporter' AS category,
+ ExporterName AS name,
+ {{ .Units }}/range AS xps
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY xps DESC
+LIMIT 5)
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	got, err := input.toSQL()
+	if err != nil {
+		t.Fatalf("toSQL() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("toSQL() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDrilldownHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expectedSQL := []struct {
+		Category string  `ch:"category"`
+		Name     string  `ch:"name"`
+		Xps      float64 `ch:"xps"`
+	}{
+		{"port", "443", 9000},
+		{"prefix", "192.0.2.0/24", 6000},
+		{"prefix", "198.51.100.0/24", 4000},
+		{"exporter", "router1", 7000},
+		{"port", "80", 1000},
+		{"exporter", "router2", 3000},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/graph/drilldown",
+			JSONInput: gin.H{
+				"start":     time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":       time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"limit":     10,
+				"filter":    "DstAS = 65000",
+				"units":     "l3bps",
+				"direction": "dst",
+			},
+			JSONOutput: gin.H{
+				"prefixes": []gin.H{
+					{"name": "192.0.2.0/24", "xps": 6000},
+					{"name": "198.51.100.0/24", "xps": 4000},
+				},
+				"ports": []gin.H{
+					{"name": "443", "xps": 9000},
+					{"name": "80", "xps": 1000},
+				},
+				"exporters": []gin.H{
+					{"name": "router1", "xps": 7000},
+					{"name": "router2", "xps": 3000},
+				},
+			},
+		}, {
+			URL: "/api/v0/console/graph/drilldown",
+			JSONInput: gin.H{
+				"start":     time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":       time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"limit":     10,
+				"units":     "l3bps",
+				"direction": "in",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Key: 'graphDrilldownHandlerInput.Direction' Error:Field validation for 'Direction' failed on the 'oneof' tag",
+			},
+		},
+	})
+}
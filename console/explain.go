@@ -0,0 +1,278 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+// graphExplainHandlerInput describes the input for the /graph/explain
+// endpoint. The filter should select the series with a spike between start
+// and end. The spike is compared to the baseline period, between
+// baseline-start and start.
+type graphExplainHandlerInput struct {
+	schema        *schema.Component
+	restricted    []string
+	Start         time.Time    `json:"start" binding:"required"`
+	End           time.Time    `json:"end" binding:"required,gtfield=Start"`
+	BaselineStart time.Time    `json:"baseline-start"`        // default to the same duration before start
+	Limit         int          `json:"limit" binding:"min=1"` // limit for each category
+	Filter        query.Filter `json:"filter"`                // where ...
+	Units         string       `json:"units" binding:"required,oneof=pps l3bps l2bps"`
+	Direction     string       `json:"direction" binding:"required,oneof=src dst"`
+}
+
+// graphExplainHandlerOutput describes the output for the /graph/explain
+// endpoint.
+type graphExplainHandlerOutput struct {
+	Xps          int           `json:"xps"`
+	Baseline     int           `json:"baseline"`
+	Contributors []explainItem `json:"contributors"`
+	Summary      []string      `json:"summary"`
+}
+type explainItem struct {
+	Category string `json:"category"`
+	Name     string `json:"name"`
+	Xps      int    `json:"xps"`
+	Baseline int    `json:"baseline"`
+	Change   int    `json:"change"`
+}
+
+// explainCategories returns the category names and the associated columns
+// for the provided direction. The interface category uses two columns.
+func (input graphExplainHandlerInput) explainCategories() ([]string, [][]query.Column) {
+	prefix, iface := "Dst", "OutIfName"
+	if input.Direction == "src" {
+		prefix, iface = "Src", "InIfName"
+	}
+	return []string{"prefix", "port", "exporter", "interface"},
+		[][]query.Column{
+			{query.NewColumn(prefix + "NetPrefix")},
+			{query.NewColumn(prefix + "Port")},
+			{query.NewColumn("ExporterName")},
+			{query.NewColumn("ExporterName"), query.NewColumn(iface)},
+		}
+}
+
+// baselineStart returns the start of the baseline period.
+func (input graphExplainHandlerInput) baselineStart() time.Time {
+	if input.BaselineStart.IsZero() {
+		return input.Start.Add(-input.End.Sub(input.Start))
+	}
+	return input.BaselineStart
+}
+
+// toSQL converts an explain query to an SQL request. Each category is
+// retrieved with its own subquery, ranked by the absolute change between the
+// baseline and the spike. The total is retrieved as an additional category.
+func (input graphExplainHandlerInput) toSQL() (string, error) {
+	where := templateWhere(input.Filter)
+	names, columns := input.explainCategories()
+	all := []query.Column{}
+	for _, cols := range columns {
+		if err := query.Columns(cols).Validate(input.schema); err != nil {
+			return "", err
+		}
+		all = append(all, cols...)
+	}
+
+	spikeStart := fmt.Sprintf(`toDateTime('%s', 'UTC')`, input.Start.UTC().Format("2006-01-02 15:04:05"))
+	spikeSeconds := max(uint64(input.End.Sub(input.Start).Seconds()), 1)
+	baselineSeconds := max(uint64(input.Start.Sub(input.baselineStart()).Seconds()), 1)
+	values := fmt.Sprintf(` SUM(if(TimeReceived >= %s, {{ .UnitsValue }}, 0))/%d AS xps,
+ SUM(if(TimeReceived < %s, {{ .UnitsValue }}, 0))/%d AS baseline`,
+		spikeStart, spikeSeconds, spikeStart, baselineSeconds)
+
+	selects := []string{fmt.Sprintf(`(SELECT
+ 'total' AS category,
+ '' AS name,
+%s
+FROM {{ .Table }}
+WHERE %s)`, values, where)}
+	for idx, cols := range columns {
+		if slices.ContainsFunc(cols, func(column query.Column) bool {
+			return slices.Contains(input.restricted, column.String())
+		}) {
+			continue
+		}
+		name := cols[0].ToSQLSelect(input.schema)
+		if len(cols) > 1 {
+			parts := []string{}
+			for _, column := range cols {
+				parts = append(parts, column.ToSQLSelect(input.schema))
+			}
+			name = fmt.Sprintf("concat(%s)", strings.Join(parts, ", ' ', "))
+		}
+		selects = append(selects, fmt.Sprintf(`(SELECT
+ '%s' AS category,
+ %s AS name,
+%s
+FROM {{ .Table }}
+WHERE %s
+GROUP BY name
+ORDER BY abs(xps - baseline) DESC
+LIMIT %d)`,
+			names[idx], name, values, where, input.Limit))
+	}
+	if len(selects) == 1 {
+		return "", errors.New("no accessible column to explain traffic")
+	}
+
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+%s
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.baselineStart(),
+			End:               input.End,
+			MainTableRequired: requireMainTable(input.schema, all, input.Filter),
+			Points:            20,
+			Units:             input.Units,
+		}),
+		strings.Join(selects, "\nUNION ALL\n"))
+	return strings.TrimSpace(sqlQuery), nil
+}
+
+// formatXps formats a rate with an SI prefix.
+func formatXps(value float64, units string) string {
+	suffix := "bps"
+	if units == "pps" {
+		suffix = "pps"
+	}
+	prefixes := []string{"", "k", "M", "G", "T", "P"}
+	idx := 0
+	for math.Abs(value) >= 1000 && idx < len(prefixes)-1 {
+		value /= 1000
+		idx++
+	}
+	return fmt.Sprintf("%.1f %s%s", value, prefixes[idx], suffix)
+}
+
+// explainSummary returns a textual summary of the change of the provided
+// total and contributors, ranked by decreasing absolute change.
+func explainSummary(total explainItem, contributors []explainItem, units string) []string {
+	change := func(value int) string {
+		if value >= 0 {
+			return "+" + formatXps(float64(value), units)
+		}
+		return "-" + formatXps(float64(-value), units)
+	}
+	summary := []string{fmt.Sprintf("Traffic went from %s to %s (%s).",
+		formatXps(float64(total.Baseline), units),
+		formatXps(float64(total.Xps), units),
+		change(total.Change))}
+	for _, item := range contributors {
+		if item.Change == 0 {
+			continue
+		}
+		line := fmt.Sprintf("%s %s went from %s to %s (%s",
+			helpers.Capitalize(item.Category), item.Name,
+			formatXps(float64(item.Baseline), units),
+			formatXps(float64(item.Xps), units),
+			change(item.Change))
+		if total.Change != 0 && (item.Change > 0) == (total.Change > 0) {
+			line = fmt.Sprintf("%s, %d%% of the change", line, item.Change*100/total.Change)
+		}
+		summary = append(summary, line+").")
+	}
+	return summary
+}
+
+func (c *Component) graphExplainHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	input := graphExplainHandlerInput{schema: c.d.Schema}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if !input.BaselineStart.IsZero() && !input.BaselineStart.Before(input.Start) {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Baseline start should be before start."})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	input.restricted = c.restrictedColumns(gc)
+	if err := checkFilterAccess(c.d.Schema, input.restricted, input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return
+	}
+	c.recordUsage("explain", nil, input.Filter)
+
+	sqlQuery, err := input.toSQL()
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	// Prepare and execute query
+	sqlQuery = c.finalizeQuery(sqlQuery)
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	results := []struct {
+		Category string  `ch:"category"`
+		Name     string  `ch:"name"`
+		Xps      float64 `ch:"xps"`
+		Baseline float64 `ch:"baseline"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+
+	// Prepare output
+	total := explainItem{}
+	contributors := []explainItem{}
+	for _, result := range results {
+		item := explainItem{
+			Category: result.Category,
+			Name:     result.Name,
+			Xps:      int(result.Xps),
+			Baseline: int(result.Baseline),
+		}
+		item.Change = item.Xps - item.Baseline
+		if result.Category == "total" {
+			total = item
+			continue
+		}
+		contributors = append(contributors, item)
+	}
+	sort.SliceStable(contributors, func(i, j int) bool {
+		ci, cj := contributors[i].Change, contributors[j].Change
+		if ci < 0 {
+			ci = -ci
+		}
+		if cj < 0 {
+			cj = -cj
+		}
+		return ci > cj
+	})
+
+	gc.JSON(http.StatusOK, graphExplainHandlerOutput{
+		Xps:          total.Xps,
+		Baseline:     total.Baseline,
+		Contributors: contributors,
+		Summary:      explainSummary(total, contributors, input.Units),
+	})
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestExplainQuerySQL(t *testing.T) {
+	input := graphExplainHandlerInput{
+		schema:     schema.NewMock(t),
+		restricted: []string{"DstPort"},
+		Start:      time.Date(2022, 4, 11, 15, 0, 0, 0, time.UTC),
+		End:        time.Date(2022, 4, 11, 16, 0, 0, 0, time.UTC),
+		Limit:      5,
+		Filter:     query.NewFilter("DstAS = 65000"),
+		Units:      "l3bps",
+		Direction:  "dst",
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-11T14:00:00Z","end":"2022-04-11T16:00:00Z","main-table-required":true,"points":20,"units":"l3bps"}@@ }}
+(SELECT
+ 'total' AS category,
+ '' AS name,
+ SUM(if(TimeReceived >= toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS xps,
+ SUM(if(TimeReceived < toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS baseline
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000))
+UNION ALL
+(SELECT
+ 'prefix' AS category,
+ DstNetPrefix AS name,
+ SUM(if(TimeReceived >= toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS xps,
+ SUM(if(TimeReceived < toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS baseline
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY abs(xps - baseline) DESC
+LIMIT 5)
+UNION ALL
+(SELECT
+ 'exporter' AS category,
+ ExporterName AS name,
+ SUM(if(TimeReceived >= toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS xps,
+ SUM(if(TimeReceived < toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS baseline
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY abs(xps - baseline) DESC
+LIMIT 5)
+UNION ALL
+(SELECT
+ 'interface' AS category,
+ concat(ExporterName, ' ', OutIfName) AS name,
+ SUM(if(TimeReceived >= toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS xps,
+ SUM(if(TimeReceived < toDateTime('2022-04-11 15:00:00', 'UTC'), {{ .UnitsValue }}, 0))/3600 AS baseline
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (DstAS = 65000)
+GROUP BY name
+ORDER BY abs(xps - baseline) DESC
+LIMIT 5)
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	got, err := input.toSQL()
+	if err != nil {
+		t.Fatalf("toSQL() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("toSQL() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestExplainHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expectedSQL := []struct {
+		Category string  `ch:"category"`
+		Name     string  `ch:"name"`
+		Xps      float64 `ch:"xps"`
+		Baseline float64 `ch:"baseline"`
+	}{
+		{"total", "", 10000, 2000},
+		{"port", "443", 9000, 1000},
+		{"prefix", "192.0.2.0/24", 6000, 1000},
+		{"exporter", "router1", 7000, 2000},
+		{"port", "80", 500, 1000},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/graph/explain",
+			JSONInput: gin.H{
+				"start":     time.Date(2022, 4, 11, 15, 0, 0, 0, time.UTC),
+				"end":       time.Date(2022, 4, 11, 16, 0, 0, 0, time.UTC),
+				"limit":     10,
+				"filter":    "DstAS = 65000",
+				"units":     "l3bps",
+				"direction": "dst",
+			},
+			JSONOutput: gin.H{
+				"xps":      10000,
+				"baseline": 2000,
+				"contributors": []gin.H{
+					{"category": "port", "name": "443", "xps": 9000, "baseline": 1000, "change": 8000},
+					{"category": "prefix", "name": "192.0.2.0/24", "xps": 6000, "baseline": 1000, "change": 5000},
+					{"category": "exporter", "name": "router1", "xps": 7000, "baseline": 2000, "change": 5000},
+					{"category": "port", "name": "80", "xps": 500, "baseline": 1000, "change": -500},
+				},
+				"summary": []string{
+					"Traffic went from 2.0 kbps to 10.0 kbps (+8.0 kbps).",
+					"Port 443 went from 1.0 kbps to 9.0 kbps (+8.0 kbps, 100% of the change).",
+					"Prefix 192.0.2.0/24 went from 1.0 kbps to 6.0 kbps (+5.0 kbps, 62% of the change).",
+					"Exporter router1 went from 2.0 kbps to 7.0 kbps (+5.0 kbps, 62% of the change).",
+					"Port 80 went from 1.0 kbps to 500.0 bps (-500.0 bps).",
+				},
+			},
+		}, {
+			URL: "/api/v0/console/graph/explain",
+			JSONInput: gin.H{
+				"start":          time.Date(2022, 4, 11, 15, 0, 0, 0, time.UTC),
+				"end":            time.Date(2022, 4, 11, 16, 0, 0, 0, time.UTC),
+				"baseline-start": time.Date(2022, 4, 11, 15, 0, 0, 0, time.UTC),
+				"limit":          10,
+				"units":          "l3bps",
+				"direction":      "dst",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Baseline start should be before start.",
+			},
+		},
+	})
+}
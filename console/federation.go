@@ -0,0 +1,377 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/query"
+)
+
+// federationMaxAnswerSize is the maximum size of the answer of a remote
+// console.
+const federationMaxAnswerSize = 16 << 20
+
+// FederationConfiguration defines a remote console queried for federated
+// graphs, usually the console of a regional deployment.
+type FederationConfiguration struct {
+	// Name is the name of the region.
+	Name string `validate:"required"`
+	// URL is the base URL of the remote console.
+	URL string `validate:"required,url"`
+	// Headers are added to the requests to the remote console, notably to
+	// authenticate them.
+	Headers map[string]string
+}
+
+// federationAnswer is the answer of a region to a federated query.
+type federationAnswer struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	body    []byte
+}
+
+// federatedQuery sends the provided request body to the provided endpoint of
+// each remote console. Answers are returned in the configured order.
+func (c *Component) federatedQuery(gc *gin.Context, endpoint string, body []byte) []federationAnswer {
+	ctx := c.t.Context(gc.Request.Context())
+	answers := make([]federationAnswer, len(c.config.Federation))
+	var wg sync.WaitGroup
+	for idx, member := range c.config.Federation {
+		answers[idx].Name = member.Name
+		wg.Add(1)
+		go func(answer *federationAnswer, member FederationConfiguration) {
+			defer wg.Done()
+			answer.body, answer.Message = c.federatedRequest(ctx, member, endpoint, body)
+			if answer.Message == "" {
+				answer.Status = "ok"
+			} else {
+				answer.Status = "error"
+				c.r.Warn().Str("region", member.Name).Msgf("federated query failed: %s", answer.Message)
+			}
+		}(&answers[idx], member)
+	}
+	wg.Wait()
+	return answers
+}
+
+// federatedRequest sends a request to a remote console. It returns the body
+// of the answer or an error message.
+func (c *Component) federatedRequest(ctx stdcontext.Context, member FederationConfiguration, endpoint string, body []byte) ([]byte, string) {
+	ctx, cancel := stdcontext.WithTimeout(ctx, c.config.FederationTimeout)
+	defer cancel()
+	url := fmt.Sprintf("%s/api/v0/console/%s", strings.TrimSuffix(member.URL, "/"), endpoint)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Sprintf("cannot build request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range member.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := c.federationClient.Do(req)
+	if err != nil {
+		return nil, fmt.Sprintf("cannot query console: %s", err)
+	}
+	defer resp.Body.Close()
+	answer, err := io.ReadAll(io.LimitReader(resp.Body, federationMaxAnswerSize+1))
+	if err != nil {
+		return nil, fmt.Sprintf("cannot read answer: %s", err)
+	}
+	if len(answer) > federationMaxAnswerSize {
+		return nil, "answer too large"
+	}
+	if resp.StatusCode != http.StatusOK {
+		var message struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(answer, &message); err == nil && message.Message != "" {
+			return nil, message.Message
+		}
+		return nil, fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return answer, ""
+}
+
+// validateFederation checks if the provided input can be federated. Values
+// from several regions are summed: this does not work for percentages.
+func (input graphCommonHandlerInput) validateFederation() error {
+	switch input.Units {
+	case "inl2%", "outl2%":
+		return errors.New("federated graphs do not support percent units")
+	}
+	return nil
+}
+
+// federationRowKey returns a key for a row of a graph.
+func federationRowKey(row []string) string {
+	return strings.Join(row, "\x00")
+}
+
+// mergeSankeyOutputs merges the rows of several sankey graphs. Rows beyond
+// the limit are merged into "Other". The value of a row is underestimated when
+// it is not in the rows returned by a region: its traffic is then counted in
+// "Other".
+func mergeSankeyOutputs(dimensions []query.Column, limit int, outputs []graphSankeyHandlerOutput) graphSankeyHandlerOutput {
+	rows := [][]string{}
+	xps := []int{}
+	indexes := map[string]int{}
+	for _, output := range outputs {
+		for idx, row := range output.Rows {
+			key := federationRowKey(row)
+			if i, ok := indexes[key]; ok {
+				xps[i] += output.Xps[idx]
+				continue
+			}
+			indexes[key] = len(rows)
+			rows = append(rows, row)
+			xps = append(xps, output.Xps[idx])
+		}
+	}
+	order := make([]int, len(rows))
+	for idx := range order {
+		order[idx] = idx
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return xps[order[i]] > xps[order[j]]
+	})
+
+	other := make([]string, len(dimensions))
+	for idx := range other {
+		other[idx] = "Other"
+	}
+	otherKey := federationRowKey(other)
+	sortedRows := make([][]string, 0, len(rows))
+	sortedXps := make([]int, 0, len(rows))
+	otherXps := 0
+	for _, idx := range order {
+		if len(sortedRows) >= limit || federationRowKey(rows[idx]) == otherKey {
+			otherXps += xps[idx]
+			continue
+		}
+		sortedRows = append(sortedRows, rows[idx])
+		sortedXps = append(sortedXps, xps[idx])
+	}
+	if otherXps > 0 {
+		sortedRows = append(sortedRows, other)
+		sortedXps = append(sortedXps, otherXps)
+	}
+	return buildSankeyOutput(dimensions, sortedRows, sortedXps)
+}
+
+// mergeLineOutputs merges several line graphs. The time axis of the first
+// graph is used. The points of the other graphs are aligned on it: each
+// timestamp gets the value of the latest point at or before it.
+func mergeLineOutputs(outputs []graphLineHandlerOutput) graphLineHandlerOutput {
+	if len(outputs) == 0 {
+		return graphLineHandlerOutput{}
+	}
+	times := outputs[0].Time
+	type mergedRow struct {
+		axis   int
+		row    []string
+		points []int
+		sum    uint64
+	}
+	rows := []*mergedRow{}
+	indexes := map[string]*mergedRow{}
+	axisNames := map[int]string{}
+	for _, output := range outputs {
+		for axis, name := range output.AxisNames {
+			axisNames[axis] = name
+		}
+		// Map each reference timestamp to a timestamp of this output
+		mapping := make([]int, len(times))
+		j := -1
+		for i, t := range times {
+			for j+1 < len(output.Time) && !output.Time[j+1].After(t) {
+				j++
+			}
+			mapping[i] = j
+		}
+		for idx, row := range output.Rows {
+			key := fmt.Sprintf("%d-%s", output.Axis[idx], federationRowKey(row))
+			merged, ok := indexes[key]
+			if !ok {
+				merged = &mergedRow{
+					axis:   output.Axis[idx],
+					row:    row,
+					points: make([]int, len(times)),
+				}
+				indexes[key] = merged
+				rows = append(rows, merged)
+			}
+			for i, j := range mapping {
+				if j >= 0 && j < len(output.Points[idx]) {
+					merged.points[i] += output.Points[idx][j]
+					merged.sum += uint64(output.Points[idx][j])
+				}
+			}
+		}
+	}
+
+	// Sort by axis, then by sum, "Other" being last
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].axis != rows[j].axis {
+			return rows[i].axis < rows[j].axis
+		}
+		if len(rows[i].row) > 0 && rows[i].row[0] == "Other" {
+			return false
+		}
+		if len(rows[j].row) > 0 && rows[j].row[0] == "Other" {
+			return true
+		}
+		return rows[i].sum > rows[j].sum
+	})
+
+	output := graphLineHandlerOutput{
+		Time:                 times,
+		Rows:                 make([][]string, len(rows)),
+		Points:               make([][]int, len(rows)),
+		Axis:                 make([]int, len(rows)),
+		AxisNames:            axisNames,
+		Average:              make([]int, len(rows)),
+		Min:                  make([]int, len(rows)),
+		Max:                  make([]int, len(rows)),
+		NinetyFivePercentile: make([]int, len(rows)),
+	}
+	for i, row := range rows {
+		output.Rows[i] = row.row
+		output.Points[i] = row.points
+		output.Axis[i] = row.axis
+		if len(times) > 0 {
+			output.Average[i] = int(row.sum / uint64(len(times)))
+		}
+		output.Min[i], output.Max[i], output.NinetyFivePercentile[i] = lineStatistics(row.points)
+	}
+	return output
+}
+
+// federationResult is the output for federated graphs.
+type federationResult[T any] struct {
+	Graph   T                  `json:"graph"`
+	Regions []federationAnswer `json:"regions"`
+}
+
+// validateFederatedInput checks the common part of a federated query.
+func (c *Component) validateFederatedInput(gc *gin.Context, input *graphCommonHandlerInput) bool {
+	if err := query.Columns(input.Dimensions).Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return false
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return false
+	}
+	if err := input.validateFederation(); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return false
+	}
+	if err := input.applyColumnAccess(c.restrictedColumns(gc)); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return false
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
+				c.config.DimensionsLimit)})
+		return false
+	}
+	return true
+}
+
+// federatedGraph sends the input to the remote consoles and decodes their
+// answers. The input is encoded again as it may have been modified to comply
+// with access restrictions. It returns false if no region answered.
+func federatedGraph[T any](c *Component, gc *gin.Context, endpoint string, input any) ([]T, []federationAnswer, bool) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": helpers.Capitalize(err.Error())})
+		return nil, nil, false
+	}
+	answers := c.federatedQuery(gc, endpoint, body)
+	outputs := []T{}
+	for idx := range answers {
+		if answers[idx].Status != "ok" {
+			continue
+		}
+		var output T
+		if err := json.Unmarshal(answers[idx].body, &output); err != nil {
+			answers[idx].Status = "error"
+			answers[idx].Message = fmt.Sprintf("cannot decode answer: %s", err)
+			continue
+		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		gc.JSON(http.StatusBadGateway, gin.H{
+			"message": "No region answered.",
+			"regions": answers,
+		})
+		return nil, nil, false
+	}
+	return outputs, answers, true
+}
+
+func (c *Component) federationLineHandlerFunc(gc *gin.Context) {
+	input := graphLineHandlerInput{graphCommonHandlerInput: graphCommonHandlerInput{schema: c.d.Schema}}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Ratio != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Federated graphs do not support ratios."})
+		return
+	}
+	if !c.validateFederatedInput(gc, &input.graphCommonHandlerInput) {
+		return
+	}
+	c.recordUsage("federation-line", input.Dimensions, input.Filter)
+
+	outputs, answers, ok := federatedGraph[graphLineHandlerOutput](c, gc, "graph/line", input)
+	if !ok {
+		return
+	}
+	gc.JSON(http.StatusOK, federationResult[graphLineHandlerOutput]{
+		Graph:   mergeLineOutputs(outputs),
+		Regions: answers,
+	})
+}
+
+func (c *Component) federationSankeyHandlerFunc(gc *gin.Context) {
+	input := graphSankeyHandlerInput{graphCommonHandlerInput: graphCommonHandlerInput{schema: c.d.Schema}}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if !c.validateFederatedInput(gc, &input.graphCommonHandlerInput) {
+		return
+	}
+	c.recordUsage("federation-sankey", input.Dimensions, input.Filter)
+
+	// Request more rows from each region to reduce the error on merged rows
+	remoteInput := input
+	remoteInput.Limit = min(input.Limit*len(c.config.Federation), c.config.DimensionsLimit)
+	outputs, answers, ok := federatedGraph[graphSankeyHandlerOutput](c, gc, "graph/sankey", remoteInput)
+	if !ok {
+		return
+	}
+	gc.JSON(http.StatusOK, federationResult[graphSankeyHandlerOutput]{
+		Graph:   mergeSankeyOutputs(input.Dimensions, input.Limit, outputs),
+		Regions: answers,
+	})
+}
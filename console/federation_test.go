@@ -0,0 +1,191 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/query"
+)
+
+func TestMergeSankeyOutputs(t *testing.T) {
+	dimensions := []query.Column{query.NewColumn("SrcAS"), query.NewColumn("ExporterName")}
+	got := mergeSankeyOutputs(dimensions, 2, []graphSankeyHandlerOutput{
+		{
+			Rows: [][]string{{"AS100", "router1"}, {"AS200", "router1"}, {"Other", "Other"}},
+			Xps:  []int{1000, 500, 100},
+		}, {
+			Rows: [][]string{{"AS300", "router2"}, {"AS200", "router1"}},
+			Xps:  []int{700, 600},
+		},
+	})
+	expected := graphSankeyHandlerOutput{
+		Rows: [][]string{{"AS200", "router1"}, {"AS100", "router1"}, {"Other", "Other"}},
+		Xps:  []int{1100, 1000, 800},
+		Nodes: []string{
+			"SrcAS: AS200",
+			"ExporterName: router1",
+			"SrcAS: AS100",
+			"SrcAS: Other",
+			"ExporterName: Other",
+		},
+		Links: []sankeyLink{
+			{"SrcAS: AS200", "ExporterName: router1", 1100},
+			{"SrcAS: AS100", "ExporterName: router1", 1000},
+			{"SrcAS: Other", "ExporterName: Other", 800},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("mergeSankeyOutputs() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMergeLineOutputs(t *testing.T) {
+	t0 := time.Date(2022, 4, 10, 15, 45, 0, 0, time.UTC)
+	got := mergeLineOutputs([]graphLineHandlerOutput{
+		{
+			Time:      []time.Time{t0, t0.Add(time.Minute), t0.Add(2 * time.Minute)},
+			Rows:      [][]string{{"AS100"}, {"Other"}},
+			Points:    [][]int{{100, 200, 300}, {10, 10, 10}},
+			Axis:      []int{1, 1},
+			AxisNames: map[int]string{1: "Direct"},
+		}, {
+			// Coarser resolution
+			Time:      []time.Time{t0, t0.Add(2 * time.Minute)},
+			Rows:      [][]string{{"AS200"}, {"AS100"}},
+			Points:    [][]int{{1000, 0}, {50, 60}},
+			Axis:      []int{1, 1},
+			AxisNames: map[int]string{1: "Direct"},
+		},
+	})
+	expected := graphLineHandlerOutput{
+		Time:                 []time.Time{t0, t0.Add(time.Minute), t0.Add(2 * time.Minute)},
+		Rows:                 [][]string{{"AS200"}, {"AS100"}, {"Other"}},
+		Points:               [][]int{{1000, 1000, 0}, {150, 250, 360}, {10, 10, 10}},
+		Axis:                 []int{1, 1, 1},
+		AxisNames:            map[int]string{1: "Direct"},
+		Average:              []int{666, 253, 10},
+		Min:                  []int{1000, 150, 10},
+		Max:                  []int{1000, 360, 10},
+		NinetyFivePercentile: []int{1000, 305, 10},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("mergeLineOutputs() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFederation(t *testing.T) {
+	europe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/console/graph/sankey" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer europe" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var input map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		if diff := helpers.Diff(input["dimensions"], []interface{}{"SrcAS"}); diff != "" {
+			t.Errorf("Forwarded dimensions (-got, +want):\n%s", diff)
+		}
+		if diff := helpers.Diff(input["limit"], 20.); diff != "" {
+			t.Errorf("Forwarded limit (-got, +want):\n%s", diff)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gin.H{
+			"rows": [][]string{{"AS100"}, {"AS200"}},
+			"xps":  []int{1000, 500},
+		})
+	}))
+	defer europe.Close()
+	america := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(gin.H{"message": "Unable to query database."})
+	}))
+	defer america.Close()
+
+	config := DefaultConfiguration()
+	config.Federation = []FederationConfiguration{
+		{
+			Name:    "europe",
+			URL:     europe.URL,
+			Headers: map[string]string{"Authorization": "Bearer europe"},
+		}, {
+			Name: "america",
+			URL:  america.URL,
+		},
+	}
+	_, h, _, _ := NewMock(t, config)
+
+	input := gin.H{
+		"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		"dimensions": []string{"SrcAS"},
+		"limit":      10,
+		"filter":     "",
+		"units":      "l3bps",
+	}
+	percent := gin.H{}
+	for k, v := range input {
+		percent[k] = v
+	}
+	percent["units"] = "inl2%"
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "sankey with a failing region",
+			URL:         "/api/v0/console/federation/graph/sankey",
+			JSONInput:   input,
+			JSONOutput: gin.H{
+				"graph": gin.H{
+					"rows":  [][]string{{"AS100"}, {"AS200"}},
+					"xps":   []int{1000, 500},
+					"nodes": []string{},
+					"links": []gin.H{},
+				},
+				"regions": []gin.H{
+					{"name": "europe", "status": "ok"},
+					{"name": "america", "status": "error", "message": "Unable to query database."},
+				},
+			},
+		}, {
+			Description: "line without any region",
+			URL:         "/api/v0/console/federation/graph/line",
+			JSONInput: gin.H{
+				"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"points":     100,
+				"dimensions": []string{"SrcAS"},
+				"limit":      10,
+				"filter":     "",
+				"units":      "l3bps",
+			},
+			StatusCode: 502,
+			JSONOutput: gin.H{
+				"message": "No region answered.",
+				"regions": []gin.H{
+					{"name": "europe", "status": "error", "message": "unexpected status 404"},
+					{"name": "america", "status": "error", "message": "Unable to query database."},
+				},
+			},
+		}, {
+			Description: "percent units",
+			URL:         "/api/v0/console/federation/graph/sankey",
+			JSONInput:   percent,
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Federated graphs do not support percent units"},
+		},
+	})
+}
@@ -6,6 +6,7 @@ package console
 import (
 	"fmt"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -58,6 +59,98 @@ func (c *Component) filterValidateHandlerFunc(gc *gin.Context) {
 	})
 }
 
+// filterRewriteHandlerInput describes the input for the /filter/rewrite endpoint.
+type filterRewriteHandlerInput struct {
+	Filter string `json:"filter"`
+}
+
+// filterRewriteHandlerOutput describes the output for the /filter/rewrite endpoint.
+type filterRewriteHandlerOutput struct {
+	Filter    string `json:"filter"`
+	Rewritten bool   `json:"rewritten"`
+	Valid     bool   `json:"valid"`
+	Message   string `json:"message"`
+}
+
+// filterRewriteHandlerFunc suggests a rewrite of the provided filter, using
+// the current names of renamed columns.
+func (c *Component) filterRewriteHandlerFunc(gc *gin.Context) {
+	var input filterRewriteHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	rewritten := c.rewriteRenamedColumns(input.Filter)
+	output := filterRewriteHandlerOutput{
+		Filter:    rewritten,
+		Rewritten: rewritten != input.Filter,
+		Valid:     true,
+		Message:   "ok",
+	}
+	if err := c.checkFilter(rewritten); err != "" {
+		output.Valid = false
+		output.Message = err
+	}
+	gc.JSON(http.StatusOK, output)
+}
+
+// checkFilter checks if the provided filter is valid with the current schema.
+// It returns a human-readable error when it is not.
+func (c *Component) checkFilter(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return ""
+	}
+	_, err := filter.Parse("", []byte(content), filter.GlobalStore("meta", &filter.Meta{Schema: c.d.Schema}))
+	if err != nil {
+		return filter.HumanError(err)
+	}
+	return ""
+}
+
+// rewriteRenamedColumns replaces the former names of renamed columns in the
+// provided filter with their current names. Quoted strings are left
+// untouched.
+func (c *Component) rewriteRenamedColumns(content string) string {
+	if len(c.config.RenamedColumns) == 0 {
+		return content
+	}
+	isWordChar := func(ch byte) bool {
+		return ch == '_' || (ch >= '0' && ch <= '9') || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+	}
+	var b strings.Builder
+	for i := 0; i < len(content); {
+		ch := content[i]
+		switch {
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(content[i+1:], ch)
+			if end == -1 {
+				b.WriteString(content[i:])
+				return b.String()
+			}
+			b.WriteString(content[i : i+end+2])
+			i += end + 2
+		case isWordChar(ch):
+			j := i + 1
+			for j < len(content) && isWordChar(content[j]) {
+				j++
+			}
+			word := content[i:j]
+			for former, current := range c.config.RenamedColumns {
+				if strings.EqualFold(word, former) {
+					word = current
+					break
+				}
+			}
+			b.WriteString(word)
+			i = j
+		default:
+			b.WriteByte(ch)
+			i++
+		}
+	}
+	return b.String()
+}
+
 // filterCompleteHandlerInput describes the input of the /filter/complete endpoint.
 type filterCompleteHandlerInput struct {
 	What   string `json:"what" binding:"required,oneof=column operator value"`
@@ -128,6 +221,10 @@ func (c *Component) filterCompleteHandlerFunc(gc *gin.Context) {
 			}
 		}
 	case "value":
+		if slices.Contains(c.restrictedColumns(gc), c.fixQueryColumnName(input.Column)) {
+			// Do not leak values of restricted columns
+			break
+		}
 		var column, detail string
 		inputColumn := strings.ToLower(input.Column)
 		switch inputColumn {
@@ -142,6 +239,22 @@ func (c *Component) filterCompleteHandlerFunc(gc *gin.Context) {
 				Label:  "undefined",
 				Detail: "network boundary",
 			})
+		case "trafficdirection":
+			for _, direction := range []string{"inbound", "outbound", "internal", "transit", "undefined"} {
+				completions = append(completions, filterCompletion{
+					Label:  direction,
+					Detail: "traffic direction",
+					Quoted: true,
+				})
+			}
+		case "tunneltype":
+			for _, tunnelType := range []string{"none", "gre", "vxlan", "ipip", "esp"} {
+				completions = append(completions, filterCompletion{
+					Label:  tunnelType,
+					Detail: "encapsulation",
+					Quoted: true,
+				})
+			}
 		case "etype":
 			completions = append(completions, filterCompletion{
 				Label:  "IPv4",
@@ -423,13 +536,31 @@ LIMIT 20`, col.Name, col.Name), input.Prefix); err != nil {
 func (c *Component) filterSavedListHandlerFunc(gc *gin.Context) {
 	ctx := c.t.Context(gc.Request.Context())
 	user := gc.MustGet("user").(authentication.UserInformation).Login
-	filters, err := c.d.Database.ListSavedFilters(ctx, user)
+	params, ok := bindListParameters(gc)
+	if !ok {
+		return
+	}
+	filters, next, err := c.d.Database.ListSavedFilters(ctx, user, c.teamFolders(gc), params.page())
 	if err != nil {
-		c.r.Err(err).Msg("unable to list filters")
-		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list filters"})
+		c.listError(gc, err, "filters")
 		return
 	}
-	gc.JSON(http.StatusOK, gin.H{"filters": filters})
+	annotated := make([]savedFilterWithStatus, len(filters))
+	for idx, f := range filters {
+		annotated[idx] = savedFilterWithStatus{SavedFilter: f}
+		annotated[idx].Error = c.checkFilter(f.Content)
+		annotated[idx].Valid = annotated[idx].Error == ""
+	}
+	listResponse(gc, params, "filters", annotated, next)
+}
+
+// savedFilterWithStatus is a saved filter annotated with its validity against
+// the current schema. A saved filter may become invalid when a column is
+// disabled or renamed.
+type savedFilterWithStatus struct {
+	database.SavedFilter
+	Valid bool   `json:"valid"`
+	Error string `json:"error"`
 }
 
 func (c *Component) filterSavedDeleteHandlerFunc(gc *gin.Context) {
@@ -443,7 +574,7 @@ func (c *Component) filterSavedDeleteHandlerFunc(gc *gin.Context) {
 	if err := c.d.Database.DeleteSavedFilter(ctx, database.SavedFilter{
 		ID:   id,
 		User: user,
-	}); err != nil {
+	}, c.teamFolders(gc)); err != nil {
 		// Assume this is because it is not found
 		gc.JSON(http.StatusNotFound, gin.H{"message": "filter not found"})
 		return
@@ -451,15 +582,29 @@ func (c *Component) filterSavedDeleteHandlerFunc(gc *gin.Context) {
 	gc.JSON(http.StatusNoContent, nil)
 }
 
-func (c *Component) filterSavedAddHandlerFunc(gc *gin.Context) {
-	ctx := c.t.Context(gc.Request.Context())
-	user := gc.MustGet("user").(authentication.UserInformation).Login
+// bindSavedFilter binds the saved filter from the request body and checks
+// the current user can access the requested team folder.
+func (c *Component) bindSavedFilter(gc *gin.Context) (database.SavedFilter, []string, bool) {
 	var filter database.SavedFilter
 	if err := gc.ShouldBindJSON(&filter); err != nil {
 		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return filter, nil, false
+	}
+	folders := c.teamFolders(gc)
+	if filter.Folder != "" && !slices.Contains(folders, filter.Folder) {
+		gc.JSON(http.StatusForbidden, gin.H{"message": "team folder not accessible"})
+		return filter, nil, false
+	}
+	filter.User = gc.MustGet("user").(authentication.UserInformation).Login
+	return filter, folders, true
+}
+
+func (c *Component) filterSavedAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	filter, _, ok := c.bindSavedFilter(gc)
+	if !ok {
 		return
 	}
-	filter.User = user
 	if err := c.d.Database.CreateSavedFilter(ctx, filter); err != nil {
 		c.r.Err(err).Msg("cannot create saved filter")
 		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new filter"})
@@ -467,3 +612,23 @@ func (c *Component) filterSavedAddHandlerFunc(gc *gin.Context) {
 	}
 	gc.JSON(http.StatusNoContent, nil)
 }
+
+func (c *Component) filterSavedUpdateHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	filter, folders, ok := c.bindSavedFilter(gc)
+	if !ok {
+		return
+	}
+	filter.ID = id
+	if err := c.d.Database.UpdateSavedFilter(ctx, filter, folders); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "filter not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
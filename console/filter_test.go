@@ -190,6 +190,30 @@ LIMIT 20`, "6540").
 				{"label": "undefined", "detail": "network boundary", "quoted": false},
 			}},
 		},
+		{
+			URL:        "/api/v0/console/filter/complete",
+			StatusCode: 200,
+			JSONInput:  gin.H{"what": "value", "column": "trafficdirection"},
+			JSONOutput: gin.H{"completions": []gin.H{
+				{"label": "inbound", "detail": "traffic direction", "quoted": true},
+				{"label": "outbound", "detail": "traffic direction", "quoted": true},
+				{"label": "internal", "detail": "traffic direction", "quoted": true},
+				{"label": "transit", "detail": "traffic direction", "quoted": true},
+				{"label": "undefined", "detail": "traffic direction", "quoted": true},
+			}},
+		},
+		{
+			URL:        "/api/v0/console/filter/complete",
+			StatusCode: 200,
+			JSONInput:  gin.H{"what": "value", "column": "tunneltype"},
+			JSONOutput: gin.H{"completions": []gin.H{
+				{"label": "none", "detail": "encapsulation", "quoted": true},
+				{"label": "gre", "detail": "encapsulation", "quoted": true},
+				{"label": "vxlan", "detail": "encapsulation", "quoted": true},
+				{"label": "ipip", "detail": "encapsulation", "quoted": true},
+				{"label": "esp", "detail": "encapsulation", "quoted": true},
+			}},
+		},
 		{
 			URL:        "/api/v0/console/filter/complete",
 			StatusCode: 200,
@@ -310,6 +334,10 @@ LIMIT 20`, "6540").
 				{
 					"id":          1,
 					"shared":      false,
+					"folder":      "",
+					"owned":       true,
+					"valid":       true,
+					"error":       "",
 					"user":        "__default",
 					"description": "test 1",
 					"content":     "InIfBoundary = external",
@@ -361,6 +389,240 @@ LIMIT 20`, "6540").
 	})
 }
 
+func TestFilterSavedPagination(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "store test 1",
+			URL:         "/api/v0/console/filter/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "test 1",
+				"content":     "InIfBoundary = external",
+			},
+			ContentType: "application/json; charset=utf-8",
+		},
+		{
+			Description: "store test 3",
+			URL:         "/api/v0/console/filter/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "test 3",
+				"content":     "InIfBoundary = external",
+			},
+			ContentType: "application/json; charset=utf-8",
+		},
+		{
+			Description: "store test 2",
+			URL:         "/api/v0/console/filter/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "test 2",
+				"content":     "InIfBoundary = external",
+			},
+			ContentType: "application/json; charset=utf-8",
+		},
+		{
+			Description: "first page",
+			URL:         "/api/v0/console/filter/saved?limit=2&sort=-description&fields=id,description",
+			JSONOutput: gin.H{
+				"filters": []gin.H{
+					{"id": 2, "description": "test 3"},
+					{"id": 3, "description": "test 2"},
+				},
+				"next": "eyJ2IjoidGVzdCAyIiwiaWQiOjN9",
+			},
+		}, {
+			Description: "last page",
+			URL:         "/api/v0/console/filter/saved?limit=2&sort=-description&fields=id,description&cursor=eyJ2IjoidGVzdCAyIiwiaWQiOjN9",
+			JSONOutput: gin.H{
+				"filters": []gin.H{
+					{"id": 1, "description": "test 1"},
+				},
+			},
+		}, {
+			Description: "unknown sort field",
+			URL:         "/api/v0/console/filter/saved?sort=content",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": `Unable to retrieve saved filters: invalid page: cannot sort on "content"`,
+			},
+		}, {
+			Description: "unknown field",
+			URL:         "/api/v0/console/filter/saved?fields=id,color",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Unknown field color"},
+		}, {
+			Description: "limit too high",
+			URL:         "/api/v0/console/filter/saved?limit=10000",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'listParameters.Limit' Error:Field validation for 'Limit' failed on the 'max' tag",
+			},
+		},
+	})
+}
+
+func TestFilterSavedTeamFolders(t *testing.T) {
+	config := DefaultConfiguration()
+	config.TeamFolders = []TeamFolderConfiguration{
+		{Name: "NOC", Groups: []string{"noc", "admins"}},
+	}
+	_, h, _, _ := NewMock(t, config)
+	asUser := func(user, groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", user)
+		headers.Add("Remote-Groups", groups)
+		return headers
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "store filter in an inaccessible folder",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("alfred", "users"),
+			StatusCode:  403,
+			JSONInput: gin.H{
+				"description": "transit",
+				"content":     "OutIfConnectivity = transit",
+				"folder":      "NOC",
+			},
+			JSONOutput: gin.H{"message": "team folder not accessible"},
+		}, {
+			Description: "store filter in team folder",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("alfred", "noc"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "transit",
+				"content":     "OutIfConnectivity = transit",
+				"folder":      "NOC",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store shared filter",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("alfred", "noc"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "IX",
+				"content":     "OutIfConnectivity = ix",
+				"shared":      true,
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list filters as a team member",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("judith", "admins"),
+			JSONOutput: gin.H{"filters": []gin.H{
+				{
+					"id":          1,
+					"shared":      false,
+					"folder":      "NOC",
+					"owned":       false,
+					"valid":       false,
+					"error":       `at line 1, position 21: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+					"user":        "alfred",
+					"description": "transit",
+					"content":     "OutIfConnectivity = transit",
+				}, {
+					"id":          2,
+					"shared":      true,
+					"folder":      "",
+					"owned":       false,
+					"valid":       false,
+					"error":       `at line 1, position 21: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+					"user":        "alfred",
+					"description": "IX",
+					"content":     "OutIfConnectivity = ix",
+				},
+			}},
+		}, {
+			Description: "list filters as another user",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("marty", "users"),
+			JSONOutput: gin.H{"filters": []gin.H{
+				{
+					"id":          2,
+					"shared":      true,
+					"folder":      "",
+					"owned":       false,
+					"valid":       false,
+					"error":       `at line 1, position 21: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+					"user":        "alfred",
+					"description": "IX",
+					"content":     "OutIfConnectivity = ix",
+				},
+			}},
+		}, {
+			Description: "update shared filter as another user",
+			Method:      "PUT",
+			URL:         "/api/v0/console/filter/saved/2",
+			Header:      asUser("judith", "admins"),
+			StatusCode:  404,
+			JSONInput: gin.H{
+				"description": "IX",
+				"content":     "OutIfConnectivity = ix",
+			},
+			JSONOutput: gin.H{"message": "filter not found"},
+		}, {
+			Description: "update team filter as a team member",
+			Method:      "PUT",
+			URL:         "/api/v0/console/filter/saved/1",
+			Header:      asUser("judith", "admins"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "transit providers",
+				"content":     "OutIfConnectivity = transit",
+				"folder":      "NOC",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "delete team filter as another user",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/filter/saved/1",
+			Header:      asUser("marty", "users"),
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "filter not found"},
+		}, {
+			Description: "list filters as owner",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("alfred", ""),
+			JSONOutput: gin.H{"filters": []gin.H{
+				{
+					"id":          1,
+					"shared":      false,
+					"folder":      "NOC",
+					"owned":       true,
+					"valid":       false,
+					"error":       `at line 1, position 21: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+					"user":        "alfred",
+					"description": "transit providers",
+					"content":     "OutIfConnectivity = transit",
+				}, {
+					"id":          2,
+					"shared":      true,
+					"folder":      "",
+					"owned":       true,
+					"valid":       false,
+					"error":       `at line 1, position 21: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+					"user":        "alfred",
+					"description": "IX",
+					"content":     "OutIfConnectivity = ix",
+				},
+			}},
+		}, {
+			Description: "delete team filter as a team member",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/filter/saved/1",
+			Header:      asUser("judith", "noc"),
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		},
+	})
+}
+
 func TestFilterHandlersMore(t *testing.T) {
 	c, h, mockConn, _ := NewMock(t, DefaultConfiguration())
 	c.d.Schema = schema.NewMock(t).EnableAllColumns()
@@ -524,3 +786,70 @@ LIMIT 20`, "a").
 		},
 	})
 }
+
+func TestFilterSavedRenamedColumns(t *testing.T) {
+	config := DefaultConfiguration()
+	config.RenamedColumns = map[string]string{
+		"InIfBorder": "InIfBoundary",
+	}
+	_, h, _, _ := NewMock(t, config)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "store filter using a former column name",
+			URL:         "/api/v0/console/filter/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "external",
+				"content":     "InIfBorder = external AND InIfName = 'inifborder'",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list invalid filter",
+			URL:         "/api/v0/console/filter/saved",
+			JSONOutput: gin.H{"filters": []gin.H{
+				{
+					"id":          1,
+					"shared":      false,
+					"folder":      "",
+					"owned":       true,
+					"valid":       false,
+					"error":       "at line 1, position 11: no match found, expected: [A-Za-z0-9]",
+					"user":        "__default",
+					"description": "external",
+					"content":     "InIfBorder = external AND InIfName = 'inifborder'",
+				},
+			}},
+		}, {
+			Description: "rewrite filter",
+			URL:         "/api/v0/console/filter/rewrite",
+			JSONInput:   gin.H{"filter": "inifborder = external AND InIfName = 'inifborder'"},
+			JSONOutput: gin.H{
+				"filter":    "InIfBoundary = external AND InIfName = 'inifborder'",
+				"rewritten": true,
+				"valid":     true,
+				"message":   "ok",
+			},
+		}, {
+			Description: "rewrite filter without renamed columns",
+			URL:         "/api/v0/console/filter/rewrite",
+			JSONInput:   gin.H{"filter": "InIfBoundary = external"},
+			JSONOutput: gin.H{
+				"filter":    "InIfBoundary = external",
+				"rewritten": false,
+				"valid":     true,
+				"message":   "ok",
+			},
+		}, {
+			Description: "rewrite invalid filter",
+			URL:         "/api/v0/console/filter/rewrite",
+			JSONInput:   gin.H{"filter": "InIfBorder = "},
+			JSONOutput: gin.H{
+				"filter":    "InIfBoundary = ",
+				"rewritten": true,
+				"valid":     false,
+				"message":   `at line 1, position 16: no match found, expected: "--", "/*", "external"i, "internal"i, "undefined"i or [ \n\r\t]`,
+			},
+		},
+	})
+}
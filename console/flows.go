@@ -0,0 +1,358 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+// flowsHandlerInput describes the input for the /flows endpoint. Flow
+// records are returned from the most recent to the oldest one. The cursor
+// returned with a page is used to get the next one.
+type flowsHandlerInput struct {
+	schema  *schema.Component
+	Start   time.Time      `json:"start" binding:"required"`
+	End     time.Time      `json:"end" binding:"required,gtfield=Start"`
+	Filter  query.Filter   `json:"filter"`  // where ...
+	Columns []query.Column `json:"columns"` // columns to return in addition to the fixed ones
+	Limit   int            `json:"limit" binding:"min=1"`
+	Cursor  string         `json:"cursor"`
+	Format  string         `json:"format" binding:"omitempty,oneof=json csv"`
+}
+
+// flowsHandlerOutput describes the output for the /flows endpoint.
+type flowsHandlerOutput struct {
+	Columns []string     `json:"columns"`
+	Flows   []flowRecord `json:"flows"`
+	Next    string       `json:"next,omitempty"`
+}
+
+// flowRecord is a single flow record. Values of the requested columns are
+// in the same order as the columns.
+type flowRecord struct {
+	Time         time.Time `json:"t" ch:"t"`
+	Bytes        uint64    `json:"bytes" ch:"bytes"`
+	Packets      uint64    `json:"packets" ch:"packets"`
+	SamplingRate uint64    `json:"sampling-rate" ch:"sampling_rate"`
+	Values       []string  `json:"values" ch:"values"`
+	Hash         uint64    `json:"-" ch:"hash"`
+}
+
+// flowsFixedColumns are the columns always returned for a flow record.
+var flowsFixedColumns = []string{"TimeReceived", "Bytes", "Packets", "SamplingRate"}
+
+// flowsCursor is the position of the last flow record of a page. As flow
+// records have no identifier, ties on time are broken with a hash of all
+// the columns. Identical flow records on a page boundary are only returned
+// once.
+type flowsCursor struct {
+	Time int64  `json:"t"`
+	Hash uint64 `json:"h"`
+}
+
+func (c flowsCursor) encode() string {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(encoded)
+}
+
+func decodeFlowsCursor(input string) (flowsCursor, error) {
+	var c flowsCursor
+	decoded, err := base64.RawURLEncoding.DecodeString(input)
+	if err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// toSQL converts a flows query to an SQL request. Flow records are always
+// retrieved from the main table. When browsing, one more record than
+// requested is retrieved to know if there is a next page.
+func (input flowsHandlerInput) toSQL() (string, error) {
+	if err := query.Columns(input.Columns).Validate(input.schema); err != nil {
+		return "", err
+	}
+	values := make([]string, len(input.Columns))
+	for idx, column := range input.Columns {
+		values[idx] = column.ToSQLSelect(input.schema)
+	}
+	where := []string{fmt.Sprintf("TimeReceived BETWEEN toDateTime('%s', 'UTC') AND toDateTime('%s', 'UTC')",
+		input.Start.UTC().Format("2006-01-02 15:04:05"),
+		input.End.UTC().Format("2006-01-02 15:04:05"))}
+	if input.Filter.Direct() != "" {
+		where = append(where, fmt.Sprintf("(%s)", input.Filter.Direct()))
+	}
+	if input.Cursor != "" {
+		cursor, err := decodeFlowsCursor(input.Cursor)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, fmt.Sprintf("(t, hash) < (toDateTime(%d, 'UTC'), %d)",
+			cursor.Time, cursor.Hash))
+	}
+	return fmt.Sprintf(`
+SELECT
+ TimeReceived AS t,
+ Bytes AS bytes,
+ Packets AS packets,
+ SamplingRate AS sampling_rate,
+ [%s] AS values,
+ cityHash64(%s) AS hash
+FROM flows
+WHERE %s
+ORDER BY t DESC, hash DESC
+LIMIT %d`,
+		strings.Join(values, ", "),
+		strings.Join(input.schema.ClickHouseSelectColumns(schema.ClickHouseSkipAliasedColumns), ", "),
+		strings.Join(where, " AND "),
+		input.limit()), nil
+}
+
+// limit returns the number of flow records to retrieve from the database.
+func (input flowsHandlerInput) limit() int {
+	if input.Format != "" {
+		return input.Limit
+	}
+	return input.Limit + 1
+}
+
+// flowsStreamFlushEvery is the number of flow records after which an
+// export is flushed to the client.
+const flowsStreamFlushEvery = 1000
+
+// flowsStreamWriter writes flow records as they are read from the database.
+type flowsStreamWriter interface {
+	Begin(columns []string) error
+	Write(flow flowRecord) error
+	Flush() error
+	End() error
+}
+
+// flowsCSVWriter streams flow records as CSV. The first line is the header.
+type flowsCSVWriter struct {
+	w *csv.Writer
+}
+
+func (fw *flowsCSVWriter) Begin(columns []string) error {
+	return fw.w.Write(columns)
+}
+
+func (fw *flowsCSVWriter) Write(flow flowRecord) error {
+	record := []string{
+		flow.Time.UTC().Format(time.RFC3339),
+		strconv.FormatUint(flow.Bytes, 10),
+		strconv.FormatUint(flow.Packets, 10),
+		strconv.FormatUint(flow.SamplingRate, 10),
+	}
+	return fw.w.Write(append(record, flow.Values...))
+}
+
+func (fw *flowsCSVWriter) Flush() error {
+	fw.w.Flush()
+	return fw.w.Error()
+}
+
+func (fw *flowsCSVWriter) End() error {
+	return fw.Flush()
+}
+
+// flowsJSONWriter streams flow records as JSON, using the same format as
+// flowsHandlerOutput.
+type flowsJSONWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (fw *flowsJSONWriter) Begin(columns []string) error {
+	encoded, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(fw.w, `{"columns":%s,"flows":[`, encoded)
+	return err
+}
+
+func (fw *flowsJSONWriter) Write(flow flowRecord) error {
+	encoded, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+	if fw.count > 0 {
+		if _, err := io.WriteString(fw.w, ","); err != nil {
+			return err
+		}
+	}
+	fw.count++
+	_, err = fw.w.Write(encoded)
+	return err
+}
+
+func (fw *flowsJSONWriter) Flush() error {
+	return nil
+}
+
+func (fw *flowsJSONWriter) End() error {
+	_, err := io.WriteString(fw.w, "]}")
+	return err
+}
+
+func (c *Component) flowsHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	input := flowsHandlerInput{schema: c.d.Schema}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	restricted := c.restrictedColumns(gc)
+	if err := checkFilterAccess(c.d.Schema, restricted, input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	for _, column := range input.Columns {
+		if slices.Contains(restricted, column.String()) {
+			gc.JSON(http.StatusForbidden, gin.H{
+				"message": fmt.Sprintf("Access to column %s is restricted.", column),
+			})
+			return
+		}
+	}
+	maxLimit := c.config.FlowsLimit
+	if input.Format != "" {
+		maxLimit = c.config.FlowsExportLimit
+	}
+	if input.Limit > maxLimit {
+		gc.JSON(http.StatusBadRequest,
+			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)", maxLimit)})
+		return
+	}
+	c.recordUsage("flows", nil, input.Filter)
+
+	sqlQuery, err := input.toSQL()
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	columns := slices.Clone(flowsFixedColumns)
+	for _, column := range input.Columns {
+		columns = append(columns, column.String())
+	}
+	gc.Header("X-SQL-Query", strings.ReplaceAll(strings.TrimSpace(sqlQuery), "\n", "  "))
+
+	if input.Format != "" {
+		c.flowsStream(gc, input, columns, strings.TrimSpace(sqlQuery))
+		return
+	}
+
+	// Execute query
+	results := []flowRecord{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, strings.TrimSpace(sqlQuery)); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+
+	// Prepare output
+	output := flowsHandlerOutput{
+		Columns: columns,
+		Flows:   results,
+	}
+	if len(results) > input.Limit {
+		output.Flows = results[:input.Limit]
+		last := output.Flows[input.Limit-1]
+		output.Next = flowsCursor{Time: last.Time.Unix(), Hash: last.Hash}.encode()
+	}
+	gc.JSON(http.StatusOK, output)
+}
+
+// flowsStream streams flow records to the client as they are read from the
+// database. Nothing is buffered besides the current block: when the client
+// is slower than the database, writes block and the database driver stops
+// fetching blocks. Once the first byte is sent, errors cannot be reported
+// to the client anymore and the response is truncated.
+func (c *Component) flowsStream(gc *gin.Context, input flowsHandlerInput, columns []string, sqlQuery string) {
+	ctx := c.t.Context(gc.Request.Context())
+	rows, err := c.d.ClickHouseDB.Conn.Query(ctx, sqlQuery)
+	if err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	defer rows.Close()
+
+	var (
+		fw          flowsStreamWriter
+		contentType string
+	)
+	switch input.Format {
+	case "csv":
+		fw = &flowsCSVWriter{w: csv.NewWriter(gc.Writer)}
+		contentType = "text/csv; charset=utf-8"
+	case "json":
+		fw = &flowsJSONWriter{w: gc.Writer}
+		contentType = "application/json; charset=utf-8"
+	}
+	gc.Header("Content-Type", contentType)
+	gc.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="akvorado-flows-%s.%s"`,
+		input.Start.UTC().Format("20060102T150405Z"), input.Format))
+	gc.Status(http.StatusOK)
+
+	if err := fw.Begin(columns); err != nil {
+		c.r.Err(err).Msg("unable to stream flows")
+		return
+	}
+	count := 0
+	for rows.Next() {
+		var flow flowRecord
+		if err := rows.ScanStruct(&flow); err != nil {
+			c.r.Err(err).Msg("unable to parse flow")
+			return
+		}
+		if err := fw.Write(flow); err != nil {
+			c.r.Err(err).Msg("unable to stream flows")
+			return
+		}
+		count++
+		if count%flowsStreamFlushEvery == 0 {
+			if err := fw.Flush(); err != nil {
+				c.r.Err(err).Msg("unable to stream flows")
+				return
+			}
+			gc.Writer.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		return
+	}
+	if err := fw.End(); err != nil {
+		c.r.Err(err).Msg("unable to stream flows")
+		return
+	}
+	gc.Writer.Flush()
+}
@@ -0,0 +1,287 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb/mocks"
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestFlowsQuerySQL(t *testing.T) {
+	sch := schema.NewMock(t)
+	hash := strings.Join(sch.ClickHouseSelectColumns(schema.ClickHouseSkipAliasedColumns), ", ")
+	cases := []struct {
+		Description string
+		Input       flowsHandlerInput
+		Expected    string
+	}{
+		{
+			Description: "no filter",
+			Input: flowsHandlerInput{
+				Start:   time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				End:     time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				Columns: []query.Column{query.NewColumn("SrcAS"), query.NewColumn("DstPort")},
+				Limit:   100,
+			},
+			Expected: fmt.Sprintf(`
+SELECT
+ TimeReceived AS t,
+ Bytes AS bytes,
+ Packets AS packets,
+ SamplingRate AS sampling_rate,
+ [concat(toString(SrcAS), ': ', dictGetOrDefault('asns', 'name', SrcAS, '???')), if(dictHas('ports', tuple(Proto, DstPort)), concat(toString(DstPort), ': ', dictGet('ports', 'name', tuple(Proto, DstPort))), toString(DstPort))] AS values,
+ cityHash64(%s) AS hash
+FROM flows
+WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC')
+ORDER BY t DESC, hash DESC
+LIMIT 101`, hash),
+		}, {
+			Description: "filter and cursor",
+			Input: flowsHandlerInput{
+				Start:   time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				End:     time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				Filter:  query.NewFilter("DstCountry = 'FR'"),
+				Columns: []query.Column{query.NewColumn("ExporterName")},
+				Limit:   10,
+				Cursor:  flowsCursor{Time: 1649605510, Hash: 1234}.encode(),
+			},
+			Expected: fmt.Sprintf(`
+SELECT
+ TimeReceived AS t,
+ Bytes AS bytes,
+ Packets AS packets,
+ SamplingRate AS sampling_rate,
+ [ExporterName] AS values,
+ cityHash64(%s) AS hash
+FROM flows
+WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC') AND (DstCountry = 'FR') AND (t, hash) < (toDateTime(1649605510, 'UTC'), 1234)
+ORDER BY t DESC, hash DESC
+LIMIT 11`, hash),
+		}, {
+			Description: "export",
+			Input: flowsHandlerInput{
+				Start:   time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				End:     time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				Columns: []query.Column{query.NewColumn("ExporterName")},
+				Limit:   1000000,
+				Format:  "csv",
+			},
+			Expected: fmt.Sprintf(`
+SELECT
+ TimeReceived AS t,
+ Bytes AS bytes,
+ Packets AS packets,
+ SamplingRate AS sampling_rate,
+ [ExporterName] AS values,
+ cityHash64(%s) AS hash
+FROM flows
+WHERE TimeReceived BETWEEN toDateTime('2022-04-10 15:45:10', 'UTC') AND toDateTime('2022-04-11 15:45:10', 'UTC')
+ORDER BY t DESC, hash DESC
+LIMIT 1000000`, hash),
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			tc.Input.schema = sch
+			if err := tc.Input.Filter.Validate(tc.Input.schema); err != nil {
+				t.Fatalf("Validate() error:\n%+v", err)
+			}
+			got, err := tc.Input.toSQL()
+			if err != nil {
+				t.Fatalf("toSQL() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(strings.TrimSpace(got), strings.TrimSpace(tc.Expected)); diff != "" {
+				t.Errorf("toSQL() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestFlowsHandler(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+	base := time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC)
+
+	expectedSQL := []flowRecord{
+		{base.Add(2 * time.Second), 1500, 1, 1000, []string{"65000: Example", "443"}, 3},
+		{base.Add(time.Second), 1000, 2, 1000, []string{"65001: Other, Inc", "80"}, 2},
+		{base, 500, 1, 1000, []string{"65000: Example", "443"}, 1},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL[2:]).
+		Return(nil)
+	// Exports are streamed
+	for i := 0; i < 2; i++ {
+		mockRows := mocks.NewMockRows(ctrl)
+		mockConn.EXPECT().
+			Query(gomock.Any(), gomock.Any()).
+			Return(mockRows, nil)
+		mockRows.EXPECT().Next().Return(true).Times(2)
+		mockRows.EXPECT().Next().Return(false)
+		for _, flow := range expectedSQL[:2] {
+			mockRows.EXPECT().ScanStruct(gomock.Any()).SetArg(0, flow).Return(nil)
+		}
+		mockRows.EXPECT().Err().Return(nil)
+		mockRows.EXPECT().Close()
+	}
+
+	input := gin.H{
+		"start":   base,
+		"end":     base.Add(time.Hour),
+		"filter":  "DstCountry = 'FR'",
+		"columns": []string{"SrcAS", "DstPort"},
+		"limit":   2,
+	}
+	next := flowsCursor{Time: base.Add(time.Second).Unix(), Hash: 2}.encode()
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "first page",
+			URL:         "/api/v0/console/flows",
+			JSONInput:   input,
+			JSONOutput: gin.H{
+				"columns": []string{"TimeReceived", "Bytes", "Packets", "SamplingRate", "SrcAS", "DstPort"},
+				"flows": []gin.H{
+					{
+						"t":             "2022-04-10T15:45:12Z",
+						"bytes":         1500,
+						"packets":       1,
+						"sampling-rate": 1000,
+						"values":        []string{"65000: Example", "443"},
+					}, {
+						"t":             "2022-04-10T15:45:11Z",
+						"bytes":         1000,
+						"packets":       2,
+						"sampling-rate": 1000,
+						"values":        []string{"65001: Other, Inc", "80"},
+					},
+				},
+				"next": next,
+			},
+		}, {
+			Description: "CSV export",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":   base,
+				"end":     base.Add(time.Hour),
+				"columns": []string{"SrcAS", "DstPort"},
+				"limit":   2,
+				"format":  "csv",
+			},
+			ContentType: "text/csv; charset=utf-8",
+			FirstLines: []string{
+				"TimeReceived,Bytes,Packets,SamplingRate,SrcAS,DstPort",
+				"2022-04-10T15:45:12Z,1500,1,1000,65000: Example,443",
+				`2022-04-10T15:45:11Z,1000,2,1000,"65001: Other, Inc",80`,
+			},
+		}, {
+			Description: "JSON export",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":   base,
+				"end":     base.Add(time.Hour),
+				"columns": []string{"SrcAS", "DstPort"},
+				"limit":   2,
+				"format":  "json",
+			},
+			JSONOutput: gin.H{
+				"columns": []string{"TimeReceived", "Bytes", "Packets", "SamplingRate", "SrcAS", "DstPort"},
+				"flows": []gin.H{
+					{
+						"t":             "2022-04-10T15:45:12Z",
+						"bytes":         1500,
+						"packets":       1,
+						"sampling-rate": 1000,
+						"values":        []string{"65000: Example", "443"},
+					}, {
+						"t":             "2022-04-10T15:45:11Z",
+						"bytes":         1000,
+						"packets":       2,
+						"sampling-rate": 1000,
+						"values":        []string{"65001: Other, Inc", "80"},
+					},
+				},
+			},
+		}, {
+			Description: "last page",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":   base,
+				"end":     base.Add(time.Hour),
+				"columns": []string{"SrcAS", "DstPort"},
+				"limit":   2,
+				"cursor":  next,
+			},
+			JSONOutput: gin.H{
+				"columns": []string{"TimeReceived", "Bytes", "Packets", "SamplingRate", "SrcAS", "DstPort"},
+				"flows": []gin.H{
+					{
+						"t":             "2022-04-10T15:45:10Z",
+						"bytes":         500,
+						"packets":       1,
+						"sampling-rate": 1000,
+						"values":        []string{"65000: Example", "443"},
+					},
+				},
+			},
+		}, {
+			Description: "invalid cursor",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":  base,
+				"end":    base.Add(time.Hour),
+				"limit":  2,
+				"cursor": "hello",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Invalid cursor"},
+		}, {
+			Description: "limit too high",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start": base,
+				"end":   base.Add(time.Hour),
+				"limit": 100000,
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Limit is set beyond maximum value (10000)"},
+		}, {
+			Description: "export limit too high",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":  base,
+				"end":    base.Add(time.Hour),
+				"limit":  100000000,
+				"format": "csv",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Limit is set beyond maximum value (10000000)"},
+		}, {
+			Description: "invalid column",
+			URL:         "/api/v0/console/flows",
+			JSONInput: gin.H{
+				"start":   base,
+				"end":     base.Add(time.Hour),
+				"columns": []string{"Bytes"},
+				"limit":   2,
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Unknown column name Bytes"},
+		},
+	})
+}
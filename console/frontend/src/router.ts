@@ -4,6 +4,7 @@
 import { createRouter, createWebHistory } from "vue-router";
 import HomePage from "@/views/HomePage.vue";
 import VisualizePage from "@/views/VisualizePage.vue";
+import FlowsPage from "@/views/FlowsPage.vue";
 import DocumentationPage from "@/views/DocumentationPage.vue";
 import ErrorPage from "@/views/ErrorPage.vue";
 
@@ -36,6 +37,19 @@ const router = createRouter({
       meta: { title: "Visualize" },
       props: (route) => ({ routeState: route.params.state }),
     },
+    {
+      path: "/flows",
+      name: "Flows",
+      component: FlowsPage,
+      meta: { title: "Flows" },
+    },
+    {
+      path: "/flows/:state",
+      name: "FlowsWithState",
+      component: FlowsPage,
+      meta: { title: "Flows" },
+      props: (route) => ({ routeState: route.params.state }),
+    },
     {
       path: "/docs",
       redirect: "/docs/intro",
@@ -4,6 +4,7 @@
 package console
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -24,6 +25,21 @@ type graphCommonHandlerInput struct {
 	TruncateAddrV4 int            `json:"truncate-v4" binding:"min=0,max=32"`  // 0 or 32 = no truncation
 	TruncateAddrV6 int            `json:"truncate-v6" binding:"min=0,max=128"` // 0 or 128 = no truncation
 	Units          string         `json:"units" binding:"required,oneof=pps l3bps l2bps inl2% outl2%"`
+	// DeduplicateSites only keeps flows from a single site for each
+	// exporter. This is useful when exporters send flows to inlets in
+	// several sites.
+	DeduplicateSites bool `json:"deduplicate-sites"`
+}
+
+// validateSites checks if site deduplication can be used.
+func (input graphCommonHandlerInput) validateSites() error {
+	if !input.DeduplicateSites {
+		return nil
+	}
+	if column, _ := input.schema.LookupColumnByKey(schema.ColumnInletSite); column.Disabled {
+		return errors.New("site deduplication requires InletSite column")
+	}
+	return nil
 }
 
 // sourceSelect builds a SELECT query to use as a source for data. Notably, it
@@ -54,8 +70,17 @@ func (input graphCommonHandlerInput) sourceSelect() string {
 			}
 		}
 	}
+	where := ""
+	if input.DeduplicateSites {
+		// For each exporter, keep the site with the most flows
+		where = " WHERE ({{ .Exporter }}, InletSite) IN (" +
+			"SELECT exporter, argMax(InletSite, count) FROM (" +
+			"SELECT {{ .Exporter }} AS exporter, InletSite, COUNT(*) AS count FROM {{ .Table }} " +
+			"WHERE {{ .Timefilter }} GROUP BY exporter, InletSite" +
+			") GROUP BY exporter)"
+	}
 	if len(truncated) == 0 {
-		return "SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1"
+		return fmt.Sprintf("SELECT * FROM {{ .Table }}%s SETTINGS asterisk_include_alias_columns = 1", where)
 	}
-	return fmt.Sprintf("SELECT * REPLACE (%s) FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1", strings.Join(truncated, ", "))
+	return fmt.Sprintf("SELECT * REPLACE (%s) FROM {{ .Table }}%s SETTINGS asterisk_include_alias_columns = 1", strings.Join(truncated, ", "), where)
 }
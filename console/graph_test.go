@@ -54,6 +54,13 @@ func TestSourceSelect(t *testing.T) {
 				TruncateAddrV6: 40,
 			},
 			Expected: "SELECT * REPLACE (tupleElement(IPv6CIDRToRange(SrcAddr, if(tupleElement(IPv6CIDRToRange(SrcAddr, 96), 1) = toIPv6('::ffff:0.0.0.0'), 120, 40)), 1) AS SrcAddr) FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1",
+		}, {
+			Description: "site deduplication",
+			Input: graphCommonHandlerInput{
+				Dimensions:       []query.Column{query.NewColumn("SrcAddr")},
+				DeduplicateSites: true,
+			},
+			Expected: "SELECT * FROM {{ .Table }} WHERE ({{ .Exporter }}, InletSite) IN (SELECT exporter, argMax(InletSite, count) FROM (SELECT {{ .Exporter }} AS exporter, InletSite, COUNT(*) AS count FROM {{ .Table }} WHERE {{ .Timefilter }} GROUP BY exporter, InletSite) GROUP BY exporter) SETTINGS asterisk_include_alias_columns = 1",
 		},
 	}
 	for _, tc := range cases {
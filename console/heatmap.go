@@ -0,0 +1,208 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+// graphHeatmapHandlerInput describes the input for the /graph/heatmap
+// endpoint.
+type graphHeatmapHandlerInput struct {
+	schema   *schema.Component
+	Start    time.Time    `json:"start" binding:"required"`
+	End      time.Time    `json:"end" binding:"required,gtfield=Start"`
+	Filter   query.Filter `json:"filter"` // where ...
+	Units    string       `json:"units" binding:"required,oneof=pps l3bps l2bps"`
+	X        string       `json:"x" binding:"required,oneof=hour-of-day day-of-week"`
+	Y        string       `json:"y" binding:"omitempty,oneof=hour-of-day day-of-week,nefield=X"`
+	Timezone string       `json:"timezone"` // UTC when empty
+}
+
+// graphHeatmapHandlerOutput describes the output for the /graph/heatmap
+// endpoint. Xps is indexed by row (Y) and then by column (X).
+type graphHeatmapHandlerOutput struct {
+	X   []string `json:"x"`
+	Y   []string `json:"y"`
+	Xps [][]int  `json:"xps"`
+}
+
+// heatmapAxis describes how to bucket flows along one axis of a heatmap.
+type heatmapAxis struct {
+	expression string              // SQL expression, %s is the time
+	labels     []string            // label for each bucket
+	index      func(time.Time) int // bucket for a time
+}
+
+var heatmapAxes = map[string]heatmapAxis{
+	"hour-of-day": {
+		expression: "toHour(%s)",
+		labels: func() []string {
+			labels := make([]string, 24)
+			for i := range labels {
+				labels[i] = fmt.Sprintf("%02d:00", i)
+			}
+			return labels
+		}(),
+		index: func(t time.Time) int { return t.Hour() },
+	},
+	"day-of-week": {
+		expression: "toUInt8(toDayOfWeek(%s) - 1)", // Monday is 1
+		labels: []string{
+			"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday",
+		},
+		index: func(t time.Time) int { return (int(t.Weekday()) + 6) % 7 },
+	},
+}
+
+var timezoneRegex = regexp.MustCompile(`^[A-Za-z0-9_+/-]+$`)
+
+// location returns the location to use to bucket flows.
+func (input graphHeatmapHandlerInput) location() (*time.Location, error) {
+	if input.Timezone == "" {
+		return time.UTC, nil
+	}
+	if !timezoneRegex.MatchString(input.Timezone) {
+		return nil, fmt.Errorf("invalid timezone %q", input.Timezone)
+	}
+	loc, err := time.LoadLocation(input.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", input.Timezone, err)
+	}
+	return loc, nil
+}
+
+// toSQL converts a heatmap query to an SQL request
+func (input graphHeatmapHandlerInput) toSQL() string {
+	timezone := input.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	t := fmt.Sprintf("toTimeZone(TimeReceived, '%s')", timezone)
+	x := fmt.Sprintf(heatmapAxes[input.X].expression, t)
+	y := "0"
+	if input.Y != "" {
+		y = fmt.Sprintf(heatmapAxes[input.Y].expression, t)
+	}
+	// We need a resolution of at most one hour.
+	points := max(uint(input.End.Sub(input.Start)/time.Hour), 1)
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+SELECT
+ {{ .Units }} AS units,
+ %s AS x,
+ %s AS y
+FROM {{ .Table }}
+WHERE %s
+GROUP BY x, y
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: requireMainTable(input.schema, nil, input.Filter),
+			Points:            points,
+			Units:             input.Units,
+		}),
+		x, y, templateWhere(input.Filter))
+	return strings.TrimSpace(sqlQuery)
+}
+
+// heatmapSeconds returns, for each bucket, the number of seconds of the
+// requested range falling into it.
+func (input graphHeatmapHandlerInput) heatmapSeconds(loc *time.Location) [][]float64 {
+	xAxis := heatmapAxes[input.X]
+	yAxis, hasY := heatmapAxes[input.Y]
+	rows := 1
+	if hasY {
+		rows = len(yAxis.labels)
+	}
+	seconds := make([][]float64, rows)
+	for i := range seconds {
+		seconds[i] = make([]float64, len(xAxis.labels))
+	}
+	for t := input.Start.In(loc); t.Before(input.End); {
+		next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc).Add(time.Hour)
+		if next.After(input.End) {
+			next = input.End
+		}
+		y := 0
+		if hasY {
+			y = yAxis.index(t)
+		}
+		seconds[y][xAxis.index(t)] += next.Sub(t).Seconds()
+		t = next.In(loc)
+	}
+	return seconds
+}
+
+func (c *Component) graphHeatmapHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	input := graphHeatmapHandlerInput{schema: c.d.Schema}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	loc, err := input.location()
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := checkFilterAccess(c.d.Schema, c.restrictedColumns(gc), input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	c.recordUsage("heatmap", nil, input.Filter)
+
+	// Prepare and execute query
+	sqlQuery := c.finalizeQuery(input.toSQL())
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	results := []struct {
+		Units uint64 `ch:"units"`
+		X     uint8  `ch:"x"`
+		Y     uint8  `ch:"y"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+
+	// Prepare output. Each bucket is averaged over the time spent in it.
+	seconds := input.heatmapSeconds(loc)
+	output := graphHeatmapHandlerOutput{
+		X:   heatmapAxes[input.X].labels,
+		Y:   []string{},
+		Xps: make([][]int, len(seconds)),
+	}
+	if input.Y != "" {
+		output.Y = heatmapAxes[input.Y].labels
+	}
+	for i := range output.Xps {
+		output.Xps[i] = make([]int, len(output.X))
+	}
+	for _, result := range results {
+		x, y := int(result.X), int(result.Y)
+		if y >= len(seconds) || x >= len(seconds[y]) || seconds[y][x] == 0 {
+			continue
+		}
+		output.Xps[y][x] = int(float64(result.Units) / seconds[y][x])
+	}
+
+	gc.JSON(http.StatusOK, output)
+}
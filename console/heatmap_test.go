@@ -0,0 +1,187 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestHeatmapQuerySQL(t *testing.T) {
+	cases := []struct {
+		Description string
+		Input       graphHeatmapHandlerInput
+		Expected    string
+	}{
+		{
+			Description: "hour of day",
+			Input: graphHeatmapHandlerInput{
+				Start: time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				End:   time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				Units: "l3bps",
+				X:     "hour-of-day",
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":24,"units":"l3bps"}@@ }}
+SELECT
+ {{ .Units }} AS units,
+ toHour(toTimeZone(TimeReceived, 'UTC')) AS x,
+ 0 AS y
+FROM {{ .Table }}
+WHERE {{ .Timefilter }}
+GROUP BY x, y
+{{ end }}`,
+		}, {
+			Description: "hour of day and day of week with timezone and filter",
+			Input: graphHeatmapHandlerInput{
+				Start:    time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+				End:      time.Date(2022, 5, 1, 0, 0, 0, 0, time.UTC),
+				Filter:   query.NewFilter("InIfBoundary = external"),
+				Units:    "pps",
+				X:        "hour-of-day",
+				Y:        "day-of-week",
+				Timezone: "Europe/Paris",
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-01T00:00:00Z","end":"2022-05-01T00:00:00Z","points":720,"units":"pps"}@@ }}
+SELECT
+ {{ .Units }} AS units,
+ toHour(toTimeZone(TimeReceived, 'Europe/Paris')) AS x,
+ toUInt8(toDayOfWeek(toTimeZone(TimeReceived, 'Europe/Paris')) - 1) AS y
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (InIfBoundary = 'external')
+GROUP BY x, y
+{{ end }}`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			tc.Input.schema = schema.NewMock(t)
+			if err := tc.Input.Filter.Validate(tc.Input.schema); err != nil {
+				t.Fatalf("Validate() error:\n%+v", err)
+			}
+			tc.Expected = strings.ReplaceAll(strings.TrimSpace(tc.Expected), "@@", "`")
+			if diff := helpers.Diff(tc.Input.toSQL(), tc.Expected); diff != "" {
+				t.Fatalf("toSQL() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHeatmapSeconds(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("LoadLocation() error:\n%+v", err)
+	}
+	input := graphHeatmapHandlerInput{
+		// Sunday 21:30 UTC to Monday 23:30 UTC
+		Start: time.Date(2022, 4, 10, 21, 30, 0, 0, time.UTC),
+		End:   time.Date(2022, 4, 11, 23, 30, 0, 0, time.UTC),
+		X:     "hour-of-day",
+		Y:     "day-of-week",
+	}
+	seconds := input.heatmapSeconds(paris)
+	// Paris is UTC+2: Sunday 23:30 to Tuesday 01:30
+	if got := seconds[6][23]; got != 1800 {
+		t.Errorf("heatmapSeconds()[Sunday][23] == %v, expected 1800", got)
+	}
+	for hour := 0; hour < 24; hour++ {
+		if got := seconds[0][hour]; got != 3600 {
+			t.Errorf("heatmapSeconds()[Monday][%d] == %v, expected 3600", hour, got)
+		}
+	}
+	if got := seconds[1][0]; got != 3600 {
+		t.Errorf("heatmapSeconds()[Tuesday][0] == %v, expected 3600", got)
+	}
+	if got := seconds[1][1]; got != 1800 {
+		t.Errorf("heatmapSeconds()[Tuesday][1] == %v, expected 1800", got)
+	}
+	if got := seconds[2][0]; got != 0 {
+		t.Errorf("heatmapSeconds()[Wednesday][0] == %v, expected 0", got)
+	}
+}
+
+func TestHeatmapHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expectedSQL := []struct {
+		Units uint64 `ch:"units"`
+		X     uint8  `ch:"x"`
+		Y     uint8  `ch:"y"`
+	}{
+		{3600 * 1000, 10, 0},
+		{3600 * 2000, 10, 1},
+		{3600 * 3000, 11, 1},
+		{3600 * 4000, 11, 5}, // not in the range
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	expectedXps := make([][]int, 7)
+	for i := range expectedXps {
+		expectedXps[i] = make([]int, 24)
+	}
+	expectedXps[0][10] = 1000
+	expectedXps[1][10] = 2000
+	expectedXps[1][11] = 3000
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "heatmap",
+			URL:         "/api/v0/console/graph/heatmap",
+			JSONInput: gin.H{
+				"start": time.Date(2022, 4, 11, 0, 0, 0, 0, time.UTC),
+				"end":   time.Date(2022, 4, 13, 0, 0, 0, 0, time.UTC),
+				"units": "l3bps",
+				"x":     "hour-of-day",
+				"y":     "day-of-week",
+			},
+			JSONOutput: gin.H{
+				"x": heatmapAxes["hour-of-day"].labels,
+				"y": []string{
+					"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday",
+				},
+				"xps": expectedXps,
+			},
+		}, {
+			Description: "same axes",
+			URL:         "/api/v0/console/graph/heatmap",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"start": time.Date(2022, 4, 11, 0, 0, 0, 0, time.UTC),
+				"end":   time.Date(2022, 4, 13, 0, 0, 0, 0, time.UTC),
+				"units": "l3bps",
+				"x":     "day-of-week",
+				"y":     "day-of-week",
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'graphHeatmapHandlerInput.Y' Error:Field validation for 'Y' failed on the 'nefield' tag",
+			},
+		}, {
+			Description: "invalid timezone",
+			URL:         "/api/v0/console/graph/heatmap",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"start":    time.Date(2022, 4, 11, 0, 0, 0, 0, time.UTC),
+				"end":      time.Date(2022, 4, 13, 0, 0, 0, 0, time.UTC),
+				"units":    "l3bps",
+				"x":        "hour-of-day",
+				"timezone": "UTC'; DROP TABLE flows",
+			},
+			JSONOutput: gin.H{
+				"message": `Invalid timezone "UTC'; DROP TABLE flows"`,
+			},
+		},
+	})
+}
@@ -4,6 +4,8 @@
 package console
 
 import (
+	stdcontext "context"
+	"errors"
 	"fmt"
 	"net/http"
 	"sort"
@@ -23,6 +25,21 @@ type graphLineHandlerInput struct {
 	Points         uint `json:"points" binding:"required,min=5,max=2000"` // minimum number of points
 	Bidirectional  bool `json:"bidirectional"`
 	PreviousPeriod bool `json:"previous-period"`
+	// LimitType is the metric used to select the top rows over the whole
+	// range: average, maximum, or 95th percentile. Average is the default.
+	LimitType string `json:"limit-type" binding:"omitempty,oneof=avg max p95"`
+	// Ratio turns the values into the percentage of the traffic matching the
+	// numerator filter over the traffic matching the denominator filter.
+	Ratio *graphLineRatio `json:"ratio,omitempty"`
+	// Probes lists the latency and loss probes to display along the
+	// traffic.
+	Probes []string `json:"probes" binding:"max=10"`
+}
+
+// graphLineRatio describes a ratio between two subsets of the traffic.
+type graphLineRatio struct {
+	Numerator   query.Filter `json:"numerator"`
+	Denominator query.Filter `json:"denominator"` // empty for the whole traffic
 }
 
 // graphLineHandlerOutput describes the output for the /graph/line endpoint. A
@@ -30,21 +47,28 @@ type graphLineHandlerInput struct {
 // direct direction and axis 2 is for the reverse direction. Rows are
 // sorted by axis, then by the sum of traffic.
 type graphLineHandlerOutput struct {
-	Time                 []time.Time    `json:"t"`
-	Rows                 [][]string     `json:"rows"`   // List of rows
-	Points               [][]int        `json:"points"` // t → row → xps
-	Axis                 []int          `json:"axis"`   // row → axis
-	AxisNames            map[int]string `json:"axis-names"`
-	Average              []int          `json:"average"` // row → average xps
-	Min                  []int          `json:"min"`     // row → min xps
-	Max                  []int          `json:"max"`     // row → max xps
-	NinetyFivePercentile []int          `json:"95th"`    // row → 95th xps
+	Time                 []time.Time      `json:"t"`
+	Rows                 [][]string       `json:"rows"`   // List of rows
+	Points               [][]int          `json:"points"` // t → row → xps
+	Axis                 []int            `json:"axis"`   // row → axis
+	AxisNames            map[int]string   `json:"axis-names"`
+	Average              []int            `json:"average"` // row → average xps
+	Min                  []int            `json:"min"`     // row → min xps
+	Max                  []int            `json:"max"`     // row → max xps
+	NinetyFivePercentile []int            `json:"95th"`    // row → 95th xps
+	Probes               []graphLineProbe `json:"probes,omitempty"`
 }
 
 // reverseDirection reverts the direction of a provided input. It does not
 // modify the original.
 func (input graphLineHandlerInput) reverseDirection() graphLineHandlerInput {
 	input.Filter.Swap()
+	if input.Ratio != nil {
+		ratio := *input.Ratio
+		ratio.Numerator.Swap()
+		ratio.Denominator.Swap()
+		input.Ratio = &ratio
+	}
 	input.Dimensions = slices.Clone(input.Dimensions)
 	query.Columns(input.Dimensions).Reverse(input.schema)
 	return input
@@ -92,6 +116,38 @@ func (input graphLineHandlerInput) previousPeriod() graphLineHandlerInput {
 	return input
 }
 
+// requireMainTable tells if the main table is required, including for the
+// ratio filters.
+func (input graphLineHandlerInput) requireMainTable() bool {
+	if input.Ratio != nil &&
+		(input.Ratio.Numerator.MainTableRequired() || input.Ratio.Denominator.MainTableRequired()) {
+		return true
+	}
+	return requireMainTable(input.schema, input.Dimensions, input.Filter)
+}
+
+// validateRatio validates the ratio filters.
+func (input *graphLineHandlerInput) validateRatio() error {
+	if input.Ratio == nil {
+		return nil
+	}
+	switch input.Units {
+	case "pps", "l3bps", "l2bps":
+	default:
+		return fmt.Errorf("ratio cannot be used with %s units", input.Units)
+	}
+	if input.Ratio.Numerator.String() == "" {
+		return errors.New("ratio requires a numerator filter")
+	}
+	if err := input.Ratio.Numerator.Validate(input.schema); err != nil {
+		return fmt.Errorf("numerator: %w", err)
+	}
+	if err := input.Ratio.Denominator.Validate(input.schema); err != nil {
+		return fmt.Errorf("denominator: %w", err)
+	}
+	return nil
+}
+
 type toSQL1Options struct {
 	skipWithClause   bool
 	reverseDirection bool
@@ -109,9 +165,19 @@ func (input graphLineHandlerInput) toSQL1(axis int, options toSQL1Options) strin
 	where := templateWhere(input.Filter)
 
 	// Select
+	xps := `{{ .Units }}/{{ .Interval }}`
+	if input.Ratio != nil {
+		denominator := `SUM({{ .UnitsValue }})`
+		if input.Ratio.Denominator.Direct() != "" {
+			denominator = fmt.Sprintf(`sumIf({{ .UnitsValue }}, %s)`,
+				templateEscape(input.Ratio.Denominator.Direct()))
+		}
+		xps = fmt.Sprintf(`ifNotFinite(100*sumIf({{ .UnitsValue }}, %s)/%s, 0)`,
+			templateEscape(input.Ratio.Numerator.Direct()), denominator)
+	}
 	fields := []string{
 		fmt.Sprintf(`{{ call .ToStartOfInterval "TimeReceived" }}%s AS time`, offsetShift),
-		`{{ .Units }}/{{ .Interval }} AS xps`,
+		fmt.Sprintf(`%s AS xps`, xps),
 	}
 	selectFields := []string{}
 	dimensions := []string{}
@@ -139,12 +205,7 @@ func (input graphLineHandlerInput) toSQL1(axis int, options toSQL1Options) strin
 	if !options.skipWithClause {
 		with := []string{fmt.Sprintf("source AS (%s)", input.sourceSelect())}
 		if len(dimensions) > 0 {
-			with = append(with, fmt.Sprintf(
-				"rows AS (SELECT %s FROM source WHERE %s GROUP BY %s ORDER BY SUM(Bytes) DESC LIMIT %d)",
-				strings.Join(dimensions, ", "),
-				where,
-				strings.Join(dimensions, ", "),
-				input.Limit))
+			with = append(with, fmt.Sprintf("rows AS (%s)", input.rowsSelect(dimensions, where)))
 		}
 		if len(with) > 0 {
 			withStr = fmt.Sprintf("\nWITH\n %s", strings.Join(with, ",\n "))
@@ -180,7 +241,7 @@ ORDER BY time WITH FILL
 			Start:             input.Start,
 			End:               input.End,
 			StartForInterval:  startForInterval,
-			MainTableRequired: requireMainTable(input.schema, input.Dimensions, input.Filter),
+			MainTableRequired: input.requireMainTable(),
 			Points:            input.Points,
 			Units:             units,
 		}),
@@ -190,6 +251,28 @@ ORDER BY time WITH FILL
 	return strings.TrimSpace(sqlQuery)
 }
 
+// rowsSelect builds the SELECT query returning the top rows. They are
+// selected over the whole range, so the same rows are displayed for each
+// point. For maximum and 95th percentile, the metric is computed from the
+// values at each interval the row is present.
+func (input graphLineHandlerInput) rowsSelect(dimensions []string, where string) string {
+	groupBy := strings.Join(dimensions, ", ")
+	switch input.LimitType {
+	case "max", "p95":
+		metric := "MAX(xps)"
+		if input.LimitType == "p95" {
+			metric = "quantile(0.95)(xps)"
+		}
+		return fmt.Sprintf(
+			`SELECT %s FROM (SELECT %s, {{ .Units }} AS xps FROM source WHERE %s GROUP BY {{ call .ToStartOfInterval "TimeReceived" }}, %s) GROUP BY %s ORDER BY %s DESC, %s LIMIT %d`,
+			groupBy, groupBy, where, groupBy, groupBy, metric, groupBy, input.Limit)
+	default:
+		return fmt.Sprintf(
+			"SELECT %s FROM source WHERE %s GROUP BY %s ORDER BY {{ .Units }} DESC, %s LIMIT %d",
+			groupBy, where, groupBy, groupBy, input.Limit)
+	}
+}
+
 // toSQL converts a graph input to an SQL request
 func (input graphLineHandlerInput) toSQL() string {
 	parts := []string{input.toSQL1(1, toSQL1Options{})}
@@ -232,17 +315,102 @@ func (c *Component) graphLineHandlerFunc(gc *gin.Context) {
 		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
 		return
 	}
+	if err := input.validateRatio(); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.validateSites(); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	restricted := c.restrictedColumns(gc)
+	if err := input.applyColumnAccess(restricted); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Ratio != nil {
+		for _, qf := range []query.Filter{input.Ratio.Numerator, input.Ratio.Denominator} {
+			if err := checkFilterAccess(c.d.Schema, restricted, qf); err != nil {
+				gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+				return
+			}
+		}
+	}
 	if input.Limit > c.config.DimensionsLimit {
 		gc.JSON(http.StatusBadRequest,
 			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
 				c.config.DimensionsLimit)})
 		return
 	}
+	filters := []query.Filter{input.Filter}
+	if input.Ratio != nil {
+		filters = append(filters, input.Ratio.Numerator, input.Ratio.Denominator)
+	}
+	c.recordUsage("line", input.Dimensions, filters...)
 
 	sqlQuery := input.toSQL()
 	sqlQuery = c.finalizeQuery(sqlQuery)
 	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
 
+	output, err := c.computeGraphLine(ctx, input, sqlQuery)
+	if err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	if len(input.Probes) > 0 {
+		sqlQuery := c.finalizeQuery(input.probesSQL())
+		output.Probes, err = c.computeGraphLineProbes(ctx, input, sqlQuery, output.Time)
+		if err != nil {
+			c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+			gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+			return
+		}
+	}
+	gc.JSON(http.StatusOK, output)
+}
+
+// lineStatistics returns the minimum (but not 0), the maximum and the 95th
+// percentile of the provided points.
+func lineStatistics(points []int) (int, int, int) {
+	// We will sort the values. It is needed for 95th percentile but it
+	// helps for min/max too. We remove special cases for 0 or 1 point.
+	nbPoints := len(points)
+	if nbPoints == 0 {
+		return 0, 0, 0
+	}
+	if nbPoints == 1 {
+		return points[0], points[0], points[0]
+	}
+	points = slices.Clone(points)
+	sort.Ints(points)
+
+	// Min (but not 0)
+	var minimum, percentile int
+	for j := 0; j < nbPoints; j++ {
+		minimum = points[j]
+		if points[j] > 0 {
+			break
+		}
+	}
+	// Max
+	maximum := points[nbPoints-1]
+	// 95th percentile
+	index := 0.95 * float64(nbPoints)
+	j := int(index)
+	if index == float64(j) {
+		percentile = points[j-1]
+	} else if index > 1 {
+		// We use the average of the two values. This
+		// is good enough for bps/pps
+		percentile = (points[j-1] + points[j]) / 2
+	}
+	return minimum, maximum, percentile
+}
+
+// computeGraphLine executes the provided SQL query for a line graph and
+// builds the output from the result.
+func (c *Component) computeGraphLine(ctx stdcontext.Context, input graphLineHandlerInput, sqlQuery string) (graphLineHandlerOutput, error) {
 	results := []struct {
 		Axis       uint8     `ch:"axis"`
 		Time       time.Time `ch:"time"`
@@ -250,9 +418,7 @@ func (c *Component) graphLineHandlerFunc(gc *gin.Context) {
 		Dimensions []string  `ch:"dimensions"`
 	}{}
 	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
-		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
-		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
-		return
+		return graphLineHandlerOutput{}, err
 	}
 
 	// When filling 0 value, we may get an empty dimensions.
@@ -323,23 +489,39 @@ func (c *Component) graphLineHandlerFunc(gc *gin.Context) {
 	}
 	// Sort axes
 	sort.Ints(axes)
-	// Sort the rows using the sums
+	// Sort the rows using the metric used to select them. "Other" is
+	// always last and ties are broken with the dimensions to get the same
+	// order on each request.
 	sortedRowKeys := map[int][]string{}
 	for _, axis := range axes {
 		sortedRowKeys[axis] = make([]string, 0, len(rows[axis]))
+		metrics := make(map[string]uint64, len(rows[axis]))
 		for k := range rows[axis] {
 			sortedRowKeys[axis] = append(sortedRowKeys[axis], k)
+			switch input.LimitType {
+			case "max", "p95":
+				_, maximum, percentile := lineStatistics(points[axis][k])
+				if input.LimitType == "max" {
+					metrics[k] = uint64(maximum)
+				} else {
+					metrics[k] = uint64(percentile)
+				}
+			default:
+				metrics[k] = sums[axis][k]
+			}
 		}
 		sort.Slice(sortedRowKeys[axis], func(i, j int) bool {
 			iKey := sortedRowKeys[axis][i]
 			jKey := sortedRowKeys[axis][j]
-			if rows[axis][iKey][0] == "Other" {
-				return false
+			iOther := rows[axis][iKey][0] == "Other"
+			jOther := rows[axis][jKey][0] == "Other"
+			if iOther != jOther {
+				return jOther
 			}
-			if rows[axis][jKey][0] == "Other" {
-				return true
+			if metrics[iKey] != metrics[jKey] {
+				return metrics[iKey] > metrics[jKey]
 			}
-			return sums[axis][iKey] > sums[axis][jKey]
+			return iKey < jKey
 		})
 	}
 
@@ -365,46 +547,7 @@ func (c *Component) graphLineHandlerFunc(gc *gin.Context) {
 			output.Axis[i] = axis
 			output.Points[i] = points[axis][k]
 			output.Average[i] = int(sums[axis][k] / uint64(len(output.Time)))
-
-			// For remaining, we will sort the values. It
-			// is needed for 95th percentile but it helps
-			// for min/max too. We remove special cases
-			// for 0 or 1 point.
-			nbPoints := len(output.Points[i])
-			if nbPoints == 0 {
-				continue
-			}
-			if nbPoints == 1 {
-				v := output.Points[i][0]
-				output.Min[i] = v
-				output.Max[i] = v
-				output.NinetyFivePercentile[i] = v
-				continue
-			}
-
-			points := make([]int, nbPoints)
-			copy(points, output.Points[i])
-			sort.Ints(points)
-
-			// Min (but not 0)
-			for j := 0; j < nbPoints; j++ {
-				output.Min[i] = points[j]
-				if points[j] > 0 {
-					break
-				}
-			}
-			// Max
-			output.Max[i] = points[nbPoints-1]
-			// 95th percentile
-			index := 0.95 * float64(nbPoints)
-			j := int(index)
-			if index == float64(j) {
-				output.NinetyFivePercentile[i] = points[j-1]
-			} else if index > 1 {
-				// We use the average of the two values. This
-				// is good enough for bps/pps
-				output.NinetyFivePercentile[i] = (points[j-1] + points[j]) / 2
-			}
+			output.Min[i], output.Max[i], output.NinetyFivePercentile[i] = lineStatistics(output.Points[i])
 		}
 	}
 
@@ -420,5 +563,5 @@ func (c *Component) graphLineHandlerFunc(gc *gin.Context) {
 			output.AxisNames[axis] = fmt.Sprintf("Previous %s", name)
 		}
 	}
-	gc.JSON(http.StatusOK, output)
+	return output, nil
 }
@@ -5,6 +5,7 @@ package console
 
 import (
 	"fmt"
+	"maps"
 	"strings"
 	"testing"
 	"time"
@@ -261,7 +262,7 @@ ORDER BY time WITH FILL
 {{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","main-table-required":true,"points":100,"units":"l3bps"}@@ }}
 WITH
  source AS (SELECT * REPLACE (tupleElement(IPv6CIDRToRange(SrcAddr, if(tupleElement(IPv6CIDRToRange(SrcAddr, 96), 1) = toIPv6('::ffff:0.0.0.0'), 120, 48)), 1) AS SrcAddr) FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
- rows AS (SELECT SrcAddr FROM source WHERE {{ .Timefilter }} AND (SrcAddr BETWEEN toIPv6('::ffff:1.0.0.0') AND toIPv6('::ffff:1.255.255.255')) GROUP BY SrcAddr ORDER BY SUM(Bytes) DESC LIMIT 0)
+ rows AS (SELECT SrcAddr FROM source WHERE {{ .Timefilter }} AND (SrcAddr BETWEEN toIPv6('::ffff:1.0.0.0') AND toIPv6('::ffff:1.255.255.255')) GROUP BY SrcAddr ORDER BY {{ .Units }} DESC, SrcAddr LIMIT 0)
 SELECT 1 AS axis, * FROM (
 SELECT
  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
@@ -450,7 +451,79 @@ ORDER BY time WITH FILL
 {{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
 WITH
  source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
- rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY SUM(Bytes) DESC LIMIT 20)
+ rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY {{ .Units }} DESC, ExporterName, InIfProvider LIMIT 20)
+SELECT 1 AS axis, * FROM (
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ {{ .Units }}/{{ .Interval }} AS xps,
+ if((ExporterName, InIfProvider) IN rows, [ExporterName, InIfProvider], ['Other', 'Other']) AS dimensions
+FROM source
+WHERE {{ .Timefilter }}
+GROUP BY time, dimensions
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+ INTERPOLATE (dimensions AS ['Other', 'Other']))
+{{ end }}`,
+		}, {
+			Description: "no filters, top by maximum",
+			Input: graphLineHandlerInput{
+				graphCommonHandlerInput: graphCommonHandlerInput{
+					Start: time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+					End:   time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+					Limit: 20,
+					Dimensions: []query.Column{
+						query.NewColumn("ExporterName"),
+						query.NewColumn("InIfProvider"),
+					},
+					Filter: query.Filter{},
+					Units:  "l3bps",
+				},
+				Points:    100,
+				LimitType: "max",
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
+WITH
+ source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
+ rows AS (SELECT ExporterName, InIfProvider FROM (SELECT ExporterName, InIfProvider, {{ .Units }} AS xps FROM source WHERE {{ .Timefilter }} GROUP BY {{ call .ToStartOfInterval "TimeReceived" }}, ExporterName, InIfProvider) GROUP BY ExporterName, InIfProvider ORDER BY MAX(xps) DESC, ExporterName, InIfProvider LIMIT 20)
+SELECT 1 AS axis, * FROM (
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ {{ .Units }}/{{ .Interval }} AS xps,
+ if((ExporterName, InIfProvider) IN rows, [ExporterName, InIfProvider], ['Other', 'Other']) AS dimensions
+FROM source
+WHERE {{ .Timefilter }}
+GROUP BY time, dimensions
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+ INTERPOLATE (dimensions AS ['Other', 'Other']))
+{{ end }}`,
+		}, {
+			Description: "no filters, top by 95th percentile",
+			Input: graphLineHandlerInput{
+				graphCommonHandlerInput: graphCommonHandlerInput{
+					Start: time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+					End:   time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+					Limit: 20,
+					Dimensions: []query.Column{
+						query.NewColumn("ExporterName"),
+						query.NewColumn("InIfProvider"),
+					},
+					Filter: query.Filter{},
+					Units:  "l3bps",
+				},
+				Points:    100,
+				LimitType: "p95",
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
+WITH
+ source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
+ rows AS (SELECT ExporterName, InIfProvider FROM (SELECT ExporterName, InIfProvider, {{ .Units }} AS xps FROM source WHERE {{ .Timefilter }} GROUP BY {{ call .ToStartOfInterval "TimeReceived" }}, ExporterName, InIfProvider) GROUP BY ExporterName, InIfProvider ORDER BY quantile(0.95)(xps) DESC, ExporterName, InIfProvider LIMIT 20)
 SELECT 1 AS axis, * FROM (
 SELECT
  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
@@ -486,7 +559,7 @@ ORDER BY time WITH FILL
 {{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
 WITH
  source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
- rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY SUM(Bytes) DESC LIMIT 20)
+ rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY {{ .Units }} DESC, ExporterName, InIfProvider LIMIT 20)
 SELECT 1 AS axis, * FROM (
 SELECT
  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
@@ -538,7 +611,7 @@ ORDER BY time WITH FILL
 {{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
 WITH
  source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
- rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY SUM(Bytes) DESC LIMIT 20)
+ rows AS (SELECT ExporterName, InIfProvider FROM source WHERE {{ .Timefilter }} GROUP BY ExporterName, InIfProvider ORDER BY {{ .Units }} DESC, ExporterName, InIfProvider LIMIT 20)
 SELECT 1 AS axis, * FROM (
 SELECT
  {{ call .ToStartOfInterval "TimeReceived" }} AS time,
@@ -568,6 +641,92 @@ ORDER BY time WITH FILL
  TO {{ .TimefilterEnd }} + INTERVAL 1 second + INTERVAL 86400 second
  STEP {{ .Interval }}
  INTERPOLATE (dimensions AS emptyArrayString()))
+{{ end }}`,
+		}, {
+			Description: "ratio of whole traffic, bidirectional",
+			Input: graphLineHandlerInput{
+				graphCommonHandlerInput: graphCommonHandlerInput{
+					Start:      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+					End:        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+					Dimensions: []query.Column{},
+					Filter:     query.Filter{},
+					Units:      "l3bps",
+				},
+				Points:        100,
+				Bidirectional: true,
+				Ratio: &graphLineRatio{
+					Numerator: query.NewFilter("EType = IPv6 AND InIfBoundary = external"),
+				},
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
+WITH
+ source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1)
+SELECT 1 AS axis, * FROM (
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ ifNotFinite(100*sumIf({{ .UnitsValue }}, EType = 34525 AND InIfBoundary = 'external')/SUM({{ .UnitsValue }}), 0) AS xps,
+ emptyArrayString() AS dimensions
+FROM source
+WHERE {{ .Timefilter }}
+GROUP BY time, dimensions
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+ INTERPOLATE (dimensions AS emptyArrayString()))
+{{ end }}
+UNION ALL
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"l3bps"}@@ }}
+SELECT 2 AS axis, * FROM (
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ ifNotFinite(100*sumIf({{ .UnitsValue }}, EType = 34525 AND OutIfBoundary = 'external')/SUM({{ .UnitsValue }}), 0) AS xps,
+ emptyArrayString() AS dimensions
+FROM source
+WHERE {{ .Timefilter }}
+GROUP BY time, dimensions
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+ INTERPOLATE (dimensions AS emptyArrayString()))
+{{ end }}`,
+		}, {
+			Description: "ratio of two subsets",
+			Input: graphLineHandlerInput{
+				graphCommonHandlerInput: graphCommonHandlerInput{
+					Start:      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+					End:        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+					Dimensions: []query.Column{query.NewColumn("ExporterName")},
+					Filter:     query.NewFilter("DstCountry = 'FR'"),
+					Limit:      20,
+					Units:      "pps",
+				},
+				Points: 100,
+				Ratio: &graphLineRatio{
+					Numerator:   query.NewFilter("InIfBoundary = external"),
+					Denominator: query.NewFilter("InIfBoundary = internal"),
+				},
+			},
+			Expected: `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100,"units":"pps"}@@ }}
+WITH
+ source AS (SELECT * FROM {{ .Table }} SETTINGS asterisk_include_alias_columns = 1),
+ rows AS (SELECT ExporterName FROM source WHERE {{ .Timefilter }} AND (DstCountry = 'FR') GROUP BY ExporterName ORDER BY {{ .Units }} DESC, ExporterName LIMIT 20)
+SELECT 1 AS axis, * FROM (
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ ifNotFinite(100*sumIf({{ .UnitsValue }}, InIfBoundary = 'external')/sumIf({{ .UnitsValue }}, InIfBoundary = 'internal'), 0) AS xps,
+ if((ExporterName) IN rows, [ExporterName], ['Other']) AS dimensions
+FROM source
+WHERE {{ .Timefilter }} AND (DstCountry = 'FR')
+GROUP BY time, dimensions
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+ INTERPOLATE (dimensions AS ['Other']))
 {{ end }}`,
 		},
 	}
@@ -579,6 +738,9 @@ ORDER BY time WITH FILL
 		if err := tc.Input.Filter.Validate(tc.Input.schema); err != nil {
 			t.Fatalf("Validate() error:\n%+v", err)
 		}
+		if err := tc.Input.validateRatio(); err != nil {
+			t.Fatalf("validateRatio() error:\n%+v", err)
+		}
 		tc.Expected = strings.ReplaceAll(tc.Expected, "@@", "`")
 		t.Run(tc.Description, func(t *testing.T) {
 			got := tc.Input.toSQL()
@@ -979,3 +1141,160 @@ func TestGraphLineHandler(t *testing.T) {
 		},
 	})
 }
+
+func TestGraphLineHandlerLimitType(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+	base := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	expectedSQL := []struct {
+		Axis       uint8     `ch:"axis"`
+		Time       time.Time `ch:"time"`
+		Xps        float64   `ch:"xps"`
+		Dimensions []string  `ch:"dimensions"`
+	}{
+		{1, base, 100, []string{"router1"}},
+		{1, base, 50, []string{"Other"}},
+		{1, base.Add(time.Minute), 100, []string{"router1"}},
+		{1, base.Add(time.Minute), 250, []string{"router2"}},
+		{1, base.Add(time.Minute), 250, []string{"router3"}},
+		{1, base.Add(2 * time.Minute), 100, []string{"router1"}},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil).
+		Times(2)
+
+	input := gin.H{
+		"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		"points":     100,
+		"limit":      3,
+		"dimensions": []string{"ExporterName"},
+		"units":      "l3bps",
+	}
+	output := gin.H{
+		"t": []string{
+			"2009-11-10T23:00:00Z",
+			"2009-11-10T23:01:00Z",
+			"2009-11-10T23:02:00Z",
+		},
+		"points": [][]int{
+			{100, 100, 100},
+			{0, 250, 0},
+			{0, 250, 0},
+			{50, 0, 0},
+		},
+		"rows":       [][]string{{"router1"}, {"router2"}, {"router3"}, {"Other"}},
+		"axis":       []int{1, 1, 1, 1},
+		"axis-names": map[int]string{1: "Direct"},
+		"average":    []int{100, 83, 83, 16},
+		"min":        []int{100, 250, 250, 50},
+		"max":        []int{100, 250, 250, 50},
+		"95th":       []int{100, 125, 125, 25},
+	}
+	inputMax := maps.Clone(input)
+	inputMax["limit-type"] = "max"
+	outputMax := maps.Clone(output)
+	outputMax["rows"] = [][]string{{"router2"}, {"router3"}, {"router1"}, {"Other"}}
+	outputMax["points"] = [][]int{
+		{0, 250, 0},
+		{0, 250, 0},
+		{100, 100, 100},
+		{50, 0, 0},
+	}
+	outputMax["average"] = []int{83, 83, 100, 16}
+	outputMax["min"] = []int{250, 250, 100, 50}
+	outputMax["max"] = []int{250, 250, 100, 50}
+	outputMax["95th"] = []int{125, 125, 100, 25}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "top by average",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   input,
+			JSONOutput:  output,
+		}, {
+			Description: "top by maximum",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   inputMax,
+			JSONOutput:  outputMax,
+		}, {
+			Description: "invalid limit type",
+			URL:         "/api/v0/console/graph/line",
+			StatusCode:  400,
+			JSONInput: func() gin.H {
+				input := maps.Clone(input)
+				input["limit-type"] = "min"
+				return input
+			}(),
+			JSONOutput: gin.H{
+				"message": "Key: 'graphLineHandlerInput.LimitType' Error:Field validation for 'LimitType' failed on the 'oneof' tag",
+			},
+		},
+	})
+}
+
+func TestGraphLineHandlerRatioErrors(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+	input := func(units string, ratio gin.H) gin.H {
+		return gin.H{
+			"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+			"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+			"points":     100,
+			"limit":      20,
+			"dimensions": []string{},
+			"units":      units,
+			"ratio":      ratio,
+		}
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "ratio with percent units",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   input("inl2%", gin.H{"numerator": "EType = IPv6"}),
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Ratio cannot be used with inl2% units"},
+		}, {
+			Description: "ratio without numerator",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   input("l3bps", gin.H{"denominator": "EType = IPv6"}),
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Ratio requires a numerator filter"},
+		}, {
+			Description: "ratio with invalid denominator",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   input("l3bps", gin.H{"numerator": "EType = IPv6", "denominator": "Unknown = 1"}),
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Denominator: cannot parse filter: at line 1, position 8: no match found, expected: [A-Za-z0-9]"},
+		},
+	})
+}
+
+func TestGraphHandlerDeduplicateSitesWithoutInletSite(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+	input := gin.H{
+		"start":             time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		"end":               time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		"points":            100,
+		"limit":             20,
+		"dimensions":        []string{"SrcAS", "ExporterName"},
+		"units":             "l3bps",
+		"deduplicate-sites": true,
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "line graph",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput:   input,
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Site deduplication requires InletSite column"},
+		}, {
+			Description: "sankey graph",
+			URL:         "/api/v0/console/graph/sankey",
+			JSONInput:   input,
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Site deduplication requires InletSite column"},
+		},
+	})
+}
@@ -0,0 +1,131 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"unicode/utf16"
+)
+
+const lzBase64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/="
+
+// lzCompressToBase64 compresses a string the same way LZString's
+// compressToBase64() does. This is used by the frontend to encode its state
+// in URLs.
+func lzCompressToBase64(input string) string {
+	w := lzWriter{bitsPerChar: 6}
+	units := utf16.Encode([]rune(input))
+	key := func(units []uint16) string {
+		var b strings.Builder
+		for _, u := range units {
+			b.WriteByte(byte(u >> 8))
+			b.WriteByte(byte(u))
+		}
+		return b.String()
+	}
+
+	dictionary := map[string]int{}
+	toCreate := map[string]bool{}
+	enlargeIn, dictSize, numBits := 2, 3, 2
+	enlarge := func() {
+		enlargeIn--
+		if enlargeIn == 0 {
+			enlargeIn = 1 << numBits
+			numBits++
+		}
+	}
+	emit := func(current []uint16) {
+		k := key(current)
+		if toCreate[k] {
+			if current[0] < 256 {
+				w.writeBits(0, numBits)
+				w.writeBits(int(current[0]), 8)
+			} else {
+				w.writeBits(1, numBits)
+				w.writeBits(int(current[0]), 16)
+			}
+			enlarge()
+			delete(toCreate, k)
+		} else {
+			w.writeBits(dictionary[k], numBits)
+		}
+		enlarge()
+	}
+
+	current := []uint16{}
+	for _, u := range units {
+		c := key([]uint16{u})
+		if _, ok := dictionary[c]; !ok {
+			dictionary[c] = dictSize
+			dictSize++
+			toCreate[c] = true
+		}
+		next := append(current[:len(current):len(current)], u)
+		if _, ok := dictionary[key(next)]; ok {
+			current = next
+			continue
+		}
+		emit(current)
+		dictionary[key(next)] = dictSize
+		dictSize++
+		current = []uint16{u}
+	}
+	if len(current) > 0 {
+		emit(current)
+	}
+	// End of stream
+	w.writeBits(2, numBits)
+	w.flush()
+
+	result := w.out.String()
+	switch len(result) % 4 {
+	case 1:
+		result += "==="
+	case 2:
+		result += "=="
+	case 3:
+		result += "="
+	}
+	return result
+}
+
+// lzWriter packs bits into characters of the base64 alphabet.
+type lzWriter struct {
+	bitsPerChar int
+	out         strings.Builder
+	value       int
+	position    int
+}
+
+// writeBits writes the provided number of bits from value, least
+// significant bit first.
+func (w *lzWriter) writeBits(value int, bits int) {
+	for i := 0; i < bits; i++ {
+		w.writeBit(value & 1)
+		value >>= 1
+	}
+}
+
+func (w *lzWriter) writeBit(bit int) {
+	w.value = (w.value << 1) | bit
+	if w.position == w.bitsPerChar-1 {
+		w.out.WriteByte(lzBase64Alphabet[w.value])
+		w.value = 0
+		w.position = 0
+	} else {
+		w.position++
+	}
+}
+
+// flush pads the last character with zeros.
+func (w *lzWriter) flush() {
+	for {
+		w.value <<= 1
+		if w.position == w.bitsPerChar-1 {
+			w.out.WriteByte(lzBase64Alphabet[w.value])
+			return
+		}
+		w.position++
+	}
+}
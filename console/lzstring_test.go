@@ -0,0 +1,24 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import "testing"
+
+func TestLZCompressToBase64(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected string
+	}{
+		{"", "Q==="},
+		{"a", "IZA="},
+		{"Hello, world", "BIUwNmD2A0AEDukBOYAmQ==="},
+		{"aaaaaaaaaaaaaaaaaaaaaaaaaaaa", "IY18ZQ=="},
+		{"héllo wörld €€€ 😀😀 abcabcabc", "BYS4NmD2AEDuBvAnMATagagk9QvBuAA9v0AhgEYDGJ5ZQA=="},
+	}
+	for _, tc := range cases {
+		if got := lzCompressToBase64(tc.Input); got != tc.Expected {
+			t.Errorf("lzCompressToBase64(%q) == %q, expected %q", tc.Input, got, tc.Expected)
+		}
+	}
+}
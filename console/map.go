@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	_ "embed" // for countries
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+//go:embed data/countries.csv
+var embeddedCountries []byte
+
+// country describes a country to be displayed on a map.
+type country struct {
+	Name      string
+	Latitude  float64
+	Longitude float64
+}
+
+// parseCountries parses the embedded list of countries. Coordinates are
+// approximate and only intended to place countries on a map.
+func parseCountries() (map[string]country, error) {
+	records, err := csv.NewReader(bytes.NewReader(embeddedCountries)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse countries: %w", err)
+	}
+	countries := make(map[string]country, len(records))
+	for _, record := range records[1:] {
+		latitude, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for %s: %w", record[0], err)
+		}
+		longitude, err := strconv.ParseFloat(record[3], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for %s: %w", record[0], err)
+		}
+		countries[record[0]] = country{
+			Name:      record[1],
+			Latitude:  latitude,
+			Longitude: longitude,
+		}
+	}
+	return countries, nil
+}
+
+// graphMapHandlerInput describes the input for the /graph/map endpoint.
+type graphMapHandlerInput struct {
+	schema *schema.Component
+	Start  time.Time    `json:"start" binding:"required"`
+	End    time.Time    `json:"end" binding:"required,gtfield=Start"`
+	Limit  int          `json:"limit" binding:"min=1"` // limit number of links
+	Filter query.Filter `json:"filter"`                // where ...
+	Units  string       `json:"units" binding:"required,oneof=pps l3bps l2bps"`
+}
+
+// graphMapHandlerOutput describes the output for the /graph/map endpoint.
+type graphMapHandlerOutput struct {
+	Countries []mapCountry `json:"countries"`
+	Links     []mapLink    `json:"links"`
+}
+type mapCountry struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	SrcXps    int     `json:"src-xps"`
+	DstXps    int     `json:"dst-xps"`
+}
+type mapLink struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Xps    int    `json:"xps"`
+}
+
+// toSQL converts a map query to an SQL request
+func (input graphMapHandlerInput) toSQL() string {
+	where := templateWhere(input.Filter)
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE %s) AS range
+SELECT
+ {{ .Units }}/range AS xps,
+ SrcCountry,
+ DstCountry
+FROM {{ .Table }}
+WHERE %s
+GROUP BY SrcCountry, DstCountry
+ORDER BY xps DESC
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: requireMainTable(input.schema, nil, input.Filter),
+			Points:            20,
+			Units:             input.Units,
+		}),
+		where, where)
+	return strings.TrimSpace(sqlQuery)
+}
+
+func (c *Component) graphMapHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	input := graphMapHandlerInput{schema: c.d.Schema}
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	restricted := c.restrictedColumns(gc)
+	if err := checkFilterAccess(c.d.Schema, restricted, input.Filter); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	for _, column := range []string{"SrcCountry", "DstCountry"} {
+		if slices.Contains(restricted, column) {
+			gc.JSON(http.StatusForbidden, gin.H{"message": fmt.Sprintf("Access to column %s is restricted", column)})
+			return
+		}
+	}
+
+	c.recordUsage("map", nil, input.Filter)
+
+	// Prepare and execute query
+	sqlQuery := c.finalizeQuery(input.toSQL())
+	gc.Header("X-SQL-Query", strings.ReplaceAll(sqlQuery, "\n", "  "))
+	results := []struct {
+		Xps        float64 `ch:"xps"`
+		SrcCountry string  `ch:"SrcCountry"`
+		DstCountry string  `ch:"DstCountry"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+
+	// Prepare output. Flows from or to unknown countries are ignored.
+	output := graphMapHandlerOutput{
+		Countries: make([]mapCountry, 0),
+		Links:     make([]mapLink, 0),
+	}
+	countries := map[string]*mapCountry{}
+	addCountry := func(code string) *mapCountry {
+		if mc, ok := countries[code]; ok {
+			return mc
+		}
+		info, ok := c.countries[code]
+		if !ok {
+			return nil
+		}
+		mc := &mapCountry{
+			Code:      code,
+			Name:      info.Name,
+			Latitude:  info.Latitude,
+			Longitude: info.Longitude,
+		}
+		countries[code] = mc
+		return mc
+	}
+	for _, result := range results {
+		src := addCountry(result.SrcCountry)
+		dst := addCountry(result.DstCountry)
+		if src != nil {
+			src.SrcXps += int(result.Xps)
+		}
+		if dst != nil {
+			dst.DstXps += int(result.Xps)
+		}
+		if src != nil && dst != nil && len(output.Links) < input.Limit {
+			output.Links = append(output.Links, mapLink{src.Code, dst.Code, int(result.Xps)})
+		}
+	}
+	for _, mc := range countries {
+		output.Countries = append(output.Countries, *mc)
+	}
+	sort.Slice(output.Countries, func(i, j int) bool {
+		return output.Countries[i].Code < output.Countries[j].Code
+	})
+
+	gc.JSON(http.StatusOK, output)
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestParseCountries(t *testing.T) {
+	countries, err := parseCountries()
+	if err != nil {
+		t.Fatalf("parseCountries() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(countries["FR"], country{
+		Name:      "France",
+		Latitude:  48.87,
+		Longitude: 2.33,
+	}); diff != "" {
+		t.Fatalf("parseCountries() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMapQuerySQL(t *testing.T) {
+	input := graphMapHandlerInput{
+		schema: schema.NewMock(t),
+		Start:  time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		End:    time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		Limit:  10,
+		Filter: query.NewFilter("InIfBoundary = external"),
+		Units:  "l3bps",
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":20,"units":"l3bps"}@@ }}
+WITH
+ (SELECT MAX(TimeReceived) - MIN(TimeReceived) FROM {{ .Table }} WHERE {{ .Timefilter }} AND (InIfBoundary = 'external')) AS range
+SELECT
+ {{ .Units }}/range AS xps,
+ SrcCountry,
+ DstCountry
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (InIfBoundary = 'external')
+GROUP BY SrcCountry, DstCountry
+ORDER BY xps DESC
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	if diff := helpers.Diff(input.toSQL(), expected); diff != "" {
+		t.Fatalf("toSQL() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestMapHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expectedSQL := []struct {
+		Xps        float64 `ch:"xps"`
+		SrcCountry string  `ch:"SrcCountry"`
+		DstCountry string  `ch:"DstCountry"`
+	}{
+		{9677, "US", "FR"},
+		{7593, "DE", "FR"},
+		{4348, "", "FR"},
+		{2915, "FR", "US"},
+		{621, "DE", "US"},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/graph/map",
+			JSONInput: gin.H{
+				"start":  time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":    time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"limit":  3,
+				"filter": "InIfBoundary = external",
+				"units":  "l3bps",
+			},
+			JSONOutput: gin.H{
+				"countries": []gin.H{
+					{
+						"code":      "DE",
+						"name":      "Germany",
+						"latitude":  51.17,
+						"longitude": 10.45,
+						"src-xps":   7593 + 621,
+						"dst-xps":   0,
+					}, {
+						"code":      "FR",
+						"name":      "France",
+						"latitude":  48.87,
+						"longitude": 2.33,
+						"src-xps":   2915,
+						"dst-xps":   9677 + 7593 + 4348,
+					}, {
+						"code":      "US",
+						"name":      "United States",
+						"latitude":  37.09,
+						"longitude": -95.71,
+						"src-xps":   9677,
+						"dst-xps":   2915 + 621,
+					},
+				},
+				"links": []gin.H{
+					{"source": "US", "target": "FR", "xps": 9677},
+					{"source": "DE", "target": "FR", "xps": 7593},
+					{"source": "FR", "target": "US", "xps": 2915},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// AlertmanagerConfiguration is the configuration of an Alertmanager
+// notifier.
+type AlertmanagerConfiguration struct {
+	// URL is the URL of the /api/v2/alerts endpoint
+	URL string `validate:"required,url"`
+}
+
+// DefaultAlertmanagerConfiguration returns the default configuration of an
+// Alertmanager notifier.
+func DefaultAlertmanagerConfiguration() Configuration {
+	return AlertmanagerConfiguration{}
+}
+
+type alertmanager struct {
+	config AlertmanagerConfiguration
+}
+
+// alertmanagerAlert is an alert as expected by the Alertmanager API.
+type alertmanagerAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      *time.Time        `json:"endsAt,omitempty"`
+}
+
+// New creates a new Alertmanager notifier.
+func (config AlertmanagerConfiguration) New() (Notifier, error) {
+	return &alertmanager{config: config}, nil
+}
+
+// Notify sends all the notifications at once. Alertmanager expects firing
+// alerts to be sent periodically, renewed notifications are therefore sent
+// too.
+func (a *alertmanager) Notify(ctx context.Context, notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	alerts := make([]alertmanagerAlert, 0, len(notifications))
+	for _, notification := range notifications {
+		alert := alertmanagerAlert{
+			Labels: map[string]string{
+				"alertname": "AkvoradoAlertRule",
+				"rule":      strconv.FormatUint(notification.Rule, 10),
+			},
+			Annotations: map[string]string{
+				"description": notification.Description,
+				"summary":     notification.Summary(),
+			},
+			StartsAt: notification.StartsAt,
+		}
+		if notification.Dimension != "" {
+			alert.Labels["dimension"] = notification.Dimension
+			alert.Labels["value"] = notification.Value
+		}
+		if notification.Status == "resolved" {
+			endsAt := notification.Time
+			alert.EndsAt = &endsAt
+		}
+		alerts = append(alerts, alert)
+	}
+	return post(ctx, a.config.URL, nil, alerts)
+}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestAlertmanager(t *testing.T) {
+	server, requests := newTestServer(t)
+	notifier, _ := AlertmanagerConfiguration{URL: server.URL + "/api/v2/alerts"}.New()
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{
+			Path: "/api/v2/alerts",
+			Body: `[{"labels":{"alertname":"AkvoradoAlertRule","dimension":"DstAddr","rule":"1","value":"2001:db8::1"},` +
+				`"annotations":{"description":"DDoS to customers","summary":"DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps"},` +
+				`"startsAt":"2024-04-11T15:45:00Z"},` +
+				`{"labels":{"alertname":"AkvoradoAlertRule","dimension":"DstAddr","rule":"1","value":"2001:db8::2"},` +
+				`"annotations":{"description":"DDoS to customers","summary":"DDoS to customers (DstAddr 2001:db8::2): 200000 pps, threshold 100000 pps"},` +
+				`"startsAt":"2024-04-11T15:43:00Z"},` +
+				`{"labels":{"alertname":"AkvoradoAlertRule","dimension":"DstAddr","rule":"1","value":"2001:db8::3"},` +
+				`"annotations":{"description":"DDoS to customers","summary":"DDoS to customers (DstAddr 2001:db8::3)"},` +
+				`"startsAt":"2024-04-11T15:41:00Z","endsAt":"2024-04-11T15:45:00Z"}]`,
+		},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
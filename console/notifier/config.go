@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"akvorado/common/helpers"
+)
+
+// ChannelConfiguration is the configuration of a named notification channel.
+type ChannelConfiguration struct {
+	// Name is the name of the channel, used by alert rules to reference it.
+	Name string `validate:"required"`
+	// RateLimit is the maximum number of notifications sent each minute. 0
+	// means no limit.
+	RateLimit int `validate:"min=0"`
+	// Config is the configuration of the notifier.
+	Config Configuration
+}
+
+// MarshalYAML undoes ConfigurationUnmarshallerHook().
+func (cc ChannelConfiguration) MarshalYAML() (interface{}, error) {
+	return helpers.ParametrizedConfigurationMarshalYAML(cc, notifiers)
+}
+
+// MarshalJSON undoes ConfigurationUnmarshallerHook().
+func (cc ChannelConfiguration) MarshalJSON() ([]byte, error) {
+	return helpers.ParametrizedConfigurationMarshalJSON(cc, notifiers)
+}
+
+var notifiers = map[string](func() Configuration){
+	"webhook":      DefaultWebhookConfiguration,
+	"slack":        DefaultSlackConfiguration,
+	"teams":        DefaultTeamsConfiguration,
+	"pagerduty":    DefaultPagerDutyConfiguration,
+	"opsgenie":     DefaultOpsgenieConfiguration,
+	"alertmanager": DefaultAlertmanagerConfiguration,
+}
+
+func init() {
+	helpers.RegisterMapstructureUnmarshallerHook(
+		helpers.ParametrizedConfigurationUnmarshallerHook(ChannelConfiguration{}, notifiers))
+}
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// OpsgenieConfiguration is the configuration of an Opsgenie notifier using
+// the Alert API.
+type OpsgenieConfiguration struct {
+	// URL is the base URL of the Opsgenie API
+	URL string `validate:"required,url"`
+	// APIKey is the key of the API integration
+	APIKey string `validate:"required"`
+	// Priority is the priority of the created alerts
+	Priority string `validate:"oneof=P1 P2 P3 P4 P5"`
+	// Template is the template used to format the message of an alert
+	Template string `validate:"required"`
+}
+
+// DefaultOpsgenieConfiguration returns the default configuration of an
+// Opsgenie notifier.
+func DefaultOpsgenieConfiguration() Configuration {
+	return OpsgenieConfiguration{
+		URL:      "https://api.opsgenie.com",
+		Priority: "P3",
+		Template: "{{ .Summary }}",
+	}
+}
+
+type opsgenie struct {
+	config   OpsgenieConfiguration
+	template *template.Template
+}
+
+// opsgenieAlert is an alert for the Alert API.
+type opsgenieAlert struct {
+	Message  string            `json:"message"`
+	Alias    string            `json:"alias"`
+	Priority string            `json:"priority"`
+	Source   string            `json:"source"`
+	Details  map[string]string `json:"details"`
+}
+
+// New creates a new Opsgenie notifier.
+func (config OpsgenieConfiguration) New() (Notifier, error) {
+	t, err := parseTemplate("opsgenie", config.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &opsgenie{config: config, template: t}, nil
+}
+
+// Notify creates an alert for each firing notification and closes it when
+// the notification is resolved.
+func (o *opsgenie) Notify(ctx context.Context, notifications []Notification) error {
+	headers := http.Header{}
+	headers.Set("Authorization", "GenieKey "+o.config.APIKey)
+	base := strings.TrimSuffix(o.config.URL, "/")
+	for _, notification := range firing(notifications) {
+		if notification.Status == "resolved" {
+			closeURL := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias",
+				base, url.PathEscape(notification.Key()))
+			if err := post(ctx, closeURL, headers, map[string]string{"source": "akvorado"}); err != nil {
+				return err
+			}
+			continue
+		}
+		message, err := execute(o.template, notification)
+		if err != nil {
+			return err
+		}
+		// The message is limited to 130 characters.
+		if len(message) > 130 {
+			message = message[:130]
+		}
+		alert := opsgenieAlert{
+			Message:  message,
+			Alias:    notification.Key(),
+			Priority: o.config.Priority,
+			Source:   "akvorado",
+			Details: map[string]string{
+				"rule":      strconv.FormatUint(notification.Rule, 10),
+				"units":     notification.Units,
+				"threshold": strconv.FormatUint(notification.Threshold, 10),
+				"xps":       strconv.FormatUint(notification.Xps, 10),
+			},
+		}
+		if notification.Dimension != "" {
+			alert.Details["dimension"] = notification.Dimension
+			alert.Details["value"] = notification.Value
+		}
+		if notification.Baseline > 0 {
+			alert.Details["baseline"] = strconv.FormatUint(notification.Baseline, 10)
+		}
+		if err := post(ctx, base+"/v2/alerts", headers, alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
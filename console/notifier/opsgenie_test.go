@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestOpsgenie(t *testing.T) {
+	server, requests := newTestServer(t)
+	config := DefaultOpsgenieConfiguration().(OpsgenieConfiguration)
+	config.URL = server.URL + "/"
+	config.APIKey = "4P1K3Y"
+	notifier, err := config.New()
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{
+			Path:          "/v2/alerts",
+			Authorization: "GenieKey 4P1K3Y",
+			Body: `{"message":"DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps",` +
+				`"alias":"akvorado-1-2001:db8::1","priority":"P3","source":"akvorado",` +
+				`"details":{"dimension":"DstAddr","rule":"1","threshold":"100000","units":"pps",` +
+				`"value":"2001:db8::1","xps":"200000"}}`,
+		}, {
+			Path:          "/v2/alerts/akvorado-1-2001:db8::3/close?identifierType=alias",
+			Authorization: "GenieKey 4P1K3Y",
+			Body:          `{"source":"akvorado"}`,
+		},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"text/template"
+	"time"
+)
+
+// PagerDutyConfiguration is the configuration of a PagerDuty notifier using
+// the Events API v2.
+type PagerDutyConfiguration struct {
+	// URL is the URL of the Events API
+	URL string `validate:"required,url"`
+	// RoutingKey is the integration key of the service
+	RoutingKey string `validate:"required"`
+	// Severity is the severity of the triggered events
+	Severity string `validate:"oneof=critical error warning info"`
+	// Template is the template used to format the summary of an event
+	Template string `validate:"required"`
+}
+
+// DefaultPagerDutyConfiguration returns the default configuration of a
+// PagerDuty notifier.
+func DefaultPagerDutyConfiguration() Configuration {
+	return PagerDutyConfiguration{
+		URL:      "https://events.pagerduty.com/v2/enqueue",
+		Severity: "warning",
+		Template: "{{ .Summary }}",
+	}
+}
+
+type pagerDuty struct {
+	config   PagerDutyConfiguration
+	template *template.Template
+}
+
+// pagerDutyEvent is an event for the Events API v2.
+type pagerDutyEvent struct {
+	RoutingKey  string                 `json:"routing_key"`
+	EventAction string                 `json:"event_action"`
+	DedupKey    string                 `json:"dedup_key"`
+	Payload     *pagerDutyEventPayload `json:"payload,omitempty"`
+}
+
+type pagerDutyEventPayload struct {
+	Summary       string       `json:"summary"`
+	Source        string       `json:"source"`
+	Severity      string       `json:"severity"`
+	Timestamp     time.Time    `json:"timestamp"`
+	CustomDetails Notification `json:"custom_details"`
+}
+
+// New creates a new PagerDuty notifier.
+func (config PagerDutyConfiguration) New() (Notifier, error) {
+	t, err := parseTemplate("pagerduty", config.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &pagerDuty{config: config, template: t}, nil
+}
+
+// Notify triggers an event for each firing notification and resolves it
+// when the notification is resolved.
+func (p *pagerDuty) Notify(ctx context.Context, notifications []Notification) error {
+	for _, notification := range firing(notifications) {
+		event := pagerDutyEvent{
+			RoutingKey:  p.config.RoutingKey,
+			EventAction: "resolve",
+			DedupKey:    notification.Key(),
+		}
+		if notification.Status == "firing" {
+			summary, err := execute(p.template, notification)
+			if err != nil {
+				return err
+			}
+			// The summary is limited to 1024 characters.
+			if len(summary) > 1024 {
+				summary = summary[:1024]
+			}
+			event.EventAction = "trigger"
+			event.Payload = &pagerDutyEventPayload{
+				Summary:       summary,
+				Source:        "akvorado",
+				Severity:      p.config.Severity,
+				Timestamp:     notification.Time,
+				CustomDetails: notification,
+			}
+		}
+		if err := post(ctx, p.config.URL, nil, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
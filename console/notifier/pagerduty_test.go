@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestPagerDuty(t *testing.T) {
+	server, requests := newTestServer(t)
+	config := DefaultPagerDutyConfiguration().(PagerDutyConfiguration)
+	config.URL = server.URL + "/v2/enqueue"
+	config.RoutingKey = "R0UT1NGK3Y"
+	notifier, err := config.New()
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{
+			Path: "/v2/enqueue",
+			Body: `{"routing_key":"R0UT1NGK3Y","event_action":"trigger","dedup_key":"akvorado-1-2001:db8::1",` +
+				`"payload":{"summary":"DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps",` +
+				`"source":"akvorado","severity":"warning","timestamp":"2024-04-11T15:45:00Z",` +
+				`"custom_details":{"rule":1,"description":"DDoS to customers","status":"firing",` +
+				`"dimension":"DstAddr","value":"2001:db8::1","units":"pps","threshold":100000,` +
+				`"xps":200000,"time":"2024-04-11T15:45:00Z"}}}`,
+		}, {
+			Path: "/v2/enqueue",
+			Body: `{"routing_key":"R0UT1NGK3Y","event_action":"resolve","dedup_key":"akvorado-1-2001:db8::3"}`,
+		},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
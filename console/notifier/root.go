@@ -0,0 +1,207 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package notifier sends alert notifications to external services (Slack,
+// Microsoft Teams, PagerDuty, Opsgenie, Alertmanager or a generic webhook).
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a notification is dropped because the
+// channel exceeded its rate limit.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// Notification is a notification about a value starting or stopping to
+// exceed the threshold of an alert rule.
+type Notification struct {
+	Rule        uint64    `json:"rule"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"` // firing or resolved
+	Dimension   string    `json:"dimension,omitempty"`
+	Value       string    `json:"value,omitempty"`
+	Units       string    `json:"units"`
+	Threshold   uint64    `json:"threshold"`
+	Xps         uint64    `json:"xps,omitempty"`
+	Baseline    uint64    `json:"baseline,omitempty"` // for anomaly rules
+	Time        time.Time `json:"time"`
+
+	// StartsAt is when the value started exceeding the threshold.
+	StartsAt time.Time `json:"-"`
+	// Renewed tells the value is still exceeding the threshold. Only some
+	// notifiers are interested in these notifications.
+	Renewed bool `json:"-"`
+}
+
+// Summary returns a human-readable summary of the notification.
+func (n Notification) Summary() string {
+	var summary strings.Builder
+	summary.WriteString(n.Description)
+	if n.Dimension != "" {
+		fmt.Fprintf(&summary, " (%s %s)", n.Dimension, n.Value)
+	}
+	if n.Status == "firing" {
+		fmt.Fprintf(&summary, ": %d %s", n.Xps, n.Units)
+		if n.Baseline > 0 {
+			fmt.Fprintf(&summary, ", baseline %d %s", n.Baseline, n.Units)
+		} else {
+			fmt.Fprintf(&summary, ", threshold %d %s", n.Threshold, n.Units)
+		}
+	}
+	return summary.String()
+}
+
+// Key returns a key identifying the alert the notification is about. It can
+// be used to deduplicate notifications.
+func (n Notification) Key() string {
+	key := "akvorado-" + strconv.FormatUint(n.Rule, 10)
+	if n.Value != "" {
+		key = fmt.Sprintf("%s-%s", key, n.Value)
+	}
+	return key
+}
+
+// Notifier sends notifications to an external service.
+type Notifier interface {
+	// Notify sends the provided notifications.
+	Notify(ctx context.Context, notifications []Notification) error
+}
+
+// Configuration is the configuration of a notifier.
+type Configuration interface {
+	// New instantiates a new notifier from its configuration.
+	New() (Notifier, error)
+}
+
+// Channel is a named notifier with a rate limit.
+type Channel struct {
+	Name     string
+	Type     string
+	notifier Notifier
+	limiter  *rate.Limiter // nil when not rate limited
+}
+
+// NewChannel creates a new channel from its configuration.
+func NewChannel(config ChannelConfiguration) (*Channel, error) {
+	notifier, err := config.Config.New()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create notifier %q: %w", config.Name, err)
+	}
+	channel := &Channel{
+		Name:     config.Name,
+		notifier: notifier,
+	}
+	configType := reflect.TypeOf(config.Config)
+	if configType.Kind() == reflect.Pointer {
+		configType = configType.Elem()
+	}
+	for name, fn := range notifiers {
+		if reflect.TypeOf(fn()) == configType {
+			channel.Type = name
+			break
+		}
+	}
+	if config.RateLimit > 0 {
+		channel.limiter = rate.NewLimiter(rate.Limit(float64(config.RateLimit)/60), config.RateLimit)
+	}
+	return channel, nil
+}
+
+// Notify sends the provided notifications through the channel and returns
+// the notifications sent. Renewed notifications are not subject to the rate
+// limit. When the rate limit is exceeded, the remaining notifications are
+// dropped and ErrRateLimited is returned.
+func (c *Channel) Notify(ctx context.Context, notifications []Notification) ([]Notification, error) {
+	allowed := notifications
+	if c.limiter != nil {
+		allowed = make([]Notification, 0, len(notifications))
+		for _, notification := range notifications {
+			if notification.Renewed || c.limiter.Allow() {
+				allowed = append(allowed, notification)
+			}
+		}
+	}
+	if len(allowed) > 0 {
+		if err := c.notifier.Notify(ctx, allowed); err != nil {
+			return nil, err
+		}
+	}
+	if len(allowed) < len(notifications) {
+		return allowed, ErrRateLimited
+	}
+	return allowed, nil
+}
+
+// firing returns the notifications which are not renewed.
+func firing(notifications []Notification) []Notification {
+	result := make([]Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		if !notification.Renewed {
+			result = append(result, notification)
+		}
+	}
+	return result
+}
+
+// parseTemplate parses the template used to format a notification.
+func parseTemplate(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(template.FuncMap{
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse template: %w", err)
+	}
+	return t, nil
+}
+
+// execute formats a notification with the provided template.
+func execute(t *template.Template, notification Notification) (string, error) {
+	var out strings.Builder
+	if err := t.Execute(&out, notification); err != nil {
+		return "", fmt.Errorf("cannot format notification: %w", err)
+	}
+	return out.String(), nil
+}
+
+// post sends the provided payload as JSON to the provided URL.
+func post(ctx context.Context, url string, headers http.Header, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot build notification: %w", err)
+	}
+	for key, values := range headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// request is a request received by the test server.
+type request struct {
+	Path          string
+	Authorization string
+	Body          string
+}
+
+// newTestServer creates a server recording the received requests.
+func newTestServer(t *testing.T) (*httptest.Server, func() []request) {
+	t.Helper()
+	var lock sync.Mutex
+	requests := []request{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		requests = append(requests, request{
+			Path:          r.URL.RequestURI(),
+			Authorization: r.Header.Get("Authorization"),
+			Body:          string(body),
+		})
+		lock.Unlock()
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []request {
+		lock.Lock()
+		defer lock.Unlock()
+		result := requests
+		requests = []request{}
+		return result
+	}
+}
+
+// testNotifications returns a firing, a renewed and a resolved notification.
+func testNotifications() []Notification {
+	now := time.Date(2024, 4, 11, 15, 45, 0, 0, time.UTC)
+	base := Notification{
+		Rule:        1,
+		Description: "DDoS to customers",
+		Dimension:   "DstAddr",
+		Units:       "pps",
+		Threshold:   100000,
+		Time:        now,
+	}
+	firing := base
+	firing.Status = "firing"
+	firing.Value = "2001:db8::1"
+	firing.Xps = 200000
+	firing.StartsAt = now
+	renewed := firing
+	renewed.Value = "2001:db8::2"
+	renewed.StartsAt = now.Add(-2 * time.Minute)
+	renewed.Renewed = true
+	resolved := base
+	resolved.Status = "resolved"
+	resolved.Value = "2001:db8::3"
+	resolved.StartsAt = now.Add(-4 * time.Minute)
+	return []Notification{firing, renewed, resolved}
+}
+
+func TestNotificationSummary(t *testing.T) {
+	notifications := testNotifications()
+	anomaly := notifications[0]
+	anomaly.Dimension = ""
+	anomaly.Value = ""
+	anomaly.Baseline = 1000
+	cases := []struct {
+		Notification Notification
+		Summary      string
+		Key          string
+	}{
+		{notifications[0], "DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps", "akvorado-1-2001:db8::1"},
+		{notifications[2], "DDoS to customers (DstAddr 2001:db8::3)", "akvorado-1-2001:db8::3"},
+		{anomaly, "DDoS to customers: 200000 pps, baseline 1000 pps", "akvorado-1"},
+	}
+	for _, tc := range cases {
+		if got := tc.Notification.Summary(); got != tc.Summary {
+			t.Errorf("Summary() == %q, expected %q", got, tc.Summary)
+		}
+		if got := tc.Notification.Key(); got != tc.Key {
+			t.Errorf("Key() == %q, expected %q", got, tc.Key)
+		}
+	}
+}
+
+func TestChannelRateLimit(t *testing.T) {
+	server, requests := newTestServer(t)
+	channel, err := NewChannel(ChannelConfiguration{
+		Name:      "noc",
+		RateLimit: 1,
+		Config:    WebhookConfiguration{URL: server.URL},
+	})
+	if err != nil {
+		t.Fatalf("NewChannel() error:\n%+v", err)
+	}
+	if channel.Type != "webhook" {
+		t.Errorf("NewChannel().Type == %q, expected %q", channel.Type, "webhook")
+	}
+
+	notifications := testNotifications()
+	sent, err := channel.Notify(context.Background(), notifications)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	// The renewed notification is not rate limited, but it is not sent by
+	// the webhook.
+	if diff := helpers.Diff(sent, notifications[:2]); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+	if got := len(requests()); got != 1 {
+		t.Fatalf("Notify() sent %d requests, expected 1", got)
+	}
+}
+
+func TestChannelError(t *testing.T) {
+	server, _ := newTestServer(t)
+	channel, err := NewChannel(ChannelConfiguration{
+		Name:   "noc",
+		Config: WebhookConfiguration{URL: server.URL + "/error"},
+	})
+	if err != nil {
+		t.Fatalf("NewChannel() error:\n%+v", err)
+	}
+	if _, err := channel.Notify(context.Background(), testNotifications()); err == nil {
+		t.Fatal("Notify() did not error")
+	}
+}
+
+func TestInvalidTemplate(t *testing.T) {
+	_, err := NewChannel(ChannelConfiguration{
+		Name: "noc",
+		Config: SlackConfiguration{
+			URL:      "https://hooks.slack.com/services/T0/B0/X",
+			Template: "{{ .Summary",
+		},
+	})
+	if err == nil {
+		t.Fatal("NewChannel() did not error")
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	server, requests := newTestServer(t)
+	notifier, _ := WebhookConfiguration{URL: server.URL}.New()
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{
+			Path: "/",
+			Body: `{"rule":1,"description":"DDoS to customers","status":"firing",` +
+				`"dimension":"DstAddr","value":"2001:db8::1","units":"pps",` +
+				`"threshold":100000,"xps":200000,"time":"2024-04-11T15:45:00Z"}`,
+		}, {
+			Path: "/",
+			Body: `{"rule":1,"description":"DDoS to customers","status":"resolved",` +
+				`"dimension":"DstAddr","value":"2001:db8::3","units":"pps",` +
+				`"threshold":100000,"time":"2024-04-11T15:45:00Z"}`,
+		},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestConfigurationUnmarshallerHook(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "slack",
+			Initial:     func() interface{} { return ChannelConfiguration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"name":       "noc",
+					"type":       "slack",
+					"rate-limit": 10,
+					"url":        "https://hooks.slack.com/services/T0/B0/X",
+				}
+			},
+			Expected: ChannelConfiguration{
+				Name:      "noc",
+				RateLimit: 10,
+				Config: SlackConfiguration{
+					URL:      "https://hooks.slack.com/services/T0/B0/X",
+					Template: "[{{ .Status | upper }}] {{ .Summary }}",
+				},
+			},
+		}, {
+			Description: "pagerduty",
+			Initial:     func() interface{} { return ChannelConfiguration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"name":        "oncall",
+					"type":        "pagerduty",
+					"routing-key": "R0UT1NGK3Y",
+					"severity":    "critical",
+				}
+			},
+			Expected: ChannelConfiguration{
+				Name: "oncall",
+				Config: PagerDutyConfiguration{
+					URL:        "https://events.pagerduty.com/v2/enqueue",
+					RoutingKey: "R0UT1NGK3Y",
+					Severity:   "critical",
+					Template:   "{{ .Summary }}",
+				},
+			},
+		},
+	})
+}
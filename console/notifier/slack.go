@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"text/template"
+)
+
+// SlackConfiguration is the configuration of a Slack incoming webhook.
+type SlackConfiguration struct {
+	// URL is the URL of the incoming webhook
+	URL string `validate:"required,url"`
+	// Template is the template used to format the text of a notification
+	Template string `validate:"required"`
+}
+
+// DefaultSlackConfiguration returns the default configuration of a Slack
+// notifier.
+func DefaultSlackConfiguration() Configuration {
+	return SlackConfiguration{
+		Template: "[{{ .Status | upper }}] {{ .Summary }}",
+	}
+}
+
+type slack struct {
+	config   SlackConfiguration
+	template *template.Template
+}
+
+// New creates a new Slack notifier.
+func (config SlackConfiguration) New() (Notifier, error) {
+	t, err := parseTemplate("slack", config.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &slack{config: config, template: t}, nil
+}
+
+// Notify sends each notification as a Slack message.
+func (s *slack) Notify(ctx context.Context, notifications []Notification) error {
+	for _, notification := range firing(notifications) {
+		text, err := execute(s.template, notification)
+		if err != nil {
+			return err
+		}
+		if err := post(ctx, s.config.URL, nil, map[string]string{"text": text}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestSlack(t *testing.T) {
+	server, requests := newTestServer(t)
+	config := DefaultSlackConfiguration().(SlackConfiguration)
+	config.URL = server.URL
+	notifier, err := config.New()
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{Path: "/", Body: `{"text":"[FIRING] DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps"}`},
+		{Path: "/", Body: `{"text":"[RESOLVED] DDoS to customers (DstAddr 2001:db8::3)"}`},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+
+	// Custom template
+	config.Template = ":rotating_light: {{ .Description }} {{ .Value }} is {{ .Status }}"
+	notifier, err = config.New()
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := notifier.Notify(context.Background(), testNotifications()[:1]); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected = []request{
+		{Path: "/", Body: `{"text":":rotating_light: DDoS to customers 2001:db8::1 is firing"}`},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
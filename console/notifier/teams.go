@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"text/template"
+)
+
+// TeamsConfiguration is the configuration of a Microsoft Teams incoming
+// webhook.
+type TeamsConfiguration struct {
+	// URL is the URL of the incoming webhook
+	URL string `validate:"required,url"`
+	// Template is the template used to format the text of a notification
+	Template string `validate:"required"`
+}
+
+// DefaultTeamsConfiguration returns the default configuration of a Microsoft
+// Teams notifier.
+func DefaultTeamsConfiguration() Configuration {
+	return TeamsConfiguration{
+		Template: "{{ .Summary }}",
+	}
+}
+
+type teams struct {
+	config   TeamsConfiguration
+	template *template.Template
+}
+
+// teamsMessageCard is a message card accepted by Microsoft Teams incoming
+// webhooks.
+type teamsMessageCard struct {
+	Type       string `json:"@type"`
+	Context    string `json:"@context"`
+	ThemeColor string `json:"themeColor"`
+	Summary    string `json:"summary"`
+	Title      string `json:"title"`
+	Text       string `json:"text"`
+}
+
+// New creates a new Microsoft Teams notifier.
+func (config TeamsConfiguration) New() (Notifier, error) {
+	t, err := parseTemplate("teams", config.Template)
+	if err != nil {
+		return nil, err
+	}
+	return &teams{config: config, template: t}, nil
+}
+
+// Notify sends each notification as a message card.
+func (t *teams) Notify(ctx context.Context, notifications []Notification) error {
+	for _, notification := range firing(notifications) {
+		text, err := execute(t.template, notification)
+		if err != nil {
+			return err
+		}
+		card := teamsMessageCard{
+			Type:       "MessageCard",
+			Context:    "https://schema.org/extensions",
+			ThemeColor: "D83B01",
+			Summary:    text,
+			Title:      "Firing: " + notification.Description,
+			Text:       text,
+		}
+		if notification.Status == "resolved" {
+			card.ThemeColor = "2EB886"
+			card.Title = "Resolved: " + notification.Description
+		}
+		if err := post(ctx, t.config.URL, nil, card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestTeams(t *testing.T) {
+	server, requests := newTestServer(t)
+	config := DefaultTeamsConfiguration().(TeamsConfiguration)
+	config.URL = server.URL
+	notifier, err := config.New()
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if err := notifier.Notify(context.Background(), testNotifications()); err != nil {
+		t.Fatalf("Notify() error:\n%+v", err)
+	}
+	expected := []request{
+		{
+			Path: "/",
+			Body: `{"@type":"MessageCard","@context":"https://schema.org/extensions",` +
+				`"themeColor":"D83B01",` +
+				`"summary":"DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps",` +
+				`"title":"Firing: DDoS to customers",` +
+				`"text":"DDoS to customers (DstAddr 2001:db8::1): 200000 pps, threshold 100000 pps"}`,
+		}, {
+			Path: "/",
+			Body: `{"@type":"MessageCard","@context":"https://schema.org/extensions",` +
+				`"themeColor":"2EB886",` +
+				`"summary":"DDoS to customers (DstAddr 2001:db8::3)",` +
+				`"title":"Resolved: DDoS to customers",` +
+				`"text":"DDoS to customers (DstAddr 2001:db8::3)"}`,
+		},
+	}
+	if diff := helpers.Diff(requests(), expected); diff != "" {
+		t.Fatalf("Notify() (-got, +want):\n%s", diff)
+	}
+}
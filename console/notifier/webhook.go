@@ -0,0 +1,39 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package notifier
+
+import (
+	"context"
+)
+
+// WebhookConfiguration is the configuration of a generic webhook. Each
+// notification is sent as a JSON object.
+type WebhookConfiguration struct {
+	// URL is the URL to send notifications to
+	URL string `validate:"required,url"`
+}
+
+// DefaultWebhookConfiguration returns the default configuration of a webhook.
+func DefaultWebhookConfiguration() Configuration {
+	return WebhookConfiguration{}
+}
+
+type webhook struct {
+	config WebhookConfiguration
+}
+
+// New creates a new webhook notifier.
+func (config WebhookConfiguration) New() (Notifier, error) {
+	return &webhook{config: config}, nil
+}
+
+// Notify sends each notification to the webhook.
+func (w *webhook) Notify(ctx context.Context, notifications []Notification) error {
+	for _, notification := range firing(notifications) {
+		if err := post(ctx, w.config.URL, nil, notification); err != nil {
+			return err
+		}
+	}
+	return nil
+}
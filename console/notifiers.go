@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/console/notifier"
+)
+
+// notifierListHandlerFunc lists the configured notifiers.
+func (c *Component) notifierListHandlerFunc(gc *gin.Context) {
+	notifiers := make([]gin.H, 0, len(c.config.Notifiers))
+	for _, nc := range c.config.Notifiers {
+		notifiers = append(notifiers, gin.H{
+			"name": nc.Name,
+			"type": c.notifiers[nc.Name].Type,
+		})
+	}
+	gc.JSON(http.StatusOK, gin.H{"notifiers": notifiers})
+}
+
+// notifierTestHandlerFunc sends a test notification through a configured
+// notifier.
+func (c *Component) notifierTestHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	channel, ok := c.notifiers[gc.Param("name")]
+	if !ok {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Notifier not found."})
+		return
+	}
+	now := c.d.Clock.Now()
+	_, err := channel.Notify(ctx, []notifier.Notification{
+		{
+			Description: "Test notification from Akvorado",
+			Status:      "firing",
+			Units:       "l3bps",
+			Threshold:   1_000_000,
+			Xps:         1_500_000,
+			Time:        now,
+			StartsAt:    now,
+		},
+	})
+	if errors.Is(err, notifier.ErrRateLimited) {
+		gc.JSON(http.StatusTooManyRequests, gin.H{"message": "Rate limit of the notifier exceeded."})
+		return
+	} else if err != nil {
+		c.r.Err(err).Str("notifier", channel.Name).Msg("cannot send test notification")
+		gc.JSON(http.StatusBadGateway, gin.H{"message": "Cannot send test notification: " + err.Error()})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"message": "Test notification sent."})
+}
@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/console/notifier"
+)
+
+func TestNotifierHandlers(t *testing.T) {
+	var bodiesLock sync.Mutex
+	bodies := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodiesLock.Lock()
+		bodies = append(bodies, string(body))
+		bodiesLock.Unlock()
+	}))
+	defer server.Close()
+
+	config := DefaultConfiguration()
+	config.AdminGroups = []string{"admins"}
+	config.Notifiers = []notifier.ChannelConfiguration{
+		{
+			Name:      "noc",
+			RateLimit: 1,
+			Config: notifier.SlackConfiguration{
+				URL:      server.URL,
+				Template: "{{ .Status }}: {{ .Description }}",
+			},
+		}, {
+			Name: "oncall",
+			Config: notifier.PagerDutyConfiguration{
+				URL:        server.URL,
+				RoutingKey: "R0UT1NGK3Y",
+				Severity:   "critical",
+				Template:   "{{ .Summary }}",
+			},
+		},
+	}
+	_, h, _, _ := NewMock(t, config)
+	asUser := func(user, groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", user)
+		headers.Add("Remote-Groups", groups)
+		return headers
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list notifiers",
+			URL:         "/api/v0/console/notifiers",
+			JSONOutput: gin.H{"notifiers": []gin.H{
+				{"name": "noc", "type": "slack"},
+				{"name": "oncall", "type": "pagerduty"},
+			}},
+		}, {
+			Description: "test notifier as a regular user",
+			URL:         "/api/v0/console/admin/notifiers/noc/test",
+			Header:      asUser("marty", "users"),
+			StatusCode:  403,
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "Access restricted to administrators."},
+		}, {
+			Description: "test unknown notifier",
+			URL:         "/api/v0/console/admin/notifiers/nope/test",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  404,
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "Notifier not found."},
+		}, {
+			Description: "test notifier",
+			URL:         "/api/v0/console/admin/notifiers/noc/test",
+			Header:      asUser("alfred", "admins"),
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "Test notification sent."},
+		}, {
+			Description: "test notifier again",
+			URL:         "/api/v0/console/admin/notifiers/noc/test",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  429,
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "Rate limit of the notifier exceeded."},
+		}, {
+			Description: "create rule with notifier",
+			URL:         "/api/v0/console/alert-rules",
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "DDoS to customers",
+				"enabled":     true,
+				"units":       "pps",
+				"threshold":   100000,
+				"duration":    300,
+				"channel":     "https://hooks.example.com/ddos",
+				"notifier":    "oncall",
+			},
+			JSONOutput: gin.H{"id": 1},
+		}, {
+			Description: "list rules",
+			URL:         "/api/v0/console/alert-rules",
+			JSONOutput: gin.H{"rules": []gin.H{
+				{
+					"id":          1,
+					"user":        "__default",
+					"description": "DDoS to customers",
+					"enabled":     true,
+					"kind":        "threshold",
+					"filter":      "",
+					"dimension":   "",
+					"units":       "pps",
+					"threshold":   100000,
+					"duration":    300,
+					"baseline":    0,
+					"channel":     "",
+					"format":      "",
+					"notifier":    "oncall",
+				},
+			}},
+		},
+	})
+
+	expected := []string{`{"text":"firing: Test notification from Akvorado"}`}
+	if diff := helpers.Diff(bodies, expected); diff != "" {
+		t.Fatalf("Test notification (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDuplicateNotifiers(t *testing.T) {
+	config := DefaultConfiguration()
+	config.Notifiers = []notifier.ChannelConfiguration{
+		{Name: "noc", Config: notifier.WebhookConfiguration{URL: "https://hooks.example.com/1"}},
+		{Name: "noc", Config: notifier.WebhookConfiguration{URL: "https://hooks.example.com/2"}},
+	}
+	r := reporter.NewMock(t)
+	if _, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
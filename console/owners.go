@@ -0,0 +1,114 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"akvorado/common/helpers"
+	"akvorado/console/database"
+)
+
+type ownersTransferHandlerInput struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required,nefield=From"`
+}
+
+type ownersOrphansHandlerInput struct {
+	// Users is the list of users still known by the identity provider.
+	Users []string `json:"users" binding:"required"`
+}
+
+// ownersListHandlerFunc lists the users owning objects in the database.
+func (c *Component) ownersListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	owners, err := c.d.Database.ListOwners(ctx)
+	if err != nil {
+		c.r.Err(err).Msg("cannot list owners")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot list owners."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"owners": owners})
+}
+
+// ownersTransferHandlerFunc transfers all the objects of a user to another
+// user.
+func (c *Component) ownersTransferHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input ownersTransferHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	transferred, err := c.d.Database.TransferOwnership(ctx, input.From, input.To)
+	if err != nil {
+		c.r.Err(err).Msg("cannot transfer ownership")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot transfer ownership."})
+		return
+	}
+	c.r.Info().Str("from", input.From).Str("to", input.To).Msg("ownership transferred")
+	gc.JSON(http.StatusOK, gin.H{"transferred": transferred})
+}
+
+// orphans returns the owners not present in the provided list of users.
+// Internal users (like the default user) are never considered as orphans.
+func (c *Component) orphans(gc *gin.Context) (map[string]database.OwnedObjects, bool) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input ownersOrphansHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return nil, false
+	}
+	owners, err := c.d.Database.ListOwners(ctx)
+	if err != nil {
+		c.r.Err(err).Msg("cannot list owners")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot list owners."})
+		return nil, false
+	}
+	for owner := range owners {
+		if strings.HasPrefix(owner, "__") || slices.Contains(input.Users, owner) {
+			delete(owners, owner)
+		}
+	}
+	return owners, true
+}
+
+// ownersOrphansHandlerFunc lists the owners absent from the identity
+// provider with the objects they own.
+func (c *Component) ownersOrphansHandlerFunc(gc *gin.Context) {
+	orphans, ok := c.orphans(gc)
+	if !ok {
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"orphans": orphans})
+}
+
+// ownersPurgeOrphansHandlerFunc deletes the objects owned by users absent
+// from the identity provider.
+func (c *Component) ownersPurgeOrphansHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	orphans, ok := c.orphans(gc)
+	if !ok {
+		return
+	}
+	users := make([]string, 0, len(orphans))
+	for user := range orphans {
+		users = append(users, user)
+	}
+	slices.Sort(users)
+	deleted, err := c.d.Database.DeleteOwnedObjects(ctx, users)
+	if err != nil {
+		c.r.Err(err).Msg("cannot purge orphaned objects")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot purge orphaned objects."})
+		return
+	}
+	if len(users) > 0 {
+		c.r.Info().Strs("users", users).Msg("orphaned objects purged")
+	}
+	gc.JSON(http.StatusOK, gin.H{"users": users, "deleted": deleted})
+}
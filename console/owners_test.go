@@ -0,0 +1,143 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestOwners(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AdminGroups = []string{"admins"}
+	_, h, _, _ := NewMock(t, config)
+	asUser := func(user, groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", user)
+		headers.Add("Remote-Groups", groups)
+		return headers
+	}
+	allKinds := func(filters, queries int) gin.H {
+		return gin.H{
+			"filters":           filters,
+			"queries":           queries,
+			"annotations":       0,
+			"snapshots":         0,
+			"alert-rules":       0,
+			"scheduled-reports": 0,
+		}
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "store filter for marty",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("marty", "users"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "transit",
+				"content":     "OutIfConnectivity = transit",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store query for marty",
+			URL:         "/api/v0/console/query/saved",
+			Header:      asUser("marty", "users"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "top AS",
+				"graph":       "sankey",
+				"content":     `{"dimensions": ["SrcAS"]}`,
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store filter for biff",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("biff", "users"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "peering",
+				"content":     "OutIfConnectivity = peering",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store filter for default user",
+			URL:         "/api/v0/console/filter/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "IX",
+				"content":     "OutIfConnectivity = ix",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list owners as a regular user",
+			URL:         "/api/v0/console/admin/owners",
+			Header:      asUser("marty", "users"),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to administrators."},
+		}, {
+			Description: "list owners",
+			URL:         "/api/v0/console/admin/owners",
+			Header:      asUser("alfred", "admins"),
+			JSONOutput: gin.H{"owners": gin.H{
+				"__default": gin.H{"filters": 1},
+				"biff":      gin.H{"filters": 1},
+				"marty":     gin.H{"filters": 1, "queries": 1},
+			}},
+		}, {
+			Description: "transfer to the same user",
+			URL:         "/api/v0/console/admin/owners/transfer",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  400,
+			JSONInput:   gin.H{"from": "marty", "to": "marty"},
+			JSONOutput: gin.H{
+				"message": "Key: 'ownersTransferHandlerInput.To' Error:Field validation for 'To' failed on the 'nefield' tag",
+			},
+		}, {
+			Description: "transfer from marty to judith",
+			URL:         "/api/v0/console/admin/owners/transfer",
+			Header:      asUser("alfred", "admins"),
+			JSONInput:   gin.H{"from": "marty", "to": "judith"},
+			JSONOutput:  gin.H{"transferred": allKinds(1, 1)},
+		}, {
+			Description: "list orphans without users",
+			URL:         "/api/v0/console/admin/owners/orphans",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  400,
+			JSONInput:   gin.H{},
+			JSONOutput: gin.H{
+				"message": "Key: 'ownersOrphansHandlerInput.Users' Error:Field validation for 'Users' failed on the 'required' tag",
+			},
+		}, {
+			Description: "list orphans",
+			URL:         "/api/v0/console/admin/owners/orphans",
+			Header:      asUser("alfred", "admins"),
+			JSONInput:   gin.H{"users": []string{"judith", "marty"}},
+			JSONOutput: gin.H{"orphans": gin.H{
+				"biff": gin.H{"filters": 1},
+			}},
+		}, {
+			Description: "purge orphans",
+			URL:         "/api/v0/console/admin/owners/orphans/purge",
+			Header:      asUser("alfred", "admins"),
+			JSONInput:   gin.H{"users": []string{"judith", "marty"}},
+			JSONOutput: gin.H{
+				"users":   []string{"biff"},
+				"deleted": allKinds(1, 0),
+			},
+		}, {
+			Description: "list owners after purge",
+			URL:         "/api/v0/console/admin/owners",
+			Header:      asUser("alfred", "admins"),
+			JSONOutput: gin.H{"owners": gin.H{
+				"__default": gin.H{"filters": 1},
+				"judith":    gin.H{"filters": 1, "queries": 1},
+			}},
+		},
+	})
+}
@@ -0,0 +1,99 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/database"
+)
+
+// listParameters are the query parameters accepted by list endpoints. Without
+// limit, all objects are returned.
+type listParameters struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"min=0,max=1000"`
+	Sort   string `form:"sort"`
+	Fields string `form:"fields"`
+}
+
+// bindListParameters binds the list parameters from the query string. On
+// error, the request is answered and false is returned.
+func bindListParameters(gc *gin.Context) (listParameters, bool) {
+	var params listParameters
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return params, false
+	}
+	return params, true
+}
+
+// page returns the database page matching the list parameters.
+func (params listParameters) page() database.Page {
+	return database.Page{
+		Cursor: params.Cursor,
+		Limit:  params.Limit,
+		Sort:   params.Sort,
+	}
+}
+
+// listError answers a request for a list which could not be retrieved.
+// Invalid pages are reported to the client.
+func (c *Component) listError(gc *gin.Context, err error, what string) {
+	if errors.Is(err, database.ErrInvalidPage) {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	c.r.Err(err).Msgf("unable to list %s", what)
+	gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list " + what})
+}
+
+// listResponse answers a request for a list with the provided objects, only
+// keeping the requested fields, and the cursor to the next page, if any.
+func listResponse[T any](gc *gin.Context, params listParameters, key string, objects []T, next string) {
+	response := gin.H{key: objects}
+	if params.Fields != "" {
+		selected, err := selectFields(objects, strings.Split(params.Fields, ","))
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+			return
+		}
+		response[key] = selected
+	}
+	if next != "" {
+		response["next"] = next
+	}
+	gc.JSON(http.StatusOK, response)
+}
+
+// selectFields only keeps the provided fields of each object, using their
+// JSON names.
+func selectFields[T any](objects []T, fields []string) ([]map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	var decoded []map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, errors.New("cannot select fields of these objects")
+	}
+	results := make([]map[string]json.RawMessage, len(decoded))
+	for idx, object := range decoded {
+		results[idx] = make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			value, ok := object[field]
+			if !ok {
+				return nil, errors.New("unknown field " + field)
+			}
+			results[idx][field] = value
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	stdcontext "context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// graphLineProbe contains the results of a latency and loss probe, aligned on
+// the time axis of a line graph. Latency and jitter are in milliseconds and
+// loss is a percentage. Points without results are null.
+type graphLineProbe struct {
+	Name    string     `json:"name"`
+	Latency []*float64 `json:"latency"` // t → average latency
+	Jitter  []*float64 `json:"jitter"`  // t → average jitter
+	Loss    []*float64 `json:"loss"`    // t → average loss
+}
+
+// probesSQL builds the SQL query returning the results of the requested
+// probes. It uses the same context as the line graph to get the same time
+// intervals.
+func (input graphLineHandlerInput) probesSQL() string {
+	probes := make([]string, len(input.Probes))
+	for idx, probe := range input.Probes {
+		probes[idx] = quoteSQLString(probe)
+	}
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ Probe AS probe,
+ avg(Latency) AS latency,
+ avg(Jitter) AS jitter,
+ avg(Loss) AS loss
+FROM probes
+WHERE {{ .Timefilter }} AND Probe IN (%s)
+GROUP BY time, probe
+ORDER BY time, probe
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             input.Start,
+			End:               input.End,
+			MainTableRequired: input.requireMainTable(),
+			Points:            input.Points,
+		}),
+		templateEscape(strings.Join(probes, ", ")))
+	return strings.TrimSpace(sqlQuery)
+}
+
+// computeGraphLineProbes executes the provided SQL query for probes and
+// aligns the results on the provided time axis.
+func (c *Component) computeGraphLineProbes(ctx stdcontext.Context, input graphLineHandlerInput, sqlQuery string, axis []time.Time) ([]graphLineProbe, error) {
+	results := []struct {
+		Time    time.Time `ch:"time"`
+		Probe   string    `ch:"probe"`
+		Latency float64   `ch:"latency"`
+		Jitter  float64   `ch:"jitter"`
+		Loss    float64   `ch:"loss"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		return nil, err
+	}
+
+	timeIndex := make(map[int64]int, len(axis))
+	for idx, t := range axis {
+		timeIndex[t.Unix()] = idx
+	}
+	output := make([]graphLineProbe, len(input.Probes))
+	probeIndex := make(map[string]int, len(input.Probes))
+	for idx, probe := range input.Probes {
+		output[idx] = graphLineProbe{
+			Name:    probe,
+			Latency: make([]*float64, len(axis)),
+			Jitter:  make([]*float64, len(axis)),
+			Loss:    make([]*float64, len(axis)),
+		}
+		probeIndex[probe] = idx
+	}
+	for _, result := range results {
+		i, ok := probeIndex[result.Probe]
+		if !ok {
+			continue
+		}
+		j, ok := timeIndex[result.Time.Unix()]
+		if !ok {
+			continue
+		}
+		result := result
+		output[i].Latency[j] = &result.Latency
+		output[i].Jitter[j] = &result.Jitter
+		output[i].Loss[j] = &result.Loss
+	}
+	return output, nil
+}
+
+// probesHandlerFunc lists the probes with results during the last day.
+func (c *Component) probesHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	results := []struct {
+		Probe string `ch:"probe"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, `
+SELECT DISTINCT Probe AS probe
+FROM probes
+WHERE TimeReceived > date_sub(day, 1, now())
+ORDER BY probe
+LIMIT 1000`); err != nil {
+		c.r.Err(err).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	probes := make([]string, len(results))
+	for idx, result := range results {
+		probes[idx] = result.Probe
+	}
+	gc.JSON(http.StatusOK, gin.H{"probes": probes})
+}
@@ -0,0 +1,175 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestGraphLineProbesSQL(t *testing.T) {
+	input := graphLineHandlerInput{
+		graphCommonHandlerInput: graphCommonHandlerInput{
+			schema:     schema.NewMock(t),
+			Start:      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+			End:        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+			Dimensions: []query.Column{},
+			Filter:     query.Filter{},
+			Units:      "l3bps",
+		},
+		Points: 100,
+		Probes: []string{"paris-london", "o'hare"},
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := strings.ReplaceAll(`
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":100}@@ }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ Probe AS probe,
+ avg(Latency) AS latency,
+ avg(Jitter) AS jitter,
+ avg(Loss) AS loss
+FROM probes
+WHERE {{ .Timefilter }} AND Probe IN ('paris-london', 'o\'hare')
+GROUP BY time, probe
+ORDER BY time, probe
+{{ end }}`, "@@", "`")
+	got := input.probesSQL()
+	if diff := helpers.Diff(strings.Split(strings.TrimSpace(got), "\n"),
+		strings.Split(strings.TrimSpace(expected), "\n")); diff != "" {
+		t.Errorf("probesSQL (-got, +want):\n%s", diff)
+	}
+}
+
+func TestGraphLineHandlerProbes(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+	base := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	expectedSQL := []struct {
+		Axis       uint8     `ch:"axis"`
+		Time       time.Time `ch:"time"`
+		Xps        float64   `ch:"xps"`
+		Dimensions []string  `ch:"dimensions"`
+	}{
+		{1, base, 1000, []string{}},
+		{1, base.Add(time.Minute), 2000, []string{}},
+		{1, base.Add(2 * time.Minute), 1500, []string{}},
+	}
+	expectedProbesSQL := []struct {
+		Time    time.Time `ch:"time"`
+		Probe   string    `ch:"probe"`
+		Latency float64   `ch:"latency"`
+		Jitter  float64   `ch:"jitter"`
+		Loss    float64   `ch:"loss"`
+	}{
+		{base, "paris-london", 10, 1, 0},
+		{base, "paris-nyc", 80, 2, 0},
+		{base.Add(2 * time.Minute), "paris-london", 25, 5, 2.5},
+	}
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, expectedSQL).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, expectedProbesSQL).
+			Return(nil),
+	)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "with probes",
+			URL:         "/api/v0/console/graph/line",
+			JSONInput: gin.H{
+				"start":  time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":    time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"points": 100,
+				"limit":  20,
+				"units":  "l3bps",
+				"probes": []string{"paris-london", "paris-nyc"},
+			},
+			JSONOutput: gin.H{
+				"rows": [][]string{{}},
+				"t": []string{
+					"2009-11-10T23:00:00Z",
+					"2009-11-10T23:01:00Z",
+					"2009-11-10T23:02:00Z",
+				},
+				"points":     [][]int{{1000, 2000, 1500}},
+				"min":        []int{1000},
+				"max":        []int{2000},
+				"average":    []int{1500},
+				"95th":       []int{1750},
+				"axis":       []int{1},
+				"axis-names": map[int]string{1: "Direct"},
+				"probes": []gin.H{
+					{
+						"name":    "paris-london",
+						"latency": []any{10, nil, 25},
+						"jitter":  []any{1, nil, 5},
+						"loss":    []any{0, nil, 2.5},
+					}, {
+						"name":    "paris-nyc",
+						"latency": []any{80, nil, nil},
+						"jitter":  []any{2, nil, nil},
+						"loss":    []any{0, nil, nil},
+					},
+				},
+			},
+		}, {
+			Description: "too many probes",
+			URL:         "/api/v0/console/graph/line",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"start":  time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+				"end":    time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+				"points": 100,
+				"limit":  20,
+				"units":  "l3bps",
+				"probes": []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"},
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'graphLineHandlerInput.Probes' Error:Field validation for 'Probes' failed on the 'max' tag",
+			},
+		},
+	})
+}
+
+func TestProbesHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	expectedSQL := []struct {
+		Probe string `ch:"probe"`
+	}{
+		{"paris-london"},
+		{"paris-nyc"},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), `
+SELECT DISTINCT Probe AS probe
+FROM probes
+WHERE TimeReceived > date_sub(day, 1, now())
+ORDER BY probe
+LIMIT 1000`).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/console/probes",
+			JSONOutput: gin.H{"probes": []string{"paris-london", "paris-nyc"}},
+		},
+	})
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"akvorado/console/query"
+)
+
+// PublicChartConfiguration defines an aggregate chart available without
+// authentication, for example for a public status page.
+type PublicChartConfiguration struct {
+	// Name is the name of the chart, used in the URL.
+	Name string `validate:"required,excludesall=/?#%"`
+	// Description is a description of the chart.
+	Description string
+	// Filter restricts the flows used by the chart. It cannot be changed
+	// by the user.
+	Filter string
+	// Units is the unit of the chart.
+	Units string `validate:"required,oneof=pps l3bps l2bps"`
+	// Range is the period covered by the chart, ending now.
+	Range time.Duration `validate:"min=1h"`
+}
+
+// publicChart is a public chart with its validated filter.
+type publicChart struct {
+	PublicChartConfiguration
+	filter query.Filter
+}
+
+// publicChartPoints is the number of points of a public chart.
+const publicChartPoints = 200
+
+// initPublicCharts validates the public charts.
+func (c *Component) initPublicCharts() error {
+	for _, pc := range c.config.PublicCharts {
+		if slices.ContainsFunc(c.publicCharts, func(other publicChart) bool { return other.Name == pc.Name }) {
+			return fmt.Errorf("duplicate public chart %q", pc.Name)
+		}
+		filter := query.NewFilter(pc.Filter)
+		if err := filter.Validate(c.d.Schema); err != nil {
+			return fmt.Errorf("invalid filter for public chart %q: %w", pc.Name, err)
+		}
+		c.publicCharts = append(c.publicCharts, publicChart{pc, filter})
+	}
+	if c.config.PublicRateLimit > 0 {
+		c.publicLimiter = rate.NewLimiter(rate.Limit(float64(c.config.PublicRateLimit)/60), c.config.PublicRateLimit)
+	}
+	return nil
+}
+
+// publicRateLimit is a middleware limiting the number of requests to public
+// endpoints, for all clients.
+func (c *Component) publicRateLimit() gin.HandlerFunc {
+	return func(gc *gin.Context) {
+		if c.publicLimiter != nil && !c.publicLimiter.Allow() {
+			gc.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests."})
+			return
+		}
+		gc.Next()
+	}
+}
+
+// toSQL returns the SQL query for a public chart.
+func (pc publicChart) toSQL(now time.Time) string {
+	sqlQuery := fmt.Sprintf(`
+{{ with %s }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ {{ .Units }}/{{ .Interval }} AS xps
+FROM {{ .Table }}
+WHERE %s
+GROUP BY time
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+{{ end }}`,
+		templateContext(inputContext{
+			Start:             now.Add(-pc.Range),
+			End:               now,
+			MainTableRequired: pc.filter.MainTableRequired(),
+			Points:            publicChartPoints,
+			Units:             pc.Units,
+		}),
+		templateWhere(pc.filter))
+	return strings.TrimSpace(sqlQuery)
+}
+
+func (c *Component) publicChartsListHandlerFunc(gc *gin.Context) {
+	charts := []gin.H{}
+	for _, pc := range c.publicCharts {
+		charts = append(charts, gin.H{
+			"name":        pc.Name,
+			"description": pc.Description,
+			"units":       pc.Units,
+		})
+	}
+	gc.JSON(http.StatusOK, gin.H{"charts": charts})
+}
+
+func (c *Component) publicChartHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	name := gc.Param("name")
+	idx := slices.IndexFunc(c.publicCharts, func(pc publicChart) bool { return pc.Name == name })
+	if idx < 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Chart not found."})
+		return
+	}
+	pc := c.publicCharts[idx]
+
+	// The query is not exposed in a header as the endpoint is public.
+	sqlQuery := c.finalizeQuery(pc.toSQL(c.d.Clock.Now()))
+	results := []struct {
+		Time time.Time `ch:"time"`
+		Xps  float64   `ch:"xps"`
+	}{}
+	if err := c.d.ClickHouseDB.Conn.Select(ctx, &results, sqlQuery); err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
+		return
+	}
+	t := make([]time.Time, 0, len(results))
+	xps := make([]int, 0, len(results))
+	for _, result := range results {
+		t = append(t, result.Time)
+		xps = append(xps, int(result.Xps))
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"name":        pc.Name,
+		"description": pc.Description,
+		"units":       pc.Units,
+		"t":           t,
+		"xps":         xps,
+	})
+}
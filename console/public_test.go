@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/console/query"
+)
+
+func TestPublicChartQuerySQL(t *testing.T) {
+	pc := publicChart{
+		PublicChartConfiguration: PublicChartConfiguration{
+			Name:   "external",
+			Filter: "InIfBoundary = external",
+			Units:  "l3bps",
+			Range:  24 * time.Hour,
+		},
+		filter: query.NewFilter("InIfBoundary = external"),
+	}
+	if err := pc.filter.Validate(schema.NewMock(t)); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	expected := `
+{{ with context @@{"start":"2022-04-10T15:45:10Z","end":"2022-04-11T15:45:10Z","points":200,"units":"l3bps"}@@ }}
+SELECT
+ {{ call .ToStartOfInterval "TimeReceived" }} AS time,
+ {{ .Units }}/{{ .Interval }} AS xps
+FROM {{ .Table }}
+WHERE {{ .Timefilter }} AND (InIfBoundary = 'external')
+GROUP BY time
+ORDER BY time WITH FILL
+ FROM {{ .TimefilterStart }}
+ TO {{ .TimefilterEnd }} + INTERVAL 1 second
+ STEP {{ .Interval }}
+{{ end }}`
+	expected = strings.ReplaceAll(strings.TrimSpace(expected), "@@", "`")
+	got := pc.toSQL(time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC))
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("toSQL() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestPublicChartsInvalidFilter(t *testing.T) {
+	config := DefaultConfiguration()
+	config.PublicCharts = []PublicChartConfiguration{
+		{Name: "external", Filter: "InIfBoundary =", Units: "l3bps", Range: time.Hour},
+	}
+	c := Component{config: config, d: &Dependencies{Schema: schema.NewMock(t)}}
+	if err := c.initPublicCharts(); err == nil {
+		t.Fatal("initPublicCharts() did not error")
+	}
+}
+
+func TestPublicCharts(t *testing.T) {
+	config := DefaultConfiguration()
+	config.PublicCharts = []PublicChartConfiguration{
+		{
+			Name:        "external",
+			Description: "External traffic",
+			Filter:      "InIfBoundary = external",
+			Units:       "l3bps",
+			Range:       24 * time.Hour,
+		}, {
+			Name:        "internal",
+			Description: "Internal traffic",
+			Filter:      "InIfBoundary = internal",
+			Units:       "pps",
+			Range:       time.Hour,
+		},
+	}
+	config.PublicRateLimit = 1
+	_, h, mockConn, mockClock := NewMock(t, config)
+	mockClock.Set(time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC))
+
+	expectedSQL := []struct {
+		Time time.Time `ch:"time"`
+		Xps  float64   `ch:"xps"`
+	}{
+		{time.Date(2022, 4, 11, 15, 30, 0, 0, time.UTC), 1000.4},
+		{time.Date(2022, 4, 11, 15, 40, 0, 0, time.UTC), 2000},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list",
+			URL:         "/api/v0/console/public/charts",
+			JSONOutput: gin.H{
+				"charts": []gin.H{
+					{"name": "external", "description": "External traffic", "units": "l3bps"},
+					{"name": "internal", "description": "Internal traffic", "units": "pps"},
+				},
+			},
+		}, {
+			Description: "chart",
+			URL:         "/api/v0/console/public/charts/external",
+			JSONOutput: gin.H{
+				"name":        "external",
+				"description": "External traffic",
+				"units":       "l3bps",
+				"t": []string{
+					"2022-04-11T15:30:00Z",
+					"2022-04-11T15:40:00Z",
+				},
+				"xps": []int{1000, 2000},
+			},
+		}, {
+			Description: "chart from cache",
+			URL:         "/api/v0/console/public/charts/external",
+			JSONOutput: gin.H{
+				"name":        "external",
+				"description": "External traffic",
+				"units":       "l3bps",
+				"t": []string{
+					"2022-04-11T15:30:00Z",
+					"2022-04-11T15:40:00Z",
+				},
+				"xps": []int{1000, 2000},
+			},
+		}, {
+			Description: "rate limited",
+			URL:         "/api/v0/console/public/charts/internal",
+			StatusCode:  429,
+			JSONOutput:  gin.H{"message": "Too many requests."},
+		},
+	})
+}
+
+func TestPublicChartsUnknown(t *testing.T) {
+	config := DefaultConfiguration()
+	config.PublicCharts = []PublicChartConfiguration{
+		{Name: "external", Units: "l3bps", Range: time.Hour},
+	}
+	_, h, _, _ := NewMock(t, config)
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/console/public/charts/unknown",
+			StatusCode: 404,
+			JSONOutput: gin.H{"message": "Chart not found."},
+		},
+	})
+}
@@ -109,6 +109,9 @@ func (qc Column) ToSQLSelect(sch *schema.Component) string {
 			helpers.ETypeIPv4, helpers.ETypeIPv6)
 	case schema.ColumnProto:
 		strValue = `dictGetOrDefault('protocols', 'name', Proto, '???')`
+	case schema.ColumnSrcPort, schema.ColumnDstPort:
+		strValue = fmt.Sprintf(`if(dictHas('ports', tuple(Proto, %s)), concat(toString(%s), ': ', dictGet('ports', 'name', tuple(Proto, %s))), toString(%s))`,
+			qc, qc, qc, qc)
 	case schema.ColumnMPLSLabels:
 		strValue = `arrayStringConcat(MPLSLabels, ' ')`
 	case schema.ColumnDstASPath:
@@ -139,12 +142,17 @@ func (qc Column) ToSQLSelect(sch *schema.Component) string {
 	default:
 		strValue = qc.String()
 		if col, ok := sch.LookupColumnByKey(key); ok {
-			if strings.HasPrefix(col.ClickHouseType, "UInt") {
+			chType := col.ClickHouseNotNullableType()
+			if strings.HasPrefix(chType, "UInt") {
 				strValue = fmt.Sprintf(`toString(%s)`, qc)
-			} else if col.ClickHouseType == "IPv6" || col.ClickHouseType == "LowCardinality(IPv6)" {
+			} else if chType == "IPv6" || chType == "LowCardinality(IPv6)" {
 				strValue = fmt.Sprintf("replaceRegexpOne(IPv6NumToString(%s), '^::ffff:', '')", qc)
 			}
 		}
 	}
+	// Missing values stored as NULL are grouped into an "Unknown" bucket
+	if col, ok := sch.LookupColumnByKey(key); ok && col.ClickHouseNullable {
+		strValue = fmt.Sprintf("ifNull(%s, 'Unknown')", strValue)
+	}
 	return strValue
 }
@@ -68,6 +68,9 @@ func TestQueryColumnSQLSelect(t *testing.T) {
 		}, {
 			Input:    schema.ColumnProto,
 			Expected: `dictGetOrDefault('protocols', 'name', Proto, '???')`,
+		}, {
+			Input:    schema.ColumnDstPort,
+			Expected: `if(dictHas('ports', tuple(Proto, DstPort)), concat(toString(DstPort), ': ', dictGet('ports', 'name', tuple(Proto, DstPort))), toString(DstPort))`,
 		}, {
 			Input:    schema.ColumnEType,
 			Expected: `if(EType = 2048, 'IPv4', if(EType = 34525, 'IPv6', '???'))`,
@@ -118,6 +121,36 @@ func TestQueryColumnSQLSelect(t *testing.T) {
 	}
 }
 
+func TestQueryColumnSQLSelectNullable(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.MissingValues = map[schema.ColumnKey]schema.MissingValue{
+		schema.ColumnInIfSpeed:    {Nullable: true},
+		schema.ColumnInIfProvider: {Nullable: true},
+		schema.ColumnExporterName: {Default: "unknown"},
+	}
+	sch, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	cases := []struct {
+		Input    schema.ColumnKey
+		Expected string
+	}{
+		{schema.ColumnInIfSpeed, `ifNull(toString(InIfSpeed), 'Unknown')`},
+		{schema.ColumnInIfProvider, `ifNull(InIfProvider, 'Unknown')`},
+		{schema.ColumnExporterName, `ExporterName`},
+	}
+	for _, tc := range cases {
+		column := query.NewColumn(tc.Input.String())
+		if err := column.Validate(sch); err != nil {
+			t.Fatalf("Validate() error:\n%+v", err)
+		}
+		if diff := helpers.Diff(column.ToSQLSelect(sch), tc.Expected); diff != "" {
+			t.Errorf("ToSQLSelect(%s) (-got, +want):\n%s", tc.Input, diff)
+		}
+	}
+}
+
 func TestReverseDirection(t *testing.T) {
 	columns := query.Columns{
 		query.NewColumn("SrcAS"),
@@ -0,0 +1,526 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// graphRenderHandlerInput describes the input for the /graph/line/render
+// endpoint. Request is the body of a /graph/line request.
+type graphRenderHandlerInput struct {
+	Format  string          `json:"format" binding:"required,oneof=svg png"`
+	Width   int             `json:"width" binding:"omitempty,min=200,max=4000"`
+	Height  int             `json:"height" binding:"omitempty,min=150,max=4000"`
+	Title   string          `json:"title" binding:"max=200"`
+	Request json.RawMessage `json:"request" binding:"required"`
+}
+
+// chartPrimitive is a shape to draw on a chart. Coordinates are in pixels,
+// from the top left corner.
+type chartPrimitive struct {
+	kind   chartPrimitiveKind
+	points []chartPoint // polygon or polyline
+	text   string       // text
+	anchor string       // text: start, middle, or end
+	color  color.RGBA
+}
+
+type chartPoint struct{ x, y float64 }
+
+type chartPrimitiveKind int
+
+const (
+	chartPolygon chartPrimitiveKind = iota
+	chartPolyline
+	chartText
+)
+
+// chartPalette is the list of colors used for rows. "Other" is grey.
+var chartPalette = []color.RGBA{
+	{0x54, 0x70, 0xc6, 0xff},
+	{0x91, 0xcc, 0x75, 0xff},
+	{0xfa, 0xc8, 0x58, 0xff},
+	{0xee, 0x66, 0x66, 0xff},
+	{0x73, 0xc0, 0xde, 0xff},
+	{0x3b, 0xa2, 0x72, 0xff},
+	{0xfc, 0x84, 0x52, 0xff},
+	{0x9a, 0x60, 0xb4, 0xff},
+	{0xea, 0x7c, 0xcc, 0xff},
+}
+
+var (
+	chartBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartForeground = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartGrid       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	chartOther      = color.RGBA{0xaa, 0xaa, 0xaa, 0xff}
+)
+
+const (
+	chartFontHeight      = 7 // height of a glyph, both for SVG and PNG
+	chartLineHeight      = 14
+	chartMaxLegendSeries = 10
+)
+
+// formatChartValue formats a value for the provided units.
+func formatChartValue(value float64, units string) string {
+	if strings.HasSuffix(units, "%") {
+		return fmt.Sprintf("%.1f%%", value)
+	}
+	return formatXps(value, units)
+}
+
+// buildLineChart turns the output of a line graph into a list of primitives.
+// Rows of the first axis are stacked. Other axes are drawn as a line for
+// their total.
+func buildLineChart(output graphLineHandlerOutput, units, title string, width, height int) []chartPrimitive {
+	primitives := []chartPrimitive{}
+	nbPoints := len(output.Time)
+
+	// Collect series and compute the maximum value
+	type series struct {
+		label  string
+		color  color.RGBA
+		values []float64
+	}
+	stacked := []series{}
+	lines := []series{}
+	totals := map[int][]float64{}
+	for idx, row := range output.Rows {
+		axis := output.Axis[idx]
+		if totals[axis] == nil {
+			totals[axis] = make([]float64, nbPoints)
+		}
+		for i, v := range output.Points[idx] {
+			totals[axis][i] += float64(v)
+		}
+		if axis != 1 {
+			continue
+		}
+		label := strings.Join(row, " — ")
+		if label == "" {
+			label = "Total"
+		}
+		c := chartPalette[len(stacked)%len(chartPalette)]
+		if len(row) > 0 && row[0] == "Other" {
+			c = chartOther
+		}
+		values := make([]float64, nbPoints)
+		for i, v := range output.Points[idx] {
+			values[i] = float64(v)
+		}
+		stacked = append(stacked, series{label, c, values})
+	}
+	axes := make([]int, 0, len(totals))
+	for axis := range totals {
+		if axis != 1 {
+			axes = append(axes, axis)
+		}
+	}
+	sort.Ints(axes)
+	for idx, axis := range axes {
+		lines = append(lines, series{
+			label:  output.AxisNames[axis],
+			color:  chartForeground,
+			values: totals[axis],
+		})
+		if idx > 0 {
+			lines[idx].color = chartOther
+		}
+	}
+	maximum := 0.
+	for _, values := range totals {
+		for _, v := range values {
+			maximum = max(maximum, v)
+		}
+	}
+	maximum = chartNiceMaximum(maximum)
+
+	// Layout
+	legendSeries := min(len(stacked)+len(lines), chartMaxLegendSeries)
+	left, right := 80., float64(width)-15
+	top, bottom := 15., float64(height)-25-float64(legendSeries*chartLineHeight)
+	if title != "" {
+		top += chartLineHeight
+		primitives = append(primitives, chartPrimitive{
+			kind:   chartText,
+			points: []chartPoint{{float64(width) / 2, 15}},
+			text:   title,
+			anchor: "middle",
+			color:  chartForeground,
+		})
+	}
+	bottom = max(bottom, top+20)
+	x := func(i int) float64 {
+		if nbPoints < 2 {
+			return left
+		}
+		return left + (right-left)*float64(i)/float64(nbPoints-1)
+	}
+	y := func(v float64) float64 {
+		return bottom - (bottom-top)*v/maximum
+	}
+
+	// Grid and Y labels
+	for i := 0; i <= 4; i++ {
+		v := maximum * float64(i) / 4
+		primitives = append(primitives, chartPrimitive{
+			kind:   chartPolyline,
+			points: []chartPoint{{left, y(v)}, {right, y(v)}},
+			color:  chartGrid,
+		}, chartPrimitive{
+			kind:   chartText,
+			points: []chartPoint{{left - 5, y(v) + chartFontHeight/2}},
+			text:   formatChartValue(v, units),
+			anchor: "end",
+			color:  chartForeground,
+		})
+	}
+
+	// Stacked areas
+	lower := make([]float64, nbPoints)
+	for _, s := range stacked {
+		upper := make([]float64, nbPoints)
+		polygon := make([]chartPoint, 0, 2*nbPoints)
+		for i := range upper {
+			upper[i] = lower[i] + s.values[i]
+			polygon = append(polygon, chartPoint{x(i), y(upper[i])})
+		}
+		for i := nbPoints - 1; i >= 0; i-- {
+			polygon = append(polygon, chartPoint{x(i), y(lower[i])})
+		}
+		primitives = append(primitives, chartPrimitive{
+			kind:   chartPolygon,
+			points: polygon,
+			color:  s.color,
+		})
+		lower = upper
+	}
+	// Lines
+	for _, s := range lines {
+		polyline := make([]chartPoint, 0, nbPoints)
+		for i, v := range s.values {
+			polyline = append(polyline, chartPoint{x(i), y(v)})
+		}
+		primitives = append(primitives, chartPrimitive{
+			kind:   chartPolyline,
+			points: polyline,
+			color:  s.color,
+		})
+	}
+
+	// X axis and labels
+	primitives = append(primitives, chartPrimitive{
+		kind:   chartPolyline,
+		points: []chartPoint{{left, bottom}, {right, bottom}},
+		color:  chartForeground,
+	})
+	if nbPoints > 0 {
+		primitives = append(primitives, chartPrimitive{
+			kind:   chartText,
+			points: []chartPoint{{left, bottom + 5 + chartLineHeight}},
+			text:   output.Time[0].UTC().Format("2006-01-02 15:04 UTC"),
+			anchor: "start",
+			color:  chartForeground,
+		}, chartPrimitive{
+			kind:   chartText,
+			points: []chartPoint{{right, bottom + 5 + chartLineHeight}},
+			text:   output.Time[nbPoints-1].UTC().Format("2006-01-02 15:04 UTC"),
+			anchor: "end",
+			color:  chartForeground,
+		})
+	}
+
+	// Legend
+	legendY := bottom + 5 + 2*chartLineHeight
+	for idx, s := range append(stacked, lines...) {
+		if idx >= chartMaxLegendSeries {
+			break
+		}
+		ly := legendY + float64(idx*chartLineHeight)
+		primitives = append(primitives, chartPrimitive{
+			kind: chartPolygon,
+			points: []chartPoint{
+				{left, ly - chartFontHeight}, {left + 10, ly - chartFontHeight},
+				{left + 10, ly}, {left, ly},
+			},
+			color: s.color,
+		}, chartPrimitive{
+			kind:   chartText,
+			points: []chartPoint{{left + 15, ly}},
+			text:   s.label,
+			anchor: "start",
+			color:  chartForeground,
+		})
+	}
+	return primitives
+}
+
+// chartNiceMaximum rounds up the provided maximum to get round labels.
+func chartNiceMaximum(maximum float64) float64 {
+	if maximum <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(maximum)))
+	for _, step := range []float64{1, 2, 4, 5, 8, 10} {
+		if step*magnitude >= maximum {
+			return step * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// renderSVG renders the provided primitives as SVG.
+func renderSVG(primitives []chartPrimitive, width, height int) []byte {
+	var buf bytes.Buffer
+	hexColor := func(c color.RGBA) string {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	points := func(points []chartPoint) string {
+		s := make([]string, len(points))
+		for i, p := range points {
+			s[i] = fmt.Sprintf("%.1f,%.1f", p.x, p.y)
+		}
+		return strings.Join(s, " ")
+	}
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		width, height, width, height)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`+"\n", hexColor(chartBackground))
+	for _, p := range primitives {
+		switch p.kind {
+		case chartPolygon:
+			fmt.Fprintf(&buf, `<polygon points="%s" fill="%s"/>`+"\n", points(p.points), hexColor(p.color))
+		case chartPolyline:
+			fmt.Fprintf(&buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`+"\n",
+				points(p.points), hexColor(p.color))
+		case chartText:
+			fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" text-anchor="%s" fill="%s" font-family="sans-serif" font-size="11">`,
+				p.points[0].x, p.points[0].y, p.anchor, hexColor(p.color))
+			xml.EscapeText(&buf, []byte(p.text))
+			buf.WriteString("</text>\n")
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+// renderPNG renders the provided primitives as PNG.
+func renderPNG(primitives []chartPrimitive, width, height int, w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] =
+			chartBackground.R, chartBackground.G, chartBackground.B, chartBackground.A
+	}
+	for _, p := range primitives {
+		switch p.kind {
+		case chartPolygon:
+			pngFillPolygon(img, p.points, p.color)
+		case chartPolyline:
+			for i := 1; i < len(p.points); i++ {
+				pngLine(img, p.points[i-1], p.points[i], p.color)
+			}
+		case chartText:
+			pngText(img, p.points[0], p.text, p.anchor, p.color)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// pngFillPolygon fills a polygon using the even-odd rule.
+func pngFillPolygon(img *image.RGBA, points []chartPoint, c color.RGBA) {
+	if len(points) < 3 {
+		return
+	}
+	minY, maxY := points[0].y, points[0].y
+	for _, p := range points {
+		minY, maxY = min(minY, p.y), max(maxY, p.y)
+	}
+	bounds := img.Bounds()
+	xs := []float64{}
+	for py := max(int(math.Floor(minY)), bounds.Min.Y); py <= min(int(math.Ceil(maxY)), bounds.Max.Y-1); py++ {
+		sy := float64(py) + 0.5
+		xs = xs[:0]
+		for i := range points {
+			a, b := points[i], points[(i+1)%len(points)]
+			if (a.y <= sy && b.y > sy) || (b.y <= sy && a.y > sy) {
+				xs = append(xs, a.x+(sy-a.y)*(b.x-a.x)/(b.y-a.y))
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			for px := int(math.Round(xs[i])); px < int(math.Round(xs[i+1])); px++ {
+				if px >= bounds.Min.X && px < bounds.Max.X {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+	}
+}
+
+// pngLine draws a line between two points.
+func pngLine(img *image.RGBA, a, b chartPoint, c color.RGBA) {
+	steps := int(math.Ceil(max(math.Abs(b.x-a.x), math.Abs(b.y-a.y))))
+	for i := 0; i <= steps; i++ {
+		t := 0.
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		img.SetRGBA(int(a.x+t*(b.x-a.x)), int(a.y+t*(b.y-a.y)), c)
+	}
+}
+
+// pngText draws a text with the embedded bitmap font. The provided point is
+// on the baseline. Lowercase letters are drawn as uppercase letters.
+func pngText(img *image.RGBA, p chartPoint, text string, anchor string, c color.RGBA) {
+	text = strings.ToUpper(text)
+	width := float64(len([]rune(text)) * 6)
+	x := p.x
+	switch anchor {
+	case "middle":
+		x -= width / 2
+	case "end":
+		x -= width
+	}
+	x0, y0 := int(x), int(p.y)-chartFontHeight
+	for idx, r := range []rune(text) {
+		glyph, ok := chartFont[r]
+		if !ok {
+			glyph = chartFont['?']
+		}
+		for row, bits := range glyph {
+			for col := 0; col < 5; col++ {
+				if bits&(1<<(4-col)) != 0 {
+					img.SetRGBA(x0+idx*6+col, y0+row, c)
+				}
+			}
+		}
+	}
+}
+
+// chartFont is a 5x7 bitmap font. Each line is a row of the glyph, the most
+// significant of the 5 bits being the leftmost pixel.
+var chartFont = map[rune][chartFontHeight]uint8{
+	' ':  {},
+	'0':  {0x0e, 0x11, 0x13, 0x15, 0x19, 0x11, 0x0e},
+	'1':  {0x04, 0x0c, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'2':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x08, 0x1f},
+	'3':  {0x1f, 0x02, 0x04, 0x02, 0x01, 0x11, 0x0e},
+	'4':  {0x02, 0x06, 0x0a, 0x12, 0x1f, 0x02, 0x02},
+	'5':  {0x1f, 0x10, 0x1e, 0x01, 0x01, 0x11, 0x0e},
+	'6':  {0x06, 0x08, 0x10, 0x1e, 0x11, 0x11, 0x0e},
+	'7':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x08, 0x08},
+	'8':  {0x0e, 0x11, 0x11, 0x0e, 0x11, 0x11, 0x0e},
+	'9':  {0x0e, 0x11, 0x11, 0x0f, 0x01, 0x02, 0x0c},
+	'A':  {0x0e, 0x11, 0x11, 0x11, 0x1f, 0x11, 0x11},
+	'B':  {0x1e, 0x11, 0x11, 0x1e, 0x11, 0x11, 0x1e},
+	'C':  {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'D':  {0x1c, 0x12, 0x11, 0x11, 0x11, 0x12, 0x1c},
+	'E':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'F':  {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x10},
+	'G':  {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'H':  {0x11, 0x11, 0x11, 0x1f, 0x11, 0x11, 0x11},
+	'I':  {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'J':  {0x07, 0x02, 0x02, 0x02, 0x02, 0x12, 0x0c},
+	'K':  {0x11, 0x12, 0x14, 0x18, 0x14, 0x12, 0x11},
+	'L':  {0x10, 0x10, 0x10, 0x10, 0x10, 0x10, 0x1f},
+	'M':  {0x11, 0x1b, 0x15, 0x15, 0x11, 0x11, 0x11},
+	'N':  {0x11, 0x11, 0x19, 0x15, 0x13, 0x11, 0x11},
+	'O':  {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'P':  {0x1e, 0x11, 0x11, 0x1e, 0x10, 0x10, 0x10},
+	'Q':  {0x0e, 0x11, 0x11, 0x11, 0x15, 0x12, 0x0d},
+	'R':  {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'S':  {0x0f, 0x10, 0x10, 0x0e, 0x01, 0x01, 0x1e},
+	'T':  {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'U':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'V':  {0x11, 0x11, 0x11, 0x11, 0x11, 0x0a, 0x04},
+	'W':  {0x11, 0x11, 0x11, 0x15, 0x15, 0x15, 0x0a},
+	'X':  {0x11, 0x11, 0x0a, 0x04, 0x0a, 0x11, 0x11},
+	'Y':  {0x11, 0x11, 0x11, 0x0a, 0x04, 0x04, 0x04},
+	'Z':  {0x1f, 0x01, 0x02, 0x04, 0x08, 0x10, 0x1f},
+	'.':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+	',':  {0x00, 0x00, 0x00, 0x00, 0x0c, 0x04, 0x08},
+	':':  {0x00, 0x0c, 0x0c, 0x00, 0x0c, 0x0c, 0x00},
+	'-':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'—':  {0x00, 0x00, 0x00, 0x1f, 0x00, 0x00, 0x00},
+	'_':  {0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x1f},
+	'+':  {0x00, 0x04, 0x04, 0x1f, 0x04, 0x04, 0x00},
+	'=':  {0x00, 0x00, 0x1f, 0x00, 0x1f, 0x00, 0x00},
+	'/':  {0x00, 0x01, 0x02, 0x04, 0x08, 0x10, 0x00},
+	'%':  {0x18, 0x19, 0x02, 0x04, 0x08, 0x13, 0x03},
+	'(':  {0x02, 0x04, 0x08, 0x08, 0x08, 0x04, 0x02},
+	')':  {0x08, 0x04, 0x02, 0x02, 0x02, 0x04, 0x08},
+	'<':  {0x02, 0x04, 0x08, 0x10, 0x08, 0x04, 0x02},
+	'>':  {0x08, 0x04, 0x02, 0x01, 0x02, 0x04, 0x08},
+	'\'': {0x0c, 0x04, 0x08, 0x00, 0x00, 0x00, 0x00},
+	'?':  {0x0e, 0x11, 0x01, 0x02, 0x04, 0x00, 0x04},
+}
+
+func (c *Component) graphLineRenderHandlerFunc(gc *gin.Context) {
+	var input graphRenderHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.Width == 0 {
+		input.Width = 800
+	}
+	if input.Height == 0 {
+		input.Height = 400
+	}
+	var request struct {
+		Units string `json:"units"`
+	}
+	if err := json.Unmarshal(input.Request, &request); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	// Execute the request with the line graph handler and keep its result.
+	writer := gc.Writer
+	buffered := &bufferedResponseWriter{ResponseWriter: writer, status: http.StatusOK}
+	gc.Writer = buffered
+	gc.Request.Body = io.NopCloser(bytes.NewReader(input.Request))
+	c.graphLineHandlerFunc(gc)
+	gc.Writer = writer
+	if buffered.status != http.StatusOK {
+		gc.Data(buffered.status, buffered.Header().Get("Content-Type"), buffered.body.Bytes())
+		return
+	}
+	writer.Header().Del("Content-Type")
+	var output graphLineHandlerOutput
+	if err := json.Unmarshal(buffered.body.Bytes(), &output); err != nil {
+		c.r.Err(err).Msg("cannot decode line graph output")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to render graph."})
+		return
+	}
+
+	primitives := buildLineChart(output, request.Units, input.Title, input.Width, input.Height)
+	switch input.Format {
+	case "svg":
+		gc.Data(http.StatusOK, "image/svg+xml", renderSVG(primitives, input.Width, input.Height))
+	case "png":
+		var buf bytes.Buffer
+		if err := renderPNG(primitives, input.Width, input.Height, &buf); err != nil {
+			c.r.Err(err).Msg("cannot render PNG")
+			gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to render graph."})
+			return
+		}
+		gc.Data(http.StatusOK, "image/png", buf.Bytes())
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestChartNiceMaximum(t *testing.T) {
+	cases := []struct {
+		Input    float64
+		Expected float64
+	}{
+		{0, 1},
+		{1, 1},
+		{7, 8},
+		{12, 20},
+		{1200, 2000},
+		{3500, 4000},
+		{4500, 5000},
+		{9100, 10000},
+	}
+	for _, tc := range cases {
+		if got := chartNiceMaximum(tc.Input); got != tc.Expected {
+			t.Errorf("chartNiceMaximum(%v) == %v, expected %v", tc.Input, got, tc.Expected)
+		}
+	}
+}
+
+func testLineChartOutput() graphLineHandlerOutput {
+	base := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	return graphLineHandlerOutput{
+		Time: []time.Time{base, base.Add(time.Minute), base.Add(2 * time.Minute)},
+		Rows: [][]string{
+			{"router1"},
+			{"Other"},
+			{},
+		},
+		Points: [][]int{
+			{1000, 2000, 1500},
+			{500, 500, 500},
+			{1200, 1800, 2500},
+		},
+		Axis:      []int{1, 1, 3},
+		AxisNames: map[int]string{1: "Direct", 3: "Previous hour"},
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	primitives := buildLineChart(testLineChartOutput(), "l3bps", "Traffic <test>", 800, 400)
+	got := string(renderSVG(primitives, 800, 400))
+	for _, expected := range []string{
+		`<svg xmlns="http://www.w3.org/2000/svg" width="800" height="400" viewBox="0 0 800 400">`,
+		`>Traffic &lt;test&gt;</text>`,
+		`>4.0 kbps</text>`,
+		`>2009-11-10 23:00 UTC</text>`,
+		`>2009-11-10 23:02 UTC</text>`,
+		`>router1</text>`,
+		`>Other</text>`,
+		`>Previous hour</text>`,
+		`fill="#5470c6"`,
+		`fill="#aaaaaa"`,
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("renderSVG() does not contain %q:\n%s", expected, got)
+		}
+	}
+	// Two stacked areas plus three legend squares
+	if count := strings.Count(got, "<polygon "); count != 5 {
+		t.Errorf("renderSVG() contains %d polygons, expected 5", count)
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	primitives := buildLineChart(testLineChartOutput(), "l3bps", "Traffic", 800, 400)
+	var buf bytes.Buffer
+	if err := renderPNG(primitives, 800, 400, &buf); err != nil {
+		t.Fatalf("renderPNG() error:\n%+v", err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("png.Decode() error:\n%+v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 800 || size.Y != 400 {
+		t.Fatalf("renderPNG() size is %v, expected 800x400", size)
+	}
+	// Find the first stacked area just above the X axis, in the middle of the
+	// graph.
+	found := false
+	for y := 300; y > 100; y-- {
+		r, g, b, _ := img.At(400, y).RGBA()
+		if uint8(r>>8) == chartPalette[0].R && uint8(g>>8) == chartPalette[0].G && uint8(b>>8) == chartPalette[0].B {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Error("renderPNG() does not contain the first stacked area")
+	}
+}
+
+func TestGraphLineRenderHandler(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+	base := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	expectedSQL := []struct {
+		Axis       uint8     `ch:"axis"`
+		Time       time.Time `ch:"time"`
+		Xps        float64   `ch:"xps"`
+		Dimensions []string  `ch:"dimensions"`
+	}{
+		{1, base, 1000, []string{"router1"}},
+		{1, base, 500, []string{"Other"}},
+		{1, base.Add(time.Minute), 2000, []string{"router1"}},
+		{1, base.Add(time.Minute), 500, []string{"Other"}},
+	}
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, expectedSQL).
+		Return(nil)
+
+	request := gin.H{
+		"start":      time.Date(2022, 4, 10, 15, 45, 10, 0, time.UTC),
+		"end":        time.Date(2022, 4, 11, 15, 45, 10, 0, time.UTC),
+		"points":     100,
+		"limit":      10,
+		"dimensions": []string{"ExporterName"},
+		"units":      "l3bps",
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "SVG",
+			URL:         "/api/v0/console/graph/line/render",
+			ContentType: "image/svg+xml",
+			JSONInput: gin.H{
+				"format":  "svg",
+				"width":   600,
+				"height":  300,
+				"request": request,
+			},
+			FirstLines: []string{
+				`<svg xmlns="http://www.w3.org/2000/svg" width="600" height="300" viewBox="0 0 600 300">`,
+				`<rect width="100%" height="100%" fill="#ffffff"/>`,
+			},
+		}, {
+			Description: "invalid format",
+			URL:         "/api/v0/console/graph/line/render",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"format":  "gif",
+				"request": request,
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'graphRenderHandlerInput.Format' Error:Field validation for 'Format' failed on the 'oneof' tag",
+			},
+		}, {
+			Description: "invalid request",
+			URL:         "/api/v0/console/graph/line/render",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"format":  "png",
+				"request": gin.H{"units": "l3bps"},
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'graphLineHandlerInput.graphCommonHandlerInput.Start' Error:Field validation for 'Start' failed on the 'required' tag\nKey: 'graphLineHandlerInput.graphCommonHandlerInput.End' Error:Field validation for 'End' failed on the 'required' tag\nKey: 'graphLineHandlerInput.graphCommonHandlerInput.Limit' Error:Field validation for 'Limit' failed on the 'min' tag\nKey: 'graphLineHandlerInput.Points' Error:Field validation for 'Points' failed on the 'required' tag",
+			},
+		},
+	})
+}
@@ -0,0 +1,376 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	stdcontext "context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+	"akvorado/console/query"
+)
+
+// defaultReportPoints is the number of points used for a scheduled report
+// when not specified.
+const defaultReportPoints = 100
+
+// maxReportCatchUp is the maximum period to check for missed schedules.
+const maxReportCatchUp = 24 * time.Hour
+
+// scheduledReportInput builds the line graph input for the provided
+// scheduled report ending at the provided time.
+func (c *Component) scheduledReportInput(report database.ScheduledReport, now time.Time) (graphLineHandlerInput, error) {
+	input := graphLineHandlerInput{graphCommonHandlerInput: graphCommonHandlerInput{schema: c.d.Schema}}
+	if err := json.Unmarshal([]byte(report.Content), &input); err != nil {
+		return input, fmt.Errorf("cannot parse content: %w", err)
+	}
+	input.Start = now.Add(-time.Duration(report.Range) * time.Second)
+	input.End = now
+	if input.Points == 0 {
+		input.Points = defaultReportPoints
+	}
+	if err := binding.Validator.ValidateStruct(&input); err != nil {
+		return input, err
+	}
+	if err := query.Columns(input.Dimensions).Validate(input.schema); err != nil {
+		return input, err
+	}
+	if err := input.Filter.Validate(input.schema); err != nil {
+		return input, err
+	}
+	if err := input.validateRatio(); err != nil {
+		return input, err
+	}
+	if err := input.validateSites(); err != nil {
+		return input, err
+	}
+	if input.Limit > c.config.DimensionsLimit {
+		return input, fmt.Errorf("limit is set beyond maximum value (%d)", c.config.DimensionsLimit)
+	}
+	return input, nil
+}
+
+// validateScheduledReport checks the schedule, the content and the channel of
+// a scheduled report. It returns an HTTP status code with the error.
+func (c *Component) validateScheduledReport(gc *gin.Context, report database.ScheduledReport) (int, error) {
+	if _, err := parseCron(report.Schedule); err != nil {
+		return http.StatusBadRequest, err
+	}
+	channel, err := url.Parse(report.Channel)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	switch channel.Scheme {
+	case "http", "https":
+	case "mailto":
+		if c.config.ReportSMTP.Server == "" {
+			return http.StatusBadRequest, errors.New("no SMTP server configured to send reports by email")
+		}
+	default:
+		return http.StatusBadRequest, fmt.Errorf("unsupported channel scheme %q", channel.Scheme)
+	}
+	input, err := c.scheduledReportInput(report, c.d.Clock.Now())
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	restricted := c.restrictedColumns(gc)
+	if err := input.applyColumnAccess(restricted); err != nil {
+		return http.StatusForbidden, err
+	}
+	if input.Ratio != nil {
+		for _, qf := range []query.Filter{input.Ratio.Numerator, input.Ratio.Denominator} {
+			if err := checkFilterAccess(c.d.Schema, restricted, qf); err != nil {
+				return http.StatusForbidden, err
+			}
+		}
+	}
+	return http.StatusOK, nil
+}
+
+func (c *Component) scheduledReportListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	reports, err := c.d.Database.ListScheduledReports(ctx, user)
+	if err != nil {
+		c.r.Err(err).Msg("unable to list scheduled reports")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list scheduled reports"})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"reports": reports})
+}
+
+func (c *Component) scheduledReportAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var report database.ScheduledReport
+	if err := gc.ShouldBindJSON(&report); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if status, err := c.validateScheduledReport(gc, report); err != nil {
+		gc.JSON(status, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	report.User = user
+	id, err := c.d.Database.CreateScheduledReport(ctx, report)
+	if err != nil {
+		c.r.Err(err).Msg("cannot create scheduled report")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new scheduled report"})
+		return
+	}
+	gc.JSON(http.StatusCreated, gin.H{"id": id})
+}
+
+func (c *Component) scheduledReportUpdateHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	var report database.ScheduledReport
+	if err := gc.ShouldBindJSON(&report); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if status, err := c.validateScheduledReport(gc, report); err != nil {
+		gc.JSON(status, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	report.ID = id
+	report.User = user
+	if err := c.d.Database.UpdateScheduledReport(ctx, report); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "scheduled report not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) scheduledReportDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteScheduledReport(ctx, database.ScheduledReport{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "scheduled report not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) scheduledReportRunHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	report, err := c.d.Database.GetScheduledReport(ctx, id, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "scheduled report not found"})
+		return
+	}
+	if err := c.runScheduledReport(ctx, report, c.d.Clock.Now()); err != nil {
+		gc.JSON(http.StatusBadGateway, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+// checkScheduledReports runs the enabled scheduled reports whose schedule
+// matches a minute since the last check.
+func (c *Component) checkScheduledReports(ctx stdcontext.Context) {
+	now := c.d.Clock.Now().Truncate(time.Minute)
+	last := c.reportsLastCheck
+	c.reportsLastCheck = now
+	if last.IsZero() || !now.After(last) {
+		return
+	}
+	if now.Sub(last) > maxReportCatchUp {
+		last = now.Add(-maxReportCatchUp)
+	}
+	reports, err := c.d.Database.ListScheduledReports(ctx, "")
+	if err != nil {
+		c.r.Err(err).Msg("unable to list scheduled reports")
+		c.metrics.reportErrors.WithLabelValues("database").Inc()
+		return
+	}
+	for _, report := range reports {
+		if !report.Enabled {
+			continue
+		}
+		schedule, err := parseCron(report.Schedule)
+		if err != nil {
+			c.r.Err(err).Uint64("report", report.ID).Msg("invalid scheduled report")
+			c.metrics.reportErrors.WithLabelValues("query").Inc()
+			continue
+		}
+		for t := last.Add(time.Minute); !t.After(now); t = t.Add(time.Minute) {
+			if schedule.matches(t) {
+				if err := c.runScheduledReport(ctx, report, now); err != nil {
+					c.r.Err(err).Uint64("report", report.ID).Msg("cannot run scheduled report")
+				}
+				break
+			}
+		}
+	}
+}
+
+// runScheduledReport renders the provided scheduled report as CSV and sends
+// it to its channel.
+func (c *Component) runScheduledReport(ctx stdcontext.Context, report database.ScheduledReport, now time.Time) error {
+	input, err := c.scheduledReportInput(report, now)
+	if err != nil {
+		c.metrics.reportErrors.WithLabelValues("query").Inc()
+		return err
+	}
+	sqlQuery := c.finalizeQuery(input.toSQL())
+	output, err := c.computeGraphLine(ctx, input, sqlQuery)
+	if err != nil {
+		c.r.Err(err).Str("query", sqlQuery).Msg("unable to query database")
+		c.metrics.reportErrors.WithLabelValues("query").Inc()
+		return errors.New("unable to query database")
+	}
+	content := renderReportCSV(input, output)
+	channel, err := c.deliverReport(ctx, report, now, content)
+	if err != nil {
+		c.metrics.reportErrors.WithLabelValues("delivery").Inc()
+		return fmt.Errorf("cannot deliver report: %w", err)
+	}
+	c.metrics.reportDeliveries.WithLabelValues(channel).Inc()
+	return nil
+}
+
+// renderReportCSV renders the output of a line graph as CSV. There is one
+// line for each row with its statistics.
+func renderReportCSV(input graphLineHandlerInput, output graphLineHandlerOutput) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	header := []string{}
+	for _, qc := range input.Dimensions {
+		header = append(header, qc.String())
+	}
+	header = append(header, "axis", "average", "min", "max", "95th")
+	w.Write(header)
+	for idx, row := range output.Rows {
+		line := append([]string{}, row...)
+		line = append(line,
+			output.AxisNames[output.Axis[idx]],
+			strconv.Itoa(output.Average[idx]),
+			strconv.Itoa(output.Min[idx]),
+			strconv.Itoa(output.Max[idx]),
+			strconv.Itoa(output.NinetyFivePercentile[idx]))
+		w.Write(line)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+// reportFilename returns the name of the file attached to a report.
+func reportFilename(report database.ScheduledReport, now time.Time) string {
+	return fmt.Sprintf("akvorado-report-%d-%s.csv", report.ID, now.UTC().Format("20060102T1504Z"))
+}
+
+// deliverReport sends the report to its channel and returns the kind of
+// channel used.
+func (c *Component) deliverReport(ctx stdcontext.Context, report database.ScheduledReport, now time.Time, content []byte) (string, error) {
+	channel, err := url.Parse(report.Channel)
+	if err != nil {
+		return "", err
+	}
+	switch channel.Scheme {
+	case "http", "https":
+		ctx, cancel := stdcontext.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, report.Channel, bytes.NewReader(content))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s"`, reportFilename(report, now)))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		return "webhook", nil
+	case "mailto":
+		config := c.config.ReportSMTP
+		if config.Server == "" {
+			return "", errors.New("no SMTP server configured")
+		}
+		recipients := strings.Split(channel.Opaque, ",")
+		message := buildReportEmail(config.From, recipients, report, now, content)
+		var auth smtp.Auth
+		if config.Username != "" {
+			host, _, _ := net.SplitHostPort(config.Server)
+			auth = smtp.PlainAuth("", config.Username, config.Password, host)
+		}
+		if err := smtp.SendMail(config.Server, auth, config.From, recipients, message); err != nil {
+			return "", err
+		}
+		return "email", nil
+	default:
+		return "", fmt.Errorf("unsupported channel scheme %q", channel.Scheme)
+	}
+}
+
+// buildReportEmail builds an email with the report attached.
+func buildReportEmail(from string, to []string, report database.ScheduledReport, now time.Time, content []byte) []byte {
+	boundary := fmt.Sprintf("akvorado-%d-%d", report.ID, now.Unix())
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: [Akvorado] %s\r\n", report.Description)
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&buf, "Report %q for the last %s is attached.\r\n\r\n",
+		report.Description, time.Duration(report.Range)*time.Second)
+	fmt.Fprintf(&buf, "--%s\r\n", boundary)
+	fmt.Fprintf(&buf, "Content-Type: text/csv\r\n")
+	fmt.Fprintf(&buf, "Content-Transfer-Encoding: base64\r\n")
+	fmt.Fprintf(&buf, "Content-Disposition: attachment; filename=%q\r\n\r\n", reportFilename(report, now))
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		fmt.Fprintf(&buf, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(&buf, "%s\r\n", encoded)
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
@@ -0,0 +1,273 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	stdcontext "context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/console/database"
+)
+
+func TestScheduledReportHandlers(t *testing.T) {
+	_, h, _, _ := NewMock(t, DefaultConfiguration())
+
+	report := gin.H{
+		"description": "Daily top AS",
+		"enabled":     true,
+		"schedule":    "0 8 * * *",
+		"range":       86400,
+		"content":     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+		"channel":     "https://hooks.example.com/reports",
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no reports",
+			URL:         "/api/v0/console/scheduled-reports",
+			JSONOutput:  gin.H{"reports": []gin.H{}},
+		}, {
+			Description: "create report",
+			URL:         "/api/v0/console/scheduled-reports",
+			StatusCode:  201,
+			JSONInput:   report,
+			JSONOutput:  gin.H{"id": 1},
+		}, {
+			Description: "create report with invalid schedule",
+			URL:         "/api/v0/console/scheduled-reports",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"schedule":    "0 8 * *",
+				"range":       86400,
+				"content":     `{"limit": 10, "units": "l3bps"}`,
+				"channel":     "https://hooks.example.com/reports",
+			},
+			JSONOutput: gin.H{"message": `Expected 5 fields in cron expression "0 8 * *", got 4`},
+		}, {
+			Description: "create report with invalid dimension",
+			URL:         "/api/v0/console/scheduled-reports",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"schedule":    "0 8 * * *",
+				"range":       86400,
+				"content":     `{"dimensions": ["nope"], "limit": 10, "units": "l3bps"}`,
+				"channel":     "https://hooks.example.com/reports",
+			},
+			JSONOutput: gin.H{"message": `Unknown column name nope`},
+		}, {
+			Description: "create report sent by email without SMTP server",
+			URL:         "/api/v0/console/scheduled-reports",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid",
+				"schedule":    "0 8 * * *",
+				"range":       86400,
+				"content":     `{"limit": 10, "units": "l3bps"}`,
+				"channel":     "mailto:noc@example.com",
+			},
+			JSONOutput: gin.H{"message": `No SMTP server configured to send reports by email`},
+		}, {
+			Description: "list reports",
+			URL:         "/api/v0/console/scheduled-reports",
+			JSONOutput: gin.H{"reports": []gin.H{
+				{
+					"id":          1,
+					"user":        "__default",
+					"description": "Daily top AS",
+					"enabled":     true,
+					"schedule":    "0 8 * * *",
+					"range":       86400,
+					"content":     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+					"channel":     "https://hooks.example.com/reports",
+				},
+			}},
+		}, {
+			Description: "update report",
+			Method:      "PUT",
+			URL:         "/api/v0/console/scheduled-reports/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+			JSONInput: gin.H{
+				"description": "Weekly top AS",
+				"enabled":     false,
+				"schedule":    "0 8 * * 1",
+				"range":       7 * 86400,
+				"content":     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+				"channel":     "https://hooks.example.com/reports",
+			},
+		}, {
+			Description: "update missing report",
+			Method:      "PUT",
+			URL:         "/api/v0/console/scheduled-reports/2",
+			StatusCode:  404,
+			JSONInput:   report,
+			JSONOutput:  gin.H{"message": "scheduled report not found"},
+		}, {
+			Description: "run missing report",
+			URL:         "/api/v0/console/scheduled-reports/2/run",
+			StatusCode:  404,
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "scheduled report not found"},
+		}, {
+			Description: "list updated reports",
+			URL:         "/api/v0/console/scheduled-reports",
+			JSONOutput: gin.H{"reports": []gin.H{
+				{
+					"id":          1,
+					"user":        "__default",
+					"description": "Weekly top AS",
+					"enabled":     false,
+					"schedule":    "0 8 * * 1",
+					"range":       7 * 86400,
+					"content":     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+					"channel":     "https://hooks.example.com/reports",
+				},
+			}},
+		}, {
+			Description: "delete missing report",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/scheduled-reports/2",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "scheduled report not found"},
+		}, {
+			Description: "delete report",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/scheduled-reports/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list, no reports again",
+			URL:         "/api/v0/console/scheduled-reports",
+			JSONOutput:  gin.H{"reports": []gin.H{}},
+		},
+	})
+}
+
+func TestCheckScheduledReports(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AlertCheckInterval = 0
+	config.ReportCheckInterval = 0
+	c, _, mockConn, mockClock := NewMock(t, config)
+
+	type delivery struct {
+		ContentType        string
+		ContentDisposition string
+		Body               string
+	}
+	var deliveriesLock sync.Mutex
+	deliveries := []delivery{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveriesLock.Lock()
+		deliveries = append(deliveries, delivery{
+			ContentType:        r.Header.Get("Content-Type"),
+			ContentDisposition: r.Header.Get("Content-Disposition"),
+			Body:               string(body),
+		})
+		deliveriesLock.Unlock()
+	}))
+	defer server.Close()
+
+	if _, err := c.d.Database.CreateScheduledReport(stdcontext.Background(), database.ScheduledReport{
+		User:        "__default",
+		Description: "Daily top AS",
+		Enabled:     true,
+		Schedule:    "0 8 * * *",
+		Range:       86400,
+		Content:     `{"dimensions": ["SrcAS"], "limit": 10, "units": "l3bps"}`,
+		Channel:     server.URL,
+	}); err != nil {
+		t.Fatalf("CreateScheduledReport() error:\n%+v", err)
+	}
+
+	base := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	results := []struct {
+		Axis       uint8     `ch:"axis"`
+		Time       time.Time `ch:"time"`
+		Xps        float64   `ch:"xps"`
+		Dimensions []string  `ch:"dimensions"`
+	}{
+		{1, base.Add(-time.Hour), 1000, []string{"AS65000"}},
+		{1, base.Add(-time.Hour), 500, []string{"Other"}},
+		{1, base, 3000, []string{"AS65000"}},
+		{1, base, 700, []string{"Other"}},
+	}
+
+	// Nothing to run before 8:00
+	c.reportsLastCheck = base.Add(-5 * time.Minute)
+	mockClock.Set(base.Add(-time.Minute))
+	c.checkScheduledReports(stdcontext.Background())
+
+	// Run at 8:00
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, results).
+		Return(nil)
+	mockClock.Set(base.Add(90 * time.Second))
+	c.checkScheduledReports(stdcontext.Background())
+
+	// Do not run again
+	mockClock.Set(base.Add(2 * time.Minute))
+	c.checkScheduledReports(stdcontext.Background())
+
+	expected := []delivery{
+		{
+			ContentType:        "text/csv",
+			ContentDisposition: `attachment; filename="akvorado-report-1-20240411T0801Z.csv"`,
+			Body: `SrcAS,axis,average,min,max,95th
+AS65000,Direct,2000,1000,3000,2000
+Other,Direct,600,500,700,600
+`,
+		},
+	}
+	if diff := helpers.Diff(deliveries, expected); diff != "" {
+		t.Fatalf("checkScheduledReports() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := c.r.GetMetrics("akvorado_console_report_")
+	expectedMetrics := map[string]string{
+		`deliveries_total{channel="webhook"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestBuildReportEmail(t *testing.T) {
+	report := database.ScheduledReport{
+		ID:          4,
+		Description: "Daily top AS",
+		Range:       86400,
+	}
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	got := string(buildReportEmail("akvorado@example.com",
+		[]string{"noc@example.com", "peering@example.com"},
+		report, now, []byte("SrcAS,axis\nAS65000,Direct\n")))
+	for _, expected := range []string{
+		"From: akvorado@example.com\r\n",
+		"To: noc@example.com, peering@example.com\r\n",
+		"Subject: [Akvorado] Daily top AS\r\n",
+		`Content-Type: multipart/mixed; boundary="akvorado-4-1712822400"` + "\r\n",
+		`Report "Daily top AS" for the last 24h0m0s is attached.`,
+		`Content-Disposition: attachment; filename="akvorado-report-4-20240411T0800Z.csv"`,
+		base64.StdEncoding.EncodeToString([]byte("SrcAS,axis\nAS65000,Direct\n")),
+		"--akvorado-4-1712822400--\r\n",
+	} {
+		if !strings.Contains(got, expected) {
+			t.Errorf("buildReportEmail() does not contain %q:\n%s", expected, got)
+		}
+	}
+}
@@ -5,25 +5,31 @@
 package console
 
 import (
+	stdcontext "context"
+	"fmt"
 	"io/fs"
 	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
+	"golang.org/x/time/rate"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
 	"akvorado/common/httpserver"
+	"akvorado/common/leader"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/console/authentication"
 	"akvorado/console/database"
+	"akvorado/console/notifier"
 	"akvorado/console/query"
 )
 
@@ -35,10 +41,35 @@ type Component struct {
 	config Configuration
 
 	flowsTables     []flowsTable
+	flowsArchive    bool
 	flowsTablesLock sync.RWMutex
+	countries       map[string]country
+
+	// Values exceeding the threshold for each alert rule
+	alertsFiring map[uint64]map[string]firingAlert
+	// Configured notifiers for alert rules
+	notifiers map[string]*notifier.Channel
+	// Last time scheduled reports were checked
+	reportsLastCheck time.Time
+	// Charts available without authentication
+	publicCharts  []publicChart
+	publicLimiter *rate.Limiter
+	// HTTP client to query remote consoles
+	federationClient *http.Client
+	// Usage counters not saved yet
+	usage struct {
+		lock    sync.Mutex
+		counts  map[database.UsageKey]uint64
+		columns *regexp.Regexp
+	}
 
 	metrics struct {
-		clickhouseQueries *reporter.CounterVec
+		clickhouseQueries  *reporter.CounterVec
+		alertNotifications *reporter.CounterVec
+		alertErrors        *reporter.CounterVec
+		alertDropped       *reporter.CounterVec
+		reportDeliveries   *reporter.CounterVec
+		reportErrors       *reporter.CounterVec
 	}
 }
 
@@ -51,6 +82,7 @@ type Dependencies struct {
 	Auth         *authentication.Component
 	Database     *database.Component
 	Schema       *schema.Component
+	Leader       *leader.Component // optional
 }
 
 // New creates a new console component.
@@ -61,13 +93,51 @@ func New(r *reporter.Reporter, config Configuration, dependencies Dependencies)
 	if err := query.Columns(config.DefaultVisualizeOptions.Dimensions).Validate(dependencies.Schema); err != nil {
 		return nil, err
 	}
+	for _, rc := range config.RestrictedColumns {
+		for _, column := range rc.Columns {
+			qc := query.NewColumn(column)
+			if err := qc.Validate(dependencies.Schema); err != nil {
+				return nil, fmt.Errorf("invalid restricted column: %w", err)
+			}
+		}
+	}
+	for former, current := range config.RenamedColumns {
+		if column, ok := dependencies.Schema.LookupColumnByName(current); !ok || column.Disabled {
+			return nil, fmt.Errorf("unknown column name %s for renamed column %s", current, former)
+		}
+	}
+	notifiers := map[string]*notifier.Channel{}
+	for _, nc := range config.Notifiers {
+		if _, ok := notifiers[nc.Name]; ok {
+			return nil, fmt.Errorf("duplicate notifier %q", nc.Name)
+		}
+		channel, err := notifier.NewChannel(nc)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[nc.Name] = channel
+	}
+	countries, err := parseCountries()
+	if err != nil {
+		return nil, err
+	}
 	c := Component{
 		r:           r,
 		d:           &dependencies,
 		config:      config,
 		flowsTables: []flowsTable{{"flows", 0, time.Time{}}},
+		countries:   countries,
+
+		alertsFiring: map[uint64]map[string]firingAlert{},
+		notifiers:    notifiers,
+
+		federationClient: &http.Client{Timeout: config.FederationTimeout},
 	}
 
+	c.initUsage()
+	if err := c.initPublicCharts(); err != nil {
+		return nil, err
+	}
 	c.d.Daemon.Track(&c.t, "console")
 
 	c.metrics.clickhouseQueries = c.r.CounterVec(
@@ -76,6 +146,36 @@ func New(r *reporter.Reporter, config Configuration, dependencies Dependencies)
 			Help: "Number of requests to ClickHouse.",
 		}, []string{"table"},
 	)
+	c.metrics.alertNotifications = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "alert_notifications_total",
+			Help: "Number of notifications sent for alert rules.",
+		}, []string{"status"},
+	)
+	c.metrics.alertErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "alert_errors_total",
+			Help: "Number of errors while checking alert rules.",
+		}, []string{"step"},
+	)
+	c.metrics.alertDropped = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "alert_notifications_dropped_total",
+			Help: "Number of notifications dropped due to the rate limit of a notifier.",
+		}, []string{"notifier"},
+	)
+	c.metrics.reportDeliveries = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "report_deliveries_total",
+			Help: "Number of scheduled reports delivered.",
+		}, []string{"channel"},
+	)
+	c.metrics.reportErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "report_errors_total",
+			Help: "Number of errors while running scheduled reports.",
+		}, []string{"step"},
+	)
 	return &c, nil
 }
 
@@ -84,23 +184,88 @@ func (c *Component) Start() error {
 	c.r.Info().Msg("starting console component")
 
 	c.d.HTTP.AddHandler("/", http.HandlerFunc(c.assetsHandlerFunc))
-	endpoint := c.d.HTTP.GinRouter.Group("/api/v0/console", c.d.Auth.UserAuthentication())
+	auth := c.d.HTTP.GinRouter.Group("/api/v0/console/auth")
+	auth.GET("/login", c.d.Auth.LoginHandlerFunc)
+	auth.GET("/callback", c.d.Auth.CallbackHandlerFunc)
+	auth.GET("/logout", c.d.Auth.LogoutHandlerFunc)
+	if len(c.publicCharts) > 0 {
+		public := c.d.HTTP.GinRouter.Group("/api/v0/console/public")
+		public.GET("/charts", c.publicChartsListHandlerFunc)
+		public.GET("/charts/:name", c.d.HTTP.CacheByRequestPath(time.Minute), c.publicRateLimit(), c.publicChartHandlerFunc)
+	}
+	if len(c.config.ChatOps.Tokens) > 0 {
+		chatops := c.d.HTTP.GinRouter.Group("/api/v0/console/chatops")
+		chatops.POST("/command", c.chatOpsCommandHandlerFunc)
+	}
+	endpoint := c.d.HTTP.GinRouter.Group("/api/v0/console", c.d.Auth.UserAuthentication(), c.columnAccess())
+	editor := c.d.Auth.RequireRole(authentication.RoleEditor)
 	endpoint.GET("/configuration", c.configHandlerFunc)
 	endpoint.GET("/docs/:name", c.docsHandlerFunc)
 	endpoint.GET("/widget/flow-last", c.d.HTTP.CacheByRequestPath(5*time.Second), c.widgetFlowLastHandlerFunc)
 	endpoint.GET("/widget/flow-rate", c.d.HTTP.CacheByRequestPath(5*time.Second), c.widgetFlowRateHandlerFunc)
-	endpoint.GET("/widget/exporters", c.d.HTTP.CacheByRequestPath(30*time.Second), c.widgetExportersHandlerFunc)
+	endpoint.GET("/widget/exporters", c.d.HTTP.CacheByRequestURI(30*time.Second), c.widgetExportersHandlerFunc)
 	endpoint.GET("/widget/top/:name", c.d.HTTP.CacheByRequestPath(30*time.Second), c.widgetTopHandlerFunc)
 	endpoint.GET("/widget/graph", c.d.HTTP.CacheByRequestPath(5*time.Minute), c.widgetGraphHandlerFunc)
 	endpoint.POST("/graph/line", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphLineHandlerFunc)
+	endpoint.POST("/graph/line/render", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphLineRenderHandlerFunc)
 	endpoint.POST("/graph/sankey", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphSankeyHandlerFunc)
+	endpoint.POST("/graph/drilldown", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphDrilldownHandlerFunc)
+	endpoint.POST("/graph/map", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphMapHandlerFunc)
+	endpoint.POST("/graph/explain", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphExplainHandlerFunc)
+	endpoint.POST("/graph/heatmap", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.graphHeatmapHandlerFunc)
+	endpoint.POST("/costs", c.d.HTTP.CacheByRequestBody(c.config.CacheTTL), c.costsHandlerFunc)
+	if len(c.config.Federation) > 0 {
+		endpoint.POST("/federation/graph/line", c.federationLineHandlerFunc)
+		endpoint.POST("/federation/graph/sankey", c.federationSankeyHandlerFunc)
+	}
+	endpoint.POST("/flows", c.flowsHandlerFunc)
 	endpoint.POST("/filter/validate", c.filterValidateHandlerFunc)
+	endpoint.POST("/filter/rewrite", c.filterRewriteHandlerFunc)
 	endpoint.POST("/filter/complete", c.d.HTTP.CacheByRequestBody(time.Minute), c.filterCompleteHandlerFunc)
 	endpoint.GET("/filter/saved", c.filterSavedListHandlerFunc)
-	endpoint.DELETE("/filter/saved/:id", c.filterSavedDeleteHandlerFunc)
-	endpoint.POST("/filter/saved", c.filterSavedAddHandlerFunc)
+	endpoint.DELETE("/filter/saved/:id", editor, c.filterSavedDeleteHandlerFunc)
+	endpoint.POST("/filter/saved", editor, c.filterSavedAddHandlerFunc)
+	endpoint.PUT("/filter/saved/:id", editor, c.filterSavedUpdateHandlerFunc)
+	endpoint.GET("/query/saved", c.querySavedListHandlerFunc)
+	endpoint.DELETE("/query/saved/:id", editor, c.querySavedDeleteHandlerFunc)
+	endpoint.POST("/query/saved", editor, c.querySavedAddHandlerFunc)
+	endpoint.POST("/query/saved/:id/execute", c.querySavedExecuteHandlerFunc)
+	endpoint.GET("/annotations", c.annotationListHandlerFunc)
+	endpoint.GET("/probes", c.probesHandlerFunc)
+	endpoint.DELETE("/annotations/:id", editor, c.annotationDeleteHandlerFunc)
+	endpoint.POST("/annotations", editor, c.annotationAddHandlerFunc)
+	endpoint.GET("/snapshots", c.snapshotListHandlerFunc)
+	endpoint.GET("/snapshots/:id", c.snapshotGetHandlerFunc)
+	endpoint.DELETE("/snapshots/:id", editor, c.snapshotDeleteHandlerFunc)
+	endpoint.POST("/snapshots", editor, c.snapshotAddHandlerFunc)
+	endpoint.GET("/dashboards", c.dashboardListHandlerFunc)
+	endpoint.GET("/dashboards/:id", c.dashboardGetHandlerFunc)
+	endpoint.DELETE("/dashboards/:id", editor, c.dashboardDeleteHandlerFunc)
+	endpoint.POST("/dashboards", editor, c.dashboardAddHandlerFunc)
+	endpoint.POST("/dashboards/:id/queries/:query/execute", c.dashboardExecuteHandlerFunc)
+	endpoint.GET("/alert-rules", c.alertRuleListHandlerFunc)
+	endpoint.POST("/alert-rules", editor, c.alertRuleAddHandlerFunc)
+	endpoint.PUT("/alert-rules/:id", editor, c.alertRuleUpdateHandlerFunc)
+	endpoint.DELETE("/alert-rules/:id", editor, c.alertRuleDeleteHandlerFunc)
+	endpoint.GET("/notifiers", c.notifierListHandlerFunc)
+	endpoint.GET("/scheduled-reports", c.scheduledReportListHandlerFunc)
+	endpoint.POST("/scheduled-reports", editor, c.scheduledReportAddHandlerFunc)
+	endpoint.PUT("/scheduled-reports/:id", editor, c.scheduledReportUpdateHandlerFunc)
+	endpoint.DELETE("/scheduled-reports/:id", editor, c.scheduledReportDeleteHandlerFunc)
+	endpoint.POST("/scheduled-reports/:id/run", editor, c.scheduledReportRunHandlerFunc)
 	endpoint.GET("/user/info", c.d.Auth.UserInfoHandlerFunc)
 	endpoint.GET("/user/avatar", c.d.Auth.UserAvatarHandlerFunc)
+	endpoint.GET("/admin/query-advisor", c.adminAccess(), c.queryAdvisorHandlerFunc)
+	endpoint.GET("/admin/saved/export", c.adminAccess(), c.savedExportHandlerFunc)
+	endpoint.POST("/admin/saved/import", c.adminAccess(), c.savedImportHandlerFunc)
+	endpoint.POST("/admin/notifiers/:name/test", c.adminAccess(), c.notifierTestHandlerFunc)
+	endpoint.GET("/admin/owners", c.adminAccess(), c.ownersListHandlerFunc)
+	endpoint.POST("/admin/owners/transfer", c.adminAccess(), c.ownersTransferHandlerFunc)
+	endpoint.POST("/admin/owners/orphans", c.adminAccess(), c.ownersOrphansHandlerFunc)
+	endpoint.POST("/admin/owners/orphans/purge", c.adminAccess(), c.ownersPurgeOrphansHandlerFunc)
+	endpoint.GET("/admin/usage", c.adminAccess(), c.usageHandlerFunc)
+	endpoint.GET("/admin/sessions", c.adminAccess(), c.d.Auth.SessionsListHandlerFunc)
+	endpoint.DELETE("/admin/sessions/:id", c.adminAccess(), c.d.Auth.SessionsRevokeHandlerFunc)
 
 	c.t.Go(func() error {
 		ticker := time.NewTicker(10 * time.Second)
@@ -119,9 +284,72 @@ func (c *Component) Start() error {
 			}
 		}
 	})
+
+	if c.config.AlertCheckInterval > 0 {
+		c.t.Go(func() error {
+			ticker := c.d.Clock.Ticker(c.config.AlertCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if c.isLeader() {
+						c.checkAlertRules(c.t.Context(nil))
+					}
+				case <-c.t.Dying():
+					return nil
+				}
+			}
+		})
+	}
+	if c.config.ReportCheckInterval > 0 {
+		c.reportsLastCheck = c.d.Clock.Now().Truncate(time.Minute)
+		c.t.Go(func() error {
+			ticker := c.d.Clock.Ticker(c.config.ReportCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if c.isLeader() {
+						c.checkScheduledReports(c.t.Context(nil))
+					} else {
+						// Reports due until now are sent by the
+						// current leader.
+						c.reportsLastCheck = c.d.Clock.Now().Truncate(time.Minute)
+					}
+				case <-c.t.Dying():
+					return nil
+				}
+			}
+		})
+	}
+	if c.config.UsageTracking {
+		c.t.Go(func() error {
+			ticker := c.d.Clock.Ticker(usageFlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					if err := c.flushUsage(c.t.Context(nil)); err != nil {
+						c.r.Err(err).Msg("cannot save usage counters")
+					}
+				case <-c.t.Dying():
+					if err := c.flushUsage(stdcontext.Background()); err != nil {
+						c.r.Err(err).Msg("cannot save usage counters")
+					}
+					return nil
+				}
+			}
+		})
+	}
 	return nil
 }
 
+// isLeader tells if this instance should run singleton jobs, like alert
+// rules or scheduled reports.
+func (c *Component) isLeader() bool {
+	return c.d.Leader == nil || c.d.Leader.IsLeader()
+}
+
 // Stop stops the console component.
 func (c *Component) Stop() error {
 	defer c.r.Info().Msg("console component stopped")
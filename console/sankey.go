@@ -103,12 +103,21 @@ func (c *Component) graphSankeyHandlerFunc(gc *gin.Context) {
 		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
 		return
 	}
+	if err := input.validateSites(); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if err := input.applyColumnAccess(c.restrictedColumns(gc)); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
 	if input.Limit > c.config.DimensionsLimit {
 		gc.JSON(http.StatusBadRequest,
 			gin.H{"message": fmt.Sprintf("Limit is set beyond maximum value (%d)",
 				c.config.DimensionsLimit)})
 		return
 	}
+	c.recordUsage("sankey", input.Dimensions, input.Filter)
 
 	sqlQuery, err := input.toSQL()
 	if err != nil {
@@ -129,15 +138,26 @@ func (c *Component) graphSankeyHandlerFunc(gc *gin.Context) {
 		return
 	}
 
-	// Prepare output
+	rows := make([][]string, 0, len(results))
+	xps := make([]int, 0, len(results))
+	for _, result := range results {
+		rows = append(rows, result.Dimensions)
+		xps = append(xps, int(result.Xps))
+	}
+	gc.JSON(http.StatusOK, buildSankeyOutput(input.Dimensions, rows, xps))
+}
+
+// buildSankeyOutput builds the output for a sankey graph from the rows and
+// their values.
+func buildSankeyOutput(dimensions []query.Column, rows [][]string, xps []int) graphSankeyHandlerOutput {
 	output := graphSankeyHandlerOutput{
-		Rows:  make([][]string, 0, len(results)),
-		Xps:   make([]int, 0, len(results)),
+		Rows:  rows,
+		Xps:   xps,
 		Nodes: make([]string, 0),
 		Links: make([]sankeyLink, 0),
 	}
 	completeName := func(name string, index int) string {
-		return fmt.Sprintf("%s: %s", input.Dimensions[index].String(), name)
+		return fmt.Sprintf("%s: %s", dimensions[index].String(), name)
 	}
 	addedNodes := map[string]struct{}{}
 	addNode := func(name string) {
@@ -155,16 +175,14 @@ func (c *Component) graphSankeyHandlerFunc(gc *gin.Context) {
 		}
 		output.Links = append(output.Links, sankeyLink{source, target, xps})
 	}
-	for _, result := range results {
-		output.Rows = append(output.Rows, result.Dimensions)
-		output.Xps = append(output.Xps, int(result.Xps))
+	for idx, row := range rows {
 		// Consider each pair of successive dimensions
-		for i := 0; i < len(input.Dimensions)-1; i++ {
-			dimension1 := completeName(result.Dimensions[i], i)
-			dimension2 := completeName(result.Dimensions[i+1], i+1)
+		for i := 0; i < len(dimensions)-1; i++ {
+			dimension1 := completeName(row[i], i)
+			dimension2 := completeName(row[i+1], i+1)
 			addNode(dimension1)
 			addNode(dimension2)
-			addLink(dimension1, dimension2, int(result.Xps))
+			addLink(dimension1, dimension2, xps[idx])
 		}
 	}
 	sort.Slice(output.Links, func(i, j int) bool {
@@ -173,6 +191,5 @@ func (c *Component) graphSankeyHandlerFunc(gc *gin.Context) {
 		}
 		return output.Links[i].Xps > output.Links[j].Xps
 	})
-
-	gc.JSON(http.StatusOK, output)
+	return output
 }
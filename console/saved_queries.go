@@ -0,0 +1,149 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+)
+
+var (
+	savedQueryParameterRegex = regexp.MustCompile(`\$([a-zA-Z_][a-zA-Z0-9_]*)`)
+	savedQueryValueRegex     = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]+$`)
+)
+
+// savedQueryExecuteHandlerInput describes the input for the
+// /query/saved/:id/execute endpoint.
+type savedQueryExecuteHandlerInput struct {
+	Parameters map[string]string `json:"parameters"`
+}
+
+// expandSavedQuery replaces the parameters in the provided content. Values
+// are restricted to a safe set of characters as they are inserted verbatim.
+func expandSavedQuery(content string, parameters map[string]string) (string, error) {
+	for name, value := range parameters {
+		if !savedQueryValueRegex.MatchString(value) {
+			return "", fmt.Errorf("invalid value for parameter %q", name)
+		}
+	}
+	var err error
+	expanded := savedQueryParameterRegex.ReplaceAllStringFunc(content, func(match string) string {
+		name := match[1:]
+		value, ok := parameters[name]
+		if !ok {
+			if err == nil {
+				err = fmt.Errorf("missing value for parameter %q", name)
+			}
+			return match
+		}
+		return value
+	})
+	if err != nil {
+		return "", err
+	}
+	return expanded, nil
+}
+
+func (c *Component) querySavedListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	params, ok := bindListParameters(gc)
+	if !ok {
+		return
+	}
+	queries, next, err := c.d.Database.ListSavedQueries(ctx, user, params.page())
+	if err != nil {
+		c.listError(gc, err, "queries")
+		return
+	}
+	listResponse(gc, params, "queries", queries, next)
+}
+
+func (c *Component) querySavedDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteSavedQuery(ctx, database.SavedQuery{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) querySavedAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var query database.SavedQuery
+	if err := gc.ShouldBindJSON(&query); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	query.User = user
+	if err := c.d.Database.CreateSavedQuery(ctx, query); err != nil {
+		c.r.Err(err).Msg("cannot create saved query")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new query"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) querySavedExecuteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	var input savedQueryExecuteHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	query, err := c.d.Database.GetSavedQuery(ctx, id, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "query not found"})
+		return
+	}
+	content, err := expandSavedQuery(query.Content, input.Parameters)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	c.recordSavedQueryUsage(id)
+	c.executeSavedQuery(gc, query.Graph, content)
+}
+
+// executeSavedQuery executes the provided expanded content of a saved query
+// with the appropriate graph handler.
+func (c *Component) executeSavedQuery(gc *gin.Context, graph string, content string) {
+	gc.Request.Body = io.NopCloser(bytes.NewBufferString(content))
+	switch graph {
+	case "line":
+		c.graphLineHandlerFunc(gc)
+	case "sankey":
+		c.graphSankeyHandlerFunc(gc)
+	default:
+		gc.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Unknown graph type %q", graph)})
+	}
+}
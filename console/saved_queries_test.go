@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestExpandSavedQuery(t *testing.T) {
+	cases := []struct {
+		Content    string
+		Parameters map[string]string
+		Expected   string
+		Error      bool
+	}{
+		{
+			Content:  `{"filter": "InIfBoundary = external"}`,
+			Expected: `{"filter": "InIfBoundary = external"}`,
+		}, {
+			Content:    `{"filter": "InIfProvider = '$provider' AND SrcAS = $asn"}`,
+			Parameters: map[string]string{"provider": "telia", "asn": "AS1299"},
+			Expected:   `{"filter": "InIfProvider = 'telia' AND SrcAS = AS1299"}`,
+		}, {
+			Content:    `{"filter": "InIfProvider = '$provider'"}`,
+			Parameters: map[string]string{"asn": "AS1299"},
+			Error:      true,
+		}, {
+			Content:    `{"filter": "InIfProvider = '$provider'"}`,
+			Parameters: map[string]string{"provider": `telia" OR 1`},
+			Error:      true,
+		},
+	}
+	for _, tc := range cases {
+		got, err := expandSavedQuery(tc.Content, tc.Parameters)
+		if err != nil && !tc.Error {
+			t.Errorf("expandSavedQuery(%q) error:\n%+v", tc.Content, err)
+		} else if err == nil && tc.Error {
+			t.Errorf("expandSavedQuery(%q) no error", tc.Content)
+		} else if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("expandSavedQuery(%q) (-got, +want):\n%s", tc.Content, diff)
+		}
+	}
+}
+
+func TestSavedQueryHandlers(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Xps        float64  `ch:"xps"`
+			Dimensions []string `ch:"dimensions"`
+		}{
+			{1000, []string{"AS1299", "router1"}},
+		}).
+		Return(nil)
+
+	content := `{
+  "start": "2022-04-10T15:45:10Z",
+  "end": "2022-04-11T15:45:10Z",
+  "dimensions": ["SrcAS", "ExporterName"],
+  "limit": 10,
+  "filter": "SrcAS = $asn",
+  "units": "l3bps"
+}`
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no queries",
+			URL:         "/api/v0/console/query/saved",
+			JSONOutput:  gin.H{"queries": []gin.H{}},
+		}, {
+			Description: "store one query",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "top exporters for an AS",
+				"graph":       "sankey",
+				"content":     content,
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store invalid query",
+			URL:         "/api/v0/console/query/saved",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid query",
+				"graph":       "pie",
+				"content":     content,
+			},
+			JSONOutput: gin.H{
+				"message": "Key: 'SavedQuery.Graph' Error:Field validation for 'Graph' failed on the 'oneof' tag",
+			},
+		}, {
+			Description: "list stored queries",
+			URL:         "/api/v0/console/query/saved",
+			JSONOutput: gin.H{"queries": []gin.H{
+				{
+					"id":          1,
+					"shared":      false,
+					"user":        "__default",
+					"description": "top exporters for an AS",
+					"graph":       "sankey",
+					"content":     content,
+				},
+			}},
+		}, {
+			Description: "execute stored query with missing parameter",
+			URL:         "/api/v0/console/query/saved/1/execute",
+			StatusCode:  400,
+			JSONInput:   gin.H{"parameters": gin.H{}},
+			JSONOutput:  gin.H{"message": `Missing value for parameter "asn"`},
+		}, {
+			Description: "execute stored query",
+			URL:         "/api/v0/console/query/saved/1/execute",
+			JSONInput:   gin.H{"parameters": gin.H{"asn": "AS1299"}},
+			JSONOutput: gin.H{
+				"rows":  [][]string{{"AS1299", "router1"}},
+				"xps":   []int{1000},
+				"nodes": []string{"SrcAS: AS1299", "ExporterName: router1"},
+				"links": []gin.H{
+					{"source": "SrcAS: AS1299", "target": "ExporterName: router1", "xps": 1000},
+				},
+			},
+		}, {
+			Description: "execute missing query",
+			URL:         "/api/v0/console/query/saved/2/execute",
+			StatusCode:  404,
+			JSONInput:   gin.H{"parameters": gin.H{}},
+			JSONOutput:  gin.H{"message": "query not found"},
+		}, {
+			Description: "delete stored query",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/query/saved/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list stored queries after delete",
+			URL:         "/api/v0/console/query/saved",
+			JSONOutput:  gin.H{"queries": []gin.H{}},
+		},
+	})
+}
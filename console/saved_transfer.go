@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"akvorado/common/helpers"
+	"akvorado/console/database"
+)
+
+type savedExportHandlerInput struct {
+	User   string `form:"user"`
+	Folder string `form:"folder"`
+}
+
+type savedImportHandlerInput struct {
+	database.SavedItems
+	// User, when not empty, becomes the owner of all the imported items.
+	User string `json:"user"`
+}
+
+// savedExportHandlerFunc exports the saved filters and saved queries of a
+// user and the saved filters of a team folder.
+func (c *Component) savedExportHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input savedExportHandlerInput
+	if err := gc.ShouldBindQuery(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if input.User == "" && input.Folder == "" {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "A user or a team folder is required."})
+		return
+	}
+	items, err := c.d.Database.ExportSavedItems(ctx, input.User, input.Folder)
+	if err != nil {
+		c.r.Err(err).Msg("cannot export saved items")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot export saved items."})
+		return
+	}
+	gc.JSON(http.StatusOK, items)
+}
+
+// savedImportHandlerFunc imports saved filters and saved queries. New IDs
+// are allocated and the mapping from the old ones is returned.
+func (c *Component) savedImportHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	var input savedImportHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	for idx := range input.Filters {
+		filter := &input.Filters[idx]
+		if input.User != "" {
+			filter.User = input.User
+		}
+		if filter.User == "" {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Saved filter without owner."})
+			return
+		}
+		if filter.Folder != "" && !slices.ContainsFunc(c.config.TeamFolders,
+			func(folder TeamFolderConfiguration) bool {
+				return folder.Name == filter.Folder
+			}) {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Unknown team folder " + filter.Folder + "."})
+			return
+		}
+	}
+	for idx := range input.Queries {
+		query := &input.Queries[idx]
+		if input.User != "" {
+			query.User = input.User
+		}
+		if query.User == "" {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Saved query without owner."})
+			return
+		}
+	}
+	mapping, err := c.d.Database.ImportSavedItems(ctx, input.SavedItems)
+	if err != nil {
+		c.r.Err(err).Msg("cannot import saved items")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot import saved items."})
+		return
+	}
+	gc.JSON(http.StatusOK, mapping)
+}
@@ -0,0 +1,177 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestSavedTransfer(t *testing.T) {
+	config := DefaultConfiguration()
+	config.AdminGroups = []string{"admins"}
+	config.TeamFolders = []TeamFolderConfiguration{
+		{Name: "NOC", Groups: []string{"noc"}},
+	}
+	_, h, _, _ := NewMock(t, config)
+	asUser := func(user, groups string) http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", user)
+		headers.Add("Remote-Groups", groups)
+		return headers
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "store filter",
+			URL:         "/api/v0/console/filter/saved",
+			Header:      asUser("marty", "noc"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "transit",
+				"content":     "OutIfConnectivity = transit",
+				"folder":      "NOC",
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "store query",
+			URL:         "/api/v0/console/query/saved",
+			Header:      asUser("marty", "noc"),
+			StatusCode:  204,
+			JSONInput: gin.H{
+				"description": "top AS",
+				"graph":       "sankey",
+				"content":     `{"dimensions": ["SrcAS"]}`,
+			},
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "export as a regular user",
+			URL:         "/api/v0/console/admin/saved/export?user=marty",
+			Header:      asUser("marty", "noc"),
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access restricted to administrators."},
+		}, {
+			Description: "export without user or folder",
+			URL:         "/api/v0/console/admin/saved/export",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "A user or a team folder is required."},
+		}, {
+			Description: "export user",
+			URL:         "/api/v0/console/admin/saved/export?user=marty",
+			Header:      asUser("alfred", "admins"),
+			JSONOutput: gin.H{
+				"filters": []gin.H{
+					{
+						"id":          1,
+						"user":        "marty",
+						"shared":      false,
+						"folder":      "NOC",
+						"owned":       false,
+						"description": "transit",
+						"content":     "OutIfConnectivity = transit",
+					},
+				},
+				"queries": []gin.H{
+					{
+						"id":          1,
+						"user":        "marty",
+						"shared":      false,
+						"description": "top AS",
+						"graph":       "sankey",
+						"content":     `{"dimensions": ["SrcAS"]}`,
+					},
+				},
+			},
+		}, {
+			Description: "export unknown folder",
+			URL:         "/api/v0/console/admin/saved/export?folder=Peering",
+			Header:      asUser("alfred", "admins"),
+			JSONOutput: gin.H{
+				"filters": []gin.H{},
+				"queries": []gin.H{},
+			},
+		}, {
+			Description: "import into an unknown folder",
+			URL:         "/api/v0/console/admin/saved/import",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"user": "judith",
+				"filters": []gin.H{
+					{
+						"id":          1,
+						"folder":      "Peering",
+						"description": "transit",
+						"content":     "OutIfConnectivity = transit",
+					},
+				},
+			},
+			JSONOutput: gin.H{"message": "Unknown team folder Peering."},
+		}, {
+			Description: "import without owner",
+			URL:         "/api/v0/console/admin/saved/import",
+			Header:      asUser("alfred", "admins"),
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"queries": []gin.H{
+					{
+						"id":          1,
+						"description": "top AS",
+						"graph":       "sankey",
+						"content":     `{"dimensions": ["SrcAS"]}`,
+					},
+				},
+			},
+			JSONOutput: gin.H{"message": "Saved query without owner."},
+		}, {
+			Description: "import for another user",
+			URL:         "/api/v0/console/admin/saved/import",
+			Header:      asUser("alfred", "admins"),
+			JSONInput: gin.H{
+				"user": "judith",
+				"filters": []gin.H{
+					{
+						"id":          1,
+						"user":        "marty",
+						"folder":      "NOC",
+						"description": "transit",
+						"content":     "OutIfConnectivity = transit",
+					},
+				},
+				"queries": []gin.H{
+					{
+						"id":          1,
+						"user":        "marty",
+						"description": "top AS",
+						"graph":       "sankey",
+						"content":     `{"dimensions": ["SrcAS"]}`,
+					},
+				},
+			},
+			JSONOutput: gin.H{
+				"filters": gin.H{"1": 2},
+				"queries": gin.H{"1": 2},
+			},
+		}, {
+			Description: "list imported queries",
+			URL:         "/api/v0/console/query/saved",
+			Header:      asUser("judith", "users"),
+			JSONOutput: gin.H{"queries": []gin.H{
+				{
+					"id":          2,
+					"user":        "judith",
+					"shared":      false,
+					"description": "top AS",
+					"graph":       "sankey",
+					"content":     `{"dimensions": ["SrcAS"]}`,
+				},
+			}},
+		},
+	})
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/console/authentication"
+	"akvorado/console/database"
+)
+
+// bufferedResponseWriter keeps the status and the body written by a handler
+// instead of sending them to the client.
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+func (w *bufferedResponseWriter) WriteHeaderNow() {}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+func (w *bufferedResponseWriter) Status() int {
+	return w.status
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.body.Len() > 0
+}
+
+func (c *Component) snapshotListHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	snapshots, err := c.d.Database.ListSnapshots(ctx, user)
+	if err != nil {
+		c.r.Err(err).Msg("unable to list snapshots")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "unable to list snapshots"})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"snapshots": snapshots})
+}
+
+func (c *Component) snapshotGetHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	snapshot, err := c.d.Database.GetSnapshot(ctx, id, user)
+	if err != nil {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "snapshot not found"})
+		return
+	}
+	// The result was computed with the restrictions of the creator of the
+	// snapshot. Refuse access if the current user is more restricted.
+	creatorRestricted := strings.Split(snapshot.RestrictedColumns, ",")
+	for _, column := range c.restrictedColumns(gc) {
+		if !slices.Contains(creatorRestricted, column) {
+			gc.JSON(http.StatusForbidden, gin.H{"message": "Access to this snapshot is restricted."})
+			return
+		}
+	}
+	gc.JSON(http.StatusOK, snapshot)
+}
+
+func (c *Component) snapshotDeleteHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	id, err := strconv.ParseUint(gc.Param("id"), 10, 64)
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "bad ID format"})
+		return
+	}
+	if err := c.d.Database.DeleteSnapshot(ctx, database.Snapshot{
+		ID:   id,
+		User: user,
+	}); err != nil {
+		// Assume this is because it is not found
+		gc.JSON(http.StatusNotFound, gin.H{"message": "snapshot not found"})
+		return
+	}
+	gc.JSON(http.StatusNoContent, nil)
+}
+
+func (c *Component) snapshotAddHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	user := gc.MustGet("user").(authentication.UserInformation).Login
+	var snapshot database.Snapshot
+	if err := gc.ShouldBindJSON(&snapshot); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	snapshot.User = user
+	snapshot.RestrictedColumns = strings.Join(c.restrictedColumns(gc), ",")
+
+	// Execute the request with the appropriate graph handler and keep its
+	// result.
+	writer := gc.Writer
+	buffered := &bufferedResponseWriter{ResponseWriter: writer, status: http.StatusOK}
+	gc.Writer = buffered
+	gc.Request.Body = io.NopCloser(bytes.NewReader(snapshot.Request))
+	switch snapshot.Graph {
+	case "line":
+		c.graphLineHandlerFunc(gc)
+	case "sankey":
+		c.graphSankeyHandlerFunc(gc)
+	}
+	gc.Writer = writer
+	if buffered.status != http.StatusOK {
+		gc.Data(buffered.status, buffered.Header().Get("Content-Type"), buffered.body.Bytes())
+		return
+	}
+	snapshot.Result = json.RawMessage(buffered.body.Bytes())
+	snapshot.CreatedAt = c.d.Clock.Now()
+
+	id, err := c.d.Database.CreateSnapshot(ctx, snapshot)
+	if err != nil {
+		c.r.Err(err).Msg("cannot create snapshot")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "cannot create new snapshot"})
+		return
+	}
+	gc.JSON(http.StatusCreated, gin.H{"id": id})
+}
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+)
+
+func TestSnapshotHandlers(t *testing.T) {
+	_, h, mockConn, _ := NewMock(t, DefaultConfiguration())
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Xps        float64  `ch:"xps"`
+			Dimensions []string `ch:"dimensions"`
+		}{
+			{1000, []string{"AS1299", "router1"}},
+		}).
+		Return(nil)
+
+	request := gin.H{
+		"start":      "2022-04-10T15:45:10Z",
+		"end":        "2022-04-11T15:45:10Z",
+		"dimensions": []string{"SrcAS", "ExporterName"},
+		"limit":      10,
+		"filter":     "DstCountry = 'FR'",
+		"units":      "l3bps",
+	}
+	result := gin.H{
+		"rows":  [][]string{{"AS1299", "router1"}},
+		"xps":   []int{1000},
+		"nodes": []string{"SrcAS: AS1299", "ExporterName: router1"},
+		"links": []gin.H{
+			{"source": "SrcAS: AS1299", "target": "ExporterName: router1", "xps": 1000},
+		},
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "list, no snapshots",
+			URL:         "/api/v0/console/snapshots",
+			JSONOutput:  gin.H{"snapshots": []gin.H{}},
+		}, {
+			Description: "snapshot one request",
+			URL:         "/api/v0/console/snapshots",
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "DDoS on 2022-04-11",
+				"graph":       "sankey",
+				"request":     request,
+			},
+			JSONOutput: gin.H{"id": 1},
+		}, {
+			Description: "snapshot an invalid request",
+			URL:         "/api/v0/console/snapshots",
+			StatusCode:  400,
+			JSONInput: gin.H{
+				"description": "invalid request",
+				"graph":       "sankey",
+				"request": gin.H{
+					"start":      "2022-04-10T15:45:10Z",
+					"end":        "2022-04-11T15:45:10Z",
+					"dimensions": []string{"SrcAS", "ExporterName"},
+					"limit":      10,
+					"filter":     "DstCountry = ",
+					"units":      "l3bps",
+				},
+			},
+			JSONOutput: gin.H{
+				"message": `Cannot parse filter: at line 1, position 13: no match found, expected: "'", "--", "/*", "\"" or [ \n\r\t]`,
+			},
+		}, {
+			Description: "get snapshot",
+			URL:         "/api/v0/console/snapshots/1",
+			JSONOutput: gin.H{
+				"id":          1,
+				"user":        "__default",
+				"shared":      false,
+				"description": "DDoS on 2022-04-11",
+				"graph":       "sankey",
+				"request":     request,
+				"result":      result,
+				"created":     "1970-01-01T00:00:00Z",
+			},
+		}, {
+			Description: "get missing snapshot",
+			URL:         "/api/v0/console/snapshots/2",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "snapshot not found"},
+		}, {
+			Description: "delete snapshot",
+			Method:      "DELETE",
+			URL:         "/api/v0/console/snapshots/1",
+			StatusCode:  204,
+			ContentType: "application/json; charset=utf-8",
+		}, {
+			Description: "list snapshots after delete",
+			URL:         "/api/v0/console/snapshots",
+			JSONOutput:  gin.H{"snapshots": []gin.H{}},
+		},
+	})
+}
+
+func TestSnapshotColumnAccess(t *testing.T) {
+	config := DefaultConfiguration()
+	config.RestrictedColumns = []RestrictedColumnsConfiguration{
+		{
+			Columns: []string{"SrcAddr", "DstAddr", "SrcPort", "EType"},
+			Groups:  []string{"privacy"},
+		},
+	}
+	_, h, mockConn, _ := NewMock(t, config)
+
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []struct {
+			Xps        float64  `ch:"xps"`
+			Dimensions []string `ch:"dimensions"`
+		}{
+			{1000, []string{"AS1299", "443"}},
+		}).
+		Return(nil)
+
+	privileged := func() http.Header {
+		headers := make(http.Header)
+		headers.Add("Remote-User", "alfred")
+		headers.Add("Remote-Groups", "butlers, privacy")
+		return headers
+	}()
+	request := gin.H{
+		"start":      "2022-04-10T15:45:10Z",
+		"end":        "2022-04-11T15:45:10Z",
+		"dimensions": []string{"SrcAS", "SrcPort"},
+		"limit":      10,
+		"units":      "l3bps",
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "shared snapshot by privileged user",
+			URL:         "/api/v0/console/snapshots",
+			Header:      privileged,
+			StatusCode:  201,
+			JSONInput: gin.H{
+				"description": "HTTPS traffic",
+				"shared":      true,
+				"graph":       "sankey",
+				"request":     request,
+			},
+			JSONOutput: gin.H{"id": 1},
+		}, {
+			Description: "get snapshot by restricted user",
+			URL:         "/api/v0/console/snapshots/1",
+			StatusCode:  403,
+			JSONOutput:  gin.H{"message": "Access to this snapshot is restricted."},
+		}, {
+			Description: "get snapshot by privileged user",
+			URL:         "/api/v0/console/snapshots/1",
+			Header:      privileged,
+			JSONOutput: gin.H{
+				"id":          1,
+				"user":        "alfred",
+				"shared":      true,
+				"description": "HTTPS traffic",
+				"graph":       "sankey",
+				"request":     request,
+				"result": gin.H{
+					"rows":  [][]string{{"AS1299", "443"}},
+					"xps":   []int{1000},
+					"nodes": []string{"SrcAS: AS1299", "SrcPort: 443"},
+					"links": []gin.H{
+						{"source": "SrcAS: AS1299", "target": "SrcPort: 443", "xps": 1000},
+					},
+				},
+				"created": "1970-01-01T00:00:00Z",
+			},
+		},
+	})
+}
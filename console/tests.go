@@ -23,17 +23,28 @@ import (
 
 // NewMock instantiantes a new authentication component
 func NewMock(t *testing.T, config Configuration) (*Component, *httpserver.Component, *mocks.MockConn, *clock.Mock) {
+	t.Helper()
+	return NewMockWithAuthentication(t, config, authentication.DefaultConfiguration())
+}
+
+// NewMockWithAuthentication instantiates a new console component with the
+// provided configuration for the authentication component.
+func NewMockWithAuthentication(t *testing.T, config Configuration, authConfig authentication.Configuration) (*Component, *httpserver.Component, *mocks.MockConn, *clock.Mock) {
 	t.Helper()
 	r := reporter.NewMock(t)
 	h := httpserver.NewMock(t, r)
 	ch, mockConn := clickhousedb.NewMock(t, r)
 	mockClock := clock.NewMock()
+	auth, err := authentication.New(r, authConfig)
+	if err != nil {
+		t.Fatalf("authentication.New() error:\n%+v", err)
+	}
 	c, err := New(r, config, Dependencies{
 		Daemon:       daemon.NewMock(t),
 		HTTP:         h,
 		ClickHouseDB: ch,
 		Clock:        mockClock,
-		Auth:         authentication.NewMock(t, r),
+		Auth:         auth,
 		Database:     database.NewMock(t, r, database.DefaultConfiguration()),
 		Schema:       schema.NewMock(t),
 	})
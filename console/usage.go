@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	stdcontext "context"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/console/database"
+	"akvorado/console/query"
+)
+
+// usageFlushInterval tells how often usage counters are saved to the
+// database.
+const usageFlushInterval = time.Minute
+
+// initUsage prepares the collection of usage counters.
+func (c *Component) initUsage() {
+	if !c.config.UsageTracking {
+		return
+	}
+	names := []string{}
+	for _, column := range c.d.Schema.Columns() {
+		if !column.Disabled {
+			names = append(names, regexp.QuoteMeta(column.Name))
+		}
+	}
+	c.usage.columns = regexp.MustCompile(`\b(?:` + strings.Join(names, "|") + `)\b`)
+	c.usage.counts = map[database.UsageKey]uint64{}
+}
+
+// recordUsage records the use of a graph with the provided dimensions and
+// filters. Users are not recorded.
+func (c *Component) recordUsage(graph string, dimensions []query.Column, filters ...query.Filter) {
+	if !c.config.UsageTracking {
+		return
+	}
+	c.usage.lock.Lock()
+	defer c.usage.lock.Unlock()
+	c.usage.counts[database.UsageKey{Kind: "graph", Name: graph}]++
+	for _, dimension := range dimensions {
+		c.usage.counts[database.UsageKey{Kind: "dimension", Name: dimension.String()}]++
+	}
+	for _, filter := range filters {
+		// Each column is only counted once per filter
+		columns := c.usage.columns.FindAllString(filter.Direct(), -1)
+		slices.Sort(columns)
+		for _, column := range slices.Compact(columns) {
+			c.usage.counts[database.UsageKey{Kind: "filter", Name: column}]++
+		}
+	}
+}
+
+// recordSavedQueryUsage records the execution of a saved query.
+func (c *Component) recordSavedQueryUsage(id uint64) {
+	if !c.config.UsageTracking {
+		return
+	}
+	c.usage.lock.Lock()
+	defer c.usage.lock.Unlock()
+	c.usage.counts[database.UsageKey{Kind: "saved-query", Name: strconv.FormatUint(id, 10)}]++
+}
+
+// flushUsage saves the usage counters to the database and removes the
+// expired ones.
+func (c *Component) flushUsage(ctx stdcontext.Context) error {
+	c.usage.lock.Lock()
+	counts := c.usage.counts
+	c.usage.counts = map[database.UsageKey]uint64{}
+	c.usage.lock.Unlock()
+
+	now := c.d.Clock.Now()
+	if err := c.d.Database.IncrementUsage(ctx, now, counts); err != nil {
+		// Put back the counters to not lose them
+		c.usage.lock.Lock()
+		for key, count := range counts {
+			c.usage.counts[key] += count
+		}
+		c.usage.lock.Unlock()
+		return err
+	}
+	return c.d.Database.DeleteUsageBefore(ctx, now.Add(-c.config.UsageRetention))
+}
+
+// usageHandlerFunc reports how the console was used.
+func (c *Component) usageHandlerFunc(gc *gin.Context) {
+	ctx := c.t.Context(gc.Request.Context())
+	if !c.config.UsageTracking {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Usage tracking is not enabled."})
+		return
+	}
+	since, err := time.ParseDuration(gc.DefaultQuery("since", "720h"))
+	if err != nil || since <= 0 {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid since parameter."})
+		return
+	}
+	if err := c.flushUsage(ctx); err != nil {
+		c.r.Err(err).Msg("cannot save usage counters")
+	}
+	usage, err := c.d.Database.ListUsage(ctx, c.d.Clock.Now().Add(-since))
+	if err != nil {
+		c.r.Err(err).Msg("cannot list usage counters")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to get usage counters."})
+		return
+	}
+
+	// Columns never used as a dimension or in a filter
+	unused := []string{}
+	for _, column := range c.d.Schema.Columns() {
+		if column.Disabled || column.ConsoleNotDimension {
+			continue
+		}
+		used := func(counter database.UsageCounter) bool { return counter.Name == column.Name }
+		if slices.ContainsFunc(usage["dimension"], used) || slices.ContainsFunc(usage["filter"], used) {
+			continue
+		}
+		unused = append(unused, column.Name)
+	}
+
+	output := gin.H{"unused-columns": unused}
+	for kind, key := range map[string]string{
+		"graph":       "graphs",
+		"dimension":   "dimensions",
+		"filter":      "filters",
+		"saved-query": "saved-queries",
+	} {
+		counters := usage[kind]
+		if counters == nil {
+			counters = []database.UsageCounter{}
+		}
+		output[key] = counters
+	}
+	gc.JSON(http.StatusOK, output)
+}
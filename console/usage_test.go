@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package console
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/helpers"
+	"akvorado/console/query"
+)
+
+func TestUsageDisabled(t *testing.T) {
+	c, h, _, _ := NewMock(t, DefaultConfiguration())
+	filter := query.NewFilter("InIfBoundary = external")
+	if err := filter.Validate(c.d.Schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	c.recordUsage("line", []query.Column{query.NewColumn("SrcAS")}, filter)
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:        "/api/v0/console/admin/usage",
+			StatusCode: 404,
+			JSONOutput: gin.H{"message": "Usage tracking is not enabled."},
+		},
+	})
+}
+
+func TestUsage(t *testing.T) {
+	config := DefaultConfiguration()
+	config.UsageTracking = true
+	c, h, mockConn, mockClock := NewMock(t, config)
+	mockClock.Set(time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC))
+
+	// Record usage through the sankey graph
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil)
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/graph/sankey",
+			JSONInput: gin.H{
+				"start":      time.Date(2024, 5, 10, 14, 0, 0, 0, time.UTC),
+				"end":        time.Date(2024, 5, 10, 15, 0, 0, 0, time.UTC),
+				"dimensions": []string{"SrcAS", "InIfProvider"},
+				"limit":      10,
+				"filter":     "InIfBoundary = external AND SrcAS = 64501",
+				"units":      "l3bps",
+			},
+			JSONOutput: gin.H{"rows": []string{}, "xps": []int{}, "nodes": []string{}, "links": []string{}},
+		},
+	})
+
+	// Record usage directly
+	filter := query.NewFilter("InIfBoundary = external")
+	if err := filter.Validate(c.d.Schema); err != nil {
+		t.Fatalf("Validate() error:\n%+v", err)
+	}
+	c.recordUsage("line", []query.Column{query.NewColumn("SrcAS")}, filter)
+	c.recordSavedQueryUsage(4)
+
+	unused := []string{}
+	for _, column := range c.d.Schema.Columns() {
+		if column.Disabled || column.ConsoleNotDimension {
+			continue
+		}
+		switch column.Name {
+		case "SrcAS", "InIfProvider", "InIfBoundary":
+		default:
+			unused = append(unused, column.Name)
+		}
+	}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/console/admin/usage",
+			JSONOutput: gin.H{
+				"graphs": []gin.H{
+					{"name": "line", "count": 1},
+					{"name": "sankey", "count": 1},
+				},
+				"dimensions": []gin.H{
+					{"name": "SrcAS", "count": 2},
+					{"name": "InIfProvider", "count": 1},
+				},
+				"filters": []gin.H{
+					{"name": "InIfBoundary", "count": 2},
+					{"name": "SrcAS", "count": 1},
+				},
+				"saved-queries": []gin.H{
+					{"name": "4", "count": 1},
+				},
+				"unused-columns": unused,
+			},
+		},
+	})
+}
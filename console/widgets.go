@@ -4,6 +4,7 @@
 package console
 
 import (
+	"encoding/base64"
 	"fmt"
 	"net/http"
 	"reflect"
@@ -104,25 +105,50 @@ func (c *Component) widgetFlowRateHandlerFunc(gc *gin.Context) {
 
 func (c *Component) widgetExportersHandlerFunc(gc *gin.Context) {
 	ctx := c.t.Context(gc.Request.Context())
-	query := `SELECT ExporterName FROM exporters GROUP BY ExporterName ORDER BY ExporterName`
+	params, ok := bindListParameters(gc)
+	if !ok {
+		return
+	}
+	after := ""
+	if params.Cursor != "" {
+		decoded, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor."})
+			return
+		}
+		after = string(decoded)
+	}
+	query := `SELECT ExporterName FROM exporters WHERE ExporterName > $1 GROUP BY ExporterName ORDER BY ExporterName`
+	if params.Limit > 0 {
+		query = fmt.Sprintf("%s LIMIT %d", query, params.Limit+1)
+	}
 	gc.Header("X-SQL-Query", query)
 	// Do not increase counter for this one.
 
 	exporters := []struct {
 		ExporterName string
 	}{}
-	err := c.d.ClickHouseDB.Conn.Select(ctx, &exporters, query)
+	err := c.d.ClickHouseDB.Conn.Select(ctx, &exporters, query, after)
 	if err != nil {
 		c.r.Err(err).Msg("unable to query database")
 		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Unable to query database."})
 		return
 	}
+	next := ""
+	if params.Limit > 0 && len(exporters) > params.Limit {
+		exporters = exporters[:params.Limit]
+		next = base64.RawURLEncoding.EncodeToString([]byte(exporters[len(exporters)-1].ExporterName))
+	}
 	exporterList := make([]string, len(exporters))
 	for idx, exporter := range exporters {
 		exporterList[idx] = exporter.ExporterName
 	}
 
-	gc.IndentedJSON(http.StatusOK, gin.H{"exporters": exporterList})
+	response := gin.H{"exporters": exporterList}
+	if next != "" {
+		response["next"] = next
+	}
+	gc.IndentedJSON(http.StatusOK, response)
 }
 
 type topResult struct {
@@ -166,14 +192,20 @@ func (c *Component) widgetTopHandlerFunc(gc *gin.Context) {
 		selector = `if(equals(EType, 34525), 'IPv6', if(equals(EType, 2048), 'IPv4', '???'))`
 		groupby = `EType`
 	case "src-port":
-		selector = `concat(dictGetOrDefault('protocols', 'name', Proto, '???'), '/', toString(SrcPort))`
+		selector = `concat(dictGetOrDefault('protocols', 'name', Proto, '???'), '/', toString(SrcPort), ` +
+			`if(dictHas('ports', tuple(Proto, SrcPort)), concat(': ', dictGet('ports', 'name', tuple(Proto, SrcPort))), ''))`
 		groupby = `Proto, SrcPort`
 		mainTableRequired = true
 	case "dst-port":
-		selector = `concat(dictGetOrDefault('protocols', 'name', Proto, '???'), '/', toString(DstPort))`
+		selector = `concat(dictGetOrDefault('protocols', 'name', Proto, '???'), '/', toString(DstPort), ` +
+			`if(dictHas('ports', tuple(Proto, DstPort)), concat(': ', dictGet('ports', 'name', tuple(Proto, DstPort))), ''))`
 		groupby = `Proto, DstPort`
 		mainTableRequired = true
 	}
+	if err := checkExpressionAccess(c.d.Schema, c.restrictedColumns(gc), selector, groupby); err != nil {
+		gc.JSON(http.StatusForbidden, gin.H{"message": "Access to this widget is restricted."})
+		return
+	}
 	if groupby == "" {
 		groupby = selector
 	}
@@ -134,11 +134,26 @@ func TestWidgetExporters(t *testing.T) {
 		{"exporter2"},
 		{"exporter3"},
 	}
-	mockConn.EXPECT().
-		Select(gomock.Any(), gomock.Any(),
-			`SELECT ExporterName FROM exporters GROUP BY ExporterName ORDER BY ExporterName`).
-		SetArg(1, expected).
-		Return(nil)
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(),
+				`SELECT ExporterName FROM exporters WHERE ExporterName > $1 GROUP BY ExporterName ORDER BY ExporterName`,
+				"").
+			SetArg(1, expected).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(),
+				`SELECT ExporterName FROM exporters WHERE ExporterName > $1 GROUP BY ExporterName ORDER BY ExporterName LIMIT 3`,
+				"").
+			SetArg(1, expected).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(),
+				`SELECT ExporterName FROM exporters WHERE ExporterName > $1 GROUP BY ExporterName ORDER BY ExporterName LIMIT 3`,
+				"exporter2").
+			SetArg(1, expected[2:]).
+			Return(nil),
+	)
 
 	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
 		{
@@ -150,6 +165,29 @@ func TestWidgetExporters(t *testing.T) {
 					"exporter3",
 				},
 			},
+		}, {
+			Description: "first page",
+			URL:         "/api/v0/console/widget/exporters?limit=2",
+			JSONOutput: gin.H{
+				"exporters": []string{
+					"exporter1",
+					"exporter2",
+				},
+				"next": "ZXhwb3J0ZXIy",
+			},
+		}, {
+			Description: "second page",
+			URL:         "/api/v0/console/widget/exporters?limit=2&cursor=ZXhwb3J0ZXIy",
+			JSONOutput: gin.H{
+				"exporters": []string{
+					"exporter3",
+				},
+			},
+		}, {
+			Description: "invalid cursor",
+			URL:         "/api/v0/console/widget/exporters?limit=2&cursor=!!!",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Invalid cursor."},
 		},
 	})
 }
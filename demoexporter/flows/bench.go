@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flows
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+
+	"akvorado/common/helpers"
+)
+
+// Payloads is a set of UDP payloads to benchmark a flow collector.
+type Payloads struct {
+	// Templates should be sent before the data and regularly after. They
+	// are only used with NetFlow.
+	Templates [][]byte
+	// Data contains the payloads with flows.
+	Data [][]byte
+	// Flows is the number of flows in each data payload.
+	Flows []int
+}
+
+// benchFlowConfiguration is the flow configuration used to generate flows
+// for benchmarks. It mixes IPv4 and IPv6 as well as several protocols.
+var benchFlowConfiguration = []FlowConfiguration{
+	{
+		InIfIndex:  []int{10, 11, 12},
+		OutIfIndex: []int{20, 21, 22},
+		Multiplier: 1,
+		SrcNet:     netip.MustParsePrefix("192.0.2.0/24"),
+		DstNet:     netip.MustParsePrefix("203.0.113.0/24"),
+		SrcAS:      []uint32{64501, 64502},
+		DstAS:      []uint32{64511, 64512},
+		DstPort:    []uint16{80, 443, 0},
+		Protocol:   []string{"tcp", "udp", "icmp"},
+	}, {
+		InIfIndex:  []int{10, 11, 12},
+		OutIfIndex: []int{20, 21, 22},
+		Multiplier: 1,
+		SrcNet:     netip.MustParsePrefix("2001:db8:1::/48"),
+		DstNet:     netip.MustParsePrefix("2001:db8:2::/48"),
+		SrcAS:      []uint32{64501, 64502},
+		DstAS:      []uint32{64511, 64512},
+		DstPort:    []uint16{80, 443, 0},
+		Protocol:   []string{"tcp", "udp"},
+	},
+}
+
+// GeneratePayloads generates approximately the provided number of flows and
+// encodes them for the provided protocol (either "netflow" or "sflow"). For
+// sFlow, agent is used as the agent address. The result is deterministic for
+// a given seed.
+func GeneratePayloads(protocol string, count int, samplingRate int, agent net.IP, seed int64) (Payloads, error) {
+	if protocol != "netflow" && protocol != "sflow" {
+		return Payloads{}, fmt.Errorf("unknown protocol %q", protocol)
+	}
+	if protocol == "sflow" && agent.To4() == nil {
+		return Payloads{}, fmt.Errorf("sFlow agent address %s should be IPv4", agent)
+	}
+	flowConfigs := make([]FlowConfiguration, len(benchFlowConfiguration))
+	for idx := range flowConfigs {
+		flowConfigs[idx] = benchFlowConfiguration[idx]
+		flowConfigs[idx].PerSecond = float64(count) / float64(len(flowConfigs))
+	}
+	start := time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC)
+	now := start.Add(time.Hour)
+	flows := generateFlows(flowConfigs, seed, now)
+	if len(flows) == 0 {
+		return Payloads{}, fmt.Errorf("no flow generated")
+	}
+
+	ctx := context.Background()
+	payloads := Payloads{}
+	switch protocol {
+	case "netflow":
+		for payload := range getNetflowTemplates(ctx, 1, samplingRate, start, now) {
+			payloads.Templates = append(payloads.Templates, payload)
+		}
+		for payload := range getNetflowData(ctx, flows, 2, start, now) {
+			payloads.Data = append(payloads.Data, payload)
+			payloads.Flows = append(payloads.Flows, int(binary.BigEndian.Uint16(payload[2:4])))
+		}
+	case "sflow":
+		uptime := uint32(now.Sub(start).Milliseconds())
+		for _, payload := range getSflowData(flows, agent, 1, samplingRate, uptime) {
+			payloads.Data = append(payloads.Data, payload)
+			payloads.Flows = append(payloads.Flows, int(binary.BigEndian.Uint32(payload[24:28])))
+		}
+	}
+	return payloads, nil
+}
+
+// GenerateProbePayloads encodes a single IPv4 TCP flow as NetFlow v9. This
+// flow can then be followed through a flow pipeline. now is used as the
+// export time.
+func GenerateProbePayloads(srcAddr, dstAddr net.IP, srcPort, dstPort uint16, samplingRate int, now time.Time) (Payloads, error) {
+	if srcAddr.To4() == nil || dstAddr.To4() == nil {
+		return Payloads{}, fmt.Errorf("probe addresses %s and %s should be IPv4", srcAddr, dstAddr)
+	}
+	flows := []generatedFlow{{
+		SrcAddr: srcAddr.To4(),
+		DstAddr: dstAddr.To4(),
+		EType:   helpers.ETypeIPv4,
+		IPFlow: IPFlow{
+			Octets:        1500,
+			Packets:       1,
+			Proto:         6,
+			SrcPort:       srcPort,
+			DstPort:       dstPort,
+			InputInt:      10,
+			OutputInt:     20,
+			ForwardStatus: 64,
+			SrcMask:       32,
+			DstMask:       32,
+		},
+	}}
+	now = now.Truncate(time.Second)
+	start := now.Add(-time.Hour)
+
+	ctx := context.Background()
+	payloads := Payloads{}
+	for payload := range getNetflowTemplates(ctx, 1, samplingRate, start, now) {
+		payloads.Templates = append(payloads.Templates, payload)
+	}
+	for payload := range getNetflowData(ctx, flows, 2, start, now) {
+		payloads.Data = append(payloads.Data, payload)
+		payloads.Flows = append(payloads.Flows, 1)
+	}
+	return payloads, nil
+}
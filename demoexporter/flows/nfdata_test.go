@@ -19,7 +19,7 @@ import (
 
 func TestGetNetflowData(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := netflow.New(r, decoder.Dependencies{Schema: schema.NewMock(t)})
+	nfdecoder := netflow.New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
 
 	ch := getNetflowTemplates(
 		context.Background(),
@@ -187,3 +187,57 @@ func TestGetNetflowData(t *testing.T) {
 		t.Fatalf("getNetflowData() (-got, +want):\n%s", diff)
 	}
 }
+
+func TestGenerateProbePayloads(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := netflow.New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+
+	payloads, err := GenerateProbePayloads(
+		net.ParseIP("198.51.100.7"), net.ParseIP("203.0.113.9"), 41234, 9,
+		1, time.Date(2022, 3, 15, 14, 33, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GenerateProbePayloads() error:\n%+v", err)
+	}
+	got := []*schema.FlowMessage{}
+	for _, payload := range append(payloads.Templates, payloads.Data...) {
+		got = append(got, nfdecoder.Decode(decoder.RawFlow{
+			Payload: payload, Source: net.ParseIP("127.0.0.1"),
+		})...)
+	}
+	for idx := range got {
+		got[idx].TimeReceived = 0
+	}
+	expected := []*schema.FlowMessage{
+		{
+			SamplingRate:    1,
+			ExporterAddress: netip.MustParseAddr("::ffff:127.0.0.1"),
+			SrcAddr:         netip.MustParseAddr("::ffff:198.51.100.7"),
+			DstAddr:         netip.MustParseAddr("::ffff:203.0.113.9"),
+			InIf:            10,
+			OutIf:           20,
+			SrcNetMask:      32,
+			DstNetMask:      32,
+			ProtobufDebug: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:            1500,
+				schema.ColumnPackets:          1,
+				schema.ColumnEType:            helpers.ETypeIPv4,
+				schema.ColumnProto:            6,
+				schema.ColumnSrcPort:          41234,
+				schema.ColumnDstPort:          9,
+				schema.ColumnForwardingStatus: 64,
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("GenerateProbePayloads() (-got, +want):\n%s", diff)
+	}
+	if payloads.Flows[0] != 1 {
+		t.Errorf("GenerateProbePayloads() flows = %d, expected 1", payloads.Flows[0])
+	}
+
+	if _, err := GenerateProbePayloads(
+		net.ParseIP("2001:db8::1"), net.ParseIP("203.0.113.9"), 41234, 9,
+		1, time.Now()); err == nil {
+		t.Error("GenerateProbePayloads() should error on IPv6 addresses")
+	}
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flows
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+
+	"akvorado/common/helpers"
+)
+
+type sflowHeader struct {
+	Version        uint32
+	AddressType    uint32
+	AgentAddress   [4]byte
+	SubAgentID     uint32
+	SequenceNumber uint32
+	Uptime         uint32
+	SampleCount    uint32
+}
+
+type sflowFlowSampleHeader struct {
+	Format         uint32
+	Length         uint32
+	SequenceNumber uint32
+	SourceID       uint32
+	SamplingRate   uint32
+	SamplePool     uint32
+	Drops          uint32
+	Input          uint32
+	Output         uint32
+	RecordCount    uint32
+}
+
+type sflowRawPacketHeader struct {
+	Format         uint32
+	Length         uint32
+	HeaderProtocol uint32
+	FrameLength    uint32
+	Stripped       uint32
+	HeaderLength   uint32
+}
+
+// sflowMaxSize is the maximum size of a sFlow datagram we generate.
+const sflowMaxSize = 1400
+
+// rawPacketHeader builds the headers of an Ethernet frame matching the
+// provided flow.
+func rawPacketHeader(flow *generatedFlow) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write([]byte{0x00, 0x00, 0x5e, 0x00, 0x53, 0x01}) // destination MAC
+	buf.Write([]byte{0x00, 0x00, 0x5e, 0x00, 0x53, 0x02}) // source MAC
+	binary.Write(buf, binary.BigEndian, flow.EType)
+	l4Length := 0
+	switch flow.Proto {
+	case 6:
+		l4Length = 20
+	case 17:
+		l4Length = 8
+	}
+	if flow.EType == helpers.ETypeIPv4 {
+		buf.Write([]byte{0x45, 0x00})
+		binary.Write(buf, binary.BigEndian, uint16(flow.Octets))
+		buf.Write([]byte{0x00, 0x00, 0x40, 0x00, 64, flow.Proto, 0x00, 0x00})
+		buf.Write(flow.SrcAddr.To4())
+		buf.Write(flow.DstAddr.To4())
+	} else {
+		buf.Write([]byte{0x60, 0x00, 0x00, 0x00})
+		binary.Write(buf, binary.BigEndian, uint16(flow.Octets-40))
+		buf.Write([]byte{flow.Proto, 64})
+		buf.Write(flow.SrcAddr.To16())
+		buf.Write(flow.DstAddr.To16())
+	}
+	if l4Length > 0 {
+		binary.Write(buf, binary.BigEndian, flow.SrcPort)
+		binary.Write(buf, binary.BigEndian, flow.DstPort)
+		buf.Write(make([]byte, l4Length-4))
+	}
+	return buf.Bytes()
+}
+
+// getSflowData transforms the generated flows into sFlow v5 datagrams. Each
+// flow becomes a flow sample with a raw packet header record.
+func getSflowData(flows []generatedFlow, agent net.IP, sequenceNumber uint32, samplingRate int, uptime uint32) [][]byte {
+	result := [][]byte{}
+	samples := [][]byte{}
+	size := 0
+	flush := func() {
+		if len(samples) == 0 {
+			return
+		}
+		buf := new(bytes.Buffer)
+		binary.Write(buf, binary.BigEndian, sflowHeader{
+			Version:        5,
+			AddressType:    1,
+			AgentAddress:   *(*[4]byte)(agent.To4()),
+			SequenceNumber: sequenceNumber,
+			Uptime:         uptime,
+			SampleCount:    uint32(len(samples)),
+		})
+		for _, sample := range samples {
+			buf.Write(sample)
+		}
+		result = append(result, buf.Bytes())
+		sequenceNumber++
+		samples = samples[:0]
+		size = 0
+	}
+	for idx := range flows {
+		flow := &flows[idx]
+		header := rawPacketHeader(flow)
+		padded := (len(header) + 3) / 4 * 4
+		sample := new(bytes.Buffer)
+		binary.Write(sample, binary.BigEndian, sflowFlowSampleHeader{
+			Format:         1,
+			Length:         uint32(32 + 24 + padded),
+			SequenceNumber: sequenceNumber + uint32(idx),
+			SourceID:       flow.InputInt,
+			SamplingRate:   uint32(samplingRate),
+			SamplePool:     uint32(samplingRate) * (sequenceNumber + uint32(idx)),
+			Input:          flow.InputInt,
+			Output:         flow.OutputInt,
+			RecordCount:    1,
+		})
+		binary.Write(sample, binary.BigEndian, sflowRawPacketHeader{
+			Format:         1,
+			Length:         uint32(16 + padded),
+			HeaderProtocol: 1,
+			FrameLength:    flow.Octets,
+			Stripped:       4,
+			HeaderLength:   uint32(len(header)),
+		})
+		sample.Write(header)
+		sample.Write(make([]byte, padded-len(header)))
+		if size+sample.Len() > sflowMaxSize-28 {
+			flush()
+		}
+		samples = append(samples, sample.Bytes())
+		size += sample.Len()
+	}
+	flush()
+	return result
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flows
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/decoder/sflow"
+)
+
+func TestGetSflowData(t *testing.T) {
+	r := reporter.NewMock(t)
+	sfdecoder := sflow.New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+
+	payloads := getSflowData(
+		[]generatedFlow{
+			{
+				SrcAddr: net.ParseIP("192.0.2.206"),
+				DstAddr: net.ParseIP("203.0.113.165"),
+				EType:   0x800,
+				IPFlow: IPFlow{
+					Octets:    1500,
+					Proto:     6,
+					SrcPort:   443,
+					DstPort:   34974,
+					InputInt:  10,
+					OutputInt: 20,
+				},
+			}, {
+				SrcAddr: net.ParseIP("2001:db8::1"),
+				DstAddr: net.ParseIP("2001:db8:2:0:cea5:d643:ec43:3772"),
+				EType:   0x86dd,
+				IPFlow: IPFlow{
+					Octets:    1300,
+					Proto:     17,
+					SrcPort:   33179,
+					DstPort:   53,
+					InputInt:  20,
+					OutputInt: 10,
+				},
+			},
+		},
+		net.ParseIP("192.0.2.1"),
+		100,
+		1024,
+		3600000)
+	if len(payloads) != 1 {
+		t.Fatalf("getSflowData() returned %d payloads, expected 1", len(payloads))
+	}
+	got := sfdecoder.Decode(decoder.RawFlow{
+		Payload: payloads[0], Source: net.ParseIP("127.0.0.1"),
+	})
+	for idx := range got {
+		got[idx].TimeReceived = 0
+	}
+	expected := []*schema.FlowMessage{
+		{
+			SamplingRate:    1024,
+			ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.1"),
+			SrcAddr:         netip.MustParseAddr("::ffff:192.0.2.206"),
+			DstAddr:         netip.MustParseAddr("::ffff:203.0.113.165"),
+			InIf:            10,
+			OutIf:           20,
+			ProtobufDebug: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:   1500,
+				schema.ColumnPackets: 1,
+				schema.ColumnEType:   helpers.ETypeIPv4,
+				schema.ColumnProto:   6,
+				schema.ColumnSrcPort: 443,
+				schema.ColumnDstPort: 34974,
+			},
+		}, {
+			SamplingRate:    1024,
+			ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.1"),
+			SrcAddr:         netip.MustParseAddr("2001:db8::1"),
+			DstAddr:         netip.MustParseAddr("2001:db8:2:0:cea5:d643:ec43:3772"),
+			InIf:            20,
+			OutIf:           10,
+			ProtobufDebug: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:   1300,
+				schema.ColumnPackets: 1,
+				schema.ColumnEType:   helpers.ETypeIPv6,
+				schema.ColumnProto:   17,
+				schema.ColumnSrcPort: 33179,
+				schema.ColumnDstPort: 53,
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("getSflowData() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestGeneratePayloads(t *testing.T) {
+	for _, protocol := range []string{"netflow", "sflow"} {
+		t.Run(protocol, func(t *testing.T) {
+			payloads, err := GeneratePayloads(protocol, 1000, 1024, net.ParseIP("127.0.0.1"), 0)
+			if err != nil {
+				t.Fatalf("GeneratePayloads() error:\n%+v", err)
+			}
+			if protocol == "netflow" && len(payloads.Templates) == 0 {
+				t.Error("GeneratePayloads() did not return templates")
+			}
+			if len(payloads.Data) != len(payloads.Flows) {
+				t.Fatalf("GeneratePayloads() returned %d payloads but %d counts",
+					len(payloads.Data), len(payloads.Flows))
+			}
+			total := 0
+			for _, count := range payloads.Flows {
+				total += count
+			}
+			if total < 800 || total > 1200 {
+				t.Errorf("GeneratePayloads() generated %d flows, expected about 1000", total)
+			}
+		})
+	}
+	if _, err := GeneratePayloads("ipfix", 1000, 1024, net.ParseIP("127.0.0.1"), 0); err == nil {
+		t.Error("GeneratePayloads() should error on unknown protocol")
+	}
+}
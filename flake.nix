@@ -42,6 +42,8 @@
               MOCKGEN=${pkgs.mockgen}/bin/mockgen \
               GOIMPORTS=${pkgs.gotools}/bin/goimports \
               PIGEON=${pkgs.pigeon}/bin/pigeon \
+              PROTOC=${pkgs.protobuf}/bin/protoc \
+              PROTOC_GEN_GO=${pkgs.protoc-gen-go}/bin/protoc-gen-go \
               REVIVE=${pkgs.coreutils}/bin/true
           '';
           # We do not use a wrapper to set SSL_CERT_FILE because, either a
@@ -95,6 +97,7 @@
             nodejs
             pkgs.git
             pkgs.curl
+            pkgs.protobuf
           ];
         };
       });
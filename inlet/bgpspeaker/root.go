@@ -0,0 +1,324 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package bgpspeaker implements a minimal BGP speaker announcing routes to a
+// single peer. Routes received from the peer are ignored. It is used by the
+// components announcing routes from the inlet.
+package bgpspeaker
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/reporter"
+)
+
+// Configuration describes the BGP peer.
+type Configuration struct {
+	// Address is the address and port of the BGP peer. When empty, no
+	// route is announced.
+	Address string `validate:"omitempty,hostname_port"`
+	// LocalAS is the local AS number.
+	LocalAS uint32 `validate:"required_with=Address"`
+	// PeerAS is the AS number of the peer.
+	PeerAS uint32 `validate:"required_with=Address"`
+	// RouterID is the BGP identifier. It should be an IPv4 address.
+	RouterID netip.Addr `validate:"required_with=Address"`
+	// HoldTime is the proposed hold time.
+	HoldTime time.Duration `validate:"eq=0|min=3s,max=65535s"`
+	// ConnectRetry is the delay before reconnecting to the peer.
+	ConnectRetry time.Duration `validate:"min=1s"`
+}
+
+// DefaultConfiguration represents the default configuration for a BGP peer.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		HoldTime:     90 * time.Second,
+		ConnectRetry: 30 * time.Second,
+	}
+}
+
+// Metrics are the metrics updated by the speaker. They are registered by the
+// component using the speaker.
+type Metrics struct {
+	Established reporter.Gauge
+	Errors      reporter.Counter
+	Updates     *reporter.CounterVec
+}
+
+// Speaker maintains a BGP session with a peer.
+type Speaker struct {
+	r        *reporter.Reporter
+	config   Configuration
+	metrics  Metrics
+	families []bgp.RouteFamily
+}
+
+// SyncFunc synchronizes the routes announced to the peer. It is called once
+// the session is established and each time routes change.
+type SyncFunc func(session *Session) error
+
+// New creates a new BGP speaker for the provided address families.
+func New(r *reporter.Reporter, config Configuration, metrics Metrics, families ...bgp.RouteFamily) (*Speaker, error) {
+	if config.Address != "" && !config.RouterID.Is4() {
+		return nil, fmt.Errorf("router ID %s should be an IPv4 address", config.RouterID)
+	}
+	return &Speaker{
+		r:        r,
+		config:   config,
+		metrics:  metrics,
+		families: families,
+	}, nil
+}
+
+// Run maintains a BGP session with the peer until the provided tomb is
+// dying. The session is reestablished on error. For each session, newSync is
+// called to get the function synchronizing routes. It is invoked when the
+// session is established and each time changed is notified.
+func (s *Speaker) Run(t *tomb.Tomb, changed <-chan struct{}, newSync func() SyncFunc) error {
+	for {
+		if err := s.session(t, changed, newSync()); err != nil {
+			s.r.Err(err).Str("peer", s.config.Address).Msg("BGP session with peer lost")
+			s.metrics.Errors.Inc()
+		}
+		s.metrics.Established.Set(0)
+		select {
+		case <-t.Dying():
+			return nil
+		case <-time.After(s.config.ConnectRetry):
+		}
+	}
+}
+
+// session establishes a BGP session with the peer and keeps routes
+// synchronized. It returns when the session is lost or when the tomb is
+// dying. In the later case, the peer withdraws the routes when the session is
+// closed.
+func (s *Speaker) session(t *tomb.Tomb, changed <-chan struct{}, sync SyncFunc) error {
+	var d net.Dialer
+	conn, err := d.DialContext(t.Context(nil), "tcp", s.config.Address)
+	if err != nil {
+		if t.Alive() {
+			return fmt.Errorf("cannot connect to peer: %w", err)
+		}
+		return nil
+	}
+	defer conn.Close()
+	session := &Session{speaker: s, conn: conn}
+
+	done := make(chan struct{})
+	defer close(done)
+	messages := make(chan *bgp.BGPMessage)
+	readErrors := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := read(conn)
+			if err != nil {
+				readErrors <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if err := session.send(s.openMessage()); err != nil {
+		return err
+	}
+	holdTime := s.config.HoldTime
+	var holdTimer *time.Timer
+	var holdChan <-chan time.Time
+	var keepaliveChan <-chan time.Time
+	opened, established := false, false
+	for {
+		select {
+		case <-t.Dying():
+			session.send(bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_CEASE,
+				bgp.BGP_ERROR_SUB_ADMINISTRATIVE_SHUTDOWN, nil))
+			return nil
+		case err := <-readErrors:
+			return fmt.Errorf("cannot read from peer: %w", err)
+		case <-holdChan:
+			session.send(bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_HOLD_TIMER_EXPIRED, 0, nil))
+			return errors.New("hold timer expired")
+		case <-keepaliveChan:
+			if err := session.send(bgp.NewBGPKeepAliveMessage()); err != nil {
+				return err
+			}
+		case <-changed:
+			if established {
+				if err := sync(session); err != nil {
+					return err
+				}
+			}
+		case msg := <-messages:
+			if holdTimer != nil {
+				holdTimer.Reset(holdTime)
+			}
+			switch body := msg.Body.(type) {
+			case *bgp.BGPOpen:
+				if opened {
+					session.send(bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_FSM_ERROR, 0, nil))
+					return errors.New("unexpected OPEN message")
+				}
+				opened = true
+				if err := s.checkOpen(body); err != nil {
+					session.send(bgp.NewBGPNotificationMessage(bgp.BGP_ERROR_OPEN_MESSAGE_ERROR,
+						bgp.BGP_ERROR_SUB_BAD_PEER_AS, nil))
+					return err
+				}
+				peerHoldTime := time.Duration(body.HoldTime) * time.Second
+				holdTime = min(holdTime, peerHoldTime)
+				if holdTime > 0 {
+					holdTimer = time.NewTimer(holdTime)
+					defer holdTimer.Stop()
+					holdChan = holdTimer.C
+					keepaliveTicker := time.NewTicker(holdTime / 3)
+					defer keepaliveTicker.Stop()
+					keepaliveChan = keepaliveTicker.C
+				}
+				if err := session.send(bgp.NewBGPKeepAliveMessage()); err != nil {
+					return err
+				}
+			case *bgp.BGPKeepAlive:
+				if !established {
+					established = true
+					s.r.Info().Str("peer", s.config.Address).Msg("BGP session established")
+					s.metrics.Established.Set(1)
+					if err := sync(session); err != nil {
+						return err
+					}
+				}
+			case *bgp.BGPNotification:
+				return fmt.Errorf("notification received from peer (code %d, subcode %d)",
+					body.ErrorCode, body.ErrorSubcode)
+			}
+		}
+	}
+}
+
+// checkOpen checks the OPEN message received from the peer.
+func (s *Speaker) checkOpen(open *bgp.BGPOpen) error {
+	peerAS := uint32(open.MyAS)
+	for _, param := range open.OptParams {
+		capabilities, ok := param.(*bgp.OptionParameterCapability)
+		if !ok {
+			continue
+		}
+		for _, capability := range capabilities.Capability {
+			if as4, ok := capability.(*bgp.CapFourOctetASNumber); ok {
+				peerAS = as4.CapValue
+			}
+		}
+	}
+	if peerAS != s.config.PeerAS {
+		return fmt.Errorf("unexpected peer AS %d (expected %d)", peerAS, s.config.PeerAS)
+	}
+	return nil
+}
+
+// openMessage builds the OPEN message for the peer.
+func (s *Speaker) openMessage() *bgp.BGPMessage {
+	myAS := uint16(bgp.AS_TRANS)
+	if s.config.LocalAS <= 0xffff {
+		myAS = uint16(s.config.LocalAS)
+	}
+	capabilities := []bgp.ParameterCapabilityInterface{}
+	for _, family := range s.families {
+		capabilities = append(capabilities, bgp.NewCapMultiProtocol(family))
+	}
+	capabilities = append(capabilities, bgp.NewCapFourOctetASNumber(s.config.LocalAS))
+	return bgp.NewBGPOpenMessage(myAS, uint16(s.config.HoldTime.Seconds()),
+		s.config.RouterID.String(),
+		[]bgp.OptionParameterInterface{bgp.NewOptionParameterCapability(capabilities)})
+}
+
+// CommonAttributes returns the path attributes common to all announcements.
+func (s *Speaker) CommonAttributes() []bgp.PathAttributeInterface {
+	if s.config.LocalAS == s.config.PeerAS {
+		return []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+			bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{}),
+			bgp.NewPathAttributeLocalPref(100),
+		}
+	}
+	return []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeOrigin(bgp.BGP_ORIGIN_ATTR_TYPE_IGP),
+		bgp.NewPathAttributeAsPath([]bgp.AsPathParamInterface{
+			bgp.NewAs4PathParam(bgp.BGP_ASPATH_ATTR_TYPE_SEQ, []uint32{s.config.LocalAS}),
+		}),
+	}
+}
+
+// Session is an established BGP session.
+type Session struct {
+	speaker *Speaker
+	conn    net.Conn
+}
+
+// LocalAddr returns the local address of the session.
+func (session *Session) LocalAddr() netip.Addr {
+	return session.conn.LocalAddr().(*net.TCPAddr).AddrPort().Addr().Unmap()
+}
+
+// Announce sends an UPDATE message announcing routes.
+func (session *Session) Announce(msg *bgp.BGPMessage) error {
+	if err := session.send(msg); err != nil {
+		return err
+	}
+	session.speaker.metrics.Updates.WithLabelValues("announce").Inc()
+	return nil
+}
+
+// Withdraw sends an UPDATE message withdrawing routes.
+func (session *Session) Withdraw(msg *bgp.BGPMessage) error {
+	if err := session.send(msg); err != nil {
+		return err
+	}
+	session.speaker.metrics.Updates.WithLabelValues("withdraw").Inc()
+	return nil
+}
+
+// send sends a BGP message to the peer.
+func (session *Session) send(msg *bgp.BGPMessage) error {
+	buf, err := msg.Serialize()
+	if err != nil {
+		return fmt.Errorf("cannot serialize BGP message: %w", err)
+	}
+	if _, err := session.conn.Write(buf); err != nil {
+		return fmt.Errorf("cannot write to peer: %w", err)
+	}
+	return nil
+}
+
+// read reads a BGP message. UPDATE messages are not decoded as their content
+// is ignored.
+func read(r io.Reader) (*bgp.BGPMessage, error) {
+	buf := make([]byte, bgp.BGP_HEADER_LENGTH, bgp.BGP_MAX_MESSAGE_LENGTH)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint16(buf[16:18])
+	if length < bgp.BGP_HEADER_LENGTH || length > bgp.BGP_MAX_MESSAGE_LENGTH {
+		return nil, fmt.Errorf("invalid BGP message length %d", length)
+	}
+	buf = buf[:length]
+	if _, err := io.ReadFull(r, buf[bgp.BGP_HEADER_LENGTH:]); err != nil {
+		return nil, err
+	}
+	if buf[18] == bgp.BGP_MSG_UPDATE {
+		return &bgp.BGPMessage{Body: &bgp.BGPUpdate{}}, nil
+	}
+	return bgp.ParseBGPMessage(buf)
+}
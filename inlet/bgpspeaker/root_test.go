@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package bgpspeaker
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSpeaker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	defer listener.Close()
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Address = listener.Addr().String()
+	config.LocalAS = 4200000001
+	config.PeerAS = 4200000002
+	config.RouterID = netip.MustParseAddr("192.0.2.10")
+	config.ConnectRetry = 10 * time.Millisecond
+	metrics := Metrics{
+		Established: r.Gauge(reporter.GaugeOpts{Name: "established", Help: "Established."}),
+		Errors:      r.Counter(reporter.CounterOpts{Name: "errors_total", Help: "Errors."}),
+		Updates: r.CounterVec(reporter.CounterOpts{Name: "updates_total", Help: "Updates."},
+			[]string{"type"}),
+	}
+	s, err := New(r, config, metrics, bgp.RF_IPv4_UC)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	var tb tomb.Tomb
+	changed := make(chan struct{}, 1)
+	synced := make(chan netip.Addr, 10)
+	tb.Go(func() error {
+		return s.Run(&tb, changed, func() SyncFunc {
+			return func(session *Session) error {
+				synced <- session.LocalAddr()
+				return session.Announce(bgp.NewBGPUpdateMessage(nil, s.CommonAttributes(),
+					[]*bgp.IPAddrPrefix{bgp.NewIPAddrPrefix(24, "198.51.100.0")}))
+			}
+		})
+	})
+	defer func() {
+		tb.Kill(nil)
+		tb.Wait()
+	}()
+
+	exchange := func(peerAS uint32) net.Conn {
+		t.Helper()
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Fatalf("Accept() error:\n%+v", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		msg, err := read(conn)
+		if err != nil {
+			t.Fatalf("read() error:\n%+v", err)
+		}
+		if open, ok := msg.Body.(*bgp.BGPOpen); !ok {
+			t.Fatalf("expected OPEN message, got %T", msg.Body)
+		} else if open.MyAS != bgp.AS_TRANS || open.ID.String() != "192.0.2.10" {
+			t.Fatalf("unexpected OPEN message: %+v", open)
+		}
+		for _, msg := range []*bgp.BGPMessage{
+			bgp.NewBGPOpenMessage(bgp.AS_TRANS, 30, "192.0.2.254", []bgp.OptionParameterInterface{
+				bgp.NewOptionParameterCapability([]bgp.ParameterCapabilityInterface{
+					bgp.NewCapFourOctetASNumber(peerAS),
+				}),
+			}),
+			bgp.NewBGPKeepAliveMessage(),
+		} {
+			buf, _ := msg.Serialize()
+			conn.Write(buf)
+		}
+		return conn
+	}
+
+	// Unexpected peer AS
+	conn := exchange(4200000003)
+	msg, err := read(conn)
+	if err != nil {
+		t.Fatalf("read() error:\n%+v", err)
+	}
+	if notification, ok := msg.Body.(*bgp.BGPNotification); !ok {
+		t.Fatalf("expected NOTIFICATION message, got %T", msg.Body)
+	} else if notification.ErrorCode != bgp.BGP_ERROR_OPEN_MESSAGE_ERROR ||
+		notification.ErrorSubcode != bgp.BGP_ERROR_SUB_BAD_PEER_AS {
+		t.Fatalf("unexpected NOTIFICATION message: %+v", notification)
+	}
+	conn.Close()
+
+	// Expected peer AS, routes are synced on establishment and on change
+	conn = exchange(4200000002)
+	defer conn.Close()
+	for _, expected := range []string{"KEEPALIVE", "UPDATE"} {
+		msg, err := read(conn)
+		if err != nil {
+			t.Fatalf("read() error:\n%+v", err)
+		}
+		got := "UPDATE"
+		if _, ok := msg.Body.(*bgp.BGPKeepAlive); ok {
+			got = "KEEPALIVE"
+		}
+		if got != expected {
+			t.Fatalf("read() got %s, expected %s", got, expected)
+		}
+	}
+	if local := <-synced; local != netip.MustParseAddr("127.0.0.1") {
+		t.Fatalf("LocalAddr() == %s, expected 127.0.0.1", local)
+	}
+	changed <- struct{}{}
+	if _, err := read(conn); err != nil {
+		t.Fatalf("read() error:\n%+v", err)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_bgpspeaker_")
+	expectedMetrics := map[string]string{
+		`established`:                    "1",
+		`errors_total`:                   "1",
+		`updates_total{type="announce"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRouterID(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Address = "127.0.0.1:179"
+	config.RouterID = netip.MustParseAddr("2001:db8::1")
+	if _, err := New(r, config, Metrics{}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -0,0 +1,364 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/pipeline"
+)
+
+type adminExporterParameters struct {
+	Exporter   netip.Addr `json:"exporter"`
+	Interfaces []uint     `json:"interfaces"`
+}
+
+// bindAdminExporterParameters binds the parameters for an administrative
+// action on an exporter. It returns false if the parameters are invalid.
+func bindAdminExporterParameters(gc *gin.Context) (adminExporterParameters, bool) {
+	var params adminExporterParameters
+	if err := gc.ShouldBindJSON(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return params, false
+	}
+	if !params.Exporter.IsValid() {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Missing exporter."})
+		return params, false
+	}
+	params.Exporter = netip.AddrFrom16(params.Exporter.As16())
+	return params, true
+}
+
+// adminInvalidateMetadataHandler invalidates the metadata cached for an
+// exporter, optionally restricted to some interfaces, or for all exporters.
+// The classification results are also invalidated.
+func (c *Component) adminInvalidateMetadataHandler(gc *gin.Context) {
+	var params struct {
+		adminExporterParameters
+		All bool `json:"all"`
+	}
+	if err := gc.ShouldBindJSON(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if params.All {
+		if params.Exporter.IsValid() || len(params.Interfaces) > 0 {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Cannot combine all with an exporter."})
+			return
+		}
+		count := c.d.Metadata.Invalidate(netip.Addr{})
+		c.classifierExporterCache.DeleteMatching(func(exporterInfo) bool { return true })
+		c.classifierInterfaceCache.DeleteMatching(func(exporterAndInterfaceInfo) bool { return true })
+		c.r.Info().Int("entries", count).Msg("metadata cache invalidated")
+		gc.JSON(http.StatusOK, gin.H{"invalidated": count})
+		return
+	}
+	if !params.Exporter.IsValid() {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Missing exporter."})
+		return
+	}
+	params.Exporter = netip.AddrFrom16(params.Exporter.As16())
+	count := c.d.Metadata.Invalidate(params.Exporter, params.Interfaces...)
+	exporterStr := params.Exporter.Unmap().String()
+	c.classifierExporterCache.DeleteMatching(func(k exporterInfo) bool {
+		return k.IP == exporterStr
+	})
+	c.classifierInterfaceCache.DeleteMatching(func(k exporterAndInterfaceInfo) bool {
+		if k.Exporter.IP != exporterStr {
+			return false
+		}
+		if len(params.Interfaces) == 0 {
+			return true
+		}
+		for _, ifIndex := range params.Interfaces {
+			if uint(k.Interface.Index) == ifIndex {
+				return true
+			}
+		}
+		return false
+	})
+	c.r.Info().Str("exporter", exporterStr).Int("entries", count).Msg("metadata cache invalidated")
+	gc.JSON(http.StatusOK, gin.H{"invalidated": count})
+}
+
+// adminResetFlowHandler clears the templates and sampling rates received
+// from an exporter.
+func (c *Component) adminResetFlowHandler(gc *gin.Context) {
+	params, ok := bindAdminExporterParameters(gc)
+	if !ok {
+		return
+	}
+	reset := c.d.Flow.ResetExporter(params.Exporter)
+	c.r.Info().Str("exporter", params.Exporter.Unmap().String()).Msg("decoder state reset")
+	gc.JSON(http.StatusOK, gin.H{"reset": reset})
+}
+
+// adminReloadGeoIPHandler reloads the GeoIP databases.
+func (c *Component) adminReloadGeoIPHandler(gc *gin.Context) {
+	if err := c.d.GeoIP.Reload(); err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	c.r.Info().Msg("GeoIP databases reloaded")
+	gc.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// adminRestartHandler restarts a component of the inlet without restarting
+// the whole inlet.
+func (c *Component) adminRestartHandler(gc *gin.Context) {
+	var restart func() error
+	component := gc.Param("component")
+	switch component {
+	case "kafka":
+		restart = c.d.Kafka.Restart
+	case "routing":
+		restart = c.d.Routing.Restart
+	default:
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Unknown component."})
+		return
+	}
+	if err := restart(); err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	c.r.Info().Str("component", component).Msg("component restarted")
+	gc.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+type exporterInterface struct {
+	Index       uint                     `json:"index"`
+	Name        string                   `json:"name"`
+	Description string                   `json:"description"`
+	Speed       uint                     `json:"speed"`
+	AdminStatus provider.InterfaceStatus `json:"admin-status"`
+	OperStatus  provider.InterfaceStatus `json:"oper-status"`
+	LastChange  *time.Time               `json:"last-change,omitempty"`
+}
+
+// exporterInterfacesHandler returns the metadata currently cached for the
+// interfaces of an exporter, including their status. The exporter can be
+// designated by its address or by its name. In the later case, its most
+// recent address is used.
+func (c *Component) exporterInterfacesHandler(gc *gin.Context) {
+	var exporter netip.Addr
+	if name := gc.Query("name"); name != "" {
+		addresses := c.d.Metadata.ExporterAddresses(name)
+		if len(addresses) == 0 {
+			gc.JSON(http.StatusNotFound, gin.H{"message": "Unknown exporter."})
+			return
+		}
+		exporter = addresses[0]
+	} else {
+		var err error
+		exporter, err = netip.ParseAddr(gc.Query("exporter"))
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": "Missing exporter."})
+			return
+		}
+	}
+	exporter = netip.AddrFrom16(exporter.As16())
+	answers := c.d.Metadata.Interfaces(exporter)
+	name := ""
+	interfaces := make([]exporterInterface, 0, len(answers))
+	for ifIndex, answer := range answers {
+		name = answer.Exporter.Name
+		if ifIndex == 0 {
+			continue
+		}
+		iface := exporterInterface{
+			Index:       ifIndex,
+			Name:        answer.Interface.Name,
+			Description: answer.Interface.Description,
+			Speed:       answer.Interface.Speed,
+			AdminStatus: answer.Interface.AdminStatus,
+			OperStatus:  answer.Interface.OperStatus,
+		}
+		if !answer.Interface.LastChange.IsZero() {
+			lastChange := answer.Interface.LastChange
+			iface.LastChange = &lastChange
+		}
+		interfaces = append(interfaces, iface)
+	}
+	sort.Slice(interfaces, func(i, j int) bool {
+		return interfaces[i].Index < interfaces[j].Index
+	})
+	result := gin.H{
+		"exporter":   exporter.Unmap().String(),
+		"name":       name,
+		"interfaces": interfaces,
+	}
+	if renumberings := c.d.Metadata.InterfaceRenumberings(exporter); len(renumberings) > 0 {
+		history := make([]gin.H, 0, len(renumberings))
+		for _, renumbering := range renumberings {
+			history = append(history, gin.H{
+				"time":     renumbering.Time,
+				"index":    renumbering.IfIndex,
+				"previous": renumbering.Previous,
+				"name":     renumbering.Name,
+			})
+		}
+		result["renumberings"] = history
+	}
+	if statistics := c.d.Flow.ExporterStatistics(exporter); len(statistics) > 0 {
+		result["statistics"] = statistics
+	}
+	gc.JSON(http.StatusOK, result)
+}
+
+type adminDropsParameters struct {
+	Minutes int `form:"minutes" binding:"min=1,max=15"`
+}
+
+// adminDropsHandler returns the number of flows dropped at each stage of the
+// pipeline during the last minutes.
+func (c *Component) adminDropsHandler(gc *gin.Context) {
+	params := adminDropsParameters{Minutes: 5}
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	drops := c.dropsHistory.Since(time.Now(), time.Duration(params.Minutes)*time.Minute)
+	stages := make([]gin.H, 0, len(pipeline.Stages))
+	var total uint64
+	for _, stage := range pipeline.Stages {
+		stages = append(stages, gin.H{"stage": stage, "dropped": drops[stage]})
+		total += drops[stage]
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"minutes": params.Minutes,
+		"stages":  stages,
+		"total":   total,
+	})
+}
+
+// talker is the volume of a flow between two addresses, sampled for the top
+// talkers.
+type talker struct {
+	src   netip.Addr
+	dst   netip.Addr
+	bytes uint64
+}
+
+type adminTopTalkersParameters struct {
+	Seconds int `form:"seconds" binding:"min=1,max=60"`
+	Limit   int `form:"limit" binding:"min=1,max=100"`
+}
+
+// adminTopTalkersHandler samples the flows forwarded during a few seconds and
+// returns the source and destination addresses with the most traffic.
+func (c *Component) adminTopTalkersHandler(gc *gin.Context) {
+	params := adminTopTalkersParameters{Seconds: 10, Limit: 10}
+	if err := gc.ShouldBindQuery(&params); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if c.d.Schema.Privacy() {
+		gc.JSON(http.StatusForbidden, gin.H{"message": "Top talkers are not available in privacy mode."})
+		return
+	}
+
+	c.topTalkersClients.Add(1)
+	defer c.topTalkersClients.Add(-1)
+	timer := time.NewTimer(time.Duration(params.Seconds) * time.Second)
+	defer timer.Stop()
+	sources := map[netip.Addr]uint64{}
+	destinations := map[netip.Addr]uint64{}
+	flows := 0
+collect:
+	for {
+		select {
+		case <-c.t.Dying():
+			return
+		case <-gc.Request.Context().Done():
+			return
+		case <-timer.C:
+			break collect
+		case t := <-c.topTalkersChannel:
+			flows++
+			if t.src.IsValid() {
+				sources[t.src] += t.bytes
+			}
+			if t.dst.IsValid() {
+				destinations[t.dst] += t.bytes
+			}
+		}
+	}
+
+	top := func(volumes map[netip.Addr]uint64) []gin.H {
+		addresses := make([]netip.Addr, 0, len(volumes))
+		for address := range volumes {
+			addresses = append(addresses, address)
+		}
+		sort.Slice(addresses, func(i, j int) bool {
+			if volumes[addresses[i]] != volumes[addresses[j]] {
+				return volumes[addresses[i]] > volumes[addresses[j]]
+			}
+			return addresses[i].Less(addresses[j])
+		})
+		if len(addresses) > params.Limit {
+			addresses = addresses[:params.Limit]
+		}
+		result := make([]gin.H, 0, len(addresses))
+		for _, address := range addresses {
+			result = append(result, gin.H{
+				"address": address.String(),
+				"bps":     volumes[address] * 8 / uint64(params.Seconds),
+			})
+		}
+		return result
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"seconds":      params.Seconds,
+		"flows":        flows,
+		"sources":      top(sources),
+		"destinations": top(destinations),
+	})
+}
+
+// adminRoutingLookupHandler returns the routing information for an IP
+// address, as used during enrichment.
+func (c *Component) adminRoutingLookupHandler(gc *gin.Context) {
+	var addresses [3]netip.Addr
+	for idx, param := range []string{"ip", "next-hop", "agent"} {
+		value := gc.Query(param)
+		if value == "" {
+			continue
+		}
+		address, err := netip.ParseAddr(value)
+		if err != nil {
+			gc.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid %s.", param)})
+			return
+		}
+		addresses[idx] = netip.AddrFrom16(address.As16())
+	}
+	if !addresses[0].IsValid() {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Missing IP."})
+		return
+	}
+	result := c.d.Routing.Lookup(gc.Request.Context(), addresses[0], addresses[1], addresses[2])
+	largeCommunities := make([]string, 0, len(result.LargeCommunities))
+	for _, community := range result.LargeCommunities {
+		largeCommunities = append(largeCommunities, community.String())
+	}
+	nextHop := ""
+	if result.NextHop.IsValid() {
+		nextHop = result.NextHop.Unmap().String()
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"asn":               result.ASN,
+		"as-path":           append([]uint32{}, result.ASPath...),
+		"communities":       append([]uint32{}, result.Communities...),
+		"large-communities": largeCommunities,
+		"net-mask":          result.NetMask,
+		"next-hop":          nextHop,
+	})
+}
@@ -0,0 +1,329 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/kafka"
+	"akvorado/inlet/metadata"
+	"akvorado/inlet/pipeline"
+	"akvorado/inlet/routing"
+)
+
+func TestAdminHandlers(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	metadataComponent := metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+		metadata.Dependencies{Daemon: daemonComponent})
+	kafkaComponent, _ := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := httpserver.NewMock(t, r)
+	routingComponent := routing.NewMock(t, r)
+	routingComponent.PopulateRIB(t)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon:   daemonComponent,
+		Flow:     flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadataComponent,
+		GeoIP:    geoip.NewMock(t, r),
+		Kafka:    kafkaComponent,
+		HTTP:     httpComponent,
+		Routing:  routingComponent,
+		Schema:   schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Populate the metadata cache
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	metadataComponent.Lookup(time.Now(), exporter, 100)
+	metadataComponent.Lookup(time.Now(), exporter, 200)
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := metadataComponent.Lookup(time.Now(), exporter, 100); !ok {
+		t.Fatal("Lookup() did not populate the cache")
+	}
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "exporter interfaces without exporter",
+			URL:         "/api/v0/inlet/metadata/exporter",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Missing exporter."},
+		}, {
+			Description: "exporter interfaces",
+			URL:         "/api/v0/inlet/metadata/exporter?exporter=192.0.2.142",
+			JSONOutput: gin.H{
+				"exporter": "192.0.2.142",
+				"name":     "192_0_2_142",
+				"interfaces": []gin.H{
+					{
+						"index":        100,
+						"name":         "Gi0/0/100",
+						"description":  "Interface 100",
+						"speed":        1000,
+						"admin-status": "",
+						"oper-status":  "",
+					}, {
+						"index":        200,
+						"name":         "Gi0/0/200",
+						"description":  "Interface 200",
+						"speed":        1000,
+						"admin-status": "",
+						"oper-status":  "",
+					},
+				},
+			},
+		}, {
+			Description: "exporter interfaces by name",
+			URL:         "/api/v0/inlet/metadata/exporter?name=192_0_2_142",
+			JSONOutput: gin.H{
+				"exporter": "192.0.2.142",
+				"name":     "192_0_2_142",
+				"interfaces": []gin.H{
+					{
+						"index":        100,
+						"name":         "Gi0/0/100",
+						"description":  "Interface 100",
+						"speed":        1000,
+						"admin-status": "",
+						"oper-status":  "",
+					}, {
+						"index":        200,
+						"name":         "Gi0/0/200",
+						"description":  "Interface 200",
+						"speed":        1000,
+						"admin-status": "",
+						"oper-status":  "",
+					},
+				},
+			},
+		}, {
+			Description: "exporter interfaces for unknown name",
+			URL:         "/api/v0/inlet/metadata/exporter?name=unknown",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Unknown exporter."},
+		}, {
+			Description: "exporter interfaces for unknown exporter",
+			URL:         "/api/v0/inlet/metadata/exporter?exporter=192.0.2.143",
+			JSONOutput: gin.H{
+				"exporter":   "192.0.2.143",
+				"name":       "",
+				"interfaces": []gin.H{},
+			},
+		}, {
+			Description: "invalidate metadata without exporter",
+			URL:         "/api/v0/inlet/admin/metadata/invalidate",
+			JSONInput:   gin.H{},
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Missing exporter."},
+		}, {
+			Description: "invalidate metadata for one interface",
+			URL:         "/api/v0/inlet/admin/metadata/invalidate",
+			JSONInput:   gin.H{"exporter": "192.0.2.142", "interfaces": []uint{100}},
+			JSONOutput:  gin.H{"invalidated": 1},
+		}, {
+			Description: "invalidate metadata for an exporter",
+			URL:         "/api/v0/inlet/admin/metadata/invalidate",
+			JSONInput:   gin.H{"exporter": "192.0.2.142"},
+			JSONOutput:  gin.H{"invalidated": 1},
+		}, {
+			Description: "invalidate metadata for an exporter and all",
+			URL:         "/api/v0/inlet/admin/metadata/invalidate",
+			JSONInput:   gin.H{"exporter": "192.0.2.142", "all": true},
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Cannot combine all with an exporter."},
+		}, {
+			Description: "invalidate all metadata",
+			URL:         "/api/v0/inlet/admin/metadata/invalidate",
+			JSONInput:   gin.H{"all": true},
+			JSONOutput:  gin.H{"invalidated": 0},
+		}, {
+			Description: "reset unknown exporter",
+			URL:         "/api/v0/inlet/admin/flow/reset",
+			JSONInput:   gin.H{"exporter": "192.0.2.142"},
+			JSONOutput:  gin.H{"reset": false},
+		}, {
+			Description: "reload GeoIP databases",
+			URL:         "/api/v0/inlet/admin/geoip/reload",
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "ok"},
+		}, {
+			Description: "restart Kafka component",
+			URL:         "/api/v0/inlet/admin/restart/kafka",
+			JSONInput:   gin.H{},
+			JSONOutput:  gin.H{"message": "ok"},
+		}, {
+			Description: "restart unknown component",
+			URL:         "/api/v0/inlet/admin/restart/unknown",
+			JSONInput:   gin.H{},
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Unknown component."},
+		}, {
+			Description: "routing lookup without IP",
+			URL:         "/api/v0/inlet/admin/routing/lookup",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Missing IP."},
+		}, {
+			Description: "routing lookup with invalid next hop",
+			URL:         "/api/v0/inlet/admin/routing/lookup?ip=192.0.2.130&next-hop=foo",
+			StatusCode:  400,
+			JSONOutput:  gin.H{"message": "Invalid next-hop."},
+		}, {
+			Description: "routing lookup",
+			URL:         "/api/v0/inlet/admin/routing/lookup?ip=192.0.2.130",
+			JSONOutput: gin.H{
+				"asn":               1299,
+				"as-path":           []uint32{64200, 1299},
+				"communities":       []uint32{500},
+				"large-communities": []string{},
+				"net-mask":          27,
+				"next-hop":          "198.51.100.8",
+			},
+		}, {
+			Description: "routing lookup without route",
+			URL:         "/api/v0/inlet/admin/routing/lookup?ip=203.0.113.1",
+			JSONOutput: gin.H{
+				"asn":               0,
+				"as-path":           []uint32{},
+				"communities":       []uint32{},
+				"large-communities": []string{},
+				"net-mask":          0,
+				"next-hop":          "",
+			},
+		},
+	})
+}
+
+func TestAdminTopTalkersHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	kafkaComponent, _ := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := httpserver.NewMock(t, r)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+			metadata.Dependencies{Daemon: daemonComponent}),
+		GeoIP:   geoip.NewMock(t, r),
+		Kafka:   kafkaComponent,
+		HTTP:    httpComponent,
+		Routing: routing.NewMock(t, r),
+		Schema:  schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Send talkers once the handler is waiting for them
+	go func() {
+		for c.topTalkersClients.Load() == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		addr := func(s string) netip.Addr { return netip.MustParseAddr(s) }
+		for _, t := range []talker{
+			{addr("192.0.2.1"), addr("198.51.100.1"), 1000},
+			{addr("192.0.2.2"), addr("198.51.100.1"), 3000},
+			{addr("192.0.2.1"), addr("198.51.100.2"), 1500},
+			{addr("192.0.2.3"), addr("198.51.100.3"), 500},
+		} {
+			c.topTalkersChannel <- t
+		}
+	}()
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "invalid duration",
+			URL:         "/api/v0/inlet/admin/top-talkers?seconds=120",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'adminTopTalkersParameters.Seconds' Error:Field validation for 'Seconds' failed on the 'max' tag",
+			},
+		}, {
+			Description: "top talkers",
+			URL:         "/api/v0/inlet/admin/top-talkers?seconds=1&limit=2",
+			JSONOutput: gin.H{
+				"seconds": 1,
+				"flows":   4,
+				"sources": []gin.H{
+					{"address": "192.0.2.2", "bps": 24000},
+					{"address": "192.0.2.1", "bps": 20000},
+				},
+				"destinations": []gin.H{
+					{"address": "198.51.100.1", "bps": 32000},
+					{"address": "198.51.100.2", "bps": 12000},
+				},
+			},
+		},
+	})
+}
+
+func TestAdminDropsHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	kafkaComponent, _ := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := httpserver.NewMock(t, r)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+			metadata.Dependencies{Daemon: daemonComponent}),
+		GeoIP:   geoip.NewMock(t, r),
+		Kafka:   kafkaComponent,
+		HTTP:    httpComponent,
+		Routing: routing.NewMock(t, r),
+		Schema:  schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Flows without interfaces are dropped during enrichment
+	c.enrichFlow(netip.MustParseAddr("::ffff:192.0.2.142"), "192.0.2.142", &schema.FlowMessage{
+		SamplingRate: 1000,
+	}, false)
+	c.drops.Add(pipeline.StageListener, 10)
+	c.drops.Add(pipeline.StageMetadataMiss, 3)
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "dropped flows",
+			URL:         "/api/v0/inlet/admin/drops",
+			JSONOutput: gin.H{
+				"minutes": 5,
+				"stages": []gin.H{
+					{"stage": "listener", "dropped": 10},
+					{"stage": "memory", "dropped": 0},
+					{"stage": "decode", "dropped": 0},
+					{"stage": "rate-limit", "dropped": 0},
+					{"stage": "metadata-miss", "dropped": 3},
+					{"stage": "enrichment", "dropped": 1},
+					{"stage": "quota", "dropped": 0},
+					{"stage": "output", "dropped": 0},
+				},
+				"total": 14,
+			},
+		}, {
+			Description: "dropped flows over a too long period",
+			URL:         "/api/v0/inlet/admin/drops?minutes=60",
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'adminDropsParameters.Minutes' Error:Field validation for 'Minutes' failed on the 'max' tag",
+			},
+		},
+	})
+}
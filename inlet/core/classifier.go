@@ -5,6 +5,7 @@ package core
 
 import (
 	"fmt"
+	"net/netip"
 	"regexp"
 	"strings"
 	"sync"
@@ -143,6 +144,8 @@ type interfaceInfo struct {
 	Description string
 	Speed       uint32
 	VLAN        uint16
+	AdminStatus string
+	OperStatus  string
 }
 
 // interfaceClassification contains the information about an interface classification
@@ -249,6 +252,95 @@ func (scr InterfaceClassifierRule) MarshalText() ([]byte, error) {
 	return []byte(scr.String()), nil
 }
 
+// ApplicationClassifierRule defines a classification rule for the application
+// of a flow.
+type ApplicationClassifierRule struct {
+	program *vm.Program
+}
+
+// applicationInfo contains the information we want to expose about a flow to
+// identify its application.
+type applicationInfo struct {
+	Proto   uint8
+	SrcPort uint16
+	DstPort uint16
+	SrcAS   uint32
+	DstAS   uint32
+	SrcAddr string
+	DstAddr string
+}
+
+// applicationClassifierEnvironment defines the environment used by the
+// application classifier
+type applicationClassifierEnvironment struct {
+	Format                   func(string, ...any) string
+	Flow                     applicationInfo
+	InNetwork                func(string, string) (bool, error)
+	ClassifyApplication      classifyStringFunc
+	ClassifyApplicationRegex classifyStringRegexFunc
+}
+
+// exec executes the application classifier with the provided flow.
+func (scr *ApplicationClassifierRule) exec(ai applicationInfo, application *string) error {
+	classifyApplication := func(input string) bool {
+		if *application == "" {
+			*application = strings.TrimSpace(input)
+		}
+		return true
+	}
+	env := applicationClassifierEnvironment{
+		Format:                   format,
+		Flow:                     ai,
+		InNetwork:                inNetwork,
+		ClassifyApplication:      classifyApplication,
+		ClassifyApplicationRegex: withRegex(classifyApplication),
+	}
+	if _, err := expr.Run(scr.program, env); err != nil {
+		return fmt.Errorf("unable to execute classifier %q: %w", scr, err)
+	}
+	return nil
+}
+
+// UnmarshalText compiles a classification rule for the application of a flow.
+func (scr *ApplicationClassifierRule) UnmarshalText(text []byte) error {
+	regexValidator := regexValidator{}
+	program, err := expr.Compile(string(text),
+		expr.Env(applicationClassifierEnvironment{}),
+		expr.AsBool(),
+		expr.Patch(&regexValidator))
+	if err != nil {
+		return fmt.Errorf("cannot compile application classifier rule %q: %w", string(text), err)
+	}
+	if len(regexValidator.invalidRegexes) > 0 {
+		return fmt.Errorf("invalid regular expression %q", regexValidator.invalidRegexes[0])
+	}
+	scr.program = program
+	return nil
+}
+
+// String turns an application classifier rule into a string
+func (scr ApplicationClassifierRule) String() string {
+	return scr.program.Source().Content()
+}
+
+// MarshalText turns an application classifier rule into a string
+func (scr ApplicationClassifierRule) MarshalText() ([]byte, error) {
+	return []byte(scr.String()), nil
+}
+
+// inNetwork tells if the provided IP address belongs to the provided network.
+func inNetwork(addr string, network string) (bool, error) {
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return false, fmt.Errorf("cannot parse network %q: %w", network, err)
+	}
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false, nil
+	}
+	return prefix.Contains(ip), nil
+}
+
 // withRegex turns a function taking a string into a function taking a
 // string to match a regex with, a regex and a template to be expanded
 // with the result of the regex.
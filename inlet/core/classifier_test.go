@@ -230,6 +230,30 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")
 			ExpectedClassification: interfaceClassification{
 				Boundary: schema.InterfaceBoundaryUndefined,
 			},
+		}, {
+			Description: "reject down interface",
+			Program:     `Interface.OperStatus == "down" && Reject()`,
+			InterfaceInfo: interfaceInfo{
+				Name:        "Gi0/0/0",
+				Description: "Transit: Telia (GWDM something something)",
+				Speed:       1000,
+				AdminStatus: "up",
+				OperStatus:  "down",
+			},
+			ExpectedClassification: interfaceClassification{
+				Reject: true,
+			},
+		}, {
+			Description: "do not reject up interface",
+			Program:     `Interface.OperStatus == "down" && Reject()`,
+			InterfaceInfo: interfaceInfo{
+				Name:        "Gi0/0/0",
+				Description: "Transit: Telia (GWDM something something)",
+				Speed:       1000,
+				AdminStatus: "up",
+				OperStatus:  "up",
+			},
+			ExpectedClassification: interfaceClassification{},
 		},
 	}
 	for _, tc := range cases {
@@ -257,6 +281,102 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")
 	}
 }
 
+func TestApplicationClassifier(t *testing.T) {
+	cases := []struct {
+		Description         string
+		Program             string
+		ApplicationInfo     applicationInfo
+		ExpectedApplication string
+		ExpectedErr         bool
+	}{
+		{
+			Description: "trivial classifier",
+			Program:     "false",
+		}, {
+			Description:         "constant classifier",
+			Program:             `ClassifyApplication("YouTube/Google")`,
+			ExpectedApplication: "YouTube/Google",
+		}, {
+			Description: "QUIC from Google",
+			Program:     `Flow.Proto == 17 && Flow.SrcPort == 443 && Flow.SrcAS == 15169 && ClassifyApplication("YouTube/Google")`,
+			ApplicationInfo: applicationInfo{
+				Proto:   17,
+				SrcPort: 443,
+				DstPort: 52344,
+				SrcAS:   15169,
+			},
+			ExpectedApplication: "YouTube/Google",
+		}, {
+			Description: "QUIC from someone else",
+			Program:     `Flow.Proto == 17 && Flow.SrcPort == 443 && Flow.SrcAS == 15169 && ClassifyApplication("YouTube/Google")`,
+			ApplicationInfo: applicationInfo{
+				Proto:   17,
+				SrcPort: 443,
+				DstPort: 52344,
+				SrcAS:   32934,
+			},
+		}, {
+			Description: "classify with network",
+			Program:     `InNetwork(Flow.DstAddr, "192.0.2.0/24") && ClassifyApplication("DNS")`,
+			ApplicationInfo: applicationInfo{
+				DstAddr: "192.0.2.53",
+			},
+			ExpectedApplication: "DNS",
+		}, {
+			Description: "classify with another network",
+			Program:     `InNetwork(Flow.DstAddr, "192.0.2.0/24") && ClassifyApplication("DNS")`,
+			ApplicationInfo: applicationInfo{
+				DstAddr: "2001:db8::53",
+			},
+		}, {
+			Description: "classify with invalid network",
+			Program:     `InNetwork(Flow.DstAddr, "192.0.2.0") && ClassifyApplication("DNS")`,
+			ApplicationInfo: applicationInfo{
+				DstAddr: "192.0.2.53",
+			},
+			ExpectedErr: true,
+		}, {
+			Description: "classify with regex",
+			Program:     `ClassifyApplicationRegex(Format("%d", Flow.DstPort), "^(80|443)$", "Web")`,
+			ApplicationInfo: applicationInfo{
+				DstPort: 443,
+			},
+			ExpectedApplication: "Web",
+		}, {
+			Description:         "first classification wins",
+			Program:             `ClassifyApplication("Netflix") && ClassifyApplication("YouTube")`,
+			ExpectedApplication: "Netflix",
+		}, {
+			Description: "unknown function",
+			Program:     `ClassifyProvider("Telia")`,
+			ExpectedErr: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			var scr ApplicationClassifierRule
+			err := scr.UnmarshalText([]byte(tc.Program))
+			if !tc.ExpectedErr && err != nil {
+				t.Fatalf("UnmarshalText(%q) error:\n%+v", tc.Program, err)
+			}
+			if tc.ExpectedErr && err != nil {
+				return
+			}
+			var gotApplication string
+			err = scr.exec(tc.ApplicationInfo, &gotApplication)
+			if !tc.ExpectedErr && err != nil {
+				t.Fatalf("exec(%q) error:\n%+v", tc.Program, err)
+			}
+			if tc.ExpectedErr && err == nil {
+				t.Fatalf("exec(%q) no error", tc.Program)
+			}
+			if diff := helpers.Diff(gotApplication, tc.ExpectedApplication); diff != "" {
+				t.Fatalf("exec(%q) (-got, +want):\n%s", tc.Program, diff)
+			}
+		})
+	}
+}
+
 func TestRegexValidation(t *testing.T) {
 	cases := []struct {
 		Classifier string
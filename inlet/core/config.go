@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"net/netip"
 	"reflect"
 	"time"
 
@@ -20,20 +21,72 @@ import (
 type Configuration struct {
 	// Number of workers for the core component
 	Workers int `validate:"min=1"`
+	// Site is the name of the site where this inlet is deployed
+	Site string
 	// ExporterClassifiers defines rules for exporter classification
 	ExporterClassifiers []ExporterClassifierRule
 	// InterfaceClassifiers defines rules for interface classification
 	InterfaceClassifiers []InterfaceClassifierRule
+	// ApplicationClassifiers defines rules for application identification
+	ApplicationClassifiers []ApplicationClassifierRule
 	// ClassifierCacheDuration defines the default TTL for classifier cache
 	ClassifierCacheDuration time.Duration `validate:"min=1s"`
 	// DefaultSamplingRate defines the default sampling rate to use when the information is missing
 	DefaultSamplingRate helpers.SubnetMap[uint]
 	// OverrideSamplingRate defines a sampling rate to use instead of the received on
 	OverrideSamplingRate helpers.SubnetMap[uint]
+	// SyntheticInterfaces defines, for each exporter, how to name interfaces
+	// without index or unknown to the metadata providers
+	SyntheticInterfaces helpers.SubnetMap[SyntheticInterfacesConfiguration]
+	// LogicalLinks defines logical links made of interfaces from one or
+	// several exporters, like a multi-chassis LAG
+	LogicalLinks []LogicalLinkConfiguration `validate:"dive"`
 	// ASNProviders defines the source used to get AS numbers
 	ASNProviders []ASNProvider `validate:"dive"`
 	// NetProviders defines the source used to get Prefix/Network Information
 	NetProviders []NetProvider `validate:"dive"`
+	// EnrichmentStages defines the ordered list of enrichment stages to
+	// apply to each flow
+	EnrichmentStages []EnrichmentStage
+	// FlowHooks defines hooks to transform flows
+	FlowHooks []FlowHookRule
+	// FlowHookBudget defines the soft time budget for the execution of a flow
+	// hook. It is checked once the hook has run.
+	FlowHookBudget time.Duration `validate:"min=1us"`
+	// TagRulesFile is the file where the tag rules defined through the API
+	// are saved. When empty, they are lost on restart.
+	TagRulesFile string
+	// Plugins is a list of Go plugins to use to enrich flows
+	Plugins []string
+	// PluginBatchSize is the maximum number of flows given at once to the
+	// plugins
+	PluginBatchSize int `validate:"min=1"`
+	// PluginFlushInterval is the maximum time to wait to complete a batch
+	// of flows for the plugins
+	PluginFlushInterval time.Duration `validate:"min=1ms"`
+	// ExternalEnrichment defines an external service to enrich flows
+	ExternalEnrichment ExternalEnrichmentConfiguration
+	// InventoryInterval defines how often the metadata cache is sent to
+	// Kafka to be stored in ClickHouse. 0 disables this feature.
+	InventoryInterval time.Duration `validate:"eq=0|min=1m"`
+	// ExporterEvents tells to send exporter liveness events from the flow
+	// component to Kafka.
+	ExporterEvents bool
+	// Probes tells to accept the results of latency and loss probes from
+	// external agents on the API and to send them to Kafka to be stored in
+	// ClickHouse.
+	Probes bool
+	// MetadataRetryQueueSize is the maximum number of flows kept while
+	// waiting for the metadata of their interfaces to be polled. 0 means
+	// flows with a metadata cache miss are dropped.
+	MetadataRetryQueueSize int `validate:"min=0"`
+	// MetadataRetryTimeout is the maximum time a flow is kept while waiting
+	// for the metadata of its interfaces to be polled.
+	MetadataRetryTimeout time.Duration `validate:"min=1s"`
+	// Tenants defines per-tenant ingest accounting and quotas.
+	Tenants TenantsConfiguration
+	// Recording defines how to record a sample of enrichment decisions.
+	Recording RecordingConfiguration
 	// Old configuration settings
 	classifierCacheSize uint
 }
@@ -44,12 +97,71 @@ func DefaultConfiguration() Configuration {
 		Workers:                 1,
 		ExporterClassifiers:     []ExporterClassifierRule{},
 		InterfaceClassifiers:    []InterfaceClassifierRule{},
+		ApplicationClassifiers:  []ApplicationClassifierRule{},
 		ClassifierCacheDuration: 5 * time.Minute,
-		ASNProviders:            []ASNProvider{ASNProviderFlow, ASNProviderRouting, ASNProviderGeoIP},
-		NetProviders:            []NetProvider{NetProviderFlow, NetProviderRouting},
+		EnrichmentStages: []EnrichmentStage{
+			EnrichmentStageMetadata,
+			EnrichmentStageClassification,
+			EnrichmentStageRouting,
+			EnrichmentStageGeoIP,
+			EnrichmentStageApplication,
+			EnrichmentStageCustom,
+		},
+		FlowHooks:            []FlowHookRule{},
+		FlowHookBudget:       time.Millisecond,
+		ASNProviders:         []ASNProvider{ASNProviderFlow, ASNProviderRouting, ASNProviderGeoIP},
+		NetProviders:         []NetProvider{NetProviderFlow, NetProviderRouting},
+		PluginBatchSize:      100,
+		PluginFlushInterval:  100 * time.Millisecond,
+		ExternalEnrichment:   DefaultExternalEnrichmentConfiguration(),
+		MetadataRetryTimeout: 10 * time.Second,
+		Tenants:              DefaultTenantsConfiguration(),
+		Recording:            DefaultRecordingConfiguration(),
 	}
 }
 
+// SyntheticInterfacesConfiguration defines the names to give to interfaces
+// without a name.
+type SyntheticInterfacesConfiguration struct {
+	// Local is the name of the interface with index 0, usually the exporter
+	// itself. When empty, no name is given.
+	Local string
+	// UnknownPrefix is the prefix of the name of the interfaces unknown to
+	// the metadata providers. The interface index is appended. When empty,
+	// no name is given.
+	UnknownPrefix string
+}
+
+// name returns the name of the interface with the provided index and name.
+func (sic SyntheticInterfacesConfiguration) name(ifIndex uint32, name string) string {
+	switch {
+	case name != "":
+		return name
+	case ifIndex == 0:
+		return sic.Local
+	case sic.UnknownPrefix != "":
+		return fmt.Sprintf("%s%d", sic.UnknownPrefix, ifIndex)
+	}
+	return ""
+}
+
+// LogicalLinkConfiguration defines a logical link and its member interfaces.
+type LogicalLinkConfiguration struct {
+	// Name is the name of the logical link
+	Name string `validate:"required"`
+	// Members are the interfaces composing the logical link
+	Members []LogicalLinkMember `validate:"min=1,dive"`
+}
+
+// LogicalLinkMember is an interface of an exporter belonging to a logical
+// link.
+type LogicalLinkMember struct {
+	// Exporter is the IP address of the exporter
+	Exporter netip.Addr
+	// Interface is the name of the interface
+	Interface string `validate:"required"`
+}
+
 type (
 	// ASNProvider describes one AS number provider.
 	ASNProvider int
@@ -190,4 +302,5 @@ func ConfigurationUnmarshallerHook() mapstructure.DecodeHookFunc {
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(ConfigurationUnmarshallerHook())
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[uint]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[SyntheticInterfacesConfiguration]())
 }
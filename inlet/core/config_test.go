@@ -4,6 +4,7 @@
 package core
 
 import (
+	"net/netip"
 	"testing"
 
 	"akvorado/common/helpers"
@@ -112,6 +113,34 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 				NetProviders: []NetProvider{NetProviderFlow, NetProviderRouting},
 			},
 			SkipValidation: true,
+		}, {
+			Description: "logical-links",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"logical-links": []gin.H{
+						{
+							"name": "transit-1",
+							"members": []gin.H{
+								{"exporter": "192.0.2.1", "interface": "Gi0/0/1"},
+								{"exporter": "192.0.2.2", "interface": "Gi0/0/1"},
+							},
+						},
+					},
+				}
+			},
+			Expected: Configuration{
+				LogicalLinks: []LogicalLinkConfiguration{
+					{
+						Name: "transit-1",
+						Members: []LogicalLinkMember{
+							{Exporter: netip.MustParseAddr("192.0.2.1"), Interface: "Gi0/0/1"},
+							{Exporter: netip.MustParseAddr("192.0.2.2"), Interface: "Gi0/0/1"},
+						},
+					},
+				},
+			},
+			SkipValidation: true,
 		},
 	})
 }
@@ -119,4 +148,28 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 func TestMarshalUnmarshal(t *testing.T) {
 	asnProviderMap.TestMarshalUnmarshal(t)
 	netProviderMap.TestMarshalUnmarshal(t)
+	enrichmentStageMap.TestMarshalUnmarshal(t)
+}
+
+func TestCheckEnrichmentStages(t *testing.T) {
+	cases := []struct {
+		Stages []EnrichmentStage
+		Error  bool
+	}{
+		{DefaultConfiguration().EnrichmentStages, false},
+		{[]EnrichmentStage{}, false},
+		{[]EnrichmentStage{EnrichmentStageGeoIP, EnrichmentStageRouting}, false},
+		{[]EnrichmentStage{EnrichmentStageRouting, EnrichmentStageMetadata, EnrichmentStageCustom}, false},
+		{[]EnrichmentStage{EnrichmentStageGeoIP, EnrichmentStageGeoIP}, true},
+		{[]EnrichmentStage{EnrichmentStageClassification, EnrichmentStageMetadata}, true},
+		{[]EnrichmentStage{EnrichmentStageMetadata, EnrichmentStageCustom, EnrichmentStageMetadata}, true},
+	}
+	for _, tc := range cases {
+		err := checkEnrichmentStages(tc.Stages)
+		if err == nil && tc.Error {
+			t.Errorf("checkEnrichmentStages(%v) did not error", tc.Stages)
+		} else if err != nil && !tc.Error {
+			t.Errorf("checkEnrichmentStages(%v) error:\n%+v", tc.Stages, err)
+		}
+	}
 }
@@ -0,0 +1,74 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// customDimension is a custom dimension defined in the schema with its
+// compiled expression.
+type customDimension struct {
+	name    string
+	program *vm.Program
+}
+
+// customDimensionEnvironment defines the environment used by custom
+// dimensions.
+type customDimensionEnvironment struct {
+	Format    func(string, ...any) string
+	InNetwork func(string, string) (bool, error)
+	Flow      flowHookInfo
+}
+
+// initCustomDimensions compiles the expressions of the custom dimensions
+// defined in the schema.
+func (c *Component) initCustomDimensions() error {
+	for _, d := range c.d.Schema.GetCustomDimensionsConfig() {
+		counter := nodeCounter{}
+		program, err := expr.Compile(d.Expression,
+			expr.Env(customDimensionEnvironment{}),
+			expr.Patch(&counter))
+		if err != nil {
+			return fmt.Errorf("cannot compile expression for custom dimension %s: %w", d.Name, err)
+		}
+		if counter.count > maxFlowHookNodes {
+			return fmt.Errorf("expression for custom dimension %s is too complex (%d nodes, maximum is %d)",
+				d.Name, counter.count, maxFlowHookNodes)
+		}
+		c.customDimensions = append(c.customDimensions, customDimension{
+			name:    d.Name,
+			program: program,
+		})
+	}
+	return nil
+}
+
+// computeCustomDimensions evaluates the custom dimensions and appends the
+// result to the flow. A nil result leaves the dimension empty.
+func (c *Component) computeCustomDimensions(exporterStr string, state *flowHookState) {
+	env := customDimensionEnvironment{
+		Format:    format,
+		InNetwork: inNetwork,
+		Flow:      state.info(c.d.Schema),
+	}
+	for idx, d := range c.customDimensions {
+		result, err := expr.Run(d.program, env)
+		if err == nil && result != nil {
+			err = c.annotate(state.flow, d.name, fmt.Sprint(result))
+		}
+		if err != nil {
+			c.classifierErrLogger.Err(err).
+				Str("type", "dimension").
+				Str("dimension", d.name).
+				Str("exporter", exporterStr).
+				Msg("error computing custom dimension")
+			c.metrics.classifierErrors.WithLabelValues("dimension", strconv.Itoa(idx)).Inc()
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestCustomDimensions(t *testing.T) {
+	r := reporter.NewMock(t)
+	schemaConfiguration := schema.DefaultConfiguration()
+	schemaConfiguration.CustomDimensions = []schema.CustomDimension{
+		{
+			Name:       "CustomerID",
+			Type:       "String",
+			Expression: `Flow.InIfBoundary == "external" ? Format("AS%d", Flow.SrcAS) : nil`,
+		}, {
+			Name:       "TrafficClass",
+			Type:       "UInt8",
+			Expression: `Flow.Proto == 6 && Flow.DstPort == 443 ? 1 : (InNetwork(Flow.DstAddr, "203.0.113.0/24") ? 2 : 0)`,
+		}, {
+			Name:       "BrokenClass",
+			Type:       "UInt8",
+			Expression: `"not a number"`,
+		},
+	}
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	flow := &schema.FlowMessage{
+		ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+		SrcAddr:         netip.MustParseAddr("::ffff:198.51.100.10"),
+		DstAddr:         netip.MustParseAddr("::ffff:203.0.113.10"),
+		SrcAS:           64501,
+	}
+	sch.ProtobufAppendVarint(flow, schema.ColumnProto, 17)
+	sch.ProtobufAppendVarint(flow, schema.ColumnDstPort, 443)
+	var exporterName string
+	var inIfSpeed, outIfSpeed uint32
+	exporter := exporterClassification{}
+	inIf := interfaceClassification{Boundary: schema.InterfaceBoundaryExternal}
+	outIf := interfaceClassification{}
+	c.computeCustomDimensions("192.0.2.142", &flowHookState{
+		flow:         flow,
+		exporterName: &exporterName,
+		exporter:     &exporter,
+		inIfSpeed:    &inIfSpeed,
+		outIfSpeed:   &outIfSpeed,
+		inIf:         &inIf,
+		outIf:        &outIf,
+	})
+
+	customerID, _ := sch.LookupColumnByName("CustomerID")
+	trafficClass, _ := sch.LookupColumnByName("TrafficClass")
+	expected := map[schema.ColumnKey]interface{}{
+		schema.ColumnProto:   17,
+		schema.ColumnDstPort: 443,
+		customerID.Key:       []byte("AS64501"),
+		trafficClass.Key:     2,
+	}
+	if diff := helpers.Diff(flow.ProtobufDebug, expected); diff != "" {
+		t.Fatalf("computeCustomDimensions() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "classifier_errors_")
+	expectedMetrics := map[string]string{
+		`classifier_errors_total{index="2",type="dimension"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCustomDimensionsInvalidExpression(t *testing.T) {
+	schemaConfiguration := schema.DefaultConfiguration()
+	schemaConfiguration.CustomDimensions = []schema.CustomDimension{
+		{Name: "CustomerID", Type: "String", Expression: `Flow.Unknown`},
+	}
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	if _, err := New(reporter.NewMock(t), DefaultConfiguration(), Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: sch,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -5,87 +5,131 @@ package core
 
 import (
 	"context"
+	"errors"
 	"net/netip"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"google.golang.org/protobuf/reflect/protoreflect"
+
 	"akvorado/common/schema"
+	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/pipeline"
+	routing "akvorado/inlet/routing/provider"
+)
+
+var (
+	errUnknownColumn = errors.New("unknown column")
+	errInvalidValue  = errors.New("invalid value")
 )
 
+// parkFlow parks a flow whose interfaces are missing from the metadata cache.
+// It is sent back to the workers once they have been polled. It returns false
+// when the retry queue is full or disabled.
+func (c *Component) parkFlow(exporterIP netip.Addr, exporterStr string, ifIndexes []uint, flow *schema.FlowMessage) bool {
+	if c.parkedFlows.Add(1) > int64(c.config.MetadataRetryQueueSize) {
+		c.parkedFlows.Add(-1)
+		return false
+	}
+	c.metrics.flowsParked.WithLabelValues(exporterStr).Inc()
+	c.d.Metadata.Notify(exporterIP, ifIndexes, c.config.MetadataRetryTimeout, func() {
+		// Cannot block as the channel can hold all the parked flows
+		c.retryChannel <- flow
+	})
+	return true
+}
+
 // exporterAndInterfaceInfo aggregates both exporter info and interface info
 type exporterAndInterfaceInfo struct {
 	Exporter  exporterInfo
 	Interface interfaceInfo
 }
 
-// enrichFlow adds more data to a flow.
-func (c *Component) enrichFlow(exporterIP netip.Addr, exporterStr string, flow *schema.FlowMessage) (skip bool) {
-	var flowExporterName string
-	var flowInIfName, flowInIfDescription, flowOutIfName, flowOutIfDescription string
-	var flowInIfSpeed, flowOutIfSpeed, flowInIfIndex, flowOutIfIndex uint32
-	var flowInIfVlan, flowOutIfVlan uint16
+// enrichedInterface is the information about an interface collected during
+// enrichment.
+type enrichedInterface struct {
+	index          uint32
+	name           string
+	description    string
+	speed          uint32
+	vlan           uint16
+	adminStatus    string
+	operStatus     string
+	classification interfaceClassification
+}
 
-	t := time.Now() // only call it once
-	expClassification := exporterClassification{}
-	inIfClassification := interfaceClassification{}
-	outIfClassification := interfaceClassification{}
+// enrichState is the state of a flow being enriched. It is shared by the
+// enrichment stages.
+type enrichState struct {
+	t            time.Time
+	exporterIP   netip.Addr
+	exporterStr  string
+	flow         *schema.FlowMessage
+	retry        bool
+	exporterName string
+	exporter     exporterClassification
+	inIf         enrichedInterface
+	outIf        enrichedInterface
+	classified   bool // interface classification was done
+	parked       bool // the flow was parked waiting for metadata
+	dropStage    pipeline.Stage
+	lookups      *EnrichmentLookups // answers to record or to replay
+	replay       bool               // use the answers from lookups
+}
 
-	if flow.InIf != 0 {
-		answer, ok := c.d.Metadata.Lookup(t, exporterIP, uint(flow.InIf))
-		if !ok {
-			c.metrics.flowsErrors.WithLabelValues(exporterStr, "SNMP cache miss").Inc()
-			skip = true
-		} else {
-			flowExporterName = answer.Exporter.Name
-			expClassification.Region = answer.Exporter.Region
-			expClassification.Role = answer.Exporter.Role
-			expClassification.Tenant = answer.Exporter.Tenant
-			expClassification.Site = answer.Exporter.Site
-			expClassification.Group = answer.Exporter.Group
-			flowInIfIndex = flow.InIf
-			flowInIfName = answer.Interface.Name
-			flowInIfDescription = answer.Interface.Description
-			flowInIfSpeed = uint32(answer.Interface.Speed)
-			inIfClassification.Provider = answer.Interface.Provider
-			inIfClassification.Connectivity = answer.Interface.Connectivity
-			inIfClassification.Boundary = answer.Interface.Boundary
-			flowInIfVlan = flow.SrcVlan
-		}
+// interfaceNames copies the interface names and descriptions into their
+// classifications when the interfaces were not classified.
+func (st *enrichState) interfaceNames() {
+	if st.classified {
+		return
 	}
+	st.inIf.classification.Name = st.inIf.name
+	st.inIf.classification.Description = st.inIf.description
+	st.outIf.classification.Name = st.outIf.name
+	st.outIf.classification.Description = st.outIf.description
+	st.classified = true
+}
 
-	if flow.OutIf != 0 {
-		answer, ok := c.d.Metadata.Lookup(t, exporterIP, uint(flow.OutIf))
-		if !ok {
-			// Only register a cache miss if we don't have one.
-			// TODO: maybe we could do one SNMP query for both interfaces.
+// enrichFlow adds more data to a flow by running it through the configured
+// enrichment stages. When the metadata of the interfaces is not in the cache,
+// the flow may be parked until they are polled. It is then enriched again
+// with retry set to true. The tenant of the exporter is returned.
+func (c *Component) enrichFlow(exporterIP netip.Addr, exporterStr string, flow *schema.FlowMessage, retry bool) (tenant string, skip bool) {
+	st := enrichState{
+		t:           time.Now(), // only call it once
+		exporterIP:  exporterIP,
+		exporterStr: exporterStr,
+		flow:        flow,
+		retry:       retry,
+		dropStage:   pipeline.StageEnrichment,
+	}
+	defer func() {
+		if skip && !st.parked {
+			c.drops.Add(st.dropStage, 1)
+		}
+	}()
+	if c.recorder.sample() {
+		input := flow.Clone()
+		st.lookups = &EnrichmentLookups{}
+		defer func() {
+			if st.parked {
+				return
+			}
+			var output *schema.FlowMessage
 			if !skip {
-				c.metrics.flowsErrors.WithLabelValues(exporterStr, "SNMP cache miss").Inc()
-				skip = true
+				output = flow.Clone()
 			}
-		} else {
-			flowExporterName = answer.Exporter.Name
-			expClassification.Region = answer.Exporter.Region
-			expClassification.Role = answer.Exporter.Role
-			expClassification.Tenant = answer.Exporter.Tenant
-			expClassification.Site = answer.Exporter.Site
-			expClassification.Group = answer.Exporter.Group
-			flowOutIfIndex = flow.OutIf
-			flowOutIfName = answer.Interface.Name
-			flowOutIfDescription = answer.Interface.Description
-			flowOutIfSpeed = uint32(answer.Interface.Speed)
-			outIfClassification.Provider = answer.Interface.Provider
-			outIfClassification.Connectivity = answer.Interface.Connectivity
-			outIfClassification.Boundary = answer.Interface.Boundary
-			flowOutIfVlan = flow.DstVlan
-		}
-	}
-
-	// We need at least one of them.
-	if flow.OutIf == 0 && flow.InIf == 0 {
-		c.metrics.flowsErrors.WithLabelValues(exporterStr, "input and output interfaces missing").Inc()
-		skip = true
+			c.record(input, st.lookups, output)
+		}()
 	}
+	return c.enrich(&st)
+}
 
+// enrich runs the enrichment stages for the provided state.
+func (c *Component) enrich(st *enrichState) (tenant string, skip bool) {
+	flow, exporterIP, exporterStr := st.flow, st.exporterIP, st.exporterStr
 	if samplingRate, ok := c.config.OverrideSamplingRate.Lookup(exporterIP); ok && samplingRate > 0 {
 		flow.SamplingRate = uint32(samplingRate)
 	}
@@ -94,29 +138,160 @@ func (c *Component) enrichFlow(exporterIP netip.Addr, exporterStr string, flow *
 			flow.SamplingRate = uint32(samplingRate)
 		} else {
 			c.metrics.flowsErrors.WithLabelValues(exporterStr, "sampling rate missing").Inc()
-			skip = true
+			return "", true
 		}
 	}
 
-	if skip {
-		return
+	start := st.t
+	for _, stage := range c.config.EnrichmentStages {
+		var stageSkip bool
+		switch stage {
+		case EnrichmentStageMetadata:
+			stageSkip = c.enrichWithMetadata(st)
+		case EnrichmentStageClassification:
+			stageSkip = c.enrichWithClassification(st)
+		case EnrichmentStageRouting:
+			c.enrichWithRouting(st)
+		case EnrichmentStageGeoIP:
+			c.enrichWithGeoIP(st)
+		case EnrichmentStageApplication:
+			c.enrichWithApplication(st)
+		case EnrichmentStageCustom:
+			stageSkip = c.enrichWithCustom(st)
+		}
+		end := time.Now()
+		stageStr := stage.String()
+		c.metrics.enrichmentStageTimes.WithLabelValues(stageStr).Observe(end.Sub(start).Seconds())
+		start = end
+		if stageSkip {
+			if !st.parked {
+				c.metrics.enrichmentStageErrors.WithLabelValues(stageStr).Inc()
+			}
+			return "", true
+		}
 	}
 
-	// Classification
-	if !c.classifyExporter(t, exporterStr, flowExporterName, flow, expClassification) ||
-		!c.classifyInterface(t, exporterStr, flowExporterName, flow,
-			flowOutIfIndex, flowOutIfName, flowOutIfDescription, flowOutIfSpeed, flowOutIfVlan, outIfClassification,
-			false) ||
-		!c.classifyInterface(t, exporterStr, flowExporterName, flow,
-			flowInIfIndex, flowInIfName, flowInIfDescription, flowInIfSpeed, flowInIfVlan, inIfClassification,
-			true) {
-		// Flow is rejected
+	st.interfaceNames()
+	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnInletSite, []byte(c.config.Site))
+	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterName, []byte(st.exporterName))
+	c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnInIfSpeed, uint64(st.inIf.speed))
+	c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnOutIfSpeed, uint64(st.outIf.speed))
+	c.writeExporter(flow, st.exporter)
+	c.writeInterface(flow, st.outIf.classification, false)
+	c.writeInterface(flow, st.inIf.classification, true)
+	c.writeLogicalLinks(st)
+
+	return st.exporter.Tenant, false
+}
+
+// enrichWithMetadata looks up the exporter and its interfaces in the metadata
+// cache. It returns true if the flow should be skipped.
+func (c *Component) enrichWithMetadata(st *enrichState) (skip bool) {
+	flow := st.flow
+	// Lookup all the interfaces at once. When both interfaces are missing,
+	// lookup the exporter only, unless local interfaces are not named.
+	synthetic, hasSynthetic := c.config.SyntheticInterfaces.Lookup(st.exporterIP)
+	ifIndexes := make([]uint, 0, 2)
+	if flow.InIf != 0 {
+		ifIndexes = append(ifIndexes, uint(flow.InIf))
+	}
+	if flow.OutIf != 0 {
+		ifIndexes = append(ifIndexes, uint(flow.OutIf))
+	}
+	if len(ifIndexes) == 0 {
+		if synthetic.Local == "" {
+			c.metrics.flowsErrors.WithLabelValues(st.exporterStr, "input and output interfaces missing").Inc()
+			return true
+		}
+		ifIndexes = append(ifIndexes, 0)
+	}
+	bytes, _ := c.d.Schema.ProtobufVarint(flow, schema.ColumnBytes)
+	volume := bytes * uint64(max(flow.SamplingRate, 1))
+	answers, ok := c.lookupMetadata(st, ifIndexes, volume)
+	if !ok {
+		if !st.retry && c.parkFlow(st.exporterIP, st.exporterStr, ifIndexes, flow) {
+			st.parked = true
+			return true
+		}
+		// Only register one cache miss per flow.
+		c.metrics.flowsErrors.WithLabelValues(st.exporterStr, "SNMP cache miss").Inc()
+		st.dropStage = pipeline.StageMetadataMiss
 		return true
 	}
 
-	ctx := c.t.Context(context.Background())
-	sourceRouting := c.d.Routing.Lookup(ctx, flow.SrcAddr, netip.Addr{}, flow.ExporterAddress)
-	destRouting := c.d.Routing.Lookup(ctx, flow.DstAddr, flow.NextHop, flow.ExporterAddress)
+	answer := answers[0]
+	st.exporterName = answer.Exporter.Name
+	st.exporter.Region = answer.Exporter.Region
+	st.exporter.Role = answer.Exporter.Role
+	st.exporter.Tenant = answer.Exporter.Tenant
+	st.exporter.Site = answer.Exporter.Site
+	st.exporter.Group = answer.Exporter.Group
+	fill := func(iface *enrichedInterface, ifIndex uint32, vlan uint16, answer provider.Answer) {
+		iface.index = ifIndex
+		iface.name = answer.Interface.Name
+		iface.description = answer.Interface.Description
+		iface.speed = uint32(answer.Interface.Speed)
+		iface.adminStatus = answer.Interface.AdminStatus.String()
+		iface.operStatus = answer.Interface.OperStatus.String()
+		iface.classification.Provider = answer.Interface.Provider
+		iface.classification.Connectivity = answer.Interface.Connectivity
+		iface.classification.Boundary = answer.Interface.Boundary
+		iface.vlan = vlan
+	}
+	if flow.InIf != 0 {
+		answer, answers = answers[0], answers[1:]
+		fill(&st.inIf, flow.InIf, flow.SrcVlan, answer)
+	}
+	if flow.OutIf != 0 {
+		fill(&st.outIf, flow.OutIf, flow.DstVlan, answers[0])
+	}
+	if hasSynthetic {
+		st.inIf.name = synthetic.name(flow.InIf, st.inIf.name)
+		st.outIf.name = synthetic.name(flow.OutIf, st.outIf.name)
+	}
+	return false
+}
+
+// lookupMetadata returns the answers of the metadata component for the
+// provided interfaces. The answers are recorded or replayed when requested.
+// It returns false if some interfaces are missing from the cache.
+func (c *Component) lookupMetadata(st *enrichState, ifIndexes []uint, volume uint64) ([]provider.Answer, bool) {
+	if st.replay {
+		return st.lookups.Metadata, len(st.lookups.Metadata) == len(ifIndexes)
+	}
+	answers, found := c.d.Metadata.LookupMany(st.t, st.exporterIP, ifIndexes, volume)
+	if slices.Contains(found, false) {
+		return nil, false
+	}
+	if st.lookups != nil {
+		st.lookups.Metadata = answers
+	}
+	return answers, true
+}
+
+// enrichWithClassification classifies the exporter and its interfaces. It
+// returns true if the flow should be skipped.
+func (c *Component) enrichWithClassification(st *enrichState) (skip bool) {
+	if st.exporter = c.classifyExporter(st.t, st.exporterStr, st.exporterName, st.exporter); st.exporter.Reject {
+		return true
+	}
+	for _, iface := range []*enrichedInterface{&st.outIf, &st.inIf} {
+		if iface.classification = c.classifyInterface(st.t, st.exporterStr, st.exporterName,
+			iface.index, iface.name, iface.description, iface.speed, iface.vlan,
+			iface.adminStatus, iface.operStatus,
+			iface.classification); iface.classification.Reject {
+			return true
+		}
+	}
+	st.classified = true
+	return false
+}
+
+// enrichWithRouting adds the routing information (prefix lengths, next hop,
+// AS numbers, communities, AS path) to the flow.
+func (c *Component) enrichWithRouting(st *enrichState) {
+	flow := st.flow
+	sourceRouting, destRouting := c.lookupRouting(st)
 
 	// set prefix len according to user config
 	flow.SrcNetMask = c.getNetMask(flow.SrcNetMask, sourceRouting.NetMask)
@@ -128,8 +303,6 @@ func (c *Component) enrichFlow(exporterIP netip.Addr, exporterStr string, flow *
 	// set asns according to user config
 	flow.SrcAS = c.getASNumber(flow.SrcAddr, flow.SrcAS, sourceRouting.ASN)
 	flow.DstAS = c.getASNumber(flow.DstAddr, flow.DstAS, destRouting.ASN)
-	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnSrcCountry, []byte(c.d.GeoIP.LookupCountry(flow.SrcAddr)))
-	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnDstCountry, []byte(c.d.GeoIP.LookupCountry(flow.DstAddr)))
 	for _, comm := range destRouting.Communities {
 		c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnDstCommunities, uint64(comm))
 	}
@@ -146,12 +319,69 @@ func (c *Component) enrichFlow(exporterIP netip.Addr, exporterStr string, flow *
 		c.d.Schema.ProtobufAppendVarintForce(flow,
 			schema.ColumnDstLargeCommunitiesLocalData2, uint64(comm.LocalData2))
 	}
+}
+
+// lookupRouting returns the routing information for the source and the
+// destination of the flow. They are recorded or replayed when requested.
+func (c *Component) lookupRouting(st *enrichState) (routing.LookupResult, routing.LookupResult) {
+	if st.replay {
+		var src, dst routing.LookupResult
+		if st.lookups.SrcRouting != nil {
+			src = *st.lookups.SrcRouting
+		}
+		if st.lookups.DstRouting != nil {
+			dst = *st.lookups.DstRouting
+		}
+		return src, dst
+	}
+	flow := st.flow
+	ctx := c.t.Context(context.Background())
+	src := c.d.Routing.Lookup(ctx, flow.SrcAddr, netip.Addr{}, flow.ExporterAddress)
+	dst := c.d.Routing.Lookup(ctx, flow.DstAddr, flow.NextHop, flow.ExporterAddress)
+	if st.lookups != nil {
+		st.lookups.SrcRouting, st.lookups.DstRouting = &src, &dst
+	}
+	return src, dst
+}
 
-	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterName, []byte(flowExporterName))
-	c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnInIfSpeed, uint64(flowInIfSpeed))
-	c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnOutIfSpeed, uint64(flowOutIfSpeed))
+// enrichWithGeoIP adds the countries to the flow.
+func (c *Component) enrichWithGeoIP(st *enrichState) {
+	c.d.Schema.ProtobufAppendBytes(st.flow, schema.ColumnSrcCountry, []byte(c.d.GeoIP.LookupCountry(st.flow.SrcAddr)))
+	c.d.Schema.ProtobufAppendBytes(st.flow, schema.ColumnDstCountry, []byte(c.d.GeoIP.LookupCountry(st.flow.DstAddr)))
+}
 
-	return
+// enrichWithApplication adds the application to the flow.
+func (c *Component) enrichWithApplication(st *enrichState) {
+	c.d.Schema.ProtobufAppendBytes(st.flow, schema.ColumnApplication,
+		[]byte(c.classifyApplication(st.exporterStr, st.flow)))
+}
+
+// enrichWithCustom runs the flow hooks, computes the custom dimensions and
+// applies the tag rules. It returns true if the flow should be skipped.
+func (c *Component) enrichWithCustom(st *enrichState) (skip bool) {
+	tagRules := *c.tagRules.Load()
+	if len(c.config.FlowHooks) > 0 || len(c.customDimensions) > 0 || len(tagRules) > 0 {
+		st.interfaceNames()
+		state := flowHookState{
+			flow:         st.flow,
+			exporterName: &st.exporterName,
+			exporter:     &st.exporter,
+			inIfSpeed:    &st.inIf.speed,
+			outIfSpeed:   &st.outIf.speed,
+			inIf:         &st.inIf.classification,
+			outIf:        &st.outIf.classification,
+		}
+		if c.runFlowHooks(st.exporterStr, &state); state.reject {
+			return true
+		}
+		if len(c.customDimensions) > 0 {
+			c.computeCustomDimensions(st.exporterStr, &state)
+		}
+		if len(tagRules) > 0 {
+			c.applyTagRules(st.exporterStr, &state, tagRules)
+		}
+	}
+	return false
 }
 
 // getASNumber retrieves the AS number for a flow, depending on user preferences.
@@ -214,29 +444,25 @@ func (c *Component) getNextHop(flowNextHop netip.Addr, bmpNextHop netip.Addr) (n
 	return nextHop
 }
 
-func (c *Component) writeExporter(flow *schema.FlowMessage, classification exporterClassification) bool {
-	if classification.Reject {
-		return false
-	}
+func (c *Component) writeExporter(flow *schema.FlowMessage, classification exporterClassification) {
 	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterGroup, []byte(classification.Group))
 	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterRole, []byte(classification.Role))
 	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterSite, []byte(classification.Site))
 	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterRegion, []byte(classification.Region))
 	c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnExporterTenant, []byte(classification.Tenant))
-	return true
 }
 
-func (c *Component) classifyExporter(t time.Time, ip string, name string, flow *schema.FlowMessage, classification exporterClassification) bool {
+func (c *Component) classifyExporter(t time.Time, ip string, name string, classification exporterClassification) exporterClassification {
 	// we already have the info provided by the metadata component
 	if (classification != exporterClassification{}) {
-		return c.writeExporter(flow, classification)
+		return classification
 	}
 	if len(c.config.ExporterClassifiers) == 0 {
-		return true
+		return classification
 	}
 	si := exporterInfo{IP: ip, Name: name}
 	if classification, ok := c.classifierExporterCache.Get(t, si); ok {
-		return c.writeExporter(flow, classification)
+		return classification
 	}
 
 	for idx, rule := range c.config.ExporterClassifiers {
@@ -255,13 +481,47 @@ func (c *Component) classifyExporter(t time.Time, ip string, name string, flow *
 		break
 	}
 	c.classifierExporterCache.Put(t, si, classification)
-	return c.writeExporter(flow, classification)
+	return classification
 }
 
-func (c *Component) writeInterface(flow *schema.FlowMessage, classification interfaceClassification, directionIn bool) bool {
-	if classification.Reject {
-		return false
+// classifyApplication identifies the application of a flow using the
+// application classifiers. As the result depends on addresses, it is not
+// cached.
+func (c *Component) classifyApplication(exporterStr string, flow *schema.FlowMessage) string {
+	if len(c.config.ApplicationClassifiers) == 0 {
+		return ""
+	}
+	proto, _ := c.d.Schema.ProtobufVarint(flow, schema.ColumnProto)
+	srcPort, _ := c.d.Schema.ProtobufVarint(flow, schema.ColumnSrcPort)
+	dstPort, _ := c.d.Schema.ProtobufVarint(flow, schema.ColumnDstPort)
+	ai := applicationInfo{
+		Proto:   uint8(proto),
+		SrcPort: uint16(srcPort),
+		DstPort: uint16(dstPort),
+		SrcAS:   flow.SrcAS,
+		DstAS:   flow.DstAS,
+		SrcAddr: flow.SrcAddr.Unmap().String(),
+		DstAddr: flow.DstAddr.Unmap().String(),
+	}
+	var application string
+	for idx, rule := range c.config.ApplicationClassifiers {
+		if err := rule.exec(ai, &application); err != nil {
+			c.classifierErrLogger.Err(err).
+				Str("type", "application").
+				Int("index", idx).
+				Str("exporter", exporterStr).
+				Msg("error executing classifier")
+			c.metrics.classifierErrors.WithLabelValues("application", strconv.Itoa(idx)).Inc()
+			break
+		}
+		if application != "" {
+			break
+		}
 	}
+	return application
+}
+
+func (c *Component) writeInterface(flow *schema.FlowMessage, classification interfaceClassification, directionIn bool) {
 	if directionIn {
 		c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnInIfName, []byte(classification.Name))
 		c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnInIfDescription, []byte(classification.Description))
@@ -275,33 +535,31 @@ func (c *Component) writeInterface(flow *schema.FlowMessage, classification inte
 		c.d.Schema.ProtobufAppendBytes(flow, schema.ColumnOutIfProvider, []byte(classification.Provider))
 		c.d.Schema.ProtobufAppendVarint(flow, schema.ColumnOutIfBoundary, uint64(classification.Boundary))
 	}
-	return true
 }
 
 func (c *Component) classifyInterface(
 	t time.Time,
 	ip string,
 	exporterName string,
-	fl *schema.FlowMessage,
 	ifIndex uint32,
 	ifName,
 	ifDescription string,
 	ifSpeed uint32,
 	ifVlan uint16,
+	ifAdminStatus,
+	ifOperStatus string,
 	classification interfaceClassification,
-	directionIn bool,
-) bool {
+) interfaceClassification {
 	// we already have the info provided by the metadata component
 	if (classification != interfaceClassification{}) {
 		classification.Name = ifName
 		classification.Description = ifDescription
-		return c.writeInterface(fl, classification, directionIn)
+		return classification
 	}
 	if len(c.config.InterfaceClassifiers) == 0 {
 		classification.Name = ifName
 		classification.Description = ifDescription
-		c.writeInterface(fl, classification, directionIn)
-		return true
+		return classification
 	}
 	si := exporterInfo{IP: ip, Name: exporterName}
 	ii := interfaceInfo{
@@ -310,13 +568,15 @@ func (c *Component) classifyInterface(
 		Description: ifDescription,
 		Speed:       ifSpeed,
 		VLAN:        ifVlan,
+		AdminStatus: ifAdminStatus,
+		OperStatus:  ifOperStatus,
 	}
 	key := exporterAndInterfaceInfo{
 		Exporter:  si,
 		Interface: ii,
 	}
 	if classification, ok := c.classifierInterfaceCache.Get(t, key); ok {
-		return c.writeInterface(fl, classification, directionIn)
+		return classification
 	}
 
 	for idx, rule := range c.config.InterfaceClassifiers {
@@ -346,7 +606,37 @@ func (c *Component) classifyInterface(
 		classification.Description = ifDescription
 	}
 	c.classifierInterfaceCache.Put(t, key, classification)
-	return c.writeInterface(fl, classification, directionIn)
+	return classification
+}
+
+// annotate sets the provided column to the provided value, encoded as a
+// string.
+func (c *Component) annotate(flow *schema.FlowMessage, name, value string) error {
+	column, ok := c.d.Schema.LookupColumnByName(name)
+	if !ok || column.Disabled || column.ProtobufIndex <= 0 {
+		return errUnknownColumn
+	}
+	switch column.ProtobufType {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		column.ProtobufAppendBytes(flow, []byte(value))
+	case protoreflect.Uint32Kind, protoreflect.Uint64Kind:
+		v, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return errInvalidValue
+		}
+		column.ProtobufAppendVarint(flow, v)
+	case protoreflect.EnumKind:
+		for k, v := range column.ProtobufEnum {
+			if strings.EqualFold(v, value) {
+				column.ProtobufAppendVarint(flow, uint64(k))
+				return nil
+			}
+		}
+		return errInvalidValue
+	default:
+		return errUnknownColumn
+	}
+	return nil
 }
 
 func isPrivateAS(as uint32) bool {
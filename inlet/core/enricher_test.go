@@ -29,10 +29,37 @@ func TestEnrich(t *testing.T) {
 	cases := []struct {
 		Name          string
 		Configuration gin.H
+		Columns       []schema.ColumnKey
 		InputFlow     func() *schema.FlowMessage
 		OutputFlow    *schema.FlowMessage
 	}{
 		{
+			Name:          "inlet site",
+			Configuration: gin.H{"site": "par1"},
+			Columns:       []schema.ColumnKey{schema.ColumnInletSite},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &schema.FlowMessage{
+				SamplingRate:    1000,
+				ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnInletSite:        "par1",
+					schema.ColumnExporterName:     "192_0_2_142",
+					schema.ColumnInIfName:         "Gi0/0/100",
+					schema.ColumnOutIfName:        "Gi0/0/200",
+					schema.ColumnInIfDescription:  "Interface 100",
+					schema.ColumnOutIfDescription: "Interface 200",
+					schema.ColumnInIfSpeed:        1000,
+					schema.ColumnOutIfSpeed:       1000,
+				},
+			},
+		}, {
 			Name:          "no rule",
 			Configuration: gin.H{},
 			InputFlow: func() *schema.FlowMessage {
@@ -56,6 +83,48 @@ func TestEnrich(t *testing.T) {
 					schema.ColumnOutIfSpeed:       1000,
 				},
 			},
+		}, {
+			Name: "synthetic interfaces",
+			Configuration: gin.H{"syntheticinterfaces": gin.H{
+				"192.0.2.0/24": gin.H{"local": "local", "unknownprefix": "unknown-"},
+			}},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+					InIf:            0,
+					OutIf:           999,
+				}
+			},
+			OutputFlow: &schema.FlowMessage{
+				SamplingRate:    1000,
+				ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnExporterName: "192_0_2_142",
+					schema.ColumnInIfName:     "local",
+					schema.ColumnOutIfName:    "unknown-999",
+				},
+			},
+		}, {
+			Name: "synthetic interfaces, local only",
+			Configuration: gin.H{"syntheticinterfaces": gin.H{
+				"192.0.2.0/24": gin.H{"local": "local"},
+			}},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				}
+			},
+			OutputFlow: &schema.FlowMessage{
+				SamplingRate:    1000,
+				ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnExporterName: "192_0_2_142",
+					schema.ColumnInIfName:     "local",
+					schema.ColumnOutIfName:    "local",
+				},
+			},
 		}, {
 			Name: "no rule, override sampling rate",
 			Configuration: gin.H{"overridesamplingrate": gin.H{
@@ -260,6 +329,56 @@ func TestEnrich(t *testing.T) {
 					schema.ColumnOutIfSpeed:       1000,
 				},
 			},
+		}, {
+			Name: "flow hook renaming provider",
+			Configuration: gin.H{
+				"interfaceclassifiers": []string{
+					`Interface.Index == 100 && ClassifyProvider("index1")`,
+				},
+				"flowhooks": []string{
+					`Flow.InIfProvider == "index1" && Set("InIfProvider", "telia")`,
+					`Flow.OutIfIndex == 200 && Set("OutIfSpeed", 10000) && Set("ExporterTenant", Format("tenant-%d", Flow.InIfIndex))`,
+				},
+			},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: &schema.FlowMessage{
+				SamplingRate:    1000,
+				ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnExporterName:     "192_0_2_142",
+					schema.ColumnExporterTenant:   "tenant-100",
+					schema.ColumnInIfProvider:     "telia",
+					schema.ColumnInIfName:         "Gi0/0/100",
+					schema.ColumnOutIfName:        "Gi0/0/200",
+					schema.ColumnInIfDescription:  "Interface 100",
+					schema.ColumnOutIfDescription: "Interface 200",
+					schema.ColumnInIfSpeed:        1000,
+					schema.ColumnOutIfSpeed:       10000,
+				},
+			},
+		}, {
+			Name: "flow hook with reject",
+			Configuration: gin.H{
+				"flowhooks": []string{
+					`Flow.InIfName == "Gi0/0/100" && Reject()`,
+				},
+			},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+				}
+			},
+			OutputFlow: nil,
 		}, {
 			Name: "interface rule with rename",
 			Configuration: gin.H{
@@ -495,6 +614,40 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 				},
 			},
 		},
+		{
+			Name: "classification and routing stages disabled",
+			Configuration: gin.H{
+				"enrichmentstages": []string{"metadata", "geoip", "application", "custom"},
+				"exporterclassifiers": []string{
+					`ClassifyRegion("asia")`,
+				},
+			},
+			InputFlow: func() *schema.FlowMessage {
+				return &schema.FlowMessage{
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+					InIf:            100,
+					OutIf:           200,
+					SrcAddr:         netip.MustParseAddr("::ffff:192.0.2.142"),
+					DstAddr:         netip.MustParseAddr("::ffff:192.0.2.10"),
+				}
+			},
+			OutputFlow: &schema.FlowMessage{
+				SamplingRate:    1000,
+				ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+				SrcAddr:         netip.MustParseAddr("::ffff:192.0.2.142"),
+				DstAddr:         netip.MustParseAddr("::ffff:192.0.2.10"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnExporterName:     "192_0_2_142",
+					schema.ColumnInIfName:         "Gi0/0/100",
+					schema.ColumnOutIfName:        "Gi0/0/200",
+					schema.ColumnInIfDescription:  "Interface 100",
+					schema.ColumnOutIfDescription: "Interface 200",
+					schema.ColumnInIfSpeed:        1000,
+					schema.ColumnOutIfSpeed:       1000,
+				},
+			},
+		},
 		{
 			Name:          "use data from routing",
 			Configuration: gin.H{},
@@ -550,8 +703,9 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 			routingComponent.PopulateRIB(t)
 
 			// Prepare a configuration
-			configuration := DefaultConfiguration()
-			decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&configuration))
+			configuration := Configuration{}
+			decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&configuration,
+				helpers.DefaultValuesUnmarshallerHook(DefaultConfiguration())))
 			if err != nil {
 				t.Fatalf("NewDecoder() error:\n%+v", err)
 			}
@@ -559,6 +713,13 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 				t.Fatalf("Decode() error:\n%+v", err)
 			}
 
+			schemaConfiguration := schema.DefaultConfiguration()
+			schemaConfiguration.Enabled = tc.Columns
+			schemaComponent, err := schema.New(schemaConfiguration)
+			if err != nil {
+				t.Fatalf("schema.New() error:\n%+v", err)
+			}
+
 			// Instantiate and start core
 			c, err := New(r, configuration, Dependencies{
 				Daemon:   daemonComponent,
@@ -568,7 +729,7 @@ ClassifyProviderRegex(Interface.Description, "^Transit: ([^ ]+)", "$1")`,
 				Kafka:    kafkaComponent,
 				HTTP:     httpComponent,
 				Routing:  routingComponent,
-				Schema:   schema.NewMock(t),
+				Schema:   schemaComponent,
 			})
 			if err != nil {
 				t.Fatalf("New() error:\n%+v", err)
@@ -794,3 +955,61 @@ func TestGetNextHop(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifyApplication(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t)
+
+	// We don't need all components as we won't start the component.
+	configuration := DefaultConfiguration()
+	decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&configuration))
+	if err != nil {
+		t.Fatalf("NewDecoder() error:\n%+v", err)
+	}
+	if err := decoder.Decode(gin.H{
+		"ApplicationClassifiers": []string{
+			`Flow.Proto == 17 && Flow.SrcPort == 443 && Flow.SrcAS == 15169 && ClassifyApplication("YouTube/Google")`,
+			`Flow.Proto == 6 && Flow.DstPort == 443 && ClassifyApplication("HTTPS")`,
+			`InNetwork(Flow.DstAddr, "192.0.2.0/24") && ClassifyApplication("Internal")`,
+		},
+	}); err != nil {
+		t.Fatalf("Decode() error:\n%+v", err)
+	}
+	c, err := New(r, configuration, Dependencies{
+		Daemon:  daemon.NewMock(t),
+		GeoIP:   geoip.NewMock(t, r),
+		Routing: routing.NewMock(t, r),
+		Schema:  sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	cases := []struct {
+		Proto    uint64
+		SrcPort  uint64
+		DstPort  uint64
+		SrcAS    uint32
+		DstAddr  string
+		Expected string
+	}{
+		{17, 443, 51234, 15169, "::ffff:198.51.100.1", "YouTube/Google"},
+		{17, 443, 51234, 32934, "::ffff:198.51.100.1", ""},
+		{6, 51234, 443, 32934, "::ffff:198.51.100.1", "HTTPS"},
+		{6, 443, 51234, 15169, "::ffff:192.0.2.10", "Internal"},
+		{6, 443, 51234, 15169, "2001:db8::10", ""},
+	}
+	for _, tc := range cases {
+		flow := &schema.FlowMessage{
+			SrcAS:   tc.SrcAS,
+			DstAddr: netip.MustParseAddr(tc.DstAddr),
+		}
+		sch.ProtobufAppendVarint(flow, schema.ColumnProto, tc.Proto)
+		sch.ProtobufAppendVarint(flow, schema.ColumnSrcPort, tc.SrcPort)
+		sch.ProtobufAppendVarint(flow, schema.ColumnDstPort, tc.DstPort)
+		got := c.classifyApplication("192.0.2.142", flow)
+		if diff := helpers.Diff(got, tc.Expected); diff != "" {
+			t.Errorf("classifyApplication(%+v) (-got, +want):\n%s", tc, diff)
+		}
+	}
+}
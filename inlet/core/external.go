@@ -0,0 +1,190 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/core/pb"
+)
+
+// ExternalEnrichmentConfiguration describes the configuration for the
+// external enrichment stage.
+type ExternalEnrichmentConfiguration struct {
+	// Target is the gRPC target of the external enrichment service. When
+	// empty, external enrichment is disabled.
+	Target string
+	// TLS defines TLS configuration to connect to the external service
+	TLS helpers.TLSConfiguration
+	// BatchSize is the maximum number of flows to send in a single request
+	BatchSize int `validate:"min=1"`
+	// FlushInterval is the maximum time to wait to complete a batch
+	FlushInterval time.Duration `validate:"min=1ms"`
+	// Timeout is the maximum time to wait for an answer
+	Timeout time.Duration `validate:"min=1ms"`
+}
+
+// DefaultExternalEnrichmentConfiguration represents the default
+// configuration for the external enrichment stage.
+func DefaultExternalEnrichmentConfiguration() ExternalEnrichmentConfiguration {
+	return ExternalEnrichmentConfiguration{
+		BatchSize:     100,
+		FlushInterval: 100 * time.Millisecond,
+		Timeout:       500 * time.Millisecond,
+	}
+}
+
+// externalEnrichMethod is the gRPC method invoked on the external service.
+// The service is described in pb/enricher.proto.
+const externalEnrichMethod = "/akvorado.inlet.Enricher/Enrich"
+
+// externalAddr encodes an IP address for the external enrichment service.
+func externalAddr(addr netip.Addr) []byte {
+	if !addr.IsValid() {
+		return nil
+	}
+	as16 := addr.As16()
+	return as16[:]
+}
+
+var errExternalMismatch = errors.New("number of annotations does not match number of flows")
+
+// initExternal connects to the external enrichment service, if configured.
+func (c *Component) initExternal() error {
+	if c.config.ExternalEnrichment.Target == "" {
+		return nil
+	}
+	if c.d.Schema.Privacy() {
+		return errors.New("external enrichment cannot be used in privacy mode")
+	}
+	creds := insecure.NewCredentials()
+	tlsConfig, err := c.config.ExternalEnrichment.TLS.MakeTLSConfig()
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(c.config.ExternalEnrichment.Target,
+		grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return fmt.Errorf("cannot connect to external enrichment service: %w", err)
+	}
+	c.externalConn = conn
+	c.externalBreaker = breaker.New(10, 1, 30*time.Second)
+
+	c.metrics.externalTimes = c.r.Summary(
+		reporter.SummaryOpts{
+			Name:       "external_enrichment_seconds",
+			Help:       "Time to successfully enrich a batch of flows with the external service.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		})
+	c.metrics.externalErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "external_enrichment_errors_total",
+			Help: "Number of errors when enriching flows with the external service.",
+		},
+		[]string{"error"})
+	c.metrics.externalBreakerOpen = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "external_enrichment_breaker_opens_total",
+			Help: "Number of times the external enrichment breaker was opened due to too many errors.",
+		})
+	c.metrics.externalRejected = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "external_enrichment_rejected_total",
+			Help: "Number of batches not enriched because the external enrichment breaker is open.",
+		})
+	return nil
+}
+
+// enrichWithExternal sends a batch of flows to the external enrichment
+// service and merges the returned annotations. On error, flows are left
+// untouched.
+func (c *Component) enrichWithExternal(flows []*schema.FlowMessage) {
+	request := &pb.EnrichRequest{Flows: make([]*pb.Flow, len(flows))}
+	for idx, flow := range flows {
+		request.Flows[idx] = &pb.Flow{
+			TimeReceived:    flow.TimeReceived,
+			SamplingRate:    flow.SamplingRate,
+			ExporterAddress: externalAddr(flow.ExporterAddress),
+			InIf:            flow.InIf,
+			OutIf:           flow.OutIf,
+			SrcVlan:         uint32(flow.SrcVlan),
+			DstVlan:         uint32(flow.DstVlan),
+			SrcAddr:         externalAddr(flow.SrcAddr),
+			DstAddr:         externalAddr(flow.DstAddr),
+			NextHop:         externalAddr(flow.NextHop),
+			SrcAs:           flow.SrcAS,
+			DstAs:           flow.DstAS,
+			SrcNetMask:      uint32(flow.SrcNetMask),
+			DstNetMask:      uint32(flow.DstNetMask),
+		}
+	}
+
+	response := &pb.EnrichResponse{}
+	start := time.Now()
+	err := c.externalBreaker.Run(func() error {
+		ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.ExternalEnrichment.Timeout)
+		defer cancel()
+		if err := c.externalConn.Invoke(ctx, externalEnrichMethod, request, response); err != nil {
+			return err
+		}
+		if len(response.Annotations) != len(flows) {
+			return errExternalMismatch
+		}
+		return nil
+	})
+	if err == breaker.ErrBreakerOpen {
+		// Only count the transitions to the open state.
+		if c.externalBreakerOpened.CompareAndSwap(false, true) {
+			c.metrics.externalBreakerOpen.Inc()
+		}
+		c.metrics.externalRejected.Inc()
+		return
+	}
+	c.externalBreakerOpened.Store(false)
+	if err != nil {
+		c.metrics.externalErrors.WithLabelValues(externalErrorLabel(err)).Inc()
+		c.externalErrLogger.Err(err).Msg("cannot enrich flows with external service")
+		return
+	}
+	c.metrics.externalTimes.Observe(time.Since(start).Seconds())
+
+	for idx, flow := range flows {
+		for name, value := range response.Annotations[idx].GetColumns() {
+			if err := c.annotate(flow, name, value); err != nil {
+				c.metrics.externalErrors.WithLabelValues(externalErrorLabel(err)).Inc()
+			}
+		}
+	}
+}
+
+// externalErrorLabel turns an error into a label for metrics.
+func externalErrorLabel(err error) string {
+	switch {
+	case status.Code(err) == codes.DeadlineExceeded:
+		return "timeout"
+	case errors.Is(err, errExternalMismatch),
+		errors.Is(err, errUnknownColumn),
+		errors.Is(err, errInvalidValue):
+		return err.Error()
+	default:
+		return "request error"
+	}
+}
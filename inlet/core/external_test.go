@@ -0,0 +1,192 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/core/pb"
+)
+
+// startExternalServer starts a gRPC server answering to external
+// enrichment requests with the provided function.
+func startExternalServer(t *testing.T, handler func(*pb.EnrichRequest) *pb.EnrichResponse) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "akvorado.inlet.Enricher",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Enrich",
+			Handler: func(_ interface{}, _ context.Context, dec func(interface{}) error, _ grpc.UnaryServerInterceptor) (interface{}, error) {
+				request := &pb.EnrichRequest{}
+				if err := dec(request); err != nil {
+					return nil, err
+				}
+				return handler(request), nil
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func TestExternalEnrichment(t *testing.T) {
+	target := startExternalServer(t, func(request *pb.EnrichRequest) *pb.EnrichResponse {
+		response := &pb.EnrichResponse{}
+		for _, flow := range request.Flows {
+			if exporter, _ := netip.AddrFromSlice(flow.ExporterAddress); exporter.Unmap().String() != "192.0.2.142" {
+				t.Errorf("ExporterAddress == %s, expected 192.0.2.142", exporter)
+			}
+			switch flow.InIf {
+			case 10:
+				response.Annotations = append(response.Annotations, &pb.Annotations{
+					Columns: map[string]string{
+						"ExporterTenant": "tenant-a",
+						"InIfBoundary":   "external",
+						"InIfSpeed":      "10000",
+					},
+				})
+			case 20:
+				response.Annotations = append(response.Annotations, &pb.Annotations{
+					Columns: map[string]string{
+						"NotAColumn": "hello",
+						"InIfSpeed":  "fast",
+					},
+				})
+			case 30:
+				time.Sleep(100 * time.Millisecond)
+				response.Annotations = append(response.Annotations, &pb.Annotations{})
+			default:
+				response.Annotations = append(response.Annotations, &pb.Annotations{})
+			}
+		}
+		return response
+	})
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.ExternalEnrichment.Target = target
+	configuration.ExternalEnrichment.Timeout = 50 * time.Millisecond
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	defer c.externalConn.Close()
+
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	flows := []*schema.FlowMessage{
+		{ExporterAddress: exporter, InIf: 10},
+		{ExporterAddress: exporter, InIf: 20},
+		{ExporterAddress: exporter, InIf: 40},
+	}
+	c.enrichWithExternal(flows)
+	got := []*schema.FlowMessage{}
+	for _, flow := range flows {
+		got = append(got, c.d.Schema.ProtobufDecode(t, c.d.Schema.ProtobufMarshal(flow)))
+	}
+	expected := []*schema.FlowMessage{
+		{
+			ExporterAddress: exporter,
+			ProtobufDebug: map[schema.ColumnKey]interface{}{
+				schema.ColumnExporterTenant: "tenant-a",
+				schema.ColumnInIfBoundary:   1,
+				schema.ColumnInIfSpeed:      10000,
+			},
+		}, {
+			ExporterAddress: exporter,
+			ProtobufDebug:   map[schema.ColumnKey]interface{}{},
+		}, {
+			ExporterAddress: exporter,
+			ProtobufDebug:   map[schema.ColumnKey]interface{}{},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("enrichWithExternal() (-got, +want):\n%s", diff)
+	}
+
+	// Timeout
+	c.enrichWithExternal([]*schema.FlowMessage{{ExporterAddress: exporter, InIf: 30}})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_external_enrichment_", "errors_", "seconds_count")
+	expectedMetrics := map[string]string{
+		`errors_total{error="invalid value"}`:  "1",
+		`errors_total{error="timeout"}`:        "1",
+		`errors_total{error="unknown column"}`: "1",
+		`seconds_count`:                        "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestExternalEnrichmentBreaker(t *testing.T) {
+	target := startExternalServer(t, func(request *pb.EnrichRequest) *pb.EnrichResponse {
+		// Always return a mismatched number of annotations
+		return &pb.EnrichResponse{}
+	})
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.ExternalEnrichment.Target = target
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	defer c.externalConn.Close()
+
+	flows := []*schema.FlowMessage{{ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142")}}
+	for i := 0; i < 15; i++ {
+		c.enrichWithExternal(flows)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_external_enrichment_", "breaker_", "rejected_", "errors_")
+	expectedMetrics := map[string]string{
+		`breaker_opens_total`: "1",
+		`rejected_total`:      "5",
+		`errors_total{error="number of annotations does not match number of flows"}`: "10",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestExternalEnrichmentPrivacy(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.ExternalEnrichment.Target = "127.0.0.1:1"
+	schemaConfiguration := schema.DefaultConfiguration()
+	schemaConfiguration.Privacy = true
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	if _, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: sch,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -0,0 +1,308 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/vm"
+
+	"akvorado/common/schema"
+)
+
+// maxFlowHookNodes is the maximum number of nodes in a flow hook. This is a
+// crude way to limit the CPU usage of a hook.
+const maxFlowHookNodes = 500
+
+// maxFlowHookOverruns is the number of time a flow hook can exceed its time
+// budget before being disabled.
+const maxFlowHookOverruns = 10
+
+// FlowHookRule defines a hook to transform flows.
+type FlowHookRule struct {
+	program *vm.Program
+}
+
+// flowHookInfo contains the information exposed to flow hooks. Modifications
+// should be done through the provided functions.
+type flowHookInfo struct {
+	ExporterAddress   string
+	ExporterName      string
+	ExporterGroup     string
+	ExporterRole      string
+	ExporterSite      string
+	ExporterRegion    string
+	ExporterTenant    string
+	SamplingRate      uint32
+	SrcAddr           string
+	DstAddr           string
+	NextHop           string
+	SrcAS             uint32
+	DstAS             uint32
+	SrcNetMask        uint8
+	DstNetMask        uint8
+	SrcVlan           uint16
+	DstVlan           uint16
+	Proto             uint8
+	SrcPort           uint16
+	DstPort           uint16
+	InIfIndex         uint32
+	InIfName          string
+	InIfDescription   string
+	InIfSpeed         uint32
+	InIfProvider      string
+	InIfConnectivity  string
+	InIfBoundary      string
+	OutIfIndex        uint32
+	OutIfName         string
+	OutIfDescription  string
+	OutIfSpeed        uint32
+	OutIfProvider     string
+	OutIfConnectivity string
+	OutIfBoundary     string
+}
+
+// flowHookEnvironment defines the environment used by flow hooks.
+type flowHookEnvironment struct {
+	Format func(string, ...any) string
+	Flow   flowHookInfo
+	Set    func(string, any) (bool, error)
+	Reject func() bool
+}
+
+// flowHookState is the state of a flow being enriched. Flow hooks can modify
+// it before it is written to the flow.
+type flowHookState struct {
+	flow         *schema.FlowMessage
+	exporterName *string
+	exporter     *exporterClassification
+	inIfSpeed    *uint32
+	outIfSpeed   *uint32
+	inIf         *interfaceClassification
+	outIf        *interfaceClassification
+	reject       bool
+}
+
+// info returns the information to expose to the flow hook.
+func (state *flowHookState) info(sch *schema.Component) flowHookInfo {
+	proto, _ := sch.ProtobufVarint(state.flow, schema.ColumnProto)
+	srcPort, _ := sch.ProtobufVarint(state.flow, schema.ColumnSrcPort)
+	dstPort, _ := sch.ProtobufVarint(state.flow, schema.ColumnDstPort)
+	return flowHookInfo{
+		ExporterAddress:   state.flow.ExporterAddress.Unmap().String(),
+		ExporterName:      *state.exporterName,
+		ExporterGroup:     state.exporter.Group,
+		ExporterRole:      state.exporter.Role,
+		ExporterSite:      state.exporter.Site,
+		ExporterRegion:    state.exporter.Region,
+		ExporterTenant:    state.exporter.Tenant,
+		SamplingRate:      state.flow.SamplingRate,
+		SrcAddr:           state.flow.SrcAddr.Unmap().String(),
+		DstAddr:           state.flow.DstAddr.Unmap().String(),
+		NextHop:           state.flow.NextHop.Unmap().String(),
+		SrcAS:             state.flow.SrcAS,
+		DstAS:             state.flow.DstAS,
+		SrcNetMask:        state.flow.SrcNetMask,
+		DstNetMask:        state.flow.DstNetMask,
+		SrcVlan:           state.flow.SrcVlan,
+		DstVlan:           state.flow.DstVlan,
+		Proto:             uint8(proto),
+		SrcPort:           uint16(srcPort),
+		DstPort:           uint16(dstPort),
+		InIfIndex:         state.flow.InIf,
+		InIfName:          state.inIf.Name,
+		InIfDescription:   state.inIf.Description,
+		InIfSpeed:         *state.inIfSpeed,
+		InIfProvider:      state.inIf.Provider,
+		InIfConnectivity:  state.inIf.Connectivity,
+		InIfBoundary:      state.inIf.Boundary.String(),
+		OutIfIndex:        state.flow.OutIf,
+		OutIfName:         state.outIf.Name,
+		OutIfDescription:  state.outIf.Description,
+		OutIfSpeed:        *state.outIfSpeed,
+		OutIfProvider:     state.outIf.Provider,
+		OutIfConnectivity: state.outIf.Connectivity,
+		OutIfBoundary:     state.outIf.Boundary.String(),
+	}
+}
+
+// flowHookSet modifies the provided column. Columns computed by the core component
+// are modified in the state, while the other ones are directly appended to
+// the flow.
+func (c *Component) flowHookSet(state *flowHookState, column string, value any) (bool, error) {
+	str := fmt.Sprint(value)
+	parseUint := func(bits int) (uint64, error) {
+		v, err := strconv.ParseUint(str, 10, bits)
+		if err != nil {
+			return 0, fmt.Errorf("invalid value %q for %s", str, column)
+		}
+		return v, nil
+	}
+	switch column {
+	case "ExporterName":
+		*state.exporterName = str
+	case "ExporterGroup":
+		state.exporter.Group = str
+	case "ExporterRole":
+		state.exporter.Role = str
+	case "ExporterSite":
+		state.exporter.Site = str
+	case "ExporterRegion":
+		state.exporter.Region = str
+	case "ExporterTenant":
+		state.exporter.Tenant = str
+	case "InIfName":
+		state.inIf.Name = str
+	case "OutIfName":
+		state.outIf.Name = str
+	case "InIfDescription":
+		state.inIf.Description = str
+	case "OutIfDescription":
+		state.outIf.Description = str
+	case "InIfProvider":
+		state.inIf.Provider = str
+	case "OutIfProvider":
+		state.outIf.Provider = str
+	case "InIfConnectivity":
+		state.inIf.Connectivity = str
+	case "OutIfConnectivity":
+		state.outIf.Connectivity = str
+	case "InIfBoundary", "OutIfBoundary":
+		var boundary schema.InterfaceBoundary
+		if err := boundary.UnmarshalText([]byte(str)); err != nil {
+			return false, fmt.Errorf("invalid value %q for %s", str, column)
+		}
+		if column == "InIfBoundary" {
+			state.inIf.Boundary = boundary
+		} else {
+			state.outIf.Boundary = boundary
+		}
+	case "InIfSpeed", "OutIfSpeed":
+		v, err := parseUint(32)
+		if err != nil {
+			return false, err
+		}
+		if column == "InIfSpeed" {
+			*state.inIfSpeed = uint32(v)
+		} else {
+			*state.outIfSpeed = uint32(v)
+		}
+	case "SamplingRate":
+		v, err := parseUint(32)
+		if err != nil {
+			return false, err
+		}
+		state.flow.SamplingRate = uint32(v)
+	case "SrcAS", "DstAS":
+		v, err := parseUint(32)
+		if err != nil {
+			return false, err
+		}
+		if column == "SrcAS" {
+			state.flow.SrcAS = uint32(v)
+		} else {
+			state.flow.DstAS = uint32(v)
+		}
+	default:
+		if err := c.annotate(state.flow, column, str); err != nil {
+			return false, fmt.Errorf("cannot set %s: %w", column, err)
+		}
+	}
+	return true, nil
+}
+
+// runFlowHooks executes the flow hooks on the provided state. The environment
+// is built once per flow and only refreshed when a hook modifies the flow. The
+// time budget is soft: a hook is never interrupted, but hooks exceeding it too
+// often are disabled.
+func (c *Component) runFlowHooks(exporterStr string, state *flowHookState) {
+	modified := false
+	env := flowHookEnvironment{
+		Format: format,
+		Flow:   state.info(c.d.Schema),
+		Set: func(column string, value any) (bool, error) {
+			ok, err := c.flowHookSet(state, column, value)
+			modified = modified || ok
+			return ok, err
+		},
+		Reject: func() bool {
+			state.reject = true
+			return false
+		},
+	}
+	for idx, hook := range c.config.FlowHooks {
+		if atomic.LoadUint32(&c.flowHookOverruns[idx]) >= maxFlowHookOverruns {
+			continue
+		}
+		if modified {
+			env.Flow = state.info(c.d.Schema)
+			modified = false
+		}
+		start := time.Now()
+		_, err := expr.Run(hook.program, &env)
+		if elapsed := time.Since(start); elapsed > c.config.FlowHookBudget {
+			c.metrics.flowHookOverruns.WithLabelValues(strconv.Itoa(idx)).Inc()
+			if atomic.AddUint32(&c.flowHookOverruns[idx], 1) == maxFlowHookOverruns {
+				c.r.Warn().
+					Int("index", idx).
+					Str("hook", hook.String()).
+					Msg("flow hook disabled after exceeding its time budget too many times")
+			}
+		}
+		if err != nil {
+			c.classifierErrLogger.Err(err).
+				Str("type", "hook").
+				Int("index", idx).
+				Str("exporter", exporterStr).
+				Msg("error executing flow hook")
+			c.metrics.flowHookErrors.WithLabelValues(strconv.Itoa(idx)).Inc()
+			continue
+		}
+		if state.reject {
+			return
+		}
+	}
+}
+
+// UnmarshalText compiles a flow hook.
+func (fhr *FlowHookRule) UnmarshalText(text []byte) error {
+	counter := nodeCounter{}
+	program, err := expr.Compile(string(text),
+		expr.Env(flowHookEnvironment{}),
+		expr.AsBool(),
+		expr.Patch(&counter))
+	if err != nil {
+		return fmt.Errorf("cannot compile flow hook %q: %w", string(text), err)
+	}
+	if counter.count > maxFlowHookNodes {
+		return fmt.Errorf("flow hook %q is too complex (%d nodes, maximum is %d)",
+			string(text), counter.count, maxFlowHookNodes)
+	}
+	fhr.program = program
+	return nil
+}
+
+// String turns a flow hook into a string
+func (fhr FlowHookRule) String() string {
+	return fhr.program.Source().Content()
+}
+
+// MarshalText turns a flow hook into a string
+func (fhr FlowHookRule) MarshalText() ([]byte, error) {
+	return []byte(fhr.String()), nil
+}
+
+// nodeCounter counts the number of nodes in an expression.
+type nodeCounter struct {
+	count int
+}
+
+func (n *nodeCounter) Visit(_ *ast.Node) {
+	n.count++
+}
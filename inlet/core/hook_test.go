@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestFlowHookTooComplex(t *testing.T) {
+	var rule FlowHookRule
+	if err := rule.UnmarshalText([]byte(`Set("InIfProvider", "telia")`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	tooComplex := strings.Repeat(`Flow.SrcAS == 1 || `, 200) + `false`
+	if err := rule.UnmarshalText([]byte(tooComplex)); err == nil {
+		t.Fatal("UnmarshalText() did not error")
+	}
+}
+
+func TestFlowHookBudget(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	var rule FlowHookRule
+	if err := rule.UnmarshalText([]byte(`Set("ExporterTenant", "tenant")`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	configuration.FlowHooks = []FlowHookRule{rule}
+	configuration.FlowHookBudget = time.Nanosecond
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	for i := 0; i < 2*maxFlowHookOverruns; i++ {
+		var exporterName string
+		var inIfSpeed, outIfSpeed uint32
+		exporter := exporterClassification{}
+		inIf, outIf := interfaceClassification{}, interfaceClassification{}
+		c.runFlowHooks("192.0.2.142", &flowHookState{
+			flow:         &schema.FlowMessage{ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142")},
+			exporterName: &exporterName,
+			exporter:     &exporter,
+			inIfSpeed:    &inIfSpeed,
+			outIfSpeed:   &outIfSpeed,
+			inIf:         &inIf,
+			outIf:        &outIf,
+		})
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "flow_hook_")
+	expectedMetrics := map[string]string{
+		`flow_hook_overruns_total{index="0"}`: "10",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestFlowHookChaining(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	for _, source := range []string{
+		`Set("ExporterRole", "edge")`,
+		`Flow.ExporterRole == "edge" && Set("ExporterSite", "par")`,
+	} {
+		var rule FlowHookRule
+		if err := rule.UnmarshalText([]byte(source)); err != nil {
+			t.Fatalf("UnmarshalText() error:\n%+v", err)
+		}
+		configuration.FlowHooks = append(configuration.FlowHooks, rule)
+	}
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	var exporterName string
+	var inIfSpeed, outIfSpeed uint32
+	exporter := exporterClassification{}
+	inIf, outIf := interfaceClassification{}, interfaceClassification{}
+	c.runFlowHooks("192.0.2.142", &flowHookState{
+		flow:         &schema.FlowMessage{ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142")},
+		exporterName: &exporterName,
+		exporter:     &exporter,
+		inIfSpeed:    &inIfSpeed,
+		outIfSpeed:   &outIfSpeed,
+		inIf:         &inIf,
+		outIf:        &outIf,
+	})
+	expected := exporterClassification{Role: "edge", Site: "par"}
+	if diff := helpers.Diff(exporter, expected); diff != "" {
+		t.Fatalf("runFlowHooks() (-got, +want):\n%s", diff)
+	}
+}
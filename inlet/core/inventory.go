@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"encoding/json"
+	"net/netip"
+	"time"
+
+	"akvorado/common/schema"
+	"akvorado/inlet/flow"
+)
+
+// maxInventoryMessageSize is the size after which an inventory message is
+// sent to Kafka. It should be smaller than the maximum message size.
+const maxInventoryMessageSize = 500_000
+
+// inventoryEntry is an interface of an exporter, as stored in the inventory
+// table in ClickHouse.
+type inventoryEntry struct {
+	TimeReceived    int64
+	ExporterAddress string
+	ExporterName    string
+	ExporterGroup   string
+	ExporterRole    string
+	ExporterSite    string
+	ExporterRegion  string
+	ExporterTenant  string
+	IfIndex         uint
+	IfName          string
+	IfDescription   string
+	IfSpeed         uint
+	IfConnectivity  string
+	IfProvider      string
+	IfBoundary      schema.InterfaceBoundary
+}
+
+// sendInventory sends the content of the metadata cache, after
+// classification, to Kafka. Each message contains the interfaces of one
+// exporter, encoded as JSON, one interface per line.
+func (c *Component) sendInventory(now time.Time) {
+	payloads := map[netip.Addr][]byte{}
+	flush := func(exporterIP netip.Addr) {
+		if payload := payloads[exporterIP]; len(payload) > 0 {
+			c.d.Kafka.SendInventory(exporterIP.Unmap().String(), payload)
+		}
+		delete(payloads, exporterIP)
+	}
+	for query, answer := range c.d.Metadata.Entries() {
+		if query.IfIndex == 0 {
+			continue
+		}
+		exporterStr := query.ExporterIP.Unmap().String()
+		expClassification := c.classifyExporter(now, exporterStr, answer.Exporter.Name,
+			exporterClassification{
+				Group:  answer.Exporter.Group,
+				Role:   answer.Exporter.Role,
+				Site:   answer.Exporter.Site,
+				Region: answer.Exporter.Region,
+				Tenant: answer.Exporter.Tenant,
+			})
+		if expClassification.Reject {
+			continue
+		}
+		ifClassification := c.classifyInterface(now, exporterStr, answer.Exporter.Name,
+			uint32(query.IfIndex), answer.Interface.Name, answer.Interface.Description,
+			uint32(answer.Interface.Speed), 0,
+			answer.Interface.AdminStatus.String(), answer.Interface.OperStatus.String(),
+			interfaceClassification{
+				Provider:     answer.Interface.Provider,
+				Connectivity: answer.Interface.Connectivity,
+				Boundary:     answer.Interface.Boundary,
+			})
+		if ifClassification.Reject {
+			continue
+		}
+		line, err := json.Marshal(inventoryEntry{
+			TimeReceived:    now.Unix(),
+			ExporterAddress: query.ExporterIP.String(),
+			ExporterName:    answer.Exporter.Name,
+			ExporterGroup:   expClassification.Group,
+			ExporterRole:    expClassification.Role,
+			ExporterSite:    expClassification.Site,
+			ExporterRegion:  expClassification.Region,
+			ExporterTenant:  expClassification.Tenant,
+			IfIndex:         query.IfIndex,
+			IfName:          ifClassification.Name,
+			IfDescription:   ifClassification.Description,
+			IfSpeed:         answer.Interface.Speed,
+			IfConnectivity:  ifClassification.Connectivity,
+			IfProvider:      ifClassification.Provider,
+			IfBoundary:      ifClassification.Boundary,
+		})
+		if err != nil {
+			panic(err)
+		}
+		payloads[query.ExporterIP] = append(append(payloads[query.ExporterIP], line...), '\n')
+		c.metrics.inventoryEntries.Inc()
+		if len(payloads[query.ExporterIP]) > maxInventoryMessageSize {
+			flush(query.ExporterIP)
+		}
+	}
+	for exporterIP := range payloads {
+		flush(exporterIP)
+	}
+}
+
+// sendExporterEvent sends an exporter liveness event to Kafka, encoded as
+// JSON.
+func (c *Component) sendExporterEvent(event flow.ExporterEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	c.d.Kafka.SendEvent(event.Exporter.String(), payload)
+}
@@ -0,0 +1,165 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/kafka"
+	"akvorado/inlet/metadata"
+	"akvorado/inlet/routing"
+)
+
+func TestSendInventory(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	metadataComponent := metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+		metadata.Dependencies{Daemon: daemonComponent})
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	configuration := DefaultConfiguration()
+	var rule InterfaceClassifierRule
+	if err := rule.UnmarshalText([]byte(`ClassifyProvider("Telia") && ClassifyExternal()`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	configuration.InterfaceClassifiers = []InterfaceClassifierRule{rule}
+	c, err := New(r, configuration, Dependencies{
+		Daemon:   daemonComponent,
+		Flow:     flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadataComponent,
+		GeoIP:    geoip.NewMock(t, r),
+		Kafka:    kafkaComponent,
+		HTTP:     httpserver.NewMock(t, r),
+		Routing:  routing.NewMock(t, r),
+		Schema:   schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	// Populate metadata cache
+	metadataComponent.Lookup(time.Now(), netip.MustParseAddr("192.0.2.142"), 100)
+	time.Sleep(20 * time.Millisecond)
+
+	received := make(chan bool)
+	kafkaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		defer close(received)
+		if msg.Topic != "flows-inventory" {
+			t.Errorf("Kafka message topic == %q, expected %q", msg.Topic, "flows-inventory")
+		}
+		value, _ := msg.Value.Encode()
+		if !strings.HasSuffix(string(value), "\n") {
+			t.Errorf("Kafka message does not end with a newline")
+		}
+		var got map[string]interface{}
+		if err := json.Unmarshal(value, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error:\n%+v", err)
+		}
+		expected := map[string]interface{}{
+			"TimeReceived":    1700000000.,
+			"ExporterAddress": "::ffff:192.0.2.142",
+			"ExporterName":    "192_0_2_142",
+			"ExporterGroup":   "",
+			"ExporterRole":    "",
+			"ExporterSite":    "",
+			"ExporterRegion":  "",
+			"ExporterTenant":  "",
+			"IfIndex":         100.,
+			"IfName":          "Gi0/0/100",
+			"IfDescription":   "Interface 100",
+			"IfSpeed":         1000.,
+			"IfConnectivity":  "",
+			"IfProvider":      "telia",
+			"IfBoundary":      "external",
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Errorf("Kafka message (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.sendInventory(time.Unix(1700000000, 0))
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Kafka message not received")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "inventory_")
+	expectedMetrics := map[string]string{
+		`inventory_entries_total`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSendExporterEvent(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+			metadata.Dependencies{Daemon: daemonComponent}),
+		GeoIP:   geoip.NewMock(t, r),
+		Kafka:   kafkaComponent,
+		HTTP:    httpserver.NewMock(t, r),
+		Routing: routing.NewMock(t, r),
+		Schema:  schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	received := make(chan bool)
+	kafkaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+		defer close(received)
+		if msg.Topic != "flows-events" {
+			t.Errorf("Kafka message topic == %q, expected %q", msg.Topic, "flows-events")
+		}
+		key, _ := msg.Key.Encode()
+		if string(key) != "192.0.2.142" {
+			t.Errorf("Kafka message key == %q, expected %q", key, "192.0.2.142")
+		}
+		value, _ := msg.Value.Encode()
+		var got map[string]interface{}
+		if err := json.Unmarshal(value, &got); err != nil {
+			t.Fatalf("json.Unmarshal() error:\n%+v", err)
+		}
+		expected := map[string]interface{}{
+			"type":      "exporter-silent",
+			"exporter":  "192.0.2.142",
+			"last-seen": "2023-11-14T22:13:20Z",
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Errorf("Kafka message (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.sendExporterEvent(flow.ExporterEvent{
+		Type:     "exporter-silent",
+		Exporter: netip.MustParseAddr("192.0.2.142"),
+		LastSeen: time.Unix(1700000000, 0).UTC(),
+	})
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Kafka message not received")
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"akvorado/common/schema"
+)
+
+// logicalLinkMember is the key to lookup the logical link of an interface.
+type logicalLinkMember struct {
+	exporter netip.Addr
+	name     string
+}
+
+// initLogicalLinks builds the index of the logical links from the
+// configuration.
+func (c *Component) initLogicalLinks() error {
+	if len(c.config.LogicalLinks) == 0 {
+		return nil
+	}
+	if column, _ := c.d.Schema.LookupColumnByKey(schema.ColumnInIfLogicalLink); column.Disabled {
+		return errors.New("logical links cannot be used when InIfLogicalLink is disabled")
+	}
+	c.logicalLinks = map[logicalLinkMember]string{}
+	for _, link := range c.config.LogicalLinks {
+		for _, member := range link.Members {
+			if !member.Exporter.IsValid() {
+				return fmt.Errorf("logical link %q has a member without exporter", link.Name)
+			}
+			key := logicalLinkMember{member.Exporter.Unmap(), member.Interface}
+			if other, ok := c.logicalLinks[key]; ok {
+				return fmt.Errorf("interface %s of exporter %s is a member of both logical links %q and %q",
+					member.Interface, member.Exporter, other, link.Name)
+			}
+			c.logicalLinks[key] = link.Name
+		}
+	}
+	return nil
+}
+
+// writeLogicalLinks sets the logical links of the input and output interfaces
+// of the flow.
+func (c *Component) writeLogicalLinks(st *enrichState) {
+	if len(c.logicalLinks) == 0 {
+		return
+	}
+	exporter := st.exporterIP.Unmap()
+	if st.inIf.name != "" {
+		if link, ok := c.logicalLinks[logicalLinkMember{exporter, st.inIf.name}]; ok {
+			c.d.Schema.ProtobufAppendBytes(st.flow, schema.ColumnInIfLogicalLink, []byte(link))
+		}
+	}
+	if st.outIf.name != "" {
+		if link, ok := c.logicalLinks[logicalLinkMember{exporter, st.outIf.name}]; ok {
+			c.d.Schema.ProtobufAppendBytes(st.flow, schema.ColumnOutIfLogicalLink, []byte(link))
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestLogicalLinks(t *testing.T) {
+	links := []LogicalLinkConfiguration{
+		{
+			Name: "transit-1",
+			Members: []LogicalLinkMember{
+				{Exporter: netip.MustParseAddr("192.0.2.1"), Interface: "Gi0/0/1"},
+				{Exporter: netip.MustParseAddr("192.0.2.2"), Interface: "Gi0/0/1"},
+			},
+		}, {
+			Name: "core",
+			Members: []LogicalLinkMember{
+				{Exporter: netip.MustParseAddr("192.0.2.1"), Interface: "Gi0/0/2"},
+			},
+		},
+	}
+	newComponent := func(t *testing.T, links []LogicalLinkConfiguration, enabled bool) (*Component, error) {
+		t.Helper()
+		r := reporter.NewMock(t)
+		schemaConfiguration := schema.DefaultConfiguration()
+		if enabled {
+			schemaConfiguration.Enabled = []schema.ColumnKey{
+				schema.ColumnInIfLogicalLink, schema.ColumnOutIfLogicalLink,
+			}
+		}
+		sch, err := schema.New(schemaConfiguration)
+		if err != nil {
+			t.Fatalf("schema.New() error:\n%+v", err)
+		}
+		configuration := DefaultConfiguration()
+		configuration.LogicalLinks = links
+		return New(r, configuration, Dependencies{
+			Daemon: daemon.NewMock(t),
+			Schema: sch,
+			HTTP:   httpserver.NewMock(t, r),
+		})
+	}
+
+	t.Run("disabled column", func(t *testing.T) {
+		if _, err := newComponent(t, links, false); err == nil {
+			t.Fatal("New() did not error")
+		}
+	})
+
+	t.Run("duplicate member", func(t *testing.T) {
+		duplicate := append(slices.Clone(links), LogicalLinkConfiguration{
+			Name: "transit-2",
+			Members: []LogicalLinkMember{
+				{Exporter: netip.MustParseAddr("192.0.2.2"), Interface: "Gi0/0/1"},
+			},
+		})
+		if _, err := newComponent(t, duplicate, true); err == nil {
+			t.Fatal("New() did not error")
+		}
+	})
+
+	t.Run("enrich", func(t *testing.T) {
+		c, err := newComponent(t, links, true)
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		cases := []struct {
+			Exporter string
+			InIf     string
+			OutIf    string
+			Expected map[schema.ColumnKey]interface{}
+		}{
+			{
+				Exporter: "::ffff:192.0.2.1",
+				InIf:     "Gi0/0/1",
+				OutIf:    "Gi0/0/2",
+				Expected: map[schema.ColumnKey]interface{}{
+					schema.ColumnInIfLogicalLink:  []byte("transit-1"),
+					schema.ColumnOutIfLogicalLink: []byte("core"),
+				},
+			}, {
+				Exporter: "::ffff:192.0.2.2",
+				InIf:     "Gi0/0/2",
+				OutIf:    "Gi0/0/1",
+				Expected: map[schema.ColumnKey]interface{}{
+					schema.ColumnOutIfLogicalLink: []byte("transit-1"),
+				},
+			}, {
+				Exporter: "::ffff:192.0.2.3",
+				InIf:     "Gi0/0/1",
+				OutIf:    "Gi0/0/2",
+				Expected: map[schema.ColumnKey]interface{}{},
+			},
+		}
+		for _, tc := range cases {
+			st := enrichState{
+				exporterIP: netip.MustParseAddr(tc.Exporter),
+				flow:       &schema.FlowMessage{},
+			}
+			st.inIf.name = tc.InIf
+			st.outIf.name = tc.OutIf
+			c.writeLogicalLinks(&st)
+			got := st.flow.ProtobufDebug
+			if got == nil {
+				got = map[schema.ColumnKey]interface{}{}
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Errorf("writeLogicalLinks(%s, %s, %s) (-got, +want):\n%s",
+					tc.Exporter, tc.InIf, tc.OutIf, diff)
+			}
+		}
+	})
+}
@@ -14,10 +14,37 @@ type metrics struct {
 	flowsForwarded   *reporter.CounterVec
 	flowsErrors      *reporter.CounterVec
 	flowsHTTPClients reporter.GaugeFunc
+	flowsParked      *reporter.CounterVec
+	flowsParkedNow   reporter.GaugeFunc
 
-	classifierExporterCacheSize  reporter.CounterFunc
-	classifierInterfaceCacheSize reporter.CounterFunc
-	classifierErrors             *reporter.CounterVec
+	classifierExporterCacheSize    reporter.CounterFunc
+	classifierExporterCacheHits    reporter.CounterFunc
+	classifierExporterCacheMisses  reporter.CounterFunc
+	classifierInterfaceCacheSize   reporter.CounterFunc
+	classifierInterfaceCacheHits   reporter.CounterFunc
+	classifierInterfaceCacheMisses reporter.CounterFunc
+	classifierErrors               *reporter.CounterVec
+
+	flowHookErrors      *reporter.CounterVec
+	taggedFlows         *reporter.CounterVec
+	flowHookOverruns    *reporter.CounterVec
+	pluginRejectedFlows *reporter.CounterVec
+	pluginErrors        *reporter.CounterVec
+
+	enrichmentStageTimes  *reporter.HistogramVec
+	enrichmentStageErrors *reporter.CounterVec
+
+	externalTimes       reporter.Summary
+	externalErrors      *reporter.CounterVec
+	externalBreakerOpen reporter.Counter
+	externalRejected    reporter.Counter
+
+	inventoryEntries reporter.Counter
+	probeResults     reporter.Counter
+
+	tenantFlows        *reporter.CounterVec
+	tenantBytes        *reporter.CounterVec
+	tenantDroppedFlows *reporter.CounterVec
 }
 
 func (c *Component) initMetrics() {
@@ -42,6 +69,34 @@ func (c *Component) initMetrics() {
 		},
 		[]string{"exporter", "error"},
 	)
+	c.metrics.flowsParked = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "parked_flows_total",
+			Help: "Number of flows parked while waiting for metadata.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.flowsParkedNow = c.r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "parked_flows",
+			Help: "Number of flows currently waiting for metadata.",
+		},
+		func() float64 {
+			return float64(c.parkedFlows.Load())
+		},
+	)
+	c.metrics.inventoryEntries = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "inventory_entries_total",
+			Help: "Number of interfaces sent to the inventory.",
+		},
+	)
+	c.metrics.probeResults = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "probe_results_total",
+			Help: "Number of probe results sent to Kafka.",
+		},
+	)
 	c.metrics.flowsHTTPClients = c.r.GaugeFunc(
 		reporter.GaugeOpts{
 			Name: "flows_http_clients",
@@ -61,6 +116,26 @@ func (c *Component) initMetrics() {
 			return float64(c.classifierExporterCache.Size())
 		},
 	)
+	c.metrics.classifierExporterCacheHits = c.r.CounterFunc(
+		reporter.CounterOpts{
+			Name: "classifier_exporter_cache_hits_total",
+			Help: "Number of lookups retrieved from the exporter classifier cache",
+		},
+		func() float64 {
+			hits, _, _ := c.classifierExporterCache.Stats()
+			return float64(hits)
+		},
+	)
+	c.metrics.classifierExporterCacheMisses = c.r.CounterFunc(
+		reporter.CounterOpts{
+			Name: "classifier_exporter_cache_misses_total",
+			Help: "Number of lookups not found in the exporter classifier cache",
+		},
+		func() float64 {
+			_, misses, _ := c.classifierExporterCache.Stats()
+			return float64(misses)
+		},
+	)
 	c.metrics.classifierInterfaceCacheSize = c.r.CounterFunc(
 		reporter.CounterOpts{
 			Name: "classifier_interface_cache_size_items",
@@ -70,10 +145,60 @@ func (c *Component) initMetrics() {
 			return float64(c.classifierInterfaceCache.Size())
 		},
 	)
+	c.metrics.classifierInterfaceCacheHits = c.r.CounterFunc(
+		reporter.CounterOpts{
+			Name: "classifier_interface_cache_hits_total",
+			Help: "Number of lookups retrieved from the interface classifier cache",
+		},
+		func() float64 {
+			hits, _, _ := c.classifierInterfaceCache.Stats()
+			return float64(hits)
+		},
+	)
+	c.metrics.classifierInterfaceCacheMisses = c.r.CounterFunc(
+		reporter.CounterOpts{
+			Name: "classifier_interface_cache_misses_total",
+			Help: "Number of lookups not found in the interface classifier cache",
+		},
+		func() float64 {
+			_, misses, _ := c.classifierInterfaceCache.Stats()
+			return float64(misses)
+		},
+	)
 	c.metrics.classifierErrors = c.r.CounterVec(
 		reporter.CounterOpts{
 			Name: "classifier_errors_total",
 			Help: "Number of errors when evaluating a classifer",
 		},
 		[]string{"type", "index"})
+	c.metrics.flowHookErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flow_hook_errors_total",
+			Help: "Number of errors when evaluating a flow hook.",
+		},
+		[]string{"index"})
+	c.metrics.flowHookOverruns = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "flow_hook_overruns_total",
+			Help: "Number of times a flow hook exceeded its time budget.",
+		},
+		[]string{"index"})
+	c.metrics.taggedFlows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "tagged_flows_total",
+			Help: "Number of flows tagged by a tag rule.",
+		},
+		[]string{"tag"})
+	c.metrics.pluginRejectedFlows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "plugin_rejected_flows_total",
+			Help: "Number of flows rejected by a plugin.",
+		},
+		[]string{"exporter", "plugin"})
+	c.metrics.pluginErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "plugin_errors_total",
+			Help: "Number of errors while running a plugin.",
+		},
+		[]string{"plugin"})
 }
@@ -0,0 +1,107 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+
+	"akvorado/common/schema"
+	"akvorado/inlet/pipeline"
+)
+
+// PluginEnrichFunc is the signature of the function a plugin should export
+// under the name "Enrich". It is invoked for each batch of flows once the
+// builtin enrichment is done. It can modify the flows using the provided
+// schema component. It returns, for each flow, whether it should be kept.
+type PluginEnrichFunc func(sch *schema.Component, flows []*schema.FlowMessage) []bool
+
+// loadedPlugin is a plugin loaded in memory.
+type loadedPlugin struct {
+	Name   string
+	Enrich PluginEnrichFunc
+}
+
+// pluginEnrichSymbol is the name of the symbol to look up in plugins.
+const pluginEnrichSymbol = "Enrich"
+
+// loadPlugin loads a Go plugin from the provided path and returns the
+// enrichment function it exports.
+func loadPlugin(path string) (PluginEnrichFunc, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load plugin %q: %w", path, err)
+	}
+	symbol, err := p.Lookup(pluginEnrichSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find %q in plugin %q: %w", pluginEnrichSymbol, path, err)
+	}
+	switch fn := symbol.(type) {
+	case func(*schema.Component, []*schema.FlowMessage) []bool:
+		return fn, nil
+	case *PluginEnrichFunc:
+		return *fn, nil
+	default:
+		return nil, fmt.Errorf("symbol %q in plugin %q has an unexpected type %T",
+			pluginEnrichSymbol, path, symbol)
+	}
+}
+
+// pluginName returns the name of a plugin from its path.
+func pluginName(path string) string {
+	return filepath.Base(path)
+}
+
+// enrichWithPlugins runs the batch of flows through the loaded plugins. It
+// returns, for each flow, whether it should be rejected.
+func (c *Component) enrichWithPlugins(flows []*schema.FlowMessage) (rejected []bool) {
+	rejected = make([]bool, len(flows))
+	candidates := flows
+	indexes := make([]int, len(flows))
+	for idx := range indexes {
+		indexes[idx] = idx
+	}
+	for _, p := range c.plugins {
+		if len(candidates) == 0 {
+			break
+		}
+		keep, err := c.runPlugin(p, candidates)
+		if err != nil {
+			c.pluginErrLogger.Err(err).Str("plugin", p.Name).Msg("cannot enrich flows with plugin")
+			c.metrics.pluginErrors.WithLabelValues(p.Name).Inc()
+			continue
+		}
+		nextCandidates := candidates[:0:0]
+		nextIndexes := indexes[:0:0]
+		for idx, flow := range candidates {
+			if !keep[idx] {
+				rejected[indexes[idx]] = true
+				exporterStr := flow.ExporterAddress.Unmap().String()
+				c.metrics.pluginRejectedFlows.WithLabelValues(exporterStr, p.Name).Inc()
+				c.drops.Add(pipeline.StageEnrichment, 1)
+				continue
+			}
+			nextCandidates = append(nextCandidates, flow)
+			nextIndexes = append(nextIndexes, indexes[idx])
+		}
+		candidates, indexes = nextCandidates, nextIndexes
+	}
+	return rejected
+}
+
+// runPlugin runs the batch of flows through the provided plugin. A panic in
+// the plugin is recovered and returned as an error, like an invalid result.
+func (c *Component) runPlugin(p loadedPlugin, flows []*schema.FlowMessage) (keep []bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			keep, err = nil, fmt.Errorf("plugin panicked: %v", r)
+		}
+	}()
+	keep = p.Enrich(c.d.Schema, flows)
+	if len(keep) != len(flows) {
+		return nil, fmt.Errorf("plugin returned %d results for %d flows", len(keep), len(flows))
+	}
+	return keep, nil
+}
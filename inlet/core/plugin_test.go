@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/netip"
+	"path/filepath"
+	"testing"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestLoadMissingPlugin(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Plugins = []string{filepath.Join(t.TempDir(), "missing.so")}
+	_, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestEnrichWithPlugins(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	calls := 0
+	c.plugins = []loadedPlugin{
+		{
+			Name: "tagger.so",
+			Enrich: func(sch *schema.Component, flows []*schema.FlowMessage) []bool {
+				calls++
+				keep := make([]bool, len(flows))
+				for idx, flow := range flows {
+					sch.ProtobufAppendBytes(flow, schema.ColumnExporterTenant, []byte("tenant-a"))
+					keep[idx] = true
+				}
+				return keep
+			},
+		}, {
+			Name: "rejecter.so",
+			Enrich: func(_ *schema.Component, flows []*schema.FlowMessage) []bool {
+				calls++
+				keep := make([]bool, len(flows))
+				for idx, flow := range flows {
+					keep[idx] = flow.InIf != 10
+				}
+				return keep
+			},
+		}, {
+			Name: "broken.so",
+			Enrich: func(_ *schema.Component, flows []*schema.FlowMessage) []bool {
+				calls++
+				return nil
+			},
+		}, {
+			Name: "panicker.so",
+			Enrich: func(_ *schema.Component, flows []*schema.FlowMessage) []bool {
+				calls++
+				panic("oops")
+			},
+		},
+	}
+
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	flows := []*schema.FlowMessage{
+		{ExporterAddress: exporter, InIf: 20},
+		{ExporterAddress: exporter, InIf: 10},
+		{ExporterAddress: exporter, InIf: 30},
+	}
+	rejected := c.enrichWithPlugins(flows)
+	if diff := helpers.Diff(rejected, []bool{false, true, false}); diff != "" {
+		t.Fatalf("enrichWithPlugins() (-got, +want):\n%s", diff)
+	}
+	if calls != 4 {
+		t.Fatalf("enrichWithPlugins() invoked plugins %d times, expected 4", calls)
+	}
+	got := c.d.Schema.ProtobufDecode(t, c.d.Schema.ProtobufMarshal(flows[0]))
+	if diff := helpers.Diff(&got, &schema.FlowMessage{
+		ExporterAddress: exporter,
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnExporterTenant: "tenant-a",
+		},
+	}); diff != "" {
+		t.Fatalf("enrichWithPlugins() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "plugin_")
+	expectedMetrics := map[string]string{
+		`plugin_rejected_flows_total{exporter="192.0.2.142",plugin="rejecter.so"}`: "1",
+		`plugin_errors_total{plugin="broken.so"}`:                                  "1",
+		`plugin_errors_total{plugin="panicker.so"}`:                                "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_pipeline_", `dropped_flows_total{stage="enrichment"}`)
+	expectedMetrics = map[string]string{
+		`dropped_flows_total{stage="enrichment"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestPluginName(t *testing.T) {
+	if got := pluginName("/usr/lib/akvorado/tagger.so"); got != "tagger.so" {
+		t.Fatalf("pluginName() == %q, expected %q", got, "tagger.so")
+	}
+}
@@ -0,0 +1,91 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+// probesHandlerInput describes the input for the /probes endpoint.
+type probesHandlerInput struct {
+	Results []probeResult `json:"results" binding:"required,min=1,max=10000,dive"`
+}
+
+// probeResult is the result of a latency and loss probe, as sent by an
+// external agent (ping, TWAMP, ...). Latency and jitter are in milliseconds
+// and loss is a percentage.
+type probeResult struct {
+	Time    time.Time `json:"time"` // now when missing
+	Probe   string    `json:"probe" binding:"required"`
+	Type    string    `json:"type"`
+	Source  string    `json:"source"`
+	Target  string    `json:"target"`
+	Latency float64   `json:"latency" binding:"min=0"`
+	Jitter  float64   `json:"jitter" binding:"min=0"`
+	Loss    float64   `json:"loss" binding:"min=0,max=100"`
+}
+
+// probeEntry is a probe result, as stored in the probes table in ClickHouse.
+type probeEntry struct {
+	TimeReceived int64
+	Probe        string
+	Type         string
+	Source       string
+	Target       string
+	Latency      float64
+	Jitter       float64
+	Loss         float64
+}
+
+// probesHandler accepts probe results and sends them to Kafka. Each message
+// contains the results of one probe, encoded as JSON, one result per line.
+func (c *Component) probesHandler(gc *gin.Context) {
+	var input probesHandlerInput
+	if err := gc.ShouldBindJSON(&input); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+
+	now := time.Now()
+	payloads := map[string][]byte{}
+	flush := func(probe string) {
+		if payload := payloads[probe]; len(payload) > 0 {
+			c.d.Kafka.SendProbes(probe, payload)
+		}
+		delete(payloads, probe)
+	}
+	for _, result := range input.Results {
+		if result.Time.IsZero() {
+			result.Time = now
+		}
+		line, err := json.Marshal(probeEntry{
+			TimeReceived: result.Time.Unix(),
+			Probe:        result.Probe,
+			Type:         result.Type,
+			Source:       result.Source,
+			Target:       result.Target,
+			Latency:      result.Latency,
+			Jitter:       result.Jitter,
+			Loss:         result.Loss,
+		})
+		if err != nil {
+			panic(err)
+		}
+		payloads[result.Probe] = append(append(payloads[result.Probe], line...), '\n')
+		c.metrics.probeResults.Inc()
+		if len(payloads[result.Probe]) > maxInventoryMessageSize {
+			flush(result.Probe)
+		}
+	}
+	for probe := range payloads {
+		flush(probe)
+	}
+	gc.JSON(http.StatusOK, gin.H{"results": len(input.Results)})
+}
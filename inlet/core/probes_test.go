@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/kafka"
+	"akvorado/inlet/metadata"
+	"akvorado/inlet/routing"
+)
+
+func TestProbesHandler(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	httpComponent := httpserver.NewMock(t, r)
+	configuration := DefaultConfiguration()
+	configuration.Probes = true
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemonComponent,
+		Flow:   flow.NewMock(t, r, flow.DefaultConfiguration()),
+		Metadata: metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+			metadata.Dependencies{Daemon: daemonComponent}),
+		GeoIP:   geoip.NewMock(t, r),
+		Kafka:   kafkaComponent,
+		HTTP:    httpComponent,
+		Routing: routing.NewMock(t, r),
+		Schema:  schema.NewMock(t),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	received := make(chan string, 2)
+	for range []int{1, 2} {
+		kafkaProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(msg *sarama.ProducerMessage) error {
+			if msg.Topic != "flows-probes" {
+				t.Errorf("Kafka message topic == %q, expected %q", msg.Topic, "flows-probes")
+			}
+			key, _ := msg.Key.Encode()
+			value, _ := msg.Value.Encode()
+			received <- string(key) + ": " + string(value)
+			return nil
+		})
+	}
+
+	helpers.TestHTTPEndpoints(t, httpComponent.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "no results",
+			URL:         "/api/v0/inlet/probes",
+			JSONInput:   gin.H{"results": []gin.H{}},
+			StatusCode:  400,
+			JSONOutput: gin.H{
+				"message": "Key: 'probesHandlerInput.Results' Error:Field validation for 'Results' failed on the 'min' tag",
+			},
+		}, {
+			Description: "invalid loss",
+			URL:         "/api/v0/inlet/probes",
+			JSONInput: gin.H{"results": []gin.H{
+				{"probe": "paris-london", "latency": 10, "loss": 150},
+			}},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Key: 'probesHandlerInput.Results[0].Loss' Error:Field validation for 'Loss' failed on the 'max' tag",
+			},
+		}, {
+			Description: "valid results",
+			URL:         "/api/v0/inlet/probes",
+			JSONInput: gin.H{"results": []gin.H{
+				{
+					"time":    "2023-11-14T22:13:20Z",
+					"probe":   "paris-london",
+					"type":    "twamp",
+					"source":  "192.0.2.1",
+					"target":  "198.51.100.1",
+					"latency": 10.5,
+					"jitter":  0.5,
+					"loss":    1,
+				}, {
+					"time":    "2023-11-14T22:14:20Z",
+					"probe":   "paris-london",
+					"type":    "twamp",
+					"source":  "192.0.2.1",
+					"target":  "198.51.100.1",
+					"latency": 12,
+				}, {
+					"time":    "2023-11-14T22:13:20Z",
+					"probe":   "paris-nyc",
+					"latency": 80,
+				},
+			}},
+			JSONOutput: gin.H{"results": 3},
+		},
+	})
+
+	got := []string{}
+	for range []int{1, 2} {
+		select {
+		case message := <-received:
+			got = append(got, message)
+		case <-time.After(time.Second):
+			t.Fatal("Kafka message not received")
+		}
+	}
+	if got[0] > got[1] {
+		got[0], got[1] = got[1], got[0]
+	}
+	expected := []string{
+		strings.Join([]string{
+			`paris-london: {"TimeReceived":1700000000,"Probe":"paris-london","Type":"twamp","Source":"192.0.2.1","Target":"198.51.100.1","Latency":10.5,"Jitter":0.5,"Loss":1}`,
+			`{"TimeReceived":1700000060,"Probe":"paris-london","Type":"twamp","Source":"192.0.2.1","Target":"198.51.100.1","Latency":12,"Jitter":0,"Loss":0}`,
+			``,
+		}, "\n"),
+		`paris-nyc: {"TimeReceived":1700000000,"Probe":"paris-nyc","Type":"","Source":"","Target":"","Latency":80,"Jitter":0,"Loss":0}` + "\n",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Kafka messages (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "probe_")
+	expectedMetrics := map[string]string{
+		`probe_results_total`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/decoder/record"
+	"akvorado/inlet/metadata/provider"
+	routing "akvorado/inlet/routing/provider"
+)
+
+// RecordingConfiguration defines how to record a sample of enrichment
+// decisions. They can be replayed later against another version or another
+// configuration.
+type RecordingConfiguration struct {
+	// File is where enrichment decisions are recorded, as JSON lines. When
+	// empty, recording is disabled.
+	File string
+	// SampleRate tells to record one flow out of SampleRate.
+	SampleRate uint64 `validate:"min=1"`
+	// MaxRecords is the maximum number of records. Recording stops once
+	// reached.
+	MaxRecords int `validate:"min=1"`
+}
+
+// DefaultRecordingConfiguration returns the default configuration for
+// recording enrichment decisions.
+func DefaultRecordingConfiguration() RecordingConfiguration {
+	return RecordingConfiguration{
+		SampleRate: 1000,
+		MaxRecords: 10000,
+	}
+}
+
+// EnrichmentRecord is a recorded enrichment decision: the flow before
+// enrichment, the answers of the metadata and routing components used to
+// enrich it, and the flow after enrichment. Flows are encoded with column
+// names as keys, like for the JSON decoder.
+type EnrichmentRecord struct {
+	Input   map[string]interface{} `json:"input"`
+	Lookups EnrichmentLookups      `json:"lookups"`
+	// Output is nil when the flow was skipped.
+	Output map[string]interface{} `json:"output"`
+}
+
+// EnrichmentLookups are the answers of the metadata and routing components
+// used to enrich a flow.
+type EnrichmentLookups struct {
+	Metadata   []provider.Answer     `json:"metadata,omitempty"`
+	SrcRouting *routing.LookupResult `json:"src-routing,omitempty"`
+	DstRouting *routing.LookupResult `json:"dst-routing,omitempty"`
+}
+
+// recorder writes enrichment records to a file.
+type recorder struct {
+	config  RecordingConfiguration
+	sampled atomic.Uint64
+
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	count   int
+}
+
+// initRecording opens the file to record enrichment decisions, if any.
+func (c *Component) initRecording() error {
+	if c.config.Recording.File == "" {
+		return nil
+	}
+	if c.d.Schema.Privacy() {
+		return errors.New("recording cannot be used in privacy mode")
+	}
+	file, err := os.OpenFile(c.config.Recording.File, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("cannot open recording file: %w", err)
+	}
+	c.recorder = &recorder{
+		config:  c.config.Recording,
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}
+	return nil
+}
+
+// sample tells if the next flow should be recorded.
+func (rc *recorder) sample() bool {
+	if rc == nil {
+		return false
+	}
+	return rc.sampled.Add(1)%rc.config.SampleRate == 0
+}
+
+// record writes a record. The provided flows are marshaled and should not be
+// reused. output is nil when the flow was skipped.
+func (c *Component) record(input *schema.FlowMessage, lookups *EnrichmentLookups, output *schema.FlowMessage) {
+	rec := EnrichmentRecord{Lookups: *lookups}
+	var err error
+	if rec.Input, err = record.ToMap(c.d.Schema, input); err != nil {
+		c.r.Err(err).Msg("cannot record flow")
+		return
+	}
+	if output != nil {
+		if rec.Output, err = record.ToMap(c.d.Schema, output); err != nil {
+			c.r.Err(err).Msg("cannot record flow")
+			return
+		}
+	}
+
+	rc := c.recorder
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	if rc.file == nil {
+		return
+	}
+	if err := rc.encoder.Encode(rec); err != nil {
+		c.r.Err(err).Msg("cannot record flow")
+		return
+	}
+	rc.count++
+	if rc.count >= rc.config.MaxRecords {
+		c.r.Info().Int("records", rc.count).Msg("enrichment recording complete")
+		rc.close()
+	}
+}
+
+// close closes the recording file. It should be called with the lock held.
+func (rc *recorder) close() error {
+	if rc.file == nil {
+		return nil
+	}
+	err := rc.file.Close()
+	rc.file = nil
+	return err
+}
+
+// Replayer enriches again recorded flows.
+type Replayer struct {
+	c       *Component
+	decoder decoder.Decoder
+}
+
+// NewReplayer creates a replayer using the current configuration of the core
+// component. The component does not need to be started.
+func (c *Component) NewReplayer() *Replayer {
+	return &Replayer{
+		c:       c,
+		decoder: record.NewJSON(c.r, decoder.Dependencies{Schema: c.d.Schema}, decoder.Option{}),
+	}
+}
+
+// Replay enriches again the input flow of the provided record. The recorded
+// answers of the metadata and routing components are used instead of
+// querying them. GeoIP databases are not recorded and are queried again. Like
+// for recording, external enrichment is not involved. The enriched flow is
+// returned, encoded like in records, or nil if it was skipped.
+func (rp *Replayer) Replay(rec EnrichmentRecord) (map[string]interface{}, error) {
+	payload, err := json.Marshal(rec.Input)
+	if err != nil {
+		return nil, err
+	}
+	flows := rp.decoder.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      payload,
+		Source:       net.IPv6zero,
+	})
+	if len(flows) != 1 {
+		return nil, errors.New("cannot decode recorded flow")
+	}
+	flow := flows[0]
+	_, flow.GotASPath = rec.Input[schema.ColumnDstASPath.String()]
+	lookups := rec.Lookups
+	st := enrichState{
+		t:           time.Now(),
+		exporterIP:  flow.ExporterAddress,
+		exporterStr: flow.ExporterAddress.Unmap().String(),
+		flow:        flow,
+		retry:       true,
+		lookups:     &lookups,
+		replay:      true,
+	}
+	if _, skip := rp.c.enrich(&st); skip {
+		return nil, nil
+	}
+	return record.ToMap(rp.c.d.Schema, flow)
+}
@@ -0,0 +1,196 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/geoip"
+	"akvorado/inlet/metadata"
+	"akvorado/inlet/routing"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	metadataComponent := metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+		metadata.Dependencies{Daemon: daemonComponent})
+	geoipComponent := geoip.NewMock(t, r)
+	routingComponent := routing.NewMock(t, r)
+	routingComponent.PopulateRIB(t)
+	sch := schema.NewMock(t)
+	dependencies := Dependencies{
+		Daemon:   daemonComponent,
+		Metadata: metadataComponent,
+		GeoIP:    geoipComponent,
+		Routing:  routingComponent,
+		Schema:   sch,
+	}
+
+	// Record a few flows
+	recording := filepath.Join(t.TempDir(), "recording.json")
+	configuration := DefaultConfiguration()
+	configuration.Recording.File = recording
+	configuration.Recording.SampleRate = 1
+	configuration.Recording.MaxRecords = 2
+	c, err := New(r, configuration, dependencies)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	newFlow := func() *schema.FlowMessage {
+		flow := &schema.FlowMessage{
+			TimeReceived:    1712822400,
+			SamplingRate:    1000,
+			ExporterAddress: exporter,
+			InIf:            100,
+			OutIf:           200,
+			SrcAddr:         netip.MustParseAddr("::ffff:192.0.2.142"),
+			DstAddr:         netip.MustParseAddr("::ffff:192.0.2.10"),
+		}
+		sch.ProtobufAppendVarint(flow, schema.ColumnBytes, 1500)
+		return flow
+	}
+	// The first flow is skipped because of a cache miss.
+	if _, skip := c.enrichFlow(exporter, "192.0.2.142", newFlow(), true); !skip {
+		t.Fatal("enrichFlow() did not skip first flow")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, skip := c.enrichFlow(exporter, "192.0.2.142", newFlow(), true); skip {
+		t.Fatal("enrichFlow() skipped second flow")
+	}
+	// Recording is complete, this one is not recorded.
+	c.enrichFlow(exporter, "192.0.2.142", newFlow(), true)
+
+	content, err := os.ReadFile(recording)
+	if err != nil {
+		t.Fatalf("ReadFile() error:\n%+v", err)
+	}
+	records := []EnrichmentRecord{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	for decoder.More() {
+		var rec EnrichmentRecord
+		if err := decoder.Decode(&rec); err != nil {
+			t.Fatalf("Decode() error:\n%+v", err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Recorded %d flows, expected 2", len(records))
+	}
+	if records[0].Output != nil {
+		t.Errorf("First record output should be nil, got %v", records[0].Output)
+	}
+	if diff := helpers.Diff(records[1].Output, map[string]interface{}{
+		"TimeReceived":                  json.Number("1712822400"),
+		"ExporterAddress":               "192.0.2.142",
+		"ExporterName":                  "192_0_2_142",
+		"SamplingRate":                  json.Number("1000"),
+		"Bytes":                         json.Number("1500"),
+		"InIf":                          json.Number("100"),
+		"OutIf":                         json.Number("200"),
+		"InIfName":                      "Gi0/0/100",
+		"OutIfName":                     "Gi0/0/200",
+		"InIfDescription":               "Interface 100",
+		"OutIfDescription":              "Interface 200",
+		"InIfSpeed":                     json.Number("1000"),
+		"OutIfSpeed":                    json.Number("1000"),
+		"SrcAddr":                       "192.0.2.142",
+		"DstAddr":                       "192.0.2.10",
+		"SrcAS":                         json.Number("1299"),
+		"DstAS":                         json.Number("174"),
+		"SrcNetMask":                    json.Number("27"),
+		"DstNetMask":                    json.Number("27"),
+		"DstASPath":                     []interface{}{json.Number("64200"), json.Number("1299"), json.Number("174")},
+		"DstCommunities":                []interface{}{json.Number("100"), json.Number("200"), json.Number("400")},
+		"DstLargeCommunitiesASN":        []interface{}{json.Number("64200")},
+		"DstLargeCommunitiesLocalData1": []interface{}{json.Number("2")},
+		"DstLargeCommunitiesLocalData2": []interface{}{json.Number("3")},
+	}); diff != "" {
+		t.Errorf("Recorded output (-got, +want):\n%s", diff)
+	}
+
+	// Replay with the same configuration, without metadata nor routing
+	// components.
+	replay := func(t *testing.T, configuration Configuration, rec EnrichmentRecord) map[string]interface{} {
+		t.Helper()
+		configuration.Recording.File = ""
+		c, err := New(r, configuration, Dependencies{
+			Daemon: daemonComponent,
+			GeoIP:  geoipComponent,
+			Schema: sch,
+		})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		got, err := c.NewReplayer().Replay(rec)
+		if err != nil {
+			t.Fatalf("Replay() error:\n%+v", err)
+		}
+		if got == nil {
+			return nil
+		}
+		// Normalize through JSON to compare with the recorded output
+		encoded, err := json.Marshal(got)
+		if err != nil {
+			t.Fatalf("Marshal() error:\n%+v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		var normalized map[string]interface{}
+		if err := decoder.Decode(&normalized); err != nil {
+			t.Fatalf("Decode() error:\n%+v", err)
+		}
+		return normalized
+	}
+	for idx, rec := range records {
+		if diff := helpers.Diff(replay(t, DefaultConfiguration(), rec), rec.Output); diff != "" {
+			t.Errorf("Replay(%d) (-got, +want):\n%s", idx, diff)
+		}
+	}
+
+	// Replay with a new classifier
+	configuration = DefaultConfiguration()
+	var rule ExporterClassifierRule
+	if err := rule.UnmarshalText([]byte(`ClassifySite("paris")`)); err != nil {
+		t.Fatalf("UnmarshalText() error:\n%+v", err)
+	}
+	configuration.ExporterClassifiers = []ExporterClassifierRule{rule}
+	expected := map[string]interface{}{"ExporterSite": "paris"}
+	for k, v := range records[1].Output {
+		expected[k] = v
+	}
+	if diff := helpers.Diff(replay(t, configuration, records[1]), expected); diff != "" {
+		t.Errorf("Replay() with classifier (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRecordingPrivacy(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Recording.File = filepath.Join(t.TempDir(), "recording.json")
+	schemaConfiguration := schema.DefaultConfiguration()
+	schemaConfiguration.Privacy = true
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	if _, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: sch,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
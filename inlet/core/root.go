@@ -6,9 +6,12 @@ package core
 
 import (
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/eapache/go-resiliency/breaker"
+	"google.golang.org/grpc"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
@@ -20,6 +23,8 @@ import (
 	"akvorado/inlet/geoip"
 	"akvorado/inlet/kafka"
 	"akvorado/inlet/metadata"
+	"akvorado/inlet/mitigation"
+	"akvorado/inlet/pipeline"
 	"akvorado/inlet/routing"
 )
 
@@ -36,22 +41,57 @@ type Component struct {
 	httpFlowClients    uint32 // for dumping flows
 	httpFlowChannel    chan *schema.FlowMessage
 	httpFlowFlushDelay time.Duration
+	topTalkersClients  atomic.Int32 // for sampling top talkers
+	topTalkersChannel  chan talker
+
+	parkedFlows  atomic.Int64 // flows waiting for metadata
+	retryChannel chan *schema.FlowMessage
 
 	classifierExporterCache  *cache.Cache[exporterInfo, exporterClassification]
 	classifierInterfaceCache *cache.Cache[exporterAndInterfaceInfo, interfaceClassification]
 	classifierErrLogger      reporter.Logger
+
+	flowHookOverruns []uint32
+	customDimensions []customDimension
+	tagRules         atomic.Pointer[[]TagRule]
+	logicalLinks     map[logicalLinkMember]string
+	tagRulesLock     sync.Mutex
+	plugins          []loadedPlugin
+	pluginErrLogger  reporter.Logger
+
+	externalConn          *grpc.ClientConn
+	externalBreaker       *breaker.Breaker
+	externalBreakerOpened atomic.Bool
+	externalErrLogger     reporter.Logger
+
+	drops        *pipeline.Drops
+	dropsHistory *pipeline.History
+
+	tenants tenantAccounting
+
+	recorder *recorder // nil when not recording
 }
 
+const (
+	// dropsHistoryInterval is the interval between two samples of dropped
+	// flows.
+	dropsHistoryInterval = 10 * time.Second
+	// dropsHistoryMaxMinutes is the maximum period to sum dropped flows
+	// over.
+	dropsHistoryMaxMinutes = 15
+)
+
 // Dependencies define the dependencies of the HTTP component.
 type Dependencies struct {
-	Daemon   daemon.Component
-	Flow     *flow.Component
-	Metadata *metadata.Component
-	Routing  *routing.Component
-	GeoIP    *geoip.Component
-	Kafka    *kafka.Component
-	HTTP     *httpserver.Component
-	Schema   *schema.Component
+	Daemon     daemon.Component
+	Flow       *flow.Component
+	Metadata   *metadata.Component
+	Routing    *routing.Component
+	GeoIP      *geoip.Component
+	Kafka      *kafka.Component
+	Mitigation *mitigation.Component // optional
+	HTTP       *httpserver.Component
+	Schema     *schema.Component
 }
 
 // New creates a new core component.
@@ -65,13 +105,52 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		httpFlowClients:    0,
 		httpFlowChannel:    make(chan *schema.FlowMessage, 10),
 		httpFlowFlushDelay: time.Second,
+		topTalkersChannel:  make(chan talker, 100),
+		retryChannel:       make(chan *schema.FlowMessage, configuration.MetadataRetryQueueSize),
 
 		classifierExporterCache:  cache.New[exporterInfo, exporterClassification](),
 		classifierInterfaceCache: cache.New[exporterAndInterfaceInfo, interfaceClassification](),
 		classifierErrLogger:      r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		externalErrLogger:        r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		pluginErrLogger:          r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+
+		flowHookOverruns: make([]uint32, len(configuration.FlowHooks)),
+
+		drops: pipeline.NewDrops(r),
+
+		tenants: tenantAccounting{usages: map[string]*tenantUsage{}},
+	}
+	if err := checkEnrichmentStages(c.config.EnrichmentStages); err != nil {
+		return nil, err
+	}
+	c.dropsHistory = pipeline.NewHistory(c.drops,
+		int(dropsHistoryMaxMinutes*time.Minute/dropsHistoryInterval)+1)
+	for _, path := range c.config.Plugins {
+		enrich, err := loadPlugin(path)
+		if err != nil {
+			return nil, err
+		}
+		c.plugins = append(c.plugins, loadedPlugin{Name: pluginName(path), Enrich: enrich})
+	}
+	if err := c.initCustomDimensions(); err != nil {
+		return nil, err
+	}
+	if err := c.initTagRules(); err != nil {
+		return nil, err
+	}
+	if err := c.initLogicalLinks(); err != nil {
+		return nil, err
+	}
+	if err := c.initExternal(); err != nil {
+		return nil, err
+	}
+	if err := c.initRecording(); err != nil {
+		return nil, err
 	}
 	c.d.Daemon.Track(&c.t, "inlet/core")
 	c.initMetrics()
+	c.initEnrichmentStagesMetrics()
+	c.initTenantsMetrics()
 	return &c, nil
 }
 
@@ -99,8 +178,70 @@ func (c *Component) Start() error {
 		}
 	})
 
+	// Dropped flows history
+	c.dropsHistory.Record(time.Now())
+	c.t.Go(func() error {
+		ticker := time.NewTicker(dropsHistoryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case now := <-ticker.C:
+				c.dropsHistory.Record(now)
+			}
+		}
+	})
+
+	// Inventory
+	if c.config.InventoryInterval > 0 {
+		c.t.Go(func() error {
+			ticker := time.NewTicker(c.config.InventoryInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-c.t.Dying():
+					return nil
+				case now := <-ticker.C:
+					c.sendInventory(now)
+				}
+			}
+		})
+	}
+
+	// Exporter liveness events
+	if c.config.ExporterEvents {
+		c.t.Go(func() error {
+			for {
+				select {
+				case <-c.t.Dying():
+					return nil
+				case event := <-c.d.Flow.ExporterEvents():
+					c.sendExporterEvent(event)
+				}
+			}
+		})
+	}
+
 	c.r.RegisterHealthcheck("core", c.channelHealthcheck())
 	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flows", c.FlowsHTTPHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/metadata/exporter", c.exporterInterfacesHandler)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/metadata/invalidate", c.adminInvalidateMetadataHandler)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/flow/reset", c.adminResetFlowHandler)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/geoip/reload", c.adminReloadGeoIPHandler)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/restart/:component", c.adminRestartHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/admin/drops", c.adminDropsHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/admin/top-talkers", c.adminTopTalkersHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/admin/routing/lookup", c.adminRoutingLookupHandler)
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/admin/tags", c.tagRulesListHandler)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/tags", c.tagRulesAddHandler)
+	c.d.HTTP.GinRouter.DELETE("/api/v0/inlet/admin/tags/:id", c.tagRulesDeleteHandler)
+	if c.config.Tenants.Enabled {
+		c.d.HTTP.GinRouter.GET("/api/v0/inlet/tenants/usage", c.tenantsUsageHandler)
+	}
+	if c.config.Probes {
+		c.d.HTTP.GinRouter.POST("/api/v0/inlet/probes", c.probesHandler)
+	}
 	return nil
 }
 
@@ -108,46 +249,146 @@ func (c *Component) Start() error {
 func (c *Component) runWorker(workerID int) error {
 	c.r.Debug().Int("worker", workerID).Msg("starting core worker")
 
+	// When plugins or external enrichment are enabled, flows are batched
+	// before being forwarded.
+	batching := c.externalConn != nil || len(c.plugins) > 0
+	batchSize, flushInterval := c.batchParameters()
+	var batch []*schema.FlowMessage
+	var batchTenants []string
+	var flushTimer *time.Timer
+	var flushChan <-chan time.Time
+	flush := func(external bool) {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushTimer, flushChan = nil, nil
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if len(c.plugins) > 0 {
+			rejected := c.enrichWithPlugins(batch)
+			kept := 0
+			for idx, flow := range batch {
+				if !rejected[idx] {
+					batch[kept], batchTenants[kept] = flow, batchTenants[idx]
+					kept++
+				}
+			}
+			batch, batchTenants = batch[:kept], batchTenants[:kept]
+		}
+		if external && c.externalConn != nil && len(batch) > 0 {
+			c.enrichWithExternal(batch)
+		}
+		for idx, flow := range batch {
+			c.forwardFlow(flow.ExporterAddress.Unmap().String(), batchTenants[idx], flow)
+		}
+		batch = batch[:0]
+		batchTenants = batchTenants[:0]
+	}
+	handle := func(exporter string, flow *schema.FlowMessage, retry bool) {
+		// Enrichment
+		ip := flow.ExporterAddress
+		tenant, skip := c.enrichFlow(ip, exporter, flow, retry)
+		if skip {
+			return
+		}
+
+		if !batching {
+			c.forwardFlow(exporter, tenant, flow)
+			return
+		}
+		batch = append(batch, flow)
+		batchTenants = append(batchTenants, tenant)
+		if len(batch) >= batchSize {
+			flush(true)
+		} else if flushTimer == nil {
+			flushTimer = time.NewTimer(flushInterval)
+			flushChan = flushTimer.C
+		}
+	}
+
 	for {
 		select {
 		case <-c.t.Dying():
 			c.r.Debug().Int("worker", workerID).Msg("stopping core worker")
+			flush(false)
 			return nil
 		case cb, ok := <-c.healthy:
 			if ok {
 				cb(reporter.HealthcheckOK, fmt.Sprintf("worker %d ok", workerID))
 			}
+		case <-flushChan:
+			flush(true)
+		case flow := <-c.retryChannel:
+			c.parkedFlows.Add(-1)
+			handle(flow.ExporterAddress.Unmap().String(), flow, true)
 		case flow := <-c.d.Flow.Flows():
 			if flow == nil {
 				c.r.Info().Int("worker", workerID).Msg("no more flow available, stopping")
+				flush(true)
 				return nil
 			}
-
 			exporter := flow.ExporterAddress.Unmap().String()
 			c.metrics.flowsReceived.WithLabelValues(exporter).Inc()
+			handle(exporter, flow, false)
+		}
+	}
+}
 
-			// Enrichment
-			ip := flow.ExporterAddress
-			if skip := c.enrichFlow(ip, exporter, flow); skip {
-				continue
-			}
+// batchParameters returns the maximum size of a batch of flows and the
+// maximum time to wait to complete it. When both plugins and external
+// enrichment are enabled, the smallest values are used.
+func (c *Component) batchParameters() (int, time.Duration) {
+	size, interval := c.config.PluginBatchSize, c.config.PluginFlushInterval
+	if c.externalConn != nil {
+		if len(c.plugins) == 0 || c.config.ExternalEnrichment.BatchSize < size {
+			size = c.config.ExternalEnrichment.BatchSize
+		}
+		if len(c.plugins) == 0 || c.config.ExternalEnrichment.FlushInterval < interval {
+			interval = c.config.ExternalEnrichment.FlushInterval
+		}
+	}
+	return size, interval
+}
 
-			// Serialize flow to Protobuf
-			buf := c.d.Schema.ProtobufMarshal(flow)
+// forwardFlow serializes the provided flow and sends it to Kafka. The tenant
+// is used for ingest accounting.
+func (c *Component) forwardFlow(exporter string, tenant string, flow *schema.FlowMessage) {
+	// Account traffic for attack detection
+	if c.d.Mitigation != nil {
+		c.d.Mitigation.Observe(flow)
+	}
 
-			// Forward to Kafka. This could block and buf is now owned by the
-			// Kafka subsystem!
-			c.metrics.flowsForwarded.WithLabelValues(exporter).Inc()
-			c.d.Kafka.Send(exporter, buf)
+	// If we have clients sampling top talkers, send them the volume
+	if c.topTalkersClients.Load() > 0 {
+		bytes, _ := c.d.Schema.ProtobufVarint(flow, schema.ColumnBytes)
+		select {
+		case c.topTalkersChannel <- talker{
+			src:   flow.SrcAddr.Unmap(),
+			dst:   flow.DstAddr.Unmap(),
+			bytes: bytes * uint64(max(flow.SamplingRate, 1)),
+		}: // OK
+		default: // Overflow, best effort and ignore
+		}
+	}
 
-			// If we have HTTP clients, send to them too
-			if atomic.LoadUint32(&c.httpFlowClients) > 0 {
-				select {
-				case c.httpFlowChannel <- flow: // OK
-				default: // Overflow, best effort and ignore
-				}
-			}
+	// Serialize flow to Protobuf
+	key := c.d.Kafka.PartitionKey(exporter, flow)
+	buf := c.d.Schema.ProtobufMarshal(flow)
+	if c.config.Tenants.Enabled && !c.accountTenant(tenant, len(buf), time.Now()) {
+		return
+	}
 
+	// Forward to Kafka. This could block and buf is now owned by the
+	// Kafka subsystem!
+	c.metrics.flowsForwarded.WithLabelValues(exporter).Inc()
+	c.d.Kafka.Send(exporter, key, buf)
+
+	// If we have HTTP clients, send to them too
+	if atomic.LoadUint32(&c.httpFlowClients) > 0 {
+		select {
+		case c.httpFlowChannel <- flow: // OK
+		default: // Overflow, best effort and ignore
 		}
 	}
 }
@@ -161,7 +402,21 @@ func (c *Component) Stop() error {
 	}()
 	c.r.Info().Msg("stopping core component")
 	c.t.Kill(nil)
-	return c.t.Wait()
+	if err := c.t.Wait(); err != nil {
+		return err
+	}
+	if c.recorder != nil {
+		c.recorder.lock.Lock()
+		err := c.recorder.close()
+		c.recorder.lock.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	if c.externalConn != nil {
+		return c.externalConn.Close()
+	}
+	return nil
 }
 
 func (c *Component) channelHealthcheck() reporter.HealthcheckFunc {
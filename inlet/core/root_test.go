@@ -116,15 +116,20 @@ func TestCore(t *testing.T) {
 		flowComponent.Inject(flowMessage("192.0.2.143", 434, 679))
 
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_core_", "-flows_processing_")
+		gotMetrics := r.GetMetrics("akvorado_inlet_core_", "-flows_processing_", "-inventory_", "-probe_", "-enrichment_")
 		expectedMetrics := map[string]string{
+			`classifier_exporter_cache_hits_total`:                               "0",
+			`classifier_exporter_cache_misses_total`:                             "0",
 			`classifier_exporter_cache_size_items`:                               "0",
+			`classifier_interface_cache_hits_total`:                              "0",
+			`classifier_interface_cache_misses_total`:                            "0",
 			`classifier_interface_cache_size_items`:                              "0",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.142"}`: "1",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.143"}`: "3",
 			`received_flows_total{exporter="192.0.2.142"}`:                       "1",
 			`received_flows_total{exporter="192.0.2.143"}`:                       "3",
 			`flows_http_clients`:                                                 "0",
+			`parked_flows`:                                                       "0",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -139,7 +144,11 @@ func TestCore(t *testing.T) {
 		time.Sleep(20 * time.Millisecond)
 		gotMetrics = r.GetMetrics("akvorado_inlet_core_", "classifier_", "-flows_processing_", "flows_", "received_", "forwarded_")
 		expectedMetrics = map[string]string{
+			`classifier_exporter_cache_hits_total`:                               "0",
+			`classifier_exporter_cache_misses_total`:                             "0",
 			`classifier_exporter_cache_size_items`:                               "0",
+			`classifier_interface_cache_hits_total`:                              "0",
+			`classifier_interface_cache_misses_total`:                            "0",
 			`classifier_interface_cache_size_items`:                              "0",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.142"}`: "1",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.143"}`: "3",
@@ -189,7 +198,11 @@ func TestCore(t *testing.T) {
 		time.Sleep(20 * time.Millisecond)
 		gotMetrics = r.GetMetrics("akvorado_inlet_core_", "classifier_", "-flows_processing_", "flows_", "forwarded_", "received_")
 		expectedMetrics = map[string]string{
+			`classifier_exporter_cache_hits_total`:                                     "0",
+			`classifier_exporter_cache_misses_total`:                                   "0",
 			`classifier_exporter_cache_size_items`:                                     "0",
+			`classifier_interface_cache_hits_total`:                                    "0",
+			`classifier_interface_cache_misses_total`:                                  "0",
 			`classifier_interface_cache_size_items`:                                    "0",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.142"}`:       "1",
 			`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.143"}`:       "3",
@@ -198,7 +211,7 @@ func TestCore(t *testing.T) {
 			`received_flows_total{exporter="192.0.2.143"}`:                             "4",
 			`forwarded_flows_total{exporter="192.0.2.142"}`:                            "2",
 			`forwarded_flows_total{exporter="192.0.2.143"}`:                            "1",
-			`flows_http_clients`: "0",
+			`flows_http_clients`:                                                       "0",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -208,7 +221,7 @@ func TestCore(t *testing.T) {
 	// Test the healthcheck function
 	t.Run("healthcheck", func(t *testing.T) {
 		got := r.RunHealthchecks(context.Background())
-		if diff := helpers.Diff(got.Details["core"], reporter.HealthcheckResult{
+		if diff := helpers.Diff(got.Details["core"].HealthcheckResult, reporter.HealthcheckResult{
 			Status: reporter.HealthcheckOK,
 			Reason: "worker 0 ok",
 		}); diff != "" {
@@ -365,3 +378,64 @@ func TestCore(t *testing.T) {
 		}
 	})
 }
+
+func TestParkFlows(t *testing.T) {
+	r := reporter.NewMock(t)
+	daemonComponent := daemon.NewMock(t)
+	metadataComponent := metadata.NewMock(t, r, metadata.DefaultConfiguration(),
+		metadata.Dependencies{Daemon: daemonComponent})
+	flowComponent := flow.NewMock(t, r, flow.DefaultConfiguration())
+	kafkaComponent, kafkaProducer := kafka.NewMock(t, r, kafka.DefaultConfiguration())
+	sch := schema.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.MetadataRetryQueueSize = 2
+	c, err := New(r, configuration, Dependencies{
+		Daemon:   daemonComponent,
+		Flow:     flowComponent,
+		Metadata: metadataComponent,
+		GeoIP:    geoip.NewMock(t, r),
+		Kafka:    kafkaComponent,
+		HTTP:     httpserver.NewMock(t, r),
+		Routing:  routing.NewMock(t, r),
+		Schema:   sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flowMessage := func(ifIndex uint32) *schema.FlowMessage {
+		return &schema.FlowMessage{
+			TimeReceived:    200,
+			SamplingRate:    1000,
+			ExporterAddress: netip.MustParseAddr("192.0.2.142"),
+			InIf:            ifIndex,
+			OutIf:           677,
+		}
+	}
+
+	// Flows are parked and forwarded once metadata is polled
+	for i := 0; i < 2; i++ {
+		kafkaProducer.ExpectInputAndSucceed()
+	}
+	flowComponent.Inject(flowMessage(434))
+	flowComponent.Inject(flowMessage(435))
+	time.Sleep(100 * time.Millisecond)
+
+	// When the queue is full, flows are dropped
+	c.parkedFlows.Store(int64(configuration.MetadataRetryQueueSize))
+	flowComponent.Inject(flowMessage(436))
+	time.Sleep(20 * time.Millisecond)
+	c.parkedFlows.Store(0)
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "parked_", "flows_errors_", "forwarded_")
+	expectedMetrics := map[string]string{
+		`parked_flows`: "0",
+		`parked_flows_total{exporter="192.0.2.142"}`:                         "2",
+		`flows_errors_total{error="SNMP cache miss",exporter="192.0.2.142"}`: "1",
+		`forwarded_flows_total{exporter="192.0.2.142"}`:                      "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
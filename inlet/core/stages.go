@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"akvorado/common/helpers/bimap"
+	"akvorado/common/reporter"
+)
+
+// EnrichmentStage describes one stage of the enrichment pipeline.
+type EnrichmentStage int
+
+const (
+	// EnrichmentStageMetadata looks up the exporter and interfaces in the
+	// metadata cache.
+	EnrichmentStageMetadata EnrichmentStage = iota
+	// EnrichmentStageClassification applies the exporter and interface
+	// classifiers.
+	EnrichmentStageClassification
+	// EnrichmentStageRouting adds network masks, next hop, AS numbers,
+	// communities and AS path.
+	EnrichmentStageRouting
+	// EnrichmentStageGeoIP adds source and destination countries.
+	EnrichmentStageGeoIP
+	// EnrichmentStageApplication applies the application classifiers.
+	EnrichmentStageApplication
+	// EnrichmentStageCustom runs the flow hooks, the custom dimensions and
+	// the tag rules.
+	EnrichmentStageCustom
+)
+
+var enrichmentStageMap = bimap.New(map[EnrichmentStage]string{
+	EnrichmentStageMetadata:       "metadata",
+	EnrichmentStageClassification: "classification",
+	EnrichmentStageRouting:        "routing",
+	EnrichmentStageGeoIP:          "geoip",
+	EnrichmentStageApplication:    "application",
+	EnrichmentStageCustom:         "custom",
+})
+
+// MarshalText turns an enrichment stage to text.
+func (es EnrichmentStage) MarshalText() ([]byte, error) {
+	got, ok := enrichmentStageMap.LoadValue(es)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown stage")
+}
+
+// String turns an enrichment stage to string.
+func (es EnrichmentStage) String() string {
+	got, _ := enrichmentStageMap.LoadValue(es)
+	return got
+}
+
+// UnmarshalText provides an enrichment stage from a string.
+func (es *EnrichmentStage) UnmarshalText(input []byte) error {
+	got, ok := enrichmentStageMap.LoadKey(string(input))
+	if ok {
+		*es = got
+		return nil
+	}
+	return errors.New("unknown stage")
+}
+
+// checkEnrichmentStages checks the list of enrichment stages is valid: no
+// duplicate and stages requiring metadata are after the metadata stage.
+func checkEnrichmentStages(stages []EnrichmentStage) error {
+	for i, stage := range stages {
+		if slices.Contains(stages[:i], stage) {
+			return fmt.Errorf("enrichment stage %q is present twice", stage)
+		}
+		switch stage {
+		case EnrichmentStageClassification, EnrichmentStageCustom:
+			metadata := slices.Index(stages, EnrichmentStageMetadata)
+			if metadata > i {
+				return fmt.Errorf("enrichment stage %q should be after %q",
+					stage, EnrichmentStageMetadata)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Component) initEnrichmentStagesMetrics() {
+	c.metrics.enrichmentStageTimes = c.r.HistogramVec(
+		reporter.HistogramOpts{
+			Name:    "enrichment_stage_seconds",
+			Help:    "Time spent in each enrichment stage.",
+			Buckets: []float64{1e-6, 5e-6, 10e-6, 25e-6, 50e-6, 100e-6, 250e-6, 500e-6, 1e-3, 5e-3},
+		},
+		[]string{"stage"})
+	c.metrics.enrichmentStageErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "enrichment_stage_errors_total",
+			Help: "Number of flows skipped or rejected by each enrichment stage.",
+		},
+		[]string{"stage"})
+}
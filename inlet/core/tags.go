@@ -0,0 +1,237 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+)
+
+// maxTagRules is the maximum number of tag rules. As each rule is evaluated
+// for each flow, this bounds the CPU usage of tagging.
+const maxTagRules = 50
+
+// TagRule is a temporary rule setting the Tag column of the flows matching
+// its expression until it expires.
+type TagRule struct {
+	ID         string    `json:"id"`
+	Expression string    `json:"expression" binding:"required"`
+	Tag        string    `json:"tag" binding:"required"`
+	Expires    time.Time `json:"expires" binding:"required"`
+
+	program *vm.Program
+}
+
+// compile compiles the expression of a tag rule. It uses the same
+// environment as custom dimensions.
+func (tr *TagRule) compile() error {
+	counter := nodeCounter{}
+	program, err := expr.Compile(tr.Expression,
+		expr.Env(customDimensionEnvironment{}),
+		expr.AsBool(),
+		expr.Patch(&counter))
+	if err != nil {
+		return fmt.Errorf("cannot compile expression: %w", err)
+	}
+	if counter.count > maxFlowHookNodes {
+		return fmt.Errorf("expression is too complex (%d nodes, maximum is %d)",
+			counter.count, maxFlowHookNodes)
+	}
+	tr.program = program
+	return nil
+}
+
+// activeTagRules returns the tag rules not expired yet.
+func activeTagRules(rules []TagRule, now time.Time) []TagRule {
+	return slices.DeleteFunc(slices.Clone(rules), func(rule TagRule) bool {
+		return !rule.Expires.After(now)
+	})
+}
+
+// applyTagRules tags the flow with the tag of the first matching rule.
+func (c *Component) applyTagRules(exporterStr string, state *flowHookState, rules []TagRule) {
+	now := time.Now()
+	env := customDimensionEnvironment{
+		Format:    format,
+		InNetwork: inNetwork,
+		Flow:      state.info(c.d.Schema),
+	}
+	for _, rule := range rules {
+		if !rule.Expires.After(now) {
+			continue
+		}
+		result, err := expr.Run(rule.program, env)
+		if err != nil {
+			c.classifierErrLogger.Err(err).
+				Str("type", "tag").
+				Str("rule", rule.ID).
+				Str("exporter", exporterStr).
+				Msg("error executing tag rule")
+			c.metrics.classifierErrors.WithLabelValues("tag", rule.ID).Inc()
+			continue
+		}
+		if result.(bool) {
+			c.d.Schema.ProtobufAppendBytes(state.flow, schema.ColumnTag, []byte(rule.Tag))
+			c.metrics.taggedFlows.WithLabelValues(rule.Tag).Inc()
+			return
+		}
+	}
+}
+
+// updateTagRules replaces the tag rules, dropping expired ones, and saves
+// them when a file is configured. It should be called with tagRulesLock held.
+func (c *Component) updateTagRules(rules []TagRule) error {
+	rules = activeTagRules(rules, time.Now())
+	if c.config.TagRulesFile != "" {
+		if err := saveTagRules(c.config.TagRulesFile, rules); err != nil {
+			return err
+		}
+	}
+	c.tagRules.Store(&rules)
+	return nil
+}
+
+// initTagRules loads the tag rules from the configured file.
+func (c *Component) initTagRules() error {
+	rules := []TagRule{}
+	if c.config.TagRulesFile != "" {
+		var err error
+		rules, err = loadTagRules(c.config.TagRulesFile)
+		if err != nil {
+			return err
+		}
+		rules = activeTagRules(rules, time.Now())
+	}
+	c.tagRules.Store(&rules)
+	return nil
+}
+
+// saveTagRules saves the tag rules to the provided file.
+func saveTagRules(rulesFile string, rules []TagRule) error {
+	tmpFile, err := os.CreateTemp(
+		filepath.Dir(rulesFile),
+		fmt.Sprintf("%s-*", filepath.Base(rulesFile)))
+	if err != nil {
+		return fmt.Errorf("unable to create tag rules file %q: %w", rulesFile, err)
+	}
+	defer func() {
+		tmpFile.Close()           // ignore errors
+		os.Remove(tmpFile.Name()) // ignore errors
+	}()
+	if err := json.NewEncoder(tmpFile).Encode(rules); err != nil {
+		return fmt.Errorf("unable to encode tag rules: %w", err)
+	}
+	if err := os.Rename(tmpFile.Name(), rulesFile); err != nil {
+		return fmt.Errorf("unable to write tag rules file %q: %w", rulesFile, err)
+	}
+	return nil
+}
+
+// loadTagRules loads the tag rules from the provided file. A missing file is
+// not an error.
+func loadTagRules(rulesFile string) ([]TagRule, error) {
+	f, err := os.Open(rulesFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []TagRule{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to load tag rules %q: %w", rulesFile, err)
+	}
+	defer f.Close()
+	rules := []TagRule{}
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("unable to decode tag rules: %w", err)
+	}
+	for idx := range rules {
+		if err := rules[idx].compile(); err != nil {
+			return nil, fmt.Errorf("invalid tag rule %s: %w", rules[idx].ID, err)
+		}
+	}
+	return rules, nil
+}
+
+// tagRulesListHandler lists the active tag rules.
+func (c *Component) tagRulesListHandler(gc *gin.Context) {
+	rules := activeTagRules(*c.tagRules.Load(), time.Now())
+	gc.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// tagRulesAddHandler adds a new tag rule.
+func (c *Component) tagRulesAddHandler(gc *gin.Context) {
+	if column, _ := c.d.Schema.LookupColumnByKey(schema.ColumnTag); column.Disabled {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Tag column is not enabled."})
+		return
+	}
+	var rule TagRule
+	if err := gc.ShouldBindJSON(&rule); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if !rule.Expires.After(time.Now()) {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Expiration should be in the future."})
+		return
+	}
+	if err := rule.compile(); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	var id [6]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot generate rule ID."})
+		return
+	}
+	rule.ID = hex.EncodeToString(id[:])
+
+	c.tagRulesLock.Lock()
+	defer c.tagRulesLock.Unlock()
+	rules := activeTagRules(*c.tagRules.Load(), time.Now())
+	if len(rules) >= maxTagRules {
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"message": fmt.Sprintf("Too many tag rules (maximum is %d).", maxTagRules),
+		})
+		return
+	}
+	if err := c.updateTagRules(append(rules, rule)); err != nil {
+		c.r.Err(err).Msg("cannot update tag rules")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot save tag rules."})
+		return
+	}
+	c.r.Info().Str("rule", rule.ID).Str("tag", rule.Tag).Msg("tag rule added")
+	gc.JSON(http.StatusOK, gin.H{"id": rule.ID})
+}
+
+// tagRulesDeleteHandler deletes a tag rule before its expiration.
+func (c *Component) tagRulesDeleteHandler(gc *gin.Context) {
+	id := gc.Param("id")
+	c.tagRulesLock.Lock()
+	defer c.tagRulesLock.Unlock()
+	rules := activeTagRules(*c.tagRules.Load(), time.Now())
+	idx := slices.IndexFunc(rules, func(rule TagRule) bool { return rule.ID == id })
+	if idx < 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Tag rule not found."})
+		return
+	}
+	if err := c.updateTagRules(slices.Delete(rules, idx, idx+1)); err != nil {
+		c.r.Err(err).Msg("cannot update tag rules")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot save tag rules."})
+		return
+	}
+	c.r.Info().Str("rule", id).Msg("tag rule deleted")
+	gc.JSON(http.StatusOK, gin.H{"message": "Tag rule deleted."})
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func newTagRulesComponent(t *testing.T, r *reporter.Reporter, configuration Configuration, enabled bool) (*Component, *httpserver.Component) {
+	t.Helper()
+	schemaConfiguration := schema.DefaultConfiguration()
+	if enabled {
+		schemaConfiguration.Enabled = []schema.ColumnKey{schema.ColumnTag}
+	}
+	sch, err := schema.New(schemaConfiguration)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	h := httpserver.NewMock(t, r)
+	c, err := New(r, configuration, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: sch,
+		HTTP:   h,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/inlet/admin/tags", c.tagRulesListHandler)
+	h.GinRouter.POST("/api/v0/inlet/admin/tags", c.tagRulesAddHandler)
+	h.GinRouter.DELETE("/api/v0/inlet/admin/tags/:id", c.tagRulesDeleteHandler)
+	return c, h
+}
+
+func addTagRule(t *testing.T, h *httpserver.Component, rule gin.H) string {
+	t.Helper()
+	body, _ := json.Marshal(rule)
+	resp, err := http.Post(fmt.Sprintf("http://%s/api/v0/inlet/admin/tags", h.LocalAddr()),
+		"application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST error:\n%+v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST status code %d", resp.StatusCode)
+	}
+	var answer struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		t.Fatalf("POST decode error:\n%+v", err)
+	}
+	return answer.ID
+}
+
+func TestTagRulesDisabledColumn(t *testing.T) {
+	r := reporter.NewMock(t)
+	_, h := newTagRulesComponent(t, r, DefaultConfiguration(), false)
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/admin/tags",
+			JSONInput: gin.H{
+				"expression": `Flow.SrcAS == 64501`,
+				"tag":        "study",
+				"expires":    "2100-01-01T00:00:00Z",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Tag column is not enabled."},
+		},
+	})
+}
+
+func TestTagRulesAPI(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TagRulesFile = filepath.Join(t.TempDir(), "tags.json")
+	_, h := newTagRulesComponent(t, r, configuration, true)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "missing tag",
+			URL:         "/api/v0/inlet/admin/tags",
+			JSONInput: gin.H{
+				"expression": `Flow.SrcAS == 64501`,
+				"expires":    "2100-01-01T00:00:00Z",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Key: 'TagRule.Tag' Error:Field validation for 'Tag' failed on the 'required' tag",
+			},
+		}, {
+			Description: "expired",
+			URL:         "/api/v0/inlet/admin/tags",
+			JSONInput: gin.H{
+				"expression": `Flow.SrcAS == 64501`,
+				"tag":        "study",
+				"expires":    "2000-01-01T00:00:00Z",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{"message": "Expiration should be in the future."},
+		}, {
+			Description: "not a boolean",
+			URL:         "/api/v0/inlet/admin/tags",
+			JSONInput: gin.H{
+				"expression": `Flow.SrcAS`,
+				"tag":        "study",
+				"expires":    "2100-01-01T00:00:00Z",
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Cannot compile expression: expected bool, but got uint32",
+			},
+		}, {
+			Description: "delete unknown",
+			Method:      "DELETE",
+			URL:         "/api/v0/inlet/admin/tags/unknown",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Tag rule not found."},
+		},
+	})
+
+	id1 := addTagRule(t, h, gin.H{
+		"expression": `InNetwork(Flow.DstAddr, "203.0.113.0/24")`,
+		"tag":        "candidate-peer",
+		"expires":    "2100-01-01T00:00:00Z",
+	})
+	id2 := addTagRule(t, h, gin.H{
+		"expression": `Flow.SrcAS == 64501`,
+		"tag":        "study",
+		"expires":    "2100-01-02T00:00:00Z",
+	})
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "delete",
+			Method:      "DELETE",
+			URL:         fmt.Sprintf("/api/v0/inlet/admin/tags/%s", id2),
+			JSONOutput:  gin.H{"message": "Tag rule deleted."},
+		}, {
+			Description: "list",
+			URL:         "/api/v0/inlet/admin/tags",
+			JSONOutput: gin.H{
+				"rules": []gin.H{
+					{
+						"id":         id1,
+						"expression": `InNetwork(Flow.DstAddr, "203.0.113.0/24")`,
+						"tag":        "candidate-peer",
+						"expires":    "2100-01-01T00:00:00Z",
+					},
+				},
+			},
+		},
+	})
+
+	// Rules are restored from the file
+	c2, _ := newTagRulesComponent(t, r, configuration, true)
+	got := *c2.tagRules.Load()
+	if len(got) != 1 || got[0].ID != id1 || got[0].program == nil {
+		t.Fatalf("initTagRules() got %+v", got)
+	}
+}
+
+func TestApplyTagRules(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, _ := newTagRulesComponent(t, r, DefaultConfiguration(), true)
+	rules := []TagRule{
+		{ID: "1", Expression: `Flow.SrcAS == 64501`, Tag: "expired", Expires: time.Now().Add(-time.Minute)},
+		{ID: "2", Expression: `Flow.SrcAS == 64502`, Tag: "other", Expires: time.Now().Add(time.Hour)},
+		{ID: "3", Expression: `InNetwork(Flow.DstAddr, "203.0.113.0/24")`, Tag: "candidate-peer", Expires: time.Now().Add(time.Hour)},
+		{ID: "4", Expression: `Flow.SrcAS == 64501`, Tag: "study", Expires: time.Now().Add(time.Hour)},
+	}
+	for idx := range rules {
+		if err := rules[idx].compile(); err != nil {
+			t.Fatalf("compile() error:\n%+v", err)
+		}
+	}
+
+	flow := &schema.FlowMessage{
+		ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.142"),
+		SrcAddr:         netip.MustParseAddr("::ffff:198.51.100.10"),
+		DstAddr:         netip.MustParseAddr("::ffff:203.0.113.10"),
+		SrcAS:           64501,
+	}
+	var exporterName string
+	var inIfSpeed, outIfSpeed uint32
+	exporter := exporterClassification{}
+	inIf := interfaceClassification{}
+	outIf := interfaceClassification{}
+	c.applyTagRules("192.0.2.142", &flowHookState{
+		flow:         flow,
+		exporterName: &exporterName,
+		exporter:     &exporter,
+		inIfSpeed:    &inIfSpeed,
+		outIfSpeed:   &outIfSpeed,
+		inIf:         &inIf,
+		outIf:        &outIf,
+	}, rules)
+
+	expected := map[schema.ColumnKey]interface{}{
+		schema.ColumnTag: []byte("candidate-peer"),
+	}
+	if diff := helpers.Diff(flow.ProtobufDebug, expected); diff != "" {
+		t.Fatalf("applyTagRules() (-got, +want):\n%s", diff)
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_", "tagged_")
+	expectedMetrics := map[string]string{
+		`tagged_flows_total{tag="candidate-peer"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
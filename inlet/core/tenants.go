@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/reporter"
+	"akvorado/inlet/pipeline"
+)
+
+// TenantsConfiguration defines per-tenant ingest accounting and quotas.
+// Tenants are identified by the tenant of the exporter classification.
+type TenantsConfiguration struct {
+	// Enabled tells to account flows and bytes for each tenant.
+	Enabled bool
+	// Period is the duration over which quotas apply.
+	Period time.Duration `validate:"min=1m"`
+	// DefaultQuota is the quota for tenants without a specific one.
+	DefaultQuota TenantQuota
+	// Quotas maps tenants to their quota.
+	Quotas map[string]TenantQuota
+}
+
+// TenantQuota defines the ingest quota of a tenant during a period. A zero
+// value means there is no limit. When a soft limit is reached, a warning is
+// logged. When a hard limit is reached, flows are dropped until the end of
+// the period.
+type TenantQuota struct {
+	// SoftFlows is the number of flows triggering a warning.
+	SoftFlows uint64 `json:"soft-flows"`
+	// HardFlows is the maximum number of flows.
+	HardFlows uint64 `json:"hard-flows"`
+	// SoftBytes is the number of bytes sent to Kafka triggering a warning.
+	SoftBytes uint64 `json:"soft-bytes"`
+	// HardBytes is the maximum number of bytes sent to Kafka.
+	HardBytes uint64 `json:"hard-bytes"`
+}
+
+// DefaultTenantsConfiguration returns the default configuration for tenants.
+func DefaultTenantsConfiguration() TenantsConfiguration {
+	return TenantsConfiguration{
+		Period: 24 * time.Hour,
+	}
+}
+
+// tenantUsage is the ingest accounting of a tenant.
+type tenantUsage struct {
+	flows        uint64 // during the current period
+	bytes        uint64 // during the current period
+	dropped      uint64 // during the current period
+	totalFlows   uint64 // since start
+	totalBytes   uint64 // since start
+	softExceeded bool
+}
+
+// tenantAccounting is the ingest accounting of all tenants.
+type tenantAccounting struct {
+	lock        sync.Mutex
+	periodStart time.Time
+	usages      map[string]*tenantUsage
+}
+
+// quota returns the quota of the provided tenant.
+func (tc TenantsConfiguration) quota(tenant string) TenantQuota {
+	if quota, ok := tc.Quotas[tenant]; ok {
+		return quota
+	}
+	return tc.DefaultQuota
+}
+
+// accountTenant accounts a flow of the provided size for the provided
+// tenant. It returns false when the flow should be dropped as the tenant is
+// over its hard quota.
+func (c *Component) accountTenant(tenant string, size int, now time.Time) bool {
+	c.tenants.lock.Lock()
+	defer c.tenants.lock.Unlock()
+	if now.Sub(c.tenants.periodStart) >= c.config.Tenants.Period {
+		c.tenants.periodStart = now.Truncate(c.config.Tenants.Period)
+		for _, usage := range c.tenants.usages {
+			usage.flows, usage.bytes, usage.dropped = 0, 0, 0
+			usage.softExceeded = false
+		}
+	}
+	usage, ok := c.tenants.usages[tenant]
+	if !ok {
+		usage = &tenantUsage{}
+		c.tenants.usages[tenant] = usage
+	}
+	quota := c.config.Tenants.quota(tenant)
+	if (quota.HardFlows > 0 && usage.flows >= quota.HardFlows) ||
+		(quota.HardBytes > 0 && usage.bytes+uint64(size) > quota.HardBytes) {
+		if usage.dropped == 0 {
+			c.r.Warn().
+				Str("tenant", tenant).
+				Msgf("hard quota exceeded, drop flows until %s",
+					c.tenants.periodStart.Add(c.config.Tenants.Period))
+		}
+		usage.dropped++
+		c.metrics.tenantDroppedFlows.WithLabelValues(tenant).Inc()
+		c.drops.Add(pipeline.StageQuota, 1)
+		return false
+	}
+	usage.flows++
+	usage.bytes += uint64(size)
+	usage.totalFlows++
+	usage.totalBytes += uint64(size)
+	c.metrics.tenantFlows.WithLabelValues(tenant).Inc()
+	c.metrics.tenantBytes.WithLabelValues(tenant).Add(float64(size))
+	if !usage.softExceeded &&
+		((quota.SoftFlows > 0 && usage.flows >= quota.SoftFlows) ||
+			(quota.SoftBytes > 0 && usage.bytes >= quota.SoftBytes)) {
+		usage.softExceeded = true
+		c.r.Warn().
+			Str("tenant", tenant).
+			Uint64("flows", usage.flows).
+			Uint64("bytes", usage.bytes).
+			Msg("soft quota exceeded")
+	}
+	return true
+}
+
+func (c *Component) initTenantsMetrics() {
+	c.metrics.tenantFlows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "tenant_flows_total",
+			Help: "Number of flows forwarded to Kafka for each tenant.",
+		},
+		[]string{"tenant"},
+	)
+	c.metrics.tenantBytes = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "tenant_bytes_total",
+			Help: "Number of bytes forwarded to Kafka for each tenant.",
+		},
+		[]string{"tenant"},
+	)
+	c.metrics.tenantDroppedFlows = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "tenant_dropped_flows_total",
+			Help: "Number of flows dropped because the tenant is over its hard quota.",
+		},
+		[]string{"tenant"},
+	)
+}
+
+type tenantUsageOutput struct {
+	Tenant       string      `json:"tenant"`
+	Flows        uint64      `json:"flows"`
+	Bytes        uint64      `json:"bytes"`
+	DroppedFlows uint64      `json:"dropped-flows"`
+	TotalFlows   uint64      `json:"total-flows"`
+	TotalBytes   uint64      `json:"total-bytes"`
+	Status       string      `json:"status"`
+	Quota        TenantQuota `json:"quota"`
+}
+
+// tenantsUsageHandler returns the ingest accounting of each tenant for the
+// current period.
+func (c *Component) tenantsUsageHandler(gc *gin.Context) {
+	c.tenants.lock.Lock()
+	periodStart := c.tenants.periodStart
+	tenants := make([]tenantUsageOutput, 0, len(c.tenants.usages))
+	for tenant, usage := range c.tenants.usages {
+		status := "ok"
+		if usage.dropped > 0 {
+			status = "hard-quota-exceeded"
+		} else if usage.softExceeded {
+			status = "soft-quota-exceeded"
+		}
+		tenants = append(tenants, tenantUsageOutput{
+			Tenant:       tenant,
+			Flows:        usage.flows,
+			Bytes:        usage.bytes,
+			DroppedFlows: usage.dropped,
+			TotalFlows:   usage.totalFlows,
+			TotalBytes:   usage.totalBytes,
+			Status:       status,
+			Quota:        c.config.Tenants.quota(tenant),
+		})
+	}
+	c.tenants.lock.Unlock()
+	sort.Slice(tenants, func(i, j int) bool {
+		return tenants[i].Tenant < tenants[j].Tenant
+	})
+	var periodEnd time.Time
+	if !periodStart.IsZero() {
+		periodEnd = periodStart.Add(c.config.Tenants.Period)
+	}
+	gc.JSON(http.StatusOK, gin.H{
+		"period-start": periodStart,
+		"period-end":   periodEnd,
+		"tenants":      tenants,
+	})
+}
@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestTenantQuotas(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Tenants.Enabled = true
+	config.Tenants.Period = time.Hour
+	config.Tenants.DefaultQuota = TenantQuota{HardBytes: 1000}
+	config.Tenants.Quotas = map[string]TenantQuota{
+		"team-a": {SoftFlows: 2, HardFlows: 3},
+		"team-b": {},
+	}
+	h := httpserver.NewMock(t, r)
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		Schema: schema.NewMock(t),
+		HTTP:   h,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	h.GinRouter.GET("/api/v0/inlet/tenants/usage", c.tenantsUsageHandler)
+
+	now := time.Date(2024, 5, 1, 10, 20, 0, 0, time.UTC)
+	cases := []struct {
+		Tenant   string
+		Size     int
+		Expected bool
+	}{
+		{"team-a", 100, true},
+		{"team-a", 100, true}, // soft quota reached
+		{"team-a", 100, true},
+		{"team-a", 100, false}, // hard quota reached
+		{"team-b", 10000, true},
+		{"team-c", 600, true},
+		{"team-c", 600, false}, // hard quota reached
+		{"team-c", 400, true},
+	}
+	for idx, tc := range cases {
+		if got := c.accountTenant(tc.Tenant, tc.Size, now); got != tc.Expected {
+			t.Errorf("accountTenant(%d) == %v, expected %v", idx, got, tc.Expected)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_core_tenant_")
+	expectedMetrics := map[string]string{
+		`bytes_total{tenant="team-a"}`:         "300",
+		`bytes_total{tenant="team-b"}`:         "10000",
+		`bytes_total{tenant="team-c"}`:         "1000",
+		`dropped_flows_total{tenant="team-a"}`: "1",
+		`dropped_flows_total{tenant="team-c"}`: "1",
+		`flows_total{tenant="team-a"}`:         "3",
+		`flows_total{tenant="team-b"}`:         "1",
+		`flows_total{tenant="team-c"}`:         "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "usage",
+			URL:         "/api/v0/inlet/tenants/usage",
+			JSONOutput: gin.H{
+				"period-start": "2024-05-01T10:00:00Z",
+				"period-end":   "2024-05-01T11:00:00Z",
+				"tenants": []gin.H{
+					{
+						"tenant":        "team-a",
+						"flows":         3,
+						"bytes":         300,
+						"dropped-flows": 1,
+						"total-flows":   3,
+						"total-bytes":   300,
+						"status":        "hard-quota-exceeded",
+						"quota":         gin.H{"soft-flows": 2, "hard-flows": 3, "soft-bytes": 0, "hard-bytes": 0},
+					}, {
+						"tenant":        "team-b",
+						"flows":         1,
+						"bytes":         10000,
+						"dropped-flows": 0,
+						"total-flows":   1,
+						"total-bytes":   10000,
+						"status":        "ok",
+						"quota":         gin.H{"soft-flows": 0, "hard-flows": 0, "soft-bytes": 0, "hard-bytes": 0},
+					}, {
+						"tenant":        "team-c",
+						"flows":         2,
+						"bytes":         1000,
+						"dropped-flows": 1,
+						"total-flows":   2,
+						"total-bytes":   1000,
+						"status":        "hard-quota-exceeded",
+						"quota":         gin.H{"soft-flows": 0, "hard-flows": 0, "soft-bytes": 0, "hard-bytes": 1000},
+					},
+				},
+			},
+		},
+	})
+
+	// Next period
+	if !c.accountTenant("team-a", 100, now.Add(time.Hour)) {
+		t.Error("accountTenant() == false after the end of the period")
+	}
+	c.tenants.lock.Lock()
+	usage := *c.tenants.usages["team-a"]
+	c.tenants.lock.Unlock()
+	if diff := helpers.Diff(usage, tenantUsage{
+		flows:      1,
+		bytes:      100,
+		totalFlows: 4,
+		totalBytes: 400,
+	}); diff != "" {
+		t.Fatalf("accountTenant() (-got, +want):\n%s", diff)
+	}
+}
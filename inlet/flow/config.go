@@ -4,11 +4,20 @@
 package flow
 
 import (
+	"errors"
+	"net/netip"
+	"time"
+
 	"golang.org/x/time/rate"
 
 	"akvorado/common/helpers"
+	"akvorado/common/helpers/bimap"
+	"akvorado/common/persist"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input"
 	"akvorado/inlet/flow/input/file"
+	"akvorado/inlet/flow/input/pcap"
+	"akvorado/inlet/flow/input/stdin"
 	"akvorado/inlet/flow/input/udp"
 )
 
@@ -19,6 +28,67 @@ type Configuration struct {
 	// RateLimit defines a rate limit on the number of flows per
 	// second. The limit is per-exporter.
 	RateLimit rate.Limit `validate:"isdefault|min=100"`
+	// PacketRateLimit defines a rate limit on the number of packets per
+	// second. The limit is per-exporter.
+	PacketRateLimit rate.Limit `validate:"isdefault|min=10"`
+	// RateLimitPolicy defines how flows are handled when an exporter exceeds
+	// one of the rate limits.
+	RateLimitPolicy RateLimitPolicy
+	// MemoryBudget is the memory, in bytes, the inlet should not use
+	// beyond. When exceeded, UDP inputs shed load according to
+	// MemoryBudgetPolicy. 0 disables the memory budget.
+	MemoryBudget uint64
+	// MemoryBudgetPolicy defines how UDP inputs shed load when the memory
+	// budget is exceeded.
+	MemoryBudgetPolicy MemoryBudgetPolicy
+	// SlowDecodeThreshold is the duration above which decoding a packet is
+	// considered slow. Slow samples get a trace ID, attached as an exemplar
+	// to the decoding time histogram and logged. 0 disables this.
+	SlowDecodeThreshold time.Duration
+	// LateFlowThreshold is the delay between the end of a flow and its
+	// reception above which the flow is accounted at its end time instead of
+	// its reception time. 0 disables this.
+	LateFlowThreshold time.Duration
+	// MaxPacketSize is the average packet size, in bytes, above which the
+	// counters of a flow are considered anomalous. Such flows are dropped.
+	// 0 disables this check.
+	MaxPacketSize uint64
+	// VendorElements maps exporter subnets to the vendor-specific elements
+	// to decode for them.
+	VendorElements *helpers.SubnetMap[[]decoder.VendorElement] `validate:"omitempty,dive,dive"`
+	// SamplingRates maps exporter subnets to rules overriding or
+	// defaulting the sampling rate advertised by exporters.
+	SamplingRates *helpers.SubnetMap[decoder.SamplingRateRules] `validate:"omitempty,dive,dive"`
+	// Quirks maps exporter subnets to workarounds for broken exports.
+	Quirks *helpers.SubnetMap[decoder.Quirks]
+	// HeaderDepth is the maximum number of stacked headers (VLAN tags, MPLS
+	// labels, IPv6 extension headers) to parse in sampled packet headers.
+	HeaderDepth int `validate:"min=0"`
+	// TemplatesPersistFile defines a file to store templates and sampling
+	// rates to survive restarts.
+	TemplatesPersistFile string
+	// Redis defines the Redis server used to persist templates and sampling
+	// rates.
+	Redis persist.RedisConfiguration
+	// TemplatesPersistRedis defines how to store templates and sampling rates
+	// in Redis to survive restarts. It is useful when no local storage is
+	// available or to share them between inlets receiving flows from the same
+	// exporters.
+	TemplatesPersistRedis persist.RedisStoreConfiguration
+	// SilentExporterTimeout is the duration without flows after which an
+	// exporter which previously sent flows is reported as silent. 0 disables
+	// exporter liveness tracking.
+	SilentExporterTimeout time.Duration `validate:"eq=0|min=10s"`
+	// SilentExporterWebhook is an URL receiving exporter liveness events.
+	SilentExporterWebhook string `validate:"omitempty,url"`
+	// ConsistencyCheckInterval is the interval between two comparisons of
+	// the interface counters sent by exporters with the volumes derived from
+	// flows. 0 disables consistency checks.
+	ConsistencyCheckInterval time.Duration `validate:"eq=0|min=1m"`
+	// ConsistencyCheckTolerance is the relative difference between the
+	// volumes derived from flows and the interface counters above which an
+	// interface is reported as inconsistent.
+	ConsistencyCheckTolerance float64 `validate:"gte=0,lte=1"`
 }
 
 // DefaultConfiguration represents the default configuration for the flow component
@@ -31,7 +101,100 @@ func DefaultConfiguration() Configuration {
 			Decoder: "sflow",
 			Config:  udp.DefaultConfiguration(),
 		}},
+		SlowDecodeThreshold:       10 * time.Millisecond,
+		MaxPacketSize:             65535,
+		HeaderDepth:               decoder.DefaultHeaderDepth,
+		ConsistencyCheckTolerance: 0.25,
+		Redis: persist.RedisConfiguration{
+			Protocol: "tcp",
+		},
+		TemplatesPersistRedis: persist.RedisStoreConfiguration{
+			Key: "akvorado:flow:templates",
+		},
+	}
+}
+
+// RateLimitPolicy defines how to handle flows over the rate limits.
+type RateLimitPolicy int
+
+const (
+	// RateLimitSample drops the excess flows and increases the sampling rate
+	// of the accepted flows to compensate.
+	RateLimitSample RateLimitPolicy = iota
+	// RateLimitDrop drops the excess flows without compensation.
+	RateLimitDrop
+)
+
+var rateLimitPolicyMap = bimap.New(map[RateLimitPolicy]string{
+	RateLimitSample: "sample",
+	RateLimitDrop:   "drop",
+})
+
+// MarshalText turns a rate limit policy to text
+func (rlp RateLimitPolicy) MarshalText() ([]byte, error) {
+	got, ok := rateLimitPolicyMap.LoadValue(rlp)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown rate limit policy")
+}
+
+// String turns a rate limit policy to string
+func (rlp RateLimitPolicy) String() string {
+	got, _ := rateLimitPolicyMap.LoadValue(rlp)
+	return got
+}
+
+// UnmarshalText provides a rate limit policy from text
+func (rlp *RateLimitPolicy) UnmarshalText(input []byte) error {
+	got, ok := rateLimitPolicyMap.LoadKey(string(input))
+	if ok {
+		*rlp = got
+		return nil
+	}
+	return errors.New("unknown rate limit policy")
+}
+
+// MemoryBudgetPolicy defines how to shed load when the memory budget is
+// exceeded.
+type MemoryBudgetPolicy int
+
+const (
+	// MemoryBudgetPause stops reading packets. They are dropped by the
+	// kernel once the receive buffer is full.
+	MemoryBudgetPause MemoryBudgetPolicy = iota
+	// MemoryBudgetDrop reads packets and drops them.
+	MemoryBudgetDrop
+)
+
+var memoryBudgetPolicyMap = bimap.New(map[MemoryBudgetPolicy]string{
+	MemoryBudgetPause: "pause",
+	MemoryBudgetDrop:  "drop",
+})
+
+// MarshalText turns a memory budget policy to text
+func (mbp MemoryBudgetPolicy) MarshalText() ([]byte, error) {
+	got, ok := memoryBudgetPolicyMap.LoadValue(mbp)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown memory budget policy")
+}
+
+// String turns a memory budget policy to string
+func (mbp MemoryBudgetPolicy) String() string {
+	got, _ := memoryBudgetPolicyMap.LoadValue(mbp)
+	return got
+}
+
+// UnmarshalText provides a memory budget policy from text
+func (mbp *MemoryBudgetPolicy) UnmarshalText(input []byte) error {
+	got, ok := memoryBudgetPolicyMap.LoadKey(string(input))
+	if ok {
+		*mbp = got
+		return nil
 	}
+	return errors.New("unknown memory budget policy")
 }
 
 // InputConfiguration represents the configuration for an input.
@@ -41,6 +204,12 @@ type InputConfiguration struct {
 	// UseSrcAddrForExporterAddr replaces the exporter address by the transport
 	// source address.
 	UseSrcAddrForExporterAddr bool
+	// UseAnnouncedExporterAddr replaces the exporter address by the one
+	// announced by the exporter in options data records, if any.
+	UseAnnouncedExporterAddr bool
+	// ExporterAddresses maps transport source addresses to exporter
+	// addresses. This is useful when exporters are behind NAT.
+	ExporterAddresses map[netip.Addr]netip.Addr
 	// Config is the actual configuration of the input.
 	Config input.Configuration
 }
@@ -56,11 +225,18 @@ func (ic InputConfiguration) MarshalJSON() ([]byte, error) {
 }
 
 var inputs = map[string](func() input.Configuration){
-	"udp":  udp.DefaultConfiguration,
-	"file": file.DefaultConfiguration,
+	"udp":   udp.DefaultConfiguration,
+	"file":  file.DefaultConfiguration,
+	"pcap":  pcap.DefaultConfiguration,
+	"stdin": stdin.DefaultConfiguration,
 }
 
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(
 		helpers.ParametrizedConfigurationUnmarshallerHook(InputConfiguration{}, inputs))
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[[]decoder.VendorElement]())
+	helpers.RegisterSubnetMapValidation[[]decoder.VendorElement]()
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[decoder.SamplingRateRules]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[decoder.Quirks]())
+	helpers.RegisterSubnetMapValidation[decoder.SamplingRateRules]()
 }
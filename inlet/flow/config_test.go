@@ -12,6 +12,8 @@ import (
 	"akvorado/common/helpers/yaml"
 
 	"akvorado/common/helpers"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input/file"
 	"akvorado/inlet/flow/input/udp"
 )
@@ -43,17 +45,19 @@ func TestDecodeConfiguration(t *testing.T) {
 				Inputs: []InputConfiguration{{
 					Decoder: "netflow",
 					Config: &udp.Configuration{
-						Workers:   3,
-						QueueSize: 100000,
-						Listen:    "192.0.2.1:2055",
+						Workers:          3,
+						DecoderQueueSize: 10000,
+						QueueSize:        100000,
+						Listen:           "192.0.2.1:2055",
 					},
 					UseSrcAddrForExporterAddr: true,
 				}, {
 					Decoder: "sflow",
 					Config: &udp.Configuration{
-						Workers:   3,
-						QueueSize: 100000,
-						Listen:    "192.0.2.1:6343",
+						Workers:          3,
+						DecoderQueueSize: 10000,
+						QueueSize:        100000,
+						Listen:           "192.0.2.1:6343",
 					},
 					UseSrcAddrForExporterAddr: false,
 				}},
@@ -92,16 +96,18 @@ func TestDecodeConfiguration(t *testing.T) {
 				Inputs: []InputConfiguration{{
 					Decoder: "netflow",
 					Config: &udp.Configuration{
-						Workers:   3,
-						QueueSize: 100000,
-						Listen:    "192.0.2.1:2055",
+						Workers:          3,
+						DecoderQueueSize: 10000,
+						QueueSize:        100000,
+						Listen:           "192.0.2.1:2055",
 					},
 				}, {
 					Decoder: "sflow",
 					Config: &udp.Configuration{
-						Workers:   3,
-						QueueSize: 100000,
-						Listen:    "192.0.2.1:6343",
+						Workers:          3,
+						DecoderQueueSize: 10000,
+						QueueSize:        100000,
+						Listen:           "192.0.2.1:6343",
 					},
 				}},
 			},
@@ -166,6 +172,152 @@ func TestDecodeConfiguration(t *testing.T) {
 					},
 				}},
 			},
+		}, {
+			Description: "vendor elements",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"inputs": []gin.H{
+						{
+							"type":    "udp",
+							"decoder": "ipfix",
+							"listen":  "192.0.2.1:4739",
+						},
+					},
+					"vendor-elements": gin.H{
+						"192.0.2.0/24": []gin.H{
+							{
+								"enterprise": 2636,
+								"element":    1,
+								"column":     "ForwardingClass",
+							},
+						},
+					},
+				}
+			},
+			Expected: Configuration{
+				Inputs: []InputConfiguration{{
+					Decoder: "ipfix",
+					Config: &udp.Configuration{
+						Workers:          1,
+						DecoderQueueSize: 10000,
+						QueueSize:        100000,
+						Listen:           "192.0.2.1:4739",
+					},
+				}},
+				VendorElements: helpers.MustNewSubnetMap(map[string][]decoder.VendorElement{
+					"::ffff:192.0.2.0/120": {
+						{Enterprise: 2636, Element: 1, Column: schema.ColumnForwardingClass},
+					},
+				}),
+			},
+		}, {
+			Description: "sampling rates",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"sampling-rates": gin.H{
+						"192.0.2.0/24": []gin.H{
+							{
+								"observation-domains": []uint32{1, 2},
+								"override":            1000,
+							}, {
+								"default": 100,
+							},
+						},
+					},
+				}
+			},
+			Expected: Configuration{
+				SamplingRates: helpers.MustNewSubnetMap(map[string]decoder.SamplingRateRules{
+					"::ffff:192.0.2.0/120": {
+						{ObservationDomains: []uint32{1, 2}, Override: 1000},
+						{Default: 100},
+					},
+				}),
+			},
+		}, {
+			Description: "sampling rates without rate",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"sampling-rates": gin.H{
+						"192.0.2.0/24": []gin.H{
+							{"observation-domains": []uint32{1, 2}},
+						},
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "quirks",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"quirks": gin.H{
+						"192.0.2.0/24": gin.H{
+							"swapped-counters":      true,
+							"timestamps-in-seconds": true,
+						},
+					},
+				}
+			},
+			Expected: Configuration{
+				Quirks: helpers.MustNewSubnetMap(map[string]decoder.Quirks{
+					"::ffff:192.0.2.0/120": {
+						SwappedCounters:     true,
+						TimestampsInSeconds: true,
+					},
+				}),
+			},
+		}, {
+			Description: "rate limits",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"rate-limit":        1000,
+					"packet-rate-limit": 100,
+					"rate-limit-policy": "drop",
+				}
+			},
+			Expected: Configuration{
+				RateLimit:       1000,
+				PacketRateLimit: 100,
+				RateLimitPolicy: RateLimitDrop,
+			},
+			SkipValidation: true,
+		}, {
+			Description: "memory budget",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"memory-budget":        1 << 30,
+					"memory-budget-policy": "drop",
+				}
+			},
+			Expected: Configuration{
+				MemoryBudget:       1 << 30,
+				MemoryBudgetPolicy: MemoryBudgetDrop,
+			},
+			SkipValidation: true,
+		}, {
+			Description: "unknown memory budget policy",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"memory-budget-policy": "whatever",
+				}
+			},
+			Error: true,
+		}, {
+			Description: "unknown rate limit policy",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"rate-limit-policy": "whatever",
+				}
+			},
+			Error: true,
 		}, {
 			Description: "incorrect decoder",
 			Initial: func() interface{} {
@@ -220,20 +372,59 @@ func TestMarshalYAML(t *testing.T) {
 	}
 	expected := `inputs:
     - decoder: netflow
+      decoderqueuesize: 0
+      decoderworkers: 0
+      dscp: 0
+      exporteraddresses: {}
+      forwardspoofsource: false
+      forwardto: []
       listen: 192.0.2.11:2055
       queuesize: 1000
       receivebuffer: 0
       type: udp
+      useannouncedexporteraddr: false
       usesrcaddrforexporteraddr: false
       workers: 3
     - decoder: sflow
+      decoderqueuesize: 0
+      decoderworkers: 0
+      dscp: 0
+      exporteraddresses: {}
+      forwardspoofsource: false
+      forwardto: []
       listen: 192.0.2.11:6343
       queuesize: 1000
       receivebuffer: 0
       type: udp
+      useannouncedexporteraddr: false
       usesrcaddrforexporteraddr: true
       workers: 3
 ratelimit: 0
+packetratelimit: 0
+ratelimitpolicy: sample
+memorybudget: 0
+memorybudgetpolicy: pause
+slowdecodethreshold: 0s
+lateflowthreshold: 0s
+maxpacketsize: 0
+vendorelements: null
+samplingrates: null
+quirks: null
+headerdepth: 0
+templatespersistfile: ""
+redis:
+    protocol: ""
+    server: ""
+    username: ""
+    password: ""
+    db: 0
+templatespersistredis:
+    key: ""
+    ttl: 0s
+silentexportertimeout: 0s
+silentexporterwebhook: ""
+consistencycheckinterval: 0s
+consistencychecktolerance: 0
 `
 	if diff := helpers.Diff(strings.Split(string(got), "\n"), strings.Split(expected, "\n")); diff != "" {
 		t.Fatalf("Marshal() (-got, +want):\n%s", diff)
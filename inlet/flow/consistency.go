@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+// InterfaceConsistency is the result of the comparison between the interface
+// counters sent by an exporter and the volume derived from its flows. Ratios
+// are the volume derived from flows divided by the volume from counters. They
+// are missing when the counters did not increase.
+type InterfaceConsistency struct {
+	Exporter    netip.Addr `json:"exporter"`
+	IfIndex     uint32     `json:"if-index"`
+	InRatio     *float64   `json:"in-ratio,omitempty"`
+	OutRatio    *float64   `json:"out-ratio,omitempty"`
+	Discrepancy bool       `json:"discrepancy"`
+}
+
+// interfaceKey identifies an interface of an exporter.
+type interfaceKey struct {
+	exporter netip.Addr
+	ifIndex  uint32
+}
+
+// interfaceVolume is the volume, in bytes, seen in flows for an interface.
+type interfaceVolume struct {
+	in  uint64
+	out uint64
+}
+
+// recordVolumes accounts the volume of the provided flows for their input and
+// output interfaces.
+func (c *Component) recordVolumes(fmsgs []*schema.FlowMessage) {
+	c.volumesLock.Lock()
+	defer c.volumesLock.Unlock()
+	for _, fmsg := range fmsgs {
+		bytes, _ := c.d.Schema.ProtobufVarint(fmsg, schema.ColumnBytes)
+		bytes *= uint64(fmsg.SamplingRate)
+		exporter := fmsg.ExporterAddress.Unmap()
+		if fmsg.InIf != 0 {
+			key := interfaceKey{exporter, fmsg.InIf}
+			volume := c.volumes[key]
+			volume.in += bytes
+			c.volumes[key] = volume
+		}
+		if fmsg.OutIf != 0 {
+			key := interfaceKey{exporter, fmsg.OutIf}
+			volume := c.volumes[key]
+			volume.out += bytes
+			c.volumes[key] = volume
+		}
+	}
+}
+
+// checkConsistency compares the volumes derived from flows since the last
+// check with the interface counters received from exporters during the same
+// period. Only exporters which sent flows during this period are checked.
+func (c *Component) checkConsistency(now time.Time) {
+	counters := map[interfaceKey]decoder.InterfaceCounters{}
+	for _, dec := range c.decoders {
+		provider, ok := dec.(decoder.CountersProvider)
+		if !ok {
+			continue
+		}
+		for exporter, interfaces := range provider.InterfaceCounters() {
+			for ifIndex, ifCounters := range interfaces {
+				counters[interfaceKey{exporter, ifIndex}] = ifCounters
+			}
+		}
+	}
+
+	c.volumesLock.Lock()
+	volumes := c.volumes
+	window := now.Sub(c.volumesStart).Seconds()
+	c.volumes = map[interfaceKey]interfaceVolume{}
+	c.volumesStart = now
+	c.volumesLock.Unlock()
+
+	exporters := map[netip.Addr]bool{}
+	for key := range volumes {
+		exporters[key.exporter] = true
+	}
+	ratio := func(flowBytes uint64, previous, current uint64, elapsed float64) *float64 {
+		if current <= previous || window <= 0 {
+			return nil
+		}
+		result := (float64(flowBytes) / window) / (float64(current-previous) / elapsed)
+		return &result
+	}
+	results := []InterfaceConsistency{}
+	for key, current := range counters {
+		previous, ok := c.previousCounters[key]
+		if !ok || !exporters[key.exporter] || !current.Received.After(previous.Received) {
+			continue
+		}
+		elapsed := current.Received.Sub(previous.Received).Seconds()
+		volume := volumes[key]
+		result := InterfaceConsistency{
+			Exporter: key.exporter,
+			IfIndex:  key.ifIndex,
+			InRatio:  ratio(volume.in, previous.InOctets, current.InOctets, elapsed),
+			OutRatio: ratio(volume.out, previous.OutOctets, current.OutOctets, elapsed),
+		}
+		if result.InRatio == nil && result.OutRatio == nil {
+			continue
+		}
+		for _, r := range []*float64{result.InRatio, result.OutRatio} {
+			if r != nil && (*r < 1-c.config.ConsistencyCheckTolerance || *r > 1+c.config.ConsistencyCheckTolerance) {
+				result.Discrepancy = true
+			}
+		}
+		results = append(results, result)
+	}
+	c.previousCounters = counters
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Exporter != results[j].Exporter {
+			return results[i].Exporter.Less(results[j].Exporter)
+		}
+		return results[i].IfIndex < results[j].IfIndex
+	})
+	inconsistent := 0
+	for _, result := range results {
+		if !result.Discrepancy {
+			continue
+		}
+		inconsistent++
+		c.metrics.consistencyDiscrepancies.WithLabelValues(result.Exporter.String()).Inc()
+		event := c.r.Warn().
+			Str("exporter", result.Exporter.String()).
+			Uint32("if-index", result.IfIndex)
+		if result.InRatio != nil {
+			event = event.Float64("in-ratio", *result.InRatio)
+		}
+		if result.OutRatio != nil {
+			event = event.Float64("out-ratio", *result.OutRatio)
+		}
+		event.Msg("interface counters do not match flows, check sampling configuration")
+	}
+	c.metrics.inconsistentInterfaces.Set(float64(inconsistent))
+
+	c.consistencyLock.Lock()
+	c.consistency = results
+	c.consistencyLock.Unlock()
+}
+
+// runConsistency periodically checks the consistency between interface
+// counters and flows.
+func (c *Component) runConsistency() error {
+	ticker := time.NewTicker(c.config.ConsistencyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case now := <-ticker.C:
+			c.checkConsistency(now)
+		}
+	}
+}
+
+// consistencyHandlerFunc returns the result of the last consistency check.
+func (c *Component) consistencyHandlerFunc(gc *gin.Context) {
+	c.consistencyLock.Lock()
+	results := c.consistency
+	c.consistencyLock.Unlock()
+	gc.JSON(http.StatusOK, gin.H{"interfaces": results})
+}
@@ -0,0 +1,127 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+// countersDecoder is a decoder only providing interface counters.
+type countersDecoder struct {
+	counters map[netip.Addr]map[uint32]decoder.InterfaceCounters
+}
+
+func (cd *countersDecoder) Decode(decoder.RawFlow) []*schema.FlowMessage { return nil }
+func (cd *countersDecoder) Name() string                                 { return "counters" }
+func (cd *countersDecoder) Reset(netip.Addr) bool                        { return false }
+func (cd *countersDecoder) InterfaceCounters() map[netip.Addr]map[uint32]decoder.InterfaceCounters {
+	return cd.counters
+}
+
+func TestConsistency(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	config.ConsistencyCheckInterval = time.Hour // checks are triggered manually
+	c := NewMock(t, r, config)
+	dec := &countersDecoder{}
+	c.decoders = append(c.decoders, dec)
+
+	exporter1 := netip.MustParseAddr("192.0.2.142")
+	exporter2 := netip.MustParseAddr("192.0.2.143")
+	flow := func(exporter netip.Addr, inIf, outIf uint32, bytes uint64) *schema.FlowMessage {
+		bf := &schema.FlowMessage{
+			ExporterAddress: netip.AddrFrom16(exporter.As16()),
+			SamplingRate:    1000,
+			InIf:            inIf,
+			OutIf:           outIf,
+		}
+		c.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, bytes)
+		return bf
+	}
+
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	dec.counters = map[netip.Addr]map[uint32]decoder.InterfaceCounters{
+		exporter1: {
+			10: {InOctets: 1_000_000, OutOctets: 1_000_000, Received: now.Add(-10 * time.Second)},
+			20: {InOctets: 1_000_000, OutOctets: 1_000_000, Received: now.Add(-10 * time.Second)},
+		},
+		exporter2: {
+			10: {InOctets: 1_000_000, OutOctets: 1_000_000, Received: now.Add(-10 * time.Second)},
+		},
+	}
+	c.volumesLock.Lock()
+	c.volumesStart = now.Add(-time.Minute)
+	c.volumesLock.Unlock()
+	c.checkConsistency(now)
+
+	// During one minute, 60 MB went from interface 10 to interface 20 of
+	// exporter 1 according to flows. Counters of interface 10 agree, but
+	// counters of interface 20 tell twice more traffic was sent.
+	c.recordVolumes([]*schema.FlowMessage{
+		flow(exporter1, 10, 20, 40_000),
+		flow(exporter1, 10, 20, 20_000),
+	})
+	dec.counters = map[netip.Addr]map[uint32]decoder.InterfaceCounters{
+		exporter1: {
+			10: {InOctets: 61_000_000, OutOctets: 1_000_000, Received: now.Add(50 * time.Second)},
+			20: {InOctets: 1_000_000, OutOctets: 121_000_000, Received: now.Add(50 * time.Second)},
+		},
+		exporter2: {
+			10: {InOctets: 61_000_000, OutOctets: 1_000_000, Received: now.Add(50 * time.Second)},
+		},
+	}
+	c.checkConsistency(now.Add(time.Minute))
+
+	one, half := 1.0, 0.5
+	expected := []InterfaceConsistency{
+		{Exporter: exporter1, IfIndex: 10, InRatio: &one},
+		{Exporter: exporter1, IfIndex: 20, OutRatio: &half, Discrepancy: true},
+	}
+	c.consistencyLock.Lock()
+	got := c.consistency
+	c.consistencyLock.Unlock()
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("checkConsistency() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_", "inconsistent_", "consistency_")
+	expectedMetrics := map[string]string{
+		`inconsistent_interfaces`:                                 "1",
+		`consistency_discrepancies_total{exporter="192.0.2.142"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	helpers.TestHTTPEndpoints(t, c.d.HTTP.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/flow/consistency",
+			JSONOutput: gin.H{
+				"interfaces": []gin.H{
+					{
+						"exporter":    "192.0.2.142",
+						"if-index":    10,
+						"in-ratio":    1,
+						"discrepancy": false,
+					}, {
+						"exporter":    "192.0.2.142",
+						"if-index":    20,
+						"out-ratio":   0.5,
+						"discrepancy": true,
+					},
+				},
+			},
+		},
+	})
+}
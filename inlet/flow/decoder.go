@@ -4,18 +4,29 @@
 package flow
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"math/bits"
 	"net/netip"
+	"time"
 
+	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/inlet/flow/decoder"
-	"akvorado/inlet/flow/decoder/netflow"
-	"akvorado/inlet/flow/decoder/sflow"
+	"akvorado/inlet/pipeline"
+
+	// Builtin decoders register themselves
+	_ "akvorado/inlet/flow/decoder/netflow"
+	_ "akvorado/inlet/flow/decoder/record"
+	_ "akvorado/inlet/flow/decoder/sflow"
 )
 
 type wrappedDecoder struct {
 	c                         *Component
 	orig                      decoder.Decoder
 	useSrcAddrForExporterAddr bool
+	useAnnouncedExporterAddr  bool
+	exporterAddresses         map[netip.Addr]netip.Addr
 }
 
 // Decode decodes a flow while keeping some stats.
@@ -24,43 +35,128 @@ func (wd *wrappedDecoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 		if r := recover(); r != nil {
 			wd.c.metrics.decoderErrors.WithLabelValues(wd.orig.Name()).
 				Inc()
+			wd.c.drops.Add(pipeline.StageDecode, 1)
 		}
 	}()
+	in.UseAnnouncedExporterAddr = wd.useAnnouncedExporterAddr
+	start := time.Now()
 	decoded := wd.orig.Decode(in)
+	wd.observeDecodeTime(in, time.Since(start))
 
 	if decoded == nil {
 		wd.c.metrics.decoderErrors.WithLabelValues(wd.orig.Name()).
 			Inc()
+		wd.c.drops.Add(pipeline.StageDecode, 1)
 		return nil
 	}
 
-	if wd.useSrcAddrForExporterAddr {
-		exporterAddress, _ := netip.AddrFromSlice(in.Source.To16())
-		for _, f := range decoded {
-			f.ExporterAddress = exporterAddress
+	if wd.useSrcAddrForExporterAddr || len(wd.exporterAddresses) > 0 {
+		sourceAddress, _ := netip.AddrFromSlice(in.Source.To16())
+		exporterAddress, ok := wd.exporterAddresses[sourceAddress.Unmap()]
+		if ok {
+			exporterAddress = netip.AddrFrom16(exporterAddress.As16())
+		} else if wd.useSrcAddrForExporterAddr {
+			exporterAddress, ok = sourceAddress, true
+		}
+		if ok {
+			for _, f := range decoded {
+				f.ExporterAddress = exporterAddress
+			}
 		}
 	}
 
+	decoded = wd.quarantine(decoded)
+
 	wd.c.metrics.decoderStats.WithLabelValues(wd.orig.Name()).
 		Inc()
 	return decoded
 }
 
+// quarantine removes flows with anomalous counters from the provided flows.
+// They are counted, but not forwarded to not pollute aggregates.
+func (wd *wrappedDecoder) quarantine(flows []*schema.FlowMessage) []*schema.FlowMessage {
+	kept := flows[:0]
+	for _, f := range flows {
+		reason := wd.counterAnomaly(f)
+		if reason == "" {
+			kept = append(kept, f)
+			continue
+		}
+		wd.c.metrics.decoderAnomalies.WithLabelValues(wd.orig.Name(), reason).Inc()
+		wd.c.drops.Add(pipeline.StageDecode, 1)
+	}
+	return kept
+}
+
+// counterAnomaly returns the reason why the counters of the provided flow are
+// anomalous, or an empty string if they look sane.
+func (wd *wrappedDecoder) counterAnomaly(f *schema.FlowMessage) string {
+	bytes, _ := wd.c.d.Schema.ProtobufVarint(f, schema.ColumnBytes)
+	packets, _ := wd.c.d.Schema.ProtobufVarint(f, schema.ColumnPackets)
+	samplingRate := max(uint64(f.SamplingRate), 1)
+	for _, counter := range []uint64{bytes, packets} {
+		// Once scaled, counters should fit in 63 bits for aggregates to
+		// not wrap. Larger values are likely counters going backwards.
+		if hi, lo := bits.Mul64(counter, samplingRate); hi != 0 || lo >= 1<<63 {
+			return "overflow"
+		}
+	}
+	if bytes == 0 || packets == 0 {
+		// Some decoders may only provide one of the counters.
+		return ""
+	}
+	if bytes < packets {
+		return "bytes-below-packets"
+	}
+	if wd.c.config.MaxPacketSize > 0 && bytes/packets > wd.c.config.MaxPacketSize {
+		return "packet-too-large"
+	}
+	return ""
+}
+
+// observeDecodeTime records the time spent to decode a packet. When decoding
+// is slow, a trace ID is attached as an exemplar and logged to help find the
+// culprit.
+func (wd *wrappedDecoder) observeDecodeTime(in decoder.RawFlow, elapsed time.Duration) {
+	observer := wd.c.metrics.decoderTime.WithLabelValues(wd.orig.Name())
+	threshold := wd.c.config.SlowDecodeThreshold
+	if threshold == 0 || elapsed < threshold {
+		observer.Observe(elapsed.Seconds())
+		return
+	}
+	var id [8]byte
+	rand.Read(id[:])
+	traceID := hex.EncodeToString(id[:])
+	reporter.ObserveWithExemplar(observer, elapsed.Seconds(), map[string]string{"trace_id": traceID})
+	wd.c.slowDecodeLogger.Warn().
+		Str("decoder", wd.orig.Name()).
+		Str("exporter", in.Source.String()).
+		Str("trace_id", traceID).
+		Dur("duration", elapsed).
+		Msg("slow packet decoding")
+}
+
 // Name returns the name of the original decoder.
 func (wd *wrappedDecoder) Name() string {
 	return wd.orig.Name()
 }
 
+// Reset clears the state of the original decoder for the provided exporter.
+func (wd *wrappedDecoder) Reset(exporter netip.Addr) bool {
+	return wd.orig.Reset(exporter)
+}
+
 // wrapDecoder wraps the provided decoders to get statistics from it.
-func (c *Component) wrapDecoder(d decoder.Decoder, useSrcAddrForExporterAddr bool) decoder.Decoder {
+func (c *Component) wrapDecoder(d decoder.Decoder, input InputConfiguration) decoder.Decoder {
+	exporterAddresses := make(map[netip.Addr]netip.Addr, len(input.ExporterAddresses))
+	for source, exporter := range input.ExporterAddresses {
+		exporterAddresses[source.Unmap()] = exporter
+	}
 	return &wrappedDecoder{
 		c:                         c,
 		orig:                      d,
-		useSrcAddrForExporterAddr: useSrcAddrForExporterAddr,
+		useSrcAddrForExporterAddr: input.UseSrcAddrForExporterAddr,
+		useAnnouncedExporterAddr:  input.UseAnnouncedExporterAddr,
+		exporterAddresses:         exporterAddresses,
 	}
 }
-
-var decoders = map[string]decoder.NewDecoderFunc{
-	"netflow": netflow.New,
-	"sflow":   sflow.New,
-}
@@ -45,41 +45,84 @@ func ParseIPv4(sch *schema.Component, bf *schema.FlowMessage, data []byte) uint6
 	return l3length
 }
 
-// ParseIPv6 parses an IPv6 packet and returns layer-3 length.
-func ParseIPv6(sch *schema.Component, bf *schema.FlowMessage, data []byte) uint64 {
+// ParseIPv6 parses an IPv6 packet and returns layer-3 length. At most depth
+// extension headers are skipped to find the upper-layer protocol.
+func ParseIPv6(sch *schema.Component, bf *schema.FlowMessage, data []byte, depth int) uint64 {
 	var l3length uint64
 	var proto uint8
 	if len(data) < 40 {
 		return 0
 	}
+	depth = headerDepth(depth)
 	l3length = uint64(binary.BigEndian.Uint16(data[4:6])) + 40
 	sch.ProtobufAppendVarint(bf, schema.ColumnEType, helpers.ETypeIPv6)
 	bf.SrcAddr = DecodeIP(data[8:24])
 	bf.DstAddr = DecodeIP(data[24:40])
 	proto = data[6]
-	sch.ProtobufAppendVarint(bf, schema.ColumnProto, uint64(proto))
 	if !sch.IsDisabled(schema.ColumnGroupL3L4) {
 		sch.ProtobufAppendVarint(bf, schema.ColumnIPTos,
 			uint64(binary.BigEndian.Uint16(data[0:2])&0xff0>>4))
 		sch.ProtobufAppendVarint(bf, schema.ColumnIPTTL, uint64(data[7]))
 		sch.ProtobufAppendVarint(bf, schema.ColumnIPv6FlowLabel,
 			uint64(binary.BigEndian.Uint32(data[0:4])&0xfffff))
-		// TODO fragmentID/fragmentOffset are in a separate header
 	}
 	data = data[40:]
+	var fragoffset uint16
+extensions:
+	for depth > 0 && len(data) >= 8 {
+		var length int
+		switch proto {
+		case 0, 43, 60:
+			// Hop-by-hop options, routing, destination options
+			length = (int(data[1]) + 1) * 8
+		case 51:
+			// Authentication header
+			length = (int(data[1]) + 2) * 4
+		case 44:
+			// Fragment
+			length = 8
+			fragoffset = binary.BigEndian.Uint16(data[2:4]) >> 3
+			if !sch.IsDisabled(schema.ColumnGroupL3L4) {
+				sch.ProtobufAppendVarint(bf, schema.ColumnIPFragmentID,
+					uint64(binary.BigEndian.Uint32(data[4:8])))
+				sch.ProtobufAppendVarint(bf, schema.ColumnIPFragmentOffset,
+					uint64(fragoffset))
+			}
+		default:
+			break extensions
+		}
+		proto = data[0]
+		depth--
+		if len(data) < length {
+			data = data[:0]
+		} else {
+			data = data[length:]
+		}
+	}
 	sch.ProtobufAppendVarint(bf, schema.ColumnProto, uint64(proto))
-	ParseL4(sch, bf, data, proto)
+	if fragoffset == 0 {
+		ParseL4(sch, bf, data, proto)
+	}
 	return l3length
 }
 
+// AppendPort appends a port and its bucket. Port buckets are computed by the
+// inlet as ports may not be transmitted (privacy mode).
+func AppendPort(sch *schema.Component, bf *schema.FlowMessage, portKey, bucketKey schema.ColumnKey, port uint64) {
+	sch.ProtobufAppendVarint(bf, portKey, port)
+	if column, ok := sch.LookupColumnByKey(bucketKey); ok && !column.Disabled {
+		column.ProtobufAppendBytes(bf, []byte(sch.PortBucket(port)))
+	}
+}
+
 // ParseL4 parses L4 layer.
 func ParseL4(sch *schema.Component, bf *schema.FlowMessage, data []byte, proto uint8) {
 	if proto == 6 || proto == 17 {
 		// UDP or TCP
 		if len(data) > 4 {
-			sch.ProtobufAppendVarint(bf, schema.ColumnSrcPort,
+			AppendPort(sch, bf, schema.ColumnSrcPort, schema.ColumnSrcPortBucket,
 				uint64(binary.BigEndian.Uint16(data[0:2])))
-			sch.ProtobufAppendVarint(bf, schema.ColumnDstPort,
+			AppendPort(sch, bf, schema.ColumnDstPort, schema.ColumnDstPortBucket,
 				uint64(binary.BigEndian.Uint16(data[2:4])))
 		}
 	}
@@ -108,62 +151,238 @@ func ParseL4(sch *schema.Component, bf *schema.FlowMessage, data []byte, proto u
 			}
 		}
 	}
+	if !sch.IsDisabled(schema.ColumnGroupTunnel) {
+		var dstPort uint16
+		if proto == 17 && len(data) >= 4 {
+			dstPort = binary.BigEndian.Uint16(data[2:4])
+		}
+		AppendTunnelType(sch, bf, proto, dstPort)
+		if dstPort == 4789 && len(data) >= 16 {
+			// VXLAN
+			sch.ProtobufAppendVarint(bf, schema.ColumnTunnelID,
+				uint64(binary.BigEndian.Uint32(data[12:16])>>8))
+			parseInnerEthernet(sch, bf, data[16:])
+		} else if proto == 47 {
+			// GRE
+			parseGRE(sch, bf, data)
+		} else if proto == 4 {
+			// IPv4 encapsulation
+			parseInnerIP(sch, bf, data, helpers.ETypeIPv4)
+		} else if proto == 41 {
+			// IPv6 encapsulation
+			parseInnerIP(sch, bf, data, helpers.ETypeIPv6)
+		}
+	}
+}
+
+// AppendTunnelType sets the encapsulation of a flow, guessed from the protocol
+// and the destination port of the outer packet.
+func AppendTunnelType(sch *schema.Component, bf *schema.FlowMessage, proto uint8, dstPort uint16) {
+	if sch.IsDisabled(schema.ColumnGroupTunnel) {
+		return
+	}
+	var tunnelType schema.TunnelType
+	switch {
+	case proto == 47:
+		tunnelType = schema.TunnelTypeGRE
+	case proto == 17 && dstPort == 4789:
+		tunnelType = schema.TunnelTypeVXLAN
+	case proto == 4 || proto == 41:
+		tunnelType = schema.TunnelTypeIPIP
+	case proto == 50:
+		tunnelType = schema.TunnelTypeESP
+	}
+	sch.ProtobufAppendVarint(bf, schema.ColumnTunnelType, uint64(tunnelType))
 }
 
-// ParseEthernet parses an Ethernet packet and returns L3 length.
-func ParseEthernet(sch *schema.Component, bf *schema.FlowMessage, data []byte) uint64 {
+// parseGRE parses a GRE header and the encapsulated packet as inner fields.
+func parseGRE(sch *schema.Component, bf *schema.FlowMessage, data []byte) {
+	if len(data) < 4 {
+		return
+	}
+	flags := data[0]
+	etherType := binary.BigEndian.Uint16(data[2:4])
+	data = data[4:]
+	if flags&0x80 != 0 {
+		// Checksum present
+		if len(data) < 4 {
+			return
+		}
+		data = data[4:]
+	}
+	if flags&0x20 != 0 {
+		// Key present
+		if len(data) < 4 {
+			return
+		}
+		sch.ProtobufAppendVarint(bf, schema.ColumnTunnelID,
+			uint64(binary.BigEndian.Uint32(data[0:4])))
+		data = data[4:]
+	}
+	if flags&0x10 != 0 {
+		// Sequence number present
+		if len(data) < 4 {
+			return
+		}
+		data = data[4:]
+	}
+	switch etherType {
+	case 0x6558:
+		parseInnerEthernet(sch, bf, data)
+	case helpers.ETypeIPv4, helpers.ETypeIPv6:
+		parseInnerIP(sch, bf, data, etherType)
+	}
+}
+
+// parseInnerEthernet parses an Ethernet frame encapsulated in a tunnel as
+// inner fields. VLAN tags are skipped.
+func parseInnerEthernet(sch *schema.Component, bf *schema.FlowMessage, data []byte) {
+	if len(data) < 14 {
+		return
+	}
+	etherType := binary.BigEndian.Uint16(data[12:14])
+	data = data[14:]
+	for etherType == 0x8100 || etherType == 0x88a8 {
+		if len(data) < 4 {
+			return
+		}
+		etherType = binary.BigEndian.Uint16(data[2:4])
+		data = data[4:]
+	}
+	parseInnerIP(sch, bf, data, etherType)
+}
+
+// parseInnerIP parses an IPv4 or IPv6 packet encapsulated in a tunnel as
+// inner fields. Tunnels are not parsed recursively.
+func parseInnerIP(sch *schema.Component, bf *schema.FlowMessage, data []byte, etherType uint16) {
+	var proto uint8
+	switch etherType {
+	case helpers.ETypeIPv4:
+		if len(data) < 20 {
+			return
+		}
+		sch.ProtobufAppendIP(bf, schema.ColumnSrcAddrInner, DecodeIP(data[12:16]))
+		sch.ProtobufAppendIP(bf, schema.ColumnDstAddrInner, DecodeIP(data[16:20]))
+		proto = data[9]
+		fragoffset := binary.BigEndian.Uint16(data[6:8]) & 0x1fff
+		ihl := int((data[0] & 0xf) * 4)
+		if fragoffset != 0 || len(data) < ihl {
+			data = data[:0]
+		} else {
+			data = data[ihl:]
+		}
+	case helpers.ETypeIPv6:
+		if len(data) < 40 {
+			return
+		}
+		sch.ProtobufAppendIP(bf, schema.ColumnSrcAddrInner, DecodeIP(data[8:24]))
+		sch.ProtobufAppendIP(bf, schema.ColumnDstAddrInner, DecodeIP(data[24:40]))
+		proto = data[6]
+		data = data[40:]
+	default:
+		return
+	}
+	sch.ProtobufAppendVarint(bf, schema.ColumnProtoInner, uint64(proto))
+	if (proto == 6 || proto == 17) && len(data) > 4 {
+		sch.ProtobufAppendVarint(bf, schema.ColumnSrcPortInner,
+			uint64(binary.BigEndian.Uint16(data[0:2])))
+		sch.ProtobufAppendVarint(bf, schema.ColumnDstPortInner,
+			uint64(binary.BigEndian.Uint16(data[2:4])))
+	}
+}
+
+// ParseEthernet parses an Ethernet packet and returns L3 length. At most depth
+// headers (VLAN tags, MPLS labels, PPPoE) are skipped to reach the IP header.
+func ParseEthernet(sch *schema.Component, bf *schema.FlowMessage, data []byte, depth int) uint64 {
 	if len(data) < 14 {
 		return 0
 	}
+	depth = headerDepth(depth)
 	if !sch.IsDisabled(schema.ColumnGroupL2) {
 		sch.ProtobufAppendVarint(bf, schema.ColumnDstMAC,
 			binary.BigEndian.Uint64([]byte{0, 0, data[0], data[1], data[2], data[3], data[4], data[5]}))
 		sch.ProtobufAppendVarint(bf, schema.ColumnSrcMAC,
 			binary.BigEndian.Uint64([]byte{0, 0, data[6], data[7], data[8], data[9], data[10], data[11]}))
 	}
-	etherType := data[12:14]
+	etherType := binary.BigEndian.Uint16(data[12:14])
 	data = data[14:]
-	if etherType[0] == 0x81 && etherType[1] == 0x00 {
-		// 802.1q
-		if len(data) < 4 {
+	for tags := 0; etherType == 0x8100 || etherType == 0x88a8 || etherType == 0x9100; tags++ {
+		// 802.1q, 802.1ad or pre-standard QinQ. Only the two outer tags
+		// are kept.
+		if depth == 0 || len(data) < 4 {
 			return 0
 		}
+		depth--
 		if !sch.IsDisabled(schema.ColumnGroupL2) {
-			bf.SrcVlan = (uint16(data[0]&0xf) << 8) + uint16(data[1])
+			vlan := binary.BigEndian.Uint16(data[0:2]) & 0xfff
+			switch tags {
+			case 0:
+				bf.SrcVlan = vlan
+			case 1:
+				sch.ProtobufAppendVarint(bf, schema.ColumnSrcVlanInner, uint64(vlan))
+			}
 		}
-		etherType = data[2:4]
+		etherType = binary.BigEndian.Uint16(data[2:4])
 		data = data[4:]
 	}
-	if etherType[0] == 0x88 && etherType[1] == 0x47 {
+	if etherType == 0x8864 {
+		// PPPoE session
+		if depth == 0 || len(data) < 8 {
+			return 0
+		}
+		depth--
+		switch binary.BigEndian.Uint16(data[6:8]) {
+		case 0x21:
+			etherType = helpers.ETypeIPv4
+		case 0x57:
+			etherType = helpers.ETypeIPv6
+		default:
+			return 0
+		}
+		data = data[8:]
+	}
+	if etherType == 0x8847 || etherType == 0x8848 {
 		// MPLS
 		for {
-			if len(data) < 5 {
+			if depth == 0 || len(data) < 5 {
 				return 0
 			}
-			label := binary.BigEndian.Uint32(append([]byte{0}, data[:3]...)) >> 4
+			depth--
+			label := binary.BigEndian.Uint32(data[0:4]) >> 12
 			bottom := data[2] & 1
 			data = data[4:]
 			sch.ProtobufAppendVarint(bf, schema.ColumnMPLSLabels, uint64(label))
-			if bottom == 1 || label <= 15 {
-				if data[0]&0xf0>>4 == 4 {
-					etherType = []byte{0x8, 0x0}
-				} else if data[0]&0xf0>>4 == 6 {
-					etherType = []byte{0x86, 0xdd}
-				} else {
-					return 0
-				}
+			if bottom == 1 {
 				break
 			}
 		}
+		switch data[0] >> 4 {
+		case 4:
+			etherType = helpers.ETypeIPv4
+		case 6:
+			etherType = helpers.ETypeIPv6
+		default:
+			return 0
+		}
 	}
-	if etherType[0] == 0x8 && etherType[1] == 0x0 {
+	switch etherType {
+	case helpers.ETypeIPv4:
 		return ParseIPv4(sch, bf, data)
-	} else if etherType[0] == 0x86 && etherType[1] == 0xdd {
-		return ParseIPv6(sch, bf, data)
+	case helpers.ETypeIPv6:
+		return ParseIPv6(sch, bf, data, depth)
 	}
 	return 0
 }
 
+// headerDepth returns the provided maximum number of stacked headers to
+// parse, or the default one if not set.
+func headerDepth(depth int) int {
+	if depth <= 0 {
+		return DefaultHeaderDepth
+	}
+	return depth
+}
+
 // DecodeIP decodes an IP address
 func DecodeIP(b []byte) netip.Addr {
 	if ip, ok := netip.AddrFromSlice(b); ok {
@@ -4,6 +4,7 @@
 package decoder
 
 import (
+	"encoding/binary"
 	"net/netip"
 	"path/filepath"
 	"testing"
@@ -16,7 +17,7 @@ func TestDecodeMPLSAndIPv4(t *testing.T) {
 	sch := schema.NewMock(t).EnableAllColumns()
 	pcap := helpers.ReadPcapL2(t, filepath.Join("testdata", "mpls-ipv4.pcap"))
 	bf := &schema.FlowMessage{}
-	l := ParseEthernet(sch, bf, pcap)
+	l := ParseEthernet(sch, bf, pcap, 0)
 	if l != 40 {
 		t.Errorf("ParseEthernet() returned %d, expected 40", l)
 	}
@@ -46,7 +47,7 @@ func TestDecodeVLANAndIPv6(t *testing.T) {
 	sch := schema.NewMock(t).EnableAllColumns()
 	pcap := helpers.ReadPcapL2(t, filepath.Join("testdata", "vlan-ipv6.pcap"))
 	bf := &schema.FlowMessage{}
-	l := ParseEthernet(sch, bf, pcap)
+	l := ParseEthernet(sch, bf, pcap, 0)
 	if l != 179 {
 		t.Errorf("ParseEthernet() returned %d, expected 179", l)
 	}
@@ -55,14 +56,382 @@ func TestDecodeVLANAndIPv6(t *testing.T) {
 		SrcAddr: netip.MustParseAddr("2402:f000:1:8e01::5555"),
 		DstAddr: netip.MustParseAddr("2607:fcd0:100:2300::b108:2a6b"),
 		ProtobufDebug: map[schema.ColumnKey]interface{}{
-			schema.ColumnEType:  helpers.ETypeIPv6,
-			schema.ColumnProto:  4,
-			schema.ColumnIPTTL:  246,
-			schema.ColumnSrcMAC: 0x00121ef2613d,
-			schema.ColumnDstMAC: 0xc500000082c4,
+			schema.ColumnEType:        helpers.ETypeIPv6,
+			schema.ColumnProto:        4,
+			schema.ColumnIPTTL:        246,
+			schema.ColumnSrcMAC:       0x00121ef2613d,
+			schema.ColumnDstMAC:       0xc500000082c4,
+			schema.ColumnTunnelType:   schema.TunnelTypeIPIP,
+			schema.ColumnSrcAddrInner: netip.MustParseAddr("::ffff:16.0.0.200"),
+			schema.ColumnDstAddrInner: netip.MustParseAddr("::ffff:192.52.166.154"),
+			schema.ColumnProtoInner:   47,
 		},
 	}
 	if diff := helpers.Diff(bf, expected); diff != "" {
 		t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
 	}
 }
+
+// testIPv4 builds an IPv4 header followed by the provided payload.
+func testIPv4(src, dst string, proto uint8, payload []byte) []byte {
+	header := make([]byte, 20)
+	header[0] = 0x45
+	binary.BigEndian.PutUint16(header[2:4], uint16(20+len(payload)))
+	header[8] = 64
+	header[9] = proto
+	s := netip.MustParseAddr(src).As4()
+	d := netip.MustParseAddr(dst).As4()
+	copy(header[12:16], s[:])
+	copy(header[16:20], d[:])
+	return append(header, payload...)
+}
+
+// testL4 builds a TCP or UDP header with the provided ports followed by
+// the provided payload.
+func testL4(src, dst uint16, payload []byte) []byte {
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint16(header[0:2], src)
+	binary.BigEndian.PutUint16(header[2:4], dst)
+	return append(header, payload...)
+}
+
+// testEthernet builds an Ethernet header with the provided ether types
+// (and VLAN tags) followed by the provided payload.
+func testEthernet(tags []byte, payload []byte) []byte {
+	header := []byte{
+		0x00, 0x00, 0x5e, 0x00, 0x53, 0x02, // destination
+		0x00, 0x00, 0x5e, 0x00, 0x53, 0x01, // source
+	}
+	header = append(header, tags...)
+	return append(header, payload...)
+}
+
+func TestDecodeQinQ(t *testing.T) {
+	sch := schema.NewMock(t).EnableAllColumns()
+	packet := testEthernet(
+		[]byte{0x88, 0xa8, 0x00, 0x64, 0x81, 0x00, 0x00, 0xc8, 0x08, 0x00},
+		testIPv4("192.0.2.1", "192.0.2.2", 17, testL4(5000, 53, nil)))
+	bf := &schema.FlowMessage{}
+	l := ParseEthernet(sch, bf, packet, 0)
+	if l != 28 {
+		t.Errorf("ParseEthernet() returned %d, expected 28", l)
+	}
+	expected := schema.FlowMessage{
+		SrcVlan: 100,
+		SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+		DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnEType:        helpers.ETypeIPv4,
+			schema.ColumnProto:        17,
+			schema.ColumnSrcPort:      5000,
+			schema.ColumnDstPort:      53,
+			schema.ColumnIPTTL:        64,
+			schema.ColumnSrcVlanInner: 200,
+			schema.ColumnSrcMAC:       0x00005e005301,
+			schema.ColumnDstMAC:       0x00005e005302,
+		},
+	}
+	if diff := helpers.Diff(bf, expected); diff != "" {
+		t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeVXLAN(t *testing.T) {
+	sch := schema.NewMock(t).EnableAllColumns()
+	inner := testEthernet([]byte{0x08, 0x00},
+		testIPv4("198.51.100.1", "198.51.100.2", 6, testL4(33000, 443, nil)))
+	vxlan := append([]byte{0x08, 0x00, 0x00, 0x00, 0x00, 0x13, 0x89, 0x00}, inner...)
+	packet := testEthernet([]byte{0x08, 0x00},
+		testIPv4("192.0.2.1", "192.0.2.2", 17, testL4(54321, 4789, vxlan)))
+	bf := &schema.FlowMessage{}
+	ParseEthernet(sch, bf, packet, 0)
+	expected := schema.FlowMessage{
+		SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+		DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnEType:        helpers.ETypeIPv4,
+			schema.ColumnProto:        17,
+			schema.ColumnSrcPort:      54321,
+			schema.ColumnDstPort:      4789,
+			schema.ColumnIPTTL:        64,
+			schema.ColumnSrcMAC:       0x00005e005301,
+			schema.ColumnDstMAC:       0x00005e005302,
+			schema.ColumnTunnelID:     5001,
+			schema.ColumnTunnelType:   schema.TunnelTypeVXLAN,
+			schema.ColumnSrcAddrInner: netip.MustParseAddr("::ffff:198.51.100.1"),
+			schema.ColumnDstAddrInner: netip.MustParseAddr("::ffff:198.51.100.2"),
+			schema.ColumnProtoInner:   6,
+			schema.ColumnSrcPortInner: 33000,
+			schema.ColumnDstPortInner: 443,
+		},
+	}
+	if diff := helpers.Diff(bf, expected); diff != "" {
+		t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeGRE(t *testing.T) {
+	sch := schema.NewMock(t).EnableAllColumns()
+	gre := append([]byte{0x20, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x2a},
+		testIPv4("198.51.100.1", "198.51.100.2", 17, testL4(5000, 53, nil))...)
+	packet := testEthernet([]byte{0x08, 0x00},
+		testIPv4("192.0.2.1", "192.0.2.2", 47, gre))
+	bf := &schema.FlowMessage{}
+	ParseEthernet(sch, bf, packet, 0)
+	expected := schema.FlowMessage{
+		SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+		DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnEType:        helpers.ETypeIPv4,
+			schema.ColumnProto:        47,
+			schema.ColumnIPTTL:        64,
+			schema.ColumnSrcMAC:       0x00005e005301,
+			schema.ColumnDstMAC:       0x00005e005302,
+			schema.ColumnTunnelID:     42,
+			schema.ColumnTunnelType:   schema.TunnelTypeGRE,
+			schema.ColumnSrcAddrInner: netip.MustParseAddr("::ffff:198.51.100.1"),
+			schema.ColumnDstAddrInner: netip.MustParseAddr("::ffff:198.51.100.2"),
+			schema.ColumnProtoInner:   17,
+			schema.ColumnSrcPortInner: 5000,
+			schema.ColumnDstPortInner: 53,
+		},
+	}
+	if diff := helpers.Diff(bf, expected); diff != "" {
+		t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeESP(t *testing.T) {
+	sch := schema.NewMock(t).EnableAllColumns()
+	packet := testEthernet([]byte{0x08, 0x00},
+		testIPv4("192.0.2.1", "192.0.2.2", 50, make([]byte, 16)))
+	bf := &schema.FlowMessage{}
+	ParseEthernet(sch, bf, packet, 0)
+	expected := schema.FlowMessage{
+		SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+		DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnEType:      helpers.ETypeIPv4,
+			schema.ColumnProto:      50,
+			schema.ColumnIPTTL:      64,
+			schema.ColumnSrcMAC:     0x00005e005301,
+			schema.ColumnDstMAC:     0x00005e005302,
+			schema.ColumnTunnelType: schema.TunnelTypeESP,
+		},
+	}
+	if diff := helpers.Diff(bf, expected); diff != "" {
+		t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
+	}
+}
+
+// testIPv6 builds an IPv6 header followed by the provided payload.
+func testIPv6(src, dst string, nextHeader uint8, payload []byte) []byte {
+	header := make([]byte, 40)
+	header[0] = 0x60
+	binary.BigEndian.PutUint16(header[4:6], uint16(len(payload)))
+	header[6] = nextHeader
+	header[7] = 64
+	s := netip.MustParseAddr(src).As16()
+	d := netip.MustParseAddr(dst).As16()
+	copy(header[8:24], s[:])
+	copy(header[24:40], d[:])
+	return append(header, payload...)
+}
+
+// testMPLS builds a MPLS label stack followed by the provided payload.
+func testMPLS(labels []uint32, payload []byte) []byte {
+	stack := make([]byte, 4*len(labels))
+	for idx, label := range labels {
+		entry := label<<12 | 64
+		if idx == len(labels)-1 {
+			entry |= 1 << 8
+		}
+		binary.BigEndian.PutUint32(stack[4*idx:], entry)
+	}
+	return append(stack, payload...)
+}
+
+func TestDecodeStackedHeaders(t *testing.T) {
+	cases := []struct {
+		Description string
+		Depth       int
+		Packet      []byte
+		L3Length    uint64
+		Expected    schema.FlowMessage
+	}{
+		{
+			Description: "triple VLAN tags",
+			Packet: testEthernet(
+				[]byte{0x88, 0xa8, 0x00, 0x64, 0x81, 0x00, 0x00, 0xc8, 0x81, 0x00, 0x01, 0x2c, 0x08, 0x00},
+				testIPv4("192.0.2.1", "192.0.2.2", 17, testL4(5000, 53, nil))),
+			L3Length: 28,
+			Expected: schema.FlowMessage{
+				SrcVlan: 100,
+				SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+				DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:        helpers.ETypeIPv4,
+					schema.ColumnProto:        17,
+					schema.ColumnSrcPort:      5000,
+					schema.ColumnDstPort:      53,
+					schema.ColumnIPTTL:        64,
+					schema.ColumnSrcVlanInner: 200,
+				},
+			},
+		}, {
+			Description: "QinQ and MPLS with IPv4",
+			Packet: testEthernet(
+				[]byte{0x91, 0x00, 0x00, 0x64, 0x81, 0x00, 0x00, 0xc8, 0x88, 0x47},
+				testMPLS([]uint32{18, 24},
+					testIPv4("192.0.2.1", "192.0.2.2", 6, testL4(33000, 443, nil)))),
+			L3Length: 28,
+			Expected: schema.FlowMessage{
+				SrcVlan: 100,
+				SrcAddr: netip.MustParseAddr("::ffff:192.0.2.1"),
+				DstAddr: netip.MustParseAddr("::ffff:192.0.2.2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:        helpers.ETypeIPv4,
+					schema.ColumnProto:        6,
+					schema.ColumnSrcPort:      33000,
+					schema.ColumnDstPort:      443,
+					schema.ColumnIPTTL:        64,
+					schema.ColumnSrcVlanInner: 200,
+					schema.ColumnMPLSLabels:   []uint32{18, 24},
+				},
+			},
+		}, {
+			Description: "VLAN and MPLS with entropy label and IPv6",
+			Packet: testEthernet(
+				[]byte{0x81, 0x00, 0x00, 0x64, 0x88, 0x47},
+				testMPLS([]uint32{18, 7, 1000, 2},
+					testIPv6("2001:db8::1", "2001:db8::2", 17, testL4(5000, 53, nil)))),
+			L3Length: 48,
+			Expected: schema.FlowMessage{
+				SrcVlan: 100,
+				SrcAddr: netip.MustParseAddr("2001:db8::1"),
+				DstAddr: netip.MustParseAddr("2001:db8::2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:      helpers.ETypeIPv6,
+					schema.ColumnProto:      17,
+					schema.ColumnSrcPort:    5000,
+					schema.ColumnDstPort:    53,
+					schema.ColumnIPTTL:      64,
+					schema.ColumnMPLSLabels: []uint32{18, 7, 1000, 2},
+				},
+			},
+		}, {
+			Description: "PPPoE with IPv6 extension headers",
+			Packet: testEthernet(
+				[]byte{0x88, 0x64, 0x11, 0x00, 0x00, 0x01, 0x00, 0x40, 0x00, 0x57},
+				testIPv6("2001:db8::1", "2001:db8::2", 0,
+					append([]byte{43, 0, 1, 4, 0, 0, 0, 0},
+						append([]byte{6, 0, 0, 0, 0, 0, 0, 0},
+							testL4(33000, 443, make([]byte, 12))...)...))),
+			L3Length: 76,
+			Expected: schema.FlowMessage{
+				SrcAddr: netip.MustParseAddr("2001:db8::1"),
+				DstAddr: netip.MustParseAddr("2001:db8::2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:   helpers.ETypeIPv6,
+					schema.ColumnProto:   6,
+					schema.ColumnSrcPort: 33000,
+					schema.ColumnDstPort: 443,
+					schema.ColumnIPTTL:   64,
+				},
+			},
+		}, {
+			Description: "IPv6 first fragment",
+			Packet: testEthernet([]byte{0x86, 0xdd},
+				testIPv6("2001:db8::1", "2001:db8::2", 44,
+					append([]byte{17, 0, 0x00, 0x01, 0x00, 0x00, 0x30, 0x39},
+						testL4(5000, 53, nil)...))),
+			L3Length: 56,
+			Expected: schema.FlowMessage{
+				SrcAddr: netip.MustParseAddr("2001:db8::1"),
+				DstAddr: netip.MustParseAddr("2001:db8::2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:        helpers.ETypeIPv6,
+					schema.ColumnProto:        17,
+					schema.ColumnSrcPort:      5000,
+					schema.ColumnDstPort:      53,
+					schema.ColumnIPTTL:        64,
+					schema.ColumnIPFragmentID: 12345,
+				},
+			},
+		}, {
+			Description: "IPv6 subsequent fragment",
+			Packet: testEthernet([]byte{0x86, 0xdd},
+				testIPv6("2001:db8::1", "2001:db8::2", 44,
+					append([]byte{17, 0, 0x00, 0xb8, 0x00, 0x00, 0x30, 0x39},
+						testL4(5000, 53, nil)...))),
+			L3Length: 56,
+			Expected: schema.FlowMessage{
+				SrcAddr: netip.MustParseAddr("2001:db8::1"),
+				DstAddr: netip.MustParseAddr("2001:db8::2"),
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnEType:            helpers.ETypeIPv6,
+					schema.ColumnProto:            17,
+					schema.ColumnIPTTL:            64,
+					schema.ColumnIPFragmentID:     12345,
+					schema.ColumnIPFragmentOffset: 23,
+				},
+			},
+		}, {
+			Description: "too many headers",
+			Depth:       2,
+			Packet: testEthernet(
+				[]byte{0x81, 0x00, 0x00, 0x64, 0x88, 0x47},
+				testMPLS([]uint32{18, 24},
+					testIPv4("192.0.2.1", "192.0.2.2", 6, testL4(33000, 443, nil)))),
+			L3Length: 0,
+			Expected: schema.FlowMessage{
+				SrcVlan: 100,
+				ProtobufDebug: map[schema.ColumnKey]interface{}{
+					schema.ColumnMPLSLabels: []uint32{18},
+				},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			sch := schema.NewMock(t).EnableAllColumns()
+			bf := &schema.FlowMessage{}
+			l := ParseEthernet(sch, bf, tc.Packet, tc.Depth)
+			if l != tc.L3Length {
+				t.Errorf("ParseEthernet() returned %d, expected %d", l, tc.L3Length)
+			}
+			tc.Expected.ProtobufDebug[schema.ColumnSrcMAC] = 0x00005e005301
+			tc.Expected.ProtobufDebug[schema.ColumnDstMAC] = 0x00005e005302
+			if diff := helpers.Diff(bf, tc.Expected); diff != "" {
+				t.Fatalf("ParseEthernet() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestAppendPort(t *testing.T) {
+	config := schema.DefaultConfiguration()
+	config.Privacy = true
+	sch, err := schema.New(config)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	bf := &schema.FlowMessage{}
+	bf.TimeReceived = 1000
+	AppendPort(sch, bf, schema.ColumnSrcPort, schema.ColumnSrcPortBucket, 51234)
+	AppendPort(sch, bf, schema.ColumnDstPort, schema.ColumnDstPortBucket, 0)
+	sch.ProtobufAppendVarint(bf, schema.ColumnBytes, 200)
+
+	got := sch.ProtobufDecode(t, sch.ProtobufMarshal(bf))
+	expected := schema.FlowMessage{
+		TimeReceived: 1000,
+		ProtobufDebug: map[schema.ColumnKey]interface{}{
+			schema.ColumnSrcPortBucket: "49152-65535",
+			schema.ColumnDstPortBucket: "0",
+			schema.ColumnBytes:         200,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ProtobufDecode() (-got, +want):\n%s", diff)
+	}
+}
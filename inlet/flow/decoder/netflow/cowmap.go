@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// cowMap is a map optimized for concurrent reads. Readers do not take any
+// lock while writers replace the whole map with a modified copy. This is
+// efficient when writes are rare compared to reads, like for templates or
+// sampling rates. The zero value is an empty map.
+type cowMap[K comparable, V any] struct {
+	lock sync.Mutex // serializes writers
+	m    atomic.Pointer[map[K]V]
+}
+
+// Load returns the value stored for the provided key.
+func (c *cowMap[K, V]) Load(key K) (V, bool) {
+	m := c.m.Load()
+	if m == nil {
+		var zero V
+		return zero, false
+	}
+	value, ok := (*m)[key]
+	return value, ok
+}
+
+// update replaces the map with a modified copy. It should be called with the
+// lock held.
+func (c *cowMap[K, V]) update(fn func(map[K]V)) {
+	var m map[K]V
+	if current := c.m.Load(); current != nil {
+		m = make(map[K]V, len(*current)+1)
+		for k, v := range *current {
+			m[k] = v
+		}
+	} else {
+		m = map[K]V{}
+	}
+	fn(m)
+	c.m.Store(&m)
+}
+
+// Store sets the value for the provided key.
+func (c *cowMap[K, V]) Store(key K, value V) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.update(func(m map[K]V) { m[key] = value })
+}
+
+// LoadOrStore returns the value stored for the provided key. If there is
+// none, it stores and returns the value created by the provided function.
+func (c *cowMap[K, V]) LoadOrStore(key K, create func() V) V {
+	if value, ok := c.Load(key); ok {
+		return value
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if value, ok := c.Load(key); ok {
+		return value
+	}
+	value := create()
+	c.update(func(m map[K]V) { m[key] = value })
+	return value
+}
+
+// Delete removes the value for the provided key and returns it.
+func (c *cowMap[K, V]) Delete(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value, ok := c.Load(key)
+	if ok {
+		c.update(func(m map[K]V) { delete(m, key) })
+	}
+	return value, ok
+}
+
+// Snapshot returns the current content of the map. It should not be
+// modified.
+func (c *cowMap[K, V]) Snapshot() map[K]V {
+	if m := c.m.Load(); m != nil {
+		return *m
+	}
+	return map[K]V{}
+}
@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestCOWMap(t *testing.T) {
+	var m cowMap[string, int]
+	if _, ok := m.Load("a"); ok {
+		t.Fatal("Load() on empty map should fail")
+	}
+	m.Store("a", 1)
+	m.Store("b", 2)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load(a) == %d, %v, expected 1, true", v, ok)
+	}
+	snapshot := m.Snapshot()
+	if v := m.LoadOrStore("b", func() int { return 3 }); v != 2 {
+		t.Fatalf("LoadOrStore(b) == %d, expected 2", v)
+	}
+	if v := m.LoadOrStore("c", func() int { return 3 }); v != 3 {
+		t.Fatalf("LoadOrStore(c) == %d, expected 3", v)
+	}
+	if v, ok := m.Delete("a"); !ok || v != 1 {
+		t.Fatalf("Delete(a) == %d, %v, expected 1, true", v, ok)
+	}
+	if _, ok := m.Delete("a"); ok {
+		t.Fatal("Delete(a) twice should fail")
+	}
+	if diff := helpers.Diff(m.Snapshot(), map[string]int{"b": 2, "c": 3}); diff != "" {
+		t.Fatalf("Snapshot() (-got, +want):\n%s", diff)
+	}
+	// Previous snapshots are not modified
+	if diff := helpers.Diff(snapshot, map[string]int{"a": 1, "b": 2}); diff != "" {
+		t.Fatalf("Snapshot() (-got, +want):\n%s", diff)
+	}
+}
+
+// rwMutexMap is the map protected by a RWMutex previously used for
+// templates and sampling rates. It is only used for comparison.
+type rwMutexMap[K comparable, V any] struct {
+	lock sync.RWMutex
+	m    map[K]V
+}
+
+func (r *rwMutexMap[K, V]) Load(key K) (V, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	value, ok := r.m[key]
+	return value, ok
+}
+
+func (r *rwMutexMap[K, V]) Store(key K, value V) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.m[key] = value
+}
+
+// The goal is to compare lookups with concurrent lookups and a few writes,
+// like for templates.
+
+func BenchmarkTemplateLookup(b *testing.B) {
+	keys := make([]uint64, 20)
+	for i := range keys {
+		keys[i] = templateKey(10, 0, uint16(256+i))
+	}
+	for _, writeEvery := range []int{10000, 100} {
+		b.Run(fmt.Sprintf("cowmap, write every %d", writeEvery), func(b *testing.B) {
+			var m cowMap[uint64, interface{}]
+			for _, key := range keys {
+				m.Store(key, struct{}{})
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%writeEvery == 0 {
+						m.Store(key, struct{}{})
+					} else if _, ok := m.Load(key); !ok {
+						b.Fatal("Load() failed")
+					}
+					i++
+				}
+			})
+		})
+		b.Run(fmt.Sprintf("rwmutex, write every %d", writeEvery), func(b *testing.B) {
+			m := rwMutexMap[uint64, interface{}]{m: map[uint64]interface{}{}}
+			for _, key := range keys {
+				m.Store(key, struct{}{})
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%writeEvery == 0 {
+						m.Store(key, struct{}{})
+					} else if _, ok := m.Load(key); !ok {
+						b.Fatal("Load() failed")
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -5,6 +5,7 @@
 package netflow
 
 import (
+	"bytes"
 	"encoding/binary"
 	"net/netip"
 
@@ -15,17 +16,33 @@ import (
 	"github.com/netsampler/goflow2/v2/decoders/netflow"
 )
 
-func (nd *Decoder) decodeIPFIX(packet netflow.IPFIXPacket, samplingRateSys *samplingRateSystem) []*schema.FlowMessage {
+// reverseInformationElementPEN is the private enterprise number used to encode
+// reverse information elements in biflows (RFC 5103).
+const reverseInformationElementPEN = 29305
+
+// Legacy Cisco NSEL/NEL fields. They are only used with NetFlow v9 as, with
+// IPFIX, they would be vendor-specific elements.
+const (
+	nfv9FieldXlateSrcAddrIPv4 = 40001
+	nfv9FieldXlateDstAddrIPv4 = 40002
+	nfv9FieldXlateSrcPort     = 40003
+	nfv9FieldXlateDstPort     = 40004
+	nfv9FieldFWEvent          = 40005
+)
+
+func (nd *Decoder) decodeIPFIX(packet netflow.IPFIXPacket, samplingRateSys *samplingRateSystem, durationSys *durationSystem, clock exportClock, vendorElements []decoder.VendorElement, quirks decoder.Quirks) []*schema.FlowMessage {
 	obsDomainID := packet.ObservationDomainId
-	return nd.decodeCommon(10, obsDomainID, packet.FlowSets, samplingRateSys)
+	return nd.decodeCommon(10, obsDomainID, packet.FlowSets, samplingRateSys, durationSys, clock, vendorElements, quirks)
 }
 
-func (nd *Decoder) decodeNFv9(packet netflow.NFv9Packet, samplingRateSys *samplingRateSystem) []*schema.FlowMessage {
+func (nd *Decoder) decodeNFv9(packet netflow.NFv9Packet, samplingRateSys *samplingRateSystem, durationSys *durationSystem, clock exportClock, vendorElements []decoder.VendorElement, quirks decoder.Quirks) []*schema.FlowMessage {
 	obsDomainID := packet.SourceId
-	return nd.decodeCommon(9, obsDomainID, packet.FlowSets, samplingRateSys)
+	clock.uptime = uint64(packet.SystemUptime)
+	clock.unixSeconds = uint64(packet.UnixSeconds)
+	return nd.decodeCommon(9, obsDomainID, packet.FlowSets, samplingRateSys, durationSys, clock, vendorElements, quirks)
 }
 
-func (nd *Decoder) decodeCommon(version uint16, obsDomainID uint32, flowSets []interface{}, samplingRateSys *samplingRateSystem) []*schema.FlowMessage {
+func (nd *Decoder) decodeCommon(version uint16, obsDomainID uint32, flowSets []interface{}, samplingRateSys *samplingRateSystem, durationSys *durationSystem, clock exportClock, vendorElements []decoder.VendorElement, quirks decoder.Quirks) []*schema.FlowMessage {
 	flowMessageSet := []*schema.FlowMessage{}
 
 	// Look for sampling rate in option data flowsets
@@ -58,7 +75,7 @@ func (nd *Decoder) decodeCommon(version uint16, obsDomainID uint32, flowSets []i
 			}
 		case netflow.DataFlowSet:
 			for _, record := range tFlowSet.Records {
-				flow := nd.decodeRecord(version, obsDomainID, samplingRateSys, record.Values)
+				flow := nd.decodeRecord(version, obsDomainID, samplingRateSys, durationSys, clock, vendorElements, quirks, record.Values)
 				if flow != nil {
 					flowMessageSet = append(flowMessageSet, flow)
 				}
@@ -69,10 +86,82 @@ func (nd *Decoder) decodeCommon(version uint16, obsDomainID uint32, flowSets []i
 	return flowMessageSet
 }
 
-func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRateSys *samplingRateSystem, fields []netflow.DataField) *schema.FlowMessage {
+// exporterAddressFromOptions returns the exporter address announced in
+// options data records (exporterIPv4Address or exporterIPv6Address), if any.
+func exporterAddressFromOptions(flowSets []interface{}) (netip.Addr, bool) {
+	var exporterAddress netip.Addr
+	for _, flowSet := range flowSets {
+		tFlowSet, ok := flowSet.(netflow.OptionsDataFlowSet)
+		if !ok {
+			continue
+		}
+		for _, record := range tFlowSet.Records {
+			for _, field := range record.OptionsValues {
+				v, ok := field.Value.([]byte)
+				if !ok || field.PenProvided {
+					continue
+				}
+				switch field.Type {
+				case netflow.IPFIX_FIELD_exporterIPv4Address, netflow.IPFIX_FIELD_exporterIPv6Address:
+					if addr := decodeIP(v); addr.IsValid() && !addr.Unmap().IsUnspecified() {
+						exporterAddress = addr
+					}
+				}
+			}
+		}
+	}
+	return exporterAddress, exporterAddress.IsValid()
+}
+
+// exporterStatisticsFields maps the information elements describing the
+// export process (RFC 7011, sections 4.3 and 4.4) to statistic names.
+var exporterStatisticsFields = map[uint16]string{
+	netflow.IPFIX_FIELD_exportedOctetTotalCount:      "exported-bytes",
+	netflow.IPFIX_FIELD_exportedMessageTotalCount:    "exported-messages",
+	netflow.IPFIX_FIELD_exportedFlowRecordTotalCount: "exported-flows",
+	netflow.IPFIX_FIELD_observedFlowTotalCount:       "observed-flows",
+	netflow.IPFIX_FIELD_ignoredPacketTotalCount:      "ignored-packets",
+	netflow.IPFIX_FIELD_ignoredOctetTotalCount:       "ignored-bytes",
+	netflow.IPFIX_FIELD_notSentFlowTotalCount:        "not-sent-flows",
+	netflow.IPFIX_FIELD_notSentPacketTotalCount:      "not-sent-packets",
+	netflow.IPFIX_FIELD_notSentOctetTotalCount:       "not-sent-bytes",
+}
+
+// exporterStatisticsFromOptions returns the statistics about the export
+// process announced in options data records, if any. The same field numbers
+// are used by NetFlow v9 for the exported bytes, packets and flows.
+func exporterStatisticsFromOptions(flowSets []interface{}) map[string]uint64 {
+	var statistics map[string]uint64
+	for _, flowSet := range flowSets {
+		tFlowSet, ok := flowSet.(netflow.OptionsDataFlowSet)
+		if !ok {
+			continue
+		}
+		for _, record := range tFlowSet.Records {
+			for _, field := range record.OptionsValues {
+				v, ok := field.Value.([]byte)
+				if !ok || field.PenProvided {
+					continue
+				}
+				if name, ok := exporterStatisticsFields[field.Type]; ok {
+					if statistics == nil {
+						statistics = map[string]uint64{}
+					}
+					statistics[name] = decodeUNumber(v)
+				}
+			}
+		}
+	}
+	return statistics
+}
+
+func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRateSys *samplingRateSystem, durationSys *durationSystem, clock exportClock, vendorElements []decoder.VendorElement, quirks decoder.Quirks, fields []netflow.DataField) *schema.FlowMessage {
 	var etype, dstPort, srcPort uint16
 	var proto, icmpType, icmpCode uint8
 	var foundIcmpTypeCode bool
+	var flowStart, flowEnd, duration uint64
+	var foundFlowStart, foundFlowEnd, foundDuration, relativeFlowEnd bool
+	var endReason uint8
 	bf := &schema.FlowMessage{}
 	dataLinkFrameSectionIdx := -1
 	for idx, field := range fields {
@@ -80,16 +169,37 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 		if !ok {
 			continue
 		}
+		if field.PenProvided && field.Pen == reverseInformationElementPEN {
+			// RFC 5103: reverse direction of a biflow
+			switch field.Type & 0x7fff {
+			case netflow.NFV9_FIELD_IN_BYTES, netflow.NFV9_FIELD_OUT_BYTES:
+				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnReverseBytes, decodeUNumber(quirks.Counter(v)))
+				continue
+			case netflow.NFV9_FIELD_IN_PKTS, netflow.NFV9_FIELD_OUT_PKTS:
+				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnReversePackets, decodeUNumber(quirks.Counter(v)))
+				continue
+			}
+		}
 		if field.PenProvided {
+			nd.decodeVendorElement(bf, vendorElements, field.Pen, field.Type&0x7fff, v)
 			continue
 		}
 
 		switch field.Type {
 		// Statistics
 		case netflow.NFV9_FIELD_IN_BYTES, netflow.NFV9_FIELD_OUT_BYTES:
-			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, decodeUNumber(v))
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, decodeUNumber(quirks.Counter(v)))
 		case netflow.NFV9_FIELD_IN_PKTS, netflow.NFV9_FIELD_OUT_PKTS:
-			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnPackets, decodeUNumber(v))
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnPackets, decodeUNumber(quirks.Counter(v)))
+		case netflow.IPFIX_FIELD_initiatorOctets:
+			// NSEL (Cisco ASA) and NEL only count bytes in both directions
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, decodeUNumber(quirks.Counter(v)))
+		case netflow.IPFIX_FIELD_responderOctets:
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnReverseBytes, decodeUNumber(quirks.Counter(v)))
+		case netflow.IPFIX_FIELD_initiatorPackets:
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnPackets, decodeUNumber(quirks.Counter(v)))
+		case netflow.IPFIX_FIELD_responderPackets:
+			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnReversePackets, decodeUNumber(quirks.Counter(v)))
 		case netflow.NFV9_FIELD_SAMPLING_INTERVAL, netflow.NFV9_FIELD_FLOW_SAMPLER_RANDOM_INTERVAL, netflow.IPFIX_FIELD_samplingPacketInterval:
 			bf.SamplingRate = uint32(decodeUNumber(v))
 		case netflow.NFV9_FIELD_FLOW_SAMPLER_ID, netflow.IPFIX_FIELD_selectorId:
@@ -118,10 +228,10 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 		// L4
 		case netflow.NFV9_FIELD_L4_SRC_PORT:
 			srcPort = uint16(decodeUNumber(v))
-			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcPort, uint64(srcPort))
+			decoder.AppendPort(nd.d.Schema, bf, schema.ColumnSrcPort, schema.ColumnSrcPortBucket, uint64(srcPort))
 		case netflow.NFV9_FIELD_L4_DST_PORT:
 			dstPort = uint16(decodeUNumber(v))
-			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnDstPort, uint64(dstPort))
+			decoder.AppendPort(nd.d.Schema, bf, schema.ColumnDstPort, schema.ColumnDstPortBucket, uint64(dstPort))
 		case netflow.NFV9_FIELD_PROTOCOL:
 			proto = uint8(decodeUNumber(v))
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnProto, uint64(proto))
@@ -148,6 +258,30 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 		case netflow.NFV9_FIELD_MPLS_LABEL_1, netflow.NFV9_FIELD_MPLS_LABEL_2, netflow.NFV9_FIELD_MPLS_LABEL_3, netflow.NFV9_FIELD_MPLS_LABEL_4, netflow.NFV9_FIELD_MPLS_LABEL_5, netflow.NFV9_FIELD_MPLS_LABEL_6, netflow.NFV9_FIELD_MPLS_LABEL_7, netflow.NFV9_FIELD_MPLS_LABEL_8, netflow.NFV9_FIELD_MPLS_LABEL_9, netflow.NFV9_FIELD_MPLS_LABEL_10:
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnMPLSLabels, decodeUNumber(v)>>4)
 
+		// Flow times (in milliseconds)
+		case netflow.NFV9_FIELD_FIRST_SWITCHED, netflow.IPFIX_FIELD_flowStartMilliseconds:
+			flowStart = quirks.Timestamp(decodeUNumber(v))
+			foundFlowStart = true
+		case netflow.NFV9_FIELD_LAST_SWITCHED, netflow.IPFIX_FIELD_flowEndMilliseconds:
+			flowEnd = quirks.Timestamp(decodeUNumber(v))
+			foundFlowEnd = true
+			relativeFlowEnd = field.Type == netflow.NFV9_FIELD_LAST_SWITCHED
+		case netflow.IPFIX_FIELD_flowStartSeconds:
+			flowStart = decodeUNumber(v) * 1000
+			foundFlowStart = true
+		case netflow.IPFIX_FIELD_flowEndSeconds:
+			flowEnd = decodeUNumber(v) * 1000
+			foundFlowEnd = true
+			relativeFlowEnd = false
+		case netflow.IPFIX_FIELD_flowDurationMilliseconds:
+			duration = decodeUNumber(v)
+			foundDuration = true
+		case netflow.IPFIX_FIELD_flowDurationMicroseconds:
+			duration = decodeUNumber(v) / 1000
+			foundDuration = true
+		case netflow.IPFIX_FIELD_flowEndReason:
+			endReason = uint8(decodeUNumber(v))
+
 		// Remaining
 		case netflow.NFV9_FIELD_FORWARDING_STATUS:
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnForwardingStatus, decodeUNumber(v))
@@ -156,14 +290,18 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 			if !nd.d.Schema.IsDisabled(schema.ColumnGroupNAT) {
 				// NAT
 				switch field.Type {
-				case netflow.IPFIX_FIELD_postNATSourceIPv4Address:
+				case netflow.IPFIX_FIELD_postNATSourceIPv4Address, netflow.IPFIX_FIELD_postNATSourceIPv6Address, nfv9FieldXlateSrcAddrIPv4:
 					nd.d.Schema.ProtobufAppendIP(bf, schema.ColumnSrcAddrNAT, decodeIP(v))
-				case netflow.IPFIX_FIELD_postNATDestinationIPv4Address:
+				case netflow.IPFIX_FIELD_postNATDestinationIPv4Address, netflow.IPFIX_FIELD_postNATDestinationIPv6Address, nfv9FieldXlateDstAddrIPv4:
 					nd.d.Schema.ProtobufAppendIP(bf, schema.ColumnDstAddrNAT, decodeIP(v))
-				case netflow.IPFIX_FIELD_postNAPTSourceTransportPort:
+				case netflow.IPFIX_FIELD_postNAPTSourceTransportPort, nfv9FieldXlateSrcPort:
 					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcPortNAT, decodeUNumber(v))
-				case netflow.IPFIX_FIELD_postNAPTDestinationTransportPort:
+				case netflow.IPFIX_FIELD_postNAPTDestinationTransportPort, nfv9FieldXlateDstPort:
 					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnDstPortNAT, decodeUNumber(v))
+				case netflow.IPFIX_FIELD_natEvent:
+					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnNATEvent, decodeUNumber(v))
+				case netflow.IPFIX_FIELD_firewallEvent, nfv9FieldFWEvent:
+					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnFirewallEvent, decodeUNumber(v))
 				}
 			}
 
@@ -174,6 +312,18 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 					bf.SrcVlan = uint16(decodeUNumber(v))
 				case netflow.NFV9_FIELD_DST_VLAN:
 					bf.DstVlan = uint16(decodeUNumber(v))
+				case netflow.IPFIX_FIELD_dot1qVlanId:
+					if bf.SrcVlan == 0 {
+						bf.SrcVlan = uint16(decodeUNumber(v))
+					}
+				case netflow.IPFIX_FIELD_postDot1qVlanId:
+					if bf.DstVlan == 0 {
+						bf.DstVlan = uint16(decodeUNumber(v))
+					}
+				case netflow.IPFIX_FIELD_dot1qCustomerVlanId:
+					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcVlanInner, decodeUNumber(v))
+				case netflow.IPFIX_FIELD_postDot1qCustomerVlanId:
+					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnDstVlanInner, decodeUNumber(v))
 				case netflow.NFV9_FIELD_IN_SRC_MAC:
 					nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcMAC, decodeUNumber(v))
 				case netflow.NFV9_FIELD_IN_DST_MAC:
@@ -219,7 +369,7 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 	}
 	if dataLinkFrameSectionIdx >= 0 {
 		data := fields[dataLinkFrameSectionIdx].Value.([]byte)
-		if l3Length := decoder.ParseEthernet(nd.d.Schema, bf, data); l3Length > 0 {
+		if l3Length := decoder.ParseEthernet(nd.d.Schema, bf, data, nd.o.HeaderDepth); l3Length > 0 {
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, l3Length)
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnPackets, 1)
 		}
@@ -248,6 +398,23 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 			nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnICMPv6Code, uint64(icmpCode))
 		}
 	}
+	decoder.AppendTunnelType(nd.d.Schema, bf, proto, dstPort)
+	if !foundDuration && foundFlowStart && foundFlowEnd && flowEnd >= flowStart {
+		duration = flowEnd - flowStart
+		foundDuration = true
+	}
+	if foundDuration {
+		nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnFlowDuration, duration)
+		durationSys.Observe(duration, endReason)
+	}
+	if foundFlowEnd {
+		// Late flows are accounted at the time they ended.
+		delay := clock.Observe(flowEnd, relativeFlowEnd)
+		if nd.o.LateFlowThreshold > 0 && delay > nd.o.LateFlowThreshold {
+			bf.TimeReceived = uint64(clock.received.Add(-delay).UTC().Unix())
+			nd.metrics.lateFlows.WithLabelValues(clock.key).Inc()
+		}
+	}
 	nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnEType, uint64(etype))
 	if bf.SamplingRate == 0 {
 		bf.SamplingRate = samplingRateSys.GetSamplingRate(version, obsDomainID, 0)
@@ -255,6 +422,29 @@ func (nd *Decoder) decodeRecord(version uint16, obsDomainID uint32, samplingRate
 	return bf
 }
 
+// decodeVendorElement stores the value of an enterprise element into the
+// configured column, if any.
+func (nd *Decoder) decodeVendorElement(bf *schema.FlowMessage, vendorElements []decoder.VendorElement, pen uint32, element uint16, v []byte) {
+	for _, ve := range vendorElements {
+		if ve.Enterprise != pen || ve.Element != element {
+			continue
+		}
+		column, ok := nd.d.Schema.LookupColumnByKey(ve.Column)
+		if !ok || column.Disabled {
+			return
+		}
+		switch column.ParserType {
+		case "uint":
+			nd.d.Schema.ProtobufAppendVarint(bf, ve.Column, decodeUNumber(v))
+		case "string":
+			nd.d.Schema.ProtobufAppendBytes(bf, ve.Column, bytes.TrimRight(v, "\x00"))
+		case "ip":
+			nd.d.Schema.ProtobufAppendIP(bf, ve.Column, decodeIP(v))
+		}
+		return
+	}
+}
+
 func decodeUNumber(b []byte) uint64 {
 	var o uint64
 	l := len(b)
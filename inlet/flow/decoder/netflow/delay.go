@@ -0,0 +1,52 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"time"
+
+	"akvorado/common/reporter"
+)
+
+// exportDelayBuckets are the buckets, in seconds, of the histogram of the
+// delay between the end of a flow and its reception.
+var exportDelayBuckets = []float64{0.1, 0.5, 1, 2, 5, 10, 30, 60, 120, 300, 600}
+
+// exportClock converts the end time of the flows of a packet to an absolute
+// time and records the delay until the packet was received. This is a proxy
+// for the export delay of the exporter and the transport latency to the
+// inlet. It includes the active timeout for long-lived flows and it is only
+// meaningful if the clocks of the exporters and the inlet are synchronized.
+type exportClock struct {
+	received time.Time
+	// uptime and unixSeconds are the system uptime, in milliseconds, and the
+	// current time announced in the header of NetFlow v9 packets. They are
+	// needed to convert times relative to the uptime.
+	uptime      uint64
+	unixSeconds uint64
+	delay       *reporter.HistogramVec
+	key         string
+}
+
+// Observe records the delay for a flow ending at the provided time, in
+// milliseconds. When relative is true, the time is relative to the system
+// uptime. Flows ending after the reception time are ignored. The delay is
+// returned, or 0 when it cannot be computed.
+func (c exportClock) Observe(flowEnd uint64, relative bool) time.Duration {
+	if c.delay == nil || c.received.IsZero() {
+		return 0
+	}
+	if relative {
+		if c.unixSeconds == 0 || flowEnd > c.uptime {
+			return 0
+		}
+		flowEnd = c.unixSeconds*1000 - (c.uptime - flowEnd)
+	}
+	delay := c.received.Sub(time.UnixMilli(int64(flowEnd)))
+	if delay < 0 {
+		return 0
+	}
+	c.delay.WithLabelValues(c.key).Observe(delay.Seconds())
+	return delay
+}
@@ -0,0 +1,126 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestExportDelay(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+	received := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	end := uint32(received.Add(-3 * time.Second).Unix())
+
+	// IPFIX with flowEndSeconds (absolute time)
+	template := ipfixSet(2,
+		304, 2, // template ID, field count
+		1, 4, // octetDeltaCount
+		151, 4) // flowEndSeconds
+	data := ipfixSet(304,
+		0, 1500, // octetDeltaCount
+		uint16(end>>16), uint16(end)) // flowEndSeconds
+	nfdecoder.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      ipfixPacket(template, data),
+		Source:       net.ParseIP("127.0.0.1"),
+	})
+	// A flow ending in the future is ignored
+	future := uint32(received.Add(time.Minute).Unix())
+	nfdecoder.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload: ipfixPacket(ipfixSet(304,
+			0, 1500,
+			uint16(future>>16), uint16(future))),
+		Source: net.ParseIP("127.0.0.1"),
+	})
+
+	// NetFlow v9 with LAST_SWITCHED (relative to the system uptime)
+	nfv9Template := ipfixSet(0,
+		305, 2, // template ID, field count
+		1, 4, // IN_BYTES
+		21, 4) // LAST_SWITCHED
+	nfv9Data := ipfixSet(305,
+		0, 1500, // IN_BYTES
+		0, 40000) // LAST_SWITCHED
+	packet := nfv9Packet(nfv9Template, nfv9Data)
+	binary.BigEndian.PutUint32(packet[4:8], 100000)                                     // uptime
+	binary.BigEndian.PutUint32(packet[8:12], uint32(received.Add(-time.Second).Unix())) // current time
+	nfdecoder.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      packet,
+		Source:       net.ParseIP("127.0.0.2"),
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_export_delay_seconds_",
+		"count", "sum")
+	expectedMetrics := map[string]string{
+		`count{exporter="127.0.0.1"}`: "1",
+		`sum{exporter="127.0.0.1"}`:   "3",
+		`count{exporter="127.0.0.2"}`: "1",
+		`sum{exporter="127.0.0.2"}`:   "61",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestLateFlows(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{
+		LateFlowThreshold: 10 * time.Second,
+	})
+	received := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	template := ipfixSet(2,
+		304, 2, // template ID, field count
+		1, 4, // octetDeltaCount
+		151, 4) // flowEndSeconds
+	nfdecoder.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      ipfixPacket(template),
+		Source:       net.ParseIP("127.0.0.1"),
+	})
+
+	cases := []struct {
+		Delay    time.Duration
+		Expected time.Time
+	}{
+		{3 * time.Second, received},
+		{time.Minute, received.Add(-time.Minute)},
+		{-time.Minute, received},
+	}
+	for _, tc := range cases {
+		end := uint32(received.Add(-tc.Delay).Unix())
+		got := nfdecoder.Decode(decoder.RawFlow{
+			TimeReceived: received,
+			Payload: ipfixPacket(ipfixSet(304,
+				0, 1500,
+				uint16(end>>16), uint16(end))),
+			Source: net.ParseIP("127.0.0.1"),
+		})
+		if len(got) != 1 {
+			t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+		}
+		if got[0].TimeReceived != uint64(tc.Expected.Unix()) {
+			t.Errorf("Decode(delay %s) time received %d, expected %d",
+				tc.Delay, got[0].TimeReceived, tc.Expected.Unix())
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_late_flows_total")
+	expectedMetrics := map[string]string{
+		`{exporter="127.0.0.1"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,117 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"net/netip"
+
+	"github.com/netsampler/goflow2/v2/decoders/netflow"
+)
+
+// persistVersion should be increased each time the way the state is encoded
+// is changed.
+const persistVersion = 1
+
+// errPersistVersion is returned when the saved state was encoded with another
+// version.
+var errPersistVersion = errors.New("version mismatch for saved state")
+
+type persistedTemplate struct {
+	Version     uint16
+	ObsDomainID uint32
+	TemplateID  uint16
+	Template    interface{}
+}
+
+type persistedSamplingRate struct {
+	Version      uint16
+	ObsDomainID  uint32
+	SamplerID    uint64
+	SamplingRate uint32
+}
+
+type persistedState struct {
+	Version       int
+	Templates     map[string][]persistedTemplate
+	SamplingRates map[string][]persistedSamplingRate
+	Exporters     map[string]netip.Addr
+}
+
+func init() {
+	gob.Register(netflow.TemplateRecord{})
+	gob.Register(netflow.IPFIXOptionsTemplateRecord{})
+	gob.Register(netflow.NFv9OptionsTemplateRecord{})
+}
+
+// Save returns the templates, the sampling rates and the exporter addresses
+// received from each exporter.
+func (nd *Decoder) Save() ([]byte, error) {
+	state := persistedState{
+		Version:       persistVersion,
+		Templates:     map[string][]persistedTemplate{},
+		SamplingRates: map[string][]persistedSamplingRate{},
+		Exporters:     map[string]netip.Addr{},
+	}
+
+	for key, exporter := range nd.exporters.Snapshot() {
+		for tkey, template := range exporter.templates.templates.Snapshot() {
+			state.Templates[key] = append(state.Templates[key], persistedTemplate{
+				Version:     uint16(tkey >> 48),
+				ObsDomainID: uint32(tkey >> 16),
+				TemplateID:  uint16(tkey),
+				Template:    template,
+			})
+		}
+		for skey, rate := range exporter.sampling.rates.Snapshot() {
+			state.SamplingRates[key] = append(state.SamplingRates[key], persistedSamplingRate{
+				Version:      skey.version,
+				ObsDomainID:  skey.obsDomainID,
+				SamplerID:    skey.samplerID,
+				SamplingRate: rate,
+			})
+		}
+		if addr := exporter.address.Load(); addr != nil {
+			state.Exporters[key] = *addr
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Load restores the templates, the sampling rates and the exporter addresses
+// returned by Save.
+func (nd *Decoder) Load(data []byte) error {
+	var state persistedState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return err
+	}
+	if state.Version != persistVersion {
+		return errPersistVersion
+	}
+
+	for key, templates := range state.Templates {
+		system := nd.state(key).templates
+		for _, t := range templates {
+			system.templates.Store(templateKey(t.Version, t.ObsDomainID, t.TemplateID), t.Template)
+		}
+	}
+	for key, rates := range state.SamplingRates {
+		system := nd.state(key).sampling
+		for _, r := range rates {
+			system.SetSamplingRate(r.Version, r.ObsDomainID, r.SamplerID, r.SamplingRate)
+		}
+	}
+	for key, addr := range state.Exporters {
+		addr := addr
+		nd.state(key).address.Store(&addr)
+	}
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"net/netip"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/netsampler/goflow2/v2/decoders/netflow"
@@ -22,12 +23,15 @@ import (
 type Decoder struct {
 	r         *reporter.Reporter
 	d         decoder.Dependencies
+	o         decoder.Option
 	errLogger reporter.Logger
 
-	// Templates and sampling systems
-	systemsLock sync.RWMutex
-	templates   map[string]*templateSystem
-	sampling    map[string]*samplingRateSystem
+	// version restricts the accepted version (0 means any)
+	version uint16
+
+	// State for each exporter. Lookups are lock-free as this is done for
+	// each packet.
+	exporters cowMap[string, *exporterState]
 
 	metrics struct {
 		errors             *reporter.CounterVec
@@ -35,17 +39,21 @@ type Decoder struct {
 		setRecordsStatsSum *reporter.CounterVec
 		setStatsSum        *reporter.CounterVec
 		templatesStats     *reporter.CounterVec
+		activeTimeout      *reporter.GaugeVec
+		exporterStatistics *reporter.GaugeVec
+		samplingRates      *reporter.CounterVec
+		exportDelay        *reporter.HistogramVec
+		lateFlows          *reporter.CounterVec
 	}
 }
 
 // New instantiates a new netflow decoder.
-func New(r *reporter.Reporter, dependencies decoder.Dependencies) decoder.Decoder {
+func New(r *reporter.Reporter, dependencies decoder.Dependencies, option decoder.Option) decoder.Decoder {
 	nd := &Decoder{
 		r:         r,
 		d:         dependencies,
+		o:         option,
 		errLogger: r.Sample(reporter.BurstSampler(30*time.Second, 3)),
-		templates: map[string]*templateSystem{},
-		sampling:  map[string]*samplingRateSystem{},
 	}
 
 	nd.metrics.errors = nd.r.CounterVec(
@@ -83,20 +91,97 @@ func New(r *reporter.Reporter, dependencies decoder.Dependencies) decoder.Decode
 		},
 		[]string{"exporter", "version", "obs_domain_id", "template_id", "type"},
 	)
+	nd.metrics.activeTimeout = nd.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "active_timeout_seconds",
+			Help: "Active timeout estimated from flow durations.",
+		},
+		[]string{"exporter"},
+	)
+	nd.metrics.exporterStatistics = nd.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "exporter_statistics",
+			Help: "Statistics about the export process announced by exporters in options.",
+		},
+		[]string{"exporter", "statistic"},
+	)
+	nd.metrics.samplingRates = nd.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "sampling_rate_overridden_total",
+			Help: "Flows whose advertised sampling rate was replaced by the configured one.",
+		},
+		[]string{"exporter", "reason"},
+	)
+	nd.metrics.exportDelay = nd.r.HistogramVec(
+		reporter.HistogramOpts{
+			Name:    "export_delay_seconds",
+			Help:    "Delay between the end of a flow and the reception of its record.",
+			Buckets: exportDelayBuckets,
+		},
+		[]string{"exporter"},
+	)
+	nd.metrics.lateFlows = nd.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "late_flows_total",
+			Help: "Number of flows received late and accounted at their end time.",
+		},
+		[]string{"exporter"},
+	)
+
+	return nd
+}
 
+// NewIPFIX instantiates a new netflow decoder only accepting IPFIX.
+func NewIPFIX(r *reporter.Reporter, dependencies decoder.Dependencies, option decoder.Option) decoder.Decoder {
+	nd := New(r, dependencies, option).(*Decoder)
+	nd.version = 10
 	return nd
 }
 
+func init() {
+	decoder.Register("netflow", New)
+	decoder.Register("ipfix", NewIPFIX)
+}
+
+// exporterState contains the templates, the sampling rates, the exporter
+// address and the statistics announced in options, and the flow durations
+// for an exporter.
+type exporterState struct {
+	templates *templateSystem
+	sampling  *samplingRateSystem
+	durations *durationSystem
+	address   atomic.Pointer[netip.Addr]
+
+	statisticsLock sync.Mutex
+	statistics     map[string]uint64
+}
+
+// state returns the state for the provided exporter, creating it if needed.
+func (nd *Decoder) state(key string) *exporterState {
+	if state, ok := nd.exporters.Load(key); ok {
+		return state
+	}
+	return nd.exporters.LoadOrStore(key, func() *exporterState {
+		return &exporterState{
+			templates: &templateSystem{nd: nd, key: key},
+			sampling:  &samplingRateSystem{},
+			durations: &durationSystem{nd: nd, key: key},
+		}
+	})
+}
+
 type templateSystem struct {
 	nd        *Decoder
 	key       string
-	templates netflow.NetFlowTemplateSystem
+	templates cowMap[uint64, interface{}]
+}
+
+func templateKey(version uint16, obsDomainID uint32, templateID uint16) uint64 {
+	return (uint64(version) << 48) | (uint64(obsDomainID) << 16) | uint64(templateID)
 }
 
 func (s *templateSystem) AddTemplate(version uint16, obsDomainID uint32, templateID uint16, template interface{}) error {
-	if err := s.templates.AddTemplate(version, obsDomainID, templateID, template); err != nil {
-		return nil
-	}
+	s.templates.Store(templateKey(version, obsDomainID, templateID), template)
 
 	var typeStr string
 	switch templateIDConv := template.(type) {
@@ -122,11 +207,17 @@ func (s *templateSystem) AddTemplate(version uint16, obsDomainID uint32, templat
 }
 
 func (s *templateSystem) GetTemplate(version uint16, obsDomainID uint32, templateID uint16) (interface{}, error) {
-	return s.templates.GetTemplate(version, obsDomainID, templateID)
+	if template, ok := s.templates.Load(templateKey(version, obsDomainID, templateID)); ok {
+		return template, nil
+	}
+	return nil, netflow.ErrorTemplateNotFound
 }
 
 func (s *templateSystem) RemoveTemplate(version uint16, obsDomainID uint32, templateID uint16) (interface{}, error) {
-	return s.templates.RemoveTemplate(version, obsDomainID, templateID)
+	if template, ok := s.templates.Delete(templateKey(version, obsDomainID, templateID)); ok {
+		return template, nil
+	}
+	return nil, netflow.ErrorTemplateNotFound
 }
 
 type samplingRateKey struct {
@@ -136,56 +227,36 @@ type samplingRateKey struct {
 }
 
 type samplingRateSystem struct {
-	lock  sync.RWMutex
-	rates map[samplingRateKey]uint32
+	rates cowMap[samplingRateKey, uint32]
 }
 
 func (s *samplingRateSystem) GetSamplingRate(version uint16, obsDomainID uint32, samplerID uint64) uint32 {
-	s.lock.RLock()
-	defer s.lock.RUnlock()
-	rate, _ := s.rates[samplingRateKey{
+	rate, _ := s.rates.Load(samplingRateKey{
 		version:     version,
 		obsDomainID: obsDomainID,
 		samplerID:   samplerID,
-	}]
+	})
 	return rate
 }
 
 func (s *samplingRateSystem) SetSamplingRate(version uint16, obsDomainID uint32, samplerID uint64, samplingRate uint32) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.rates[samplingRateKey{
+	key := samplingRateKey{
 		version:     version,
 		obsDomainID: obsDomainID,
 		samplerID:   samplerID,
-	}] = samplingRate
+	}
+	// Options are usually repeated, do not copy the map when nothing changes
+	if rate, ok := s.rates.Load(key); ok && rate == samplingRate {
+		return
+	}
+	s.rates.Store(key, samplingRate)
 }
 
 // Decode decodes a Netflow payload.
 func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 	key := in.Source.String()
-	nd.systemsLock.RLock()
-	templates, tok := nd.templates[key]
-	sampling, sok := nd.sampling[key]
-	nd.systemsLock.RUnlock()
-	if !tok {
-		templates = &templateSystem{
-			nd:        nd,
-			templates: netflow.CreateTemplateSystem(),
-			key:       key,
-		}
-		nd.systemsLock.Lock()
-		nd.templates[key] = templates
-		nd.systemsLock.Unlock()
-	}
-	if !sok {
-		sampling = &samplingRateSystem{
-			rates: map[samplingRateKey]uint32{},
-		}
-		nd.systemsLock.Lock()
-		nd.sampling[key] = sampling
-		nd.systemsLock.Unlock()
-	}
+	state := nd.state(key)
+	templates, sampling, durations := state.templates, state.sampling, state.durations
 
 	ts := uint64(in.TimeReceived.UTC().Unix())
 	buf := bytes.NewBuffer(in.Payload)
@@ -216,6 +287,12 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 			Inc()
 		return nil
 	}
+	if nd.version != 0 && nd.version != packetNFv9.Version && nd.version != packetIPFIX.Version {
+		nd.metrics.errors.WithLabelValues(key, "unexpected version").Inc()
+		nd.errLogger.Warn().Str("exporter", key).Str("version", version).
+			Msgf("%s decoder received an unexpected version", nd.Name())
+		return nil
+	}
 	nd.metrics.stats.WithLabelValues(key, version).Inc()
 	for _, fs := range flowSets {
 		switch fsConv := fs.(type) {
@@ -247,16 +324,66 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 		}
 	}
 
-	var flowMessageSet []*schema.FlowMessage
+	// Exporters behind NAT may announce their address in options.
+	var exporterAddress netip.Addr
+	ok := false
+	if in.UseAnnouncedExporterAddr {
+		exporterAddress, ok = exporterAddressFromOptions(flowSets)
+		if ok {
+			address := exporterAddress
+			state.address.Store(&address)
+		} else if address := state.address.Load(); address != nil {
+			exporterAddress, ok = *address, true
+		}
+	}
+	if !ok {
+		exporterAddress, _ = netip.AddrFromSlice(in.Source.To16())
+	}
+	if statistics := exporterStatisticsFromOptions(flowSets); statistics != nil {
+		state.statisticsLock.Lock()
+		if state.statistics == nil {
+			state.statistics = map[string]uint64{}
+		}
+		for name, value := range statistics {
+			state.statistics[name] = value
+			nd.metrics.exporterStatistics.WithLabelValues(key, name).Set(float64(value))
+		}
+		state.statisticsLock.Unlock()
+	}
+	vendorElements, _ := nd.o.VendorElements.Lookup(exporterAddress)
+
+	samplingRates, _ := nd.o.SamplingRates.Lookup(exporterAddress)
+	quirks, _ := nd.o.Quirks.Lookup(exporterAddress)
+
+	var (
+		flowMessageSet []*schema.FlowMessage
+		obsDomainID    uint32
+	)
+	clock := exportClock{
+		received: in.TimeReceived,
+		delay:    nd.metrics.exportDelay,
+		key:      key,
+	}
 	if packetNFv9.Version == 9 {
-		flowMessageSet = nd.decodeNFv9(packetNFv9, sampling)
+		obsDomainID = packetNFv9.SourceId
+		flowMessageSet = nd.decodeNFv9(packetNFv9, sampling, durations, clock, vendorElements, quirks)
 	} else if packetIPFIX.Version == 10 {
-		flowMessageSet = nd.decodeIPFIX(packetIPFIX, sampling)
+		obsDomainID = packetIPFIX.ObservationDomainId
+		flowMessageSet = nd.decodeIPFIX(packetIPFIX, sampling, durations, clock, vendorElements, quirks)
 	}
-	exporterAddress, _ := netip.AddrFromSlice(in.Source.To16())
 	for _, fmsg := range flowMessageSet {
-		fmsg.TimeReceived = ts
+		if fmsg.TimeReceived == 0 {
+			fmsg.TimeReceived = ts
+		}
 		fmsg.ExporterAddress = exporterAddress
+		fmsg.SamplingRate = quirks.SamplingRate(fmsg.SamplingRate)
+		if len(samplingRates) > 0 {
+			var reason string
+			fmsg.SamplingRate, reason = samplingRates.Apply(obsDomainID, fmsg.SamplingRate)
+			if reason != "" {
+				nd.metrics.samplingRates.WithLabelValues(key, reason).Inc()
+			}
+		}
 	}
 
 	return flowMessageSet
@@ -264,5 +391,31 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 
 // Name returns the name of the decoder.
 func (nd *Decoder) Name() string {
+	if nd.version == 10 {
+		return "ipfix"
+	}
 	return "netflow"
 }
+
+// Statistics returns the last statistics about the export process announced
+// by the provided exporter.
+func (nd *Decoder) Statistics(exporter netip.Addr) map[string]uint64 {
+	state, ok := nd.exporters.Load(exporter.Unmap().String())
+	if !ok {
+		return map[string]uint64{}
+	}
+	state.statisticsLock.Lock()
+	defer state.statisticsLock.Unlock()
+	statistics := make(map[string]uint64, len(state.statistics))
+	for name, value := range state.statistics {
+		statistics[name] = value
+	}
+	return statistics
+}
+
+// Reset clears the templates, the sampling rates, the exporter address, the
+// statistics and the flow durations received from the provided exporter.
+func (nd *Decoder) Reset(exporter netip.Addr) bool {
+	_, ok := nd.exporters.Delete(exporter.Unmap().String())
+	return ok
+}
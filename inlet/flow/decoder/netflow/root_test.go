@@ -4,6 +4,8 @@
 package netflow
 
 import (
+	"encoding/binary"
+	"fmt"
 	"net"
 	"net/netip"
 	"path/filepath"
@@ -17,7 +19,7 @@ import (
 
 func TestDecode(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	// Send an option template
 	template := helpers.ReadPcapL4(t, filepath.Join("testdata", "options-template.pcap"))
@@ -212,9 +214,68 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+
+	if nfdecoder.Reset(exporter) {
+		t.Fatal("Reset() on unknown exporter returned true")
+	}
+
+	template := helpers.ReadPcapL4(t, filepath.Join("testdata", "template.pcap"))
+	nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: net.ParseIP("127.0.0.1")})
+	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "data.pcap"))
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if len(got) == 0 {
+		t.Fatal("Decode() on data got no flows")
+	}
+
+	if !nfdecoder.Reset(exporter) {
+		t.Fatal("Reset() on known exporter returned false")
+	}
+	got = nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if len(got) != 0 {
+		t.Fatal("Decode() on data after Reset() got flows")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t).EnableAllColumns()
+	nfdecoder := New(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
+	for _, f := range []string{"options-template.pcap", "options-data.pcap", "template.pcap"} {
+		payload := helpers.ReadPcapL4(t, filepath.Join("testdata", f))
+		nfdecoder.Decode(decoder.RawFlow{Payload: payload, Source: net.ParseIP("127.0.0.1")})
+	}
+	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "data.pcap"))
+	expected := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if len(expected) == 0 {
+		t.Fatal("Decode() on data got no flows")
+	}
+
+	state, err := nfdecoder.(decoder.Persister).Save()
+	if err != nil {
+		t.Fatalf("Save() error:\n%+v", err)
+	}
+	r = reporter.NewMock(t)
+	nfdecoder = New(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
+	if err := nfdecoder.(decoder.Persister).Load(state); err != nil {
+		t.Fatalf("Load() error:\n%+v", err)
+	}
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Decode() after Load() (-got, +want):\n%s", diff)
+	}
+
+	if err := nfdecoder.(decoder.Persister).Load([]byte("garbage")); err == nil {
+		t.Fatal("Load() on garbage did not error")
+	}
+}
+
 func TestTemplatesMixedWithData(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
 
 	// Send packet with both data and templates
 	template := helpers.ReadPcapL4(t, filepath.Join("testdata", "data+templates.pcap"))
@@ -237,7 +298,7 @@ func TestTemplatesMixedWithData(t *testing.T) {
 
 func TestDecodeSamplingRate(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "samplingrate-template.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
@@ -273,9 +334,68 @@ func TestDecodeSamplingRate(t *testing.T) {
 	}
 }
 
+func TestDecodeSamplingRateOverride(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{
+		SamplingRates: helpers.MustNewSubnetMap(map[string]decoder.SamplingRateRules{
+			"::ffff:127.0.0.0/120": {
+				{ObservationDomains: []uint32{1000}, Override: 10},
+				{Override: 1000},
+			},
+		}),
+	})
+
+	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "samplingrate-template.pcap"))
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	data = helpers.ReadPcapL4(t, filepath.Join("testdata", "samplingrate-data.pcap"))
+	got = append(got, nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})...)
+	if len(got) == 0 {
+		t.Fatal("Decode() returned no flow")
+	}
+	for _, f := range got {
+		if f.SamplingRate != 1000 {
+			t.Fatalf("Decode() sampling rate == %d, expected 1000", f.SamplingRate)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_", "sampling_rate_")
+	expectedMetrics := map[string]string{
+		`sampling_rate_overridden_total{exporter="127.0.0.1",reason="override"}`: fmt.Sprintf("%d", len(got)),
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeQuirks(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t).EnableAllColumns()
+	nfdecoder := New(r, decoder.Dependencies{Schema: sch}, decoder.Option{
+		Quirks: helpers.MustNewSubnetMap(map[string]decoder.Quirks{
+			"::ffff:127.0.0.0/120": {SwappedCounters: true},
+		}),
+	})
+
+	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "samplingrate-template.pcap"))
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	data = helpers.ReadPcapL4(t, filepath.Join("testdata", "samplingrate-data.pcap"))
+	got = append(got, nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})...)
+	if len(got) == 0 {
+		t.Fatal("Decode() returned no flow")
+	}
+	// The capture is correct: 160 bytes and 1 packet in 4-byte counters
+	// are swapped.
+	bytes, _ := sch.ProtobufVarint(got[0], schema.ColumnBytes)
+	packets, _ := sch.ProtobufVarint(got[0], schema.ColumnPackets)
+	if bytes != 0xa0000000 || packets != 0x01000000 {
+		t.Fatalf("Decode() bytes == %#x, packets == %#x, expected 0xa0000000 and 0x1000000",
+			bytes, packets)
+	}
+}
+
 func TestDecodeMultipleSamplingRates(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "multiplesamplingrates-options-template.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
@@ -309,6 +429,7 @@ func TestDecodeMultipleSamplingRates(t *testing.T) {
 				schema.ColumnIPv6FlowLabel:    252813,
 				schema.ColumnTCPFlags:         16,
 				schema.ColumnEType:            helpers.ETypeIPv6,
+				schema.ColumnFlowDuration:     4911,
 			},
 		},
 		{
@@ -332,6 +453,7 @@ func TestDecodeMultipleSamplingRates(t *testing.T) {
 				schema.ColumnIPTos:            40,
 				schema.ColumnIPv6FlowLabel:    570164,
 				schema.ColumnEType:            helpers.ETypeIPv6,
+				schema.ColumnFlowDuration:     1870,
 			},
 		},
 	}
@@ -347,7 +469,7 @@ func TestDecodeMultipleSamplingRates(t *testing.T) {
 
 func TestDecodeICMP(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "icmp-template.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
@@ -419,7 +541,7 @@ func TestDecodeICMP(t *testing.T) {
 
 func TestDecodeDataLink(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "datalink-template.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
@@ -460,7 +582,7 @@ func TestDecodeDataLink(t *testing.T) {
 
 func TestDecodeMPLS(t *testing.T) {
 	r := reporter.NewMock(t)
-	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "mpls.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
@@ -501,6 +623,7 @@ func TestDecodeMPLS(t *testing.T) {
 				schema.ColumnSrcPort:          49153,
 				schema.ColumnDstPort:          862,
 				schema.ColumnMPLSLabels:       []uint32{20006, 524275},
+				schema.ColumnFlowDuration:     84000,
 			},
 		},
 	}
@@ -513,3 +636,435 @@ func TestDecodeMPLS(t *testing.T) {
 	}
 
 }
+
+func TestDecodeExporterAddressFromOptions(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+
+	// IPFIX packet with an options template announcing exporterIPv4Address,
+	// a template with source and destination addresses and the
+	// associated data.
+	ipfix := ipfixPacket
+	set := ipfixSet
+	optionsTemplate := set(3,
+		300, 2, 1, // template ID, field count, scope field count
+		149, 4, // observationDomainId
+		130, 4) // exporterIPv4Address
+	template := set(2,
+		301, 2, // template ID, field count
+		8, 4, // sourceIPv4Address
+		12, 4) // destinationIPv4Address
+	optionsData := set(300,
+		0, 0, // observationDomainId
+		0xc000, 0x020a) // 192.0.2.10
+	data := set(301,
+		0xc633, 0x6401, // 198.51.100.1
+		0xcb00, 0x7101) // 203.0.113.1
+
+	// By default, the announced address is ignored
+	source := net.ParseIP("127.0.0.1")
+	got := nfdecoder.Decode(decoder.RawFlow{
+		Payload: ipfix(optionsTemplate, template, data, optionsData),
+		Source:  source,
+	})
+	if len(got) != 1 {
+		t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+	}
+	expected := netip.MustParseAddr("::ffff:127.0.0.1")
+	if got[0].ExporterAddress != expected {
+		t.Fatalf("Decode() exporter address %s, expected %s", got[0].ExporterAddress, expected)
+	}
+
+	// When enabled, the announced address is used
+	got = nfdecoder.Decode(decoder.RawFlow{
+		Payload:                  ipfix(data, optionsData),
+		Source:                   source,
+		UseAnnouncedExporterAddr: true,
+	})
+	if len(got) != 1 {
+		t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+	}
+	expected = netip.MustParseAddr("::ffff:192.0.2.10")
+	if got[0].ExporterAddress != expected {
+		t.Fatalf("Decode() exporter address %s, expected %s", got[0].ExporterAddress, expected)
+	}
+
+	// Announced address is remembered
+	got = nfdecoder.Decode(decoder.RawFlow{Payload: ipfix(data), Source: source, UseAnnouncedExporterAddr: true})
+	if len(got) != 1 {
+		t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+	}
+	if got[0].ExporterAddress != expected {
+		t.Fatalf("Decode() exporter address %s, expected %s", got[0].ExporterAddress, expected)
+	}
+
+	// After a reset, the source address is used
+	if !nfdecoder.Reset(netip.MustParseAddr("127.0.0.1")) {
+		t.Fatal("Reset() returned false")
+	}
+	nfdecoder.Decode(decoder.RawFlow{Payload: ipfix(template), Source: source})
+	got = nfdecoder.Decode(decoder.RawFlow{Payload: ipfix(data), Source: source, UseAnnouncedExporterAddr: true})
+	if len(got) != 1 {
+		t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+	}
+	expected = netip.MustParseAddr("::ffff:127.0.0.1")
+	if got[0].ExporterAddress != expected {
+		t.Fatalf("Decode() exporter address %s, expected %s", got[0].ExporterAddress, expected)
+	}
+}
+
+func TestDecodeExporterStatistics(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+
+	// IPFIX packet with the Exporting Process Reliability Statistics options
+	// template (RFC 7011, section 4.3), without the timestamps.
+	ipfix := ipfixPacket
+	set := ipfixSet
+	optionsTemplate := set(3,
+		300, 4, 1, // template ID, field count, scope field count
+		144, 4, // exportingProcessId
+		42, 4, // exportedFlowRecordTotalCount
+		166, 4, // notSentFlowTotalCount
+		167, 4) // notSentPacketTotalCount
+	optionsData := set(300,
+		0, 1, // exportingProcessId
+		0, 1000, // exportedFlowRecordTotalCount
+		0, 12, // notSentFlowTotalCount
+		0, 3) // notSentPacketTotalCount
+
+	source := net.ParseIP("127.0.0.1")
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+	nfdecoder.Decode(decoder.RawFlow{
+		Payload: ipfix(optionsTemplate, optionsData),
+		Source:  source,
+	})
+	got := nfdecoder.(decoder.StatisticsProvider).Statistics(exporter)
+	expected := map[string]uint64{
+		"exported-flows":   1000,
+		"not-sent-flows":   12,
+		"not-sent-packets": 3,
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Statistics() (-got, +want):\n%s", diff)
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_exporter_statistics")
+	expectedMetrics := map[string]string{
+		`{exporter="127.0.0.1",statistic="exported-flows"}`:   "1000",
+		`{exporter="127.0.0.1",statistic="not-sent-flows"}`:   "12",
+		`{exporter="127.0.0.1",statistic="not-sent-packets"}`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Statistics are cleared on reset
+	if !nfdecoder.Reset(exporter) {
+		t.Fatal("Reset() returned false")
+	}
+	got = nfdecoder.(decoder.StatisticsProvider).Statistics(exporter)
+	if diff := helpers.Diff(got, map[string]uint64{}); diff != "" {
+		t.Fatalf("Statistics() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecodeIPFIXOnly(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := NewIPFIX(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
+	if name := nfdecoder.Name(); name != "ipfix" {
+		t.Fatalf("Name() == %q, expected %q", name, "ipfix")
+	}
+
+	// NetFlow v9 is rejected
+	template := helpers.ReadPcapL4(t, filepath.Join("testdata", "options-template.pcap"))
+	got := nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: net.ParseIP("127.0.0.1")})
+	if got != nil {
+		t.Fatalf("Decode() should have rejected NetFlow v9")
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_errors_total")
+	expectedMetrics := map[string]string{
+		`{error="unexpected version",exporter="127.0.0.1"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+// ipfixPacket builds an IPFIX packet from the provided sets.
+func ipfixPacket(sets ...[]byte) []byte {
+	payload := []byte{}
+	for _, set := range sets {
+		payload = append(payload, set...)
+	}
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint16(header[0:2], 10)
+	binary.BigEndian.PutUint16(header[2:4], uint16(16+len(payload)))
+	return append(header, payload...)
+}
+
+// ipfixSet builds an IPFIX set from its ID and its content, as 16-bit words.
+func ipfixSet(id uint16, content ...uint16) []byte {
+	b := make([]byte, 4, 4+2*len(content))
+	binary.BigEndian.PutUint16(b[0:2], id)
+	binary.BigEndian.PutUint16(b[2:4], uint16(4+2*len(content)))
+	for _, c := range content {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+	return b
+}
+
+func TestDecodeVendorElements(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{
+		VendorElements: helpers.MustNewSubnetMap(map[string][]decoder.VendorElement{
+			"::ffff:127.0.0.1/128": {
+				{Enterprise: 2636, Element: 1, Column: schema.ColumnForwardingClass},
+				{Enterprise: 2011, Element: 2, Column: schema.ColumnApplicationID},
+				{Enterprise: 6527, Element: 3, Column: schema.ColumnSubscriberID},
+				{Enterprise: 6527, Element: 4, Column: schema.ColumnSubscriberID},
+				{Enterprise: 6527, Element: 5, Column: schema.ColumnSrcAddrNAT},
+			},
+		}),
+	})
+
+	ipfix := ipfixPacket
+	set := ipfixSet
+	template := set(2,
+		301, 6, // template ID, field count
+		1, 4, // octetDeltaCount
+		0x8001, 2, 0, 2636, // Juniper, element 1
+		0x8002, 4, 0, 2011, // Huawei, element 2
+		0x8003, 6, 0, 6527, // Nokia, element 3
+		0x8009, 2, 0, 2636, // Juniper, element 9 (not configured)
+		0x8001, 2, 0, 9999) // Unknown enterprise, element 1
+	data := set(301,
+		0, 1000, // octetDeltaCount
+		5,         // forwarding class
+		0, 0x1234, // application ID
+		0x7375, 0x6231, 0, // "sub1\0\0"
+		7, // ignored
+		8) // ignored
+	variableTemplate := set(2,
+		302, 3, // template ID, field count
+		1, 4, // octetDeltaCount
+		0x8004, 65535, 0, 6527, // Nokia, element 4, variable length
+		0x8005, 4, 0, 6527) // Nokia, element 5
+	variableData := set(302,
+		0, 500, // octetDeltaCount
+		0x0575, 0x7365, 0x7232, // length 5, "user2"
+		0xc000, 0x0201) // 192.0.2.1
+
+	cases := []struct {
+		Description string
+		Source      string
+		Payload     []byte
+		Expected    map[schema.ColumnKey]interface{}
+	}{
+		{
+			Description: "configured exporter",
+			Source:      "127.0.0.1",
+			Payload:     ipfix(template, data),
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:           1000,
+				schema.ColumnForwardingClass: 5,
+				schema.ColumnApplicationID:   0x1234,
+				schema.ColumnSubscriberID:    []byte("sub1"),
+			},
+		}, {
+			Description: "other exporter",
+			Source:      "127.0.0.2",
+			Payload:     ipfix(template, data),
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes: 1000,
+			},
+		}, {
+			Description: "variable length and IP elements",
+			Source:      "127.0.0.1",
+			Payload:     ipfix(variableTemplate, variableData),
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:        500,
+				schema.ColumnSubscriberID: []byte("user2"),
+				schema.ColumnSrcAddrNAT:   netip.MustParseAddr("::ffff:192.0.2.1"),
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := nfdecoder.Decode(decoder.RawFlow{
+				Payload: tc.Payload,
+				Source:  net.ParseIP(tc.Source),
+			})
+			if len(got) != 1 {
+				t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+			}
+			if diff := helpers.Diff(got[0].ProtobufDebug, tc.Expected); diff != "" {
+				t.Fatalf("Decode() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeBiflow(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
+
+	template := ipfixSet(2,
+		303, 4, // template ID, field count
+		1, 4, // octetDeltaCount
+		2, 4, // packetDeltaCount
+		0x8001, 4, 0, 29305, // reverseOctetDeltaCount
+		0x8002, 4, 0, 29305) // reversePacketDeltaCount
+	data := ipfixSet(303,
+		0, 1500, // octetDeltaCount
+		0, 3, // packetDeltaCount
+		0, 64000, // reverseOctetDeltaCount
+		0, 50) // reversePacketDeltaCount
+
+	got := nfdecoder.Decode(decoder.RawFlow{
+		Payload: ipfixPacket(template, data),
+		Source:  net.ParseIP("127.0.0.1"),
+	})
+	if len(got) != 1 {
+		t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+	}
+	expected := map[schema.ColumnKey]interface{}{
+		schema.ColumnBytes:          1500,
+		schema.ColumnPackets:        3,
+		schema.ColumnReverseBytes:   64000,
+		schema.ColumnReversePackets: 50,
+	}
+	if diff := helpers.Diff(got[0].ProtobufDebug, expected); diff != "" {
+		t.Fatalf("Decode() (-got, +want):\n%s", diff)
+	}
+}
+
+// nfv9Packet builds a NetFlow v9 packet from the provided flowsets.
+func nfv9Packet(sets ...[]byte) []byte {
+	payload := []byte{}
+	for _, set := range sets {
+		payload = append(payload, set...)
+	}
+	header := make([]byte, 20)
+	binary.BigEndian.PutUint16(header[0:2], 9)
+	binary.BigEndian.PutUint16(header[2:4], uint16(len(sets)))
+	return append(header, payload...)
+}
+
+func TestDecodeNAT(t *testing.T) {
+	r := reporter.NewMock(t)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
+
+	cases := []struct {
+		Description string
+		Payload     []byte
+		Expected    map[schema.ColumnKey]interface{}
+	}{
+		{
+			Description: "IPFIX NAT44 session",
+			Payload: ipfixPacket(
+				ipfixSet(2,
+					304, 6, // template ID, field count
+					8, 4, // sourceIPv4Address
+					225, 4, // postNATSourceIPv4Address
+					7, 2, // sourceTransportPort
+					227, 2, // postNAPTSourceTransportPort
+					230, 1, // natEvent
+					4, 1), // protocolIdentifier
+				ipfixSet(304,
+					0x0a00, 0x0001, // 10.0.0.1
+					0xc633, 0x6401, // 198.51.100.1
+					40000,    // source port
+					1024,     // post-NAT source port
+					0x0406)), // NAT44 session create, TCP
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnEType:      helpers.ETypeIPv4,
+				schema.ColumnSrcAddrNAT: netip.MustParseAddr("::ffff:198.51.100.1"),
+				schema.ColumnSrcPort:    40000,
+				schema.ColumnSrcPortNAT: 1024,
+				schema.ColumnNATEvent:   4,
+				schema.ColumnProto:      6,
+			},
+		}, {
+			Description: "IPFIX NAT64 session",
+			Payload: ipfixPacket(
+				ipfixSet(2,
+					305, 2, // template ID, field count
+					282, 16, // postNATDestinationIPv6Address
+					1, 4), // octetDeltaCount
+				ipfixSet(305,
+					0x2001, 0x0db8, 0, 0, 0, 0, 0, 1, // 2001:db8::1
+					0, 1000)), // octetDeltaCount
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnDstAddrNAT: netip.MustParseAddr("2001:db8::1"),
+				schema.ColumnBytes:      1000,
+			},
+		}, {
+			Description: "NetFlow v9 NSEL",
+			Payload: nfv9Packet(
+				ipfixSet(0,
+					306, 6, // template ID, field count
+					40001, 4, // NF_F_XLATE_SRC_ADDR_IPV4
+					40003, 2, // NF_F_XLATE_SRC_PORT
+					233, 1, // NF_F_FW_EVENT
+					4, 1, // PROTOCOL
+					231, 4, // NF_F_FWD_FLOW_DELTA_BYTES
+					232, 4), // NF_F_REV_FLOW_DELTA_BYTES
+				ipfixSet(306,
+					0xc633, 0x6402, // 198.51.100.2
+					2048,    // post-NAT source port
+					0x0211,  // flow deleted, UDP
+					0, 1500, // initiator bytes
+					0, 600)), // responder bytes
+			Expected: map[schema.ColumnKey]interface{}{
+				schema.ColumnSrcAddrNAT:    netip.MustParseAddr("::ffff:198.51.100.2"),
+				schema.ColumnSrcPortNAT:    2048,
+				schema.ColumnFirewallEvent: 2,
+				schema.ColumnProto:         17,
+				schema.ColumnBytes:         1500,
+				schema.ColumnReverseBytes:  600,
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := nfdecoder.Decode(decoder.RawFlow{
+				Payload: tc.Payload,
+				Source:  net.ParseIP("127.0.0.1"),
+			})
+			if len(got) != 1 {
+				t.Fatalf("Decode() returned %d flows, expected 1", len(got))
+			}
+			if diff := helpers.Diff(got[0].ProtobufDebug, tc.Expected); diff != "" {
+				t.Fatalf("Decode() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeParallel(b *testing.B) {
+	schema.DisableDebug(b)
+	r := reporter.NewMock(b)
+	nfdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(b)}, decoder.Option{})
+	template := helpers.ReadPcapL4(b, filepath.Join("testdata", "template.pcap"))
+	data := helpers.ReadPcapL4(b, filepath.Join("testdata", "data.pcap"))
+
+	for _, exporters := range []int{1, 100} {
+		sources := make([]net.IP, exporters)
+		for i := range sources {
+			sources[i] = net.IPv4(192, 0, 2, byte(i+1))
+			nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: sources[i]})
+		}
+		b.Run(fmt.Sprintf("%d exporters", exporters), func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					got := nfdecoder.Decode(decoder.RawFlow{Payload: data, Source: sources[i%exporters]})
+					if len(got) == 0 {
+						b.Fatal("Decode() did not return any flow")
+					}
+					i++
+				}
+			})
+		})
+	}
+}
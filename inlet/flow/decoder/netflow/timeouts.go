@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxTrackedDuration is the largest flow duration tracked, in seconds.
+	// Longer flows are accounted in the last bucket.
+	maxTrackedDuration = 3600
+	// maxActiveTimeout is the largest active timeout accepted without
+	// warning. With a longer active timeout, long-lived flows are only
+	// accounted once their timeout expires, making time series spiky.
+	maxActiveTimeout = time.Minute
+	// estimateEvery tells how often (in number of flows) the active timeout
+	// is estimated again.
+	estimateEvery = 1000
+	// maxObservedFlows is the number of flows after which the histogram is
+	// halved to favor recent observations.
+	maxObservedFlows = 1 << 20
+)
+
+// flowEndReasonActiveTimeout is the value of the IPFIX element flowEndReason
+// when a flow is exported because of the active timeout (RFC 5102).
+const flowEndReasonActiveTimeout = 2
+
+// durationSystem keeps a histogram of the durations of the flows received from
+// an exporter to estimate its active timeout. Flows lasting longer than the
+// active timeout are cut by the exporter, therefore the active timeout is the
+// upper bound of the observed durations.
+type durationSystem struct {
+	nd  *Decoder
+	key string
+
+	lock     sync.Mutex
+	buckets  [maxTrackedDuration + 1]uint64
+	total    uint64
+	estimate time.Duration
+}
+
+// Observe records the duration of a flow, in milliseconds. When known, the
+// end reason is used to ignore flows that ended before the active timeout.
+func (s *durationSystem) Observe(duration uint64, endReason uint8) {
+	if endReason != 0 && endReason != flowEndReasonActiveTimeout {
+		return
+	}
+	bucket := (duration + 500) / 1000
+	if bucket > maxTrackedDuration {
+		bucket = maxTrackedDuration
+	}
+	s.lock.Lock()
+	s.buckets[bucket]++
+	s.total++
+	if s.total%estimateEvery != 0 {
+		s.lock.Unlock()
+		return
+	}
+	previous := s.estimate
+	s.estimate = s.activeTimeout()
+	estimate := s.estimate
+	if s.total >= maxObservedFlows {
+		s.total = 0
+		for idx := range s.buckets {
+			s.buckets[idx] /= 2
+			s.total += s.buckets[idx]
+		}
+	}
+	s.lock.Unlock()
+
+	if estimate == 0 {
+		return
+	}
+	s.nd.metrics.activeTimeout.WithLabelValues(s.key).Set(estimate.Seconds())
+	if estimate > maxActiveTimeout && estimate != previous {
+		s.nd.errLogger.Warn().
+			Str("exporter", s.key).
+			Dur("active-timeout", estimate).
+			Msgf("active timeout seems longer than %s, time series will be biased", maxActiveTimeout)
+	}
+}
+
+// activeTimeout returns the highest duration shared by at least 0.5% of the
+// observed flows. It returns 0 when not enough flows with a duration were
+// observed. The lock should be held.
+func (s *durationSystem) activeTimeout() time.Duration {
+	if s.total < estimateEvery {
+		return 0
+	}
+	threshold := s.total / 200
+	for bucket := maxTrackedDuration; bucket > 0; bucket-- {
+		if s.buckets[bucket] > threshold {
+			return time.Duration(bucket) * time.Second
+		}
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2023 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package netflow
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestActiveTimeoutEstimation(t *testing.T) {
+	cases := []struct {
+		Description string
+		Durations   func(i int) (uint64, uint8)
+		Expected    string
+	}{
+		{
+			Description: "not enough flows",
+			Durations: func(i int) (uint64, uint8) {
+				if i >= estimateEvery-1 {
+					return 0, flowEndReasonActiveTimeout + 1
+				}
+				return 60000, 0
+			},
+			Expected: "",
+		}, {
+			Description: "short flows and long-lived flows cut at 60s",
+			Durations: func(i int) (uint64, uint8) {
+				switch i % 10 {
+				case 0:
+					return 59700, 0
+				case 1:
+					return 60000, 0
+				default:
+					return uint64(i%50) * 100, 0
+				}
+			},
+			Expected: "60",
+		}, {
+			Description: "rare outliers are ignored",
+			Durations: func(i int) (uint64, uint8) {
+				switch {
+				case i == 10:
+					return 7200000, 0
+				case i%3 == 0:
+					return 15000, 0
+				default:
+					return 100, 0
+				}
+			},
+			Expected: "15",
+		}, {
+			Description: "only flows ended by active timeout",
+			Durations: func(i int) (uint64, uint8) {
+				if i%2 == 0 {
+					return uint64(i%300) * 1000, 1
+				}
+				return 300000, flowEndReasonActiveTimeout
+			},
+			Expected: "300",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			r := reporter.NewMock(t)
+			nd := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{}).(*Decoder)
+			durations := &durationSystem{nd: nd, key: "127.0.0.1"}
+			for i := 0; i < 2*estimateEvery; i++ {
+				durations.Observe(tc.Durations(i))
+			}
+			expectedMetrics := map[string]string{}
+			if tc.Expected != "" {
+				expectedMetrics[`active_timeout_seconds{exporter="127.0.0.1"}`] = tc.Expected
+			}
+			gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_netflow_", "active_timeout_")
+			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+				t.Fatalf("Metrics (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
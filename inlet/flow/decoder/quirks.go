@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+// Quirks are workarounds for exporters sending broken flows.
+type Quirks struct {
+	// SwappedCounters tells the bytes and packets counters are sent in
+	// little-endian order (NetFlow v9 and IPFIX only).
+	SwappedCounters bool
+	// SamplingRateExponent tells the advertised sampling rate is the
+	// exponent of a power of two (1 for 2, 10 for 1024).
+	SamplingRateExponent bool
+	// TimestampsInSeconds tells the flow start and end times are sent in
+	// seconds instead of milliseconds (NetFlow v9 and IPFIX only).
+	TimestampsInSeconds bool
+}
+
+// SamplingRate returns the sampling rate to use for the advertised one.
+func (q Quirks) SamplingRate(samplingRate uint32) uint32 {
+	if q.SamplingRateExponent && samplingRate > 0 && samplingRate < 32 {
+		return 1 << samplingRate
+	}
+	return samplingRate
+}
+
+// Counter returns the provided counter bytes in network order.
+func (q Quirks) Counter(b []byte) []byte {
+	if !q.SwappedCounters {
+		return b
+	}
+	swapped := make([]byte, len(b))
+	for i := range b {
+		swapped[len(b)-1-i] = b[i]
+	}
+	return swapped
+}
+
+// Timestamp returns the flow time in milliseconds from the advertised one.
+func (q Quirks) Timestamp(ts uint64) uint64 {
+	if q.TimestampsInSeconds {
+		return ts * 1000
+	}
+	return ts
+}
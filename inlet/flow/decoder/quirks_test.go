@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestQuirks(t *testing.T) {
+	var none Quirks
+	all := Quirks{
+		SwappedCounters:      true,
+		SamplingRateExponent: true,
+		TimestampsInSeconds:  true,
+	}
+
+	if got := none.SamplingRate(10); got != 10 {
+		t.Errorf("SamplingRate(10) == %d, expected 10", got)
+	}
+	for _, tc := range []struct{ advertised, expected uint32 }{
+		{0, 0},
+		{1, 2},
+		{10, 1024},
+		{1000, 1000},
+	} {
+		if got := all.SamplingRate(tc.advertised); got != tc.expected {
+			t.Errorf("SamplingRate(%d) == %d, expected %d", tc.advertised, got, tc.expected)
+		}
+	}
+
+	counter := []byte{0xa0, 0x01, 0x00, 0x00}
+	if diff := helpers.Diff(none.Counter(counter), []byte{0xa0, 0x01, 0x00, 0x00}); diff != "" {
+		t.Errorf("Counter() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(all.Counter(counter), []byte{0x00, 0x00, 0x01, 0xa0}); diff != "" {
+		t.Errorf("Counter() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(counter, []byte{0xa0, 0x01, 0x00, 0x00}); diff != "" {
+		t.Errorf("Counter() modified its input (-got, +want):\n%s", diff)
+	}
+
+	if got := none.Timestamp(1500); got != 1500 {
+		t.Errorf("Timestamp(1500) == %d, expected 1500", got)
+	}
+	if got := all.Timestamp(1500); got != 1_500_000 {
+		t.Errorf("Timestamp(1500) == %d, expected 1500000", got)
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package record
+
+import (
+	"fmt"
+	"net/netip"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/common/schema"
+)
+
+// ToMap converts a flow to a map using column names as keys. Once encoded as
+// JSON, it can be read back by the JSON decoder. The provided flow should not
+// be reused afterwards.
+func ToMap(sch *schema.Component, bf *schema.FlowMessage) (map[string]interface{}, error) {
+	columns := protobufColumns(sch)
+	record := map[string]interface{}{}
+	if bf.InIf != 0 {
+		record["InIf"] = bf.InIf
+	}
+	if bf.OutIf != 0 {
+		record["OutIf"] = bf.OutIf
+	}
+	payload := sch.ProtobufMarshal(bf)
+	_, n := protowire.ConsumeVarint(payload)
+	if n < 0 {
+		return nil, protowire.ParseError(n)
+	}
+	payload = payload[n:]
+	add := func(column *schema.Column, value interface{}) {
+		if !column.ProtobufRepeated {
+			record[column.Name] = value
+			return
+		}
+		values, _ := record[column.Name].([]interface{})
+		record[column.Name] = append(values, value)
+	}
+	varint := func(column *schema.Column, value uint64) interface{} {
+		if name, ok := column.ProtobufEnum[int(value)]; ok {
+			return name
+		}
+		return value
+	}
+	for len(payload) > 0 {
+		number, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		payload = payload[n:]
+		column, ok := columns[number]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %d", number)
+		}
+		switch wireType {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(payload)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			payload = payload[n:]
+			add(column, varint(column, value))
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(payload)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			payload = payload[n:]
+			switch {
+			case column.ProtobufRepeated && column.ProtobufType != protoreflect.BytesKind && column.ProtobufType != protoreflect.StringKind:
+				for len(value) > 0 {
+					v, n := protowire.ConsumeVarint(value)
+					if n < 0 {
+						return nil, protowire.ParseError(n)
+					}
+					value = value[n:]
+					add(column, varint(column, v))
+				}
+			case isIP(column):
+				ip, _ := netip.AddrFromSlice(value)
+				add(column, ip.Unmap().String())
+			default:
+				add(column, string(value))
+			}
+		default:
+			return nil, fmt.Errorf("unexpected wire type for %s", column.Name)
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strconv"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/common/schema"
+)
+
+// decodeJSON decodes a JSON record. Keys are column names. Integers are
+// expected as numbers, enumerations as names or numbers, IP addresses and
+// other values as strings. Repeated columns are expected as arrays.
+func (rd *Decoder) decodeJSON(bf *schema.FlowMessage, payload []byte) error {
+	var record map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return err
+	}
+	for name, value := range record {
+		// Interface indexes are not part of the schema but they are needed
+		// to query metadata.
+		switch name {
+		case "InIf", "OutIf":
+			v, err := jsonUint(value)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			if name == "InIf" {
+				bf.InIf = uint32(v)
+			} else {
+				bf.OutIf = uint32(v)
+			}
+			continue
+		}
+		column, ok := rd.d.Schema.LookupColumnByName(name)
+		if !ok || column.Disabled || column.ProtobufIndex <= 0 {
+			return fmt.Errorf("unknown column %s", name)
+		}
+		values := []interface{}{value}
+		if column.ProtobufRepeated {
+			var ok bool
+			values, ok = value.([]interface{})
+			if !ok {
+				return fmt.Errorf("%s: array expected", name)
+			}
+		}
+		for _, value := range values {
+			if err := rd.setJSON(bf, column, value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// setJSON sets a JSON value for the provided column.
+func (rd *Decoder) setJSON(bf *schema.FlowMessage, column *schema.Column, value interface{}) error {
+	switch {
+	case column.ProtobufType == protoreflect.EnumKind:
+		if name, ok := value.(string); ok {
+			for k, v := range column.ProtobufEnum {
+				if v == name {
+					setVarint(bf, column, uint64(k))
+					return nil
+				}
+			}
+			return fmt.Errorf("unknown value %q", name)
+		}
+		v, err := jsonUint(value)
+		if err != nil {
+			return err
+		}
+		setVarint(bf, column, v)
+	case isIP(column):
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("string expected")
+		}
+		ip, err := netip.ParseAddr(s)
+		if err != nil {
+			return err
+		}
+		setIP(bf, column, ip)
+	case column.ProtobufType == protoreflect.StringKind || column.ProtobufType == protoreflect.BytesKind:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("string expected")
+		}
+		column.ProtobufAppendBytes(bf, []byte(s))
+	default:
+		v, err := jsonUint(value)
+		if err != nil {
+			return err
+		}
+		setVarint(bf, column, v)
+	}
+	return nil
+}
+
+// jsonUint converts a JSON number to an unsigned integer.
+func jsonUint(value interface{}) (uint64, error) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("number expected")
+	}
+	return strconv.ParseUint(number.String(), 10, 64)
+}
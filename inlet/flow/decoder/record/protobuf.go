@@ -0,0 +1,77 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package record
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/common/schema"
+)
+
+// decodeProtobuf decodes a length-delimited protobuf record, as sent to
+// Kafka.
+func (rd *Decoder) decodeProtobuf(bf *schema.FlowMessage, payload []byte) error {
+	size, n := protowire.ConsumeVarint(payload)
+	if n < 0 {
+		return protowire.ParseError(n)
+	}
+	payload = payload[n:]
+	if uint64(len(payload)) != size {
+		return fmt.Errorf("unexpected length %d instead of %d", len(payload), size)
+	}
+	for len(payload) > 0 {
+		number, wireType, n := protowire.ConsumeTag(payload)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		payload = payload[n:]
+		column, ok := rd.columns[number]
+		if !ok {
+			return fmt.Errorf("unknown field %d", number)
+		}
+		switch wireType {
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			payload = payload[n:]
+			setVarint(bf, column, value)
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(payload)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			payload = payload[n:]
+			switch {
+			case column.ProtobufRepeated && column.ProtobufType != protoreflect.BytesKind && column.ProtobufType != protoreflect.StringKind:
+				// Packed repeated integers
+				for len(value) > 0 {
+					v, n := protowire.ConsumeVarint(value)
+					if n < 0 {
+						return protowire.ParseError(n)
+					}
+					value = value[n:]
+					setVarint(bf, column, v)
+				}
+			case isIP(column):
+				ip, ok := netip.AddrFromSlice(value)
+				if !ok {
+					return fmt.Errorf("invalid IP address for %s", column.Name)
+				}
+				setIP(bf, column, ip)
+			default:
+				column.ProtobufAppendBytes(bf, value)
+			}
+		default:
+			return errors.New("unexpected wire type")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package record handles decoding of flow records already using the schema
+// of Akvorado, encoded as JSON or as length-delimited protobuf messages.
+package record
+
+import (
+	"net/netip"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+// Decoder contains the state for the record decoder.
+type Decoder struct {
+	r         *reporter.Reporter
+	d         decoder.Dependencies
+	errLogger reporter.Logger
+	name      string
+	decode    func(*Decoder, *schema.FlowMessage, []byte) error
+
+	// columns maps protobuf indexes to columns
+	columns map[protowire.Number]*schema.Column
+}
+
+// NewJSON instantiates a new decoder for JSON records.
+func NewJSON(r *reporter.Reporter, dependencies decoder.Dependencies, _ decoder.Option) decoder.Decoder {
+	return newDecoder(r, dependencies, "json", (*Decoder).decodeJSON)
+}
+
+// NewProtobuf instantiates a new decoder for protobuf records.
+func NewProtobuf(r *reporter.Reporter, dependencies decoder.Dependencies, _ decoder.Option) decoder.Decoder {
+	return newDecoder(r, dependencies, "protobuf", (*Decoder).decodeProtobuf)
+}
+
+func init() {
+	decoder.Register("json", NewJSON)
+	decoder.Register("protobuf", NewProtobuf)
+}
+
+func newDecoder(r *reporter.Reporter, dependencies decoder.Dependencies, name string, decode func(*Decoder, *schema.FlowMessage, []byte) error) *Decoder {
+	rd := &Decoder{
+		r:         r,
+		d:         dependencies,
+		errLogger: r.Sample(reporter.BurstSampler(30*time.Second, 3)),
+		name:      name,
+		decode:    decode,
+		columns:   protobufColumns(dependencies.Schema),
+	}
+	return rd
+}
+
+// protobufColumns maps protobuf indexes to the columns of the provided
+// schema.
+func protobufColumns(sch *schema.Component) map[protowire.Number]*schema.Column {
+	columns := map[protowire.Number]*schema.Column{}
+	for _, column := range sch.Columns() {
+		for _, column := range append([]schema.Column{column}, column.ClickHouseTransformFrom...) {
+			if column.ProtobufIndex > 0 {
+				column, _ := sch.LookupColumnByKey(column.Key)
+				columns[column.ProtobufIndex] = column
+			}
+		}
+	}
+	return columns
+}
+
+// Decode decodes a record into a flow.
+func (rd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
+	bf := &schema.FlowMessage{}
+	if err := rd.decode(rd, bf, in.Payload); err != nil {
+		rd.errLogger.Err(err).Str("decoder", rd.name).Msg("cannot decode record")
+		return nil
+	}
+	if bf.TimeReceived == 0 {
+		bf.TimeReceived = uint64(in.TimeReceived.UTC().Unix())
+	}
+	if !bf.ExporterAddress.IsValid() {
+		bf.ExporterAddress, _ = netip.AddrFromSlice(in.Source.To16())
+	}
+	return []*schema.FlowMessage{bf}
+}
+
+// Name returns the decoder name.
+func (rd *Decoder) Name() string {
+	return rd.name
+}
+
+// Reset does nothing as there is no state.
+func (rd *Decoder) Reset(netip.Addr) bool {
+	return false
+}
+
+// setVarint sets an integer value for the provided column.
+func setVarint(bf *schema.FlowMessage, column *schema.Column, value uint64) {
+	switch column.Key {
+	case schema.ColumnTimeReceived:
+		bf.TimeReceived = value
+	case schema.ColumnSamplingRate:
+		bf.SamplingRate = uint32(value)
+	case schema.ColumnSrcAS:
+		bf.SrcAS = uint32(value)
+	case schema.ColumnDstAS:
+		bf.DstAS = uint32(value)
+	case schema.ColumnSrcNetMask:
+		bf.SrcNetMask = uint8(value)
+	case schema.ColumnDstNetMask:
+		bf.DstNetMask = uint8(value)
+	case schema.ColumnSrcVlan:
+		bf.SrcVlan = uint16(value)
+	case schema.ColumnDstVlan:
+		bf.DstVlan = uint16(value)
+	default:
+		column.ProtobufAppendVarint(bf, value)
+	}
+}
+
+// setIP sets an IP address for the provided column.
+func setIP(bf *schema.FlowMessage, column *schema.Column, value netip.Addr) {
+	value = netip.AddrFrom16(value.As16())
+	switch column.Key {
+	case schema.ColumnExporterAddress:
+		bf.ExporterAddress = value
+	case schema.ColumnSrcAddr:
+		bf.SrcAddr = value
+	case schema.ColumnDstAddr:
+		bf.DstAddr = value
+	case schema.ColumnNextHop:
+		bf.NextHop = value
+	default:
+		column.ProtobufAppendIP(bf, value)
+	}
+}
+
+// isIP tells if the provided column contains IP addresses.
+func isIP(column *schema.Column) bool {
+	return column.ProtobufType == protoreflect.BytesKind &&
+		strings.Contains(column.ClickHouseType, "IPv6")
+}
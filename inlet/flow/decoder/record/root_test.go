@@ -0,0 +1,193 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package record
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t).EnableAllColumns()
+	rdecoder := NewJSON(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
+	received := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		Description string
+		Payload     string
+		Expected    []*schema.FlowMessage
+	}{
+		{
+			Description: "complete record",
+			Payload: `{"TimeReceived": 1712822400, "SamplingRate": 1000, "ExporterAddress": "192.0.2.1",
+"InIf": 10, "OutIf": 20, "SrcAddr": "2001:db8::1", "DstAddr": "198.51.100.1", "SrcAS": 65000,
+"Bytes": 1500, "Packets": 1, "Proto": 6, "SrcPort": 443, "InIfBoundary": "EXTERNAL",
+"DstASPath": [65001, 65002], "InIfDescription": "Transit"}`,
+			Expected: []*schema.FlowMessage{
+				{
+					TimeReceived:    1712822400,
+					SamplingRate:    1000,
+					ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.1"),
+					InIf:            10,
+					OutIf:           20,
+					SrcAddr:         netip.MustParseAddr("2001:db8::1"),
+					DstAddr:         netip.MustParseAddr("::ffff:198.51.100.1"),
+					SrcAS:           65000,
+					ProtobufDebug: map[schema.ColumnKey]interface{}{
+						schema.ColumnBytes:           1500,
+						schema.ColumnPackets:         1,
+						schema.ColumnProto:           6,
+						schema.ColumnSrcPort:         443,
+						schema.ColumnInIfBoundary:    schema.InterfaceBoundaryExternal,
+						schema.ColumnDstASPath:       []uint32{65001, 65002},
+						schema.ColumnInIfDescription: []byte("Transit"),
+					},
+				},
+			},
+		}, {
+			Description: "default time and exporter",
+			Payload:     `{"Bytes": 100}`,
+			Expected: []*schema.FlowMessage{
+				{
+					TimeReceived:    uint64(received.Unix()),
+					ExporterAddress: netip.MustParseAddr("::ffff:127.0.0.1"),
+					ProtobufDebug: map[schema.ColumnKey]interface{}{
+						schema.ColumnBytes: 100,
+					},
+				},
+			},
+		}, {
+			Description: "unknown column",
+			Payload:     `{"Unknown": 100}`,
+		}, {
+			Description: "not a number",
+			Payload:     `{"Bytes": "100"}`,
+		}, {
+			Description: "invalid IP",
+			Payload:     `{"SrcAddr": "nope"}`,
+		}, {
+			Description: "invalid JSON",
+			Payload:     `{"Bytes"`,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := rdecoder.Decode(decoder.RawFlow{
+				TimeReceived: received,
+				Payload:      []byte(tc.Payload),
+				Source:       net.ParseIP("127.0.0.1"),
+			})
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("Decode() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDecodeProtobuf(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t).EnableAllColumns()
+	rdecoder := NewProtobuf(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
+
+	// Build a record as sent to Kafka
+	bf := &schema.FlowMessage{
+		TimeReceived:    1712822400,
+		SamplingRate:    1000,
+		ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.1"),
+		SrcAddr:         netip.MustParseAddr("2001:db8::1"),
+		DstAddr:         netip.MustParseAddr("::ffff:198.51.100.1"),
+		SrcAS:           65000,
+	}
+	sch.ProtobufAppendVarint(bf, schema.ColumnBytes, 1500)
+	sch.ProtobufAppendVarint(bf, schema.ColumnInIfBoundary, uint64(schema.InterfaceBoundaryInternal))
+	sch.ProtobufAppendVarint(bf, schema.ColumnDstASPath, 65001)
+	sch.ProtobufAppendVarint(bf, schema.ColumnDstASPath, 65002)
+	sch.ProtobufAppendBytes(bf, schema.ColumnInIfDescription, []byte("Transit"))
+	payload := sch.ProtobufMarshal(bf)
+
+	got := rdecoder.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      payload,
+		Source:       net.ParseIP("127.0.0.1"),
+	})
+	expected := []*schema.FlowMessage{
+		{
+			TimeReceived:    1712822400,
+			SamplingRate:    1000,
+			ExporterAddress: netip.MustParseAddr("::ffff:192.0.2.1"),
+			SrcAddr:         netip.MustParseAddr("2001:db8::1"),
+			DstAddr:         netip.MustParseAddr("::ffff:198.51.100.1"),
+			SrcAS:           65000,
+			ProtobufDebug: map[schema.ColumnKey]interface{}{
+				schema.ColumnBytes:           1500,
+				schema.ColumnInIfBoundary:    schema.InterfaceBoundaryInternal,
+				schema.ColumnDstASPath:       []uint32{65001, 65002},
+				schema.ColumnInIfDescription: []byte("Transit"),
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Decode() (-got, +want):\n%s", diff)
+	}
+
+	// Truncated record
+	if got := rdecoder.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      payload[:len(payload)-2],
+		Source:       net.ParseIP("127.0.0.1"),
+	}); got != nil {
+		t.Fatalf("Decode() on truncated record:\n%+v", got)
+	}
+}
+
+func TestToMap(t *testing.T) {
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t).EnableAllColumns()
+	rdecoder := NewJSON(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
+
+	payload := `{"TimeReceived":1712822400,"SamplingRate":1000,"ExporterAddress":"192.0.2.1",` +
+		`"InIf":10,"OutIf":20,"SrcAddr":"2001:db8::1","DstAddr":"198.51.100.1","SrcAS":65000,` +
+		`"Bytes":1500,"Packets":1,"Proto":6,"SrcPort":443,"InIfBoundary":"EXTERNAL",` +
+		`"DstASPath":[65001,65002],"InIfDescription":"Transit"}`
+	flows := rdecoder.Decode(decoder.RawFlow{
+		TimeReceived: time.Now(),
+		Payload:      []byte(payload),
+		Source:       net.ParseIP("127.0.0.1"),
+	})
+	if len(flows) != 1 {
+		t.Fatalf("Decode() returned %d flows", len(flows))
+	}
+	got, err := ToMap(sch, flows[0])
+	if err != nil {
+		t.Fatalf("ToMap() error:\n%+v", err)
+	}
+	expected := map[string]interface{}{
+		"TimeReceived":    uint64(1712822400),
+		"SamplingRate":    uint64(1000),
+		"ExporterAddress": "192.0.2.1",
+		"InIf":            uint32(10),
+		"OutIf":           uint32(20),
+		"SrcAddr":         "2001:db8::1",
+		"DstAddr":         "198.51.100.1",
+		"SrcAS":           uint64(65000),
+		"Bytes":           uint64(1500),
+		"Packets":         uint64(1),
+		"Proto":           uint64(6),
+		"SrcPort":         uint64(443),
+		"InIfBoundary":    "EXTERNAL",
+		"DstASPath":       []interface{}{uint64(65001), uint64(65002)},
+		"InIfDescription": "Transit",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("ToMap() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	registry     = map[string]NewDecoderFunc{}
+	registryLock sync.RWMutex
+)
+
+// Register makes a decoder available under the provided name. It is expected
+// to be called from the init() function of the package implementing the
+// decoder, so out-of-tree decoders can be added at build time by importing
+// their package. It panics if a decoder is already registered with the same
+// name.
+func Register(name string, newDecoder NewDecoderFunc) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if name == "" || newDecoder == nil {
+		panic("decoder: invalid registration")
+	}
+	if _, ok := registry[name]; ok {
+		panic(fmt.Sprintf("decoder: %q already registered", name))
+	}
+	registry[name] = newDecoder
+}
+
+// Lookup returns the function to instantiate the decoder registered under the
+// provided name.
+func Lookup(name string) (NewDecoderFunc, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	newDecoder, ok := registry[name]
+	return newDecoder, ok
+}
+
+// Names returns the sorted list of registered decoders.
+func Names() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
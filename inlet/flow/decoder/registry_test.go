@@ -0,0 +1,48 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+type dummyDecoder struct{}
+
+func (dummyDecoder) Decode(RawFlow) []*schema.FlowMessage { return []*schema.FlowMessage{} }
+func (dummyDecoder) Name() string                         { return "dummy" }
+func (dummyDecoder) Reset(netip.Addr) bool                { return false }
+
+func TestRegistry(t *testing.T) {
+	Register("dummy", func(*reporter.Reporter, Dependencies, Option) Decoder {
+		return dummyDecoder{}
+	})
+
+	newDecoder, ok := Lookup("dummy")
+	if !ok {
+		t.Fatal("Lookup(\"dummy\") did not find the decoder")
+	}
+	if got := newDecoder(reporter.NewMock(t), Dependencies{}, Option{}).Name(); got != "dummy" {
+		t.Fatalf("Name() == %q, expected %q", got, "dummy")
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Fatal("Lookup(\"unknown\") found a decoder")
+	}
+	if !slices.Contains(Names(), "dummy") {
+		t.Fatalf("Names() == %v, should contain %q", Names(), "dummy")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register() did not panic on duplicate name")
+		}
+	}()
+	Register("dummy", func(*reporter.Reporter, Dependencies, Option) Decoder {
+		return dummyDecoder{}
+	})
+}
@@ -7,8 +7,10 @@ package decoder
 
 import (
 	"net"
+	"net/netip"
 	"time"
 
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 )
@@ -22,6 +24,45 @@ type Decoder interface {
 
 	// Name returns the decoder name
 	Name() string
+
+	// Reset clears the state kept for the provided exporter (templates,
+	// sampling rates). It returns true if there was some state to clear.
+	Reset(exporter netip.Addr) bool
+}
+
+// Persister is implemented by decoders able to save their state (templates,
+// sampling rates) to survive restarts.
+type Persister interface {
+	// Save returns an encoded version of the decoder state.
+	Save() ([]byte, error)
+	// Load restores a state previously returned by Save.
+	Load(state []byte) error
+}
+
+// StatisticsProvider is implemented by decoders able to report the statistics
+// sent by exporters about their export process (exported flows, flows not
+// sent).
+type StatisticsProvider interface {
+	// Statistics returns the last statistics received from the provided
+	// exporter.
+	Statistics(exporter netip.Addr) map[string]uint64
+}
+
+// InterfaceCounters are the octet counters of an interface, as sent by an
+// exporter.
+type InterfaceCounters struct {
+	InOctets  uint64
+	OutOctets uint64
+	// Received is the time the counters were received.
+	Received time.Time
+}
+
+// CountersProvider is implemented by decoders able to report the interface
+// counters sent by exporters along with flows.
+type CountersProvider interface {
+	// InterfaceCounters returns the last interface counters received from
+	// each exporter, indexed by interface index.
+	InterfaceCounters() map[netip.Addr]map[uint32]InterfaceCounters
 }
 
 // Dependencies are the dependencies for the decoder
@@ -29,12 +70,51 @@ type Dependencies struct {
 	Schema *schema.Component
 }
 
+// Option are the options for the decoder.
+type Option struct {
+	// VendorElements maps exporter subnets to the vendor-specific
+	// elements to decode for them.
+	VendorElements *helpers.SubnetMap[[]VendorElement]
+	// SamplingRates maps exporter subnets to the rules to override or
+	// default the advertised sampling rates.
+	SamplingRates *helpers.SubnetMap[SamplingRateRules]
+	// Quirks maps exporter subnets to the workarounds to apply to their
+	// flows.
+	Quirks *helpers.SubnetMap[Quirks]
+	// HeaderDepth is the maximum number of stacked headers (VLAN tags,
+	// MPLS labels, IPv6 extension headers) to parse in sampled packet
+	// headers. When 0, DefaultHeaderDepth is used.
+	HeaderDepth int
+	// LateFlowThreshold is the delay between the end of a flow and its
+	// reception above which the flow is timestamped with its end time
+	// instead of its reception time. When 0, this is disabled.
+	LateFlowThreshold time.Duration
+}
+
+// DefaultHeaderDepth is the default maximum number of stacked headers to parse
+// in sampled packet headers.
+const DefaultHeaderDepth = 16
+
+// VendorElement maps a vendor-specific (enterprise) element to a column.
+type VendorElement struct {
+	// Enterprise is the private enterprise number of the vendor.
+	Enterprise uint32 `validate:"min=1"`
+	// Element is the element ID, without the enterprise bit.
+	Element uint16 `validate:"min=1,max=32767"`
+	// Column is the column to store the value into.
+	Column schema.ColumnKey
+}
+
 // RawFlow is an undecoded flow.
 type RawFlow struct {
 	TimeReceived time.Time
 	Payload      []byte
 	Source       net.IP
+
+	// UseAnnouncedExporterAddr tells the decoder to use the exporter
+	// address announced by the exporter, if any.
+	UseAnnouncedExporterAddr bool
 }
 
 // NewDecoderFunc is the signature of a function to instantiate a decoder.
-type NewDecoderFunc func(*reporter.Reporter, Dependencies) Decoder
+type NewDecoderFunc func(*reporter.Reporter, Dependencies, Option) Decoder
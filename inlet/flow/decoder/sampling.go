@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import "slices"
+
+// SamplingRateRule defines the sampling rate to use for some observation
+// domains of an exporter.
+type SamplingRateRule struct {
+	// ObservationDomains restricts the rule to some observation domains (the
+	// source ID for NetFlow v9, the sub-agent ID for sFlow). When empty, the
+	// rule applies to all observation domains.
+	ObservationDomains []uint32
+	// Default is the sampling rate to use when the exporter does not
+	// advertise one.
+	Default uint32 `validate:"required_without=Override"`
+	// Override is the sampling rate to use instead of the advertised one.
+	Override uint32
+}
+
+// SamplingRateRules is a list of sampling rate rules. The first rule
+// matching an observation domain is used.
+type SamplingRateRules []SamplingRateRule
+
+// Apply returns the sampling rate to use for a flow from the provided
+// observation domain with the advertised sampling rate. The second value
+// tells if the advertised sampling rate was overridden ("override"),
+// defaulted ("default") or kept as is ("").
+func (rules SamplingRateRules) Apply(obsDomainID uint32, samplingRate uint32) (uint32, string) {
+	for _, rule := range rules {
+		if len(rule.ObservationDomains) > 0 && !slices.Contains(rule.ObservationDomains, obsDomainID) {
+			continue
+		}
+		if rule.Override > 0 && rule.Override != samplingRate {
+			return rule.Override, "override"
+		}
+		if rule.Override == 0 && samplingRate == 0 && rule.Default > 0 {
+			return rule.Default, "default"
+		}
+		return samplingRate, ""
+	}
+	return samplingRate, ""
+}
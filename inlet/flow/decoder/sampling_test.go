@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package decoder
+
+import "testing"
+
+func TestSamplingRateRules(t *testing.T) {
+	rules := SamplingRateRules{
+		{ObservationDomains: []uint32{1, 2}, Override: 1000},
+		{ObservationDomains: []uint32{3}, Default: 500, Override: 100},
+		{Default: 10},
+	}
+	cases := []struct {
+		ObsDomainID  uint32
+		SamplingRate uint32
+		Expected     uint32
+		Reason       string
+	}{
+		{1, 0, 1000, "override"},
+		{2, 2000, 1000, "override"},
+		{2, 1000, 1000, ""},
+		{3, 0, 100, "override"},
+		{4, 0, 10, "default"},
+		{4, 2000, 2000, ""},
+	}
+	for _, tc := range cases {
+		got, reason := rules.Apply(tc.ObsDomainID, tc.SamplingRate)
+		if got != tc.Expected || reason != tc.Reason {
+			t.Errorf("Apply(%d, %d) == %d, %q but expected %d, %q",
+				tc.ObsDomainID, tc.SamplingRate, got, reason, tc.Expected, tc.Reason)
+		}
+	}
+	if got, reason := SamplingRateRules(nil).Apply(1, 0); got != 0 || reason != "" {
+		t.Errorf("Apply() on empty rules == %d, %q but expected 0, \"\"", got, reason)
+	}
+}
@@ -85,18 +85,20 @@ func (nd *Decoder) decode(packet sflow.Packet) []*schema.FlowMessage {
 				bf.DstAddr = decoder.DecodeIP(recordData.DstIP)
 				l3length = uint64(recordData.Length)
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnProto, uint64(recordData.Protocol))
-				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcPort, uint64(recordData.SrcPort))
-				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnDstPort, uint64(recordData.DstPort))
+				decoder.AppendPort(nd.d.Schema, bf, schema.ColumnSrcPort, schema.ColumnSrcPortBucket, uint64(recordData.SrcPort))
+				decoder.AppendPort(nd.d.Schema, bf, schema.ColumnDstPort, schema.ColumnDstPortBucket, uint64(recordData.DstPort))
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnEType, helpers.ETypeIPv4)
+				decoder.AppendTunnelType(nd.d.Schema, bf, uint8(recordData.Protocol), uint16(recordData.DstPort))
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnIPTos, uint64(recordData.Tos))
 			case sflow.SampledIPv6:
 				bf.SrcAddr = decoder.DecodeIP(recordData.SrcIP)
 				bf.DstAddr = decoder.DecodeIP(recordData.DstIP)
 				l3length = uint64(recordData.Length)
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnProto, uint64(recordData.Protocol))
-				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnSrcPort, uint64(recordData.SrcPort))
-				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnDstPort, uint64(recordData.DstPort))
+				decoder.AppendPort(nd.d.Schema, bf, schema.ColumnSrcPort, schema.ColumnSrcPortBucket, uint64(recordData.SrcPort))
+				decoder.AppendPort(nd.d.Schema, bf, schema.ColumnDstPort, schema.ColumnDstPortBucket, uint64(recordData.DstPort))
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnEType, helpers.ETypeIPv6)
+				decoder.AppendTunnelType(nd.d.Schema, bf, uint8(recordData.Protocol), uint16(recordData.DstPort))
 				nd.d.Schema.ProtobufAppendVarint(bf, schema.ColumnIPTos, uint64(recordData.Priority))
 			case sflow.SampledEthernet:
 				if l3length == 0 {
@@ -155,11 +157,11 @@ func (nd *Decoder) parseSampledHeader(bf *schema.FlowMessage, header *sflow.Samp
 	data := header.HeaderData
 	switch header.Protocol {
 	case 1: // Ethernet
-		return decoder.ParseEthernet(nd.d.Schema, bf, data)
+		return decoder.ParseEthernet(nd.d.Schema, bf, data, nd.o.HeaderDepth)
 	case 11: // IPv4
 		return decoder.ParseIPv4(nd.d.Schema, bf, data)
 	case 12: // IPv6
-		return decoder.ParseIPv6(nd.d.Schema, bf, data)
+		return decoder.ParseIPv6(nd.d.Schema, bf, data, nd.o.HeaderDepth)
 	}
 	return 0
 }
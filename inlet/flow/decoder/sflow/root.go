@@ -6,7 +6,10 @@ package sflow
 
 import (
 	"bytes"
+	"maps"
 	"net"
+	"net/netip"
+	"sync"
 	"time"
 
 	"github.com/netsampler/goflow2/v2/decoders/sflow"
@@ -32,6 +35,7 @@ const (
 type Decoder struct {
 	r         *reporter.Reporter
 	d         decoder.Dependencies
+	o         decoder.Option
 	errLogger reporter.Logger
 
 	metrics struct {
@@ -39,15 +43,22 @@ type Decoder struct {
 		stats                 *reporter.CounterVec
 		sampleRecordsStatsSum *reporter.CounterVec
 		sampleStatsSum        *reporter.CounterVec
+		samplingRates         *reporter.CounterVec
 	}
+
+	// Last interface counters received from each exporter
+	counters     map[netip.Addr]map[uint32]decoder.InterfaceCounters
+	countersLock sync.Mutex
 }
 
 // New instantiates a new sFlow decoder.
-func New(r *reporter.Reporter, dependencies decoder.Dependencies) decoder.Decoder {
+func New(r *reporter.Reporter, dependencies decoder.Dependencies, option decoder.Option) decoder.Decoder {
 	nd := &Decoder{
 		r:         r,
 		d:         dependencies,
+		o:         option,
 		errLogger: r.Sample(reporter.BurstSampler(30*time.Second, 3)),
+		counters:  map[netip.Addr]map[uint32]decoder.InterfaceCounters{},
 	}
 
 	nd.metrics.errors = nd.r.CounterVec(
@@ -78,10 +89,21 @@ func New(r *reporter.Reporter, dependencies decoder.Dependencies) decoder.Decode
 		},
 		[]string{"exporter", "agent", "version", "type"},
 	)
+	nd.metrics.samplingRates = nd.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "sampling_rate_overridden_total",
+			Help: "sFlows whose advertised sampling rate was replaced by the configured one.",
+		},
+		[]string{"exporter", "agent", "reason"},
+	)
 
 	return nd
 }
 
+func init() {
+	decoder.Register("sflow", New)
+}
+
 // Decode decodes an sFlow payload.
 func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 	buf := bytes.NewBuffer(in.Payload)
@@ -117,12 +139,23 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 				Inc()
 			nd.metrics.sampleRecordsStatsSum.WithLabelValues(key, agent, version, "CounterSample").
 				Add(float64(len(sConv.Records)))
+			nd.recordCounters(decoder.DecodeIP(packet.AgentIP), sConv, in.TimeReceived)
 		}
 	}
 
 	flowMessageSet := nd.decode(packet)
+	samplingRates, _ := nd.o.SamplingRates.Lookup(decoder.DecodeIP(packet.AgentIP))
+	quirks, _ := nd.o.Quirks.Lookup(decoder.DecodeIP(packet.AgentIP))
 	for _, fmsg := range flowMessageSet {
 		fmsg.TimeReceived = ts
+		fmsg.SamplingRate = quirks.SamplingRate(fmsg.SamplingRate)
+		if len(samplingRates) > 0 {
+			var reason string
+			fmsg.SamplingRate, reason = samplingRates.Apply(packet.SubAgentId, fmsg.SamplingRate)
+			if reason != "" {
+				nd.metrics.samplingRates.WithLabelValues(key, agent, reason).Inc()
+			}
+		}
 	}
 
 	return flowMessageSet
@@ -132,3 +165,49 @@ func (nd *Decoder) Decode(in decoder.RawFlow) []*schema.FlowMessage {
 func (nd *Decoder) Name() string {
 	return "sflow"
 }
+
+// Reset clears the interface counters received from the provided exporter.
+func (nd *Decoder) Reset(exporter netip.Addr) bool {
+	nd.countersLock.Lock()
+	defer nd.countersLock.Unlock()
+	exporter = exporter.Unmap()
+	_, ok := nd.counters[exporter]
+	delete(nd.counters, exporter)
+	return ok
+}
+
+// recordCounters records the generic interface counters contained in the
+// provided counter sample.
+func (nd *Decoder) recordCounters(exporter netip.Addr, sample sflow.CounterSample, received time.Time) {
+	exporter = exporter.Unmap()
+	nd.countersLock.Lock()
+	defer nd.countersLock.Unlock()
+	for _, record := range sample.Records {
+		ifCounters, ok := record.Data.(sflow.IfCounters)
+		if !ok {
+			continue
+		}
+		counters, ok := nd.counters[exporter]
+		if !ok {
+			counters = map[uint32]decoder.InterfaceCounters{}
+			nd.counters[exporter] = counters
+		}
+		counters[ifCounters.IfIndex] = decoder.InterfaceCounters{
+			InOctets:  ifCounters.IfInOctets,
+			OutOctets: ifCounters.IfOutOctets,
+			Received:  received,
+		}
+	}
+}
+
+// InterfaceCounters returns the last interface counters received from each
+// exporter.
+func (nd *Decoder) InterfaceCounters() map[netip.Addr]map[uint32]decoder.InterfaceCounters {
+	nd.countersLock.Lock()
+	defer nd.countersLock.Unlock()
+	result := make(map[netip.Addr]map[uint32]decoder.InterfaceCounters, len(nd.counters))
+	for exporter, counters := range nd.counters {
+		result[exporter] = maps.Clone(counters)
+	}
+	return result
+}
@@ -8,6 +8,9 @@ import (
 	"net/netip"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/netsampler/goflow2/v2/decoders/sflow"
 
 	"akvorado/common/helpers"
 	"akvorado/common/reporter"
@@ -17,7 +20,7 @@ import (
 
 func TestDecode(t *testing.T) {
 	r := reporter.NewMock(t)
-	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	// Send data
 	data := helpers.ReadPcapL4(t, filepath.Join("testdata", "data-1140.pcap"))
@@ -176,7 +179,7 @@ func TestDecode(t *testing.T) {
 
 func TestDecodeInterface(t *testing.T) {
 	r := reporter.NewMock(t)
-	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)})
+	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{})
 
 	t.Run("local interface", func(t *testing.T) {
 		// Send data
@@ -284,7 +287,7 @@ func TestDecodeInterface(t *testing.T) {
 
 func TestDecodeSamples(t *testing.T) {
 	r := reporter.NewMock(t)
-	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()})
+	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t).EnableAllColumns()}, decoder.Option{})
 
 	t.Run("expanded flow sample", func(t *testing.T) {
 		// Send data
@@ -497,3 +500,40 @@ func TestDecodeSamples(t *testing.T) {
 		}
 	})
 }
+
+func TestInterfaceCounters(t *testing.T) {
+	r := reporter.NewMock(t)
+	sdecoder := New(r, decoder.Dependencies{Schema: schema.NewMock(t)}, decoder.Option{}).(*Decoder)
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	sdecoder.recordCounters(exporter, sflow.CounterSample{
+		Records: []sflow.CounterRecord{
+			{Data: sflow.IfCounters{IfIndex: 10, IfInOctets: 1000, IfOutOctets: 2000}},
+			{Data: sflow.EthernetCounters{}},
+			{Data: sflow.IfCounters{IfIndex: 20, IfInOctets: 3000, IfOutOctets: 4000}},
+		},
+	}, now)
+	sdecoder.recordCounters(exporter, sflow.CounterSample{
+		Records: []sflow.CounterRecord{
+			{Data: sflow.IfCounters{IfIndex: 10, IfInOctets: 1500, IfOutOctets: 2500}},
+		},
+	}, now.Add(time.Minute))
+
+	got := sdecoder.InterfaceCounters()
+	expected := map[netip.Addr]map[uint32]decoder.InterfaceCounters{
+		netip.MustParseAddr("192.0.2.142"): {
+			10: {InOctets: 1500, OutOctets: 2500, Received: now.Add(time.Minute)},
+			20: {InOctets: 3000, OutOctets: 4000, Received: now},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("InterfaceCounters() (-got, +want):\n%s", diff)
+	}
+
+	if !sdecoder.Reset(exporter) {
+		t.Error("Reset() returned false")
+	}
+	if got := sdecoder.InterfaceCounters(); len(got) != 0 {
+		t.Errorf("InterfaceCounters() after Reset():\n%+v", got)
+	}
+}
@@ -34,3 +34,8 @@ func (dc *DummyDecoder) Decode(in RawFlow) []*schema.FlowMessage {
 func (dc *DummyDecoder) Name() string {
 	return "dummy"
 }
+
+// Reset does nothing as there is no state.
+func (dc *DummyDecoder) Reset(netip.Addr) bool {
+	return false
+}
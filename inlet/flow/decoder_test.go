@@ -5,8 +5,10 @@ package flow
 
 import (
 	"net"
+	"net/netip"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"akvorado/common/helpers"
 	"akvorado/common/reporter"
@@ -16,13 +18,34 @@ import (
 	"akvorado/inlet/flow/decoder/sflow"
 )
 
+func TestDecodeTime(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	config.SlowDecodeThreshold = time.Nanosecond
+	c := NewMock(t, r, config)
+	sdecoder := c.wrapDecoder(sflow.New(r, decoder.Dependencies{Schema: c.d.Schema}, decoder.Option{}), InputConfiguration{})
+	data := helpers.ReadPcapL4(t, filepath.Join("decoder", "sflow", "testdata", "data-1140.pcap"))
+	if got := sdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")}); len(got) == 0 {
+		t.Fatal("Decode() did not return any flow")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_time_seconds_count")
+	expectedMetrics := map[string]string{
+		`{name="sflow"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
 // The goal is to benchmark flow decoding + encoding to protobuf
 
 func BenchmarkDecodeEncodeNetflow(b *testing.B) {
 	schema.DisableDebug(b)
 	r := reporter.NewMock(b)
 	sch := schema.NewMock(b)
-	nfdecoder := netflow.New(r, decoder.Dependencies{Schema: sch})
+	nfdecoder := netflow.New(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
 
 	template := helpers.ReadPcapL4(b, filepath.Join("decoder", "netflow", "testdata", "options-template.pcap"))
 	got := nfdecoder.Decode(decoder.RawFlow{Payload: template, Source: net.ParseIP("127.0.0.1")})
@@ -66,7 +89,7 @@ func BenchmarkDecodeEncodeSflow(b *testing.B) {
 	schema.DisableDebug(b)
 	r := reporter.NewMock(b)
 	sch := schema.NewMock(b)
-	sdecoder := sflow.New(r, decoder.Dependencies{Schema: sch})
+	sdecoder := sflow.New(r, decoder.Dependencies{Schema: sch}, decoder.Option{})
 	data := helpers.ReadPcapL4(b, filepath.Join("decoder", "sflow", "testdata", "data-1140.pcap"))
 
 	for _, withEncoding := range []bool{true, false} {
@@ -90,3 +113,92 @@ func BenchmarkDecodeEncodeSflow(b *testing.B) {
 		})
 	}
 }
+
+func TestExporterAddresses(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	c := NewMock(t, r, config)
+	sdecoder := c.wrapDecoder(sflow.New(r, decoder.Dependencies{Schema: c.d.Schema}, decoder.Option{}), InputConfiguration{
+		ExporterAddresses: map[netip.Addr]netip.Addr{
+			netip.MustParseAddr("127.0.0.1"): netip.MustParseAddr("192.0.2.10"),
+		},
+	})
+	data := helpers.ReadPcapL4(t, filepath.Join("decoder", "sflow", "testdata", "data-1140.pcap"))
+
+	// Mapped source
+	got := sdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.1")})
+	if len(got) == 0 {
+		t.Fatal("Decode() did not return any flow")
+	}
+	expected := netip.MustParseAddr("::ffff:192.0.2.10")
+	for _, f := range got {
+		if f.ExporterAddress != expected {
+			t.Fatalf("Decode() exporter address %s, expected %s", f.ExporterAddress, expected)
+		}
+	}
+
+	// Unmapped source: agent address is kept
+	got = sdecoder.Decode(decoder.RawFlow{Payload: data, Source: net.ParseIP("127.0.0.2")})
+	if len(got) == 0 {
+		t.Fatal("Decode() did not return any flow")
+	}
+	expected = netip.MustParseAddr("::ffff:172.16.0.3")
+	for _, f := range got {
+		if f.ExporterAddress != expected {
+			t.Fatalf("Decode() exporter address %s, expected %s", f.ExporterAddress, expected)
+		}
+	}
+}
+
+type fakeDecoder struct {
+	flows []*schema.FlowMessage
+}
+
+func (fd *fakeDecoder) Decode(decoder.RawFlow) []*schema.FlowMessage {
+	return fd.flows
+}
+func (fd *fakeDecoder) Name() string          { return "fake" }
+func (fd *fakeDecoder) Reset(netip.Addr) bool { return false }
+
+func TestCounterAnomalies(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	c := NewMock(t, r, config)
+	flow := func(bytes, packets uint64, samplingRate uint32) *schema.FlowMessage {
+		bf := &schema.FlowMessage{SamplingRate: samplingRate}
+		if bytes > 0 {
+			c.d.Schema.ProtobufAppendVarint(bf, schema.ColumnBytes, bytes)
+		}
+		if packets > 0 {
+			c.d.Schema.ProtobufAppendVarint(bf, schema.ColumnPackets, packets)
+		}
+		return bf
+	}
+	flows := []*schema.FlowMessage{
+		flow(1500, 1, 1000),
+		flow(1000, 0, 1),
+		flow(0, 1, 1),
+		flow(1<<40, 1<<30, 1<<10),
+		flow(1<<63, 1, 1),
+		flow(1<<40, 1<<20, 1<<30),
+		flow(10, 20, 1),
+		flow(100000, 1, 1),
+	}
+	wdecoder := c.wrapDecoder(&fakeDecoder{flows: flows}, InputConfiguration{})
+	got := wdecoder.Decode(decoder.RawFlow{Source: net.ParseIP("127.0.0.1")})
+	if len(got) != 4 {
+		t.Fatalf("Decode() returned %d flows, expected 4", len(got))
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_decoder_anomalies_total")
+	expectedMetrics := map[string]string{
+		`{name="fake",reason="overflow"}`:            "2",
+		`{name="fake",reason="bytes-below-packets"}`: "1",
+		`{name="fake",reason="packet-too-large"}`:    "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
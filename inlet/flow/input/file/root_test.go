@@ -21,7 +21,7 @@ func TestFileInput(t *testing.T) {
 	configuration.Paths = []string{path.Join("testdata", "file1.txt"), path.Join("testdata", "file2.txt")}
 	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{
 		Schema: schema.NewMock(t),
-	})
+	}, nil)
 	if err != nil {
 		t.Fatalf("New() error:\n%+v", err)
 	}
@@ -0,0 +1,36 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pcap
+
+import "akvorado/inlet/flow/input"
+
+// Configuration describes pcap input configuration. Either a file is replayed
+// or an interface is sniffed.
+type Configuration struct {
+	// Path is the pcap or pcapng file to replay.
+	Path string `validate:"required_without=Interface,excluded_with=Interface"`
+	// Interface is the network interface to sniff flow packets from.
+	Interface string `validate:"required_without=Path"`
+	// Ports restricts the UDP destination ports of the flow packets. When
+	// empty, all UDP packets are decoded.
+	Ports []uint16
+	// Speed is the replay speed relative to the original timing. 0 replays
+	// the file as fast as possible.
+	Speed float64 `validate:"min=0"`
+	// Loop replays the file again once its end is reached.
+	Loop bool
+	// CaptureTime uses the capture timestamps of the replayed packets as
+	// reception time instead of the current time. This is useful to
+	// backfill flows.
+	CaptureTime bool
+	// Promiscuous enables the promiscuous mode of the sniffed interface.
+	Promiscuous bool
+}
+
+// DefaultConfiguration describes the default configuration for pcap input.
+func DefaultConfiguration() input.Configuration {
+	return &Configuration{
+		Speed: 1,
+	}
+}
@@ -0,0 +1,42 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pcap
+
+import (
+	"testing"
+
+	"akvorado/common/helpers"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	config := DefaultConfiguration().(*Configuration)
+	config.Path = "/path/to/file.pcap"
+	if err := helpers.Validate.Struct(config); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
+
+func TestConfigurationValidation(t *testing.T) {
+	cases := []struct {
+		Description string
+		Config      Configuration
+		Error       bool
+	}{
+		{"no path or interface", Configuration{Speed: 1}, true},
+		{"path", Configuration{Path: "file.pcap", Speed: 1}, false},
+		{"interface", Configuration{Interface: "eth0"}, false},
+		{"path and interface", Configuration{Path: "file.pcap", Interface: "eth0"}, true},
+		{"negative speed", Configuration{Path: "file.pcap", Speed: -1}, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			err := helpers.Validate.Struct(tc.Config)
+			if err == nil && tc.Error {
+				t.Fatal("validate.Struct() did not error")
+			} else if err != nil && !tc.Error {
+				t.Fatalf("validate.Struct() error:\n%+v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pcap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// pcapngMagic is the type of the first block of a pcapng file.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// packetReader reads packets from a pcap or pcapng file.
+type packetReader interface {
+	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
+	LinkType() layers.LinkType
+}
+
+// replay replays the configured file. Once the file is replayed, it waits
+// for the input to stop, unless it should loop.
+func (in *Input) replay() error {
+	for {
+		if err := in.replayOnce(); err != nil {
+			in.r.Err(err).Str("path", in.config.Path).Msg("unable to replay file")
+			in.metrics.errors.Inc()
+			return err
+		}
+		select {
+		case <-in.t.Dying():
+			return nil
+		default:
+		}
+		if !in.config.Loop {
+			in.r.Info().Str("path", in.config.Path).Msg("file replayed")
+			<-in.t.Dying()
+			return nil
+		}
+	}
+}
+
+// replayOnce replays the configured file once, respecting the original
+// timing adjusted by the configured speed.
+func (in *Input) replayOnce() error {
+	f, err := os.Open(in.config.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buffered := bufio.NewReader(f)
+	magic, err := buffered.Peek(len(pcapngMagic))
+	if err != nil {
+		return fmt.Errorf("cannot read file header: %w", err)
+	}
+	var reader packetReader
+	if bytes.Equal(magic, pcapngMagic) {
+		reader, err = pcapgo.NewNgReader(buffered, pcapgo.DefaultNgReaderOptions)
+	} else {
+		reader, err = pcapgo.NewReader(buffered)
+	}
+	if err != nil {
+		return fmt.Errorf("cannot read file header: %w", err)
+	}
+
+	var first time.Time
+	start := time.Now()
+	for {
+		data, ci, err := reader.ReadPacketData()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("cannot read packet: %w", err)
+		}
+		if in.config.Speed > 0 {
+			if first.IsZero() {
+				first = ci.Timestamp
+			}
+			wait := time.Duration(float64(ci.Timestamp.Sub(first))/in.config.Speed) - time.Since(start)
+			if wait > 0 {
+				select {
+				case <-in.t.Dying():
+					return nil
+				case <-time.After(wait):
+				}
+			}
+		}
+		received := time.Now()
+		if in.config.CaptureTime {
+			received = ci.Timestamp
+		}
+		if !in.handlePacket(data, reader.LinkType(), received) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package pcap handles flow packets captured from the network, either by
+// replaying a pcap file or by sniffing an interface.
+package pcap
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/exp/slices"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/input"
+	"akvorado/inlet/pipeline"
+)
+
+// Input represents the state of a pcap input.
+type Input struct {
+	r      *reporter.Reporter
+	t      tomb.Tomb
+	config *Configuration
+
+	metrics struct {
+		packets        *reporter.CounterVec
+		ignoredPackets reporter.Counter
+		decodedFlows   *reporter.CounterVec
+		errors         reporter.Counter
+	}
+
+	ch      chan []*schema.FlowMessage // channel to send flows to
+	decoder decoder.Decoder
+}
+
+// New instantiates a new pcap input from the provided configuration.
+func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder, _ *pipeline.Budget) (input.Input, error) {
+	if configuration.Path == "" && configuration.Interface == "" {
+		return nil, errors.New("no path or interface provided for pcap input")
+	}
+	input := &Input{
+		r:       r,
+		config:  configuration,
+		ch:      make(chan []*schema.FlowMessage),
+		decoder: dec,
+	}
+	input.metrics.packets = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "packets_total",
+			Help: "Flow packets captured.",
+		},
+		[]string{"exporter"},
+	)
+	input.metrics.ignoredPackets = r.Counter(
+		reporter.CounterOpts{
+			Name: "ignored_packets_total",
+			Help: "Captured packets ignored as they are not flow packets.",
+		},
+	)
+	input.metrics.decodedFlows = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "decoded_flows_total",
+			Help: "Number of flows decoded and written to the internal queue.",
+		},
+		[]string{"exporter"},
+	)
+	input.metrics.errors = r.Counter(
+		reporter.CounterOpts{
+			Name: "errors_total",
+			Help: "Errors while capturing packets.",
+		},
+	)
+	daemon.Track(&input.t, "inlet/flow/input/pcap")
+	return input, nil
+}
+
+// Start starts capturing packets and producing flows.
+func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
+	if in.config.Path != "" {
+		in.r.Info().Str("path", in.config.Path).Msg("pcap input starting")
+		in.t.Go(in.replay)
+		return in.ch, nil
+	}
+	in.r.Info().Str("interface", in.config.Interface).Msg("pcap input starting")
+	sniffer, err := newSniffer(in.config.Interface, in.config.Promiscuous)
+	if err != nil {
+		in.r.Err(err).Str("interface", in.config.Interface).Msg("unable to sniff interface")
+		return nil, err
+	}
+	in.t.Go(func() error {
+		return in.sniff(sniffer)
+	})
+	return in.ch, nil
+}
+
+// Stop stops capturing packets.
+func (in *Input) Stop() error {
+	defer func() {
+		close(in.ch)
+		in.r.Info().Msg("pcap input stopped")
+	}()
+	in.t.Kill(nil)
+	return in.t.Wait()
+}
+
+// handlePacket decodes the flows contained in a captured packet and sends
+// them. The decoder of the first layer should be provided. It returns false
+// when the input is stopping.
+func (in *Input) handlePacket(data []byte, first gopacket.Decoder, received time.Time) bool {
+	packet := gopacket.NewPacket(data, first, gopacket.DecodeOptions{Lazy: true})
+	udp, ok := packet.Layer(layers.LayerTypeUDP).(*layers.UDP)
+	if !ok || (len(in.config.Ports) > 0 && !slices.Contains(in.config.Ports, uint16(udp.DstPort))) {
+		in.metrics.ignoredPackets.Inc()
+		return true
+	}
+	var source net.IP
+	switch network := packet.NetworkLayer().(type) {
+	case *layers.IPv4:
+		source = network.SrcIP
+	case *layers.IPv6:
+		source = network.SrcIP
+	default:
+		in.metrics.ignoredPackets.Inc()
+		return true
+	}
+	exporter := source.String()
+	in.metrics.packets.WithLabelValues(exporter).Inc()
+	flows := in.decoder.Decode(decoder.RawFlow{
+		TimeReceived: received,
+		Payload:      udp.Payload,
+		Source:       source,
+	})
+	if len(flows) == 0 {
+		return true
+	}
+	select {
+	case <-in.t.Dying():
+		return false
+	case in.ch <- flows:
+		in.metrics.decodedFlows.WithLabelValues(exporter).Add(float64(len(flows)))
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pcap
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestReplay(t *testing.T) {
+	cases := []struct {
+		Description string
+		Ports       []uint16
+		CaptureTime bool
+		Expected    []string
+		Metrics     map[string]string
+	}{
+		{
+			Description: "all ports",
+			Expected:    []string{"192.0.2.100"},
+			Metrics: map[string]string{
+				`decoded_flows_total{exporter="192.0.2.100"}`: "1",
+				`packets_total{exporter="192.0.2.100"}`:       "1",
+				`ignored_packets_total`:                       "0",
+			},
+		}, {
+			Description: "matching port",
+			Ports:       []uint16{2055},
+			CaptureTime: true,
+			Expected:    []string{"192.0.2.100"},
+			Metrics: map[string]string{
+				`decoded_flows_total{exporter="192.0.2.100"}`: "1",
+				`packets_total{exporter="192.0.2.100"}`:       "1",
+				`ignored_packets_total`:                       "0",
+			},
+		}, {
+			Description: "other port",
+			Ports:       []uint16{6343},
+			Expected:    []string{},
+			Metrics: map[string]string{
+				`ignored_packets_total`: "1",
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			r := reporter.NewMock(t)
+			configuration := DefaultConfiguration().(*Configuration)
+			configuration.Path = filepath.Join("..", "..", "decoder", "netflow", "testdata", "data.pcap")
+			configuration.Speed = 0
+			configuration.Ports = tc.Ports
+			configuration.CaptureTime = tc.CaptureTime
+			in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{
+				Schema: schema.NewMock(t),
+			}, nil)
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			ch, err := in.Start()
+			if err != nil {
+				t.Fatalf("Start() error:\n%+v", err)
+			}
+			defer func() {
+				if err := in.Stop(); err != nil {
+					t.Fatalf("Stop() error:\n%+v", err)
+				}
+			}()
+
+			got := []string{}
+		out:
+			for {
+				select {
+				case flows := <-ch:
+					for _, flow := range flows {
+						got = append(got, flow.ExporterAddress.Unmap().String())
+						if tc.CaptureTime && flow.TimeReceived == uint64(time.Now().Unix()) {
+							t.Error("TimeReceived is not the capture time")
+						}
+					}
+				case <-time.After(50 * time.Millisecond):
+					break out
+				}
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("Input data (-got, +want):\n%s", diff)
+			}
+
+			gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_pcap_",
+				"decoded_flows_total", "packets_total", "ignored_packets_total")
+			if diff := helpers.Diff(gotMetrics, tc.Metrics); diff != "" {
+				t.Fatalf("Metrics (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSniffMissingInterface(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Interface = "does-not-exist0"
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{
+		Schema: schema.NewMock(t),
+	}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, err := in.Start(); err == nil {
+		t.Fatal("Start() did not error")
+	}
+}
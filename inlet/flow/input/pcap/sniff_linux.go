@@ -0,0 +1,105 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build linux
+
+package pcap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/gopacket/layers"
+	"golang.org/x/sys/unix"
+)
+
+// sniffer is an AF_PACKET socket bound to an interface. As the socket uses
+// SOCK_DGRAM, packets start at the network layer.
+type sniffer struct {
+	fd int
+}
+
+// htons converts a short from host to network byte order.
+func htons(value uint16) uint16 {
+	return value<<8 | value>>8
+}
+
+// newSniffer opens an AF_PACKET socket on the provided interface. This
+// requires the CAP_NET_RAW capability.
+func newSniffer(iface string, promiscuous bool) (*sniffer, error) {
+	intf, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("cannot find interface %q: %w", iface, err)
+	}
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM, int(htons(unix.ETH_P_ALL)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open packet socket: %w", err)
+	}
+	if err := unix.Bind(fd, &unix.SockaddrLinklayer{
+		Protocol: htons(unix.ETH_P_ALL),
+		Ifindex:  intf.Index,
+	}); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("cannot bind to interface %q: %w", iface, err)
+	}
+	if promiscuous {
+		if err := unix.SetsockoptPacketMreq(fd, unix.SOL_PACKET, unix.PACKET_ADD_MEMBERSHIP,
+			&unix.PacketMreq{
+				Ifindex: int32(intf.Index),
+				Type:    unix.PACKET_MR_PROMISC,
+			}); err != nil {
+			unix.Close(fd)
+			return nil, fmt.Errorf("cannot enable promiscuous mode on %q: %w", iface, err)
+		}
+	}
+	// Use a timeout to be able to stop the input
+	timeout := unix.NsecToTimeval((500 * time.Millisecond).Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("cannot set receive timeout: %w", err)
+	}
+	return &sniffer{fd: fd}, nil
+}
+
+// sniff reads packets from the sniffer until the input is stopped.
+func (in *Input) sniff(s *sniffer) error {
+	defer unix.Close(s.fd)
+	payload := make([]byte, 65536)
+	for {
+		select {
+		case <-in.t.Dying():
+			return nil
+		default:
+		}
+		n, from, err := unix.Recvfrom(s.fd, payload, 0)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			in.r.Err(err).Str("interface", in.config.Interface).Msg("unable to read packet")
+			in.metrics.errors.Inc()
+			return err
+		}
+		received := time.Now()
+		ll, ok := from.(*unix.SockaddrLinklayer)
+		if !ok || ll.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		data := make([]byte, n)
+		copy(data, payload[:n])
+		switch htons(ll.Protocol) {
+		case unix.ETH_P_IP:
+			if !in.handlePacket(data, layers.LayerTypeIPv4, received) {
+				return nil
+			}
+		case unix.ETH_P_IPV6:
+			if !in.handlePacket(data, layers.LayerTypeIPv6, received) {
+				return nil
+			}
+		default:
+			in.metrics.ignoredPackets.Inc()
+		}
+	}
+}
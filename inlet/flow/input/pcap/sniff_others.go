@@ -0,0 +1,21 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build !linux
+
+package pcap
+
+import "errors"
+
+// sniffer is not available on this platform.
+type sniffer struct{}
+
+// newSniffer returns an error as sniffing is only supported on Linux.
+func newSniffer(string, bool) (*sniffer, error) {
+	return nil, errors.New("sniffing an interface is only supported on Linux")
+}
+
+// sniff does nothing as sniffing is only supported on Linux.
+func (in *Input) sniff(*sniffer) error {
+	return nil
+}
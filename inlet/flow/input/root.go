@@ -9,6 +9,7 @@ import (
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/pipeline"
 )
 
 // Input is the interface any input should meet
@@ -21,6 +22,7 @@ type Input interface {
 
 // Configuration defines the interface to instantiate an input module from its configuration.
 type Configuration interface {
-	// New instantiates a new input from its configuration.
-	New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder) (Input, error)
+	// New instantiates a new input from its configuration. The memory budget
+	// may be nil.
+	New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder, budget *pipeline.Budget) (Input, error)
 }
@@ -0,0 +1,14 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package stdin
+
+import "akvorado/inlet/flow/input"
+
+// Configuration describes stdin input configuration.
+type Configuration struct{}
+
+// DefaultConfiguration describes the default configuration for stdin input.
+func DefaultConfiguration() input.Configuration {
+	return &Configuration{}
+}
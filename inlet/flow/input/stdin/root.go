@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package stdin reads flow records from the standard input. With the
+// "protobuf" decoder, records are length-delimited. Otherwise, there is one
+// record per line.
+package stdin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+	"akvorado/inlet/flow/input"
+	"akvorado/inlet/pipeline"
+)
+
+// maxRecordSize is the maximum size of a length-delimited record.
+const maxRecordSize = 1 << 20
+
+// Input represents the state of a stdin input.
+type Input struct {
+	r      *reporter.Reporter
+	t      tomb.Tomb
+	config *Configuration
+	reader io.Reader // source of records, os.Stdin unless testing
+
+	ch      chan []*schema.FlowMessage // channel to send flows to
+	decoder decoder.Decoder
+}
+
+// New instantiates a new stdin input from the provided configuration.
+func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder, _ *pipeline.Budget) (input.Input, error) {
+	input := &Input{
+		r:       r,
+		config:  configuration,
+		reader:  os.Stdin,
+		ch:      make(chan []*schema.FlowMessage),
+		decoder: dec,
+	}
+	daemon.Track(&input.t, "inlet/flow/input/stdin")
+	return input, nil
+}
+
+// Start starts reading records from the standard input and producing
+// flows. Once the standard input is closed, the daemon is stopped.
+func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
+	in.r.Info().Msg("stdin input starting")
+	reader := bufio.NewReader(in.reader)
+	next := readLine
+	if in.decoder.Name() == "protobuf" {
+		next = readDelimited
+	}
+	in.t.Go(func() error {
+		for {
+			payload, err := next(reader)
+			if err == io.EOF {
+				in.r.Info().Msg("end of standard input")
+				return nil
+			} else if err != nil {
+				in.r.Err(err).Msg("unable to read standard input")
+				return err
+			}
+			if len(payload) == 0 {
+				continue
+			}
+			flows := in.decoder.Decode(decoder.RawFlow{
+				TimeReceived: time.Now(),
+				Payload:      payload,
+				Source:       net.ParseIP("127.0.0.1"),
+			})
+			if len(flows) == 0 {
+				continue
+			}
+			select {
+			case <-in.t.Dying():
+				return nil
+			case in.ch <- flows:
+			}
+		}
+	})
+	return in.ch, nil
+}
+
+// Stop stops reading the standard input.
+func (in *Input) Stop() error {
+	defer func() {
+		close(in.ch)
+		in.r.Info().Msg("stdin input stopped")
+	}()
+	in.t.Kill(nil)
+	return in.t.Wait()
+}
+
+// readLine reads a newline-terminated record.
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	line, err := reader.ReadBytes('\n')
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	return bytes.TrimSpace(line), err
+}
+
+// readDelimited reads a length-delimited record. The length prefix is kept.
+func readDelimited(reader *bufio.Reader) ([]byte, error) {
+	var prefix [binary.MaxVarintLen64]byte
+	n := 0
+	for {
+		b, err := reader.ReadByte()
+		if err == io.EOF && n > 0 {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+		if n == len(prefix) {
+			return nil, errors.New("invalid length prefix")
+		}
+		prefix[n] = b
+		n++
+		if b < 0x80 {
+			break
+		}
+	}
+	size, _ := binary.Uvarint(prefix[:n])
+	if size > maxRecordSize {
+		return nil, errors.New("record too large")
+	}
+	payload := make([]byte, n+int(size))
+	copy(payload, prefix[:n])
+	if _, err := io.ReadFull(reader, payload[n:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package stdin
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
+)
+
+func TestStdinInput(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{
+		Schema: schema.NewMock(t),
+	}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	in.(*Input).reader = strings.NewReader("hello world!\n\nbye bye\nno newline")
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	expected := []string{"hello world!", "bye bye", "no newline"}
+	got := []string{}
+out:
+	for i := 0; i < len(expected)+1; i++ {
+		select {
+		case got1 := <-ch:
+			for _, fl := range got1 {
+				got = append(got, string(fl.ProtobufDebug[schema.ColumnInIfDescription].([]byte)))
+			}
+		case <-time.After(50 * time.Millisecond):
+			break out
+		}
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Input data (-got, +want):\n%s", diff)
+	}
+}
+
+func TestReadDelimited(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected []string
+		Err      bool
+	}{
+		{Input: "\x03abc\x01d", Expected: []string{"\x03abc", "\x01d"}},
+		{Input: "\x00", Expected: []string{"\x00"}},
+		{Input: "\x05abc", Err: true},
+		{Input: "\x80", Err: true},
+		{Input: "\xff\xff\xff\x7f", Err: true},
+	}
+	for _, tc := range cases {
+		reader := bufio.NewReader(strings.NewReader(tc.Input))
+		got := []string{}
+		var err error
+		for {
+			var payload []byte
+			payload, err = readDelimited(reader)
+			if err != nil {
+				break
+			}
+			got = append(got, string(payload))
+		}
+		if tc.Err && err == io.EOF {
+			t.Errorf("readDelimited(%q) did not error", tc.Input)
+		} else if !tc.Err && err != io.EOF {
+			t.Errorf("readDelimited(%q) error:\n%+v", tc.Input, err)
+		} else if !tc.Err {
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Errorf("readDelimited(%q) (-got, +want):\n%s", tc.Input, diff)
+			}
+		}
+	}
+}
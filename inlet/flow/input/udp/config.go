@@ -7,10 +7,17 @@ import "akvorado/inlet/flow/input"
 
 // Configuration describes UDP input configuration.
 type Configuration struct {
-	// Listen tells which port to listen to.
-	Listen string `validate:"required,listen"`
+	// Listen tells which port to listen to. It can also be a socket passed by
+	// systemd ("systemd:name").
+	Listen string `validate:"required,listen|startswith=systemd:"`
 	// Workers define the number of workers to use for receiving flows.
 	Workers int `validate:"required,min=1"`
+	// DecoderWorkers define the number of workers to use for decoding
+	// flows. When 0, flows are decoded by the workers receiving them.
+	DecoderWorkers int `validate:"min=0"`
+	// DecoderQueueSize defines the size of the channel used to send
+	// received packets to decoder workers.
+	DecoderQueueSize uint `validate:"required_with=DecoderWorkers"`
 	// QueueSize defines the size of the channel used to
 	// communicate incoming flows. 0 can be used to disable
 	// buffering.
@@ -21,13 +28,25 @@ type Configuration struct {
 	// The value cannot exceed the kernel max value
 	// (net.core.wmem_max).
 	ReceiveBuffer uint
+	// ForwardTo is a list of destinations (host:port) to forward the
+	// received packets to, as is. This allows to insert Akvorado in front
+	// of other collectors.
+	ForwardTo []string `validate:"dive,hostname_port"`
+	// ForwardSpoofSource tells to keep the source address and port of the
+	// received packets when forwarding them. This requires raw sockets and
+	// the CAP_NET_RAW capability.
+	ForwardSpoofSource bool
+	// DSCP is the DSCP value to use for packets sent by this input (when
+	// forwarding).
+	DSCP uint8 `validate:"max=63"`
 }
 
 // DefaultConfiguration is the default configuration for this input
 func DefaultConfiguration() input.Configuration {
 	return &Configuration{
-		Listen:    ":0",
-		Workers:   1,
-		QueueSize: 100000,
+		Listen:           ":0",
+		Workers:          1,
+		DecoderQueueSize: 10000,
+		QueueSize:        100000,
 	}
 }
@@ -14,3 +14,26 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
 	}
 }
+
+func TestValidateListen(t *testing.T) {
+	cases := []struct {
+		Listen string
+		Valid  bool
+	}{
+		{"127.0.0.1:2055", true},
+		{":2055", true},
+		{"systemd:netflow", true},
+		{"unix:/run/akvorado.sock", false},
+		{"netflow", false},
+	}
+	for _, tc := range cases {
+		configuration := DefaultConfiguration().(*Configuration)
+		configuration.Listen = tc.Listen
+		err := helpers.Validate.Struct(configuration)
+		if err == nil && !tc.Valid {
+			t.Errorf("validate.Struct(%q) did not error", tc.Listen)
+		} else if err != nil && tc.Valid {
+			t.Errorf("validate.Struct(%q) error:\n%+v", tc.Listen, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package udp
+
+import (
+	"encoding/binary"
+	"net"
+)
+
+// forwarder sends received packets to another collector.
+type forwarder interface {
+	// Forward sends the payload received from the provided source.
+	Forward(payload []byte, source *net.UDPAddr) error
+	// Close closes the forwarder.
+	Close() error
+}
+
+// udpForwarder forwards packets using a connected UDP socket. The
+// destination sees the inlet as the source of the packets.
+type udpForwarder struct {
+	*net.UDPConn
+}
+
+// Forward sends the payload to the destination.
+func (f udpForwarder) Forward(payload []byte, _ *net.UDPAddr) error {
+	_, err := f.Write(payload)
+	return err
+}
+
+// newForwarder creates a forwarder to the provided destination. When spoof
+// is true, the forwarded packets keep the source address of the received
+// packets.
+func newForwarder(destination *net.UDPAddr, dscp uint8, spoof bool) (forwarder, error) {
+	if spoof {
+		return newSpoofingForwarder(destination, dscp)
+	}
+	dialer := dialConfig(dscp)
+	conn, err := dialer.Dial("udp", destination.String())
+	if err != nil {
+		return nil, err
+	}
+	return udpForwarder{conn.(*net.UDPConn)}, nil
+}
+
+// udpHeader builds an UDP header for the provided payload. The checksum is
+// computed from the provided source and destination IP addresses (4 or 16
+// bytes).
+func udpHeader(source, destination *net.UDPAddr, srcIP, dstIP net.IP, payload []byte) []byte {
+	length := 8 + len(payload)
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint16(header[0:], uint16(source.Port))
+	binary.BigEndian.PutUint16(header[2:], uint16(destination.Port))
+	binary.BigEndian.PutUint16(header[4:], uint16(length))
+
+	// Pseudo-header
+	var sum uint32
+	sum = checksumAdd(sum, srcIP)
+	sum = checksumAdd(sum, dstIP)
+	sum += 17 // UDP
+	sum += uint32(length)
+	sum = checksumAdd(sum, header)
+	sum = checksumAdd(sum, payload)
+	checksum := checksumFold(sum)
+	if checksum == 0 {
+		checksum = 0xffff
+	}
+	binary.BigEndian.PutUint16(header[6:], checksum)
+	return header
+}
+
+// checksumAdd adds the provided bytes to an Internet checksum.
+func checksumAdd(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+// checksumFold turns a sum into an Internet checksum.
+func checksumFold(sum uint32) uint16 {
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
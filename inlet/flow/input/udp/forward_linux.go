@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build linux
+
+package udp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// spoofingForwarder forwards packets using a raw socket, keeping the original
+// source address and port. This requires the CAP_NET_RAW capability.
+type spoofingForwarder struct {
+	fd          int
+	dscp        uint8
+	destination *net.UDPAddr
+	sockaddr    unix.Sockaddr
+}
+
+// newSpoofingForwarder creates a forwarder keeping the original source of the
+// packets.
+func newSpoofingForwarder(destination *net.UDPAddr, dscp uint8) (forwarder, error) {
+	f := &spoofingForwarder{
+		dscp:        dscp,
+		destination: destination,
+	}
+	family := unix.AF_INET6
+	if ip4 := destination.IP.To4(); ip4 != nil {
+		family = unix.AF_INET
+		sa := &unix.SockaddrInet4{}
+		copy(sa.Addr[:], ip4)
+		f.sockaddr = sa
+	} else {
+		sa := &unix.SockaddrInet6{}
+		copy(sa.Addr[:], destination.IP.To16())
+		f.sockaddr = sa
+	}
+	// With IPPROTO_RAW, the IP header is provided by us.
+	fd, err := unix.Socket(family, unix.SOCK_RAW, unix.IPPROTO_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create raw socket: %w", err)
+	}
+	f.fd = fd
+	return f, nil
+}
+
+// Forward sends the payload to the destination, using the provided source.
+func (f *spoofingForwarder) Forward(payload []byte, source *net.UDPAddr) error {
+	var packet []byte
+	if dst4 := f.destination.IP.To4(); dst4 != nil {
+		src4 := source.IP.To4()
+		if src4 == nil {
+			return errors.New("cannot forward an IPv6 packet to an IPv4 destination")
+		}
+		udp := udpHeader(source, f.destination, src4, dst4, payload)
+		header := make([]byte, 20)
+		header[0] = 0x45
+		header[1] = f.dscp << 2
+		binary.BigEndian.PutUint16(header[2:], uint16(len(header)+len(udp)+len(payload)))
+		header[8] = 64 // TTL
+		header[9] = unix.IPPROTO_UDP
+		copy(header[12:], src4)
+		copy(header[16:], dst4)
+		binary.BigEndian.PutUint16(header[10:], checksumFold(checksumAdd(0, header)))
+		packet = append(append(header, udp...), payload...)
+	} else {
+		if source.IP.To4() != nil {
+			return errors.New("cannot forward an IPv4 packet to an IPv6 destination")
+		}
+		src16, dst16 := source.IP.To16(), f.destination.IP.To16()
+		udp := udpHeader(source, f.destination, src16, dst16, payload)
+		header := make([]byte, 40)
+		binary.BigEndian.PutUint32(header[0:], 6<<28|uint32(f.dscp)<<22)
+		binary.BigEndian.PutUint16(header[4:], uint16(len(udp)+len(payload)))
+		header[6] = unix.IPPROTO_UDP
+		header[7] = 64 // Hop limit
+		copy(header[8:], src16)
+		copy(header[24:], dst16)
+		packet = append(append(header, udp...), payload...)
+	}
+	return unix.Sendto(f.fd, packet, 0, f.sockaddr)
+}
+
+// Close closes the raw socket.
+func (f *spoofingForwarder) Close() error {
+	return unix.Close(f.fd)
+}
@@ -0,0 +1,16 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+//go:build !linux
+
+package udp
+
+import (
+	"errors"
+	"net"
+)
+
+// newSpoofingForwarder is not supported on this platform.
+func newSpoofingForwarder(_ *net.UDPAddr, _ uint8) (forwarder, error) {
+	return nil, errors.New("source spoofing is only supported on Linux")
+}
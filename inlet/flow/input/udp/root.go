@@ -10,15 +10,18 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
 	"time"
 
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input"
+	"akvorado/inlet/pipeline"
 )
 
 // Input represents the state of an UDP listener.
@@ -35,20 +38,30 @@ type Input struct {
 		outDrops      *reporter.CounterVec
 		inDrops       *reporter.GaugeVec
 		decodedFlows  *reporter.CounterVec
+		forwarded     *reporter.CounterVec
+		forwardErrors *reporter.CounterVec
+
+		decoderWorkers     *reporter.GaugeVec
+		decoderQueueLength *reporter.GaugeVec
+		decoderDrops       *reporter.CounterVec
 	}
 
+	drops   *pipeline.Drops
+	budget  *pipeline.Budget
 	address net.Addr                   // listening address, for testing purpoese
 	ch      chan []*schema.FlowMessage // channel to send flows to
 	decoder decoder.Decoder            // decoder to use
 }
 
 // New instantiate a new UDP listener from the provided configuration.
-func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder) (input.Input, error) {
+func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Component, dec decoder.Decoder, budget *pipeline.Budget) (input.Input, error) {
 	input := &Input{
 		r:       r,
 		config:  configuration,
 		ch:      make(chan []*schema.FlowMessage, configuration.QueueSize),
 		decoder: dec,
+		drops:   pipeline.NewDrops(r),
+		budget:  budget,
 	}
 
 	input.metrics.bytes = r.CounterVec(
@@ -102,6 +115,42 @@ func (configuration *Configuration) New(r *reporter.Reporter, daemon daemon.Comp
 		[]string{"listener", "worker", "exporter"},
 	)
 
+	input.metrics.forwarded = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "forwarded_packets_total",
+			Help: "Packets forwarded to other collectors.",
+		},
+		[]string{"listener", "worker", "destination"},
+	)
+	input.metrics.forwardErrors = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "forward_errors_total",
+			Help: "Errors while forwarding packets to other collectors.",
+		},
+		[]string{"listener", "worker", "destination"},
+	)
+	input.metrics.decoderWorkers = r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "decoder_workers",
+			Help: "Number of workers decoding packets.",
+		},
+		[]string{"listener", "decoder"},
+	)
+	input.metrics.decoderQueueLength = r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "decoder_queue_length",
+			Help: "Number of packets waiting for a decoder worker.",
+		},
+		[]string{"listener", "decoder"},
+	)
+	input.metrics.decoderDrops = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "decoder_dropped_packets_total",
+			Help: "Dropped packets due to decoder queue full.",
+		},
+		[]string{"listener", "worker", "exporter"},
+	)
+
 	daemon.Track(&input.t, "inlet/flow/input/udp")
 	return input, nil
 }
@@ -113,23 +162,32 @@ func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
 	// Listen to UDP port
 	conns := []*net.UDPConn{}
 	for i := 0; i < in.config.Workers; i++ {
-		var listenAddr net.Addr
-		if in.address != nil {
-			// We already are listening on one address, let's
-			// listen to the same (useful when using :0).
-			listenAddr = in.address
-		} else {
+		var udpConn *net.UDPConn
+		if strings.HasPrefix(in.config.Listen, daemon.ActivationPrefix) {
 			var err error
-			listenAddr, err = net.ResolveUDPAddr("udp", in.config.Listen)
+			udpConn, err = listenActivated(strings.TrimPrefix(in.config.Listen, daemon.ActivationPrefix), i)
 			if err != nil {
-				return nil, fmt.Errorf("unable to resolve %v: %w", in.config.Listen, err)
+				return nil, helpers.ConfigurationError(fmt.Errorf("unable to listen to %v: %w", in.config.Listen, err))
 			}
+		} else {
+			var listenAddr net.Addr
+			if in.address != nil {
+				// We already are listening on one address, let's
+				// listen to the same (useful when using :0).
+				listenAddr = in.address
+			} else {
+				var err error
+				listenAddr, err = net.ResolveUDPAddr("udp", in.config.Listen)
+				if err != nil {
+					return nil, helpers.ConfigurationError(fmt.Errorf("unable to resolve %v: %w", in.config.Listen, err))
+				}
+			}
+			pconn, err := listenConfig.ListenPacket(in.t.Context(context.Background()), "udp", listenAddr.String())
+			if err != nil {
+				return nil, helpers.ConfigurationError(fmt.Errorf("unable to listen to %v: %w", listenAddr, err))
+			}
+			udpConn = pconn.(*net.UDPConn)
 		}
-		pconn, err := listenConfig.ListenPacket(in.t.Context(context.Background()), "udp", listenAddr.String())
-		if err != nil {
-			return nil, fmt.Errorf("unable to listen to %v: %w", listenAddr, err)
-		}
-		udpConn := pconn.(*net.UDPConn)
 		in.address = udpConn.LocalAddr()
 		if i == 0 {
 			in.r.Info().Str("listen", in.address.String()).Msg("UDP input listening")
@@ -146,6 +204,37 @@ func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
 		conns = append(conns, udpConn)
 	}
 
+	// Sockets to forward packets to other collectors
+	forwarders := make([][]forwarder, in.config.Workers)
+	for _, destination := range in.config.ForwardTo {
+		destAddr, err := net.ResolveUDPAddr("udp", destination)
+		if err != nil {
+			closeAll(conns, forwarders)
+			return nil, fmt.Errorf("unable to resolve %v: %w", destination, err)
+		}
+		for i := 0; i < in.config.Workers; i++ {
+			fwd, err := newForwarder(destAddr, in.config.DSCP, in.config.ForwardSpoofSource)
+			if err != nil {
+				closeAll(conns, forwarders)
+				return nil, fmt.Errorf("unable to forward to %v: %w", destination, err)
+			}
+			forwarders[i] = append(forwarders[i], fwd)
+		}
+	}
+
+	// When there are dedicated decoder workers, receiving workers hand
+	// packets over to them through a channel.
+	var decodeCh chan rawPacket
+	decoderName := in.decoder.Name()
+	if in.config.DecoderWorkers > 0 {
+		decodeCh = make(chan rawPacket, in.config.DecoderQueueSize)
+		in.metrics.decoderWorkers.WithLabelValues(in.config.Listen, decoderName).
+			Set(float64(in.config.DecoderWorkers))
+	} else {
+		in.metrics.decoderWorkers.WithLabelValues(in.config.Listen, decoderName).
+			Set(float64(in.config.Workers))
+	}
+
 	for i := 0; i < in.config.Workers; i++ {
 		workerID := i
 		worker := strconv.Itoa(i)
@@ -158,7 +247,12 @@ func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
 				Str("listen", listen).
 				Logger()
 			errLogger := l.Sample(reporter.BurstSampler(time.Minute, 1))
+			var kernelDrops uint32
 			for count := 0; ; count++ {
+				// When the memory budget is exceeded, either wait
+				// (packets are then dropped by the kernel) or read
+				// the packet and drop it.
+				admitted := in.budget.Admit(in.t.Dying())
 				n, oobn, _, source, err := conns[workerID].ReadMsgUDP(payload, oob)
 				if err != nil {
 					if errors.Is(err, net.ErrClosed) {
@@ -168,11 +262,18 @@ func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
 					in.metrics.errors.WithLabelValues(listen, worker).Inc()
 					continue
 				}
+				if !admitted {
+					continue
+				}
 
 				oobMsg, err := parseSocketControlMessage(oob[:oobn])
 				if err != nil {
 					errLogger.Err(err).Msg("unable to decode UDP control message")
 				} else {
+					if oobMsg.Drops > kernelDrops {
+						in.drops.Add(pipeline.StageListener, int(oobMsg.Drops-kernelDrops))
+						kernelDrops = oobMsg.Drops
+					}
 					if count < 100 || count%100 == 0 {
 						in.metrics.inDrops.WithLabelValues(listen, worker).Set(
 							float64(oobMsg.Drops))
@@ -189,43 +290,125 @@ func (in *Input) Start() (<-chan []*schema.FlowMessage, error) {
 					Inc()
 				in.metrics.packetSizeSum.WithLabelValues(listen, worker, srcIP).
 					Observe(float64(n))
-				flows := in.decoder.Decode(decoder.RawFlow{
-					TimeReceived: oobMsg.Received,
-					Payload:      payload[:n],
-					Source:       source.IP,
-				})
-				if len(flows) == 0 {
+				for idx, fwd := range forwarders[workerID] {
+					destination := in.config.ForwardTo[idx]
+					if err := fwd.Forward(payload[:n], source); err != nil {
+						errLogger.Err(err).Str("destination", destination).Msg("unable to forward UDP packet")
+						in.metrics.forwardErrors.WithLabelValues(listen, worker, destination).Inc()
+						continue
+					}
+					in.metrics.forwarded.WithLabelValues(listen, worker, destination).Inc()
+				}
+				packet := rawPacket{
+					RawFlow: decoder.RawFlow{
+						TimeReceived: oobMsg.Received,
+						Payload:      payload[:n],
+						Source:       source.IP,
+					},
+					worker: worker,
+					srcIP:  srcIP,
+				}
+				if decodeCh == nil {
+					if !in.decode(packet, errLogger) {
+						return nil
+					}
 					continue
 				}
+				// Decoder workers need their own copy of the payload.
+				packet.Payload = append([]byte(nil), packet.Payload...)
+				in.budget.Reserve(cap(packet.Payload))
 				select {
-				case <-in.t.Dying():
-					return nil
-				case in.ch <- flows:
-					in.metrics.decodedFlows.WithLabelValues(listen, worker, srcIP).
-						Add(float64(len((flows))))
+				case decodeCh <- packet:
 				default:
-					errLogger.Warn().Msgf("dropping flow due to queue full (size %d)",
-						in.config.QueueSize)
-					in.metrics.outDrops.WithLabelValues(listen, worker, srcIP).
+					in.budget.Release(cap(packet.Payload))
+					errLogger.Warn().Msgf("dropping packet due to decoder queue full (size %d)",
+						in.config.DecoderQueueSize)
+					in.metrics.decoderDrops.WithLabelValues(listen, worker, srcIP).
 						Inc()
+					in.drops.Add(pipeline.StageListener, 1)
+				}
+				if count < 100 || count%100 == 0 {
+					in.metrics.decoderQueueLength.WithLabelValues(listen, decoderName).
+						Set(float64(len(decodeCh)))
 				}
 			}
 		})
 
 	}
 
+	for i := 0; i < in.config.DecoderWorkers; i++ {
+		in.t.Go(func() error {
+			errLogger := in.r.With().
+				Str("listen", in.config.Listen).
+				Logger().
+				Sample(reporter.BurstSampler(time.Minute, 1))
+			for {
+				select {
+				case <-in.t.Dying():
+					return nil
+				case packet := <-decodeCh:
+					in.budget.Release(cap(packet.Payload))
+					if !in.decode(packet, errLogger) {
+						return nil
+					}
+				}
+			}
+		})
+	}
+
 	// Watch for termination and close on dying
 	in.t.Go(func() error {
 		<-in.t.Dying()
-		for _, conn := range conns {
-			conn.Close()
-		}
+		closeAll(conns, forwarders)
 		return nil
 	})
 
 	return in.ch, nil
 }
 
+// rawPacket is a received packet waiting to be decoded.
+type rawPacket struct {
+	decoder.RawFlow
+	worker string
+	srcIP  string
+}
+
+// decode decodes a packet and sends the resulting flows to the output
+// channel. It returns false if the input is stopping.
+func (in *Input) decode(packet rawPacket, errLogger reporter.Logger) bool {
+	flows := in.decoder.Decode(packet.RawFlow)
+	if len(flows) == 0 {
+		return true
+	}
+	listen := in.config.Listen
+	select {
+	case <-in.t.Dying():
+		return false
+	case in.ch <- flows:
+		in.metrics.decodedFlows.WithLabelValues(listen, packet.worker, packet.srcIP).
+			Add(float64(len((flows))))
+	default:
+		errLogger.Warn().Msgf("dropping flow due to queue full (size %d)",
+			in.config.QueueSize)
+		in.metrics.outDrops.WithLabelValues(listen, packet.worker, packet.srcIP).
+			Inc()
+		in.drops.Add(pipeline.StageListener, len(flows))
+	}
+	return true
+}
+
+// closeAll closes the listening and forwarding sockets.
+func closeAll(conns []*net.UDPConn, forwarders [][]forwarder) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+	for _, workerForwarders := range forwarders {
+		for _, fwd := range workerForwarders {
+			fwd.Close()
+		}
+	}
+}
+
 // Stop stops the UDP listeners
 func (in *Input) Stop() error {
 	l := in.r.With().Str("listen", in.config.Listen).Logger()
@@ -4,8 +4,10 @@
 package udp
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
+	"sort"
 	"testing"
 	"time"
 
@@ -20,7 +22,7 @@ func TestUDPInput(t *testing.T) {
 	r := reporter.NewMock(t)
 	configuration := DefaultConfiguration().(*Configuration)
 	configuration.Listen = "127.0.0.1:0"
-	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)})
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
 	if err != nil {
 		t.Fatalf("New() error:\n%+v", err)
 	}
@@ -81,6 +83,7 @@ func TestUDPInput(t *testing.T) {
 		`bytes_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                        "12",
 		`decoded_flows_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                "1",
 		`packets_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                      "1",
+		`decoder_workers{decoder="dummy",listener="127.0.0.1:0"}`:                                    "1",
 		`in_dropped_packets_total{listener="127.0.0.1:0",worker="0"}`:                                "0",
 		`summary_size_bytes_count{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:           "1",
 		`summary_size_bytes_sum{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:             "12",
@@ -100,7 +103,7 @@ func TestOverflow(t *testing.T) {
 	configuration.QueueSize = 1
 	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{
 		Schema: schema.NewMock(t),
-	})
+	}, nil)
 	if err != nil {
 		t.Fatalf("New() error:\n%+v", err)
 	}
@@ -133,6 +136,7 @@ func TestOverflow(t *testing.T) {
 	expectedMetrics := map[string]string{
 		`bytes_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                        "120",
 		`decoded_flows_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                "1",
+		`decoder_workers{decoder="dummy",listener="127.0.0.1:0"}`:                                    "1",
 		`in_dropped_packets_total{listener="127.0.0.1:0",worker="0"}`:                                "0",
 		`out_dropped_packets_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:          "9",
 		`packets_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`:                      "10",
@@ -145,4 +149,245 @@ func TestOverflow(t *testing.T) {
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Input metrics (-got, +want):\n%s", diff)
 	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_pipeline_", "dropped_flows_total{stage=\"listener\"}")
+	expectedMetrics = map[string]string{
+		`dropped_flows_total{stage="listener"}`: "9",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Pipeline metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestForward(t *testing.T) {
+	// Legacy collector
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("ListenUDP() error:\n%+v", err)
+	}
+	defer collector.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Listen = "127.0.0.1:0"
+	configuration.ForwardTo = []string{collector.LocalAddr().String()}
+	if err := helpers.Validate.Struct(configuration); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	conn, err := net.Dial("udp", in.(*Input).address.String())
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	if _, err := conn.Write([]byte("hello world!")); err != nil {
+		t.Fatalf("Write() error:\n%+v", err)
+	}
+
+	// The packet is forwarded as is
+	payload := make([]byte, 100)
+	collector.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := collector.Read(payload)
+	if err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(string(payload[:n]), "hello world!"); diff != "" {
+		t.Fatalf("Forwarded payload (-got, +want):\n%s", diff)
+	}
+
+	// And it is still decoded
+	select {
+	case got := <-ch:
+		if len(got) == 0 {
+			t.Fatalf("empty decoded flows received")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no decoded flows received")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_udp_forward")
+	expectedMetrics := map[string]string{
+		fmt.Sprintf(`ed_packets_total{destination="%s",listener="127.0.0.1:0",worker="0"}`,
+			collector.LocalAddr()): "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Input metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestForwardSpoofSource(t *testing.T) {
+	// Legacy collector
+	collector, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("ListenUDP() error:\n%+v", err)
+	}
+	defer collector.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Listen = "127.0.0.1:0"
+	configuration.ForwardTo = []string{collector.LocalAddr().String()}
+	configuration.ForwardSpoofSource = true
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, err := in.Start(); err != nil {
+		t.Skipf("Start() error (missing CAP_NET_RAW?):\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	conn, err := net.Dial("udp", in.(*Input).address.String())
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	if _, err := conn.Write([]byte("hello world!")); err != nil {
+		t.Fatalf("Write() error:\n%+v", err)
+	}
+
+	// The packet is forwarded as is, from the original source
+	payload := make([]byte, 100)
+	collector.SetReadDeadline(time.Now().Add(time.Second))
+	n, source, err := collector.ReadFromUDP(payload)
+	if err != nil {
+		t.Fatalf("ReadFromUDP() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(string(payload[:n]), "hello world!"); diff != "" {
+		t.Fatalf("Forwarded payload (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(source.String(), conn.LocalAddr().String()); diff != "" {
+		t.Fatalf("Forwarded source (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDecoderWorkers(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Listen = "127.0.0.1:0"
+	configuration.DecoderWorkers = 2
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+
+	conn, err := net.Dial("udp", in.(*Input).address.String())
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	payloads := []string{"hello world!", "hello again!"}
+	for _, payload := range payloads {
+		if _, err := conn.Write([]byte(payload)); err != nil {
+			t.Fatalf("Write() error:\n%+v", err)
+		}
+	}
+
+	// Decoding order is not guaranteed
+	got := []string{}
+	for range payloads {
+		select {
+		case flows := <-ch:
+			got = append(got, string(flows[0].ProtobufDebug[schema.ColumnInIfDescription].([]byte)))
+		case <-time.After(time.Second):
+			t.Fatal("no decoded flows received")
+		}
+	}
+	sort.Strings(got)
+	if diff := helpers.Diff(got, []string{"hello again!", "hello world!"}); diff != "" {
+		t.Fatalf("Decoded payloads (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_input_udp_", "decoded_", "decoder_workers")
+	expectedMetrics := map[string]string{
+		`decoded_flows_total{exporter="127.0.0.1",listener="127.0.0.1:0",worker="0"}`: "2",
+		`decoder_workers{decoder="dummy",listener="127.0.0.1:0"}`:                     "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Input metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestSystemdActivation(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error:\n%+v", err)
+	}
+	defer conn.Close()
+	file, err := conn.File()
+	if err != nil {
+		t.Fatalf("File() error:\n%+v", err)
+	}
+	defer file.Close()
+	daemon.MockActivatedFiles(t, "netflow", file)
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(*Configuration)
+	configuration.Listen = "systemd:netflow"
+	configuration.Workers = 2
+	in, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	ch, err := in.Start()
+	if err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+	defer func() {
+		if err := in.Stop(); err != nil {
+			t.Fatalf("Stop() error:\n%+v", err)
+		}
+	}()
+	if diff := helpers.Diff(in.(*Input).address.String(), conn.LocalAddr().String()); diff != "" {
+		t.Fatalf("address (-got, +want):\n%s", diff)
+	}
+
+	// Send data to the socket passed by systemd
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	if _, err := client.Write([]byte("hello world!")); err != nil {
+		t.Fatalf("Write() error:\n%+v", err)
+	}
+	select {
+	case got := <-ch:
+		if len(got) == 0 {
+			t.Fatalf("empty decoded flows received")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no decoded flows received")
+	}
+
+	// Unknown socket
+	configuration.Listen = "systemd:unknown"
+	in2, err := configuration.New(r, daemon.NewMock(t), &decoder.DummyDecoder{Schema: schema.NewMock(t)}, nil)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, err := in2.Start(); err == nil {
+		t.Fatal("Start() did not error")
+	}
 }
@@ -4,11 +4,15 @@
 package udp
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"syscall"
 	"time"
 
 	"golang.org/x/sys/unix"
+
+	"akvorado/common/daemon"
 )
 
 type oobMessage struct {
@@ -32,3 +36,51 @@ var listenConfig = net.ListenConfig{
 		return err
 	},
 }
+
+// listenActivated returns a connection for a socket passed by systemd with the
+// provided name. When several sockets share this name, workers are spread over
+// them. The socket is configured like the ones created with listenConfig.
+func listenActivated(name string, worker int) (*net.UDPConn, error) {
+	files := daemon.ActivatedFiles(name)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no socket %q passed by systemd", name)
+	}
+	pconn, err := net.FilePacketConn(files[worker%len(files)])
+	if err != nil {
+		return nil, err
+	}
+	udpConn, ok := pconn.(*net.UDPConn)
+	if !ok {
+		pconn.Close()
+		return nil, errors.New("socket passed by systemd is not an UDP socket")
+	}
+	rawConn, err := udpConn.SyscallConn()
+	if err == nil {
+		err = listenConfig.Control("udp", udpConn.LocalAddr().String(), rawConn)
+	}
+	if err != nil {
+		udpConn.Close()
+		return nil, fmt.Errorf("unable to configure socket: %w", err)
+	}
+	return udpConn, nil
+}
+
+// dialConfig returns a dialer setting the provided DSCP value on the socket.
+func dialConfig(dscp uint8) net.Dialer {
+	return net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			if dscp == 0 {
+				return nil
+			}
+			var err error
+			c.Control(func(fd uintptr) {
+				if network == "udp6" {
+					err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, int(dscp)<<2)
+				} else {
+					err = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, int(dscp)<<2)
+				}
+			})
+			return err
+		},
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"runtime"
 	"testing"
 	"time"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestParseSocketControlMessage(t *testing.T) {
@@ -74,3 +76,26 @@ outer:
 		t.Fatal("no drops detected")
 	}
 }
+
+func TestDialConfigDSCP(t *testing.T) {
+	dialer := dialConfig(46)
+	conn, err := dialer.Dial("udp", "127.0.0.1:9")
+	if err != nil {
+		t.Fatalf("Dial() error:\n%+v", err)
+	}
+	defer conn.Close()
+	rawConn, err := conn.(*net.UDPConn).SyscallConn()
+	if err != nil {
+		t.Fatalf("SyscallConn() error:\n%+v", err)
+	}
+	var tos int
+	rawConn.Control(func(fd uintptr) {
+		tos, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS)
+	})
+	if err != nil {
+		t.Fatalf("GetsockoptInt() error:\n%+v", err)
+	}
+	if tos != 46<<2 {
+		t.Fatalf("GetsockoptInt() == %d, expected %d", tos, 46<<2)
+	}
+}
@@ -0,0 +1,156 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// ExporterEvent is emitted when an exporter which previously sent flows goes
+// silent, or when it sends flows again.
+type ExporterEvent struct {
+	Type     string     `json:"type"` // exporter-silent or exporter-alive
+	Exporter netip.Addr `json:"exporter"`
+	LastSeen time.Time  `json:"last-seen"`
+}
+
+// exporterLiveness is the liveness state of an exporter.
+type exporterLiveness struct {
+	lastSeen time.Time
+	silent   bool
+}
+
+// ExporterEvents returns a channel to receive exporter liveness events. Events
+// are dropped when they are not consumed fast enough.
+func (c *Component) ExporterEvents() <-chan ExporterEvent {
+	return c.outgoingExporterEvents
+}
+
+// recordLiveness records the reception of flows from the provided exporter.
+func (c *Component) recordLiveness(exporter netip.Addr, now time.Time) {
+	if !exporter.IsValid() {
+		return
+	}
+	exporter = exporter.Unmap()
+	c.livenessLock.Lock()
+	defer c.livenessLock.Unlock()
+	state, ok := c.liveness[exporter]
+	if !ok {
+		c.liveness[exporter] = &exporterLiveness{lastSeen: now}
+		return
+	}
+	if state.silent {
+		state.silent = false
+		c.queueExporterEvent(ExporterEvent{
+			Type:     "exporter-alive",
+			Exporter: exporter,
+			LastSeen: now,
+		})
+	}
+	state.lastSeen = now
+}
+
+// checkLiveness emits an event for each exporter which did not send flows
+// since the configured timeout.
+func (c *Component) checkLiveness(now time.Time) {
+	c.livenessLock.Lock()
+	defer c.livenessLock.Unlock()
+	silent := 0
+	for exporter, state := range c.liveness {
+		if !state.silent && now.Sub(state.lastSeen) >= c.config.SilentExporterTimeout {
+			state.silent = true
+			c.queueExporterEvent(ExporterEvent{
+				Type:     "exporter-silent",
+				Exporter: exporter,
+				LastSeen: state.lastSeen,
+			})
+		}
+		if state.silent {
+			silent++
+		}
+	}
+	c.metrics.silentExporters.Set(float64(silent))
+}
+
+// queueExporterEvent queues an exporter event. It should be called while
+// holding the liveness lock.
+func (c *Component) queueExporterEvent(event ExporterEvent) {
+	exporter := event.Exporter.String()
+	if event.Type == "exporter-silent" {
+		c.r.Warn().
+			Str("exporter", exporter).
+			Time("last-seen", event.LastSeen).
+			Msg("exporter is silent")
+	} else {
+		c.r.Info().Str("exporter", exporter).Msg("exporter is alive again")
+	}
+	c.metrics.exporterEvents.WithLabelValues(event.Type).Inc()
+	select {
+	case c.exporterEvents <- event:
+	default:
+		c.metrics.exporterEventsDropped.Inc()
+	}
+}
+
+// runLiveness periodically checks the liveness of exporters and dispatches
+// the resulting events.
+func (c *Component) runLiveness() error {
+	ticker := time.NewTicker(max(c.config.SilentExporterTimeout/10, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case now := <-ticker.C:
+			c.checkLiveness(now)
+		case event := <-c.exporterEvents:
+			if c.config.SilentExporterWebhook != "" {
+				if err := c.postExporterEvent(event); err != nil {
+					c.r.Err(err).
+						Str("exporter", event.Exporter.String()).
+						Msg("cannot send exporter event to webhook")
+					c.metrics.exporterEventsErrors.Inc()
+				}
+			}
+			select {
+			case c.outgoingExporterEvents <- event:
+			default:
+				c.metrics.exporterEventsDropped.Inc()
+			}
+		}
+	}
+}
+
+// postExporterEvent sends an exporter event to the configured webhook.
+func (c *Component) postExporterEvent(event ExporterEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		c.config.SilentExporterWebhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
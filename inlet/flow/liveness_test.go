@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestLiveness(t *testing.T) {
+	received := make(chan ExporterEvent, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event ExporterEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Inputs = nil
+	config.SilentExporterTimeout = time.Hour // checks are triggered manually
+	config.SilentExporterWebhook = server.URL
+	c := NewMock(t, r, config)
+
+	exporter1 := netip.MustParseAddr("::ffff:192.0.2.142")
+	exporter2 := netip.MustParseAddr("2001:db8::1")
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	c.recordLiveness(exporter1, now)
+	c.recordLiveness(exporter2, now)
+	c.recordLiveness(exporter2, now.Add(50*time.Minute))
+	c.checkLiveness(now.Add(30 * time.Minute))
+	c.checkLiveness(now.Add(70 * time.Minute))
+	c.checkLiveness(now.Add(80 * time.Minute))
+	c.recordLiveness(exporter1, now.Add(90*time.Minute))
+
+	expected := []ExporterEvent{
+		{
+			Type:     "exporter-silent",
+			Exporter: netip.MustParseAddr("192.0.2.142"),
+			LastSeen: now,
+		}, {
+			Type:     "exporter-alive",
+			Exporter: netip.MustParseAddr("192.0.2.142"),
+			LastSeen: now.Add(90 * time.Minute),
+		},
+	}
+	for _, source := range []struct {
+		name   string
+		events <-chan ExporterEvent
+	}{
+		{"webhook", received},
+		{"channel", c.ExporterEvents()},
+	} {
+		got := []ExporterEvent{}
+		for range expected {
+			select {
+			case event := <-source.events:
+				got = append(got, event)
+			case <-time.After(time.Second):
+				t.Fatalf("%s: event not received", source.name)
+			}
+		}
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("%s: events (-got, +want):\n%s", source.name, diff)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_flow_", "silent_", "exporter_events_")
+	expectedMetrics := map[string]string{
+		`silent_exporters`: "1",
+		`exporter_events_total{type="exporter-alive"}`:  "1",
+		`exporter_events_total{type="exporter-silent"}`: "1",
+		`exporter_events_dropped_total`:                 "0",
+		`exporter_events_errors_total`:                  "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package flow
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+
+	"akvorado/common/persist"
+	"akvorado/inlet/flow/decoder"
+)
+
+// saveDecoders persists the state of the decoders supporting it to the
+// provided stores.
+func (c *Component) saveDecoders(ctx context.Context, stores []persist.Store) error {
+	states := map[string][]byte{}
+	for _, dec := range c.decoders {
+		persister, ok := dec.(decoder.Persister)
+		if !ok {
+			continue
+		}
+		state, err := persister.Save()
+		if err != nil {
+			return fmt.Errorf("unable to save state of %s decoder: %w", dec.Name(), err)
+		}
+		states[dec.Name()] = state
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(states); err != nil {
+		return fmt.Errorf("unable to encode templates: %w", err)
+	}
+	return persist.Save(ctx, stores, buf.Bytes())
+}
+
+// loadDecoders restores the state of the decoders from the first provided
+// store with a saved state.
+func (c *Component) loadDecoders(ctx context.Context, stores []persist.Store) error {
+	saved, err := persist.Load(ctx, stores)
+	if err != nil {
+		return err
+	}
+	states := map[string][]byte{}
+	if err := gob.NewDecoder(bytes.NewReader(saved)).Decode(&states); err != nil {
+		return fmt.Errorf("unable to decode templates: %w", err)
+	}
+	for _, dec := range c.decoders {
+		persister, ok := dec.(decoder.Persister)
+		if !ok {
+			continue
+		}
+		state, ok := states[dec.Name()]
+		if !ok {
+			continue
+		}
+		if err := persister.Load(state); err != nil {
+			return fmt.Errorf("unable to restore state of %s decoder: %w", dec.Name(), err)
+		}
+	}
+	return nil
+}
@@ -7,31 +7,40 @@ import (
 	"time"
 
 	"akvorado/common/schema"
+	"akvorado/inlet/pipeline"
 
 	"golang.org/x/time/rate"
 )
 
 type limiter struct {
-	l           *rate.Limiter
-	dropped     uint64  // dropped during the current second
-	total       uint64  // total during the current second
-	dropRate    float64 // drop rate during the last second
+	flows       *rate.Limiter // nil when flows are not limited
+	packets     *rate.Limiter // nil when packets are not limited
+	dropped     uint64        // dropped during the current second
+	total       uint64        // total during the current second
+	dropRate    float64       // drop rate during the last second
 	currentTick time.Time
 }
 
 // allowMessages tell if we can transmit the provided messages,
 // depending on the rate limiter configuration. If yes, their sampling
-// rate may be modified to match current drop rate.
+// rate may be modified to match current drop rate. The messages are
+// expected to come from the same packet.
 func (c *Component) allowMessages(fmsgs []*schema.FlowMessage) bool {
 	count := len(fmsgs)
-	if c.config.RateLimit == 0 || count == 0 {
+	if (c.config.RateLimit == 0 && c.config.PacketRateLimit == 0) || count == 0 {
 		return true
 	}
 	exporter := fmsgs[0].ExporterAddress
+	c.limitersLock.Lock()
+	defer c.limitersLock.Unlock()
 	exporterLimiter, ok := c.limiters[exporter]
 	if !ok {
-		exporterLimiter = &limiter{
-			l: rate.NewLimiter(rate.Limit(c.config.RateLimit), int(c.config.RateLimit/10)),
+		exporterLimiter = &limiter{}
+		if c.config.RateLimit > 0 {
+			exporterLimiter.flows = rate.NewLimiter(c.config.RateLimit, int(c.config.RateLimit/10))
+		}
+		if c.config.PacketRateLimit > 0 {
+			exporterLimiter.packets = rate.NewLimiter(c.config.PacketRateLimit, int(c.config.PacketRateLimit/10))
 		}
 		c.limiters[exporter] = exporterLimiter
 	}
@@ -44,11 +53,19 @@ func (c *Component) allowMessages(fmsgs []*schema.FlowMessage) bool {
 		exporterLimiter.currentTick = tick
 	}
 	exporterLimiter.total += uint64(count)
-	if !exporterLimiter.l.AllowN(now, count) {
+	var limit string
+	if exporterLimiter.packets != nil && !exporterLimiter.packets.AllowN(now, 1) {
+		limit = "packets"
+	} else if exporterLimiter.flows != nil && !exporterLimiter.flows.AllowN(now, count) {
+		limit = "flows"
+	}
+	if limit != "" {
 		exporterLimiter.dropped += uint64(count)
+		c.drops.Add(pipeline.StageRateLimit, count)
+		c.metrics.rateLimitDrops.WithLabelValues(exporter.Unmap().String(), limit).Add(float64(count))
 		return false
 	}
-	if exporterLimiter.dropRate > 0 {
+	if exporterLimiter.dropRate > 0 && c.config.RateLimitPolicy == RateLimitSample {
 		for _, flow := range fmsgs {
 			flow.SamplingRate *= uint32(1 / (1 - exporterLimiter.dropRate))
 		}
@@ -5,19 +5,29 @@
 package flow
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/go-redis/redis/v8"
+	"golang.org/x/exp/slices"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
 	"akvorado/common/httpserver"
+	"akvorado/common/persist"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input"
+	"akvorado/inlet/flow/input/udp"
+	"akvorado/inlet/pipeline"
 )
 
 // Component represents the flow component.
@@ -30,16 +40,54 @@ type Component struct {
 	metrics struct {
 		decoderStats  *reporter.CounterVec
 		decoderErrors *reporter.CounterVec
+		decoderTime   *reporter.HistogramVec
+
+		decoderAnomalies *reporter.CounterVec
+
+		rateLimitDrops *reporter.CounterVec
+
+		silentExporters       reporter.Gauge
+		exporterEvents        *reporter.CounterVec
+		exporterEventsDropped reporter.Counter
+		exporterEventsErrors  reporter.Counter
+
+		inconsistentInterfaces   reporter.Gauge
+		consistencyDiscrepancies *reporter.CounterVec
 	}
+	slowDecodeLogger reporter.Logger
+	drops            *pipeline.Drops
+	budget           *pipeline.Budget
 
 	// Channel for sending flows out of the package.
 	outgoingFlows chan *schema.FlowMessage
 
 	// Per-exporter rate-limiters
-	limiters map[netip.Addr]*limiter
+	limiters     map[netip.Addr]*limiter
+	limitersLock sync.Mutex
+
+	// Per-exporter liveness
+	liveness               map[netip.Addr]*exporterLiveness
+	livenessLock           sync.Mutex
+	exporterEvents         chan ExporterEvent
+	outgoingExporterEvents chan ExporterEvent
+
+	// Per-interface volumes and counters for consistency checks
+	volumes          map[interfaceKey]interfaceVolume
+	volumesStart     time.Time
+	volumesLock      sync.Mutex
+	previousCounters map[interfaceKey]decoder.InterfaceCounters
+	consistency      []InterfaceConsistency
+	consistencyLock  sync.Mutex
 
-	// Inputs
-	inputs []input.Input
+	// Inputs and decoders
+	inputs   []input.Input
+	channels []<-chan []*schema.FlowMessage // returned by inputs
+	decoders []decoder.Decoder
+	redis    *redis.Client   // nil when Redis is not used
+	stores   []persist.Store // where to persist the state of decoders
+
+	// Last time flows were received (Unix nanoseconds)
+	lastReceived atomic.Int64
 }
 
 // Dependencies are the dependencies of the flow component.
@@ -62,6 +110,38 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		outgoingFlows: make(chan *schema.FlowMessage),
 		limiters:      make(map[netip.Addr]*limiter),
 		inputs:        make([]input.Input, len(configuration.Inputs)),
+
+		liveness:               make(map[netip.Addr]*exporterLiveness),
+		exporterEvents:         make(chan ExporterEvent, 100),
+		outgoingExporterEvents: make(chan ExporterEvent, 100),
+
+		volumes:          map[interfaceKey]interfaceVolume{},
+		previousCounters: map[interfaceKey]decoder.InterfaceCounters{},
+		consistency:      []InterfaceConsistency{},
+
+		slowDecodeLogger: r.Sample(reporter.BurstSampler(time.Minute, 10)),
+		drops:            pipeline.NewDrops(r),
+		budget: pipeline.NewBudget(r, configuration.MemoryBudget,
+			configuration.MemoryBudgetPolicy == MemoryBudgetPause),
+	}
+
+	// Check vendor elements target a column that can be decoded from a flow
+	for subnet, elements := range configuration.VendorElements.ToMap() {
+		for _, element := range elements {
+			if !vendorElementColumn(dependencies.Schema, element.Column) {
+				return nil, fmt.Errorf("vendor element %d/%d for %s cannot be stored in column %s",
+					element.Enterprise, element.Element, subnet, element.Column)
+			}
+		}
+	}
+
+	// Check flows are not forwarded in privacy mode
+	if dependencies.Schema.Privacy() {
+		for _, input := range configuration.Inputs {
+			if udpConfig, ok := input.Config.(*udp.Configuration); ok && len(udpConfig.ForwardTo) > 0 {
+				return nil, errors.New("flows cannot be forwarded in privacy mode")
+			}
+		}
 	}
 
 	// Initialize decoders (at most once each)
@@ -73,19 +153,27 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 			decs[idx] = dec
 			continue
 		}
-		decoderfunc, ok := decoders[input.Decoder]
+		decoderfunc, ok := decoder.Lookup(input.Decoder)
 		if !ok {
-			return nil, fmt.Errorf("unknown decoder %q", input.Decoder)
+			return nil, fmt.Errorf("unknown decoder %q (available: %s)",
+				input.Decoder, strings.Join(decoder.Names(), ", "))
 		}
-		dec = decoderfunc(r, decoder.Dependencies{Schema: c.d.Schema})
+		dec = decoderfunc(r, decoder.Dependencies{Schema: c.d.Schema}, decoder.Option{
+			VendorElements:    c.config.VendorElements,
+			SamplingRates:     c.config.SamplingRates,
+			Quirks:            c.config.Quirks,
+			HeaderDepth:       c.config.HeaderDepth,
+			LateFlowThreshold: c.config.LateFlowThreshold,
+		})
 		alreadyInitialized[input.Decoder] = dec
-		decs[idx] = c.wrapDecoder(dec, input.UseSrcAddrForExporterAddr)
+		c.decoders = append(c.decoders, dec)
+		decs[idx] = c.wrapDecoder(dec, input)
 	}
 
 	// Initialize inputs
 	for idx, input := range c.config.Inputs {
 		var err error
-		c.inputs[idx], err = input.Config.New(r, c.d.Daemon, decs[idx])
+		c.inputs[idx], err = input.Config.New(r, c.d.Daemon, decs[idx], c.budget)
 		if err != nil {
 			return nil, err
 		}
@@ -106,14 +194,79 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		},
 		[]string{"name"},
 	)
+	c.metrics.decoderTime = c.r.HistogramVec(
+		reporter.HistogramOpts{
+			Name:    "decoder_time_seconds",
+			Help:    "Time to decode a packet.",
+			Buckets: []float64{5e-6, 10e-6, 25e-6, 50e-6, 100e-6, 250e-6, 500e-6, 1e-3, 5e-3, 10e-3},
+		},
+		[]string{"name"},
+	)
+	c.metrics.decoderAnomalies = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "decoder_anomalies_total",
+			Help: "Number of decoded flows dropped due to anomalous counters.",
+		},
+		[]string{"name", "reason"},
+	)
+	c.metrics.rateLimitDrops = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "rate_limit_dropped_flows_total",
+			Help: "Number of flows dropped by the rate limiter.",
+		},
+		[]string{"exporter", "limit"},
+	)
+	c.metrics.silentExporters = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "silent_exporters",
+			Help: "Number of exporters which stopped sending flows.",
+		},
+	)
+	c.metrics.exporterEvents = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "exporter_events_total",
+			Help: "Number of exporter liveness events.",
+		},
+		[]string{"type"},
+	)
+	c.metrics.exporterEventsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "exporter_events_dropped_total",
+			Help: "Number of exporter liveness events dropped because the queue is full.",
+		},
+	)
+	c.metrics.exporterEventsErrors = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "exporter_events_errors_total",
+			Help: "Number of exporter liveness events which could not be sent to the webhook.",
+		},
+	)
+	c.metrics.inconsistentInterfaces = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "inconsistent_interfaces",
+			Help: "Number of interfaces whose counters do not match the volume derived from flows.",
+		},
+	)
+	c.metrics.consistencyDiscrepancies = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "consistency_discrepancies_total",
+			Help: "Number of discrepancies between interface counters and flows.",
+		},
+		[]string{"exporter"},
+	)
 
 	c.d.Daemon.Track(&c.t, "inlet/flow")
+	if c.config.Redis.Server != "" {
+		c.redis = c.config.Redis.NewClient()
+	}
+	c.stores = persist.NewStores(c.config.TemplatesPersistFile, c.redis, c.config.TemplatesPersistRedis)
 
 	c.d.HTTP.AddHandler("/api/v0/inlet/flow/schema.proto",
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Header().Set("Content-Type", "text/plain")
 			w.Write([]byte(c.d.Schema.ProtobufDefinition()))
 		}))
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/flow/consistency", c.consistencyHandlerFunc)
 
 	return &c, nil
 }
@@ -123,14 +276,50 @@ func (c *Component) Flows() <-chan *schema.FlowMessage {
 	return c.outgoingFlows
 }
 
+// ResetExporter clears the state kept by decoders (templates, sampling rates)
+// for the provided exporter. It returns true if some state was cleared.
+func (c *Component) ResetExporter(exporter netip.Addr) bool {
+	reset := false
+	for _, dec := range c.decoders {
+		if dec.Reset(exporter) {
+			reset = true
+		}
+	}
+	return reset
+}
+
+// ExporterStatistics returns the statistics about the export process announced
+// by the provided exporter.
+func (c *Component) ExporterStatistics(exporter netip.Addr) map[string]uint64 {
+	statistics := map[string]uint64{}
+	for _, dec := range c.decoders {
+		provider, ok := dec.(decoder.StatisticsProvider)
+		if !ok {
+			continue
+		}
+		for name, value := range provider.Statistics(exporter) {
+			statistics[name] = value
+		}
+	}
+	return statistics
+}
+
 // Start starts the flow component.
 func (c *Component) Start() error {
+	if len(c.stores) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), persist.Timeout)
+		if err := c.loadDecoders(ctx, c.stores); err != nil && !errors.Is(err, persist.ErrNotFound) {
+			c.r.Err(err).Msg("cannot load templates, ignoring")
+		}
+		cancel()
+	}
 	for _, input := range c.inputs {
 		ch, err := input.Start()
 		stopper := input.Stop
 		if err != nil {
 			return err
 		}
+		c.channels = append(c.channels, ch)
 		c.t.Go(func() error {
 			defer stopper()
 			for {
@@ -138,7 +327,16 @@ func (c *Component) Start() error {
 				case <-c.t.Dying():
 					return nil
 				case fmsgs := <-ch:
+					if len(fmsgs) > 0 {
+						c.lastReceived.Store(time.Now().UnixNano())
+					}
+					if c.config.SilentExporterTimeout > 0 && len(fmsgs) > 0 {
+						c.recordLiveness(fmsgs[0].ExporterAddress, time.Now())
+					}
 					if c.allowMessages(fmsgs) {
+						if c.config.ConsistencyCheckInterval > 0 {
+							c.recordVolumes(fmsgs)
+						}
 						for _, fmsg := range fmsgs {
 							select {
 							case <-c.t.Dying():
@@ -151,6 +349,23 @@ func (c *Component) Start() error {
 			}
 		})
 	}
+	if c.config.SilentExporterTimeout > 0 {
+		c.t.Go(c.runLiveness)
+	}
+	if c.config.ConsistencyCheckInterval > 0 {
+		c.volumesLock.Lock()
+		c.volumesStart = time.Now()
+		c.volumesLock.Unlock()
+		c.t.Go(c.runConsistency)
+	}
+	c.r.RegisterReadinessCheck("flow", c.receivingFlowsHealthcheck)
+	c.r.RegisterReadinessCheck("flow/backlog", c.backlogHealthcheck)
+	if c.budget != nil {
+		c.t.Go(func() error {
+			c.budget.Run(c.t.Dying())
+			return nil
+		})
+	}
 	return nil
 }
 
@@ -158,9 +373,103 @@ func (c *Component) Start() error {
 func (c *Component) Stop() error {
 	defer func() {
 		close(c.outgoingFlows)
+		if len(c.stores) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), persist.Timeout)
+			if err := c.saveDecoders(ctx, c.stores); err != nil {
+				c.r.Err(err).Msg("cannot save templates")
+			}
+			cancel()
+			for _, store := range c.stores {
+				store.Close()
+			}
+		}
+		if c.redis != nil {
+			c.redis.Close()
+		}
 		c.r.Info().Msg("flow component stopped")
 	}()
 	c.r.Info().Msg("stopping flow component")
 	c.t.Kill(nil)
 	return c.t.Wait()
 }
+
+// receivingFlowsTimeout is the duration without any flow after which the flow
+// component is not considered as receiving flows anymore.
+const receivingFlowsTimeout = time.Minute
+
+// receivingFlowsHealthcheck checks if flows were received recently. This is
+// only a warning as an inlet without flows may still be able to receive
+// them.
+func (c *Component) receivingFlowsHealthcheck(_ context.Context) reporter.HealthcheckResult {
+	last := c.lastReceived.Load()
+	if last == 0 {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "no flow received yet"}
+	}
+	since := time.Since(time.Unix(0, last)).Truncate(time.Second)
+	if since > receivingFlowsTimeout {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: fmt.Sprintf("no flow received for %s", since),
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "receiving flows"}
+}
+
+// backlogHealthcheck checks the queues between inputs and the flow component
+// are not almost full and the memory budget is not exceeded. When failing,
+// the inlet is not able to keep up with the incoming flows.
+func (c *Component) backlogHealthcheck(_ context.Context) reporter.HealthcheckResult {
+	if c.budget.Exceeded() {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "memory budget exceeded"}
+	}
+	for idx, ch := range c.channels {
+		backlog, capacity := len(ch), cap(ch)
+		if capacity > 0 && backlog > capacity*3/4 {
+			return reporter.HealthcheckResult{
+				Status: reporter.HealthcheckWarning,
+				Reason: fmt.Sprintf("backlog above threshold for input %d (%d/%d)", idx, backlog, capacity),
+			}
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "backlog below threshold"}
+}
+
+// flowMessageColumns are the columns backed by a field of schema.FlowMessage
+// instead of being directly encoded by decoders.
+var flowMessageColumns = []schema.ColumnKey{
+	schema.ColumnTimeReceived,
+	schema.ColumnSamplingRate,
+	schema.ColumnExporterAddress,
+	schema.ColumnSrcAddr,
+	schema.ColumnDstAddr,
+	schema.ColumnNextHop,
+	schema.ColumnSrcAS,
+	schema.ColumnDstAS,
+	schema.ColumnSrcNetMask,
+	schema.ColumnDstNetMask,
+	schema.ColumnSrcVlan,
+	schema.ColumnDstVlan,
+}
+
+// vendorElementColumn tells if the provided column can store the value of a
+// vendor element: it should be a scalar column directly extracted from the
+// flow, not computed by ClickHouse or set during enrichment.
+func vendorElementColumn(sch *schema.Component, key schema.ColumnKey) bool {
+	column, ok := sch.LookupColumnByKey(key)
+	if !ok {
+		return false
+	}
+	if column.ClickHouseAlias != "" || column.ClickHouseGenerateFrom != "" ||
+		len(column.ClickHouseTransformFrom) > 0 || column.InletEnrichment ||
+		column.ProtobufIndex < 0 || column.ProtobufRepeated {
+		return false
+	}
+	if slices.Contains(flowMessageColumns, key) {
+		return false
+	}
+	switch column.ParserType {
+	case "uint", "string", "ip":
+		return true
+	}
+	return false
+}
@@ -4,16 +4,25 @@
 package flow
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
+	"akvorado/common/daemon"
 	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
 	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input/file"
+	"akvorado/inlet/flow/input/udp"
 )
 
 func TestFlow(t *testing.T) {
@@ -123,3 +132,184 @@ func TestFlow(t *testing.T) {
 		}
 	}
 }
+
+func TestVendorElementsColumns(t *testing.T) {
+	cases := []struct {
+		Column schema.ColumnKey
+		Valid  bool
+	}{
+		{schema.ColumnForwardingClass, true},
+		{schema.ColumnSubscriberID, true},
+		{schema.ColumnSrcAddrNAT, true},
+		{schema.ColumnIPTTL, true},
+		{schema.ColumnSrcAS, false},            // field of FlowMessage
+		{schema.ColumnExporterAddress, false},  // field of FlowMessage
+		{schema.ColumnInIfName, false},         // enrichment
+		{schema.ColumnPacketSizeBucket, false}, // alias
+		{schema.ColumnMPLSLabels, false},       // array
+		{schema.ColumnDstASPath, false},        // array
+	}
+	for _, tc := range cases {
+		t.Run(tc.Column.String(), func(t *testing.T) {
+			r := reporter.NewMock(t)
+			config := DefaultConfiguration()
+			config.VendorElements = helpers.MustNewSubnetMap(map[string][]decoder.VendorElement{
+				"::/0": {{Enterprise: 2636, Element: 1, Column: tc.Column}},
+			})
+			_, err := New(r, config, Dependencies{
+				Daemon: daemon.NewMock(t),
+				HTTP:   httpserver.NewMock(t, r),
+				Schema: schema.NewMock(t),
+			})
+			if err == nil && !tc.Valid {
+				t.Fatal("New() did not error")
+			} else if err != nil && tc.Valid {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicy(t *testing.T) {
+	exporter := netip.MustParseAddr("::ffff:192.0.2.142")
+	packet := func() []*schema.FlowMessage {
+		return []*schema.FlowMessage{{ExporterAddress: exporter, SamplingRate: 100}}
+	}
+	cases := []struct {
+		Policy               RateLimitPolicy
+		ExpectedSamplingRate uint32
+	}{
+		{RateLimitSample, 400},
+		{RateLimitDrop, 100},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Policy.String(), func(t *testing.T) {
+			r := reporter.NewMock(t)
+			config := DefaultConfiguration()
+			config.PacketRateLimit = 10
+			config.RateLimitPolicy = tc.Policy
+			c := NewMock(t, r, config)
+
+			// Burst is one packet
+			for i := 0; i < 4; i++ {
+				if got := c.allowMessages(packet()); got != (i == 0) {
+					t.Fatalf("allowMessages() #%d == %v", i, got)
+				}
+			}
+			// During the next tick, the drop rate is 75%
+			time.Sleep(250 * time.Millisecond)
+			fmsgs := packet()
+			if !c.allowMessages(fmsgs) {
+				t.Fatal("allowMessages() == false")
+			}
+			if fmsgs[0].SamplingRate != tc.ExpectedSamplingRate {
+				t.Fatalf("SamplingRate == %d, expected %d", fmsgs[0].SamplingRate, tc.ExpectedSamplingRate)
+			}
+
+			gotMetrics := r.GetMetrics("akvorado_inlet_flow_", "rate_limit_")
+			expectedMetrics := map[string]string{
+				`rate_limit_dropped_flows_total{exporter="192.0.2.142",limit="packets"}`: "3",
+			}
+			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+				t.Fatalf("Metrics (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTemplatesPersistFile(t *testing.T) {
+	_, src, _, _ := runtime.Caller(0)
+	base := path.Join(path.Dir(src), "decoder", "netflow", "testdata")
+	template := helpers.ReadPcapL4(t, path.Join(base, "template.pcap"))
+	data := helpers.ReadPcapL4(t, path.Join(base, "data.pcap"))
+	source := net.ParseIP("127.0.0.1")
+
+	config := DefaultConfiguration()
+	config.TemplatesPersistFile = filepath.Join(t.TempDir(), "templates")
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, config)
+	c.decoders[0].Decode(decoder.RawFlow{Payload: template, Source: source})
+	if err := c.saveDecoders(context.Background(), c.stores); err != nil {
+		t.Fatalf("saveDecoders() error:\n%+v", err)
+	}
+
+	// Templates are loaded on start
+	r = reporter.NewMock(t)
+	c = NewMock(t, r, config)
+	got := c.decoders[0].Decode(decoder.RawFlow{Payload: data, Source: source})
+	if len(got) == 0 {
+		t.Fatal("Decode() after restart got no flows")
+	}
+}
+
+func TestReceivingFlowsHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	check := func(expected reporter.HealthcheckResult) {
+		t.Helper()
+		got := r.RunHealthchecks(context.Background())
+		if diff := helpers.Diff(got.Details["flow"].HealthcheckResult, expected); diff != "" {
+			t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+		}
+	}
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "no flow received yet"})
+	c.lastReceived.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "no flow received for 2m0s"})
+	c.lastReceived.Store(time.Now().UnixNano())
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "receiving flows"})
+}
+
+func TestBacklogHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration())
+
+	check := func(expected reporter.HealthcheckResult) {
+		t.Helper()
+		got := r.RunHealthchecks(context.Background())
+		if diff := helpers.Diff(got.Details["flow/backlog"].HealthcheckResult, expected); diff != "" {
+			t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+		}
+	}
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "backlog below threshold"})
+
+	ch := make(chan []*schema.FlowMessage, 4)
+	c.channels = []<-chan []*schema.FlowMessage{ch}
+	for i := 0; i < 3; i++ {
+		ch <- nil
+	}
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "backlog below threshold"})
+	ch <- nil
+	check(reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: "backlog above threshold for input 0 (4/4)",
+	})
+}
+
+func TestForwardPrivacy(t *testing.T) {
+	r := reporter.NewMock(t)
+	schemaConfig := schema.DefaultConfiguration()
+	schemaConfig.Privacy = true
+	sch, err := schema.New(schemaConfig)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	config := DefaultConfiguration()
+	config.Inputs = []InputConfiguration{
+		{
+			Decoder: "netflow",
+			Config: &udp.Configuration{
+				Listen:    "127.0.0.1:0",
+				QueueSize: 10,
+				ForwardTo: []string{"127.0.0.1:2055"},
+			},
+		},
+	}
+	if _, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpserver.NewMock(t, r),
+		Schema: sch,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
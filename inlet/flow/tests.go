@@ -6,6 +6,8 @@
 package flow
 
 import (
+	"fmt"
+	"reflect"
 	"testing"
 
 	"akvorado/common/daemon"
@@ -13,9 +15,14 @@ import (
 	"akvorado/common/httpserver"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
+	"akvorado/inlet/flow/decoder"
 	"akvorado/inlet/flow/input/udp"
 )
 
+func init() {
+	helpers.AddPrettyFormatter(reflect.TypeOf(helpers.SubnetMap[[]decoder.VendorElement]{}), fmt.Sprint)
+}
+
 // NewMock creates a new flow importer listening on a random port. It
 // is autostarted.
 func NewMock(t *testing.T, r *reporter.Reporter, config Configuration) *Component {
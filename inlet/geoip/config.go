@@ -6,6 +6,7 @@ package geoip
 import (
 	"fmt"
 	"reflect"
+	"time"
 
 	"akvorado/common/helpers"
 
@@ -14,12 +15,20 @@ import (
 
 // Configuration describes the configuration for the GeoIP component.
 type Configuration struct {
-	// ASNDatabase defines the path to the ASN database.
-	ASNDatabase string
-	// GeoDatabase defines the path to the geo database.
-	GeoDatabase string
+	// ASNDatabase defines the paths to the ASN databases. The first
+	// database with an answer wins.
+	ASNDatabase []string
+	// GeoDatabase defines the paths to the geo databases. The first
+	// database with an answer wins.
+	GeoDatabase []string
 	// Optional tells if we need to error if not present on start.
 	Optional bool
+	// RefreshInterval tells how often to reload the databases, in addition
+	// to reloading them when they are modified. 0 disables periodic reload.
+	RefreshInterval time.Duration `validate:"eq=0|min=1m"`
+	// CacheSize is the maximum number of answers to keep in cache for each
+	// kind of database. 0 disables the cache.
+	CacheSize int `validate:"min=0"`
 }
 
 // DefaultConfiguration represents the default configuration for the
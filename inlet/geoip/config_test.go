@@ -33,7 +33,7 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 				}
 			},
 			Expected: Configuration{
-				ASNDatabase: "something",
+				ASNDatabase: []string{"something"},
 				Optional:    true,
 			},
 		}, {
@@ -46,8 +46,8 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 				}
 			},
 			Expected: Configuration{
-				ASNDatabase: "something",
-				GeoDatabase: "something else",
+				ASNDatabase: []string{"something"},
+				GeoDatabase: []string{"something else"},
 			},
 		}, {
 			Description: "no country-database, geoip-database",
@@ -59,8 +59,8 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 				}
 			},
 			Expected: Configuration{
-				ASNDatabase: "something",
-				GeoDatabase: "something else",
+				ASNDatabase: []string{"something"},
+				GeoDatabase: []string{"something else"},
 			},
 		}, {
 			Description: "both country-database, geoip-database",
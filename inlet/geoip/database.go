@@ -4,6 +4,7 @@
 package geoip
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"strings"
@@ -37,7 +38,9 @@ func (c *Component) openDatabase(which string, path string, container *atomic.Po
 		return err
 	}
 	oldOne := container.Swap(&newOne)
+	c.purgeCache(which)
 	c.metrics.databaseRefresh.WithLabelValues(which).Inc()
+	c.metrics.databaseBuildEpoch.WithLabelValues(which, path).Set(float64(db.Metadata.BuildEpoch))
 	if oldOne != nil {
 		c.r.Debug().
 			Str("database", path).
@@ -47,6 +50,34 @@ func (c *Component) openDatabase(which string, path string, container *atomic.Po
 	return nil
 }
 
+// openDatabases opens all the configured databases. It returns the errors
+// encountered but tries to open all databases anyway.
+func (c *Component) openDatabases() error {
+	var errs []error
+	for idx, path := range c.config.GeoDatabase {
+		errs = append(errs, c.openDatabase("geo", path, &c.db.geo[idx]))
+	}
+	for idx, path := range c.config.ASNDatabase {
+		errs = append(errs, c.openDatabase("asn", path, &c.db.asn[idx]))
+	}
+	return errors.Join(errs...)
+}
+
+// hasDatabase tells if at least one database is opened.
+func (c *Component) hasDatabase() bool {
+	for idx := range c.db.geo {
+		if c.db.geo[idx].Load() != nil {
+			return true
+		}
+	}
+	for idx := range c.db.asn {
+		if c.db.asn[idx].Load() != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // getGeoDatabase guesses the database format and instantiate the right one.
 func getGeoDatabase(db *maxminddb.Reader) (geoDatabase, error) {
 	// We should looks at the fields, but instead we use metadata and default to
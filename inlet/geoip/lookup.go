@@ -6,34 +6,95 @@ package geoip
 import (
 	"net"
 	"net/netip"
+	"time"
 )
 
-// LookupASN returns the result of a lookup for an AS number.
+// LookupASN returns the result of a lookup for an AS number. Databases are
+// queried in order until one of them has an answer.
 func (c *Component) LookupASN(ip netip.Addr) uint32 {
-	asnDB := c.db.asn.Load()
-	if asnDB != nil {
-		ip := ip.As16()
-		asn, err := (*asnDB).LookupASN(net.IP(ip[:]))
+	if c.cache.asn == nil {
+		return c.lookupASN(ip)
+	}
+	now := time.Now()
+	if asn, ok := c.cache.asn.Get(now, ip); ok {
+		c.metrics.cacheHit.WithLabelValues("asn").Inc()
+		return asn
+	}
+	c.metrics.cacheMiss.WithLabelValues("asn").Inc()
+	asn := c.lookupASN(ip)
+	c.cache.asn.Put(now, ip, asn)
+	return asn
+}
+
+// lookupASN queries the ASN databases without using the cache.
+func (c *Component) lookupASN(ip netip.Addr) uint32 {
+	ip16 := ip.As16()
+	loaded := false
+	for idx := range c.db.asn {
+		asnDB := c.db.asn[idx].Load()
+		if asnDB == nil {
+			continue
+		}
+		loaded = true
+		asn, err := (*asnDB).LookupASN(net.IP(ip16[:]))
 		if err == nil && asn != 0 {
 			c.metrics.databaseHit.WithLabelValues("asn").Inc()
 			return asn
 		}
+	}
+	if loaded {
 		c.metrics.databaseMiss.WithLabelValues("asn").Inc()
 	}
 	return 0
 }
 
-// LookupCountry returns the result of a lookup for country.
+// LookupCountry returns the result of a lookup for country. Databases are
+// queried in order until one of them has an answer.
 func (c *Component) LookupCountry(ip netip.Addr) string {
-	geoDB := c.db.geo.Load()
-	if geoDB != nil {
-		ip := ip.As16()
-		country, err := (*geoDB).LookupCountry(net.IP(ip[:]))
+	if c.cache.geo == nil {
+		return c.lookupCountry(ip)
+	}
+	now := time.Now()
+	if country, ok := c.cache.geo.Get(now, ip); ok {
+		c.metrics.cacheHit.WithLabelValues("geo").Inc()
+		return country
+	}
+	c.metrics.cacheMiss.WithLabelValues("geo").Inc()
+	country := c.lookupCountry(ip)
+	c.cache.geo.Put(now, ip, country)
+	return country
+}
+
+// lookupCountry queries the geo databases without using the cache.
+func (c *Component) lookupCountry(ip netip.Addr) string {
+	ip16 := ip.As16()
+	loaded := false
+	for idx := range c.db.geo {
+		geoDB := c.db.geo[idx].Load()
+		if geoDB == nil {
+			continue
+		}
+		loaded = true
+		country, err := (*geoDB).LookupCountry(net.IP(ip16[:]))
 		if err == nil && country != "" {
 			c.metrics.databaseHit.WithLabelValues("geo").Inc()
 			return country
 		}
+	}
+	if loaded {
 		c.metrics.databaseMiss.WithLabelValues("geo").Inc()
 	}
 	return ""
 }
+
+// purgeCache removes all the cached answers for the provided kind of
+// database. It is called when a database is reloaded.
+func (c *Component) purgeCache(which string) {
+	all := func(netip.Addr) bool { return true }
+	switch {
+	case which == "geo" && c.cache.geo != nil:
+		c.cache.geo.DeleteMatching(all)
+	case which == "asn" && c.cache.asn != nil:
+		c.cache.asn.DeleteMatching(all)
+	}
+}
@@ -50,7 +50,7 @@ func TestLookup(t *testing.T) {
 			t.Errorf("LookupASN(%q) (-got, +want):\n%s", tc.IP, diff)
 		}
 	}
-	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_")
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_", "-db_build_")
 	expectedMetrics := map[string]string{
 		`db_hits_total{database="asn"}`:    "3",
 		`db_hits_total{database="geo"}`:    "3",
@@ -69,8 +69,8 @@ func TestLookupIPInfo(t *testing.T) {
 	config := DefaultConfiguration()
 	// The JSON version of this one is here:
 	// https://github.com/ipinfo/sample-database/blob/main/IP%20to%20Country%20ASN/ip_country_asn_sample.json
-	config.GeoDatabase = filepath.Join("testdata", "ip_country_asn_sample.mmdb")
-	config.ASNDatabase = filepath.Join("testdata", "ip_country_asn_sample.mmdb")
+	config.GeoDatabase = []string{filepath.Join("testdata", "ip_country_asn_sample.mmdb")}
+	config.ASNDatabase = []string{filepath.Join("testdata", "ip_country_asn_sample.mmdb")}
 	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
 	if err != nil {
 		t.Fatalf("New() error:\n%+s", err)
@@ -107,3 +107,114 @@ func TestLookupIPInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupMultipleDatabases(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.GeoDatabase = []string{
+		filepath.Join("testdata", "ip_country_asn_sample.mmdb"),
+		filepath.Join("testdata", "GeoLite2-Country-Test.mmdb"),
+	}
+	config.ASNDatabase = []string{
+		filepath.Join("testdata", "ip_country_asn_sample.mmdb"),
+		filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb"),
+	}
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+s", err)
+	}
+	helpers.StartStop(t, c)
+
+	cases := []struct {
+		IP              string
+		ExpectedASN     uint32
+		ExpectedCountry string
+	}{
+		{
+			// From the first database
+			IP:              "2.19.4.138",
+			ExpectedASN:     32787,
+			ExpectedCountry: "SG",
+		}, {
+			// From the second database
+			IP:              "67.43.156.77",
+			ExpectedASN:     35908,
+			ExpectedCountry: "BT",
+		}, {
+			// From none of them
+			IP: "192.0.2.1",
+		},
+	}
+	for _, tc := range cases {
+		gotCountry := c.LookupCountry(netip.MustParseAddr(tc.IP))
+		if diff := helpers.Diff(gotCountry, tc.ExpectedCountry); diff != "" {
+			t.Errorf("LookupCountry(%q) (-got, +want):\n%s", tc.IP, diff)
+		}
+		gotASN := c.LookupASN(netip.MustParseAddr(tc.IP))
+		if diff := helpers.Diff(gotASN, tc.ExpectedASN); diff != "" {
+			t.Errorf("LookupASN(%q) (-got, +want):\n%s", tc.IP, diff)
+		}
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_", "db_hits_", "db_misses_")
+	expectedMetrics := map[string]string{
+		`db_hits_total{database="asn"}`:   "2",
+		`db_hits_total{database="geo"}`:   "2",
+		`db_misses_total{database="asn"}`: "1",
+		`db_misses_total{database="geo"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestLookupWithCache(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.GeoDatabase = []string{filepath.Join("testdata", "GeoLite2-Country-Test.mmdb")}
+	config.ASNDatabase = []string{filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb")}
+	config.CacheSize = 10
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+s", err)
+	}
+	helpers.StartStop(t, c)
+
+	for i := 0; i < 3; i++ {
+		if got := c.LookupCountry(netip.MustParseAddr("2.125.160.216")); got != "GB" {
+			t.Errorf("LookupCountry() == %q, expected %q", got, "GB")
+		}
+		if got := c.LookupASN(netip.MustParseAddr("1.0.0.1")); got != 15169 {
+			t.Errorf("LookupASN() == %d, expected %d", got, 15169)
+		}
+		if got := c.LookupASN(netip.MustParseAddr("2.125.160.216")); got != 0 {
+			t.Errorf("LookupASN() == %d, expected %d", got, 0)
+		}
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_", "-db_build_", "-db_refresh_")
+	expectedMetrics := map[string]string{
+		`cache_evicted_entries_total`:        "0",
+		`cache_hits_total{database="asn"}`:   "4",
+		`cache_hits_total{database="geo"}`:   "2",
+		`cache_misses_total{database="asn"}`: "2",
+		`cache_misses_total{database="geo"}`: "1",
+		`cache_size_entries`:                 "3",
+		`db_hits_total{database="asn"}`:      "1",
+		`db_hits_total{database="geo"}`:      "1",
+		`db_misses_total{database="asn"}`:    "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Reloading the databases purges the cache
+	if err := c.Reload(); err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_geoip_", "cache_size_")
+	expectedMetrics = map[string]string{
+		`cache_size_entries`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
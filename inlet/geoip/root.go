@@ -7,6 +7,7 @@ package geoip
 import (
 	"errors"
 	"fmt"
+	"net/netip"
 	"path/filepath"
 	"sync/atomic"
 	"time"
@@ -15,6 +16,7 @@ import (
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers/cache"
 	"akvorado/common/reporter"
 )
 
@@ -26,13 +28,22 @@ type Component struct {
 	config Configuration
 
 	db struct {
-		geo atomic.Pointer[geoDatabase]
-		asn atomic.Pointer[geoDatabase]
+		geo []atomic.Pointer[geoDatabase]
+		asn []atomic.Pointer[geoDatabase]
+	}
+	cache struct {
+		geo *cache.Cache[netip.Addr, string]
+		asn *cache.Cache[netip.Addr, uint32]
 	}
 	metrics struct {
-		databaseRefresh *reporter.CounterVec
-		databaseHit     *reporter.CounterVec
-		databaseMiss    *reporter.CounterVec
+		databaseRefresh    *reporter.CounterVec
+		databaseHit        *reporter.CounterVec
+		databaseMiss       *reporter.CounterVec
+		databaseBuildEpoch *reporter.GaugeVec
+		cacheHit           *reporter.CounterVec
+		cacheMiss          *reporter.CounterVec
+		cacheEvicted       reporter.CounterFunc
+		cacheSize          reporter.GaugeFunc
 	}
 }
 
@@ -48,12 +59,14 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		d:      &dependencies,
 		config: configuration,
 	}
-	if c.config.GeoDatabase != "" {
-		c.config.GeoDatabase = filepath.Clean(c.config.GeoDatabase)
+	for idx, path := range c.config.GeoDatabase {
+		c.config.GeoDatabase[idx] = filepath.Clean(path)
 	}
-	if c.config.ASNDatabase != "" {
-		c.config.ASNDatabase = filepath.Clean(c.config.ASNDatabase)
+	for idx, path := range c.config.ASNDatabase {
+		c.config.ASNDatabase[idx] = filepath.Clean(path)
 	}
+	c.db.geo = make([]atomic.Pointer[geoDatabase], len(c.config.GeoDatabase))
+	c.db.asn = make([]atomic.Pointer[geoDatabase], len(c.config.ASNDatabase))
 	c.d.Daemon.Track(&c.t, "inlet/geoip")
 	c.metrics.databaseRefresh = c.r.CounterVec(
 		reporter.CounterOpts{
@@ -76,18 +89,56 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		},
 		[]string{"database"},
 	)
+	c.metrics.databaseBuildEpoch = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "db_build_epoch_seconds",
+			Help: "Build time of a GeoIP database.",
+		},
+		[]string{"database", "path"},
+	)
+	if c.config.CacheSize > 0 {
+		c.cache.geo = cache.NewLRU[netip.Addr, string](c.config.CacheSize)
+		c.cache.asn = cache.NewLRU[netip.Addr, uint32](c.config.CacheSize)
+		c.metrics.cacheHit = c.r.CounterVec(
+			reporter.CounterOpts{
+				Name: "cache_hits_total",
+				Help: "Number of lookups retrieved from cache.",
+			},
+			[]string{"database"},
+		)
+		c.metrics.cacheMiss = c.r.CounterVec(
+			reporter.CounterOpts{
+				Name: "cache_misses_total",
+				Help: "Number of lookups not found in cache.",
+			},
+			[]string{"database"},
+		)
+		c.metrics.cacheEvicted = c.r.CounterFunc(
+			reporter.CounterOpts{
+				Name: "cache_evicted_entries_total",
+				Help: "Number of cache entries evicted because the cache was full.",
+			}, func() float64 {
+				_, _, geoEvicted := c.cache.geo.Stats()
+				_, _, asnEvicted := c.cache.asn.Stats()
+				return float64(geoEvicted + asnEvicted)
+			})
+		c.metrics.cacheSize = c.r.GaugeFunc(
+			reporter.GaugeOpts{
+				Name: "cache_size_entries",
+				Help: "Number of entries in cache.",
+			}, func() float64 {
+				return float64(c.cache.geo.Size() + c.cache.asn.Size())
+			})
+	}
 	return &c, nil
 }
 
 // Start starts the GeoIP component.
 func (c *Component) Start() error {
-	if err := c.openDatabase("geo", c.config.GeoDatabase, &c.db.geo); err != nil && !c.config.Optional {
-		return err
-	}
-	if err := c.openDatabase("asn", c.config.ASNDatabase, &c.db.asn); err != nil && !c.config.Optional {
+	if err := c.openDatabases(); err != nil && !c.config.Optional {
 		return err
 	}
-	if c.db.geo.Load() == nil && c.db.asn.Load() == nil {
+	if !c.hasDatabase() {
 		c.r.Warn().Msg("skipping GeoIP component: no database specified")
 	}
 
@@ -100,11 +151,8 @@ func (c *Component) Start() error {
 		return fmt.Errorf("cannot setup watcher: %w", err)
 	}
 	dirs := map[string]struct{}{}
-	if c.config.GeoDatabase != "" {
-		dirs[filepath.Dir(c.config.GeoDatabase)] = struct{}{}
-	}
-	if c.config.ASNDatabase != "" {
-		dirs[filepath.Dir(c.config.ASNDatabase)] = struct{}{}
+	for _, path := range append(append([]string{}, c.config.GeoDatabase...), c.config.ASNDatabase...) {
+		dirs[filepath.Dir(path)] = struct{}{}
 	}
 	for k := range dirs {
 		if err := watcher.Add(k); err != nil {
@@ -115,6 +163,12 @@ func (c *Component) Start() error {
 	c.t.Go(func() error {
 		errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 1))
 		defer watcher.Close()
+		var refresh <-chan time.Time
+		if c.config.RefreshInterval > 0 {
+			ticker := time.NewTicker(c.config.RefreshInterval)
+			defer ticker.Stop()
+			refresh = ticker.C
+		}
 
 		for {
 			// Watch both for errors and events in the
@@ -123,6 +177,8 @@ func (c *Component) Start() error {
 			select {
 			case <-c.t.Dying():
 				return nil
+			case <-refresh:
+				c.openDatabases()
 			case err, ok := <-watcher.Errors:
 				if !ok {
 					return errors.New("file watcher died")
@@ -135,11 +191,15 @@ func (c *Component) Start() error {
 				if !event.Has(fsnotify.Write) && !event.Has(fsnotify.Create) {
 					continue
 				}
-				if filepath.Clean(event.Name) == c.config.GeoDatabase {
-					c.openDatabase("geo", c.config.GeoDatabase, &c.db.geo)
+				for idx, path := range c.config.GeoDatabase {
+					if filepath.Clean(event.Name) == path {
+						c.openDatabase("geo", path, &c.db.geo[idx])
+					}
 				}
-				if filepath.Clean(event.Name) == c.config.ASNDatabase {
-					c.openDatabase("asn", c.config.ASNDatabase, &c.db.asn)
+				for idx, path := range c.config.ASNDatabase {
+					if filepath.Clean(event.Name) == path {
+						c.openDatabase("asn", path, &c.db.asn[idx])
+					}
 				}
 			}
 		}
@@ -147,9 +207,15 @@ func (c *Component) Start() error {
 	return nil
 }
 
+// Reload reopens the GeoIP databases. This is useful when a database was
+// replaced without the file watcher noticing it.
+func (c *Component) Reload() error {
+	return c.openDatabases()
+}
+
 // Stop stops the GeoIP component.
 func (c *Component) Stop() error {
-	if c.db.geo.Load() == nil && c.db.asn.Load() == nil {
+	if !c.hasDatabase() {
 		return nil
 	}
 	c.r.Info().Msg("stopping GeoIP component")
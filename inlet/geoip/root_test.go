@@ -4,9 +4,11 @@
 package geoip
 
 import (
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 	"time"
 
@@ -36,13 +38,13 @@ func copyFile(src string, dst string) {
 func TestDatabaseRefresh(t *testing.T) {
 	dir := t.TempDir()
 	config := DefaultConfiguration()
-	config.GeoDatabase = filepath.Join(dir, "country.mmdb")
-	config.ASNDatabase = filepath.Join(dir, "asn.mmdb")
+	config.GeoDatabase = []string{filepath.Join(dir, "country.mmdb")}
+	config.ASNDatabase = []string{filepath.Join(dir, "asn.mmdb")}
 
 	copyFile(filepath.Join("testdata", "GeoLite2-Country-Test.mmdb"),
-		config.GeoDatabase)
+		config.GeoDatabase[0])
 	copyFile(filepath.Join("testdata", "GeoLite2-ASN-Test.mmdb"),
-		config.ASNDatabase)
+		config.ASNDatabase[0])
 
 	r := reporter.NewMock(t)
 	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
@@ -56,6 +58,8 @@ func TestDatabaseRefresh(t *testing.T) {
 	expectedMetrics := map[string]string{
 		`refresh_total{database="asn"}`: "1",
 		`refresh_total{database="geo"}`: "1",
+		fmt.Sprintf(`build_epoch_seconds{database="asn",path="%s"}`, config.ASNDatabase[0]): "1.63710205e+09",
+		fmt.Sprintf(`build_epoch_seconds{database="geo",path="%s"}`, config.GeoDatabase[0]): "1.63710205e+09",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -64,9 +68,9 @@ func TestDatabaseRefresh(t *testing.T) {
 	// Check we can reload the database
 	copyFile(filepath.Join("testdata", "GeoLite2-Country-Test.mmdb"),
 		filepath.Join(dir, "tmp.mmdb"))
-	os.Rename(filepath.Join(dir, "tmp.mmdb"), config.GeoDatabase)
+	os.Rename(filepath.Join(dir, "tmp.mmdb"), config.GeoDatabase[0])
 	time.Sleep(20 * time.Millisecond)
-	gotMetrics = r.GetMetrics("akvorado_inlet_geoip_db_")
+	gotMetrics = r.GetMetrics("akvorado_inlet_geoip_db_", "refresh_")
 	expectedMetrics = map[string]string{
 		`refresh_total{database="asn"}`: "1",
 		`refresh_total{database="geo"}`: "2",
@@ -74,6 +78,19 @@ func TestDatabaseRefresh(t *testing.T) {
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
 	}
+
+	// Check we can force a reload
+	if err := c.Reload(); err != nil {
+		t.Fatalf("Reload() error:\n%+v", err)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_geoip_db_", "refresh_")
+	expectedMetrics = map[string]string{
+		`refresh_total{database="asn"}`: "2",
+		`refresh_total{database="geo"}`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
 }
 
 func TestStartWithoutDatabase(t *testing.T) {
@@ -87,9 +104,9 @@ func TestStartWithoutDatabase(t *testing.T) {
 
 func TestStartWithMissingDatabase(t *testing.T) {
 	geoConfiguration := DefaultConfiguration()
-	geoConfiguration.GeoDatabase = "/i/do/not/exist"
+	geoConfiguration.GeoDatabase = []string{"/i/do/not/exist"}
 	asnConfiguration := DefaultConfiguration()
-	asnConfiguration.ASNDatabase = "/i/do/not/exist"
+	asnConfiguration.ASNDatabase = []string{"/i/do/not/exist"}
 	cases := []struct {
 		Name   string
 		Config Configuration
@@ -110,3 +127,21 @@ func TestStartWithMissingDatabase(t *testing.T) {
 		})
 	}
 }
+
+func TestDatabasePeriodicRefresh(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.GeoDatabase = []string{filepath.Join("testdata", "GeoLite2-Country-Test.mmdb")}
+	config.RefreshInterval = 20 * time.Millisecond
+	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	time.Sleep(50 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_geoip_db_", "refresh_")
+	if refreshes, _ := strconv.Atoi(gotMetrics[`refresh_total{database="geo"}`]); refreshes < 2 {
+		t.Fatalf("Metrics: %d refreshes, expected at least 2", refreshes)
+	}
+}
@@ -25,8 +25,8 @@ func NewMock(t *testing.T, r *reporter.Reporter) *Component {
 	t.Helper()
 	config := DefaultConfiguration()
 	_, src, _, _ := runtime.Caller(0)
-	config.GeoDatabase = filepath.Join(path.Dir(src), "testdata", "GeoLite2-Country-Test.mmdb")
-	config.ASNDatabase = filepath.Join(path.Dir(src), "testdata", "GeoLite2-ASN-Test.mmdb")
+	config.GeoDatabase = []string{filepath.Join(path.Dir(src), "testdata", "GeoLite2-Country-Test.mmdb")}
+	config.ASNDatabase = []string{filepath.Join(path.Dir(src), "testdata", "GeoLite2-ASN-Test.mmdb")}
 	c, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)})
 	if err != nil {
 		t.Fatalf("New() error:\n%+s", err)
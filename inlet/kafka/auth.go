@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/common/reporter"
+)
+
+// trackAuthenticationFailures wraps the client certificate and the OAuth token
+// callbacks to count and log authentication failures.
+func (c *Component) trackAuthenticationFailures() {
+	errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 3))
+	if tlsConfig := c.kafkaConfig.Net.TLS.Config; tlsConfig != nil && tlsConfig.GetClientCertificate != nil {
+		getClientCertificate := tlsConfig.GetClientCertificate
+		tlsConfig.GetClientCertificate = func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := getClientCertificate(cri)
+			if err != nil {
+				c.metrics.authenticationFailures.WithLabelValues("certificate").Inc()
+				errLogger.Err(err).Msg("cannot get Kafka client certificate")
+			}
+			return cert, err
+		}
+	}
+	if tokenProvider := c.kafkaConfig.Net.SASL.TokenProvider; tokenProvider != nil {
+		c.kafkaConfig.Net.SASL.TokenProvider = trackedTokenProvider{
+			AccessTokenProvider: tokenProvider,
+			onError: func(err error) {
+				c.metrics.authenticationFailures.WithLabelValues("token").Inc()
+				errLogger.Err(err).Msg("cannot get Kafka OAuth token")
+			},
+		}
+	}
+}
+
+// trackedTokenProvider is an access token provider calling onError on failure.
+type trackedTokenProvider struct {
+	sarama.AccessTokenProvider
+	onError func(error)
+}
+
+// Token returns an access token from the wrapped provider.
+func (p trackedTokenProvider) Token() (*sarama.AccessToken, error) {
+	token, err := p.AccessTokenProvider.Token()
+	if err != nil {
+		p.onError(err)
+	}
+	return token, err
+}
@@ -0,0 +1,121 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"sync"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/inlet/pipeline"
+)
+
+// batch accumulates length-delimited protobuf flows from one exporter to send
+// them in a single Kafka message.
+type batch struct {
+	lock     sync.Mutex
+	exporter string
+	buf      *[]byte
+	flows    int
+}
+
+// batchMetadata is attached to the Kafka messages containing a batch.
+type batchMetadata struct {
+	buf   *[]byte
+	flows int
+}
+
+// getBatch returns the batch for the provided exporter, creating it if
+// needed.
+func (c *Component) getBatch(exporter string) *batch {
+	c.batchesLock.RLock()
+	b, ok := c.batches[exporter]
+	c.batchesLock.RUnlock()
+	if ok {
+		return b
+	}
+	c.batchesLock.Lock()
+	defer c.batchesLock.Unlock()
+	if b, ok := c.batches[exporter]; ok {
+		return b
+	}
+	b = &batch{
+		exporter: exporter,
+		buf:      c.batchPool.Get().(*[]byte),
+	}
+	c.batches[exporter] = b
+	return b
+}
+
+// sendBatched appends the provided flow to the batch of the exporter. The
+// batch is sent first if the flow does not fit.
+func (c *Component) sendBatched(exporter string, payload []byte) {
+	b := c.getBatch(exporter)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if len(*b.buf)+len(payload) > c.config.BatchMaxBytes {
+		c.flushBatch(b, true)
+	}
+	*b.buf = append(*b.buf, payload...)
+	b.flows++
+}
+
+// flushBatch sends the provided batch to Kafka. It should be called with the
+// batch lock held. The buffer is recycled once Kafka is done with it. See
+// produceWithAbort for abortOnStop.
+func (c *Component) flushBatch(b *batch, abortOnStop bool) {
+	if b.flows == 0 {
+		return
+	}
+	var key []byte
+	if c.config.PartitionKey == PartitionKeyExporter {
+		key = []byte(b.exporter)
+	} else {
+		key = make([]byte, 4)
+		binary.BigEndian.PutUint32(key, rand.Uint32())
+	}
+	msg := &sarama.ProducerMessage{
+		Topic:    c.kafkaTopic,
+		Key:      sarama.ByteEncoder(key),
+		Value:    sarama.ByteEncoder(*b.buf),
+		Metadata: batchMetadata{buf: b.buf, flows: b.flows},
+	}
+	c.metrics.batchesSent.WithLabelValues(b.exporter).Inc()
+	c.metrics.batchFlows.WithLabelValues(b.exporter).Observe(float64(b.flows))
+	b.buf = c.batchPool.Get().(*[]byte)
+	b.flows = 0
+	if !c.produceWithAbort(msg, abortOnStop) {
+		c.drops.Add(pipeline.StageOutput, c.recycleBatch(msg))
+	}
+}
+
+// flushBatches sends all the pending batches to Kafka. See produceWithAbort for
+// abortOnStop.
+func (c *Component) flushBatches(abortOnStop bool) {
+	c.batchesLock.RLock()
+	batches := make([]*batch, 0, len(c.batches))
+	for _, b := range c.batches {
+		batches = append(batches, b)
+	}
+	c.batchesLock.RUnlock()
+	for _, b := range batches {
+		b.lock.Lock()
+		c.flushBatch(b, abortOnStop)
+		b.lock.Unlock()
+	}
+}
+
+// recycleBatch returns the buffer of a processed message to the pool, if it
+// is a batch. It returns the number of flows in the message.
+func (c *Component) recycleBatch(msg *sarama.ProducerMessage) int {
+	metadata, ok := msg.Metadata.(batchMetadata)
+	if !ok {
+		return 1
+	}
+	*metadata.buf = (*metadata.buf)[:0]
+	c.batchPool.Put(metadata.buf)
+	return metadata.flows
+}
@@ -4,10 +4,12 @@
 package kafka
 
 import (
+	"errors"
 	"time"
 
 	"github.com/IBM/sarama"
 
+	"akvorado/common/helpers/bimap"
 	"akvorado/common/kafka"
 )
 
@@ -26,6 +28,42 @@ type Configuration struct {
 	CompressionCodec CompressionCodec
 	// QueueSize defines the size of the channel used to send to Kafka.
 	QueueSize int `validate:"min=0"`
+	// Encoding defines how flows are encoded in Kafka messages.
+	Encoding Encoding
+	// SchemaRegistry defines the schema registry to use with Avro encoding.
+	SchemaRegistry SchemaRegistryConfiguration
+	// PartitionKey defines how flows are assigned to partitions.
+	PartitionKey PartitionKey
+	// BatchMaxBytes is the maximum size of a Kafka message containing
+	// several flows. 0 disables batching.
+	BatchMaxBytes int `validate:"min=0,ltfield=MaxMessageBytes"`
+	// BatchMaxLatency is the maximum duration a flow waits in a batch
+	// before being sent.
+	BatchMaxLatency time.Duration `validate:"min=1ms"`
+	// Mirror defines a second Kafka cluster receiving a copy of the
+	// messages, for example during a migration between clusters.
+	Mirror MirrorConfiguration
+}
+
+// MirrorConfiguration describes a Kafka cluster receiving a copy of the
+// messages sent to the main one.
+type MirrorConfiguration struct {
+	kafka.Configuration `mapstructure:",squash" yaml:"-,inline"`
+	// Enable tells to send a copy of the messages to this Kafka cluster.
+	Enable bool
+}
+
+// SchemaRegistryConfiguration defines how to register schemas in a schema
+// registry.
+type SchemaRegistryConfiguration struct {
+	// URL is the base URL of the schema registry.
+	URL string `validate:"omitempty,url"`
+	// Username is the username for basic authentication.
+	Username string
+	// Password is the password for basic authentication.
+	Password string `validate:"required_with=Username"`
+	// SubjectNameStrategy defines how the subject is derived.
+	SubjectNameStrategy SubjectNameStrategy
 }
 
 // DefaultConfiguration represents the default configuration for the Kafka exporter.
@@ -37,6 +75,15 @@ func DefaultConfiguration() Configuration {
 		MaxMessageBytes:  1000000,
 		CompressionCodec: CompressionCodec(sarama.CompressionNone),
 		QueueSize:        32,
+		Encoding:         EncodingProtobuf,
+		SchemaRegistry: SchemaRegistryConfiguration{
+			SubjectNameStrategy: TopicNameStrategy,
+		},
+		PartitionKey:    PartitionKeyRandom,
+		BatchMaxLatency: 100 * time.Millisecond,
+		Mirror: MirrorConfiguration{
+			Configuration: kafka.DefaultConfiguration(),
+		},
 	}
 }
 
@@ -57,3 +104,130 @@ func (cc CompressionCodec) String() string {
 func (cc CompressionCodec) MarshalText() ([]byte, error) {
 	return []byte(cc.String()), nil
 }
+
+// Encoding represents how flows are encoded.
+type Encoding int
+
+const (
+	// EncodingProtobuf encodes flows using length-delimited protobuf messages
+	EncodingProtobuf Encoding = iota
+	// EncodingAvro encodes flows using Avro with the schema registry wire format
+	EncodingAvro
+)
+
+var encodingMap = bimap.New(map[Encoding]string{
+	EncodingProtobuf: "protobuf",
+	EncodingAvro:     "avro",
+})
+
+// MarshalText turns an encoding to text
+func (e Encoding) MarshalText() ([]byte, error) {
+	got, ok := encodingMap.LoadValue(e)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown encoding")
+}
+
+// String turns an encoding to string
+func (e Encoding) String() string {
+	got, _ := encodingMap.LoadValue(e)
+	return got
+}
+
+// UnmarshalText provides an encoding from text
+func (e *Encoding) UnmarshalText(input []byte) error {
+	got, ok := encodingMap.LoadKey(string(input))
+	if ok {
+		*e = got
+		return nil
+	}
+	return errors.New("unknown encoding")
+}
+
+// SubjectNameStrategy represents how the subject of a schema is named in the
+// schema registry.
+type SubjectNameStrategy int
+
+const (
+	// TopicNameStrategy uses the topic name followed by "-value"
+	TopicNameStrategy SubjectNameStrategy = iota
+	// RecordNameStrategy uses the fully-qualified record name
+	RecordNameStrategy
+	// TopicRecordNameStrategy uses the topic name and the record name
+	TopicRecordNameStrategy
+)
+
+var subjectNameStrategyMap = bimap.New(map[SubjectNameStrategy]string{
+	TopicNameStrategy:       "topic",
+	RecordNameStrategy:      "record",
+	TopicRecordNameStrategy: "topic-record",
+})
+
+// MarshalText turns a subject name strategy to text
+func (sns SubjectNameStrategy) MarshalText() ([]byte, error) {
+	got, ok := subjectNameStrategyMap.LoadValue(sns)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown subject name strategy")
+}
+
+// String turns a subject name strategy to string
+func (sns SubjectNameStrategy) String() string {
+	got, _ := subjectNameStrategyMap.LoadValue(sns)
+	return got
+}
+
+// UnmarshalText provides a subject name strategy from text
+func (sns *SubjectNameStrategy) UnmarshalText(input []byte) error {
+	got, ok := subjectNameStrategyMap.LoadKey(string(input))
+	if ok {
+		*sns = got
+		return nil
+	}
+	return errors.New("unknown subject name strategy")
+}
+
+// PartitionKey represents how flows are assigned to partitions.
+type PartitionKey int
+
+const (
+	// PartitionKeyRandom spreads flows randomly on all partitions
+	PartitionKeyRandom PartitionKey = iota
+	// PartitionKeyExporter sends all flows from an exporter to the same partition
+	PartitionKeyExporter
+	// PartitionKeyFlowHash sends both directions of a flow to the same partition
+	PartitionKeyFlowHash
+)
+
+var partitionKeyMap = bimap.New(map[PartitionKey]string{
+	PartitionKeyRandom:   "random",
+	PartitionKeyExporter: "exporter",
+	PartitionKeyFlowHash: "flow-hash",
+})
+
+// MarshalText turns a partition key to text
+func (pk PartitionKey) MarshalText() ([]byte, error) {
+	got, ok := partitionKeyMap.LoadValue(pk)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown partition key")
+}
+
+// String turns a partition key to string
+func (pk PartitionKey) String() string {
+	got, _ := partitionKeyMap.LoadValue(pk)
+	return got
+}
+
+// UnmarshalText provides a partition key from text
+func (pk *PartitionKey) UnmarshalText(input []byte) error {
+	got, ok := partitionKeyMap.LoadKey(string(input))
+	if ok {
+		*pk = got
+		return nil
+	}
+	return errors.New("unknown partition key")
+}
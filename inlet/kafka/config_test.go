@@ -45,3 +45,9 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
 	}
 }
+
+func TestMarshalUnmarshal(t *testing.T) {
+	encodingMap.TestMarshalUnmarshal(t)
+	subjectNameStrategyMap.TestMarshalUnmarshal(t)
+	partitionKeyMap.TestMarshalUnmarshal(t)
+}
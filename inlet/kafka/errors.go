@@ -0,0 +1,44 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"errors"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/common/helpers"
+)
+
+// classifyError returns the provided producer error with its class.
+// Authentication and authorization errors are configuration errors, rejected
+// messages are permanent errors and unavailable brokers are transient errors.
+func classifyError(err error) error {
+	var kerr sarama.KError
+	if !errors.As(err, &kerr) {
+		if errors.Is(err, sarama.ErrOutOfBrokers) || errors.Is(err, sarama.ErrNotConnected) {
+			return helpers.TransientError(err)
+		}
+		return err
+	}
+	switch kerr {
+	case sarama.ErrSASLAuthenticationFailed,
+		sarama.ErrTopicAuthorizationFailed,
+		sarama.ErrClusterAuthorizationFailed,
+		sarama.ErrUnsupportedSASLMechanism:
+		return helpers.ConfigurationError(err)
+	case sarama.ErrMessageSizeTooLarge,
+		sarama.ErrInvalidMessage,
+		sarama.ErrInvalidMessageSize:
+		return helpers.PermanentError(err)
+	case sarama.ErrNotEnoughReplicas,
+		sarama.ErrNotEnoughReplicasAfterAppend,
+		sarama.ErrNotLeaderForPartition,
+		sarama.ErrLeaderNotAvailable,
+		sarama.ErrRequestTimedOut,
+		sarama.ErrBrokerNotAvailable:
+		return helpers.TransientError(err)
+	}
+	return err
+}
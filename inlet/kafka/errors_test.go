@@ -0,0 +1,33 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/common/helpers"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		Err   error
+		Class helpers.ErrorClass
+	}{
+		{errors.New("noooo"), helpers.ErrorClassUnknown},
+		{sarama.ErrSASLAuthenticationFailed, helpers.ErrorClassConfiguration},
+		{fmt.Errorf("cannot produce: %w", sarama.ErrTopicAuthorizationFailed), helpers.ErrorClassConfiguration},
+		{sarama.ErrMessageSizeTooLarge, helpers.ErrorClassPermanent},
+		{sarama.ErrNotEnoughReplicas, helpers.ErrorClassTransient},
+		{sarama.ErrOutOfBrokers, helpers.ErrorClassTransient},
+	}
+	for _, tc := range cases {
+		if got := helpers.ErrorClassOf(classifyError(tc.Err)); got != tc.Class {
+			t.Errorf("classifyError(%v) == %s, expected %s", tc.Err, got, tc.Class)
+		}
+	}
+}
@@ -18,6 +18,13 @@ type metrics struct {
 	messagesSent *reporter.CounterVec
 	bytesSent    *reporter.CounterVec
 	errors       *reporter.CounterVec
+	batchesSent  *reporter.CounterVec
+	batchFlows   *reporter.HistogramVec
+
+	authenticationFailures *reporter.CounterVec
+
+	mirrorErrors *reporter.CounterVec
+	mirrorDrops  *reporter.CounterVec
 
 	kafkaIncomingByteRate  *reporter.MetricDesc
 	kafkaOutgoingByteRate  *reporter.MetricDesc
@@ -50,6 +57,21 @@ func (c *Component) initMetrics() {
 		},
 		[]string{"exporter"},
 	)
+	c.metrics.batchesSent = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "sent_batches_total",
+			Help: "Number of batches of flows sent from a given exporter.",
+		},
+		[]string{"exporter"},
+	)
+	c.metrics.batchFlows = c.r.HistogramVec(
+		reporter.HistogramOpts{
+			Name:    "batch_flows",
+			Help:    "Number of flows in each batch from a given exporter.",
+			Buckets: []float64{1, 10, 100, 1000, 10000},
+		},
+		[]string{"exporter"},
+	)
 	c.metrics.errors = c.r.CounterVec(
 		reporter.CounterOpts{
 			Name: "errors_total",
@@ -57,6 +79,28 @@ func (c *Component) initMetrics() {
 		},
 		[]string{"error"},
 	)
+	c.metrics.authenticationFailures = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "authentication_failures_total",
+			Help: "Number of authentication failures with Kafka.",
+		},
+		[]string{"reason"},
+	)
+
+	c.metrics.mirrorErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mirror_errors_total",
+			Help: "Number of errors when sending to the mirror.",
+		},
+		[]string{"error"},
+	)
+	c.metrics.mirrorDrops = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mirror_dropped_flows_total",
+			Help: "Number of flows not sent to the mirror.",
+		},
+		[]string{"reason"},
+	)
 
 	c.metrics.kafkaIncomingByteRate = c.r.MetricDesc(
 		"brokers_incoming_byte_rate",
@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"slices"
+
+	"github.com/IBM/sarama"
+)
+
+// mirrorMetadata is attached to the Kafka messages sent to the mirror.
+type mirrorMetadata struct {
+	flows int
+}
+
+// mirror sends a copy of the provided message to the mirror producer. It
+// should be called before the message is sent to the main producer and with
+// the producer lock held. The mirror never blocks the main producer: when its
+// queue is full, the copy is dropped.
+func (c *Component) mirror(msg *sarama.ProducerMessage) {
+	topic, ok := c.mirrorTopics[msg.Topic]
+	if !ok {
+		return
+	}
+	flows := 0
+	if msg.Topic == c.kafkaTopic {
+		flows = 1
+	}
+	value := msg.Value
+	if metadata, ok := msg.Metadata.(batchMetadata); ok {
+		// The buffer of a batch is recycled once sent by the main producer.
+		value = sarama.ByteEncoder(slices.Clone(*metadata.buf))
+		flows = metadata.flows
+	}
+	select {
+	case c.mirrorProducer.Input() <- &sarama.ProducerMessage{
+		Topic:    topic,
+		Key:      msg.Key,
+		Value:    value,
+		Metadata: mirrorMetadata{flows: flows},
+	}:
+	default:
+		if flows > 0 {
+			c.metrics.mirrorDrops.WithLabelValues("queue full").Add(float64(flows))
+		}
+	}
+}
+
+// mirrorFlows returns the number of flows in a message sent to the mirror.
+func mirrorFlows(msg *sarama.ProducerMessage) int {
+	metadata, _ := msg.Metadata.(mirrorMetadata)
+	return metadata.flows
+}
@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// avroSubject returns the subject to use to register the Avro schema.
+func (c *Component) avroSubject() string {
+	switch c.config.SchemaRegistry.SubjectNameStrategy {
+	case RecordNameStrategy:
+		return c.avroEncoder.Name()
+	case TopicRecordNameStrategy:
+		return fmt.Sprintf("%s-%s", c.kafkaTopic, c.avroEncoder.Name())
+	default:
+		return fmt.Sprintf("%s-value", c.kafkaTopic)
+	}
+}
+
+// registerAvroSchema registers the Avro schema into the schema registry and
+// returns its ID. If the schema is already registered, the existing ID is
+// returned.
+func (c *Component) registerAvroSchema(ctx context.Context) (uint32, error) {
+	body, err := json.Marshal(struct {
+		Schema string `json:"schema"`
+	}{c.avroEncoder.Definition()})
+	if err != nil {
+		panic(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	endpoint := fmt.Sprintf("%s/subjects/%s/versions",
+		strings.TrimSuffix(c.config.SchemaRegistry.URL, "/"),
+		url.PathEscape(c.avroSubject()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("cannot build schema registry request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if c.config.SchemaRegistry.Username != "" {
+		req.SetBasicAuth(c.config.SchemaRegistry.Username, c.config.SchemaRegistry.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("cannot query schema registry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("unexpected status code %d from schema registry: %s",
+			resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	var result struct {
+		ID uint32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("cannot decode schema registry answer: %w", err)
+	}
+	return result.ID, nil
+}
+
+// avroMarshal turns a protobuf-encoded flow into an Avro message using the
+// schema registry wire format: a zero byte, the schema ID and the Avro
+// binary encoding of the flow.
+func (c *Component) avroMarshal(payload []byte) ([]byte, error) {
+	buf := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(buf[1:], c.avroSchemaID)
+	return c.avroEncoder.Marshal(buf, payload)
+}
@@ -5,19 +5,24 @@
 package kafka
 
 import (
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/IBM/sarama"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/kafka"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
+	"akvorado/inlet/pipeline"
 )
 
 // Component represents the Kafka exporter.
@@ -28,10 +33,34 @@ type Component struct {
 	config Configuration
 
 	kafkaTopic          string
+	inventoryTopic      string
+	eventsTopic         string
+	probesTopic         string
 	kafkaConfig         *sarama.Config
 	kafkaProducer       sarama.AsyncProducer
+	kafkaProducerDying  <-chan struct{}
+	kafkaProducerLock   sync.RWMutex
 	createKafkaProducer func() (sarama.AsyncProducer, error)
 	metrics             metrics
+
+	mirrorConfig         *sarama.Config
+	mirrorTopics         map[string]string // main topic to mirror topic
+	mirrorProducer       sarama.AsyncProducer
+	createMirrorProducer func() (sarama.AsyncProducer, error)
+	drops                *pipeline.Drops
+
+	avroEncoder  *schema.AvroEncoder
+	avroSchemaID uint32
+
+	batches     map[string]*batch
+	batchesLock sync.RWMutex
+	batchPool   sync.Pool
+
+	// Last producer error, for readiness
+	lastErrorLock  sync.Mutex
+	lastError      time.Time
+	lastErrorMsg   string
+	lastErrorCause error
 }
 
 // Dependencies define the dependencies of the Kafka exporter.
@@ -50,7 +79,7 @@ func New(reporter *reporter.Reporter, configuration Configuration, dependencies
 	kafkaConfig.Metadata.AllowAutoTopicCreation = true
 	kafkaConfig.Producer.MaxMessageBytes = configuration.MaxMessageBytes
 	kafkaConfig.Producer.Compression = sarama.CompressionCodec(configuration.CompressionCodec)
-	kafkaConfig.Producer.Return.Successes = false
+	kafkaConfig.Producer.Return.Successes = configuration.BatchMaxBytes > 0
 	kafkaConfig.Producer.Return.Errors = true
 	kafkaConfig.Producer.Flush.Bytes = configuration.FlushBytes
 	kafkaConfig.Producer.Flush.Frequency = configuration.FlushInterval
@@ -59,16 +88,64 @@ func New(reporter *reporter.Reporter, configuration Configuration, dependencies
 	if err := kafkaConfig.Validate(); err != nil {
 		return nil, fmt.Errorf("cannot validate Kafka configuration: %w", err)
 	}
+	if configuration.Encoding == EncodingAvro && configuration.SchemaRegistry.URL == "" {
+		return nil, errors.New("a schema registry URL is required for Avro encoding")
+	}
+	if configuration.BatchMaxBytes > 0 && configuration.Encoding != EncodingProtobuf {
+		return nil, errors.New("batching is only possible with protobuf encoding")
+	}
+	if configuration.BatchMaxBytes > 0 && configuration.PartitionKey == PartitionKeyFlowHash {
+		return nil, errors.New("batching is not possible with flow-hash partition key")
+	}
+	var mirrorConfig *sarama.Config
+	if configuration.Mirror.Enable {
+		mirrorConfig, err = kafka.NewConfig(configuration.Mirror.Configuration)
+		if err != nil {
+			return nil, fmt.Errorf("cannot build Kafka mirror configuration: %w", err)
+		}
+		mirrorConfig.Metadata.AllowAutoTopicCreation = true
+		mirrorConfig.Producer = kafkaConfig.Producer
+		mirrorConfig.Producer.Return.Successes = false
+		mirrorConfig.ChannelBufferSize = kafkaConfig.ChannelBufferSize
+		if err := mirrorConfig.Validate(); err != nil {
+			return nil, fmt.Errorf("cannot validate Kafka mirror configuration: %w", err)
+		}
+	}
 
 	c := Component{
 		r:      reporter,
 		d:      &dependencies,
 		config: configuration,
 
-		kafkaConfig: kafkaConfig,
-		kafkaTopic:  fmt.Sprintf("%s-%s", configuration.Topic, dependencies.Schema.ProtobufMessageHash()),
+		kafkaConfig:    kafkaConfig,
+		kafkaTopic:     fmt.Sprintf("%s-%s", configuration.Topic, dependencies.Schema.ProtobufMessageHash()),
+		inventoryTopic: fmt.Sprintf("%s-inventory", configuration.Topic),
+		eventsTopic:    fmt.Sprintf("%s-events", configuration.Topic),
+		probesTopic:    fmt.Sprintf("%s-probes", configuration.Topic),
+		drops:          pipeline.NewDrops(reporter),
+		batches:        make(map[string]*batch),
+	}
+	if mirrorConfig != nil {
+		c.mirrorConfig = mirrorConfig
+		c.mirrorTopics = map[string]string{
+			c.kafkaTopic:     fmt.Sprintf("%s-%s", configuration.Mirror.Topic, dependencies.Schema.ProtobufMessageHash()),
+			c.inventoryTopic: fmt.Sprintf("%s-inventory", configuration.Mirror.Topic),
+			c.eventsTopic:    fmt.Sprintf("%s-events", configuration.Mirror.Topic),
+			c.probesTopic:    fmt.Sprintf("%s-probes", configuration.Mirror.Topic),
+		}
+		c.createMirrorProducer = func() (sarama.AsyncProducer, error) {
+			return sarama.NewAsyncProducer(c.config.Mirror.Brokers, c.mirrorConfig)
+		}
+	}
+	c.batchPool.New = func() any {
+		buf := make([]byte, 0, configuration.BatchMaxBytes)
+		return &buf
+	}
+	if configuration.Encoding == EncodingAvro {
+		c.avroEncoder = dependencies.Schema.NewAvroEncoder()
 	}
 	c.initMetrics()
+	c.trackAuthenticationFailures()
 	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
 		return sarama.NewAsyncProducer(c.config.Brokers, c.kafkaConfig)
 	}
@@ -81,6 +158,22 @@ func (c *Component) Start() error {
 	c.r.Info().Msg("starting Kafka component")
 	kafka.GlobalKafkaLogger.Register(c.r)
 
+	// Register Avro schema
+	if c.avroEncoder != nil {
+		id, err := c.registerAvroSchema(c.t.Context(nil))
+		if err != nil {
+			c.r.Err(err).
+				Str("registry", c.config.SchemaRegistry.URL).
+				Msg("unable to register Avro schema")
+			return fmt.Errorf("unable to register Avro schema: %w", err)
+		}
+		c.avroSchemaID = id
+		c.r.Info().
+			Str("subject", c.avroSubject()).
+			Uint32("id", id).
+			Msg("Avro schema registered")
+	}
+
 	// Create producer
 	kafkaProducer, err := c.createKafkaProducer()
 	if err != nil {
@@ -89,27 +182,113 @@ func (c *Component) Start() error {
 			Msg("unable to create async producer")
 		return fmt.Errorf("unable to create Kafka async producer: %w", err)
 	}
+	var mirrorProducer sarama.AsyncProducer
+	if c.createMirrorProducer != nil {
+		mirrorProducer, err = c.createMirrorProducer()
+		if err != nil {
+			kafkaProducer.Close()
+			c.r.Err(err).
+				Str("brokers", strings.Join(c.config.Mirror.Brokers, ",")).
+				Msg("unable to create mirror async producer")
+			return fmt.Errorf("unable to create Kafka mirror async producer: %w", err)
+		}
+	}
+	c.kafkaProducerLock.Lock()
 	c.kafkaProducer = kafkaProducer
+	c.kafkaProducerDying = c.t.Dying()
+	c.mirrorProducer = mirrorProducer
+	c.kafkaProducerLock.Unlock()
+	c.r.RegisterReadinessCheck("kafka", c.producerHealthcheck)
 
-	// Main loop
+	// Process the results of the producers. This is done in a dedicated
+	// goroutine as the producers block when their results are not read. It
+	// stops once the producers are closed.
 	c.t.Go(func() error {
-		defer kafkaProducer.Close()
 		defer c.kafkaConfig.MetricRegistry.UnregisterAll()
 		errLogger := c.r.Sample(reporter.BurstSampler(10*time.Second, 3))
+		successes := kafkaProducer.Successes()
+		producerErrors := kafkaProducer.Errors()
+		var mirrorErrors <-chan *sarama.ProducerError
+		if mirrorProducer != nil {
+			defer c.mirrorConfig.MetricRegistry.UnregisterAll()
+			mirrorErrors = mirrorProducer.Errors()
+		}
+		for successes != nil || producerErrors != nil || mirrorErrors != nil {
+			select {
+			case msg, ok := <-successes:
+				if !ok {
+					successes = nil
+					continue
+				}
+				c.recycleBatch(msg)
+			case msg, ok := <-producerErrors:
+				if !ok {
+					producerErrors = nil
+					continue
+				}
+				flows := c.recycleBatch(msg.Msg)
+				c.metrics.errors.WithLabelValues(msg.Error()).Inc()
+				if errors.Is(msg.Err, sarama.ErrSASLAuthenticationFailed) {
+					c.metrics.authenticationFailures.WithLabelValues("broker").Inc()
+				}
+				c.drops.Add(pipeline.StageOutput, flows)
+				c.lastErrorLock.Lock()
+				c.lastError = time.Now()
+				c.lastErrorMsg = msg.Error()
+				c.lastErrorCause = classifyError(msg.Err)
+				c.lastErrorLock.Unlock()
+				errLogger.Err(msg.Err).
+					Stringer("class", helpers.ErrorClassOf(c.lastErrorCause)).
+					Str("topic", msg.Msg.Topic).
+					Int64("offset", msg.Msg.Offset).
+					Int32("partition", msg.Msg.Partition).
+					Msg("Kafka producer error")
+			case msg, ok := <-mirrorErrors:
+				if !ok {
+					mirrorErrors = nil
+					continue
+				}
+				c.metrics.mirrorErrors.WithLabelValues(msg.Error()).Inc()
+				if flows := mirrorFlows(msg.Msg); flows > 0 {
+					c.metrics.mirrorDrops.WithLabelValues("error").Add(float64(flows))
+				}
+				errLogger.Err(msg.Err).
+					Str("topic", msg.Msg.Topic).
+					Msg("Kafka mirror producer error")
+			}
+		}
+		return nil
+	})
+
+	// Main loop: flush batches and close the producers when stopping
+	c.t.Go(func() error {
+		defer func() {
+			c.kafkaProducerLock.Lock()
+			defer c.kafkaProducerLock.Unlock()
+			kafkaProducer.AsyncClose()
+			c.kafkaProducer = nil
+			if mirrorProducer != nil {
+				mirrorProducer.AsyncClose()
+				c.mirrorProducer = nil
+			}
+		}()
+		var batchTicker <-chan time.Time
+		if c.config.BatchMaxBytes > 0 {
+			ticker := time.NewTicker(c.config.BatchMaxLatency)
+			defer ticker.Stop()
+			batchTicker = ticker.C
+		}
 		for {
 			select {
 			case <-c.t.Dying():
-				c.r.Debug().Msg("stop error logger")
+				// Pending batches are sent before closing the producers.
+				// As the component is stopping, the sends should not be
+				// aborted.
+				c.r.Debug().Msg("stop Kafka producer")
+				c.flushBatches(false)
 				return nil
-			case msg := <-kafkaProducer.Errors():
-				if msg != nil {
-					c.metrics.errors.WithLabelValues(msg.Error()).Inc()
-					errLogger.Err(msg.Err).
-						Str("topic", msg.Msg.Topic).
-						Int64("offset", msg.Msg.Offset).
-						Int32("partition", msg.Msg.Partition).
-						Msg("Kafka producer error")
-				}
+			case <-batchTicker:
+				c.flushBatches(true)
 			}
 		}
 	})
@@ -127,15 +306,141 @@ func (c *Component) Stop() error {
 	return c.t.Wait()
 }
 
-// Send a message to Kafka.
-func (c *Component) Send(exporter string, payload []byte) {
+// Restart stops and starts the Kafka component again, without stopping the
+// inlet. Messages sent while the producer is not running are dropped.
+func (c *Component) Restart() error {
+	c.r.Info().Msg("restarting Kafka component")
+	return c.d.Daemon.Restart(&c.t, c.Stop, c.Start)
+}
+
+// produce sends a message to the Kafka producer. It returns false when the
+// producer is not running, for example when the component is restarting. When
+// a mirror is configured, a copy is sent to it too. Failures to send to the
+// mirror are accounted separately and do not impact the main producer. When
+// the producer is full, the send is aborted once the component is stopping:
+// the producer can only be closed once no message is being sent to it.
+func (c *Component) produce(msg *sarama.ProducerMessage) bool {
+	return c.produceWithAbort(msg, true)
+}
+
+// produceWithAbort sends a message to the Kafka producer. When abortOnStop is
+// false, the send is not aborted when the component is stopping. This is only
+// safe from the goroutine closing the producer.
+func (c *Component) produceWithAbort(msg *sarama.ProducerMessage, abortOnStop bool) bool {
+	c.kafkaProducerLock.RLock()
+	defer c.kafkaProducerLock.RUnlock()
+	if c.kafkaProducer == nil {
+		return false
+	}
+	if c.mirrorProducer != nil {
+		c.mirror(msg)
+	}
+	var dying <-chan struct{}
+	if abortOnStop {
+		dying = c.kafkaProducerDying
+	}
+	select {
+	case c.kafkaProducer.Input() <- msg:
+		return true
+	case <-dying:
+		return false
+	}
+}
+
+// producerErrorWindow is the duration during which a producer error makes
+// the Kafka component not ready.
+const producerErrorWindow = 30 * time.Second
+
+// producerHealthcheck checks if the Kafka producer is able to send messages,
+// by looking at the last error it returned. Configuration and permanent
+// errors make the check fail while other errors only trigger a warning.
+func (c *Component) producerHealthcheck(_ context.Context) reporter.HealthcheckResult {
+	c.lastErrorLock.Lock()
+	defer c.lastErrorLock.Unlock()
+	if !c.lastError.IsZero() && time.Since(c.lastError) < producerErrorWindow {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckStatusForError(c.lastErrorCause),
+			Reason: fmt.Sprintf("producer error: %s", c.lastErrorMsg),
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "producer ready"}
+}
+
+// PartitionKey returns the key to use to send the provided flow, depending on
+// the configured partitioning strategy. It should be called before the flow is
+// encoded. A nil key means the flow is assigned to a random partition.
+func (c *Component) PartitionKey(exporter string, flow *schema.FlowMessage) []byte {
+	switch c.config.PartitionKey {
+	case PartitionKeyExporter:
+		return []byte(exporter)
+	case PartitionKeyFlowHash:
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, c.d.Schema.FlowHash(flow))
+		return key
+	default:
+		return nil
+	}
+}
+
+// Send a message to Kafka. The payload is a protobuf-encoded flow. It is
+// converted to Avro if needed. The key is used to choose the partition. When
+// nil, a random key is used. When batching is enabled, the payload is copied
+// into the batch of the exporter and the key is ignored.
+func (c *Component) Send(exporter string, key []byte, payload []byte) {
+	if c.avroEncoder != nil {
+		var err error
+		payload, err = c.avroMarshal(payload)
+		if err != nil {
+			c.metrics.errors.WithLabelValues("cannot encode to Avro").Inc()
+			c.drops.Add(pipeline.StageOutput, 1)
+			return
+		}
+	}
 	c.metrics.bytesSent.WithLabelValues(exporter).Add(float64(len(payload)))
 	c.metrics.messagesSent.WithLabelValues(exporter).Inc()
-	key := make([]byte, 4)
-	binary.BigEndian.PutUint32(key, rand.Uint32())
-	c.kafkaProducer.Input() <- &sarama.ProducerMessage{
+	if c.config.BatchMaxBytes > 0 && len(payload) <= c.config.BatchMaxBytes {
+		c.sendBatched(exporter, payload)
+		return
+	}
+	if key == nil {
+		key = make([]byte, 4)
+		binary.BigEndian.PutUint32(key, rand.Uint32())
+	}
+	if !c.produce(&sarama.ProducerMessage{
 		Topic: c.kafkaTopic,
 		Key:   sarama.ByteEncoder(key),
 		Value: sarama.ByteEncoder(payload),
+	}) {
+		c.drops.Add(pipeline.StageOutput, 1)
 	}
 }
+
+// SendInventory sends an inventory message to Kafka. These messages use a
+// dedicated topic and are not accounted as flows.
+func (c *Component) SendInventory(exporter string, payload []byte) {
+	c.produce(&sarama.ProducerMessage{
+		Topic: c.inventoryTopic,
+		Key:   sarama.StringEncoder(exporter),
+		Value: sarama.ByteEncoder(payload),
+	})
+}
+
+// SendProbes sends a message with probe results to Kafka. These messages use a
+// dedicated topic and are not accounted as flows.
+func (c *Component) SendProbes(probe string, payload []byte) {
+	c.produce(&sarama.ProducerMessage{
+		Topic: c.probesTopic,
+		Key:   sarama.StringEncoder(probe),
+		Value: sarama.ByteEncoder(payload),
+	})
+}
+
+// SendEvent sends an event about an exporter to Kafka. These messages use a
+// dedicated topic and are not accounted as flows.
+func (c *Component) SendEvent(exporter string, payload []byte) {
+	c.produce(&sarama.ProducerMessage{
+		Topic: c.eventsTopic,
+		Key:   sarama.StringEncoder(exporter),
+		Value: sarama.ByteEncoder(payload),
+	})
+}
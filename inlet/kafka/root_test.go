@@ -4,16 +4,25 @@
 package kafka
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
 	gometrics "github.com/rcrowley/go-metrics"
 
 	"akvorado/common/daemon"
 	"akvorado/common/helpers"
+	"akvorado/common/kafka"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 )
@@ -21,6 +30,14 @@ import (
 func TestKafka(t *testing.T) {
 	r := reporter.NewMock(t)
 	c, mockProducer := NewMock(t, r, DefaultConfiguration())
+	checkHealth := func(expected reporter.HealthcheckResult) {
+		t.Helper()
+		got := r.RunHealthchecks(context.Background())
+		if diff := helpers.Diff(got.Details["kafka"].HealthcheckResult, expected); diff != "" {
+			t.Fatalf("RunHealthchecks() (-got, +want):\n%s", diff)
+		}
+	}
+	checkHealth(reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "producer ready"})
 
 	// Send one message
 	received := make(chan bool)
@@ -37,7 +54,7 @@ func TestKafka(t *testing.T) {
 		}
 		return nil
 	})
-	c.Send("127.0.0.1", []byte("hello world!"))
+	c.Send("127.0.0.1", nil, []byte("hello world!"))
 	select {
 	case <-received:
 	case <-time.After(1 * time.Second):
@@ -46,7 +63,7 @@ func TestKafka(t *testing.T) {
 
 	// Another but with a fail
 	mockProducer.ExpectInputAndFail(errors.New("noooo"))
-	c.Send("127.0.0.1", []byte("goodbye world!"))
+	c.Send("127.0.0.1", nil, []byte("goodbye world!"))
 
 	time.Sleep(10 * time.Millisecond)
 	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_")
@@ -58,6 +75,87 @@ func TestKafka(t *testing.T) {
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
 	}
+	checkHealth(reporter.HealthcheckResult{
+		Status: reporter.HealthcheckWarning,
+		Reason: fmt.Sprintf("producer error: kafka: Failed to produce message to topic flows-%s: noooo",
+			c.d.Schema.ProtobufMessageHash()),
+	})
+}
+
+func TestKafkaRestart(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, _ := NewMock(t, r, DefaultConfiguration())
+
+	var mockProducer *mocks.AsyncProducer
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		mockProducer = mocks.NewAsyncProducer(t, c.kafkaConfig)
+		return mockProducer, nil
+	}
+	if err := c.Restart(); err != nil {
+		t.Fatalf("Restart() error:\n%+v", err)
+	}
+
+	// The new producer is used
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		value, _ := got.Value.Encode()
+		if diff := helpers.Diff(string(value), "hello world!"); diff != "" {
+			t.Fatalf("Send() (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", nil, []byte("hello world!"))
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+}
+
+// stuckProducer is a producer never accepting messages.
+type stuckProducer struct {
+	*mocks.AsyncProducer
+	input chan *sarama.ProducerMessage
+}
+
+func (p stuckProducer) Input() chan<- *sarama.ProducerMessage {
+	return p.input
+}
+
+func TestKafkaRestartWhileSending(t *testing.T) {
+	r := reporter.NewMock(t)
+	c, _ := NewMock(t, r, DefaultConfiguration())
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		return stuckProducer{
+			AsyncProducer: mocks.NewAsyncProducer(t, c.kafkaConfig),
+			input:         make(chan *sarama.ProducerMessage),
+		}, nil
+	}
+	if err := c.Restart(); err != nil {
+		t.Fatalf("Restart() error:\n%+v", err)
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		c.Send("127.0.0.1", nil, []byte("hello world!"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	restarted := make(chan error)
+	go func() {
+		restarted <- c.Restart()
+	}()
+	select {
+	case err := <-restarted:
+		if err != nil {
+			t.Fatalf("Restart() error:\n%+v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Restart() blocked by a pending message")
+	}
+	<-sent
 }
 
 func TestKafkaMetrics(t *testing.T) {
@@ -103,3 +201,392 @@ func TestKafkaMetrics(t *testing.T) {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
 	}
 }
+
+func TestKafkaAvro(t *testing.T) {
+	var gotSubject, gotUser, gotPassword, gotContentType string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSubject = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/subjects/"), "/versions")
+		gotUser, gotPassword, _ = r.BasicAuth()
+		gotContentType = r.Header.Get("Content-Type")
+		var body struct {
+			Schema string `json:"schema"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Schema == "" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		w.Write([]byte(`{"id": 42}`))
+	}))
+	defer registry.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Encoding = EncodingAvro
+	configuration.SchemaRegistry.URL = registry.URL
+	configuration.SchemaRegistry.Username = "akvorado"
+	configuration.SchemaRegistry.Password = "secret"
+	c, mockProducer := NewMock(t, r, configuration)
+
+	expectedSubject := fmt.Sprintf("flows-%s-value", c.d.Schema.ProtobufMessageHash())
+	if diff := helpers.Diff([]string{gotSubject, gotUser, gotPassword, gotContentType}, []string{
+		expectedSubject, "akvorado", "secret", "application/vnd.schemaregistry.v1+json",
+	}); diff != "" {
+		t.Fatalf("Schema registration (-got, +want):\n%s", diff)
+	}
+
+	bf := &schema.FlowMessage{TimeReceived: 1000, SamplingRate: 20000}
+	payload := c.d.Schema.ProtobufMarshal(bf)
+	expectedValue, err := c.d.Schema.NewAvroEncoder().Marshal([]byte{0, 0, 0, 0, 42}, payload)
+	if err != nil {
+		t.Fatalf("Marshal() error:\n%+v", err)
+	}
+	received := make(chan bool)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(got *sarama.ProducerMessage) error {
+		defer close(received)
+		value, _ := got.Value.Encode()
+		if diff := helpers.Diff(value, expectedValue); diff != "" {
+			t.Fatalf("Send() (-got, +want):\n%s", diff)
+		}
+		return nil
+	})
+	c.Send("127.0.0.1", nil, payload)
+	select {
+	case <-received:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Kafka message not received")
+	}
+
+	// Invalid payload
+	c.Send("127.0.0.1", nil, []byte("hello world!"))
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "errors_")
+	expectedMetrics := map[string]string{
+		`errors_total{error="cannot encode to Avro"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestAvroSubject(t *testing.T) {
+	cases := []struct {
+		Strategy SubjectNameStrategy
+		Expected string
+	}{
+		{TopicNameStrategy, "flows-%[1]s-value"},
+		{RecordNameStrategy, "akvorado.FlowMessagev%[1]s"},
+		{TopicRecordNameStrategy, "flows-%[1]s-akvorado.FlowMessagev%[1]s"},
+	}
+	for _, tc := range cases {
+		configuration := DefaultConfiguration()
+		configuration.Encoding = EncodingAvro
+		configuration.SchemaRegistry.URL = "http://127.0.0.1:8081"
+		configuration.SchemaRegistry.SubjectNameStrategy = tc.Strategy
+		c, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		expected := fmt.Sprintf(tc.Expected, c.d.Schema.ProtobufMessageHash())
+		if got := c.avroSubject(); got != expected {
+			t.Errorf("avroSubject(%s) == %q, expected %q", tc.Strategy, got, expected)
+		}
+	}
+}
+
+func TestKafkaAvroWithoutRegistry(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.Encoding = EncodingAvro
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)}); err == nil {
+		t.Fatal("New() should trigger an error")
+	}
+}
+
+func TestKafkaOAuthFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "invalid client", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.TLS.Enable = true
+	configuration.TLS.SASLUsername = "hello"
+	configuration.TLS.SASLPassword = "password"
+	configuration.TLS.SASLMechanism = kafka.SASLOAuth
+	configuration.TLS.SASLOAuthTokenURL = server.URL
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, err := c.kafkaConfig.Net.SASL.TokenProvider.Token(); err == nil {
+		t.Fatal("Token() did not error")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "authentication_")
+	expectedMetrics := map[string]string{
+		`authentication_failures_total{reason="token"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestPartitionKey(t *testing.T) {
+	sch := schema.NewMock(t)
+	flow := func(srcAddr, dstAddr string, srcPort, dstPort uint64) *schema.FlowMessage {
+		bf := &schema.FlowMessage{
+			SrcAddr: netip.MustParseAddr(srcAddr),
+			DstAddr: netip.MustParseAddr(dstAddr),
+		}
+		sch.ProtobufAppendVarint(bf, schema.ColumnProto, 6)
+		sch.ProtobufAppendVarint(bf, schema.ColumnSrcPort, srcPort)
+		sch.ProtobufAppendVarint(bf, schema.ColumnDstPort, dstPort)
+		return bf
+	}
+	forward := flow("::ffff:192.0.2.1", "::ffff:198.51.100.1", 34567, 443)
+	reverse := flow("::ffff:198.51.100.1", "::ffff:192.0.2.1", 443, 34567)
+
+	for _, tc := range []struct {
+		PartitionKey PartitionKey
+		Forward      []byte
+		Reverse      []byte
+	}{
+		{PartitionKeyRandom, nil, nil},
+		{PartitionKeyExporter, []byte("127.0.0.1"), []byte("127.0.0.1")},
+	} {
+		configuration := DefaultConfiguration()
+		configuration.PartitionKey = tc.PartitionKey
+		c, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: sch})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		got := [][]byte{c.PartitionKey("127.0.0.1", forward), c.PartitionKey("127.0.0.1", reverse)}
+		if diff := helpers.Diff(got, [][]byte{tc.Forward, tc.Reverse}); diff != "" {
+			t.Errorf("PartitionKey(%s) (-got, +want):\n%s", tc.PartitionKey, diff)
+		}
+	}
+
+	configuration := DefaultConfiguration()
+	configuration.PartitionKey = PartitionKeyFlowHash
+	c, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: sch})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	forwardKey := c.PartitionKey("127.0.0.1", forward)
+	if len(forwardKey) != 8 {
+		t.Fatalf("PartitionKey(flow-hash) == %v, expected 8 bytes", forwardKey)
+	}
+	if diff := helpers.Diff(c.PartitionKey("127.0.0.2", reverse), forwardKey); diff != "" {
+		t.Fatalf("PartitionKey(flow-hash) for reverse flow (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaBatching(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchMaxBytes = 30
+	configuration.BatchMaxLatency = 100 * time.Millisecond
+	configuration.PartitionKey = PartitionKeyExporter
+	c, mockProducer := NewMock(t, r, configuration)
+
+	received := make(chan string, 2)
+	checker := func(got *sarama.ProducerMessage) error {
+		if diff := helpers.Diff(got.Key, sarama.ByteEncoder("127.0.0.1")); diff != "" {
+			t.Errorf("Send() key (-got, +want):\n%s", diff)
+		}
+		value, _ := got.Value.Encode()
+		received <- string(value)
+		return nil
+	}
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+
+	// The third message does not fit in the first batch
+	for _, payload := range []string{"hello world!", "hello world!", "goodbye world!"} {
+		c.Send("127.0.0.1", nil, []byte(payload))
+	}
+	for _, expected := range []string{"hello world!hello world!", "goodbye world!"} {
+		select {
+		case got := <-received:
+			if diff := helpers.Diff(got, expected); diff != "" {
+				t.Fatalf("Send() (-got, +want):\n%s", diff)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Kafka message not received")
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "sent_", "batch_flows_count", "batch_flows_sum")
+	expectedMetrics := map[string]string{
+		`sent_bytes_total{exporter="127.0.0.1"}`:    "38",
+		`sent_messages_total{exporter="127.0.0.1"}`: "3",
+		`sent_batches_total{exporter="127.0.0.1"}`:  "2",
+		`batch_flows_count{exporter="127.0.0.1"}`:   "2",
+		`batch_flows_sum{exporter="127.0.0.1"}`:     "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaBatchingManyExporters(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchMaxBytes = 100
+	configuration.BatchMaxLatency = 50 * time.Millisecond
+	c, mockProducer := NewMock(t, r, configuration)
+
+	// Flushing more batches than the producer can buffer should not block
+	// the processing of its results.
+	exporters := 10 * c.kafkaConfig.ChannelBufferSize
+	received := make(chan struct{}, exporters)
+	for i := 0; i < exporters; i++ {
+		mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(*sarama.ProducerMessage) error {
+			received <- struct{}{}
+			return nil
+		})
+	}
+	for i := 0; i < exporters; i++ {
+		c.Send(fmt.Sprintf("192.0.2.%d", i), nil, []byte("hello world!"))
+	}
+	for i := 0; i < exporters; i++ {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("Kafka message %d not received", i)
+		}
+	}
+}
+
+func TestKafkaBatchingFlushOnStop(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.BatchMaxBytes = 100
+	configuration.BatchMaxLatency = time.Hour
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	var mockProducer *mocks.AsyncProducer
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		mockProducer = mocks.NewAsyncProducer(t, c.kafkaConfig)
+		return mockProducer, nil
+	}
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error:\n%+v", err)
+	}
+
+	// Pending batches are all sent when stopping
+	exporters := 50
+	received := make(chan struct{}, exporters)
+	for i := 0; i < exporters; i++ {
+		mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(func(*sarama.ProducerMessage) error {
+			received <- struct{}{}
+			return nil
+		})
+	}
+	for i := 0; i < exporters; i++ {
+		c.Send(fmt.Sprintf("192.0.2.%d", i), nil, []byte("hello world!"))
+	}
+	if err := c.Stop(); err != nil {
+		t.Fatalf("Stop() error:\n%+v", err)
+	}
+	if got := len(received); got != exporters {
+		t.Fatalf("Stop() sent %d batches instead of %d", got, exporters)
+	}
+	gotMetrics := r.GetMetrics("akvorado_inlet_pipeline_", `dropped_flows_total{stage="output"}`)
+	expectedMetrics := map[string]string{
+		`dropped_flows_total{stage="output"}`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestKafkaBatchingIncompatible(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.BatchMaxBytes = 10000
+	configuration.PartitionKey = PartitionKeyFlowHash
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error with flow-hash partition key")
+	}
+	configuration.PartitionKey = PartitionKeyRandom
+	configuration.Encoding = EncodingAvro
+	configuration.SchemaRegistry.URL = "http://127.0.0.1:8081"
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error with Avro encoding")
+	}
+}
+
+func TestKafkaMirror(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Mirror.Enable = true
+	configuration.Mirror.Topic = "flows-new"
+	c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t), Schema: schema.NewMock(t)})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	var mockProducer, mockMirror *mocks.AsyncProducer
+	c.createKafkaProducer = func() (sarama.AsyncProducer, error) {
+		mockProducer = mocks.NewAsyncProducer(t, c.kafkaConfig)
+		return mockProducer, nil
+	}
+	c.createMirrorProducer = func() (sarama.AsyncProducer, error) {
+		mockMirror = mocks.NewAsyncProducer(t, c.mirrorConfig)
+		return mockMirror, nil
+	}
+	helpers.StartStop(t, c)
+
+	received := make(chan string, 4)
+	checker := func(got *sarama.ProducerMessage) error {
+		value, _ := got.Value.Encode()
+		received <- fmt.Sprintf("%s: %s", got.Topic, value)
+		return nil
+	}
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+	mockProducer.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+	mockMirror.ExpectInputAndFail(errors.New("noooo"))
+	mockMirror.ExpectInputWithMessageCheckerFunctionAndSucceed(checker)
+	c.Send("127.0.0.1", nil, []byte("hello world!"))
+	c.SendEvent("127.0.0.1", []byte("event"))
+
+	got := []string{}
+	for i := 0; i < 3; i++ {
+		select {
+		case msg := <-received:
+			got = append(got, msg)
+		case <-time.After(time.Second):
+			t.Fatal("Kafka message not received")
+		}
+	}
+	slices.Sort(got)
+	hash := c.d.Schema.ProtobufMessageHash()
+	expected := []string{
+		fmt.Sprintf("flows-%s: hello world!", hash),
+		"flows-events: event",
+		"flows-new-events: event",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Send() (-got, +want):\n%s", diff)
+	}
+
+	// Errors on the mirror are accounted separately
+	time.Sleep(10 * time.Millisecond)
+	gotMetrics := r.GetMetrics("akvorado_inlet_kafka_", "mirror_", "errors_")
+	expectedMetrics := map[string]string{
+		`mirror_dropped_flows_total{reason="error"}`: "1",
+		fmt.Sprintf(`mirror_errors_total{error="kafka: Failed to produce message to topic flows-new-%s: noooo"}`, hash): "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+	gotMetrics = r.GetMetrics("akvorado_inlet_pipeline_", `dropped_flows_total{stage="output"}`)
+	expectedMetrics = map[string]string{
+		`dropped_flows_total{stage="output"}`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -4,10 +4,16 @@
 package metadata
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
 	"net/netip"
+	"slices"
 	"time"
 
 	"akvorado/common/helpers/cache"
+	"akvorado/common/persist"
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
 )
@@ -21,10 +27,11 @@ type metadataCache struct {
 	cache *cache.Cache[provider.Query, provider.Answer]
 
 	metrics struct {
-		cacheHit     reporter.Counter
-		cacheMiss    reporter.Counter
-		cacheExpired reporter.Counter
-		cacheSize    reporter.GaugeFunc
+		cacheHit         reporter.CounterFunc
+		cacheMiss        reporter.CounterFunc
+		cacheExpired     reporter.Counter
+		cacheInvalidated reporter.Counter
+		cacheSize        reporter.GaugeFunc
 	}
 }
 
@@ -33,21 +40,32 @@ func newMetadataCache(r *reporter.Reporter) *metadataCache {
 		r:     r,
 		cache: cache.New[provider.Query, provider.Answer](),
 	}
-	sc.metrics.cacheHit = r.Counter(
+	sc.metrics.cacheHit = r.CounterFunc(
 		reporter.CounterOpts{
 			Name: "cache_hits_total",
 			Help: "Number of lookups retrieved from cache.",
+		}, func() float64 {
+			hits, _, _ := sc.cache.Stats()
+			return float64(hits)
 		})
-	sc.metrics.cacheMiss = r.Counter(
+	sc.metrics.cacheMiss = r.CounterFunc(
 		reporter.CounterOpts{
 			Name: "cache_misses_total",
 			Help: "Number of lookup miss.",
+		}, func() float64 {
+			_, misses, _ := sc.cache.Stats()
+			return float64(misses)
 		})
 	sc.metrics.cacheExpired = r.Counter(
 		reporter.CounterOpts{
 			Name: "cache_expired_entries_total",
 			Help: "Number of cache entries expired.",
 		})
+	sc.metrics.cacheInvalidated = r.Counter(
+		reporter.CounterOpts{
+			Name: "cache_invalidated_entries_total",
+			Help: "Number of cache entries manually invalidated.",
+		})
 	sc.metrics.cacheSize = r.GaugeFunc(
 		reporter.GaugeOpts{
 			Name: "cache_size_entries",
@@ -61,13 +79,12 @@ func newMetadataCache(r *reporter.Reporter) *metadataCache {
 // Lookup will perform a lookup of the cache. It returns the exporter
 // name as well as the requested interface.
 func (sc *metadataCache) Lookup(t time.Time, query provider.Query) (provider.Answer, bool) {
-	result, ok := sc.cache.Get(t, query)
-	if !ok {
-		sc.metrics.cacheMiss.Inc()
-		return provider.Answer{}, false
-	}
-	sc.metrics.cacheHit.Inc()
-	return result, true
+	return sc.cache.Get(t, query)
+}
+
+// LookupMany performs several lookups of the cache at once.
+func (sc *metadataCache) LookupMany(t time.Time, queries []provider.Query) ([]provider.Answer, []bool) {
+	return sc.cache.GetMany(t, queries)
 }
 
 // Put a new entry in the cache.
@@ -82,6 +99,35 @@ func (sc *metadataCache) Expire(before time.Time) int {
 	return expired
 }
 
+// Invalidate removes entries for the provided exporter. When interfaces are
+// provided, only these ones are removed. When the exporter is not valid, all
+// entries are removed.
+func (sc *metadataCache) Invalidate(exporterIP netip.Addr, ifIndexes ...uint) int {
+	invalidated := sc.cache.DeleteMatching(func(k provider.Query) bool {
+		if !exporterIP.IsValid() {
+			return true
+		}
+		if k.ExporterIP != exporterIP {
+			return false
+		}
+		return len(ifIndexes) == 0 || slices.Contains(ifIndexes, k.IfIndex)
+	})
+	sc.metrics.cacheInvalidated.Add(float64(invalidated))
+	return invalidated
+}
+
+// Interfaces returns all the cached entries for the provided exporter, indexed
+// by interface index.
+func (sc *metadataCache) Interfaces(exporterIP netip.Addr) map[uint]provider.Answer {
+	result := map[uint]provider.Answer{}
+	for k, v := range sc.cache.Items() {
+		if k.ExporterIP == exporterIP {
+			result[k.IfIndex] = v
+		}
+	}
+	return result
+}
+
 // NeedUpdates returns a map of interface entries that would need to
 // be updated. It relies on last update.
 func (sc *metadataCache) NeedUpdates(before time.Time) map[netip.Addr][]uint {
@@ -96,12 +142,23 @@ func (sc *metadataCache) NeedUpdates(before time.Time) map[netip.Addr][]uint {
 	return result
 }
 
-// Save stores the cache to the provided location.
-func (sc *metadataCache) Save(cacheFile string) error {
-	return sc.cache.Save(cacheFile)
+// Save stores the cache to the provided stores.
+func (sc *metadataCache) Save(ctx context.Context, stores []persist.Store) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sc.cache); err != nil {
+		return fmt.Errorf("unable to encode cache: %w", err)
+	}
+	return persist.Save(ctx, stores, buf.Bytes())
 }
 
-// Load loads the cache from the provided location.
-func (sc *metadataCache) Load(cacheFile string) error {
-	return sc.cache.Load(cacheFile)
+// Load loads the cache from the first provided store with a saved cache.
+func (sc *metadataCache) Load(ctx context.Context, stores []persist.Store) error {
+	state, err := persist.Load(ctx, stores)
+	if err != nil {
+		return err
+	}
+	if err := gob.NewDecoder(bytes.NewReader(state)).Decode(sc.cache); err != nil {
+		return fmt.Errorf("unable to decode cache: %w", err)
+	}
+	return nil
 }
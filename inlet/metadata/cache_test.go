@@ -4,9 +4,9 @@
 package metadata
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/fs"
 	"math/rand"
 	"net/netip"
 	"path/filepath"
@@ -20,6 +20,7 @@ import (
 	"golang.org/x/exp/slices"
 
 	"akvorado/common/helpers"
+	"akvorado/common/persist"
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
 )
@@ -60,10 +61,11 @@ func TestGetEmpty(t *testing.T) {
 
 	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_")
 	expectedMetrics := map[string]string{
-		`expired_entries_total`: "0",
-		`hits_total`:            "0",
-		`misses_total`:          "1",
-		`size_entries`:          "0",
+		`expired_entries_total`:     "0",
+		`invalidated_entries_total`: "0",
+		`hits_total`:                "0",
+		`misses_total`:              "1",
+		`size_entries`:              "0",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -91,10 +93,11 @@ func TestSimpleLookup(t *testing.T) {
 
 	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_")
 	expectedMetrics := map[string]string{
-		`expired_entries_total`: "0",
-		`hits_total`:            "1",
-		`misses_total`:          "2",
-		`size_entries`:          "1",
+		`expired_entries_total`:     "0",
+		`invalidated_entries_total`: "0",
+		`hits_total`:                "1",
+		`misses_total`:              "2",
+		`size_entries`:              "1",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -175,10 +178,11 @@ func TestExpire(t *testing.T) {
 
 	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_")
 	expectedMetrics := map[string]string{
-		`expired_entries_total`: "3",
-		`hits_total`:            "7",
-		`misses_total`:          "6",
-		`size_entries`:          "1",
+		`expired_entries_total`:     "3",
+		`invalidated_entries_total`: "0",
+		`hits_total`:                "7",
+		`misses_total`:              "6",
+		`size_entries`:              "1",
 	}
 	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 		t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -233,6 +237,82 @@ func TestExpireRefresh(t *testing.T) {
 		Interface: provider.Interface{Name: "Gi0/0/0/1", Description: "IX"}})
 }
 
+func TestInvalidate(t *testing.T) {
+	r, sc := setupTestCache(t)
+	now := time.Now()
+	answer := provider.Answer{
+		Exporter:  provider.Exporter{Name: "localhost"},
+		Interface: provider.Interface{Name: "Gi0/0/0/1", Description: "Transit", Speed: 1000},
+	}
+	for _, exporter := range []string{"::ffff:127.0.0.1", "::ffff:127.0.0.2"} {
+		for _, ifIndex := range []uint{676, 678, 679} {
+			sc.Put(now, provider.Query{
+				ExporterIP: netip.MustParseAddr(exporter),
+				IfIndex:    ifIndex,
+			}, answer)
+		}
+	}
+
+	if count := sc.Invalidate(netip.MustParseAddr("::ffff:127.0.0.1"), 676, 679); count != 2 {
+		t.Errorf("Invalidate() returned %d, expected 2", count)
+	}
+	expectCacheLookup(t, sc, "127.0.0.1", 676, provider.Answer{})
+	expectCacheLookup(t, sc, "127.0.0.1", 678, answer)
+	expectCacheLookup(t, sc, "127.0.0.2", 676, answer)
+
+	if count := sc.Invalidate(netip.MustParseAddr("::ffff:127.0.0.2")); count != 3 {
+		t.Errorf("Invalidate() returned %d, expected 3", count)
+	}
+	expectCacheLookup(t, sc, "127.0.0.2", 678, provider.Answer{})
+
+	if count := sc.Invalidate(netip.Addr{}); count != 1 {
+		t.Errorf("Invalidate() returned %d, expected 1", count)
+	}
+	expectCacheLookup(t, sc, "127.0.0.1", 678, provider.Answer{})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_", "size_", "invalidated_")
+	expectedMetrics := map[string]string{
+		`size_entries`:              "0",
+		`invalidated_entries_total`: "6",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestInterfaces(t *testing.T) {
+	_, sc := setupTestCache(t)
+	now := time.Now()
+	answer := provider.Answer{
+		Exporter: provider.Exporter{Name: "localhost"},
+		Interface: provider.Interface{
+			Name:        "Gi0/0/0/1",
+			Description: "Transit",
+			Speed:       1000,
+			AdminStatus: provider.InterfaceStatusUp,
+			OperStatus:  provider.InterfaceStatusDown,
+		},
+	}
+	for _, exporter := range []string{"::ffff:127.0.0.1", "::ffff:127.0.0.2"} {
+		for _, ifIndex := range []uint{676, 678} {
+			sc.Put(now, provider.Query{
+				ExporterIP: netip.MustParseAddr(exporter),
+				IfIndex:    ifIndex,
+			}, answer)
+		}
+	}
+
+	got := sc.Interfaces(netip.MustParseAddr("::ffff:127.0.0.1"))
+	expected := map[uint]provider.Answer{676: answer, 678: answer}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Errorf("Interfaces() (-got, +want):\n%s", diff)
+	}
+	got = sc.Interfaces(netip.MustParseAddr("::ffff:127.0.0.3"))
+	if diff := helpers.Diff(got, map[uint]provider.Answer{}); diff != "" {
+		t.Errorf("Interfaces() (-got, +want):\n%s", diff)
+	}
+}
+
 func TestNeedUpdates(t *testing.T) {
 	_, sc := setupTestCache(t)
 	now := time.Now()
@@ -318,8 +398,8 @@ func TestNeedUpdates(t *testing.T) {
 
 func TestLoadNotExist(t *testing.T) {
 	_, sc := setupTestCache(t)
-	err := sc.Load("/i/do/not/exist")
-	if !errors.Is(err, fs.ErrNotExist) {
+	err := sc.Load(context.Background(), []persist.Store{persist.NewFileStore("/i/do/not/exist")})
+	if !errors.Is(err, persist.ErrNotFound) {
 		t.Fatalf("sc.Load() error:\n%s", err)
 	}
 }
@@ -355,14 +435,14 @@ func TestSaveLoad(t *testing.T) {
 			Interface: provider.Interface{Name: "Gi0/0/0/1", Description: "IX", Speed: 1000},
 		})
 
-	target := filepath.Join(t.TempDir(), "cache")
-	if err := sc.Save(target); err != nil {
+	target := []persist.Store{persist.NewFileStore(filepath.Join(t.TempDir(), "cache"))}
+	if err := sc.Save(context.Background(), target); err != nil {
 		t.Fatalf("sc.Save() error:\n%s", err)
 	}
 
 	_, sc = setupTestCache(t)
 	now = now.Add(10 * time.Minute)
-	if err := sc.Load(target); err != nil {
+	if err := sc.Load(context.Background(), target); err != nil {
 		t.Fatalf("sc.Load() error:\n%s", err)
 	}
 
@@ -456,9 +536,9 @@ func TestConcurrentOperations(t *testing.T) {
 	wg.Wait()
 
 	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_")
-	hits, _ := strconv.Atoi(gotMetrics["hits_total"])
-	misses, _ := strconv.Atoi(gotMetrics["misses_total"])
+	hits, _ := strconv.ParseFloat(gotMetrics["hits_total"], 64)
+	misses, _ := strconv.ParseFloat(gotMetrics["misses_total"], 64)
 	if int64(hits+misses) != atomic.LoadInt64(&lookups) {
-		t.Errorf("hit + miss = %d, expected %d", hits+misses, atomic.LoadInt64(&lookups))
+		t.Errorf("hit + miss = %.0f, expected %d", hits+misses, atomic.LoadInt64(&lookups))
 	}
 }
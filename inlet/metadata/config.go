@@ -4,13 +4,20 @@
 package metadata
 
 import (
+	"fmt"
+	"net/netip"
+	"reflect"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
+
 	"akvorado/common/helpers"
+	"akvorado/common/persist"
 	"akvorado/inlet/metadata/provider"
 	"akvorado/inlet/metadata/provider/gnmi"
 	"akvorado/inlet/metadata/provider/snmp"
 	"akvorado/inlet/metadata/provider/static"
+	"akvorado/inlet/metadata/provider/vendorapi"
 )
 
 // Configuration describes the configuration for the metadata client
@@ -23,14 +30,33 @@ type Configuration struct {
 	CacheCheckInterval time.Duration `validate:"ltefield=CacheRefresh,min=1s"`
 	// CachePersist defines a file to store cache and survive restarts
 	CachePersistFile string
+	// Redis defines the Redis server used to persist the cache and to share
+	// it with other inlets.
+	Redis persist.RedisConfiguration
+	// CachePersistRedis defines how to store the cache in Redis to survive
+	// restarts. It is useful when no local storage is available. When both
+	// are configured, the cache is loaded from Redis first.
+	CachePersistRedis persist.RedisStoreConfiguration
+	// TrackInterfaceRenumbering tells to detect when an exporter changes the
+	// name associated to an interface index (for example, after a reboot).
+	// When this happens, the change is recorded and the other interfaces of
+	// the exporter are refreshed.
+	TrackInterfaceRenumbering bool
+	// SharedCache defines a cache shared with other inlets to avoid
+	// polling the same exporters several times.
+	SharedCache SharedCacheConfiguration
 
-	// Provider defines the configuration of the provider to sue
-	Provider ProviderConfiguration
+	// Providers defines the configuration of the providers to use. They
+	// are tried in order until one of them answers.
+	Providers []ProviderConfiguration `validate:"dive"`
 
 	// Workers define the number of workers used to poll metadata
 	Workers int `validate:"min=1"`
 	// MaxBatchRequests define how many requests to pass to a worker at once if possible
 	MaxBatchRequests int `validate:"min=0"`
+	// Warmup defines how long, after a start with an empty cache, interfaces
+	// are polled by decreasing traffic volume instead of in request order.
+	Warmup time.Duration `validate:"min=0"`
 }
 
 // DefaultConfiguration represents the default configuration for the metadata provider.
@@ -42,11 +68,37 @@ func DefaultConfiguration() Configuration {
 		CachePersistFile:   "",
 		Workers:            1,
 		MaxBatchRequests:   10,
+		Warmup:             5 * time.Minute,
+		Redis: persist.RedisConfiguration{
+			Protocol: "tcp",
+		},
+		CachePersistRedis: persist.RedisStoreConfiguration{
+			Key: "akvorado:metadata:cache",
+		},
+		SharedCache: SharedCacheConfiguration{
+			Prefix:       "akvorado:metadata:",
+			LockDuration: 30 * time.Second,
+		},
 	}
 }
 
+// SharedCacheConfiguration describes the configuration of a Redis cache
+// shared between several inlets.
+type SharedCacheConfiguration struct {
+	// Enabled tells to share the cache through the configured Redis server.
+	Enabled bool
+	// Prefix is prepended to all the keys
+	Prefix string
+	// LockDuration defines how long an inlet can poll an exporter before
+	// another inlet is allowed to poll it too.
+	LockDuration time.Duration `validate:"min=1s"`
+}
+
 // ProviderConfiguration represents the configuration for a metadata provider.
 type ProviderConfiguration struct {
+	// ExporterSubnets restricts the provider to the exporters in the
+	// provided subnets. When empty, the provider handles all exporters.
+	ExporterSubnets []netip.Prefix
 	// Config is the actual configuration for the provider.
 	Config provider.Configuration
 }
@@ -65,9 +117,47 @@ var providers = map[string](func() provider.Configuration){
 	"snmp":   snmp.DefaultConfiguration,
 	"gnmi":   gnmi.DefaultConfiguration,
 	"static": static.DefaultConfiguration,
+	"eapi":   vendorapi.DefaultEAPIConfiguration,
+	"nxapi":  vendorapi.DefaultNXAPIConfiguration,
+}
+
+// ConfigurationUnmarshallerHook normalize metadata configuration:
+//   - replace provider by providers
+func ConfigurationUnmarshallerHook() mapstructure.DecodeHookFunc {
+	return func(from, to reflect.Value) (interface{}, error) {
+		if from.Kind() != reflect.Map || from.IsNil() || to.Type() != reflect.TypeOf(Configuration{}) {
+			return from.Interface(), nil
+		}
+
+		// provider → providers
+		var providerKey, providersKey *reflect.Value
+		fromMap := from.MapKeys()
+		for i, k := range fromMap {
+			k = helpers.ElemOrIdentity(k)
+			if k.Kind() != reflect.String {
+				return from.Interface(), nil
+			}
+			if helpers.MapStructureMatchName(k.String(), "Provider") {
+				providerKey = &fromMap[i]
+			} else if helpers.MapStructureMatchName(k.String(), "Providers") {
+				providersKey = &fromMap[i]
+			}
+		}
+		if providerKey != nil && providersKey != nil {
+			return nil, fmt.Errorf("cannot have both %q and %q", providerKey.String(), providersKey.String())
+		}
+		if providerKey != nil {
+			from.SetMapIndex(reflect.ValueOf("providers"),
+				reflect.ValueOf([]interface{}{from.MapIndex(*providerKey).Interface()}))
+			from.SetMapIndex(*providerKey, reflect.Value{})
+		}
+
+		return from.Interface(), nil
+	}
 }
 
 func init() {
+	helpers.RegisterMapstructureUnmarshallerHook(ConfigurationUnmarshallerHook())
 	helpers.RegisterMapstructureUnmarshallerHook(
 		helpers.ParametrizedConfigurationUnmarshallerHook(ProviderConfiguration{}, providers))
 }
@@ -4,9 +4,13 @@
 package metadata
 
 import (
+	"net/netip"
 	"testing"
 
+	"github.com/gin-gonic/gin"
+
 	"akvorado/common/helpers"
+	"akvorado/inlet/metadata/provider/static"
 )
 
 func TestDefaultConfiguration(t *testing.T) {
@@ -14,3 +18,58 @@ func TestDefaultConfiguration(t *testing.T) {
 		t.Fatalf("validate.Struct() error:\n%+v", err)
 	}
 }
+
+func TestConfigurationUnmarshallerHook(t *testing.T) {
+	staticConfiguration := func() *static.Configuration {
+		c := static.DefaultConfiguration().(static.Configuration)
+		return &c
+	}
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "provider",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"provider": gin.H{"type": "static"},
+				}
+			},
+			Expected: func() Configuration {
+				c := DefaultConfiguration()
+				c.Providers = []ProviderConfiguration{{Config: staticConfiguration()}}
+				return c
+			}(),
+		}, {
+			Description: "providers",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"providers": []gin.H{
+						{"type": "static", "exporter-subnets": []string{"192.0.2.0/24"}},
+						{"type": "static"},
+					},
+				}
+			},
+			Expected: func() Configuration {
+				c := DefaultConfiguration()
+				c.Providers = []ProviderConfiguration{
+					{
+						ExporterSubnets: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+						Config:          staticConfiguration(),
+					},
+					{Config: staticConfiguration()},
+				}
+				return c
+			}(),
+		}, {
+			Description: "provider and providers",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"provider":  gin.H{"type": "static"},
+					"providers": []gin.H{{"type": "static"}},
+				}
+			},
+			Error: true,
+		},
+	})
+}
@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metadata
+
+import (
+	"net/netip"
+	"time"
+
+	"akvorado/inlet/metadata/provider"
+)
+
+// waiter is a callback waiting for some interfaces to be polled.
+type waiter struct {
+	remaining int
+	deadline  time.Time
+	callback  func()
+}
+
+// Notify registers a callback to be called once the provided interfaces of an
+// exporter have been polled, successfully or not, or when the provided timeout
+// expires. The callback is called exactly once, possibly from another
+// goroutine, and it should not block. If the interfaces are already in the
+// cache, it is called immediately. Notify does not trigger a poll by itself:
+// use Lookup or LookupMany for that.
+func (c *Component) Notify(exporterIP netip.Addr, ifIndexes []uint, timeout time.Duration, callback func()) {
+	exporterIP = normalizeExporterIP(exporterIP)
+	queries := make([]provider.Query, 0, len(ifIndexes))
+	for _, ifIndex := range ifIndexes {
+		queries = append(queries, provider.Query{ExporterIP: exporterIP, IfIndex: ifIndex})
+	}
+
+	// The cache is checked while holding the lock to not miss an update
+	// received between the lookup and the registration.
+	c.waitersLock.Lock()
+	_, found := c.sc.LookupMany(time.Time{}, queries)
+	w := &waiter{
+		deadline: c.d.Clock.Now().Add(timeout),
+		callback: callback,
+	}
+	for idx, query := range queries {
+		if found[idx] {
+			continue
+		}
+		w.remaining++
+		c.waiters[query] = append(c.waiters[query], w)
+	}
+	registered := w.remaining > 0
+	c.waitersLock.Unlock()
+	if !registered {
+		callback()
+	}
+}
+
+// notifyWaiters calls the callbacks waiting for the provided queries, once
+// all the queries they wait for have been resolved.
+func (c *Component) notifyWaiters(queries ...provider.Query) {
+	callbacks := []func(){}
+	c.waitersLock.Lock()
+	for _, query := range queries {
+		for _, w := range c.waiters[query] {
+			w.remaining--
+			if w.remaining == 0 {
+				callbacks = append(callbacks, w.callback)
+			}
+		}
+		delete(c.waiters, query)
+	}
+	c.waitersLock.Unlock()
+	for _, callback := range callbacks {
+		callback()
+	}
+}
+
+// expireWaiters calls the callbacks whose deadline is before the provided
+// time.
+func (c *Component) expireWaiters(now time.Time) {
+	callbacks := []func(){}
+	c.waitersLock.Lock()
+	for query, waiters := range c.waiters {
+		kept := waiters[:0]
+		for _, w := range waiters {
+			switch {
+			case w.remaining <= 0:
+				// Already notified
+			case now.After(w.deadline):
+				w.remaining = 0
+				callbacks = append(callbacks, w.callback)
+			default:
+				kept = append(kept, w)
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.waiters, query)
+		} else {
+			c.waiters[query] = kept
+		}
+	}
+	c.waitersLock.Unlock()
+	for _, callback := range callbacks {
+		callback()
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"akvorado/inlet/metadata/provider"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/openconfig/gnmi/proto/gnmi"
 	"github.com/openconfig/gnmic/pkg/api"
 	"github.com/openconfig/gnmic/pkg/target"
 )
@@ -36,9 +37,12 @@ func (state *exporterState) update(events []event, model Model) {
 	// properties, for example if the index is in the state hierarchy but the
 	// name is in the config hierarchy)
 	// - mapping from keys to speeds (same remark)
+	// - mapping from keys to admin and oper status (same remark)
 	i := 0
 	indexes := map[string]uint{}
 	speeds := map[string]uint{}
+	adminStatuses := map[string]provider.InterfaceStatus{}
+	operStatuses := map[string]provider.InterfaceStatus{}
 outer1:
 	for _, event := range events {
 		for _, path := range model.SystemNamePaths {
@@ -65,6 +69,24 @@ outer1:
 				speeds[event.Keys] = speed
 			}
 		}
+		for _, path := range model.IfAdminStatusPaths {
+			if event.Path == path {
+				var status provider.InterfaceStatus
+				if err := status.UnmarshalText([]byte(event.Value)); err != nil {
+					continue outer1
+				}
+				adminStatuses[event.Keys] = status
+			}
+		}
+		for _, path := range model.IfOperStatusPaths {
+			if event.Path == path {
+				var status provider.InterfaceStatus
+				if err := status.UnmarshalText([]byte(event.Value)); err != nil {
+					continue outer1
+				}
+				operStatuses[event.Keys] = status
+			}
+		}
 		events[i] = event
 		i++
 	}
@@ -101,7 +123,7 @@ outer2:
 		}
 	}
 
-	// Third-pass: unnamed interfaces and speed
+	// Third-pass: unnamed interfaces, speed and status
 	for keys, index := range indexes {
 		iface := state.Interfaces[index]
 		// Set name
@@ -122,10 +144,17 @@ outer2:
 			delete(state.Interfaces, index)
 			continue
 		}
-		// Set speed
-		for iface.Speed == 0 && keys != "" {
-			iface.Speed = speeds[keys]
-			keys = keys[:max(0, strings.LastIndex(keys, ","))]
+		// Set speed and status, using parent's value when missing
+		for k := keys; k != ""; k = k[:max(0, strings.LastIndex(k, ","))] {
+			if iface.Speed == 0 {
+				iface.Speed = speeds[k]
+			}
+			if iface.AdminStatus == provider.InterfaceStatusUndefined {
+				iface.AdminStatus = adminStatuses[k]
+			}
+			if iface.OperStatus == provider.InterfaceStatusUndefined {
+				iface.OperStatus = operStatuses[k]
+			}
 		}
 		// Copy back
 		state.Interfaces[index] = iface
@@ -151,6 +180,29 @@ retryConnect:
 	targetPort := p.config.Ports.LookupOrDefault(exporterIP, 57400)
 	targetAddress := net.JoinHostPort(targetIP.String(), strconv.FormatUint(uint64(targetPort), 10))
 	targetAuthParameters := p.config.AuthenticationParameters.LookupOrDefault(exporterIP, AuthenticationParameter{})
+
+	waitBeforeRetry := func() bool {
+		next := time.NewTimer(retryInitBackoff.NextBackOff())
+		select {
+		case <-ctx.Done():
+			next.Stop()
+			return false
+		case <-next.C:
+		}
+		return true
+	}
+	secret, _, err := p.secrets.Lookup(ctx, exporterIP)
+	if err != nil {
+		l.Err(err).Msg("unable to fetch credentials")
+		p.metrics.errors.WithLabelValues(exporterStr, "cannot fetch credentials").Inc()
+		if !waitBeforeRetry() {
+			return
+		}
+		goto retryConnect
+	}
+	secret.Override("Username", &targetAuthParameters.Username)
+	secret.Override("Password", &targetAuthParameters.Password)
+
 	targetOptions := []api.TargetOption{
 		api.Address(targetAddress),
 		api.Insecure(targetAuthParameters.Insecure),
@@ -168,16 +220,6 @@ retryConnect:
 	addIfNotEmpty(targetAuthParameters.TLSCert, api.TLSCert(targetAuthParameters.TLSCert))
 	addIfNotEmpty(targetAuthParameters.TLSKey, api.TLSKey(targetAuthParameters.TLSKey))
 
-	waitBeforeRetry := func() bool {
-		next := time.NewTimer(retryInitBackoff.NextBackOff())
-		select {
-		case <-ctx.Done():
-			next.Stop()
-			return false
-		case <-next.C:
-		}
-		return true
-	}
 	l.Debug().Msgf("connecting to %s", targetAddress)
 	tg, err := api.NewTarget(
 		targetOptions...,
@@ -195,6 +237,8 @@ retryConnect:
 	if err != nil {
 		l.Err(err).Msg("unable to create client")
 		p.metrics.errors.WithLabelValues(exporterStr, "cannot create client").Inc()
+		// Credentials may have been rotated
+		p.secrets.Invalidate(exporterIP)
 		if !waitBeforeRetry() {
 			return
 		}
@@ -223,9 +267,17 @@ retryDetect:
 	// - Subscribe, mode stream + sampling: we cannot know when stuff get deleted without expiring them ourselves
 	// - SubscribePoll: not widely implemented
 	//
-	// So, we use SubscribeOnce. This is not the most efficient way, but we ensure we get a coherent state.
+	// So, by default, we use SubscribeOnce. This is not the most efficient way,
+	// but we ensure we get a coherent state. When requested, we use a stream
+	// subscription with a target-defined mode and we keep track of the
+	// received values and deletions ourselves.
+	streaming, _ := p.config.Streaming.Lookup(exporterIP)
+	subscriptionListMode := api.SubscriptionListModeONCE()
+	if streaming {
+		subscriptionListMode = api.SubscriptionListModeSTREAM()
+	}
 	subscribeRequestOptions := model.gnmiOptions(
-		api.SubscriptionListModeONCE(),
+		subscriptionListMode,
 		api.Encoding(encoding),
 	)
 	if setTarget, ok := p.config.SetTarget.Lookup(exporterIP); ok && setTarget {
@@ -239,6 +291,19 @@ retryDetect:
 	retryFetchBackoff.MaxElapsedTime = 0
 	retryFetchBackoff.MaxInterval = time.Minute
 	retryFetchBackoff.InitialInterval = time.Second
+	for streaming {
+		l.Debug().Msg("subscribing")
+		if !p.stream(ctx, tg, exporterStr, subscribeReq, model, state, retryFetchBackoff) {
+			return
+		}
+		next := time.NewTimer(retryFetchBackoff.NextBackOff())
+		select {
+		case <-ctx.Done():
+			next.Stop()
+			return
+		case <-next.C:
+		}
+	}
 	for {
 		l.Debug().Msg("polling")
 		start := time.Now()
@@ -291,6 +356,69 @@ retryDetect:
 	}
 }
 
+// stream receives updates from a stream subscription and updates the state
+// accordingly. It returns when the subscription is interrupted and the return
+// value tells if we should subscribe again.
+func (p *Provider) stream(ctx context.Context, tg *target.Target, exporterStr string,
+	subscribeReq *gnmi.SubscribeRequest, model Model, state *exporterState, retryBackoff backoff.BackOff,
+) bool {
+	l := p.r.With().Str("exporter", exporterStr).Logger()
+	ctx, cancel := context.WithCancel(ctx)
+	responses, errs := tg.SubscribeOnceChan(ctx, subscribeReq)
+	interrupted := false
+	defer func() {
+		cancel()
+		if interrupted {
+			return
+		}
+		// Unblock the receiving goroutine until it notices the cancellation
+		go func() {
+			for {
+				select {
+				case <-responses:
+				case <-errs:
+					return
+				}
+			}
+		}()
+	}()
+
+	store := eventStore{}
+	synced := false
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case err := <-errs:
+			interrupted = true
+			l.Err(err).Msg("subscription interrupted")
+			p.metrics.errors.WithLabelValues(exporterStr, "subscription interrupted").Inc()
+			return true
+		case response := <-responses:
+			store.apply(response)
+			if response.GetSyncResponse() && !synced {
+				// Initial state received
+				synced = true
+				p.metrics.times.WithLabelValues(exporterStr).Observe(time.Now().Sub(start).Seconds())
+				retryBackoff.Reset()
+			}
+			if !synced {
+				continue
+			}
+			events := store.events()
+			p.metrics.paths.WithLabelValues(exporterStr).Set(float64(len(events)))
+			p.stateLock.Lock()
+			state.update(events, model)
+			state.Ready = true
+			p.stateLock.Unlock()
+			l.Debug().Msg("state updated")
+			p.metrics.ready.WithLabelValues(exporterStr).Set(1)
+			p.metrics.updates.WithLabelValues(exporterStr).Inc()
+		}
+	}
+}
+
 // detectModelAndEncoding subscribe to the various paths of the configured models to
 // determine the one the target is compatible with.
 func (p *Provider) detectModelAndEncoding(ctx context.Context, tg *target.Target) (Model, string, error) {
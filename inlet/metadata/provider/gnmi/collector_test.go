@@ -53,6 +53,14 @@ func TestStateUpdate(t *testing.T) {
 		{"/interface/ifindex", "name=ethernet-1/4", "103"},
 		{"/interface/subinterface/ifindex", "name=ethernet-1/4,index=1", "105"},
 		{"/interface/ifindex", "name=lag1", "106"},
+		{"/interface/admin-state", "name=ethernet-1/1", "enable"},
+		{"/interface/oper-state", "name=ethernet-1/1", "up"},
+		{"/interface/admin-state", "name=ethernet-1/2", "disable"},
+		{"/interface/oper-state", "name=ethernet-1/2", "down"},
+		{"/interface/admin-state", "name=ethernet-1/4", "enable"},
+		{"/interface/oper-state", "name=ethernet-1/4", "up"},
+		{"/interface/subinterface/oper-state", "name=ethernet-1/4,index=1", "down"},
+		{"/interface/oper-state", "name=lag1", "something"},
 		{"/system/name/host-name", "", "srlinux"},
 	}, model)
 	expected = exporterState{
@@ -62,11 +70,15 @@ func TestStateUpdate(t *testing.T) {
 				Name:        "ethernet-1/1",
 				Description: "1st interface",
 				Speed:       100_000,
+				AdminStatus: provider.InterfaceStatusUp,
+				OperStatus:  provider.InterfaceStatusUp,
 			},
 			101: {
 				Name:        "ethernet-1/2",
 				Description: "2nd interface",
 				Speed:       100_000,
+				AdminStatus: provider.InterfaceStatusDown,
+				OperStatus:  provider.InterfaceStatusDown,
 			},
 			102: {
 				Name:        "ethernet-1/3",
@@ -77,11 +89,15 @@ func TestStateUpdate(t *testing.T) {
 				Name:        "ethernet-1/4",
 				Description: "",
 				Speed:       25_000,
+				AdminStatus: provider.InterfaceStatusUp,
+				OperStatus:  provider.InterfaceStatusUp,
 			},
 			105: {
 				Name:        "ethernet-1/4.1",
 				Description: "4th interface",
 				Speed:       25_000,
+				AdminStatus: provider.InterfaceStatusUp,
+				OperStatus:  provider.InterfaceStatusDown,
 			},
 			106: {
 				Name:        "lag1",
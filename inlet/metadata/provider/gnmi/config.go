@@ -12,6 +12,7 @@ import (
 	"akvorado/common/helpers"
 	"akvorado/common/helpers/bimap"
 	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
 
 	"github.com/mitchellh/mapstructure"
 )
@@ -26,12 +27,17 @@ type Configuration struct {
 	Targets *helpers.SubnetMap[netip.Addr]
 	// SetTarget is a mpping from exporter IPs to whatever set target name in gNMI path prefix
 	SetTarget *helpers.SubnetMap[bool]
+	// Streaming is a mapping from exporter IPs to whatever use a streaming subscription instead of polling
+	Streaming *helpers.SubnetMap[bool]
 	// Ports is a mapping from exporter IPs to gNMI port.
 	Ports *helpers.SubnetMap[uint16]
 	// AuthenticationParameters is a mapping from exporter IPs to authentication configuration.
 	AuthenticationParameters *helpers.SubnetMap[AuthenticationParameter] `validate:"omitempty,dive"`
 	// Models describe the YANG models to use to query devices.
 	Models []Model `validate:"min=1,dive"`
+	// Secrets defines a backend to fetch usernames and passwords from when
+	// connecting to exporters.
+	Secrets secrets.Configuration
 }
 
 // AuthenticationParameter contains the configuration related to authentication to a target.
@@ -61,6 +67,8 @@ type Model struct {
 	IfNamePaths        []string      `validate:"required_without=IfNameKeys"`
 	IfDescriptionPaths []string      `validate:"min=1"`
 	IfSpeedPaths       []IfSpeedPath `validate:"min=1,dive"`
+	IfAdminStatusPaths []string
+	IfOperStatusPaths  []string
 }
 
 // IfSpeedPath defines a path for oper speed.
@@ -118,9 +126,11 @@ func DefaultConfiguration() provider.Configuration {
 		MinimalRefreshInterval:   time.Minute,
 		Targets:                  helpers.MustNewSubnetMap(map[string]netip.Addr{}),
 		SetTarget:                helpers.MustNewSubnetMap(map[string]bool{}),
+		Streaming:                helpers.MustNewSubnetMap(map[string]bool{}),
 		Ports:                    helpers.MustNewSubnetMap(map[string]uint16{"::/0": 9339}),
 		AuthenticationParameters: helpers.MustNewSubnetMap(map[string]AuthenticationParameter{}),
 		Models:                   DefaultModels(),
+		Secrets:                  secrets.DefaultConfiguration(),
 	}
 }
 
@@ -144,6 +154,14 @@ func DefaultModels() []Model {
 				{"/state/port/ethernet/oper-speed", SpeedMegabits},
 				{"/state/lag/bandwidth", SpeedBits},
 			},
+			IfAdminStatusPaths: []string{
+				"/configure/port/admin-state",
+				"/configure/lag/admin-state",
+			},
+			IfOperStatusPaths: []string{
+				"/state/port/oper-state",
+				"/state/lag/oper-state",
+			},
 		}, {
 			Name:            "Nokia SR Linux",
 			SystemNamePaths: []string{"/system/name/host-name"},
@@ -163,6 +181,14 @@ func DefaultModels() []Model {
 				{"/interface/ethernet/port-speed", SpeedHuman},
 				{"/interface/lag/lag-speed", SpeedBits},
 			},
+			IfAdminStatusPaths: []string{
+				"/interface/admin-state",
+				"/interface/subinterface/admin-state",
+			},
+			IfOperStatusPaths: []string{
+				"/interface/oper-state",
+				"/interface/subinterface/oper-state",
+			},
 		}, {
 			Name:            "OpenConfig",
 			SystemNamePaths: []string{"/system/config/hostname"},
@@ -183,6 +209,14 @@ func DefaultModels() []Model {
 				{"/interfaces/interface/ethernet/state/negotiated-port-speed", SpeedEthernet},
 				{"/interfaces/interface/ethernet/state/port-speed", SpeedEthernet},
 			},
+			IfAdminStatusPaths: []string{
+				"/interfaces/interface/state/admin-status",
+				"/interfaces/interface/subinterfaces/subinterface/state/admin-status",
+			},
+			IfOperStatusPaths: []string{
+				"/interfaces/interface/state/oper-status",
+				"/interfaces/interface/subinterfaces/subinterface/state/oper-status",
+			},
 		}, {
 			Name:               "IETF",
 			SystemNamePaths:    []string{"/system/hostname"},
@@ -192,6 +226,8 @@ func DefaultModels() []Model {
 			IfSpeedPaths: []IfSpeedPath{
 				{"/interfaces/interface/speed", SpeedBits},
 			},
+			IfAdminStatusPaths: []string{"/interfaces/interface/admin-status"},
+			IfOperStatusPaths:  []string{"/interfaces/interface/oper-status"},
 		},
 	}
 }
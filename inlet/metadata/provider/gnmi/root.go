@@ -11,6 +11,7 @@ import (
 
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
 )
 
 // Provider represents the SNMP provider.
@@ -18,6 +19,7 @@ type Provider struct {
 	r       *reporter.Reporter
 	config  *Configuration
 	metrics metrics
+	secrets *secrets.Store
 
 	put     func(provider.Update)
 	refresh chan bool
@@ -28,9 +30,14 @@ type Provider struct {
 
 // New creates a new SNMP provider from configuration
 func (configuration Configuration) New(r *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	store, err := configuration.Secrets.New(r)
+	if err != nil {
+		return nil, err
+	}
 	p := Provider{
 		r:       r,
 		config:  &configuration,
+		secrets: store,
 		put:     put,
 		state:   map[netip.Addr]*exporterState{},
 		refresh: make(chan bool),
@@ -89,6 +89,47 @@ func subscribeResponsesToEvents(responses []*gnmi.SubscribeResponse) []event {
 	return events
 }
 
+// eventKey identifies a value in an eventStore.
+type eventKey struct {
+	Path string
+	Keys string
+}
+
+// eventStore keeps the last value received for each path of a streaming
+// subscription.
+type eventStore map[eventKey]string
+
+// apply updates the store with the updates and deletions from the provided
+// response.
+func (s eventStore) apply(response *gnmi.SubscribeResponse) {
+	n := response.GetUpdate()
+	if n == nil {
+		return
+	}
+	prefixEvent := gnmiPathToEvent(n.GetPrefix(), event{})
+	for _, d := range n.GetDelete() {
+		ev := gnmiPathToEvent(d, prefixEvent)
+		for k := range s {
+			if (k.Path == ev.Path || strings.HasPrefix(k.Path, ev.Path+"/")) &&
+				(ev.Keys == "" || k.Keys == ev.Keys || strings.HasPrefix(k.Keys, ev.Keys+",")) {
+				delete(s, k)
+			}
+		}
+	}
+	for _, ev := range subscribeResponseToEvents(response) {
+		s[eventKey{Path: ev.Path, Keys: ev.Keys}] = ev.Value
+	}
+}
+
+// events returns the content of the store as a list of events.
+func (s eventStore) events() []event {
+	events := make([]event, 0, len(s))
+	for k, v := range s {
+		events = append(events, event{Path: k.Path, Keys: k.Keys, Value: v})
+	}
+	return events
+}
+
 // jsonAppendToEvents appends the events derived from the provided event plus
 // the JSON-decoded value.
 func jsonAppendToEvents(events []event, ev event, value interface{}) []event {
@@ -0,0 +1,79 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package gnmi
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/openconfig/gnmi/proto/gnmi"
+
+	"akvorado/common/helpers"
+)
+
+func TestEventStore(t *testing.T) {
+	elem := func(name string, keys ...string) *gnmi.PathElem {
+		pe := &gnmi.PathElem{Name: name}
+		if len(keys) == 2 {
+			pe.Key = map[string]string{keys[0]: keys[1]}
+		}
+		return pe
+	}
+	update := func(value string, elems ...*gnmi.PathElem) *gnmi.Update {
+		return &gnmi.Update{
+			Path: &gnmi.Path{Elem: elems},
+			Val:  &gnmi.TypedValue{Value: &gnmi.TypedValue_StringVal{StringVal: value}},
+		}
+	}
+	notification := func(updates []*gnmi.Update, deletes ...*gnmi.Path) *gnmi.SubscribeResponse {
+		return &gnmi.SubscribeResponse{
+			Response: &gnmi.SubscribeResponse_Update{
+				Update: &gnmi.Notification{Update: updates, Delete: deletes},
+			},
+		}
+	}
+	sorted := func(events []event) []event {
+		sort.Slice(events, func(i, j int) bool {
+			if events[i].Path != events[j].Path {
+				return events[i].Path < events[j].Path
+			}
+			return events[i].Keys < events[j].Keys
+		})
+		return events
+	}
+
+	store := eventStore{}
+	store.apply(notification([]*gnmi.Update{
+		update("1", elem("interface", "name", "ethernet-1/1"), elem("ifindex")),
+		update("1st interface", elem("interface", "name", "ethernet-1/1"), elem("description")),
+		update("2", elem("interface", "name", "ethernet-1/2"), elem("ifindex")),
+		update("2nd interface", elem("interface", "name", "ethernet-1/2"), elem("description")),
+		update("3", elem("interface", "name", "ethernet-1/2"), elem("subinterface", "index", "1"), elem("ifindex")),
+	}))
+	store.apply(&gnmi.SubscribeResponse{
+		Response: &gnmi.SubscribeResponse_SyncResponse{SyncResponse: true},
+	})
+	expected := []event{
+		{"/interface/description", "name=ethernet-1/1", "1st interface"},
+		{"/interface/description", "name=ethernet-1/2", "2nd interface"},
+		{"/interface/ifindex", "name=ethernet-1/1", "1"},
+		{"/interface/ifindex", "name=ethernet-1/2", "2"},
+		{"/interface/subinterface/ifindex", "name=ethernet-1/2,index=1", "3"},
+	}
+	if diff := helpers.Diff(sorted(store.events()), expected); diff != "" {
+		t.Fatalf("events() (-got, +want):\n%s", diff)
+	}
+
+	// Update a description and delete an interface
+	store.apply(notification([]*gnmi.Update{
+		update("first interface", elem("interface", "name", "ethernet-1/1"), elem("description")),
+	}, &gnmi.Path{Elem: []*gnmi.PathElem{elem("interface", "name", "ethernet-1/2")}}))
+	expected = []event{
+		{"/interface/description", "name=ethernet-1/1", "first interface"},
+		{"/interface/ifindex", "name=ethernet-1/1", "1"},
+	}
+	if diff := helpers.Diff(sorted(store.events()), expected); diff != "" {
+		t.Fatalf("events() (-got, +want):\n%s", diff)
+	}
+}
@@ -7,6 +7,9 @@ package provider
 import (
 	"context"
 	"net/netip"
+	"time"
+
+	"github.com/gin-gonic/gin"
 
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
@@ -20,6 +23,9 @@ type Interface struct {
 	Provider     string
 	Connectivity string
 	Boundary     schema.InterfaceBoundary
+	AdminStatus  InterfaceStatus
+	OperStatus   InterfaceStatus
+	LastChange   time.Time
 }
 
 // Exporter describes a router that exports netflow
@@ -68,6 +74,25 @@ type Provider interface {
 	Query(ctx context.Context, query BatchQuery) error
 }
 
+// PushProvider is the interface a provider accepting data pushed through the
+// HTTP API should implement.
+type PushProvider interface {
+	Provider
+	// PushHandler returns the handler accepting pushed data or nil when
+	// pushing data is disabled. Once data is accepted, the handler calls
+	// refresh with the subnets of the exporters whose data changed.
+	PushHandler(refresh func(exporterSubnets []netip.Prefix)) gin.HandlerFunc
+}
+
+// DiscoveryProvider is the interface a provider able to discover exporters
+// should implement.
+type DiscoveryProvider interface {
+	Provider
+	// DiscoveredHandler returns the handler listing the discovered exporters
+	// or nil when discovery is disabled.
+	DiscoveredHandler() gin.HandlerFunc
+}
+
 // Configuration defines an interface to configure a provider.
 type Configuration interface {
 	// New instantiates a new provider from its configuration.
@@ -0,0 +1,133 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"errors"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/helpers/bimap"
+)
+
+// Configuration describes how to fetch the credentials of exporters from a
+// secret backend.
+type Configuration struct {
+	// Backend is the backend storing the secrets. With "none", only the
+	// credentials from the provider configuration are used.
+	Backend Backend
+	// Paths is a mapping from exporter IPs to the location of their secret
+	// in the backend. "{exporter}" is replaced by the IP of the exporter.
+	// Exporters without a path use the credentials from the provider
+	// configuration.
+	Paths *helpers.SubnetMap[string]
+	// CacheDuration tells how long a secret is kept before being fetched
+	// again. This bounds the time needed to use a rotated secret. 0 disables
+	// the cache.
+	CacheDuration time.Duration `validate:"min=0"`
+	// Timeout tells how much time to wait for an answer from the backend. 0
+	// means no timeout.
+	Timeout time.Duration `validate:"min=0"`
+	// Vault is the configuration for the Vault backend.
+	Vault VaultConfiguration
+	// CyberArk is the configuration for the CyberArk backend.
+	CyberArk CyberArkConfiguration
+}
+
+// VaultConfiguration describes how to access a Vault server. Paths are API
+// paths (for example, "secret/data/devices/{exporter}" for a KV version 2
+// engine).
+type VaultConfiguration struct {
+	// Address is the URL of the Vault server. When empty, VAULT_ADDR is used.
+	Address string `validate:"omitempty,url"`
+	// TokenFile is the file containing the token to authenticate. It is read
+	// again on each fetch to allow the token to be renewed. When empty,
+	// VAULT_TOKEN is used.
+	TokenFile string
+	// Namespace is the namespace to use. When empty, VAULT_NAMESPACE is used.
+	Namespace string
+	// TLS defines the TLS configuration to connect to the server.
+	TLS helpers.TLSConfiguration
+}
+
+// CyberArkConfiguration describes how to access a CyberArk Central Credential
+// Provider. Paths are account object names.
+type CyberArkConfiguration struct {
+	// Address is the URL of the Central Credential Provider.
+	Address string `validate:"omitempty,url"`
+	// AppID is the application ID to use.
+	AppID string
+	// Safe is the safe containing the accounts.
+	Safe string
+	// TLS defines the TLS configuration to connect to the provider. A client
+	// certificate is usually needed to authenticate.
+	TLS helpers.TLSConfiguration
+}
+
+// DefaultConfiguration represents the default configuration for secrets.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Backend:       BackendNone,
+		Paths:         helpers.MustNewSubnetMap(map[string]string{}),
+		CacheDuration: 5 * time.Minute,
+		Timeout:       5 * time.Second,
+		Vault: VaultConfiguration{
+			TLS: helpers.TLSConfiguration{Verify: true},
+		},
+		CyberArk: CyberArkConfiguration{
+			TLS: helpers.TLSConfiguration{Verify: true},
+		},
+	}
+}
+
+// Backend is a secret backend.
+type Backend int
+
+const (
+	// BackendNone disables the use of a secret backend.
+	BackendNone Backend = iota
+	// BackendFile reads secrets from YAML files.
+	BackendFile
+	// BackendVault fetches secrets from Vault.
+	BackendVault
+	// BackendCyberArk fetches secrets from CyberArk Central Credential
+	// Provider.
+	BackendCyberArk
+)
+
+var backendMap = bimap.New(map[Backend]string{
+	BackendNone:     "none",
+	BackendFile:     "file",
+	BackendVault:    "vault",
+	BackendCyberArk: "cyberark",
+})
+
+// MarshalText turns a secret backend to text
+func (b Backend) MarshalText() ([]byte, error) {
+	got, ok := backendMap.LoadValue(b)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errors.New("unknown secret backend")
+}
+
+// String turns a secret backend to string
+func (b Backend) String() string {
+	got, _ := backendMap.LoadValue(b)
+	return got
+}
+
+// UnmarshalText provides a secret backend from text
+func (b *Backend) UnmarshalText(input []byte) error {
+	got, ok := backendMap.LoadKey(string(input))
+	if ok {
+		*b = got
+		return nil
+	}
+	return errors.New("unknown secret backend")
+}
+
+func init() {
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[string]())
+}
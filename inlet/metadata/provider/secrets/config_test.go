@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	if err := helpers.Validate.Struct(DefaultConfiguration()); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
+
+func TestConfigurationDecode(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "vault",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"backend": "vault",
+					"paths": gin.H{
+						"203.0.113.0/24": "secret/data/devices/{exporter}",
+					},
+					"cache-duration": "1m",
+					"vault": gin.H{
+						"address":    "https://vault.example.com:8200",
+						"token-file": "/run/secrets/vault-token",
+					},
+				}
+			},
+			Expected: Configuration{
+				Backend: BackendVault,
+				Paths: helpers.MustNewSubnetMap(map[string]string{
+					"::ffff:203.0.113.0/120": "secret/data/devices/{exporter}",
+				}),
+				CacheDuration: time.Minute,
+				Timeout:       5 * time.Second,
+				Vault: VaultConfiguration{
+					Address:   "https://vault.example.com:8200",
+					TokenFile: "/run/secrets/vault-token",
+					TLS:       helpers.TLSConfiguration{Verify: true},
+				},
+				CyberArk: CyberArkConfiguration{
+					TLS: helpers.TLSConfiguration{Verify: true},
+				},
+			},
+		}, {
+			Description: "unknown backend",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{"backend": "keepass"}
+			},
+			Error: true,
+		},
+	})
+}
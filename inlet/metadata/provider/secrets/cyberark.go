@@ -0,0 +1,47 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// fetcher returns a function fetching secrets from CyberArk Central Credential
+// Provider. The password of the account is available as "password" and its
+// user name as "username". The other properties of the account are also
+// available.
+func (config CyberArkConfiguration) fetcher() (fetchFunc, error) {
+	client, err := newHTTPClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, path string) (Secret, error) {
+		query := url.Values{}
+		query.Set("AppID", config.AppID)
+		if config.Safe != "" {
+			query.Set("Safe", config.Safe)
+		}
+		query.Set("Object", path)
+		target := fmt.Sprintf("%s/AIMWebService/api/Accounts?%s",
+			strings.TrimRight(config.Address, "/"), query.Encode())
+		var payload map[string]interface{}
+		if err := getJSON(ctx, client, target, nil, &payload); err != nil {
+			return nil, err
+		}
+		secret := Secret{}
+		for k, v := range payload {
+			if v, ok := v.(string); ok {
+				secret[k] = v
+			}
+		}
+		if content, ok := secret["Content"]; ok {
+			delete(secret, "Content")
+			secret["password"] = content
+		}
+		return secret, nil
+	}, nil
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestCyberArkBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/AIMWebService/api/Accounts" || query.Get("AppID") != "akvorado" || query.Get("Safe") != "Network" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if query.Get("Object") != "device-192.0.2.1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Content": "secret", "UserName": "akvorado", "Address": "192.0.2.1", "PasswordChangeInProcess": false}`))
+	}))
+	defer server.Close()
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Backend = BackendCyberArk
+	config.Paths = helpers.MustNewSubnetMap(map[string]string{
+		"::ffff:192.0.2.0/120": "device-{exporter}",
+	})
+	config.CyberArk.Address = server.URL
+	config.CyberArk.AppID = "akvorado"
+	config.CyberArk.Safe = "Network"
+	s, err := config.New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got, _, err := s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.1"))
+	if err != nil {
+		t.Fatalf("Lookup() error:\n%+v", err)
+	}
+	expected := Secret{"password": "secret", "UserName": "akvorado", "Address": "192.0.2.1"}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+	if got.Get("Username") != "akvorado" {
+		t.Fatalf("Get(Username) == %q, expected %q", got.Get("Username"), "akvorado")
+	}
+	_, _, err = s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.2"))
+	if class := helpers.ErrorClassOf(err); class != helpers.ErrorClassPermanent {
+		t.Fatalf("Lookup() error class %s instead of %s", class, helpers.ErrorClassPermanent)
+	}
+}
+
+func TestCyberArkMissingAppID(t *testing.T) {
+	config := DefaultConfiguration()
+	config.Backend = BackendCyberArk
+	config.CyberArk.Address = "https://cyberark.example.com"
+	if _, err := config.New(reporter.NewMock(t)); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
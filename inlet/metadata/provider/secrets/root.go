@@ -0,0 +1,244 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package secrets fetches the credentials of exporters from a secret backend
+// (YAML files, Vault or CyberArk) when they are polled, so they do not have
+// to be stored in the configuration file.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/helpers/yaml"
+	"akvorado/common/reporter"
+)
+
+// Secret contains the credentials for an exporter, indexed by name.
+type Secret map[string]string
+
+// Get returns the value associated to the provided name or an empty string.
+// Names are matched like configuration keys: case and dashes do not matter.
+func (s Secret) Get(name string) string {
+	for k, v := range s {
+		if helpers.MapStructureMatchName(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Override replaces the provided value with the one associated to the
+// provided name, if any.
+func (s Secret) Override(name string, target *string) {
+	if v := s.Get(name); v != "" {
+		*target = v
+	}
+}
+
+// Store fetches secrets from a backend and caches them.
+type Store struct {
+	r         *reporter.Reporter
+	config    Configuration
+	fetch     fetchFunc
+	errLogger reporter.Logger
+
+	cache     map[string]cachedSecret
+	cacheLock sync.Mutex
+
+	metrics struct {
+		successes *reporter.CounterVec
+		errors    *reporter.CounterVec
+	}
+}
+
+// fetchFunc fetches the secret at the provided path.
+type fetchFunc func(ctx context.Context, path string) (Secret, error)
+
+// cachedSecret is a secret in the cache.
+type cachedSecret struct {
+	secret  Secret
+	expires time.Time
+}
+
+// New creates a new secret store from configuration.
+func (configuration Configuration) New(r *reporter.Reporter) (*Store, error) {
+	s := Store{
+		r:         r,
+		config:    configuration,
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		cache:     map[string]cachedSecret{},
+	}
+	switch configuration.Backend {
+	case BackendNone:
+		return &s, nil
+	case BackendFile:
+		s.fetch = fetchFile
+	case BackendVault:
+		if configuration.Vault.Address == "" && os.Getenv("VAULT_ADDR") == "" {
+			return nil, errors.New("no address for Vault secret backend")
+		}
+		fetch, err := configuration.Vault.fetcher()
+		if err != nil {
+			return nil, err
+		}
+		s.fetch = fetch
+	case BackendCyberArk:
+		if configuration.CyberArk.Address == "" || configuration.CyberArk.AppID == "" {
+			return nil, errors.New("no address or application ID for CyberArk secret backend")
+		}
+		fetch, err := configuration.CyberArk.fetcher()
+		if err != nil {
+			return nil, err
+		}
+		s.fetch = fetch
+	default:
+		return nil, fmt.Errorf("unknown secret backend %q", configuration.Backend)
+	}
+
+	s.metrics.successes = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "success_requests_total",
+			Help: "Number of secrets successfully fetched.",
+		}, []string{"exporter"})
+	s.metrics.errors = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "error_requests_total",
+			Help: "Number of errors while fetching secrets.",
+		}, []string{"exporter", "error"})
+	return &s, nil
+}
+
+// Lookup returns the secret for the provided exporter. The second value is
+// false when the exporter has no secret. When the backend cannot be reached,
+// the previously fetched secret is returned, if any.
+func (s *Store) Lookup(ctx context.Context, exporter netip.Addr) (Secret, bool, error) {
+	if s == nil || s.fetch == nil {
+		return nil, false, nil
+	}
+	path, ok := s.config.Paths.Lookup(exporter)
+	if !ok || path == "" {
+		return nil, false, nil
+	}
+	exporterStr := exporter.Unmap().String()
+	path = strings.ReplaceAll(path, "{exporter}", exporterStr)
+
+	now := time.Now()
+	s.cacheLock.Lock()
+	cached, ok := s.cache[path]
+	s.cacheLock.Unlock()
+	if ok && now.Before(cached.expires) {
+		return cached.secret, true, nil
+	}
+
+	if s.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.Timeout)
+		defer cancel()
+	}
+	secret, err := s.fetch(ctx, path)
+	if err != nil {
+		s.metrics.errors.WithLabelValues(exporterStr, helpers.ErrorClassOf(err).String()).Inc()
+		if ok {
+			s.errLogger.Warn().Err(err).
+				Str("exporter", exporterStr).
+				Str("path", path).
+				Msg("unable to fetch secret, using the previous one")
+			return cached.secret, true, nil
+		}
+		return nil, false, fmt.Errorf("unable to fetch secret for %s: %w", exporterStr, err)
+	}
+	s.metrics.successes.WithLabelValues(exporterStr).Inc()
+	s.cacheLock.Lock()
+	s.cache[path] = cachedSecret{
+		secret:  secret,
+		expires: now.Add(s.config.CacheDuration),
+	}
+	s.cacheLock.Unlock()
+	return secret, true, nil
+}
+
+// Invalidate tells the secret of the provided exporter should be fetched again
+// on the next lookup. It should be called when the credentials are rejected,
+// as the secret may have been rotated. The current secret is still used if
+// the backend cannot be reached.
+func (s *Store) Invalidate(exporter netip.Addr) {
+	if s == nil || s.fetch == nil {
+		return
+	}
+	path, ok := s.config.Paths.Lookup(exporter)
+	if !ok {
+		return
+	}
+	path = strings.ReplaceAll(path, "{exporter}", exporter.Unmap().String())
+	s.cacheLock.Lock()
+	defer s.cacheLock.Unlock()
+	if cached, ok := s.cache[path]; ok {
+		cached.expires = time.Time{}
+		s.cache[path] = cached
+	}
+}
+
+// fetchFile reads a secret from a YAML file containing a mapping from names
+// to values.
+func fetchFile(_ context.Context, path string) (Secret, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, helpers.ConfigurationError(fmt.Errorf("cannot read secret file %s: %w", path, err))
+	}
+	var secret Secret
+	if err := yaml.Unmarshal(content, &secret); err != nil {
+		return nil, helpers.PermanentError(fmt.Errorf("cannot parse secret file %s: %w", path, err))
+	}
+	return secret, nil
+}
+
+// newHTTPClient builds an HTTP client using the provided TLS configuration.
+func newHTTPClient(config helpers.TLSConfiguration) (*http.Client, error) {
+	tlsConfig, err := config.MakeTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}, nil
+}
+
+// getJSON fetches the provided URL and decodes the answer into the provided
+// response.
+func getJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, response interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return helpers.ConfigurationError(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return helpers.TransientError(err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return helpers.ConfigurationError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	case resp.StatusCode >= 500:
+		return helpers.TransientError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return helpers.PermanentError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return helpers.PermanentError(fmt.Errorf("cannot decode answer: %w", err))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestSecretGet(t *testing.T) {
+	secret := Secret{
+		"username":                  "akvorado",
+		"authentication-passphrase": "secret",
+	}
+	if got := secret.Get("UserName"); got != "akvorado" {
+		t.Errorf("Get(UserName) == %q, expected %q", got, "akvorado")
+	}
+	if got := secret.Get("AuthenticationPassphrase"); got != "secret" {
+		t.Errorf("Get(AuthenticationPassphrase) == %q, expected %q", got, "secret")
+	}
+	if got := secret.Get("Password"); got != "" {
+		t.Errorf("Get(Password) == %q, expected empty string", got)
+	}
+	password := "default"
+	secret.Override("Password", &password)
+	if password != "default" {
+		t.Errorf("Override(Password) changed value to %q", password)
+	}
+}
+
+func TestNoBackend(t *testing.T) {
+	r := reporter.NewMock(t)
+	s, err := DefaultConfiguration().New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if _, ok, err := s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.1")); ok || err != nil {
+		t.Fatalf("Lookup() == %v, %v, expected no secret", ok, err)
+	}
+}
+
+func TestFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("WriteFile() error:\n%+v", err)
+		}
+	}
+	write("192.0.2.1.yaml", "community: private\n")
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Backend = BackendFile
+	config.Paths = helpers.MustNewSubnetMap(map[string]string{
+		"::ffff:192.0.2.0/120": filepath.Join(dir, "{exporter}.yaml"),
+	})
+	s, err := config.New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	lookup := func(exporter string) Secret {
+		t.Helper()
+		secret, ok, err := s.Lookup(context.Background(), netip.MustParseAddr(exporter))
+		if err != nil {
+			t.Fatalf("Lookup(%s) error:\n%+v", exporter, err)
+		}
+		if !ok {
+			t.Fatalf("Lookup(%s) did not return a secret", exporter)
+		}
+		return secret
+	}
+
+	if diff := helpers.Diff(lookup("::ffff:192.0.2.1"), Secret{"community": "private"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+
+	// The secret is cached until invalidated
+	write("192.0.2.1.yaml", "community: rotated\n")
+	if diff := helpers.Diff(lookup("::ffff:192.0.2.1"), Secret{"community": "private"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+	s.Invalidate(netip.MustParseAddr("::ffff:192.0.2.1"))
+	if diff := helpers.Diff(lookup("::ffff:192.0.2.1"), Secret{"community": "rotated"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+
+	// When the backend fails, the previous secret is used
+	os.Remove(filepath.Join(dir, "192.0.2.1.yaml"))
+	s.Invalidate(netip.MustParseAddr("::ffff:192.0.2.1"))
+	if diff := helpers.Diff(lookup("::ffff:192.0.2.1"), Secret{"community": "rotated"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+
+	// Without a previous secret, an error is returned
+	if _, _, err := s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.2")); err == nil {
+		t.Fatal("Lookup() did not error")
+	} else if class := helpers.ErrorClassOf(err); class != helpers.ErrorClassConfiguration {
+		t.Fatalf("Lookup() error class %s instead of %s", class, helpers.ErrorClassConfiguration)
+	}
+
+	// Exporters without a path have no secret
+	if _, ok, err := s.Lookup(context.Background(), netip.MustParseAddr("::ffff:198.51.100.1")); ok || err != nil {
+		t.Fatalf("Lookup() == %v, %v, expected no secret", ok, err)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_secrets_")
+	expectedMetrics := map[string]string{
+		`success_requests_total{exporter="192.0.2.1"}`:                     "2",
+		`error_requests_total{error="configuration",exporter="192.0.2.1"}`: "1",
+		`error_requests_total{error="configuration",exporter="192.0.2.2"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,71 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"akvorado/common/helpers"
+	"akvorado/common/helpers/vault"
+)
+
+// fetcher returns a function fetching secrets from Vault. Both KV version 1
+// and version 2 engines are supported.
+func (config VaultConfiguration) fetcher() (fetchFunc, error) {
+	httpClient, err := newHTTPClient(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	client := vault.New(httpClient, config.Address, config.Namespace)
+	return func(ctx context.Context, path string) (Secret, error) {
+		token := os.Getenv("VAULT_TOKEN")
+		if config.TokenFile != "" {
+			content, err := os.ReadFile(config.TokenFile)
+			if err != nil {
+				return nil, helpers.ConfigurationError(fmt.Errorf("cannot read Vault token: %w", err))
+			}
+			token = strings.TrimRight(string(content), "\r\n")
+		}
+		if token == "" {
+			return nil, helpers.ConfigurationError(errors.New("no Vault token"))
+		}
+		data, err := client.Read(ctx, token, path)
+		if err != nil {
+			return nil, classifyVaultError(err)
+		}
+		secret := Secret{}
+		for k, v := range data {
+			if v, ok := v.(string); ok {
+				secret[k] = v
+			}
+		}
+		return secret, nil
+	}, nil
+}
+
+// classifyVaultError classifies an error returned by the Vault client the
+// same way getJSON does.
+func classifyVaultError(err error) error {
+	var statusErr *vault.StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.Code == http.StatusUnauthorized || statusErr.Code == http.StatusForbidden:
+			return helpers.ConfigurationError(err)
+		case statusErr.Code >= 500:
+			return helpers.TransientError(err)
+		}
+		return helpers.PermanentError(err)
+	case errors.As(err, &netErr):
+		return helpers.TransientError(err)
+	}
+	return helpers.PermanentError(err)
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestVaultBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get("X-Vault-Namespace") != "network" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/secret/data/devices/192.0.2.1":
+			w.Write([]byte(`{"data": {"data": {"username": "akvorado", "password": "secret", "port": 830}, "metadata": {"version": 3}}}`))
+		case "/v1/kv/devices/192.0.2.2":
+			w.Write([]byte(`{"data": {"username": "akvorado", "password": "other"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s.token\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Backend = BackendVault
+	config.Paths = helpers.MustNewSubnetMap(map[string]string{
+		"::ffff:192.0.2.1/128": "secret/data/devices/{exporter}",
+		"::ffff:192.0.2.2/128": "kv/devices/{exporter}",
+		"::ffff:192.0.2.3/128": "secret/data/devices/{exporter}",
+	})
+	config.Vault.Address = server.URL
+	config.Vault.TokenFile = tokenFile
+	config.Vault.Namespace = "network"
+	s, err := config.New(r)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	got, _, err := s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.1"))
+	if err != nil {
+		t.Fatalf("Lookup() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, Secret{"username": "akvorado", "password": "secret"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+	_, _, err = s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.3"))
+	if class := helpers.ErrorClassOf(err); class != helpers.ErrorClassPermanent {
+		t.Fatalf("Lookup() error class %s instead of %s", class, helpers.ErrorClassPermanent)
+	}
+
+	// The token is read again on each fetch
+	if err := os.WriteFile(tokenFile, []byte("s.expired\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	_, _, err = s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.2"))
+	if class := helpers.ErrorClassOf(err); class != helpers.ErrorClassConfiguration {
+		t.Fatalf("Lookup() error class %s instead of %s", class, helpers.ErrorClassConfiguration)
+	}
+	if err := os.WriteFile(tokenFile, []byte("s.token\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	got, _, err = s.Lookup(context.Background(), netip.MustParseAddr("::ffff:192.0.2.2"))
+	if err != nil {
+		t.Fatalf("Lookup() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, Secret{"username": "akvorado", "password": "other"}); diff != "" {
+		t.Fatalf("Lookup() (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,125 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"golang.org/x/time/rate"
+
+	"akvorado/common/helpers"
+)
+
+// exporterState keeps the rate limiter and the backoff state of an exporter.
+type exporterState struct {
+	limiter  *rate.Limiter // nil when requests are not limited
+	timeouts int           // number of consecutive timeouts
+	until    time.Time     // do not poll the exporter before this time
+
+	contextEngineID string // discovered context engine ID
+}
+
+// exporterState returns the state of the provided exporter. The lock should
+// be held.
+func (p *Provider) exporterState(exporter netip.Addr) *exporterState {
+	state, ok := p.exporterStates[exporter]
+	if !ok {
+		state = &exporterState{}
+		if p.config.PollerRateLimit > 0 {
+			state.limiter = rate.NewLimiter(p.config.PollerRateLimit, max(1, int(p.config.PollerRateLimit)))
+		}
+		p.exporterStates[exporter] = state
+	}
+	return state
+}
+
+// allowPoll tells if the provided exporter can be polled now. When it cannot,
+// the reason is returned.
+func (p *Provider) allowPoll(exporter netip.Addr, now time.Time) (bool, string) {
+	p.exporterStatesLock.Lock()
+	defer p.exporterStatesLock.Unlock()
+	state := p.exporterState(exporter)
+	if now.Before(state.until) {
+		if p.config.PollerBlackholeThreshold > 0 && state.timeouts >= p.config.PollerBlackholeThreshold {
+			return false, "blackhole"
+		}
+		return false, "backoff"
+	}
+	if state.limiter != nil && !state.limiter.AllowN(now, 1) {
+		return false, "rate limit"
+	}
+	return true, ""
+}
+
+// recordTimeout records a timeout for the provided exporter and computes the
+// time before it can be polled again.
+func (p *Provider) recordTimeout(exporter netip.Addr, now time.Time) {
+	exporterStr := exporter.Unmap().String()
+	p.exporterStatesLock.Lock()
+	defer p.exporterStatesLock.Unlock()
+	state := p.exporterState(exporter)
+	state.timeouts++
+	p.metrics.timeouts.WithLabelValues(exporterStr).Set(float64(state.timeouts))
+	if p.config.PollerBlackholeThreshold > 0 && state.timeouts >= p.config.PollerBlackholeThreshold {
+		if state.timeouts == p.config.PollerBlackholeThreshold {
+			p.errLogger.Warn().
+				Str("exporter", exporterStr).
+				Int("timeouts", state.timeouts).
+				Msgf("too many timeouts, do not poll exporter for %s", p.config.PollerBlackholeDuration)
+		}
+		state.until = now.Add(p.config.PollerBlackholeDuration)
+		p.metrics.blackholed.WithLabelValues(exporterStr).Set(1)
+		return
+	}
+	if p.config.PollerBackoff > 0 {
+		backoff := p.config.PollerBackoff
+		for i := 1; i < state.timeouts && backoff < p.config.PollerMaxBackoff; i++ {
+			backoff *= 2
+		}
+		state.until = now.Add(min(backoff, p.config.PollerMaxBackoff))
+	}
+}
+
+// recordSuccess records an answer from the provided exporter and resets its
+// backoff state.
+func (p *Provider) recordSuccess(exporter netip.Addr) {
+	p.exporterStatesLock.Lock()
+	defer p.exporterStatesLock.Unlock()
+	state, ok := p.exporterStates[exporter]
+	if !ok || state.timeouts == 0 {
+		return
+	}
+	exporterStr := exporter.Unmap().String()
+	state.timeouts = 0
+	state.until = time.Time{}
+	p.metrics.timeouts.WithLabelValues(exporterStr).Set(0)
+	p.metrics.blackholed.WithLabelValues(exporterStr).Set(0)
+}
+
+// classifyError returns the provided error from gosnmp with its class.
+// gosnmp does not use typed errors for timeouts.
+func classifyError(err error) error {
+	if helpers.ErrorClassOf(err) != helpers.ErrorClassUnknown {
+		return err
+	}
+	if strings.Contains(err.Error(), "timeout") {
+		return helpers.TransientError(err)
+	}
+	return err
+}
+
+// classifyStatus returns an error for the provided SNMP error status. Access
+// errors are configuration errors, other errors are permanent.
+func classifyStatus(status gosnmp.SNMPError) error {
+	err := fmt.Errorf("SNMP error %s(%d)", status, status)
+	switch status {
+	case gosnmp.NoAccess, gosnmp.AuthorizationError:
+		return helpers.ConfigurationError(err)
+	}
+	return helpers.PermanentError(err)
+}
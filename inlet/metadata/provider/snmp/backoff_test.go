@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package snmp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+)
+
+func TestBackoff(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(Configuration)
+	configuration.PollerBackoff = time.Second
+	configuration.PollerMaxBackoff = 3 * time.Second
+	configuration.PollerBlackholeThreshold = 4
+	configuration.PollerBlackholeDuration = time.Hour
+	pp, err := configuration.New(r, func(provider.Update) {})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p := pp.(*Provider)
+	exporter := netip.MustParseAddr("::ffff:192.0.2.1")
+	other := netip.MustParseAddr("::ffff:192.0.2.2")
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+
+	expectAllow := func(exporter netip.Addr, now time.Time, expectedOk bool, expectedReason string) {
+		t.Helper()
+		ok, reason := p.allowPoll(exporter, now)
+		if ok != expectedOk || reason != expectedReason {
+			t.Errorf("allowPoll(%s, %s) == %v, %q, expected %v, %q",
+				exporter, now, ok, reason, expectedOk, expectedReason)
+		}
+	}
+
+	expectAllow(exporter, now, true, "")
+	// 1st timeout: 1s backoff
+	p.recordTimeout(exporter, now)
+	expectAllow(exporter, now.Add(500*time.Millisecond), false, "backoff")
+	expectAllow(other, now.Add(500*time.Millisecond), true, "")
+	expectAllow(exporter, now.Add(time.Second), true, "")
+	// 2nd timeout: 2s backoff
+	now = now.Add(time.Second)
+	p.recordTimeout(exporter, now)
+	expectAllow(exporter, now.Add(1500*time.Millisecond), false, "backoff")
+	expectAllow(exporter, now.Add(2*time.Second), true, "")
+	// 3rd timeout: 3s backoff (capped)
+	now = now.Add(2 * time.Second)
+	p.recordTimeout(exporter, now)
+	expectAllow(exporter, now.Add(2500*time.Millisecond), false, "backoff")
+	expectAllow(exporter, now.Add(3*time.Second), true, "")
+	// 4th timeout: blackhole
+	now = now.Add(3 * time.Second)
+	p.recordTimeout(exporter, now)
+	expectAllow(exporter, now.Add(30*time.Minute), false, "blackhole")
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_snmp_",
+		"poller_consecutive_timeouts", "poller_blackholed")
+	expectedMetrics := map[string]string{
+		`poller_consecutive_timeouts{exporter="192.0.2.1"}`: "4",
+		`poller_blackholed{exporter="192.0.2.1"}`:           "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Probe after the blackhole period, then success
+	now = now.Add(time.Hour)
+	expectAllow(exporter, now, true, "")
+	p.recordSuccess(exporter)
+	expectAllow(exporter, now, true, "")
+
+	gotMetrics = r.GetMetrics("akvorado_inlet_metadata_provider_snmp_",
+		"poller_consecutive_timeouts", "poller_blackholed")
+	expectedMetrics = map[string]string{
+		`poller_consecutive_timeouts{exporter="192.0.2.1"}`: "0",
+		`poller_blackholed{exporter="192.0.2.1"}`:           "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(Configuration)
+	configuration.PollerRateLimit = 2
+	pp, err := configuration.New(r, func(provider.Update) {})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p := pp.(*Provider)
+	exporter := netip.MustParseAddr("::ffff:192.0.2.1")
+	other := netip.MustParseAddr("::ffff:192.0.2.2")
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+
+	got := []bool{}
+	for _, exporter := range []netip.Addr{exporter, exporter, exporter, other} {
+		ok, _ := p.allowPoll(exporter, now)
+		got = append(got, ok)
+	}
+	// Tokens are refilled after one second
+	ok, _ := p.allowPoll(exporter, now.Add(time.Second))
+	got = append(got, ok)
+	if diff := helpers.Diff(got, []bool{true, true, false, true, true}); diff != "" {
+		t.Fatalf("allowPoll() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected helpers.ErrorClass
+	}{
+		{errors.New("request timeout (after 1 retries)"), helpers.ErrorClassTransient},
+		{fmt.Errorf("cannot GET: %w", context.DeadlineExceeded), helpers.ErrorClassTransient},
+		{errors.New("connection refused"), helpers.ErrorClassUnknown},
+	}
+	for _, tc := range cases {
+		if got := helpers.ErrorClassOf(classifyError(tc.err)); got != tc.expected {
+			t.Errorf("classifyError(%q) class == %s, expected %s", tc.err, got, tc.expected)
+		}
+	}
+}
+
+func TestClassifyStatus(t *testing.T) {
+	cases := []struct {
+		status   gosnmp.SNMPError
+		expected helpers.ErrorClass
+	}{
+		{gosnmp.AuthorizationError, helpers.ErrorClassConfiguration},
+		{gosnmp.NoAccess, helpers.ErrorClassConfiguration},
+		{gosnmp.GenErr, helpers.ErrorClassPermanent},
+	}
+	for _, tc := range cases {
+		if got := helpers.ErrorClassOf(classifyStatus(tc.status)); got != tc.expected {
+			t.Errorf("classifyStatus(%s) class == %s, expected %s", tc.status, got, tc.expected)
+		}
+	}
+}
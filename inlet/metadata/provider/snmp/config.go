@@ -4,7 +4,9 @@
 package snmp
 
 import (
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/netip"
 	"reflect"
 	"strings"
@@ -12,10 +14,12 @@ import (
 
 	"github.com/gosnmp/gosnmp"
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/time/rate"
 
 	"akvorado/common/helpers"
 	"akvorado/common/helpers/bimap"
 	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
 )
 
 // Configuration describes the configuration for the SNMP client
@@ -24,6 +28,35 @@ type Configuration struct {
 	PollerRetries int `validate:"min=0"`
 	// PollerTimeout tell how much time a poller should wait for an answer
 	PollerTimeout time.Duration `validate:"min=100ms"`
+	// PollerRateLimit is the maximum number of requests per second sent to
+	// the same exporter. 0 means no limit.
+	PollerRateLimit rate.Limit `validate:"min=0"`
+	// PollerBackoff is the time to wait before polling again an exporter
+	// after a timeout. It is doubled after each consecutive timeout, up to
+	// PollerMaxBackoff. 0 disables the backoff.
+	PollerBackoff time.Duration `validate:"min=0"`
+	// PollerMaxBackoff is the maximum time to wait before polling again an
+	// exporter after consecutive timeouts.
+	PollerMaxBackoff time.Duration `validate:"gtefield=PollerBackoff"`
+	// PollerBlackholeThreshold is the number of consecutive timeouts after
+	// which an exporter is not polled at all for PollerBlackholeDuration. 0
+	// disables the blackhole.
+	PollerBlackholeThreshold int `validate:"min=0"`
+	// PollerBlackholeDuration tells how long to not poll an exporter after
+	// too many consecutive timeouts.
+	PollerBlackholeDuration time.Duration `validate:"min=0"`
+	// NegativeCacheDuration tells how long to remember interfaces reported
+	// as nonexistent by an exporter before polling them again
+	NegativeCacheDuration time.Duration `validate:"min=0"`
+	// ResolveLAGSpeed tells to sum the speeds of member links (from
+	// ifStackTable) when an interface has no speed
+	ResolveLAGSpeed bool
+	// FallbackSpeed is a mapping from exporter IPs to the speed to use when
+	// an interface has no speed
+	FallbackSpeed *helpers.SubnetMap[uint]
+	// PrewarmInterfaces tells to walk the interface tables with GetBulk when
+	// an exporter is polled for the first time to get all its interfaces
+	PrewarmInterfaces bool
 
 	// Communities is a mapping from exporter IPs to SNMPv2 communities
 	Communities *helpers.SubnetMap[string]
@@ -33,6 +66,9 @@ type Configuration struct {
 	Agents map[netip.Addr]netip.Addr
 	// Ports is a mapping from exporter IPs to SNMP port
 	Ports *helpers.SubnetMap[uint16]
+	// Secrets defines a backend to fetch communities and SNMPv3 passphrases
+	// from when polling exporters.
+	Secrets secrets.Configuration
 }
 
 // SecurityParameters describes SNMPv3 USM security parameters.
@@ -43,6 +79,13 @@ type SecurityParameters struct {
 	PrivacyProtocol          PrivProtocol
 	PrivacyPassphrase        string `validate:"required_with=PrivacyProtocol"`
 	ContextName              string
+	// ContextEngineID is the context engine ID to use. When empty, the
+	// authoritative engine ID of the agent is used.
+	ContextEngineID EngineID
+	// DiscoverContextEngineID tells to retrieve the context engine ID from
+	// the snmpEngineID object in the context when ContextEngineID is empty.
+	// This is needed for devices behind an SNMP proxy.
+	DiscoverContextEngineID bool
 }
 
 // DefaultConfiguration represents the default configuration for the SNMP client.
@@ -51,6 +94,13 @@ func DefaultConfiguration() provider.Configuration {
 		PollerRetries: 1,
 		PollerTimeout: time.Second,
 
+		PollerBackoff:            2 * time.Second,
+		PollerMaxBackoff:         time.Minute,
+		PollerBlackholeThreshold: 5,
+		PollerBlackholeDuration:  10 * time.Minute,
+
+		NegativeCacheDuration: 30 * time.Minute,
+
 		Communities: helpers.MustNewSubnetMap(map[string]string{
 			"::/0": "public",
 		}),
@@ -58,6 +108,8 @@ func DefaultConfiguration() provider.Configuration {
 		Ports: helpers.MustNewSubnetMap(map[string]uint16{
 			"::/0": 161,
 		}),
+		FallbackSpeed: helpers.MustNewSubnetMap(map[string]uint{}),
+		Secrets:       secrets.DefaultConfiguration(),
 	}
 }
 
@@ -187,9 +239,38 @@ func (pp PrivProtocol) MarshalText() ([]byte, error) {
 	return []byte(pp.String()), nil
 }
 
+// EngineID represents a SNMPv3 engine ID
+type EngineID string
+
+// UnmarshalText parses a SNMPv3 engine ID as an hexadecimal string. Colons
+// and a 0x prefix are accepted.
+func (eid *EngineID) UnmarshalText(text []byte) error {
+	str := strings.ReplaceAll(string(text), ":", "")
+	str = strings.TrimPrefix(strings.TrimPrefix(str, "0x"), "0X")
+	engineID, err := hex.DecodeString(str)
+	if err != nil {
+		return fmt.Errorf("invalid engine ID: %w", err)
+	}
+	if len(engineID) > 0 && (len(engineID) < 5 || len(engineID) > 32) {
+		return errors.New("invalid engine ID: length should be between 5 and 32 bytes")
+	}
+	*eid = EngineID(engineID)
+	return nil
+}
+
+// String turns a SNMPv3 engine ID to an hexadecimal string
+func (eid EngineID) String() string {
+	return hex.EncodeToString([]byte(eid))
+}
+
+// MarshalText turns a SNMPv3 engine ID to an hexadecimal string
+func (eid EngineID) MarshalText() ([]byte, error) {
+	return []byte(eid.String()), nil
+}
+
 func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(ConfigurationUnmarshallerHook())
-	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[string]())
+	// The hook for SubnetMap[string] is registered by the secrets package.
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[SecurityParameters]())
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[uint16]())
 	helpers.RegisterSubnetMapValidation[SecurityParameters]()
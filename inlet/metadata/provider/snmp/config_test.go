@@ -186,6 +186,64 @@ func TestConfigurationUnmarshallerHook(t *testing.T) {
 					},
 				}),
 			},
+		}, {
+			Description: "SNMP security parameters with context engine ID",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"poller-timeout": "200ms",
+					"security-parameters": gin.H{
+						"203.0.113.0/24": gin.H{
+							"user-name":                 "alfred",
+							"authentication-protocol":   "sha",
+							"authentication-passphrase": "hello",
+							"context-name":              "router1",
+							"context-engine-id":         "0x80:00:1f:88:80:5e:27:8a:59",
+						},
+						"198.51.100.0/24": gin.H{
+							"user-name":                  "alfred",
+							"authentication-protocol":    "sha",
+							"authentication-passphrase":  "hello",
+							"context-name":               "router2",
+							"discover-context-engine-id": true,
+						},
+					},
+				}
+			},
+			Expected: Configuration{
+				PollerTimeout: 200 * time.Millisecond,
+				Communities: helpers.MustNewSubnetMap(map[string]string{
+					"::/0": "public",
+				}),
+				SecurityParameters: helpers.MustNewSubnetMap(map[string]SecurityParameters{
+					"::ffff:203.0.113.0/120": {
+						UserName:                 "alfred",
+						AuthenticationProtocol:   AuthProtocol(gosnmp.SHA),
+						AuthenticationPassphrase: "hello",
+						ContextName:              "router1",
+						ContextEngineID:          EngineID("\x80\x00\x1f\x88\x80\x5e\x27\x8a\x59"),
+					},
+					"::ffff:198.51.100.0/120": {
+						UserName:                 "alfred",
+						AuthenticationProtocol:   AuthProtocol(gosnmp.SHA),
+						AuthenticationPassphrase: "hello",
+						ContextName:              "router2",
+						DiscoverContextEngineID:  true,
+					},
+				}),
+			},
+		}, {
+			Description: "SNMP security parameters with invalid context engine ID",
+			Initial:     func() interface{} { return Configuration{} },
+			Configuration: func() interface{} {
+				return gin.H{
+					"security-parameters": gin.H{
+						"user-name":         "alfred",
+						"context-engine-id": "8000",
+					},
+				}
+			},
+			Error: true,
 		}, {
 			Description: "SNMP security parameters without privacy protocol",
 			Initial:     func() interface{} { return Configuration{} },
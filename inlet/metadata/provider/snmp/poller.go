@@ -8,18 +8,70 @@ import (
 	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gosnmp/gosnmp"
 
+	"akvorado/common/helpers"
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
 )
 
+// negativeCacheEntry is an entry of the negative cache. It records an
+// interface reported as nonexistent by an exporter.
+type negativeCacheEntry struct {
+	exporterName string
+	expires      time.Time
+}
+
 // Poll polls the SNMP provider for the requested interface indexes.
 func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port uint16, ifIndexes []uint, put func(provider.Update)) error {
-	// Check if already have a request running
 	exporterStr := exporter.Unmap().String()
+
+	// Answer directly for interfaces known to be missing
+	if p.config.NegativeCacheDuration > 0 {
+		now := time.Now()
+		remainingIfIndexes := make([]uint, 0, len(ifIndexes))
+		updates := []provider.Update{}
+		p.negativeCacheLock.Lock()
+		for _, ifIndex := range ifIndexes {
+			query := provider.Query{ExporterIP: exporter, IfIndex: ifIndex}
+			entry, ok := p.negativeCache[query]
+			if ok && now.Before(entry.expires) {
+				updates = append(updates, provider.Update{
+					Query: query,
+					Answer: provider.Answer{
+						Exporter: provider.Exporter{Name: entry.exporterName},
+					},
+				})
+				continue
+			}
+			if ok {
+				delete(p.negativeCache, query)
+			}
+			remainingIfIndexes = append(remainingIfIndexes, ifIndex)
+		}
+		p.negativeCacheLock.Unlock()
+		for _, update := range updates {
+			p.metrics.negativeHits.WithLabelValues(exporterStr).Inc()
+			put(update)
+		}
+		if len(remainingIfIndexes) == 0 {
+			return nil
+		}
+		ifIndexes = remainingIfIndexes
+	}
+
+	// Do not poll exporters over their rate limit or in backoff
+	if ok, reason := p.allowPoll(exporter, time.Now()); !ok {
+		p.metrics.skipped.WithLabelValues(exporterStr, reason).Inc()
+		return nil
+	}
+
+	// Check if already have a request running
 	filteredIfIndexes := make([]uint, 0, len(ifIndexes))
 	keys := make([]string, 0, len(ifIndexes))
 	p.pendingRequestsLock.Lock()
@@ -45,6 +97,14 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 		p.pendingRequestsLock.Unlock()
 	}()
 
+	// Fetch credentials from the secret backend
+	secret, _, err := p.secrets.Lookup(ctx, exporter)
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "secret").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to fetch credentials")
+		return err
+	}
+
 	// Instantiate an SNMP state
 	g := &gosnmp.GoSNMP{
 		Context:                 ctx,
@@ -58,9 +118,18 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 			p.metrics.retries.WithLabelValues(exporterStr).Inc()
 		},
 	}
+	if agent.Unmap().Is4() {
+		g.Transport = "udp4"
+	} else {
+		g.Transport = "udp6"
+	}
+	discoverContextEngineID := false
 	if securityParameters, ok := p.config.SecurityParameters.Lookup(exporter); ok {
 		g.Version = gosnmp.Version3
 		g.SecurityModel = gosnmp.UserSecurityModel
+		secret.Override("UserName", &securityParameters.UserName)
+		secret.Override("AuthenticationPassphrase", &securityParameters.AuthenticationPassphrase)
+		secret.Override("PrivacyPassphrase", &securityParameters.PrivacyPassphrase)
 		usmSecurityParameters := gosnmp.UsmSecurityParameters{
 			UserName:                 securityParameters.UserName,
 			AuthenticationProtocol:   gosnmp.SnmpV3AuthProtocol(securityParameters.AuthenticationProtocol),
@@ -84,50 +153,106 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 			}
 		}
 		g.ContextName = securityParameters.ContextName
+		g.ContextEngineID = string(securityParameters.ContextEngineID)
+		discoverContextEngineID = g.ContextEngineID == "" && securityParameters.DiscoverContextEngineID
 	} else {
 		g.Version = gosnmp.Version2c
 		g.Community = p.config.Communities.LookupOrDefault(exporter, "public")
+		secret.Override("Community", &g.Community)
 	}
 
 	if err := g.Connect(); err != nil {
 		p.metrics.errors.WithLabelValues(exporterStr, "connect").Inc()
 		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to connect")
 	}
+	if discoverContextEngineID {
+		if contextEngineID := p.contextEngineID(g, exporter, exporterStr); contextEngineID != "" {
+			g.ContextEngineID = contextEngineID
+		}
+	}
+
+	// Walk interface tables the first time an exporter is seen
+	if p.config.PrewarmInterfaces && p.firstSeen(exporter) {
+		walked := p.walkInterfaces(g, exporter, exporterStr, put)
+		remainingIfIndexes := make([]uint, 0, len(ifIndexes))
+		for _, ifIndex := range ifIndexes {
+			if _, ok := walked[ifIndex]; !ok {
+				remainingIfIndexes = append(remainingIfIndexes, ifIndex)
+			}
+		}
+		if len(remainingIfIndexes) == 0 {
+			return nil
+		}
+		ifIndexes = remainingIfIndexes
+	}
+
 	start := time.Now()
-	requests := []string{"1.3.6.1.2.1.1.5.0"}
+	requests := []string{
+		"1.3.6.1.2.1.1.5.0", // sysName
+		"1.3.6.1.2.1.1.3.0", // sysUpTime
+	}
 	for _, ifIndex := range ifIndexes {
 		moreRequests := []string{
 			fmt.Sprintf("1.3.6.1.2.1.2.2.1.2.%d", ifIndex),     // ifDescr
 			fmt.Sprintf("1.3.6.1.2.1.31.1.1.1.18.%d", ifIndex), // ifAlias
 			fmt.Sprintf("1.3.6.1.2.1.31.1.1.1.15.%d", ifIndex), // ifSpeed
+			fmt.Sprintf("1.3.6.1.2.1.2.2.1.7.%d", ifIndex),     // ifAdminStatus
+			fmt.Sprintf("1.3.6.1.2.1.2.2.1.8.%d", ifIndex),     // ifOperStatus
+			fmt.Sprintf("1.3.6.1.2.1.2.2.1.9.%d", ifIndex),     // ifLastChange
 		}
 		requests = append(requests, moreRequests...)
 	}
-	result, err := g.Get(requests)
-	if errors.Is(err, context.Canceled) {
-		return nil
-	}
-	if err != nil {
-		p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
-		p.errLogger.Err(err).
-			Str("exporter", exporterStr).
-			Msgf("unable to GET (%d OIDs)", len(requests))
-		return err
-	}
-	if result.Error != gosnmp.NoError && result.ErrorIndex == 0 {
-		// There is some error affecting the whole request
-		p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
-		p.errLogger.Error().
-			Str("exporter", exporterStr).
-			Stringer("code", result.Error).
-			Msgf("unable to GET (%d OIDs)", len(requests))
-		return fmt.Errorf("SNMP error %s(%d)", result.Error, result.Error)
+	// Split the request to not exceed the maximum number of OIDs per PDU
+	variables := make([]gosnmp.SnmpPDU, 0, len(requests))
+	for len(variables) < len(requests) {
+		chunk := requests[len(variables):min(len(variables)+gosnmp.MaxOids, len(requests))]
+		result, err := g.Get(chunk)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			err = classifyError(err)
+			class := helpers.ErrorClassOf(err)
+			p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
+			p.errLogger.Err(err).
+				Str("exporter", exporterStr).
+				Stringer("class", class).
+				Msgf("unable to GET (%d OIDs)", len(chunk))
+			switch class {
+			case helpers.ErrorClassTransient:
+				p.recordTimeout(exporter, time.Now())
+			case helpers.ErrorClassConfiguration:
+				p.secrets.Invalidate(exporter)
+			}
+			return err
+		}
+		p.recordSuccess(exporter)
+		if result.Error != gosnmp.NoError && result.ErrorIndex == 0 {
+			// There is some error affecting the whole request
+			err := classifyStatus(result.Error)
+			p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
+			p.errLogger.Error().
+				Str("exporter", exporterStr).
+				Stringer("code", result.Error).
+				Stringer("class", helpers.ErrorClassOf(err)).
+				Msgf("unable to GET (%d OIDs)", len(chunk))
+			if helpers.ErrorClassOf(err) == helpers.ErrorClassConfiguration {
+				p.secrets.Invalidate(exporter)
+			}
+			return err
+		}
+		if len(result.Variables) != len(chunk) {
+			p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
+			return helpers.PermanentError(fmt.Errorf("SNMP answer has %d variables instead of %d",
+				len(result.Variables), len(chunk)))
+		}
+		variables = append(variables, result.Variables...)
 	}
 
 	processStr := func(idx int, what string, target *string) bool {
-		switch result.Variables[idx].Type {
+		switch variables[idx].Type {
 		case gosnmp.OctetString:
-			*target = string(result.Variables[idx].Value.([]byte))
+			*target = string(variables[idx].Value.([]byte))
 		case gosnmp.NoSuchInstance, gosnmp.NoSuchObject:
 			p.metrics.errors.WithLabelValues(exporterStr, fmt.Sprintf("%s missing", what)).Inc()
 			return false
@@ -138,9 +263,9 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 		return true
 	}
 	processUint := func(idx int, what string, target *uint) bool {
-		switch result.Variables[idx].Type {
+		switch variables[idx].Type {
 		case gosnmp.Gauge32:
-			*target = result.Variables[idx].Value.(uint)
+			*target = variables[idx].Value.(uint)
 		case gosnmp.NoSuchInstance, gosnmp.NoSuchObject:
 			p.metrics.errors.WithLabelValues(exporterStr, fmt.Sprintf("%s missing", what)).Inc()
 			return false
@@ -150,19 +275,41 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 		}
 		return true
 	}
+	// Status and timeticks are optional: no error is reported when missing.
+	processStatus := func(idx int, target *provider.InterfaceStatus) {
+		if variables[idx].Type == gosnmp.Integer {
+			if value := variables[idx].Value.(int); value > 0 && value <= int(provider.InterfaceStatusLowerLayerDown) {
+				*target = provider.InterfaceStatus(value)
+			}
+		}
+	}
+	processTimeTicks := func(idx int) (uint32, bool) {
+		if variables[idx].Type == gosnmp.TimeTicks {
+			return variables[idx].Value.(uint32), true
+		}
+		return 0, false
+	}
+	missing := func(idx int) bool {
+		return variables[idx].Type == gosnmp.NoSuchInstance ||
+			variables[idx].Type == gosnmp.NoSuchObject
+	}
 	var (
 		sysNameVal string
 	)
 	if !processStr(0, "sysname", &sysNameVal) {
 		return errors.New("unable to get sysName")
 	}
-	for idx := 1; idx < len(requests)-2; idx += 3 {
+	sysUpTimeVal, sysUpTimeOk := processTimeTicks(1)
+	for idx := 2; idx < len(requests)-5; idx += 6 {
 		var (
-			ifDescrVal string
-			ifAliasVal string
-			ifSpeedVal uint
+			ifDescrVal       string
+			ifAliasVal       string
+			ifSpeedVal       uint
+			ifAdminStatusVal provider.InterfaceStatus
+			ifOperStatusVal  provider.InterfaceStatus
+			ifLastChangeVal  time.Time
 		)
-		ifIndex := ifIndexes[(idx-1)/3]
+		ifIndex := ifIndexes[(idx-2)/6]
 		ok := true
 		// We do not process results when index is 0 (this can happen for local
 		// traffic, we only care for exporter name).
@@ -179,6 +326,20 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 		if ok {
 			p.metrics.successes.WithLabelValues(exporterStr).Inc()
 		}
+		if ifIndex > 0 && missing(idx) && missing(idx+1) && missing(idx+2) {
+			// The interface does not exist, remember it
+			p.addToNegativeCache(exporter, ifIndex, sysNameVal)
+		} else if ifIndex > 0 && ifSpeedVal == 0 {
+			ifSpeedVal = p.missingSpeed(g, exporter, exporterStr, ifIndex)
+		}
+		if ifIndex > 0 {
+			processStatus(idx+3, &ifAdminStatusVal)
+			processStatus(idx+4, &ifOperStatusVal)
+			// ifLastChange is the value of sysUpTime at the last change
+			if lastChange, ok := processTimeTicks(idx + 5); ok && sysUpTimeOk && lastChange <= sysUpTimeVal {
+				ifLastChangeVal = start.Add(-time.Duration(sysUpTimeVal-lastChange) * 10 * time.Millisecond)
+			}
+		}
 		put(provider.Update{
 			Query: provider.Query{
 				ExporterIP: exporter,
@@ -192,6 +353,9 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 					Name:        ifDescrVal,
 					Description: ifAliasVal,
 					Speed:       ifSpeedVal,
+					AdminStatus: ifAdminStatusVal,
+					OperStatus:  ifOperStatusVal,
+					LastChange:  ifLastChangeVal,
 				},
 			},
 		})
@@ -201,6 +365,192 @@ func (p *Provider) Poll(ctx context.Context, exporter, agent netip.Addr, port ui
 	return nil
 }
 
+// missingSpeed returns the speed to use for an interface without speed. It may
+// be a LAG.
+func (p *Provider) missingSpeed(g *gosnmp.GoSNMP, exporter netip.Addr, exporterStr string, ifIndex uint) uint {
+	var speed uint
+	if p.config.ResolveLAGSpeed {
+		speed = p.lagSpeed(g, exporterStr, ifIndex)
+	}
+	if speed == 0 && p.config.FallbackSpeed != nil {
+		speed = p.config.FallbackSpeed.LookupOrDefault(exporter, 0)
+	}
+	return speed
+}
+
+// firstSeen tells if the provided exporter is seen for the first time.
+func (p *Provider) firstSeen(exporter netip.Addr) bool {
+	p.prewarmedLock.Lock()
+	defer p.prewarmedLock.Unlock()
+	if _, ok := p.prewarmed[exporter]; ok {
+		return false
+	}
+	p.prewarmed[exporter] = struct{}{}
+	return true
+}
+
+// walkInterfaces walks the interface tables (ifTable and ifXTable) of an
+// exporter to retrieve all its interfaces. Each of them is provided to the put
+// function. It returns the set of retrieved interface indexes.
+func (p *Provider) walkInterfaces(g *gosnmp.GoSNMP, exporter netip.Addr, exporterStr string, put func(provider.Update)) map[uint]struct{} {
+	result, err := g.Get([]string{
+		"1.3.6.1.2.1.1.5.0", // sysName
+		"1.3.6.1.2.1.1.3.0", // sysUpTime
+	})
+	if err != nil || len(result.Variables) != 2 || result.Variables[0].Type != gosnmp.OctetString {
+		p.metrics.errors.WithLabelValues(exporterStr, "walk").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to get sysName")
+		return nil
+	}
+	start := time.Now()
+	sysNameVal := string(result.Variables[0].Value.([]byte))
+	sysUpTimeVal, sysUpTimeOk := result.Variables[1].Value.(uint32)
+
+	columns := []string{
+		"1.3.6.1.2.1.2.2.1.2",     // ifDescr
+		"1.3.6.1.2.1.31.1.1.1.18", // ifAlias
+		"1.3.6.1.2.1.31.1.1.1.15", // ifSpeed
+		"1.3.6.1.2.1.2.2.1.7",     // ifAdminStatus
+		"1.3.6.1.2.1.2.2.1.8",     // ifOperStatus
+		"1.3.6.1.2.1.2.2.1.9",     // ifLastChange
+	}
+	values := make([]map[uint]gosnmp.SnmpPDU, len(columns))
+	ifIndexes := map[uint]struct{}{}
+	for idx, column := range columns {
+		pdus, err := g.BulkWalkAll(column)
+		if err != nil {
+			p.metrics.errors.WithLabelValues(exporterStr, "walk").Inc()
+			p.errLogger.Err(err).
+				Str("exporter", exporterStr).
+				Str("oid", column).
+				Msg("unable to walk interface table")
+			return nil
+		}
+		values[idx] = make(map[uint]gosnmp.SnmpPDU, len(pdus))
+		for _, pdu := range pdus {
+			index, ok := strings.CutPrefix(pdu.Name, fmt.Sprintf(".%s.", column))
+			if !ok {
+				continue
+			}
+			ifIndex, err := strconv.ParseUint(index, 10, 32)
+			if err != nil || ifIndex == 0 {
+				continue
+			}
+			values[idx][uint(ifIndex)] = pdu
+			ifIndexes[uint(ifIndex)] = struct{}{}
+		}
+	}
+
+	sortedIfIndexes := make([]uint, 0, len(ifIndexes))
+	for ifIndex := range ifIndexes {
+		sortedIfIndexes = append(sortedIfIndexes, ifIndex)
+	}
+	slices.Sort(sortedIfIndexes)
+	for _, ifIndex := range sortedIfIndexes {
+		var iface provider.Interface
+		if pdu, ok := values[0][ifIndex]; ok && pdu.Type == gosnmp.OctetString {
+			iface.Name = string(pdu.Value.([]byte))
+		}
+		if pdu, ok := values[1][ifIndex]; ok && pdu.Type == gosnmp.OctetString {
+			iface.Description = string(pdu.Value.([]byte))
+		}
+		if pdu, ok := values[2][ifIndex]; ok && pdu.Type == gosnmp.Gauge32 {
+			iface.Speed = pdu.Value.(uint)
+		}
+		for idx, target := range []*provider.InterfaceStatus{&iface.AdminStatus, &iface.OperStatus} {
+			if pdu, ok := values[3+idx][ifIndex]; ok && pdu.Type == gosnmp.Integer {
+				if value := pdu.Value.(int); value > 0 && value <= int(provider.InterfaceStatusLowerLayerDown) {
+					*target = provider.InterfaceStatus(value)
+				}
+			}
+		}
+		if pdu, ok := values[5][ifIndex]; ok && pdu.Type == gosnmp.TimeTicks && sysUpTimeOk {
+			if lastChange := pdu.Value.(uint32); lastChange <= sysUpTimeVal {
+				iface.LastChange = start.Add(-time.Duration(sysUpTimeVal-lastChange) * 10 * time.Millisecond)
+			}
+		}
+		if iface.Speed == 0 {
+			iface.Speed = p.missingSpeed(g, exporter, exporterStr, ifIndex)
+		}
+		p.metrics.walked.WithLabelValues(exporterStr).Inc()
+		put(provider.Update{
+			Query: provider.Query{
+				ExporterIP: exporter,
+				IfIndex:    ifIndex,
+			},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{
+					Name: sysNameVal,
+				},
+				Interface: iface,
+			},
+		})
+	}
+	p.metrics.times.WithLabelValues(exporterStr).Observe(time.Now().Sub(start).Seconds())
+	return ifIndexes
+}
+
+// lagSpeed returns the sum of the speeds of the members of the provided
+// interface. Members are retrieved from ifStackTable.
+func (p *Provider) lagSpeed(g *gosnmp.GoSNMP, exporterStr string, ifIndex uint) uint {
+	prefix := fmt.Sprintf(".1.3.6.1.2.1.31.1.2.1.3.%d.", ifIndex) // ifStackStatus
+	pdus, err := g.BulkWalkAll(strings.TrimSuffix(prefix, "."))
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "ifstack walk").Inc()
+		p.errLogger.Err(err).
+			Str("exporter", exporterStr).
+			Uint("ifindex", ifIndex).
+			Msg("unable to walk ifStackTable")
+		return 0
+	}
+	requests := []string{}
+	for _, pdu := range pdus {
+		member, ok := strings.CutPrefix(pdu.Name, prefix)
+		if !ok || member == "0" {
+			continue
+		}
+		requests = append(requests, fmt.Sprintf("1.3.6.1.2.1.31.1.1.1.15.%s", member)) // ifSpeed
+	}
+	if len(requests) == 0 {
+		return 0
+	}
+	result, err := g.Get(requests)
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "get").Inc()
+		p.errLogger.Err(err).
+			Str("exporter", exporterStr).
+			Msgf("unable to GET (%d OIDs)", len(requests))
+		return 0
+	}
+	var speed uint
+	for _, variable := range result.Variables {
+		if variable.Type == gosnmp.Gauge32 {
+			speed += variable.Value.(uint)
+		}
+	}
+	return speed
+}
+
+// addToNegativeCache records an interface as nonexistent. Expired entries are
+// removed at the same time.
+func (p *Provider) addToNegativeCache(exporter netip.Addr, ifIndex uint, exporterName string) {
+	if p.config.NegativeCacheDuration <= 0 {
+		return
+	}
+	now := time.Now()
+	p.negativeCacheLock.Lock()
+	defer p.negativeCacheLock.Unlock()
+	for query, entry := range p.negativeCache {
+		if !now.Before(entry.expires) {
+			delete(p.negativeCache, query)
+		}
+	}
+	p.negativeCache[provider.Query{ExporterIP: exporter, IfIndex: ifIndex}] = negativeCacheEntry{
+		exporterName: exporterName,
+		expires:      now.Add(p.config.NegativeCacheDuration),
+	}
+}
+
 type goSNMPLogger struct {
 	r *reporter.Reporter
 }
@@ -216,3 +566,38 @@ func (l *goSNMPLogger) Printf(format string, v ...interface{}) {
 		e.Msg(fmt.Sprintf(format, v...))
 	}
 }
+
+// contextEngineID returns the context engine ID of the provided exporter. It
+// is retrieved from the snmpEngineID object in the context on first use. This
+// is needed when the exporter is behind an SNMP proxy as the authoritative
+// engine ID is the one of the proxy. An empty string is returned on error.
+func (p *Provider) contextEngineID(g *gosnmp.GoSNMP, exporter netip.Addr, exporterStr string) string {
+	p.exporterStatesLock.Lock()
+	contextEngineID := p.exporterState(exporter).contextEngineID
+	p.exporterStatesLock.Unlock()
+	if contextEngineID != "" {
+		return contextEngineID
+	}
+
+	result, err := g.Get([]string{"1.3.6.1.6.3.10.2.1.1.0"}) // snmpEngineID
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "engine id discovery").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to discover context engine ID")
+		return ""
+	}
+	if len(result.Variables) != 1 || result.Variables[0].Type != gosnmp.OctetString {
+		p.metrics.errors.WithLabelValues(exporterStr, "engine id discovery").Inc()
+		p.errLogger.Error().Str("exporter", exporterStr).Msg("unable to discover context engine ID")
+		return ""
+	}
+	contextEngineID = string(result.Variables[0].Value.([]byte))
+	p.r.Debug().
+		Str("exporter", exporterStr).
+		Stringer("engine-id", EngineID(contextEngineID)).
+		Msg("context engine ID discovered")
+
+	p.exporterStatesLock.Lock()
+	p.exporterState(exporter).contextEngineID = contextEngineID
+	p.exporterStatesLock.Unlock()
+	return contextEngineID
+}
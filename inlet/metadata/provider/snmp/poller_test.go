@@ -27,6 +27,8 @@ func TestPoller(t *testing.T) {
 		Skip        string
 		Config      Configuration
 		ExporterIP  netip.Addr
+
+		ContextEngineID EngineID // expected discovered context engine ID
 	}{
 		{
 			Description: "SNMPv2",
@@ -72,6 +74,27 @@ func TestPoller(t *testing.T) {
 					},
 				}),
 			},
+		}, {
+			Description: "SNMPv3 with context engine ID discovery",
+			Config: Configuration{
+				PollerRetries: 2,
+				PollerTimeout: 100 * time.Millisecond,
+				Communities: helpers.MustNewSubnetMap(map[string]string{
+					"::/0": "public",
+				}),
+				SecurityParameters: helpers.MustNewSubnetMap(map[string]SecurityParameters{
+					"::/0": {
+						UserName:                 "alfred",
+						AuthenticationProtocol:   AuthProtocol(gosnmp.MD5),
+						AuthenticationPassphrase: "hello",
+						PrivacyProtocol:          PrivProtocol(gosnmp.AES),
+						PrivacyPassphrase:        "bye",
+						ContextName:              "private",
+						DiscoverContextEngineID:  true,
+					},
+				}),
+			},
+			ContextEngineID: EngineID("\x80\x00\x1f\x88\x80\x5e\x27\x8a\x59"),
 		}, {
 			Description: "SNMPv3 no priv",
 			Skip:        "GoSNMPServer is broken with this configuration",
@@ -132,6 +155,48 @@ func TestPoller(t *testing.T) {
 								OnGet: func() (interface{}, error) {
 									return "exporter62", nil
 								},
+							}, {
+								OID:  "1.3.6.1.2.1.1.3.0",
+								Type: gosnmp.TimeTicks,
+								OnGet: func() (interface{}, error) {
+									return uint32(100000), nil
+								},
+							}, {
+								OID:  "1.3.6.1.6.3.10.2.1.1.0",
+								Type: gosnmp.OctetString,
+								OnGet: func() (interface{}, error) {
+									return "\x80\x00\x1f\x88\x80\x5e\x27\x8a\x59", nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.7.641",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 1, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.8.641",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 1, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.9.641",
+								Type: gosnmp.TimeTicks,
+								OnGet: func() (interface{}, error) {
+									return uint32(40000), nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.7.642",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 1, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.8.642",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 2, nil
+								},
 							}, {
 								OID:  "1.3.6.1.2.1.2.2.1.2.641",
 								Type: gosnmp.OctetString,
@@ -182,6 +247,55 @@ func TestPoller(t *testing.T) {
 								},
 							},
 							// ifAlias.643 missing
+							{
+								OID:  "1.3.6.1.2.1.2.2.1.2.645",
+								Type: gosnmp.OctetString,
+								OnGet: func() (interface{}, error) {
+									return "Po1", nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.1.1.15.645",
+								Type: gosnmp.Gauge32,
+								OnGet: func() (interface{}, error) {
+									return uint(0), nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.1.1.18.645",
+								Type: gosnmp.OctetString,
+								OnGet: func() (interface{}, error) {
+									return "LAG", nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.2.1.3.645.641",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 1, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.2.1.3.645.642",
+								Type: gosnmp.Integer,
+								OnGet: func() (interface{}, error) {
+									return 1, nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.2.2.1.2.646",
+								Type: gosnmp.OctetString,
+								OnGet: func() (interface{}, error) {
+									return "Gi0/0/0/6", nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.1.1.15.646",
+								Type: gosnmp.Gauge32,
+								OnGet: func() (interface{}, error) {
+									return uint(0), nil
+								},
+							}, {
+								OID:  "1.3.6.1.2.1.31.1.1.1.18.646",
+								Type: gosnmp.OctetString,
+								OnGet: func() (interface{}, error) {
+									return "No speed", nil
+								},
+							},
 						},
 					},
 				},
@@ -204,13 +318,23 @@ func TestPoller(t *testing.T) {
 
 			got := []string{}
 			config := tc.Config
+			config.NegativeCacheDuration = time.Minute
+			config.ResolveLAGSpeed = true
+			config.FallbackSpeed = helpers.MustNewSubnetMap(map[string]uint{
+				"::/0": 1000,
+			})
 			config.Ports = helpers.MustNewSubnetMap(map[string]uint16{
 				"::/0": uint16(port),
 			})
 			put := func(update provider.Update) {
-				got = append(got, fmt.Sprintf("%s %s %d %s %s %d",
+				lastChange := ""
+				if !update.Interface.LastChange.IsZero() {
+					lastChange = time.Since(update.Interface.LastChange).Round(time.Minute).String()
+				}
+				got = append(got, fmt.Sprintf("%s %s %d %s %s %d %s %s %s",
 					update.ExporterIP.Unmap().String(), update.Exporter.Name,
-					update.IfIndex, update.Interface.Name, update.Interface.Description, update.Interface.Speed))
+					update.IfIndex, update.Interface.Name, update.Interface.Description, update.Interface.Speed,
+					update.Interface.AdminStatus, update.Interface.OperStatus, lastChange))
 			}
 			p, err := config.New(r, put)
 			if err != nil {
@@ -221,29 +345,215 @@ func TestPoller(t *testing.T) {
 			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: []uint{642}})
 			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: []uint{643, 644}})
 			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: []uint{0}})
+			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: []uint{644}})
+			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: []uint{645, 646}})
+			// Large request, split into several PDUs (GoSNMPServer does not
+			// handle correctly a PDU starting with a missing OID, so the
+			// second PDU starts in the middle of 641)
+			largeIfIndexes := []uint{}
+			for ifIndex := uint(1000); ifIndex < 1009; ifIndex++ {
+				largeIfIndexes = append(largeIfIndexes, ifIndex)
+			}
+			largeIfIndexes = append(largeIfIndexes, 641)
+			p.Query(context.Background(), provider.BatchQuery{ExporterIP: tc.ExporterIP, IfIndexes: largeIfIndexes})
 			exporterStr := tc.ExporterIP.Unmap().String()
 			time.Sleep(50 * time.Millisecond)
-			if diff := helpers.Diff(got, []string{
-				fmt.Sprintf(`%s exporter62 641 Gi0/0/0/0 Transit 10000`, exporterStr),
-				fmt.Sprintf(`%s exporter62 642 Gi0/0/0/1 Peering 20000`, exporterStr),
-				fmt.Sprintf(`%s exporter62 643 Gi0/0/0/2  10000`, exporterStr), // no ifAlias
-				fmt.Sprintf(`%s exporter62 644   0`, exporterStr),              // negative cache
-				fmt.Sprintf(`%s exporter62 0   0`, exporterStr),
-			}); diff != "" {
+			expected := []string{
+				fmt.Sprintf(`%s exporter62 641 Gi0/0/0/0 Transit 10000 up up 10m0s`, exporterStr),
+				fmt.Sprintf(`%s exporter62 642 Gi0/0/0/1 Peering 20000 up down `, exporterStr),
+				fmt.Sprintf(`%s exporter62 643 Gi0/0/0/2  10000   `, exporterStr), // no ifAlias
+				fmt.Sprintf(`%s exporter62 644   0   `, exporterStr),              // missing interface
+				fmt.Sprintf(`%s exporter62 0   0   `, exporterStr),
+				fmt.Sprintf(`%s exporter62 644   0   `, exporterStr), // from negative cache
+				fmt.Sprintf(`%s exporter62 645 Po1 LAG 30000   `, exporterStr),
+				fmt.Sprintf(`%s exporter62 646 Gi0/0/0/6 No speed 1000   `, exporterStr),
+			}
+			for _, ifIndex := range largeIfIndexes[:9] {
+				expected = append(expected, fmt.Sprintf(`%s exporter62 %d   0   `, exporterStr, ifIndex))
+			}
+			expected = append(expected,
+				fmt.Sprintf(`%s exporter62 641 Gi0/0/0/0 Transit 10000 up up 10m0s`, exporterStr))
+			if diff := helpers.Diff(got, expected); diff != "" {
 				t.Fatalf("Poll() (-got, +want):\n%s", diff)
 			}
 
-			gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_snmp_poller_", "error_", "pending_", "success_")
+			gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_snmp_poller_",
+				"error_", "negative_", "pending_", "success_")
 			expectedMetrics := map[string]string{
-				fmt.Sprintf(`error_requests_total{error="ifalias missing",exporter="%s"}`, exporterStr): "2", // 643+644
-				fmt.Sprintf(`error_requests_total{error="ifdescr missing",exporter="%s"}`, exporterStr): "1", // 644
-				fmt.Sprintf(`error_requests_total{error="ifspeed missing",exporter="%s"}`, exporterStr): "1", // 644
+				fmt.Sprintf(`error_requests_total{error="ifalias missing",exporter="%s"}`, exporterStr): "11", // 643+644+1000-1008
+				fmt.Sprintf(`error_requests_total{error="ifdescr missing",exporter="%s"}`, exporterStr): "10", // 644+1000-1008
+				fmt.Sprintf(`error_requests_total{error="ifspeed missing",exporter="%s"}`, exporterStr): "10", // 644+1000-1008
+				fmt.Sprintf(`negative_cache_hits_total{exporter="%s"}`, exporterStr):                    "1",
 				`pending_requests`: "0",
-				fmt.Sprintf(`success_requests_total{exporter="%s"}`, exporterStr): "3", // 641+642+0
+				fmt.Sprintf(`success_requests_total{exporter="%s"}`, exporterStr): "6", // 641+642+0+645+646+641
 			}
 			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 				t.Fatalf("Metrics (-got, +want):\n%s", diff)
 			}
+
+			if tc.ContextEngineID != "" {
+				state := p.(*Provider).exporterStates[tc.ExporterIP]
+				if state == nil || EngineID(state.contextEngineID) != tc.ContextEngineID {
+					t.Fatalf("Poll() did not discover context engine ID %s", tc.ContextEngineID)
+				}
+			}
+		})
+	}
+}
+
+func TestPollerPrewarm(t *testing.T) {
+	r := reporter.NewMock(t)
+	oids := []*GoSNMPServer.PDUValueControlItem{}
+	add := func(oid string, typ gosnmp.Asn1BER, value interface{}) {
+		oids = append(oids, &GoSNMPServer.PDUValueControlItem{
+			OID:  oid,
+			Type: typ,
+			OnGet: func() (interface{}, error) {
+				return value, nil
+			},
 		})
 	}
+	add("1.3.6.1.2.1.1.3.0", gosnmp.TimeTicks, uint32(100000))
+	add("1.3.6.1.2.1.1.5.0", gosnmp.OctetString, "exporter62")
+	add("1.3.6.1.2.1.2.2.1.2.641", gosnmp.OctetString, "Gi0/0/0/0")
+	add("1.3.6.1.2.1.2.2.1.2.642", gosnmp.OctetString, "Gi0/0/0/1")
+	add("1.3.6.1.2.1.2.2.1.2.643", gosnmp.OctetString, "Gi0/0/0/2")
+	add("1.3.6.1.2.1.2.2.1.7.641", gosnmp.Integer, 1)
+	add("1.3.6.1.2.1.2.2.1.7.642", gosnmp.Integer, 1)
+	add("1.3.6.1.2.1.2.2.1.8.641", gosnmp.Integer, 1)
+	add("1.3.6.1.2.1.2.2.1.8.642", gosnmp.Integer, 2)
+	add("1.3.6.1.2.1.2.2.1.9.641", gosnmp.TimeTicks, uint32(40000))
+	add("1.3.6.1.2.1.31.1.1.1.15.641", gosnmp.Gauge32, uint(10000))
+	add("1.3.6.1.2.1.31.1.1.1.15.642", gosnmp.Gauge32, uint(20000))
+	add("1.3.6.1.2.1.31.1.1.1.15.643", gosnmp.Gauge32, uint(0))
+	add("1.3.6.1.2.1.31.1.1.1.18.641", gosnmp.OctetString, "Transit")
+	add("1.3.6.1.2.1.31.1.1.1.18.642", gosnmp.OctetString, "Peering")
+	server := GoSNMPServer.NewSNMPServer(GoSNMPServer.MasterAgent{
+		SubAgents: []*GoSNMPServer.SubAgent{
+			{
+				CommunityIDs: []string{"public"},
+				OIDs:         oids,
+			},
+		},
+	})
+	if err := server.ListenUDP("udp", "127.0.0.1:0"); err != nil {
+		t.Fatalf("ListenUDP() err:\n%+v", err)
+	}
+	_, portStr, _ := net.SplitHostPort(server.Address().String())
+	port, _ := strconv.Atoi(portStr)
+	go server.ServeForever()
+	defer server.Shutdown()
+
+	config := DefaultConfiguration().(Configuration)
+	config.PollerTimeout = 100 * time.Millisecond
+	config.PrewarmInterfaces = true
+	config.FallbackSpeed = helpers.MustNewSubnetMap(map[string]uint{
+		"::/0": 1000,
+	})
+	config.Ports = helpers.MustNewSubnetMap(map[string]uint16{
+		"::/0": uint16(port),
+	})
+	got := []string{}
+	put := func(update provider.Update) {
+		lastChange := ""
+		if !update.Interface.LastChange.IsZero() {
+			lastChange = time.Since(update.Interface.LastChange).Round(time.Minute).String()
+		}
+		got = append(got, fmt.Sprintf("%s %d %s %s %d %s %s %s",
+			update.Exporter.Name,
+			update.IfIndex, update.Interface.Name, update.Interface.Description, update.Interface.Speed,
+			update.Interface.AdminStatus, update.Interface.OperStatus, lastChange))
+	}
+	p, err := config.New(r, put)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+	// All interfaces are retrieved with the first query, then 644 is polled
+	p.Query(context.Background(), provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{641, 644}})
+	// Interface tables are not walked again
+	p.Query(context.Background(), provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{642}})
+	expected := []string{
+		"exporter62 641 Gi0/0/0/0 Transit 10000 up up 10m0s",
+		"exporter62 642 Gi0/0/0/1 Peering 20000 up down ",
+		"exporter62 643 Gi0/0/0/2  1000   ",
+		"exporter62 644   0   ",
+		"exporter62 642 Gi0/0/0/1 Peering 20000 up down ",
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Poll() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_snmp_poller_", "walked_")
+	expectedMetrics := map[string]string{
+		`walked_interfaces_total{exporter="127.0.0.1"}`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestPollerIPv6(t *testing.T) {
+	r := reporter.NewMock(t)
+	server := GoSNMPServer.NewSNMPServer(GoSNMPServer.MasterAgent{
+		SubAgents: []*GoSNMPServer.SubAgent{
+			{
+				CommunityIDs: []string{"private"},
+				OIDs: []*GoSNMPServer.PDUValueControlItem{
+					{
+						OID:   "1.3.6.1.2.1.1.5.0",
+						Type:  gosnmp.OctetString,
+						OnGet: func() (interface{}, error) { return "exporter62", nil },
+					}, {
+						OID:   "1.3.6.1.2.1.2.2.1.2.641",
+						Type:  gosnmp.OctetString,
+						OnGet: func() (interface{}, error) { return "Gi0/0/0/0", nil },
+					}, {
+						OID:   "1.3.6.1.2.1.31.1.1.1.15.641",
+						Type:  gosnmp.Gauge32,
+						OnGet: func() (interface{}, error) { return uint(10000), nil },
+					},
+				},
+			},
+		},
+	})
+	if err := server.ListenUDP("udp6", "[::1]:0"); err != nil {
+		t.Skipf("ListenUDP() err:\n%+v", err)
+	}
+	_, portStr, _ := net.SplitHostPort(server.Address().String())
+	port, _ := strconv.Atoi(portStr)
+	go server.ServeForever()
+	defer server.Shutdown()
+
+	config := DefaultConfiguration().(Configuration)
+	config.PollerTimeout = 100 * time.Millisecond
+	config.Communities = helpers.MustNewSubnetMap(map[string]string{
+		"::/0":          "public",
+		"2001:db8::/64": "private",
+	})
+	config.Ports = helpers.MustNewSubnetMap(map[string]uint16{
+		"2001:db8::/64": uint16(port),
+	})
+	config.Agents = map[netip.Addr]netip.Addr{
+		netip.MustParseAddr("2001:db8::1"): netip.MustParseAddr("::1"),
+	}
+	got := []string{}
+	put := func(update provider.Update) {
+		got = append(got, fmt.Sprintf("%s %s %d %s %d",
+			update.ExporterIP, update.Exporter.Name,
+			update.IfIndex, update.Interface.Name, update.Interface.Speed))
+	}
+	p, err := config.New(r, put)
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("2001:db8::1"),
+		IfIndexes:  []uint{641},
+	})
+	expected := []string{"2001:db8::1 exporter62 641 Gi0/0/0/0 10000"}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Poll() (-got, +want):\n%s", diff)
+	}
 }
@@ -13,6 +13,7 @@ import (
 
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
 )
 
 // Provider represents the SNMP provider.
@@ -22,7 +23,14 @@ type Provider struct {
 
 	pendingRequests     map[string]struct{}
 	pendingRequestsLock sync.Mutex
+	negativeCache       map[provider.Query]negativeCacheEntry
+	negativeCacheLock   sync.Mutex
+	prewarmed           map[netip.Addr]struct{}
+	prewarmedLock       sync.Mutex
+	exporterStates      map[netip.Addr]*exporterState
+	exporterStatesLock  sync.Mutex
 	errLogger           reporter.Logger
+	secrets             *secrets.Store
 
 	put func(provider.Update)
 
@@ -31,6 +39,11 @@ type Provider struct {
 		successes       *reporter.CounterVec
 		errors          *reporter.CounterVec
 		retries         *reporter.CounterVec
+		negativeHits    *reporter.CounterVec
+		walked          *reporter.CounterVec
+		skipped         *reporter.CounterVec
+		timeouts        *reporter.GaugeVec
+		blackholed      *reporter.GaugeVec
 		times           *reporter.SummaryVec
 	}
 }
@@ -46,12 +59,21 @@ func (configuration Configuration) New(r *reporter.Reporter, put func(provider.U
 		}
 	}
 
+	store, err := configuration.Secrets.New(r)
+	if err != nil {
+		return nil, err
+	}
+
 	p := Provider{
 		r:      r,
 		config: &configuration,
 
 		pendingRequests: make(map[string]struct{}),
+		negativeCache:   make(map[provider.Query]negativeCacheEntry),
+		prewarmed:       make(map[netip.Addr]struct{}),
+		exporterStates:  make(map[netip.Addr]*exporterState),
 		errLogger:       r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		secrets:         store,
 
 		put: put,
 	}
@@ -80,6 +102,31 @@ func (configuration Configuration) New(r *reporter.Reporter, put func(provider.U
 			Name: "poller_retry_requests_total",
 			Help: "Number of retried requests.",
 		}, []string{"exporter"})
+	p.metrics.negativeHits = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "poller_negative_cache_hits_total",
+			Help: "Number of requests answered from the negative cache.",
+		}, []string{"exporter"})
+	p.metrics.walked = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "poller_walked_interfaces_total",
+			Help: "Number of interfaces retrieved by walking interface tables.",
+		}, []string{"exporter"})
+	p.metrics.skipped = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "poller_skipped_requests_total",
+			Help: "Number of requests skipped due to rate limiting or backoff.",
+		}, []string{"exporter", "reason"})
+	p.metrics.timeouts = r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "poller_consecutive_timeouts",
+			Help: "Number of consecutive timeouts for an exporter.",
+		}, []string{"exporter"})
+	p.metrics.blackholed = r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "poller_blackholed",
+			Help: "Whether an exporter is not polled anymore due to too many timeouts.",
+		}, []string{"exporter"})
 	p.metrics.times = r.SummaryVec(
 		reporter.SummaryOpts{
 			Name:       "poller_seconds",
@@ -92,6 +139,9 @@ func (configuration Configuration) New(r *reporter.Reporter, put func(provider.U
 
 // Query queries exporter to get information through SNMP.
 func (p *Provider) Query(ctx context.Context, query provider.BatchQuery) error {
+	if query.ExporterIP.Is4() {
+		query.ExporterIP = netip.AddrFrom16(query.ExporterIP.As16())
+	}
 	// Avoid querying too much exporters with errors
 	agentIP, ok := p.config.Agents[query.ExporterIP]
 	if !ok {
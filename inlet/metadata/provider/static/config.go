@@ -15,6 +15,8 @@ import (
 type Configuration struct {
 	// Exporters is a subnet map matching Exporters to their configuration
 	Exporters *helpers.SubnetMap[ExporterConfiguration] `validate:"omitempty,dive"`
+	// Profiles defines named sets of attributes shared by several exporters.
+	Profiles map[string]ProfileConfiguration `validate:"dive"`
 	// ExporterSources defines a set of remote Exporters
 	// definitions to map IP address to their configuration.
 	// The results are overridden by the content of Exporters.
@@ -22,6 +24,29 @@ type Configuration struct {
 	// ExporterSourcesTimeout tells how long to wait for exporter
 	// sources to be ready. 503 is returned when not.
 	ExporterSourcesTimeout time.Duration `validate:"min=0"`
+	// PushToken is the token to provide to push exporter definitions
+	// through the HTTP API. When empty, pushing is disabled. Like for
+	// ExporterSources, the results are overridden by the content of
+	// Exporters.
+	PushToken string
+	// Discovery defines how exporters not matching any configured exporter
+	// are handled.
+	Discovery DiscoveryConfiguration
+}
+
+// DiscoveryConfiguration describes the discovery of exporters sending flows
+// without matching any configured exporter.
+type DiscoveryConfiguration struct {
+	// Enabled tells to create a placeholder exporter for each unknown
+	// exporter.
+	Enabled bool
+	// Profile is the name of a profile to use for discovered exporters.
+	Profile string
+	// MaxExporters is the maximum number of discovered exporters. 0 means
+	// no limit.
+	MaxExporters int `validate:"min=0"`
+	// Interval is the minimum duration between two discoveries.
+	Interval time.Duration `validate:"min=0"`
 }
 
 // ExporterConfiguration is the interface configuration for an exporter.
@@ -31,12 +56,38 @@ type ExporterConfiguration struct {
 	Default provider.Interface `validate:"omitempty"`
 	// IfIndexes is a map from interface indexes to interfaces
 	IfIndexes map[uint]provider.Interface `validate:"omitempty,dive"`
+	// Profile is the name of a profile to use for attributes not set here
+	Profile string
+}
+
+// ProfileConfiguration is a set of attributes shared by several exporters.
+// They are used when the exporter does not define them.
+type ProfileConfiguration struct {
+	// Region is the general location of the exporters.
+	Region string
+	// Role is the role of the exporters.
+	Role string
+	// Tenant is the owner of the exporters.
+	Tenant string
+	// Site is the location of the exporters.
+	Site string
+	// Group is a functional or organisational identifier for the exporters.
+	Group string
+	// Default is used if not empty for any unknown ifindexes
+	Default provider.Interface `validate:"omitempty"`
+	// IfIndexes is a map from interface indexes to interfaces
+	IfIndexes map[uint]provider.Interface `validate:"omitempty,dive"`
 }
 
 // DefaultConfiguration represents the default configuration for the static provider
 func DefaultConfiguration() provider.Configuration {
 	return Configuration{
 		Exporters: helpers.MustNewSubnetMap(map[string]ExporterConfiguration{}),
+		Profiles:  map[string]ProfileConfiguration{},
+		Discovery: DiscoveryConfiguration{
+			MaxExporters: 100,
+			Interval:     5 * time.Second,
+		},
 	}
 }
 
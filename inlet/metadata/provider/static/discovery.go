@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package static
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/inlet/metadata/provider"
+)
+
+// discoveredGroup is the group of discovered exporters. It flags them until
+// they are confirmed by adding them to the configuration.
+const discoveredGroup = "discovered"
+
+// discoveredExporter is an exporter discovered because it sent flows without
+// matching any configured exporter.
+type discoveredExporter struct {
+	Exporter  netip.Addr `json:"exporter"`
+	FirstSeen time.Time  `json:"first-seen"`
+}
+
+// discover returns a placeholder configuration for the provided exporter,
+// which does not match any configured exporter. Discoveries are throttled:
+// false is returned when discovery is disabled, when too many exporters were
+// discovered, or when the previous discovery is too recent. In the last case,
+// the exporter will be discovered on a later query.
+func (p *Provider) discover(exporterIP netip.Addr) (ExporterConfiguration, bool) {
+	if !p.discovery.Enabled {
+		return ExporterConfiguration{}, false
+	}
+	exporterIP = exporterIP.Unmap()
+	p.discoveredLock.Lock()
+	defer p.discoveredLock.Unlock()
+	if _, ok := p.discovered[exporterIP]; !ok {
+		if p.discovery.MaxExporters > 0 && len(p.discovered) >= p.discovery.MaxExporters {
+			p.metrics.discoveryThrottled.WithLabelValues("limit").Inc()
+			return ExporterConfiguration{}, false
+		}
+		now := time.Now()
+		if now.Sub(p.lastDiscovery) < p.discovery.Interval {
+			p.metrics.discoveryThrottled.WithLabelValues("interval").Inc()
+			return ExporterConfiguration{}, false
+		}
+		p.lastDiscovery = now
+		p.discovered[exporterIP] = now
+		p.metrics.discoveredExporters.Set(float64(len(p.discovered)))
+		p.r.Info().Str("exporter", exporterIP.String()).Msg("new exporter discovered")
+	}
+	return ExporterConfiguration{
+		Exporter: provider.Exporter{
+			Name:  exporterIP.String(),
+			Group: discoveredGroup,
+		},
+		Profile: p.discovery.Profile,
+	}, true
+}
+
+// DiscoveredHandler returns the handler listing the discovered exporters. It
+// returns nil when discovery is disabled.
+func (p *Provider) DiscoveredHandler() gin.HandlerFunc {
+	if !p.discovery.Enabled {
+		return nil
+	}
+	return p.discoveredHandlerFunc
+}
+
+// discoveredHandlerFunc lists the discovered exporters still not matching
+// any configured exporter.
+func (p *Provider) discoveredHandlerFunc(gc *gin.Context) {
+	exporters := p.exporters.Load()
+	p.discoveredLock.Lock()
+	discovered := make([]discoveredExporter, 0, len(p.discovered))
+	for exporterIP, firstSeen := range p.discovered {
+		if _, ok := exporters.Lookup(netip.AddrFrom16(exporterIP.As16())); ok {
+			continue
+		}
+		discovered = append(discovered, discoveredExporter{
+			Exporter:  exporterIP,
+			FirstSeen: firstSeen,
+		})
+	}
+	p.discoveredLock.Unlock()
+	sort.Slice(discovered, func(i, j int) bool {
+		return discovered[i].Exporter.Less(discovered[j].Exporter)
+	})
+	gc.JSON(http.StatusOK, gin.H{"exporters": discovered})
+}
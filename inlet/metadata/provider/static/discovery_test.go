@@ -0,0 +1,159 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package static
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+)
+
+func TestDiscoveryDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	var got []provider.Update
+	p, err := DefaultConfiguration().New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if handler := p.(provider.DiscoveryProvider).DiscoveredHandler(); handler != nil {
+		t.Fatal("DiscoveredHandler() should be nil when discovery is disabled")
+	}
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("::ffff:192.0.2.1"),
+		IfIndexes:  []uint{10},
+	})
+	if len(got) > 0 {
+		t.Fatalf("Query() returned updates:\n%+v", got)
+	}
+}
+
+func TestDiscoveryUnknownProfile(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration().(Configuration)
+	configuration.Discovery.Enabled = true
+	configuration.Discovery.Profile = "unknown"
+	if _, err := configuration.New(r, func(provider.Update) {}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	configuration := DefaultConfiguration().(Configuration)
+	configuration.Discovery = DiscoveryConfiguration{
+		Enabled:      true,
+		Profile:      "demo",
+		MaxExporters: 2,
+		Interval:     time.Hour,
+	}
+	configuration.Profiles = map[string]ProfileConfiguration{
+		"demo": {
+			Role:    "demo",
+			Group:   "lab",
+			Default: provider.Interface{Name: "unknown", Description: "Unknown interface", Speed: 1000},
+		},
+	}
+	var got []provider.Update
+	pp, err := configuration.New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p := pp.(*Provider)
+	h.GinRouter.GET("/api/v0/inlet/metadata/discovered", p.DiscoveredHandler())
+
+	exporter1 := netip.MustParseAddr("::ffff:192.0.2.1")
+	exporter2 := netip.MustParseAddr("::ffff:192.0.2.2")
+	exporter3 := netip.MustParseAddr("::ffff:192.0.2.3")
+	query := func(exporterIP netip.Addr) {
+		p.Query(context.Background(), provider.BatchQuery{
+			ExporterIP: exporterIP,
+			IfIndexes:  []uint{10},
+		})
+	}
+
+	// The second exporter is throttled, the first one is still answered.
+	query(exporter1)
+	query(exporter2)
+	query(exporter1)
+	// Once the interval is elapsed, the second one is discovered, but not the
+	// third one as the limit is reached.
+	p.discoveredLock.Lock()
+	p.lastDiscovery = time.Time{}
+	p.discoveredLock.Unlock()
+	query(exporter2)
+	p.discoveredLock.Lock()
+	p.lastDiscovery = time.Time{}
+	p.discoveredLock.Unlock()
+	query(exporter3)
+
+	answer := func(exporterIP netip.Addr) provider.Update {
+		return provider.Update{
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 10},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{
+					Name:  exporterIP.Unmap().String(),
+					Role:  "demo",
+					Group: "discovered",
+				},
+				Interface: provider.Interface{Name: "unknown", Description: "Unknown interface", Speed: 1000},
+			},
+		}
+	}
+	expected := []provider.Update{answer(exporter1), answer(exporter1), answer(exporter2)}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Query() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_static_", "discover")
+	expectedMetrics := map[string]string{
+		`discovered_exporters`:                         "2",
+		`discovery_throttled_total{reason="interval"}`: "1",
+		`discovery_throttled_total{reason="limit"}`:    "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Confirm the first exporter
+	if err := p.updateExporters("push", []exporterInfo{
+		{
+			Exporter:       provider.Exporter{Name: "edge1"},
+			ExporterSubnet: "192.0.2.1/32",
+		},
+	}); err != nil {
+		t.Fatalf("updateExporters() error:\n%+v", err)
+	}
+	firstSeen := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	p.discoveredLock.Lock()
+	for exporterIP := range p.discovered {
+		p.discovered[exporterIP] = firstSeen
+	}
+	p.discoveredLock.Unlock()
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/metadata/discovered",
+			JSONOutput: gin.H{
+				"exporters": []gin.H{
+					{
+						"exporter":   "192.0.2.2",
+						"first-seen": "2024-04-11T08:00:00Z",
+					},
+				},
+			},
+		},
+	})
+}
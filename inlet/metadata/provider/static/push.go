@@ -0,0 +1,186 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package static
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+
+	"akvorado/common/helpers"
+)
+
+// maxPushSize is the maximum size of a pushed document.
+const maxPushSize = 10 << 20
+
+// PushHandler returns the handler accepting exporter definitions pushed
+// through the HTTP API. It returns nil when no token is configured.
+func (p *Provider) PushHandler(refresh func([]netip.Prefix)) gin.HandlerFunc {
+	if p.pushToken == "" {
+		return nil
+	}
+	return func(gc *gin.Context) {
+		p.pushHandlerFunc(gc, refresh)
+	}
+}
+
+// pushHandlerFunc replaces the pushed exporter definitions. The body is a list
+// of exporters, in JSON or YAML, using the same format as exporter sources.
+// The provided exporters are all validated before being used. With PATCH, they
+// are merged with the previously pushed ones instead: an exporter replaces the
+// one with the same subnet. Cached data for the exporters whose definition
+// changed is refreshed.
+func (p *Provider) pushHandlerFunc(gc *gin.Context, refresh func([]netip.Prefix)) {
+	token, ok := strings.CutPrefix(gc.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(p.pushToken)) != 1 {
+		gc.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token."})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(gc.Writer, gc.Request.Body, maxPushSize))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	exporters, errs := p.parsePushedExporters(body)
+	if len(errs) > 0 {
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, helpers.Capitalize(err.Error()))
+		}
+		gc.JSON(http.StatusBadRequest, gin.H{
+			"message": "Invalid exporters.",
+			"errors":  messages,
+		})
+		return
+	}
+
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	p.exportersLock.Lock()
+	previous := p.exportersMap["push"]
+	p.exportersLock.Unlock()
+	if gc.Request.Method == http.MethodPatch {
+		exporters = mergeExporters(previous, exporters)
+	}
+	if err := p.updateExporters("push", exporters); err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": helpers.Capitalize(err.Error())})
+		return
+	}
+	if changed := changedSubnets(previous, exporters); len(changed) > 0 {
+		refresh(changed)
+	}
+	p.metrics.pushLastSuccess.SetToCurrentTime()
+	p.metrics.pushedExporters.Set(float64(len(exporters)))
+	p.r.Info().Int("exporters", len(exporters)).Msg("exporters pushed")
+	gc.JSON(http.StatusOK, gin.H{"exporters": len(exporters)})
+}
+
+// parsePushedExporters parses and validates pushed exporter definitions. As
+// JSON is a subset of YAML, both are accepted. All the errors are returned.
+func (p *Provider) parsePushedExporters(body []byte) ([]exporterInfo, []error) {
+	var raw []interface{}
+	if err := yaml.Unmarshal(body, &raw); err != nil {
+		return nil, []error{fmt.Errorf("cannot parse exporters: %w", err)}
+	}
+	exporters := make([]exporterInfo, 0, len(raw))
+	errs := []error{}
+	for idx, value := range raw {
+		var exporter exporterInfo
+		decoder, err := mapstructure.NewDecoder(helpers.GetMapStructureDecoderConfig(&exporter))
+		if err != nil {
+			panic(err)
+		}
+		if err := decoder.Decode(value); err != nil {
+			errs = append(errs, fmt.Errorf("exporter %d: %w", idx, err))
+			continue
+		}
+		if err := helpers.Validate.Struct(exporter); err != nil {
+			var verrs validator.ValidationErrors
+			if !errors.As(err, &verrs) {
+				errs = append(errs, fmt.Errorf("exporter %d: %w", idx, err))
+				continue
+			}
+			for _, verr := range verrs {
+				errs = append(errs, fmt.Errorf("exporter %d: %w", idx, verr))
+			}
+			continue
+		}
+		if _, err := helpers.SubnetMapParseKey(exporter.ExporterSubnet); err != nil {
+			errs = append(errs, fmt.Errorf("exporter %d: invalid subnet %q", idx, exporter.ExporterSubnet))
+			continue
+		}
+		if _, ok := p.profiles[exporter.Profile]; exporter.Profile != "" && !ok {
+			errs = append(errs, fmt.Errorf("exporter %d: unknown profile %q", idx, exporter.Profile))
+			continue
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, errs
+}
+
+// mergeExporters merges the patch into the provided exporters. An exporter of
+// the patch replaces the one with the same subnet or is appended.
+func mergeExporters(exporters, patch []exporterInfo) []exporterInfo {
+	merged := slices.Clone(exporters)
+	positions := map[string]int{}
+	for idx, exporter := range merged {
+		key, _ := helpers.SubnetMapParseKey(exporter.ExporterSubnet)
+		positions[key] = idx
+	}
+	for _, exporter := range patch {
+		key, _ := helpers.SubnetMapParseKey(exporter.ExporterSubnet)
+		if idx, ok := positions[key]; ok {
+			merged[idx] = exporter
+			continue
+		}
+		positions[key] = len(merged)
+		merged = append(merged, exporter)
+	}
+	return merged
+}
+
+// changedSubnets returns the subnets of the exporters added, removed, or
+// modified between the two provided lists.
+func changedSubnets(previous, current []exporterInfo) []netip.Prefix {
+	index := func(exporters []exporterInfo) map[string]exporterInfo {
+		result := make(map[string]exporterInfo, len(exporters))
+		for _, exporter := range exporters {
+			key, _ := helpers.SubnetMapParseKey(exporter.ExporterSubnet)
+			result[key] = exporter
+		}
+		return result
+	}
+	before := index(previous)
+	after := index(current)
+	keys := []string{}
+	for key, exporter := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, exporter) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	subnets := make([]netip.Prefix, 0, len(keys))
+	for _, key := range keys {
+		if subnet, err := netip.ParsePrefix(key); err == nil {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
@@ -0,0 +1,218 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package static
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+)
+
+func TestPushDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	p, err := DefaultConfiguration().New(r, func(provider.Update) {})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	if handler := p.(provider.PushProvider).PushHandler(nil); handler != nil {
+		t.Fatal("PushHandler() should be nil without token")
+	}
+}
+
+func TestPush(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	configuration := DefaultConfiguration().(Configuration)
+	configuration.PushToken = "secret"
+	configuration.Exporters = helpers.MustNewSubnetMap(map[string]ExporterConfiguration{
+		"2001:db8:2::/48": {
+			Exporter: provider.Exporter{Name: "static"},
+			Default:  provider.Interface{Name: "Default0", Description: "Default interface", Speed: 1000},
+		},
+	})
+	configuration.Profiles = map[string]ProfileConfiguration{
+		"edge": {Role: "edge"},
+	}
+	var got []provider.Update
+	pp, err := configuration.New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p := pp.(*Provider)
+	var refreshed [][]netip.Prefix
+	handler := p.PushHandler(func(subnets []netip.Prefix) {
+		refreshed = append(refreshed, subnets)
+	})
+	h.GinRouter.PUT("/api/v0/inlet/metadata/exporters", handler)
+	h.GinRouter.PATCH("/api/v0/inlet/metadata/exporters", handler)
+
+	authorized := http.Header{"Authorization": []string{"Bearer secret"}}
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "missing token",
+			Method:      "PUT",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			JSONInput:   []gin.H{},
+			StatusCode:  401,
+			JSONOutput:  gin.H{"message": "Invalid token."},
+		}, {
+			Description: "invalid token",
+			Method:      "PUT",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			Header:      http.Header{"Authorization": []string{"Bearer wrong"}},
+			JSONInput:   []gin.H{},
+			StatusCode:  401,
+			JSONOutput:  gin.H{"message": "Invalid token."},
+		}, {
+			Description: "invalid exporters",
+			Method:      "PUT",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			Header:      authorized,
+			JSONInput: []gin.H{
+				{
+					"exporter-subnet": "2001:db8:1::/48",
+					"name":            "",
+				}, {
+					"exporter-subnet": "not a subnet",
+					"name":            "exporter",
+				}, {
+					"exporter-subnet": "2001:db8:3::/48",
+					"name":            "exporter",
+					"profile":         "core",
+				}, {
+					"exporter-subnet": "2001:db8:4::/48",
+					"name":            "exporter",
+					"unknown":         "key",
+				},
+			},
+			StatusCode: 400,
+			JSONOutput: gin.H{
+				"message": "Invalid exporters.",
+				"errors": []string{
+					"Exporter 0: Key: 'exporterInfo.Exporter.Name' Error:Field validation for 'Name' failed on the 'required' tag",
+					`Exporter 1: invalid subnet "not a subnet"`,
+					`Exporter 2: unknown profile "core"`,
+					"Exporter 3: 1 error(s) decoding:\n\n* '' has invalid keys: unknown",
+				},
+			},
+		}, {
+			Description: "valid exporters",
+			Method:      "PUT",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			Header:      authorized,
+			JSONInput: []gin.H{
+				{
+					"exporter-subnet": "2001:db8:1::/48",
+					"name":            "pushed",
+					"profile":         "edge",
+					"interfaces": []gin.H{
+						{"ifindex": 10, "name": "Gi10", "description": "10th interface", "speed": 1000},
+					},
+				}, {
+					"exporter-subnet": "2001:db8:2::/48",
+					"name":            "overridden",
+				},
+			},
+			JSONOutput: gin.H{"exporters": 2},
+		}, {
+			Description: "patch exporters",
+			Method:      "PATCH",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			Header:      authorized,
+			JSONInput: []gin.H{
+				{
+					"exporter-subnet": "2001:db8:2::/48",
+					"name":            "still overridden",
+				}, {
+					"exporter-subnet": "2001:db8:5::/48",
+					"name":            "new",
+				},
+			},
+			JSONOutput: gin.H{"exporters": 3},
+		}, {
+			Description: "patch without change",
+			Method:      "PATCH",
+			URL:         "/api/v0/inlet/metadata/exporters",
+			Header:      authorized,
+			JSONInput: []gin.H{
+				{
+					"exporter-subnet": "2001:db8:5::/48",
+					"name":            "new",
+				},
+			},
+			JSONOutput: gin.H{"exporters": 3},
+		},
+	})
+
+	expectedRefreshed := [][]netip.Prefix{
+		{netip.MustParsePrefix("2001:db8:1::/48"), netip.MustParsePrefix("2001:db8:2::/48")},
+		{netip.MustParsePrefix("2001:db8:2::/48"), netip.MustParsePrefix("2001:db8:5::/48")},
+	}
+	if diff := helpers.Diff(refreshed, expectedRefreshed); diff != "" {
+		t.Fatalf("refresh() (-got, +want):\n%s", diff)
+	}
+
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+		IfIndexes:  []uint{10},
+	})
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("2001:db8:2::10"),
+		IfIndexes:  []uint{10},
+	})
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("2001:db8:5::10"),
+		IfIndexes:  []uint{10},
+	})
+	expected := []provider.Update{
+		{
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+				IfIndex:    10,
+			},
+			Answer: provider.Answer{
+				Exporter:  provider.Exporter{Name: "pushed", Role: "edge"},
+				Interface: provider.Interface{Name: "Gi10", Description: "10th interface", Speed: 1000},
+			},
+		}, {
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:2::10"),
+				IfIndex:    10,
+			},
+			Answer: provider.Answer{
+				Exporter:  provider.Exporter{Name: "static"},
+				Interface: provider.Interface{Name: "Default0", Description: "Default interface", Speed: 1000},
+			},
+		}, {
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:5::10"),
+				IfIndex:    10,
+			},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "new"},
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Query() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_static_", "pushed_")
+	expectedMetrics := map[string]string{
+		"pushed_exporters": "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -13,8 +13,10 @@ import (
 
 	"context"
 	"fmt"
+	"net/netip"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Provider represents the static provider.
@@ -24,15 +26,67 @@ type Provider struct {
 	exportersMap           map[string][]exporterInfo
 	exporters              atomic.Pointer[helpers.SubnetMap[ExporterConfiguration]]
 	exportersLock          sync.Mutex
+	profiles               map[string]ProfileConfiguration
+	pushToken              string
+	pushLock               sync.Mutex
 	put                    func(provider.Update)
+
+	discovery      DiscoveryConfiguration
+	discovered     map[netip.Addr]time.Time
+	lastDiscovery  time.Time
+	discoveredLock sync.Mutex
+
+	metrics struct {
+		pushLastSuccess     reporter.Gauge
+		pushedExporters     reporter.Gauge
+		discoveredExporters reporter.Gauge
+		discoveryThrottled  *reporter.CounterVec
+	}
 }
 
 // New creates a new static provider from configuration
 func (configuration Configuration) New(r *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	for subnet, exporter := range configuration.Exporters.ToMap() {
+		if _, ok := configuration.Profiles[exporter.Profile]; exporter.Profile != "" && !ok {
+			return nil, fmt.Errorf("exporter %s uses unknown profile %q", subnet, exporter.Profile)
+		}
+	}
+	if _, ok := configuration.Profiles[configuration.Discovery.Profile]; configuration.Discovery.Profile != "" && !ok {
+		return nil, fmt.Errorf("discovery uses unknown profile %q", configuration.Discovery.Profile)
+	}
 	p := &Provider{
 		r:            r,
 		exportersMap: map[string][]exporterInfo{},
+		profiles:     configuration.Profiles,
+		pushToken:    configuration.PushToken,
 		put:          put,
+		discovery:    configuration.Discovery,
+		discovered:   map[netip.Addr]time.Time{},
+	}
+	if p.pushToken != "" {
+		p.metrics.pushLastSuccess = r.Gauge(
+			reporter.GaugeOpts{
+				Name: "push_last_success_timestamp_seconds",
+				Help: "Time of the last successful push of exporters.",
+			})
+		p.metrics.pushedExporters = r.Gauge(
+			reporter.GaugeOpts{
+				Name: "pushed_exporters",
+				Help: "Number of exporters received in the last successful push.",
+			})
+	}
+	if p.discovery.Enabled {
+		p.metrics.discoveredExporters = r.Gauge(
+			reporter.GaugeOpts{
+				Name: "discovered_exporters",
+				Help: "Number of exporters discovered.",
+			})
+		p.metrics.discoveryThrottled = r.CounterVec(
+			reporter.CounterOpts{
+				Name: "discovery_throttled_total",
+				Help: "Number of discoveries delayed or refused.",
+			},
+			[]string{"reason"})
 	}
 	p.exporters.Store(configuration.Exporters)
 	p.initStaticExporters()
@@ -51,12 +105,22 @@ func (configuration Configuration) New(r *reporter.Reporter, put func(provider.U
 func (p *Provider) Query(_ context.Context, query provider.BatchQuery) error {
 	exporter, ok := p.exporters.Load().Lookup(query.ExporterIP)
 	if !ok {
-		return nil
+		exporter, ok = p.discover(query.ExporterIP)
+		if !ok {
+			return nil
+		}
 	}
+	profile := p.profiles[exporter.Profile]
+	exporter.Exporter = exporter.withProfile(profile)
 	for _, ifIndex := range query.IfIndexes {
 		iface, ok := exporter.IfIndexes[ifIndex]
 		if !ok {
+			iface, ok = profile.IfIndexes[ifIndex]
+		}
+		if !ok && exporter.Default.Name != "" {
 			iface = exporter.Default
+		} else if !ok {
+			iface = profile.Default
 		}
 		p.put(provider.Update{
 			Query: provider.Query{
@@ -71,3 +135,24 @@ func (p *Provider) Query(_ context.Context, query provider.BatchQuery) error {
 	}
 	return nil
 }
+
+// withProfile returns the exporter attributes, completed with the ones from
+// the provided profile.
+func (e ExporterConfiguration) withProfile(profile ProfileConfiguration) provider.Exporter {
+	exporter := e.Exporter
+	for _, attr := range []struct {
+		exporter *string
+		profile  string
+	}{
+		{&exporter.Region, profile.Region},
+		{&exporter.Role, profile.Role},
+		{&exporter.Tenant, profile.Tenant},
+		{&exporter.Site, profile.Site},
+		{&exporter.Group, profile.Group},
+	} {
+		if *attr.exporter == "" {
+			*attr.exporter = attr.profile
+		}
+	}
+	return exporter
+}
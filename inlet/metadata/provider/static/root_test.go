@@ -220,3 +220,125 @@ func TestStaticProvider(t *testing.T) {
 		t.Fatalf("static provider (-got, +want):\n%s", diff)
 	}
 }
+
+func TestStaticProviderProfiles(t *testing.T) {
+	config := Configuration{
+		Profiles: map[string]ProfileConfiguration{
+			"cisco-edge": {
+				Region: "eu",
+				Role:   "edge",
+				Site:   "par",
+				Default: provider.Interface{
+					Name:        "Default0",
+					Description: "Default interface",
+					Speed:       1000,
+				},
+				IfIndexes: map[uint]provider.Interface{
+					10: {
+						Name:         "Gi10",
+						Description:  "Transit",
+						Speed:        10000,
+						Connectivity: "transit",
+						Boundary:     schema.InterfaceBoundaryExternal,
+					},
+					11: {
+						Name:        "Gi11",
+						Description: "Core",
+						Speed:       10000,
+					},
+				},
+			},
+		},
+		Exporters: helpers.MustNewSubnetMap(map[string]ExporterConfiguration{
+			"2001:db8:1::/48": {
+				Exporter: provider.Exporter{
+					Name: "edge1",
+					Site: "lon",
+				},
+				IfIndexes: map[uint]provider.Interface{
+					11: {
+						Name:        "Gi11",
+						Description: "PNI",
+						Speed:       1000,
+					},
+				},
+				Profile: "cisco-edge",
+			},
+		}),
+	}
+
+	var got []provider.Update
+	r := reporter.NewMock(t)
+	p, err := config.New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+		IfIndexes:  []uint{9, 10, 11},
+	})
+
+	exporter := provider.Exporter{
+		Name:   "edge1",
+		Region: "eu",
+		Role:   "edge",
+		Site:   "lon",
+	}
+	expected := []provider.Update{
+		{
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+				IfIndex:    9,
+			},
+			Answer: provider.Answer{
+				Exporter: exporter,
+				Interface: provider.Interface{
+					Name:        "Default0",
+					Description: "Default interface",
+					Speed:       1000,
+				},
+			},
+		},
+		{
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+				IfIndex:    10,
+			},
+			Answer: provider.Answer{
+				Exporter: exporter,
+				Interface: provider.Interface{
+					Name:         "Gi10",
+					Description:  "Transit",
+					Speed:        10000,
+					Connectivity: "transit",
+					Boundary:     schema.InterfaceBoundaryExternal,
+				},
+			},
+		},
+		{
+			Query: provider.Query{
+				ExporterIP: netip.MustParseAddr("2001:db8:1::10"),
+				IfIndex:    11,
+			},
+			Answer: provider.Answer{
+				Exporter: exporter,
+				Interface: provider.Interface{
+					Name:        "Gi11",
+					Description: "PNI",
+					Speed:       1000,
+				},
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("static provider (-got, +want):\n%s", diff)
+	}
+
+	// Unknown profile
+	config.Profiles = map[string]ProfileConfiguration{}
+	if _, err := config.New(r, func(provider.Update) {}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
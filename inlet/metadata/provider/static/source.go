@@ -15,6 +15,8 @@ type exporterInfo struct {
 	Default provider.Interface `validate:"omitempty"`
 	// IfIndexes is a map from interface indexes to interfaces
 	Interfaces []exporterInterface `validate:"omitempty"`
+	// Profile is the name of a profile to use for attributes not set here
+	Profile string
 }
 
 type exporterInterface struct {
@@ -32,6 +34,7 @@ func (i exporterInfo) toExporterConfiguration() ExporterConfiguration {
 		Exporter:  i.Exporter,
 		Default:   i.Default,
 		IfIndexes: ifindexMap,
+		Profile:   i.Profile,
 	}
 }
 
@@ -51,12 +54,11 @@ func (p *Provider) initStaticExporters() {
 		staticExporters = append(
 			staticExporters,
 			exporterInfo{
-				Exporter: provider.Exporter{
-					Name: config.Name,
-				},
+				Exporter:       config.Exporter,
 				ExporterSubnet: subnet,
 				Default:        config.Default,
 				Interfaces:     interfaces,
+				Profile:        config.Profile,
 			},
 		)
 	}
@@ -70,8 +72,18 @@ func (p *Provider) UpdateRemoteDataSource(ctx context.Context, name string, sour
 	if err != nil {
 		return 0, err
 	}
+	if err := p.updateExporters(name, results); err != nil {
+		return 0, err
+	}
+	return len(results), nil
+}
+
+// updateExporters replaces the exporters of the provided source and swaps the
+// exporter map with the result of the reconciliation of all the sources.
+func (p *Provider) updateExporters(name string, results []exporterInfo) error {
 	finalMap := map[string]ExporterConfiguration{}
 	p.exportersLock.Lock()
+	defer p.exportersLock.Unlock()
 	p.exportersMap[name] = results
 	for id, results := range p.exportersMap {
 		if id == "static" {
@@ -96,11 +108,10 @@ func (p *Provider) UpdateRemoteDataSource(ctx context.Context, name string, sour
 		// This overrides duplicates config for an Exporter if it's also defined as static
 		finalMap[exporterSubnet] = exporterData.toExporterConfiguration()
 	}
-	p.exportersLock.Unlock()
 	exporters, err := helpers.NewSubnetMap[ExporterConfiguration](finalMap)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	p.exporters.Swap(exporters)
-	return len(results), nil
+	return nil
 }
@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package provider
+
+import (
+	"errors"
+	"strings"
+
+	"akvorado/common/helpers/bimap"
+)
+
+// InterfaceStatus is the administrative or operational status of an
+// interface. Values match the ones from IF-MIB.
+type InterfaceStatus uint8
+
+const (
+	// InterfaceStatusUndefined means we don't know the status.
+	InterfaceStatusUndefined InterfaceStatus = iota
+	// InterfaceStatusUp means the interface is up.
+	InterfaceStatusUp
+	// InterfaceStatusDown means the interface is down.
+	InterfaceStatusDown
+	// InterfaceStatusTesting means the interface is in some test mode.
+	InterfaceStatusTesting
+	// InterfaceStatusUnknown means the status cannot be determined.
+	InterfaceStatusUnknown
+	// InterfaceStatusDormant means the interface is waiting for external actions.
+	InterfaceStatusDormant
+	// InterfaceStatusNotPresent means some component is missing.
+	InterfaceStatusNotPresent
+	// InterfaceStatusLowerLayerDown means a lower-layer interface is down.
+	InterfaceStatusLowerLayerDown
+)
+
+var (
+	interfaceStatusMap = bimap.New(map[InterfaceStatus]string{
+		InterfaceStatusUndefined:      "",
+		InterfaceStatusUp:             "up",
+		InterfaceStatusDown:           "down",
+		InterfaceStatusTesting:        "testing",
+		InterfaceStatusUnknown:        "unknown",
+		InterfaceStatusDormant:        "dormant",
+		InterfaceStatusNotPresent:     "not-present",
+		InterfaceStatusLowerLayerDown: "lower-layer-down",
+	})
+	// interfaceStatusAliases are alternate spellings used by some vendors
+	// (notably with gNMI). They are matched after normalization.
+	interfaceStatusAliases = map[string]InterfaceStatus{
+		"enable":         InterfaceStatusUp,
+		"enabled":        InterfaceStatusUp,
+		"disable":        InterfaceStatusDown,
+		"disabled":       InterfaceStatusDown,
+		"notpresent":     InterfaceStatusNotPresent,
+		"lowerlayerdown": InterfaceStatusLowerLayerDown,
+	}
+	errUnknownInterfaceStatus = errors.New("unknown interface status")
+)
+
+// MarshalText turns an interface status to text
+func (is InterfaceStatus) MarshalText() ([]byte, error) {
+	got, ok := interfaceStatusMap.LoadValue(is)
+	if ok {
+		return []byte(got), nil
+	}
+	return nil, errUnknownInterfaceStatus
+}
+
+// String turns an interface status to string
+func (is InterfaceStatus) String() string {
+	got, _ := interfaceStatusMap.LoadValue(is)
+	return got
+}
+
+// UnmarshalText provides an interface status from text. It is
+// case-insensitive and accepts some alternate spellings, like "enabled" or
+// "LOWER_LAYER_DOWN".
+func (is *InterfaceStatus) UnmarshalText(input []byte) error {
+	text := strings.ToLower(strings.TrimSpace(string(input)))
+	if got, ok := interfaceStatusMap.LoadKey(text); ok {
+		*is = got
+		return nil
+	}
+	text = strings.NewReplacer("-", "", "_", "").Replace(text)
+	if got, ok := interfaceStatusAliases[text]; ok {
+		*is = got
+		return nil
+	}
+	return errUnknownInterfaceStatus
+}
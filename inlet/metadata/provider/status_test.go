@@ -0,0 +1,54 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package provider
+
+import "testing"
+
+func TestInterfaceStatusUnmarshalText(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected InterfaceStatus
+		Error    bool
+	}{
+		{"", InterfaceStatusUndefined, false},
+		{"up", InterfaceStatusUp, false},
+		{"UP", InterfaceStatusUp, false},
+		{"down", InterfaceStatusDown, false},
+		{"enable", InterfaceStatusUp, false},
+		{"disabled", InterfaceStatusDown, false},
+		{"dormant", InterfaceStatusDormant, false},
+		{"LOWER_LAYER_DOWN", InterfaceStatusLowerLayerDown, false},
+		{"not-present", InterfaceStatusNotPresent, false},
+		{"NOT_PRESENT", InterfaceStatusNotPresent, false},
+		{"sleeping", InterfaceStatusUndefined, true},
+	}
+	for _, tc := range cases {
+		var got InterfaceStatus
+		err := got.UnmarshalText([]byte(tc.Input))
+		switch {
+		case err != nil && !tc.Error:
+			t.Errorf("UnmarshalText(%q) error:\n%+v", tc.Input, err)
+		case err == nil && tc.Error:
+			t.Errorf("UnmarshalText(%q) did not error", tc.Input)
+		case got != tc.Expected:
+			t.Errorf("UnmarshalText(%q) == %s but expected %s", tc.Input, got, tc.Expected)
+		}
+	}
+}
+
+func TestInterfaceStatusMarshalText(t *testing.T) {
+	for status := InterfaceStatusUndefined; status <= InterfaceStatusLowerLayerDown; status++ {
+		text, err := status.MarshalText()
+		if err != nil {
+			t.Fatalf("MarshalText(%d) error:\n%+v", status, err)
+		}
+		var got InterfaceStatus
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatalf("UnmarshalText(%q) error:\n%+v", text, err)
+		}
+		if got != status {
+			t.Errorf("UnmarshalText(MarshalText(%d)) == %d", status, got)
+		}
+	}
+}
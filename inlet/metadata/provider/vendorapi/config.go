@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"net/netip"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
+)
+
+// Configuration describes the configuration for the vendor API providers.
+type Configuration struct {
+	// Timeout tells how much time to wait for an answer
+	Timeout time.Duration `validate:"min=100ms"`
+	// MinimalRefreshInterval tells how much time to wait at least between two
+	// fetches from the same exporter
+	MinimalRefreshInterval time.Duration `validate:"min=1s"`
+	// Targets is a mapping from exporter IPs to API endpoint IP.
+	Targets *helpers.SubnetMap[netip.Addr]
+	// Ports is a mapping from exporter IPs to API port.
+	Ports *helpers.SubnetMap[uint16]
+	// Credentials is a mapping from exporter IPs to API credentials. Exporters
+	// without credentials are not handled by the provider.
+	Credentials *helpers.SubnetMap[Credentials] `validate:"omitempty,dive"`
+	// Secrets defines a backend to fetch usernames and passwords from when
+	// querying exporters. Exporters still need an entry in Credentials.
+	Secrets secrets.Configuration
+}
+
+// Credentials contains the configuration related to authentication to an API
+// endpoint.
+type Credentials struct {
+	// Username is the username to use to authenticate.
+	Username string `validate:"required"`
+	// Password is the password to use to authenticate.
+	Password string
+	// Insecure tells to use HTTP instead of HTTPS.
+	Insecure bool
+	// SkipVerify tells if we should skip certificate verification.
+	SkipVerify bool
+	// TLSCA sets the path towards the TLS certificate authority file.
+	TLSCA string
+}
+
+// EAPIConfiguration is the configuration for the Arista eAPI provider.
+type EAPIConfiguration Configuration
+
+// NXAPIConfiguration is the configuration for the Cisco NX-API provider.
+type NXAPIConfiguration Configuration
+
+// defaultConfiguration represents the default configuration shared by the
+// vendor API providers.
+func defaultConfiguration() Configuration {
+	return Configuration{
+		Timeout:                5 * time.Second,
+		MinimalRefreshInterval: time.Minute,
+		Targets:                helpers.MustNewSubnetMap(map[string]netip.Addr{}),
+		Ports:                  helpers.MustNewSubnetMap(map[string]uint16{"::/0": 443}),
+		Credentials:            helpers.MustNewSubnetMap(map[string]Credentials{}),
+		Secrets:                secrets.DefaultConfiguration(),
+	}
+}
+
+// DefaultEAPIConfiguration represents the default configuration for the
+// Arista eAPI provider.
+func DefaultEAPIConfiguration() provider.Configuration {
+	return EAPIConfiguration(defaultConfiguration())
+}
+
+// DefaultNXAPIConfiguration represents the default configuration for the
+// Cisco NX-API provider.
+func DefaultNXAPIConfiguration() provider.Configuration {
+	return NXAPIConfiguration(defaultConfiguration())
+}
+
+// New creates a new Arista eAPI provider from configuration
+func (configuration EAPIConfiguration) New(r *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	return newProvider(r, Configuration(configuration), fetchEAPI, put)
+}
+
+// New creates a new Cisco NX-API provider from configuration
+func (configuration NXAPIConfiguration) New(r *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	return newProvider(r, Configuration(configuration), fetchNXAPI, put)
+}
+
+func init() {
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[netip.Addr]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[uint16]())
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[Credentials]())
+	helpers.RegisterSubnetMapValidation[netip.Addr]()
+	helpers.RegisterSubnetMapValidation[uint16]()
+	helpers.RegisterSubnetMapValidation[Credentials]()
+}
@@ -0,0 +1,70 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/metadata/provider/secrets"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	if err := helpers.Validate.Struct(DefaultEAPIConfiguration()); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+	if err := helpers.Validate.Struct(DefaultNXAPIConfiguration()); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
+
+func TestConfigurationDecode(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description: "credentials",
+			Initial:     func() interface{} { return DefaultEAPIConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"timeout": "2s",
+					"credentials": gin.H{
+						"203.0.113.0/24": gin.H{
+							"username":    "akvorado",
+							"password":    "secret",
+							"skip-verify": true,
+						},
+					},
+				}
+			},
+			Expected: EAPIConfiguration{
+				Timeout:                2 * time.Second,
+				MinimalRefreshInterval: time.Minute,
+				Targets:                helpers.MustNewSubnetMap(map[string]netip.Addr{}),
+				Ports:                  helpers.MustNewSubnetMap(map[string]uint16{"::/0": 443}),
+				Credentials: helpers.MustNewSubnetMap(map[string]Credentials{
+					"::ffff:203.0.113.0/120": {
+						Username:   "akvorado",
+						Password:   "secret",
+						SkipVerify: true,
+					},
+				}),
+				Secrets: secrets.DefaultConfiguration(),
+			},
+		}, {
+			Description: "credentials without username",
+			Initial:     func() interface{} { return DefaultNXAPIConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"credentials": gin.H{
+						"password": "secret",
+					},
+				}
+			},
+			Error: true,
+		},
+	})
+}
@@ -0,0 +1,115 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/metadata/provider"
+)
+
+type eapiRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  struct {
+		Version int      `json:"version"`
+		Cmds    []string `json:"cmds"`
+		Format  string   `json:"format"`
+	} `json:"params"`
+	ID string `json:"id"`
+}
+
+type eapiResponse struct {
+	Result []json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type eapiShowHostname struct {
+	Hostname string `json:"hostname"`
+}
+
+type eapiShowInterfaces struct {
+	Interfaces map[string]struct {
+		Description        string  `json:"description"`
+		Bandwidth          float64 `json:"bandwidth"` // in bps
+		InterfaceStatus    string  `json:"interfaceStatus"`
+		LineProtocolStatus string  `json:"lineProtocolStatus"`
+	} `json:"interfaces"`
+}
+
+type eapiShowIfIndex struct {
+	IfIndex map[string]uint `json:"ifIndex"`
+}
+
+// fetchEAPI fetches the name and the interfaces of an Arista device using
+// eAPI.
+func fetchEAPI(ctx context.Context, client *http.Client, baseURL string, credentials Credentials) (*device, error) {
+	request := eapiRequest{
+		JSONRPC: "2.0",
+		Method:  "runCmds",
+		ID:      "akvorado",
+	}
+	request.Params.Version = 1
+	request.Params.Cmds = []string{
+		"show hostname",
+		"show interfaces",
+		"show snmp mib ifmib ifindex",
+	}
+	request.Params.Format = "json"
+	var response eapiResponse
+	if err := postJSON(ctx, client, baseURL+"/command-api", credentials, request, &response); err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, helpers.PermanentError(
+			fmt.Errorf("eAPI error %d: %s", response.Error.Code, response.Error.Message))
+	}
+	if len(response.Result) != len(request.Params.Cmds) {
+		return nil, helpers.PermanentError(
+			fmt.Errorf("eAPI answer has %d results instead of %d",
+				len(response.Result), len(request.Params.Cmds)))
+	}
+
+	var (
+		hostname   eapiShowHostname
+		interfaces eapiShowInterfaces
+		ifIndexes  eapiShowIfIndex
+	)
+	for idx, target := range []interface{}{&hostname, &interfaces, &ifIndexes} {
+		if err := json.Unmarshal(response.Result[idx], target); err != nil {
+			return nil, helpers.PermanentError(
+				fmt.Errorf("cannot decode %q: %w", request.Params.Cmds[idx], err))
+		}
+	}
+
+	result := device{
+		Name:       hostname.Hostname,
+		Interfaces: map[uint]provider.Interface{},
+	}
+	for name, iface := range interfaces.Interfaces {
+		ifIndex, ok := ifIndexes.IfIndex[name]
+		if !ok {
+			continue
+		}
+		adminStatus := provider.InterfaceStatusUp
+		if iface.InterfaceStatus == "disabled" {
+			adminStatus = provider.InterfaceStatusDown
+		}
+		result.Interfaces[ifIndex] = provider.Interface{
+			Name:        name,
+			Description: iface.Description,
+			Speed:       uint(iface.Bandwidth / 1_000_000),
+			AdminStatus: adminStatus,
+			OperStatus:  parseStatus(iface.LineProtocolStatus),
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,277 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
+)
+
+// newTestServer starts an HTTP server answering the provided body on the
+// provided path and returns a configuration to query it.
+func newTestServer(t *testing.T, path string, body string) (Configuration, *atomic.Int32) {
+	t.Helper()
+	requests := &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if username, password, ok := r.BasicAuth(); !ok || username != "akvorado" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	_, portStr, err := net.SplitHostPort(server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("SplitHostPort() error:\n%+v", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatalf("Atoi() error:\n%+v", err)
+	}
+	config := defaultConfiguration()
+	config.Ports = helpers.MustNewSubnetMap(map[string]uint16{"::/0": uint16(port)})
+	config.Credentials = helpers.MustNewSubnetMap(map[string]Credentials{
+		"::ffff:127.0.0.1/128": {
+			Username: "akvorado",
+			Password: "secret",
+			Insecure: true,
+		},
+	})
+	return config, requests
+}
+
+// queryTestProvider queries the provided provider for the provided
+// exporter and interfaces.
+func queryTestProvider(t *testing.T, p provider.Provider, exporterIP netip.Addr, ifIndexes ...uint) {
+	t.Helper()
+	if err := p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: exporterIP,
+		IfIndexes:  ifIndexes,
+	}); err != nil {
+		t.Fatalf("Query() error:\n%+v", err)
+	}
+}
+
+func TestEAPI(t *testing.T) {
+	config, requests := newTestServer(t, "/command-api", `{
+  "jsonrpc": "2.0",
+  "id": "akvorado",
+  "result": [
+    {"hostname": "sw1", "fqdn": "sw1.example.com"},
+    {"interfaces": {
+      "Ethernet1": {
+        "name": "Ethernet1",
+        "description": "Transit",
+        "bandwidth": 10000000000,
+        "interfaceStatus": "connected",
+        "lineProtocolStatus": "up"
+      },
+      "Ethernet2": {
+        "name": "Ethernet2",
+        "description": "",
+        "bandwidth": 100000000000,
+        "interfaceStatus": "disabled",
+        "lineProtocolStatus": "down"
+      },
+      "Port-Channel10": {
+        "name": "Port-Channel10",
+        "description": "Peering",
+        "bandwidth": 20000000000,
+        "interfaceStatus": "connected",
+        "lineProtocolStatus": "lowerLayerDown"
+      }
+    }},
+    {"ifIndex": {"Ethernet1": 1, "Ethernet2": 2, "Port-Channel10": 1000010}}
+  ]
+}`)
+	r := reporter.NewMock(t)
+	got := []provider.Update{}
+	p, err := EAPIConfiguration(config).New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	exporterIP := netip.MustParseAddr("::ffff:127.0.0.1")
+	queryTestProvider(t, p, exporterIP, 1, 2)
+	queryTestProvider(t, p, exporterIP, 1000010, 3)
+	// Not handled by this provider
+	queryTestProvider(t, p, netip.MustParseAddr("::ffff:192.0.2.1"), 1)
+
+	expected := []provider.Update{
+		{
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 1},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "sw1"},
+				Interface: provider.Interface{
+					Name:        "Ethernet1",
+					Description: "Transit",
+					Speed:       10000,
+					AdminStatus: provider.InterfaceStatusUp,
+					OperStatus:  provider.InterfaceStatusUp,
+				},
+			},
+		}, {
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 2},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "sw1"},
+				Interface: provider.Interface{
+					Name:        "Ethernet2",
+					Speed:       100000,
+					AdminStatus: provider.InterfaceStatusDown,
+					OperStatus:  provider.InterfaceStatusDown,
+				},
+			},
+		}, {
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 1000010},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "sw1"},
+				Interface: provider.Interface{
+					Name:        "Port-Channel10",
+					Description: "Peering",
+					Speed:       20000,
+					AdminStatus: provider.InterfaceStatusUp,
+					OperStatus:  provider.InterfaceStatusLowerLayerDown,
+				},
+			},
+		}, {
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 3},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "sw1"},
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Query() (-got, +want):\n%s", diff)
+	}
+	// The second query should use the data from the first one
+	if requests.Load() != 1 {
+		t.Fatalf("Query() sent %d requests instead of 1", requests.Load())
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_provider_vendorapi_", "success_", "error_")
+	expectedMetrics := map[string]string{
+		`success_requests_total{exporter="127.0.0.1"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestEAPIErrors(t *testing.T) {
+	cases := []struct {
+		Description string
+		Body        string
+		Credentials Credentials
+		Class       helpers.ErrorClass
+	}{
+		{
+			Description: "wrong credentials",
+			Body:        `{}`,
+			Credentials: Credentials{Username: "akvorado", Password: "wrong", Insecure: true},
+			Class:       helpers.ErrorClassConfiguration,
+		}, {
+			Description: "eAPI error",
+			Body:        `{"jsonrpc": "2.0", "id": "akvorado", "error": {"code": 1002, "message": "invalid command"}}`,
+			Credentials: Credentials{Username: "akvorado", Password: "secret", Insecure: true},
+			Class:       helpers.ErrorClassPermanent,
+		}, {
+			Description: "missing results",
+			Body:        `{"jsonrpc": "2.0", "id": "akvorado", "result": [{"hostname": "sw1"}]}`,
+			Credentials: Credentials{Username: "akvorado", Password: "secret", Insecure: true},
+			Class:       helpers.ErrorClassPermanent,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			config, _ := newTestServer(t, "/command-api", tc.Body)
+			config.Credentials = helpers.MustNewSubnetMap(map[string]Credentials{
+				"::/0": tc.Credentials,
+			})
+			r := reporter.NewMock(t)
+			p, err := EAPIConfiguration(config).New(r, func(provider.Update) {
+				t.Fatal("put() should not be called")
+			})
+			if err != nil {
+				t.Fatalf("New() error:\n%+v", err)
+			}
+			err = p.Query(context.Background(), provider.BatchQuery{
+				ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+				IfIndexes:  []uint{1},
+			})
+			if err == nil {
+				t.Fatal("Query() did not error")
+			}
+			if class := helpers.ErrorClassOf(err); class != tc.Class {
+				t.Fatalf("Query() error class %s instead of %s", class, tc.Class)
+			}
+		})
+	}
+}
+
+func TestMinimalRefreshInterval(t *testing.T) {
+	config, requests := newTestServer(t, "/command-api", `{"result": [{"hostname": "sw1"}, {"interfaces": {}}, {"ifIndex": {}}]}`)
+	config.MinimalRefreshInterval = 10 * time.Millisecond
+	r := reporter.NewMock(t)
+	p, err := EAPIConfiguration(config).New(r, func(provider.Update) {})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	exporterIP := netip.MustParseAddr("::ffff:127.0.0.1")
+	queryTestProvider(t, p, exporterIP, 1)
+	queryTestProvider(t, p, exporterIP, 1)
+	time.Sleep(20 * time.Millisecond)
+	queryTestProvider(t, p, exporterIP, 1)
+	if requests.Load() != 2 {
+		t.Fatalf("Query() sent %d requests instead of 2", requests.Load())
+	}
+}
+
+func TestSecrets(t *testing.T) {
+	config, requests := newTestServer(t, "/command-api", `{"result": [{"hostname": "sw1"}, {"interfaces": {}}, {"ifIndex": {}}]}`)
+	config.Credentials = helpers.MustNewSubnetMap(map[string]Credentials{
+		"::ffff:127.0.0.1/128": {
+			Username: "akvorado",
+			Insecure: true,
+		},
+	})
+	secretFile := filepath.Join(t.TempDir(), "127.0.0.1.yaml")
+	if err := os.WriteFile(secretFile, []byte("password: secret\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error:\n%+v", err)
+	}
+	config.Secrets.Backend = secrets.BackendFile
+	config.Secrets.Paths = helpers.MustNewSubnetMap(map[string]string{
+		"::/0": filepath.Join(filepath.Dir(secretFile), "{exporter}.yaml"),
+	})
+	r := reporter.NewMock(t)
+	p, err := EAPIConfiguration(config).New(r, func(provider.Update) {})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	queryTestProvider(t, p, netip.MustParseAddr("::ffff:127.0.0.1"), 1)
+	if requests.Load() != 1 {
+		t.Fatalf("Query() sent %d requests instead of 1", requests.Load())
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"akvorado/common/helpers"
+	"akvorado/inlet/metadata/provider"
+)
+
+type nxapiRequest struct {
+	InsAPI struct {
+		Version      string `json:"version"`
+		Type         string `json:"type"`
+		Chunk        string `json:"chunk"`
+		SID          string `json:"sid"`
+		Input        string `json:"input"`
+		OutputFormat string `json:"output_format"`
+	} `json:"ins_api"`
+}
+
+type nxapiResponse struct {
+	InsAPI struct {
+		Outputs struct {
+			Output nxapiList[struct {
+				Input string          `json:"input"`
+				Code  string          `json:"code"`
+				Msg   string          `json:"msg"`
+				Body  json.RawMessage `json:"body"`
+			}] `json:"output"`
+		} `json:"outputs"`
+	} `json:"ins_api"`
+}
+
+type nxapiShowHostname struct {
+	Hostname string `json:"hostname"`
+}
+
+type nxapiShowInterface struct {
+	TableInterface struct {
+		RowInterface nxapiList[struct {
+			Interface     string    `json:"interface"`
+			Description   string    `json:"desc"`
+			State         string    `json:"state"`
+			AdminState    string    `json:"admin_state"`
+			EthBandwidth  nxapiUint `json:"eth_bw"` // in kbps
+			SVIAdminState string    `json:"svi_admin_state"`
+			SVILineProto  string    `json:"svi_line_proto"`
+			SVIBandwidth  nxapiUint `json:"svi_bw"` // in kbps
+		}] `json:"ROW_interface"`
+	} `json:"TABLE_interface"`
+}
+
+type nxapiShowIfIndex struct {
+	TableInterface struct {
+		RowInterface nxapiList[struct {
+			Interface string    `json:"interface"`
+			IfIndex   nxapiUint `json:"snmp-ifindex"`
+		}] `json:"ROW_interface"`
+	} `json:"TABLE_interface"`
+}
+
+// nxapiList is a list of items. NX-API returns an object instead of a list
+// when there is only one item.
+type nxapiList[T any] []T
+
+// UnmarshalJSON decodes a list or a single item.
+func (l *nxapiList[T]) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		return json.Unmarshal(data, (*[]T)(l))
+	}
+	var item T
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	*l = nxapiList[T]{item}
+	return nil
+}
+
+// nxapiUint is an unsigned integer. NX-API may return it as a string,
+// possibly in hexadecimal.
+type nxapiUint uint64
+
+// UnmarshalJSON decodes a number or a string.
+func (u *nxapiUint) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "" {
+		*u = 0
+		return nil
+	}
+	value, err := strconv.ParseUint(str, 0, 64)
+	if err != nil {
+		return err
+	}
+	*u = nxapiUint(value)
+	return nil
+}
+
+// fetchNXAPI fetches the name and the interfaces of a Cisco device using
+// NX-API.
+func fetchNXAPI(ctx context.Context, client *http.Client, baseURL string, credentials Credentials) (*device, error) {
+	cmds := []string{
+		"show hostname",
+		"show interface",
+		"show interface snmp-ifindex",
+	}
+	var request nxapiRequest
+	request.InsAPI.Version = "1.0"
+	request.InsAPI.Type = "cli_show"
+	request.InsAPI.Chunk = "0"
+	request.InsAPI.SID = "1"
+	request.InsAPI.Input = strings.Join(cmds, " ;")
+	request.InsAPI.OutputFormat = "json"
+	var response nxapiResponse
+	if err := postJSON(ctx, client, baseURL+"/ins", credentials, request, &response); err != nil {
+		return nil, err
+	}
+	outputs := response.InsAPI.Outputs.Output
+	if len(outputs) != len(cmds) {
+		return nil, helpers.PermanentError(
+			fmt.Errorf("NX-API answer has %d outputs instead of %d", len(outputs), len(cmds)))
+	}
+
+	var (
+		hostname   nxapiShowHostname
+		interfaces nxapiShowInterface
+		ifIndexes  nxapiShowIfIndex
+	)
+	for idx, target := range []interface{}{&hostname, &interfaces, &ifIndexes} {
+		if outputs[idx].Code != "200" {
+			return nil, helpers.PermanentError(
+				fmt.Errorf("NX-API error %s for %q: %s", outputs[idx].Code, cmds[idx], outputs[idx].Msg))
+		}
+		if err := json.Unmarshal(outputs[idx].Body, target); err != nil {
+			return nil, helpers.PermanentError(
+				fmt.Errorf("cannot decode %q: %w", cmds[idx], err))
+		}
+	}
+
+	names := map[string]uint{}
+	for _, row := range ifIndexes.TableInterface.RowInterface {
+		names[row.Interface] = uint(row.IfIndex)
+	}
+	result := device{
+		Name:       hostname.Hostname,
+		Interfaces: map[uint]provider.Interface{},
+	}
+	for _, row := range interfaces.TableInterface.RowInterface {
+		ifIndex, ok := names[row.Interface]
+		if !ok {
+			continue
+		}
+		adminState, state, bandwidth := row.AdminState, row.State, row.EthBandwidth
+		if bandwidth == 0 && row.SVIBandwidth > 0 {
+			adminState, state, bandwidth = row.SVIAdminState, row.SVILineProto, row.SVIBandwidth
+		}
+		result.Interfaces[ifIndex] = provider.Interface{
+			Name:        row.Interface,
+			Description: row.Description,
+			Speed:       uint(bandwidth / 1000),
+			AdminStatus: parseStatus(adminState),
+			OperStatus:  parseStatus(state),
+		}
+	}
+	return &result, nil
+}
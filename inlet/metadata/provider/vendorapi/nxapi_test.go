@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package vendorapi
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+)
+
+func TestNXAPI(t *testing.T) {
+	config, _ := newTestServer(t, "/ins", `{
+  "ins_api": {
+    "type": "cli_show",
+    "version": "1.0",
+    "sid": "eoc",
+    "outputs": {
+      "output": [
+        {"input": "show hostname", "msg": "Success", "code": "200", "body": {"hostname": "n9k1"}},
+        {"input": "show interface", "msg": "Success", "code": "200", "body": {
+          "TABLE_interface": {"ROW_interface": [
+            {"interface": "Ethernet1/1", "state": "up", "admin_state": "up", "desc": "Transit", "eth_bw": 10000000},
+            {"interface": "Ethernet1/2", "state": "down", "admin_state": "down", "eth_bw": "100000000"},
+            {"interface": "Vlan100", "svi_admin_state": "up", "svi_line_proto": "up", "desc": "Servers", "svi_bw": 1000000},
+            {"interface": "Ethernet1/3", "state": "up", "admin_state": "up", "eth_bw": 1000000}
+          ]}
+        }},
+        {"input": "show interface snmp-ifindex", "msg": "Success", "code": "200", "body": {
+          "TABLE_interface": {"ROW_interface": [
+            {"interface": "Ethernet1/1", "snmp-ifindex": "436207616"},
+            {"interface": "Ethernet1/2", "snmp-ifindex": 436211712},
+            {"interface": "Vlan100", "snmp-ifindex": "0x9010064"}
+          ]}
+        }}
+      ]
+    }
+  }
+}`)
+	r := reporter.NewMock(t)
+	got := []provider.Update{}
+	p, err := NXAPIConfiguration(config).New(r, func(update provider.Update) {
+		got = append(got, update)
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	exporterIP := netip.MustParseAddr("::ffff:127.0.0.1")
+	queryTestProvider(t, p, exporterIP, 436207616, 436211712, 151060580)
+
+	expected := []provider.Update{
+		{
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 436207616},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "n9k1"},
+				Interface: provider.Interface{
+					Name:        "Ethernet1/1",
+					Description: "Transit",
+					Speed:       10000,
+					AdminStatus: provider.InterfaceStatusUp,
+					OperStatus:  provider.InterfaceStatusUp,
+				},
+			},
+		}, {
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 436211712},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "n9k1"},
+				Interface: provider.Interface{
+					Name:        "Ethernet1/2",
+					Speed:       100000,
+					AdminStatus: provider.InterfaceStatusDown,
+					OperStatus:  provider.InterfaceStatusDown,
+				},
+			},
+		}, {
+			Query: provider.Query{ExporterIP: exporterIP, IfIndex: 151060580},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{Name: "n9k1"},
+				Interface: provider.Interface{
+					Name:        "Vlan100",
+					Description: "Servers",
+					Speed:       1000,
+					AdminStatus: provider.InterfaceStatusUp,
+					OperStatus:  provider.InterfaceStatusUp,
+				},
+			},
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("Query() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestNXAPISingleOutput(t *testing.T) {
+	config, _ := newTestServer(t, "/ins", `{
+  "ins_api": {
+    "outputs": {
+      "output": {"input": "show hostname", "msg": "Success", "code": "200", "body": {"hostname": "n9k1"}}
+    }
+  }
+}`)
+	r := reporter.NewMock(t)
+	p, err := NXAPIConfiguration(config).New(r, func(provider.Update) {
+		t.Fatal("put() should not be called")
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	err = p.Query(context.Background(), provider.BatchQuery{
+		ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+		IfIndexes:  []uint{1},
+	})
+	if err == nil {
+		t.Fatal("Query() did not error")
+	}
+	if class := helpers.ErrorClassOf(err); class != helpers.ErrorClassPermanent {
+		t.Fatalf("Query() error class %s instead of %s", class, helpers.ErrorClassPermanent)
+	}
+}
@@ -0,0 +1,258 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package vendorapi uses vendor HTTP APIs (Arista eAPI and Cisco NX-API) to
+// get interface names and descriptions.
+package vendorapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+	"akvorado/inlet/metadata/provider/secrets"
+)
+
+// Provider represents a vendor API provider.
+type Provider struct {
+	r         *reporter.Reporter
+	config    *Configuration
+	fetch     fetchFunc
+	errLogger reporter.Logger
+	secrets   *secrets.Store
+
+	put func(provider.Update)
+
+	states     map[netip.Addr]*exporterState
+	statesLock sync.Mutex
+
+	metrics struct {
+		successes *reporter.CounterVec
+		errors    *reporter.CounterVec
+		times     *reporter.SummaryVec
+	}
+}
+
+// device contains the information fetched from an exporter.
+type device struct {
+	Name       string
+	Interfaces map[uint]provider.Interface
+}
+
+// fetchFunc fetches the name and the interfaces of a device using the
+// provided HTTP client and base URL.
+type fetchFunc func(ctx context.Context, client *http.Client, baseURL string, credentials Credentials) (*device, error)
+
+// exporterState keeps the last information fetched from an exporter. The lock
+// ensures only one fetch is running for an exporter.
+type exporterState struct {
+	lock    sync.Mutex
+	device  *device
+	fetched time.Time
+}
+
+// newProvider creates a new vendor API provider using the provided fetch
+// function.
+func newProvider(r *reporter.Reporter, configuration Configuration, fetch fetchFunc, put func(provider.Update)) (provider.Provider, error) {
+	store, err := configuration.Secrets.New(r)
+	if err != nil {
+		return nil, err
+	}
+	p := Provider{
+		r:         r,
+		config:    &configuration,
+		fetch:     fetch,
+		errLogger: r.Sample(reporter.BurstSampler(10*time.Second, 3)),
+		secrets:   store,
+		put:       put,
+		states:    map[netip.Addr]*exporterState{},
+	}
+	p.metrics.successes = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "success_requests_total",
+			Help: "Number of successful requests.",
+		}, []string{"exporter"})
+	p.metrics.errors = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "error_requests_total",
+			Help: "Number of failed requests.",
+		}, []string{"exporter", "error"})
+	p.metrics.times = r.SummaryVec(
+		reporter.SummaryOpts{
+			Name:       "seconds",
+			Help:       "Time to fetch data from an exporter.",
+			Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		}, []string{"exporter"})
+	return &p, nil
+}
+
+// Query queries the exporter to get information through its API. Exporters
+// without credentials are ignored and left to the next provider.
+func (p *Provider) Query(ctx context.Context, q provider.BatchQuery) error {
+	credentials, ok := p.config.Credentials.Lookup(q.ExporterIP)
+	if !ok {
+		return nil
+	}
+	p.statesLock.Lock()
+	state, ok := p.states[q.ExporterIP]
+	if !ok {
+		state = &exporterState{}
+		p.states[q.ExporterIP] = state
+	}
+	p.statesLock.Unlock()
+
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.device == nil || time.Since(state.fetched) >= p.config.MinimalRefreshInterval {
+		device, err := p.query(ctx, q.ExporterIP, credentials)
+		if err != nil {
+			return err
+		}
+		state.device = device
+		state.fetched = time.Now()
+	}
+
+	for _, ifIndex := range q.IfIndexes {
+		p.put(provider.Update{
+			Query: provider.Query{
+				ExporterIP: q.ExporterIP,
+				IfIndex:    ifIndex,
+			},
+			Answer: provider.Answer{
+				Exporter: provider.Exporter{
+					Name: state.device.Name,
+				},
+				Interface: state.device.Interfaces[ifIndex],
+			},
+		})
+	}
+	return nil
+}
+
+// query fetches information from the provided exporter.
+func (p *Provider) query(ctx context.Context, exporterIP netip.Addr, credentials Credentials) (*device, error) {
+	exporterStr := exporterIP.Unmap().String()
+	targetIP := p.config.Targets.LookupOrDefault(exporterIP, exporterIP)
+	targetPort := p.config.Ports.LookupOrDefault(exporterIP, 443)
+	scheme := "https"
+	if credentials.Insecure {
+		scheme = "http"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme,
+		net.JoinHostPort(targetIP.Unmap().String(), strconv.FormatUint(uint64(targetPort), 10)))
+
+	secret, _, err := p.secrets.Lookup(ctx, exporterIP)
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "secret").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to fetch credentials")
+		return nil, err
+	}
+	secret.Override("Username", &credentials.Username)
+	secret.Override("Password", &credentials.Password)
+
+	tlsConfig, err := credentials.tlsConfig()
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "tls").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to build TLS configuration")
+		return nil, helpers.ConfigurationError(err)
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Timeout:   p.config.Timeout,
+		Transport: transport,
+	}
+
+	start := time.Now()
+	device, err := p.fetch(ctx, client, baseURL, credentials)
+	if errors.Is(err, context.Canceled) {
+		return nil, err
+	}
+	if err != nil {
+		p.metrics.errors.WithLabelValues(exporterStr, "fetch").Inc()
+		p.errLogger.Err(err).Str("exporter", exporterStr).Msg("unable to fetch data from exporter")
+		if helpers.ErrorClassOf(err) == helpers.ErrorClassConfiguration {
+			// Credentials may have been rotated
+			p.secrets.Invalidate(exporterIP)
+		}
+		return nil, err
+	}
+	p.metrics.successes.WithLabelValues(exporterStr).Inc()
+	p.metrics.times.WithLabelValues(exporterStr).Observe(time.Since(start).Seconds())
+	return device, nil
+}
+
+// postJSON sends the provided request encoded as JSON to the provided URL and
+// decodes the answer into the provided response.
+func postJSON(ctx context.Context, client *http.Client, url string, credentials Credentials, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return helpers.ConfigurationError(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(credentials.Username, credentials.Password)
+	resp, err := client.Do(req)
+	if err != nil {
+		return helpers.TransientError(err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return helpers.ConfigurationError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	case resp.StatusCode >= 500:
+		return helpers.TransientError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	case resp.StatusCode != http.StatusOK:
+		return helpers.PermanentError(fmt.Errorf("unexpected HTTP status %s", resp.Status))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return helpers.PermanentError(fmt.Errorf("cannot decode answer: %w", err))
+	}
+	return nil
+}
+
+// parseStatus parses an interface status. Unknown values are ignored.
+func parseStatus(status string) provider.InterfaceStatus {
+	var result provider.InterfaceStatus
+	if err := result.UnmarshalText([]byte(status)); err != nil {
+		return provider.InterfaceStatusUndefined
+	}
+	return result
+}
+
+// tlsConfig returns the TLS configuration for the provided credentials.
+func (credentials Credentials) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: credentials.SkipVerify,
+	}
+	if credentials.TLSCA != "" {
+		caCert, err := os.ReadFile(credentials.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read CA certificate: %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if ok := caCertPool.AppendCertsFromPEM(caCert); !ok {
+			return nil, errors.New("cannot parse CA certificate")
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	return tlsConfig, nil
+}
@@ -7,18 +7,25 @@
 package metadata
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/netip"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/eapache/go-resiliency/breaker"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"gopkg.in/tomb.v2"
 
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/persist"
 	"akvorado/common/reporter"
 	"akvorado/inlet/metadata/provider"
 )
@@ -30,16 +37,32 @@ type Component struct {
 	t      tomb.Tomb
 	config Configuration
 
-	sc *metadataCache
+	sc                *metadataCache
+	redis             *redis.Client   // nil when Redis is not used
+	stores            []persist.Store // where to persist the cache
+	shared            sharedCache     // nil when the cache is not shared
+	sharedCacheLogger reporter.Logger
 
 	healthyWorkers         chan reporter.ChannelHealthcheckFunc
 	providerChannel        chan provider.BatchQuery
-	dispatcherChannel      chan provider.Query
+	dispatcherChannel      chan provider.BatchQuery
 	dispatcherBChannel     chan (<-chan bool) // block channel for testing
 	providerBreakersLock   sync.Mutex
 	providerBreakerLoggers map[netip.Addr]reporter.Logger
 	providerBreakers       map[netip.Addr]*breaker.Breaker
-	provider               provider.Provider
+	providers              []providerEntry
+	pendingLock            sync.Mutex
+	pending                map[provider.Query]struct{}
+	waitersLock            sync.Mutex
+	waiters                map[provider.Query][]*waiter
+	identitiesLock         sync.RWMutex
+	identities             map[string][]netip.Addr
+	renumberingLock        sync.Mutex
+	renumberings           map[netip.Addr][]InterfaceRenumbering
+	renumberingRefreshes   map[netip.Addr]time.Time
+	warmupUntil            time.Time
+	volumesLock            sync.Mutex
+	volumes                map[provider.Query]uint64
 
 	metrics struct {
 		cacheRefreshRuns         reporter.Counter
@@ -47,13 +70,37 @@ type Component struct {
 		providerBusyCount        *reporter.CounterVec
 		providerBreakerOpenCount *reporter.CounterVec
 		providerBatchedCount     reporter.Counter
+		exporterNewAddresses     *reporter.CounterVec
+		interfaceRenumberings    *reporter.CounterVec
+		sharedCacheHits          reporter.Counter
+		sharedCacheMisses        reporter.Counter
+		sharedCacheLocked        reporter.Counter
+		sharedCacheErrors        reporter.Counter
 	}
 }
 
+// InterfaceRenumbering records an interface index which changed of name.
+type InterfaceRenumbering struct {
+	Time     time.Time
+	IfIndex  uint
+	Previous string
+	Name     string
+}
+
+// maxRenumberings is the number of interface renumberings kept per exporter.
+const maxRenumberings = 100
+
+// providerEntry is a provider with the subnets of the exporters it handles.
+type providerEntry struct {
+	provider  provider.Provider
+	exporters *helpers.SubnetMap[bool] // nil means all exporters
+}
+
 // Dependencies define the dependencies of the metadata component.
 type Dependencies struct {
 	Daemon daemon.Component
 	Clock  clock.Clock
+	HTTP   *httpserver.Component // optional
 }
 
 // New creates a new metadata component.
@@ -76,21 +123,92 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 		sc:     sc,
 
 		providerChannel:        make(chan provider.BatchQuery),
-		dispatcherChannel:      make(chan provider.Query, 100*configuration.Workers),
+		dispatcherChannel:      make(chan provider.BatchQuery, 100*configuration.Workers),
 		dispatcherBChannel:     make(chan (<-chan bool)),
 		providerBreakers:       make(map[netip.Addr]*breaker.Breaker),
 		providerBreakerLoggers: make(map[netip.Addr]reporter.Logger),
+		pending:                make(map[provider.Query]struct{}),
+		waiters:                make(map[provider.Query][]*waiter),
+		identities:             make(map[string][]netip.Addr),
+		renumberings:           make(map[netip.Addr][]InterfaceRenumbering),
+		renumberingRefreshes:   make(map[netip.Addr]time.Time),
 	}
 	c.d.Daemon.Track(&c.t, "inlet/metadata")
+	if c.config.Redis.Server != "" {
+		c.redis = c.config.Redis.NewClient()
+	}
+	c.stores = persist.NewStores(c.config.CachePersistFile, c.redis, c.config.CachePersistRedis)
 
-	// Initialize the provider
-	selectedProvider, err := c.config.Provider.Config.New(r, func(update provider.Update) {
-		c.sc.Put(c.d.Clock.Now(), update.Query, update.Answer)
-	})
-	if err != nil {
-		return nil, err
+	// Initialize the providers
+	if len(c.config.Providers) == 0 {
+		return nil, errors.New("at least one provider is needed")
+	}
+	if c.config.SharedCache.Enabled {
+		if c.redis == nil {
+			return nil, errors.New("a Redis server is needed to share the cache")
+		}
+		// Entries are kept until the next refresh by one of the inlets.
+		ttl := c.config.CacheRefresh
+		if ttl == 0 {
+			ttl = c.config.CacheDuration
+		}
+		c.shared = newRedisSharedCache(c.redis, c.config.SharedCache, ttl)
+		c.sharedCacheLogger = r.Sample(reporter.BurstSampler(time.Minute, 1))
+	}
+	put := func(update provider.Update) {
+		c.update(update)
+		if c.shared != nil {
+			c.sharedPut(update)
+		}
+	}
+	var pushHandler, discoveredHandler gin.HandlerFunc
+	for idx, pc := range c.config.Providers {
+		entry := providerEntry{}
+		if len(pc.ExporterSubnets) > 0 {
+			subnets := map[string]bool{}
+			for _, subnet := range pc.ExporterSubnets {
+				key, err := helpers.SubnetMapParseKey(subnet.String())
+				if err != nil {
+					return nil, fmt.Errorf("invalid exporter subnet for provider %d: %w", idx, err)
+				}
+				subnets[key] = true
+			}
+			exporters, err := helpers.NewSubnetMap(subnets)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exporter subnets for provider %d: %w", idx, err)
+			}
+			entry.exporters = exporters
+		}
+		selectedProvider, err := pc.Config.New(r, put)
+		if err != nil {
+			return nil, err
+		}
+		entry.provider = selectedProvider
+		c.providers = append(c.providers, entry)
+		if pp, ok := selectedProvider.(provider.PushProvider); ok {
+			if handler := pp.PushHandler(c.refreshExporters); handler != nil {
+				if pushHandler != nil {
+					return nil, errors.New("only one provider can accept pushed data")
+				}
+				pushHandler = handler
+			}
+		}
+		if dp, ok := selectedProvider.(provider.DiscoveryProvider); ok {
+			if handler := dp.DiscoveredHandler(); handler != nil {
+				if discoveredHandler != nil {
+					return nil, errors.New("only one provider can discover exporters")
+				}
+				discoveredHandler = handler
+			}
+		}
+	}
+	if pushHandler != nil && c.d.HTTP != nil {
+		c.d.HTTP.GinRouter.PUT("/api/v0/inlet/metadata/exporters", pushHandler)
+		c.d.HTTP.GinRouter.PATCH("/api/v0/inlet/metadata/exporters", pushHandler)
+	}
+	if discoveredHandler != nil && c.d.HTTP != nil {
+		c.d.HTTP.GinRouter.GET("/api/v0/inlet/metadata/discovered", discoveredHandler)
 	}
-	c.provider = selectedProvider
 
 	c.metrics.cacheRefreshRuns = r.Counter(
 		reporter.CounterOpts{
@@ -120,6 +238,38 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 			Help: "Several requests were batched into one.",
 		},
 	)
+	c.metrics.exporterNewAddresses = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "exporter_new_addresses_total",
+			Help: "Number of times a known exporter was seen with a new address.",
+		},
+		[]string{"exporter"})
+	c.metrics.interfaceRenumberings = r.CounterVec(
+		reporter.CounterOpts{
+			Name: "interface_renumberings_total",
+			Help: "Number of times an interface index was seen with a new name.",
+		},
+		[]string{"exporter"})
+	c.metrics.sharedCacheHits = r.Counter(
+		reporter.CounterOpts{
+			Name: "shared_cache_hits_total",
+			Help: "Number of lookups retrieved from the shared cache.",
+		})
+	c.metrics.sharedCacheMisses = r.Counter(
+		reporter.CounterOpts{
+			Name: "shared_cache_misses_total",
+			Help: "Number of lookups missing from the shared cache.",
+		})
+	c.metrics.sharedCacheLocked = r.Counter(
+		reporter.CounterOpts{
+			Name: "shared_cache_locked_total",
+			Help: "Number of polls skipped as another inlet is polling the same exporter.",
+		})
+	c.metrics.sharedCacheErrors = r.Counter(
+		reporter.CounterOpts{
+			Name: "shared_cache_errors_total",
+			Help: "Number of errors with the shared cache.",
+		})
 	return &c, nil
 }
 
@@ -128,10 +278,18 @@ func (c *Component) Start() error {
 	c.r.Info().Msg("starting metadata component")
 
 	// Load cache
-	if c.config.CachePersistFile != "" {
-		if err := c.sc.Load(c.config.CachePersistFile); err != nil {
+	if len(c.stores) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), persist.Timeout)
+		if err := c.sc.Load(ctx, c.stores); errors.Is(err, persist.ErrNotFound) {
+			c.r.Info().Msg("no saved cache, starting with an empty one")
+		} else if err != nil {
 			c.r.Err(err).Msg("cannot load cache, ignoring")
 		}
+		cancel()
+	}
+	if c.config.Warmup > 0 && c.sc.cache.Size() == 0 {
+		c.warmupUntil = c.d.Clock.Now().Add(c.config.Warmup)
+		c.r.Info().Dur("duration", c.config.Warmup).Msg("empty cache, poll interfaces by traffic volume")
 	}
 
 	// Goroutine to refresh the cache
@@ -141,6 +299,8 @@ func (c *Component) Start() error {
 		c.r.Debug().Msg("starting metadata ticker")
 		ticker := c.d.Clock.Ticker(c.config.CacheCheckInterval)
 		defer ticker.Stop()
+		waitersTicker := c.d.Clock.Ticker(time.Second)
+		defer waitersTicker.Stop()
 		defer close(healthyTicker)
 		for {
 			select {
@@ -153,6 +313,9 @@ func (c *Component) Start() error {
 				}
 			case <-ticker.C:
 				c.expireCache()
+				c.expireVolumes()
+			case now := <-waitersTicker.C:
+				c.expireWaiters(now)
 			}
 		}
 	})
@@ -174,11 +337,18 @@ func (c *Component) Start() error {
 				// This is to test batching
 				<-ch
 			case request := <-c.dispatcherChannel:
-				c.dispatchIncomingRequest(request)
+				if c.warmingUp() {
+					c.dispatchWarmupRequests(request)
+				} else {
+					c.dispatchIncomingRequest(request)
+				}
 			}
 		}
 	})
 
+	// Readiness depends on the backlog of requests to dispatch
+	c.r.RegisterReadinessCheck("metadata/backlog", c.backlogHealthcheck)
+
 	// Goroutines to poll exporters
 	c.healthyWorkers = make(chan reporter.ChannelHealthcheckFunc)
 	c.r.RegisterHealthcheck("metadata/worker", reporter.ChannelHealthcheck(c.t.Context(nil), c.healthyWorkers))
@@ -204,16 +374,37 @@ func (c *Component) Start() error {
 	return nil
 }
 
+// backlogHealthcheck checks the queue of requests waiting to be dispatched to
+// workers is not almost full.
+func (c *Component) backlogHealthcheck(_ context.Context) reporter.HealthcheckResult {
+	backlog, capacity := len(c.dispatcherChannel), cap(c.dispatcherChannel)
+	if backlog > capacity*3/4 {
+		return reporter.HealthcheckResult{
+			Status: reporter.HealthcheckWarning,
+			Reason: fmt.Sprintf("backlog above threshold (%d/%d)", backlog, capacity),
+		}
+	}
+	return reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "backlog below threshold"}
+}
+
 // Stop stops the metadata component
 func (c *Component) Stop() error {
 	defer func() {
 		close(c.dispatcherChannel)
 		close(c.providerChannel)
 		close(c.healthyWorkers)
-		if c.config.CachePersistFile != "" {
-			if err := c.sc.Save(c.config.CachePersistFile); err != nil {
+		if len(c.stores) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), persist.Timeout)
+			if err := c.sc.Save(ctx, c.stores); err != nil {
 				c.r.Err(err).Msg("cannot save cache")
 			}
+			cancel()
+			for _, store := range c.stores {
+				store.Close()
+			}
+		}
+		if c.redis != nil {
+			c.redis.Close()
 		}
 		c.r.Info().Msg("metadata component stopped")
 	}()
@@ -226,11 +417,12 @@ func (c *Component) Stop() error {
 // If the information is not in the cache, it will be polled, but
 // won't be returned immediately.
 func (c *Component) Lookup(t time.Time, exporterIP netip.Addr, ifIndex uint) (provider.Answer, bool) {
+	exporterIP = normalizeExporterIP(exporterIP)
 	query := provider.Query{ExporterIP: exporterIP, IfIndex: ifIndex}
 	answer, ok := c.sc.Lookup(t, query)
 	if !ok {
 		select {
-		case c.dispatcherChannel <- query:
+		case c.dispatcherChannel <- provider.BatchQuery{ExporterIP: exporterIP, IfIndexes: []uint{ifIndex}}:
 		default:
 			c.metrics.providerBusyCount.WithLabelValues(exporterIP.Unmap().String()).Inc()
 		}
@@ -238,20 +430,201 @@ func (c *Component) Lookup(t time.Time, exporterIP netip.Addr, ifIndex uint) (pr
 	return answer, ok
 }
 
+// LookupMany looks up interface information for several interfaces of the
+// provided exporter at once. The answers are returned in the same order as the
+// provided interface indexes. Interfaces not in the cache are polled with a
+// single request, but they won't be returned immediately. The volume is the
+// traffic of the flow triggering the lookup. After a start with an empty
+// cache, it is used to poll the busiest interfaces first.
+func (c *Component) LookupMany(t time.Time, exporterIP netip.Addr, ifIndexes []uint, volume uint64) ([]provider.Answer, []bool) {
+	exporterIP = normalizeExporterIP(exporterIP)
+	queries := make([]provider.Query, len(ifIndexes))
+	for idx, ifIndex := range ifIndexes {
+		queries[idx] = provider.Query{ExporterIP: exporterIP, IfIndex: ifIndex}
+	}
+	answers, found := c.sc.LookupMany(t, queries)
+	var missing []uint
+	for idx, ok := range found {
+		if !ok && !slices.Contains(missing, ifIndexes[idx]) {
+			missing = append(missing, ifIndexes[idx])
+		}
+	}
+	if len(missing) > 0 {
+		c.recordVolume(exporterIP, missing, volume)
+		select {
+		case c.dispatcherChannel <- provider.BatchQuery{ExporterIP: exporterIP, IfIndexes: missing}:
+		default:
+			c.metrics.providerBusyCount.WithLabelValues(exporterIP.Unmap().String()).Inc()
+		}
+	}
+	return answers, found
+}
+
+// Invalidate removes the cached information for the provided exporter. When
+// interfaces are provided, only these interfaces are invalidated. When the
+// exporter is the zero value, the whole cache is invalidated. It returns the
+// number of removed entries.
+func (c *Component) Invalidate(exporterIP netip.Addr, ifIndexes ...uint) int {
+	return c.sc.Invalidate(normalizeExporterIP(exporterIP), ifIndexes...)
+}
+
+// Interfaces returns the cached information for all the known interfaces of
+// the provided exporter. Contrary to Lookup, this does not trigger any poll.
+func (c *Component) Interfaces(exporterIP netip.Addr) map[uint]provider.Answer {
+	return c.sc.Interfaces(normalizeExporterIP(exporterIP))
+}
+
+// Entries returns all the cached entries. Contrary to Lookup, this does not
+// trigger any poll.
+func (c *Component) Entries() map[provider.Query]provider.Answer {
+	return c.sc.cache.Items()
+}
+
+// ExporterAddresses returns the addresses known for the exporter with the
+// provided name, the most recent one first. The name is the one returned by
+// providers (SNMP sysName or static configuration). It stays stable when an
+// exporter is renumbered.
+func (c *Component) ExporterAddresses(name string) []netip.Addr {
+	c.identitiesLock.RLock()
+	defer c.identitiesLock.RUnlock()
+	return slices.Clone(c.identities[name])
+}
+
+// update stores an update received from a provider or from the shared cache
+// into the local cache.
+func (c *Component) update(update provider.Update) {
+	if c.config.TrackInterfaceRenumbering {
+		c.checkRenumbering(update)
+	}
+	c.sc.Put(c.d.Clock.Now(), update.Query, update.Answer)
+	c.updateIdentity(update.Exporter.Name, update.ExporterIP)
+	c.pendingLock.Lock()
+	delete(c.pending, update.Query)
+	c.pendingLock.Unlock()
+	c.notifyWaiters(update.Query)
+}
+
+// updateIdentity records the provided address for the exporter with the
+// provided name.
+func (c *Component) updateIdentity(name string, exporterIP netip.Addr) {
+	if name == "" {
+		return
+	}
+	c.identitiesLock.RLock()
+	addresses := c.identities[name]
+	current := len(addresses) > 0 && addresses[0] == exporterIP
+	c.identitiesLock.RUnlock()
+	if current {
+		return
+	}
+
+	c.identitiesLock.Lock()
+	defer c.identitiesLock.Unlock()
+	addresses = c.identities[name]
+	idx := slices.Index(addresses, exporterIP)
+	switch {
+	case idx == 0:
+		return
+	case idx > 0:
+		addresses = slices.Delete(addresses, idx, idx+1)
+	case len(addresses) > 0:
+		c.r.Info().
+			Str("exporter", name).
+			Str("previous", addresses[0].Unmap().String()).
+			Str("address", exporterIP.Unmap().String()).
+			Msg("exporter seen with a new address")
+		c.metrics.exporterNewAddresses.WithLabelValues(name).Inc()
+	}
+	c.identities[name] = append([]netip.Addr{exporterIP}, addresses...)
+}
+
+// InterfaceRenumberings returns the interface indexes of the provided exporter
+// which were seen with a new name, the oldest first. Only the last changes are
+// kept. This is only tracked when TrackInterfaceRenumbering is enabled.
+func (c *Component) InterfaceRenumberings(exporterIP netip.Addr) []InterfaceRenumbering {
+	c.renumberingLock.Lock()
+	defer c.renumberingLock.Unlock()
+	return slices.Clone(c.renumberings[normalizeExporterIP(exporterIP)])
+}
+
+// checkRenumbering compares the provided update with the cached entry for the
+// same interface index. When the name changed, the exporter has likely
+// renumbered its interfaces: the change is recorded and the other interfaces
+// of the exporter are refreshed.
+func (c *Component) checkRenumbering(update provider.Update) {
+	now := c.d.Clock.Now()
+	previous, ok := c.sc.cache.Get(now, update.Query)
+	if !ok || previous.Interface.Name == "" || update.Interface.Name == "" ||
+		previous.Interface.Name == update.Interface.Name {
+		return
+	}
+	exporterStr := update.ExporterIP.Unmap().String()
+	c.r.Info().
+		Str("exporter", exporterStr).
+		Uint("ifindex", update.IfIndex).
+		Str("previous", previous.Interface.Name).
+		Str("name", update.Interface.Name).
+		Msg("interface index seen with a new name")
+	c.metrics.interfaceRenumberings.WithLabelValues(exporterStr).Inc()
+
+	c.renumberingLock.Lock()
+	renumberings := append(c.renumberings[update.ExporterIP], InterfaceRenumbering{
+		Time:     now,
+		IfIndex:  update.IfIndex,
+		Previous: previous.Interface.Name,
+		Name:     update.Interface.Name,
+	})
+	if len(renumberings) > maxRenumberings {
+		renumberings = slices.Clone(renumberings[len(renumberings)-maxRenumberings:])
+	}
+	c.renumberings[update.ExporterIP] = renumberings
+	lastRefresh, refreshed := c.renumberingRefreshes[update.ExporterIP]
+	refresh := !refreshed || now.Sub(lastRefresh) >= c.config.CacheCheckInterval
+	if refresh {
+		c.renumberingRefreshes[update.ExporterIP] = now
+	}
+	c.renumberingLock.Unlock()
+	if !refresh {
+		return
+	}
+
+	// Other interfaces are likely to be renumbered too. Keep the current
+	// entries to not lose flows while refreshing them.
+	for ifIndex := range c.sc.Interfaces(update.ExporterIP) {
+		if ifIndex == 0 || ifIndex == update.IfIndex {
+			continue
+		}
+		select {
+		case c.dispatcherChannel <- provider.BatchQuery{ExporterIP: update.ExporterIP, IfIndexes: []uint{ifIndex}}:
+		default:
+			c.metrics.providerBusyCount.WithLabelValues(exporterStr).Inc()
+		}
+	}
+}
+
+// normalizeExporterIP turns an IPv4 address into an IPv4-mapped IPv6 address.
+// Cache entries and subnet maps used by providers are keyed by IPv6 addresses.
+func normalizeExporterIP(exporterIP netip.Addr) netip.Addr {
+	if exporterIP.Is4() {
+		return netip.AddrFrom16(exporterIP.As16())
+	}
+	return exporterIP
+}
+
 // dispatchIncomingRequest dispatches an incoming request to workers. It may
 // handle more than the provided request if it can.
-func (c *Component) dispatchIncomingRequest(request provider.Query) {
+func (c *Component) dispatchIncomingRequest(request provider.BatchQuery) {
 	requestsMap := map[netip.Addr][]uint{
-		request.ExporterIP: {request.IfIndex},
+		request.ExporterIP: slices.Clone(request.IfIndexes),
 	}
 	for c.config.MaxBatchRequests > 0 {
 		select {
 		case request := <-c.dispatcherChannel:
-			indexes, ok := requestsMap[request.ExporterIP]
-			if !ok {
-				indexes = []uint{request.IfIndex}
-			} else {
-				indexes = append(indexes, request.IfIndex)
+			indexes := requestsMap[request.ExporterIP]
+			for _, ifIndex := range request.IfIndexes {
+				if !slices.Contains(indexes, ifIndex) {
+					indexes = append(indexes, ifIndex)
+				}
 			}
 			requestsMap[request.ExporterIP] = indexes
 			// We don't want to exceed the configured limit but also there is no
@@ -279,8 +652,26 @@ func (c *Component) dispatchIncomingRequest(request provider.Query) {
 }
 
 // providerIncomingRequest handles an incoming request to the provider. It
-// uses a breaker to avoid pushing working on non-responsive exporters.
+// uses a breaker to avoid pushing working on non-responsive exporters. When
+// the cache is shared, entries known by other inlets are not polled and an
+// exporter is only polled by one inlet at a time.
 func (c *Component) providerIncomingRequest(request provider.BatchQuery) {
+	// Once done, notify the waiters for interfaces without answer
+	defer func(request provider.BatchQuery) {
+		queries := make([]provider.Query, 0, len(request.IfIndexes))
+		for _, ifIndex := range request.IfIndexes {
+			queries = append(queries, provider.Query{ExporterIP: request.ExporterIP, IfIndex: ifIndex})
+		}
+		c.notifyWaiters(queries...)
+	}(request)
+	if c.shared != nil {
+		request = c.sharedLookup(request)
+		if len(request.IfIndexes) == 0 || !c.sharedLock(request.ExporterIP) {
+			return
+		}
+		defer c.sharedUnlock(request.ExporterIP)
+	}
+
 	// Avoid querying too much exporters with errors
 	c.providerBreakersLock.Lock()
 	providerBreaker, ok := c.providerBreakers[request.ExporterIP]
@@ -291,7 +682,7 @@ func (c *Component) providerIncomingRequest(request provider.BatchQuery) {
 	c.providerBreakersLock.Unlock()
 
 	if err := providerBreaker.Run(func() error {
-		return c.provider.Query(c.t.Context(nil), request)
+		return c.queryProviders(c.t.Context(nil), request)
 	}); err == breaker.ErrBreakerOpen {
 		c.metrics.providerBreakerOpenCount.WithLabelValues(request.ExporterIP.Unmap().String()).Inc()
 		c.providerBreakersLock.Lock()
@@ -308,6 +699,76 @@ func (c *Component) providerIncomingRequest(request provider.BatchQuery) {
 	}
 }
 
+// queryProviders queries the providers handling the exporter in order. When a
+// provider does not answer for some interfaces, the next one is queried for
+// them. An error is returned only when no provider was able to answer.
+func (c *Component) queryProviders(ctx context.Context, request provider.BatchQuery) error {
+	var lastErr error
+	remaining := request.IfIndexes
+	for _, entry := range c.providers {
+		if entry.exporters != nil {
+			if _, ok := entry.exporters.Lookup(request.ExporterIP); !ok {
+				continue
+			}
+		}
+		c.pendingLock.Lock()
+		for _, ifIndex := range remaining {
+			c.pending[provider.Query{ExporterIP: request.ExporterIP, IfIndex: ifIndex}] = struct{}{}
+		}
+		c.pendingLock.Unlock()
+
+		err := entry.provider.Query(ctx, provider.BatchQuery{
+			ExporterIP: request.ExporterIP,
+			IfIndexes:  remaining,
+		})
+		if err != nil {
+			lastErr = err
+		}
+
+		// Keep only the interfaces without answer
+		unanswered := []uint{}
+		c.pendingLock.Lock()
+		for _, ifIndex := range remaining {
+			query := provider.Query{ExporterIP: request.ExporterIP, IfIndex: ifIndex}
+			if _, ok := c.pending[query]; ok {
+				unanswered = append(unanswered, ifIndex)
+				delete(c.pending, query)
+			}
+		}
+		c.pendingLock.Unlock()
+		remaining = unanswered
+		if len(remaining) == 0 {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// refreshExporters refreshes the cached entries of the exporters in the
+// provided subnets. It is called when a provider receives new data for them.
+func (c *Component) refreshExporters(exporterSubnets []netip.Prefix) {
+	count := 0
+	for query := range c.sc.cache.Items() {
+		for _, subnet := range exporterSubnets {
+			if !subnet.Contains(query.ExporterIP) {
+				continue
+			}
+			select {
+			case c.dispatcherChannel <- provider.BatchQuery{
+				ExporterIP: query.ExporterIP,
+				IfIndexes:  []uint{query.IfIndex},
+			}:
+				count++
+			default:
+				c.metrics.providerBusyCount.WithLabelValues(query.ExporterIP.Unmap().String()).Inc()
+			}
+			break
+		}
+	}
+	c.r.Debug().Int("count", count).Msg("refreshed metadata cache for updated exporters")
+	c.metrics.cacheRefresh.Add(float64(count))
+}
+
 // expireCache handles cache expiration and refresh.
 func (c *Component) expireCache() {
 	c.sc.Expire(c.d.Clock.Now().Add(-c.config.CacheDuration))
@@ -319,9 +780,9 @@ func (c *Component) expireCache() {
 		for exporter, ifaces := range toRefresh {
 			for _, ifIndex := range ifaces {
 				select {
-				case c.dispatcherChannel <- provider.Query{
+				case c.dispatcherChannel <- provider.BatchQuery{
 					ExporterIP: exporter,
-					IfIndex:    ifIndex,
+					IfIndexes:  []uint{ifIndex},
 				}:
 					count++
 				default:
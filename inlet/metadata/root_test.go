@@ -51,6 +51,114 @@ func TestLookup(t *testing.T) {
 	})
 }
 
+func TestLookupMany(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	exporter := netip.MustParseAddr("127.0.0.1")
+	answers, found := c.LookupMany(time.Now(), exporter, []uint{765, 999, 765}, 0)
+	if diff := helpers.Diff(found, []bool{false, false, false}); diff != "" {
+		t.Fatalf("LookupMany() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(answers, make([]provider.Answer, 3)); diff != "" {
+		t.Fatalf("LookupMany() (-got, +want):\n%s", diff)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	answer765 := provider.Answer{
+		Exporter:  provider.Exporter{Name: "127_0_0_1"},
+		Interface: provider.Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	}
+	answer999 := provider.Answer{
+		Exporter: provider.Exporter{Name: "127_0_0_1"},
+	}
+	answers, found = c.LookupMany(time.Now(), exporter, []uint{765, 999, 765}, 0)
+	if diff := helpers.Diff(found, []bool{true, true, true}); diff != "" {
+		t.Fatalf("LookupMany() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(answers, []provider.Answer{answer765, answer999, answer765}); diff != "" {
+		t.Fatalf("LookupMany() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	r := reporter.NewMock(t)
+	mockClock := clock.NewMock()
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t), Clock: mockClock})
+	exporter := netip.MustParseAddr("127.0.0.1")
+	notified := make(chan string, 10)
+
+	// Notified once polled
+	c.Notify(exporter, []uint{765, 766}, time.Minute, func() { notified <- "polled" })
+	c.LookupMany(mockClock.Now(), exporter, []uint{765, 766}, 0)
+	select {
+	case got := <-notified:
+		if got != "polled" {
+			t.Fatalf("Notify() got %q, expected %q", got, "polled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Notify() callback not called")
+	}
+
+	// Notified immediately when already in cache
+	c.Notify(exporter, []uint{765}, time.Minute, func() { notified <- "cached" })
+	if got := <-notified; got != "cached" {
+		t.Fatalf("Notify() got %q, expected %q", got, "cached")
+	}
+
+	// Notified after timeout when never polled
+	c.Notify(exporter, []uint{767}, 10*time.Second, func() { notified <- "expired" })
+	mockClock.Add(5 * time.Second)
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case got := <-notified:
+		t.Fatalf("Notify() got %q too early", got)
+	default:
+	}
+	mockClock.Add(10 * time.Second)
+	select {
+	case got := <-notified:
+		if got != "expired" {
+			t.Fatalf("Notify() got %q, expected %q", got, "expired")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Notify() callback not called")
+	}
+	c.waitersLock.Lock()
+	if len(c.waiters) != 0 {
+		t.Errorf("waiters not empty: %v", c.waiters)
+	}
+	c.waitersLock.Unlock()
+}
+
+func TestLookupIPv4Normalization(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	c.Lookup(time.Now(), netip.MustParseAddr("127.0.0.1"), 765)
+	c.Lookup(time.Now(), netip.MustParseAddr("::ffff:127.0.0.1"), 765)
+	time.Sleep(30 * time.Millisecond)
+
+	expected := provider.Answer{
+		Exporter:  provider.Exporter{Name: "127_0_0_1"},
+		Interface: provider.Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	}
+	for _, exporter := range []string{"127.0.0.1", "::ffff:127.0.0.1"} {
+		got, _ := c.Lookup(time.Now(), netip.MustParseAddr(exporter), 765)
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("Lookup(%q) (-got, +want):\n%s", exporter, diff)
+		}
+		if diff := helpers.Diff(c.Interfaces(netip.MustParseAddr(exporter)),
+			map[uint]provider.Answer{765: expected}); diff != "" {
+			t.Fatalf("Interfaces(%q) (-got, +want):\n%s", exporter, diff)
+		}
+	}
+	if size := c.sc.cache.Size(); size != 1 {
+		t.Fatalf("cache size == %d, expected 1", size)
+	}
+	if count := c.Invalidate(netip.MustParseAddr("127.0.0.1")); count != 1 {
+		t.Fatalf("Invalidate() == %d, expected 1", count)
+	}
+}
+
 func TestComponentSaveLoad(t *testing.T) {
 	configuration := DefaultConfiguration()
 	configuration.CachePersistFile = filepath.Join(t.TempDir(), "cache")
@@ -58,6 +166,9 @@ func TestComponentSaveLoad(t *testing.T) {
 	t.Run("save", func(t *testing.T) {
 		r := reporter.NewMock(t)
 		c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+		if !c.warmingUp() {
+			t.Fatal("warmingUp() == false, expected true")
+		}
 
 		expectMockLookup(t, c, "127.0.0.1", 765, provider.Answer{})
 		time.Sleep(30 * time.Millisecond)
@@ -76,6 +187,9 @@ func TestComponentSaveLoad(t *testing.T) {
 	t.Run("load", func(t *testing.T) {
 		r := reporter.NewMock(t)
 		c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+		if c.warmingUp() {
+			t.Fatal("warmingUp() == true, expected false")
+		}
 		expectMockLookup(t, c, "127.0.0.1", 765, provider.Answer{
 			Exporter: provider.Exporter{
 				Name: "127_0_0_1",
@@ -135,12 +249,13 @@ func TestAutoRefresh(t *testing.T) {
 	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_cache_")
 	for _, runs := range []string{"29", "30", "31"} { // 63/2
 		expectedMetrics := map[string]string{
-			`expired_entries_total`: "0",
-			`hits_total`:            "4",
-			`misses_total`:          "1",
-			`size_entries`:          "1",
-			`refresh_runs_total`:    runs,
-			`refreshs`:              "1",
+			`expired_entries_total`:     "0",
+			`invalidated_entries_total`: "0",
+			`hits_total`:                "4",
+			`misses_total`:              "1",
+			`size_entries`:              "1",
+			`refresh_runs_total`:        runs,
+			`refreshs`:                  "1",
 		}
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" && runs == "31" {
 			t.Fatalf("Metrics (-got, +want):\n%s", diff)
@@ -150,13 +265,39 @@ func TestAutoRefresh(t *testing.T) {
 	}
 }
 
+func TestRefreshExporters(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	stale := provider.Answer{Exporter: provider.Exporter{Name: "stale"}}
+	for _, exporter := range []string{"::ffff:127.0.0.1", "::ffff:192.0.2.1"} {
+		c.sc.Put(time.Now(), provider.Query{
+			ExporterIP: netip.MustParseAddr(exporter),
+			IfIndex:    765,
+		}, stale)
+	}
+
+	c.refreshExporters([]netip.Prefix{netip.MustParsePrefix("::ffff:127.0.0.0/104")})
+	time.Sleep(30 * time.Millisecond)
+	expectMockLookup(t, c, "127.0.0.1", 765, provider.Answer{
+		Exporter: provider.Exporter{
+			Name: "127_0_0_1",
+		},
+		Interface: provider.Interface{
+			Name:        "Gi0/0/765",
+			Description: "Interface 765",
+			Speed:       1000,
+		},
+	})
+	expectMockLookup(t, c, "192.0.2.1", 765, stale)
+}
+
 func TestConfigCheck(t *testing.T) {
 	t.Run("refresh", func(t *testing.T) {
 		configuration := DefaultConfiguration()
 		configuration.CacheDuration = 10 * time.Minute
 		configuration.CacheRefresh = 5 * time.Minute
 		configuration.CacheCheckInterval = time.Minute
-		configuration.Provider.Config = mockProviderConfiguration{}
+		configuration.Providers = []ProviderConfiguration{{Config: mockProviderConfiguration{}}}
 		if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
 			t.Fatal("New() should trigger an error")
 		}
@@ -166,7 +307,7 @@ func TestConfigCheck(t *testing.T) {
 		configuration.CacheDuration = 10 * time.Minute
 		configuration.CacheRefresh = 15 * time.Minute
 		configuration.CacheCheckInterval = 12 * time.Minute
-		configuration.Provider.Config = mockProviderConfiguration{}
+		configuration.Providers = []ProviderConfiguration{{Config: mockProviderConfiguration{}}}
 		if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
 			t.Fatal("New() should trigger an error")
 		}
@@ -176,7 +317,7 @@ func TestConfigCheck(t *testing.T) {
 		configuration.CacheDuration = 10 * time.Minute
 		configuration.CacheRefresh = 0
 		configuration.CacheCheckInterval = 2 * time.Minute
-		configuration.Provider.Config = mockProviderConfiguration{}
+		configuration.Providers = []ProviderConfiguration{{Config: mockProviderConfiguration{}}}
 		if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err != nil {
 			t.Fatalf("New() error:\n%+v", err)
 		}
@@ -216,7 +357,7 @@ func TestProviderBreaker(t *testing.T) {
 			r := reporter.NewMock(t)
 			configuration := DefaultConfiguration()
 			configuration.MaxBatchRequests = 0
-			configuration.Provider.Config = tc.ProviderConfiguration
+			configuration.Providers = []ProviderConfiguration{{Config: tc.ProviderConfiguration}}
 			c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
 			c.metrics.providerBreakerOpenCount.WithLabelValues("127.0.0.1").Add(0)
 
@@ -263,7 +404,7 @@ func TestBatching(t *testing.T) {
 	r := reporter.NewMock(t)
 	t.Run("run", func(t *testing.T) {
 		configuration := DefaultConfiguration()
-		configuration.Provider.Config = &bcp
+		configuration.Providers = []ProviderConfiguration{{Config: &bcp}}
 		c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
 
 		// Block dispatcher
@@ -302,3 +443,278 @@ func TestBatching(t *testing.T) {
 		t.Errorf("Accepted requests (-got, +want):\n%s", diff)
 	}
 }
+
+func TestLookupManyBatching(t *testing.T) {
+	bcp := batchProviderConfiguration{
+		received: []provider.BatchQuery{},
+	}
+	r := reporter.NewMock(t)
+	t.Run("run", func(t *testing.T) {
+		configuration := DefaultConfiguration()
+		configuration.Providers = []ProviderConfiguration{{Config: &bcp}}
+		c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+		// Duplicate interfaces should be requested only once
+		c.LookupMany(c.d.Clock.Now(), netip.MustParseAddr("::ffff:127.0.0.1"), []uint{766, 767, 766}, 0)
+		time.Sleep(20 * time.Millisecond)
+	})
+
+	expectedAccepted := []provider.BatchQuery{
+		{
+			ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+			IfIndexes:  []uint{766, 767},
+		},
+	}
+	if diff := helpers.Diff(bcp.received, expectedAccepted); diff != "" {
+		t.Errorf("Accepted requests (-got, +want):\n%s", diff)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	bcp := batchProviderConfiguration{
+		received: []provider.BatchQuery{},
+	}
+	r := reporter.NewMock(t)
+	t.Run("run", func(t *testing.T) {
+		configuration := DefaultConfiguration()
+		configuration.MaxBatchRequests = 2
+		configuration.Providers = []ProviderConfiguration{{Config: &bcp}}
+		c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+		// Block dispatcher
+		blocker := make(chan bool)
+		c.dispatcherBChannel <- blocker
+
+		defer func() {
+			// Unblock
+			time.Sleep(20 * time.Millisecond)
+			close(blocker)
+			time.Sleep(20 * time.Millisecond)
+		}()
+
+		// Queue requests
+		exporter1 := netip.MustParseAddr("::ffff:127.0.0.1")
+		exporter2 := netip.MustParseAddr("::ffff:127.0.0.2")
+		c.LookupMany(c.d.Clock.Now(), exporter1, []uint{766}, 100)
+		c.LookupMany(c.d.Clock.Now(), exporter1, []uint{767}, 1000)
+		c.LookupMany(c.d.Clock.Now(), exporter2, []uint{768, 769}, 5000)
+		c.LookupMany(c.d.Clock.Now(), exporter1, []uint{768}, 10)
+		c.LookupMany(c.d.Clock.Now(), exporter1, []uint{766}, 2000)
+	})
+
+	expectedAccepted := []provider.BatchQuery{
+		{
+			ExporterIP: netip.MustParseAddr("::ffff:127.0.0.2"),
+			IfIndexes:  []uint{768, 769},
+		}, {
+			ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+			IfIndexes:  []uint{766, 767},
+		}, {
+			ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+			IfIndexes:  []uint{768},
+		},
+	}
+	if diff := helpers.Diff(bcp.received, expectedAccepted); diff != "" {
+		t.Errorf("Accepted requests (-got, +want):\n%s", diff)
+	}
+}
+
+type partialProvider struct {
+	name string
+	put  func(provider.Update)
+}
+
+// Query answers only for interfaces with an index lower than 100.
+func (pp partialProvider) Query(_ context.Context, query provider.BatchQuery) error {
+	for _, ifIndex := range query.IfIndexes {
+		if ifIndex >= 100 {
+			continue
+		}
+		pp.put(provider.Update{
+			Query: provider.Query{ExporterIP: query.ExporterIP, IfIndex: ifIndex},
+			Answer: provider.Answer{
+				Exporter:  provider.Exporter{Name: pp.name},
+				Interface: provider.Interface{Name: pp.name},
+			},
+		})
+	}
+	return nil
+}
+
+type partialProviderConfiguration struct {
+	name string
+}
+
+func (ppc partialProviderConfiguration) New(_ *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	return partialProvider{name: ppc.name, put: put}, nil
+}
+
+func TestProviderFallback(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Providers = []ProviderConfiguration{
+		{Config: errorProviderConfiguration{}},
+		{
+			ExporterSubnets: []netip.Prefix{netip.MustParsePrefix("127.0.0.2/32")},
+			Config:          partialProviderConfiguration{name: "partial"},
+		},
+		{Config: mockProviderConfiguration{}},
+	}
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+	expectMockLookup(t, c, "127.0.0.1", 10, provider.Answer{})
+	expectMockLookup(t, c, "127.0.0.2", 10, provider.Answer{})
+	expectMockLookup(t, c, "127.0.0.2", 765, provider.Answer{})
+	time.Sleep(30 * time.Millisecond)
+
+	// 127.0.0.1 is not handled by the partial provider
+	expectMockLookup(t, c, "127.0.0.1", 10, provider.Answer{
+		Exporter:  provider.Exporter{Name: "127_0_0_1"},
+		Interface: provider.Interface{Name: "Gi0/0/10", Description: "Interface 10", Speed: 1000},
+	})
+	// 127.0.0.2 is handled by the partial provider, only for some interfaces
+	expectMockLookup(t, c, "127.0.0.2", 10, provider.Answer{
+		Exporter:  provider.Exporter{Name: "partial"},
+		Interface: provider.Interface{Name: "partial"},
+	})
+	expectMockLookup(t, c, "127.0.0.2", 765, provider.Answer{
+		Exporter:  provider.Exporter{Name: "127_0_0_2"},
+		Interface: provider.Interface{Name: "Gi0/0/765", Description: "Interface 765", Speed: 1000},
+	})
+}
+
+func TestNoProvider(t *testing.T) {
+	configuration := DefaultConfiguration()
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() should trigger an error")
+	}
+}
+
+func TestSharedCacheWithoutRedis(t *testing.T) {
+	configuration := DefaultConfiguration()
+	configuration.SharedCache.Enabled = true
+	configuration.Providers = []ProviderConfiguration{{Config: mockProviderConfiguration{}}}
+	if _, err := New(reporter.NewMock(t), configuration, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() should trigger an error")
+	}
+}
+
+func TestExporterIdentity(t *testing.T) {
+	r := reporter.NewMock(t)
+	c := NewMock(t, r, DefaultConfiguration(), Dependencies{Daemon: daemon.NewMock(t)})
+	addr1 := netip.MustParseAddr("::ffff:192.0.2.1")
+	addr2 := netip.MustParseAddr("::ffff:192.0.2.2")
+
+	c.updateIdentity("", addr1)
+	c.updateIdentity("router1", addr1)
+	c.updateIdentity("router1", addr1)
+	if diff := helpers.Diff(c.ExporterAddresses("router1"), []netip.Addr{addr1}); diff != "" {
+		t.Fatalf("ExporterAddresses() (-got, +want):\n%s", diff)
+	}
+
+	// Renumbering
+	c.updateIdentity("router1", addr2)
+	if diff := helpers.Diff(c.ExporterAddresses("router1"), []netip.Addr{addr2, addr1}); diff != "" {
+		t.Fatalf("ExporterAddresses() (-got, +want):\n%s", diff)
+	}
+	// Back to the previous address
+	c.updateIdentity("router1", addr1)
+	if diff := helpers.Diff(c.ExporterAddresses("router1"), []netip.Addr{addr1, addr2}); diff != "" {
+		t.Fatalf("ExporterAddresses() (-got, +want):\n%s", diff)
+	}
+	if diff := helpers.Diff(c.ExporterAddresses("router2"), []netip.Addr(nil)); diff != "" {
+		t.Fatalf("ExporterAddresses() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_", "exporter_")
+	expectedMetrics := map[string]string{
+		`exporter_new_addresses_total{exporter="router1"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestInterfaceRenumbering(t *testing.T) {
+	r := reporter.NewMock(t)
+	mockClock := clock.NewMock()
+	configuration := DefaultConfiguration()
+	configuration.TrackInterfaceRenumbering = true
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t), Clock: mockClock})
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+	renamed := provider.Update{
+		Query: provider.Query{ExporterIP: exporter, IfIndex: 100},
+		Answer: provider.Answer{
+			Interface: provider.Interface{Name: "Gi0/0/100"},
+		},
+	}
+
+	// Unknown interface
+	c.checkRenumbering(renamed)
+	c.sc.Put(mockClock.Now(), renamed.Query, provider.Answer{
+		Interface: provider.Interface{Name: "Gi0/0/50"},
+	})
+	c.sc.Put(mockClock.Now(), provider.Query{ExporterIP: exporter, IfIndex: 200}, provider.Answer{
+		Interface: provider.Interface{Name: "Gi0/0/200"},
+	})
+	if diff := helpers.Diff(c.InterfaceRenumberings(exporter), []InterfaceRenumbering(nil)); diff != "" {
+		t.Fatalf("InterfaceRenumberings() (-got, +want):\n%s", diff)
+	}
+
+	// Same name
+	mockClock.Add(time.Minute)
+	c.checkRenumbering(provider.Update{
+		Query: provider.Query{ExporterIP: exporter, IfIndex: 200},
+		Answer: provider.Answer{
+			Interface: provider.Interface{Name: "Gi0/0/200"},
+		},
+	})
+	// New name
+	c.checkRenumbering(renamed)
+	expected := []InterfaceRenumbering{{
+		Time:     mockClock.Now(),
+		IfIndex:  100,
+		Previous: "Gi0/0/50",
+		Name:     "Gi0/0/100",
+	}}
+	if diff := helpers.Diff(c.InterfaceRenumberings(netip.MustParseAddr("127.0.0.1")), expected); diff != "" {
+		t.Fatalf("InterfaceRenumberings() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_metadata_", "interface_")
+	expectedMetrics := map[string]string{
+		`interface_renumberings_total{exporter="127.0.0.1"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestBacklogHealthcheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	configuration := DefaultConfiguration()
+	configuration.Workers = 1
+	configuration.Providers = []ProviderConfiguration{{Config: &batchProviderConfiguration{}}}
+	c := NewMock(t, r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+
+	check := func(expected reporter.HealthcheckResult) {
+		t.Helper()
+		got := c.backlogHealthcheck(context.Background())
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("backlogHealthcheck() (-got, +want):\n%s", diff)
+		}
+	}
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckOK, Reason: "backlog below threshold"})
+
+	// Block dispatcher and fill the queue
+	blocker := make(chan bool)
+	c.dispatcherBChannel <- blocker
+	for i := 0; i < 80; i++ {
+		c.dispatcherChannel <- provider.BatchQuery{
+			ExporterIP: netip.MustParseAddr("::ffff:127.0.0.1"),
+			IfIndexes:  []uint{uint(i)},
+		}
+	}
+	check(reporter.HealthcheckResult{Status: reporter.HealthcheckWarning, Reason: "backlog above threshold (80/100)"})
+	close(blocker)
+}
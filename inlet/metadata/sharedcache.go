@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metadata
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"akvorado/inlet/metadata/provider"
+)
+
+// sharedCacheTimeout is the timeout for each request to the shared cache.
+const sharedCacheTimeout = time.Second
+
+// sharedCache is a cache shared between several inlets. Entries are expected
+// to expire by themselves.
+type sharedCache interface {
+	// Get returns the entries found for the provided exporter and interfaces.
+	Get(ctx context.Context, query provider.BatchQuery) (map[uint]provider.Answer, error)
+	// Put stores an entry.
+	Put(ctx context.Context, update provider.Update) error
+	// Lock tries to acquire the right to poll the provided exporter.
+	Lock(ctx context.Context, exporterIP netip.Addr) (bool, error)
+	// Unlock releases the right to poll the provided exporter.
+	Unlock(ctx context.Context, exporterIP netip.Addr) error
+}
+
+// redisSharedCache is a shared cache using Redis.
+type redisSharedCache struct {
+	client       *redis.Client
+	prefix       string
+	ttl          time.Duration
+	lockDuration time.Duration
+}
+
+// newRedisSharedCache creates a new shared cache using the provided Redis
+// client. Entries expire after the provided TTL.
+func newRedisSharedCache(client *redis.Client, config SharedCacheConfiguration, ttl time.Duration) *redisSharedCache {
+	return &redisSharedCache{
+		client:       client,
+		prefix:       config.Prefix,
+		ttl:          ttl,
+		lockDuration: config.LockDuration,
+	}
+}
+
+func (rc *redisSharedCache) entryKey(exporterIP netip.Addr, ifIndex uint) string {
+	return fmt.Sprintf("%sentry:%s:%d", rc.prefix, exporterIP.Unmap(), ifIndex)
+}
+
+func (rc *redisSharedCache) lockKey(exporterIP netip.Addr) string {
+	return fmt.Sprintf("%slock:%s", rc.prefix, exporterIP.Unmap())
+}
+
+// Get returns the entries found for the provided exporter and interfaces.
+func (rc *redisSharedCache) Get(ctx context.Context, query provider.BatchQuery) (map[uint]provider.Answer, error) {
+	keys := make([]string, len(query.IfIndexes))
+	for idx, ifIndex := range query.IfIndexes {
+		keys[idx] = rc.entryKey(query.ExporterIP, ifIndex)
+	}
+	values, err := rc.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get entries from Redis: %w", err)
+	}
+	result := map[uint]provider.Answer{}
+	for idx, value := range values {
+		value, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var answer provider.Answer
+		if err := json.Unmarshal([]byte(value), &answer); err != nil {
+			return nil, fmt.Errorf("cannot decode entry %s: %w", keys[idx], err)
+		}
+		result[query.IfIndexes[idx]] = answer
+	}
+	return result, nil
+}
+
+// Put stores an entry.
+func (rc *redisSharedCache) Put(ctx context.Context, update provider.Update) error {
+	value, err := json.Marshal(update.Answer)
+	if err != nil {
+		return fmt.Errorf("cannot encode entry: %w", err)
+	}
+	key := rc.entryKey(update.ExporterIP, update.IfIndex)
+	if err := rc.client.Set(ctx, key, value, rc.ttl).Err(); err != nil {
+		return fmt.Errorf("cannot store entry in Redis: %w", err)
+	}
+	return nil
+}
+
+// Lock tries to acquire the right to poll the provided exporter.
+func (rc *redisSharedCache) Lock(ctx context.Context, exporterIP netip.Addr) (bool, error) {
+	ok, err := rc.client.SetNX(ctx, rc.lockKey(exporterIP), 1, rc.lockDuration).Result()
+	if err != nil {
+		return false, fmt.Errorf("cannot lock exporter in Redis: %w", err)
+	}
+	return ok, nil
+}
+
+// Unlock releases the right to poll the provided exporter.
+func (rc *redisSharedCache) Unlock(ctx context.Context, exporterIP netip.Addr) error {
+	if err := rc.client.Del(ctx, rc.lockKey(exporterIP)).Err(); err != nil {
+		return fmt.Errorf("cannot unlock exporter in Redis: %w", err)
+	}
+	return nil
+}
+
+// sharedLookup fetches the entries of the provided request from the shared
+// cache. They are added to the local cache and the request for the remaining
+// interfaces is returned.
+func (c *Component) sharedLookup(request provider.BatchQuery) provider.BatchQuery {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), sharedCacheTimeout)
+	defer cancel()
+	answers, err := c.shared.Get(ctx, request)
+	if err != nil {
+		c.sharedCacheError(err)
+		return request
+	}
+	remaining := []uint{}
+	for _, ifIndex := range request.IfIndexes {
+		answer, ok := answers[ifIndex]
+		if !ok {
+			remaining = append(remaining, ifIndex)
+			continue
+		}
+		c.update(provider.Update{
+			Query:  provider.Query{ExporterIP: request.ExporterIP, IfIndex: ifIndex},
+			Answer: answer,
+		})
+	}
+	c.metrics.sharedCacheHits.Add(float64(len(request.IfIndexes) - len(remaining)))
+	c.metrics.sharedCacheMisses.Add(float64(len(remaining)))
+	return provider.BatchQuery{ExporterIP: request.ExporterIP, IfIndexes: remaining}
+}
+
+// sharedLock acquires the right to poll the provided exporter. When another
+// inlet is already polling it, false is returned. On error, polling is
+// allowed.
+func (c *Component) sharedLock(exporterIP netip.Addr) bool {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), sharedCacheTimeout)
+	defer cancel()
+	ok, err := c.shared.Lock(ctx, exporterIP)
+	if err != nil {
+		c.sharedCacheError(err)
+		return true
+	}
+	if !ok {
+		c.metrics.sharedCacheLocked.Inc()
+	}
+	return ok
+}
+
+// sharedUnlock releases the right to poll the provided exporter.
+func (c *Component) sharedUnlock(exporterIP netip.Addr) {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), sharedCacheTimeout)
+	defer cancel()
+	if err := c.shared.Unlock(ctx, exporterIP); err != nil {
+		c.sharedCacheError(err)
+	}
+}
+
+// sharedPut stores the provided update in the shared cache.
+func (c *Component) sharedPut(update provider.Update) {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), sharedCacheTimeout)
+	defer cancel()
+	if err := c.shared.Put(ctx, update); err != nil {
+		c.sharedCacheError(err)
+	}
+}
+
+// sharedCacheError logs and counts an error with the shared cache.
+func (c *Component) sharedCacheError(err error) {
+	c.sharedCacheLogger.Err(err).Msg("error with shared cache")
+	c.metrics.sharedCacheErrors.Inc()
+}
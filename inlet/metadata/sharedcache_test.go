@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metadata
+
+import (
+	"context"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+	"akvorado/inlet/metadata/provider"
+)
+
+// memorySharedCache is an in-memory shared cache for tests.
+type memorySharedCache struct {
+	lock    sync.Mutex
+	entries map[provider.Query]provider.Answer
+	locks   map[netip.Addr]bool
+}
+
+func newMemorySharedCache() *memorySharedCache {
+	return &memorySharedCache{
+		entries: map[provider.Query]provider.Answer{},
+		locks:   map[netip.Addr]bool{},
+	}
+}
+
+func (mc *memorySharedCache) Get(_ context.Context, query provider.BatchQuery) (map[uint]provider.Answer, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	result := map[uint]provider.Answer{}
+	for _, ifIndex := range query.IfIndexes {
+		if answer, ok := mc.entries[provider.Query{ExporterIP: query.ExporterIP, IfIndex: ifIndex}]; ok {
+			result[ifIndex] = answer
+		}
+	}
+	return result, nil
+}
+
+func (mc *memorySharedCache) Put(_ context.Context, update provider.Update) error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	mc.entries[update.Query] = update.Answer
+	return nil
+}
+
+func (mc *memorySharedCache) Lock(_ context.Context, exporterIP netip.Addr) (bool, error) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	if mc.locks[exporterIP] {
+		return false, nil
+	}
+	mc.locks[exporterIP] = true
+	return true, nil
+}
+
+func (mc *memorySharedCache) Unlock(_ context.Context, exporterIP netip.Addr) error {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	delete(mc.locks, exporterIP)
+	return nil
+}
+
+// countingProvider counts the polled interfaces and answers like the mock
+// provider.
+type countingProvider struct {
+	mockProvider
+	polled *int
+}
+
+func (cp countingProvider) Query(ctx context.Context, query provider.BatchQuery) error {
+	*cp.polled += len(query.IfIndexes)
+	return cp.mockProvider.Query(ctx, query)
+}
+
+type countingProviderConfiguration struct {
+	polled *int
+}
+
+func (cpc countingProviderConfiguration) New(_ *reporter.Reporter, put func(provider.Update)) (provider.Provider, error) {
+	return countingProvider{mockProvider: mockProvider{put: put}, polled: cpc.polled}, nil
+}
+
+func TestSharedCache(t *testing.T) {
+	shared := newMemorySharedCache()
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+	newComponent := func(r *reporter.Reporter, polled *int) *Component {
+		configuration := DefaultConfiguration()
+		configuration.Providers = []ProviderConfiguration{
+			{Config: countingProviderConfiguration{polled: polled}},
+		}
+		c, err := New(r, configuration, Dependencies{Daemon: daemon.NewMock(t)})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		c.shared = shared
+		c.sharedCacheLogger = r.Sample(reporter.BurstSampler(time.Minute, 1))
+		return c
+	}
+	r1 := reporter.NewMock(t)
+	r2 := reporter.NewMock(t)
+	var polled1, polled2 int
+	c1 := newComponent(r1, &polled1)
+	c2 := newComponent(r2, &polled2)
+
+	// First inlet polls the exporter
+	c1.providerIncomingRequest(provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{1, 2}})
+	if polled1 != 2 {
+		t.Fatalf("first inlet polled %d interfaces, expected 2", polled1)
+	}
+
+	// Second inlet only polls the missing interface
+	c2.providerIncomingRequest(provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{1, 2, 3}})
+	if polled2 != 1 {
+		t.Fatalf("second inlet polled %d interfaces, expected 1", polled2)
+	}
+	if got := len(c2.Interfaces(exporter)); got != 3 {
+		t.Fatalf("second inlet has %d interfaces, expected 3", got)
+	}
+	if diff := helpers.Diff(c2.Interfaces(exporter)[1], provider.Answer{
+		Exporter:  provider.Exporter{Name: "127_0_0_1"},
+		Interface: provider.Interface{Name: "Gi0/0/1", Description: "Interface 1", Speed: 1000},
+	}); diff != "" {
+		t.Fatalf("Interfaces() (-got, +want):\n%s", diff)
+	}
+
+	// When the exporter is polled by another inlet, skip it
+	shared.Lock(context.Background(), exporter)
+	c1.providerIncomingRequest(provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{3, 4}})
+	if polled1 != 2 {
+		t.Fatalf("first inlet polled %d interfaces, expected 2", polled1)
+	}
+	shared.Unlock(context.Background(), exporter)
+	c1.providerIncomingRequest(provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{4}})
+	if polled1 != 3 {
+		t.Fatalf("first inlet polled %d interfaces, expected 3", polled1)
+	}
+
+	gotMetrics := r1.GetMetrics("akvorado_inlet_metadata_", "shared_cache_")
+	expectedMetrics := map[string]string{
+		`shared_cache_hits_total`:   "1",
+		`shared_cache_misses_total`: "4",
+		`shared_cache_locked_total`: "1",
+		`shared_cache_errors_total`: "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestRedisSharedCache(t *testing.T) {
+	server := helpers.CheckExternalService(t, "Redis",
+		[]string{"redis:6379", "127.0.0.1:6379"})
+	client := redis.NewClient(&redis.Options{
+		Addr: server,
+		DB:   10,
+	})
+	defer client.Close()
+	if err := client.FlushAll(context.Background()).Err(); err != nil {
+		t.Fatalf("FlushAll() error:\n%+v", err)
+	}
+
+	rc := newRedisSharedCache(client, DefaultConfiguration().SharedCache, time.Minute)
+	ctx := context.Background()
+	exporter := netip.MustParseAddr("::ffff:127.0.0.1")
+
+	got, err := rc.Get(ctx, provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{1, 2}})
+	if err != nil {
+		t.Fatalf("Get() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, map[uint]provider.Answer{}); diff != "" {
+		t.Fatalf("Get() (-got, +want):\n%s", diff)
+	}
+	answer := provider.Answer{
+		Exporter: provider.Exporter{Name: "exporter1"},
+		Interface: provider.Interface{
+			Name:       "Gi0/0/1",
+			Speed:      1000,
+			OperStatus: provider.InterfaceStatusUp,
+		},
+	}
+	if err := rc.Put(ctx, provider.Update{
+		Query:  provider.Query{ExporterIP: exporter, IfIndex: 1},
+		Answer: answer,
+	}); err != nil {
+		t.Fatalf("Put() error:\n%+v", err)
+	}
+	got, err = rc.Get(ctx, provider.BatchQuery{ExporterIP: exporter, IfIndexes: []uint{1, 2}})
+	if err != nil {
+		t.Fatalf("Get() error:\n%+v", err)
+	}
+	if diff := helpers.Diff(got, map[uint]provider.Answer{1: answer}); diff != "" {
+		t.Fatalf("Get() (-got, +want):\n%s", diff)
+	}
+	ttl, err := client.TTL(ctx, "akvorado:metadata:entry:127.0.0.1:1").Result()
+	if err != nil {
+		t.Fatalf("TTL() error:\n%+v", err)
+	}
+	if ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("TTL() == %s, expected less than a minute", ttl)
+	}
+
+	// Locking
+	for _, expected := range []bool{true, false} {
+		ok, err := rc.Lock(ctx, exporter)
+		if err != nil {
+			t.Fatalf("Lock() error:\n%+v", err)
+		}
+		if ok != expected {
+			t.Fatalf("Lock() == %v, expected %v", ok, expected)
+		}
+	}
+	if err := rc.Unlock(ctx, exporter); err != nil {
+		t.Fatalf("Unlock() error:\n%+v", err)
+	}
+	if ok, err := rc.Lock(ctx, exporter); err != nil || !ok {
+		t.Fatalf("Lock() == %v, %v, expected true", ok, err)
+	}
+}
@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package metadata
+
+import (
+	"net/netip"
+	"sort"
+
+	"akvorado/inlet/metadata/provider"
+)
+
+// warmingUp tells if the component is warming up: it started with an empty
+// cache less than the configured warm-up duration ago.
+func (c *Component) warmingUp() bool {
+	return !c.warmupUntil.IsZero() && c.d.Clock.Now().Before(c.warmupUntil)
+}
+
+// recordVolume records the traffic volume of a flow for the provided missing
+// interfaces. During warm-up, interfaces are polled by decreasing volume.
+func (c *Component) recordVolume(exporterIP netip.Addr, ifIndexes []uint, volume uint64) {
+	if volume == 0 || !c.warmingUp() {
+		return
+	}
+	c.volumesLock.Lock()
+	defer c.volumesLock.Unlock()
+	if c.volumes == nil {
+		c.volumes = map[provider.Query]uint64{}
+	}
+	for _, ifIndex := range ifIndexes {
+		c.volumes[provider.Query{ExporterIP: exporterIP, IfIndex: ifIndex}] += volume
+	}
+}
+
+// expireVolumes releases the recorded volumes once the warm-up is over.
+func (c *Component) expireVolumes() {
+	if c.warmupUntil.IsZero() || c.warmingUp() {
+		return
+	}
+	c.volumesLock.Lock()
+	c.volumes = nil
+	c.volumesLock.Unlock()
+}
+
+// dispatchWarmupRequests dispatches the provided request and all the requests
+// waiting in the queue to workers. The interfaces with the highest observed
+// volume are sent first, batched with other interfaces of the same exporter.
+// Waiting requests are collected again after each batch to keep the order
+// up-to-date. When batching is disabled, duplicate requests are kept.
+func (c *Component) dispatchWarmupRequests(request provider.BatchQuery) {
+	backlog := []provider.Query{}
+	queued := map[provider.Query]struct{}{}
+	add := func(request provider.BatchQuery) {
+		for _, ifIndex := range request.IfIndexes {
+			query := provider.Query{ExporterIP: request.ExporterIP, IfIndex: ifIndex}
+			if _, ok := queued[query]; ok && c.config.MaxBatchRequests > 0 {
+				continue
+			}
+			queued[query] = struct{}{}
+			backlog = append(backlog, query)
+		}
+	}
+	add(request)
+	batchSize := max(c.config.MaxBatchRequests, 1)
+	for len(backlog) > 0 {
+	collect:
+		for {
+			select {
+			case request := <-c.dispatcherChannel:
+				add(request)
+			case <-c.t.Dying():
+				return
+			default:
+				break collect
+			}
+		}
+
+		// Sort by decreasing volume
+		c.volumesLock.Lock()
+		volumes := make([]uint64, len(backlog))
+		for idx, query := range backlog {
+			volumes[idx] = c.volumes[query]
+		}
+		c.volumesLock.Unlock()
+		order := make([]int, len(backlog))
+		for idx := range order {
+			order[idx] = idx
+		}
+		sort.SliceStable(order, func(i, j int) bool {
+			return volumes[order[i]] > volumes[order[j]]
+		})
+
+		// Batch the first interface with other interfaces of the same exporter
+		exporterIP := backlog[order[0]].ExporterIP
+		ifIndexes := []uint{}
+		remaining := make([]provider.Query, 0, len(backlog))
+		for _, idx := range order {
+			query := backlog[idx]
+			if query.ExporterIP == exporterIP && len(ifIndexes) < batchSize {
+				ifIndexes = append(ifIndexes, query.IfIndex)
+				delete(queued, query)
+				continue
+			}
+			remaining = append(remaining, query)
+		}
+		backlog = remaining
+		if len(ifIndexes) > 1 {
+			c.metrics.providerBatchedCount.Add(float64(len(ifIndexes)))
+		}
+		select {
+		case <-c.t.Dying():
+			return
+		case c.providerChannel <- provider.BatchQuery{ExporterIP: exporterIP, IfIndexes: ifIndexes}:
+		}
+	}
+}
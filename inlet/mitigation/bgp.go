@@ -0,0 +1,132 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"sort"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+
+	"akvorado/inlet/bgpspeaker"
+)
+
+// bgpSync announces the new mitigations and withdraws the stopped ones. The
+// provided map of announced mitigations is updated.
+func (c *Component) bgpSync(session *bgpspeaker.Session, announced map[destination]mitigation) error {
+	c.mitigationsLock.RLock()
+	wanted := make(map[destination]mitigation, len(c.mitigations))
+	for key, m := range c.mitigations {
+		wanted[key] = *m
+	}
+	c.mitigationsLock.RUnlock()
+
+	for _, key := range sortedDestinations(announced) {
+		if _, ok := wanted[key]; ok {
+			continue
+		}
+		if err := session.Withdraw(c.bgpUpdateMessage(announced[key], true)); err != nil {
+			return err
+		}
+		delete(announced, key)
+	}
+	for _, key := range sortedDestinations(wanted) {
+		if _, ok := announced[key]; ok {
+			continue
+		}
+		if err := session.Announce(c.bgpUpdateMessage(wanted[key], false)); err != nil {
+			return err
+		}
+		announced[key] = wanted[key]
+	}
+	return nil
+}
+
+// bgpUpdateMessage builds the UPDATE message to announce or withdraw the
+// provided mitigation.
+func (c *Component) bgpUpdateMessage(m mitigation, withdraw bool) *bgp.BGPMessage {
+	var nlri bgp.AddrPrefixInterface
+	switch {
+	case m.Action == "flowspec" && m.Address.Is4():
+		nlri = bgp.NewFlowSpecIPv4Unicast(flowspecComponents(m,
+			bgp.NewFlowSpecDestinationPrefix(bgp.NewIPAddrPrefix(32, m.Address.String()))))
+	case m.Action == "flowspec":
+		nlri = bgp.NewFlowSpecIPv6Unicast(flowspecComponents(m,
+			bgp.NewFlowSpecDestinationPrefix6(bgp.NewIPv6AddrPrefix(128, m.Address.String()), 0)))
+	case m.Address.Is4():
+		prefix := bgp.NewIPAddrPrefix(32, m.Address.String())
+		if withdraw {
+			return bgp.NewBGPUpdateMessage([]*bgp.IPAddrPrefix{prefix}, []bgp.PathAttributeInterface{}, nil)
+		}
+		attrs := append(c.bgp.CommonAttributes(),
+			bgp.NewPathAttributeNextHop(c.config.Peer.RTBHNextHopIPv4.String()),
+			c.bgpRTBHCommunities())
+		return bgp.NewBGPUpdateMessage(nil, attrs, []*bgp.IPAddrPrefix{prefix})
+	default:
+		nlri = bgp.NewIPv6AddrPrefix(128, m.Address.String())
+	}
+
+	if withdraw {
+		return bgp.NewBGPUpdateMessage(nil, []bgp.PathAttributeInterface{
+			bgp.NewPathAttributeMpUnreachNLRI([]bgp.AddrPrefixInterface{nlri}),
+		}, nil)
+	}
+	attrs := c.bgp.CommonAttributes()
+	if m.Action == "flowspec" {
+		// Flowspec routes have no next hop. The traffic is discarded by
+		// setting the rate to 0.
+		nextHop := "0.0.0.0"
+		if m.Address.Is6() {
+			nextHop = "::"
+		}
+		attrs = append(attrs,
+			bgp.NewPathAttributeMpReachNLRI(nextHop, []bgp.AddrPrefixInterface{nlri}),
+			bgp.NewPathAttributeExtendedCommunities([]bgp.ExtendedCommunityInterface{
+				bgp.NewTrafficRateExtended(0, 0),
+			}))
+	} else {
+		attrs = append(attrs,
+			bgp.NewPathAttributeMpReachNLRI(c.config.Peer.RTBHNextHopIPv6.String(),
+				[]bgp.AddrPrefixInterface{nlri}),
+			c.bgpRTBHCommunities())
+	}
+	return bgp.NewBGPUpdateMessage(nil, attrs, nil)
+}
+
+// bgpRTBHCommunities returns the communities attribute for RTBH
+// announcements.
+func (c *Component) bgpRTBHCommunities() bgp.PathAttributeInterface {
+	communities := make([]uint32, len(c.config.Peer.RTBHCommunities))
+	for idx, community := range c.config.Peer.RTBHCommunities {
+		communities[idx] = uint32(community)
+	}
+	return bgp.NewPathAttributeCommunities(communities)
+}
+
+// flowspecComponents returns the Flowspec components matching the traffic
+// of a mitigation.
+func flowspecComponents(m mitigation, prefix bgp.FlowSpecComponentInterface) []bgp.FlowSpecComponentInterface {
+	components := []bgp.FlowSpecComponentInterface{prefix}
+	if m.Protocol != 0 {
+		components = append(components, bgp.NewFlowSpecComponent(bgp.FLOW_SPEC_TYPE_IP_PROTO,
+			[]*bgp.FlowSpecComponentItem{
+				bgp.NewFlowSpecComponentItem(bgp.DEC_NUM_OP_EQ|bgp.DEC_NUM_OP_END, uint64(m.Protocol)),
+			}))
+	}
+	return components
+}
+
+// sortedDestinations returns the keys of the provided map, sorted.
+func sortedDestinations(m map[destination]mitigation) []destination {
+	keys := make([]destination, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].rule != keys[j].rule {
+			return keys[i].rule < keys[j].rule
+		}
+		return keys[i].addr.Less(keys[j].addr)
+	})
+	return keys
+}
@@ -0,0 +1,181 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+// readBGPMessage reads and decodes a BGP message.
+func readBGPMessage(t *testing.T, conn net.Conn) *bgp.BGPMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, bgp.BGP_HEADER_LENGTH)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(header[16:18]))
+	copy(buf, header)
+	if _, err := io.ReadFull(conn, buf[bgp.BGP_HEADER_LENGTH:]); err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	msg, err := bgp.ParseBGPMessage(buf)
+	if err != nil {
+		t.Fatalf("ParseBGPMessage() error:\n%+v", err)
+	}
+	return msg
+}
+
+// describeUpdate returns a textual description of an UPDATE message.
+func describeUpdate(t *testing.T, msg *bgp.BGPMessage) []string {
+	t.Helper()
+	update, ok := msg.Body.(*bgp.BGPUpdate)
+	if !ok {
+		t.Fatalf("expected UPDATE message, got %T", msg.Body)
+	}
+	description := []string{}
+	for _, prefix := range update.WithdrawnRoutes {
+		description = append(description, "withdraw "+prefix.String())
+	}
+	for _, attr := range update.PathAttributes {
+		description = append(description, attr.String())
+	}
+	for _, prefix := range update.NLRI {
+		description = append(description, "announce "+prefix.String())
+	}
+	return description
+}
+
+func TestBGPExport(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	defer listener.Close()
+
+	r := reporter.NewMock(t)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.Rules = testRules()
+	config.Interval = time.Hour // detection is triggered manually
+	config.Peer.Address = listener.Addr().String()
+	config.Peer.LocalAS = 64496
+	config.Peer.PeerAS = 64497
+	config.Peer.RouterID = netip.MustParseAddr("192.0.2.10")
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpserver.NewMock(t, r),
+		Schema: sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error:\n%+v", err)
+	}
+	defer conn.Close()
+
+	// Session establishment
+	msg := readBGPMessage(t, conn)
+	open, ok := msg.Body.(*bgp.BGPOpen)
+	if !ok {
+		t.Fatalf("expected OPEN message, got %T", msg.Body)
+	}
+	if open.MyAS != 64496 || open.ID.String() != "192.0.2.10" || open.HoldTime != 90 {
+		t.Fatalf("unexpected OPEN message: %+v", open)
+	}
+	for _, msg := range []*bgp.BGPMessage{
+		bgp.NewBGPOpenMessage(64497, 30, "192.0.2.254", []bgp.OptionParameterInterface{}),
+		bgp.NewBGPKeepAliveMessage(),
+	} {
+		buf, _ := msg.Serialize()
+		conn.Write(buf)
+	}
+	msg = readBGPMessage(t, conn)
+	if _, ok := msg.Body.(*bgp.BGPKeepAlive); !ok {
+		t.Fatalf("expected KEEPALIVE message, got %T", msg.Body)
+	}
+
+	// Attacks
+	observe := func(dst string, proto, packets, bytes uint64) {
+		flow := &schema.FlowMessage{
+			SamplingRate: 1000,
+			DstAddr:      netip.MustParseAddr(dst),
+		}
+		sch.ProtobufAppendVarint(flow, schema.ColumnProto, proto)
+		sch.ProtobufAppendVarint(flow, schema.ColumnPackets, packets)
+		sch.ProtobufAppendVarint(flow, schema.ColumnBytes, bytes)
+		c.Observe(flow)
+	}
+	now := time.Now()
+	observe("::ffff:192.0.2.10", 17, 1_000_000, 540_000_000)
+	observe("::ffff:192.0.2.11", 6, 3_960_000, 240_000_000)
+	observe("2001:db8::1", 6, 3_960_000, 240_000_000)
+	c.detect(now)
+
+	for _, expected := range [][]string{
+		{
+			"{Origin: i}",
+			"{AsPath: 64496}",
+			"{MpReach(ipv4-flowspec): {Nexthop: <nil>, NLRIs: [[destination: 192.0.2.10/32][protocol: ==udp]]}}",
+			"{Extcomms: [discard]}",
+		}, {
+			"{Origin: i}",
+			"{AsPath: 64496}",
+			"{Nexthop: 192.0.2.1}",
+			"{Communities: blackhole}",
+			"announce 192.0.2.11/32",
+		}, {
+			"{Origin: i}",
+			"{AsPath: 64496}",
+			"{MpReach(ipv6-unicast): {Nexthop: 100::1, NLRIs: [2001:db8::1/128]}}",
+			"{Communities: blackhole}",
+		},
+	} {
+		got := describeUpdate(t, readBGPMessage(t, conn))
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("UPDATE (-got, +want):\n%s", diff)
+		}
+	}
+
+	// End of attacks
+	c.detect(now.Add(config.Duration))
+	for _, expected := range [][]string{
+		{"{MpUnreach(ipv4-flowspec): {NLRIs: [[destination: 192.0.2.10/32][protocol: ==udp]]}}"},
+		{"withdraw 192.0.2.11/32"},
+		{"{MpUnreach(ipv6-unicast): {NLRIs: [2001:db8::1/128]}}"},
+	} {
+		got := describeUpdate(t, readBGPMessage(t, conn))
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("UPDATE (-got, +want):\n%s", diff)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_mitigation_", "bgp_")
+	expectedMetrics := map[string]string{
+		`bgp_established`:                    "1",
+		`bgp_errors_total`:                   "0",
+		`bgp_updates_total{type="announce"}`: "3",
+		`bgp_updates_total{type="withdraw"}`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,130 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"akvorado/inlet/bgpspeaker"
+)
+
+// Configuration describes the configuration for the mitigation component.
+type Configuration struct {
+	// Rules defines when and how to mitigate an attack. When empty, detection
+	// is disabled.
+	Rules []RuleConfiguration `validate:"dive"`
+	// Interval is the period over which traffic rates are computed.
+	Interval time.Duration `validate:"min=1s"`
+	// Duration is the minimum duration of a mitigation. A mitigation is
+	// withdrawn once traffic stayed below the threshold for this duration.
+	Duration time.Duration `validate:"min=1m"`
+	// MaxMitigations is the maximum number of simultaneous mitigations.
+	MaxMitigations int `validate:"min=1"`
+	// Peer is the BGP peer mitigations are announced to.
+	Peer PeerConfiguration
+	// Exporters is the list of external systems receiving attack events,
+	// like FastNetMon or a scrubbing provider.
+	Exporters []ExporterConfiguration `validate:"dive"`
+	// ExportTimeout is the timeout for each request to an exporter.
+	ExportTimeout time.Duration `validate:"min=1s"`
+	// ExportAttempts is the number of attempts to deliver an event before
+	// giving up.
+	ExportAttempts int `validate:"min=1"`
+}
+
+// RuleConfiguration describes a detection rule.
+type RuleConfiguration struct {
+	// Name is the name of the rule.
+	Name string `validate:"required"`
+	// Networks is the list of protected networks. Each destination address
+	// inside them is checked independently.
+	Networks []netip.Prefix `validate:"min=1"`
+	// Protocol restricts the rule to an IP protocol. 0 matches any protocol.
+	Protocol uint8
+	// PPS is the packet rate above which a destination is mitigated. 0
+	// disables this threshold.
+	PPS uint64 `validate:"required_without=BPS"`
+	// BPS is the bit rate above which a destination is mitigated. 0 disables
+	// this threshold.
+	BPS uint64 `validate:"required_without=PPS"`
+	// Action is how to mitigate the attack: "rtbh" to blackhole the
+	// destination or "flowspec" to discard the matching traffic.
+	Action string `validate:"oneof=rtbh flowspec"`
+}
+
+// PeerConfiguration describes the BGP peer receiving mitigations.
+type PeerConfiguration struct {
+	bgpspeaker.Configuration `mapstructure:",squash" yaml:",inline"`
+	// RTBHNextHopIPv4 is the next hop used for IPv4 RTBH announcements.
+	RTBHNextHopIPv4 netip.Addr
+	// RTBHNextHopIPv6 is the next hop used for IPv6 RTBH announcements.
+	RTBHNextHopIPv6 netip.Addr
+	// RTBHCommunities are the communities attached to RTBH announcements.
+	RTBHCommunities []Community
+}
+
+// ExporterConfiguration describes an external system receiving attack events.
+type ExporterConfiguration struct {
+	// Name is the name of the exporter, used to record acknowledgements.
+	Name string `validate:"required"`
+	// URL is where events are posted.
+	URL string `validate:"required,url"`
+	// Headers are additional HTTP headers sent with each event, for example
+	// for authentication.
+	Headers map[string]string
+}
+
+// DefaultConfiguration represents the default configuration for the
+// mitigation component.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Interval:       10 * time.Second,
+		Duration:       10 * time.Minute,
+		MaxMitigations: 100,
+		ExportTimeout:  10 * time.Second,
+		ExportAttempts: 3,
+		Peer: PeerConfiguration{
+			Configuration:   bgpspeaker.DefaultConfiguration(),
+			RTBHNextHopIPv4: netip.MustParseAddr("192.0.2.1"),
+			RTBHNextHopIPv6: netip.MustParseAddr("100::1"),
+			RTBHCommunities: []Community{Community(65535<<16 + 666)},
+		},
+	}
+}
+
+// Community is a standard community.
+type Community uint32
+
+// UnmarshalText parses a standard community.
+func (comm *Community) UnmarshalText(input []byte) error {
+	elems := strings.Split(string(input), ":")
+	if len(elems) != 2 {
+		return errors.New("community should be ASN:XX")
+	}
+	asn, err := strconv.ParseUint(elems[0], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid ASN in community %q", input)
+	}
+	local, err := strconv.ParseUint(elems[1], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid local value in community %q", input)
+	}
+	*comm = Community(asn<<16 + local)
+	return nil
+}
+
+// MarshalText turns a community to a string.
+func (comm Community) MarshalText() ([]byte, error) {
+	return []byte(comm.String()), nil
+}
+
+// String turns a community to a string.
+func (comm Community) String() string {
+	return fmt.Sprintf("%d:%d", comm>>16, comm&0xffff)
+}
@@ -0,0 +1,184 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
+)
+
+func TestDefaultConfiguration(t *testing.T) {
+	if err := helpers.Validate.Struct(DefaultConfiguration()); err != nil {
+		t.Fatalf("validate.Struct() error:\n%+v", err)
+	}
+}
+
+func TestConfigurationUnmarshallerHook(t *testing.T) {
+	helpers.TestConfigurationDecode(t, helpers.ConfigurationDecodeCases{
+		{
+			Description:   "empty",
+			Initial:       func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} { return gin.H{} },
+			Expected:      DefaultConfiguration(),
+		}, {
+			Description: "rules and peer",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"rules": []gin.H{
+						{
+							"name":     "udp flood",
+							"networks": []string{"192.0.2.0/24", "2001:db8::/64"},
+							"protocol": 17,
+							"bps":      1_000_000_000,
+							"action":   "flowspec",
+						}, {
+							"name":     "flood",
+							"networks": []string{"192.0.2.0/24"},
+							"pps":      1_000_000,
+							"action":   "rtbh",
+						},
+					},
+					"peer": gin.H{
+						"address":          "192.0.2.254:179",
+						"local-as":         64496,
+						"peer-as":          64496,
+						"router-id":        "192.0.2.10",
+						"rtbh-communities": []string{"65535:666", "64496:666"},
+					},
+				}
+			},
+			Expected: func() Configuration {
+				c := DefaultConfiguration()
+				c.Rules = []RuleConfiguration{
+					{
+						Name: "udp flood",
+						Networks: []netip.Prefix{
+							netip.MustParsePrefix("192.0.2.0/24"),
+							netip.MustParsePrefix("2001:db8::/64"),
+						},
+						Protocol: 17,
+						BPS:      1_000_000_000,
+						Action:   "flowspec",
+					}, {
+						Name:     "flood",
+						Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+						PPS:      1_000_000,
+						Action:   "rtbh",
+					},
+				}
+				c.Peer.Address = "192.0.2.254:179"
+				c.Peer.LocalAS = 64496
+				c.Peer.PeerAS = 64496
+				c.Peer.RouterID = netip.MustParseAddr("192.0.2.10")
+				c.Peer.RTBHCommunities = []Community{65535<<16 + 666, 64496<<16 + 666}
+				return c
+			}(),
+		}, {
+			Description: "exporters",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"exporters": []gin.H{
+						{
+							"name": "fastnetmon",
+							"url":  "https://fastnetmon.example.com/api/attacks",
+							"headers": gin.H{
+								"Authorization": "Bearer 7a3b1c6e",
+							},
+						},
+					},
+					"export-attempts": 5,
+				}
+			},
+			Expected: func() Configuration {
+				c := DefaultConfiguration()
+				c.Exporters = []ExporterConfiguration{
+					{
+						Name:    "fastnetmon",
+						URL:     "https://fastnetmon.example.com/api/attacks",
+						Headers: map[string]string{"Authorization": "Bearer 7a3b1c6e"},
+					},
+				}
+				c.ExportAttempts = 5
+				return c
+			}(),
+		}, {
+			Description: "exporter without URL",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"exporters": []gin.H{{"name": "fastnetmon"}},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "rule without threshold",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"rules": []gin.H{
+						{
+							"name":     "flood",
+							"networks": []string{"192.0.2.0/24"},
+							"action":   "rtbh",
+						},
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "rule with unknown action",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"rules": []gin.H{
+						{
+							"name":     "flood",
+							"networks": []string{"192.0.2.0/24"},
+							"pps":      1_000_000,
+							"action":   "drop",
+						},
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "peer without AS",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"peer": gin.H{
+						"address":   "192.0.2.254:179",
+						"router-id": "192.0.2.10",
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "invalid community",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{
+					"peer": gin.H{
+						"rtbh-communities": []string{"65535"},
+					},
+				}
+			},
+			Error: true,
+		}, {
+			Description: "too short interval",
+			Initial:     func() interface{} { return DefaultConfiguration() },
+			Configuration: func() interface{} {
+				return gin.H{"interval": time.Millisecond}
+			},
+			Error: true,
+		},
+	})
+}
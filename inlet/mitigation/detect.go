@@ -0,0 +1,151 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"net/netip"
+	"time"
+
+	"akvorado/common/schema"
+)
+
+// mitigation is an active mitigation.
+type mitigation struct {
+	Rule     string     `json:"rule"`
+	Action   string     `json:"action"`
+	Address  netip.Addr `json:"address"`
+	Protocol uint8      `json:"protocol,omitempty"`
+	PPS      uint64     `json:"pps"` // highest rate seen
+	BPS      uint64     `json:"bps"` // highest rate seen
+	Started  time.Time  `json:"started"`
+	LastSeen time.Time  `json:"last-seen"`
+
+	// Exports is the delivery status of the attack to each exporter
+	Exports map[string]exportStatus `json:"exports,omitempty"`
+}
+
+// Observe accounts the traffic of the provided flow. It should be called
+// before the flow is serialized.
+func (c *Component) Observe(flow *schema.FlowMessage) {
+	if len(c.config.Rules) == 0 || !flow.DstAddr.IsValid() {
+		return
+	}
+	dst := flow.DstAddr.Unmap()
+	var proto, packets, bytes uint64
+	loaded := false
+	for idx, rule := range c.config.Rules {
+		protected := false
+		for _, network := range rule.Networks {
+			if network.Contains(dst) {
+				protected = true
+				break
+			}
+		}
+		if !protected {
+			continue
+		}
+		if !loaded {
+			proto, _ = c.d.Schema.ProtobufVarint(flow, schema.ColumnProto)
+			packets, _ = c.d.Schema.ProtobufVarint(flow, schema.ColumnPackets)
+			bytes, _ = c.d.Schema.ProtobufVarint(flow, schema.ColumnBytes)
+			samplingRate := uint64(max(flow.SamplingRate, 1))
+			packets *= samplingRate
+			bytes *= samplingRate
+			loaded = true
+		}
+		if rule.Protocol != 0 && uint64(rule.Protocol) != proto {
+			continue
+		}
+		key := destination{rule: idx, addr: dst}
+		c.countersLock.Lock()
+		counter, ok := c.counters[key]
+		if !ok {
+			counter = &counters{}
+			c.counters[key] = counter
+		}
+		counter.packets += packets
+		counter.bytes += bytes
+		c.countersLock.Unlock()
+	}
+}
+
+// detect computes the traffic rate of each destination since the last call,
+// starts a mitigation for the ones above the threshold of their rule, and
+// stops the mitigations for destinations which stayed below the threshold
+// long enough.
+func (c *Component) detect(now time.Time) {
+	c.countersLock.Lock()
+	current := c.counters
+	c.counters = make(map[destination]*counters, len(current))
+	c.countersLock.Unlock()
+
+	seconds := c.config.Interval.Seconds()
+	changed := false
+	c.mitigationsLock.Lock()
+	for key, counter := range current {
+		rule := c.config.Rules[key.rule]
+		pps := uint64(float64(counter.packets) / seconds)
+		bps := uint64(float64(counter.bytes*8) / seconds)
+		if !(rule.PPS > 0 && pps > rule.PPS) && !(rule.BPS > 0 && bps > rule.BPS) {
+			continue
+		}
+		if m, ok := c.mitigations[key]; ok {
+			m.LastSeen = now
+			m.PPS = max(m.PPS, pps)
+			m.BPS = max(m.BPS, bps)
+			continue
+		}
+		if len(c.mitigations) >= c.config.MaxMitigations {
+			c.r.Warn().
+				Str("rule", rule.Name).
+				Str("address", key.addr.String()).
+				Msg("too many active mitigations, skip new one")
+			c.metrics.mitigationsSkipped.WithLabelValues(rule.Name).Inc()
+			continue
+		}
+		c.r.Warn().
+			Str("rule", rule.Name).
+			Str("action", rule.Action).
+			Str("address", key.addr.String()).
+			Uint64("pps", pps).
+			Uint64("bps", bps).
+			Msg("start mitigation")
+		m := &mitigation{
+			Rule:     rule.Name,
+			Action:   rule.Action,
+			Address:  key.addr,
+			Protocol: rule.Protocol,
+			PPS:      pps,
+			BPS:      bps,
+			Started:  now,
+			LastSeen: now,
+		}
+		c.mitigations[key] = m
+		c.queueEvent("attack-start", key, m)
+		c.metrics.mitigations.WithLabelValues(rule.Name, rule.Action).Inc()
+		changed = true
+	}
+	for key, m := range c.mitigations {
+		if now.Sub(m.LastSeen) >= c.config.Duration {
+			c.r.Info().
+				Str("rule", m.Rule).
+				Str("action", m.Action).
+				Str("address", m.Address.String()).
+				Msg("stop mitigation")
+			delete(c.mitigations, key)
+			c.queueEvent("attack-stop", key, m)
+			changed = true
+		}
+	}
+	c.metrics.activeMitigations.Set(float64(len(c.mitigations)))
+	c.mitigationsLock.Unlock()
+
+	// Notify the BGP session
+	if changed {
+		select {
+		case c.mitigationsChanged <- struct{}{}:
+		default:
+		}
+	}
+}
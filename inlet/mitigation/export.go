@@ -0,0 +1,141 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// exportStatus is the delivery status of an event to an exporter.
+type exportStatus struct {
+	Status string `json:"status"` // pending, acknowledged, or failed
+	Error  string `json:"error,omitempty"`
+}
+
+// event is an attack event pushed to exporters.
+type event struct {
+	Type string `json:"type"` // attack-start or attack-stop
+	mitigation
+
+	key destination
+}
+
+// queueEvent queues an event for the exporters. It should be called while
+// holding the mitigations lock. When an attack starts, the delivery status
+// is recorded in the mitigation.
+func (c *Component) queueEvent(eventType string, key destination, m *mitigation) {
+	if len(c.config.Exporters) == 0 {
+		return
+	}
+	if eventType == "attack-start" {
+		m.Exports = make(map[string]exportStatus, len(c.config.Exporters))
+		for _, exporter := range c.config.Exporters {
+			m.Exports[exporter.Name] = exportStatus{Status: "pending"}
+		}
+	}
+	e := event{Type: eventType, mitigation: *m, key: key}
+	e.Exports = nil
+	select {
+	case c.events <- e:
+	default:
+		c.r.Warn().
+			Str("rule", m.Rule).
+			Str("address", m.Address.String()).
+			Msg("export queue full, drop event")
+		c.metrics.exportDropped.Inc()
+		for name := range m.Exports {
+			m.Exports[name] = exportStatus{Status: "failed", Error: "export queue full"}
+		}
+	}
+}
+
+// runExport delivers queued events to each exporter.
+func (c *Component) runExport() error {
+	for {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case e := <-c.events:
+			for _, exporter := range c.config.Exporters {
+				err := c.export(exporter, e)
+				status := "acknowledged"
+				if err != nil {
+					status = "failed"
+					c.r.Err(err).
+						Str("exporter", exporter.Name).
+						Str("type", e.Type).
+						Str("address", e.Address.String()).
+						Msg("cannot export event")
+				}
+				c.metrics.exportEvents.WithLabelValues(exporter.Name, status).Inc()
+				if e.Type != "attack-start" {
+					continue
+				}
+				result := exportStatus{Status: status}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				c.mitigationsLock.Lock()
+				if m, ok := c.mitigations[e.key]; ok && m.Started.Equal(e.Started) {
+					m.Exports[exporter.Name] = result
+				}
+				c.mitigationsLock.Unlock()
+			}
+		}
+	}
+}
+
+// export posts an event to an exporter, retrying on errors.
+func (c *Component) export(exporter ExporterConfiguration, e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	var lastErr error
+	for attempt := 0; attempt < c.config.ExportAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-c.t.Dying():
+				return lastErr
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		lastErr = c.post(exporter, body)
+		if lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// post sends an encoded event to an exporter. Any 2xx status code is an
+// acknowledgement.
+func (c *Component) post(exporter ExporterConfiguration, body []byte) error {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.ExportTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, exporter.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("cannot build request: %w", err)
+	}
+	for key, value := range exporter.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
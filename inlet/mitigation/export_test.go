@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestExport(t *testing.T) {
+	var lock sync.Mutex
+	received := []gin.H{}
+	ack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var got gin.H
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("Decode() error:\n%+v", err)
+		}
+		lock.Lock()
+		received = append(received, got)
+		lock.Unlock()
+	}))
+	defer ack.Close()
+	nack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer nack.Close()
+
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.Rules = testRules()
+	config.Interval = time.Hour // detection is triggered manually
+	config.Duration = 90 * time.Minute
+	config.ExportAttempts = 1
+	config.Exporters = []ExporterConfiguration{
+		{
+			Name:    "fastnetmon",
+			URL:     ack.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		}, {
+			Name: "scrubbing",
+			URL:  nack.URL,
+		},
+	}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   h,
+		Schema: sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flow := &schema.FlowMessage{
+		SamplingRate: 1000,
+		DstAddr:      netip.MustParseAddr("2001:db8::1"),
+	}
+	sch.ProtobufAppendVarint(flow, schema.ColumnProto, 6)
+	sch.ProtobufAppendVarint(flow, schema.ColumnPackets, 3_960_000)
+	sch.ProtobufAppendVarint(flow, schema.ColumnBytes, 240_000_000)
+	c.Observe(flow)
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	c.detect(now)
+	c.detect(now.Add(2 * time.Hour))
+	time.Sleep(100 * time.Millisecond)
+
+	lock.Lock()
+	gotReceived := received
+	lock.Unlock()
+	expectedReceived := []gin.H{
+		{
+			"type":      "attack-start",
+			"rule":      "flood",
+			"action":    "rtbh",
+			"address":   "2001:db8::1",
+			"pps":       1.1e6,
+			"bps":       5.33333333e8,
+			"started":   "2024-04-11T08:00:00Z",
+			"last-seen": "2024-04-11T08:00:00Z",
+		}, {
+			"type":      "attack-stop",
+			"rule":      "flood",
+			"action":    "rtbh",
+			"address":   "2001:db8::1",
+			"pps":       1.1e6,
+			"bps":       5.33333333e8,
+			"started":   "2024-04-11T08:00:00Z",
+			"last-seen": "2024-04-11T08:00:00Z",
+		},
+	}
+	if diff := helpers.Diff(gotReceived, expectedReceived); diff != "" {
+		t.Fatalf("Received events (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_mitigation_", "export_")
+	expectedMetrics := map[string]string{
+		`export_events_total{exporter="fastnetmon",status="acknowledged"}`: "2",
+		`export_events_total{exporter="scrubbing",status="failed"}`:        "2",
+		`export_dropped_events_total`:                                      "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestExportStatus(t *testing.T) {
+	ack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ack.Close()
+	nack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer nack.Close()
+
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.Rules = testRules()
+	config.Interval = time.Hour // detection is triggered manually
+	config.ExportAttempts = 1
+	config.Exporters = []ExporterConfiguration{
+		{Name: "fastnetmon", URL: ack.URL},
+		{Name: "scrubbing", URL: nack.URL},
+	}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   h,
+		Schema: sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	flow := &schema.FlowMessage{
+		SamplingRate: 1000,
+		DstAddr:      netip.MustParseAddr("2001:db8::1"),
+	}
+	sch.ProtobufAppendVarint(flow, schema.ColumnProto, 6)
+	sch.ProtobufAppendVarint(flow, schema.ColumnPackets, 3_960_000)
+	sch.ProtobufAppendVarint(flow, schema.ColumnBytes, 240_000_000)
+	c.Observe(flow)
+	c.detect(time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC))
+	time.Sleep(100 * time.Millisecond)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/mitigations",
+			JSONOutput: gin.H{"mitigations": []gin.H{
+				{
+					"rule":      "flood",
+					"action":    "rtbh",
+					"address":   "2001:db8::1",
+					"pps":       1.1e6,
+					"bps":       5.33333333e8,
+					"started":   "2024-04-11T08:00:00Z",
+					"last-seen": "2024-04-11T08:00:00Z",
+					"exports": gin.H{
+						"fastnetmon": gin.H{"status": "acknowledged"},
+						"scrubbing": gin.H{
+							"status": "failed",
+							"error":  "unexpected status code 503",
+						},
+					},
+				},
+			}},
+		},
+	})
+}
+
+func TestDuplicateExporter(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Exporters = []ExporterConfiguration{
+		{Name: "fastnetmon", URL: "http://192.0.2.1/api"},
+		{Name: "fastnetmon", URL: "http://192.0.2.2/api"},
+	}
+	if _, err := New(r, config, Dependencies{Daemon: daemon.NewMock(t)}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
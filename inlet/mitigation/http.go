@@ -0,0 +1,31 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"maps"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mitigationsHandlerFunc lists the active mitigations.
+func (c *Component) mitigationsHandlerFunc(gc *gin.Context) {
+	c.mitigationsLock.RLock()
+	mitigations := make([]mitigation, 0, len(c.mitigations))
+	for _, m := range c.mitigations {
+		copied := *m
+		copied.Exports = maps.Clone(m.Exports)
+		mitigations = append(mitigations, copied)
+	}
+	c.mitigationsLock.RUnlock()
+	sort.Slice(mitigations, func(i, j int) bool {
+		if !mitigations[i].Started.Equal(mitigations[j].Started) {
+			return mitigations[i].Started.Before(mitigations[j].Started)
+		}
+		return mitigations[i].Address.Less(mitigations[j].Address)
+	})
+	gc.JSON(http.StatusOK, gin.H{"mitigations": mitigations})
+}
@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import "akvorado/common/reporter"
+
+type metrics struct {
+	mitigations        *reporter.CounterVec
+	mitigationsSkipped *reporter.CounterVec
+	activeMitigations  reporter.Gauge
+	bgpEstablished     reporter.Gauge
+	bgpErrors          reporter.Counter
+	bgpUpdates         *reporter.CounterVec
+	exportEvents       *reporter.CounterVec
+	exportDropped      reporter.Counter
+}
+
+// initMetrics initialize the metrics for the mitigation component.
+func (c *Component) initMetrics() {
+	c.metrics.mitigations = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mitigations_total",
+			Help: "Number of mitigations started.",
+		},
+		[]string{"rule", "action"},
+	)
+	c.metrics.mitigationsSkipped = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "mitigations_skipped_total",
+			Help: "Number of mitigations skipped because too many are active.",
+		},
+		[]string{"rule"},
+	)
+	c.metrics.activeMitigations = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "active_mitigations",
+			Help: "Number of active mitigations.",
+		},
+	)
+	c.metrics.bgpEstablished = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "bgp_established",
+			Help: "Is the BGP session with the peer established?",
+		},
+	)
+	c.metrics.bgpErrors = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "bgp_errors_total",
+			Help: "Number of errors with the BGP session.",
+		},
+	)
+	c.metrics.bgpUpdates = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "bgp_updates_total",
+			Help: "Number of BGP updates sent to the peer.",
+		},
+		[]string{"type"},
+	)
+	c.metrics.exportEvents = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "export_events_total",
+			Help: "Number of attack events sent to exporters.",
+		},
+		[]string{"exporter", "status"},
+	)
+	c.metrics.exportDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "export_dropped_events_total",
+			Help: "Number of attack events dropped because the export queue is full.",
+		},
+	)
+}
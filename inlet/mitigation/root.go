@@ -0,0 +1,152 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package mitigation detects attacks from the traffic rate of each
+// destination and exports mitigations to a BGP peer, either as RTBH or as
+// Flowspec rules. Attack events can also be pushed to external mitigation
+// systems.
+package mitigation
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+	"akvorado/inlet/bgpspeaker"
+)
+
+// Component represents the mitigation component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	metrics metrics
+	bgp     *bgpspeaker.Speaker
+
+	countersLock sync.Mutex
+	counters     map[destination]*counters
+
+	mitigationsLock    sync.RWMutex
+	mitigations        map[destination]*mitigation
+	mitigationsChanged chan struct{}
+	events             chan event
+}
+
+// Dependencies define the dependencies of the mitigation component.
+type Dependencies struct {
+	Daemon daemon.Component
+	HTTP   *httpserver.Component
+	Schema *schema.Component
+}
+
+// destination is an address checked by a rule.
+type destination struct {
+	rule int
+	addr netip.Addr
+}
+
+// counters are the traffic counters for a destination.
+type counters struct {
+	packets uint64
+	bytes   uint64
+}
+
+// New creates a new mitigation component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	if len(configuration.Rules) > 0 && dependencies.Schema.Privacy() {
+		return nil, errors.New("mitigation cannot be used in privacy mode")
+	}
+	for idx, rule := range configuration.Rules {
+		for idx, network := range rule.Networks {
+			rule.Networks[idx] = network.Masked()
+		}
+		configuration.Rules[idx] = rule
+	}
+	exporters := map[string]bool{}
+	for _, exporter := range configuration.Exporters {
+		if exporters[exporter.Name] {
+			return nil, fmt.Errorf("duplicate exporter %q", exporter.Name)
+		}
+		exporters[exporter.Name] = true
+	}
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+
+		counters:           map[destination]*counters{},
+		mitigations:        map[destination]*mitigation{},
+		mitigationsChanged: make(chan struct{}, 1),
+		events:             make(chan event, 100),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/mitigation")
+	c.initMetrics()
+	var err error
+	c.bgp, err = bgpspeaker.New(r, configuration.Peer.Configuration, bgpspeaker.Metrics{
+		Established: c.metrics.bgpEstablished,
+		Errors:      c.metrics.bgpErrors,
+		Updates:     c.metrics.bgpUpdates,
+	}, bgp.RF_IPv4_UC, bgp.RF_IPv6_UC, bgp.RF_FS_IPv4_UC, bgp.RF_FS_IPv6_UC)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Start starts the mitigation component.
+func (c *Component) Start() error {
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/mitigations", c.mitigationsHandlerFunc)
+	if len(c.config.Rules) == 0 {
+		c.r.Info().Msg("no detection rule, mitigation component disabled")
+		return nil
+	}
+	c.r.Info().Msg("starting mitigation component")
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case now := <-ticker.C:
+				c.detect(now)
+			}
+		}
+	})
+	if c.config.Peer.Address != "" {
+		c.t.Go(func() error {
+			return c.bgp.Run(&c.t, c.mitigationsChanged, func() bgpspeaker.SyncFunc {
+				announced := map[destination]mitigation{}
+				return func(session *bgpspeaker.Session) error {
+					return c.bgpSync(session, announced)
+				}
+			})
+		})
+	}
+	if len(c.config.Exporters) > 0 {
+		c.t.Go(c.runExport)
+	}
+	return nil
+}
+
+// Stop stops the mitigation component.
+func (c *Component) Stop() error {
+	if len(c.config.Rules) == 0 {
+		return nil
+	}
+	defer c.r.Info().Msg("mitigation component stopped")
+	c.r.Info().Msg("stopping mitigation component")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
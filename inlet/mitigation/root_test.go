@@ -0,0 +1,154 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package mitigation
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func testRules() []RuleConfiguration {
+	return []RuleConfiguration{
+		{
+			Name:     "udp flood",
+			Networks: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+			Protocol: 17,
+			BPS:      1_000_000_000,
+			Action:   "flowspec",
+		}, {
+			Name: "flood",
+			Networks: []netip.Prefix{
+				netip.MustParsePrefix("192.0.2.0/24"),
+				netip.MustParsePrefix("2001:db8::/64"),
+			},
+			PPS:    1_000_000,
+			Action: "rtbh",
+		},
+	}
+}
+
+func TestDetection(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.Rules = testRules()
+	config.Interval = time.Hour // detection is triggered manually
+	config.Duration = 90 * time.Minute
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   h,
+		Schema: sch,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	observe := func(dst string, proto, packets, bytes uint64) {
+		flow := &schema.FlowMessage{
+			SamplingRate: 1000,
+			DstAddr:      netip.MustParseAddr(dst),
+		}
+		sch.ProtobufAppendVarint(flow, schema.ColumnProto, proto)
+		sch.ProtobufAppendVarint(flow, schema.ColumnPackets, packets)
+		sch.ProtobufAppendVarint(flow, schema.ColumnBytes, bytes)
+		c.Observe(flow)
+	}
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+
+	// 1.2 Gbps of UDP to 192.0.2.10 over one hour, 1.1 Mpps of TCP to
+	// 2001:db8::1, traffic to an unprotected destination.
+	observe("::ffff:192.0.2.10", 17, 1_000_000, 540_000_000)
+	observe("2001:db8::1", 6, 3_960_000, 240_000_000)
+	observe("2001:db8:1::1", 6, 10_000_000, 240_000_000)
+	c.detect(now)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/mitigations",
+			JSONOutput: gin.H{"mitigations": []gin.H{
+				{
+					"rule":      "udp flood",
+					"action":    "flowspec",
+					"address":   "192.0.2.10",
+					"protocol":  17,
+					"pps":       277777,
+					"bps":       1.2e9,
+					"started":   "2024-04-11T08:00:00Z",
+					"last-seen": "2024-04-11T08:00:00Z",
+				}, {
+					"rule":      "flood",
+					"action":    "rtbh",
+					"address":   "2001:db8::1",
+					"pps":       1.1e6,
+					"bps":       5.33333333e8,
+					"started":   "2024-04-11T08:00:00Z",
+					"last-seen": "2024-04-11T08:00:00Z",
+				},
+			}},
+		},
+	})
+
+	// The attack on 192.0.2.10 continues, the other one stops
+	observe("::ffff:192.0.2.10", 17, 1_000_000, 540_000_000)
+	c.detect(now.Add(time.Hour))
+	c.detect(now.Add(2 * time.Hour))
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/inlet/mitigations",
+			JSONOutput: gin.H{"mitigations": []gin.H{
+				{
+					"rule":      "udp flood",
+					"action":    "flowspec",
+					"address":   "192.0.2.10",
+					"protocol":  17,
+					"pps":       277777,
+					"bps":       1.2e9,
+					"started":   "2024-04-11T08:00:00Z",
+					"last-seen": "2024-04-11T09:00:00Z",
+				},
+			}},
+		},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_mitigation_", "mitigations", "active")
+	expectedMetrics := map[string]string{
+		`active_mitigations`: "1",
+		`mitigations_total{action="flowspec",rule="udp flood"}`: "1",
+		`mitigations_total{action="rtbh",rule="flood"}`:         "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestDetectionPrivacy(t *testing.T) {
+	r := reporter.NewMock(t)
+	schemaConfig := schema.DefaultConfiguration()
+	schemaConfig.Privacy = true
+	sch, err := schema.New(schemaConfig)
+	if err != nil {
+		t.Fatalf("schema.New() error:\n%+v", err)
+	}
+	config := DefaultConfiguration()
+	config.Rules = testRules()
+	if _, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpserver.NewMock(t, r),
+		Schema: sch,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
@@ -0,0 +1,226 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pipeline
+
+import (
+	"runtime/metrics"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"akvorado/common/reporter"
+)
+
+// budgetResumeRatio is the fraction of the budget memory usage should go
+// below before accepting packets again once the budget is exceeded.
+const budgetResumeRatio = 0.9
+
+// budgetSampleInterval is how often memory usage is sampled from the Go
+// runtime.
+const budgetSampleInterval = 100 * time.Millisecond
+
+// Budget is a memory budget for the inlet. Memory usage is sampled from the
+// Go runtime and adjusted between two samples with the size of the buffers
+// reserved by the inputs. When usage goes over the limit, inputs stop
+// reading packets (pause) or drop them after reading them (drop) until
+// usage goes below 90% of the limit. A nil budget admits everything.
+type Budget struct {
+	r     *reporter.Reporter
+	limit uint64
+	pause bool
+	drops *Drops
+
+	sampled    atomic.Uint64 // memory usage when last sampled
+	buffered   atomic.Int64  // bytes currently reserved by inputs
+	atSample   atomic.Int64  // bytes reserved by inputs when last sampled
+	exceeded   atomic.Bool
+	resumeLock sync.Mutex
+	resumeCond *sync.Cond
+
+	// sample returns the current memory usage (replaced in tests)
+	sample func() uint64
+
+	metrics struct {
+		paused reporter.Counter
+	}
+}
+
+// NewBudget creates a new memory budget of the provided size in bytes. When
+// pause is true, inputs stop reading packets when the budget is exceeded.
+// Otherwise, they drop them. A 0 limit disables the budget and nil is
+// returned.
+func NewBudget(r *reporter.Reporter, limit uint64, pause bool) *Budget {
+	if limit == 0 {
+		return nil
+	}
+	b := &Budget{
+		r:      r,
+		limit:  limit,
+		pause:  pause,
+		drops:  NewDrops(r),
+		sample: runtimeMemoryUsage,
+	}
+	b.resumeCond = sync.NewCond(&b.resumeLock)
+	r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "memory_budget_bytes",
+			Help: "Memory budget of the inlet.",
+		}, func() float64 { return float64(b.limit) })
+	r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "memory_budget_usage_bytes",
+			Help: "Estimated memory usage accounted against the memory budget.",
+		}, func() float64 { return float64(b.Usage()) })
+	r.GaugeFunc(
+		reporter.GaugeOpts{
+			Name: "memory_budget_exceeded",
+			Help: "1 when the memory budget is exceeded and packets are shed.",
+		}, func() float64 {
+			if b.exceeded.Load() {
+				return 1
+			}
+			return 0
+		})
+	b.metrics.paused = r.Counter(
+		reporter.CounterOpts{
+			Name: "memory_budget_paused_seconds_total",
+			Help: "Time spent by inputs waiting for memory usage to go below the budget.",
+		})
+	return b
+}
+
+// runtimeMemoryUsage returns the memory mapped by the Go runtime and not
+// released to the operating system. This is the value used by the runtime
+// for its own memory limit.
+func runtimeMemoryUsage() uint64 {
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// Run samples memory usage until the provided channel is closed.
+func (b *Budget) Run(dying <-chan struct{}) {
+	if b == nil {
+		return
+	}
+	ticker := time.NewTicker(budgetSampleInterval)
+	defer ticker.Stop()
+	for {
+		b.Sample()
+		select {
+		case <-dying:
+			// Unblock paused inputs
+			b.resumeLock.Lock()
+			b.exceeded.Store(false)
+			b.resumeLock.Unlock()
+			b.resumeCond.Broadcast()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample samples memory usage from the runtime and updates the state of the
+// budget.
+func (b *Budget) Sample() {
+	b.atSample.Store(b.buffered.Load())
+	b.sampled.Store(b.sample())
+	b.update()
+}
+
+// Usage returns the estimated memory usage.
+func (b *Budget) Usage() uint64 {
+	usage := int64(b.sampled.Load()) + b.buffered.Load() - b.atSample.Load()
+	if usage < 0 {
+		return 0
+	}
+	return uint64(usage)
+}
+
+// Exceeded tells if the budget is currently exceeded.
+func (b *Budget) Exceeded() bool {
+	return b != nil && b.exceeded.Load()
+}
+
+// update updates the exceeded state from the estimated usage.
+func (b *Budget) update() {
+	usage := b.Usage()
+	if b.exceeded.Load() {
+		if float64(usage) < budgetResumeRatio*float64(b.limit) {
+			b.resumeLock.Lock()
+			b.exceeded.Store(false)
+			b.resumeLock.Unlock()
+			b.resumeCond.Broadcast()
+			b.r.Info().Uint64("usage", usage).Msg("memory usage back under budget, accepting packets")
+		}
+	} else if usage > b.limit {
+		b.exceeded.Store(true)
+		b.r.Warn().Uint64("usage", usage).Uint64("budget", b.limit).
+			Msg("memory budget exceeded, shedding packets")
+	}
+}
+
+// Reserve accounts for a buffer of the provided size held by an input.
+func (b *Budget) Reserve(size int) {
+	if b == nil {
+		return
+	}
+	b.buffered.Add(int64(size))
+	if !b.exceeded.Load() {
+		b.update()
+	}
+}
+
+// Release accounts for a buffer previously reserved and now released.
+func (b *Budget) Release(size int) {
+	if b == nil {
+		return
+	}
+	b.buffered.Add(-int64(size))
+}
+
+// Admit tells if an input should read and process a new packet. When the
+// budget is exceeded and the policy is to pause, it blocks until memory
+// usage goes below the budget or the provided channel is closed. When the
+// policy is to drop, it returns false and the input should drop the
+// packet after reading it. The packet is accounted as dropped.
+func (b *Budget) Admit(dying <-chan struct{}) bool {
+	if b == nil || !b.exceeded.Load() {
+		return true
+	}
+	if !b.pause {
+		b.drops.Add(StageMemory, 1)
+		return false
+	}
+	start := time.Now()
+	defer func() {
+		b.metrics.paused.Add(time.Since(start).Seconds())
+	}()
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		// Wake up waiters when dying
+		select {
+		case <-dying:
+			b.resumeLock.Lock()
+			b.resumeCond.Broadcast()
+			b.resumeLock.Unlock()
+		case <-stop:
+		}
+	}()
+	b.resumeLock.Lock()
+	defer b.resumeLock.Unlock()
+	for b.exceeded.Load() {
+		select {
+		case <-dying:
+			return true
+		default:
+		}
+		b.resumeCond.Wait()
+	}
+	return true
+}
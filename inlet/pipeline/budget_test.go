@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestBudgetDisabled(t *testing.T) {
+	r := reporter.NewMock(t)
+	b := NewBudget(r, 0, true)
+	if b != nil {
+		t.Fatal("NewBudget() should return nil when disabled")
+	}
+	b.Reserve(1000)
+	b.Release(1000)
+	if !b.Admit(nil) {
+		t.Fatal("Admit() should admit everything when disabled")
+	}
+	if b.Exceeded() {
+		t.Fatal("Exceeded() should be false when disabled")
+	}
+}
+
+func TestBudgetDrop(t *testing.T) {
+	r := reporter.NewMock(t)
+	var usage uint64 = 500
+	b := NewBudget(r, 1000, false)
+	b.sample = func() uint64 { return usage }
+
+	b.Sample()
+	if !b.Admit(nil) {
+		t.Fatal("Admit() should admit under budget")
+	}
+
+	// Buffers reserved between two samples are accounted
+	b.Reserve(600)
+	if b.Usage() != 1100 {
+		t.Fatalf("Usage() == %d, expected 1100", b.Usage())
+	}
+	if b.Admit(nil) {
+		t.Fatal("Admit() should not admit over budget")
+	}
+	if !b.Exceeded() {
+		t.Fatal("Exceeded() should be true over budget")
+	}
+
+	// Still over 90% of the budget
+	b.Release(600)
+	usage = 950
+	b.Sample()
+	if b.Admit(nil) {
+		t.Fatal("Admit() should not admit over 90% of the budget")
+	}
+
+	// Back under 90%
+	usage = 800
+	b.Sample()
+	if !b.Admit(nil) {
+		t.Fatal("Admit() should admit under 90% of the budget")
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_pipeline_", "memory_", `dropped_flows_total{stage="memory"}`)
+	expectedMetrics := map[string]string{
+		`dropped_flows_total{stage="memory"}`: "2",
+		`memory_budget_bytes`:                 "1000",
+		`memory_budget_exceeded`:              "0",
+		`memory_budget_paused_seconds_total`:  "0",
+		`memory_budget_usage_bytes`:           "800",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestBudgetPause(t *testing.T) {
+	r := reporter.NewMock(t)
+	var usage uint64 = 2000
+	b := NewBudget(r, 1000, true)
+	b.sample = func() uint64 { return usage }
+	b.Sample()
+
+	admitted := make(chan bool)
+	go func() {
+		admitted <- b.Admit(nil)
+	}()
+	select {
+	case <-admitted:
+		t.Fatal("Admit() should block over budget")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	usage = 100
+	b.Sample()
+	select {
+	case ok := <-admitted:
+		if !ok {
+			t.Fatal("Admit() should admit after pause")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Admit() still blocked under budget")
+	}
+
+	// Pause is interrupted when dying
+	usage = 2000
+	b.Sample()
+	dying := make(chan struct{})
+	go func() {
+		admitted <- b.Admit(dying)
+	}()
+	close(dying)
+	select {
+	case <-admitted:
+	case <-time.After(time.Second):
+		t.Fatal("Admit() still blocked after dying")
+	}
+}
@@ -0,0 +1,93 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package pipeline accounts for the flows dropped at each stage of the inlet
+// pipeline. All components share the same metric family, with a stage label,
+// to quickly find where flows are lost.
+package pipeline
+
+import (
+	dto "github.com/prometheus/client_model/go"
+
+	"akvorado/common/reporter"
+)
+
+// Stage is a step of the inlet pipeline where flows may be dropped.
+type Stage string
+
+const (
+	// StageListener is for packets dropped by the kernel or by the
+	// listener because its queues are full. Packets dropped before
+	// decoding are counted as one flow.
+	StageListener Stage = "listener"
+	// StageMemory is for packets dropped because the memory budget of the
+	// inlet is exceeded. Each packet is counted as one flow.
+	StageMemory Stage = "memory"
+	// StageDecode is for packets which cannot be decoded. Each packet is
+	// counted as one flow.
+	StageDecode Stage = "decode"
+	// StageRateLimit is for flows dropped by the rate limiter.
+	StageRateLimit Stage = "rate-limit"
+	// StageMetadataMiss is for flows dropped because interface metadata is
+	// not available yet.
+	StageMetadataMiss Stage = "metadata-miss"
+	// StageEnrichment is for flows dropped during enrichment: missing
+	// interfaces or sampling rate, rejection by a classifier or a plugin.
+	StageEnrichment Stage = "enrichment"
+	// StageQuota is for flows dropped because their tenant is over its hard
+	// quota.
+	StageQuota Stage = "quota"
+	// StageOutput is for flows which cannot be sent to Kafka.
+	StageOutput Stage = "output"
+)
+
+// Stages is the list of all stages, in pipeline order.
+var Stages = []Stage{
+	StageListener,
+	StageMemory,
+	StageDecode,
+	StageRateLimit,
+	StageMetadataMiss,
+	StageEnrichment,
+	StageQuota,
+	StageOutput,
+}
+
+// Drops counts dropped flows for each stage. As metrics are registered once,
+// all instances created from the same reporter share the same counters.
+type Drops struct {
+	counter *reporter.CounterVec
+}
+
+// NewDrops returns a new drop accounting instance.
+func NewDrops(r *reporter.Reporter) *Drops {
+	counter := r.CounterVec(
+		reporter.CounterOpts{
+			Name: "dropped_flows_total",
+			Help: "Number of flows dropped at each stage of the pipeline.",
+		},
+		[]string{"stage"},
+	)
+	for _, stage := range Stages {
+		counter.WithLabelValues(string(stage))
+	}
+	return &Drops{counter: counter}
+}
+
+// Add records dropped flows for the provided stage.
+func (d *Drops) Add(stage Stage, count int) {
+	d.counter.WithLabelValues(string(stage)).Add(float64(count))
+}
+
+// Totals returns the number of dropped flows for each stage since the start.
+func (d *Drops) Totals() map[Stage]uint64 {
+	totals := make(map[Stage]uint64, len(Stages))
+	for _, stage := range Stages {
+		var m dto.Metric
+		if err := d.counter.WithLabelValues(string(stage)).Write(&m); err != nil {
+			continue
+		}
+		totals[stage] = uint64(m.GetCounter().GetValue())
+	}
+	return totals
+}
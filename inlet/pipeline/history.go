@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pipeline
+
+import (
+	"sync"
+	"time"
+)
+
+// History keeps the totals of dropped flows at regular intervals to compute
+// the number of dropped flows over the last minutes.
+type History struct {
+	drops   *Drops
+	size    int
+	lock    sync.Mutex
+	samples []sample // oldest first
+}
+
+type sample struct {
+	time   time.Time
+	totals map[Stage]uint64
+}
+
+// NewHistory creates a new history keeping at most size samples.
+func NewHistory(drops *Drops, size int) *History {
+	return &History{
+		drops:   drops,
+		size:    size,
+		samples: make([]sample, 0, size),
+	}
+}
+
+// Record records the current totals.
+func (h *History) Record(now time.Time) {
+	totals := h.drops.Totals()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.samples) == h.size {
+		h.samples = append(h.samples[:0], h.samples[1:]...)
+	}
+	h.samples = append(h.samples, sample{time: now, totals: totals})
+}
+
+// Since returns the number of flows dropped for each stage since the
+// provided duration. When the history is too short, the oldest sample is
+// used instead.
+func (h *History) Since(now time.Time, period time.Duration) map[Stage]uint64 {
+	current := h.drops.Totals()
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if len(h.samples) == 0 {
+		return current
+	}
+	baseline := h.samples[0]
+	for _, s := range h.samples[1:] {
+		if s.time.After(now.Add(-period)) {
+			break
+		}
+		baseline = s
+	}
+	for stage, value := range current {
+		current[stage] = value - baseline.totals[stage]
+	}
+	return current
+}
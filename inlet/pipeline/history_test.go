@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"akvorado/common/helpers"
+	"akvorado/common/reporter"
+)
+
+func TestHistory(t *testing.T) {
+	r := reporter.NewMock(t)
+	drops := NewDrops(r)
+	history := NewHistory(drops, 3)
+	start := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	zero := map[Stage]uint64{
+		StageListener:     0,
+		StageMemory:       0,
+		StageDecode:       0,
+		StageRateLimit:    0,
+		StageMetadataMiss: 0,
+		StageEnrichment:   0,
+		StageQuota:        0,
+		StageOutput:       0,
+	}
+
+	// Without samples, totals are returned
+	drops.Add(StageDecode, 2)
+	expected := map[Stage]uint64{}
+	for k, v := range zero {
+		expected[k] = v
+	}
+	expected[StageDecode] = 2
+	if diff := helpers.Diff(history.Since(start, time.Minute), expected); diff != "" {
+		t.Fatalf("Since() (-got, +want):\n%s", diff)
+	}
+
+	// One sample per minute
+	history.Record(start) // decode=2
+	drops.Add(StageListener, 10)
+	history.Record(start.Add(time.Minute)) // decode=2, listener=10
+	drops.Add(StageOutput, 5)
+	drops.Add(StageListener, 1)
+	history.Record(start.Add(2 * time.Minute)) // decode=2, listener=11, output=5
+	drops.Add(StageEnrichment, 3)
+	now := start.Add(2*time.Minute + 30*time.Second)
+
+	cases := []struct {
+		Period   time.Duration
+		Expected map[Stage]uint64
+	}{
+		{
+			Period: time.Minute,
+			Expected: map[Stage]uint64{
+				StageListener:   1,
+				StageOutput:     5,
+				StageEnrichment: 3,
+			},
+		}, {
+			Period: 2 * time.Minute,
+			Expected: map[Stage]uint64{
+				StageListener:   11,
+				StageOutput:     5,
+				StageEnrichment: 3,
+			},
+		}, {
+			// Too long, use the oldest sample
+			Period: time.Hour,
+			Expected: map[Stage]uint64{
+				StageListener:   11,
+				StageOutput:     5,
+				StageEnrichment: 3,
+			},
+		},
+	}
+	for _, tc := range cases {
+		expected := map[Stage]uint64{}
+		for k, v := range zero {
+			expected[k] = v
+		}
+		for k, v := range tc.Expected {
+			expected[k] = v
+		}
+		if diff := helpers.Diff(history.Since(now, tc.Period), expected); diff != "" {
+			t.Errorf("Since(%s) (-got, +want):\n%s", tc.Period, diff)
+		}
+	}
+
+	// Oldest sample is evicted
+	history.Record(start.Add(3 * time.Minute))
+	expected = map[Stage]uint64{}
+	for k, v := range zero {
+		expected[k] = v
+	}
+	expected[StageListener] = 1
+	expected[StageOutput] = 5
+	expected[StageEnrichment] = 3
+	if diff := helpers.Diff(history.Since(now, time.Hour), expected); diff != "" {
+		t.Fatalf("Since() (-got, +want):\n%s", diff)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_pipeline_")
+	expectedMetrics := map[string]string{
+		`dropped_flows_total{stage="decode"}`:        "2",
+		`dropped_flows_total{stage="enrichment"}`:    "3",
+		`dropped_flows_total{stage="listener"}`:      "11",
+		`dropped_flows_total{stage="memory"}`:        "0",
+		`dropped_flows_total{stage="metadata-miss"}`: "0",
+		`dropped_flows_total{stage="output"}`:        "5",
+		`dropped_flows_total{stage="quota"}`:         "0",
+		`dropped_flows_total{stage="rate-limit"}`:    "0",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
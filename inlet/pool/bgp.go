@@ -0,0 +1,111 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import (
+	"errors"
+	"net/netip"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+
+	"akvorado/inlet/bgpspeaker"
+)
+
+// bgpSync announces the prefixes when the inlet is in the pool and withdraws
+// them otherwise. announced is updated to reflect the current state.
+func (c *Component) bgpSync(session *bgpspeaker.Session, announced *bool) error {
+	member := c.Member()
+	if member == *announced {
+		return nil
+	}
+	var ipv4, ipv6 []netip.Prefix
+	for _, prefix := range c.config.BGP.Prefixes {
+		if prefix.Addr().Is4() {
+			ipv4 = append(ipv4, prefix)
+		} else {
+			ipv6 = append(ipv6, prefix)
+		}
+	}
+	var msgs []*bgp.BGPMessage
+	if member {
+		local := session.LocalAddr()
+		if len(ipv4) > 0 {
+			nextHop := c.config.BGP.NextHopIPv4
+			if !nextHop.IsValid() && local.Is4() {
+				nextHop = local
+			}
+			if !nextHop.IsValid() {
+				return errors.New("no IPv4 next hop to announce IPv4 prefixes")
+			}
+			msgs = append(msgs, c.bgpAnnounceMessage(ipv4, nextHop))
+		}
+		if len(ipv6) > 0 {
+			nextHop := c.config.BGP.NextHopIPv6
+			if !nextHop.IsValid() && local.Is6() {
+				nextHop = local
+			}
+			if !nextHop.IsValid() {
+				return errors.New("no IPv6 next hop to announce IPv6 prefixes")
+			}
+			msgs = append(msgs, c.bgpAnnounceMessage(ipv6, nextHop))
+		}
+	} else {
+		if len(ipv4) > 0 {
+			msgs = append(msgs, bgpWithdrawMessage(ipv4))
+		}
+		if len(ipv6) > 0 {
+			msgs = append(msgs, bgpWithdrawMessage(ipv6))
+		}
+	}
+	for _, msg := range msgs {
+		send := session.Withdraw
+		if member {
+			send = session.Announce
+		}
+		if err := send(msg); err != nil {
+			return err
+		}
+	}
+	*announced = member
+	return nil
+}
+
+// bgpAnnounceMessage builds the UPDATE message to announce the provided
+// prefixes. They should all be from the same address family.
+func (c *Component) bgpAnnounceMessage(prefixes []netip.Prefix, nextHop netip.Addr) *bgp.BGPMessage {
+	attrs := c.bgp.CommonAttributes()
+	if prefixes[0].Addr().Is4() {
+		nlri := make([]*bgp.IPAddrPrefix, len(prefixes))
+		for idx, prefix := range prefixes {
+			nlri[idx] = bgp.NewIPAddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+		}
+		attrs = append(attrs, bgp.NewPathAttributeNextHop(nextHop.String()))
+		return bgp.NewBGPUpdateMessage(nil, attrs, nlri)
+	}
+	nlri := make([]bgp.AddrPrefixInterface, len(prefixes))
+	for idx, prefix := range prefixes {
+		nlri[idx] = bgp.NewIPv6AddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+	}
+	attrs = append(attrs, bgp.NewPathAttributeMpReachNLRI(nextHop.String(), nlri))
+	return bgp.NewBGPUpdateMessage(nil, attrs, nil)
+}
+
+// bgpWithdrawMessage builds the UPDATE message to withdraw the provided
+// prefixes. They should all be from the same address family.
+func bgpWithdrawMessage(prefixes []netip.Prefix) *bgp.BGPMessage {
+	if prefixes[0].Addr().Is4() {
+		withdrawn := make([]*bgp.IPAddrPrefix, len(prefixes))
+		for idx, prefix := range prefixes {
+			withdrawn[idx] = bgp.NewIPAddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+		}
+		return bgp.NewBGPUpdateMessage(withdrawn, []bgp.PathAttributeInterface{}, nil)
+	}
+	nlri := make([]bgp.AddrPrefixInterface, len(prefixes))
+	for idx, prefix := range prefixes {
+		nlri[idx] = bgp.NewIPv6AddrPrefix(uint8(prefix.Bits()), prefix.Addr().String())
+	}
+	return bgp.NewBGPUpdateMessage(nil, []bgp.PathAttributeInterface{
+		bgp.NewPathAttributeMpUnreachNLRI(nlri),
+	}, nil)
+}
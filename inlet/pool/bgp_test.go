@@ -0,0 +1,162 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+// readBGPMessage reads and decodes a BGP message.
+func readBGPMessage(t *testing.T, conn net.Conn) *bgp.BGPMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	header := make([]byte, bgp.BGP_HEADER_LENGTH)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	buf := make([]byte, binary.BigEndian.Uint16(header[16:18]))
+	copy(buf, header)
+	if _, err := io.ReadFull(conn, buf[bgp.BGP_HEADER_LENGTH:]); err != nil {
+		t.Fatalf("Read() error:\n%+v", err)
+	}
+	msg, err := bgp.ParseBGPMessage(buf)
+	if err != nil {
+		t.Fatalf("ParseBGPMessage() error:\n%+v", err)
+	}
+	return msg
+}
+
+// describeUpdate returns a textual description of an UPDATE message.
+func describeUpdate(t *testing.T, msg *bgp.BGPMessage) []string {
+	t.Helper()
+	update, ok := msg.Body.(*bgp.BGPUpdate)
+	if !ok {
+		t.Fatalf("expected UPDATE message, got %T", msg.Body)
+	}
+	description := []string{}
+	for _, prefix := range update.WithdrawnRoutes {
+		description = append(description, "withdraw "+prefix.String())
+	}
+	for _, attr := range update.PathAttributes {
+		description = append(description, attr.String())
+	}
+	for _, prefix := range update.NLRI {
+		description = append(description, "announce "+prefix.String())
+	}
+	return description
+}
+
+func TestBGPAnnounce(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error:\n%+v", err)
+	}
+	defer listener.Close()
+
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Interval = time.Hour // checks are triggered manually
+	config.Checks = []string{}
+	config.BGP.Address = listener.Addr().String()
+	config.BGP.LocalAS = 64496
+	config.BGP.PeerAS = 64497
+	config.BGP.RouterID = netip.MustParseAddr("192.0.2.10")
+	config.BGP.Prefixes = []netip.Prefix{
+		netip.MustParsePrefix("203.0.113.1/32"),
+		netip.MustParsePrefix("198.51.100.0/24"),
+		netip.MustParsePrefix("2001:db8::1/128"),
+	}
+	config.BGP.NextHopIPv6 = netip.MustParseAddr("2001:db8:1::10")
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpserver.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+	c.update(time.Now(), reporter.MultipleHealthcheckResults{})
+
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatalf("Accept() error:\n%+v", err)
+	}
+	defer conn.Close()
+
+	// Session establishment
+	msg := readBGPMessage(t, conn)
+	open, ok := msg.Body.(*bgp.BGPOpen)
+	if !ok {
+		t.Fatalf("expected OPEN message, got %T", msg.Body)
+	}
+	if open.MyAS != 64496 || open.ID.String() != "192.0.2.10" || open.HoldTime != 90 {
+		t.Fatalf("unexpected OPEN message: %+v", open)
+	}
+	for _, msg := range []*bgp.BGPMessage{
+		bgp.NewBGPOpenMessage(64497, 30, "192.0.2.254", []bgp.OptionParameterInterface{}),
+		bgp.NewBGPKeepAliveMessage(),
+	} {
+		buf, _ := msg.Serialize()
+		conn.Write(buf)
+	}
+	msg = readBGPMessage(t, conn)
+	if _, ok := msg.Body.(*bgp.BGPKeepAlive); !ok {
+		t.Fatalf("expected KEEPALIVE message, got %T", msg.Body)
+	}
+
+	// The inlet is in the pool
+	for _, expected := range [][]string{
+		{
+			"{Origin: i}",
+			"{AsPath: 64496}",
+			"{Nexthop: 127.0.0.1}",
+			"announce 203.0.113.1/32",
+			"announce 198.51.100.0/24",
+		}, {
+			"{Origin: i}",
+			"{AsPath: 64496}",
+			"{MpReach(ipv6-unicast): {Nexthop: 2001:db8:1::10, NLRIs: [2001:db8::1/128]}}",
+		},
+	} {
+		got := describeUpdate(t, readBGPMessage(t, conn))
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("UPDATE (-got, +want):\n%s", diff)
+		}
+	}
+
+	// The inlet leaves the pool
+	c.drain(true)
+	for _, expected := range [][]string{
+		{"withdraw 203.0.113.1/32", "withdraw 198.51.100.0/24"},
+		{"{MpUnreach(ipv6-unicast): {NLRIs: [2001:db8::1/128]}}"},
+	} {
+		got := describeUpdate(t, readBGPMessage(t, conn))
+		if diff := helpers.Diff(got, expected); diff != "" {
+			t.Fatalf("UPDATE (-got, +want):\n%s", diff)
+		}
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_pool_", "bgp_")
+	expectedMetrics := map[string]string{
+		`bgp_established`:                    "1",
+		`bgp_errors_total`:                   "0",
+		`bgp_updates_total{type="announce"}`: "2",
+		`bgp_updates_total{type="withdraw"}`: "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
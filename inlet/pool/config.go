@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import (
+	"net/netip"
+	"time"
+
+	"akvorado/inlet/bgpspeaker"
+)
+
+// Configuration describes the configuration for the pool component.
+type Configuration struct {
+	// Checks is the list of readiness checks which should succeed for the
+	// inlet to stay in the load-balancing pool. When empty, the inlet only
+	// leaves the pool when drained.
+	Checks []string
+	// Interval is the delay between two evaluations of the checks.
+	Interval time.Duration `validate:"min=1s"`
+	// HoldDown is how long the checks should succeed before the inlet
+	// joins the pool again after leaving it.
+	HoldDown time.Duration `validate:"min=0"`
+	// BGP is the BGP peer anycast prefixes are announced to while the inlet
+	// is in the pool.
+	BGP BGPConfiguration
+}
+
+// BGPConfiguration describes the BGP peer receiving anycast prefixes.
+type BGPConfiguration struct {
+	bgpspeaker.Configuration `mapstructure:",squash" yaml:",inline"`
+	// Prefixes is the list of anycast prefixes to announce.
+	Prefixes []netip.Prefix `validate:"required_with=Address"`
+	// NextHopIPv4 is the next hop for IPv4 prefixes. When unset, the local
+	// address of the BGP session is used.
+	NextHopIPv4 netip.Addr
+	// NextHopIPv6 is the next hop for IPv6 prefixes. When unset, the local
+	// address of the BGP session is used.
+	NextHopIPv6 netip.Addr
+}
+
+// DefaultConfiguration represents the default configuration for the pool
+// component.
+func DefaultConfiguration() Configuration {
+	return Configuration{
+		Checks:   []string{"kafka", "flow/backlog"},
+		Interval: 5 * time.Second,
+		HoldDown: 30 * time.Second,
+		BGP: BGPConfiguration{
+			Configuration: bgpspeaker.DefaultConfiguration(),
+		},
+	}
+}
@@ -0,0 +1,37 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// poolHandlerFunc tells if the inlet is in the load-balancing pool. The
+// status code is 503 when it is not, for load balancers only looking at it.
+func (c *Component) poolHandlerFunc(gc *gin.Context) {
+	c.stateLock.RLock()
+	member := c.member
+	reasons := c.currentReasons()
+	c.stateLock.RUnlock()
+	status := http.StatusOK
+	if !member {
+		status = http.StatusServiceUnavailable
+	}
+	gc.JSON(status, gin.H{"member": member, "reasons": reasons})
+}
+
+// drainHandlerFunc removes the inlet from the pool, for example before a
+// maintenance.
+func (c *Component) drainHandlerFunc(gc *gin.Context) {
+	c.drain(true)
+	gc.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
+// undrainHandlerFunc cancels a previous drain.
+func (c *Component) undrainHandlerFunc(gc *gin.Context) {
+	c.drain(false)
+	gc.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
@@ -0,0 +1,50 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import "akvorado/common/reporter"
+
+type metrics struct {
+	member         reporter.Gauge
+	transitions    *reporter.CounterVec
+	bgpEstablished reporter.Gauge
+	bgpErrors      reporter.Counter
+	bgpUpdates     *reporter.CounterVec
+}
+
+// initMetrics initialize the metrics for the pool component.
+func (c *Component) initMetrics() {
+	c.metrics.member = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "member",
+			Help: "1 when the inlet is in the load-balancing pool.",
+		},
+	)
+	c.metrics.transitions = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "transitions_total",
+			Help: "Number of times the inlet joined or left the load-balancing pool.",
+		},
+		[]string{"transition"},
+	)
+	c.metrics.bgpEstablished = c.r.Gauge(
+		reporter.GaugeOpts{
+			Name: "bgp_established",
+			Help: "Is the BGP session with the peer established?",
+		},
+	)
+	c.metrics.bgpErrors = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "bgp_errors_total",
+			Help: "Number of errors with the BGP session.",
+		},
+	)
+	c.metrics.bgpUpdates = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "bgp_updates_total",
+			Help: "Number of BGP updates sent to the peer.",
+		},
+		[]string{"type"},
+	)
+}
@@ -0,0 +1,201 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+// Package pool tells if the inlet should be part of a UDP load-balancing
+// pool, from the result of some readiness checks. This is exposed to load
+// balancers through HTTP and, for anycast deployments, the inlet can
+// announce some prefixes to a BGP peer while it is in the pool.
+package pool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
+	"gopkg.in/tomb.v2"
+
+	"akvorado/common/daemon"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/inlet/bgpspeaker"
+)
+
+// Component represents the pool component.
+type Component struct {
+	r      *reporter.Reporter
+	d      *Dependencies
+	t      tomb.Tomb
+	config Configuration
+
+	metrics metrics
+	bgp     *bgpspeaker.Speaker
+
+	stateLock    sync.RWMutex
+	member       bool
+	drained      bool
+	reasons      []string  // why the checks are failing
+	lastFailure  time.Time // last time the checks failed
+	stateChanged chan struct{}
+}
+
+// Dependencies define the dependencies of the pool component.
+type Dependencies struct {
+	Daemon daemon.Component
+	HTTP   *httpserver.Component
+}
+
+// New creates a new pool component.
+func New(r *reporter.Reporter, configuration Configuration, dependencies Dependencies) (*Component, error) {
+	for idx, prefix := range configuration.BGP.Prefixes {
+		configuration.BGP.Prefixes[idx] = prefix.Masked()
+	}
+	if configuration.BGP.NextHopIPv4.IsValid() && !configuration.BGP.NextHopIPv4.Is4() {
+		return nil, fmt.Errorf("IPv4 next hop %s should be an IPv4 address", configuration.BGP.NextHopIPv4)
+	}
+	if configuration.BGP.NextHopIPv6.IsValid() && !configuration.BGP.NextHopIPv6.Is6() {
+		return nil, fmt.Errorf("IPv6 next hop %s should be an IPv6 address", configuration.BGP.NextHopIPv6)
+	}
+	c := Component{
+		r:      r,
+		d:      &dependencies,
+		config: configuration,
+
+		reasons:      []string{"starting"},
+		stateChanged: make(chan struct{}, 1),
+	}
+	c.d.Daemon.Track(&c.t, "inlet/pool")
+	c.initMetrics()
+	var err error
+	c.bgp, err = bgpspeaker.New(r, configuration.BGP.Configuration, bgpspeaker.Metrics{
+		Established: c.metrics.bgpEstablished,
+		Errors:      c.metrics.bgpErrors,
+		Updates:     c.metrics.bgpUpdates,
+	}, bgp.RF_IPv4_UC, bgp.RF_IPv6_UC)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Start starts the pool component.
+func (c *Component) Start() error {
+	c.r.Info().Msg("starting pool component")
+	c.d.HTTP.GinRouter.GET("/api/v0/inlet/admin/pool", c.poolHandlerFunc)
+	c.d.HTTP.GinRouter.POST("/api/v0/inlet/admin/pool/drain", c.drainHandlerFunc)
+	c.d.HTTP.GinRouter.DELETE("/api/v0/inlet/admin/pool/drain", c.undrainHandlerFunc)
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case now := <-ticker.C:
+				c.check(now)
+			}
+		}
+	})
+	if c.config.BGP.Address != "" {
+		c.t.Go(func() error {
+			return c.bgp.Run(&c.t, c.stateChanged, func() bgpspeaker.SyncFunc {
+				announced := false
+				return func(session *bgpspeaker.Session) error {
+					return c.bgpSync(session, &announced)
+				}
+			})
+		})
+	}
+	return nil
+}
+
+// Stop stops the pool component.
+func (c *Component) Stop() error {
+	defer c.r.Info().Msg("pool component stopped")
+	c.r.Info().Msg("stopping pool component")
+	c.t.Kill(nil)
+	return c.t.Wait()
+}
+
+// check runs the readiness checks and updates the state of the inlet.
+func (c *Component) check(now time.Time) {
+	ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.Interval)
+	defer cancel()
+	c.update(now, c.r.RunHealthchecks(ctx))
+}
+
+// update updates the state of the inlet from the results of the readiness
+// checks. Any status other than OK removes the inlet from the pool.
+func (c *Component) update(now time.Time, results reporter.MultipleHealthcheckResults) {
+	reasons := []string{}
+	for _, name := range c.config.Checks {
+		detail, ok := results.Details[name]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%s: unknown check", name))
+		} else if detail.Status != reporter.HealthcheckOK {
+			reasons = append(reasons, fmt.Sprintf("%s: %s", name, detail.Reason))
+		}
+	}
+
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if len(reasons) > 0 {
+		c.lastFailure = now
+	} else if !c.lastFailure.IsZero() {
+		if remaining := c.lastFailure.Add(c.config.HoldDown).Sub(now); remaining > 0 {
+			reasons = append(reasons, fmt.Sprintf("hold-down for %s", remaining.Round(time.Second)))
+		}
+	}
+	c.reasons = reasons
+	c.updateMembership()
+}
+
+// drain removes the inlet from the pool until undrained, whatever the
+// result of the checks.
+func (c *Component) drain(drained bool) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.drained = drained
+	c.updateMembership()
+}
+
+// updateMembership computes if the inlet is in the pool. It should be called
+// with the state lock held.
+func (c *Component) updateMembership() {
+	member := len(c.reasons) == 0 && !c.drained
+	if member == c.member {
+		return
+	}
+	c.member = member
+	if member {
+		c.r.Info().Msg("inlet joins the load-balancing pool")
+		c.metrics.member.Set(1)
+		c.metrics.transitions.WithLabelValues("join").Inc()
+	} else {
+		c.r.Warn().Strs("reasons", c.currentReasons()).Msg("inlet leaves the load-balancing pool")
+		c.metrics.member.Set(0)
+		c.metrics.transitions.WithLabelValues("leave").Inc()
+	}
+	select {
+	case c.stateChanged <- struct{}{}:
+	default:
+	}
+}
+
+// currentReasons returns why the inlet is not in the pool. It should be
+// called with the state lock held.
+func (c *Component) currentReasons() []string {
+	reasons := append([]string{}, c.reasons...)
+	if c.drained {
+		reasons = append(reasons, "drained")
+	}
+	return reasons
+}
+
+// Member tells if the inlet is in the load-balancing pool.
+func (c *Component) Member() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	return c.member
+}
@@ -0,0 +1,145 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package pool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+)
+
+func TestMembership(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.Interval = time.Hour // checks are triggered manually
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   h,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	results := func(kafka, backlog reporter.HealthcheckStatus) reporter.MultipleHealthcheckResults {
+		return reporter.MultipleHealthcheckResults{
+			Details: map[string]reporter.HealthcheckDetail{
+				"kafka": {HealthcheckResult: reporter.HealthcheckResult{
+					Status: kafka, Reason: "kafka " + kafka.String(),
+				}},
+				"flow/backlog": {HealthcheckResult: reporter.HealthcheckResult{
+					Status: backlog, Reason: "backlog " + backlog.String(),
+				}},
+			},
+		}
+	}
+	expect := func(status int, member bool, reasons []string) {
+		t.Helper()
+		helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+			{
+				URL:        "/api/v0/inlet/admin/pool",
+				StatusCode: status,
+				JSONOutput: gin.H{"member": member, "reasons": reasons},
+			},
+		})
+	}
+
+	now := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+	expect(503, false, []string{"starting"})
+	c.update(now, results(reporter.HealthcheckOK, reporter.HealthcheckOK))
+	expect(200, true, []string{})
+
+	// Kafka is down
+	now = now.Add(5 * time.Second)
+	c.update(now, results(reporter.HealthcheckError, reporter.HealthcheckWarning))
+	expect(503, false, []string{"kafka: kafka error", "flow/backlog: backlog warning"})
+
+	// Back, but hold-down
+	now = now.Add(5 * time.Second)
+	c.update(now, results(reporter.HealthcheckOK, reporter.HealthcheckOK))
+	expect(503, false, []string{"hold-down for 25s"})
+	now = now.Add(25 * time.Second)
+	c.update(now, results(reporter.HealthcheckOK, reporter.HealthcheckOK))
+	expect(200, true, []string{})
+
+	// Unknown check
+	c.update(now, reporter.MultipleHealthcheckResults{})
+	expect(503, false, []string{"kafka: unknown check", "flow/backlog: unknown check"})
+	now = now.Add(time.Minute)
+	c.update(now, results(reporter.HealthcheckOK, reporter.HealthcheckOK))
+
+	// Drain
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "drain",
+			Method:      "POST",
+			URL:         "/api/v0/inlet/admin/pool/drain",
+			JSONOutput:  gin.H{"message": "ok"},
+		},
+	})
+	expect(503, false, []string{"drained"})
+	now = now.Add(time.Minute)
+	c.update(now, results(reporter.HealthcheckOK, reporter.HealthcheckOK))
+	expect(503, false, []string{"drained"})
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "undrain",
+			Method:      "DELETE",
+			URL:         "/api/v0/inlet/admin/pool/drain",
+			JSONOutput:  gin.H{"message": "ok"},
+		},
+	})
+	expect(200, true, []string{})
+
+	gotMetrics := r.GetMetrics("akvorado_inlet_pool_", "member", "transitions_total")
+	expectedMetrics := map[string]string{
+		`member`:                                "1",
+		`transitions_total{transition="join"}`:  "4",
+		`transitions_total{transition="leave"}`: "3",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	config := DefaultConfiguration()
+	config.Interval = time.Hour
+	config.Checks = []string{"test"}
+	c, err := New(r, config, Dependencies{
+		Daemon: daemon.NewMock(t),
+		HTTP:   httpserver.NewMock(t, r),
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	status := reporter.HealthcheckOK
+	r.RegisterReadinessCheck("test", func(_ context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{Status: status, Reason: "test"}
+	})
+	// Other checks are ignored
+	r.RegisterReadinessCheck("other", func(_ context.Context) reporter.HealthcheckResult {
+		return reporter.HealthcheckResult{Status: reporter.HealthcheckError, Reason: "other"}
+	})
+	c.check(time.Now())
+	if !c.Member() {
+		t.Fatal("Member() should be true")
+	}
+	status = reporter.HealthcheckWarning
+	c.check(time.Now())
+	if c.Member() {
+		t.Fatal("Member() should be false")
+	}
+}
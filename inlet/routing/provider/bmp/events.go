@@ -11,6 +11,7 @@ import (
 
 	"github.com/osrg/gobgp/v3/pkg/packet/bgp"
 	"github.com/osrg/gobgp/v3/pkg/packet/bmp"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 // peerKey is the key used to identify a peer
@@ -92,6 +93,9 @@ func (p *Provider) addPeer(pkey peerKey) *peerInfo {
 		reference: p.lastPeerReference,
 	}
 	p.peers[pkey] = pinfo
+	p.metrics.peerUp.WithLabelValues(
+		pkey.exporter.Addr().Unmap().String(),
+		pkey.ip.Unmap().String()).Set(1)
 	return pinfo
 }
 
@@ -100,6 +104,11 @@ func (p *Provider) removePeer(pkey peerKey, reason string) {
 	exporterStr := pkey.exporter.Addr().Unmap().String()
 	peerStr := pkey.ip.Unmap().String()
 	p.r.Info().Msgf("remove peer %s for exporter %s (reason: %s)", peerStr, exporterStr, reason)
+	p.metrics.peerUp.WithLabelValues(exporterStr, peerStr).Set(0)
+	p.metrics.peerStatistics.DeletePartialMatch(prometheus.Labels{
+		"exporter": exporterStr,
+		"peer":     peerStr,
+	})
 	select {
 	case p.peerRemovalChan <- pkey:
 		return
@@ -221,6 +230,56 @@ func (p *Provider) handlePeerUpNotification(pkey peerKey, body *bmp.BMPPeerUpNot
 		Msgf("new peer %s from exporter %s", peerStr, exporterStr)
 }
 
+// statisticsTypes maps the BMP statistics types we know to a name.
+var statisticsTypes = map[uint16]string{
+	bmp.BMP_STAT_TYPE_REJECTED:                            "rejected",
+	bmp.BMP_STAT_TYPE_DUPLICATE_PREFIX:                    "duplicate-prefix",
+	bmp.BMP_STAT_TYPE_DUPLICATE_WITHDRAW:                  "duplicate-withdraw",
+	bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_CLUSTER_LIST_LOOP: "invalid-cluster-list-loop",
+	bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_PATH_LOOP:      "invalid-as-path-loop",
+	bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_ORIGINATOR_ID:     "invalid-originator-id",
+	bmp.BMP_STAT_TYPE_INV_UPDATE_DUE_TO_AS_CONFED_LOOP:    "invalid-as-confed-loop",
+	bmp.BMP_STAT_TYPE_ADJ_RIB_IN:                          "adj-rib-in",
+	bmp.BMP_STAT_TYPE_LOC_RIB:                             "loc-rib",
+	bmp.BMP_STAT_TYPE_WITHDRAW_UPDATE:                     "withdraw-update",
+	bmp.BMP_STAT_TYPE_WITHDRAW_PREFIX:                     "withdraw-prefix",
+	bmp.BMP_STAT_TYPE_DUPLICATE_UPDATE:                    "duplicate-update",
+	bmp.BMP_STAT_TYPE_ADJ_RIB_OUT_PRE_POLICY:              "adj-rib-out-pre-policy",
+	bmp.BMP_STAT_TYPE_ADJ_RIB_OUT_POST_POLICY:             "adj-rib-out-post-policy",
+}
+
+// handleStatisticsReport handles a statistics report by exporting the
+// statistics as metrics. Per-AFI/SAFI statistics are ignored.
+func (p *Provider) handleStatisticsReport(pkey peerKey, body *bmp.BMPStatisticsReport) {
+	p.mu.RLock()
+	_, ok := p.peers[pkey]
+	p.mu.RUnlock()
+	if !ok {
+		return
+	}
+	exporterStr := pkey.exporter.Addr().Unmap().String()
+	peerStr := pkey.ip.Unmap().String()
+	for _, stat := range body.Stats {
+		var (
+			statType uint16
+			value    float64
+		)
+		switch stat := stat.(type) {
+		case *bmp.BMPStatsTLV32:
+			statType, value = stat.Type, float64(stat.Value)
+		case *bmp.BMPStatsTLV64:
+			statType, value = stat.Type, float64(stat.Value)
+		default:
+			continue
+		}
+		name, ok := statisticsTypes[statType]
+		if !ok {
+			continue
+		}
+		p.metrics.peerStatistics.WithLabelValues(exporterStr, peerStr, name).Set(value)
+	}
+}
+
 func (p *Provider) handleRouteMonitoring(pkey peerKey, body *bmp.BMPRouteMonitoring) {
 	// We expect to have a BGP update message
 	if body.BGPUpdate == nil || body.BGPUpdate.Body == nil {
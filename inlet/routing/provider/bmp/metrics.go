@@ -19,6 +19,8 @@ type metrics struct {
 	peerRemovalDone      *reporter.CounterVec
 	peerRemovalPartial   *reporter.CounterVec
 	peerRemovalQueueFull *reporter.CounterVec
+	peerUp               *reporter.GaugeVec
+	peerStatistics       *reporter.GaugeVec
 }
 
 // initMetrics initialize the metrics for the BMP component.
@@ -115,4 +117,18 @@ func (p *Provider) initMetrics() {
 		},
 		[]string{"exporter"},
 	)
+	p.metrics.peerUp = p.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "peer_up",
+			Help: "Whether a peer is up (1) or down (0).",
+		},
+		[]string{"exporter", "peer"},
+	)
+	p.metrics.peerStatistics = p.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "peer_statistics",
+			Help: "Last value of the statistics reported by the exporter for a peer.",
+		},
+		[]string{"exporter", "peer", "type"},
+	)
 }
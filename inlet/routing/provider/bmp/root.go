@@ -108,11 +108,33 @@ func (p *Provider) Start() error {
 
 // Stop stops the BMP provider.
 func (p *Provider) Stop() error {
-	defer func() {
-		close(p.peerRemovalChan)
-		p.r.Info().Msg("BMP component stopped")
-	}()
+	defer close(p.peerRemovalChan)
+	return p.stop()
+}
+
+// stop stops the BMP provider without closing the peer removal queue.
+func (p *Provider) stop() error {
+	defer p.r.Info().Msg("BMP component stopped")
 	p.r.Info().Msg("stopping BMP component")
 	p.t.Kill(nil)
 	return p.t.Wait()
 }
+
+// Restart stops and starts the BMP provider again. Connections from exporters
+// are closed and their peers are handled as if the exporters disconnected:
+// routes are kept until they reconnect or until the configured duration.
+func (p *Provider) Restart() error {
+	p.r.Info().Msg("restarting BMP provider")
+	return p.d.Daemon.Restart(&p.t, p.stop, func() error {
+		p.mu.Lock()
+		until := p.d.Clock.Now().Add(p.config.Keep)
+		for _, pinfo := range p.peers {
+			if pinfo.staleUntil.IsZero() {
+				pinfo.staleUntil = until
+			}
+		}
+		p.scheduleStalePeersRemoval()
+		p.mu.Unlock()
+		return p.Start()
+	})
+}
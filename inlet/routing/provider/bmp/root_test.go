@@ -98,7 +98,7 @@ func TestBMP(t *testing.T) {
 
 		send(t, conn, "bmp-terminate.pcap")
 		time.Sleep(30 * time.Millisecond)
-		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics = map[string]string{
 			`closed_connections_total{exporter="127.0.0.1"}`:                   "1",
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:  "1",
@@ -123,7 +123,7 @@ func TestBMP(t *testing.T) {
 		mockClock.Add(2 * time.Hour)
 		for tries := 20; tries >= 0; tries-- {
 			time.Sleep(5 * time.Millisecond)
-			gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+			gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 			expectedMetrics = map[string]string{
 				`closed_connections_total{exporter="127.0.0.1"}`:                   "1",
 				`received_messages_total{exporter="127.0.0.1",type="initiation"}`:  "1",
@@ -152,7 +152,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-peers-up.pcap")
 		send(t, conn, "bmp-eor.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -180,7 +180,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-reach.pcap")
 		send(t, conn, "bmp-reach-addpath.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -238,7 +238,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-init.pcap")
 		send(t, conn, "bmp-reach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			// Same metrics as previously, except the AddPath peer.
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:       "1",
@@ -264,7 +264,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-peers-up.pcap")
 		send(t, conn, "bmp-eor.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -292,7 +292,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-reach.pcap")
 		send(t, conn, "bmp-peer-down.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:             "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`:   "4",
@@ -307,6 +307,24 @@ func TestBMP(t *testing.T) {
 		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 			t.Errorf("Metrics (-got, +want):\n%s", diff)
 		}
+		// Statistics of the peer down are removed
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_peer_", "up",
+			`statistics{exporter="127.0.0.1",peer="192.0.2.1",type="rejected"}`,
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="rejected"}`,
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="invalid-as-path-loop"}`,
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="adj-rib-in"}`)
+		expectedMetrics = map[string]string{
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="adj-rib-in"}`:           "0",
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="invalid-as-path-loop"}`: "2",
+			`statistics{exporter="127.0.0.1",peer="192.0.2.5",type="rejected"}`:             "1",
+			`up{exporter="127.0.0.1",peer="192.0.2.1"}`:                                     "0",
+			`up{exporter="127.0.0.1",peer="192.0.2.5"}`:                                     "1",
+			`up{exporter="127.0.0.1",peer="2001:db8::3"}`:                                   "1",
+			`up{exporter="127.0.0.1",peer="2001:db8::7"}`:                                   "1",
+		}
+		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+			t.Errorf("Metrics (-got, +want):\n%s", diff)
+		}
 
 		expectedRIB := map[netip.Addr][]string{
 			netip.MustParseAddr("2001:db8::3"): {
@@ -348,7 +366,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-eor.pcap")
 		send(t, conn, "bmp-reach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -387,7 +405,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-eor.pcap")
 		send(t, conn, "bmp-reach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -440,7 +458,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-reach.pcap")
 		send(t, conn, "bmp-unreach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -471,7 +489,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-init.pcap")
 		send(t, conn, "bmp-l3vpn.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "1",
@@ -617,7 +635,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-eor.pcap")
 		send(t, conn, "bmp-unreach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -650,7 +668,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-unreach.pcap")
 		send(t, conn, "bmp-unreach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -690,7 +708,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-unreach.pcap")
 		send(t, conn, "bmp-unreach.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -720,7 +738,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-reach.pcap")
 		send(t, conn, "bmp-eor.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "4",
@@ -779,7 +797,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-l3vpn.pcap")
 		conn.Close()
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "1",
@@ -807,7 +825,7 @@ func TestBMP(t *testing.T) {
 
 		mockClock.Add(2 * time.Hour)
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics = map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "1",
@@ -841,7 +859,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-l3vpn.pcap")
 		send(t, conn, "bmp-reach-unknown-family.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		ignoredMetric := `ignored_updates_total{error="unknown route family. AFI: 57, SAFI: 65",exporter="127.0.0.1",reason="afi-safi"}`
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
@@ -880,7 +898,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn, "bmp-l3vpn.pcap")
 		send(t, conn, "bmp-reach-vpls.pcap")
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "1",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "1",
@@ -913,7 +931,7 @@ func TestBMP(t *testing.T) {
 		send(t, conn2, "bmp-l3vpn.pcap")
 		conn1.Close()
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics := map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "2",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "2",
@@ -943,7 +961,7 @@ func TestBMP(t *testing.T) {
 
 		mockClock.Add(2 * time.Hour)
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics = map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "2",
 			`received_messages_total{exporter="127.0.0.1",type="peer-up-notification"}`: "2",
@@ -972,7 +990,7 @@ func TestBMP(t *testing.T) {
 
 		send(t, conn2, "bmp-terminate.pcap")
 		time.Sleep(30 * time.Millisecond)
-		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics = map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "2",
 			`received_messages_total{exporter="127.0.0.1",type="termination"}`:          "1",
@@ -995,7 +1013,7 @@ func TestBMP(t *testing.T) {
 
 		mockClock.Add(2 * time.Hour)
 		time.Sleep(20 * time.Millisecond)
-		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+		gotMetrics = r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 		expectedMetrics = map[string]string{
 			`received_messages_total{exporter="127.0.0.1",type="initiation"}`:           "2",
 			`received_messages_total{exporter="127.0.0.1",type="termination"}`:          "1",
@@ -1038,7 +1056,7 @@ func TestBMP(t *testing.T) {
 		mockClock.Add(2 * time.Hour)
 		for tries := 20; tries >= 0; tries-- {
 			time.Sleep(5 * time.Millisecond)
-			gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration")
+			gotMetrics := r.GetMetrics("akvorado_inlet_routing_provider_bmp_", "-locked_duration", "-peer_")
 			// For removed_partial_peers_total, we have 18 routes, but only 14 routes
 			// can be removed while keeping 1 route on each peer. 14 is the max, but
 			// we rely on good-willing from the scheduler to get this number.
@@ -1139,4 +1157,36 @@ func TestBMP(t *testing.T) {
 			t.Errorf("Lookup() == %d, expected 0", lookup.ASN)
 		}
 	})
+
+	t.Run("restart", func(t *testing.T) {
+		r := reporter.NewMock(t)
+		config := DefaultConfiguration()
+		p, mockClock := NewMock(t, r, config)
+		helpers.StartStop(t, p)
+		p.PopulateRIB(t)
+
+		if err := p.Restart(); err != nil {
+			t.Fatalf("Restart() error:\n%+v", err)
+		}
+		// Still listening
+		conn := dial(t, p)
+		send(t, conn, "bmp-init.pcap")
+		time.Sleep(20 * time.Millisecond)
+
+		// Routes are kept until the peer is stale
+		lookup, _ := p.Lookup(context.Background(),
+			netip.MustParseAddr("::ffff:192.0.2.2"),
+			netip.MustParseAddr("::ffff:198.51.100.200"), netip.Addr{})
+		if lookup.ASN != 174 {
+			t.Errorf("Lookup() == %d, expected 174", lookup.ASN)
+		}
+		mockClock.Add(2 * time.Hour)
+		time.Sleep(20 * time.Millisecond)
+		lookup, _ = p.Lookup(context.Background(),
+			netip.MustParseAddr("::ffff:192.0.2.2"),
+			netip.MustParseAddr("::ffff:198.51.100.200"), netip.Addr{})
+		if lookup.ASN != 0 {
+			t.Errorf("Lookup() == %d, expected 0", lookup.ASN)
+		}
+	})
 }
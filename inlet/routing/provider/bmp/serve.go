@@ -82,7 +82,7 @@ func (p *Provider) serveConnection(conn *net.TCPConn) error {
 			msg.Body = &bmp.BMPRouteMonitoring{}
 			p.metrics.messages.WithLabelValues(exporterStr, "route-monitoring").Inc()
 		case bmp.BMP_MSG_STATISTICS_REPORT:
-			// Ignore
+			msg.Body = &bmp.BMPStatisticsReport{}
 			p.metrics.messages.WithLabelValues(exporterStr, "statistics-report").Inc()
 		case bmp.BMP_MSG_PEER_DOWN_NOTIFICATION:
 			msg.Body = &bmp.BMPPeerDownNotification{}
@@ -206,6 +206,8 @@ func (p *Provider) serveConnection(conn *net.TCPConn) error {
 			p.handlePeerDownNotification(pkey)
 		case *bmp.BMPRouteMonitoring:
 			p.handleRouteMonitoring(pkey, body)
+		case *bmp.BMPStatisticsReport:
+			p.handleStatisticsReport(pkey, body)
 		}
 	}
 }
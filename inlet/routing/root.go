@@ -8,6 +8,7 @@ package routing
 
 import (
 	"context"
+	"errors"
 	"net/netip"
 	"time"
 
@@ -67,12 +68,25 @@ func (c *Component) Stop() error {
 	return nil
 }
 
+// Restart restarts the routing provider, if it supports it.
+func (c *Component) Restart() error {
+	restarterP, ok := c.provider.(restarter)
+	if !ok {
+		return errors.New("routing provider cannot be restarted")
+	}
+	c.r.Info().Msg("restarting routing component")
+	return restarterP.Restart()
+}
+
 type starter interface {
 	Start() error
 }
 type stopper interface {
 	Stop() error
 }
+type restarter interface {
+	Restart() error
+}
 
 // Lookup uses the selected provider to get an answer.
 func (c *Component) Lookup(ctx context.Context, ip netip.Addr, nh netip.Addr, agent netip.Addr) provider.LookupResult {
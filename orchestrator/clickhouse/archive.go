@@ -0,0 +1,80 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+
+	"akvorado/common/schema"
+)
+
+// ArchiveConfiguration describes where archived flows are stored in an object
+// storage (S3 or S3-compatible like GCS), usually by a scheduled export of
+// raw flows.
+type ArchiveConfiguration struct {
+	// URL is the URL of the archived flows. It may contain wildcards
+	// (`*`, `**`, `{a,b}`) to match several files. When empty, archived
+	// flows are not queried.
+	URL string `validate:"omitempty,url"`
+	// Format is the format of the archived flows.
+	Format string `validate:"oneof=Parquet CSVWithNames"`
+	// AccessKeyID is the access key to use to read from the object storage.
+	AccessKeyID string
+	// SecretAccessKey is the secret key to use to read from the object storage.
+	SecretAccessKey string
+}
+
+// archiveTable is the name of the table to query archived flows.
+const archiveTable = "flows_archive"
+
+// archiveCreateQuery builds the query to create the table to query archived
+// flows. The columns are the ones of the main flows table: aliased columns
+// are computed when querying and therefore do not need to be archived.
+func archiveCreateQuery(config ArchiveConfiguration, sch *schema.Component) string {
+	quote := func(s string) string {
+		return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s))
+	}
+	args := []string{quote(config.URL)}
+	if config.AccessKeyID != "" {
+		args = append(args, quote(config.AccessKeyID), quote(config.SecretAccessKey))
+	}
+	args = append(args, quote(config.Format))
+	return fmt.Sprintf("CREATE TABLE %s (%s)\nENGINE = S3(%s)",
+		archiveTable,
+		sch.ClickHouseCreateTable(schema.ClickHouseSkipCodecs),
+		strings.Join(args, ", "))
+}
+
+// createArchiveTable creates the table to query archived flows. The table
+// does not hold any data, therefore, it is always recreated to match the
+// current schema. It is removed when no archive is configured.
+func (c *Component) createArchiveTable(ctx context.Context) error {
+	if c.config.Archive.URL == "" {
+		if ok, err := c.tableAlreadyExists(ctx, archiveTable, "name", archiveTable); err != nil {
+			return err
+		} else if !ok {
+			return errSkipStep
+		}
+		c.r.Info().Msg("drop archive table")
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf("DROP TABLE %s SYNC", archiveTable)); err != nil {
+			return fmt.Errorf("cannot drop archive table: %w", err)
+		}
+		return nil
+	}
+	c.r.Info().Msg("create archive table")
+	if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s SYNC", archiveTable)); err != nil {
+		return fmt.Errorf("cannot drop existing archive table: %w", err)
+	}
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_suspicious_low_cardinality_types": 1,
+	}))
+	if err := c.d.ClickHouse.Exec(ctx, archiveCreateQuery(c.config.Archive, c.d.Schema)); err != nil {
+		return fmt.Errorf("cannot create archive table: %w", err)
+	}
+	return nil
+}
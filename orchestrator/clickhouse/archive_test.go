@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"strings"
+	"testing"
+
+	"akvorado/common/helpers"
+	"akvorado/common/schema"
+)
+
+func TestArchiveCreateQuery(t *testing.T) {
+	sch := schema.NewMock(t)
+	columns := sch.ClickHouseCreateTable(schema.ClickHouseSkipCodecs)
+	if strings.Contains(columns, "CODEC(") {
+		t.Fatalf("ClickHouseCreateTable() with ClickHouseSkipCodecs contains codecs:\n%s", columns)
+	}
+	if !strings.Contains(columns, "`PacketSize` UInt64 ALIAS intDiv(Bytes, Packets)") {
+		t.Fatalf("ClickHouseCreateTable() does not contain aliased columns:\n%s", columns)
+	}
+
+	cases := []struct {
+		Description string
+		Config      ArchiveConfiguration
+		Expected    string
+	}{
+		{
+			Description: "without credentials",
+			Config: ArchiveConfiguration{
+				URL:    "https://bucket.s3.amazonaws.com/flows/**/*.parquet",
+				Format: "Parquet",
+			},
+			Expected: "CREATE TABLE flows_archive (" + columns + ")\n" +
+				"ENGINE = S3('https://bucket.s3.amazonaws.com/flows/**/*.parquet', 'Parquet')",
+		}, {
+			Description: "with credentials",
+			Config: ArchiveConfiguration{
+				URL:             "https://storage.googleapis.com/bucket/flows/*.csv",
+				Format:          "CSVWithNames",
+				AccessKeyID:     "GOOG1234",
+				SecretAccessKey: "secret'key",
+			},
+			Expected: "CREATE TABLE flows_archive (" + columns + ")\n" +
+				"ENGINE = S3('https://storage.googleapis.com/bucket/flows/*.csv', 'GOOG1234', 'secret\\'key', 'CSVWithNames')",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := archiveCreateQuery(tc.Config, sch)
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("archiveCreateQuery() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
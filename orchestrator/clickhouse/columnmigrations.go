@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/exp/slices"
+
+	"akvorado/common/schema"
+)
+
+// ColumnMigrationConfiguration describes how to migrate the data of a column
+// of the flow tables which was renamed or whose type changed.
+type ColumnMigrationConfiguration struct {
+	// Column is the name of the column in the current schema.
+	Column string `validate:"required"`
+	// From is the previous name of the column. When empty, the column was
+	// not renamed.
+	From string
+	// Backfill is a ClickHouse expression computing the value of the
+	// column from the columns of the existing table. When empty, the
+	// previous column is converted to the new type.
+	Backfill string
+}
+
+// columnMigration returns the migration configured for the provided column,
+// if any.
+func (c *Component) columnMigration(column string) (ColumnMigrationConfiguration, bool) {
+	for _, migration := range c.config.ColumnMigrations {
+		if migration.Column == column {
+			return migration, true
+		}
+	}
+	return ColumnMigrationConfiguration{}, false
+}
+
+// flowsTableViews returns the views reading from or writing to the flows
+// table of the provided resolution.
+func (c *Component) flowsTableViews(resolution ResolutionConfiguration) []string {
+	if resolution.Interval > 0 {
+		return []string{fmt.Sprintf("flows_%s_consumer", resolution.Interval)}
+	}
+	views := []string{
+		fmt.Sprintf("flows_%s_raw_consumer", c.d.Schema.ProtobufMessageHash()),
+		"exporters",
+	}
+	for _, resolution := range c.config.Resolutions {
+		if resolution.Interval > 0 {
+			views = append(views, fmt.Sprintf("flows_%s_consumer", resolution.Interval))
+		}
+	}
+	return views
+}
+
+// planFlowsTableRewrite returns the statements to rewrite the flows table of
+// the provided resolution, when some columns cannot be modified in place. The
+// existing table is renamed, a new one is created and the data is copied,
+// using the configured backfill expressions. The views are dropped and
+// recreated by the next steps, therefore ingestion is paused during the copy.
+func (c *Component) planFlowsTableRewrite(ctx context.Context, resolution ResolutionConfiguration, existingColumns []string) ([]migrationStatement, error) {
+	var tableName string
+	if resolution.Interval == 0 {
+		tableName = "flows"
+	} else {
+		tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+	}
+	oldTableName := fmt.Sprintf("%s_migration", tableName)
+	if ok, err := c.tableAlreadyExists(ctx, oldTableName, "name", oldTableName); err != nil {
+		return nil, err
+	} else if ok {
+		return nil, fmt.Errorf("table %s exists, a previous rewrite of %s was interrupted",
+			oldTableName, tableName)
+	}
+	createQuery, err := c.flowsTableCreateQuery(tableName, resolution)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build create table statement for %s: %w", tableName, err)
+	}
+
+	// Columns to copy and how to compute them. Columns absent from the
+	// existing table get their default value.
+	options := []schema.ClickHouseTableOption{schema.ClickHouseSkipAliasedColumns}
+	if resolution.Interval > 0 {
+		options = append(options, schema.ClickHouseSkipMainOnlyColumns)
+	}
+	columns := []string{}
+	expressions := []string{}
+	for _, column := range c.d.Schema.ClickHouseSelectColumns(options...) {
+		expression := ""
+		migration, ok := c.columnMigration(column)
+		switch {
+		case ok && migration.Backfill != "":
+			expression = migration.Backfill
+		case ok && migration.From != "" && slices.Contains(existingColumns, migration.From):
+			expression = migration.From
+		case slices.Contains(existingColumns, column):
+			expression = column
+		default:
+			continue
+		}
+		columns = append(columns, column)
+		expressions = append(expressions, expression)
+	}
+
+	statements := []migrationStatement{}
+	for _, view := range c.flowsTableViews(resolution) {
+		statements = append(statements, migrationStatement{
+			Table:   view,
+			Query:   fmt.Sprintf("DROP TABLE IF EXISTS %s SYNC", view),
+			Rewrite: true,
+		})
+	}
+	return append(statements, []migrationStatement{
+		{
+			Table:    tableName,
+			Query:    fmt.Sprintf("RENAME TABLE %s TO %s", tableName, oldTableName),
+			Rollback: fmt.Sprintf("RENAME TABLE %s TO %s", oldTableName, tableName),
+			Rewrite:  true,
+		}, {
+			Table:    tableName,
+			Query:    createQuery,
+			Rollback: fmt.Sprintf("DROP TABLE %s SYNC", tableName),
+			Rewrite:  true,
+		}, {
+			Table: tableName,
+			Query: fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+				tableName, strings.Join(columns, ", "), strings.Join(expressions, ", "), oldTableName),
+			Rewrite: true,
+		}, {
+			Table:   oldTableName,
+			Query:   fmt.Sprintf("DROP TABLE %s SYNC", oldTableName),
+			Rewrite: true,
+		},
+	}...), nil
+}
@@ -0,0 +1,188 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/clickhousedb/mocks"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestColumnMigrationsConfiguration(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, _ := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.ColumnMigrations = []ColumnMigrationConfiguration{{Column: "Unknown"}}
+	if _, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       httpserver.NewMock(t, r),
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	}); err == nil {
+		t.Fatal("New() did not error")
+	}
+}
+
+func TestPlanFlowsTableRewrite(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SchemaCheckInterval = 0
+	config.ColumnMigrations = []ColumnMigrationConfiguration{
+		{Column: "ExporterName", From: "ExporterHostname"},
+		{Column: "InIfSpeed", Backfill: "InIfSpeed * 1000"},
+	}
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       httpserver.NewMock(t, r),
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	ctrl := gomock.NewController(t)
+	mockRow := mocks.NewMockRow(ctrl)
+	mockRow.EXPECT().Scan(gomock.Any()).Return(sql.ErrNoRows)
+	mockConn.EXPECT().
+		QueryRow(gomock.Any(), "SELECT name FROM system.tables WHERE name = $1 AND database = $2",
+			"flows_1m0s_migration", config.Database).
+		Return(mockRow)
+
+	resolution := ResolutionConfiguration{Interval: time.Minute, TTL: 7 * 24 * time.Hour}
+	got, err := c.planFlowsTableRewrite(context.Background(), resolution,
+		[]string{"TimeReceived", "ExporterAddress", "ExporterHostname", "InIfSpeed", "Bytes", "Packets"})
+	if err != nil {
+		t.Fatalf("planFlowsTableRewrite() error:\n%+v", err)
+	}
+	createQuery, err := c.flowsTableCreateQuery("flows_1m0s", resolution)
+	if err != nil {
+		t.Fatalf("flowsTableCreateQuery() error:\n%+v", err)
+	}
+	expected := []migrationStatement{
+		{
+			Table:   "flows_1m0s_consumer",
+			Query:   "DROP TABLE IF EXISTS flows_1m0s_consumer SYNC",
+			Rewrite: true,
+		}, {
+			Table:    "flows_1m0s",
+			Query:    "RENAME TABLE flows_1m0s TO flows_1m0s_migration",
+			Rollback: "RENAME TABLE flows_1m0s_migration TO flows_1m0s",
+			Rewrite:  true,
+		}, {
+			Table:    "flows_1m0s",
+			Query:    createQuery,
+			Rollback: "DROP TABLE flows_1m0s SYNC",
+			Rewrite:  true,
+		}, {
+			Table: "flows_1m0s",
+			Query: "INSERT INTO flows_1m0s (TimeReceived, ExporterAddress, ExporterName, InIfSpeed, Bytes, Packets) " +
+				"SELECT TimeReceived, ExporterAddress, ExporterHostname, InIfSpeed * 1000, Bytes, Packets FROM flows_1m0s_migration",
+			Rewrite: true,
+		}, {
+			Table:   "flows_1m0s_migration",
+			Query:   "DROP TABLE flows_1m0s_migration SYNC",
+			Rewrite: true,
+		},
+	}
+	if diff := helpers.Diff(got, expected); diff != "" {
+		t.Fatalf("planFlowsTableRewrite() (-got, +want):\n%s", diff)
+	}
+}
+
+func TestColumnMigration(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent := clickhousedb.SetupClickHouse(t, r)
+	if err := chComponent.Exec(context.Background(), "DROP TABLE IF EXISTS system.metric_log"); err != nil {
+		t.Fatalf("Exec() error:\n%+v", err)
+	}
+	dropAllTables(t, chComponent)
+
+	run := func(t *testing.T, configuration Configuration) *reporter.Reporter {
+		t.Helper()
+		r := reporter.NewMock(t)
+		configuration.OrchestratorURL = "http://something"
+		configuration.Kafka.Configuration = kafka.DefaultConfiguration()
+		ch, err := New(r, configuration, Dependencies{
+			Daemon:     daemon.NewMock(t),
+			HTTP:       httpserver.NewMock(t, r),
+			Schema:     schema.NewMock(t),
+			ClickHouse: chComponent,
+		})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		helpers.StartStop(t, ch)
+		waitMigrations(t, ch)
+		return r
+	}
+
+	// Simulate a previous schema where ExporterName was ExporterHostname.
+	t.Run("previous schema", func(t *testing.T) {
+		run(t, DefaultConfiguration())
+		for _, query := range []string{
+			"DROP TABLE IF EXISTS exporters SYNC",
+			fmt.Sprintf("DROP TABLE IF EXISTS flows_%s_raw_consumer SYNC", schema.NewMock(t).ProtobufMessageHash()),
+			"DROP TABLE IF EXISTS flows_1m0s_consumer SYNC",
+			"DROP TABLE IF EXISTS flows_5m0s_consumer SYNC",
+			"DROP TABLE IF EXISTS flows_1h0m0s_consumer SYNC",
+			"ALTER TABLE flows RENAME COLUMN ExporterName TO ExporterHostname",
+			`INSERT INTO flows (TimeReceived, ExporterAddress, ExporterHostname, Bytes, Packets)
+SELECT now() - number * 3600, toIPv6('::ffff:192.0.2.1'), 'edge1', 1000, 1
+FROM numbers(100)`,
+		} {
+			if err := chComponent.Exec(context.Background(), query); err != nil {
+				t.Fatalf("Exec() error:\n%+v", err)
+			}
+		}
+	})
+	if t.Failed() {
+		return
+	}
+
+	configuration := DefaultConfiguration()
+	configuration.ColumnMigrations = []ColumnMigrationConfiguration{
+		{Column: "ExporterName", From: "ExporterHostname"},
+	}
+	configuration.AllowTableRewrites = true
+	t.Run("rewrite", func(t *testing.T) {
+		run(t, configuration)
+		row := chComponent.QueryRow(context.Background(),
+			`SELECT count() FROM flows WHERE ExporterName = 'edge1'`)
+		var count uint64
+		if err := row.Scan(&count); err != nil {
+			t.Fatalf("Scan() error:\n%+v", err)
+		}
+		if count != 100 {
+			t.Fatalf("flows contains %d rows with a backfilled exporter name, expected 100", count)
+		}
+	})
+	if t.Failed() {
+		return
+	}
+
+	t.Run("idempotency", func(t *testing.T) {
+		r := run(t, configuration)
+		gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_migrations_", "applied_steps_total")
+		expectedMetrics := map[string]string{`applied_steps_total`: "0"}
+		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+			t.Fatalf("Metrics (-got, +want):\n%s", diff)
+		}
+	})
+}
@@ -21,6 +21,9 @@ type Configuration struct {
 	clickhousedb.Configuration `mapstructure:",squash" yaml:"-,inline"`
 	// SkipMigrations tell if we should skip migrations.
 	SkipMigrations bool
+	// DryRunMigrations tells to only log the changes needed for the flow
+	// tables instead of applying migrations.
+	DryRunMigrations bool
 	// Kafka describes Kafka-specific configuration
 	Kafka KafkaConfiguration
 	// Resolutions describe the various resolutions to use to
@@ -29,6 +32,9 @@ type Configuration struct {
 	// MaxPartitions define the number of partitions to have for a
 	// consolidated flow tables when full.
 	MaxPartitions int `validate:"isdefault|min=1"`
+	// ExporterSubpartitions is the number of subpartitions, based on the
+	// exporter address, to use for flow tables. 0 disables subpartitioning.
+	ExporterSubpartitions int `validate:"min=0"`
 	// SystemLogTTL is the TTL to set for system log tables.
 	SystemLogTTL time.Duration `validate:"isdefault|min=1m"`
 	// PrometheusEndpoint defines the endpoint ClickHouse can use to expose
@@ -51,6 +57,38 @@ type Configuration struct {
 	// OrchestratorURL allows one to override URL to reach
 	// orchestrator from ClickHouse
 	OrchestratorURL string `validate:"isdefault|url"`
+	// Exports defines scheduled exports of query results to an object
+	// storage.
+	Exports []ExportConfiguration `validate:"dive"`
+	// SystemMetricsInterval is the interval between two queries of the
+	// ClickHouse system tables to expose their content as metrics. 0
+	// disables this feature.
+	SystemMetricsInterval time.Duration `validate:"min=0"`
+	// SchemaCheckInterval is the interval between two comparisons of the
+	// database schema with the expected one. 0 disables this feature.
+	SchemaCheckInterval time.Duration `validate:"min=0"`
+	// IntegrityCheckInterval is the interval between two comparisons of
+	// the consolidated flow tables with the raw flows. 0 disables this
+	// feature.
+	IntegrityCheckInterval time.Duration `validate:"min=0"`
+	// IntegrityCheckWindows is the number of windows sampled for each
+	// consolidated table during an integrity check.
+	IntegrityCheckWindows int `validate:"isdefault|min=1"`
+	// IntegrityCheckTolerance is the relative difference between a
+	// consolidated table and the raw flows above which a drift is reported.
+	IntegrityCheckTolerance float64 `validate:"min=0,max=1"`
+	// ColumnMigrations describes how to migrate the data of the renamed or
+	// retyped columns of the flow tables.
+	ColumnMigrations []ColumnMigrationConfiguration `validate:"dive"`
+	// AllowTableRewrites tells to rewrite the flow tables when some columns
+	// cannot be modified in place. Ingestion is paused during the rewrite.
+	AllowTableRewrites bool
+	// SchemaVersionsRetention is how long to keep the raw flows tables of
+	// a previous flow schema version once superseded. 0 keeps them forever.
+	SchemaVersionsRetention time.Duration `validate:"min=0"`
+	// Archive defines where archived flows can be queried when they are
+	// older than the data in the flows tables.
+	Archive ArchiveConfiguration
 }
 
 // ResolutionConfiguration describes a consolidation interval.
@@ -62,6 +100,10 @@ type ResolutionConfiguration struct {
 	// TTL is how long to keep data for this resolution. A
 	// value of 0 means to never expire.
 	TTL time.Duration `validate:"isdefault|min=1h"`
+	// PartitionInterval is the interval covered by each partition. A value
+	// of 0 means to derive it from the TTL and the maximum number of
+	// partitions.
+	PartitionInterval time.Duration `validate:"isdefault|min=1m"`
 }
 
 // KafkaConfiguration describes Kafka-specific configuration
@@ -86,14 +128,22 @@ func DefaultConfiguration() Configuration {
 			GroupName: "clickhouse",
 		},
 		Resolutions: []ResolutionConfiguration{
-			{0, 15 * 24 * time.Hour},                   // 15 days
-			{time.Minute, 7 * 24 * time.Hour},          // 7 days
-			{5 * time.Minute, 3 * 30 * 24 * time.Hour}, // 90 days
-			{time.Hour, 12 * 30 * 24 * time.Hour},      // 1 year
+			{Interval: 0, TTL: 15 * 24 * time.Hour},                   // 15 days
+			{Interval: time.Minute, TTL: 7 * 24 * time.Hour},          // 7 days
+			{Interval: 5 * time.Minute, TTL: 3 * 30 * 24 * time.Hour}, // 90 days
+			{Interval: time.Hour, TTL: 12 * 30 * 24 * time.Hour},      // 1 year
+		},
+		MaxPartitions:           50,
+		NetworkSourcesTimeout:   10 * time.Second,
+		SystemLogTTL:            30 * 24 * time.Hour, // 30 days
+		SystemMetricsInterval:   time.Minute,
+		SchemaCheckInterval:     10 * time.Minute,
+		IntegrityCheckInterval:  time.Hour,
+		IntegrityCheckWindows:   3,
+		IntegrityCheckTolerance: 0.001,
+		Archive: ArchiveConfiguration{
+			Format: "Parquet",
 		},
-		MaxPartitions:         50,
-		NetworkSourcesTimeout: 10 * time.Second,
-		SystemLogTTL:          30 * 24 * time.Hour, // 30 days
 	}
 }
 
@@ -132,4 +182,5 @@ func init() {
 	helpers.RegisterMapstructureUnmarshallerHook(helpers.SubnetMapUnmarshallerHook[NetworkAttributes]())
 	helpers.RegisterMapstructureUnmarshallerHook(NetworkAttributesUnmarshallerHook())
 	helpers.RegisterSubnetMapValidation[NetworkAttributes]()
+	helpers.RegisterMapstructureUnmarshallerHook(helpers.DefaultValuesUnmarshallerHook[ExportConfiguration](DefaultExportConfiguration()))
 }
@@ -0,0 +1,206 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ExportConfiguration describes a scheduled export of query results to an
+// object storage (S3 or S3-compatible like GCS).
+type ExportConfiguration struct {
+	// Name is the name of the export, used for logs and metrics.
+	Name string `validate:"required"`
+	// Interval is the period covered by each export.
+	Interval time.Duration `validate:"min=1m"`
+	// Delay is how long to wait after the end of a period before exporting
+	// it, to let late flows arrive.
+	Delay time.Duration `validate:"min=0"`
+	// Query is the SELECT query to export. `{{ .Start }}` and `{{ .End }}`
+	// are replaced by the boundaries of the exported period. When empty,
+	// raw flows are exported.
+	Query string
+	// URL is the destination URL. It is a template where `.Start` and
+	// `.End` are the boundaries of the exported period.
+	URL string `validate:"required"`
+	// Format is the format to use for the export.
+	Format string `validate:"oneof=Parquet CSVWithNames"`
+	// AccessKeyID is the access key to use to write to the object storage.
+	AccessKeyID string
+	// SecretAccessKey is the secret key to use to write to the object storage.
+	SecretAccessKey string
+}
+
+// DefaultExportConfiguration represents the default configuration for an export.
+func DefaultExportConfiguration() ExportConfiguration {
+	return ExportConfiguration{
+		Interval: time.Hour,
+		Delay:    5 * time.Minute,
+		Format:   "Parquet",
+	}
+}
+
+const defaultExportQuery = `SELECT * FROM flows WHERE TimeReceived >= {{ .Start }} AND TimeReceived < {{ .End }}`
+
+// exportQuery builds the query to export the provided period.
+func exportQuery(config ExportConfiguration, start, end time.Time) (string, error) {
+	urlTemplate, err := template.New("url").Option("missingkey=error").Parse(config.URL)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse export URL: %w", err)
+	}
+	var url strings.Builder
+	if err := urlTemplate.Execute(&url, struct{ Start, End time.Time }{start, end}); err != nil {
+		return "", fmt.Errorf("cannot execute export URL template: %w", err)
+	}
+
+	query := config.Query
+	if query == "" {
+		query = defaultExportQuery
+	}
+	queryTemplate, err := template.New("query").Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse export query: %w", err)
+	}
+	var selectQuery strings.Builder
+	if err := queryTemplate.Execute(&selectQuery, struct{ Start, End string }{
+		fmt.Sprintf("toDateTime('%s', 'UTC')", start.UTC().Format("2006-01-02 15:04:05")),
+		fmt.Sprintf("toDateTime('%s', 'UTC')", end.UTC().Format("2006-01-02 15:04:05")),
+	}); err != nil {
+		return "", fmt.Errorf("cannot execute export query template: %w", err)
+	}
+
+	quote := func(s string) string {
+		return fmt.Sprintf("'%s'", strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s))
+	}
+	args := []string{quote(url.String())}
+	if config.AccessKeyID != "" {
+		args = append(args, quote(config.AccessKeyID), quote(config.SecretAccessKey))
+	}
+	args = append(args, quote(config.Format))
+	return fmt.Sprintf("INSERT INTO FUNCTION s3(%s)\n%s\nSETTINGS s3_truncate_on_insert = 1",
+		strings.Join(args, ", "), strings.TrimSpace(selectQuery.String())), nil
+}
+
+// runExport exports the provided period.
+func (c *Component) runExport(ctx context.Context, config ExportConfiguration, start, end time.Time) error {
+	query, err := exportQuery(config, start, end)
+	if err != nil {
+		return err
+	}
+	if err := c.d.ClickHouse.Exec(ctx, query); err != nil {
+		return fmt.Errorf("cannot export %s: %w", config.Name, err)
+	}
+	return nil
+}
+
+// exportMaxBackfill is the age of the oldest period exported when catching
+// up with missed periods. Older periods are likely gone from the raw table.
+const exportMaxBackfill = 7 * 24 * time.Hour
+
+// exportRetryInterval is the time to wait before retrying a failed export.
+const exportRetryInterval = time.Minute
+
+// exportRecord is the last period exported by a scheduled export.
+type exportRecord struct {
+	End time.Time `ch:"period_end"`
+}
+
+// createExportsTable creates the table recording the last period exported by
+// each scheduled export.
+func (c *Component) createExportsTable(ctx context.Context) error {
+	if ok, err := c.tableAlreadyExists(ctx, "exports", "name", "exports"); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("exports table already exists, skip migration")
+		return errSkipStep
+	}
+	c.r.Info().Msg("create exports table")
+	if err := c.d.ClickHouse.Exec(ctx, `
+CREATE TABLE exports (
+ name String,
+ period_end DateTime
+)
+ENGINE = ReplacingMergeTree(period_end)
+ORDER BY name`); err != nil {
+		return fmt.Errorf("cannot create exports table: %w", err)
+	}
+	return nil
+}
+
+// exportPending exports all the periods completed since the last successful
+// export, oldest first. It stops at the first failure. The end of each
+// exported period is recorded so that the next run, possibly on another
+// orchestrator, resumes from there.
+func (c *Component) exportPending(ctx context.Context, config ExportConfiguration, now time.Time) error {
+	latest := now.Add(-config.Delay).Truncate(config.Interval)
+	var results []exportRecord
+	if err := c.d.ClickHouse.Select(ctx, &results,
+		`SELECT max(period_end) AS period_end FROM exports WHERE name = $1`, config.Name); err != nil {
+		return fmt.Errorf("cannot get last export for %s: %w", config.Name, err)
+	}
+	start := latest.Add(-config.Interval)
+	if len(results) > 0 && results[0].End.Unix() > 0 {
+		start = results[0].End
+	}
+	if oldest := now.Add(-exportMaxBackfill).Truncate(config.Interval).Add(config.Interval); start.Before(oldest) {
+		start = oldest
+	}
+	for ; !start.Add(config.Interval).After(latest); start = start.Add(config.Interval) {
+		end := start.Add(config.Interval)
+		if err := c.runExport(ctx, config, start, end); err != nil {
+			return err
+		}
+		if err := c.d.ClickHouse.Exec(ctx,
+			`INSERT INTO exports (name, period_end) VALUES ($1, $2)`, config.Name, end); err != nil {
+			return fmt.Errorf("cannot record export for %s: %w", config.Name, err)
+		}
+		c.metrics.exports.WithLabelValues(config.Name).Inc()
+	}
+	return nil
+}
+
+// scheduleExport runs the provided export for each completed period. Only the
+// leader exports. Failed and missed periods are exported on the next run.
+func (c *Component) scheduleExport(config ExportConfiguration) {
+	c.t.Go(func() error {
+		wait := time.Duration(0)
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-time.After(wait):
+			}
+			now := time.Now()
+			wait = now.Add(-config.Delay).Truncate(config.Interval).
+				Add(config.Interval).Add(config.Delay).Sub(now)
+			if !c.isLeader() {
+				c.r.Debug().Str("export", config.Name).Msg("not the leader, skipping export")
+				continue
+			}
+			if !c.config.SkipMigrations && !c.config.DryRunMigrations {
+				select {
+				case <-c.migrationsDone:
+				default:
+					c.r.Debug().Str("export", config.Name).Msg("migrations not done, delaying export")
+					wait = exportRetryInterval
+					continue
+				}
+			}
+			ctx, cancel := context.WithTimeout(c.t.Context(nil), config.Interval)
+			err := c.exportPending(ctx, config, now)
+			cancel()
+			if err != nil {
+				c.r.Err(err).Str("export", config.Name).Msg("cannot run export")
+				c.metrics.exportErrors.WithLabelValues(config.Name).Inc()
+				if wait > exportRetryInterval {
+					wait = exportRetryInterval
+				}
+			}
+		}
+	})
+}
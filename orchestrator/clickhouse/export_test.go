@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestExportQuery(t *testing.T) {
+	start := time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	cases := []struct {
+		Description string
+		Config      ExportConfiguration
+		Expected    string
+		Error       bool
+	}{
+		{
+			Description: "raw flows",
+			Config: ExportConfiguration{
+				URL:    `https://bucket.s3.amazonaws.com/flows/{{ .Start.Format "2006/01/02/15" }}.parquet`,
+				Format: "Parquet",
+			},
+			Expected: `INSERT INTO FUNCTION s3('https://bucket.s3.amazonaws.com/flows/2024/03/10/14.parquet', 'Parquet')
+SELECT * FROM flows WHERE TimeReceived >= toDateTime('2024-03-10 14:00:00', 'UTC') AND TimeReceived < toDateTime('2024-03-10 15:00:00', 'UTC')
+SETTINGS s3_truncate_on_insert = 1`,
+		}, {
+			Description: "aggregated query with credentials",
+			Config: ExportConfiguration{
+				Query: `
+SELECT SrcAS, SUM(Bytes*SamplingRate) AS Bytes
+FROM flows
+WHERE TimeReceived BETWEEN {{ .Start }} AND {{ .End }}
+GROUP BY SrcAS`,
+				URL:             `https://storage.googleapis.com/bucket/{{ .Start.Format "2006-01-02" }}.csv`,
+				Format:          "CSVWithNames",
+				AccessKeyID:     "GOOG1234",
+				SecretAccessKey: "secret'key",
+			},
+			Expected: `INSERT INTO FUNCTION s3('https://storage.googleapis.com/bucket/2024-03-10.csv', 'GOOG1234', 'secret\'key', 'CSVWithNames')
+SELECT SrcAS, SUM(Bytes*SamplingRate) AS Bytes
+FROM flows
+WHERE TimeReceived BETWEEN toDateTime('2024-03-10 14:00:00', 'UTC') AND toDateTime('2024-03-10 15:00:00', 'UTC')
+GROUP BY SrcAS
+SETTINGS s3_truncate_on_insert = 1`,
+		}, {
+			Description: "invalid URL template",
+			Config: ExportConfiguration{
+				URL:    `https://bucket.s3.amazonaws.com/{{ .Unknown }}.parquet`,
+				Format: "Parquet",
+			},
+			Error: true,
+		}, {
+			Description: "invalid query template",
+			Config: ExportConfiguration{
+				Query:  `SELECT * FROM flows WHERE {{ .Start`,
+				URL:    `https://bucket.s3.amazonaws.com/flows.parquet`,
+				Format: "Parquet",
+			},
+			Error: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got, err := exportQuery(tc.Config, start, end)
+			if err != nil && !tc.Error {
+				t.Fatalf("exportQuery() error:\n%+v", err)
+			} else if err == nil && tc.Error {
+				t.Fatal("exportQuery() no error")
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("exportQuery() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       httpserver.NewMock(t, r),
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	start := time.Date(2024, 3, 10, 14, 0, 0, 0, time.UTC)
+	export := DefaultExportConfiguration()
+	export.Name = "raw"
+	export.URL = "https://bucket.s3.amazonaws.com/flows.parquet"
+	expected, _ := exportQuery(export, start, start.Add(time.Hour))
+	mockConn.EXPECT().Exec(gomock.Any(), expected).Return(nil)
+	if err := c.runExport(context.Background(), export, start, start.Add(time.Hour)); err != nil {
+		t.Fatalf("runExport() error:\n%+v", err)
+	}
+	mockConn.EXPECT().Exec(gomock.Any(), expected).Return(errors.New("access denied"))
+	if err := c.runExport(context.Background(), export, start, start.Add(time.Hour)); err == nil {
+		t.Fatal("runExport() no error")
+	}
+}
+
+func TestExportPending(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       httpserver.NewMock(t, r),
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	export := DefaultExportConfiguration()
+	export.Name = "raw"
+	export.URL = `https://bucket.s3.amazonaws.com/{{ .Start.Format "15" }}.parquet`
+	now := time.Date(2024, 3, 10, 17, 10, 0, 0, time.UTC)
+	period := func(hour int) (time.Time, time.Time) {
+		start := time.Date(2024, 3, 10, hour, 0, 0, 0, time.UTC)
+		return start, start.Add(time.Hour)
+	}
+	expectExport := func(hour int, err error) *gomock.Call {
+		start, end := period(hour)
+		query, _ := exportQuery(export, start, end)
+		return mockConn.EXPECT().Exec(gomock.Any(), query).Return(err)
+	}
+	expectRecord := func(hour int) *gomock.Call {
+		_, end := period(hour)
+		return mockConn.EXPECT().
+			Exec(gomock.Any(), `INSERT INTO exports (name, period_end) VALUES ($1, $2)`, "raw", end).
+			Return(nil)
+	}
+	expectLast := func(last time.Time) *gomock.Call {
+		return mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(),
+				`SELECT max(period_end) AS period_end FROM exports WHERE name = $1`, "raw").
+			SetArg(1, []exportRecord{{End: last}}).
+			Return(nil)
+	}
+
+	// First run: only the last period is exported
+	gomock.InOrder(
+		expectLast(time.Unix(0, 0)),
+		expectExport(16, nil),
+		expectRecord(16),
+	)
+	if err := c.exportPending(context.Background(), export, now); err != nil {
+		t.Fatalf("exportPending() error:\n%+v", err)
+	}
+
+	// Missed periods are backfilled, stopping at the first failure
+	_, last := period(13)
+	gomock.InOrder(
+		expectLast(last),
+		expectExport(14, nil),
+		expectRecord(14),
+		expectExport(15, errors.New("access denied")),
+	)
+	if err := c.exportPending(context.Background(), export, now); err == nil {
+		t.Fatal("exportPending() no error")
+	}
+
+	// Failed period is retried
+	_, last = period(14)
+	gomock.InOrder(
+		expectLast(last),
+		expectExport(15, nil),
+		expectRecord(15),
+		expectExport(16, nil),
+		expectRecord(16),
+	)
+	if err := c.exportPending(context.Background(), export, now); err != nil {
+		t.Fatalf("exportPending() error:\n%+v", err)
+	}
+
+	// Nothing to do when up-to-date
+	_, last = period(16)
+	expectLast(last)
+	if err := c.exportPending(context.Background(), export, now); err != nil {
+		t.Fatalf("exportPending() error:\n%+v", err)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_", "exports_total")
+	expectedMetrics := map[string]string{
+		`exports_total{export="raw"}`: "4",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -20,15 +20,18 @@ var (
 	//go:embed data/protocols.csv
 	//go:embed data/icmp.csv
 	//go:embed data/asns.csv
+	//go:embed data/ports.csv
 	data           embed.FS
 	initShTemplate = template.Must(template.New("initsh").Parse(`#!/bin/sh
 
-# Install Protobuf schema
+# Install Protobuf schemas
 mkdir -p /var/lib/clickhouse/format_schemas
-echo "Install flow schema flow-{{ .FlowSchemaHash }}.proto"
-cat > /var/lib/clickhouse/format_schemas/flow-{{ .FlowSchemaHash }}.proto <<'EOPROTO'
-{{ .FlowSchema }}
+{{- range $schema := .FlowSchemas }}
+echo "Install flow schema flow-{{ $schema.Hash }}.proto"
+cat > /var/lib/clickhouse/format_schemas/flow-{{ $schema.Hash }}.proto <<'EOPROTO'
+{{ $schema.Definition }}
 EOPROTO
+{{- end }}
 
 # Alter ClickHouse configuration
 mkdir -p /etc/clickhouse-server/config.d
@@ -56,8 +59,7 @@ EOCONFIG
 )
 
 type initShVariables struct {
-	FlowSchemaHash     string
-	FlowSchema         string
+	FlowSchemas        []schemaVersion
 	SystemLogTTL       int
 	SystemLogTables    []string
 	PrometheusEndpoint string
@@ -84,9 +86,8 @@ func (c *Component) registerHTTPHandlers() error {
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var result bytes.Buffer
 			if err := initShTemplate.Execute(&result, initShVariables{
-				FlowSchemaHash: c.d.Schema.ProtobufMessageHash(),
-				FlowSchema:     c.d.Schema.ProtobufDefinition(),
-				SystemLogTTL:   int(c.config.SystemLogTTL.Seconds()),
+				FlowSchemas:  c.knownSchemaVersions(),
+				SystemLogTTL: int(c.config.SystemLogTTL.Seconds()),
 				SystemLogTables: []string{
 					"asynchronous_metric_log",
 					"metric_log",
@@ -121,6 +122,16 @@ func (c *Component) registerHTTPHandlers() error {
 		}))
 	}
 
+	// Schema drift
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/schema-drift", c.schemaDriftHandlerFunc)
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/integrity", c.integrityHandlerFunc)
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/schemas", c.schemaVersionsHandlerFunc)
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/schemas/:hash", c.schemaVersionHandlerFunc)
+
+	// Migrations
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/migrations", c.migrationsHandlerFunc)
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/clickhouse/migrations/plan", c.migrationPlanHandlerFunc)
+
 	// networks.csv
 	c.d.HTTP.AddHandler("/api/v0/orchestrator/clickhouse/networks.csv",
 		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
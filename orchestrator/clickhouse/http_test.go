@@ -62,6 +62,13 @@ func TestHTTPEndpoints(t *testing.T) {
 				`"asn","name"`,
 				`1,"Level 3 Communications"`,
 			},
+		}, {
+			URL:         "/api/v0/orchestrator/clickhouse/ports.csv",
+			ContentType: "text/csv; charset=utf-8",
+			FirstLines: []string{
+				`proto,port,name`,
+				`6,1,tcpmux`,
+			},
 		}, {
 			URL:         "/api/v0/orchestrator/clickhouse/networks.csv",
 			ContentType: "text/csv; charset=utf-8",
@@ -75,7 +82,7 @@ func TestHTTPEndpoints(t *testing.T) {
 			FirstLines: []string{
 				`#!/bin/sh`,
 				``,
-				`# Install Protobuf schema`,
+				`# Install Protobuf schemas`,
 				`mkdir -p /var/lib/clickhouse/format_schemas`,
 				fmt.Sprintf(`echo "Install flow schema flow-%s.proto"`,
 					c.d.Schema.ProtobufMessageHash()),
@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// integrityCheckMaxAge is the age of the oldest window checked for
+// integrity. Older data is unlikely to be fixed anyway.
+const integrityCheckMaxAge = 7 * 24 * time.Hour
+
+// integrityTotals are the totals of a flow table for a window.
+type integrityTotals struct {
+	Bytes   uint64 `ch:"bytes" json:"bytes"`
+	Packets uint64 `ch:"packets" json:"packets"`
+}
+
+// integrityWindow is the comparison of a consolidated table with the raw
+// flows for a window.
+type integrityWindow struct {
+	Table    string          `json:"table"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Expected integrityTotals `json:"expected"`
+	Got      integrityTotals `json:"got"`
+	Drift    float64         `json:"drift"`
+	Mismatch bool            `json:"mismatch"`
+}
+
+// integrityResult is the result of the last integrity check.
+type integrityResult struct {
+	Checked time.Time         `json:"checked"`
+	Windows []integrityWindow `json:"windows"`
+}
+
+// scheduleIntegrityCheck periodically compares the consolidated flow tables
+// with the raw flows.
+func (c *Component) scheduleIntegrityCheck() {
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.IntegrityCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+			}
+			if !c.config.SkipMigrations && !c.config.DryRunMigrations {
+				select {
+				case <-c.migrationsDone:
+				default:
+					c.r.Debug().Msg("migrations not done, skipping integrity check")
+					continue
+				}
+			}
+			ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.IntegrityCheckInterval)
+			err := c.checkIntegrity(ctx, time.Now())
+			cancel()
+			if err != nil {
+				c.r.Err(err).Msg("cannot check integrity of consolidated tables")
+				c.metrics.integrityCheckErrors.Inc()
+			}
+		}
+	})
+}
+
+// checkIntegrity compares the totals of each consolidated table with the
+// totals of the raw flows over a sample of past windows and records the
+// result. A difference usually means some inserts from a materialized view
+// have failed.
+func (c *Component) checkIntegrity(ctx context.Context, now time.Time) error {
+	var rawTTL time.Duration
+	for _, resolution := range c.config.Resolutions {
+		if resolution.Interval == 0 {
+			rawTTL = resolution.TTL
+		}
+	}
+
+	windows := []integrityWindow{}
+	for _, resolution := range c.config.Resolutions {
+		if resolution.Interval == 0 {
+			continue
+		}
+		tableName := fmt.Sprintf("flows_%s", resolution.Interval)
+		length, candidates := integrityCandidates(resolution, rawTTL, now)
+		if len(candidates) > c.config.IntegrityCheckWindows {
+			sampled := []time.Time{}
+			for _, idx := range rand.Perm(len(candidates))[:c.config.IntegrityCheckWindows] {
+				sampled = append(sampled, candidates[idx])
+			}
+			sort.Slice(sampled, func(i, j int) bool { return sampled[i].Before(sampled[j]) })
+			candidates = sampled
+		}
+		for _, start := range candidates {
+			end := start.Add(length)
+			expected, err := c.integrityTotals(ctx, "flows", start, end)
+			if err != nil {
+				return err
+			}
+			got, err := c.integrityTotals(ctx, tableName, start, end)
+			if err != nil {
+				return err
+			}
+			drift := math.Max(
+				integrityDrift(expected.Bytes, got.Bytes),
+				integrityDrift(expected.Packets, got.Packets))
+			windows = append(windows, integrityWindow{
+				Table:    tableName,
+				Start:    start,
+				End:      end,
+				Expected: expected,
+				Got:      got,
+				Drift:    drift,
+				Mismatch: drift > c.config.IntegrityCheckTolerance,
+			})
+		}
+	}
+
+	c.integrityLock.Lock()
+	c.integrity = &integrityResult{
+		Checked: now,
+		Windows: windows,
+	}
+	c.integrityLock.Unlock()
+
+	c.metrics.integrityDrift.Reset()
+	mismatches := 0
+	drifts := map[string]float64{}
+	for _, window := range windows {
+		drifts[window.Table] = math.Max(drifts[window.Table], window.Drift)
+		if window.Mismatch {
+			mismatches++
+			c.metrics.integrityMismatches.WithLabelValues(window.Table).Inc()
+		}
+	}
+	for table, drift := range drifts {
+		c.metrics.integrityDrift.WithLabelValues(table).Set(drift)
+	}
+	if mismatches > 0 {
+		c.r.Warn().Msgf("consolidated tables do not match raw flows (%d windows)", mismatches)
+	}
+	return nil
+}
+
+// integrityCandidates returns the length of the windows to check for the
+// provided resolution and the start of the candidate windows. Windows are
+// aligned on their length, are still covered by the TTL of both the raw and
+// the consolidated tables, and are old enough to be fully consolidated.
+func integrityCandidates(resolution ResolutionConfiguration, rawTTL time.Duration, now time.Time) (time.Duration, []time.Time) {
+	length := time.Hour
+	if resolution.Interval > length {
+		length = resolution.Interval
+	}
+	maxAge := integrityCheckMaxAge
+	for _, ttl := range []time.Duration{rawTTL, resolution.TTL} {
+		if ttl > 0 && ttl < maxAge {
+			maxAge = ttl
+		}
+	}
+	oldest := now.Add(-maxAge).Truncate(length).Add(length)
+	newest := now.Truncate(length).Add(-2 * length)
+	candidates := []time.Time{}
+	for start := oldest; !start.After(newest); start = start.Add(length) {
+		candidates = append(candidates, start)
+	}
+	return length, candidates
+}
+
+// integrityTotals returns the number of bytes and packets in the provided
+// table for the provided window.
+func (c *Component) integrityTotals(ctx context.Context, table string, start, end time.Time) (integrityTotals, error) {
+	var results []integrityTotals
+	if err := c.d.ClickHouse.Select(ctx, &results, fmt.Sprintf(`
+SELECT SUM(Bytes*SamplingRate) AS bytes, SUM(Packets*SamplingRate) AS packets
+FROM %s
+WHERE TimeReceived >= $1 AND TimeReceived < $2
+`, table), start, end); err != nil {
+		return integrityTotals{}, fmt.Errorf("cannot query totals for %s: %w", table, err)
+	}
+	if len(results) == 0 {
+		return integrityTotals{}, nil
+	}
+	return results[0], nil
+}
+
+// integrityDrift returns the relative difference between the expected and
+// the actual value.
+func integrityDrift(expected, got uint64) float64 {
+	if expected == got {
+		return 0
+	}
+	if expected == 0 {
+		return 1
+	}
+	return math.Abs(float64(got)-float64(expected)) / float64(expected)
+}
+
+// integrityHandlerFunc returns the result of the last integrity check.
+func (c *Component) integrityHandlerFunc(gc *gin.Context) {
+	c.integrityLock.RLock()
+	defer c.integrityLock.RUnlock()
+	if c.integrity == nil {
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"message": "Integrity of consolidated tables not checked yet."})
+		return
+	}
+	gc.JSON(http.StatusOK, c.integrity)
+}
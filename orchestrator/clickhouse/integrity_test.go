@@ -0,0 +1,202 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestIntegrityCandidates(t *testing.T) {
+	now := time.Date(2024, 4, 11, 8, 30, 0, 0, time.UTC)
+	cases := []struct {
+		Description string
+		Resolution  ResolutionConfiguration
+		RawTTL      time.Duration
+		Length      time.Duration
+		Candidates  []time.Time
+	}{
+		{
+			Description: "short TTL",
+			Resolution:  ResolutionConfiguration{Interval: time.Minute, TTL: 4 * time.Hour},
+			RawTTL:      24 * time.Hour,
+			Length:      time.Hour,
+			Candidates: []time.Time{
+				time.Date(2024, 4, 11, 5, 0, 0, 0, time.UTC),
+				time.Date(2024, 4, 11, 6, 0, 0, 0, time.UTC),
+			},
+		}, {
+			Description: "short raw TTL",
+			Resolution:  ResolutionConfiguration{Interval: time.Minute, TTL: 0},
+			RawTTL:      3 * time.Hour,
+			Length:      time.Hour,
+			Candidates: []time.Time{
+				time.Date(2024, 4, 11, 6, 0, 0, 0, time.UTC),
+			},
+		}, {
+			Description: "too short TTL",
+			Resolution:  ResolutionConfiguration{Interval: time.Minute, TTL: 2 * time.Hour},
+			RawTTL:      3 * time.Hour,
+			Length:      time.Hour,
+			Candidates:  []time.Time{},
+		}, {
+			Description: "daily resolution",
+			Resolution:  ResolutionConfiguration{Interval: 24 * time.Hour, TTL: 0},
+			RawTTL:      4 * 24 * time.Hour,
+			Length:      24 * time.Hour,
+			Candidates: []time.Time{
+				time.Date(2024, 4, 8, 0, 0, 0, 0, time.UTC),
+				time.Date(2024, 4, 9, 0, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			length, candidates := integrityCandidates(tc.Resolution, tc.RawTTL, now)
+			if length != tc.Length {
+				t.Errorf("integrityCandidates() length == %s, expected %s", length, tc.Length)
+			}
+			if diff := helpers.Diff(candidates, tc.Candidates); diff != "" {
+				t.Errorf("integrityCandidates() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIntegrityCheck(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	h := httpserver.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SchemaCheckInterval = 0
+	config.IntegrityCheckInterval = 0
+	config.Resolutions = []ResolutionConfiguration{
+		{Interval: 0, TTL: 3 * time.Hour},
+		{Interval: time.Minute, TTL: 24 * time.Hour},
+		{Interval: time.Hour, TTL: 24 * time.Hour},
+	}
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       h,
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "not checked yet",
+			URL:         "/api/v0/orchestrator/clickhouse/integrity",
+			StatusCode:  503,
+			JSONOutput:  gin.H{"message": "Integrity of consolidated tables not checked yet."},
+		},
+	})
+
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	start := time.Date(2024, 4, 11, 6, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	query := func(table string) string {
+		return fmt.Sprintf(`
+SELECT SUM(Bytes*SamplingRate) AS bytes, SUM(Packets*SamplingRate) AS packets
+FROM %s
+WHERE TimeReceived >= $1 AND TimeReceived < $2
+`, table)
+	}
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), query("flows"), start, end).
+			SetArg(1, []integrityTotals{{Bytes: 100000, Packets: 1000}}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), query("flows_1m0s"), start, end).
+			SetArg(1, []integrityTotals{{Bytes: 100000, Packets: 1000}}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), query("flows"), start, end).
+			SetArg(1, []integrityTotals{{Bytes: 100000, Packets: 1000}}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), query("flows_1h0m0s"), start, end).
+			SetArg(1, []integrityTotals{{Bytes: 75000, Packets: 800}}).
+			Return(nil),
+	)
+	if err := c.checkIntegrity(context.Background(), now); err != nil {
+		t.Fatalf("checkIntegrity() error:\n%+v", err)
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "drift detected",
+			URL:         "/api/v0/orchestrator/clickhouse/integrity",
+			JSONOutput: gin.H{
+				"checked": "2024-04-11T08:00:00Z",
+				"windows": []gin.H{
+					{
+						"table":    "flows_1m0s",
+						"start":    "2024-04-11T06:00:00Z",
+						"end":      "2024-04-11T07:00:00Z",
+						"expected": gin.H{"bytes": 100000, "packets": 1000},
+						"got":      gin.H{"bytes": 100000, "packets": 1000},
+						"drift":    0,
+						"mismatch": false,
+					}, {
+						"table":    "flows_1h0m0s",
+						"start":    "2024-04-11T06:00:00Z",
+						"end":      "2024-04-11T07:00:00Z",
+						"expected": gin.H{"bytes": 100000, "packets": 1000},
+						"got":      gin.H{"bytes": 75000, "packets": 800},
+						"drift":    0.25,
+						"mismatch": true,
+					},
+				},
+			},
+		},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_integrity_")
+	expectedMetrics := map[string]string{
+		`check_errors_total`:                     "0",
+		`drift_ratio{table="flows_1h0m0s"}`:      "0.25",
+		`drift_ratio{table="flows_1m0s"}`:        "0",
+		`mismatches_total{table="flows_1h0m0s"}`: "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
+
+func TestIntegrityDrift(t *testing.T) {
+	cases := []struct {
+		Expected uint64
+		Got      uint64
+		Drift    float64
+	}{
+		{0, 0, 0},
+		{0, 10, 1},
+		{100, 100, 0},
+		{100, 90, 0.1},
+		{100, 120, 0.2},
+	}
+	for _, tc := range cases {
+		if got := integrityDrift(tc.Expected, tc.Got); got != tc.Drift {
+			t.Errorf("integrityDrift(%d, %d) == %f, expected %f", tc.Expected, tc.Got, got, tc.Drift)
+		}
+	}
+}
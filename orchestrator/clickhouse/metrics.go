@@ -9,10 +9,33 @@ type metrics struct {
 	migrationsRunning    reporter.Gauge
 	migrationsApplied    reporter.Counter
 	migrationsNotApplied reporter.Counter
+	migrationsRolledBack reporter.Counter
 
 	networkSourceUpdates *reporter.CounterVec
 	networkSourceErrors  *reporter.CounterVec
 	networkSourceCount   *reporter.GaugeVec
+
+	exports      *reporter.CounterVec
+	exportErrors *reporter.CounterVec
+
+	systemMetricsErrors     *reporter.CounterVec
+	kafkaConsumerLag        *reporter.GaugeVec
+	kafkaConsumerMessages   *reporter.GaugeVec
+	kafkaConsumerExceptions *reporter.GaugeVec
+	tableParts              *reporter.GaugeVec
+	tableRows               *reporter.GaugeVec
+	tableBytes              *reporter.GaugeVec
+	tableMerges             *reporter.GaugeVec
+	viewErrors              *reporter.CounterVec
+
+	schemaDifferences *reporter.GaugeVec
+	schemaCheckErrors reporter.Counter
+
+	integrityDrift       *reporter.GaugeVec
+	integrityMismatches  *reporter.CounterVec
+	integrityCheckErrors reporter.Counter
+
+	schemaVersionsDropped reporter.Counter
 }
 
 func (c *Component) initMetrics() {
@@ -34,4 +57,126 @@ func (c *Component) initMetrics() {
 			Help: "Number of migration steps not applied",
 		},
 	)
+	c.metrics.migrationsRolledBack = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "migrations_rolledback_statements_total",
+			Help: "Number of migration statements rolled back",
+		},
+	)
+	c.metrics.exports = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "exports_total",
+			Help: "Number of successful scheduled exports.",
+		},
+		[]string{"export"},
+	)
+	c.metrics.exportErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "export_errors_total",
+			Help: "Number of failed scheduled exports.",
+		},
+		[]string{"export"},
+	)
+	c.metrics.systemMetricsErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "system_metrics_errors_total",
+			Help: "Number of errors while querying ClickHouse system tables.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.kafkaConsumerLag = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Number of messages not yet consumed by a ClickHouse Kafka engine table.",
+		},
+		[]string{"table", "topic", "partition"},
+	)
+	c.metrics.kafkaConsumerMessages = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "kafka_consumer_messages",
+			Help: "Number of messages read by the consumers of a ClickHouse Kafka engine table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.kafkaConsumerExceptions = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "kafka_consumer_exceptions",
+			Help: "Number of recent exceptions for the consumers of a ClickHouse Kafka engine table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.tableParts = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "table_parts",
+			Help: "Number of active parts for a ClickHouse table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.tableRows = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "table_rows",
+			Help: "Number of rows in a ClickHouse table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.tableBytes = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "table_bytes",
+			Help: "Size on disk of a ClickHouse table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.tableMerges = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "table_merges",
+			Help: "Number of merges in progress for a ClickHouse table.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.viewErrors = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "view_errors_total",
+			Help: "Number of failed executions of a ClickHouse materialized view.",
+		},
+		[]string{"view"},
+	)
+	c.metrics.schemaDifferences = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "schema_differences",
+			Help: "Number of differences between the expected and the actual database schema.",
+		},
+		[]string{"table", "kind"},
+	)
+	c.metrics.schemaCheckErrors = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "schema_check_errors_total",
+			Help: "Number of errors while checking the database schema.",
+		},
+	)
+	c.metrics.integrityDrift = c.r.GaugeVec(
+		reporter.GaugeOpts{
+			Name: "integrity_drift_ratio",
+			Help: "Largest relative difference between a consolidated table and the raw flows during the last integrity check.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.integrityMismatches = c.r.CounterVec(
+		reporter.CounterOpts{
+			Name: "integrity_mismatches_total",
+			Help: "Number of sampled windows where a consolidated table does not match the raw flows.",
+		},
+		[]string{"table"},
+	)
+	c.metrics.integrityCheckErrors = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "integrity_check_errors_total",
+			Help: "Number of errors while checking the integrity of consolidated tables.",
+		},
+	)
+	c.metrics.schemaVersionsDropped = c.r.Counter(
+		reporter.CounterOpts{
+			Name: "schema_versions_dropped_total",
+			Help: "Number of expired flow schema versions dropped.",
+		},
+	)
 }
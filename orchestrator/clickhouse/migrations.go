@@ -63,8 +63,25 @@ func (c *Component) migrateDatabase() error {
 		return fmt.Errorf("incorrect Clickhouse version: %w", err)
 	}
 
+	// Only display what would be done
+	if c.config.DryRunMigrations {
+		if err := c.dryRunMigrations(ctx); err != nil {
+			return err
+		}
+		c.metrics.migrationsRunning.Set(0)
+		return nil
+	}
+
+	// Record the applied migrations
+	err := c.wrapMigrations(func() error {
+		return c.createSchemaMigrationsTable(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
 	// Create dictionaries
-	err := c.wrapMigrations(
+	err = c.wrapMigrations(
 		func() error {
 			return c.createDictionary(ctx, "asns", "hashed",
 				"`asn` UInt32 INJECTIVE, `name` String", "asn")
@@ -74,6 +91,9 @@ func (c *Component) migrateDatabase() error {
 		}, func() error {
 			return c.createDictionary(ctx, "icmp", "complex_key_hashed",
 				"`proto` UInt8, `type` UInt8, `code` UInt8, `name` String", "proto, type, code")
+		}, func() error {
+			return c.createDictionary(ctx, "ports", "complex_key_hashed",
+				"`proto` UInt8, `port` UInt16, `name` String", "proto, port")
 		}, func() error {
 			return c.createDictionary(ctx, "networks", "ip_trie",
 				"`network` String, `name` String, `role` String, `site` String, `region` String, `tenant` String",
@@ -124,6 +144,8 @@ func (c *Component) migrateDatabase() error {
 		err := c.wrapMigrations(
 			func() error {
 				return c.createOrUpdateFlowsTable(ctx, resolution)
+			}, func() error {
+				return c.repartitionFlowsTable(ctx, resolution)
 			}, func() error {
 				return c.createFlowsConsumerView(ctx, resolution)
 			})
@@ -142,12 +164,38 @@ func (c *Component) migrateDatabase() error {
 			return c.createRawFlowsConsumerView(ctx)
 		}, func() error {
 			return c.createRawFlowsErrorsView(ctx)
+		}, func() error {
+			return c.createSchemaVersionsTable(ctx)
+		}, func() error {
+			return c.registerSchemaVersion(ctx)
+		}, func() error {
+			return c.createInventoryTable(ctx)
+		}, func() error {
+			return c.createRawInventoryTable(ctx)
+		}, func() error {
+			return c.createRawInventoryConsumerView(ctx)
+		}, func() error {
+			return c.createInterfacesDictionary(ctx)
+		}, func() error {
+			return c.createProbesTable(ctx)
+		}, func() error {
+			return c.createRawProbesTable(ctx)
+		}, func() error {
+			return c.createRawProbesConsumerView(ctx)
+		}, func() error {
+			return c.createArchiveTable(ctx)
+		}, func() error {
+			return c.createExportsTable(ctx)
 		},
 	)
 	if err != nil {
 		return err
 	}
 
+	if err := c.loadSchemaVersions(ctx); err != nil {
+		return err
+	}
+
 	close(c.migrationsDone)
 	c.metrics.migrationsRunning.Set(0)
 	c.r.Info().Msg("database migration done")
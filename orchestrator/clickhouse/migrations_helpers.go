@@ -121,6 +121,15 @@ LAYOUT({{ .Layout }}())
 	return nil
 }
 
+// reloadDictionary forces ClickHouse to reload the provided dictionary.
+func (c *Component) reloadDictionary(ctx context.Context, name string) error {
+	if err := c.d.ClickHouse.Exec(ctx,
+		fmt.Sprintf("SYSTEM RELOAD DICTIONARY %s.%s", c.config.Database, name)); err != nil {
+		return fmt.Errorf("cannot reload dictionary %s: %w", name, err)
+	}
+	return nil
+}
+
 // createExportersView creates the exporters table/view.
 func (c *Component) createExportersView(ctx context.Context) error {
 	// Select the columns we need
@@ -209,7 +218,8 @@ func (c *Component) createRawFlowsTable(ctx context.Context) error {
 			"Schema": c.d.Schema.ClickHouseCreateTable(
 				schema.ClickHouseSkipGeneratedColumns,
 				schema.ClickHouseUseTransformFromType,
-				schema.ClickHouseSkipAliasedColumns),
+				schema.ClickHouseSkipAliasedColumns,
+				schema.ClickHouseNotNullable),
 			"Engine": kafkaEngine,
 		})
 	if err != nil {
@@ -254,6 +264,7 @@ func (c *Component) createRawFlowsConsumerView(ctx context.Context) error {
 		"Columns": strings.Join(c.d.Schema.ClickHouseSelectColumns(
 			schema.ClickHouseSubstituteGenerates,
 			schema.ClickHouseSubstituteTransforms,
+			schema.ClickHouseSubstituteMissingValues,
 			schema.ClickHouseSkipAliasedColumns), ", "),
 		"Database": c.config.Database,
 		"Table":    tableName,
@@ -346,57 +357,47 @@ func (c *Component) createOrUpdateFlowsTable(ctx context.Context, resolution Res
 	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
 		"allow_suspicious_low_cardinality_types": 1,
 	}))
+	statements, err := c.planFlowsTable(ctx, resolution)
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return errSkipStep
+	}
+	if !c.config.AllowTableRewrites && slices.ContainsFunc(statements, func(statement migrationStatement) bool {
+		return statement.Rewrite
+	}) {
+		return fmt.Errorf("flows table for interval %s needs to be rewritten, check the migration plan and enable table rewrites",
+			resolution.Interval)
+	}
+	return c.applyMigrationStatements(ctx, statements)
+}
+
+// planFlowsTable returns the statements to create or update the flows table
+// of the provided resolution. Nothing is executed.
+func (c *Component) planFlowsTable(ctx context.Context, resolution ResolutionConfiguration) ([]migrationStatement, error) {
 	var tableName string
 	if resolution.Interval == 0 {
 		tableName = "flows"
 	} else {
 		tableName = fmt.Sprintf("flows_%s", resolution.Interval)
 	}
-	partitionInterval := uint64((resolution.TTL / time.Duration(c.config.MaxPartitions)).Seconds())
 	ttl := uint64(resolution.TTL.Seconds())
 
 	// Create table if it does not exist
 	if ok, err := c.tableAlreadyExists(ctx, tableName, "name", tableName); err != nil {
-		return err
+		return nil, err
 	} else if !ok {
-		var createQuery string
-		var err error
-		if resolution.Interval == 0 {
-			createQuery, err = stemplate(`
-CREATE TABLE flows ({{ .Schema }})
-ENGINE = MergeTree
-PARTITION BY toYYYYMMDDhhmmss(toStartOfInterval(TimeReceived, INTERVAL {{ .PartitionInterval }} second))
-ORDER BY (TimeReceived, ExporterAddress, InIfName, OutIfName)
-TTL TimeReceived + toIntervalSecond({{ .TTL }})
-`, gin.H{
-				"Schema":            c.d.Schema.ClickHouseCreateTable(),
-				"PartitionInterval": partitionInterval,
-				"TTL":               ttl,
-			})
-		} else {
-			createQuery, err = stemplate(`
-CREATE TABLE {{ .Table }} ({{ .Schema }})
-ENGINE = SummingMergeTree((Bytes, Packets))
-PARTITION BY toYYYYMMDDhhmmss(toStartOfInterval(TimeReceived, INTERVAL {{ .PartitionInterval }} second))
-PRIMARY KEY ({{ .PrimaryKey }})
-ORDER BY ({{ .SortingKey }})
-TTL TimeReceived + toIntervalSecond({{ .TTL }})
-`, gin.H{
-				"Table":             tableName,
-				"Schema":            c.d.Schema.ClickHouseCreateTable(schema.ClickHouseSkipMainOnlyColumns),
-				"PartitionInterval": partitionInterval,
-				"PrimaryKey":        strings.Join(c.d.Schema.ClickHousePrimaryKeys(), ", "),
-				"SortingKey":        strings.Join(c.d.Schema.ClickHouseSortingKeys(), ", "),
-				"TTL":               ttl,
-			})
-		}
+		createQuery, err := c.flowsTableCreateQuery(tableName, resolution)
 		if err != nil {
-			return fmt.Errorf("cannot build create table statement for %s: %w", tableName, err)
-		}
-		if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
-			return fmt.Errorf("cannot create %s: %w", tableName, err)
+			return nil, fmt.Errorf("cannot build create table statement for %s: %w", tableName, err)
 		}
-		return nil
+		return []migrationStatement{{
+			Table:    tableName,
+			Query:    createQuery,
+			Rollback: fmt.Sprintf("DROP TABLE %s SYNC", tableName),
+			Online:   true,
+		}}, nil
 	}
 
 	// Get existing columns
@@ -415,12 +416,24 @@ WHERE database = $1
 AND table = $2
 ORDER BY position ASC
 `, c.config.Database, tableName); err != nil {
-		return fmt.Errorf("cannot query columns table: %w", err)
+		return nil, fmt.Errorf("cannot query columns table: %w", err)
+	}
+
+	existingNames := []string{}
+	for _, existingColumn := range existingColumns {
+		existingNames = append(existingNames, existingColumn.Name)
 	}
 
 	// Plan for modifications. We don't check everything: we assume the
-	// modifications to be done are covered by the unit tests.
+	// modifications to be done are covered by the unit tests. Columns to be
+	// recreated are dropped first, their data is lost. Renamed columns and
+	// columns which cannot be modified in place require to rewrite the
+	// whole table.
+	rewrites := []string{}
+	statements := []migrationStatement{}
 	modifications := []string{}
+	rollbacks := []string{}
+	reshaped := false
 	previousColumn := ""
 outer:
 	for _, wantedColumn := range c.d.Schema.Columns() {
@@ -433,9 +446,11 @@ outer:
 				modifyTypeOrCodec := false
 				if wantedColumn.ClickHouseType != existingColumn.Type {
 					modifyTypeOrCodec = true
-					if slices.Contains(c.d.Schema.ClickHousePrimaryKeys(), wantedColumn.Name) {
-						return fmt.Errorf("table %s, primary key column %s has a non-matching type: %s vs %s",
+					_, migrated := c.columnMigration(wantedColumn.Name)
+					if migrated || slices.Contains(c.d.Schema.ClickHousePrimaryKeys(), wantedColumn.Name) {
+						c.r.Info().Msgf("table %s, column %s has a non-matching type: %s vs %s",
 							tableName, wantedColumn.Name, existingColumn.Type, wantedColumn.ClickHouseType)
+						rewrites = append(rewrites, wantedColumn.Name)
 					}
 				}
 				if wantedColumn.ClickHouseCodec != "" {
@@ -444,96 +459,279 @@ outer:
 						modifyTypeOrCodec = true
 					}
 				}
+				recreate := false
 				// change alias existence has changed. ALIAS expression changes are not yet checked here.
 				if (wantedColumn.ClickHouseAlias != "") != (existingColumn.DefaultKind == "ALIAS") {
 					// either the column was an alias and should be none, or the other way around. Either way, we need to recreate.
 					c.r.Logger.Debug().Msg(fmt.Sprintf("column %s alias content has changed, recreating. New ALIAS: %s", existingColumn.Name, wantedColumn.ClickHouseAlias))
-					err := c.d.ClickHouse.Exec(ctx,
-						fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, existingColumn.Name))
-					if err != nil {
-						return fmt.Errorf("cannot drop %s from %s to cleanup aliasing: %w",
-							existingColumn.Name, tableName, err)
-					}
-					// Schedule adding it back
-					modifications = append(modifications,
-						fmt.Sprintf("ADD COLUMN %s AFTER %s", wantedColumn.ClickHouseDefinition(), previousColumn))
+					recreate = true
 				}
 
 				if resolution.Interval > 0 && slices.Contains(c.d.Schema.ClickHousePrimaryKeys(), wantedColumn.Name) && existingColumn.IsPrimaryKey == 0 {
-					return fmt.Errorf("table %s, column %s should be a primary key, cannot change that",
-						tableName, wantedColumn.Name)
+					c.r.Info().Msgf("table %s, column %s should be a primary key", tableName, wantedColumn.Name)
+					rewrites = append(rewrites, wantedColumn.Name)
 				}
 				if resolution.Interval > 0 && !wantedColumn.ClickHouseNotSortingKey && existingColumn.IsSortingKey == 0 {
 					// That's something we can fix, but we need to drop it before recreating it
-					err := c.d.ClickHouse.Exec(ctx,
-						fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, existingColumn.Name))
-					if err != nil {
-						return fmt.Errorf("cannot drop %s from %s to fix ordering: %w",
-							existingColumn.Name, tableName, err)
-					}
+					recreate = true
+				}
+				if recreate {
+					statements = append(statements, migrationStatement{
+						Table: tableName,
+						Query: fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", tableName, existingColumn.Name),
+					})
 					// Schedule adding it back
 					modifications = append(modifications,
 						fmt.Sprintf("ADD COLUMN %s AFTER %s", wantedColumn.ClickHouseDefinition(), previousColumn))
+					reshaped = true
 				} else if modifyTypeOrCodec {
 					modifications = append(modifications,
 						fmt.Sprintf("MODIFY COLUMN %s", wantedColumn.ClickHouseDefinition()))
+					rollbacks = append(rollbacks,
+						strings.TrimSpace(fmt.Sprintf("MODIFY COLUMN `%s` %s %s",
+							existingColumn.Name, existingColumn.Type, existingColumn.CompressionCodec)))
 				}
 				previousColumn = wantedColumn.Name
 				continue outer
 			}
 		}
-		// Add the missing column. Only if not primary.
-		if resolution.Interval > 0 && slices.Contains(c.d.Schema.ClickHousePrimaryKeys(), wantedColumn.Name) {
-			return fmt.Errorf("table %s, column %s is missing but it is a primary key",
-				tableName, wantedColumn.Name)
+		// Add the missing column. Only if not primary nor renamed.
+		if migration, ok := c.columnMigration(wantedColumn.Name); ok &&
+			(migration.Backfill != "" || slices.Contains(existingNames, migration.From)) {
+			c.r.Info().Msgf("table %s, column %s is missing and should be backfilled", tableName, wantedColumn.Name)
+			rewrites = append(rewrites, wantedColumn.Name)
+		} else if resolution.Interval > 0 && slices.Contains(c.d.Schema.ClickHousePrimaryKeys(), wantedColumn.Name) {
+			c.r.Info().Msgf("table %s, column %s is missing but it is a primary key", tableName, wantedColumn.Name)
+			rewrites = append(rewrites, wantedColumn.Name)
 		}
 		c.r.Debug().Msgf("add missing column %s to %s", wantedColumn.Name, tableName)
 		modifications = append(modifications,
 			fmt.Sprintf("ADD COLUMN %s AFTER %s", wantedColumn.ClickHouseDefinition(), previousColumn))
+		rollbacks = append(rollbacks, fmt.Sprintf("DROP COLUMN %s", wantedColumn.Name))
+		reshaped = true
 		previousColumn = wantedColumn.Name
 	}
+	if len(rewrites) > 0 {
+		c.r.Warn().Strs("columns", rewrites).
+			Msgf("%s cannot be modified in place and needs to be rewritten", tableName)
+		return c.planFlowsTableRewrite(ctx, resolution, existingNames)
+	}
 	if len(modifications) > 0 {
-		// Also update ORDER BY
-		if resolution.Interval > 0 {
+		rollback := ""
+		if resolution.Interval > 0 && reshaped {
+			// Also update ORDER BY. The consumer is dropped as its SELECT
+			// query does not match the table anymore. It is recreated by
+			// the next step. Changing only types or codecs keeps it.
 			modifications = append(modifications,
 				fmt.Sprintf("MODIFY ORDER BY (%s)", strings.Join(c.d.Schema.ClickHouseSortingKeys(), ", ")))
+			statements = append(statements, migrationStatement{
+				Table: fmt.Sprintf("%s_consumer", tableName),
+				Query: fmt.Sprintf(`DROP TABLE IF EXISTS %s_consumer SYNC`, tableName),
+			})
+		} else if len(statements) == 0 {
+			// Columns added to the sorting key cannot be removed, so we
+			// only know how to rollback simple modifications.
+			rollback = fmt.Sprintf("ALTER TABLE %s %s", tableName, strings.Join(rollbacks, ", "))
 		}
-		c.r.Info().Msgf("apply %d modifications to %s", len(modifications), tableName)
-		if resolution.Interval > 0 {
-			// Drop the view
-			viewName := fmt.Sprintf("%s_consumer", tableName)
-			if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, viewName)); err != nil {
-				return fmt.Errorf("cannot drop %s: %w", viewName, err)
-			}
-		}
-		err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf("ALTER TABLE %s %s", tableName, strings.Join(modifications, ", ")))
-		if err != nil {
-			return fmt.Errorf("cannot update table %s: %w", tableName, err)
-		}
+		statements = append(statements, migrationStatement{
+			Table:    tableName,
+			Query:    fmt.Sprintf("ALTER TABLE %s %s", tableName, strings.Join(modifications, ", ")),
+			Rollback: rollback,
+			Online:   true,
+		})
 	}
 
 	// Check if we need to update the TTL
 	ttlClause := fmt.Sprintf("TTL TimeReceived + toIntervalSecond(%d)", ttl)
 	ttlClauseLike := fmt.Sprintf("CAST(engine_full LIKE '%% %s %%', 'String')", ttlClause)
 	if ok, err := c.tableAlreadyExists(ctx, tableName, ttlClauseLike, "1"); err != nil {
-		return err
+		return nil, err
 	} else if !ok {
 		c.r.Warn().
-			Msgf("updating TTL of %s with interval %s, this can take a long time", tableName, resolution.Interval)
-		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf("ALTER TABLE %s MODIFY %s", tableName, ttlClause)); err != nil {
-			return fmt.Errorf("cannot modify TTL for table %s: %w", tableName, err)
+			Msgf("TTL of %s with interval %s needs an update, this can take a long time", tableName, resolution.Interval)
+		statements = append(statements, migrationStatement{
+			Table:  tableName,
+			Query:  fmt.Sprintf("ALTER TABLE %s MODIFY %s", tableName, ttlClause),
+			Online: true,
+		})
+	}
+	return statements, nil
+}
+
+// flowsTablePartitionBy returns the partition expression for the flows table
+// of the provided resolution.
+func (c *Component) flowsTablePartitionBy(resolution ResolutionConfiguration) string {
+	partitionInterval := resolution.PartitionInterval
+	if partitionInterval == 0 {
+		partitionInterval = resolution.TTL / time.Duration(c.config.MaxPartitions)
+	}
+	partitionBy := fmt.Sprintf(
+		"toYYYYMMDDhhmmss(toStartOfInterval(TimeReceived, INTERVAL %d second))",
+		uint64(partitionInterval.Seconds()))
+	if c.config.ExporterSubpartitions > 0 {
+		partitionBy = fmt.Sprintf("(%s, moduloOrZero(cityHash64(ExporterAddress), %d))",
+			partitionBy, c.config.ExporterSubpartitions)
+	}
+	return partitionBy
+}
+
+// flowsTableCreateQuery returns the query to create the flows table of the
+// provided resolution with the provided name.
+func (c *Component) flowsTableCreateQuery(tableName string, resolution ResolutionConfiguration) (string, error) {
+	ttl := uint64(resolution.TTL.Seconds())
+	if resolution.Interval == 0 {
+		return stemplate(`
+CREATE TABLE {{ .Table }} ({{ .Schema }})
+ENGINE = MergeTree
+PARTITION BY {{ .PartitionBy }}
+ORDER BY (TimeReceived, ExporterAddress, InIfName, OutIfName)
+TTL TimeReceived + toIntervalSecond({{ .TTL }})
+`, gin.H{
+			"Table":       tableName,
+			"Schema":      c.d.Schema.ClickHouseCreateTable(),
+			"PartitionBy": c.flowsTablePartitionBy(resolution),
+			"TTL":         ttl,
+		})
+	}
+	return stemplate(`
+CREATE TABLE {{ .Table }} ({{ .Schema }})
+ENGINE = SummingMergeTree((Bytes, Packets))
+PARTITION BY {{ .PartitionBy }}
+PRIMARY KEY ({{ .PrimaryKey }})
+ORDER BY ({{ .SortingKey }})
+TTL TimeReceived + toIntervalSecond({{ .TTL }})
+`, gin.H{
+		"Table":       tableName,
+		"Schema":      c.d.Schema.ClickHouseCreateTable(schema.ClickHouseSkipMainOnlyColumns),
+		"PartitionBy": c.flowsTablePartitionBy(resolution),
+		"PrimaryKey":  strings.Join(c.d.Schema.ClickHousePrimaryKeys(), ", "),
+		"SortingKey":  strings.Join(c.d.Schema.ClickHouseSortingKeys(), ", "),
+		"TTL":         ttl,
+	})
+}
+
+// repartitionFlowsTable changes the partitioning of an existing flows table
+// when it does not match the configured one. This is only done when the
+// partitioning is explicitly configured. ClickHouse cannot alter the
+// partition key of a table: a new table is swapped with the existing one and
+// the data is copied partition by partition. Consumers are dropped during the
+// copy and recreated by the next steps, therefore ingestion is paused and
+// resumed from Kafka. An interrupted copy is resumed on the next run.
+func (c *Component) repartitionFlowsTable(ctx context.Context, resolution ResolutionConfiguration) error {
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_suspicious_low_cardinality_types": 1,
+	}))
+	var tableName string
+	if resolution.Interval == 0 {
+		tableName = "flows"
+	} else {
+		tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+	}
+	oldTableName := fmt.Sprintf("%s_old", tableName)
+	newTableName := fmt.Sprintf("%s_new", tableName)
+
+	if ok, err := c.tableAlreadyExists(ctx, oldTableName, "name", oldTableName); err != nil {
+		return err
+	} else if !ok {
+		if resolution.PartitionInterval == 0 && c.config.ExporterSubpartitions == 0 {
+			return errSkipStep
+		}
+
+		// Create an empty table with the expected partitioning to compare
+		// partition keys as formatted by ClickHouse.
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, newTableName)); err != nil {
+			return fmt.Errorf("cannot drop %s: %w", newTableName, err)
+		}
+		createQuery, err := c.flowsTableCreateQuery(newTableName, resolution)
+		if err != nil {
+			return fmt.Errorf("cannot build create table statement for %s: %w", newTableName, err)
+		}
+		if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
+			return fmt.Errorf("cannot create %s: %w", newTableName, err)
+		}
+		var samePartitioning uint8
+		row := c.d.ClickHouse.QueryRow(ctx, `
+SELECT uniqExact(partition_key) = 1
+FROM system.tables
+WHERE database = $1 AND name IN ($2, $3)
+`, c.config.Database, tableName, newTableName)
+		if err := row.Scan(&samePartitioning); err != nil {
+			return fmt.Errorf("cannot compare partition keys of %s: %w", tableName, err)
+		}
+		if samePartitioning == 1 {
+			if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE %s SYNC`, newTableName)); err != nil {
+				return fmt.Errorf("cannot drop %s: %w", newTableName, err)
+			}
+			return errSkipStep
+		}
+
+		// Drop consumers and swap tables
+		c.r.Warn().Msgf("repartitioning %s, ingestion is paused until done", tableName)
+		for _, view := range c.flowsTableViews(resolution) {
+			if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, view)); err != nil {
+				return fmt.Errorf("cannot drop %s: %w", view, err)
+			}
+		}
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`RENAME TABLE %s TO %s, %s TO %s`,
+			tableName, oldTableName, newTableName, tableName)); err != nil {
+			return fmt.Errorf("cannot swap %s with %s: %w", tableName, newTableName, err)
+		}
+	}
+
+	// Copy data from the old table, one partition at a time
+	var partitions []struct {
+		ID string `ch:"partition_id"`
+	}
+	if err := c.d.ClickHouse.Select(ctx, &partitions, `
+SELECT DISTINCT partition_id
+FROM system.parts
+WHERE database = $1 AND table = $2 AND active
+ORDER BY partition_id ASC
+`, c.config.Database, oldTableName); err != nil {
+		return fmt.Errorf("cannot query partitions of %s: %w", oldTableName, err)
+	}
+	options := []schema.ClickHouseTableOption{schema.ClickHouseSkipAliasedColumns}
+	if resolution.Interval > 0 {
+		options = append(options, schema.ClickHouseSkipMainOnlyColumns)
+	}
+	columns := strings.Join(c.d.Schema.ClickHouseSelectColumns(options...), ", ")
+	for idx, partition := range partitions {
+		c.r.Info().Msgf("copy partition %s of %s (%d/%d)", partition.ID, tableName, idx+1, len(partitions))
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(
+			`INSERT INTO %s (%s) SELECT %s FROM %s WHERE _partition_id = '%s'`,
+			tableName, columns, columns, oldTableName, partition.ID)); err != nil {
+			return fmt.Errorf("cannot copy partition %s of %s: %w", partition.ID, oldTableName, err)
 		}
-		return nil
-	} else if len(modifications) > 0 {
-		return nil
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(
+			`ALTER TABLE %s DROP PARTITION ID '%s'`, oldTableName, partition.ID)); err != nil {
+			return fmt.Errorf("cannot drop partition %s of %s: %w", partition.ID, oldTableName, err)
+		}
+	}
+	if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE %s SYNC`, oldTableName)); err != nil {
+		return fmt.Errorf("cannot drop %s: %w", oldTableName, err)
 	}
-	return errSkipStep
+	c.r.Info().Msgf("repartitioning of %s done", tableName)
+	return nil
 }
 
 func (c *Component) createFlowsConsumerView(ctx context.Context, resolution ResolutionConfiguration) error {
+	statements, err := c.planFlowsConsumerView(ctx, resolution, false)
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		return errSkipStep
+	}
+	return c.applyMigrationStatements(ctx, statements)
+}
+
+// planFlowsConsumerView returns the statements to create or update the
+// consumer of the flows table of the provided resolution. When dropped is
+// true, the consumer is expected to be dropped by a previous statement.
+func (c *Component) planFlowsConsumerView(ctx context.Context, resolution ResolutionConfiguration, dropped bool) ([]migrationStatement, error) {
 	if resolution.Interval == 0 {
 		// The consumer for the main table is created elsewhere.
-		return errSkipStep
+		return nil, nil
 	}
 	tableName := fmt.Sprintf("flows_%s", resolution.Interval)
 	viewName := fmt.Sprintf("%s_consumer", tableName)
@@ -552,25 +750,378 @@ FROM {{ .Database }}.flows`, gin.H{
 			schema.ClickHouseSkipAliasedColumns), ",\n "),
 	})
 	if err != nil {
-		return fmt.Errorf("cannot build select statement for consumer %s: %w", viewName, err)
+		return nil, fmt.Errorf("cannot build select statement for consumer %s: %w", viewName, err)
 	}
 
 	// Check the existing one
-	if ok, err := c.tableAlreadyExists(ctx, viewName, "as_select", selectQuery); err != nil {
+	if !dropped {
+		if ok, err := c.tableAlreadyExists(ctx, viewName, "as_select", selectQuery); err != nil {
+			return nil, err
+		} else if ok {
+			c.r.Info().Msgf("%s already exists, skip migration", viewName)
+			return nil, nil
+		}
+	}
+
+	// Drop and create
+	return []migrationStatement{
+		{
+			Table: viewName,
+			Query: fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, viewName),
+		}, {
+			Table:    viewName,
+			Query:    fmt.Sprintf(`CREATE MATERIALIZED VIEW %s TO %s AS %s`, viewName, tableName, selectQuery),
+			Rollback: fmt.Sprintf(`DROP TABLE %s SYNC`, viewName),
+			Online:   true,
+		},
+	}, nil
+}
+
+// inventoryColumns are the columns of the inventory table. The inlets send
+// entries with the same fields.
+var inventoryColumns = []struct {
+	Name    string
+	RawType string
+	Type    string
+}{
+	{"TimeReceived", "DateTime", "DateTime CODEC(DoubleDelta, LZ4)"},
+	{"ExporterAddress", "IPv6", "LowCardinality(IPv6)"},
+	{"ExporterName", "String", "LowCardinality(String)"},
+	{"ExporterGroup", "String", "LowCardinality(String)"},
+	{"ExporterRole", "String", "LowCardinality(String)"},
+	{"ExporterSite", "String", "LowCardinality(String)"},
+	{"ExporterRegion", "String", "LowCardinality(String)"},
+	{"ExporterTenant", "String", "LowCardinality(String)"},
+	{"IfIndex", "UInt32", "UInt32"},
+	{"IfName", "String", "LowCardinality(String)"},
+	{"IfDescription", "String", "String"},
+	{"IfSpeed", "UInt32", "UInt32"},
+	{"IfConnectivity", "String", "LowCardinality(String)"},
+	{"IfProvider", "String", "LowCardinality(String)"},
+	{"IfBoundary", "Enum8('undefined' = 0, 'external' = 1, 'internal' = 2)", "Enum8('undefined' = 0, 'external' = 1, 'internal' = 2)"},
+}
+
+// longestTTL returns the TTL of the resolution with the longest TTL. 0 means
+// data is never expired.
+func (c *Component) longestTTL() time.Duration {
+	var ttl time.Duration
+	for _, resolution := range c.config.Resolutions {
+		if resolution.TTL == 0 {
+			return 0
+		}
+		ttl = max(ttl, resolution.TTL)
+	}
+	return ttl
+}
+
+// createInventoryTable creates the inventory table. It keeps the history of
+// the interfaces of each exporter, as sent periodically by the inlets. The TTL
+// is the one of the resolution with the longest TTL.
+func (c *Component) createInventoryTable(ctx context.Context) error {
+	ttl := c.longestTTL()
+	columns := []string{}
+	for _, column := range inventoryColumns {
+		columns = append(columns, fmt.Sprintf("`%s` %s", column.Name, column.Type))
+	}
+	createQuery, err := stemplate(`
+CREATE TABLE {{ .Database }}.inventory ({{ .Columns }})
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(TimeReceived)
+ORDER BY (ExporterAddress, IfIndex, TimeReceived)
+{{ if .TTL }}TTL TimeReceived + toIntervalSecond({{ .TTL }}){{ end }}`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+			"TTL":      uint64(ttl.Seconds()),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build query to create inventory table: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "inventory", "name", "inventory"); err != nil {
 		return err
 	} else if ok {
-		c.r.Info().Msgf("%s already exists, skip migration", viewName)
+		c.r.Info().Msg("inventory table already exists, skip migration")
 		return errSkipStep
 	}
 
-	// Drop and create
-	c.r.Info().Msgf("create %s", viewName)
-	if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, viewName)); err != nil {
-		return fmt.Errorf("cannot drop table %s: %w", viewName, err)
+	c.r.Info().Msg("create inventory table")
+	ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{
+		"allow_suspicious_low_cardinality_types": 1,
+	}))
+	if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
+		return fmt.Errorf("cannot create inventory table: %w", err)
+	}
+	return nil
+}
+
+// createRawInventoryTable creates the table consuming the inventory topic in
+// Kafka.
+func (c *Component) createRawInventoryTable(ctx context.Context) error {
+	kafkaSettings := []string{
+		fmt.Sprintf(`kafka_broker_list = '%s'`,
+			strings.Join(c.config.Kafka.Brokers, ",")),
+		fmt.Sprintf(`kafka_topic_list = '%s-inventory'`, c.config.Kafka.Topic),
+		fmt.Sprintf(`kafka_group_name = '%s'`, c.config.Kafka.GroupName),
+		`kafka_format = 'JSONEachRow'`,
+		`kafka_num_consumers = 1`,
+		`kafka_handle_error_mode = 'stream'`,
+	}
+	for _, setting := range c.config.Kafka.EngineSettings {
+		kafkaSettings = append(kafkaSettings, setting)
+	}
+	columns := []string{}
+	for _, column := range inventoryColumns {
+		columns = append(columns, fmt.Sprintf("`%s` %s", column.Name, column.RawType))
+	}
+	createQuery, err := stemplate(
+		`CREATE TABLE {{ .Database }}.inventory_raw ({{ .Columns }}) ENGINE = {{ .Engine }}`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+			"Engine":   fmt.Sprintf("Kafka SETTINGS %s", strings.Join(kafkaSettings, ", ")),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build query to create raw inventory table: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "inventory_raw", "create_table_query", createQuery); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("raw inventory table already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create raw inventory table")
+	for _, table := range []string{"inventory_raw_consumer", "inventory_raw"} {
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, table)); err != nil {
+			return fmt.Errorf("cannot drop %s: %w", table, err)
+		}
+	}
+	if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
+		return fmt.Errorf("cannot create raw inventory table: %w", err)
+	}
+	return nil
+}
+
+// createRawInventoryConsumerView creates the view moving entries from the raw
+// inventory table to the inventory table.
+func (c *Component) createRawInventoryConsumerView(ctx context.Context) error {
+	columns := []string{}
+	for _, column := range inventoryColumns {
+		columns = append(columns, column.Name)
+	}
+	selectQuery, err := stemplate(
+		`SELECT {{ .Columns }} FROM {{ .Database }}.inventory_raw WHERE length(_error) = 0`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build select statement for raw inventory consumer view: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "inventory_raw_consumer", "as_select", selectQuery); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("raw inventory consumer view already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create raw inventory consumer view")
+	if err := c.d.ClickHouse.Exec(ctx, `DROP TABLE IF EXISTS inventory_raw_consumer SYNC`); err != nil {
+		return fmt.Errorf("cannot drop table inventory_raw_consumer: %w", err)
+	}
+	if err := c.d.ClickHouse.Exec(ctx,
+		fmt.Sprintf("CREATE MATERIALIZED VIEW inventory_raw_consumer TO inventory AS %s",
+			selectQuery)); err != nil {
+		return fmt.Errorf("cannot create raw inventory consumer view: %w", err)
+	}
+	return nil
+}
+
+// probesColumns are the columns of the probes table. The inlets send entries
+// with the same fields.
+var probesColumns = []struct {
+	Name    string
+	RawType string
+	Type    string
+}{
+	{"TimeReceived", "DateTime", "DateTime CODEC(DoubleDelta, LZ4)"},
+	{"Probe", "String", "LowCardinality(String)"},
+	{"Type", "String", "LowCardinality(String)"},
+	{"Source", "String", "LowCardinality(String)"},
+	{"Target", "String", "LowCardinality(String)"},
+	{"Latency", "Float32", "Float32"},
+	{"Jitter", "Float32", "Float32"},
+	{"Loss", "Float32", "Float32"},
+}
+
+// createProbesTable creates the probes table. It stores the results of the
+// latency and loss probes sent by external agents through the inlets. Like
+// the inventory, the TTL is the one of the resolution with the longest TTL.
+func (c *Component) createProbesTable(ctx context.Context) error {
+	ttl := c.longestTTL()
+	columns := []string{}
+	for _, column := range probesColumns {
+		columns = append(columns, fmt.Sprintf("`%s` %s", column.Name, column.Type))
+	}
+	createQuery, err := stemplate(`
+CREATE TABLE {{ .Database }}.probes ({{ .Columns }})
+ENGINE = MergeTree
+PARTITION BY toYYYYMM(TimeReceived)
+ORDER BY (Probe, TimeReceived)
+{{ if .TTL }}TTL TimeReceived + toIntervalSecond({{ .TTL }}){{ end }}`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+			"TTL":      uint64(ttl.Seconds()),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build query to create probes table: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "probes", "name", "probes"); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("probes table already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create probes table")
+	if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
+		return fmt.Errorf("cannot create probes table: %w", err)
+	}
+	return nil
+}
+
+// createRawProbesTable creates the table consuming the probes topic in Kafka.
+func (c *Component) createRawProbesTable(ctx context.Context) error {
+	kafkaSettings := []string{
+		fmt.Sprintf(`kafka_broker_list = '%s'`,
+			strings.Join(c.config.Kafka.Brokers, ",")),
+		fmt.Sprintf(`kafka_topic_list = '%s-probes'`, c.config.Kafka.Topic),
+		fmt.Sprintf(`kafka_group_name = '%s'`, c.config.Kafka.GroupName),
+		`kafka_format = 'JSONEachRow'`,
+		`kafka_num_consumers = 1`,
+		`kafka_handle_error_mode = 'stream'`,
+	}
+	for _, setting := range c.config.Kafka.EngineSettings {
+		kafkaSettings = append(kafkaSettings, setting)
+	}
+	columns := []string{}
+	for _, column := range probesColumns {
+		columns = append(columns, fmt.Sprintf("`%s` %s", column.Name, column.RawType))
+	}
+	createQuery, err := stemplate(
+		`CREATE TABLE {{ .Database }}.probes_raw ({{ .Columns }}) ENGINE = {{ .Engine }}`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+			"Engine":   fmt.Sprintf("Kafka SETTINGS %s", strings.Join(kafkaSettings, ", ")),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build query to create raw probes table: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "probes_raw", "create_table_query", createQuery); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("raw probes table already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create raw probes table")
+	for _, table := range []string{"probes_raw_consumer", "probes_raw"} {
+		if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, table)); err != nil {
+			return fmt.Errorf("cannot drop %s: %w", table, err)
+		}
+	}
+	if err := c.d.ClickHouse.Exec(ctx, createQuery); err != nil {
+		return fmt.Errorf("cannot create raw probes table: %w", err)
+	}
+	return nil
+}
+
+// createRawProbesConsumerView creates the view moving entries from the raw
+// probes table to the probes table.
+func (c *Component) createRawProbesConsumerView(ctx context.Context) error {
+	columns := []string{}
+	for _, column := range probesColumns {
+		columns = append(columns, column.Name)
+	}
+	selectQuery, err := stemplate(
+		`SELECT {{ .Columns }} FROM {{ .Database }}.probes_raw WHERE length(_error) = 0`,
+		gin.H{
+			"Database": c.config.Database,
+			"Columns":  strings.Join(columns, ", "),
+		})
+	if err != nil {
+		return fmt.Errorf("cannot build select statement for raw probes consumer view: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "probes_raw_consumer", "as_select", selectQuery); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("raw probes consumer view already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create raw probes consumer view")
+	if err := c.d.ClickHouse.Exec(ctx, `DROP TABLE IF EXISTS probes_raw_consumer SYNC`); err != nil {
+		return fmt.Errorf("cannot drop table probes_raw_consumer: %w", err)
 	}
 	if err := c.d.ClickHouse.Exec(ctx,
-		fmt.Sprintf(`CREATE MATERIALIZED VIEW %s TO %s AS %s`, viewName, tableName, selectQuery)); err != nil {
-		return fmt.Errorf("cannot create %s: %w", viewName, err)
+		fmt.Sprintf("CREATE MATERIALIZED VIEW probes_raw_consumer TO probes AS %s",
+			selectQuery)); err != nil {
+		return fmt.Errorf("cannot create raw probes consumer view: %w", err)
+	}
+	return nil
+}
+
+// createInterfacesDictionary creates the interfaces dictionary. It provides
+// the last known attributes of each interface from the inventory table.
+func (c *Component) createInterfacesDictionary(ctx context.Context) error {
+	attributes := []string{"`ExporterAddress` IPv6", "`IfName` String"}
+	selects := []string{"ExporterAddress", "IfName"}
+	for _, column := range inventoryColumns {
+		switch column.Name {
+		case "TimeReceived", "ExporterAddress", "IfName":
+			continue
+		case "IfBoundary":
+			attributes = append(attributes, fmt.Sprintf("`%s` String", column.Name))
+			selects = append(selects, fmt.Sprintf("toString(argMax(%[1]s, TimeReceived)) AS %[1]s", column.Name))
+		default:
+			attributes = append(attributes, fmt.Sprintf("`%s` %s", column.Name, column.RawType))
+			selects = append(selects, fmt.Sprintf("argMax(%[1]s, TimeReceived) AS %[1]s", column.Name))
+		}
+	}
+	createQuery, err := stemplate(`
+CREATE DICTIONARY {{ .Database }}.interfaces ({{ .Attributes }})
+PRIMARY KEY ExporterAddress, IfName
+SOURCE(CLICKHOUSE(QUERY 'SELECT {{ .Selects }} FROM {{ .Database }}.inventory GROUP BY ExporterAddress, IfName'))
+LIFETIME(MIN 0 MAX 3600)
+LAYOUT(COMPLEX_KEY_HASHED())
+`, gin.H{
+		"Database":   c.config.Database,
+		"Attributes": strings.Join(attributes, ", "),
+		"Selects":    strings.Join(selects, ", "),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot build query to create interfaces dictionary: %w", err)
+	}
+
+	if ok, err := c.tableAlreadyExists(ctx, "interfaces", "create_table_query", createQuery); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("interfaces dictionary already exists, skip migration")
+		return errSkipStep
+	}
+
+	c.r.Info().Msg("create interfaces dictionary")
+	createOrReplaceQuery := strings.Replace(createQuery, "CREATE ", "CREATE OR REPLACE ", 1)
+	if err := c.d.ClickHouse.Exec(ctx, createOrReplaceQuery); err != nil {
+		return fmt.Errorf("cannot create interfaces dictionary: %w", err)
 	}
 	return nil
 }
@@ -243,6 +243,7 @@ WHERE database=currentDatabase() AND table NOT LIKE '.%'`)
 			expected := []string{
 				"asns",
 				"exporters",
+				"exports",
 				"flows",
 				"flows_1h0m0s",
 				"flows_1h0m0s_consumer",
@@ -254,8 +255,18 @@ WHERE database=currentDatabase() AND table NOT LIKE '.%'`)
 				fmt.Sprintf("flows_%s_raw_consumer", hash),
 				fmt.Sprintf("flows_%s_raw_errors", hash),
 				"icmp",
+				"interfaces",
+				"inventory",
+				"inventory_raw",
+				"inventory_raw_consumer",
 				"networks",
+				"ports",
+				"probes",
+				"probes_raw",
+				"probes_raw_consumer",
 				"protocols",
+				"schema_migrations",
+				"schema_versions",
 			}
 			if diff := helpers.Diff(got, expected); diff != "" {
 				t.Fatalf("SHOW TABLES (-got, +want):\n%s", diff)
@@ -316,6 +327,15 @@ LIMIT 1`)
 			if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
 				t.Fatalf("Metrics (-got, +want):\n%s", diff)
 			}
+
+			// Nothing left to do
+			plan, err := ch.migrationPlan(context.Background())
+			if err != nil {
+				t.Fatalf("migrationPlan() error:\n%+v", err)
+			}
+			if diff := helpers.Diff(plan, []migrationStatement{}); diff != "" {
+				t.Fatalf("migrationPlan() (-got, +want):\n%s", diff)
+			}
 		})
 	}
 
@@ -643,3 +663,105 @@ func TestCustomDictMigration(t *testing.T) {
 		})
 	}
 }
+
+func TestRepartitionMigration(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent := clickhousedb.SetupClickHouse(t, r)
+	if err := chComponent.Exec(context.Background(), "DROP TABLE IF EXISTS system.metric_log"); err != nil {
+		t.Fatalf("Exec() error:\n%+v", err)
+	}
+	dropAllTables(t, chComponent)
+
+	run := func(t *testing.T, configuration Configuration) *reporter.Reporter {
+		t.Helper()
+		r := reporter.NewMock(t)
+		configuration.OrchestratorURL = "http://something"
+		configuration.Kafka.Configuration = kafka.DefaultConfiguration()
+		ch, err := New(r, configuration, Dependencies{
+			Daemon:     daemon.NewMock(t),
+			HTTP:       httpserver.NewMock(t, r),
+			Schema:     schema.NewMock(t),
+			ClickHouse: chComponent,
+		})
+		if err != nil {
+			t.Fatalf("New() error:\n%+v", err)
+		}
+		helpers.StartStop(t, ch)
+		waitMigrations(t, ch)
+		return r
+	}
+	partitionKey := func(t *testing.T, table string) string {
+		t.Helper()
+		row := chComponent.QueryRow(context.Background(), `
+SELECT partition_key FROM system.tables
+WHERE database = currentDatabase() AND name = $1`, table)
+		var key string
+		if err := row.Scan(&key); err != nil {
+			t.Fatalf("Scan() error:\n%+v", err)
+		}
+		return key
+	}
+	count := func(t *testing.T, table string) uint64 {
+		t.Helper()
+		row := chComponent.QueryRow(context.Background(), fmt.Sprintf(`SELECT count() FROM %s`, table))
+		var count uint64
+		if err := row.Scan(&count); err != nil {
+			t.Fatalf("Scan() error:\n%+v", err)
+		}
+		return count
+	}
+
+	t.Run("default partitioning", func(t *testing.T) {
+		run(t, DefaultConfiguration())
+		if err := chComponent.Exec(context.Background(), `
+INSERT INTO flows (TimeReceived, ExporterAddress, Bytes, Packets)
+SELECT now() - number * 3600, toIPv6(concat('::ffff:192.0.2.', toString(number % 10))), 1000, 1
+FROM numbers(100)`); err != nil {
+			t.Fatalf("Exec() error:\n%+v", err)
+		}
+	})
+	if t.Failed() {
+		return
+	}
+
+	var before string
+	configuration := DefaultConfiguration()
+	configuration.Resolutions[0].PartitionInterval = time.Hour
+	configuration.ExporterSubpartitions = 4
+	t.Run("repartition", func(t *testing.T) {
+		before = partitionKey(t, "flows")
+		run(t, configuration)
+		after := partitionKey(t, "flows")
+		if after == before {
+			t.Fatalf("partition key of flows is still %s", after)
+		}
+		if !strings.Contains(after, "cityHash64(ExporterAddress)") {
+			t.Fatalf("partition key of flows is %s, missing exporter subpartitioning", after)
+		}
+		if got := count(t, "flows"); got != 100 {
+			t.Fatalf("flows contains %d rows after repartitioning, expected 100", got)
+		}
+		row := chComponent.QueryRow(context.Background(), `
+SELECT count() FROM system.tables
+WHERE database = currentDatabase() AND name LIKE 'flows%\_old'`)
+		var tables uint64
+		if err := row.Scan(&tables); err != nil {
+			t.Fatalf("Scan() error:\n%+v", err)
+		}
+		if tables != 0 {
+			t.Fatalf("%d old tables are still present after repartitioning", tables)
+		}
+	})
+	if t.Failed() {
+		return
+	}
+
+	t.Run("idempotency", func(t *testing.T) {
+		r := run(t, configuration)
+		gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_migrations_", "applied_steps_total")
+		expectedMetrics := map[string]string{`applied_steps_total`: "0"}
+		if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+			t.Fatalf("Metrics (-got, +want):\n%s", diff)
+		}
+	})
+}
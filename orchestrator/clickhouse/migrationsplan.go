@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// migrationStatement is a DDL statement of a migration step.
+type migrationStatement struct {
+	Table string `json:"table"`
+	Query string `json:"query"`
+	// Rollback is the statement reverting this one. It is empty when the
+	// statement cannot be reverted (for example, when data is dropped).
+	Rollback string `json:"rollback,omitempty"`
+	// Online tells if the statement is executed without losing data and
+	// without pausing ingestion.
+	Online bool `json:"online"`
+	// Rewrite tells if the statement is part of the rewrite of a table.
+	Rewrite bool `json:"rewrite,omitempty"`
+}
+
+// appliedMigration is a statement recorded in the schema_migrations table.
+type appliedMigration struct {
+	Applied  time.Time `ch:"applied" json:"applied"`
+	Version  string    `ch:"version" json:"version"`
+	Table    string    `ch:"table" json:"table"`
+	Query    string    `ch:"query" json:"query"`
+	Rollback string    `ch:"rollback" json:"rollback,omitempty"`
+	Status   string    `ch:"status" json:"status"`
+}
+
+// createSchemaMigrationsTable creates the table recording the statements
+// applied by migrations.
+func (c *Component) createSchemaMigrationsTable(ctx context.Context) error {
+	if ok, err := c.tableAlreadyExists(ctx, "schema_migrations", "name", "schema_migrations"); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("schema migrations table already exists, skip migration")
+		return errSkipStep
+	}
+	c.r.Info().Msg("create schema migrations table")
+	if err := c.d.ClickHouse.Exec(ctx, `
+CREATE TABLE schema_migrations (
+ applied DateTime64(3),
+ version String,
+ table String,
+ query String,
+ rollback String,
+ status Enum8('applied' = 1, 'failed' = 2, 'rolled back' = 3)
+)
+ENGINE = MergeTree
+ORDER BY applied`); err != nil {
+		return fmt.Errorf("cannot create schema migrations table: %w", err)
+	}
+	return nil
+}
+
+// recordMigrationStatement records a statement in the schema_migrations
+// table. Errors are only logged.
+func (c *Component) recordMigrationStatement(ctx context.Context, statement migrationStatement, status string) {
+	if err := c.d.ClickHouse.Exec(ctx,
+		`INSERT INTO schema_migrations SELECT now64(3), $1, $2, $3, $4, $5`,
+		c.d.Schema.ProtobufMessageHash(), statement.Table, statement.Query, statement.Rollback, status); err != nil {
+		c.r.Err(err).Str("table", statement.Table).Msg("cannot record migration")
+	}
+}
+
+// applyMigrationStatements executes the provided statements in order. When
+// one of them fails, the statements already executed are rolled back in
+// reverse order, when possible.
+func (c *Component) applyMigrationStatements(ctx context.Context, statements []migrationStatement) error {
+	for idx, statement := range statements {
+		c.r.Info().Str("table", statement.Table).Msgf("apply migration: %s", statement.Query)
+		if err := c.d.ClickHouse.Exec(ctx, statement.Query); err != nil {
+			c.recordMigrationStatement(ctx, statement, "failed")
+			c.rollbackMigrationStatements(ctx, statements[:idx])
+			return fmt.Errorf("cannot update %s: %w", statement.Table, err)
+		}
+		c.recordMigrationStatement(ctx, statement, "applied")
+	}
+	return nil
+}
+
+// rollbackMigrationStatements reverts the provided statements, in reverse
+// order. It stops at the first statement which cannot be reverted.
+func (c *Component) rollbackMigrationStatements(ctx context.Context, statements []migrationStatement) {
+	for idx := len(statements) - 1; idx >= 0; idx-- {
+		statement := statements[idx]
+		if statement.Rollback == "" {
+			c.r.Warn().Str("table", statement.Table).Msgf("cannot rollback migration: %s", statement.Query)
+			return
+		}
+		c.r.Info().Str("table", statement.Table).Msgf("rollback migration: %s", statement.Rollback)
+		if err := c.d.ClickHouse.Exec(ctx, statement.Rollback); err != nil {
+			c.r.Err(err).Str("table", statement.Table).Msgf("cannot rollback migration: %s", statement.Query)
+			return
+		}
+		c.recordMigrationStatement(ctx, statement, "rolled back")
+		c.metrics.migrationsRolledBack.Inc()
+	}
+}
+
+// migrationPlan returns the statements needed to update the flow tables and
+// their consumers. Nothing is executed.
+func (c *Component) migrationPlan(ctx context.Context) ([]migrationStatement, error) {
+	plan := []migrationStatement{}
+	for _, resolution := range c.config.Resolutions {
+		statements, err := c.planFlowsTable(ctx, resolution)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, statements...)
+		// The consumer may also be dropped by the rewrite of the main table.
+		dropped := false
+		for _, statement := range plan {
+			if statement.Table == fmt.Sprintf("flows_%s_consumer", resolution.Interval) {
+				dropped = true
+			}
+		}
+		statements, err = c.planFlowsConsumerView(ctx, resolution, dropped)
+		if err != nil {
+			return nil, err
+		}
+		plan = append(plan, statements...)
+	}
+	return plan, nil
+}
+
+// dryRunMigrations logs the statements which would be executed to update the
+// flow tables.
+func (c *Component) dryRunMigrations(ctx context.Context) error {
+	plan, err := c.migrationPlan(ctx)
+	if err != nil {
+		return fmt.Errorf("cannot compute migration plan: %w", err)
+	}
+	if len(plan) == 0 {
+		c.r.Info().Msg("dry-run: flow tables are up-to-date")
+		return nil
+	}
+	for _, statement := range plan {
+		c.r.Warn().
+			Str("table", statement.Table).
+			Bool("online", statement.Online).
+			Bool("rewrite", statement.Rewrite).
+			Msgf("dry-run: would apply migration: %s", statement.Query)
+	}
+	return nil
+}
+
+// migrationPlanHandlerFunc returns the statements needed to update the flow
+// tables.
+func (c *Component) migrationPlanHandlerFunc(gc *gin.Context) {
+	plan, err := c.migrationPlan(gc.Request.Context())
+	if err != nil {
+		c.r.Err(err).Msg("cannot compute migration plan")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot compute migration plan."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"statements": plan})
+}
+
+// migrationsHandlerFunc returns the last applied migrations.
+func (c *Component) migrationsHandlerFunc(gc *gin.Context) {
+	migrations := []appliedMigration{}
+	if err := c.d.ClickHouse.Select(gc.Request.Context(), &migrations, `
+SELECT applied, version, table, query, rollback, toString(status) AS status
+FROM schema_migrations
+ORDER BY applied DESC
+LIMIT 100
+`); err != nil {
+		c.r.Err(err).Msg("cannot query applied migrations")
+		gc.JSON(http.StatusInternalServerError, gin.H{"message": "Cannot query applied migrations."})
+		return
+	}
+	gc.JSON(http.StatusOK, gin.H{"migrations": migrations})
+}
@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestApplyMigrationStatements(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SchemaCheckInterval = 0
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       h,
+		Schema:     sch,
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	hash := sch.ProtobufMessageHash()
+	statements := []migrationStatement{
+		{
+			Table: "flows_1m0s_consumer",
+			Query: "DROP TABLE IF EXISTS flows_1m0s_consumer SYNC",
+		}, {
+			Table:    "flows_1m0s",
+			Query:    "ALTER TABLE flows_1m0s ADD COLUMN `SrcVlan` UInt16 AFTER DstAS",
+			Rollback: "ALTER TABLE flows_1m0s DROP COLUMN SrcVlan",
+			Online:   true,
+		}, {
+			Table:    "flows_1m0s",
+			Query:    "ALTER TABLE flows_1m0s ADD COLUMN `DstVlan` UInt16 AFTER SrcVlan",
+			Rollback: "ALTER TABLE flows_1m0s DROP COLUMN DstVlan",
+			Online:   true,
+		}, {
+			Table:  "flows_1m0s",
+			Query:  "ALTER TABLE flows_1m0s MODIFY TTL TimeReceived + toIntervalSecond(86400)",
+			Online: true,
+		},
+	}
+	record := func(statement migrationStatement, status string) *gomock.Call {
+		return mockConn.EXPECT().
+			Exec(gomock.Any(), `INSERT INTO schema_migrations SELECT now64(3), $1, $2, $3, $4, $5`,
+				hash, statement.Table, statement.Query, statement.Rollback, status).
+			Return(nil)
+	}
+
+	// Failure of the last statement rolls back the previous ones, until the
+	// consumer drop which cannot be reverted.
+	gomock.InOrder(
+		mockConn.EXPECT().Exec(gomock.Any(), statements[0].Query).Return(nil),
+		record(statements[0], "applied"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[1].Query).Return(nil),
+		record(statements[1], "applied"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[2].Query).Return(nil),
+		record(statements[2], "applied"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[3].Query).Return(errors.New("timeout")),
+		record(statements[3], "failed"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[2].Rollback).Return(nil),
+		record(statements[2], "rolled back"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[1].Rollback).Return(nil),
+		record(statements[1], "rolled back"),
+	)
+	if err := c.applyMigrationStatements(context.Background(), statements); err == nil {
+		t.Fatal("applyMigrationStatements() did not error")
+	}
+
+	// Success
+	gomock.InOrder(
+		mockConn.EXPECT().Exec(gomock.Any(), statements[1].Query).Return(nil),
+		record(statements[1], "applied"),
+		mockConn.EXPECT().Exec(gomock.Any(), statements[2].Query).Return(nil),
+		record(statements[2], "applied"),
+	)
+	if err := c.applyMigrationStatements(context.Background(), statements[1:3]); err != nil {
+		t.Fatalf("applyMigrationStatements() error:\n%+v", err)
+	}
+
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_migrations_", "rolledback_statements_total")
+	expectedMetrics := map[string]string{
+		"rolledback_statements_total": "2",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// History of migrations
+	applied := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any()).
+		SetArg(1, []appliedMigration{
+			{
+				Applied:  applied,
+				Version:  hash,
+				Table:    "flows_1m0s",
+				Query:    statements[1].Query,
+				Rollback: statements[1].Rollback,
+				Status:   "applied",
+			},
+		}).
+		Return(nil)
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "applied migrations",
+			URL:         "/api/v0/orchestrator/clickhouse/migrations",
+			JSONOutput: gin.H{
+				"migrations": []gin.H{
+					{
+						"applied":  "2024-04-11T08:00:00Z",
+						"version":  hash,
+						"table":    "flows_1m0s",
+						"query":    statements[1].Query,
+						"rollback": statements[1].Rollback,
+						"status":   "applied",
+					},
+				},
+			},
+		},
+	})
+}
@@ -17,7 +17,9 @@ import (
 
 	"akvorado/common/clickhousedb"
 	"akvorado/common/daemon"
+	"akvorado/common/helpers"
 	"akvorado/common/httpserver"
+	"akvorado/common/leader"
 	"akvorado/common/reporter"
 	"akvorado/common/schema"
 )
@@ -35,6 +37,14 @@ type Component struct {
 	networkSourcesFetcher *remotedatasourcefetcher.Component[externalNetworkAttributes]
 	networkSources        map[string][]externalNetworkAttributes
 	networkSourcesLock    sync.RWMutex
+
+	systemMetricsLastViewCheck time.Time
+	schemaDrift                *schemaDriftResult
+	schemaDriftLock            sync.RWMutex
+	integrity                  *integrityResult
+	integrityLock              sync.RWMutex
+	schemaVersions             []schemaVersion
+	schemaVersionsLock         sync.RWMutex
 }
 
 // Dependencies define the dependencies of the ClickHouse configurator.
@@ -43,6 +53,7 @@ type Dependencies struct {
 	HTTP       *httpserver.Component
 	ClickHouse *clickhousedb.Component
 	Schema     *schema.Component
+	Leader     *leader.Component // optional
 }
 
 // New creates a new ClickHouse component.
@@ -61,6 +72,16 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize remote data source fetcher component: %w", err)
 	}
+	for _, export := range c.config.Exports {
+		if _, err := exportQuery(export, time.Time{}, time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	for _, migration := range c.config.ColumnMigrations {
+		if _, ok := c.d.Schema.LookupColumnByName(migration.Column); !ok {
+			return nil, fmt.Errorf("unknown column %q in column migrations", migration.Column)
+		}
+	}
 	c.initMetrics()
 	if err := c.registerHTTPHandlers(); err != nil {
 		return nil, err
@@ -89,20 +110,32 @@ func (c *Component) Start() error {
 		customBackoff.MaxElapsedTime = 0
 		customBackoff.InitialInterval = time.Second
 		for {
-			if !c.config.SkipMigrations {
+			retryable := true
+			if !c.config.SkipMigrations && !c.isLeader() {
+				// Check again soon in case we become the leader.
+				c.r.Debug().Msg("not the leader, skipping database migration")
+				customBackoff.Reset()
+			} else if !c.config.SkipMigrations {
 				c.r.Info().Msg("attempting database migration")
-				if err := c.migrateDatabase(); err != nil {
-					c.r.Err(err).Msg("database migration error")
-				} else {
+				err := c.migrateDatabase()
+				if err == nil {
 					return nil
 				}
+				err = clickhousedb.ClassifyError(err)
+				class := helpers.ErrorClassOf(err)
+				c.r.Err(err).Stringer("class", class).Msg("database migration error")
 				if !migrationsOnce {
 					close(c.migrationsOnce)
 					migrationsOnce = true
 					customBackoff.Reset()
 				}
+				retryable = class.Retryable()
 			}
 			next := customBackoff.NextBackOff()
+			if !retryable {
+				// Retrying soon is useless, wait for the longest interval.
+				next = customBackoff.MaxInterval
+			}
 			select {
 			case <-c.t.Dying():
 				return nil
@@ -116,9 +149,40 @@ func (c *Component) Start() error {
 		return fmt.Errorf("unable to start network sources fetcher component: %w", err)
 	}
 
+	// Scheduled exports
+	for _, export := range c.config.Exports {
+		c.scheduleExport(export)
+	}
+
+	// ClickHouse system metrics
+	if c.config.SystemMetricsInterval > 0 {
+		c.scheduleSystemMetrics()
+	}
+
+	// Schema drift detection
+	if c.config.SchemaCheckInterval > 0 {
+		c.scheduleSchemaCheck()
+	}
+
+	// Integrity check of consolidated tables
+	if c.config.IntegrityCheckInterval > 0 {
+		c.scheduleIntegrityCheck()
+	}
+
+	// Cleanup of previous schema versions
+	if c.config.SchemaVersionsRetention > 0 && !c.config.SkipMigrations {
+		c.scheduleSchemaVersionsCleanup()
+	}
+
 	return nil
 }
 
+// isLeader tells if this instance should run singleton jobs, like migrations
+// or scheduled exports.
+func (c *Component) isLeader() bool {
+	return c.d.Leader == nil || c.d.Leader.IsLeader()
+}
+
 // Stop stops the ClickHouse component.
 func (c *Component) Stop() error {
 	c.r.Info().Msg("stopping ClickHouse component")
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slices"
+
+	"akvorado/common/schema"
+)
+
+// schemaDifference is a difference between the expected schema and the
+// schema of the database.
+type schemaDifference struct {
+	Table    string `json:"table"`
+	Column   string `json:"column,omitempty"`
+	Kind     string `json:"kind"`
+	Expected string `json:"expected,omitempty"`
+	Got      string `json:"got,omitempty"`
+}
+
+// schemaDriftResult is the result of the last schema check.
+type schemaDriftResult struct {
+	Checked     time.Time          `json:"checked"`
+	Differences []schemaDifference `json:"differences"`
+}
+
+// existingColumn is a column as described by system.columns.
+type existingColumn struct {
+	Table            string `ch:"table"`
+	Name             string `ch:"name"`
+	Type             string `ch:"type"`
+	CompressionCodec string `ch:"compression_codec"`
+	DefaultKind      string `ch:"default_kind"`
+}
+
+// existingTable is a table as described by system.tables.
+type existingTable struct {
+	Name string `ch:"name"`
+}
+
+// scheduleSchemaCheck periodically compares the schema of the database with
+// the expected one.
+func (c *Component) scheduleSchemaCheck() {
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.SchemaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+			}
+			if !c.config.SkipMigrations && !c.config.DryRunMigrations {
+				select {
+				case <-c.migrationsDone:
+				default:
+					c.r.Debug().Msg("migrations not done, skipping schema check")
+					continue
+				}
+			}
+			ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.SchemaCheckInterval)
+			err := c.checkSchema(ctx, time.Now())
+			cancel()
+			if err != nil {
+				c.r.Err(err).Msg("cannot check database schema")
+				c.metrics.schemaCheckErrors.Inc()
+			}
+		}
+	})
+}
+
+// checkSchema compares the schema of the database with the expected one and
+// records the differences.
+func (c *Component) checkSchema(ctx context.Context, now time.Time) error {
+	differences, err := c.schemaDifferences(ctx)
+	if err != nil {
+		return err
+	}
+	c.schemaDriftLock.Lock()
+	c.schemaDrift = &schemaDriftResult{
+		Checked:     now,
+		Differences: differences,
+	}
+	c.schemaDriftLock.Unlock()
+
+	c.metrics.schemaDifferences.Reset()
+	for _, difference := range differences {
+		c.metrics.schemaDifferences.WithLabelValues(difference.Table, difference.Kind).Inc()
+	}
+	if len(differences) > 0 {
+		c.r.Warn().Msgf("database schema differs from the expected one (%d differences)",
+			len(differences))
+	}
+	return nil
+}
+
+// schemaDifferences returns the differences between the expected schema and
+// the schema of the database. Only the flow tables and the associated
+// consumers are checked.
+func (c *Component) schemaDifferences(ctx context.Context) ([]schemaDifference, error) {
+	var tables []existingTable
+	if err := c.d.ClickHouse.Select(ctx, &tables, `
+SELECT name
+FROM system.tables
+WHERE database = $1
+`, c.config.Database); err != nil {
+		return nil, fmt.Errorf("cannot query tables: %w", err)
+	}
+	var columns []existingColumn
+	if err := c.d.ClickHouse.Select(ctx, &columns, `
+SELECT table, name, type, compression_codec, default_kind
+FROM system.columns
+WHERE database = $1
+ORDER BY table, position
+`, c.config.Database); err != nil {
+		return nil, fmt.Errorf("cannot query columns: %w", err)
+	}
+
+	differences := []schemaDifference{}
+	tableExists := func(name string) bool {
+		return slices.ContainsFunc(tables, func(table existingTable) bool {
+			return table.Name == name
+		})
+	}
+	expectTable := func(name string) bool {
+		if !tableExists(name) {
+			differences = append(differences, schemaDifference{
+				Table: name,
+				Kind:  "missing table",
+			})
+			return false
+		}
+		return true
+	}
+
+	rawTableName := fmt.Sprintf("flows_%s_raw", c.d.Schema.ProtobufMessageHash())
+	expectTable(rawTableName)
+	expectTable(fmt.Sprintf("%s_consumer", rawTableName))
+	for _, resolution := range c.config.Resolutions {
+		tableName := "flows"
+		if resolution.Interval > 0 {
+			tableName = fmt.Sprintf("flows_%s", resolution.Interval)
+			expectTable(fmt.Sprintf("%s_consumer", tableName))
+		}
+		if !expectTable(tableName) {
+			continue
+		}
+
+		tableColumns := []existingColumn{}
+		for _, column := range columns {
+			if column.Table == tableName {
+				tableColumns = append(tableColumns, column)
+			}
+		}
+		wantedColumns := c.d.Schema.Columns()
+		if resolution.Interval > 0 {
+			wantedColumns = slices.DeleteFunc(wantedColumns, func(column schema.Column) bool {
+				return column.ClickHouseMainOnly
+			})
+		}
+	outer:
+		for _, wantedColumn := range wantedColumns {
+			for _, existingColumn := range tableColumns {
+				if existingColumn.Name != wantedColumn.Name {
+					continue
+				}
+				if existingColumn.Type != wantedColumn.ClickHouseType {
+					differences = append(differences, schemaDifference{
+						Table:    tableName,
+						Column:   wantedColumn.Name,
+						Kind:     "type mismatch",
+						Expected: wantedColumn.ClickHouseType,
+						Got:      existingColumn.Type,
+					})
+				}
+				if wantedColumn.ClickHouseCodec != "" {
+					wantedCodec := fmt.Sprintf("CODEC(%s)", wantedColumn.ClickHouseCodec)
+					if wantedCodec != existingColumn.CompressionCodec {
+						differences = append(differences, schemaDifference{
+							Table:    tableName,
+							Column:   wantedColumn.Name,
+							Kind:     "codec mismatch",
+							Expected: wantedCodec,
+							Got:      existingColumn.CompressionCodec,
+						})
+					}
+				}
+				if (wantedColumn.ClickHouseAlias != "") != (existingColumn.DefaultKind == "ALIAS") {
+					differences = append(differences, schemaDifference{
+						Table:    tableName,
+						Column:   wantedColumn.Name,
+						Kind:     "alias mismatch",
+						Expected: wantedColumn.ClickHouseAlias,
+					})
+				}
+				continue outer
+			}
+			differences = append(differences, schemaDifference{
+				Table:    tableName,
+				Column:   wantedColumn.Name,
+				Kind:     "missing column",
+				Expected: wantedColumn.ClickHouseType,
+			})
+		}
+
+		// Columns unknown to the schema. Disabled columns are not removed
+		// by migrations and are therefore accepted.
+		for _, existingColumn := range tableColumns {
+			column, ok := c.d.Schema.LookupColumnByName(existingColumn.Name)
+			if !ok || (resolution.Interval > 0 && column.ClickHouseMainOnly) {
+				differences = append(differences, schemaDifference{
+					Table:  tableName,
+					Column: existingColumn.Name,
+					Kind:   "unexpected column",
+					Got:    existingColumn.Type,
+				})
+			}
+		}
+	}
+	return differences, nil
+}
+
+// schemaDriftHandlerFunc returns the result of the last schema check.
+func (c *Component) schemaDriftHandlerFunc(gc *gin.Context) {
+	c.schemaDriftLock.RLock()
+	defer c.schemaDriftLock.RUnlock()
+	if c.schemaDrift == nil {
+		gc.JSON(http.StatusServiceUnavailable, gin.H{"message": "Database schema not checked yet."})
+		return
+	}
+	gc.JSON(http.StatusOK, c.schemaDrift)
+}
@@ -0,0 +1,150 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SchemaCheckInterval = 0
+	config.Resolutions = []ResolutionConfiguration{
+		{Interval: 0, TTL: 24 * time.Hour},
+		{Interval: time.Minute, TTL: 24 * time.Hour},
+	}
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       h,
+		Schema:     sch,
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "not checked yet",
+			URL:         "/api/v0/orchestrator/clickhouse/schema-drift",
+			StatusCode:  503,
+			JSONOutput:  gin.H{"message": "Database schema not checked yet."},
+		},
+	})
+
+	// Build a database matching the expected schema, then alter it.
+	rawTableName := fmt.Sprintf("flows_%s_raw", sch.ProtobufMessageHash())
+	tables := []existingTable{
+		{"flows"},
+		{"flows_1m0s"},
+		{rawTableName},
+		{rawTableName + "_consumer"},
+	}
+	columns := []existingColumn{}
+	for _, table := range []string{"flows", "flows_1m0s"} {
+		for _, column := range sch.Columns() {
+			if table != "flows" && column.ClickHouseMainOnly {
+				continue
+			}
+			existing := existingColumn{
+				Table: table,
+				Name:  column.Name,
+				Type:  column.ClickHouseType,
+			}
+			if column.ClickHouseCodec != "" {
+				existing.CompressionCodec = fmt.Sprintf("CODEC(%s)", column.ClickHouseCodec)
+			}
+			if column.ClickHouseAlias != "" {
+				existing.DefaultKind = "ALIAS"
+			}
+			switch {
+			case table == "flows" && column.Name == "SrcAS":
+				existing.Type = "UInt16"
+			case table == "flows_1m0s" && column.Name == "DstAS":
+				continue
+			}
+			columns = append(columns, existing)
+		}
+	}
+	columns = append(columns, existingColumn{
+		Table: "flows",
+		Name:  "Manual",
+		Type:  "String",
+	})
+
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+		SetArg(1, tables).
+		Return(nil)
+	mockConn.EXPECT().
+		Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+		SetArg(1, columns).
+		Return(nil)
+	if err := c.checkSchema(context.Background(), now); err != nil {
+		t.Fatalf("checkSchema() error:\n%+v", err)
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "drift detected",
+			URL:         "/api/v0/orchestrator/clickhouse/schema-drift",
+			JSONOutput: gin.H{
+				"checked": "2024-04-11T08:00:00Z",
+				"differences": []gin.H{
+					{
+						"table":    "flows",
+						"column":   "SrcAS",
+						"kind":     "type mismatch",
+						"expected": "UInt32",
+						"got":      "UInt16",
+					}, {
+						"table":  "flows",
+						"column": "Manual",
+						"kind":   "unexpected column",
+						"got":    "String",
+					}, {
+						"table": "flows_1m0s_consumer",
+						"kind":  "missing table",
+					}, {
+						"table":    "flows_1m0s",
+						"column":   "DstAS",
+						"kind":     "missing column",
+						"expected": "UInt32",
+					},
+				},
+			},
+		},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_schema_", "differences")
+	expectedMetrics := map[string]string{
+		`differences{kind="missing column",table="flows_1m0s"}`:         "1",
+		`differences{kind="missing table",table="flows_1m0s_consumer"}`: "1",
+		`differences{kind="type mismatch",table="flows"}`:               "1",
+		`differences{kind="unexpected column",table="flows"}`:           "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,225 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"akvorado/common/schema"
+)
+
+// schemaVersion is a version of the flow schema. Each version has its own
+// Kafka topic and its own raw flows table. Keeping the tables of the previous
+// versions allows inlets still using them to be upgraded later.
+type schemaVersion struct {
+	Hash       string    `ch:"hash" json:"hash"`
+	Definition string    `ch:"definition" json:"-"`
+	Columns    []string  `ch:"columns" json:"columns"`
+	FirstSeen  time.Time `ch:"first_seen" json:"first-seen"`
+}
+
+// currentSchemaVersion returns the version of the current flow schema.
+func (c *Component) currentSchemaVersion() schemaVersion {
+	columns := []string{}
+	for _, column := range c.d.Schema.Columns() {
+		for _, column := range append([]schema.Column{column}, column.ClickHouseTransformFrom...) {
+			if column.ProtobufIndex >= 0 {
+				columns = append(columns, column.Name)
+			}
+		}
+	}
+	return schemaVersion{
+		Hash:       c.d.Schema.ProtobufMessageHash(),
+		Definition: c.d.Schema.ProtobufDefinition(),
+		Columns:    columns,
+	}
+}
+
+// createSchemaVersionsTable creates the table registering the flow schema
+// versions.
+func (c *Component) createSchemaVersionsTable(ctx context.Context) error {
+	if ok, err := c.tableAlreadyExists(ctx, "schema_versions", "name", "schema_versions"); err != nil {
+		return err
+	} else if ok {
+		c.r.Info().Msg("schema versions table already exists, skip migration")
+		return errSkipStep
+	}
+	c.r.Info().Msg("create schema versions table")
+	if err := c.d.ClickHouse.Exec(ctx, `
+CREATE TABLE schema_versions (
+ hash String,
+ definition String,
+ columns Array(String),
+ first_seen DateTime
+)
+ENGINE = ReplacingMergeTree
+ORDER BY hash`); err != nil {
+		return fmt.Errorf("cannot create schema versions table: %w", err)
+	}
+	return nil
+}
+
+// registerSchemaVersion registers the current flow schema version if it is
+// not already known.
+func (c *Component) registerSchemaVersion(ctx context.Context) error {
+	current := c.currentSchemaVersion()
+	row := c.d.ClickHouse.QueryRow(ctx,
+		`SELECT count() FROM schema_versions WHERE hash = $1`, current.Hash)
+	var count uint64
+	if err := row.Scan(&count); err != nil {
+		return fmt.Errorf("cannot check schema version: %w", err)
+	}
+	if count > 0 {
+		c.r.Info().Msg("schema version already registered, skip migration")
+		return errSkipStep
+	}
+	c.r.Info().Str("hash", current.Hash).Msg("register schema version")
+	if err := c.d.ClickHouse.Exec(ctx,
+		`INSERT INTO schema_versions SELECT $1, $2, $3, now()`,
+		current.Hash, current.Definition, current.Columns); err != nil {
+		return fmt.Errorf("cannot register schema version: %w", err)
+	}
+	return nil
+}
+
+// loadSchemaVersions loads the registered flow schema versions, from the
+// oldest to the most recent one.
+func (c *Component) loadSchemaVersions(ctx context.Context) error {
+	var versions []schemaVersion
+	if err := c.d.ClickHouse.Select(ctx, &versions, `
+SELECT hash, definition, columns, first_seen
+FROM schema_versions FINAL
+ORDER BY first_seen, hash
+`); err != nil {
+		return fmt.Errorf("cannot load schema versions: %w", err)
+	}
+	c.schemaVersionsLock.Lock()
+	c.schemaVersions = versions
+	c.schemaVersionsLock.Unlock()
+	return nil
+}
+
+// expiredSchemaVersions returns the versions superseded by a more recent one
+// for more than the provided retention. The current version never expires.
+func expiredSchemaVersions(versions []schemaVersion, current string, now time.Time, retention time.Duration) []schemaVersion {
+	expired := []schemaVersion{}
+	for idx, version := range versions {
+		if version.Hash == current || idx == len(versions)-1 {
+			continue
+		}
+		if superseded := versions[idx+1].FirstSeen; now.Sub(superseded) > retention {
+			expired = append(expired, version)
+		}
+	}
+	return expired
+}
+
+// cleanupSchemaVersions drops the raw flows tables of expired schema versions
+// and unregisters them.
+func (c *Component) cleanupSchemaVersions(ctx context.Context, now time.Time) error {
+	if err := c.loadSchemaVersions(ctx); err != nil {
+		return err
+	}
+	c.schemaVersionsLock.RLock()
+	expired := expiredSchemaVersions(c.schemaVersions, c.d.Schema.ProtobufMessageHash(),
+		now, c.config.SchemaVersionsRetention)
+	c.schemaVersionsLock.RUnlock()
+	if len(expired) == 0 {
+		return nil
+	}
+	for _, version := range expired {
+		c.r.Info().Str("hash", version.Hash).Msg("drop expired schema version")
+		tableName := fmt.Sprintf("flows_%s_raw", version.Hash)
+		for _, table := range []string{
+			fmt.Sprintf("%s_consumer", tableName),
+			fmt.Sprintf("%s_errors", tableName),
+			tableName,
+		} {
+			if err := c.d.ClickHouse.Exec(ctx, fmt.Sprintf(`DROP TABLE IF EXISTS %s SYNC`, table)); err != nil {
+				return fmt.Errorf("cannot drop %s: %w", table, err)
+			}
+		}
+		if err := c.d.ClickHouse.Exec(ctx,
+			`ALTER TABLE schema_versions DELETE WHERE hash = $1`, version.Hash); err != nil {
+			return fmt.Errorf("cannot unregister schema version %s: %w", version.Hash, err)
+		}
+		c.metrics.schemaVersionsDropped.Inc()
+	}
+	return c.loadSchemaVersions(ctx)
+}
+
+// scheduleSchemaVersionsCleanup periodically drops the expired schema
+// versions.
+func (c *Component) scheduleSchemaVersionsCleanup() {
+	c.t.Go(func() error {
+		select {
+		case <-c.t.Dying():
+			return nil
+		case <-c.migrationsDone:
+		}
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if c.isLeader() {
+				ctx, cancel := context.WithTimeout(c.t.Context(nil), time.Minute)
+				err := c.cleanupSchemaVersions(ctx, time.Now())
+				cancel()
+				if err != nil {
+					c.r.Err(err).Msg("cannot cleanup schema versions")
+				}
+			}
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// knownSchemaVersions returns the registered schema versions, including the
+// current one, even when not registered yet.
+func (c *Component) knownSchemaVersions() []schemaVersion {
+	current := c.currentSchemaVersion()
+	c.schemaVersionsLock.RLock()
+	defer c.schemaVersionsLock.RUnlock()
+	versions := []schemaVersion{}
+	found := false
+	for _, version := range c.schemaVersions {
+		if version.Hash == current.Hash {
+			found = true
+		}
+		versions = append(versions, version)
+	}
+	if !found {
+		versions = append(versions, current)
+	}
+	return versions
+}
+
+// schemaVersionsHandlerFunc lists the known schema versions.
+func (c *Component) schemaVersionsHandlerFunc(gc *gin.Context) {
+	gc.JSON(http.StatusOK, gin.H{
+		"current":  c.d.Schema.ProtobufMessageHash(),
+		"versions": c.knownSchemaVersions(),
+	})
+}
+
+// schemaVersionHandlerFunc returns the protobuf definition of a schema
+// version.
+func (c *Component) schemaVersionHandlerFunc(gc *gin.Context) {
+	hash := gc.Param("hash")
+	for _, version := range c.knownSchemaVersions() {
+		if version.Hash == hash {
+			gc.String(http.StatusOK, version.Definition)
+			return
+		}
+	}
+	gc.JSON(http.StatusNotFound, gin.H{"message": "Schema version not found."})
+}
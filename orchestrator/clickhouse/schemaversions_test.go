@@ -0,0 +1,174 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestExpiredSchemaVersions(t *testing.T) {
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	versions := []schemaVersion{
+		{Hash: "A", FirstSeen: now.Add(-30 * 24 * time.Hour)},
+		{Hash: "B", FirstSeen: now.Add(-10 * 24 * time.Hour)},
+		{Hash: "C", FirstSeen: now.Add(-2 * 24 * time.Hour)},
+		{Hash: "D", FirstSeen: now.Add(-time.Hour)},
+	}
+	cases := []struct {
+		Description string
+		Current     string
+		Expected    []string
+	}{
+		{"current is the last one", "D", []string{"A"}},
+		{"current is an old one", "C", []string{"A"}},
+		{"current is the first one", "A", []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.Description, func(t *testing.T) {
+			got := []string{}
+			for _, version := range expiredSchemaVersions(versions, tc.Current, now, 7*24*time.Hour) {
+				got = append(got, version.Hash)
+			}
+			if diff := helpers.Diff(got, tc.Expected); diff != "" {
+				t.Fatalf("expiredSchemaVersions() (-got, +want):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestSchemaVersions(t *testing.T) {
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	h := httpserver.NewMock(t, r)
+	sch := schema.NewMock(t)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SchemaCheckInterval = 0
+	config.SchemaVersionsRetention = 7 * 24 * time.Hour
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       h,
+		Schema:     sch,
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	helpers.StartStop(t, c)
+
+	current := c.currentSchemaVersion()
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "only current version",
+			URL:         "/api/v0/orchestrator/clickhouse/schemas",
+			JSONOutput: gin.H{
+				"current": current.Hash,
+				"versions": []gin.H{
+					{
+						"hash":       current.Hash,
+						"columns":    current.Columns,
+						"first-seen": "0001-01-01T00:00:00Z",
+					},
+				},
+			},
+		}, {
+			Description: "current definition",
+			URL:         "/api/v0/orchestrator/clickhouse/schemas/" + current.Hash,
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{"", `syntax = "proto3";`},
+		}, {
+			Description: "unknown definition",
+			URL:         "/api/v0/orchestrator/clickhouse/schemas/UNKNOWN",
+			StatusCode:  404,
+			JSONOutput:  gin.H{"message": "Schema version not found."},
+		},
+	})
+
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	old := schemaVersion{
+		Hash:       "OLD",
+		Definition: `syntax = "proto3"; // old`,
+		Columns:    []string{"TimeReceived"},
+		FirstSeen:  now.Add(-30 * 24 * time.Hour),
+	}
+	recent := schemaVersion{
+		Hash:       "RECENT",
+		Definition: `syntax = "proto3"; // recent`,
+		Columns:    []string{"TimeReceived", "Bytes"},
+		FirstSeen:  now.Add(-20 * 24 * time.Hour),
+	}
+	registered := current
+	registered.FirstSeen = now.Add(-24 * time.Hour)
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, []schemaVersion{old, recent, registered}).
+			Return(nil),
+		mockConn.EXPECT().
+			Exec(gomock.Any(), "DROP TABLE IF EXISTS flows_OLD_raw_consumer SYNC").
+			Return(nil),
+		mockConn.EXPECT().
+			Exec(gomock.Any(), "DROP TABLE IF EXISTS flows_OLD_raw_errors SYNC").
+			Return(nil),
+		mockConn.EXPECT().
+			Exec(gomock.Any(), "DROP TABLE IF EXISTS flows_OLD_raw SYNC").
+			Return(nil),
+		mockConn.EXPECT().
+			Exec(gomock.Any(), "ALTER TABLE schema_versions DELETE WHERE hash = $1", "OLD").
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any()).
+			SetArg(1, []schemaVersion{recent, registered}).
+			Return(nil),
+	)
+	if err := c.cleanupSchemaVersions(context.Background(), now); err != nil {
+		t.Fatalf("cleanupSchemaVersions() error:\n%+v", err)
+	}
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			Description: "registered versions",
+			URL:         "/api/v0/orchestrator/clickhouse/schemas",
+			JSONOutput: gin.H{
+				"current": current.Hash,
+				"versions": []gin.H{
+					{
+						"hash":       "RECENT",
+						"columns":    []string{"TimeReceived", "Bytes"},
+						"first-seen": "2024-03-22T08:00:00Z",
+					}, {
+						"hash":       current.Hash,
+						"columns":    current.Columns,
+						"first-seen": "2024-04-10T08:00:00Z",
+					},
+				},
+			},
+		}, {
+			Description: "previous definition",
+			URL:         "/api/v0/orchestrator/clickhouse/schemas/RECENT",
+			ContentType: "text/plain; charset=utf-8",
+			FirstLines:  []string{`syntax = "proto3"; // recent`},
+		},
+	})
+
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_", "schema_versions_dropped_total")
+	expectedMetrics := map[string]string{
+		"schema_versions_dropped_total": "1",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
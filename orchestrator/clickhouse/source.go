@@ -25,5 +25,15 @@ func (c *Component) UpdateRemoteDataSource(ctx context.Context, name string, sou
 	c.networkSourcesLock.Lock()
 	c.networkSources[name] = results
 	c.networkSourcesLock.Unlock()
+
+	// Make the new networks available immediately. Before migrations are
+	// done, the dictionary may not exist yet: it will be loaded on creation.
+	select {
+	case <-c.migrationsDone:
+		if err := c.reloadDictionary(ctx, "networks"); err != nil {
+			c.r.Err(err).Str("source", name).Msg("cannot reload networks dictionary")
+		}
+	default:
+	}
 	return len(results), nil
 }
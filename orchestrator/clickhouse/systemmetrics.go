@@ -0,0 +1,243 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+
+	"akvorado/common/kafka"
+)
+
+// kafkaConsumerAssignment is a partition assigned to a consumer of a
+// table using the Kafka engine.
+type kafkaConsumerAssignment struct {
+	Table     string `ch:"table"`
+	Topic     string `ch:"topic"`
+	Partition int32  `ch:"partition"`
+	Offset    int64  `ch:"offset"`
+}
+
+// kafkaConsumerStats are statistics about the consumers of a table using
+// the Kafka engine.
+type kafkaConsumerStats struct {
+	Table      string `ch:"table"`
+	Messages   uint64 `ch:"messages"`
+	Exceptions uint64 `ch:"exceptions"`
+}
+
+// tableParts are statistics about the active parts of a table.
+type tableParts struct {
+	Table string `ch:"table"`
+	Parts uint64 `ch:"parts"`
+	Rows  uint64 `ch:"rows"`
+	Bytes uint64 `ch:"bytes"`
+}
+
+// tableMerges is the number of merges in progress for a table.
+type tableMerges struct {
+	Table  string `ch:"table"`
+	Merges uint64 `ch:"merges"`
+}
+
+// viewErrors is the number of failed executions of a materialized view.
+type viewErrors struct {
+	View   string `ch:"view"`
+	Errors uint64 `ch:"errors"`
+}
+
+// scheduleSystemMetrics periodically collects metrics from ClickHouse system
+// tables.
+func (c *Component) scheduleSystemMetrics() {
+	c.t.Go(func() error {
+		ticker := time.NewTicker(c.config.SystemMetricsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.t.Dying():
+				return nil
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(c.t.Context(nil), c.config.SystemMetricsInterval)
+				c.collectSystemMetrics(ctx, time.Now())
+				cancel()
+			}
+		}
+	})
+}
+
+// collectSystemMetrics queries ClickHouse system tables to update the
+// associated metrics. Each table is queried independently: an error for one
+// of them does not prevent the others from being updated.
+func (c *Component) collectSystemMetrics(ctx context.Context, now time.Time) {
+	collectors := []struct {
+		name    string
+		collect func(context.Context, time.Time) error
+	}{
+		{"kafka_consumers", c.collectKafkaConsumerMetrics},
+		{"parts", c.collectPartsMetrics},
+		{"merges", c.collectMergesMetrics},
+		{"query_views_log", c.collectViewErrorsMetrics},
+	}
+	for _, collector := range collectors {
+		if err := collector.collect(ctx, now); err != nil {
+			c.r.Err(err).Str("table", collector.name).Msg("cannot collect ClickHouse system metrics")
+			c.metrics.systemMetricsErrors.WithLabelValues(collector.name).Inc()
+		}
+	}
+}
+
+// collectKafkaConsumerMetrics updates metrics about the Kafka engine
+// consumers. The lag is computed by comparing the current offset of each
+// assigned partition with the newest offset known by Kafka.
+func (c *Component) collectKafkaConsumerMetrics(ctx context.Context, _ time.Time) error {
+	var stats []kafkaConsumerStats
+	if err := c.d.ClickHouse.Select(ctx, &stats, `
+SELECT table, sum(num_messages_read) AS messages, sum(length(exceptions.text)) AS exceptions
+FROM system.kafka_consumers
+WHERE database = $1
+GROUP BY table
+`, c.config.Database); err != nil {
+		return fmt.Errorf("cannot query Kafka consumers: %w", err)
+	}
+	var assignments []kafkaConsumerAssignment
+	if err := c.d.ClickHouse.Select(ctx, &assignments, `
+SELECT table, topic, partition, offset
+FROM system.kafka_consumers
+ARRAY JOIN assignments.topic AS topic, assignments.partition_id AS partition, assignments.current_offset AS offset
+WHERE database = $1
+`, c.config.Database); err != nil {
+		return fmt.Errorf("cannot query Kafka consumer assignments: %w", err)
+	}
+
+	c.metrics.kafkaConsumerMessages.Reset()
+	c.metrics.kafkaConsumerExceptions.Reset()
+	for _, stat := range stats {
+		c.metrics.kafkaConsumerMessages.WithLabelValues(stat.Table).Set(float64(stat.Messages))
+		c.metrics.kafkaConsumerExceptions.WithLabelValues(stat.Table).Set(float64(stat.Exceptions))
+	}
+
+	c.metrics.kafkaConsumerLag.Reset()
+	partitions := map[string][]int32{}
+	for _, assignment := range assignments {
+		// A negative offset means nothing has been consumed yet.
+		if assignment.Offset >= 0 {
+			partitions[assignment.Topic] = append(partitions[assignment.Topic], assignment.Partition)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil
+	}
+	newest, err := c.kafkaNewestOffsets(partitions)
+	if err != nil {
+		return err
+	}
+	for _, assignment := range assignments {
+		offset, ok := newest[assignment.Topic][assignment.Partition]
+		if !ok || assignment.Offset < 0 {
+			continue
+		}
+		lag := max(offset-assignment.Offset, 0)
+		c.metrics.kafkaConsumerLag.WithLabelValues(
+			assignment.Table, assignment.Topic, strconv.Itoa(int(assignment.Partition)),
+		).Set(float64(lag))
+	}
+	return nil
+}
+
+// kafkaNewestOffsets returns the newest offset of the provided partitions.
+func (c *Component) kafkaNewestOffsets(partitions map[string][]int32) (map[string]map[int32]int64, error) {
+	kafkaConfig, err := kafka.NewConfig(c.config.Kafka.Configuration)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(c.config.Kafka.Brokers, kafkaConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Kafka: %w", err)
+	}
+	defer client.Close()
+	offsets := map[string]map[int32]int64{}
+	for topic, topicPartitions := range partitions {
+		offsets[topic] = map[int32]int64{}
+		for _, partition := range topicPartitions {
+			offset, err := client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("cannot get newest offset for %s/%d: %w", topic, partition, err)
+			}
+			offsets[topic][partition] = offset
+		}
+	}
+	return offsets, nil
+}
+
+// collectPartsMetrics updates metrics about the active parts of each table.
+func (c *Component) collectPartsMetrics(ctx context.Context, _ time.Time) error {
+	var parts []tableParts
+	if err := c.d.ClickHouse.Select(ctx, &parts, `
+SELECT table, count() AS parts, sum(rows) AS rows, sum(bytes_on_disk) AS bytes
+FROM system.parts
+WHERE database = $1 AND active
+GROUP BY table
+`, c.config.Database); err != nil {
+		return fmt.Errorf("cannot query parts: %w", err)
+	}
+	c.metrics.tableParts.Reset()
+	c.metrics.tableRows.Reset()
+	c.metrics.tableBytes.Reset()
+	for _, part := range parts {
+		c.metrics.tableParts.WithLabelValues(part.Table).Set(float64(part.Parts))
+		c.metrics.tableRows.WithLabelValues(part.Table).Set(float64(part.Rows))
+		c.metrics.tableBytes.WithLabelValues(part.Table).Set(float64(part.Bytes))
+	}
+	return nil
+}
+
+// collectMergesMetrics updates metrics about the merges in progress.
+func (c *Component) collectMergesMetrics(ctx context.Context, _ time.Time) error {
+	var merges []tableMerges
+	if err := c.d.ClickHouse.Select(ctx, &merges, `
+SELECT table, count() AS merges
+FROM system.merges
+WHERE database = $1
+GROUP BY table
+`, c.config.Database); err != nil {
+		return fmt.Errorf("cannot query merges: %w", err)
+	}
+	c.metrics.tableMerges.Reset()
+	for _, merge := range merges {
+		c.metrics.tableMerges.WithLabelValues(merge.Table).Set(float64(merge.Merges))
+	}
+	return nil
+}
+
+// collectViewErrorsMetrics counts the failed executions of materialized
+// views since the last collection.
+func (c *Component) collectViewErrorsMetrics(ctx context.Context, now time.Time) error {
+	now = now.Truncate(time.Second)
+	since := c.systemMetricsLastViewCheck
+	if since.IsZero() {
+		// Do not count errors that happened before we started.
+		c.systemMetricsLastViewCheck = now
+		return nil
+	}
+	var failures []viewErrors
+	if err := c.d.ClickHouse.Select(ctx, &failures, `
+SELECT view_name AS view, count() AS errors
+FROM system.query_views_log
+WHERE event_time >= $1 AND event_time < $2
+AND startsWith(view_name, $3)
+AND status != 'QueryFinish'
+GROUP BY view
+`, since, now, c.config.Database+"."); err != nil {
+		return fmt.Errorf("cannot query materialized view errors: %w", err)
+	}
+	c.systemMetricsLastViewCheck = now
+	for _, viewError := range failures {
+		c.metrics.viewErrors.WithLabelValues(viewError.View).Add(float64(viewError.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: 2024 Free Mobile
+// SPDX-License-Identifier: AGPL-3.0-only
+
+package clickhouse
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/mock/gomock"
+
+	"akvorado/common/clickhousedb"
+	"akvorado/common/daemon"
+	"akvorado/common/helpers"
+	"akvorado/common/httpserver"
+	"akvorado/common/kafka"
+	"akvorado/common/reporter"
+	"akvorado/common/schema"
+)
+
+func TestCollectSystemMetrics(t *testing.T) {
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("flows-v5", 0, broker.BrokerID()).
+			SetLeader("flows-v5", 1, broker.BrokerID()),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset("flows-v5", 0, sarama.OffsetNewest, 1500).
+			SetOffset("flows-v5", 1, sarama.OffsetNewest, 2000),
+	})
+
+	r := reporter.NewMock(t)
+	chComponent, mockConn := clickhousedb.NewMock(t, r)
+	config := DefaultConfiguration()
+	config.SkipMigrations = true
+	config.SystemMetricsInterval = 0
+	config.Kafka.Configuration = kafka.DefaultConfiguration()
+	config.Kafka.Brokers = []string{broker.Addr()}
+	c, err := New(r, config, Dependencies{
+		Daemon:     daemon.NewMock(t),
+		HTTP:       httpserver.NewMock(t, r),
+		Schema:     schema.NewMock(t),
+		ClickHouse: chComponent,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+
+	now := time.Date(2024, 4, 11, 8, 0, 0, 0, time.UTC)
+	gomock.InOrder(
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []kafkaConsumerStats{{"flows_5_raw", 10000, 2}}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []kafkaConsumerAssignment{
+				{"flows_5_raw", "flows-v5", 0, 1000},
+				{"flows_5_raw", "flows-v5", 1, 2000},
+				{"flows_5_raw", "flows-v5", 2, -1001},
+			}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []tableParts{
+				{"flows", 120, 1_000_000, 50_000_000},
+				{"flows_1m0s", 40, 100_000, 4_000_000},
+			}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			Return(errors.New("unknown table")),
+		// First check of views only records the current time
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []kafkaConsumerStats{}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []kafkaConsumerAssignment{}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []tableParts{}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(), "default").
+			SetArg(1, []tableMerges{{"flows", 3}}).
+			Return(nil),
+		mockConn.EXPECT().
+			Select(gomock.Any(), gomock.Any(), gomock.Any(),
+				now, now.Add(time.Minute), "default.").
+			SetArg(1, []viewErrors{{"default.flows_1m0s_consumer", 4}}).
+			Return(nil),
+	)
+
+	c.collectSystemMetrics(context.Background(), now)
+	gotMetrics := r.GetMetrics("akvorado_orchestrator_clickhouse_",
+		"kafka_", "table_", "view_", "system_")
+	expectedMetrics := map[string]string{
+		`kafka_consumer_exceptions{table="flows_5_raw"}`:                         "2",
+		`kafka_consumer_lag{partition="0",table="flows_5_raw",topic="flows-v5"}`: "500",
+		`kafka_consumer_lag{partition="1",table="flows_5_raw",topic="flows-v5"}`: "0",
+		`kafka_consumer_messages{table="flows_5_raw"}`:                           "10000",
+		`system_metrics_errors_total{table="merges"}`:                            "1",
+		`table_bytes{table="flows"}`:                                             "5e+07",
+		`table_bytes{table="flows_1m0s"}`:                                        "4e+06",
+		`table_parts{table="flows"}`:                                             "120",
+		`table_parts{table="flows_1m0s"}`:                                        "40",
+		`table_rows{table="flows"}`:                                              "1e+06",
+		`table_rows{table="flows_1m0s"}`:                                         "100000",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+
+	// Stale series are removed on the next collection
+	c.collectSystemMetrics(context.Background(), now.Add(time.Minute))
+	gotMetrics = r.GetMetrics("akvorado_orchestrator_clickhouse_",
+		"kafka_", "table_", "view_", "system_")
+	expectedMetrics = map[string]string{
+		`system_metrics_errors_total{table="merges"}`:           "1",
+		`table_merges{table="flows"}`:                           "3",
+		`view_errors_total{view="default.flows_1m0s_consumer"}`: "4",
+	}
+	if diff := helpers.Diff(gotMetrics, expectedMetrics); diff != "" {
+		t.Fatalf("Metrics (-got, +want):\n%s", diff)
+	}
+}
@@ -4,10 +4,15 @@
 package orchestrator
 
 import (
+	"fmt"
 	"net/http"
+	"net/netip"
+	"sort"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+
+	"akvorado/common/helpers"
 )
 
 func (c *Component) configurationHandlerFunc(gc *gin.Context) {
@@ -41,3 +46,45 @@ func (c *Component) configurationHandlerFunc(gc *gin.Context) {
 	}
 	gc.YAML(http.StatusOK, configuration)
 }
+
+type subnetMatch struct {
+	Path   string       `json:"path"`
+	Subnet netip.Prefix `json:"subnet"`
+	Value  interface{}  `json:"value"`
+}
+
+// subnetsHandlerFunc returns, for each subnet map in the configurations of a
+// service, the subnet matching the provided IP address and its value.
+func (c *Component) subnetsHandlerFunc(gc *gin.Context) {
+	service := gc.Param("service")
+	ip, err := netip.ParseAddr(gc.Query("ip"))
+	if err != nil {
+		gc.JSON(http.StatusBadRequest, gin.H{"message": "Invalid IP address."})
+		return
+	}
+
+	c.serviceLock.Lock()
+	serviceConfigurations, ok := c.serviceConfigurations[ServiceType(service)]
+	matches := []subnetMatch{}
+	for idx, configuration := range serviceConfigurations {
+		helpers.WalkSubnetMaps(configuration, func(path string, sm helpers.SubnetMapInspector) {
+			if subnet, value, ok := sm.LookupPrefixValue(ip); ok {
+				matches = append(matches, subnetMatch{
+					Path:   fmt.Sprintf("%d.%s", idx, path),
+					Subnet: subnet,
+					Value:  value,
+				})
+			}
+		})
+	}
+	c.serviceLock.Unlock()
+
+	if !ok || len(serviceConfigurations) == 0 {
+		gc.JSON(http.StatusNotFound, gin.H{"message": "Configuration not found."})
+		return
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Path < matches[j].Path
+	})
+	gc.JSON(http.StatusOK, gin.H{"matches": matches})
+}
@@ -6,6 +6,8 @@ package orchestrator
 import (
 	"testing"
 
+	"github.com/gin-gonic/gin"
+
 	"akvorado/common/helpers"
 	"akvorado/common/httpserver"
 	"akvorado/common/reporter"
@@ -65,3 +67,78 @@ func TestConfigurationEndpoint(t *testing.T) {
 		},
 	})
 }
+
+func TestReplaceConfigurations(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		HTTP: h,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	c.RegisterConfiguration(InletService, map[string]string{"hello": "Hello world!"})
+	c.RegisterConfiguration(InletService, map[string]string{"hello": "Hello pal!"})
+	c.ReplaceConfigurations(InletService, []interface{}{
+		map[string]string{"hello": "Hello again!"},
+	})
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL:         "/api/v0/orchestrator/configuration/inlet/0",
+			ContentType: "application/x-yaml; charset=utf-8",
+			FirstLines:  []string{`hello: Hello again!`},
+		}, {
+			URL:         "/api/v0/orchestrator/configuration/inlet/1",
+			ContentType: "application/x-yaml; charset=utf-8",
+			FirstLines:  []string{`hello: Hello again!`},
+		},
+	})
+}
+
+func TestSubnetsEndpoint(t *testing.T) {
+	r := reporter.NewMock(t)
+	h := httpserver.NewMock(t, r)
+	c, err := New(r, DefaultConfiguration(), Dependencies{
+		HTTP: h,
+	})
+	if err != nil {
+		t.Fatalf("New() error:\n%+v", err)
+	}
+	type configuration struct {
+		Communities  *helpers.SubnetMap[string]
+		SamplingRate *helpers.SubnetMap[uint]
+	}
+	c.RegisterConfiguration(InletService, configuration{
+		Communities: helpers.MustNewSubnetMap(map[string]string{
+			"::/0":                 "public",
+			"::ffff:192.0.2.0/120": "private",
+		}),
+		SamplingRate: helpers.MustNewSubnetMap(map[string]uint{
+			"::ffff:198.51.100.0/120": 1000,
+		}),
+	})
+
+	helpers.TestHTTPEndpoints(t, h.LocalAddr(), helpers.HTTPEndpointCases{
+		{
+			URL: "/api/v0/orchestrator/subnets/inlet?ip=192.0.2.10",
+			JSONOutput: gin.H{"matches": []gin.H{
+				{"path": "0.communities", "subnet": "192.0.2.0/24", "value": "private"},
+			}},
+		}, {
+			URL: "/api/v0/orchestrator/subnets/inlet?ip=198.51.100.10",
+			JSONOutput: gin.H{"matches": []gin.H{
+				{"path": "0.communities", "subnet": "::/0", "value": "public"},
+				{"path": "0.samplingrate", "subnet": "198.51.100.0/24", "value": 1000},
+			}},
+		}, {
+			URL:         "/api/v0/orchestrator/subnets/inlet?ip=hello",
+			ContentType: "application/json; charset=utf-8",
+			StatusCode:  400,
+		}, {
+			URL:         "/api/v0/orchestrator/subnets/console?ip=192.0.2.10",
+			ContentType: "application/json; charset=utf-8",
+			StatusCode:  404,
+		},
+	})
+}
@@ -52,6 +52,7 @@ func New(r *reporter.Reporter, configuration Configuration, dependencies Depende
 
 	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/configuration/:service", c.configurationHandlerFunc)
 	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/configuration/:service/:index", c.configurationHandlerFunc)
+	c.d.HTTP.GinRouter.GET("/api/v0/orchestrator/subnets/:service", c.subnetsHandlerFunc)
 
 	return &c, nil
 }
@@ -65,3 +66,11 @@ func (c *Component) RegisterConfiguration(service ServiceType, configuration int
 	c.serviceConfigurations[service] = append(c.serviceConfigurations[service], configuration)
 	c.serviceLock.Unlock()
 }
+
+// ReplaceConfigurations replaces all the configurations for a service. This is
+// used when the configuration file is reloaded.
+func (c *Component) ReplaceConfigurations(service ServiceType, configurations []interface{}) {
+	c.serviceLock.Lock()
+	c.serviceConfigurations[service] = configurations
+	c.serviceLock.Unlock()
+}